@@ -22,6 +22,9 @@
 //   - Password changes invalidate the entry on next failed verification
 //   - Unused entries are purged after a configurable period (default: 30 days)
 //   - Account-wide invalidation is supported for account deletion
+//
+// App passwords that were used to log in are cached per address next to the
+// account password, so that logins with any of them are served locally.
 package authcache
 
 import (
@@ -126,6 +129,19 @@ func openAndValidate(dbPath string) (*sql.DB, error) {
 	);
 	CREATE INDEX IF NOT EXISTS idx_auth_cache_last_used ON auth_cache(last_used);
 	CREATE INDEX IF NOT EXISTS idx_auth_cache_account_id ON auth_cache(account_id);
+	CREATE TABLE IF NOT EXISTS auth_cache_app_passwords (
+		address TEXT NOT NULL,
+		app_password_id INTEGER NOT NULL,
+		account_id INTEGER NOT NULL,
+		password_hash TEXT NOT NULL,
+		protocols TEXT NOT NULL,
+		allowed_ips TEXT NOT NULL,
+		cached_at INTEGER NOT NULL,
+		last_used INTEGER NOT NULL,
+		PRIMARY KEY (address, app_password_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_auth_cache_app_passwords_last_used ON auth_cache_app_passwords(last_used);
+	CREATE INDEX IF NOT EXISTS idx_auth_cache_app_passwords_account_id ON auth_cache_app_passwords(account_id);
 	`
 	if _, err := sqliteDB.Exec(schema); err != nil {
 		sqliteDB.Close()
@@ -240,11 +256,103 @@ func (c *Cache) Invalidate(ctx context.Context, address string) error {
 	if err != nil {
 		return fmt.Errorf("failed to invalidate cache entry: %w", err)
 	}
+	_, err = c.db.ExecContext(ctx, `DELETE FROM auth_cache_app_passwords WHERE address = ?`, address)
+	if err != nil {
+		return fmt.Errorf("failed to invalidate cached app passwords: %w", err)
+	}
 
 	logger.Debug("AuthCache: Invalidated cache entry", "address", address)
 	return nil
 }
 
+// AppPassword is a cached app password of an address.
+type AppPassword struct {
+	ID             int64
+	AccountID      int64
+	HashedPassword string
+	Protocols      []string
+	AllowedIPs     []string
+}
+
+// GetAppPasswords retrieves the cached app passwords of the given address.
+// Returns ErrCacheMiss if none is cached or all have expired.
+func (c *Cache) GetAppPasswords(ctx context.Context, address string) ([]AppPassword, error) {
+	address = strings.ToLower(strings.TrimSpace(address))
+	if address == "" {
+		return nil, errors.New("address cannot be empty")
+	}
+
+	maxCachedAt := time.Now().Add(-c.maxAge).Unix()
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT app_password_id, account_id, password_hash, protocols, allowed_ips
+		FROM auth_cache_app_passwords
+		WHERE address = ? AND cached_at >= ?
+	`, address, maxCachedAt)
+	if err != nil {
+		metrics.AuthCacheOperations.WithLabelValues("error").Inc()
+		return nil, fmt.Errorf("auth cache query error: %w", err)
+	}
+	defer rows.Close()
+
+	var appPasswords []AppPassword
+	for rows.Next() {
+		var app AppPassword
+		var protocols, allowedIPs string
+		if err := rows.Scan(&app.ID, &app.AccountID, &app.HashedPassword, &protocols, &allowedIPs); err != nil {
+			metrics.AuthCacheOperations.WithLabelValues("error").Inc()
+			return nil, fmt.Errorf("auth cache query error: %w", err)
+		}
+		app.Protocols = splitList(protocols)
+		app.AllowedIPs = splitList(allowedIPs)
+		appPasswords = append(appPasswords, app)
+	}
+	if err := rows.Err(); err != nil {
+		metrics.AuthCacheOperations.WithLabelValues("error").Inc()
+		return nil, fmt.Errorf("auth cache query error: %w", err)
+	}
+	if len(appPasswords) == 0 {
+		return nil, ErrCacheMiss
+	}
+	return appPasswords, nil
+}
+
+// PutAppPassword stores an app password that was used to log in as address,
+// replacing any existing entry for the same app password.
+func (c *Cache) PutAppPassword(ctx context.Context, address string, app AppPassword) error {
+	address = strings.ToLower(strings.TrimSpace(address))
+	if address == "" {
+		return errors.New("address cannot be empty")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now().Unix()
+	_, err := c.db.ExecContext(ctx, `
+		INSERT INTO auth_cache_app_passwords (address, app_password_id, account_id, password_hash, protocols, allowed_ips, cached_at, last_used)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(address, app_password_id) DO UPDATE SET
+			account_id = excluded.account_id,
+			password_hash = excluded.password_hash,
+			protocols = excluded.protocols,
+			allowed_ips = excluded.allowed_ips,
+			cached_at = excluded.cached_at,
+			last_used = excluded.last_used
+	`, address, app.ID, app.AccountID, app.HashedPassword, strings.Join(app.Protocols, ","), strings.Join(app.AllowedIPs, ","), now, now)
+	if err != nil {
+		return fmt.Errorf("failed to cache app password: %w", err)
+	}
+	return nil
+}
+
+// splitList splits a comma-separated list, returning nil for an empty string.
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
 // InvalidateAccount removes all entries for an account.
 // This should be called on account deletion.
 func (c *Cache) InvalidateAccount(ctx context.Context, accountID int64) error {
@@ -257,6 +365,12 @@ func (c *Cache) InvalidateAccount(ctx context.Context, accountID int64) error {
 	}
 
 	count, _ := result.RowsAffected()
+	result, err = c.db.ExecContext(ctx, `DELETE FROM auth_cache_app_passwords WHERE account_id = ?`, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to invalidate account cache: %w", err)
+	}
+	appCount, _ := result.RowsAffected()
+	count += appCount
 	if count > 0 {
 		logger.Info("AuthCache: Invalidated account cache", "account_id", accountID, "entries_removed", count)
 	}
@@ -299,6 +413,9 @@ func (c *Cache) cleanup(ctx context.Context) {
 	} else if count, _ := result1.RowsAffected(); count > 0 {
 		logger.Info("AuthCache: Purged expired entries", "count", count, "max_age", c.maxAge)
 	}
+	if _, err := c.db.ExecContext(ctx, `DELETE FROM auth_cache_app_passwords WHERE cached_at < ? OR last_used < ?`, maxAgeThreshold, now.Add(-c.purgeUnused).Unix()); err != nil {
+		logger.Error("AuthCache: Failed to purge app password entries", "error", err)
+	}
 
 	// Remove entries unused for longer than purge_unused
 	purgeUnusedThreshold := now.Add(-c.purgeUnused).Unix()
@@ -253,6 +253,62 @@ func TestInvalidateAccount(t *testing.T) {
 	}
 }
 
+func TestAppPasswords(t *testing.T) {
+	c := newTestCache(t)
+	ctx := context.Background()
+
+	if _, err := c.GetAppPasswords(ctx, "user@example.com"); err != ErrCacheMiss {
+		t.Fatalf("expected ErrCacheMiss, got %v", err)
+	}
+
+	phone := AppPassword{ID: 1, AccountID: 42, HashedPassword: "{SHA512}phone", Protocols: []string{"imap", "submission"}}
+	laptop := AppPassword{ID: 2, AccountID: 42, HashedPassword: "{SHA512}laptop", Protocols: []string{"imap"}, AllowedIPs: []string{"192.0.2.0/24"}}
+	for _, app := range []AppPassword{phone, laptop} {
+		if err := c.PutAppPassword(ctx, "User@Example.com", app); err != nil {
+			t.Fatalf("PutAppPassword() error: %v", err)
+		}
+	}
+	c.Put(ctx, "user@example.com", 42, "hash")
+
+	apps, err := c.GetAppPasswords(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("GetAppPasswords() error: %v", err)
+	}
+	if len(apps) != 2 {
+		t.Fatalf("got %d app passwords, want 2", len(apps))
+	}
+	for _, app := range apps {
+		want := phone
+		if app.ID == laptop.ID {
+			want = laptop
+		}
+		if app.AccountID != want.AccountID || app.HashedPassword != want.HashedPassword ||
+			len(app.Protocols) != len(want.Protocols) || len(app.AllowedIPs) != len(want.AllowedIPs) {
+			t.Errorf("app password %d = %+v, want %+v", app.ID, app, want)
+		}
+	}
+
+	// Invalidating the address drops its app passwords too
+	if err := c.Invalidate(ctx, "user@example.com"); err != nil {
+		t.Fatalf("Invalidate() error: %v", err)
+	}
+	if _, err := c.GetAppPasswords(ctx, "user@example.com"); err != ErrCacheMiss {
+		t.Errorf("expected ErrCacheMiss after Invalidate, got %v", err)
+	}
+
+	c.PutAppPassword(ctx, "user@example.com", phone)
+	c.PutAppPassword(ctx, "other@example.com", AppPassword{ID: 3, AccountID: 99, HashedPassword: "h", Protocols: []string{"pop3"}})
+	if err := c.InvalidateAccount(ctx, 42); err != nil {
+		t.Fatalf("InvalidateAccount() error: %v", err)
+	}
+	if _, err := c.GetAppPasswords(ctx, "user@example.com"); err != ErrCacheMiss {
+		t.Errorf("expected ErrCacheMiss after InvalidateAccount, got %v", err)
+	}
+	if _, err := c.GetAppPasswords(ctx, "other@example.com"); err != nil {
+		t.Errorf("other account should remain cached, got %v", err)
+	}
+}
+
 func TestStats(t *testing.T) {
 	c := newTestCache(t)
 	ctx := context.Background()
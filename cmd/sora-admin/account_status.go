@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+)
+
+func handleSetAccountStatus(ctx context.Context) {
+	fs := flag.NewFlagSet("accounts set-status", flag.ContinueOnError)
+	email := fs.String("email", "", "Email address of the account")
+	status := fs.String("status", "", "New status: "+strings.Join(db.AccountStatuses, ", "))
+	reason := fs.String("reason", "", "Reason for the status change")
+	expires := fs.String("expires", "", "Revert to active at this time (YYYY-MM-DD, RFC3339 or duration, e.g. 720h)")
+	deleteAt := fs.String("delete-at", "", "Soft-delete the account at this time (YYYY-MM-DD, RFC3339 or duration)")
+	noKick := fs.Bool("no-kick", false, "Do not kick live sessions when logins become blocked")
+
+	fs.Usage = func() {
+		fmt.Printf(`Set the lifecycle status of an account
+
+  active         normal operation
+  suspended      logins and deliveries are refused
+  receive-only   logins are refused, mail is still delivered
+  send-disabled  logins and deliveries are allowed, submission is refused
+
+The status, reason, expiry and scheduled deletion are all replaced. When the
+new status refuses logins, live sessions are kicked through the admin API
+(http_api_addr) unless --no-kick is given.
+
+Usage:
+  sora-admin accounts set-status --email <email> --status <status> [options]
+
+Options:
+  --email string      Email address of the account (required)
+  --status string     New status (required)
+  --reason string     Reason for the status change
+  --expires string    Revert to active at this time (YYYY-MM-DD, RFC3339 or duration, e.g. 720h)
+  --delete-at string  Soft-delete the account at this time (YYYY-MM-DD, RFC3339 or duration)
+  --no-kick           Do not kick live sessions
+
+Examples:
+  sora-admin accounts set-status --email user@example.com --status receive-only --reason "Unpaid invoice"
+  sora-admin accounts set-status --email user@example.com --status suspended --expires 72h
+  sora-admin accounts set-status --email user@example.com --status send-disabled --delete-at 2026-12-31T00:00:00Z
+  sora-admin accounts set-status --email user@example.com --status active
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *email == "" || *status == "" {
+		fmt.Println("Error: --email and --status are required")
+		fs.Usage()
+		exit(1)
+	}
+
+	accountStatus := db.AccountStatus{Status: *status, Reason: *reason}
+	var err error
+	if accountStatus.ExpiresAt, err = parseStatusTime(*expires); err != nil {
+		fmt.Printf("Error: invalid --expires: %v\n\n", err)
+		fs.Usage()
+		exit(1)
+	}
+	if accountStatus.DeleteAt, err = parseStatusTime(*deleteAt); err != nil {
+		fmt.Printf("Error: invalid --delete-at: %v\n\n", err)
+		fs.Usage()
+		exit(1)
+	}
+
+	if err := setAccountStatus(ctx, globalConfig, *email, accountStatus); err != nil {
+		logger.Fatalf("Failed to set account status: %v", err)
+	}
+	fmt.Printf("Status of %s set to %s\n", *email, *status)
+
+	if !db.AccountStatusAllowsLogin(*status) && !*noKick {
+		if globalConfig.HTTPAPIAddr == "" {
+			fmt.Println("Warning: http_api_addr is not configured, live sessions were not kicked")
+			return
+		}
+		if err := kickConnections(ctx, globalConfig, *email, "", "", "", false, true); err != nil {
+			fmt.Printf("Warning: failed to kick live sessions: %v\n", err)
+		}
+	}
+}
+
+// parseStatusTime parses a date accepted by parseTimeFlag or a duration from
+// now. An empty value returns nil.
+func parseStatusTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		t := time.Now().Add(d)
+		return &t, nil
+	}
+	t, err := parseTimeFlag(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %q (use YYYY-MM-DD, RFC3339 or a duration)", value)
+	}
+	return &t, nil
+}
+
+func setAccountStatus(ctx context.Context, cfg AdminConfig, email string, status db.AccountStatus) error {
+	rdb, err := newAdminDatabase(ctx, &cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to initialize resilient database: %w", err)
+	}
+	defer rdb.Close()
+
+	if _, err := rdb.SetAccountStatusWithRetry(ctx, email, status); err != nil {
+		if errors.Is(err, consts.ErrUserNotFound) {
+			return fmt.Errorf("account with email %s does not exist", email)
+		}
+		return err
+	}
+	return nil
+}
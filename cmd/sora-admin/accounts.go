@@ -20,7 +20,7 @@ import (
 func handleAccountsCommand(ctx context.Context) {
 	if len(os.Args) < 3 {
 		printAccountsUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	subcommand := os.Args[2]
@@ -39,18 +39,34 @@ func handleAccountsCommand(ctx context.Context) {
 		handleRestoreAccount(ctx)
 	case "purge-domain":
 		handlePurgeDomain(ctx)
+	case "quota":
+		handleShowQuota(ctx)
+	case "set-quota":
+		handleSetQuota(ctx)
+	case "domain-quota":
+		handleDomainQuota(ctx)
+	case "set-status":
+		handleSetAccountStatus(ctx)
+	case "app-passwords":
+		handleListAppPasswords(ctx)
+	case "app-password-create":
+		handleCreateAppPassword(ctx)
+	case "app-password-revoke":
+		handleRevokeAppPassword(ctx)
+	case "totp-reset":
+		handleResetTOTP(ctx)
 	case "help", "--help", "-h":
 		printAccountsUsage()
 	default:
 		fmt.Printf("Unknown accounts subcommand: %s\n\n", subcommand)
 		printAccountsUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
 func handleCreateAccount(ctx context.Context) {
 	// Parse accounts create specific flags
-	fs := flag.NewFlagSet("accounts create", flag.ExitOnError)
+	fs := flag.NewFlagSet("accounts create", flag.ContinueOnError)
 
 	email := fs.String("email", "", "Email address for the new account (required unless --credentials is provided)")
 	password := fs.String("password", "", "Password for the new account (required unless --password-hash or --credentials is provided)")
@@ -86,34 +102,32 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	if *credentials == "" && *email == "" {
 		fmt.Printf("Error: either --email or --credentials is required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	if *credentials != "" && (*email != "" || *password != "" || *passwordHash != "") {
 		fmt.Printf("Error: cannot specify --credentials with --email, --password, or --password-hash\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	if *credentials == "" {
 		if *password == "" && *passwordHash == "" {
 			fmt.Printf("Error: either --password or --password-hash is required\n\n")
 			fs.Usage()
-			os.Exit(1)
+			exit(1)
 		}
 
 		if *password != "" && *passwordHash != "" {
 			fmt.Printf("Error: cannot specify both --password and --password-hash\n\n")
 			fs.Usage()
-			os.Exit(1)
+			exit(1)
 		}
 	}
 
@@ -129,7 +143,7 @@ Examples:
 	if !hashTypeValid {
 		fmt.Printf("Error: --hash must be one of: %s\n\n", strings.Join(validHashTypes, ", "))
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Create the account
@@ -150,7 +164,7 @@ Examples:
 
 func handleListAccounts(ctx context.Context) {
 	// Parse list-accounts specific flags
-	fs := flag.NewFlagSet("accounts list", flag.ExitOnError)
+	fs := flag.NewFlagSet("accounts list", flag.ContinueOnError)
 	domain := fs.String("domain", "", "Domain to list accounts for (e.g., example.com) (required)")
 
 	fs.Usage = func() {
@@ -177,15 +191,13 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	if *domain == "" {
 		fmt.Printf("Error: --domain is required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// List accounts
@@ -196,7 +208,7 @@ Examples:
 
 func handleShowAccount(ctx context.Context) {
 	// Parse show-account specific flags
-	fs := flag.NewFlagSet("accounts show", flag.ExitOnError)
+	fs := flag.NewFlagSet("accounts show", flag.ContinueOnError)
 	email := fs.String("email", "", "Email address of the account to show")
 	jsonOutput := fs.Bool("json", false, "Output in JSON format")
 
@@ -225,15 +237,13 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	if *email == "" {
 		fmt.Println("Error: --email is required")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Show the account details
@@ -244,7 +254,7 @@ Examples:
 
 func handleUpdateAccount(ctx context.Context) {
 	// Parse update-account specific flags
-	fs := flag.NewFlagSet("accounts update", flag.ExitOnError)
+	fs := flag.NewFlagSet("accounts update", flag.ContinueOnError)
 
 	email := fs.String("email", "", "Email address for the account to update (required)")
 	password := fs.String("password", "", "New password for the account (optional if --password-hash or --make-primary is provided)")
@@ -277,27 +287,25 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	if *email == "" {
 		fmt.Printf("Error: --email is required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	if *password == "" && *passwordHash == "" && !*makePrimary {
 		fmt.Printf("Error: either --password, --password-hash, or --make-primary must be specified\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	if *password != "" && *passwordHash != "" {
 		fmt.Printf("Error: cannot specify both --password and --password-hash\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Validate hash type
@@ -312,7 +320,7 @@ Examples:
 	if !hashTypeValid {
 		fmt.Printf("Error: --hash must be one of: %s\n\n", strings.Join(validHashTypes, ", "))
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Update the account
@@ -332,7 +340,7 @@ Examples:
 
 func handleDeleteAccount(ctx context.Context) {
 	// Parse delete-account specific flags
-	fs := flag.NewFlagSet("accounts delete", flag.ExitOnError)
+	fs := flag.NewFlagSet("accounts delete", flag.ContinueOnError)
 
 	email := fs.String("email", "", "Email address for the account to delete (required)")
 	confirm := fs.Bool("confirm", false, "Confirm account deletion (required)")
@@ -368,21 +376,19 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	if *email == "" {
 		fmt.Printf("Error: --email is required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	if !*confirm {
 		fmt.Printf("Error: --confirm is required for account deletion\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Delete the account
@@ -399,7 +405,7 @@ Examples:
 
 func handleRestoreAccount(ctx context.Context) {
 	// Parse accounts restore specific flags
-	fs := flag.NewFlagSet("accounts restore", flag.ExitOnError)
+	fs := flag.NewFlagSet("accounts restore", flag.ContinueOnError)
 
 	email := fs.String("email", "", "Email address for the account to restore (required)")
 
@@ -423,15 +429,13 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	if *email == "" {
 		fmt.Printf("Error: --email is required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Restore the account
@@ -444,7 +448,7 @@ Examples:
 
 func handlePurgeDomain(ctx context.Context) {
 	// Parse purge-domain specific flags
-	fs := flag.NewFlagSet("accounts purge-domain", flag.ExitOnError)
+	fs := flag.NewFlagSet("accounts purge-domain", flag.ContinueOnError)
 
 	domain := fs.String("domain", "", "Domain to purge (e.g., example.com) (required)")
 	confirm := fs.Bool("confirm", false, "Confirm domain purge (required for safety)")
@@ -482,21 +486,19 @@ Examples:
 	}
 
 	// Parse the remaining arguments
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	if *domain == "" {
 		fmt.Printf("Error: --domain is required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	if !*confirm {
 		fmt.Printf("Error: --confirm is required for domain purge\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Purge the domain
@@ -514,13 +516,21 @@ Usage:
   sora-admin accounts <subcommand> [options]
 
 Subcommands:
-  create        Create a new account
-  list          List accounts for a specific domain
-  show          Show detailed information for a specific account
-  update        Update an existing account's password
-  delete        Delete an account (soft delete with grace period, or hard delete with --purge)
-  restore       Restore a soft-deleted account
-  purge-domain  Purge all accounts in a domain (irreversible, resumable)
+  create               Create a new account
+  list                 List accounts for a specific domain
+  show                 Show detailed information for a specific account
+  update               Update an existing account's password
+  delete               Delete an account (soft delete with grace period, or hard delete with --purge)
+  restore              Restore a soft-deleted account
+  purge-domain         Purge all accounts in a domain (irreversible, resumable)
+  quota                Show quota limits and usage of an account
+  set-quota            Set the storage and message limits of an account
+  domain-quota         Show or set the default quota of a domain
+  set-status           Suspend, restrict or reactivate an account
+  app-passwords        List the app passwords of an account
+  app-password-create  Create an app password for some protocols
+  app-password-revoke  Revoke an app password
+  totp-reset           Remove the TOTP second factor of an account
 
 Examples:
   sora-admin accounts create --email user@example.com --password mypassword
@@ -531,6 +541,10 @@ Examples:
   sora-admin accounts delete --email user@example.com --confirm --purge
   sora-admin accounts restore --email user@example.com
   sora-admin accounts purge-domain --domain example.com --confirm
+  sora-admin accounts set-quota --email user@example.com --storage 10gb
+  sora-admin accounts domain-quota --domain example.com --storage 5gb
+  sora-admin accounts set-status --email user@example.com --status suspended --reason "Abuse"
+  sora-admin accounts app-password-create --email user@example.com --name "Phone" --protocols imap,submission
 
 Use 'sora-admin accounts <subcommand> --help' for detailed help.
 `)
@@ -692,6 +706,15 @@ func showAccount(ctx context.Context, cfg AdminConfig, email string, jsonOutput
 		fmt.Printf("  Account ID:    %d\n", accountDetails.ID)
 		fmt.Printf("  Primary Email: %s\n", accountDetails.PrimaryEmail)
 		fmt.Printf("  Status:        %s\n", accountDetails.Status)
+		if accountDetails.StatusReason != "" {
+			fmt.Printf("  Reason:        %s\n", accountDetails.StatusReason)
+		}
+		if accountDetails.StatusExpiresAt != nil {
+			fmt.Printf("  Status Until:  %s\n", accountDetails.StatusExpiresAt.UTC().Format("2006-01-02 15:04:05 UTC"))
+		}
+		if accountDetails.DeleteScheduledAt != nil {
+			fmt.Printf("  Delete At:     %s\n", accountDetails.DeleteScheduledAt.UTC().Format("2006-01-02 15:04:05 UTC"))
+		}
 		fmt.Printf("  Created:       %s\n", accountDetails.CreatedAt.Format("2006-01-02 15:04:05 UTC"))
 
 		if accountDetails.DeletedAt != nil {
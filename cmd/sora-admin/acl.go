@@ -15,7 +15,7 @@ import (
 func handleACLCommand(ctx context.Context) {
 	if len(os.Args) < 3 {
 		printACLUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	subcommand := os.Args[2]
@@ -31,31 +31,31 @@ func handleACLCommand(ctx context.Context) {
 	default:
 		fmt.Printf("Unknown acl subcommand: %s\n\n", subcommand)
 		printACLUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
 // handleACLGrant grants ACL rights to a user or identifier on a mailbox
 func handleACLGrant(ctx context.Context) {
-	fs := flag.NewFlagSet("acl grant", flag.ExitOnError)
+	fs := flag.NewFlagSet("acl grant", flag.ContinueOnError)
 	email := fs.String("email", "", "Email address of the mailbox owner (required)")
 	mailbox := fs.String("mailbox", "", "Mailbox name, e.g., 'Shared/Sales' (required)")
 	identifier := fs.String("identifier", "", "Email address or 'anyone' (required, can also use --user)")
 	user := fs.String("user", "", "Alias for --identifier")
 	rights := fs.String("rights", "", "ACL rights string, e.g., 'lrs' (required)")
 
-	fs.Parse(os.Args[3:])
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required parameters
 	if *email == "" {
 		fmt.Println("Error: --email is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 	if *mailbox == "" {
 		fmt.Println("Error: --mailbox is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Use --user if --identifier is not provided
@@ -66,20 +66,20 @@ func handleACLGrant(ctx context.Context) {
 	if targetIdentifier == "" {
 		fmt.Println("Error: --identifier or --user is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 
 	if *rights == "" {
 		fmt.Println("Error: --rights is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Create database connection
 	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
 	if err != nil {
 		fmt.Printf("Failed to connect to database: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 	defer rdb.Close()
 
@@ -96,7 +96,7 @@ func handleACLGrant(ctx context.Context) {
 	err = aclSvc.Grant(ctxWithConfig, *email, *mailbox, targetIdentifier, *rights)
 	if err != nil {
 		fmt.Printf("Failed to grant ACL: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	fmt.Printf("Successfully granted rights '%s' to '%s' on mailbox '%s' (owner: %s)\n",
@@ -105,24 +105,24 @@ func handleACLGrant(ctx context.Context) {
 
 // handleACLRevoke revokes ACL rights from a user or identifier on a mailbox
 func handleACLRevoke(ctx context.Context) {
-	fs := flag.NewFlagSet("acl revoke", flag.ExitOnError)
+	fs := flag.NewFlagSet("acl revoke", flag.ContinueOnError)
 	email := fs.String("email", "", "Email address of the mailbox owner (required)")
 	mailbox := fs.String("mailbox", "", "Mailbox name, e.g., 'Shared/Sales' (required)")
 	identifier := fs.String("identifier", "", "Email address or 'anyone' (required, can also use --user)")
 	user := fs.String("user", "", "Alias for --identifier")
 
-	fs.Parse(os.Args[3:])
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required parameters
 	if *email == "" {
 		fmt.Println("Error: --email is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 	if *mailbox == "" {
 		fmt.Println("Error: --mailbox is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Use --user if --identifier is not provided
@@ -133,14 +133,14 @@ func handleACLRevoke(ctx context.Context) {
 	if targetIdentifier == "" {
 		fmt.Println("Error: --identifier or --user is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Create database connection
 	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
 	if err != nil {
 		fmt.Printf("Failed to connect to database: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 	defer rdb.Close()
 
@@ -157,7 +157,7 @@ func handleACLRevoke(ctx context.Context) {
 	err = aclSvc.Revoke(ctxWithConfig, *email, *mailbox, targetIdentifier)
 	if err != nil {
 		fmt.Printf("Failed to revoke ACL: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	fmt.Printf("Successfully revoked access for '%s' on mailbox '%s' (owner: %s)\n",
@@ -166,29 +166,29 @@ func handleACLRevoke(ctx context.Context) {
 
 // handleACLList lists all ACL entries for a mailbox
 func handleACLList(ctx context.Context) {
-	fs := flag.NewFlagSet("acl list", flag.ExitOnError)
+	fs := flag.NewFlagSet("acl list", flag.ContinueOnError)
 	email := fs.String("email", "", "Email address of the mailbox owner (required)")
 	mailbox := fs.String("mailbox", "", "Mailbox name, e.g., 'Shared/Sales' (required)")
 
-	fs.Parse(os.Args[3:])
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required parameters
 	if *email == "" {
 		fmt.Println("Error: --email is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 	if *mailbox == "" {
 		fmt.Println("Error: --mailbox is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Create database connection
 	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
 	if err != nil {
 		fmt.Printf("Failed to connect to database: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 	defer rdb.Close()
 
@@ -205,7 +205,7 @@ func handleACLList(ctx context.Context) {
 	acls, err := aclSvc.List(ctxWithConfig, *email, *mailbox)
 	if err != nil {
 		fmt.Printf("Failed to list ACLs: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Print results
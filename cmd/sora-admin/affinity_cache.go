@@ -14,7 +14,7 @@ import (
 func handleAffinityCacheCommand(ctx context.Context) {
 	if len(os.Args) < 3 {
 		printAffinityCacheUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	subcommand := os.Args[2]
@@ -26,7 +26,7 @@ func handleAffinityCacheCommand(ctx context.Context) {
 	default:
 		fmt.Printf("Unknown affinity-cache subcommand: %s\n\n", subcommand)
 		printAffinityCacheUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
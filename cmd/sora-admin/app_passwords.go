@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+)
+
+func handleListAppPasswords(ctx context.Context) {
+	fs := flag.NewFlagSet("accounts app-passwords", flag.ContinueOnError)
+	email := fs.String("email", "", "Email address of the account")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+
+	fs.Usage = func() {
+		fmt.Printf(`List the app passwords of an account
+
+Usage:
+  sora-admin accounts app-passwords --email <email> [options]
+
+Options:
+  --email string   Email address of the account (required)
+  --json           Output in JSON format instead of human-readable format
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *email == "" {
+		fmt.Println("Error: --email is required")
+		fs.Usage()
+		exit(1)
+	}
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	accountID, err := rdb.GetAccountIDByAddressWithRetry(ctx, *email)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserNotFound) {
+			logger.Fatalf("Account with email %s does not exist", *email)
+		}
+		logger.Fatalf("Failed to look up account: %v", err)
+	}
+
+	appPasswords, err := rdb.ListAppPasswordsWithRetry(ctx, accountID)
+	if err != nil {
+		logger.Fatalf("Failed to list app passwords: %v", err)
+	}
+
+	if *jsonOutput {
+		printJSON(appPasswords)
+		return
+	}
+
+	if len(appPasswords) == 0 {
+		fmt.Println("No app passwords found.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPROTOCOLS\tALLOWED IPS\tCREATED\tLAST USED")
+	for _, a := range appPasswords {
+		allowedIPs := "any"
+		if len(a.AllowedIPs) > 0 {
+			allowedIPs = strings.Join(a.AllowedIPs, ",")
+		}
+		lastUsed := "never"
+		if a.LastUsedAt != nil {
+			lastUsed = a.LastUsedAt.Format("2006-01-02 15:04:05")
+			if a.LastUsedIP != "" {
+				lastUsed += " from " + a.LastUsedIP
+			}
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", a.ID, a.Name, strings.Join(a.Protocols, ","), allowedIPs,
+			a.CreatedAt.Format("2006-01-02 15:04:05"), lastUsed)
+	}
+	w.Flush()
+}
+
+func handleCreateAppPassword(ctx context.Context) {
+	fs := flag.NewFlagSet("accounts app-password-create", flag.ContinueOnError)
+	email := fs.String("email", "", "Email address of the account")
+	name := fs.String("name", "", "Name of the app password, e.g. the device it is used on")
+	protocols := fs.String("protocols", "", "Comma-separated protocols: "+strings.Join(db.AppPasswordProtocols, ", "))
+	allowedIPs := fs.String("allowed-ips", "", "Comma-separated IP addresses or CIDR networks it may be used from")
+
+	fs.Usage = func() {
+		fmt.Printf(`Create an app password for an account
+
+An app password is a generated secret that is accepted instead of the account
+password, but only for the given protocols and, optionally, client networks.
+The password is printed once and cannot be retrieved later.
+
+Usage:
+  sora-admin accounts app-password-create --email <email> --name <name> --protocols <list> [options]
+
+Options:
+  --email string         Email address of the account (required)
+  --name string          Name of the app password (required)
+  --protocols string     Comma-separated protocols (required): %s
+  --allowed-ips string   Comma-separated IP addresses or CIDR networks (default: any)
+
+Examples:
+  sora-admin accounts app-password-create --email user@example.com --name "Phone" --protocols imap,submission
+  sora-admin accounts app-password-create --email user@example.com --name "Backup" --protocols imap --allowed-ips 192.0.2.0/24
+`, strings.Join(db.AppPasswordProtocols, ", "))
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *email == "" || *name == "" || *protocols == "" {
+		fmt.Println("Error: --email, --name and --protocols are required")
+		fs.Usage()
+		exit(1)
+	}
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	accountID, err := rdb.GetAccountIDByAddressWithRetry(ctx, *email)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserNotFound) {
+			logger.Fatalf("Account with email %s does not exist", *email)
+		}
+		logger.Fatalf("Failed to look up account: %v", err)
+	}
+
+	appPassword, secret, err := rdb.CreateAppPasswordWithRetry(ctx, accountID, db.AppPassword{
+		Name:       *name,
+		Protocols:  splitList(*protocols),
+		AllowedIPs: splitList(*allowedIPs),
+	})
+	if err != nil {
+		if errors.Is(err, consts.ErrDBUniqueViolation) {
+			logger.Fatalf("Account %s already has an app password named %q", *email, *name)
+		}
+		logger.Fatalf("Failed to create app password: %v", err)
+	}
+
+	fmt.Printf("Created app password %q (ID %d) for %s\n", appPassword.Name, appPassword.ID, *email)
+	fmt.Printf("Protocols: %s\n", strings.Join(appPassword.Protocols, ", "))
+	if len(appPassword.AllowedIPs) > 0 {
+		fmt.Printf("Allowed IPs: %s\n", strings.Join(appPassword.AllowedIPs, ", "))
+	}
+	fmt.Printf("\nPassword: %s\n\nThe password is not shown again.\n", secret)
+}
+
+func handleRevokeAppPassword(ctx context.Context) {
+	fs := flag.NewFlagSet("accounts app-password-revoke", flag.ContinueOnError)
+	email := fs.String("email", "", "Email address of the account")
+	id := fs.Int64("id", 0, "ID of the app password")
+	noKick := fs.Bool("no-kick", false, "Do not kick live sessions")
+
+	fs.Usage = func() {
+		fmt.Printf(`Revoke an app password
+
+Live sessions of the account are kicked through the admin API (http_api_addr)
+so that clients using the app password have to log in again, unless --no-kick
+is given.
+
+Usage:
+  sora-admin accounts app-password-revoke --email <email> --id <id> [options]
+
+Options:
+  --email string   Email address of the account (required)
+  --id int         ID of the app password, see 'accounts app-passwords' (required)
+  --no-kick        Do not kick live sessions
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *email == "" || *id <= 0 {
+		fmt.Println("Error: --email and --id are required")
+		fs.Usage()
+		exit(1)
+	}
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	accountID, err := rdb.GetAccountIDByAddressWithRetry(ctx, *email)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserNotFound) {
+			logger.Fatalf("Account with email %s does not exist", *email)
+		}
+		logger.Fatalf("Failed to look up account: %v", err)
+	}
+
+	if err := rdb.DeleteAppPasswordWithRetry(ctx, accountID, *id); err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			logger.Fatalf("Account %s has no app password with ID %d", *email, *id)
+		}
+		logger.Fatalf("Failed to revoke app password: %v", err)
+	}
+	fmt.Printf("Revoked app password %d of %s\n", *id, *email)
+
+	if *noKick {
+		return
+	}
+	if globalConfig.HTTPAPIAddr == "" {
+		fmt.Println("Warning: http_api_addr is not configured, live sessions were not kicked")
+		return
+	}
+	if err := kickConnections(ctx, globalConfig, *email, "", "", "", false, true); err != nil {
+		fmt.Printf("Warning: failed to kick live sessions: %v\n", err)
+	}
+}
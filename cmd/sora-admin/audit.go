@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+)
+
+// auditedSubcommands lists the subcommands that modify state and are recorded
+// in the admin audit log, per command. Commands without subcommands that
+// modify state are listed without subcommands.
+var auditedSubcommands = map[string][]string{
+	"accounts":     {"create", "update", "delete", "restore", "purge-domain", "set-quota", "domain-quota", "set-status", "app-password-create", "app-password-revoke", "totp-reset"},
+	"acl":          {"grant", "revoke"},
+	"credentials":  {"add", "delete"},
+	"domains":      {"create", "update", "suspend", "activate", "delete", "alias-add", "alias-update", "alias-delete"},
+	"mailbox":      {"create", "delete", "rename", "subscribe", "unsubscribe", "fix-utf7"},
+	"cache":        {"purge"},
+	"connections":  {"kick"},
+	"affinity":     {"set", "delete"},
+	"migrate":      {"up", "down", "force"},
+	"import":       {"maildir", "files", "s3"},
+	"migrate-imap": nil,
+	"uploader":     {"resolve"},
+	"messages":     {"restore"},
+	"relay":        {"delete", "requeue"},
+	"sieve":        {"create", "update", "delete"},
+	"storage":      {"rotate-keys"},
+	"tls":          {"delete", "del", "rm", "clean"},
+	"verify":       {"s3"},
+}
+
+// cliAudit is the audit entry of the running subcommand, or nil if the
+// subcommand is not audited.
+var cliAudit *db.AdminAuditEntry
+
+// startCLIAudit prepares the audit entry for a mutating subcommand. args are
+// the arguments following the command name. The entry is written by
+// finishCLIAudit when the subcommand returns, by exit when it exits, or by the
+// logger's fatal hook when it fails.
+func startCLIAudit(command string, args []string) {
+	subcommands, audited := auditedSubcommands[command]
+	if !audited {
+		return
+	}
+	action, subcommand, flags := command, "", args
+	if len(subcommands) > 0 {
+		if len(args) == 0 || !slices.Contains(subcommands, args[0]) {
+			return
+		}
+		subcommand, flags = args[0], args[1:]
+		action = command + "." + subcommand
+	}
+
+	// domain-quota only modifies state when a new default is given, and
+	// verify s3 only when it fixes what it finds
+	if subcommand == "domain-quota" && !hasAnyFlag(flags, "storage", "messages", "delete") {
+		return
+	}
+	if action == "verify.s3" && !hasAnyFlag(flags, "fix-orphaned", "fix-missing") {
+		return
+	}
+
+	entry := &db.AdminAuditEntry{
+		Actor:         "cli:" + currentUsername(),
+		Source:        db.AuditSourceCLI,
+		Action:        action,
+		TargetAccount: firstFlagValue(flags, "email", "primary", "user", "address"),
+		TargetMailbox: firstFlagValue(flags, "mailbox", "old-name"),
+		PayloadHash:   hashArgs(flags),
+	}
+	if entry.TargetAccount == "" {
+		if domain := flagValue(flags, "domain"); domain != "" {
+			entry.TargetAccount = "@" + domain
+		}
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		entry.SourceIP = hostname
+	}
+	cliAudit = entry
+
+	logger.SetFatalHook(func(msg string) {
+		finishCLIAudit(context.Background(), msg)
+	})
+}
+
+// finishCLIAudit records the prepared audit entry, if any. An empty errMsg
+// records success. Failures to write the entry are reported but do not change
+// the outcome of the subcommand.
+func finishCLIAudit(ctx context.Context, errMsg string) {
+	entry := cliAudit
+	if entry == nil {
+		return
+	}
+	cliAudit = nil
+
+	entry.Result = db.AuditResultSuccess
+	if errMsg != "" {
+		entry.Result = db.AuditResultFailure
+		entry.StatusCode = 1
+		entry.Error = errMsg
+	}
+
+	// The subcommand may have been interrupted; the record must still be written
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record audit entry: %v\n", err)
+		return
+	}
+	defer rdb.Close()
+
+	if _, err := rdb.InsertAdminAuditEntryWithRetry(ctx, *entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record audit entry: %v\n", err)
+	}
+}
+
+// exit ends sora-admin with code after recording the audit entry of the
+// running subcommand, which os.Exit alone would skip. Subcommands must exit
+// through it rather than call os.Exit.
+func exit(code int) {
+	errMsg := ""
+	if code != 0 {
+		errMsg = fmt.Sprintf("exit status %d", code)
+	}
+	finishCLIAudit(context.Background(), errMsg)
+	os.Exit(code)
+}
+
+// parseFlags parses the flags of a subcommand. Flag sets are created with
+// flag.ContinueOnError so that a parse error exits through exit and the
+// invocation is audited; it exits with 2 like flag.ContinueOnError. --help exits
+// with 0 and is not audited since the subcommand does not run.
+func parseFlags(fs *flag.FlagSet, args []string) {
+	err := fs.Parse(args)
+	if err == nil {
+		return
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		cliAudit = nil
+		exit(0)
+	}
+	exit(2)
+}
+
+// currentUsername returns the name of the OS user running sora-admin.
+func currentUsername() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "unknown"
+}
+
+// secretFlags are the flags whose values are redacted before the arguments
+// are hashed.
+var secretFlags = []string{"password", "password-hash"}
+
+// hashArgs returns the hex SHA-256 of the NUL-joined arguments, so that the
+// audit log can tell invocations apart. The values of secretFlags are
+// redacted first: an unsalted hash of a short or common password could be
+// reversed by hashing candidates with the other, known arguments.
+func hashArgs(args []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(redactArgs(args), "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// redactArgs returns a copy of args with the values of secretFlags replaced,
+// accepting both "--name value" and "--name=value".
+func redactArgs(args []string) []string {
+	redacted := slices.Clone(args)
+	for i, arg := range redacted {
+		trimmed := strings.TrimLeft(arg, "-")
+		if trimmed == arg {
+			continue
+		}
+		name, _, hasValue := strings.Cut(trimmed, "=")
+		if !slices.Contains(secretFlags, name) {
+			continue
+		}
+		if hasValue {
+			redacted[i] = arg[:len(arg)-len(trimmed)] + name + "=REDACTED"
+		} else if i+1 < len(redacted) {
+			redacted[i+1] = "REDACTED"
+		}
+	}
+	return redacted
+}
+
+// flagValue returns the value of --name or -name in args, accepting both
+// "--name value" and "--name=value".
+func flagValue(args []string, name string) string {
+	for i, arg := range args {
+		trimmed := strings.TrimLeft(arg, "-")
+		if trimmed == arg {
+			continue
+		}
+		if trimmed == name && i+1 < len(args) {
+			return args[i+1]
+		}
+		if value, ok := strings.CutPrefix(trimmed, name+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// firstFlagValue returns the value of the first of names that is set.
+func firstFlagValue(args []string, names ...string) string {
+	for _, name := range names {
+		if value := flagValue(args, name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// hasAnyFlag reports whether any of names is present in args.
+func hasAnyFlag(args []string, names ...string) bool {
+	for _, arg := range args {
+		trimmed := strings.TrimLeft(arg, "-")
+		if trimmed == arg {
+			continue
+		}
+		name, _, _ := strings.Cut(trimmed, "=")
+		if slices.Contains(names, name) {
+			return true
+		}
+	}
+	return false
+}
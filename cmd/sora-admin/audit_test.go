@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/migadu/sora/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlagValue(t *testing.T) {
+	args := []string{"--email", "user@example.com", "-mailbox=Sent", "--confirm", "positional"}
+
+	assert.Equal(t, "user@example.com", flagValue(args, "email"))
+	assert.Equal(t, "Sent", flagValue(args, "mailbox"))
+	assert.Equal(t, "", flagValue(args, "domain"))
+	assert.Equal(t, "Sent", firstFlagValue(args, "old-name", "mailbox"))
+
+	assert.True(t, hasAnyFlag(args, "confirm"))
+	assert.True(t, hasAnyFlag(args, "storage", "mailbox"))
+	assert.False(t, hasAnyFlag(args, "positional"))
+}
+
+func TestHashArgsRedactsSecrets(t *testing.T) {
+	assert.Equal(t,
+		[]string{"--email", "user@example.com", "--password", "REDACTED", "-password-hash=REDACTED", "--hash", "bcrypt"},
+		redactArgs([]string{"--email", "user@example.com", "--password", "hunter2", "-password-hash=$2a$10$abc", "--hash", "bcrypt"}))
+
+	// Invocations that differ only in the password hash the same
+	assert.Equal(t,
+		hashArgs([]string{"--email", "user@example.com", "--password", "hunter2"}),
+		hashArgs([]string{"--email", "user@example.com", "--password", "letmein"}))
+	assert.Equal(t,
+		hashArgs([]string{"--email", "user@example.com", "--password=hunter2"}),
+		hashArgs([]string{"--email", "user@example.com", "--password=letmein"}))
+	assert.NotEqual(t,
+		hashArgs([]string{"--email", "user@example.com", "--password", "hunter2"}),
+		hashArgs([]string{"--email", "other@example.com", "--password", "hunter2"}))
+}
+
+func TestStartCLIAudit(t *testing.T) {
+	defer func() {
+		cliAudit = nil
+		logger.SetFatalHook(nil)
+	}()
+
+	startCLIAudit("accounts", []string{"list"})
+	assert.Nil(t, cliAudit, "read-only subcommands are not audited")
+
+	startCLIAudit("accounts", []string{"domain-quota", "--domain", "example.com"})
+	assert.Nil(t, cliAudit, "showing a domain quota is not audited")
+
+	startCLIAudit("accounts", []string{"domain-quota", "--domain", "example.com", "--storage", "5gb"})
+	if assert.NotNil(t, cliAudit) {
+		assert.Equal(t, "accounts.domain-quota", cliAudit.Action)
+		assert.Equal(t, "@example.com", cliAudit.TargetAccount)
+	}
+
+	startCLIAudit("migrate-imap", []string{"--email", "user@example.com", "--host", "imap.example.net", "--password", "secret"})
+	if assert.NotNil(t, cliAudit, "commands without subcommands are audited") {
+		assert.Equal(t, "migrate-imap", cliAudit.Action)
+		assert.Equal(t, "user@example.com", cliAudit.TargetAccount)
+	}
+
+	cliAudit = nil
+	startCLIAudit("verify", []string{"s3", "--email", "user@example.com"})
+	assert.Nil(t, cliAudit, "verifying without fixing is not audited")
+
+	startCLIAudit("verify", []string{"s3", "--email", "user@example.com", "--fix-orphaned"})
+	if assert.NotNil(t, cliAudit) {
+		assert.Equal(t, "verify.s3", cliAudit.Action)
+	}
+
+	startCLIAudit("import", []string{"files", "--format", "mbox", "--email", "user@example.com", "--path", "Takeout.mbox"})
+	if assert.NotNil(t, cliAudit) {
+		assert.Equal(t, "import.files", cliAudit.Action)
+		assert.Equal(t, "user@example.com", cliAudit.TargetAccount)
+	}
+
+	startCLIAudit("acl", []string{"grant", "--email", "owner@example.com", "--mailbox", "Shared/Sales", "--password", "secret"})
+	if assert.NotNil(t, cliAudit) {
+		assert.Equal(t, "acl.grant", cliAudit.Action)
+		assert.Equal(t, "owner@example.com", cliAudit.TargetAccount)
+		assert.Equal(t, "Shared/Sales", cliAudit.TargetMailbox)
+		assert.Len(t, cliAudit.PayloadHash, 64)
+		assert.NotContains(t, cliAudit.PayloadHash, "secret")
+	}
+}
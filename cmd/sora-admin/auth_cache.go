@@ -14,7 +14,7 @@ import (
 func handleAuthCacheCommand(ctx context.Context) {
 	if len(os.Args) < 3 {
 		printAuthCacheUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	subcommand := os.Args[2]
@@ -26,7 +26,7 @@ func handleAuthCacheCommand(ctx context.Context) {
 	default:
 		fmt.Printf("Unknown auth-cache subcommand: %s\n\n", subcommand)
 		printAuthCacheUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
@@ -22,7 +22,7 @@ import (
 func handleCacheCommand(ctx context.Context) {
 	if len(os.Args) < 3 {
 		printCacheUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	subcommand := os.Args[2]
@@ -38,13 +38,13 @@ func handleCacheCommand(ctx context.Context) {
 	default:
 		fmt.Printf("Unknown cache subcommand: %s\n\n", subcommand)
 		printCacheUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
 func handleCacheStats(ctx context.Context) {
 	// Parse cache-stats specific flags
-	fs := flag.NewFlagSet("cache stats", flag.ExitOnError)
+	fs := flag.NewFlagSet("cache stats", flag.ContinueOnError)
 
 	fs.Usage = func() {
 		fmt.Printf(`Show local cache size and object count
@@ -68,9 +68,7 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 
@@ -82,7 +80,7 @@ Examples:
 
 func handleCachePurge(ctx context.Context) {
 	// Parse cache-purge specific flags
-	fs := flag.NewFlagSet("cache purge", flag.ExitOnError)
+	fs := flag.NewFlagSet("cache purge", flag.ContinueOnError)
 
 	confirm := fs.Bool("confirm", false, "Confirm cache purge without interactive prompt")
 
@@ -107,9 +105,7 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 
@@ -121,7 +117,7 @@ Examples:
 
 func handleCacheMetrics(ctx context.Context) {
 	// Parse cache-metrics specific flags
-	fs := flag.NewFlagSet("cache metrics", flag.ExitOnError)
+	fs := flag.NewFlagSet("cache metrics", flag.ContinueOnError)
 
 	instanceID := fs.String("instance", "", "Show metrics for specific instance ID")
 	since := fs.String("since", "24h", "Time window for historical metrics (e.g., 1h, 24h, 7d)")
@@ -158,9 +154,7 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	// Parse since duration
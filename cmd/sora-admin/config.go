@@ -42,7 +42,7 @@ func handleConfigCommand(ctx context.Context) {
 
 	if subcommand == "" {
 		printConfigUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	switch subcommand {
@@ -55,7 +55,7 @@ func handleConfigCommand(ctx context.Context) {
 	default:
 		fmt.Printf("Unknown config subcommand: %s\n\n", subcommand)
 		printConfigUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
@@ -95,7 +95,7 @@ Description:
 Examples:
   sora-admin --config sora.config.toml config validate
 `)
-		os.Exit(1)
+		exit(1)
 	}
 
 	fmt.Printf("Validating configuration file: %s\n\n", configFile)
@@ -105,7 +105,7 @@ Examples:
 	if err := config.LoadConfigFromFile(configFile, &cfg); err != nil {
 		fmt.Printf("❌ Configuration validation FAILED:\n")
 		fmt.Printf("   %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Validate all server configurations
@@ -148,7 +148,7 @@ Examples:
 
 	if hasErrors {
 		fmt.Printf("\n❌ Configuration validation FAILED with errors\n")
-		os.Exit(1)
+		exit(1)
 	}
 
 	fmt.Printf("✅ Configuration is valid!\n")
@@ -187,7 +187,7 @@ func handleConfigDump(_ context.Context) {
 	}
 
 	// Parse additional flags after the subcommand
-	flagSet := flag.NewFlagSet("config-dump", flag.ExitOnError)
+	flagSet := flag.NewFlagSet("config-dump", flag.ContinueOnError)
 	flagSet.StringVar(&format, "format", "toml", "Output format: toml or json")
 	flagSet.BoolVar(&maskSecrets, "mask-secrets", true, "Mask sensitive values (passwords, keys)")
 	flagSet.Usage = func() {
@@ -207,13 +207,13 @@ Examples:
 	}
 
 	if flagsStartIndex > 0 && flagsStartIndex < len(os.Args) {
-		flagSet.Parse(os.Args[flagsStartIndex:])
+		parseFlags(flagSet, os.Args[flagsStartIndex:])
 	}
 
 	if configFile == "" {
 		fmt.Printf("Error: --config is required\n\n")
 		flagSet.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Load full configuration
@@ -233,6 +233,13 @@ Examples:
 		cfg.S3.AccessKey = "***MASKED***"
 		cfg.S3.SecretKey = "***MASKED***"
 		cfg.S3.EncryptionKey = "***MASKED***"
+		if len(cfg.S3.EncryptionKeys) > 0 {
+			maskedKeys := make(map[string]string, len(cfg.S3.EncryptionKeys))
+			for id := range cfg.S3.EncryptionKeys {
+				maskedKeys[id] = "***MASKED***"
+			}
+			cfg.S3.EncryptionKeys = maskedKeys
+		}
 		cfg.TLS.CertFile = "***MASKED***"
 		cfg.TLS.KeyFile = "***MASKED***"
 		if cfg.TLS.LetsEncrypt != nil {
@@ -21,7 +21,7 @@ import (
 func handleConnectionsCommand(ctx context.Context) {
 	if len(os.Args) < 3 {
 		printConnectionsUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	subcommand := os.Args[2]
@@ -35,13 +35,13 @@ func handleConnectionsCommand(ctx context.Context) {
 	default:
 		fmt.Printf("Unknown connections subcommand: %s\n\n", subcommand)
 		printConnectionsUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
 func handleListConnections(ctx context.Context) {
 	// Parse connections list specific flags
-	fs := flag.NewFlagSet("connections list", flag.ExitOnError)
+	fs := flag.NewFlagSet("connections list", flag.ContinueOnError)
 
 	userEmail := fs.String("user", "", "Filter connections by user email")
 	domain := fs.String("domain", "", "Filter connections by domain")
@@ -76,9 +76,7 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// List connections
 	if err := listConnections(ctx, globalConfig, *userEmail, *domain, *protocol, *instanceID); err != nil {
@@ -88,7 +86,7 @@ Examples:
 
 func handleKickConnections(ctx context.Context) {
 	// Parse kick-connections specific flags
-	fs := flag.NewFlagSet("connections kick", flag.ExitOnError)
+	fs := flag.NewFlagSet("connections kick", flag.ContinueOnError)
 
 	userEmail := fs.String("user", "", "Kick all connections for specific user email")
 	protocol := fs.String("protocol", "", "Kick connections using specific protocol (IMAP, POP3, ManageSieve)")
@@ -128,15 +126,13 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate that at least one filter is specified
 	if *userEmail == "" && *protocol == "" && *server == "" && *clientAddr == "" && !*all {
 		fmt.Printf("Error: At least one filtering option must be specified\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Validate protocol if specified
@@ -153,7 +149,7 @@ Examples:
 		if !valid {
 			fmt.Printf("Error: Invalid protocol. Must be one of: %s\n\n", strings.Join(validProtocols, ", "))
 			fs.Usage()
-			os.Exit(1)
+			exit(1)
 		}
 	}
 
@@ -167,7 +163,7 @@ Examples:
 func handleAffinityCommand(ctx context.Context) {
 	if len(os.Args) < 3 {
 		printAffinityUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	subcommand := os.Args[2]
@@ -185,12 +181,12 @@ func handleAffinityCommand(ctx context.Context) {
 	default:
 		fmt.Printf("Unknown affinity subcommand: %s\n\n", subcommand)
 		printAffinityUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
 func handleSetAffinity(ctx context.Context) {
-	fs := flag.NewFlagSet("affinity set", flag.ExitOnError)
+	fs := flag.NewFlagSet("affinity set", flag.ContinueOnError)
 
 	userEmail := fs.String("user", "", "User email address (required)")
 	protocol := fs.String("protocol", "", "Protocol: imap, pop3, or managesieve (required)")
@@ -216,15 +212,13 @@ Examples:
 `)
 	}
 
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	if *userEmail == "" || *protocol == "" || *backendAddr == "" {
 		fmt.Printf("Error: --user, --protocol, and --backend are required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Validate protocol
@@ -233,7 +227,7 @@ Examples:
 	if !validProtocols[*protocol] {
 		fmt.Printf("Error: protocol must be one of: imap, pop3, managesieve\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Find admin API server config
@@ -275,7 +269,7 @@ Examples:
 }
 
 func handleGetAffinity(ctx context.Context) {
-	fs := flag.NewFlagSet("affinity get", flag.ExitOnError)
+	fs := flag.NewFlagSet("affinity get", flag.ContinueOnError)
 
 	userEmail := fs.String("user", "", "User email address (required)")
 	protocol := fs.String("protocol", "", "Protocol: imap, pop3, or managesieve (required)")
@@ -296,15 +290,13 @@ Examples:
 `)
 	}
 
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	if *userEmail == "" || *protocol == "" {
 		fmt.Printf("Error: --user, and --protocol are required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	*protocol = strings.ToLower(*protocol)
@@ -350,7 +342,7 @@ func handleListAffinity(_ context.Context) {
 }
 
 func handleDeleteAffinity(ctx context.Context) {
-	fs := flag.NewFlagSet("affinity delete", flag.ExitOnError)
+	fs := flag.NewFlagSet("affinity delete", flag.ContinueOnError)
 
 	userEmail := fs.String("user", "", "User email address (required)")
 	protocol := fs.String("protocol", "", "Protocol: imap, pop3, or managesieve (required)")
@@ -374,15 +366,13 @@ Examples:
 `)
 	}
 
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	if *userEmail == "" || *protocol == "" {
 		fmt.Printf("Error: --user, and --protocol are required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	*protocol = strings.ToLower(*protocol)
@@ -18,7 +18,7 @@ import (
 func handleCredentialsCommand(ctx context.Context) {
 	if len(os.Args) < 3 {
 		printCredentialsUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	subcommand := os.Args[2]
@@ -36,13 +36,13 @@ func handleCredentialsCommand(ctx context.Context) {
 	default:
 		fmt.Printf("Unknown credentials subcommand: %s\n\n", subcommand)
 		printCredentialsUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
 func handleAddCredential(ctx context.Context) {
 	// Parse add-credential specific flags
-	fs := flag.NewFlagSet("credentials add", flag.ExitOnError)
+	fs := flag.NewFlagSet("credentials add", flag.ContinueOnError)
 
 	primaryIdentity := fs.String("primary", "", "Primary identity of the account to add credential to (required)")
 	email := fs.String("email", "", "New email address to add as credential (required)")
@@ -75,33 +75,31 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	if *primaryIdentity == "" {
 		fmt.Printf("Error: --primary is required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	if *email == "" {
 		fmt.Printf("Error: --email is required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	if *password == "" && *passwordHash == "" {
 		fmt.Printf("Error: either --password or --password-hash is required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	if *password != "" && *passwordHash != "" {
 		fmt.Printf("Error: cannot specify both --password and --password-hash\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Validate hash type
@@ -116,7 +114,7 @@ Examples:
 	if !hashTypeValid {
 		fmt.Printf("Error: --hash must be one of: %s\n\n", strings.Join(validHashTypes, ", "))
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Add the credential
@@ -129,7 +127,7 @@ Examples:
 
 func handleListCredentials(ctx context.Context) {
 	// Parse list-credentials specific flags
-	fs := flag.NewFlagSet("credentials list", flag.ExitOnError)
+	fs := flag.NewFlagSet("credentials list", flag.ContinueOnError)
 
 	email := fs.String("email", "", "Email address associated with the account (required)")
 
@@ -151,15 +149,13 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	if *email == "" {
 		fmt.Printf("Error: --email is required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// List the credentials
@@ -170,7 +166,7 @@ Examples:
 
 func handleShowCredential(ctx context.Context) {
 	// Parse show-credential specific flags
-	fs := flag.NewFlagSet("credentials show", flag.ExitOnError)
+	fs := flag.NewFlagSet("credentials show", flag.ContinueOnError)
 	email := fs.String("email", "", "Email address (credential) to show details for")
 	jsonOutput := fs.Bool("json", false, "Output in JSON format")
 
@@ -200,15 +196,13 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	if *email == "" {
 		fmt.Println("Error: --email is required")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Show the credential details
@@ -219,7 +213,7 @@ Examples:
 
 func handleDeleteCredential(ctx context.Context) {
 	// Parse delete-credential specific flags
-	fs := flag.NewFlagSet("credentials delete", flag.ExitOnError)
+	fs := flag.NewFlagSet("credentials delete", flag.ContinueOnError)
 
 	email := fs.String("email", "", "Email address of the credential to delete (required)")
 
@@ -246,15 +240,13 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	if *email == "" {
 		fmt.Printf("Error: --email is required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Delete the credential
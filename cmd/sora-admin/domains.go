@@ -0,0 +1,743 @@
+package main
+
+// domains.go - Command handlers for domains and aliases
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+)
+
+func handleDomainsCommand(ctx context.Context) {
+	if len(os.Args) < 3 {
+		printDomainsUsage()
+		exit(1)
+	}
+
+	subcommand := os.Args[2]
+	switch subcommand {
+	case "list":
+		handleListDomains(ctx)
+	case "show":
+		handleShowDomain(ctx)
+	case "create":
+		handleCreateDomain(ctx)
+	case "update":
+		handleUpdateDomain(ctx)
+	case "suspend":
+		handleSetDomainStatus(ctx, db.DomainStatusSuspended)
+	case "activate":
+		handleSetDomainStatus(ctx, db.DomainStatusActive)
+	case "delete":
+		handleDeleteDomain(ctx)
+	case "aliases":
+		handleListAliases(ctx)
+	case "alias-add":
+		handleAddAlias(ctx)
+	case "alias-update":
+		handleUpdateAlias(ctx)
+	case "alias-delete":
+		handleDeleteAlias(ctx)
+	case "help", "--help", "-h":
+		printDomainsUsage()
+	default:
+		fmt.Printf("Unknown domains subcommand: %s\n\n", subcommand)
+		printDomainsUsage()
+		exit(1)
+	}
+}
+
+func printDomainsUsage() {
+	fmt.Printf(`Domain Management
+
+Domains are optional. Addresses of a domain that has not been created behave
+as an active domain with default policies.
+
+Usage:
+  sora-admin domains <subcommand> [options]
+
+Subcommands:
+  list          List domains
+  show          Show the policies of a domain
+  create        Create a domain
+  update        Change the policies of a domain
+  suspend       Refuse logins and deliveries for all addresses of a domain
+  activate      Lift the suspension of a domain
+  delete        Delete a domain with its aliases (accounts are not touched)
+  aliases       List the aliases of a domain
+  alias-add     Create an alias
+  alias-update  Change the targets or state of an alias
+  alias-delete  Delete an alias
+
+Examples:
+  sora-admin domains create --domain example.com --max-accounts 100 --catch-all postmaster@example.com
+  sora-admin domains update --domain example.com --sieve-extensions fileinto,vacation --shared-mailboxes=false
+  sora-admin domains suspend --domain example.com
+  sora-admin domains alias-add --address sales@example.com --targets alice@example.com,bob@partner.example
+
+Use 'sora-admin domains <subcommand> --help' for detailed help.
+`)
+}
+
+// domainPolicyFlags are the flags shared by domains create and update.
+type domainPolicyFlags struct {
+	maxAccounts     *int
+	catchAll        *string
+	sieveExtensions *string
+	sharedMailboxes *bool
+	storage         *string
+	messages        *int64
+	description     *string
+}
+
+func addDomainPolicyFlags(fs *flag.FlagSet) *domainPolicyFlags {
+	return &domainPolicyFlags{
+		maxAccounts:     fs.Int("max-accounts", -1, "Maximum number of accounts (-1 = unlimited)"),
+		catchAll:        fs.String("catch-all", "", "Catch-all target address (empty = none)"),
+		sieveExtensions: fs.String("sieve-extensions", "", "Comma-separated allowed Sieve extensions (empty = all server extensions)"),
+		sharedMailboxes: fs.Bool("shared-mailboxes", true, "Allow shared mailboxes"),
+		storage:         fs.String("storage", "", "Default storage quota (e.g. 500mb, 10gb, 0 = unlimited)"),
+		messages:        fs.Int64("messages", -1, "Default maximum number of messages (0 = unlimited)"),
+		description:     fs.String("description", "", "Description"),
+	}
+}
+
+// apply copies the flags that were given on the command line into d. With
+// all set, every policy is applied, so that omitted flags reset to defaults.
+func (f *domainPolicyFlags) apply(fs *flag.FlagSet, d *db.Domain, all bool) error {
+	set := make(map[string]bool)
+	fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+
+	if all || set["max-accounts"] {
+		d.MaxAccounts = nil
+		if *f.maxAccounts >= 0 {
+			d.MaxAccounts = f.maxAccounts
+		}
+	}
+	if all || set["catch-all"] {
+		d.CatchAll = *f.catchAll
+	}
+	if all || set["sieve-extensions"] {
+		d.SieveExtensions = nil
+		if *f.sieveExtensions != "" {
+			d.SieveExtensions = splitList(*f.sieveExtensions)
+		}
+	}
+	if all || set["shared-mailboxes"] {
+		d.SharedMailboxes = *f.sharedMailboxes
+	}
+	if set["storage"] || set["messages"] {
+		storageLimit, messagesLimit, err := parseQuotaFlags(*f.storage, *f.messages)
+		if err != nil {
+			return err
+		}
+		if set["storage"] {
+			d.QuotaStorage = storageLimit
+		}
+		if set["messages"] {
+			d.QuotaMessages = messagesLimit
+		}
+	}
+	if all || set["description"] {
+		d.Description = *f.description
+	}
+	return nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var items []string
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func handleListDomains(ctx context.Context) {
+	fs := flag.NewFlagSet("domains list", flag.ContinueOnError)
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+
+	fs.Usage = func() {
+		fmt.Printf(`List domains
+
+Usage:
+  sora-admin domains list [options]
+
+Options:
+  --json   Output in JSON format instead of human-readable format
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	domains, err := rdb.ListDomainsWithRetry(ctx)
+	if err != nil {
+		logger.Fatalf("Failed to list domains: %v", err)
+	}
+
+	if *jsonOutput {
+		printJSON(domains)
+		return
+	}
+
+	if len(domains) == 0 {
+		fmt.Println("No domains found.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DOMAIN\tSTATUS\tACCOUNTS\tALIASES\tCATCH-ALL\tDESCRIPTION")
+	for _, d := range domains {
+		accounts := fmt.Sprintf("%d", d.AccountCount)
+		if d.MaxAccounts != nil {
+			accounts = fmt.Sprintf("%d/%d", d.AccountCount, *d.MaxAccounts)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", d.Name, d.Status, accounts, d.AliasCount, d.CatchAll, d.Description)
+	}
+	w.Flush()
+}
+
+func handleShowDomain(ctx context.Context) {
+	fs := flag.NewFlagSet("domains show", flag.ContinueOnError)
+	domain := fs.String("domain", "", "Domain name")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+
+	fs.Usage = func() {
+		fmt.Printf(`Show the policies of a domain
+
+Usage:
+  sora-admin domains show --domain <domain> [options]
+
+Options:
+  --domain string   Domain name (required)
+  --json            Output in JSON format instead of human-readable format
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *domain == "" {
+		fmt.Println("Error: --domain is required")
+		fs.Usage()
+		exit(1)
+	}
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	d, err := rdb.GetDomainWithRetry(ctx, *domain)
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			logger.Fatalf("Domain %s does not exist", *domain)
+		}
+		logger.Fatalf("Failed to get domain: %v", err)
+	}
+
+	if *jsonOutput {
+		printJSON(d)
+		return
+	}
+
+	fmt.Printf("Domain:           %s\n", d.Name)
+	fmt.Printf("Status:           %s\n", d.Status)
+	if d.MaxAccounts != nil {
+		fmt.Printf("Accounts:         %d of %d\n", d.AccountCount, *d.MaxAccounts)
+	} else {
+		fmt.Printf("Accounts:         %d (unlimited)\n", d.AccountCount)
+	}
+	fmt.Printf("Aliases:          %d\n", d.AliasCount)
+	if d.CatchAll != "" {
+		fmt.Printf("Catch-all:        %s\n", d.CatchAll)
+	} else {
+		fmt.Printf("Catch-all:        none\n")
+	}
+	if d.SieveExtensions != nil {
+		fmt.Printf("Sieve extensions: %s\n", strings.Join(d.SieveExtensions, ", "))
+	} else {
+		fmt.Printf("Sieve extensions: server default\n")
+	}
+	fmt.Printf("Shared mailboxes: %t\n", d.SharedMailboxes)
+	fmt.Printf("Default storage:  %s\n", describeStorageLimit(d.QuotaStorage))
+	fmt.Printf("Default messages: %s\n", describeMessagesLimit(d.QuotaMessages))
+	if d.Description != "" {
+		fmt.Printf("Description:      %s\n", d.Description)
+	}
+	fmt.Printf("Created:          %s\n", d.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+	fmt.Printf("Updated:          %s\n", d.UpdatedAt.Format("2006-01-02 15:04:05 MST"))
+}
+
+func handleCreateDomain(ctx context.Context) {
+	fs := flag.NewFlagSet("domains create", flag.ContinueOnError)
+	domain := fs.String("domain", "", "Domain name")
+	suspended := fs.Bool("suspended", false, "Create the domain suspended")
+	policy := addDomainPolicyFlags(fs)
+
+	fs.Usage = func() {
+		fmt.Printf(`Create a domain
+
+Usage:
+  sora-admin domains create --domain <domain> [options]
+
+Options:
+  --domain string             Domain name (required)
+  --suspended                 Create the domain suspended
+  --max-accounts int          Maximum number of accounts (default: unlimited)
+  --catch-all string          Address receiving mail for unknown addresses of the domain
+  --sieve-extensions string   Comma-separated Sieve extensions scripts may use (default: all server extensions)
+  --shared-mailboxes          Allow shared mailboxes (default: true)
+  --storage string            Default storage quota (e.g. 500mb, 10gb); 0 = unlimited
+  --messages int              Default maximum number of messages; 0 = unlimited
+  --description string        Description
+
+Examples:
+  sora-admin domains create --domain example.com
+  sora-admin domains create --domain example.com --max-accounts 100 --storage 5gb --catch-all postmaster@example.com
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *domain == "" {
+		fmt.Println("Error: --domain is required")
+		fs.Usage()
+		exit(1)
+	}
+
+	d := db.Domain{Name: *domain, Status: db.DomainStatusActive}
+	if *suspended {
+		d.Status = db.DomainStatusSuspended
+	}
+	if err := policy.apply(fs, &d, true); err != nil {
+		fmt.Printf("Error: %v\n\n", err)
+		fs.Usage()
+		exit(1)
+	}
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	if err := rdb.CreateDomainWithRetry(ctx, d); err != nil {
+		if errors.Is(err, consts.ErrDBUniqueViolation) {
+			logger.Fatalf("Domain %s already exists", *domain)
+		}
+		logger.Fatalf("Failed to create domain: %v", err)
+	}
+
+	fmt.Printf("Domain %s created\n", *domain)
+}
+
+func handleUpdateDomain(ctx context.Context) {
+	fs := flag.NewFlagSet("domains update", flag.ContinueOnError)
+	domain := fs.String("domain", "", "Domain name")
+	policy := addDomainPolicyFlags(fs)
+
+	fs.Usage = func() {
+		fmt.Printf(`Change the policies of a domain
+
+Only the given options are changed.
+
+Usage:
+  sora-admin domains update --domain <domain> [options]
+
+Options:
+  --domain string             Domain name (required)
+  --max-accounts int          Maximum number of accounts; -1 = unlimited
+  --catch-all string          Catch-all address; "" removes the catch-all
+  --sieve-extensions string   Comma-separated Sieve extensions; "" allows all server extensions
+  --shared-mailboxes          Allow shared mailboxes (use --shared-mailboxes=false to forbid)
+  --storage string            Default storage quota (e.g. 500mb, 10gb); 0 = unlimited
+  --messages int              Default maximum number of messages; 0 = unlimited
+  --description string        Description
+
+Examples:
+  sora-admin domains update --domain example.com --max-accounts 250
+  sora-admin domains update --domain example.com --sieve-extensions fileinto,vacation,envelope
+  sora-admin domains update --domain example.com --catch-all ""
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *domain == "" {
+		fmt.Println("Error: --domain is required")
+		fs.Usage()
+		exit(1)
+	}
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	d, err := rdb.GetDomainWithRetry(ctx, *domain)
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			logger.Fatalf("Domain %s does not exist", *domain)
+		}
+		logger.Fatalf("Failed to get domain: %v", err)
+	}
+	if err := policy.apply(fs, d, false); err != nil {
+		fmt.Printf("Error: %v\n\n", err)
+		fs.Usage()
+		exit(1)
+	}
+
+	if err := rdb.UpdateDomainWithRetry(ctx, *d); err != nil {
+		logger.Fatalf("Failed to update domain: %v", err)
+	}
+
+	fmt.Printf("Domain %s updated\n", d.Name)
+}
+
+func handleSetDomainStatus(ctx context.Context, status string) {
+	verb := "suspend"
+	if status == db.DomainStatusActive {
+		verb = "activate"
+	}
+	fs := flag.NewFlagSet("domains "+verb, flag.ContinueOnError)
+	domain := fs.String("domain", "", "Domain name")
+
+	fs.Usage = func() {
+		fmt.Printf(`Set the status of a domain
+
+A suspended domain refuses logins and deliveries for all its addresses.
+Existing sessions are not terminated; use 'connections kick' for that.
+
+Usage:
+  sora-admin domains %s --domain <domain>
+
+Options:
+  --domain string   Domain name (required)
+`, verb)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *domain == "" {
+		fmt.Println("Error: --domain is required")
+		fs.Usage()
+		exit(1)
+	}
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	d, err := rdb.GetDomainWithRetry(ctx, *domain)
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			logger.Fatalf("Domain %s does not exist", *domain)
+		}
+		logger.Fatalf("Failed to get domain: %v", err)
+	}
+	d.Status = status
+	if err := rdb.UpdateDomainWithRetry(ctx, *d); err != nil {
+		logger.Fatalf("Failed to update domain: %v", err)
+	}
+
+	fmt.Printf("Domain %s is now %s\n", d.Name, status)
+}
+
+func handleDeleteDomain(ctx context.Context) {
+	fs := flag.NewFlagSet("domains delete", flag.ContinueOnError)
+	domain := fs.String("domain", "", "Domain name")
+	confirm := fs.Bool("confirm", false, "Confirm deletion")
+
+	fs.Usage = func() {
+		fmt.Printf(`Delete a domain
+
+Deletes the domain, its aliases and its default quota. Accounts of the domain
+are not touched; use 'accounts purge-domain' to remove them.
+
+Usage:
+  sora-admin domains delete --domain <domain> --confirm
+
+Options:
+  --domain string   Domain name (required)
+  --confirm         Confirm deletion (required)
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *domain == "" {
+		fmt.Println("Error: --domain is required")
+		fs.Usage()
+		exit(1)
+	}
+	if !*confirm {
+		fmt.Println("Error: --confirm is required to delete a domain")
+		fs.Usage()
+		exit(1)
+	}
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	if err := rdb.DeleteDomainWithRetry(ctx, *domain); err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			logger.Fatalf("Domain %s does not exist", *domain)
+		}
+		logger.Fatalf("Failed to delete domain: %v", err)
+	}
+
+	fmt.Printf("Domain %s deleted\n", *domain)
+}
+
+func handleListAliases(ctx context.Context) {
+	fs := flag.NewFlagSet("domains aliases", flag.ContinueOnError)
+	domain := fs.String("domain", "", "Domain name")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+
+	fs.Usage = func() {
+		fmt.Printf(`List the aliases of a domain
+
+Usage:
+  sora-admin domains aliases --domain <domain> [options]
+
+Options:
+  --domain string   Domain name (required)
+  --json            Output in JSON format instead of human-readable format
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *domain == "" {
+		fmt.Println("Error: --domain is required")
+		fs.Usage()
+		exit(1)
+	}
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	aliases, err := rdb.ListAliasesWithRetry(ctx, *domain)
+	if err != nil {
+		logger.Fatalf("Failed to list aliases: %v", err)
+	}
+
+	if *jsonOutput {
+		printJSON(aliases)
+		return
+	}
+
+	if len(aliases) == 0 {
+		fmt.Printf("No aliases found for domain %s.\n", *domain)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ADDRESS\tENABLED\tTARGETS\tDESCRIPTION")
+	for _, a := range aliases {
+		fmt.Fprintf(w, "%s\t%t\t%s\t%s\n", a.Address, a.Enabled, strings.Join(a.Targets, ", "), a.Description)
+	}
+	w.Flush()
+}
+
+func handleAddAlias(ctx context.Context) {
+	fs := flag.NewFlagSet("domains alias-add", flag.ContinueOnError)
+	address := fs.String("address", "", "Alias address")
+	targets := fs.String("targets", "", "Comma-separated target addresses")
+	description := fs.String("description", "", "Description")
+	disabled := fs.Bool("disabled", false, "Create the alias disabled")
+
+	fs.Usage = func() {
+		fmt.Printf(`Create an alias
+
+Targets that are account addresses are delivered locally, other targets are
+forwarded through the relay. The domain of the alias must exist.
+
+Usage:
+  sora-admin domains alias-add --address <address> --targets <addresses> [options]
+
+Options:
+  --address string       Alias address (required)
+  --targets string       Comma-separated target addresses (required)
+  --description string   Description
+  --disabled             Create the alias disabled
+
+Examples:
+  sora-admin domains alias-add --address sales@example.com --targets alice@example.com,bob@example.com
+  sora-admin domains alias-add --address info@example.com --targets info@partner.example
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *address == "" || *targets == "" {
+		fmt.Println("Error: --address and --targets are required")
+		fs.Usage()
+		exit(1)
+	}
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	_, err = rdb.CreateAliasWithRetry(ctx, db.Alias{
+		Address:     *address,
+		Targets:     splitList(*targets),
+		Description: *description,
+		Enabled:     !*disabled,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, consts.ErrDBUniqueViolation):
+			logger.Fatalf("Alias %s already exists", *address)
+		case errors.Is(err, consts.ErrDBNotFound):
+			logger.Fatalf("Domain of %s does not exist; create it with 'domains create' first", *address)
+		}
+		logger.Fatalf("Failed to create alias: %v", err)
+	}
+
+	fmt.Printf("Alias %s created\n", *address)
+}
+
+func handleUpdateAlias(ctx context.Context) {
+	fs := flag.NewFlagSet("domains alias-update", flag.ContinueOnError)
+	address := fs.String("address", "", "Alias address")
+	targets := fs.String("targets", "", "Comma-separated target addresses")
+	description := fs.String("description", "", "Description")
+	enabled := fs.Bool("enabled", true, "Enable or disable the alias")
+
+	fs.Usage = func() {
+		fmt.Printf(`Change the targets or state of an alias
+
+Only the given options are changed.
+
+Usage:
+  sora-admin domains alias-update --address <address> [options]
+
+Options:
+  --address string       Alias address (required)
+  --targets string       Comma-separated target addresses, replacing the current ones
+  --description string   Description
+  --enabled              Enable the alias (use --enabled=false to disable)
+
+Examples:
+  sora-admin domains alias-update --address sales@example.com --targets carol@example.com
+  sora-admin domains alias-update --address sales@example.com --enabled=false
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *address == "" {
+		fmt.Println("Error: --address is required")
+		fs.Usage()
+		exit(1)
+	}
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	alias, err := rdb.GetAliasWithRetry(ctx, *address)
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			logger.Fatalf("Alias %s does not exist", *address)
+		}
+		logger.Fatalf("Failed to get alias: %v", err)
+	}
+
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "targets":
+			alias.Targets = splitList(*targets)
+		case "description":
+			alias.Description = *description
+		case "enabled":
+			alias.Enabled = *enabled
+		}
+	})
+
+	if err := rdb.UpdateAliasWithRetry(ctx, *alias); err != nil {
+		logger.Fatalf("Failed to update alias: %v", err)
+	}
+
+	fmt.Printf("Alias %s updated\n", alias.Address)
+}
+
+func handleDeleteAlias(ctx context.Context) {
+	fs := flag.NewFlagSet("domains alias-delete", flag.ContinueOnError)
+	address := fs.String("address", "", "Alias address")
+
+	fs.Usage = func() {
+		fmt.Printf(`Delete an alias
+
+Usage:
+  sora-admin domains alias-delete --address <address>
+
+Options:
+  --address string   Alias address (required)
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *address == "" {
+		fmt.Println("Error: --address is required")
+		fs.Usage()
+		exit(1)
+	}
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	if err := rdb.DeleteAliasWithRetry(ctx, *address); err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			logger.Fatalf("Alias %s does not exist", *address)
+		}
+		logger.Fatalf("Failed to delete alias: %v", err)
+	}
+
+	fmt.Printf("Alias %s deleted\n", *address)
+}
+
+func printJSON(v any) {
+	jsonData, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		logger.Fatalf("Error marshaling JSON: %v", err)
+	}
+	fmt.Println(string(jsonData))
+}
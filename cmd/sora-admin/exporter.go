@@ -17,6 +17,7 @@ import (
 	"github.com/emersion/go-imap/v2"
 	"github.com/migadu/sora/db"
 	"github.com/migadu/sora/helpers"
+	"github.com/migadu/sora/pkg/mbox"
 	"github.com/migadu/sora/pkg/resilient"
 	"github.com/migadu/sora/server"
 	_ "modernc.org/sqlite"
@@ -33,6 +34,7 @@ type ExporterOptions struct {
 	OverwriteFlags bool          // Whether to overwrite flags on existing messages
 	ExportDelay    time.Duration // Delay between exports to control rate
 	ExportUIDList  bool          // Whether to export dovecot-uidlist files
+	Format         string        // maildir (default), mbox or eml
 }
 
 // Exporter handles the maildir export process.
@@ -56,6 +58,9 @@ type Exporter struct {
 
 	// UID mappings per mailbox for dovecot-uidlist generation
 	uidMappings map[string][]UIDFileMapping // mailbox name -> UID mappings
+
+	// mbox file of the mailbox being exported with --format mbox
+	mboxWriter *mbox.Writer
 }
 
 // NewExporter creates a new Exporter instance.
@@ -94,6 +99,8 @@ func NewExporter(ctx context.Context, maildirPath, email string, jobs int, rdb *
 			mailbox TEXT NOT NULL,
 			s3_uploaded INTEGER DEFAULT 0,
 			s3_uploaded_at TIMESTAMP,
+			mbox_offset INTEGER,
+			internal_date INTEGER,
 			UNIQUE(hash, mailbox),
 			UNIQUE(filename, mailbox)
 		);
@@ -206,9 +213,11 @@ func (exporter *Exporter) Run() error {
 	}
 
 	// Create mailbox directories
-	for _, mbox := range mailboxes {
-		if err := exporter.createMailboxDirectory(mbox.Name); err != nil {
-			return fmt.Errorf("failed to create mailbox directory: %w", err)
+	if exporter.isMaildir() {
+		for _, mbox := range mailboxes {
+			if err := exporter.createMailboxDirectory(mbox.Name); err != nil {
+				return fmt.Errorf("failed to create mailbox directory: %w", err)
+			}
 		}
 	}
 
@@ -461,6 +470,19 @@ func (exporter *Exporter) exportMailbox(ctx context.Context, mailbox *db.DBMailb
 		return fmt.Errorf("failed to get messages: %w", err)
 	}
 
+	workers := exporter.jobs
+	if exporter.options.Format == formatMbox {
+		// Messages are appended to the mbox file in UID order
+		workers = 1
+		file, err := exporter.openMboxFile(mailbox.Name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		exporter.mboxWriter = mbox.NewWriter(file)
+		defer func() { exporter.mboxWriter = nil }()
+	}
+
 	// Process messages in parallel
 	var wg sync.WaitGroup
 	// Make channel buffer large enough to hold all messages to prevent deadlock
@@ -474,7 +496,7 @@ func (exporter *Exporter) exportMailbox(ctx context.Context, mailbox *db.DBMailb
 	// No need for progress reporter - we'll prefix each log message
 
 	// Start workers
-	for w := 0; w < exporter.jobs; w++ {
+	for w := 0; w < workers; w++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -573,6 +595,10 @@ func (exporter *Exporter) exportMessage(msg *db.Message, mailboxName string) err
 		return fmt.Errorf("failed to read message content: %w", err)
 	}
 
+	if !exporter.isMaildir() {
+		return exporter.exportMessageFile(msg, mailboxName, content, existingFilename)
+	}
+
 	// Generate maildir filename
 	var filename string
 	if existingFilename != "" {
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/helpers"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/mbox"
+)
+
+// isMaildir reports whether messages are exported to a maildir.
+func (exporter *Exporter) isMaildir() bool {
+	return exporter.options.Format == "" || exporter.options.Format == formatMaildir
+}
+
+// mboxPath returns the mbox file of a mailbox: Work/Projects is exported
+// to Work/Projects.mbox.
+func (exporter *Exporter) mboxPath(mailboxName string) string {
+	return filepath.Join(exporter.maildirPath, filepath.FromSlash(mailboxName)+".mbox")
+}
+
+// openMboxFile opens the mbox file of a mailbox for appending.
+func (exporter *Exporter) openMboxFile(mailboxName string) (*os.File, error) {
+	path := exporter.mboxPath(mailboxName)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mbox file: %w", err)
+	}
+	return file, nil
+}
+
+// exportMessageFile exports a message to the mbox file of its mailbox, or
+// as <uid>.eml to the directory of its mailbox. The flags of a message are
+// kept in mbox files only.
+func (exporter *Exporter) exportMessageFile(msg *db.Message, mailboxName string, content []byte, existingFilename string) error {
+	var filename, path string
+	if exporter.options.Format == formatMbox {
+		filename = fmt.Sprintf("%d", msg.UID)
+		path = exporter.mboxPath(mailboxName)
+		err := exporter.mboxWriter.Write(&mbox.Message{
+			From:  exportSender(msg),
+			Date:  msg.InternalDate,
+			Flags: exportFlags(msg),
+			Data:  content,
+		})
+		if err == nil {
+			err = exporter.mboxWriter.Flush()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write mbox file: %w", err)
+		}
+	} else {
+		filename = existingFilename
+		if filename == "" {
+			filename = fmt.Sprintf("%d.eml", msg.UID)
+		}
+		dir := filepath.Join(exporter.maildirPath, filepath.FromSlash(mailboxName))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+		path = filepath.Join(dir, filename)
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			return fmt.Errorf("failed to write message file: %w", err)
+		}
+		if err := os.Chtimes(path, msg.InternalDate, msg.InternalDate); err != nil {
+			logger.Info("Warning: Failed to set file times", "error", err)
+		}
+	}
+
+	// Record export in database
+	if err := exporter.recordExport(msg.ContentHash, mailboxName, filename, path, int64(msg.Size)); err != nil {
+		logger.Info("Warning: Failed to record export", "error", err)
+	}
+
+	atomic.AddInt64(&exporter.exportedMessages, 1)
+	logger.Info("Successfully exported message", "progress", exporter.getProgressPrefix(), "uid", msg.UID, "mailbox", mailboxName, "file", filename)
+
+	// Add delay if configured to control rate
+	if exporter.options.ExportDelay > 0 {
+		time.Sleep(exporter.options.ExportDelay)
+	}
+	return nil
+}
+
+// exportFlags returns the system and custom flags of a message.
+func exportFlags(msg *db.Message) []imap.Flag {
+	flags := db.BitwiseToFlags(msg.BitwiseFlags)
+	for _, keyword := range msg.CustomFlags {
+		flags = append(flags, imap.Flag(keyword))
+	}
+	return flags
+}
+
+// exportSender returns the sender for the From line of an mbox file.
+func exportSender(msg *db.Message) string {
+	var recipients []helpers.Recipient
+	if len(msg.RecipientsJSON) > 0 && json.Unmarshal(msg.RecipientsJSON, &recipients) == nil {
+		for _, recipient := range recipients {
+			if recipient.AddressType == "from" && recipient.EmailAddress != "" {
+				return recipient.EmailAddress
+			}
+		}
+	}
+	return ""
+}
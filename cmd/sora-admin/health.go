@@ -22,7 +22,7 @@ import (
 func handleHealthCommand(ctx context.Context) {
 	if len(os.Args) < 3 {
 		printHealthUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	subcommand := os.Args[2]
@@ -34,12 +34,12 @@ func handleHealthCommand(ctx context.Context) {
 	default:
 		fmt.Printf("Unknown health subcommand: %s\n\n", subcommand)
 		printHealthUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
 func handleHealthStatus(ctx context.Context) {
-	fs := flag.NewFlagSet("health", flag.ExitOnError)
+	fs := flag.NewFlagSet("health", flag.ContinueOnError)
 
 	// Command-specific flags
 	hostname := fs.String("hostname", "", "Show health status for specific hostname")
@@ -82,9 +82,7 @@ Examples:
 
 	// Parse command arguments (skip program name, command name, and subcommand name)
 	args := os.Args[3:]
-	if err := fs.Parse(args); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, args)
 
 	// If showing backends, use Admin API instead of database
 	if *showBackends {
@@ -0,0 +1,741 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/helpers"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/server"
+	_ "modernc.org/sqlite"
+)
+
+// Connection security of the remote IMAP server
+const (
+	imapSecurityTLS      = "tls"
+	imapSecurityStartTLS = "starttls"
+	imapSecurityNone     = "none"
+)
+
+// IMAPMigratorOptions contains configuration options for the IMAP migrator
+type IMAPMigratorOptions struct {
+	Address            string // host:port of the remote IMAP server
+	Username           string
+	Password           string
+	Security           string // tls (default), starttls or none
+	InsecureSkipVerify bool
+	StatePath          string // SQLite file keeping the state of the remote mailboxes
+	MailboxFilter      []string
+	PreserveFlags      bool
+	PreserveUIDs       bool // Keep the remote UIDVALIDITY and UIDs in empty mailboxes
+	DryRun             bool
+	StartDate          *time.Time
+	EndDate            *time.Time
+	Jobs               int // Number of mailboxes migrated in parallel
+	BatchSize          int // Number of messages fetched at once (default: 20)
+	MaxMessageSize     int64
+	ImportDelay        time.Duration // Delay between imports to control rate
+	TestMode           bool          // Skip S3 uploads for testing (messages stored in DB only)
+}
+
+// IMAPMigrator copies the mailboxes of an account on a remote IMAP server
+// into a Sora account, using the parsing and insert steps of the Importer.
+//
+// The UIDVALIDITY, the last migrated UID and the HIGHESTMODSEQ of every
+// remote mailbox are kept in a SQLite state file, so an interrupted
+// migration resumes where it stopped and later runs only fetch new messages
+// and, if the server supports CONDSTORE, the flags changed since.
+type IMAPMigrator struct {
+	ctx      context.Context
+	email    string
+	options  IMAPMigratorOptions
+	rdb      resilientDB
+	s3       objectStorage
+	importer *Importer
+	state    *sql.DB
+
+	// dial connects and logs in to the remote server
+	dial func() (*imapclient.Client, error)
+
+	address   server.Address
+	accountID int64
+
+	totalMessages    int64
+	importedMessages int64
+	skippedMessages  int64
+	failedMessages   int64
+	updatedMessages  int64
+	startTime        time.Time
+}
+
+// remoteMailbox is a mailbox of the remote server and the Sora mailbox it is
+// migrated to
+type remoteMailbox struct {
+	name   string
+	target string
+}
+
+// remoteMessage is a message of a remote mailbox
+type remoteMessage struct {
+	uid          imap.UID
+	size         int64
+	internalDate time.Time
+}
+
+// remoteMailboxState is the migration state of a remote mailbox
+type remoteMailboxState struct {
+	uidValidity   uint32
+	lastUID       imap.UID
+	highestModSeq uint64
+}
+
+// NewIMAPMigrator creates a new IMAPMigrator instance.
+func NewIMAPMigrator(ctx context.Context, email string, rdb resilientDB, s3 objectStorage, options IMAPMigratorOptions) (*IMAPMigrator, error) {
+	if options.Security == "" {
+		options.Security = imapSecurityTLS
+	}
+	if options.Jobs < 1 {
+		options.Jobs = 1
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 20
+	}
+
+	state, err := sql.Open("sqlite", options.StatePath+"?_journal_mode=WAL&_busy_timeout=5000&_synchronous=NORMAL")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file: %w", err)
+	}
+	// Mailboxes are migrated in parallel, SQLite works best with a single writer
+	state.SetMaxOpenConns(1)
+
+	// sora_uid is NULL for messages that already existed in Sora
+	_, err = state.Exec(`
+		CREATE TABLE IF NOT EXISTS mailboxes (
+			name TEXT PRIMARY KEY,
+			uid_validity INTEGER NOT NULL,
+			last_uid INTEGER NOT NULL DEFAULT 0,
+			highest_modseq INTEGER NOT NULL DEFAULT 0,
+			updated_at TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS messages (
+			mailbox TEXT NOT NULL,
+			uid INTEGER NOT NULL,
+			hash TEXT NOT NULL,
+			sora_uid INTEGER,
+			PRIMARY KEY (mailbox, uid)
+		);
+	`)
+	if err != nil {
+		state.Close()
+		return nil, fmt.Errorf("failed to create state tables: %w", err)
+	}
+
+	migrator := &IMAPMigrator{
+		ctx:     ctx,
+		email:   email,
+		options: options,
+		rdb:     rdb,
+		s3:      s3,
+		state:   state,
+		importer: &Importer{
+			ctx:   ctx,
+			email: email,
+			jobs:  options.Jobs,
+			rdb:   rdb,
+			s3:    s3,
+			options: ImporterOptions{
+				MailboxFilter:  options.MailboxFilter,
+				PreserveFlags:  options.PreserveFlags,
+				MaxMessageSize: options.MaxMessageSize,
+				ImportDelay:    options.ImportDelay,
+				TestMode:       options.TestMode,
+			},
+			mailboxCache: make(map[string]*db.DBMailbox),
+			batchSize:    options.BatchSize,
+		},
+		startTime: time.Now(),
+	}
+	migrator.dial = migrator.dialRemote
+	return migrator, nil
+}
+
+// Close cleans up resources used by the migrator.
+func (m *IMAPMigrator) Close() error {
+	if err := m.state.Close(); err != nil {
+		return fmt.Errorf("failed to close state file: %w", err)
+	}
+	logger.Info("Migration state saved", "path", m.options.StatePath)
+	return nil
+}
+
+// dialRemote connects and logs in to the remote server.
+func (m *IMAPMigrator) dialRemote() (*imapclient.Client, error) {
+	clientOptions := &imapclient.Options{
+		TLSConfig: &tls.Config{InsecureSkipVerify: m.options.InsecureSkipVerify},
+	}
+
+	var c *imapclient.Client
+	var err error
+	switch m.options.Security {
+	case imapSecurityStartTLS:
+		c, err = imapclient.DialStartTLS(m.options.Address, clientOptions)
+	case imapSecurityNone:
+		c, err = imapclient.DialInsecure(m.options.Address, clientOptions)
+	default:
+		c, err = imapclient.DialTLS(m.options.Address, clientOptions)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", m.options.Address, err)
+	}
+
+	if err := c.Login(m.options.Username, m.options.Password).Wait(); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to log in as %s: %w", m.options.Username, err)
+	}
+	return c, nil
+}
+
+// Run migrates the remote mailboxes.
+func (m *IMAPMigrator) Run() error {
+	defer m.Close()
+
+	address, err := server.NewAddress(m.email)
+	if err != nil {
+		return fmt.Errorf("invalid email address format: %w", err)
+	}
+	m.address = address
+
+	if !m.options.DryRun {
+		m.accountID, err = m.rdb.GetAccountIDByAddressWithRetry(m.ctx, address.FullAddress())
+		if err != nil {
+			return fmt.Errorf("account not found: %w", err)
+		}
+	}
+
+	c, err := m.dial()
+	if err != nil {
+		return err
+	}
+	mailboxes, err := m.listMailboxes(c)
+	c.Logout().Wait()
+	c.Close()
+	if err != nil {
+		return err
+	}
+	logger.Info("Found remote mailboxes to migrate", "count", len(mailboxes))
+
+	// Every worker migrates one mailbox at a time on its own connection
+	queue := make(chan remoteMailbox)
+	var failedMailboxes int64
+	var wg sync.WaitGroup
+	for w := 0; w < m.options.Jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var c *imapclient.Client
+			defer func() {
+				if c != nil {
+					c.Logout().Wait()
+					c.Close()
+				}
+			}()
+
+			for mbox := range queue {
+				if c == nil {
+					var err error
+					if c, err = m.dial(); err != nil {
+						logger.Warn("Failed to connect to remote server", "mailbox", mbox.name, "error", err)
+						atomic.AddInt64(&failedMailboxes, 1)
+						continue
+					}
+				}
+				if err := m.migrateMailbox(c, mbox); err != nil {
+					logger.Warn("Failed to migrate mailbox", "mailbox", mbox.name, "error", err)
+					atomic.AddInt64(&failedMailboxes, 1)
+					// The connection may be broken, use a new one for the next mailbox
+					c.Close()
+					c = nil
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, mbox := range mailboxes {
+		select {
+		case queue <- mbox:
+		case <-m.ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if err := m.ctx.Err(); err != nil {
+		logger.Info("Migration cancelled by user")
+		return err
+	}
+
+	m.printSummary()
+	if failedMailboxes > 0 {
+		return fmt.Errorf("%d of %d mailboxes failed, run the migration again to resume", failedMailboxes, len(mailboxes))
+	}
+	return nil
+}
+
+// listMailboxes returns the remote mailboxes to migrate. Mailboxes of other
+// users, shared mailboxes and the virtual \All and \Flagged mailboxes (such
+// as Gmail's All Mail) are skipped.
+func (m *IMAPMigrator) listMailboxes(c *imapclient.Client) ([]remoteMailbox, error) {
+	var prefix string
+	var otherPrefixes []string
+	if c.Caps().Has(imap.CapNamespace) {
+		namespaces, err := c.Namespace().Wait()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get namespaces: %w", err)
+		}
+		if len(namespaces.Personal) > 0 {
+			prefix = namespaces.Personal[0].Prefix
+		}
+		for _, ns := range append(namespaces.Other, namespaces.Shared...) {
+			if ns.Prefix != "" {
+				otherPrefixes = append(otherPrefixes, ns.Prefix)
+			}
+		}
+	}
+
+	listOptions := &imap.ListOptions{ReturnSpecialUse: c.Caps().Has(imap.CapSpecialUse)}
+	list, err := c.List("", "*", listOptions).Collect()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mailboxes: %w", err)
+	}
+
+	var mailboxes []remoteMailbox
+	for _, data := range list {
+		if slices.Contains(data.Attrs, imap.MailboxAttrNoSelect) || slices.Contains(data.Attrs, imap.MailboxAttrNonExistent) {
+			continue
+		}
+		if slices.ContainsFunc(otherPrefixes, func(p string) bool { return strings.HasPrefix(data.Mailbox, p) }) {
+			continue
+		}
+		if slices.Contains(data.Attrs, imap.MailboxAttrAll) || slices.Contains(data.Attrs, imap.MailboxAttrFlagged) {
+			logger.Info("Skipping virtual mailbox", "mailbox", data.Mailbox)
+			continue
+		}
+
+		target := remoteMailboxName(data.Mailbox, data.Delim, prefix, data.Attrs)
+		if !m.importer.shouldImportMailbox(data.Mailbox) && !m.importer.shouldImportMailbox(target) {
+			continue
+		}
+		mailboxes = append(mailboxes, remoteMailbox{name: data.Mailbox, target: target})
+	}
+
+	sort.Slice(mailboxes, func(a, b int) bool { return mailboxes[a].name < mailboxes[b].name })
+	return mailboxes, nil
+}
+
+// remoteMailboxName returns the Sora mailbox of a remote mailbox. Special-use
+// mailboxes map to the special mailboxes, the personal namespace prefix is
+// dropped (INBOX.Work is migrated to Work) and the hierarchy delimiter
+// becomes /.
+func remoteMailboxName(name string, delim rune, prefix string, attrs []imap.MailboxAttr) string {
+	if strings.EqualFold(name, consts.MailboxInbox) {
+		return consts.MailboxInbox
+	}
+	for _, attr := range attrs {
+		switch attr {
+		case imap.MailboxAttrSent:
+			return consts.MailboxSent
+		case imap.MailboxAttrDrafts:
+			return consts.MailboxDrafts
+		case imap.MailboxAttrJunk:
+			return consts.MailboxJunk
+		case imap.MailboxAttrTrash:
+			return consts.MailboxTrash
+		case imap.MailboxAttrArchive:
+			return consts.MailboxArchive
+		}
+	}
+
+	if prefix != "" && len(name) > len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+		name = name[len(prefix):]
+	}
+	if delim != 0 && delim != consts.MailboxDelimiter {
+		name = strings.ReplaceAll(name, string(delim), string(consts.MailboxDelimiter))
+	}
+	return specialMailboxName(name)
+}
+
+// migrateMailbox migrates the messages of a remote mailbox added since the
+// last run, after syncing the flags changed since.
+func (m *IMAPMigrator) migrateMailbox(c *imapclient.Client, mbox remoteMailbox) error {
+	condStore := c.Caps().Has(imap.CapCondStore)
+	selected, err := c.Select(mbox.name, &imap.SelectOptions{ReadOnly: true, CondStore: condStore}).Wait()
+	if err != nil {
+		return fmt.Errorf("failed to select mailbox: %w", err)
+	}
+
+	state, err := m.loadMailboxState(mbox.name)
+	if err != nil {
+		return err
+	}
+	if state.uidValidity != selected.UIDValidity {
+		if state.uidValidity != 0 {
+			logger.Warn("UIDVALIDITY of remote mailbox changed, migrating all messages again",
+				"mailbox", mbox.name, "old", state.uidValidity, "new", selected.UIDValidity)
+		}
+		state = remoteMailboxState{uidValidity: selected.UIDValidity}
+		if !m.options.DryRun {
+			if err := m.resetMailboxState(mbox.name, selected.UIDValidity); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !m.options.DryRun && m.options.PreserveFlags && condStore && state.highestModSeq > 0 &&
+		state.lastUID > 0 && selected.HighestModSeq > state.highestModSeq {
+		if err := m.syncFlags(c, mbox, state); err != nil {
+			return err
+		}
+	}
+
+	var messages []remoteMessage
+	if selected.NumMessages > 0 {
+		if messages, err = m.newMessages(c, state.lastUID); err != nil {
+			return err
+		}
+	}
+	atomic.AddInt64(&m.totalMessages, int64(len(messages)))
+
+	if m.options.DryRun {
+		var count, size int64
+		for _, msg := range messages {
+			if !m.skipMessage(msg) {
+				count++
+				size += msg.size
+			}
+		}
+		logger.Info("DRY RUN: Would migrate mailbox", "mailbox", mbox.name, "target", mbox.target,
+			"messages", count, "size", formatImportSize(size), "last_uid", state.lastUID)
+		return nil
+	}
+
+	logger.Info("Migrating mailbox", "mailbox", mbox.name, "target", mbox.target, "messages", len(messages), "last_uid", state.lastUID)
+	for start := 0; start < len(messages); start += m.options.BatchSize {
+		if err := m.ctx.Err(); err != nil {
+			return err
+		}
+		batch := messages[start:min(start+m.options.BatchSize, len(messages))]
+		lastUID, err := m.migrateBatch(c, mbox, selected.UIDValidity, batch)
+		if lastUID > state.lastUID {
+			state.lastUID = lastUID
+			if saveErr := m.saveMailboxState(mbox.name, state); saveErr != nil {
+				return saveErr
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Flags changed after the SELECT have a higher modseq and are synced by the next run
+	if condStore && selected.HighestModSeq > state.highestModSeq {
+		state.highestModSeq = selected.HighestModSeq
+		if err := m.saveMailboxState(mbox.name, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newMessages returns the messages of the selected mailbox with a UID above
+// lastUID, in UID order.
+func (m *IMAPMigrator) newMessages(c *imapclient.Client, lastUID imap.UID) ([]remoteMessage, error) {
+	uids := imap.UIDSet{imap.UIDRange{Start: lastUID + 1, Stop: 0}}
+	fetched, err := c.Fetch(uids, &imap.FetchOptions{UID: true, RFC822Size: true, InternalDate: true}).Collect()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch message list: %w", err)
+	}
+
+	var messages []remoteMessage
+	for _, buf := range fetched {
+		// UID n:* includes the last message even if its UID is below n
+		if buf.UID <= lastUID {
+			continue
+		}
+		messages = append(messages, remoteMessage{uid: buf.UID, size: buf.RFC822Size, internalDate: buf.InternalDate})
+	}
+	sort.Slice(messages, func(a, b int) bool { return messages[a].uid < messages[b].uid })
+	return messages, nil
+}
+
+// skipMessage applies the date filters and the size limit to a remote
+// message
+func (m *IMAPMigrator) skipMessage(msg remoteMessage) bool {
+	if m.options.StartDate != nil && msg.internalDate.Before(*m.options.StartDate) {
+		return true
+	}
+	if m.options.EndDate != nil && msg.internalDate.After(*m.options.EndDate) {
+		return true
+	}
+	return m.importer.validateMessage(msg.size) != nil
+}
+
+// migrateBatch fetches and imports a batch of messages. It returns the UID up
+// to which all messages were processed, so that a failed batch is fetched
+// again from the first failed message by the next run.
+func (m *IMAPMigrator) migrateBatch(c *imapclient.Client, mbox remoteMailbox, uidValidity uint32, batch []remoteMessage) (imap.UID, error) {
+	var uids imap.UIDSet
+	for _, msg := range batch {
+		if !m.skipMessage(msg) {
+			uids.AddNum(msg.uid)
+		}
+	}
+
+	bodySection := &imap.FetchItemBodySection{Peek: true}
+	fetched := make(map[imap.UID]*imapclient.FetchMessageBuffer)
+	if len(uids) > 0 {
+		bufs, err := c.Fetch(uids, &imap.FetchOptions{
+			UID:          true,
+			Flags:        true,
+			InternalDate: true,
+			BodySection:  []*imap.FetchItemBodySection{bodySection},
+		}).Collect()
+		if err != nil {
+			return 0, fmt.Errorf("failed to fetch messages: %w", err)
+		}
+		for _, buf := range bufs {
+			fetched[buf.UID] = buf
+		}
+	}
+
+	var lastUID imap.UID
+	for _, msg := range batch {
+		buf, ok := fetched[msg.uid]
+		if !ok {
+			// Filtered, or expunged on the remote server since it was listed
+			atomic.AddInt64(&m.skippedMessages, 1)
+			lastUID = msg.uid
+			continue
+		}
+
+		content := buf.FindBodySection(bodySection)
+		if err := m.importMessage(mbox, uidValidity, msg, buf.Flags, content); err != nil {
+			atomic.AddInt64(&m.failedMessages, 1)
+			return lastUID, fmt.Errorf("failed to import message UID %d: %w", msg.uid, err)
+		}
+		lastUID = msg.uid
+
+		if delay := m.importer.options.ImportDelay; delay > 0 {
+			time.Sleep(delay)
+		}
+	}
+	return lastUID, nil
+}
+
+// importMessage uploads a remote message and inserts it into the target
+// mailbox. Messages that cannot be parsed are counted as failed and skipped.
+func (m *IMAPMigrator) importMessage(mbox remoteMailbox, uidValidity uint32, msg remoteMessage, flags []imap.Flag, content []byte) error {
+	up := uploadedMsg{
+		msg: msgInfo{
+			filename: fmt.Sprintf("%d", msg.uid),
+			hash:     HashContent(content),
+			size:     int64(len(content)),
+			mailbox:  mbox.target,
+			date:     msg.internalDate,
+		},
+		content: content,
+	}
+
+	metadata, err := m.importer.parseMessageMetadata(content, up.msg.filename, "")
+	if err != nil {
+		logger.Warn("Failed to parse message, skipping", "mailbox", mbox.name, "uid", msg.uid, "error", err)
+		atomic.AddInt64(&m.failedMessages, 1)
+		return m.recordMessage(mbox.name, msg.uid, up.msg.hash, 0)
+	}
+	if !msg.internalDate.IsZero() {
+		metadata.internalDate = msg.internalDate
+	}
+	if m.options.PreserveFlags {
+		metadata.flags = migratedFlags(flags)
+	}
+	if m.options.PreserveUIDs {
+		uid := uint32(msg.uid)
+		metadata.preservedUID = &uid
+		metadata.preservedUIDValidity = &uidValidity
+	}
+	up.metadata = metadata
+
+	if !m.options.TestMode && m.s3 != nil {
+		s3Key := helpers.NewS3Key(metadata.domain, metadata.localpart, up.msg.hash)
+		if err := m.s3.Put(s3Key, bytes.NewReader(content), up.msg.size); err != nil {
+			return fmt.Errorf("S3 upload failed: %w", err)
+		}
+	}
+
+	mailbox, err := m.importer.getOrCreateMailbox(m.ctx, m.accountID, mbox.target)
+	if err != nil {
+		return fmt.Errorf("failed to get or create mailbox '%s': %w", mbox.target, err)
+	}
+
+	_, soraUID, err := m.rdb.InsertMessageFromImporterWithRetry(m.ctx, insertMessageOptions(m.address, m.accountID, mailbox, up))
+	if errors.Is(err, consts.ErrDBUniqueViolation) {
+		atomic.AddInt64(&m.skippedMessages, 1)
+		return m.recordMessage(mbox.name, msg.uid, up.msg.hash, 0)
+	}
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.importedMessages, 1)
+	return m.recordMessage(mbox.name, msg.uid, up.msg.hash, soraUID)
+}
+
+// syncFlags copies the flags of migrated messages changed on the remote
+// server since the last run.
+func (m *IMAPMigrator) syncFlags(c *imapclient.Client, mbox remoteMailbox, state remoteMailboxState) error {
+	uids := imap.UIDSet{imap.UIDRange{Start: 1, Stop: state.lastUID}}
+	changed, err := c.Fetch(uids, &imap.FetchOptions{UID: true, Flags: true, ChangedSince: state.highestModSeq}).Collect()
+	if err != nil {
+		return fmt.Errorf("failed to fetch changed flags: %w", err)
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	mailbox, err := m.importer.getOrCreateMailbox(m.ctx, m.accountID, mbox.target)
+	if err != nil {
+		return fmt.Errorf("failed to get or create mailbox '%s': %w", mbox.target, err)
+	}
+
+	for _, buf := range changed {
+		soraUID, err := m.migratedUID(mbox.name, buf.UID)
+		if err != nil {
+			return err
+		}
+		if soraUID == 0 {
+			continue
+		}
+		if _, _, err := m.rdb.SetMessageFlagsWithRetry(m.ctx, imap.UID(soraUID), mailbox.ID, migratedFlags(buf.Flags)); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				// Expunged in Sora since it was migrated
+				continue
+			}
+			return fmt.Errorf("failed to update flags of message UID %d: %w", buf.UID, err)
+		}
+		atomic.AddInt64(&m.updatedMessages, 1)
+	}
+	logger.Info("Synced changed flags", "mailbox", mbox.name, "changed", len(changed))
+	return nil
+}
+
+// migratedFlags returns the flags of a remote message to store in Sora.
+// \Recent is session state and is never stored.
+func migratedFlags(flags []imap.Flag) []imap.Flag {
+	var migrated []imap.Flag
+	for _, flag := range flags {
+		if !strings.EqualFold(string(flag), `\Recent`) {
+			migrated = append(migrated, flag)
+		}
+	}
+	return migrated
+}
+
+// loadMailboxState returns the state of a remote mailbox, or the zero state
+// if it was never migrated.
+func (m *IMAPMigrator) loadMailboxState(name string) (remoteMailboxState, error) {
+	var state remoteMailboxState
+	err := m.state.QueryRow(`SELECT uid_validity, last_uid, highest_modseq FROM mailboxes WHERE name = ?`, name).
+		Scan(&state.uidValidity, &state.lastUID, &state.highestModSeq)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return state, fmt.Errorf("failed to read state of mailbox %s: %w", name, err)
+	}
+	return state, nil
+}
+
+// resetMailboxState forgets the migrated messages of a remote mailbox whose
+// UIDVALIDITY changed.
+func (m *IMAPMigrator) resetMailboxState(name string, uidValidity uint32) error {
+	tx, err := m.state.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin state transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM messages WHERE mailbox = ?`, name); err != nil {
+		return fmt.Errorf("failed to reset state of mailbox %s: %w", name, err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO mailboxes (name, uid_validity, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (name) DO UPDATE SET uid_validity = excluded.uid_validity, last_uid = 0, highest_modseq = 0, updated_at = CURRENT_TIMESTAMP
+	`, name, uidValidity)
+	if err != nil {
+		return fmt.Errorf("failed to reset state of mailbox %s: %w", name, err)
+	}
+	return tx.Commit()
+}
+
+// saveMailboxState stores the last UID and HIGHESTMODSEQ of a remote mailbox.
+func (m *IMAPMigrator) saveMailboxState(name string, state remoteMailboxState) error {
+	_, err := m.state.Exec(`UPDATE mailboxes SET last_uid = ?, highest_modseq = ?, updated_at = CURRENT_TIMESTAMP WHERE name = ?`,
+		state.lastUID, state.highestModSeq, name)
+	if err != nil {
+		return fmt.Errorf("failed to save state of mailbox %s: %w", name, err)
+	}
+	return nil
+}
+
+// recordMessage stores the Sora UID of a migrated message, 0 if it was not
+// inserted.
+func (m *IMAPMigrator) recordMessage(mailbox string, uid imap.UID, hash string, soraUID int64) error {
+	_, err := m.state.Exec(`INSERT OR REPLACE INTO messages (mailbox, uid, hash, sora_uid) VALUES (?, ?, ?, ?)`,
+		mailbox, uid, hash, sql.NullInt64{Int64: soraUID, Valid: soraUID > 0})
+	if err != nil {
+		return fmt.Errorf("failed to record message UID %d: %w", uid, err)
+	}
+	return nil
+}
+
+// migratedUID returns the Sora UID of a migrated message, 0 if it is unknown.
+func (m *IMAPMigrator) migratedUID(mailbox string, uid imap.UID) (int64, error) {
+	var soraUID sql.NullInt64
+	err := m.state.QueryRow(`SELECT sora_uid FROM messages WHERE mailbox = ? AND uid = ?`, mailbox, uid).Scan(&soraUID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("failed to read state of message UID %d: %w", uid, err)
+	}
+	return soraUID.Int64, nil
+}
+
+// printSummary prints the migration counters.
+func (m *IMAPMigrator) printSummary() {
+	duration := time.Since(m.startTime)
+	fmt.Printf("\n\nMigration Summary:\n")
+	fmt.Printf("  New messages:      %d\n", m.totalMessages)
+	if m.options.DryRun {
+		fmt.Printf("  Duration:          %s\n", duration.Round(time.Second))
+		return
+	}
+	fmt.Printf("  Imported:          %d\n", m.importedMessages)
+	fmt.Printf("  Skipped:           %d\n", m.skippedMessages)
+	fmt.Printf("  Failed:            %d\n", m.failedMessages)
+	fmt.Printf("  Flags updated:     %d\n", m.updatedMessages)
+	fmt.Printf("  Duration:          %s\n", duration.Round(time.Second))
+	if m.importedMessages > 0 {
+		rate := float64(m.importedMessages) / duration.Seconds()
+		fmt.Printf("  Import rate:       %.1f messages/sec\n", rate)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+	"github.com/migadu/sora/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startRemoteIMAPServer starts an in-memory IMAP server standing in for the
+// server an account is migrated from.
+func startRemoteIMAPServer(t *testing.T, mailboxes ...string) string {
+	t.Helper()
+	user := imapmemserver.NewUser("remote@example.net", "secret")
+	for _, name := range mailboxes {
+		require.NoError(t, user.Create(name, nil))
+	}
+	memServer := imapmemserver.New()
+	memServer.AddUser(user)
+
+	srv := imapserver.New(&imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			return memServer.NewSession(), nil, nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}, imap.CapCondStore: {}, imap.CapNamespace: {}},
+		InsecureAuth: true,
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+func dialRemoteIMAPServer(t *testing.T, addr string) *imapclient.Client {
+	t.Helper()
+	c, err := imapclient.DialInsecure(addr, nil)
+	require.NoError(t, err)
+	require.NoError(t, c.Login("remote@example.net", "secret").Wait())
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func appendRemoteMessage(t *testing.T, c *imapclient.Client, mailbox, subject string, date time.Time, flags ...imap.Flag) {
+	t.Helper()
+	msg := "From: sender@example.net\r\nTo: remote@example.net\r\nSubject: " + subject + "\r\n\r\n" + subject + "\r\n"
+	cmd := c.Append(mailbox, int64(len(msg)), &imap.AppendOptions{Flags: flags, Time: date})
+	_, err := cmd.Write([]byte(msg))
+	require.NoError(t, err)
+	require.NoError(t, cmd.Close())
+	_, err = cmd.Wait()
+	require.NoError(t, err)
+}
+
+func TestIMAPMigrator(t *testing.T) {
+	addr := startRemoteIMAPServer(t, "INBOX", "Sent Items", "Work/Projects")
+	remote := dialRemoteIMAPServer(t, addr)
+
+	date := time.Date(2024, 3, 5, 10, 30, 0, 0, time.UTC)
+	appendRemoteMessage(t, remote, "INBOX", "one", date, imap.FlagSeen)
+	appendRemoteMessage(t, remote, "INBOX", "two", date.Add(time.Hour), imap.FlagFlagged, "$label1")
+	appendRemoteMessage(t, remote, "Sent Items", "sent", date, imap.FlagSeen)
+	appendRemoteMessage(t, remote, "Work/Projects", "work", date)
+
+	mockRDB := newMockResilientDatabase()
+	options := IMAPMigratorOptions{
+		Address:       addr,
+		Username:      "remote@example.net",
+		Password:      "secret",
+		Security:      imapSecurityNone,
+		StatePath:     filepath.Join(t.TempDir(), "state.db"),
+		PreserveFlags: true,
+		PreserveUIDs:  true,
+		Jobs:          2,
+		BatchSize:     1,
+		TestMode:      true,
+	}
+	run := func() {
+		migrator, err := NewIMAPMigrator(context.Background(), "user@example.com", mockRDB, nil, options)
+		require.NoError(t, err)
+		require.NoError(t, migrator.Run())
+	}
+
+	run()
+	require.Len(t, mockRDB.inserted, 4)
+	byMailbox := make(map[string][]*db.InsertMessageOptions)
+	for _, inserted := range mockRDB.inserted {
+		byMailbox[inserted.MailboxName] = append(byMailbox[inserted.MailboxName], inserted)
+	}
+	assert.Len(t, byMailbox["Sent"], 1)
+	assert.Len(t, byMailbox["Work/Projects"], 1)
+	require.Len(t, byMailbox["INBOX"], 2)
+
+	first, second := byMailbox["INBOX"][0], byMailbox["INBOX"][1]
+	assert.Equal(t, "one", first.Subject)
+	assert.ElementsMatch(t, []imap.Flag{imap.FlagSeen}, first.Flags)
+	assert.ElementsMatch(t, []imap.Flag{imap.FlagFlagged, "$label1"}, second.Flags)
+	assert.True(t, date.Equal(first.InternalDate), "internal date %s", first.InternalDate)
+	require.NotNil(t, second.PreservedUID)
+	assert.Equal(t, uint32(2), *second.PreservedUID)
+	require.NotNil(t, second.PreservedUIDValidity)
+
+	// The next run only migrates new messages and flag changes
+	appendRemoteMessage(t, remote, "INBOX", "three", date)
+	_, err := remote.Select("INBOX", nil).Wait()
+	require.NoError(t, err)
+	require.NoError(t, remote.Store(imap.UIDSetNum(1), &imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Flags:  []imap.Flag{imap.FlagAnswered},
+		Silent: true,
+	}, nil).Close())
+
+	run()
+	require.Len(t, mockRDB.inserted, 5)
+	assert.Equal(t, "three", mockRDB.inserted[4].Subject)
+
+	inbox := mockRDB.mailboxes["INBOX"]
+	require.NotNil(t, inbox)
+	assert.ElementsMatch(t, []imap.Flag{imap.FlagSeen, imap.FlagAnswered}, mockRDB.flagUpdates[inbox.ID][1])
+	assert.Len(t, mockRDB.flagUpdates[inbox.ID], 1)
+
+	// Nothing changed since
+	run()
+	assert.Len(t, mockRDB.inserted, 5)
+}
+
+func TestIMAPMigratorDryRun(t *testing.T) {
+	addr := startRemoteIMAPServer(t, "INBOX")
+	remote := dialRemoteIMAPServer(t, addr)
+	appendRemoteMessage(t, remote, "INBOX", "one", time.Now())
+
+	mockRDB := newMockResilientDatabase()
+	migrator, err := NewIMAPMigrator(context.Background(), "user@example.com", mockRDB, nil, IMAPMigratorOptions{
+		Address:   addr,
+		Username:  "remote@example.net",
+		Password:  "secret",
+		Security:  imapSecurityNone,
+		StatePath: filepath.Join(t.TempDir(), "state.db"),
+		DryRun:    true,
+		TestMode:  true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, migrator.Run())
+	assert.Equal(t, int64(1), migrator.totalMessages)
+	assert.Empty(t, mockRDB.inserted)
+}
+
+func TestRemoteMailboxName(t *testing.T) {
+	tests := []struct {
+		name   string
+		delim  rune
+		prefix string
+		attrs  []imap.MailboxAttr
+		want   string
+	}{
+		{"inbox", '/', "", nil, "INBOX"},
+		{"INBOX.Work.Projects", '.', "INBOX.", nil, "Work/Projects"},
+		{"INBOX.Sent", '.', "INBOX.", nil, "Sent"},
+		{"[Gmail]/Sent Mail", '/', "", []imap.MailboxAttr{imap.MailboxAttrSent}, "Sent"},
+		{"Papierkorb", '/', "", []imap.MailboxAttr{imap.MailboxAttrHasNoChildren, imap.MailboxAttrTrash}, "Trash"},
+		{"Deleted Items", '/', "", nil, "Trash"},
+		{"Lists/go-nuts", '/', "", nil, "Lists/go-nuts"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, remoteMailboxName(tt.name, tt.delim, tt.prefix, tt.attrs), tt.name)
+	}
+}
@@ -18,13 +18,15 @@ import (
 func handleImportCommand(ctx context.Context) {
 	if len(os.Args) < 3 {
 		printImportUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	subcommand := os.Args[2]
 	switch subcommand {
 	case "maildir":
 		handleImportMaildir(ctx)
+	case "files":
+		handleImportFiles(ctx)
 	case "s3":
 		handleImportS3(ctx)
 	case "--help", "-h":
@@ -32,13 +34,13 @@ func handleImportCommand(ctx context.Context) {
 	default:
 		fmt.Printf("Unknown import subcommand: %s\n\n", subcommand)
 		printImportUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
 func handleImportMaildir(ctx context.Context) {
 	// Parse import specific flags
-	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
 
 	email := fs.String("email", "", "Email address for the account to import mail to (required)")
 	maildirPath := fs.String("maildir-path", "", "Path to the maildir to import (required)")
@@ -125,53 +127,209 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command name and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	if *email == "" {
 		fmt.Printf("Error: --email is required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	if *maildirPath == "" {
 		fmt.Printf("Error: --maildir-path is required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
+	}
+
+	startDateParsed, endDateParsed := parseDateFilters(*startDate, *endDate)
+
+	options := ImporterOptions{
+		DryRun:               *dryRun,
+		StartDate:            startDateParsed,
+		EndDate:              endDateParsed,
+		MailboxFilter:        parseMailboxFilter(*mailboxFilter),
+		PreserveFlags:        *preserveFlags,
+		ShowProgress:         *showProgress,
+		ForceReimport:        *forceReimport,
+		CleanupDB:            *cleanupDB,
+		Dovecot:              *dovecot,
+		ImportDelay:          *delay,
+		SievePath:            *sievePath,
+		PreserveUIDs:         *preserveUIDs || *dovecot,
+		BatchSize:            *batchSize,
+		BatchTransactionMode: *batchTxMode,
+		Incremental:          *incremental,
+		MaxMessageSize:       globalConfig.GetImportMessageLimit(),
+		Format:               formatMaildir,
+	}
+	runImporter(ctx, *maildirPath, *email, *jobs, options)
+}
+
+// handleImportFiles handles import files, which imports mbox files or .eml
+// files depending on --format.
+func handleImportFiles(ctx context.Context) {
+	fs := flag.NewFlagSet("import files", flag.ContinueOnError)
+
+	email := fs.String("email", "", "Email address for the account to import mail to (required)")
+	path := fs.String("path", "", "Path to the files to import (required)")
+	format := fs.String("format", "", "Format of the files: mbox or eml (required)")
+	gmailLabels := fs.Bool("gmail-labels", true, "Import messages into the mailboxes of their X-Gmail-Labels")
+	jobs := fs.Int("jobs", 4, "Number of parallel import jobs")
+	batchSize := fs.Int("batch-size", 20, "Number of messages to process in each batch (default: 20)")
+	batchTxMode := fs.Bool("batch-transaction", false, "Use single transaction per batch (20x faster but less resilient)")
+	dryRun := fs.Bool("dry-run", false, "Preview what would be imported without making changes")
+	preserveFlags := fs.Bool("preserve-flags", true, "Preserve the flags of the messages (Seen, Answered, etc)")
+	showProgress := fs.Bool("progress", true, "Show import progress")
+	delay := fs.Duration("delay", 0, "Delay between operations to control rate (e.g. 500ms)")
+	forceReimport := fs.Bool("force-reimport", false, "Force reimport of messages even if they already exist")
+	cleanupDB := fs.Bool("cleanup-db", false, "Remove the SQLite import database after successful import")
+	sievePath := fs.String("sieve", "", "Path to Sieve script file to import for the user")
+	mailboxFilter := fs.String("mailbox-filter", "", "Comma-separated list of mailboxes to import (e.g. INBOX,Sent)")
+	startDate := fs.String("start-date", "", "Import only messages after this date (YYYY-MM-DD)")
+	endDate := fs.String("end-date", "", "Import only messages before this date (YYYY-MM-DD)")
+	incremental := fs.Bool("incremental", false, "Skip messages already marked as imported in SQLite cache")
+
+	fs.Usage = func() {
+		fmt.Printf(`Import mbox or .eml files from a given path
+
+Usage:
+  sora-admin import files --format mbox|eml [options]
+
+With --format mbox the path is an mbox file or a directory of mbox files, as exported by Thunderbird
+(Inbox, Inbox.sbd/Work), Apple Mail (Work.mbox/mbox) or Google Takeout (Work.mbox). Each file is
+imported into the mailbox named after it. Thunderbird X-Mozilla-Status and X-Mozilla-Keys headers and
+mbox Status, X-Status and X-Keywords headers become flags; messages Thunderbird marked as deleted are
+skipped. The date filters use the date of the From line.
+
+With --format eml the path is a directory of .eml files. Files at the top are imported into INBOX,
+files in subdirectories into the mailbox named after the directory.
+
+In both formats, messages with X-Gmail-Labels headers go to the mailboxes of their labels instead
+(Inbox, Sent, Drafts, Spam and Trash map to the special mailboxes; Starred and Unread to flags;
+messages without a folder label to Archive).
+
+Options:
+  --email string          Email address for the account to import mail to (required)
+  --path string           Path to the files to import (required)
+  --format string         Format of the files: mbox or eml (required)
+  --gmail-labels          Import messages into the mailboxes of their X-Gmail-Labels (default: true)
+  --jobs int              Number of parallel import jobs (default: 4)
+  --batch-size int        Number of messages to process in each batch (default: 20)
+  --batch-transaction     Use single transaction per batch (20x faster but less resilient, default: false)
+  --dry-run               Preview what would be imported without making changes
+  --preserve-flags        Preserve the flags of the messages (default: true)
+  --progress              Show import progress (default: true)
+  --delay duration        Delay between operations to control rate (e.g. 500ms)
+  --force-reimport        Force reimport of messages even if they already exist
+  --cleanup-db            Remove the SQLite import database after successful import
+  --incremental           Skip messages already marked as imported in SQLite cache (default: false = read all)
+  --sieve string          Path to Sieve script file to import for the user
+  --mailbox-filter string Comma-separated list of mailboxes to import (e.g. INBOX,Sent,Archive*)
+  --start-date string     Import only messages after this date (YYYY-MM-DD)
+  --end-date string       Import only messages before this date (YYYY-MM-DD)
+  --config string        Path to TOML configuration file (required)
+
+Dry runs, date filters and duplicate detection work as for maildir imports.
+
+Examples:
+  # Import a Google Takeout mbox file
+  sora-admin import files --format mbox --email user@example.com --path "Takeout/Mail/All mail Including Spam and Trash.mbox"
+
+  # Import a Thunderbird profile folder
+  sora-admin import files --format mbox --email user@example.com --path ~/.thunderbird/abcd.default/Mail/Local\ Folders
+
+  # Import a Takeout mbox file as a single mailbox
+  sora-admin import files --format mbox --email user@example.com --path Takeout/Mail/Work.mbox --gmail-labels=false
+
+  # Import a directory of .eml files
+  sora-admin import files --format eml --email user@example.com --path /backup/eml --dry-run
+`)
+	}
+
+	// Parse the remaining arguments (skip the command name and subcommand name)
+	parseFlags(fs, os.Args[3:])
+
+	// Validate required arguments
+	if *email == "" {
+		fmt.Printf("Error: --email is required\n\n")
+		fs.Usage()
+		exit(1)
+	}
+
+	if *path == "" {
+		fmt.Printf("Error: --path is required\n\n")
+		fs.Usage()
+		exit(1)
+	}
+
+	if *format != formatMbox && *format != formatEML {
+		fmt.Printf("Error: --format must be mbox or eml\n\n")
+		fs.Usage()
+		exit(1)
+	}
+
+	startDateParsed, endDateParsed := parseDateFilters(*startDate, *endDate)
+
+	options := ImporterOptions{
+		DryRun:               *dryRun,
+		StartDate:            startDateParsed,
+		EndDate:              endDateParsed,
+		MailboxFilter:        parseMailboxFilter(*mailboxFilter),
+		PreserveFlags:        *preserveFlags,
+		ShowProgress:         *showProgress,
+		ForceReimport:        *forceReimport,
+		CleanupDB:            *cleanupDB,
+		ImportDelay:          *delay,
+		SievePath:            *sievePath,
+		BatchSize:            *batchSize,
+		BatchTransactionMode: *batchTxMode,
+		Incremental:          *incremental,
+		MaxMessageSize:       globalConfig.GetImportMessageLimit(),
+		Format:               *format,
+		GmailLabels:          *gmailLabels,
 	}
+	runImporter(ctx, *path, *email, *jobs, options)
+}
 
-	// Parse date filters
-	var startDateParsed, endDateParsed *time.Time
-	if *startDate != "" {
-		t, err := time.Parse("2006-01-02", *startDate)
+// parseDateFilters parses the --start-date and --end-date flags of imports
+// and exports. The end date includes the whole day.
+func parseDateFilters(startDate, endDate string) (startDateParsed, endDateParsed *time.Time) {
+	if startDate != "" {
+		t, err := time.Parse("2006-01-02", startDate)
 		if err != nil {
 			fmt.Printf("Error: Invalid start date format. Use YYYY-MM-DD\n")
-			os.Exit(1)
+			exit(1)
 		}
 		startDateParsed = &t
 	}
-	if *endDate != "" {
-		t, err := time.Parse("2006-01-02", *endDate)
+	if endDate != "" {
+		t, err := time.Parse("2006-01-02", endDate)
 		if err != nil {
 			fmt.Printf("Error: Invalid end date format. Use YYYY-MM-DD\n")
-			os.Exit(1)
+			exit(1)
 		}
 		// Add 23:59:59 to include the entire end date
 		t = t.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
 		endDateParsed = &t
 	}
+	return startDateParsed, endDateParsed
+}
 
-	// Parse mailbox filter
-	var mailboxList []string
-	if *mailboxFilter != "" {
-		mailboxList = strings.Split(*mailboxFilter, ",")
-		for i := range mailboxList {
-			mailboxList[i] = strings.TrimSpace(mailboxList[i])
-		}
+// parseMailboxFilter parses the comma-separated --mailbox-filter flag.
+func parseMailboxFilter(mailboxFilter string) []string {
+	if mailboxFilter == "" {
+		return nil
+	}
+	mailboxList := strings.Split(mailboxFilter, ",")
+	for i := range mailboxList {
+		mailboxList[i] = strings.TrimSpace(mailboxList[i])
 	}
+	return mailboxList
+}
 
+// runImporter imports the messages at path into the account and exits.
+func runImporter(ctx context.Context, path, email string, jobs int, options ImporterOptions) {
 	// Connect to resilient database
 	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
 	if err != nil {
@@ -183,61 +341,32 @@ Examples:
 	// NOTE: Importer supports TestMode, but the CLI normally requires S3 connectivity.
 	// For integration tests (and some migration workflows), we allow skipping S3 by
 	// setting SORA_ADMIN_SKIP_S3=1.
-	var s3 *storage.S3Storage
+	var s3 storage.BlobStore
 	if os.Getenv("SORA_ADMIN_SKIP_S3") == "1" {
 		logger.Info("S3 disabled via SORA_ADMIN_SKIP_S3=1")
 		s3 = nil
 	} else {
-		s3Timeout, err := globalConfig.S3.GetTimeout()
+		s3, err = newBlobStore(globalConfig)
 		if err != nil {
-			logger.Fatalf("Failed to parse S3 timeout: %v", err)
+			logger.Fatalf("Failed to initialize storage: %v", err)
 		}
-		s3, err = storage.New(globalConfig.S3.Endpoint, globalConfig.S3.AccessKey, globalConfig.S3.SecretKey, globalConfig.S3.Bucket, !globalConfig.S3.DisableTLS, globalConfig.S3.GetDebug(), s3Timeout)
-		if err != nil {
-			logger.Fatalf("Failed to connect to S3: %v", err)
-		}
-		if globalConfig.S3.Encrypt {
-			if err := s3.EnableEncryption(globalConfig.S3.EncryptionKey); err != nil {
-				logger.Fatalf("Failed to enable S3 encryption: %v", err)
-			}
-		}
-	}
-
-	// Create importer options
-	options := ImporterOptions{
-		DryRun:               *dryRun,
-		StartDate:            startDateParsed,
-		EndDate:              endDateParsed,
-		MailboxFilter:        mailboxList,
-		PreserveFlags:        *preserveFlags,
-		ShowProgress:         *showProgress,
-		ForceReimport:        *forceReimport,
-		CleanupDB:            *cleanupDB,
-		Dovecot:              *dovecot,
-		ImportDelay:          *delay,
-		SievePath:            *sievePath,
-		PreserveUIDs:         *preserveUIDs || *dovecot,
-		TestMode:             s3 == nil,
-		BatchSize:            *batchSize,
-		BatchTransactionMode: *batchTxMode,
-		Incremental:          *incremental,
-		MaxMessageSize:       globalConfig.GetImportMessageLimit(),
 	}
+	options.TestMode = s3 == nil
 
-	importer, err := NewImporter(ctx, *maildirPath, *email, *jobs, rdb, s3, options)
+	importer, err := NewImporter(ctx, path, email, jobs, rdb, s3, options)
 	if err != nil {
 		logger.Fatalf("Failed to create importer: %v", err)
 	}
 
 	if err := importer.Run(); err != nil {
-		logger.Fatalf("Failed to import maildir: %v", err)
+		logger.Fatalf("Failed to import %s: %v", options.Format, err)
 	}
-	os.Exit(0)
+	exit(0)
 }
 
 func handleImportS3(ctx context.Context) {
 	// Define flag set for S3 import
-	fs := flag.NewFlagSet("import s3", flag.ExitOnError)
+	fs := flag.NewFlagSet("import s3", flag.ContinueOnError)
 
 	// Define flags
 	email := fs.String("email", "", "Email address to import messages for")
@@ -252,9 +381,7 @@ func handleImportS3(ctx context.Context) {
 	continuationToken := fs.String("continuation-token", "", "S3 continuation token to resume from")
 
 	// Parse the flags
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Failed to parse flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	// Validate required flags
@@ -270,18 +397,9 @@ func handleImportS3(ctx context.Context) {
 	defer rdb.Close()
 
 	// Connect to S3
-	s3Timeout, err := globalConfig.S3.GetTimeout()
-	if err != nil {
-		logger.Fatalf("Failed to parse S3 timeout: %v", err)
-	}
-	s3, err := storage.New(globalConfig.S3.Endpoint, globalConfig.S3.AccessKey, globalConfig.S3.SecretKey, globalConfig.S3.Bucket, !globalConfig.S3.DisableTLS, globalConfig.S3.GetDebug(), s3Timeout)
+	s3, err := newBlobStore(globalConfig)
 	if err != nil {
-		logger.Fatalf("Failed to connect to S3: %v", err)
-	}
-	if globalConfig.S3.Encrypt {
-		if err := s3.EnableEncryption(globalConfig.S3.EncryptionKey); err != nil {
-			logger.Fatalf("Failed to enable S3 encryption: %v", err)
-		}
+		logger.Fatalf("Failed to initialize storage: %v", err)
 	}
 
 	// Configure S3 importer options
@@ -306,31 +424,33 @@ func handleImportS3(ctx context.Context) {
 	if err := importer.Run(); err != nil {
 		logger.Fatalf("Failed to import from S3: %v", err)
 	}
-	os.Exit(0)
+	exit(0)
 }
 
 func handleExportCommand(ctx context.Context) {
 	if len(os.Args) < 3 {
 		printExportUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	subcommand := os.Args[2]
 	switch subcommand {
 	case "maildir":
 		handleExportMaildir(ctx)
+	case "files":
+		handleExportFiles(ctx)
 	case "--help", "-h":
 		printExportUsage()
 	default:
 		fmt.Printf("Unknown export subcommand: %s\n\n", subcommand)
 		printExportUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
 func handleExportMaildir(ctx context.Context) {
 	// Parse export specific flags
-	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
 
 	email := fs.String("email", "", "Email address for the account to export mail from (required)")
 	maildirPath := fs.String("maildir-path", "", "Path where the maildir will be created/updated (required)")
@@ -389,74 +509,22 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command name and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	if *email == "" {
 		fmt.Printf("Error: --email is required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	if *maildirPath == "" {
 		fmt.Printf("Error: --maildir-path is required\n\n")
 		fs.Usage()
-		os.Exit(1)
-	}
-
-	// Parse date filters
-	var startDateParsed, endDateParsed *time.Time
-	if *startDate != "" {
-		t, err := time.Parse("2006-01-02", *startDate)
-		if err != nil {
-			fmt.Printf("Error: Invalid start date format. Use YYYY-MM-DD\n")
-			os.Exit(1)
-		}
-		startDateParsed = &t
-	}
-	if *endDate != "" {
-		t, err := time.Parse("2006-01-02", *endDate)
-		if err != nil {
-			fmt.Printf("Error: Invalid end date format. Use YYYY-MM-DD\n")
-			os.Exit(1)
-		}
-		// Add 23:59:59 to include the entire end date
-		t = t.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
-		endDateParsed = &t
-	}
-
-	// Parse mailbox filter
-	var mailboxList []string
-	if *mailboxFilter != "" {
-		mailboxList = strings.Split(*mailboxFilter, ",")
-		for i := range mailboxList {
-			mailboxList[i] = strings.TrimSpace(mailboxList[i])
-		}
-	}
-
-	// Connect to resilient database
-	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
-	if err != nil {
-		logger.Fatalf("Failed to initialize resilient database: %v", err)
+		exit(1)
 	}
-	defer rdb.Close()
 
-	// Connect to S3
-	s3Timeout, err := globalConfig.S3.GetTimeout()
-	if err != nil {
-		logger.Fatalf("Failed to parse S3 timeout: %v", err)
-	}
-	s3, err := storage.New(globalConfig.S3.Endpoint, globalConfig.S3.AccessKey, globalConfig.S3.SecretKey, globalConfig.S3.Bucket, !globalConfig.S3.DisableTLS, globalConfig.S3.GetDebug(), s3Timeout)
-	if err != nil {
-		logger.Fatalf("Failed to connect to S3: %v", err)
-	}
-	if globalConfig.S3.Encrypt {
-		if err := s3.EnableEncryption(globalConfig.S3.EncryptionKey); err != nil {
-			logger.Fatalf("Failed to enable S3 encryption: %v", err)
-		}
-	}
+	startDateParsed, endDateParsed := parseDateFilters(*startDate, *endDate)
 
 	// If dovecot flag is enabled, also enable UID list export
 	exportUIDListEnabled := *exportUIDList || *dovecot
@@ -466,23 +534,127 @@ Examples:
 		DryRun:         *dryRun,
 		StartDate:      startDateParsed,
 		EndDate:        endDateParsed,
-		MailboxFilter:  mailboxList,
+		MailboxFilter:  parseMailboxFilter(*mailboxFilter),
 		ShowProgress:   *showProgress,
 		Dovecot:        *dovecot,
 		OverwriteFlags: *overwriteFlags,
 		ExportDelay:    *delay,
 		ExportUIDList:  exportUIDListEnabled,
+		Format:         formatMaildir,
+	}
+
+	runExporter(ctx, *maildirPath, *email, *jobs, options)
+}
+
+// handleExportFiles handles export files, which exports mbox files or .eml
+// files depending on --format.
+func handleExportFiles(ctx context.Context) {
+	fs := flag.NewFlagSet("export files", flag.ContinueOnError)
+
+	email := fs.String("email", "", "Email address for the account to export mail from (required)")
+	path := fs.String("path", "", "Path where the files will be created/updated (required)")
+	format := fs.String("format", "", "Format of the files: mbox or eml (required)")
+	jobs := fs.Int("jobs", 4, "Number of parallel export jobs")
+	dryRun := fs.Bool("dry-run", false, "Preview what would be exported without making changes")
+	showProgress := fs.Bool("progress", true, "Show export progress")
+	delay := fs.Duration("delay", 0, "Delay between operations to control rate (e.g. 500ms)")
+	mailboxFilter := fs.String("mailbox-filter", "", "Comma-separated list of mailboxes to export (e.g. INBOX,Sent)")
+	startDate := fs.String("start-date", "", "Export only messages after this date (YYYY-MM-DD)")
+	endDate := fs.String("end-date", "", "Export only messages before this date (YYYY-MM-DD)")
+
+	fs.Usage = func() {
+		fmt.Printf(`Export messages to mbox or .eml files
+
+Usage:
+  sora-admin export files --format mbox|eml [options]
+
+With --format mbox each mailbox is exported to <mailbox>.mbox (e.g. Work/Projects.mbox), with flags
+in Status, X-Status and X-Keywords headers. Exporting again appends new messages. With --format eml
+messages are exported as <mailbox>/<uid>.eml, dated with their internal date; flags are not kept.
+Both layouts can be imported with 'sora-admin import files' and the same --format.
+
+Options:
+  --email string          Email address for the account to export mail from (required)
+  --path string           Path where the files will be created/updated (required)
+  --format string         Format of the files: mbox or eml (required)
+  --jobs int              Number of parallel export jobs (default: 4)
+  --dry-run               Preview what would be exported without making changes
+  --progress              Show export progress (default: true)
+  --delay duration        Delay between operations to control rate (e.g. 500ms)
+  --mailbox-filter string Comma-separated list of mailboxes to export (e.g. INBOX,Sent,Archive*)
+  --start-date string     Export only messages after this date (YYYY-MM-DD)
+  --end-date string       Export only messages before this date (YYYY-MM-DD)
+  --config string        Path to TOML configuration file (required)
+
+The exporter creates a SQLite database (sora-maildir.db) in the path to track exported
+messages and avoid duplicates.
+
+Examples:
+  sora-admin export files --format mbox --email user@example.com --path /backup/mbox
+  sora-admin export files --format eml --email user@example.com --path /backup/eml --mailbox-filter INBOX,Sent
+`)
+	}
+
+	// Parse the remaining arguments (skip the command name and subcommand name)
+	parseFlags(fs, os.Args[3:])
+
+	// Validate required arguments
+	if *email == "" {
+		fmt.Printf("Error: --email is required\n\n")
+		fs.Usage()
+		exit(1)
+	}
+
+	if *path == "" {
+		fmt.Printf("Error: --path is required\n\n")
+		fs.Usage()
+		exit(1)
+	}
+
+	if *format != formatMbox && *format != formatEML {
+		fmt.Printf("Error: --format must be mbox or eml\n\n")
+		fs.Usage()
+		exit(1)
+	}
+
+	startDateParsed, endDateParsed := parseDateFilters(*startDate, *endDate)
+
+	options := ExporterOptions{
+		DryRun:        *dryRun,
+		StartDate:     startDateParsed,
+		EndDate:       endDateParsed,
+		MailboxFilter: parseMailboxFilter(*mailboxFilter),
+		ShowProgress:  *showProgress,
+		ExportDelay:   *delay,
+		Format:        *format,
+	}
+	runExporter(ctx, *path, *email, *jobs, options)
+}
+
+// runExporter exports the messages of the account to path and exits.
+func runExporter(ctx context.Context, path, email string, jobs int, options ExporterOptions) {
+	// Connect to resilient database
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	// Connect to S3
+	s3, err := newBlobStore(globalConfig)
+	if err != nil {
+		logger.Fatalf("Failed to initialize storage: %v", err)
 	}
 
-	exporter, err := NewExporter(ctx, *maildirPath, *email, *jobs, rdb, s3, options)
+	exporter, err := NewExporter(ctx, path, email, jobs, rdb, s3, options)
 	if err != nil {
 		logger.Fatalf("Failed to create exporter: %v", err)
 	}
 
 	if err := exporter.Run(); err != nil {
-		logger.Fatalf("Failed to export maildir: %v", err)
+		logger.Fatalf("Failed to export %s: %v", options.Format, err)
 	}
-	os.Exit(0)
+	exit(0)
 }
 
 func printImportUsage() {
@@ -493,6 +665,7 @@ Usage:
 
 Subcommands:
   maildir        Import maildir data
+  files          Import mbox or .eml files (--format mbox|eml)
   s3             Import messages from S3 storage (recovery scenario)
   fix-subscriptions  Fix subscription status for default mailboxes
 
@@ -500,6 +673,8 @@ Examples:
   sora-admin import maildir --email user@example.com --maildir-path /var/vmail/user/Maildir
   sora-admin import maildir --email user@example.com --maildir-path /home/user/Maildir --dry-run
   sora-admin import maildir --email user@example.com --maildir-path /var/vmail/user/Maildir --dovecot
+  sora-admin import files --format mbox --email user@example.com --path /backup/Takeout/Mail
+  sora-admin import files --format eml --email user@example.com --path /backup/eml
   sora-admin import s3 --email user@example.com --dry-run
   sora-admin import s3 --email user@example.com --workers 5 --batch-size 500
 
@@ -515,11 +690,14 @@ Usage:
 
 Subcommands:
   maildir  Export messages to maildir format
+  files    Export messages to mbox or .eml files (--format mbox|eml)
 
 Examples:
   sora-admin export maildir --email user@example.com --maildir-path /var/backup/user/Maildir
   sora-admin export maildir --email user@example.com --maildir-path /backup/maildir --mailbox-filter INBOX,Sent
   sora-admin export maildir --email user@example.com --maildir-path /backup/maildir --dovecot
+  sora-admin export files --format mbox --email user@example.com --path /backup/mbox
+  sora-admin export files --format eml --email user@example.com --path /backup/eml
 
 Use 'sora-admin export <subcommand> --help' for detailed help.
 `)
@@ -50,6 +50,8 @@ type ImporterOptions struct {
 	BatchTransactionMode bool          // Use single transaction per batch (faster but less resilient, default: false)
 	Incremental          bool          // Use SQLite cache to skip already-imported messages (default: false = always read all)
 	MaxMessageSize       int64         // Maximum message size to import (bytes, 0 = use default)
+	Format               string        // maildir (default), mbox or eml
+	GmailLabels          bool          // Import messages into the mailboxes of their X-Gmail-Labels
 }
 
 // resilientDB defines the interface for database operations needed by the importer.
@@ -68,6 +70,7 @@ type resilientDB interface {
 	QueryRowWithRetry(ctx context.Context, sql string, args ...any) pgx.Row
 	GetOrCreateMailboxByNameWithRetry(ctx context.Context, accountID int64, name string) (*db.DBMailbox, error)
 	InsertMessageFromImporterWithRetry(ctx context.Context, opts *db.InsertMessageOptions) (int64, int64, error)
+	SetMessageFlagsWithRetry(ctx context.Context, messageUID imap.UID, mailboxID int64, newFlags []imap.Flag) ([]imap.Flag, int64, error)
 	DeleteMessageByHashAndMailboxWithRetry(ctx context.Context, accountID, mailboxID int64, hash string) (int64, error)
 	BeginTxWithRetry(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
 	GetOperationalDatabase() *db.Database
@@ -80,6 +83,25 @@ type msgInfo struct {
 	hash     string
 	size     int64
 	mailbox  string
+	offset   int64     // Offset of the message in an mbox file
+	date     time.Time // Date of an mbox message, zero for message files
+}
+
+// msgInfoColumns are the SQLite columns read by scanMsgInfo
+const msgInfoColumns = "path, filename, hash, size, mailbox, mbox_offset, internal_date"
+
+// scanMsgInfo reads a message of the SQLite database
+func scanMsgInfo(rows *sql.Rows) (msgInfo, error) {
+	var msg msgInfo
+	var offset, internalDate sql.NullInt64
+	if err := rows.Scan(&msg.path, &msg.filename, &msg.hash, &msg.size, &msg.mailbox, &offset, &internalDate); err != nil {
+		return msg, err
+	}
+	msg.offset = offset.Int64
+	if internalDate.Valid {
+		msg.date = time.Unix(internalDate.Int64, 0)
+	}
+	return msg, nil
 }
 
 // uploadedMsg represents a successfully uploaded message
@@ -98,7 +120,9 @@ type messageMetadata struct {
 	subject              string
 	plaintextBody        string
 	sentDate             time.Time
+	internalDate         time.Time
 	inReplyTo            []string
+	references           []string
 	bodyStructure        *imap.BodyStructure
 	recipients           []helpers.Recipient
 	rawHeaders           string
@@ -142,7 +166,12 @@ type Importer struct {
 // NewImporter creates a new Importer instance.
 func NewImporter(ctx context.Context, maildirPath, email string, jobs int, rdb *resilient.ResilientDatabase, s3 objectStorage, options ImporterOptions) (*Importer, error) {
 	// Always create SQLite database in the maildir path to persist maildir state
-	dbPath := filepath.Join(maildirPath, "sora-maildir.db")
+	dbDir := maildirPath
+	if info, err := os.Stat(maildirPath); err == nil && !info.IsDir() {
+		// A single mbox file
+		dbDir = filepath.Dir(maildirPath)
+	}
+	dbPath := filepath.Join(dbDir, "sora-maildir.db")
 
 	if options.Incremental {
 		logger.Info("Using maildir database for incremental import", "path", dbPath)
@@ -165,6 +194,7 @@ func NewImporter(ctx context.Context, maildirPath, email string, jobs int, rdb *
 
 	// Create the table for storing message information.
 	// s3_uploaded tracks whether the message has been successfully uploaded to S3
+	// mbox_offset and internal_date are only set for messages of mbox files
 	_, err = sqliteDB.Exec(`
 		CREATE TABLE IF NOT EXISTS messages (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -175,6 +205,8 @@ func NewImporter(ctx context.Context, maildirPath, email string, jobs int, rdb *
 			mailbox TEXT NOT NULL,
 			s3_uploaded INTEGER DEFAULT 0,
 			s3_uploaded_at TIMESTAMP,
+			mbox_offset INTEGER,
+			internal_date INTEGER,
 			UNIQUE(hash, mailbox),
 			UNIQUE(filename, mailbox)
 		);
@@ -218,6 +250,26 @@ func NewImporter(ctx context.Context, maildirPath, email string, jobs int, rdb *
 		logger.Info("SQLite database migration completed successfully - all existing messages marked as uploaded")
 	}
 
+	// Migrate existing databases: add the mbox columns if they don't exist
+	err = sqliteDB.QueryRow(`
+		SELECT COUNT(*) > 0
+		FROM pragma_table_info('messages')
+		WHERE name='mbox_offset'
+	`).Scan(&columnExists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for mbox_offset column: %w", err)
+	}
+
+	if !columnExists {
+		logger.Info("Migrating SQLite database: adding mbox columns")
+		if _, err = sqliteDB.Exec(`ALTER TABLE messages ADD COLUMN mbox_offset INTEGER`); err != nil {
+			return nil, fmt.Errorf("failed to add mbox_offset column: %w", err)
+		}
+		if _, err = sqliteDB.Exec(`ALTER TABLE messages ADD COLUMN internal_date INTEGER`); err != nil {
+			return nil, fmt.Errorf("failed to add internal_date column: %w", err)
+		}
+	}
+
 	// Create index after migration (idempotent operation)
 	_, err = sqliteDB.Exec(`CREATE INDEX IF NOT EXISTS idx_s3_uploaded ON messages(s3_uploaded)`)
 	if err != nil {
@@ -386,9 +438,22 @@ func (i *Importer) Run() error {
 		}
 	}
 
-	logger.Info("Scanning maildir...")
-	if err := i.scanMaildir(); err != nil {
-		return fmt.Errorf("failed to scan maildir: %w", err)
+	switch i.options.Format {
+	case formatMbox:
+		logger.Info("Scanning mbox files...")
+		if err := i.scanMbox(); err != nil {
+			return fmt.Errorf("failed to scan mbox files: %w", err)
+		}
+	case formatEML:
+		logger.Info("Scanning .eml files...")
+		if err := i.scanEML(); err != nil {
+			return fmt.Errorf("failed to scan .eml files: %w", err)
+		}
+	default:
+		logger.Info("Scanning maildir...")
+		if err := i.scanMaildir(); err != nil {
+			return fmt.Errorf("failed to scan maildir: %w", err)
+		}
 	}
 
 	// Sync mailbox state (UIDVALIDITY) before starting import
@@ -721,10 +786,10 @@ func (i *Importer) performDryRun() error {
 	var query string
 	if i.options.Incremental {
 		// Incremental mode: only show messages not yet uploaded
-		query = "SELECT path, filename, hash, size, mailbox FROM messages WHERE s3_uploaded = 0 ORDER BY mailbox, path"
+		query = "SELECT " + msgInfoColumns + " FROM messages WHERE s3_uploaded = 0 ORDER BY mailbox, path, mbox_offset"
 	} else {
 		// Non-incremental mode: show all messages
-		query = "SELECT path, filename, hash, size, mailbox FROM messages ORDER BY mailbox, path"
+		query = "SELECT " + msgInfoColumns + " FROM messages ORDER BY mailbox, path, mbox_offset"
 	}
 
 	rows, err := i.sqliteDB.Query(query)
@@ -738,12 +803,12 @@ func (i *Importer) performDryRun() error {
 	var mailboxWouldImport, mailboxWouldSkip int
 
 	for rows.Next() {
-		var path, filename, hash, mailbox string
-		var size int64
-		if err := rows.Scan(&path, &filename, &hash, &size, &mailbox); err != nil {
+		msg, err := scanMsgInfo(rows)
+		if err != nil {
 			logger.Info("Failed to scan row", "error", err)
 			continue
 		}
+		path, filename, hash, size, mailbox := msg.path, msg.filename, msg.hash, msg.size, msg.mailbox
 
 		totalToScan++
 
@@ -762,7 +827,7 @@ func (i *Importer) performDryRun() error {
 		}
 
 		// Check date filter if specified
-		if i.shouldSkipMessage(path) {
+		if i.shouldSkipMessage(msg) {
 			mailboxWouldSkip++
 			totalWouldSkip++
 			continue
@@ -803,27 +868,39 @@ func (i *Importer) performDryRun() error {
 		dateStr := "(unknown date)"
 
 		// Try to extract subject and date from message file
-		if info, err := os.Stat(path); err == nil {
+		if !msg.date.IsZero() {
+			dateStr = msg.date.Format("2006-01-02 15:04")
+		} else if info, err := os.Stat(path); err == nil {
 			dateStr = info.ModTime().Format("2006-01-02 15:04")
 		}
 
 		// Try to get subject from message content (first few hundred bytes)
-		if file, err := os.Open(path); err == nil {
+		var head []byte
+		var mboxContent []byte
+		var mboxFlags []imap.Flag
+		if i.options.Format == formatMbox {
+			// Messages of mbox files are read on their own
+			mboxContent, mboxFlags, _ = readMboxMessage(path, msg.offset, hash)
+			head = mboxContent[:min(len(mboxContent), 1024)]
+		} else if file, err := os.Open(path); err == nil {
 			buffer := make([]byte, 1024)
 			if n, err := file.Read(buffer); err == nil {
-				content := string(buffer[:n])
-				// Simple subject extraction
-				if idx := strings.Index(strings.ToLower(content), "subject:"); idx != -1 {
-					subjectLine := content[idx+8:]
-					if endIdx := strings.Index(subjectLine, "\n"); endIdx != -1 {
-						subject = strings.TrimSpace(subjectLine[:endIdx])
-						if len(subject) > 50 {
-							subject = subject[:47] + "..."
-						}
+				head = buffer[:n]
+			}
+			file.Close()
+		}
+		if head != nil {
+			content := string(head)
+			// Simple subject extraction
+			if idx := strings.Index(strings.ToLower(content), "subject:"); idx != -1 {
+				subjectLine := content[idx+8:]
+				if endIdx := strings.Index(subjectLine, "\n"); endIdx != -1 {
+					subject = strings.TrimSpace(subjectLine[:endIdx])
+					if len(subject) > 50 {
+						subject = subject[:47] + "..."
 					}
 				}
 			}
-			file.Close()
 		}
 
 		if subject == "" || subject == "\r" {
@@ -842,6 +919,14 @@ func (i *Importer) performDryRun() error {
 		// Show flags if preserve-flags is enabled
 		if i.options.PreserveFlags {
 			flags := i.parseMaildirFlags(filename)
+			switch i.options.Format {
+			case formatMbox:
+				flags = i.sourceFlags(mboxContent, mboxFlags)
+			case formatEML:
+				if content, err := os.ReadFile(path); err == nil {
+					flags = i.sourceFlags(content, nil)
+				}
+			}
 			if len(flags) > 0 {
 				var flagNames []string
 				for _, flag := range flags {
@@ -964,22 +1049,29 @@ func (i *Importer) resolveMailboxName(path string) (string, error) {
 		mailboxName = strings.TrimSpace(mailboxName)
 
 		// Handle special folder name mappings
-		switch strings.ToLower(mailboxName) {
-		case "sent", "sent items", "sent mail":
-			mailboxName = "Sent"
-		case "drafts", "draft":
-			mailboxName = "Drafts"
-		case "trash", "deleted", "deleted items":
-			mailboxName = "Trash"
-		case "junk", "spam":
-			mailboxName = "Junk"
-		case "archive", "archives":
-			mailboxName = "Archive"
-		}
+		mailboxName = specialMailboxName(mailboxName)
 	}
 	return mailboxName, nil
 }
 
+// specialMailboxName maps the common names of special folders to the names
+// Sora uses.
+func specialMailboxName(name string) string {
+	switch strings.ToLower(name) {
+	case "sent", "sent items", "sent mail":
+		return "Sent"
+	case "drafts", "draft":
+		return "Drafts"
+	case "trash", "deleted", "deleted items":
+		return "Trash"
+	case "junk", "spam":
+		return "Junk"
+	case "archive", "archives":
+		return "Archive"
+	}
+	return name
+}
+
 // parseMaildirFlags extracts IMAP flags from a maildir filename.
 func (i *Importer) parseMaildirFlags(filename string) []imap.Flag {
 	var flags []imap.Flag
@@ -1233,18 +1325,7 @@ func (i *Importer) scanMaildir() error {
 			mailboxName = strings.TrimSpace(mailboxName)
 
 			// Handle special folder name mappings
-			switch strings.ToLower(mailboxName) {
-			case "sent", "sent items", "sent mail":
-				mailboxName = "Sent"
-			case "drafts", "draft":
-				mailboxName = "Drafts"
-			case "trash", "deleted", "deleted items":
-				mailboxName = "Trash"
-			case "junk", "spam":
-				mailboxName = "Junk"
-			case "archive", "archives":
-				mailboxName = "Archive"
-			}
+			mailboxName = specialMailboxName(mailboxName)
 		}
 
 		logger.Info("Processing maildir folder", "path", relPath, "mailbox", mailboxName, "has_delimiter", strings.Contains(mailboxName, "/"))
@@ -1434,18 +1515,21 @@ func (i *Importer) findMovedFile(originalPath string) (string, bool) {
 	return "", false
 }
 
-// shouldSkipMessage applies date filters
-func (i *Importer) shouldSkipMessage(path string) bool {
+// shouldSkipMessage applies date filters to the date of an mbox message or
+// the modification time of a message file
+func (i *Importer) shouldSkipMessage(msg msgInfo) bool {
 	if i.options.StartDate == nil && i.options.EndDate == nil {
 		return false
 	}
 
-	info, err := os.Stat(path)
-	if err != nil {
-		return false
+	modTime := msg.date
+	if modTime.IsZero() {
+		info, err := os.Stat(msg.path)
+		if err != nil {
+			return false
+		}
+		modTime = info.ModTime()
 	}
-
-	modTime := info.ModTime()
 	if i.options.StartDate != nil && modTime.Before(*i.options.StartDate) {
 		return true
 	}
@@ -1502,6 +1586,7 @@ func (i *Importer) parseMessageMetadata(content []byte, filename, path string) (
 	if len(inReplyTo) == 0 {
 		inReplyTo = nil
 	}
+	references, _ := mailHeader.MsgIDList("References")
 
 	// If the Date header is missing or invalid, fall back to the file's modification time.
 	// This is a more accurate timestamp than time.Now().
@@ -1573,7 +1658,9 @@ func (i *Importer) parseMessageMetadata(content []byte, filename, path string) (
 		subject:              subject,
 		plaintextBody:        plaintextBody,
 		sentDate:             sentDate,
+		internalDate:         sentDate,
 		inReplyTo:            inReplyTo,
+		references:           references,
 		bodyStructure:        &bodyStructure,
 		recipients:           recipients,
 		rawHeaders:           rawHeaders,
@@ -1610,7 +1697,14 @@ func (i *Importer) uploadBatchToS3(batch []msgInfo) []uploadedMsg {
 			}
 
 			// Read file
-			content, err := os.ReadFile(msg.path)
+			var content []byte
+			var mboxFlags []imap.Flag
+			var err error
+			if i.options.Format == formatMbox {
+				content, mboxFlags, err = readMboxMessage(msg.path, msg.offset, msg.hash)
+			} else {
+				content, err = os.ReadFile(msg.path)
+			}
 			if err != nil {
 				// If file not found, it might have been renamed (e.g. flags changed)
 				// Try to find it by unique ID prefix
@@ -1642,6 +1736,14 @@ func (i *Importer) uploadBatchToS3(batch []msgInfo) []uploadedMsg {
 				logger.Warn("Failed to parse message", "path", msg.path, "error", err)
 				return
 			}
+			if i.options.Format == formatMbox || i.options.Format == formatEML {
+				if i.options.PreserveFlags {
+					metadata.flags = i.sourceFlags(content, mboxFlags)
+				}
+				if !msg.date.IsZero() {
+					metadata.internalDate = msg.date
+				}
+			}
 
 			// Check for cancellation before S3 upload
 			select {
@@ -1674,6 +1776,33 @@ func (i *Importer) uploadBatchToS3(batch []msgInfo) []uploadedMsg {
 	return uploaded
 }
 
+// insertMessageOptions returns the options to insert an uploaded message
+// into a mailbox of an account
+func insertMessageOptions(address server.Address, accountID int64, mailbox *db.DBMailbox, up uploadedMsg) *db.InsertMessageOptions {
+	return &db.InsertMessageOptions{
+		AccountID:            accountID,
+		MailboxID:            mailbox.ID,
+		S3Domain:             address.Domain(),
+		S3Localpart:          address.LocalPart(),
+		MailboxName:          mailbox.Name,
+		ContentHash:          up.msg.hash,
+		MessageID:            up.metadata.messageID,
+		Flags:                up.metadata.flags,
+		InternalDate:         up.metadata.internalDate,
+		Size:                 up.msg.size,
+		Subject:              up.metadata.subject,
+		PlaintextBody:        up.metadata.plaintextBody,
+		SentDate:             up.metadata.sentDate,
+		InReplyTo:            up.metadata.inReplyTo,
+		References:           up.metadata.references,
+		BodyStructure:        up.metadata.bodyStructure,
+		Recipients:           up.metadata.recipients,
+		RawHeaders:           up.metadata.rawHeaders,
+		PreservedUID:         up.metadata.preservedUID,
+		PreservedUIDValidity: up.metadata.preservedUIDValidity,
+	}
+}
+
 // insertBatchToDB inserts all uploaded messages in a batch
 // Note: Each message insert uses InsertMessageFromImporterWithRetry which has its own transaction
 func (i *Importer) insertBatchToDB(uploaded []uploadedMsg) ([]string, error) {
@@ -1701,27 +1830,7 @@ func (i *Importer) insertBatchToDB(uploaded []uploadedMsg) ([]string, error) {
 		}
 
 		// Insert into PostgreSQL with built-in transaction and retry
-		_, _, err = i.rdb.InsertMessageFromImporterWithRetry(i.ctx, &db.InsertMessageOptions{
-			AccountID:            user.AccountID(),
-			MailboxID:            mailbox.ID,
-			S3Domain:             address.Domain(),
-			S3Localpart:          address.LocalPart(),
-			MailboxName:          mailbox.Name,
-			ContentHash:          up.msg.hash,
-			MessageID:            up.metadata.messageID,
-			Flags:                up.metadata.flags,
-			InternalDate:         up.metadata.sentDate,
-			Size:                 up.msg.size,
-			Subject:              up.metadata.subject,
-			PlaintextBody:        up.metadata.plaintextBody,
-			SentDate:             up.metadata.sentDate,
-			InReplyTo:            up.metadata.inReplyTo,
-			BodyStructure:        up.metadata.bodyStructure,
-			Recipients:           up.metadata.recipients,
-			RawHeaders:           up.metadata.rawHeaders,
-			PreservedUID:         up.metadata.preservedUID,
-			PreservedUIDValidity: up.metadata.preservedUIDValidity,
-		})
+		_, _, err = i.rdb.InsertMessageFromImporterWithRetry(i.ctx, insertMessageOptions(address, user.AccountID(), mailbox, up))
 
 		if err != nil {
 			if errors.Is(err, consts.ErrDBUniqueViolation) {
@@ -1781,27 +1890,7 @@ func (i *Importer) insertBatchToDBWithTransaction(uploaded []uploadedMsg) ([]str
 		}
 
 		// Insert using the transaction handle (no retry wrapper - transaction handles atomicity)
-		_, _, err = database.InsertMessageFromImporter(i.ctx, tx, &db.InsertMessageOptions{
-			AccountID:            user.AccountID(),
-			MailboxID:            mailbox.ID,
-			S3Domain:             address.Domain(),
-			S3Localpart:          address.LocalPart(),
-			MailboxName:          mailbox.Name,
-			ContentHash:          up.msg.hash,
-			MessageID:            up.metadata.messageID,
-			Flags:                up.metadata.flags,
-			InternalDate:         up.metadata.sentDate,
-			Size:                 up.msg.size,
-			Subject:              up.metadata.subject,
-			PlaintextBody:        up.metadata.plaintextBody,
-			SentDate:             up.metadata.sentDate,
-			InReplyTo:            up.metadata.inReplyTo,
-			BodyStructure:        up.metadata.bodyStructure,
-			Recipients:           up.metadata.recipients,
-			RawHeaders:           up.metadata.rawHeaders,
-			PreservedUID:         up.metadata.preservedUID,
-			PreservedUIDValidity: up.metadata.preservedUIDValidity,
-		})
+		_, _, err = database.InsertMessageFromImporter(i.ctx, tx, insertMessageOptions(address, user.AccountID(), mailbox, up))
 
 		if err != nil {
 			if errors.Is(err, consts.ErrDBUniqueViolation) {
@@ -2059,10 +2148,10 @@ func (i *Importer) importMessages() error {
 	var query string
 	if i.options.Incremental {
 		// Incremental mode: only load messages not yet uploaded
-		query = `SELECT path, filename, hash, size, mailbox FROM messages WHERE s3_uploaded = 0 ORDER BY mailbox, path`
+		query = `SELECT ` + msgInfoColumns + ` FROM messages WHERE s3_uploaded = 0 ORDER BY mailbox, path, mbox_offset`
 	} else {
 		// Non-incremental mode: load all messages
-		query = `SELECT path, filename, hash, size, mailbox FROM messages ORDER BY mailbox, path`
+		query = `SELECT ` + msgInfoColumns + ` FROM messages ORDER BY mailbox, path, mbox_offset`
 	}
 
 	rows, err := i.sqliteDB.Query(query)
@@ -2072,15 +2161,14 @@ func (i *Importer) importMessages() error {
 
 	var allMessages []msgInfo
 	for rows.Next() {
-		var msg msgInfo
-		if err := rows.Scan(&msg.path, &msg.filename, &msg.hash,
-			&msg.size, &msg.mailbox); err != nil {
+		msg, err := scanMsgInfo(rows)
+		if err != nil {
 			logger.Info("Failed to scan row", "error", err)
 			continue
 		}
 
 		// Apply filters
-		if i.shouldSkipMessage(msg.path) {
+		if i.shouldSkipMessage(msg) {
 			atomic.AddInt64(&i.skippedMessages, 1)
 			continue
 		}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/mbox"
+)
+
+// Formats of the import and export commands
+const (
+	formatMaildir = "maildir"
+	formatMbox    = "mbox"
+	formatEML     = "eml"
+)
+
+// X-Mozilla-Status bits of Thunderbird
+const (
+	mozillaRead      = 0x0001
+	mozillaReplied   = 0x0002
+	mozillaMarked    = 0x0004
+	mozillaExpunged  = 0x0008
+	mozillaForwarded = 0x1000
+)
+
+// scanMbox scans an mbox file, or a directory of mbox files, and populates
+// the SQLite database. Directories are laid out as Thunderbird (Inbox,
+// Inbox.sbd/Work), Apple Mail (Work.mbox/mbox) or Google Takeout
+// (Work.mbox) do; files that are not mbox files are skipped.
+func (i *Importer) scanMbox() error {
+	root := filepath.Clean(i.maildirPath)
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return i.scanMboxFile(root, mboxMailboxName(filepath.Base(root)))
+	}
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err := i.ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(name, ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".msf") || strings.HasPrefix(name, "sora-maildir.db") {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return fmt.Errorf("could not get relative path for %s: %w", path, err)
+		}
+		err = i.scanMboxFile(path, mboxMailboxName(relPath))
+		if errors.Is(err, mbox.ErrNotMbox) {
+			logger.Info("Skipping file that is not an mbox file", "path", path)
+			return nil
+		}
+		return err
+	})
+}
+
+// scanMboxFile adds the messages of an mbox file to the SQLite database.
+// Messages are recorded by their offset in the file and imported into
+// mailbox, or into the mailboxes of their Gmail labels.
+func (i *Importer) scanMboxFile(path, mailbox string) error {
+	if !looksLikeMbox(path) {
+		return mbox.ErrNotMbox
+	}
+	if !i.options.GmailLabels && !i.shouldImportMailbox(mailbox) {
+		logger.Info("Skipping mailbox (filtered)", "mailbox", mailbox)
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	logger.Info("Processing mbox file", "path", path, "mailbox", mailbox)
+
+	reader := mbox.NewReader(file)
+	reader.MaxMessageSize = i.options.MaxMessageSize
+	base := filepath.Base(path)
+	for {
+		if err := i.ctx.Err(); err != nil {
+			return err
+		}
+		msg, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if errors.Is(err, mbox.ErrMessageTooLarge) {
+			logger.Info("Invalid message", "path", path, "error", err)
+			atomic.AddInt64(&i.skippedMessages, 1)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if err := i.validateMessage(int64(len(msg.Data))); err != nil {
+			logger.Info("Invalid message", "path", path, "offset", msg.Offset, "error", err)
+			atomic.AddInt64(&i.skippedMessages, 1)
+			continue
+		}
+
+		headers := parseSourceHeaders(msg.Data)
+		if headers.expunged {
+			// Deleted in Thunderbird, which keeps it until the folder is compacted
+			continue
+		}
+
+		mailboxes := []string{mailbox}
+		if i.options.GmailLabels && len(headers.labels) > 0 {
+			mailboxes, _ = gmailLabels(headers.labels)
+		}
+
+		var internalDate sql.NullInt64
+		date := msg.Date
+		if date.IsZero() {
+			date = headers.date
+		}
+		if !date.IsZero() {
+			internalDate = sql.NullInt64{Int64: date.Unix(), Valid: true}
+		}
+
+		hash := HashContent(msg.Data)
+		filename := fmt.Sprintf("%s@%d", base, msg.Offset)
+		for _, name := range mailboxes {
+			if !i.shouldImportMailbox(name) {
+				continue
+			}
+			_, err = i.sqliteDB.Exec("INSERT OR IGNORE INTO messages (path, filename, hash, size, mailbox, mbox_offset, internal_date) VALUES (?, ?, ?, ?, ?, ?, ?)",
+				path, filename, hash, len(msg.Data), name, msg.Offset, internalDate)
+			if err != nil {
+				logger.Info("Failed to insert message into sqlite db", "error", err)
+			}
+		}
+	}
+}
+
+// scanEML scans a directory of .eml files and populates the SQLite
+// database. Files at the top go to INBOX, files in subdirectories to the
+// mailbox named after the directory.
+func (i *Importer) scanEML() error {
+	root := filepath.Clean(i.maildirPath)
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("path '%s' is not a directory of .eml files", root)
+	}
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err := i.ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(name, ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(name, ".") || !strings.EqualFold(filepath.Ext(name), ".eml") {
+			return nil
+		}
+
+		relDir, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return fmt.Errorf("could not get relative path for %s: %w", path, err)
+		}
+		mailbox := "INBOX"
+		if relDir != "." {
+			mailbox = fileMailboxName(filepath.ToSlash(relDir))
+		}
+		if !i.shouldImportMailbox(mailbox) {
+			return nil
+		}
+
+		hash, size, err := hashFile(path)
+		if err != nil {
+			logger.Info("Failed to hash file", "path", path, "error", err)
+			return nil
+		}
+		if err := i.validateMessage(size); err != nil {
+			logger.Info("Invalid message", "path", path, "error", err)
+			atomic.AddInt64(&i.skippedMessages, 1)
+			return nil
+		}
+
+		_, err = i.sqliteDB.Exec("INSERT OR IGNORE INTO messages (path, filename, hash, size, mailbox) VALUES (?, ?, ?, ?, ?)",
+			path, name, hash, size, mailbox)
+		if err != nil {
+			logger.Info("Failed to insert message into sqlite db", "error", err)
+		}
+		return nil
+	})
+}
+
+// readMboxMessage reads the message at offset of an mbox file. It returns
+// the flags of its status headers too.
+func readMboxMessage(path string, offset int64, hash string) ([]byte, []imap.Flag, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	msg, err := mbox.NewReader(file).Next()
+	if err != nil {
+		return nil, nil, err
+	}
+	if HashContent(msg.Data) != hash {
+		return nil, nil, errors.New("mbox file changed since it was scanned")
+	}
+	return msg.Data, msg.Flags, nil
+}
+
+// sourceFlags returns the flags of an mbox or .eml message: those of the
+// mbox status headers and those of the Thunderbird and Gmail headers.
+func (i *Importer) sourceFlags(content []byte, mboxFlags []imap.Flag) []imap.Flag {
+	headers := parseSourceHeaders(content)
+	flags := append(slices.Clone(mboxFlags), headers.flags...)
+	if i.options.GmailLabels && len(headers.labels) > 0 {
+		_, labelFlags := gmailLabels(headers.labels)
+		flags = append(flags, labelFlags...)
+	}
+	slices.Sort(flags)
+	return slices.Compact(flags)
+}
+
+// looksLikeMbox reports whether a file starts with a From line.
+func looksLikeMbox(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	buf := make([]byte, 1024)
+	n, _ := io.ReadFull(file, buf)
+	return bytes.HasPrefix(bytes.TrimLeft(buf[:n], " \t\r\n"), []byte("From "))
+}
+
+// mboxMailboxName turns the path of an mbox file, relative to the imported
+// directory, into a mailbox name.
+func mboxMailboxName(relPath string) string {
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	// Apple Mail keeps the messages of Work.mbox in Work.mbox/mbox
+	if n := len(parts); n > 1 && parts[n-1] == "mbox" && strings.HasSuffix(parts[n-2], ".mbox") {
+		parts = parts[:n-1]
+	}
+	for idx, part := range parts {
+		part = strings.TrimSuffix(part, ".sbd") // Thunderbird subfolders
+		part = strings.TrimSuffix(part, ".mbox")
+		parts[idx] = part
+	}
+	return fileMailboxName(strings.Join(parts, "/"))
+}
+
+// fileMailboxName cleans a mailbox name taken from a file or directory name
+// and maps the names of special folders.
+func fileMailboxName(name string) string {
+	parts := strings.Split(name, "/")
+	clean := parts[:0]
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			clean = append(clean, part)
+		}
+	}
+	if len(clean) == 0 {
+		return "INBOX"
+	}
+	if strings.EqualFold(clean[0], "INBOX") {
+		clean[0] = "INBOX"
+	}
+	return specialMailboxName(strings.Join(clean, "/"))
+}
+
+// sourceHeaders is what the headers of Thunderbird and Google Takeout
+// exports say about a message.
+type sourceHeaders struct {
+	flags    []imap.Flag // From X-Mozilla-Status and X-Mozilla-Keys
+	labels   []string    // X-Gmail-Labels
+	expunged bool        // Deleted in Thunderbird
+	date     time.Time   // Date header
+}
+
+func parseSourceHeaders(content []byte) sourceHeaders {
+	var h sourceHeaders
+	header, err := textproto.ReadHeader(bufio.NewReader(bytes.NewReader(content)))
+	if err != nil {
+		return h
+	}
+
+	if status, err := strconv.ParseUint(strings.TrimSpace(header.Get("X-Mozilla-Status")), 16, 32); err == nil {
+		if status&mozillaRead != 0 {
+			h.flags = append(h.flags, imap.FlagSeen)
+		}
+		if status&mozillaReplied != 0 {
+			h.flags = append(h.flags, imap.FlagAnswered)
+		}
+		if status&mozillaMarked != 0 {
+			h.flags = append(h.flags, imap.FlagFlagged)
+		}
+		if status&mozillaForwarded != 0 {
+			h.flags = append(h.flags, imap.Flag("$Forwarded"))
+		}
+		h.expunged = status&mozillaExpunged != 0
+	}
+	for _, keyword := range strings.Fields(header.Get("X-Mozilla-Keys")) {
+		h.flags = append(h.flags, imap.Flag(keyword))
+	}
+
+	if value := header.Get("X-Gmail-Labels"); value != "" {
+		if decoded, err := new(mime.WordDecoder).DecodeHeader(value); err == nil {
+			value = decoded
+		}
+		h.labels = splitGmailLabels(value)
+	}
+
+	mailHeader := mail.Header{Header: message.Header{Header: header}}
+	h.date, _ = mailHeader.Date()
+	return h
+}
+
+// splitGmailLabels splits an X-Gmail-Labels header. Labels containing
+// commas are quoted.
+func splitGmailLabels(value string) []string {
+	var labels []string
+	var label strings.Builder
+	quoted := false
+	add := func() {
+		if l := strings.TrimSpace(label.String()); l != "" {
+			labels = append(labels, l)
+		}
+		label.Reset()
+	}
+	for _, r := range value {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			add()
+		default:
+			label.WriteRune(r)
+		}
+	}
+	add()
+	return labels
+}
+
+// gmailLabels translates Gmail labels into mailboxes and flags. A message
+// is seen unless labelled Unread, and archived when no label is a mailbox.
+func gmailLabels(labels []string) ([]string, []imap.Flag) {
+	var mailboxes []string
+	var flags []imap.Flag
+	seen := true
+	addMailbox := func(name string) {
+		if !slices.Contains(mailboxes, name) {
+			mailboxes = append(mailboxes, name)
+		}
+	}
+
+	for _, label := range labels {
+		lower := strings.ToLower(label)
+		switch lower {
+		case "inbox":
+			addMailbox("INBOX")
+		case "sent":
+			addMailbox("Sent")
+		case "draft", "drafts":
+			addMailbox("Drafts")
+			flags = append(flags, imap.FlagDraft)
+		case "spam":
+			addMailbox("Junk")
+		case "trash":
+			addMailbox("Trash")
+		case "starred":
+			flags = append(flags, imap.FlagFlagged)
+		case "unread":
+			seen = false
+		case "opened", "important", "archived", "chat":
+			// States of Gmail, not folders
+		default:
+			if strings.HasPrefix(lower, "category ") {
+				continue
+			}
+			addMailbox(fileMailboxName(label))
+		}
+	}
+
+	if seen {
+		flags = append(flags, imap.FlagSeen)
+	}
+	if len(mailboxes) == 0 {
+		mailboxes = []string{"Archive"}
+	}
+	return mailboxes, flags
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+// scannedMessages returns the messages of the SQLite database by mailbox.
+func scannedMessages(t *testing.T, importer *Importer) map[string][]msgInfo {
+	t.Helper()
+	rows, err := importer.sqliteDB.Query("SELECT " + msgInfoColumns + " FROM messages ORDER BY mailbox, path, mbox_offset")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	messages := make(map[string][]msgInfo)
+	for rows.Next() {
+		msg, err := scanMsgInfo(rows)
+		require.NoError(t, err)
+		messages[msg.mailbox] = append(messages[msg.mailbox], msg)
+	}
+	require.NoError(t, rows.Err())
+	return messages
+}
+
+func TestScanMboxThunderbird(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "Inbox"),
+		"From - Tue Mar  5 10:30:00 2024\nX-Mozilla-Status: 0005\nX-Mozilla-Keys: $label1\nSubject: one\n\nfirst\n\n"+
+			"From - Wed Mar  6 10:30:00 2024\nX-Mozilla-Status: 0009\nSubject: deleted\n\ngone\n\n"+
+			"From - Thu Mar  7 10:30:00 2024\nStatus: RO\nX-Status: A\nSubject: three\n\nthird\n")
+	writeTestFile(t, filepath.Join(dir, "Inbox.msf"), "// <!-- <mdb:mork:z v=\"1.4\"/> -->\n")
+	writeTestFile(t, filepath.Join(dir, "Inbox.sbd", "Work"), "From - Fri Mar  8 10:30:00 2024\nSubject: work\n\nwork\n")
+	writeTestFile(t, filepath.Join(dir, "Sent Mail.mbox"), "From - Sat Mar  9 10:30:00 2024\nSubject: sent\n\nsent\n")
+	writeTestFile(t, filepath.Join(dir, "notes"), "not an mbox file\n")
+
+	importer, err := NewImporter(context.Background(), dir, "user@example.com", 1, nil, nil, ImporterOptions{Format: formatMbox, PreserveFlags: true})
+	require.NoError(t, err)
+	defer importer.Close()
+
+	require.NoError(t, importer.scanMbox())
+	messages := scannedMessages(t, importer)
+	require.Len(t, messages, 3)
+	require.Len(t, messages["INBOX"], 2, "the message marked as deleted is skipped")
+	assert.Len(t, messages["INBOX/Work"], 1)
+	assert.Len(t, messages["Sent"], 1)
+
+	first, third := messages["INBOX"][0], messages["INBOX"][1]
+	assert.Equal(t, time.Date(2024, 3, 5, 10, 30, 0, 0, time.UTC), first.date.UTC())
+	assert.Greater(t, third.offset, first.offset)
+
+	// Messages are read back on their own, with their flags
+	content, mboxFlags, err := readMboxMessage(first.path, first.offset, first.hash)
+	require.NoError(t, err)
+	assert.Equal(t, "X-Mozilla-Status: 0005\r\nX-Mozilla-Keys: $label1\r\nSubject: one\r\n\r\nfirst\r\n", string(content))
+	assert.ElementsMatch(t, []imap.Flag{imap.FlagSeen, imap.FlagFlagged, "$label1"}, importer.sourceFlags(content, mboxFlags))
+
+	content, mboxFlags, err = readMboxMessage(third.path, third.offset, third.hash)
+	require.NoError(t, err)
+	assert.Equal(t, "Subject: three\r\n\r\nthird\r\n", string(content))
+	assert.ElementsMatch(t, []imap.Flag{imap.FlagSeen, imap.FlagAnswered}, importer.sourceFlags(content, mboxFlags))
+
+	// A changed file is not imported from stale offsets
+	_, _, err = readMboxMessage(third.path, third.offset, first.hash)
+	assert.Error(t, err)
+}
+
+func TestScanMboxGmailLabels(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "All mail Including Spam and Trash.mbox")
+	writeTestFile(t, path,
+		"From 1234@xxx Tue Mar  5 10:30:00 +0000 2024\nX-Gmail-Labels: Inbox,Starred,\"Work, old\",Category Updates\nSubject: one\n\none\n\n"+
+			"From 5678@xxx Wed Mar  6 10:30:00 +0000 2024\nX-Gmail-Labels: Archived,Unread\nSubject: two\n\ntwo\n")
+
+	importer, err := NewImporter(context.Background(), path, "user@example.com", 1, nil, nil, ImporterOptions{Format: formatMbox, GmailLabels: true, PreserveFlags: true})
+	require.NoError(t, err)
+	defer importer.Close()
+
+	require.NoError(t, importer.scanMbox())
+	messages := scannedMessages(t, importer)
+	require.Len(t, messages, 3)
+	require.Len(t, messages["INBOX"], 1)
+	require.Len(t, messages["Work, old"], 1)
+	require.Len(t, messages["Archive"], 1)
+	assert.Equal(t, messages["INBOX"][0].hash, messages["Work, old"][0].hash)
+
+	content, mboxFlags, err := readMboxMessage(path, messages["INBOX"][0].offset, messages["INBOX"][0].hash)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []imap.Flag{imap.FlagSeen, imap.FlagFlagged}, importer.sourceFlags(content, mboxFlags))
+
+	content, mboxFlags, err = readMboxMessage(path, messages["Archive"][0].offset, messages["Archive"][0].hash)
+	require.NoError(t, err)
+	assert.Empty(t, importer.sourceFlags(content, mboxFlags))
+}
+
+func TestScanEML(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "1.eml"), "Subject: one\r\n\r\none\r\n")
+	writeTestFile(t, filepath.Join(dir, "Sent Items", "2.EML"), "Subject: two\r\n\r\ntwo\r\n")
+	writeTestFile(t, filepath.Join(dir, "Work", "Projects", "3.eml"), "Subject: three\r\n\r\nthree\r\n")
+	writeTestFile(t, filepath.Join(dir, "Work", "readme.txt"), "not a message\n")
+
+	importer, err := NewImporter(context.Background(), dir, "user@example.com", 1, nil, nil, ImporterOptions{Format: formatEML})
+	require.NoError(t, err)
+	defer importer.Close()
+
+	require.NoError(t, importer.scanEML())
+	messages := scannedMessages(t, importer)
+	assert.Len(t, messages["INBOX"], 1)
+	assert.Len(t, messages["Sent"], 1)
+	assert.Len(t, messages["Work/Projects"], 1)
+	assert.Len(t, messages, 3)
+}
+
+func TestMboxMailboxName(t *testing.T) {
+	tests := map[string]string{
+		"Inbox":                    "INBOX",
+		"inbox.mbox":               "INBOX",
+		"Inbox.sbd/Work":           "INBOX/Work",
+		"Archives.sbd/2023.sbd/Q1": "Archives/2023/Q1",
+		"Sent.mbox":                "Sent",
+		"Work.mbox/mbox":           "Work",
+		"Lists/go-nuts.mbox":       "Lists/go-nuts",
+		"Deleted Items":            "Trash",
+	}
+	for path, want := range tests {
+		assert.Equal(t, want, mboxMailboxName(path), path)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/emersion/go-imap/v2"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/migadu/sora/consts"
@@ -34,6 +35,10 @@ type mockResilientDatabase struct {
 	// For simulating failures
 	insertMessageShouldFail bool
 	insertMessageError      error
+
+	// Inserted messages and flag updates, by mailbox ID and UID
+	inserted    []*db.InsertMessageOptions
+	flagUpdates map[int64]map[imap.UID][]imap.Flag
 }
 
 func newMockResilientDatabase() *mockResilientDatabase {
@@ -116,7 +121,34 @@ func (m *mockResilientDatabase) InsertMessageFromImporterWithRetry(ctx context.C
 	if m.insertMessageShouldFail {
 		return 0, 0, m.insertMessageError
 	}
-	return 1, 1, nil
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var uid int64
+	for _, inserted := range m.inserted {
+		if inserted.MailboxID == opts.MailboxID {
+			if inserted.ContentHash == opts.ContentHash {
+				return 0, 0, consts.ErrDBUniqueViolation
+			}
+			uid++
+		}
+	}
+	m.inserted = append(m.inserted, opts)
+	if opts.PreservedUID != nil {
+		return int64(len(m.inserted)), int64(*opts.PreservedUID), nil
+	}
+	return int64(len(m.inserted)), uid + 1, nil
+}
+func (m *mockResilientDatabase) SetMessageFlagsWithRetry(ctx context.Context, messageUID imap.UID, mailboxID int64, newFlags []imap.Flag) ([]imap.Flag, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.flagUpdates == nil {
+		m.flagUpdates = make(map[int64]map[imap.UID][]imap.Flag)
+	}
+	if m.flagUpdates[mailboxID] == nil {
+		m.flagUpdates[mailboxID] = make(map[imap.UID][]imap.Flag)
+	}
+	m.flagUpdates[mailboxID][messageUID] = newFlags
+	return newFlags, 1, nil
 }
 func (m *mockResilientDatabase) DeleteMessageByHashAndMailboxWithRetry(ctx context.Context, accountID, mailboxID int64, hash string) (int64, error) {
 	return 0, nil
@@ -10,14 +10,13 @@ import (
 	"github.com/migadu/sora/db"
 	"github.com/migadu/sora/helpers"
 	"github.com/migadu/sora/pkg/resilient"
-	"github.com/migadu/sora/storage"
 )
 
 // handleMailboxCommand handles the 'mailbox' command
 func handleMailboxCommand(ctx context.Context) {
 	if len(os.Args) < 3 {
 		printMailboxUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	subcommand := os.Args[2]
@@ -41,13 +40,13 @@ func handleMailboxCommand(ctx context.Context) {
 	default:
 		fmt.Printf("Unknown mailbox subcommand: %s\n\n", subcommand)
 		printMailboxUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
 // handleMailboxCreate creates a new mailbox for a user
 func handleMailboxCreate(ctx context.Context) {
-	fs := flag.NewFlagSet("mailbox create", flag.ExitOnError)
+	fs := flag.NewFlagSet("mailbox create", flag.ContinueOnError)
 	email := fs.String("email", "", "Email address of the account (required)")
 	mailbox := fs.String("mailbox", "", "Mailbox name/path to create, e.g., 'Work' or 'Projects/2024' (required)")
 
@@ -71,25 +70,25 @@ Examples:
 `)
 	}
 
-	fs.Parse(os.Args[3:])
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required parameters
 	if *email == "" {
 		fmt.Println("Error: --email is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 	if *mailbox == "" {
 		fmt.Println("Error: --mailbox is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Create database connection
 	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
 	if err != nil {
 		fmt.Printf("Failed to connect to database: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 	defer rdb.Close()
 
@@ -97,14 +96,14 @@ Examples:
 	accountID, err := rdb.GetAccountIDByEmailWithRetry(ctx, *email)
 	if err != nil {
 		fmt.Printf("Failed to find account: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Create mailbox
 	err = rdb.CreateMailboxForUserWithRetry(ctx, accountID, *mailbox)
 	if err != nil {
 		fmt.Printf("Failed to create mailbox: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	fmt.Printf("Successfully created mailbox '%s' for account %s\n", *mailbox, *email)
@@ -112,7 +111,7 @@ Examples:
 
 // handleMailboxList lists all mailboxes for a user
 func handleMailboxList(ctx context.Context) {
-	fs := flag.NewFlagSet("mailbox list", flag.ExitOnError)
+	fs := flag.NewFlagSet("mailbox list", flag.ContinueOnError)
 	email := fs.String("email", "", "Email address of the account (required)")
 	subscribedOnly := fs.Bool("subscribed", false, "Show only subscribed mailboxes")
 
@@ -136,20 +135,20 @@ Examples:
 `)
 	}
 
-	fs.Parse(os.Args[3:])
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required parameters
 	if *email == "" {
 		fmt.Println("Error: --email is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Create database connection
 	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
 	if err != nil {
 		fmt.Printf("Failed to connect to database: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 	defer rdb.Close()
 
@@ -157,14 +156,14 @@ Examples:
 	accountID, err := rdb.GetAccountIDByEmailWithRetry(ctx, *email)
 	if err != nil {
 		fmt.Printf("Failed to find account: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Get mailboxes
 	mailboxes, err := rdb.GetMailboxesForUserWithRetry(ctx, accountID, *subscribedOnly)
 	if err != nil {
 		fmt.Printf("Failed to list mailboxes: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Print results
@@ -192,7 +191,7 @@ Examples:
 
 // handleMailboxDelete deletes a mailbox
 func handleMailboxDelete(ctx context.Context) {
-	fs := flag.NewFlagSet("mailbox delete", flag.ExitOnError)
+	fs := flag.NewFlagSet("mailbox delete", flag.ContinueOnError)
 	email := fs.String("email", "", "Email address of the account (required)")
 	mailbox := fs.String("mailbox", "", "Mailbox name/path to delete (required)")
 	confirm := fs.Bool("confirm", false, "Confirm deletion without interactive prompt (required)")
@@ -220,30 +219,30 @@ Examples:
 `)
 	}
 
-	fs.Parse(os.Args[3:])
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required parameters
 	if *email == "" {
 		fmt.Println("Error: --email is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 	if *mailbox == "" {
 		fmt.Println("Error: --mailbox is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 	if !*confirm {
 		fmt.Println("Error: --confirm is required for safety")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Create database connection
 	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
 	if err != nil {
 		fmt.Printf("Failed to connect to database: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 	defer rdb.Close()
 
@@ -251,46 +250,24 @@ Examples:
 	accountID, err := rdb.GetAccountIDByEmailWithRetry(ctx, *email)
 	if err != nil {
 		fmt.Printf("Failed to find account: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	// If purge flag is set, purge all messages from S3 and database
 	if *purge {
 		fmt.Printf("Purging all messages from mailbox '%s' and its children...\n", *mailbox)
 
-		// Initialize S3 storage
-		useSSL := !globalConfig.S3.DisableTLS
-		s3Timeout, err := globalConfig.S3.GetTimeout()
+		// Initialize storage
+		s3Storage, err := newBlobStore(globalConfig)
 		if err != nil {
-			fmt.Printf("Invalid S3 timeout configuration: %v\n", err)
-			os.Exit(1)
-		}
-		s3Storage, err := storage.New(
-			globalConfig.S3.Endpoint,
-			globalConfig.S3.AccessKey,
-			globalConfig.S3.SecretKey,
-			globalConfig.S3.Bucket,
-			useSSL,
-			false,     // debug mode
-			s3Timeout, // timeout
-		)
-		if err != nil {
-			fmt.Printf("Failed to initialize S3 storage: %v\n", err)
-			os.Exit(1)
-		}
-
-		// Enable encryption if configured
-		if globalConfig.S3.Encrypt {
-			if err := s3Storage.EnableEncryption(globalConfig.S3.EncryptionKey); err != nil {
-				fmt.Printf("Failed to enable S3 encryption: %v\n", err)
-				os.Exit(1)
-			}
+			fmt.Printf("Failed to initialize storage: %v\n", err)
+			exit(1)
 		}
 
 		err = purgeMailboxMessages(ctx, rdb, s3Storage, accountID, *mailbox)
 		if err != nil {
 			fmt.Printf("Failed to purge messages: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 	}
 
@@ -298,7 +275,7 @@ Examples:
 	err = rdb.DeleteMailboxForUserWithRetry(ctx, accountID, *mailbox)
 	if err != nil {
 		fmt.Printf("Failed to delete mailbox: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	if *purge {
@@ -310,7 +287,7 @@ Examples:
 
 // handleMailboxRename renames or moves a mailbox
 func handleMailboxRename(ctx context.Context) {
-	fs := flag.NewFlagSet("mailbox rename", flag.ExitOnError)
+	fs := flag.NewFlagSet("mailbox rename", flag.ContinueOnError)
 	email := fs.String("email", "", "Email address of the account (required)")
 	oldName := fs.String("old-name", "", "Current mailbox name/path (required)")
 	newName := fs.String("new-name", "", "New mailbox name/path (required)")
@@ -336,30 +313,30 @@ Examples:
 `)
 	}
 
-	fs.Parse(os.Args[3:])
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required parameters
 	if *email == "" {
 		fmt.Println("Error: --email is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 	if *oldName == "" {
 		fmt.Println("Error: --old-name is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 	if *newName == "" {
 		fmt.Println("Error: --new-name is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Create database connection
 	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
 	if err != nil {
 		fmt.Printf("Failed to connect to database: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 	defer rdb.Close()
 
@@ -367,21 +344,21 @@ Examples:
 	accountID, err := rdb.GetAccountIDByEmailWithRetry(ctx, *email)
 	if err != nil {
 		fmt.Printf("Failed to find account: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Get the mailbox to rename
 	mbox, err := rdb.GetMailboxByNameWithRetry(ctx, accountID, *oldName)
 	if err != nil {
 		fmt.Printf("Failed to find mailbox '%s': %v\n", *oldName, err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Rename mailbox - newParentID is handled internally by RenameMailbox
 	err = rdb.RenameMailboxWithRetry(ctx, mbox.ID, accountID, *newName, nil)
 	if err != nil {
 		fmt.Printf("Failed to rename mailbox: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	fmt.Printf("Successfully renamed mailbox '%s' to '%s' for account %s\n", *oldName, *newName, *email)
@@ -389,7 +366,7 @@ Examples:
 
 // handleMailboxSubscribe subscribes to a mailbox
 func handleMailboxSubscribe(ctx context.Context) {
-	fs := flag.NewFlagSet("mailbox subscribe", flag.ExitOnError)
+	fs := flag.NewFlagSet("mailbox subscribe", flag.ContinueOnError)
 	email := fs.String("email", "", "Email address of the account (required)")
 	mailbox := fs.String("mailbox", "", "Mailbox name/path to subscribe to (required)")
 
@@ -409,25 +386,25 @@ Examples:
 `)
 	}
 
-	fs.Parse(os.Args[3:])
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required parameters
 	if *email == "" {
 		fmt.Println("Error: --email is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 	if *mailbox == "" {
 		fmt.Println("Error: --mailbox is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Create database connection
 	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
 	if err != nil {
 		fmt.Printf("Failed to connect to database: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 	defer rdb.Close()
 
@@ -435,14 +412,14 @@ Examples:
 	accountID, err := rdb.GetAccountIDByEmailWithRetry(ctx, *email)
 	if err != nil {
 		fmt.Printf("Failed to find account: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Subscribe to mailbox
 	err = rdb.SubscribeToMailboxWithRetry(ctx, accountID, *mailbox)
 	if err != nil {
 		fmt.Printf("Failed to subscribe to mailbox: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	fmt.Printf("Successfully subscribed to mailbox '%s' for account %s\n", *mailbox, *email)
@@ -450,7 +427,7 @@ Examples:
 
 // handleMailboxUnsubscribe unsubscribes from a mailbox
 func handleMailboxUnsubscribe(ctx context.Context) {
-	fs := flag.NewFlagSet("mailbox unsubscribe", flag.ExitOnError)
+	fs := flag.NewFlagSet("mailbox unsubscribe", flag.ContinueOnError)
 	email := fs.String("email", "", "Email address of the account (required)")
 	mailbox := fs.String("mailbox", "", "Mailbox name/path to unsubscribe from (required)")
 
@@ -470,25 +447,25 @@ Examples:
 `)
 	}
 
-	fs.Parse(os.Args[3:])
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required parameters
 	if *email == "" {
 		fmt.Println("Error: --email is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 	if *mailbox == "" {
 		fmt.Println("Error: --mailbox is required")
 		fs.PrintDefaults()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Create database connection
 	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
 	if err != nil {
 		fmt.Printf("Failed to connect to database: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 	defer rdb.Close()
 
@@ -496,14 +473,14 @@ Examples:
 	accountID, err := rdb.GetAccountIDByEmailWithRetry(ctx, *email)
 	if err != nil {
 		fmt.Printf("Failed to find account: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Unsubscribe from mailbox
 	err = rdb.UnsubscribeFromMailboxWithRetry(ctx, accountID, *mailbox)
 	if err != nil {
 		fmt.Printf("Failed to unsubscribe from mailbox: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	fmt.Printf("Successfully unsubscribed from mailbox '%s' for account %s\n", *mailbox, *email)
@@ -512,7 +489,7 @@ Examples:
 // handleMailboxFixUTF7 finds and fixes mailbox names that contain un-decoded Modified UTF-7 sequences.
 // This can happen when mailboxes were imported from Dovecot without decoding the filesystem names.
 func handleMailboxFixUTF7(ctx context.Context) {
-	fs := flag.NewFlagSet("mailbox fix-utf7", flag.ExitOnError)
+	fs := flag.NewFlagSet("mailbox fix-utf7", flag.ContinueOnError)
 	email := fs.String("email", "", "Email address of the account (optional, fixes all accounts if omitted)")
 	dryRun := fs.Bool("dry-run", false, "Show what would be changed without making changes")
 
@@ -546,13 +523,13 @@ Examples:
 `)
 	}
 
-	fs.Parse(os.Args[3:])
+	parseFlags(fs, os.Args[3:])
 
 	// Create database connection
 	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
 	if err != nil {
 		fmt.Printf("Failed to connect to database: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 	defer rdb.Close()
 
@@ -566,7 +543,7 @@ Examples:
 		accountID, err := rdb.GetAccountIDByEmailWithRetry(ctx, *email)
 		if err != nil {
 			fmt.Printf("Failed to find account: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 		query = `SELECT id, account_id, name FROM mailboxes WHERE account_id = $1 AND name ~ '&[A-Za-z0-9+,]+-' ORDER BY account_id, name`
 		args = []any{accountID}
@@ -599,7 +576,7 @@ Examples:
 		dbRows, err := db.WritePool.Query(ctx, query, args...)
 		if err != nil {
 			fmt.Printf("Failed to query mailboxes: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		for dbRows.Next() {
@@ -610,13 +587,13 @@ Examples:
 			}
 			if err := dbRows.Scan(&r.MailboxID, &r.AccountID, &r.MailboxName); err != nil {
 				fmt.Printf("Failed to scan row: %v\n", err)
-				os.Exit(1)
+				exit(1)
 			}
 			rows = append(rows, r)
 		}
 		if err := dbRows.Err(); err != nil {
 			fmt.Printf("Failed to iterate mailbox rows: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 		dbRows.Close()
 
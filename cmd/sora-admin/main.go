@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/migadu/sora/config"
+	"github.com/migadu/sora/db"
 	"github.com/migadu/sora/helpers"
 	"github.com/migadu/sora/logger"
 	"github.com/migadu/sora/pkg/resilient"
@@ -31,10 +32,12 @@ var globalConfig AdminConfig
 type AdminConfig struct {
 	Database                  config.DatabaseConfig        `toml:"database"`
 	S3                        config.S3Config              `toml:"s3"`
+	Storage                   config.StorageConfig         `toml:"storage"`
 	LocalCache                config.LocalCacheConfig      `toml:"local_cache"`
 	Uploader                  config.UploaderConfig        `toml:"uploader"`
 	Cleanup                   config.CleanupConfig         `toml:"cleanup"`
 	SharedMailboxes           config.SharedMailboxesConfig `toml:"shared_mailboxes"`
+	Sieve                     config.SieveConfig           `toml:"sieve"`
 	TLS                       config.TLSConfig             `toml:"tls"` // TLS configuration for accessing Let's Encrypt S3 bucket
 	AdminCLI                  config.AdminCLIConfig        `toml:"admin_cli"`
 	Servers                   config.ServersConfig         // Server configs for fallback (e.g., IMAP append_limit)
@@ -106,10 +109,12 @@ func loadAdminConfig(configPath string, cfg *AdminConfig) error {
 	// Extract the parts we need for admin operations
 	cfg.Database = fullCfg.Database
 	cfg.S3 = fullCfg.S3
+	cfg.Storage = fullCfg.Storage
 	cfg.LocalCache = fullCfg.LocalCache
 	cfg.Uploader = fullCfg.Uploader
 	cfg.Cleanup = fullCfg.Cleanup
 	cfg.SharedMailboxes = fullCfg.SharedMailboxes
+	cfg.Sieve = fullCfg.Sieve
 	cfg.TLS = fullCfg.TLS
 	cfg.AdminCLI = fullCfg.AdminCLI
 	cfg.Servers = fullCfg.Servers
@@ -117,6 +122,9 @@ func loadAdminConfig(configPath string, cfg *AdminConfig) error {
 	cfg.HTTPAPIAddr = fullCfg.AdminCLI.Addr
 	cfg.HTTPAPIKey = fullCfg.AdminCLI.APIKey
 
+	// Imports and mailbox operations wake up IDLE sessions like the servers do
+	db.SetMailboxChangeNotifications(fullCfg.MailboxNotifications.Enabled)
+
 	// Default to true for insecure skip verify (safer for localhost usage)
 	cfg.HTTPAPIInsecureSkipVerify = true
 	if fullCfg.AdminCLI.InsecureSkipVerify != nil {
@@ -129,7 +137,7 @@ func loadAdminConfig(configPath string, cfg *AdminConfig) error {
 func main() {
 	if len(os.Args) < 2 {
 		printUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Create a context that is cancelled on an interrupt signal (Ctrl+C).
@@ -139,17 +147,17 @@ func main() {
 	// Allow 'sora-admin -v' and 'sora-admin --version' as shortcuts
 	if os.Args[1] == "-v" || os.Args[1] == "--version" {
 		printVersion()
-		os.Exit(0)
+		exit(0)
 	}
 
 	// Allow 'sora-admin help' and 'sora-admin version' without config
 	if os.Args[1] == "help" || os.Args[1] == "--help" || os.Args[1] == "-h" {
 		printUsage()
-		os.Exit(0)
+		exit(0)
 	}
 	if os.Args[1] == "version" {
 		printVersion()
-		os.Exit(0)
+		exit(0)
 	}
 
 	// Determine the command first
@@ -167,7 +175,7 @@ func main() {
 
 	if command == "" {
 		printUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Special handling for 'config' subcommands - they parse their own --config flag
@@ -200,6 +208,9 @@ func main() {
 	// Replace os.Args with filtered args (without --config)
 	os.Args = newArgs
 
+	// Mutating subcommands are recorded in the admin audit log
+	startCLIAudit(command, os.Args[2:])
+
 	switch command {
 	case "accounts":
 		handleAccountsCommand(ctx)
@@ -207,6 +218,8 @@ func main() {
 		handleACLCommand(ctx)
 	case "credentials":
 		handleCredentialsCommand(ctx)
+	case "domains":
+		handleDomainsCommand(ctx)
 	case "mailbox":
 		handleMailboxCommand(ctx)
 	case "cache":
@@ -231,21 +244,29 @@ func main() {
 		handleImportCommand(ctx)
 	case "export":
 		handleExportCommand(ctx)
+	case "migrate-imap":
+		handleMigrateIMAPCommand(ctx)
 	case "uploader":
 		handleUploaderCommand(ctx)
 	case "messages":
 		handleMessagesCommand(ctx)
 	case "relay":
 		handleRelayCommand(ctx)
+	case "sieve":
+		handleSieveCommand(ctx)
 	case "verify":
 		handleVerifyCommand(ctx)
+	case "storage":
+		handleStorageCommand(ctx)
 	case "tls":
 		handleTLSCommand(ctx)
 	default:
 		fmt.Printf("Unknown command: %s\n\n", command)
 		printUsage()
-		os.Exit(1)
+		exit(1)
 	}
+
+	finishCLIAudit(ctx, "")
 }
 
 func printVersion() {
@@ -265,6 +286,7 @@ Commands:
   accounts      Manage user accounts
   acl           Manage mailbox ACL (Access Control Lists)
   credentials   Manage account credentials
+  domains       Manage domains, domain policies and aliases
   mailbox       Manage mailboxes (create, delete, rename, subscribe)
   cache         Cache management operations
   auth-cache    Auth cache management (persistent auth credential cache)
@@ -278,9 +300,12 @@ Commands:
   uploader      Upload queue management
   messages      List and restore deleted messages
   relay         Relay queue management (stats, list, show, delete, requeue)
+  sieve         Manage global and domain Sieve scripts
   verify        Verify data integrity (S3 storage, etc.)
+  storage       S3 storage maintenance (encryption key rotation)
   import        Import maildir data
   export        Export maildir data
+  migrate-imap  Migrate an account from a remote IMAP server
   tls           TLS certificate management (list certificates from S3 and cache)
   version       Show version information
   help          Show this help message
@@ -18,7 +18,7 @@ import (
 func handleMessagesCommand(ctx context.Context) {
 	if len(os.Args) < 3 {
 		printMessagesUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	subcommand := os.Args[2]
@@ -32,13 +32,13 @@ func handleMessagesCommand(ctx context.Context) {
 	default:
 		fmt.Printf("Unknown messages subcommand: %s\n\n", subcommand)
 		printMessagesUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
 func handleListDeletedMessages(ctx context.Context) {
 	// Parse list-deleted-messages specific flags
-	fs := flag.NewFlagSet("messages list-deleted", flag.ExitOnError)
+	fs := flag.NewFlagSet("messages list-deleted", flag.ContinueOnError)
 
 	email := fs.String("email", "", "Email address of the account (required)")
 	mailbox := fs.String("mailbox", "", "Filter by mailbox path (optional)")
@@ -77,9 +77,7 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	// Validate required flags
@@ -87,7 +85,7 @@ Examples:
 		fmt.Println("ERROR: --email is required")
 		fmt.Println()
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Parse time filters
@@ -115,7 +113,7 @@ Examples:
 
 func handleRestoreMessages(ctx context.Context) {
 	// Parse restore-messages specific flags
-	fs := flag.NewFlagSet("messages restore", flag.ExitOnError)
+	fs := flag.NewFlagSet("messages restore", flag.ContinueOnError)
 
 	email := fs.String("email", "", "Email address of the account (required)")
 	mailbox := fs.String("mailbox", "", "Restore all deleted messages from this mailbox")
@@ -165,9 +163,7 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	// Validate required flags
@@ -175,7 +171,7 @@ Examples:
 		fmt.Println("ERROR: --email is required")
 		fmt.Println()
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Validate that at least one filter is provided
@@ -183,7 +179,7 @@ Examples:
 		fmt.Println("ERROR: At least one filter option is required (--ids, --mailbox, --since, or --until)")
 		fmt.Println()
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Parse message IDs if provided
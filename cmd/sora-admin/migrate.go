@@ -23,7 +23,7 @@ import (
 func handleMigrateCommand(ctx context.Context) {
 	if len(os.Args) < 3 {
 		printMigrateUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	subcommand := os.Args[2]
@@ -41,7 +41,7 @@ func handleMigrateCommand(ctx context.Context) {
 	default:
 		fmt.Printf("Unknown migrate subcommand: %s\n\n", subcommand)
 		printMigrateUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
@@ -73,12 +73,12 @@ Use 'sora-admin migrate <subcommand> --help' for detailed help.
 }
 
 func handleMigrateUp(ctx context.Context) {
-	fs := flag.NewFlagSet("migrate up", flag.ExitOnError)
+	fs := flag.NewFlagSet("migrate up", flag.ContinueOnError)
 	fs.Usage = func() {
 		fmt.Println("Usage: sora-admin migrate up --config config.toml")
 		fmt.Println("Applies all pending upwards migrations.")
 	}
-	fs.Parse(os.Args[3:])
+	parseFlags(fs, os.Args[3:])
 
 	m, db, err := getMigrateInstance(ctx)
 	if err != nil {
@@ -95,14 +95,14 @@ func handleMigrateUp(ctx context.Context) {
 }
 
 func handleMigrateDown(ctx context.Context) {
-	fs := flag.NewFlagSet("migrate down", flag.ExitOnError)
+	fs := flag.NewFlagSet("migrate down", flag.ContinueOnError)
 	limit := fs.Int("limit", 1, "Number of migrations to revert")
 	all := fs.Bool("all", false, "Revert all migrations")
 	fs.Usage = func() {
 		fmt.Println("Usage: sora-admin migrate down --config config.toml [--limit N | --all]")
 		fmt.Println("Reverts migrations. Defaults to reverting one migration.")
 	}
-	fs.Parse(os.Args[3:])
+	parseFlags(fs, os.Args[3:])
 
 	m, db, err := getMigrateInstance(ctx)
 	if err != nil {
@@ -139,12 +139,12 @@ func handleMigrateDown(ctx context.Context) {
 }
 
 func handleMigrateVersion(ctx context.Context) {
-	fs := flag.NewFlagSet("migrate version", flag.ExitOnError)
+	fs := flag.NewFlagSet("migrate version", flag.ContinueOnError)
 	fs.Usage = func() {
 		fmt.Println("Usage: sora-admin migrate version --config config.toml")
 		fmt.Println("Shows the current migration version and dirty state.")
 	}
-	fs.Parse(os.Args[3:])
+	parseFlags(fs, os.Args[3:])
 
 	// Query schema_migrations directly instead of using golang-migrate's m.Version(),
 	// which acquires an exclusive advisory lock. This allows checking the version
@@ -192,16 +192,16 @@ func handleMigrateVersion(ctx context.Context) {
 }
 
 func handleMigrateForce(ctx context.Context) {
-	fs := flag.NewFlagSet("migrate force", flag.ExitOnError)
+	fs := flag.NewFlagSet("migrate force", flag.ContinueOnError)
 	fs.Usage = func() {
 		fmt.Println("Usage: sora-admin migrate force --config config.toml <version>")
 		fmt.Println("Forcibly sets the database migration version. USE WITH CAUTION.")
 	}
-	fs.Parse(os.Args[3:])
+	parseFlags(fs, os.Args[3:])
 
 	if fs.NArg() != 1 {
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	version, err := strconv.Atoi(fs.Arg(0))
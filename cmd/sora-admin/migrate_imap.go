@@ -0,0 +1,207 @@
+package main
+
+// migrate_imap.go - Command handler for migrating accounts from remote IMAP servers
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/storage"
+)
+
+func handleMigrateIMAPCommand(ctx context.Context) {
+	fs := flag.NewFlagSet("migrate-imap", flag.ContinueOnError)
+
+	email := fs.String("email", "", "Email address of the Sora account to migrate mail to (required)")
+	host := fs.String("host", "", "Remote IMAP server as host or host:port (required)")
+	username := fs.String("user", "", "Username on the remote server (default: --email)")
+	password := fs.String("password", "", "Password on the remote server (default: $SORA_MIGRATE_IMAP_PASSWORD)")
+	security := fs.String("security", imapSecurityTLS, "Connection security: tls, starttls or none")
+	insecureSkipVerify := fs.Bool("insecure-skip-verify", false, "Do not verify the TLS certificate of the remote server")
+	statePath := fs.String("state", "", "SQLite state file for incremental and resumed migrations (default: sora-imap-<email>.db)")
+	jobs := fs.Int("jobs", 4, "Number of mailboxes migrated in parallel")
+	batchSize := fs.Int("batch-size", 20, "Number of messages fetched at once")
+	dryRun := fs.Bool("dry-run", false, "Show what would be migrated without making changes")
+	preserveFlags := fs.Bool("preserve-flags", true, "Preserve flags and keep them in sync on later runs")
+	preserveUIDs := fs.Bool("preserve-uids", false, "Preserve the remote UIDVALIDITY and UIDs in empty mailboxes")
+	delay := fs.Duration("delay", 0, "Delay between messages to control rate (e.g. 500ms)")
+	mailboxFilter := fs.String("mailbox-filter", "", "Comma-separated list of remote or Sora mailboxes to migrate (e.g. INBOX,Sent,Archive*)")
+	startDate := fs.String("start-date", "", "Migrate only messages received after this date (YYYY-MM-DD)")
+	endDate := fs.String("end-date", "", "Migrate only messages received before this date (YYYY-MM-DD)")
+
+	fs.Usage = func() {
+		fmt.Printf(`Migrate an account from a remote IMAP server
+
+Usage:
+  sora-admin migrate-imap [options]
+
+Options:
+  --email string           Email address of the Sora account to migrate mail to (required)
+  --host string            Remote IMAP server as host or host:port (required, port defaults to 993, or 143 without TLS)
+  --user string            Username on the remote server (default: --email)
+  --password string        Password on the remote server (default: $SORA_MIGRATE_IMAP_PASSWORD)
+  --security string        Connection security: tls, starttls or none (default: tls)
+  --insecure-skip-verify   Do not verify the TLS certificate of the remote server
+  --state string           SQLite state file (default: sora-imap-<email>.db in the current directory)
+  --jobs int               Number of mailboxes migrated in parallel, one connection each (default: 4)
+  --batch-size int         Number of messages fetched at once (default: 20)
+  --dry-run                Show what would be migrated without making changes
+  --preserve-flags         Preserve flags and keep them in sync on later runs (default: true)
+  --preserve-uids          Preserve the remote UIDVALIDITY and UIDs in empty mailboxes
+  --delay duration         Delay between messages to control rate (e.g. 500ms)
+  --mailbox-filter string  Comma-separated list of remote or Sora mailboxes to migrate (e.g. INBOX,Sent,Archive*)
+  --start-date string      Migrate only messages received after this date (YYYY-MM-DD)
+  --end-date string        Migrate only messages received before this date (YYYY-MM-DD)
+  --config string          Path to TOML configuration file (required)
+
+Every selectable mailbox of the remote account is migrated, except mailboxes of other users, shared
+mailboxes and virtual mailboxes such as Gmail's All Mail. Special-use mailboxes (\Sent, \Drafts, \Junk,
+\Trash, \Archive) are migrated to the Sora special mailboxes, the personal namespace prefix is dropped
+(INBOX.Work becomes Work) and the remote hierarchy delimiter is replaced by /. Flags and internal dates
+are kept; \Recent is not.
+
+The state file keeps the UIDVALIDITY, the last migrated UID and the HIGHESTMODSEQ of every remote mailbox.
+Run the command again with the same state file to resume an interrupted migration or to migrate the
+messages received since the last run. If the remote server supports CONDSTORE, flag changes of already
+migrated messages are copied too. Messages deleted on the remote server are not deleted in Sora, and
+messages skipped by --start-date and --end-date are not revisited by later runs.
+
+With --preserve-uids the remote UIDVALIDITY and UIDs are kept for mailboxes that are empty in Sora, so
+clients do not download messages again after the switch. Mailboxes that already contain messages get new
+UIDs.
+
+Examples:
+  # Preview the migration
+  sora-admin migrate-imap --email user@example.com --host imap.example.net --dry-run
+
+  # Migrate, keeping the UIDs
+  SORA_MIGRATE_IMAP_PASSWORD=secret sora-admin migrate-imap --email user@example.com --host imap.example.net --preserve-uids
+
+  # Migrate from another login, over STARTTLS
+  sora-admin migrate-imap --email user@example.com --host mail.old.example:143 --security starttls --user user --password secret
+
+  # Migrate the messages received since the last run, shortly before the MX switch
+  sora-admin migrate-imap --email user@example.com --host imap.example.net --state /var/lib/sora/user.db
+`)
+	}
+
+	parseFlags(fs, os.Args[2:])
+
+	if *email == "" || *host == "" {
+		fmt.Printf("Error: --email and --host are required\n\n")
+		fs.Usage()
+		exit(1)
+	}
+
+	switch *security {
+	case imapSecurityTLS, imapSecurityStartTLS, imapSecurityNone:
+	default:
+		fmt.Printf("Error: Invalid security %q. Use tls, starttls or none\n", *security)
+		exit(1)
+	}
+
+	address := *host
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		port := "993"
+		if *security != imapSecurityTLS {
+			port = "143"
+		}
+		address = net.JoinHostPort(address, port)
+	}
+
+	if *username == "" {
+		*username = *email
+	}
+	if *password == "" {
+		*password = os.Getenv("SORA_MIGRATE_IMAP_PASSWORD")
+	}
+	if *password == "" {
+		fmt.Printf("Error: --password or $SORA_MIGRATE_IMAP_PASSWORD is required\n")
+		exit(1)
+	}
+
+	if *statePath == "" {
+		*statePath = fmt.Sprintf("sora-imap-%s.db", strings.ToLower(*email))
+	}
+
+	// Parse date filters
+	var startDateParsed, endDateParsed *time.Time
+	if *startDate != "" {
+		t, err := time.Parse("2006-01-02", *startDate)
+		if err != nil {
+			fmt.Printf("Error: Invalid start date format. Use YYYY-MM-DD\n")
+			exit(1)
+		}
+		startDateParsed = &t
+	}
+	if *endDate != "" {
+		t, err := time.Parse("2006-01-02", *endDate)
+		if err != nil {
+			fmt.Printf("Error: Invalid end date format. Use YYYY-MM-DD\n")
+			exit(1)
+		}
+		// Add 23:59:59 to include the entire end date
+		t = t.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
+		endDateParsed = &t
+	}
+
+	var mailboxList []string
+	if *mailboxFilter != "" {
+		mailboxList = strings.Split(*mailboxFilter, ",")
+		for i := range mailboxList {
+			mailboxList[i] = strings.TrimSpace(mailboxList[i])
+		}
+	}
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	// As for maildir imports, SORA_ADMIN_SKIP_S3=1 stores messages in the database only
+	var s3 storage.BlobStore
+	if os.Getenv("SORA_ADMIN_SKIP_S3") == "1" {
+		logger.Info("S3 disabled via SORA_ADMIN_SKIP_S3=1")
+	} else {
+		s3, err = newBlobStore(globalConfig)
+		if err != nil {
+			logger.Fatalf("Failed to initialize storage: %v", err)
+		}
+	}
+
+	options := IMAPMigratorOptions{
+		Address:            address,
+		Username:           *username,
+		Password:           *password,
+		Security:           *security,
+		InsecureSkipVerify: *insecureSkipVerify,
+		StatePath:          *statePath,
+		MailboxFilter:      mailboxList,
+		PreserveFlags:      *preserveFlags,
+		PreserveUIDs:       *preserveUIDs,
+		DryRun:             *dryRun,
+		StartDate:          startDateParsed,
+		EndDate:            endDateParsed,
+		Jobs:               *jobs,
+		BatchSize:          *batchSize,
+		MaxMessageSize:     globalConfig.GetImportMessageLimit(),
+		ImportDelay:        *delay,
+		TestMode:           s3 == nil,
+	}
+
+	migrator, err := NewIMAPMigrator(ctx, *email, rdb, s3, options)
+	if err != nil {
+		logger.Fatalf("Failed to create IMAP migrator: %v", err)
+	}
+
+	if err := migrator.Run(); err != nil {
+		logger.Fatalf("Failed to migrate from %s: %v", address, err)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+// quota.go - Command handlers for account and domain quotas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/helpers"
+	"github.com/migadu/sora/logger"
+)
+
+func handleShowQuota(ctx context.Context) {
+	fs := flag.NewFlagSet("accounts quota", flag.ContinueOnError)
+	email := fs.String("email", "", "Email address of the account")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+
+	fs.Usage = func() {
+		fmt.Printf(`Show quota limits and usage of an account
+
+Usage:
+  sora-admin accounts quota --email <email> [options]
+
+Options:
+  --email string   Email address of the account (required)
+  --json           Output in JSON format instead of human-readable format
+
+Examples:
+  sora-admin accounts quota --email user@example.com
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *email == "" {
+		fmt.Println("Error: --email is required")
+		fs.Usage()
+		exit(1)
+	}
+
+	if err := showQuota(ctx, globalConfig, *email, *jsonOutput); err != nil {
+		logger.Fatalf("Failed to show quota: %v", err)
+	}
+}
+
+func handleSetQuota(ctx context.Context) {
+	fs := flag.NewFlagSet("accounts set-quota", flag.ContinueOnError)
+	email := fs.String("email", "", "Email address of the account")
+	storage := fs.String("storage", "", "Storage limit (e.g. 500mb, 10gb, 0 = unlimited)")
+	messages := fs.Int64("messages", -1, "Maximum number of messages (0 = unlimited)")
+
+	fs.Usage = func() {
+		fmt.Printf(`Set the quota of an account
+
+Both limits are replaced. A limit that is not given is cleared, so the
+domain default (if any) applies to it again.
+
+Usage:
+  sora-admin accounts set-quota --email <email> [options]
+
+Options:
+  --email string     Email address of the account (required)
+  --storage string   Storage limit (e.g. 500mb, 10gb); 0 = unlimited
+  --messages int     Maximum number of messages; 0 = unlimited
+
+Examples:
+  sora-admin accounts set-quota --email user@example.com --storage 10gb
+  sora-admin accounts set-quota --email user@example.com --storage 1gb --messages 50000
+  sora-admin accounts set-quota --email user@example.com   # revert to domain default
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *email == "" {
+		fmt.Println("Error: --email is required")
+		fs.Usage()
+		exit(1)
+	}
+
+	storageLimit, messagesLimit, err := parseQuotaFlags(*storage, *messages)
+	if err != nil {
+		fmt.Printf("Error: %v\n\n", err)
+		fs.Usage()
+		exit(1)
+	}
+
+	if err := setQuota(ctx, globalConfig, *email, storageLimit, messagesLimit); err != nil {
+		logger.Fatalf("Failed to set quota: %v", err)
+	}
+
+	fmt.Printf("Quota updated for %s (storage: %s, messages: %s)\n", *email, describeStorageLimit(storageLimit), describeMessagesLimit(messagesLimit))
+}
+
+func handleDomainQuota(ctx context.Context) {
+	fs := flag.NewFlagSet("accounts domain-quota", flag.ContinueOnError)
+	domain := fs.String("domain", "", "Domain name")
+	storage := fs.String("storage", "", "Default storage limit (e.g. 500mb, 10gb, 0 = unlimited)")
+	messages := fs.Int64("messages", -1, "Default maximum number of messages (0 = unlimited)")
+	remove := fs.Bool("delete", false, "Remove the domain default quota")
+
+	fs.Usage = func() {
+		fmt.Printf(`Show or set the default quota of a domain
+
+The domain default applies to every account of the domain that has no limit
+of its own. Without --storage, --messages or --delete the current default is shown.
+
+Usage:
+  sora-admin accounts domain-quota --domain <domain> [options]
+
+Options:
+  --domain string    Domain name (required)
+  --storage string   Default storage limit (e.g. 500mb, 10gb); 0 = unlimited
+  --messages int     Default maximum number of messages; 0 = unlimited
+  --delete           Remove the domain default quota
+
+Examples:
+  sora-admin accounts domain-quota --domain example.com
+  sora-admin accounts domain-quota --domain example.com --storage 5gb --messages 100000
+  sora-admin accounts domain-quota --domain example.com --delete
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *domain == "" {
+		fmt.Println("Error: --domain is required")
+		fs.Usage()
+		exit(1)
+	}
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	switch {
+	case *remove:
+		if err := rdb.DeleteDomainQuotaWithRetry(ctx, *domain); err != nil {
+			if errors.Is(err, consts.ErrDBNotFound) {
+				logger.Fatalf("No quota set for domain %s", *domain)
+			}
+			logger.Fatalf("Failed to delete domain quota: %v", err)
+		}
+		fmt.Printf("Default quota removed for domain %s\n", *domain)
+
+	case *storage != "" || *messages >= 0:
+		storageLimit, messagesLimit, err := parseQuotaFlags(*storage, *messages)
+		if err != nil {
+			fmt.Printf("Error: %v\n\n", err)
+			fs.Usage()
+			exit(1)
+		}
+		quota := db.DomainQuota{Domain: *domain, StorageLimit: storageLimit, MessagesLimit: messagesLimit}
+		if err := rdb.SetDomainQuotaWithRetry(ctx, quota); err != nil {
+			logger.Fatalf("Failed to set domain quota: %v", err)
+		}
+		fmt.Printf("Default quota updated for domain %s (storage: %s, messages: %s)\n", *domain, describeStorageLimit(storageLimit), describeMessagesLimit(messagesLimit))
+
+	default:
+		quota, err := rdb.GetDomainQuotaWithRetry(ctx, *domain)
+		if err != nil {
+			if errors.Is(err, consts.ErrDBNotFound) {
+				fmt.Printf("No default quota set for domain %s\n", *domain)
+				return
+			}
+			logger.Fatalf("Failed to get domain quota: %v", err)
+		}
+		fmt.Printf("Default quota for domain %s:\n", quota.Domain)
+		fmt.Printf("  Storage:  %s\n", describeStorageLimit(quota.StorageLimit))
+		fmt.Printf("  Messages: %s\n", describeMessagesLimit(quota.MessagesLimit))
+	}
+}
+
+// parseQuotaFlags converts the --storage and --messages flag values into
+// optional limits. An empty storage string or negative message count means
+// "not set".
+func parseQuotaFlags(storage string, messages int64) (*int64, *int64, error) {
+	var storageLimit, messagesLimit *int64
+	if storage != "" {
+		size, err := helpers.ParseSize(storage)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid --storage value %q: %w", storage, err)
+		}
+		storageLimit = &size
+	}
+	if messages >= 0 {
+		messagesLimit = &messages
+	}
+	return storageLimit, messagesLimit, nil
+}
+
+func describeStorageLimit(limit *int64) string {
+	switch {
+	case limit == nil:
+		return "not set"
+	case *limit == 0:
+		return "unlimited"
+	default:
+		return formatBytes(*limit)
+	}
+}
+
+func describeMessagesLimit(limit *int64) string {
+	switch {
+	case limit == nil:
+		return "not set"
+	case *limit == 0:
+		return "unlimited"
+	default:
+		return fmt.Sprintf("%d", *limit)
+	}
+}
+
+func showQuota(ctx context.Context, cfg AdminConfig, email string, jsonOutput bool) error {
+	rdb, err := newAdminDatabase(ctx, &cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to initialize resilient database: %w", err)
+	}
+	defer rdb.Close()
+
+	accountID, err := rdb.GetAccountIDByAddressWithRetry(ctx, email)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserNotFound) {
+			return fmt.Errorf("account with email %s does not exist", email)
+		}
+		return fmt.Errorf("failed to find account: %w", err)
+	}
+
+	quota, err := rdb.GetAccountQuotaWithRetry(ctx, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to get quota: %w", err)
+	}
+
+	if jsonOutput {
+		jsonData, err := json.MarshalIndent(quota, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling JSON: %w", err)
+		}
+		fmt.Println(string(jsonData))
+		return nil
+	}
+
+	fmt.Printf("Quota for %s (account ID %d):\n", email, quota.AccountID)
+	if quota.StorageLimit > 0 {
+		fmt.Printf("  Storage:  %s of %s (%.1f%%, from %s)\n", formatBytes(quota.StorageUsed), formatBytes(quota.StorageLimit),
+			float64(quota.StorageUsed)*100/float64(quota.StorageLimit), quota.StorageSource)
+	} else {
+		fmt.Printf("  Storage:  %s (unlimited)\n", formatBytes(quota.StorageUsed))
+	}
+	if quota.MessagesLimit > 0 {
+		fmt.Printf("  Messages: %d of %d (%.1f%%, from %s)\n", quota.MessagesUsed, quota.MessagesLimit,
+			float64(quota.MessagesUsed)*100/float64(quota.MessagesLimit), quota.MessagesSource)
+	} else {
+		fmt.Printf("  Messages: %d (unlimited)\n", quota.MessagesUsed)
+	}
+	return nil
+}
+
+func setQuota(ctx context.Context, cfg AdminConfig, email string, storageLimit, messagesLimit *int64) error {
+	rdb, err := newAdminDatabase(ctx, &cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to initialize resilient database: %w", err)
+	}
+	defer rdb.Close()
+
+	accountID, err := rdb.GetAccountIDByAddressWithRetry(ctx, email)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserNotFound) {
+			return fmt.Errorf("account with email %s does not exist", email)
+		}
+		return fmt.Errorf("failed to find account: %w", err)
+	}
+
+	return rdb.SetAccountQuotaWithRetry(ctx, accountID, storageLimit, messagesLimit)
+}
@@ -19,7 +19,7 @@ import (
 func handleRelayCommand(ctx context.Context) {
 	if len(os.Args) < 3 {
 		printRelayUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	subcommand := os.Args[2]
@@ -39,25 +39,25 @@ func handleRelayCommand(ctx context.Context) {
 	default:
 		fmt.Printf("Unknown relay subcommand: %s\n\n", subcommand)
 		printRelayUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
 func handleRelayStats(_ context.Context) {
-	flags := flag.NewFlagSet("relay stats", flag.ExitOnError)
+	flags := flag.NewFlagSet("relay stats", flag.ContinueOnError)
 	configPath := flags.String("config", "config.toml", "Configuration file path")
-	flags.Parse(os.Args[3:])
+	parseFlags(flags, os.Args[3:])
 
 	// Load config to get relay queue path
 	cfg, err := loadConfig(*configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	if !cfg.Relay.IsQueueEnabled() {
 		fmt.Println("Relay is not configured (queue is enabled automatically when relay is configured)")
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Create queue instance (just for stats, doesn't start worker)
@@ -65,14 +65,14 @@ func handleRelayStats(_ context.Context) {
 	queue, err := relayqueue.NewDiskQueue(queuePath, cfg.Relay.Queue.MaxAttempts, nil)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error accessing relay queue: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Get stats
 	pending, processing, failed, err := queue.GetStats()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error getting stats: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Display stats
@@ -88,22 +88,22 @@ func handleRelayStats(_ context.Context) {
 }
 
 func handleRelayList(_ context.Context) {
-	flags := flag.NewFlagSet("relay list", flag.ExitOnError)
+	flags := flag.NewFlagSet("relay list", flag.ContinueOnError)
 	configPath := flags.String("config", "config.toml", "Configuration file path")
 	queueType := flags.String("queue", "pending", "Queue to list (pending, processing, failed)")
 	limit := flags.Int("limit", 100, "Maximum number of messages to display")
-	flags.Parse(os.Args[3:])
+	parseFlags(flags, os.Args[3:])
 
 	// Load config
 	cfg, err := loadConfig(*configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	if !cfg.Relay.IsQueueEnabled() {
 		fmt.Println("Relay is not configured (queue is enabled automatically when relay is configured)")
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Determine queue directory
@@ -117,7 +117,7 @@ func handleRelayList(_ context.Context) {
 		queueDir = filepath.Join(cfg.Relay.GetQueuePath(), "failed")
 	default:
 		fmt.Fprintf(os.Stderr, "Invalid queue type: %s (must be pending, processing, or failed)\n", *queueType)
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Read directory
@@ -126,10 +126,10 @@ func handleRelayList(_ context.Context) {
 		if os.IsNotExist(err) {
 			fmt.Printf("Queue directory does not exist: %s\n", queueDir)
 			fmt.Println("This may indicate the relay queue has never been used.")
-			os.Exit(0)
+			exit(0)
 		}
 		fmt.Fprintf(os.Stderr, "Error reading queue directory: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Collect metadata files
@@ -194,28 +194,28 @@ func handleRelayList(_ context.Context) {
 }
 
 func handleRelayShow(_ context.Context) {
-	flags := flag.NewFlagSet("relay show", flag.ExitOnError)
+	flags := flag.NewFlagSet("relay show", flag.ContinueOnError)
 	configPath := flags.String("config", "config.toml", "Configuration file path")
 	messageID := flags.String("id", "", "Message ID to display (required)")
 	queueType := flags.String("queue", "pending", "Queue to search (pending, processing, failed)")
-	flags.Parse(os.Args[3:])
+	parseFlags(flags, os.Args[3:])
 
 	if *messageID == "" {
 		fmt.Fprintf(os.Stderr, "Error: --id is required\n")
 		flags.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Load config
 	cfg, err := loadConfig(*configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	if !cfg.Relay.IsQueueEnabled() {
 		fmt.Println("Relay is not configured (queue is enabled automatically when relay is configured)")
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Try to find the message in the specified queue
@@ -229,16 +229,16 @@ func handleRelayShow(_ context.Context) {
 		if os.IsNotExist(err) {
 			fmt.Fprintf(os.Stderr, "Message ID %s not found in %s queue\n", *messageID, *queueType)
 			fmt.Fprintf(os.Stderr, "Try searching other queues with --queue flag\n")
-			os.Exit(1)
+			exit(1)
 		}
 		fmt.Fprintf(os.Stderr, "Error reading metadata: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	var msg relayqueue.QueuedMessage
 	if err := json.Unmarshal(data, &msg); err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing metadata: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Read message body
@@ -279,34 +279,34 @@ func handleRelayShow(_ context.Context) {
 }
 
 func handleRelayDelete(_ context.Context) {
-	flags := flag.NewFlagSet("relay delete", flag.ExitOnError)
+	flags := flag.NewFlagSet("relay delete", flag.ContinueOnError)
 	configPath := flags.String("config", "config.toml", "Configuration file path")
 	messageID := flags.String("id", "", "Message ID to delete (use 'all' to delete all messages)")
 	queueType := flags.String("queue", "failed", "Queue to delete from (pending, processing, failed)")
 	confirm := flags.Bool("confirm", false, "Confirm deletion (required)")
-	flags.Parse(os.Args[3:])
+	parseFlags(flags, os.Args[3:])
 
 	if *messageID == "" {
 		fmt.Fprintf(os.Stderr, "Error: --id is required\n")
 		flags.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	if !*confirm {
 		fmt.Fprintf(os.Stderr, "Error: --confirm flag is required for safety\n")
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Load config
 	cfg, err := loadConfig(*configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	if !cfg.Relay.IsQueueEnabled() {
 		fmt.Println("Relay is not configured (queue is enabled automatically when relay is configured)")
-		os.Exit(1)
+		exit(1)
 	}
 
 	queueDir := filepath.Join(cfg.Relay.GetQueuePath(), *queueType)
@@ -316,7 +316,7 @@ func handleRelayDelete(_ context.Context) {
 		entries, err := os.ReadDir(queueDir)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error reading queue directory: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		deleted := 0
@@ -342,13 +342,13 @@ func handleRelayDelete(_ context.Context) {
 		// Check if message exists
 		if _, err := os.Stat(metadataPath); os.IsNotExist(err) {
 			fmt.Fprintf(os.Stderr, "Message ID %s not found in %s queue\n", *messageID, *queueType)
-			os.Exit(1)
+			exit(1)
 		}
 
 		// Delete both files
 		if err := os.Remove(metadataPath); err != nil {
 			fmt.Fprintf(os.Stderr, "Error deleting metadata: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		if err := os.Remove(messagePath); err != nil {
@@ -360,33 +360,33 @@ func handleRelayDelete(_ context.Context) {
 }
 
 func handleRelayRequeue(_ context.Context) {
-	flags := flag.NewFlagSet("relay requeue", flag.ExitOnError)
+	flags := flag.NewFlagSet("relay requeue", flag.ContinueOnError)
 	configPath := flags.String("config", "config.toml", "Configuration file path")
 	messageID := flags.String("id", "", "Message ID to requeue (use 'all' to requeue all failed messages)")
 	confirm := flags.Bool("confirm", false, "Confirm requeue operation (required)")
-	flags.Parse(os.Args[3:])
+	parseFlags(flags, os.Args[3:])
 
 	if *messageID == "" {
 		fmt.Fprintf(os.Stderr, "Error: --id is required\n")
 		flags.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	if !*confirm {
 		fmt.Fprintf(os.Stderr, "Error: --confirm flag is required for safety\n")
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Load config
 	cfg, err := loadConfig(*configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	if !cfg.Relay.IsQueueEnabled() {
 		fmt.Println("Relay is not configured (queue is enabled automatically when relay is configured)")
-		os.Exit(1)
+		exit(1)
 	}
 
 	failedDir := filepath.Join(cfg.Relay.GetQueuePath(), "failed")
@@ -397,7 +397,7 @@ func handleRelayRequeue(_ context.Context) {
 		entries, err := os.ReadDir(failedDir)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error reading failed queue: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		requeued := 0
@@ -420,7 +420,7 @@ func handleRelayRequeue(_ context.Context) {
 		// Requeue specific message
 		if err := requeueMessage(failedDir, pendingDir, *messageID); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		fmt.Printf("Requeued message %s from failed to pending queue\n", *messageID)
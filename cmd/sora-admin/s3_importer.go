@@ -16,8 +16,6 @@ import (
 
 	"github.com/migadu/sora/logger"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/imapserver"
 	"github.com/emersion/go-message/mail"
@@ -71,7 +69,7 @@ type S3ObjectInfo struct {
 }
 
 // NewS3Importer creates a new S3Importer instance
-func NewS3Importer(rdb *resilient.ResilientDatabase, s3 *storage.S3Storage, options S3ImporterOptions) (*S3Importer, error) {
+func NewS3Importer(rdb *resilient.ResilientDatabase, s3 storage.BlobStore, options S3ImporterOptions) (*S3Importer, error) {
 	// Wrap S3 storage with resilient patterns
 	resilientS3 := resilient.NewResilientS3Storage(s3)
 	// Create temporary SQLite database to track S3 objects
@@ -188,92 +186,83 @@ func (si *S3Importer) scanS3Objects() error {
 	s3Prefix := fmt.Sprintf("%s/%s/", address.Domain(), address.LocalPart())
 	logger.Info("Scanning S3 bucket for user", "email", si.options.Email, "prefix", s3Prefix)
 
-	ctx := context.Background()
-	input := &s3.ListObjectsV2Input{
-		Bucket:     aws.String(si.s3.GetStorage().BucketName),
-		Prefix:     aws.String(s3Prefix),
-		MaxKeys:    aws.Int32(1000), // Process in batches
-		StartAfter: aws.String(si.options.ContinuationToken),
-	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	objectCount := 0
 	batchCount := 0
 
-	paginator := s3.NewListObjectsV2Paginator(si.s3.GetStorage().Client, input)
+	objectCh, errCh := si.s3.GetStorage().ListObjectsAfter(ctx, s3Prefix, si.options.ContinuationToken, true)
 
-	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(ctx)
-		if err != nil {
-			return fmt.Errorf("error listing S3 objects: %w", err)
+	for object := range objectCh {
+		key := object.Key
+		size := object.Size
+		lastModified := object.LastModified
+		etag := object.ETag
+
+		// Parse the S3 key to extract domain, local_part, and content_hash
+		// Expected format: domain/local_part/content_hash
+		parts := strings.Split(key, "/")
+		if len(parts) != 3 {
+			logger.Info("Skipping S3 object with unexpected key format", "key", key)
+			continue
 		}
 
-		for _, object := range page.Contents {
-			key := aws.ToString(object.Key)
-			size := aws.ToInt64(object.Size)
-			lastModified := aws.ToTime(object.LastModified)
-			etag := strings.Trim(aws.ToString(object.ETag), "\"")
-
-			// Parse the S3 key to extract domain, local_part, and content_hash
-			// Expected format: domain/local_part/content_hash
-			parts := strings.Split(key, "/")
-			if len(parts) != 3 {
-				logger.Info("Skipping S3 object with unexpected key format", "key", key)
-				continue
-			}
+		domain := parts[0]
+		localPart := parts[1]
+		contentHash := parts[2]
 
-			domain := parts[0]
-			localPart := parts[1]
-			contentHash := parts[2]
-
-			// Validate that this matches our expected user
-			expectedDomain := address.Domain()
-			expectedLocalPart := address.LocalPart()
-			if domain != expectedDomain || localPart != expectedLocalPart {
-				logger.Info("Skipping S3 object for different user", "key", key,
-					"expected_email", fmt.Sprintf("%s@%s", expectedLocalPart, expectedDomain))
-				continue
-			}
+		// Validate that this matches our expected user
+		expectedDomain := address.Domain()
+		expectedLocalPart := address.LocalPart()
+		if domain != expectedDomain || localPart != expectedLocalPart {
+			logger.Info("Skipping S3 object for different user", "key", key,
+				"expected_email", fmt.Sprintf("%s@%s", expectedLocalPart, expectedDomain))
+			continue
+		}
 
-			// Validate content hash format (should be hex)
-			if len(contentHash) != 64 { // SHA256 hex string length
-				logger.Info("Skipping S3 object with invalid hash format", "key", key)
-				continue
-			}
-			if _, err := hex.DecodeString(contentHash); err != nil {
-				logger.Info("Skipping S3 object with non-hex hash", "key", key)
-				continue
-			}
+		// Validate content hash format (should be hex)
+		if len(contentHash) != 64 { // SHA256 hex string length
+			logger.Info("Skipping S3 object with invalid hash format", "key", key)
+			continue
+		}
+		if _, err := hex.DecodeString(contentHash); err != nil {
+			logger.Info("Skipping S3 object with non-hex hash", "key", key)
+			continue
+		}
 
-			// Store object information in SQLite
-			_, err := si.db.Exec(`
-				INSERT OR IGNORE INTO s3_objects
-				(key, size, last_modified, etag, domain, local_part, content_hash)
-				VALUES (?, ?, ?, ?, ?, ?, ?)`,
-				key, size, lastModified.Format(time.RFC3339),
-				etag, domain, localPart, contentHash)
-			if err != nil {
-				return fmt.Errorf("failed to insert S3 object info: %w", err)
-			}
+		// Store object information in SQLite
+		_, err := si.db.Exec(`
+			INSERT OR IGNORE INTO s3_objects
+			(key, size, last_modified, etag, domain, local_part, content_hash)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			key, size, lastModified.Format(time.RFC3339),
+			etag, domain, localPart, contentHash)
+		if err != nil {
+			return fmt.Errorf("failed to insert S3 object info: %w", err)
+		}
 
-			objectCount++
-			if objectCount%1000 == 0 {
-				logger.Info("Scanned S3 objects", "count", objectCount)
-			}
+		objectCount++
+		if objectCount%1000 == 0 {
+			logger.Info("Scanned S3 objects", "count", objectCount)
+		}
 
-			// Check if we've reached the maximum object limit
-			if si.options.MaxObjects > 0 && objectCount >= si.options.MaxObjects {
-				logger.Info("Reached maximum object limit", "max", si.options.MaxObjects)
-				return nil
-			}
+		// Check if we've reached the maximum object limit
+		if si.options.MaxObjects > 0 && objectCount >= si.options.MaxObjects {
+			logger.Info("Reached maximum object limit", "max", si.options.MaxObjects)
+			return nil
+		}
 
-			batchCount++
-			if batchCount >= si.options.BatchSize {
-				// Store continuation token for resumable operations
-				si.lastContinuationToken = key
-				batchCount = 0
-			}
+		batchCount++
+		if batchCount >= si.options.BatchSize {
+			// Store continuation token for resumable operations
+			si.lastContinuationToken = key
+			batchCount = 0
 		}
 	}
+	if err := <-errCh; err != nil {
+		return fmt.Errorf("error listing S3 objects: %w", err)
+	}
 
 	logger.Info("Completed S3 scan", "count", objectCount)
 	return nil
@@ -503,6 +492,7 @@ func (si *S3Importer) importS3Object(obj S3ObjectInfo) error {
 	if len(inReplyTo) == 0 {
 		inReplyTo = nil
 	}
+	references, _ := mailHeader.MsgIDList("References")
 
 	if sentDate.IsZero() {
 		sentDate = time.Now()
@@ -560,6 +550,7 @@ func (si *S3Importer) importS3Object(obj S3ObjectInfo) error {
 			PlaintextBody: actualPlaintextBody,
 			SentDate:      sentDate,
 			InReplyTo:     inReplyTo,
+			References:    references,
 			BodyStructure: &bodyStructure,
 			Recipients:    recipients,
 			RawHeaders:    rawHeadersText,
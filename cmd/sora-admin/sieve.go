@@ -0,0 +1,410 @@
+package main
+
+// sieve.go - Command handlers for global and domain Sieve scripts
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/server/sieveengine"
+)
+
+func handleSieveCommand(ctx context.Context) {
+	if len(os.Args) < 3 {
+		printSieveUsage()
+		exit(1)
+	}
+
+	subcommand := os.Args[2]
+	switch subcommand {
+	case "list":
+		handleListGlobalSieveScripts(ctx)
+	case "show":
+		handleShowGlobalSieveScript(ctx)
+	case "create":
+		handleCreateGlobalSieveScript(ctx)
+	case "update":
+		handleUpdateGlobalSieveScript(ctx)
+	case "delete":
+		handleDeleteGlobalSieveScript(ctx)
+	case "help", "--help", "-h":
+		printSieveUsage()
+	default:
+		fmt.Printf("Unknown sieve subcommand: %s\n\n", subcommand)
+		printSieveUsage()
+		exit(1)
+	}
+}
+
+func printSieveUsage() {
+	fmt.Printf(`Global Sieve Script Management
+
+Global scripts run for every account, domain scripts for the accounts of one
+domain, before or after the account's own script:
+
+  global before, domain before, account script, domain after, global after
+
+A before script that files, redirects or discards a message skips the
+account's script. After scripts always run. Changes apply to deliveries within
+a minute.
+
+Usage:
+  sora-admin sieve <subcommand> [options]
+
+Subcommands:
+  list     List global and domain scripts
+  show     Show a script
+  create   Create a script
+  update   Change a script
+  delete   Delete a script
+
+Examples:
+  sora-admin sieve create --phase before --name spam --file spam.sieve
+  sora-admin sieve create --domain example.com --phase after --name archive --file archive.sieve
+  sora-admin sieve update --id 3 --active=false
+  sora-admin sieve list --domain example.com
+
+Use 'sora-admin sieve <subcommand> --help' for detailed help.
+`)
+}
+
+// readSieveScript reads a script from a file, or from stdin for "-".
+func readSieveScript(path string) (string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read script: %w", err)
+	}
+	return string(data), nil
+}
+
+// validateGlobalSieveScript normalizes s and checks that its script parses
+// with the extensions global scripts may use.
+func validateGlobalSieveScript(s *db.GlobalSieveScript) error {
+	if err := s.Normalize(); err != nil {
+		return err
+	}
+	extensions := sieveengine.GlobalExtensions(globalConfig.Sieve.GlobalEnabledExtensions)
+	if _, err := sieveengine.NewSieveExecutorWithExtensions(s.Script, extensions); err != nil {
+		return fmt.Errorf("invalid script: %w", err)
+	}
+	return nil
+}
+
+func handleListGlobalSieveScripts(ctx context.Context) {
+	fs := flag.NewFlagSet("sieve list", flag.ContinueOnError)
+	domain := fs.String("domain", "", "Only list the scripts that run for this domain")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+
+	fs.Usage = func() {
+		fmt.Printf(`List global and domain Sieve scripts in the order they run
+
+Usage:
+  sora-admin sieve list [options]
+
+Options:
+  --domain string   Only list the scripts that run for the accounts of this domain
+  --json            Output in JSON format instead of human-readable format
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	scripts, err := rdb.ListGlobalSieveScriptsWithRetry(ctx)
+	if err != nil {
+		logger.Fatalf("Failed to list global sieve scripts: %v", err)
+	}
+	if *domain != "" {
+		d := strings.ToLower(strings.TrimSpace(*domain))
+		filtered := []db.GlobalSieveScript{}
+		for _, s := range scripts {
+			if s.Domain == "" || s.Domain == d {
+				filtered = append(filtered, s)
+			}
+		}
+		scripts = filtered
+	}
+
+	if *jsonOutput {
+		printJSON(scripts)
+		return
+	}
+
+	if len(scripts) == 0 {
+		fmt.Println("No global sieve scripts found.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDOMAIN\tPHASE\tNAME\tACTIVE\tUPDATED")
+	for _, s := range scripts {
+		domain := s.Domain
+		if domain == "" {
+			domain = "(all)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%t\t%s\n", s.ID, domain, s.Phase, s.Name, s.Active, s.UpdatedAt.Format("2006-01-02 15:04:05"))
+	}
+	w.Flush()
+}
+
+func handleShowGlobalSieveScript(ctx context.Context) {
+	fs := flag.NewFlagSet("sieve show", flag.ContinueOnError)
+	id := fs.Int64("id", 0, "Script ID")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+
+	fs.Usage = func() {
+		fmt.Printf(`Show a global Sieve script
+
+Usage:
+  sora-admin sieve show --id <id> [options]
+
+Options:
+  --id int   Script ID (required)
+  --json     Output in JSON format instead of human-readable format
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *id <= 0 {
+		fmt.Println("Error: --id is required")
+		fs.Usage()
+		exit(1)
+	}
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	s, err := rdb.GetGlobalSieveScriptWithRetry(ctx, *id)
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			logger.Fatalf("Global sieve script %d does not exist", *id)
+		}
+		logger.Fatalf("Failed to get global sieve script: %v", err)
+	}
+
+	if *jsonOutput {
+		printJSON(s)
+		return
+	}
+
+	domain := s.Domain
+	if domain == "" {
+		domain = "all domains"
+	}
+	fmt.Printf("ID:       %d\n", s.ID)
+	fmt.Printf("Name:     %s\n", s.Name)
+	fmt.Printf("Domain:   %s\n", domain)
+	fmt.Printf("Phase:    %s\n", s.Phase)
+	fmt.Printf("Active:   %t\n", s.Active)
+	fmt.Printf("Created:  %s\n", s.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+	fmt.Printf("Updated:  %s\n", s.UpdatedAt.Format("2006-01-02 15:04:05 MST"))
+	fmt.Printf("\n%s", s.Script)
+	if !strings.HasSuffix(s.Script, "\n") {
+		fmt.Println()
+	}
+}
+
+func handleCreateGlobalSieveScript(ctx context.Context) {
+	fs := flag.NewFlagSet("sieve create", flag.ContinueOnError)
+	domain := fs.String("domain", "", "Domain the script runs for (empty = all domains)")
+	phase := fs.String("phase", "", "before or after the account's script")
+	name := fs.String("name", "", "Script name")
+	file := fs.String("file", "", "Script file ('-' for stdin)")
+	active := fs.Bool("active", true, "Run the script")
+
+	fs.Usage = func() {
+		fmt.Printf(`Create a global or domain Sieve script
+
+Usage:
+  sora-admin sieve create --phase <before|after> --name <name> --file <path> [options]
+
+Options:
+  --domain string   Domain whose accounts the script runs for (default: all accounts)
+  --phase string    Run "before" or "after" the account's script (required)
+  --name string     Script name, unique per domain (required)
+  --file string     Script file, or - to read from stdin (required)
+  --active          Run the script (default: true)
+
+Examples:
+  sora-admin sieve create --phase before --name spam --file spam.sieve
+  sora-admin sieve create --domain example.com --phase after --name archive --file - < archive.sieve
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *phase == "" || *name == "" || *file == "" {
+		fmt.Println("Error: --phase, --name and --file are required")
+		fs.Usage()
+		exit(1)
+	}
+
+	script, err := readSieveScript(*file)
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+	s := db.GlobalSieveScript{Domain: *domain, Phase: *phase, Name: *name, Script: script, Active: *active}
+	if err := validateGlobalSieveScript(&s); err != nil {
+		logger.Fatalf("Error: %v", err)
+	}
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	created, err := rdb.CreateGlobalSieveScriptWithRetry(ctx, s)
+	if err != nil {
+		if errors.Is(err, consts.ErrDBUniqueViolation) {
+			logger.Fatalf("A global sieve script named %s already exists for this domain", s.Name)
+		}
+		logger.Fatalf("Failed to create global sieve script: %v", err)
+	}
+
+	fmt.Printf("Global sieve script %s created with ID %d\n", created.Name, created.ID)
+}
+
+func handleUpdateGlobalSieveScript(ctx context.Context) {
+	fs := flag.NewFlagSet("sieve update", flag.ContinueOnError)
+	id := fs.Int64("id", 0, "Script ID")
+	phase := fs.String("phase", "", "before or after the account's script")
+	name := fs.String("name", "", "Script name")
+	file := fs.String("file", "", "Script file ('-' for stdin)")
+	active := fs.Bool("active", true, "Run the script")
+
+	fs.Usage = func() {
+		fmt.Printf(`Change a global or domain Sieve script
+
+Only the given options are changed. The domain of a script cannot be changed.
+
+Usage:
+  sora-admin sieve update --id <id> [options]
+
+Options:
+  --id int          Script ID (required)
+  --phase string    Run "before" or "after" the account's script
+  --name string     Script name
+  --file string     Script file, or - to read from stdin
+  --active          Run the script (use --active=false to disable it)
+
+Examples:
+  sora-admin sieve update --id 3 --file spam.sieve
+  sora-admin sieve update --id 3 --active=false
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *id <= 0 {
+		fmt.Println("Error: --id is required")
+		fs.Usage()
+		exit(1)
+	}
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	s, err := rdb.GetGlobalSieveScriptWithRetry(ctx, *id)
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			logger.Fatalf("Global sieve script %d does not exist", *id)
+		}
+		logger.Fatalf("Failed to get global sieve script: %v", err)
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+	if set["phase"] {
+		s.Phase = *phase
+	}
+	if set["name"] {
+		s.Name = *name
+	}
+	if set["file"] {
+		if s.Script, err = readSieveScript(*file); err != nil {
+			logger.Fatalf("%v", err)
+		}
+	}
+	if set["active"] {
+		s.Active = *active
+	}
+	if err := validateGlobalSieveScript(s); err != nil {
+		logger.Fatalf("Error: %v", err)
+	}
+
+	if _, err := rdb.UpdateGlobalSieveScriptWithRetry(ctx, *s); err != nil {
+		if errors.Is(err, consts.ErrDBUniqueViolation) {
+			logger.Fatalf("A global sieve script named %s already exists for this domain", s.Name)
+		}
+		logger.Fatalf("Failed to update global sieve script: %v", err)
+	}
+
+	fmt.Printf("Global sieve script %d updated\n", *id)
+}
+
+func handleDeleteGlobalSieveScript(ctx context.Context) {
+	fs := flag.NewFlagSet("sieve delete", flag.ContinueOnError)
+	id := fs.Int64("id", 0, "Script ID")
+
+	fs.Usage = func() {
+		fmt.Printf(`Delete a global or domain Sieve script
+
+Usage:
+  sora-admin sieve delete --id <id>
+
+Options:
+  --id int   Script ID (required)
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *id <= 0 {
+		fmt.Println("Error: --id is required")
+		fs.Usage()
+		exit(1)
+	}
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	if err := rdb.DeleteGlobalSieveScriptWithRetry(ctx, *id); err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			logger.Fatalf("Global sieve script %d does not exist", *id)
+		}
+		logger.Fatalf("Failed to delete global sieve script: %v", err)
+	}
+
+	fmt.Printf("Global sieve script %d deleted\n", *id)
+}
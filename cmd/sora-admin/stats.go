@@ -21,7 +21,7 @@ import (
 func handleStatsCommand(ctx context.Context) {
 	if len(os.Args) < 3 {
 		printStatsUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	subcommand := os.Args[2]
@@ -35,13 +35,13 @@ func handleStatsCommand(ctx context.Context) {
 	default:
 		fmt.Printf("Unknown stats subcommand: %s\n\n", subcommand)
 		printStatsUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
 func handleBlockedCommand(ctx context.Context) {
 	// Parse blocked specific flags
-	fs := flag.NewFlagSet("stats blocked", flag.ExitOnError)
+	fs := flag.NewFlagSet("stats blocked", flag.ContinueOnError)
 	protocol := fs.String("protocol", "", "Filter by protocol (imap, pop3, managesieve, imap_proxy, pop3_proxy, managesieve_proxy, userapi)")
 
 	fs.Usage = func() {
@@ -67,9 +67,7 @@ Examples:
 	}
 
 	// Parse the remaining arguments
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Show blocked entries
 	if err := showBlockedEntries(ctx, globalConfig, *protocol); err != nil {
@@ -79,7 +77,7 @@ Examples:
 
 func handleConnectionStats(ctx context.Context) {
 	// Parse connection-stats specific flags
-	fs := flag.NewFlagSet("stats connection", flag.ExitOnError)
+	fs := flag.NewFlagSet("stats connection", flag.ContinueOnError)
 
 	userEmail := fs.String("user", "", "Show connections for specific user email")
 	showDetail := fs.Bool("detail", true, "Show detailed connection list")
@@ -114,9 +112,7 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 
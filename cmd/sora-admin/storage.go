@@ -0,0 +1,309 @@
+package main
+
+// storage.go - Command handlers for S3 storage maintenance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/storage"
+)
+
+func handleStorageCommand(ctx context.Context) {
+	if len(os.Args) < 3 {
+		printStorageUsage()
+		exit(1)
+	}
+
+	subcommand := os.Args[2]
+	switch subcommand {
+	case "rotate-keys":
+		handleStorageRotateKeys(ctx)
+	case "help", "--help", "-h":
+		printStorageUsage()
+	default:
+		fmt.Printf("Unknown storage subcommand: %s\n\n", subcommand)
+		printStorageUsage()
+		exit(1)
+	}
+}
+
+func printStorageUsage() {
+	fmt.Printf(`Storage Management
+
+Usage:
+  sora-admin storage <subcommand> [options]
+
+Subcommands:
+  rotate-keys   Re-encrypt S3 objects with the active encryption key
+
+Examples:
+  sora-admin --config config.toml storage rotate-keys --dry-run
+  sora-admin --config config.toml storage rotate-keys --prefix example.com/
+
+Use 'sora-admin storage <subcommand> --help' for detailed help.
+`)
+}
+
+func handleStorageRotateKeys(ctx context.Context) {
+	fs := flag.NewFlagSet("storage rotate-keys", flag.ContinueOnError)
+	prefix := fs.String("prefix", "", "Only rotate objects whose key starts with this prefix")
+	stateFile := fs.String("state-file", "rotate-keys.state.json", "File used to record progress so an interrupted run can resume")
+	restart := fs.Bool("restart", false, "Ignore any saved progress and start from the beginning")
+	dryRun := fs.Bool("dry-run", false, "Report objects that would be rotated without rewriting them")
+	delay := fs.Duration("delay", 0, "Pause between objects to limit load on S3 (e.g. 10ms)")
+	progressEvery := fs.Int("progress-every", 1000, "Print progress and save state every N objects")
+
+	fs.Usage = func() {
+		fmt.Printf(`Re-encrypt S3 objects with the active encryption key
+
+Usage:
+  sora-admin storage rotate-keys [options]
+
+Options:
+  --prefix string          Only rotate objects whose key starts with this prefix (e.g. example.com/)
+  --state-file string      Progress file for resuming (default: rotate-keys.state.json)
+  --restart                Ignore saved progress and start from the beginning
+  --dry-run                Report objects that would be rotated without rewriting them
+  --delay duration         Pause between objects to limit load on S3 (default: 0)
+  --progress-every int     Print progress and save state every N objects (default: 1000)
+
+Requires [s3] encrypt = true and an encryption key ring (encryption_keys with
+encryption_key_id). Every object under the prefix is read; objects that are not
+yet encrypted with the active key and encryption_key_scope are decrypted with
+their original key (or the legacy encryption_key) and written back. Objects
+that change or disappear while being rotated are left untouched. Objects that
+cannot be decrypted are reported and skipped.
+
+Objects are listed in key order and the last processed key is saved to the
+state file, so the job can be interrupted and re-run to continue. Old master
+keys must stay in encryption_keys until a run completes without failures.
+
+Examples:
+  sora-admin --config config.toml storage rotate-keys --dry-run
+  sora-admin --config config.toml storage rotate-keys
+  sora-admin --config config.toml storage rotate-keys --prefix example.com/ --delay 10ms
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *progressEvery <= 0 {
+		*progressEvery = 1000
+	}
+
+	if err := rotateStorageKeys(ctx, globalConfig, *prefix, *stateFile, *restart, *dryRun, *delay, *progressEvery); err != nil {
+		logger.Fatalf("Key rotation failed: %v", err)
+	}
+}
+
+// rotateKeysState is the progress of a rotate-keys run, persisted so that an
+// interrupted run can resume after the last processed key.
+type rotateKeysState struct {
+	Prefix      string    `json:"prefix"`
+	ActiveKeyID string    `json:"active_key_id"`
+	Scope       string    `json:"scope"`
+	LastKey     string    `json:"last_key"`
+	Scanned     int64     `json:"scanned"`
+	Rotated     int64     `json:"rotated"`
+	Skipped     int64     `json:"skipped"`
+	Changed     int64     `json:"changed"`
+	Failed      int64     `json:"failed"`
+	Completed   bool      `json:"completed"`
+	StartedAt   time.Time `json:"started_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func loadRotateKeysState(path string) (*rotateKeysState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var state rotateKeysState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// save writes the state atomically so a crash never leaves a truncated file.
+func (st *rotateKeysState) save(path string) error {
+	st.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func rotateStorageKeys(ctx context.Context, cfg AdminConfig, prefix, stateFile string, restart, dryRun bool, delay time.Duration, progressEvery int) error {
+	if !cfg.S3.Encrypt {
+		return fmt.Errorf("S3 encryption is not enabled in the configuration")
+	}
+	if len(cfg.S3.EncryptionKeys) == 0 {
+		return fmt.Errorf("no encryption key ring configured: set [s3] encryption_keys and encryption_key_id")
+	}
+
+	s3Timeout, err := cfg.S3.GetTimeout()
+	if err != nil {
+		return fmt.Errorf("invalid S3 timeout configuration: %w", err)
+	}
+	s3Storage, err := storage.New(cfg.S3.Endpoint, cfg.S3.AccessKey, cfg.S3.SecretKey, cfg.S3.Bucket, !cfg.S3.DisableTLS, cfg.S3.GetDebug(), s3Timeout)
+	if err != nil {
+		return fmt.Errorf("failed to initialize S3: %w", err)
+	}
+	if err := s3Storage.ConfigureEncryption(&cfg.S3); err != nil {
+		return fmt.Errorf("failed to enable S3 encryption: %w", err)
+	}
+
+	activeKeyID := s3Storage.KeyRing.ActiveKeyID()
+	scope := s3Storage.KeyRing.Scope().String()
+
+	var state *rotateKeysState
+	if !restart && !dryRun {
+		state, err = loadRotateKeysState(stateFile)
+		if err != nil {
+			return fmt.Errorf("failed to load state file: %w", err)
+		}
+		if state != nil && (state.Prefix != prefix || state.ActiveKeyID != activeKeyID || state.Scope != scope) {
+			fmt.Printf("State file %s belongs to a different run (prefix %q, key %q, scope %s); starting over\n", stateFile, state.Prefix, state.ActiveKeyID, state.Scope)
+			state = nil
+		}
+		if state != nil && state.Completed {
+			fmt.Printf("Rotation to key %q already completed at %s (use --restart to run again)\n", activeKeyID, state.UpdatedAt.Format(time.RFC3339))
+			return nil
+		}
+	}
+	if state == nil {
+		state = &rotateKeysState{
+			Prefix:      prefix,
+			ActiveKeyID: activeKeyID,
+			Scope:       scope,
+			StartedAt:   time.Now(),
+		}
+	} else {
+		fmt.Printf("Resuming after %q (%d objects already scanned)\n", state.LastKey, state.Scanned)
+	}
+
+	mode := ""
+	if dryRun {
+		mode = " (dry run)"
+	}
+	fmt.Printf("Rotating S3 objects to key %q, scope %s%s\n", activeKeyID, scope, mode)
+	if prefix != "" {
+		fmt.Printf("Prefix: %s\n", prefix)
+	}
+
+	saveState := func() {
+		if dryRun {
+			return
+		}
+		if err := state.save(stateFile); err != nil {
+			logger.Warn("Failed to save rotation state", "file", stateFile, "error", err)
+		}
+	}
+	printProgress := func() {
+		fmt.Printf("  scanned %d, rotated %d, up to date %d, changed %d, failed %d (last: %s)\n",
+			state.Scanned, state.Rotated, state.Skipped, state.Changed, state.Failed, state.LastKey)
+	}
+
+	runStart := time.Now()
+	objectCh, errCh := s3Storage.ListObjectsAfter(ctx, prefix, state.LastKey, true)
+
+	for objectCh != nil || errCh != nil {
+		select {
+		case <-ctx.Done():
+			saveState()
+			printProgress()
+			return ctx.Err()
+		case err, ok := <-errCh:
+			if !ok {
+				errCh = nil
+				continue
+			}
+			saveState()
+			return fmt.Errorf("S3 list error: %w", err)
+		case object, ok := <-objectCh:
+			if !ok {
+				objectCh = nil
+				continue
+			}
+
+			result, err := s3Storage.RotateObject(ctx, object.Key, dryRun)
+			switch {
+			case err != nil:
+				if ctx.Err() != nil {
+					// Leave LastKey on the previous object so it is retried on resume
+					continue
+				}
+				state.Failed++
+				fmt.Printf("  ✗ %s: %v\n", object.Key, err)
+			case result == storage.RotateRotated:
+				state.Rotated++
+				if dryRun {
+					fmt.Printf("  would rotate %s\n", object.Key)
+				}
+			case result == storage.RotateChanged:
+				state.Changed++
+			default:
+				state.Skipped++
+			}
+			state.Scanned++
+			state.LastKey = object.Key
+
+			if state.Scanned%int64(progressEvery) == 0 {
+				printProgress()
+				saveState()
+			}
+
+			if delay > 0 {
+				select {
+				case <-ctx.Done():
+				case <-time.After(delay):
+				}
+			}
+		}
+	}
+
+	state.Completed = state.Failed == 0
+	saveState()
+
+	status := "finished"
+	if !state.Completed {
+		status = "finished with failures"
+	}
+	fmt.Printf("\nRotation %s in %s\n", status, time.Since(runStart).Round(time.Second))
+	fmt.Printf("  Scanned:     %d\n", state.Scanned)
+	fmt.Printf("  Rotated:     %d\n", state.Rotated)
+	fmt.Printf("  Up to date:  %d\n", state.Skipped)
+	fmt.Printf("  Changed:     %d\n", state.Changed)
+	fmt.Printf("  Failed:      %d\n", state.Failed)
+
+	if state.Failed > 0 {
+		return fmt.Errorf("%d objects could not be rotated; keep old keys in encryption_keys and re-run with --restart after fixing them", state.Failed)
+	}
+	return nil
+}
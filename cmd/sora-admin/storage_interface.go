@@ -1,15 +1,24 @@
 package main
 
-import "io"
+import (
+	"io"
+
+	"github.com/migadu/sora/storage"
+)
 
 // objectStorage defines the interface for S3-compatible object storage operations.
-// This allows for using either real S3 storage or file-based mocks during testing.
-// Both storage.S3Storage and testutils.FileBasedS3Mock implement this interface.
+// This allows for using either the configured blob store or file-based mocks during testing.
+// Every storage.BlobStore and testutils.FileBasedS3Mock implement this interface.
 type objectStorage interface {
 	Put(key string, reader io.Reader, size int64) error
 	Get(key string) (io.ReadCloser, error)
 	Exists(key string) (bool, string, error)
 	Delete(key string) error
 	Copy(sourcePath, destPath string) error
-	EnableEncryption(encryptionKey string) error
+}
+
+// newBlobStore creates the blob store selected by the [storage] section,
+// with encryption and tiering configured the same way as the server.
+func newBlobStore(cfg AdminConfig) (storage.BlobStore, error) {
+	return storage.NewFromConfig(&cfg.S3, &cfg.Storage)
 }
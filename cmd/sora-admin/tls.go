@@ -24,7 +24,7 @@ import (
 func handleTLSCommand(ctx context.Context) {
 	if len(os.Args) < 3 {
 		printTLSUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	subcommand := os.Args[2]
@@ -42,12 +42,12 @@ func handleTLSCommand(ctx context.Context) {
 	default:
 		fmt.Printf("Unknown tls subcommand: %s\n\n", subcommand)
 		printTLSUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
 func handleTLSList(ctx context.Context) {
-	fs := flag.NewFlagSet("tls list", flag.ExitOnError)
+	fs := flag.NewFlagSet("tls list", flag.ContinueOnError)
 
 	cacheDir := fs.String("cache-dir", "", "Local autocert cache directory (default: from config tls.letsencrypt.fallback_dir or /var/lib/sora/certs)")
 	showDetails := fs.Bool("details", false, "Show detailed certificate information")
@@ -79,9 +79,7 @@ Examples:
 `)
 	}
 
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Determine cache directory: flag > config > default
 	finalCacheDir := *cacheDir
@@ -99,7 +97,7 @@ Examples:
 }
 
 func handleTLSDelete(ctx context.Context) {
-	fs := flag.NewFlagSet("tls delete", flag.ExitOnError)
+	fs := flag.NewFlagSet("tls delete", flag.ContinueOnError)
 
 	domain := fs.String("domain", "", "Domain name (e.g., imap.example.com) - deletes both ECDSA and RSA variants")
 	s3Key := fs.String("key", "", "S3 key (e.g., autocert/cert-abc123...)")
@@ -131,20 +129,18 @@ Examples:
 `)
 	}
 
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	if *domain == "" && *s3Key == "" {
 		fmt.Println("Error: Either --domain or --key must be specified")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	if *domain != "" && *s3Key != "" {
 		fmt.Println("Error: Cannot specify both --domain and --key")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Determine cache directory
@@ -163,7 +159,7 @@ Examples:
 }
 
 func handleTLSClean(ctx context.Context) {
-	fs := flag.NewFlagSet("tls clean", flag.ExitOnError)
+	fs := flag.NewFlagSet("tls clean", flag.ContinueOnError)
 
 	cacheDir := fs.String("cache-dir", "", "Local autocert cache directory (default: from config)")
 	dryRun := fs.Bool("dry-run", false, "Show what would be deleted without actually deleting")
@@ -195,9 +191,7 @@ Examples:
 `)
 	}
 
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Determine cache directory
 	finalCacheDir := *cacheDir
@@ -215,7 +209,7 @@ Examples:
 }
 
 func handleTLSCache(ctx context.Context) {
-	fs := flag.NewFlagSet("tls cache", flag.ExitOnError)
+	fs := flag.NewFlagSet("tls cache", flag.ContinueOnError)
 
 	cacheDir := fs.String("cache-dir", "", "Local autocert cache directory (default: from config)")
 	domain := fs.String("domain", "", "Cache specific domain only (defaults to all configured domains)")
@@ -248,9 +242,7 @@ Examples:
 `)
 	}
 
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Determine cache directory
 	finalCacheDir := *cacheDir
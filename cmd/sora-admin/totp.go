@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/logger"
+)
+
+func handleResetTOTP(ctx context.Context) {
+	fs := flag.NewFlagSet("accounts totp-reset", flag.ContinueOnError)
+	email := fs.String("email", "", "Email address of the account")
+
+	fs.Usage = func() {
+		fmt.Printf(`Remove the TOTP second factor of an account
+
+Use this when a user lost both their authenticator and their recovery codes.
+The user can then log in to the User API with the password alone and enrol
+again.
+
+Usage:
+  sora-admin accounts totp-reset --email <email>
+
+Options:
+  --email string   Email address of the account (required)
+`)
+	}
+
+	parseFlags(fs, os.Args[3:])
+
+	if *email == "" {
+		fmt.Println("Error: --email is required")
+		fs.Usage()
+		exit(1)
+	}
+
+	rdb, err := newAdminDatabase(ctx, &globalConfig.Database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize resilient database: %v", err)
+	}
+	defer rdb.Close()
+
+	accountID, err := rdb.GetAccountIDByAddressWithRetry(ctx, *email)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserNotFound) {
+			logger.Fatalf("Account with email %s does not exist", *email)
+		}
+		logger.Fatalf("Failed to look up account: %v", err)
+	}
+
+	if err := rdb.DeleteTOTPWithRetry(ctx, accountID); err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			fmt.Printf("Account %s has no second factor\n", *email)
+			return
+		}
+		logger.Fatalf("Failed to reset second factor: %v", err)
+	}
+	fmt.Printf("Second factor of %s removed\n", *email)
+}
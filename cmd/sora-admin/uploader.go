@@ -12,13 +12,12 @@ import (
 	"time"
 
 	"github.com/migadu/sora/logger"
-	"github.com/migadu/sora/storage"
 )
 
 func handleUploaderCommand(ctx context.Context) {
 	if len(os.Args) < 3 {
 		printUploaderUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	subcommand := os.Args[2]
@@ -32,13 +31,13 @@ func handleUploaderCommand(ctx context.Context) {
 	default:
 		fmt.Printf("Unknown uploader subcommand: %s\n\n", subcommand)
 		printUploaderUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
 func handleUploaderStatus(ctx context.Context) {
 	// Parse uploader status specific flags
-	fs := flag.NewFlagSet("uploader status", flag.ExitOnError)
+	fs := flag.NewFlagSet("uploader status", flag.ContinueOnError)
 
 	showFailed := fs.Bool("show-failed", true, "Show failed uploads details")
 	failedLimit := fs.Int("failed-limit", 10, "Maximum number of failed uploads to show")
@@ -69,9 +68,7 @@ Examples:
 	}
 
 	// Parse the remaining arguments (skip the command and subcommand name)
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 
@@ -82,7 +79,7 @@ Examples:
 }
 
 func handleUploaderResolve(ctx context.Context) {
-	fs := flag.NewFlagSet("uploader resolve", flag.ExitOnError)
+	fs := flag.NewFlagSet("uploader resolve", flag.ContinueOnError)
 	dryRun := fs.Bool("dry-run", false, "Show what would be done without making changes")
 	limit := fs.Int("limit", 100, "Maximum number of failed uploads to process")
 
@@ -109,9 +106,7 @@ Examples:
 `)
 	}
 
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	if err := resolveFailedUploads(ctx, globalConfig, *dryRun, *limit); err != nil {
 		logger.Fatalf("Failed to resolve uploads: %v", err)
@@ -125,27 +120,9 @@ func resolveFailedUploads(ctx context.Context, cfg AdminConfig, dryRun bool, lim
 	}
 	defer rdb.Close()
 
-	s3Timeout, err := cfg.S3.GetTimeout()
-	if err != nil {
-		return fmt.Errorf("invalid S3 timeout configuration: %w", err)
-	}
-
-	s3Storage, err := storage.New(
-		cfg.S3.Endpoint,
-		cfg.S3.AccessKey,
-		cfg.S3.SecretKey,
-		cfg.S3.Bucket,
-		!cfg.S3.DisableTLS,
-		false,
-		s3Timeout,
-	)
+	s3Storage, err := newBlobStore(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to initialize S3: %w", err)
-	}
-	if cfg.S3.Encrypt {
-		if err := s3Storage.EnableEncryption(cfg.S3.EncryptionKey); err != nil {
-			return fmt.Errorf("failed to enable S3 encryption: %w", err)
-		}
+		return fmt.Errorf("failed to initialize storage: %w", err)
 	}
 
 	failedUploads, err := rdb.GetFailedUploadsWithEmailWithRetry(ctx, cfg.Uploader.MaxAttempts, limit)
@@ -296,33 +273,11 @@ func showUploaderStatus(ctx context.Context, cfg AdminConfig, showFailed bool, f
 
 	// Show failed uploads if requested
 	if showFailed && stats.FailedUploads > 0 {
-		// Initialize S3 storage for checking existence
-		s3Timeout, err := cfg.S3.GetTimeout()
+		// Initialize storage for checking existence
+		s3Storage, err := newBlobStore(cfg)
 		if err != nil {
-			logger.Warn("Invalid S3 timeout configuration (S3 Status column will show 'N/A')", "error", err)
-		}
-
-		var s3Storage *storage.S3Storage
-		if err == nil {
-			s3Storage, err = storage.New(
-				cfg.S3.Endpoint,
-				cfg.S3.AccessKey,
-				cfg.S3.SecretKey,
-				cfg.S3.Bucket,
-				!cfg.S3.DisableTLS,
-				false,
-				s3Timeout,
-			)
-			if err != nil {
-				logger.Warn("Failed to initialize S3 (S3 Status column will show 'N/A')", "error", err)
-				s3Storage = nil
-			}
-		}
-		if s3Storage != nil && cfg.S3.Encrypt {
-			if err := s3Storage.EnableEncryption(cfg.S3.EncryptionKey); err != nil {
-				logger.Warn("Failed to enable S3 encryption (S3 Status column will show 'N/A')", "error", err)
-				s3Storage = nil
-			}
+			logger.Warn("Failed to initialize storage (S3 Status column will show 'N/A')", "error", err)
+			s3Storage = nil
 		}
 
 		fmt.Printf("\nFailed Uploads (showing up to %d):\n", failedLimit)
@@ -17,7 +17,7 @@ import (
 func handleVerifyCommand(ctx context.Context) {
 	if len(os.Args) < 3 {
 		printVerifyUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	subcommand := os.Args[2]
@@ -31,7 +31,7 @@ func handleVerifyCommand(ctx context.Context) {
 	default:
 		fmt.Printf("Unknown verify subcommand: %s\n\n", subcommand)
 		printVerifyUsage()
-		os.Exit(1)
+		exit(1)
 	}
 }
 
@@ -57,7 +57,7 @@ Use 'sora-admin verify <subcommand> --help' for detailed help.
 
 func handleVerifyS3(ctx context.Context) {
 	// Parse verify s3 specific flags
-	fs := flag.NewFlagSet("verify s3", flag.ExitOnError)
+	fs := flag.NewFlagSet("verify s3", flag.ContinueOnError)
 
 	email := fs.String("email", "", "Email address to verify (required)")
 	showMissing := fs.Bool("show-missing", false, "Show detailed list of missing/orphaned objects")
@@ -101,15 +101,13 @@ Examples:
 	}
 
 	// Parse the remaining arguments
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	if *email == "" {
 		fmt.Printf("Error: --email is required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Run verification
@@ -139,30 +137,10 @@ func verifyS3Storage(ctx context.Context, cfg AdminConfig, email string, showMis
 	}
 	defer rdb.Close()
 
-	// Initialize S3 storage
-	s3Timeout, err := cfg.S3.GetTimeout()
-	if err != nil {
-		return fmt.Errorf("invalid S3 timeout configuration: %w", err)
-	}
-
-	s3Storage, err := storage.New(
-		cfg.S3.Endpoint,
-		cfg.S3.AccessKey,
-		cfg.S3.SecretKey,
-		cfg.S3.Bucket,
-		!cfg.S3.DisableTLS, // useSSL = !DisableTLS
-		false,              // no debug
-		s3Timeout,          // timeout
-	)
+	// Initialize storage
+	s3Storage, err := newBlobStore(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to initialize S3 storage: %w", err)
-	}
-
-	// Enable encryption if configured
-	if cfg.S3.Encrypt {
-		if err := s3Storage.EnableEncryption(cfg.S3.EncryptionKey); err != nil {
-			return fmt.Errorf("failed to enable encryption: %w", err)
-		}
+		return fmt.Errorf("failed to initialize storage: %w", err)
 	}
 
 	fmt.Printf("Verifying S3 consistency for %s...\n\n", email)
@@ -221,7 +199,7 @@ func verifyS3Storage(ctx context.Context, cfg AdminConfig, email string, showMis
 	return nil
 }
 
-func checkDBToS3(ctx context.Context, rdb *resilient.ResilientDatabase, s3Storage *storage.S3Storage, accountID int64, result *verificationResult, batchSize int) error {
+func checkDBToS3(ctx context.Context, rdb *resilient.ResilientDatabase, s3Storage storage.BlobStore, accountID int64, result *verificationResult, batchSize int) error {
 	// Get all messages for the user
 	messages, err := rdb.GetAllMessagesForUserVerificationWithRetry(ctx, accountID)
 	if err != nil {
@@ -253,7 +231,7 @@ func checkDBToS3(ctx context.Context, rdb *resilient.ResilientDatabase, s3Storag
 	return nil
 }
 
-func checkS3ToDB(ctx context.Context, rdb *resilient.ResilientDatabase, s3Storage *storage.S3Storage, accountID int64, email string, result *verificationResult) error {
+func checkS3ToDB(ctx context.Context, rdb *resilient.ResilientDatabase, s3Storage storage.BlobStore, accountID int64, email string, result *verificationResult) error {
 	// Parse email to get domain and localpart
 	parts := strings.Split(email, "@")
 	if len(parts) != 2 {
@@ -303,7 +281,7 @@ func checkS3ToDB(ctx context.Context, rdb *resilient.ResilientDatabase, s3Storag
 	}
 }
 
-func applyFixes(ctx context.Context, rdb *resilient.ResilientDatabase, s3Storage *storage.S3Storage, result *verificationResult, fixOrphaned, fixMissing bool) error {
+func applyFixes(ctx context.Context, rdb *resilient.ResilientDatabase, s3Storage storage.BlobStore, result *verificationResult, fixOrphaned, fixMissing bool) error {
 	var wg sync.WaitGroup
 	errors := make(chan error, 2)
 
@@ -408,7 +386,7 @@ func printVerificationSummary(result *verificationResult, showMissing, dryRun, f
 
 func handleVerifyHash(ctx context.Context) {
 	// Parse verify hash specific flags
-	fs := flag.NewFlagSet("verify hash", flag.ExitOnError)
+	fs := flag.NewFlagSet("verify hash", flag.ContinueOnError)
 
 	hash := fs.String("hash", "", "Content hash to verify (required)")
 	email := fs.String("email", "", "Email address (required)")
@@ -441,20 +419,18 @@ Examples:
 	}
 
 	// Parse the remaining arguments
-	if err := fs.Parse(os.Args[3:]); err != nil {
-		logger.Fatalf("Error parsing flags: %v", err)
-	}
+	parseFlags(fs, os.Args[3:])
 
 	// Validate required arguments
 	if *hash == "" {
 		fmt.Printf("Error: --hash is required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 	if *email == "" {
 		fmt.Printf("Error: --email is required\n\n")
 		fs.Usage()
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Run verification
@@ -471,30 +447,10 @@ func verifyContentHash(ctx context.Context, cfg AdminConfig, hash, email string,
 	}
 	defer rdb.Close()
 
-	// Initialize S3 storage
-	s3Timeout, err := cfg.S3.GetTimeout()
-	if err != nil {
-		return fmt.Errorf("invalid S3 timeout configuration: %w", err)
-	}
-
-	s3Storage, err := storage.New(
-		cfg.S3.Endpoint,
-		cfg.S3.AccessKey,
-		cfg.S3.SecretKey,
-		cfg.S3.Bucket,
-		!cfg.S3.DisableTLS,
-		false,
-		s3Timeout,
-	)
+	// Initialize storage
+	s3Storage, err := newBlobStore(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to initialize S3 storage: %w", err)
-	}
-
-	// Enable encryption if configured
-	if cfg.S3.Encrypt {
-		if err := s3Storage.EnableEncryption(cfg.S3.EncryptionKey); err != nil {
-			return fmt.Errorf("failed to enable encryption: %w", err)
-		}
+		return fmt.Errorf("failed to initialize storage: %w", err)
 	}
 
 	// Get account ID
@@ -19,8 +19,10 @@ import (
 	"github.com/migadu/sora/cache"
 	"github.com/migadu/sora/cluster"
 	"github.com/migadu/sora/config"
+	"github.com/migadu/sora/db"
 	"github.com/migadu/sora/logger"
 	"github.com/migadu/sora/pkg/errors"
+	"github.com/migadu/sora/pkg/events"
 	"github.com/migadu/sora/pkg/health"
 	"github.com/migadu/sora/pkg/metrics"
 	"github.com/migadu/sora/pkg/resilient"
@@ -31,6 +33,7 @@ import (
 	"github.com/migadu/sora/server/delivery"
 	"github.com/migadu/sora/server/imap"
 	"github.com/migadu/sora/server/imapproxy"
+	"github.com/migadu/sora/server/jmap"
 	"github.com/migadu/sora/server/lmtp"
 	"github.com/migadu/sora/server/lmtpproxy"
 	"github.com/migadu/sora/server/managesieve"
@@ -38,6 +41,9 @@ import (
 	"github.com/migadu/sora/server/pop3"
 	"github.com/migadu/sora/server/pop3proxy"
 	"github.com/migadu/sora/server/relayqueue"
+	"github.com/migadu/sora/server/sieveengine"
+	"github.com/migadu/sora/server/submission"
+	"github.com/migadu/sora/server/submissionproxy"
 	"github.com/migadu/sora/server/uploader"
 	mailapi "github.com/migadu/sora/server/userapi"
 	"github.com/migadu/sora/server/userapiproxy"
@@ -77,30 +83,35 @@ func (sm *serverManager) Wait() {
 
 // serverDependencies encapsulates all shared services and dependencies needed by servers
 type serverDependencies struct {
-	storage               *storage.S3Storage
-	resilientDB           *resilient.ResilientDatabase
-	uploadWorker          *uploader.UploadWorker
-	cacheInstance         *cache.Cache
-	cleanupWorker         *cleaner.CleanupWorker
-	relayQueue            *relayqueue.DiskQueue
-	relayWorker           *relayqueue.Worker
-	healthIntegration     *health.HealthIntegration
-	metricsCollector      *metrics.Collector
-	clusterManager        *cluster.Manager
-	tlsManager            *tlsmanager.Manager
-	affinityManager       *server.AffinityManager
-	spamTrainingClient    *spamtraining.Client // Spam filter training client (optional)
-	hostname              string
-	ftsRetention          time.Duration
-	config                config.Config
-	serverManager         *serverManager
-	connectionTrackers    map[string]*server.ConnectionTracker // protocol -> tracker (for admin API kick)
-	connectionTrackersMux sync.Mutex                           // protects connectionTrackers map
-	authCacheInstance     *authcache.Cache                     // persistent auth cache
-	proxyServers          map[string]adminapi.ProxyServer      // proxy name -> proxy server interface (for backend health)
-	proxyServersMux       sync.Mutex                           // protects proxyServers map
-	runningServers        map[string]ConfigReloader            // server name -> reloadable server
-	runningServersMux     sync.Mutex                           // protects runningServers map
+	storage                  storage.BlobStore
+	resilientDB              *resilient.ResilientDatabase
+	uploadWorker             *uploader.UploadWorker
+	cacheInstance            *cache.Cache
+	cleanupWorker            *cleaner.CleanupWorker
+	relayQueue               *relayqueue.DiskQueue
+	relayWorker              *relayqueue.Worker
+	eventDispatcher          *events.Dispatcher  // Mailbox event stream (optional)
+	eventWebhook             *events.WebhookSink // Webhook sink of the event stream
+	eventFile                *events.FileSink    // NDJSON file sink of the event stream
+	healthIntegration        *health.HealthIntegration
+	metricsCollector         *metrics.Collector
+	clusterManager           *cluster.Manager
+	tlsManager               *tlsmanager.Manager
+	affinityManager          *server.AffinityManager
+	spamTrainingClient       *spamtraining.Client    // Spam filter training client (optional)
+	mailboxNotifier          *server.MailboxNotifier // Push-driven IDLE (optional)
+	idleFallbackPollInterval time.Duration
+	hostname                 string
+	ftsRetention             time.Duration
+	config                   config.Config
+	serverManager            *serverManager
+	connectionTrackers       map[string]*server.ConnectionTracker // protocol -> tracker (for admin API kick)
+	connectionTrackersMux    sync.Mutex                           // protects connectionTrackers map
+	authCacheInstance        *authcache.Cache                     // persistent auth cache
+	proxyServers             map[string]adminapi.ProxyServer      // proxy name -> proxy server interface (for backend health)
+	proxyServersMux          sync.Mutex                           // protects proxyServers map
+	runningServers           map[string]ConfigReloader            // server name -> reloadable server
+	runningServersMux        sync.Mutex                           // protects runningServers map
 }
 
 // ConfigReloader is implemented by servers that support runtime config reload via SIGHUP.
@@ -227,6 +238,17 @@ func main() {
 	if deps.relayWorker != nil {
 		defer deps.relayWorker.Stop()
 	}
+	// Deferred calls run in reverse: the dispatcher drains into the sinks first
+	if deps.eventFile != nil {
+		defer deps.eventFile.Close()
+	}
+	if deps.eventWebhook != nil {
+		defer deps.eventWebhook.Stop()
+	}
+	if deps.eventDispatcher != nil {
+		defer deps.eventDispatcher.Stop()
+		defer events.SetDefault(nil)
+	}
 
 	// SIGHUP handler for config reload - set up AFTER deps is created so we can
 	// update deps.config directly. Servers that hold Config *config.Config pointers
@@ -247,6 +269,13 @@ func main() {
 			// Update shared config settings (propagates via Config pointer)
 			handleConfigReload(*configPath, &deps.config, errorHandler)
 
+			// Reopen the event file so it can be rotated
+			if deps.eventFile != nil {
+				if err := deps.eventFile.Reopen(); err != nil {
+					logger.Error("Failed to reopen event file", "error", err)
+				}
+			}
+
 			// Dispatch per-server reload to running servers
 			deps.runningServersMux.Lock()
 			serverCount := len(deps.runningServers)
@@ -477,13 +506,13 @@ func initializeServices(ctx context.Context, cfg config.Config, errorHandler *er
 		(cfg.Database.Read != nil && len(cfg.Database.Read.Hosts) > 0)
 
 	for _, server := range allServers {
-		if server.Type == "imap" || server.Type == "lmtp" || server.Type == "pop3" {
+		if server.Type == "imap" || server.Type == "lmtp" || server.Type == "pop3" || server.Type == "jmap" || server.Type == "submission" {
 			storageServicesNeeded = true
 			databaseNeeded = true
 			break
 		}
 		// Check if proxy servers need database (when lookup_local_users=true)
-		if server.Type == "imap_proxy" || server.Type == "pop3_proxy" || server.Type == "managesieve_proxy" || server.Type == "lmtp_proxy" || server.Type == "user_api_proxy" {
+		if server.Type == "imap_proxy" || server.Type == "pop3_proxy" || server.Type == "managesieve_proxy" || server.Type == "lmtp_proxy" || server.Type == "user_api_proxy" || server.Type == "jmap_proxy" || server.Type == "submission_proxy" {
 			if server.RemoteLookup != nil && server.RemoteLookup.ShouldLookupLocalUsers() {
 				databaseNeeded = true
 			}
@@ -515,39 +544,35 @@ func initializeServices(ctx context.Context, cfg config.Config, errorHandler *er
 		proxyServers:       make(map[string]adminapi.ProxyServer),
 	}
 
-	// Initialize S3 storage if needed
+	// Initialize blob storage if needed
 	if storageServicesNeeded {
-		// Ensure required S3 arguments are provided only if needed
-		if cfg.S3.AccessKey == "" || cfg.S3.SecretKey == "" || cfg.S3.Bucket == "" {
-			errorHandler.ValidationError("S3 credentials", fmt.Errorf("missing required S3 credentials for mail services (IMAP, LMTP, POP3)"))
-			os.Exit(errorHandler.WaitForExit())
+		backend := cfg.Storage.GetBackend()
+		if backend == storage.BackendS3 {
+			// Ensure required S3 arguments are provided only if needed
+			if cfg.S3.AccessKey == "" || cfg.S3.SecretKey == "" || cfg.S3.Bucket == "" {
+				errorHandler.ValidationError("S3 credentials", fmt.Errorf("missing required S3 credentials for mail services (IMAP, LMTP, POP3)"))
+				os.Exit(errorHandler.WaitForExit())
+			}
+			if cfg.S3.Endpoint == "" {
+				errorHandler.ValidationError("S3 endpoint", fmt.Errorf("S3 endpoint not specified"))
+				os.Exit(errorHandler.WaitForExit())
+			}
+			s3Timeout, err := cfg.S3.GetTimeout()
+			if err != nil {
+				errorHandler.ValidationError("S3 timeout", err)
+				os.Exit(errorHandler.WaitForExit())
+			}
+			logger.Info("Connecting to S3", "endpoint", cfg.S3.Endpoint, "bucket", cfg.S3.Bucket, "timeout", s3Timeout)
+		} else {
+			logger.Info("Initializing blob storage", "backend", backend, "path", cfg.Storage.Path)
 		}
 
-		// Initialize S3 storage
-		s3EndpointToUse := cfg.S3.Endpoint
-		if s3EndpointToUse == "" {
-			errorHandler.ValidationError("S3 endpoint", fmt.Errorf("S3 endpoint not specified"))
-			os.Exit(errorHandler.WaitForExit())
-		}
-		s3Timeout, err := cfg.S3.GetTimeout()
-		if err != nil {
-			errorHandler.ValidationError("S3 timeout", err)
-			os.Exit(errorHandler.WaitForExit())
-		}
-		logger.Info("Connecting to S3", "endpoint", s3EndpointToUse, "bucket", cfg.S3.Bucket, "timeout", s3Timeout)
-		deps.storage, err = storage.New(s3EndpointToUse, cfg.S3.AccessKey, cfg.S3.SecretKey, cfg.S3.Bucket, !cfg.S3.DisableTLS, cfg.S3.GetDebug(), s3Timeout)
+		var err error
+		deps.storage, err = storage.NewFromConfig(&cfg.S3, &cfg.Storage)
 		if err != nil {
-			errorHandler.FatalError(fmt.Sprintf("initialize S3 storage at endpoint '%s'", s3EndpointToUse), err)
+			errorHandler.FatalError(fmt.Sprintf("initialize %s storage", backend), err)
 			os.Exit(errorHandler.WaitForExit())
 		}
-
-		// Enable encryption if configured
-		if cfg.S3.Encrypt {
-			if err := deps.storage.EnableEncryption(cfg.S3.EncryptionKey); err != nil {
-				errorHandler.FatalError("enable S3 encryption", err)
-				os.Exit(errorHandler.WaitForExit())
-			}
-		}
 	}
 
 	// Initialize the resilient database with runtime failover (if needed)
@@ -717,6 +742,7 @@ func initializeServices(ctx context.Context, cfg config.Config, errorHandler *er
 
 		cleanupErrChan := make(chan error, 1)
 		deps.cleanupWorker = cleaner.New(deps.resilientDB, deps.storage, deps.cacheInstance, wakeInterval, gracePeriod, maxAgeRestriction, ftsRetention, healthStatusRetention, cleanupErrChan)
+		deps.cleanupWorker.SetTieringBatchSize(cfg.Storage.Tiering.GetBatchSize())
 
 		// Start error listener for cleanup worker
 		go func() {
@@ -921,6 +947,33 @@ func initializeServices(ctx context.Context, cfg config.Config, errorHandler *er
 		}
 	}
 
+	// Initialize the mailbox event stream if enabled
+	if cfg.Events.Enabled {
+		if deps.resilientDB == nil {
+			logger.Warn("Event stream enabled but no database is configured - events disabled")
+		} else {
+			initializeEvents(ctx, cfg.Events, deps, errorHandler)
+		}
+	}
+
+	// Initialize push-driven IDLE if enabled
+	if cfg.MailboxNotifications.Enabled {
+		if deps.resilientDB == nil {
+			logger.Warn("Mailbox notifications enabled but no database is configured - IDLE will poll")
+		} else {
+			fallback, err := cfg.MailboxNotifications.GetFallbackPollInterval()
+			if err != nil {
+				errorHandler.FatalError("parse mailbox_notifications fallback_poll_interval", err)
+				os.Exit(errorHandler.WaitForExit())
+			}
+			db.SetMailboxChangeNotifications(true)
+			deps.mailboxNotifier = server.NewMailboxNotifier()
+			deps.idleFallbackPollInterval = fallback
+			go deps.mailboxNotifier.Run(ctx, deps.resilientDB)
+			logger.Info("Mailbox notifications enabled", "fallback_poll_interval", fallback)
+		}
+	}
+
 	// Initialize cluster manager if enabled
 	if cfg.Cluster.Enabled {
 		logger.Info("Initializing cluster manager")
@@ -992,6 +1045,68 @@ func initializeServices(ctx context.Context, cfg config.Config, errorHandler *er
 	return deps, nil
 }
 
+// initializeEvents creates the event sinks and dispatcher and installs the
+// dispatcher as the default publisher.
+func initializeEvents(ctx context.Context, cfg config.EventsConfig, deps *serverDependencies, errorHandler *errors.ErrorHandler) {
+	var sinks []events.Sink
+
+	if cfg.File.Path != "" {
+		fileSink, err := events.NewFileSink(cfg.File.Path)
+		if err != nil {
+			errorHandler.FatalError("create event file sink", err)
+			os.Exit(errorHandler.WaitForExit())
+		}
+		deps.eventFile = fileSink
+		sinks = append(sinks, fileSink)
+	}
+
+	refresh, err := cfg.GetSubscriptionRefresh()
+	if err != nil {
+		errorHandler.FatalError("parse events subscription_refresh", err)
+		os.Exit(errorHandler.WaitForExit())
+	}
+	timeout, err := cfg.Webhook.GetTimeout()
+	if err != nil {
+		errorHandler.FatalError("parse events webhook timeout", err)
+		os.Exit(errorHandler.WaitForExit())
+	}
+	workerInterval, err := cfg.Webhook.GetWorkerInterval()
+	if err != nil {
+		errorHandler.FatalError("parse events webhook worker_interval", err)
+		os.Exit(errorHandler.WaitForExit())
+	}
+	backoff, err := cfg.Webhook.GetRetryBackoff()
+	if err != nil {
+		errorHandler.FatalError("parse events webhook retry_backoff", err)
+		os.Exit(errorHandler.WaitForExit())
+	}
+	failedRetention, err := cfg.Webhook.GetFailedRetention()
+	if err != nil {
+		errorHandler.FatalError("parse events webhook failed_retention", err)
+		os.Exit(errorHandler.WaitForExit())
+	}
+
+	queue, err := events.NewQueue(cfg.Webhook.GetQueuePath(), cfg.Webhook.GetMaxAttempts(), backoff)
+	if err != nil {
+		errorHandler.FatalError("create event webhook queue", err)
+		os.Exit(errorHandler.WaitForExit())
+	}
+	deps.eventWebhook = events.NewWebhookSink(deps.resilientDB, queue, events.WebhookConfig{
+		Timeout:         timeout,
+		Concurrency:     cfg.Webhook.GetConcurrency(),
+		WorkerInterval:  workerInterval,
+		RefreshInterval: refresh,
+		FailedRetention: failedRetention,
+	})
+	deps.eventWebhook.Start(ctx)
+	sinks = append(sinks, deps.eventWebhook)
+
+	deps.eventDispatcher = events.NewDispatcher(cfg.GetBufferSize(), deps.resilientDB, sinks...)
+	deps.eventDispatcher.Start(ctx)
+	events.SetDefault(deps.eventDispatcher)
+	logger.Info("Event stream enabled", "file", cfg.File.Path, "webhook_queue", cfg.Webhook.GetQueuePath())
+}
+
 // startServers starts all configured servers and returns an error channel for monitoring
 func startServers(ctx context.Context, deps *serverDependencies) chan error {
 	errChan := make(chan error, 1)
@@ -1064,6 +1179,14 @@ func startServers(ctx context.Context, deps *serverDependencies) chan error {
 			go startDynamicHTTPUserAPIServer(ctx, deps, server, errChan)
 		case "user_api_proxy":
 			go startDynamicUserAPIProxyServer(ctx, deps, server, errChan)
+		case "jmap":
+			go startDynamicJMAPServer(ctx, deps, server, errChan)
+		case "jmap_proxy":
+			go startDynamicJMAPProxyServer(ctx, deps, server, errChan)
+		case "submission":
+			go startDynamicSubmissionServer(ctx, deps, server, errChan)
+		case "submission_proxy":
+			go startDynamicSubmissionProxyServer(ctx, deps, server, errChan)
 		default:
 			logger.Info("Unknown server type - skipping", "type", server.Type, "name", server.Name)
 		}
@@ -1198,6 +1321,7 @@ func startDynamicIMAPServer(ctx context.Context, deps *serverDependencies, serve
 			TrustedNetworks:              deps.config.Servers.TrustedNetworks,
 			AuthRateLimit:                authRateLimit,
 			LookupCache:                  serverConfig.LookupCache,
+			OAuth:                        serverConfig.OAuth,
 			SearchRateLimitPerMin:        serverConfig.GetSearchRateLimitPerMin(),
 			SearchRateLimitWindow:        searchRateLimitWindow,
 			SessionMemoryLimit:           sessionMemoryLimit,
@@ -1220,6 +1344,8 @@ func startDynamicIMAPServer(ctx context.Context, deps *serverDependencies, serve
 			InsecureAuth:                 serverConfig.InsecureAuth || !serverConfig.TLS, // Default true when TLS not enabled (backend behind proxy)
 			Config:                       &deps.config,
 			SpamTraining:                 deps.spamTrainingClient,
+			MailboxNotifier:              deps.mailboxNotifier,
+			IdleFallbackPollInterval:     deps.idleFallbackPollInterval,
 		})
 	if err != nil {
 		errChan <- err
@@ -1276,25 +1402,27 @@ func startDynamicLMTPServer(ctx context.Context, deps *serverDependencies, serve
 	}
 
 	lmtpServer, err := lmtp.New(ctx, serverConfig.Name, deps.hostname, serverConfig.Addr, deps.storage, deps.resilientDB, deps.uploadWorker, lmtp.LMTPServerOptions{
-		RelayQueue:           deps.relayQueue,  // Global relay queue
-		RelayWorker:          deps.relayWorker, // Global relay worker for immediate processing
-		TLSVerify:            serverConfig.TLSVerify,
-		TLS:                  serverConfig.TLS,
-		TLSCertFile:          serverConfig.TLSCertFile,
-		TLSKeyFile:           serverConfig.TLSKeyFile,
-		TLSUseStartTLS:       serverConfig.TLSUseStartTLS,
-		TLSConfig:            tlsConfig,
-		Debug:                serverConfig.Debug,
-		MaxConnections:       serverConfig.MaxConnections,
-		MaxConnectionsPerIP:  serverConfig.MaxConnectionsPerIP,
-		ListenBacklog:        serverConfig.ListenBacklog,
-		ProxyProtocol:        serverConfig.ProxyProtocol,
-		ProxyProtocolTimeout: proxyProtocolTimeout,
-		TrustedNetworks:      deps.config.Servers.TrustedNetworks,
-		MaxMessageSize:       maxMessageSize,
-		FTSRetention:         deps.ftsRetention,
-		SieveExtensions:      deps.config.Sieve.EnabledExtensions,
-		InsecureAuth:         serverConfig.InsecureAuth || !serverConfig.TLS, // Default true when TLS not enabled (LMTP behind trusted network)
+		RelayQueue:            deps.relayQueue,  // Global relay queue
+		RelayWorker:           deps.relayWorker, // Global relay worker for immediate processing
+		TLSVerify:             serverConfig.TLSVerify,
+		TLS:                   serverConfig.TLS,
+		TLSCertFile:           serverConfig.TLSCertFile,
+		TLSKeyFile:            serverConfig.TLSKeyFile,
+		TLSUseStartTLS:        serverConfig.TLSUseStartTLS,
+		TLSConfig:             tlsConfig,
+		Debug:                 serverConfig.Debug,
+		MaxConnections:        serverConfig.MaxConnections,
+		MaxConnectionsPerIP:   serverConfig.MaxConnectionsPerIP,
+		ListenBacklog:         serverConfig.ListenBacklog,
+		ProxyProtocol:         serverConfig.ProxyProtocol,
+		ProxyProtocolTimeout:  proxyProtocolTimeout,
+		TrustedNetworks:       deps.config.Servers.TrustedNetworks,
+		MaxMessageSize:        maxMessageSize,
+		FTSRetention:          deps.ftsRetention,
+		SieveExtensions:       deps.config.Sieve.EnabledExtensions,
+		GlobalSieveExtensions: deps.config.Sieve.GlobalEnabledExtensions,
+		SieveFilterHeaders:    sieveFilterHeaders(deps.config.Sieve),
+		InsecureAuth:          serverConfig.InsecureAuth || !serverConfig.TLS, // Default true when TLS not enabled (LMTP behind trusted network)
 	})
 
 	if err != nil {
@@ -1315,6 +1443,18 @@ func startDynamicLMTPServer(ctx context.Context, deps *serverDependencies, serve
 	lmtpServer.Start(errChan)
 }
 
+// sieveFilterHeaders returns the spam and virus headers of the Sieve
+// spamtest and virustest extensions.
+func sieveFilterHeaders(cfg config.SieveConfig) *sieveengine.FilterHeaders {
+	return &sieveengine.FilterHeaders{
+		SpamHeader:   cfg.SpamTest.Header,
+		SpamMinScore: cfg.SpamTest.MinScore,
+		SpamMaxScore: cfg.SpamTest.MaxScore,
+		VirusHeader:  cfg.VirusTest.Header,
+		VirusValues:  cfg.VirusTest.Values,
+	}
+}
+
 func startDynamicPOP3Server(ctx context.Context, deps *serverDependencies, serverConfig config.ServerConfig, errChan chan error) {
 	deps.serverManager.Add()
 	defer deps.serverManager.Done()
@@ -1370,6 +1510,7 @@ func startDynamicPOP3Server(ctx context.Context, deps *serverDependencies, serve
 		TrustedNetworks:        deps.config.Servers.TrustedNetworks,
 		AuthRateLimit:          authRateLimit,
 		LookupCache:            serverConfig.LookupCache,
+		OAuth:                  serverConfig.OAuth,
 		SessionMemoryLimit:     sessionMemoryLimit,
 		AuthIdleTimeout:        authIdleTimeout,
 		CommandTimeout:         commandTimeout,
@@ -1462,6 +1603,7 @@ func startDynamicManageSieveServer(ctx context.Context, deps *serverDependencies
 		TLSConfig:              tlsConfig,
 		Debug:                  serverConfig.Debug,
 		MaxScriptSize:          maxSize,
+		MaxScripts:             serverConfig.MaxScripts,
 		SupportedExtensions:    deps.config.Sieve.EnabledExtensions,
 		MasterSASLUsername:     serverConfig.MasterSASLUsername,
 		MasterSASLPassword:     serverConfig.MasterSASLPassword,
@@ -1473,6 +1615,7 @@ func startDynamicManageSieveServer(ctx context.Context, deps *serverDependencies
 		TrustedNetworks:        deps.config.Servers.TrustedNetworks,
 		AuthRateLimit:          authRateLimit,
 		LookupCache:            serverConfig.LookupCache,
+		OAuth:                  serverConfig.OAuth,
 		AuthIdleTimeout:        authIdleTimeout,
 		CommandTimeout:         commandTimeout,
 		AbsoluteSessionTimeout: absoluteSessionTimeout,
@@ -1605,6 +1748,7 @@ func startDynamicIMAPProxyServer(ctx context.Context, deps *serverDependencies,
 		EnableBackendHealthCheck: serverConfig.GetRemoteHealthChecks(),
 		AuthRateLimit:            authRateLimit,
 		LookupCache:              serverConfig.LookupCache,
+		OAuth:                    serverConfig.OAuth,
 		RemoteLookup:             serverConfig.RemoteLookup,
 		TrustedProxies:           deps.config.Servers.TrustedNetworks,
 		MaxConnections:           serverConfig.MaxConnections,
@@ -1728,6 +1872,7 @@ func startDynamicPOP3ProxyServer(ctx context.Context, deps *serverDependencies,
 		EnableBackendHealthCheck: serverConfig.GetRemoteHealthChecks(),
 		AuthRateLimit:            authRateLimit,
 		RemoteLookup:             serverConfig.RemoteLookup,
+		OAuth:                    serverConfig.OAuth,
 		TrustedProxies:           deps.config.Servers.TrustedNetworks,
 		MaxConnections:           serverConfig.MaxConnections,
 		MaxConnectionsPerIP:      serverConfig.MaxConnectionsPerIP,
@@ -1848,6 +1993,7 @@ func startDynamicManageSieveProxyServer(ctx context.Context, deps *serverDepende
 		MinBytesPerMinute:        serverConfig.GetMinBytesPerMinute(),
 		AuthRateLimit:            authRateLimit,
 		RemoteLookup:             serverConfig.RemoteLookup,
+		OAuth:                    serverConfig.OAuth,
 		EnableAffinity:           serverConfig.EnableAffinity,
 		EnableBackendHealthCheck: serverConfig.GetRemoteHealthChecks(),
 		TrustedProxies:           deps.config.Servers.TrustedNetworks,
@@ -1857,6 +2003,7 @@ func startDynamicManageSieveProxyServer(ctx context.Context, deps *serverDepende
 		ListenBacklog:            serverConfig.ListenBacklog,
 		Debug:                    serverConfig.Debug,
 		SupportedExtensions:      serverConfig.SupportedExtensions,
+		MaxScriptSize:            serverConfig.GetMaxScriptSizeWithDefault(),
 		LookupCache:              serverConfig.LookupCache,
 		MaxAuthErrors:            serverConfig.GetMaxAuthErrors(),
 	})
@@ -2032,7 +2179,7 @@ func startDynamicHTTPAdminAPIServer(ctx context.Context, deps *serverDependencie
 	deps.serverManager.Add()
 	defer deps.serverManager.Done()
 
-	if serverConfig.APIKey == "" {
+	if serverConfig.APIKey == "" && len(serverConfig.APIKeys) == 0 {
 		logger.Info("HTTP Admin API server enabled but no API key configured - skipping", "name", serverConfig.Name)
 		return
 	}
@@ -2065,26 +2212,29 @@ func startDynamicHTTPAdminAPIServer(ctx context.Context, deps *serverDependencie
 	}
 
 	options := adminapi.ServerOptions{
-		Name:               serverConfig.Name,
-		Addr:               serverConfig.Addr,
-		APIKey:             serverConfig.APIKey,
-		AllowedHosts:       serverConfig.AllowedHosts,
-		Cache:              deps.cacheInstance,
-		Uploader:           deps.uploadWorker,
-		Storage:            deps.storage,
-		RelayQueue:         deps.relayQueue, // Global relay queue
-		TLS:                serverConfig.TLS,
-		TLSConfig:          tlsConfig, // From TLS manager (if available)
-		TLSCertFile:        serverConfig.TLSCertFile,
-		TLSKeyFile:         serverConfig.TLSKeyFile,
-		TLSVerify:          serverConfig.TLSVerify,
-		Hostname:           deps.hostname,
-		FTSRetention:       deps.ftsRetention,
-		AffinityManager:    deps.affinityManager,
-		ValidBackends:      validBackends,
-		ConnectionTrackers: deps.connectionTrackers,
-		ProxyServers:       deps.proxyServers,
-		AuthCache:          deps.authCacheInstance,
+		Name:                  serverConfig.Name,
+		Addr:                  serverConfig.Addr,
+		APIKey:                serverConfig.APIKey,
+		APIKeys:               serverConfig.APIKeys,
+		AllowedHosts:          serverConfig.AllowedHosts,
+		Cache:                 deps.cacheInstance,
+		Uploader:              deps.uploadWorker,
+		Storage:               deps.storage,
+		RelayQueue:            deps.relayQueue, // Global relay queue
+		TLS:                   serverConfig.TLS,
+		TLSConfig:             tlsConfig, // From TLS manager (if available)
+		TLSCertFile:           serverConfig.TLSCertFile,
+		TLSKeyFile:            serverConfig.TLSKeyFile,
+		TLSVerify:             serverConfig.TLSVerify,
+		Hostname:              deps.hostname,
+		FTSRetention:          deps.ftsRetention,
+		AffinityManager:       deps.affinityManager,
+		ValidBackends:         validBackends,
+		ConnectionTrackers:    deps.connectionTrackers,
+		ProxyServers:          deps.proxyServers,
+		AuthCache:             deps.authCacheInstance,
+		GlobalSieveExtensions: deps.config.Sieve.GlobalEnabledExtensions,
+		SieveFilterHeaders:    sieveFilterHeaders(deps.config.Sieve),
 	}
 
 	srv := adminapi.Start(ctx, deps.resilientDB, options, errChan)
@@ -2135,6 +2285,7 @@ func startDynamicHTTPUserAPIServer(ctx context.Context, deps *serverDependencies
 		TokenIssuer:    serverConfig.TokenIssuer,
 		AllowedOrigins: serverConfig.AllowedOrigins,
 		AllowedHosts:   serverConfig.AllowedHosts,
+		TOTPIssuer:     serverConfig.TOTPIssuer,
 		Storage:        deps.storage,
 		Cache:          deps.cacheInstance,
 		AuthRateLimit:  authRateLimit,
@@ -2144,6 +2295,17 @@ func startDynamicHTTPUserAPIServer(ctx context.Context, deps *serverDependencies
 		TLSCertFile:    serverConfig.TLSCertFile,
 		TLSKeyFile:     serverConfig.TLSKeyFile,
 		TLSVerify:      serverConfig.TLSVerify,
+		MaxScriptSize:  serverConfig.GetMaxScriptSizeWithDefault(),
+		MaxScripts:     serverConfig.MaxScripts,
+
+		SupportedExtensions: deps.config.Sieve.EnabledExtensions,
+		ConnectionTrackers:  deps.connectionTrackers,
+
+		Uploader:       deps.uploadWorker,
+		Hostname:       deps.hostname,
+		FTSRetention:   deps.ftsRetention,
+		MaxImportSize:  serverConfig.GetMaxImportSizeWithDefault(),
+		MaxMessageSize: serverConfig.GetMaxMessageSizeWithDefault(),
 	}
 
 	srv := mailapi.Start(ctx, deps.resilientDB, options, errChan)
@@ -2223,9 +2385,353 @@ func startDynamicUserAPIProxyServer(ctx context.Context, deps *serverDependencie
 	}
 }
 
+func startDynamicJMAPServer(ctx context.Context, deps *serverDependencies, serverConfig config.ServerConfig, errChan chan error) {
+	deps.serverManager.Add()
+	defer deps.serverManager.Done()
+
+	maxSizeUpload, err := serverConfig.JMAP.GetMaxSizeUpload()
+	if err != nil {
+		errChan <- fmt.Errorf("invalid jmap.max_size_upload for JMAP server %s: %w", serverConfig.Name, err)
+		return
+	}
+	maxSizeRequest, err := serverConfig.JMAP.GetMaxSizeRequest()
+	if err != nil {
+		errChan <- fmt.Errorf("invalid jmap.max_size_request for JMAP server %s: %w", serverConfig.Name, err)
+		return
+	}
+	pollInterval, err := serverConfig.JMAP.GetEventSourcePollInterval()
+	if err != nil {
+		errChan <- fmt.Errorf("invalid jmap.eventsource_poll_interval for JMAP server %s: %w", serverConfig.Name, err)
+		return
+	}
+
+	limits := jmap.Limits{
+		MaxSizeUpload:  maxSizeUpload,
+		MaxSizeRequest: maxSizeRequest,
+	}
+	var baseURL string
+	if serverConfig.JMAP != nil {
+		baseURL = serverConfig.JMAP.BaseURL
+		limits.MaxCallsInRequest = serverConfig.JMAP.MaxCallsInRequest
+		limits.MaxObjectsInGet = serverConfig.JMAP.MaxObjectsInGet
+		limits.MaxObjectsInSet = serverConfig.JMAP.MaxObjectsInSet
+	}
+
+	// Get auth rate limit config
+	authRateLimit := server.DefaultAuthRateLimiterConfig()
+	if serverConfig.AuthRateLimit != nil {
+		authRateLimit = *serverConfig.AuthRateLimit
+	}
+
+	// Get TLS config from manager if TLS is enabled
+	var tlsConfig *tls.Config
+	if serverConfig.TLS && deps.tlsManager != nil {
+		tlsConfig = deps.tlsManager.GetTLSConfig()
+		if serverConfig.TLSDefaultDomain != "" {
+			tlsConfig = tlsmanager.WrapTLSConfigWithDefaultDomain(tlsConfig, serverConfig.TLSDefaultDomain)
+		}
+	}
+
+	options := jmap.ServerOptions{
+		Name:                    serverConfig.Name,
+		Addr:                    serverConfig.Addr,
+		Hostname:                deps.hostname,
+		BaseURL:                 baseURL,
+		JWTSecret:               serverConfig.JWTSecret,
+		AllowedOrigins:          serverConfig.AllowedOrigins,
+		AllowedHosts:            serverConfig.AllowedHosts,
+		Limits:                  limits,
+		EventSourcePollInterval: pollInterval,
+		FTSRetention:            deps.ftsRetention,
+		Storage:                 deps.storage,
+		Cache:                   deps.cacheInstance,
+		Uploader:                deps.uploadWorker,
+		AuthRateLimit:           authRateLimit,
+		LookupCache:             serverConfig.LookupCache,
+		TLS:                     serverConfig.TLS,
+		TLSConfig:               tlsConfig, // From TLS manager (if available)
+		TLSCertFile:             serverConfig.TLSCertFile,
+		TLSKeyFile:              serverConfig.TLSKeyFile,
+		TLSVerify:               serverConfig.TLSVerify,
+	}
+
+	srv := jmap.Start(ctx, deps.resilientDB, options, errChan)
+	if srv != nil {
+		deps.registerServer(serverConfig.Name, srv)
+	}
+}
+
+func startDynamicJMAPProxyServer(ctx context.Context, deps *serverDependencies, serverConfig config.ServerConfig, errChan chan error) {
+	deps.serverManager.Add()
+	defer deps.serverManager.Done()
+
+	connectTimeout := serverConfig.GetConnectTimeoutWithDefault()
+
+	remotePort, err := serverConfig.GetRemotePort()
+	if err != nil {
+		errChan <- fmt.Errorf("invalid remote_port for JMAP proxy %s: %w", serverConfig.Name, err)
+		return
+	}
+
+	// Get global TLS config if available
+	var tlsConfig *tls.Config
+	if deps.tlsManager != nil {
+		tlsConfig = deps.tlsManager.GetTLSConfig()
+		// Wrap with server-specific default domain if specified
+		tlsConfig = tlsmanager.WrapTLSConfigWithDefaultDomain(tlsConfig, serverConfig.TLSDefaultDomain)
+	}
+
+	server, err := userapiproxy.New(ctx, deps.resilientDB, userapiproxy.ServerOptions{
+		Name:                     serverConfig.Name,
+		Addr:                     serverConfig.Addr,
+		Protocol:                 "jmap",
+		RemoteAddrs:              serverConfig.RemoteAddrs,
+		RemotePort:               remotePort,
+		JWTSecret:                serverConfig.JWTSecret, // Optional: routes bearer-token requests by their claims
+		TLS:                      serverConfig.TLS,
+		TLSCertFile:              serverConfig.TLSCertFile,
+		TLSKeyFile:               serverConfig.TLSKeyFile,
+		TLSVerify:                serverConfig.TLSVerify,
+		TLSConfig:                tlsConfig,
+		RemoteTLS:                serverConfig.RemoteTLS,
+		RemoteTLSVerify:          serverConfig.RemoteTLSVerify,
+		ConnectTimeout:           connectTimeout,
+		EnableBackendHealthCheck: serverConfig.GetRemoteHealthChecks(),
+		MaxConnections:           serverConfig.MaxConnections,
+		MaxConnectionsPerIP:      serverConfig.MaxConnectionsPerIP,
+		TrustedNetworks:          deps.config.Servers.TrustedNetworks,
+		TrustedProxies:           deps.config.Servers.TrustedNetworks,
+		RemoteLookup:             serverConfig.RemoteLookup,
+		LookupCache:              serverConfig.LookupCache,
+		AffinityManager:          deps.affinityManager,
+	})
+	if err != nil {
+		errChan <- fmt.Errorf("failed to create JMAP proxy server: %w", err)
+		return
+	}
+
+	// Register proxy server for backend health monitoring via Admin API
+	deps.proxyServersMux.Lock()
+	deps.proxyServers["JMAP-"+serverConfig.Name] = server
+	deps.proxyServersMux.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		logger.Info("Shutting down JMAP proxy server", "name", serverConfig.Name)
+		server.Stop()
+	}()
+
+	deps.registerServer(serverConfig.Name, server)
+
+	if err := server.Start(); err != nil && ctx.Err() == nil {
+		errChan <- fmt.Errorf("JMAP proxy server error: %w", err)
+	}
+}
+
 // serverLogger implements delivery.Logger interface using the global logger
 type serverLogger struct{}
 
 func (l *serverLogger) Log(format string, args ...any) {
 	logger.Info(fmt.Sprintf(format, args...))
 }
+
+func startDynamicSubmissionServer(ctx context.Context, deps *serverDependencies, serverConfig config.ServerConfig, errChan chan error) {
+	deps.serverManager.Add()
+	defer deps.serverManager.Done()
+
+	// Submitted messages are sent through the relay queue, which only exists
+	// when [relay] is configured.
+	if deps.relayQueue == nil {
+		errChan <- fmt.Errorf("submission server %s requires a configured relay queue", serverConfig.Name)
+		return
+	}
+	var relayWorker submission.RelayWorkerNotifier
+	if deps.relayWorker != nil {
+		relayWorker = deps.relayWorker
+	}
+
+	authRateLimit := server.DefaultAuthRateLimiterConfig()
+	if serverConfig.AuthRateLimit != nil {
+		authRateLimit = *serverConfig.AuthRateLimit
+	}
+
+	maxMessageSize, err := serverConfig.GetMaxMessageSize()
+	if err != nil {
+		logger.Info("Submission: Invalid max_message_size - using default (50MB)", "name", serverConfig.Name, "error", err)
+		maxMessageSize = 50 * 1024 * 1024
+	}
+
+	// Get global TLS config if available and wrap with server-specific default domain
+	var tlsConfig *tls.Config
+	if deps.tlsManager != nil {
+		tlsConfig = deps.tlsManager.GetTLSConfig()
+		tlsConfig = tlsmanager.WrapTLSConfigWithDefaultDomain(tlsConfig, serverConfig.TLSDefaultDomain)
+	}
+
+	s, err := submission.New(ctx, serverConfig.Name, deps.hostname, serverConfig.Addr, deps.resilientDB, deps.uploadWorker, submission.SubmissionServerOptions{
+		RelayQueue:           deps.relayQueue,
+		RelayWorker:          relayWorker,
+		Debug:                serverConfig.Debug,
+		TLS:                  serverConfig.TLS,
+		TLSCertFile:          serverConfig.TLSCertFile,
+		TLSKeyFile:           serverConfig.TLSKeyFile,
+		TLSVerify:            serverConfig.TLSVerify,
+		TLSUseStartTLS:       serverConfig.TLSUseStartTLS,
+		TLSConfig:            tlsConfig,
+		MasterSASLUsername:   serverConfig.MasterSASLUsername,
+		MasterSASLPassword:   serverConfig.MasterSASLPassword,
+		AuthRateLimit:        authRateLimit,
+		LookupCache:          serverConfig.LookupCache,
+		MaxConnections:       serverConfig.MaxConnections,
+		MaxConnectionsPerIP:  serverConfig.MaxConnectionsPerIP,
+		ListenBacklog:        serverConfig.ListenBacklog,
+		ProxyProtocol:        serverConfig.ProxyProtocol,
+		ProxyProtocolTimeout: serverConfig.GetProxyProtocolTimeoutWithDefault(),
+		TrustedNetworks:      deps.config.Servers.TrustedNetworks,
+		FTSRetention:         deps.ftsRetention,
+		MaxMessageSize:       maxMessageSize,
+		MaxRecipients:        serverConfig.Submission.GetMaxRecipients(),
+		SaveSent:             serverConfig.Submission != nil && serverConfig.Submission.SaveSent,
+		SentMailbox:          serverConfig.Submission.GetSentMailbox(),
+		InsecureAuth:         serverConfig.InsecureAuth || !serverConfig.TLS, // Default true when TLS not enabled (backend behind proxy)
+	})
+	if err != nil {
+		errChan <- fmt.Errorf("failed to create submission server: %w", err)
+		return
+	}
+
+	go func() {
+		<-ctx.Done()
+		logger.Info("Shutting down submission server", "name", serverConfig.Name)
+		if err := s.Close(); err != nil {
+			logger.Info("Error closing submission server", "error", err)
+		}
+	}()
+
+	deps.registerServer(serverConfig.Name, s)
+
+	s.Start(errChan)
+}
+
+func startDynamicSubmissionProxyServer(ctx context.Context, deps *serverDependencies, serverConfig config.ServerConfig, errChan chan error) {
+	deps.serverManager.Add()
+	defer deps.serverManager.Done()
+
+	authRateLimit := server.DefaultAuthRateLimiterConfig()
+	if serverConfig.AuthRateLimit != nil {
+		authRateLimit = *serverConfig.AuthRateLimit
+	}
+
+	remotePort, err := serverConfig.GetRemotePort()
+	if err != nil {
+		errChan <- fmt.Errorf("invalid remote_port for submission proxy %s: %w", serverConfig.Name, err)
+		return
+	}
+
+	commandTimeout, err := serverConfig.GetCommandTimeout()
+	if err != nil {
+		logger.Info("Submission proxy: Invalid command timeout - using default (0 = disabled)", "name", serverConfig.Name, "error", err)
+		commandTimeout = 0 // Proxies should use auth_idle_timeout and absolute_session_timeout
+	}
+
+	absoluteSessionTimeout, err := serverConfig.GetAbsoluteSessionTimeout()
+	if err != nil {
+		logger.Info("Submission proxy: Invalid absolute session timeout - using default (30 minutes)", "name", serverConfig.Name, "error", err)
+		absoluteSessionTimeout = 30 * time.Minute
+	}
+
+	// Get global TLS config if available and wrap with server-specific default domain
+	var tlsConfig *tls.Config
+	if deps.tlsManager != nil {
+		tlsConfig = deps.tlsManager.GetTLSConfig()
+		tlsConfig = tlsmanager.WrapTLSConfigWithDefaultDomain(tlsConfig, serverConfig.TLSDefaultDomain)
+	}
+
+	server, err := submissionproxy.New(ctx, deps.resilientDB, deps.hostname, submissionproxy.ServerOptions{
+		Name:                     serverConfig.Name,
+		Addr:                     serverConfig.Addr,
+		RemoteAddrs:              serverConfig.RemoteAddrs,
+		RemotePort:               remotePort,
+		InsecureAuth:             serverConfig.InsecureAuth || !serverConfig.TLS,
+		TLS:                      serverConfig.TLS,
+		TLSUseStartTLS:           serverConfig.TLSUseStartTLS,
+		TLSCertFile:              serverConfig.TLSCertFile,
+		TLSKeyFile:               serverConfig.TLSKeyFile,
+		TLSVerify:                serverConfig.TLSVerify,
+		TLSConfig:                tlsConfig,
+		RemoteTLS:                serverConfig.RemoteTLS,
+		RemoteTLSUseStartTLS:     serverConfig.RemoteTLSUseStartTLS,
+		RemoteTLSVerify:          serverConfig.RemoteTLSVerify,
+		RemoteUseProxyProtocol:   serverConfig.RemoteUseProxyProtocol,
+		RemoteUseXCLIENT:         serverConfig.RemoteUseXCLIENT,
+		MasterUsername:           serverConfig.MasterUsername,
+		MasterPassword:           serverConfig.MasterPassword,
+		MasterSASLUsername:       serverConfig.MasterSASLUsername,
+		MasterSASLPassword:       serverConfig.MasterSASLPassword,
+		ConnectTimeout:           serverConfig.GetConnectTimeoutWithDefault(),
+		AuthIdleTimeout:          serverConfig.GetAuthIdleTimeoutWithDefault(),
+		CommandTimeout:           commandTimeout,
+		AbsoluteSessionTimeout:   absoluteSessionTimeout,
+		MinBytesPerMinute:        serverConfig.GetMinBytesPerMinute(),
+		MaxMessageSize:           serverConfig.GetMaxMessageSizeWithDefault(),
+		EnableAffinity:           serverConfig.EnableAffinity,
+		EnableBackendHealthCheck: serverConfig.GetRemoteHealthChecks(),
+		AuthRateLimit:            authRateLimit,
+		RemoteLookup:             serverConfig.RemoteLookup,
+		TrustedProxies:           deps.config.Servers.TrustedNetworks,
+		ProxyProtocol:            serverConfig.ProxyProtocol,
+		ProxyProtocolTimeout:     serverConfig.GetProxyProtocolTimeoutWithDefault(),
+		MaxConnections:           serverConfig.MaxConnections,
+		MaxConnectionsPerIP:      serverConfig.MaxConnectionsPerIP,
+		TrustedNetworks:          deps.config.Servers.TrustedNetworks,
+		ListenBacklog:            serverConfig.ListenBacklog,
+		LookupCache:              serverConfig.LookupCache,
+		MaxAuthErrors:            serverConfig.GetMaxAuthErrors(),
+		Debug:                    serverConfig.Debug,
+	})
+	if err != nil {
+		errChan <- fmt.Errorf("failed to create submission proxy server: %w", err)
+		return
+	}
+
+	// Set affinity manager on connection manager if cluster is enabled
+	if connMgr := server.GetConnectionManager(); connMgr != nil {
+		if deps.affinityManager != nil {
+			connMgr.SetAffinityManager(deps.affinityManager)
+			logger.Info("Submission Proxy: Affinity manager attached to connection manager", "name", serverConfig.Name)
+		}
+
+		// Register remotelookup health check if remotelookup is enabled
+		if routingLookup := connMgr.GetRoutingLookup(); routingLookup != nil {
+			if healthChecker, ok := routingLookup.(health.RemoteLookupHealthChecker); ok {
+				deps.healthIntegration.RegisterRemoteLookupCheck(healthChecker, serverConfig.Name)
+				logger.Info("Registered remotelookup health check for submission proxy", "name", serverConfig.Name)
+			}
+		}
+	}
+
+	// Start connection tracker if enabled.
+	if tracker, mapKey := startConnectionTrackerForProxy("Submission", serverConfig.Name, deps.hostname, serverConfig.MaxConnectionsPerUser, serverConfig.MaxConnectionsPerUserPerIP, deps.clusterManager, &deps.config.Cluster, server); tracker != nil {
+		defer tracker.Stop()
+		deps.connectionTrackersMux.Lock()
+		deps.connectionTrackers[mapKey] = tracker
+		deps.connectionTrackersMux.Unlock()
+	}
+
+	// Register proxy server for backend health monitoring via Admin API
+	deps.proxyServersMux.Lock()
+	deps.proxyServers["Submission-"+serverConfig.Name] = server
+	deps.proxyServersMux.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		logger.Info("Shutting down submission proxy server", "name", serverConfig.Name)
+		server.Stop()
+	}()
+
+	deps.registerServer(serverConfig.Name, server)
+
+	if err := server.Start(); err != nil && ctx.Err() == nil {
+		errChan <- fmt.Errorf("submission proxy server error: %w", err)
+	}
+}
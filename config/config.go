@@ -134,6 +134,13 @@ type S3Config struct {
 	Timeout       string `toml:"timeout"` // Timeout for individual S3 operations (default: 30s)
 	Encrypt       bool   `toml:"encrypt"`
 	EncryptionKey string `toml:"encryption_key"`
+
+	// Key ring: versioned master keys (key id -> hex key). When set, new objects
+	// are encrypted with EncryptionKeyID and EncryptionKey is only used to read
+	// objects written before the key ring was configured.
+	EncryptionKeys     map[string]string `toml:"encryption_keys"`
+	EncryptionKeyID    string            `toml:"encryption_key_id"`    // Active master key ID (optional with a single key)
+	EncryptionKeyScope string            `toml:"encryption_key_scope"` // Data key scope: "global" (default), "domain" or "account"
 }
 
 // GetDebug returns the debug flag
@@ -149,6 +156,48 @@ func (s *S3Config) GetTimeout() (time.Duration, error) {
 	return helpers.ParseDuration(s.Timeout)
 }
 
+// StorageConfig selects the blob backend used for message bodies.
+type StorageConfig struct {
+	Backend string               `toml:"backend"` // "s3" (default) or "filesystem"
+	Path    string               `toml:"path"`    // Root directory for the filesystem backend
+	Tiering StorageTieringConfig `toml:"tiering"`
+}
+
+// GetBackend returns the configured backend, defaulting to "s3".
+func (s *StorageConfig) GetBackend() string {
+	if s.Backend == "" {
+		return "s3"
+	}
+	return strings.ToLower(s.Backend)
+}
+
+// StorageTieringConfig moves old message bodies to a second bucket or a
+// cheaper storage class. The cold tier uses the [s3] endpoint, credentials
+// and encryption settings.
+type StorageTieringConfig struct {
+	Enabled      bool   `toml:"enabled"`
+	After        string `toml:"after"`         // Move objects older than this to the cold tier (default: 90d)
+	Bucket       string `toml:"bucket"`        // Cold bucket (default: the [s3] bucket, which requires storage_class)
+	StorageClass string `toml:"storage_class"` // S3 storage class for cold objects, e.g. "STANDARD_IA" or "GLACIER_IR"
+	BatchSize    int    `toml:"batch_size"`    // Objects scanned per cleanup cycle (default: 10000)
+}
+
+// GetAfter parses the age after which objects are moved to the cold tier
+func (t *StorageTieringConfig) GetAfter() (time.Duration, error) {
+	if t.After == "" {
+		return 90 * 24 * time.Hour, nil
+	}
+	return helpers.ParseDuration(t.After)
+}
+
+// GetBatchSize returns the number of objects scanned per cleanup cycle
+func (t *StorageTieringConfig) GetBatchSize() int {
+	if t.BatchSize <= 0 {
+		return 10000
+	}
+	return t.BatchSize
+}
+
 // ClusterRateLimitSyncConfig holds configuration for cluster-wide auth rate limiting
 type ClusterRateLimitSyncConfig struct {
 	Enabled           bool `toml:"enabled"`             // Enable cluster-wide rate limiting (default: true if cluster enabled)
@@ -524,6 +573,49 @@ func (c *LookupCacheConfig) GetPositiveRevalidationWindow() (time.Duration, erro
 	return time.ParseDuration(c.PositiveRevalidationWindow)
 }
 
+// OAuthConfig holds configuration for OAUTHBEARER/XOAUTH2 SASL authentication.
+// Tokens are validated either as JWTs against a JWKS (jwks_url or jwks_file)
+// or with an RFC 7662 token introspection endpoint.
+type OAuthConfig struct {
+	Enabled             bool   `toml:"enabled"`
+	JWKSURL             string `toml:"jwks_url"`              // URL of the JSON Web Key Set used to verify JWT signatures
+	JWKSFile            string `toml:"jwks_file"`             // Local JSON Web Key Set file (alternative to jwks_url)
+	JWKSRefreshInterval string `toml:"jwks_refresh_interval"` // How often the key set is reloaded (default: "1h")
+	Issuer              string `toml:"issuer"`                // Required "iss" claim (optional)
+	Audience            string `toml:"audience"`              // Required "aud" claim (optional)
+	UsernameClaim       string `toml:"username_claim"`        // Claim holding the user's email address (default: "email")
+
+	IntrospectionURL          string `toml:"introspection_url"`           // RFC 7662 token introspection endpoint
+	IntrospectionClientID     string `toml:"introspection_client_id"`     // Client credentials for the introspection endpoint
+	IntrospectionClientSecret string `toml:"introspection_client_secret"` // Client credentials for the introspection endpoint
+
+	Timeout string `toml:"timeout"` // HTTP timeout for JWKS and introspection requests (default: "5s")
+}
+
+// GetJWKSRefreshInterval returns how often the key set is reloaded
+func (c *OAuthConfig) GetJWKSRefreshInterval() (time.Duration, error) {
+	if c.JWKSRefreshInterval == "" {
+		return time.Hour, nil
+	}
+	return helpers.ParseDuration(c.JWKSRefreshInterval)
+}
+
+// GetUsernameClaim returns the claim that maps a token to an account
+func (c *OAuthConfig) GetUsernameClaim() string {
+	if c.UsernameClaim == "" {
+		return "email"
+	}
+	return c.UsernameClaim
+}
+
+// GetTimeout returns the HTTP timeout for JWKS and introspection requests
+func (c *OAuthConfig) GetTimeout() (time.Duration, error) {
+	if c.Timeout == "" {
+		return 5 * time.Second, nil
+	}
+	return helpers.ParseDuration(c.Timeout)
+}
+
 // RemoteLookupConfig holds configuration for HTTP-based user routing
 type RemoteLookupConfig struct {
 	Enabled   bool   `toml:"enabled"`
@@ -1192,6 +1284,14 @@ type HTTPAPIConfig struct {
 	TLSVerify    bool     `toml:"tls_verify"` // Verify client certificates (mutual TLS)
 }
 
+// AdminAPIKeyConfig is a named admin API key with the scopes it grants
+type AdminAPIKeyConfig struct {
+	Name    string   `toml:"name"`
+	Key     string   `toml:"key"`
+	Scopes  []string `toml:"scopes"`            // admin, read-only, accounts, connections, cache, acl, mail-delivery
+	Domains []string `toml:"domains,omitempty"` // If empty, the key may act on any domain
+}
+
 // UserAPIServerConfig holds User API server configuration
 type UserAPIServerConfig struct {
 	Start          bool     `toml:"start"`
@@ -1252,6 +1352,64 @@ type ServerTimeoutsConfig struct {
 	SchedulerShardCount    int    `toml:"scheduler_shard_count,omitempty"`    // Number of timeout scheduler shards (default: 0 = runtime.NumCPU(), -1 = runtime.NumCPU()/2 for physical cores)
 }
 
+// JMAPConfig holds settings for servers of type "jmap" (RFC 8620/8621)
+type JMAPConfig struct {
+	BaseURL                 string `toml:"base_url,omitempty"`                  // Public URL advertised in the session resource (default: derived from the request)
+	MaxSizeUpload           string `toml:"max_size_upload,omitempty"`           // Maximum blob upload size (default: 50mb)
+	MaxSizeRequest          string `toml:"max_size_request,omitempty"`          // Maximum API request size (default: 10mb)
+	MaxCallsInRequest       int    `toml:"max_calls_in_request,omitempty"`      // Maximum method calls per API request (default: 16)
+	MaxObjectsInGet         int    `toml:"max_objects_in_get,omitempty"`        // Maximum ids per /get call (default: 500)
+	MaxObjectsInSet         int    `toml:"max_objects_in_set,omitempty"`        // Maximum creates/updates/destroys per /set call (default: 500)
+	EventSourcePollInterval string `toml:"eventsource_poll_interval,omitempty"` // How often EventSource connections check for changes (default: 5s)
+}
+
+// GetMaxSizeUpload returns the maximum blob upload size in bytes
+func (c *JMAPConfig) GetMaxSizeUpload() (int64, error) {
+	if c == nil || c.MaxSizeUpload == "" {
+		return 50 * 1024 * 1024, nil
+	}
+	return helpers.ParseSize(c.MaxSizeUpload)
+}
+
+// GetMaxSizeRequest returns the maximum API request size in bytes
+func (c *JMAPConfig) GetMaxSizeRequest() (int64, error) {
+	if c == nil || c.MaxSizeRequest == "" {
+		return 10 * 1024 * 1024, nil
+	}
+	return helpers.ParseSize(c.MaxSizeRequest)
+}
+
+// GetEventSourcePollInterval returns how often EventSource connections poll for state changes
+func (c *JMAPConfig) GetEventSourcePollInterval() (time.Duration, error) {
+	if c == nil || c.EventSourcePollInterval == "" {
+		return 5 * time.Second, nil
+	}
+	return time.ParseDuration(c.EventSourcePollInterval)
+}
+
+// SubmissionConfig holds settings for servers of type "submission" (RFC 6409)
+type SubmissionConfig struct {
+	SaveSent      bool   `toml:"save_sent,omitempty"`      // Store a copy of every submitted message in the sender's Sent mailbox (default: false)
+	SentMailbox   string `toml:"sent_mailbox,omitempty"`   // Name of the mailbox used for saved copies (default: "Sent")
+	MaxRecipients int    `toml:"max_recipients,omitempty"` // Maximum RCPT TO commands per message (default: 100)
+}
+
+// GetSentMailbox returns the mailbox name used for saved copies
+func (c *SubmissionConfig) GetSentMailbox() string {
+	if c == nil || c.SentMailbox == "" {
+		return "Sent"
+	}
+	return c.SentMailbox
+}
+
+// GetMaxRecipients returns the maximum number of recipients per message
+func (c *SubmissionConfig) GetMaxRecipients() int {
+	if c == nil || c.MaxRecipients <= 0 {
+		return 100
+	}
+	return c.MaxRecipients
+}
+
 // ServerConfig represents a single server instance
 type ServerConfig struct {
 	Type string `toml:"type"`
@@ -1291,8 +1449,9 @@ type ServerConfig struct {
 	// Auth security
 	InsecureAuth bool `toml:"insecure_auth,omitempty"` // Allow PLAIN auth over non-TLS connections (default: false for ManageSieve, true for IMAP/LMTP behind proxy)
 
-	// ManageSieve specific
+	// ManageSieve specific (max_script_size and max_scripts also apply to the HTTP user API)
 	MaxScriptSize       string   `toml:"max_script_size,omitempty"`
+	MaxScripts          int      `toml:"max_scripts,omitempty"`          // Maximum number of Sieve scripts per account (0 = unlimited)
 	SupportedExtensions []string `toml:"supported_extensions,omitempty"` // List of supported Sieve extensions (additional to builtins)
 
 	// Proxy specific
@@ -1312,14 +1471,17 @@ type ServerConfig struct {
 	AffinityValidity       string   `toml:"affinity_validity,omitempty"`
 
 	// HTTP API specific
-	APIKey       string   `toml:"api_key,omitempty"`
-	AllowedHosts []string `toml:"allowed_hosts,omitempty"`
+	APIKey       string              `toml:"api_key,omitempty"`  // Key with the admin scope
+	APIKeys      []AdminAPIKeyConfig `toml:"api_keys,omitempty"` // Named keys with restricted scopes
+	AllowedHosts []string            `toml:"allowed_hosts,omitempty"`
 
 	// Mail HTTP API specific (stateless JWT-based authentication)
 	JWTSecret      string   `toml:"jwt_secret,omitempty"`      // Secret key for signing JWT tokens
 	TokenDuration  string   `toml:"token_duration,omitempty"`  // Token validity duration (e.g., "24h", "7d")
 	TokenIssuer    string   `toml:"token_issuer,omitempty"`    // JWT issuer field
 	AllowedOrigins []string `toml:"allowed_origins,omitempty"` // CORS allowed origins for web clients
+	TOTPIssuer     string   `toml:"totp_issuer,omitempty"`     // Issuer shown in authenticator apps (default: Sora)
+	MaxImportSize  string   `toml:"max_import_size,omitempty"` // Maximum size of an uploaded mbox file or zip archive (default: 1gb)
 
 	// Metrics specific
 	Path                 string `toml:"path,omitempty"`
@@ -1344,6 +1506,15 @@ type ServerConfig struct {
 	// Pre-lookup (embedded)
 	RemoteLookup *RemoteLookupConfig `toml:"remote_lookup,omitempty"`
 
+	// OAUTHBEARER/XOAUTH2 token validation (embedded)
+	OAuth *OAuthConfig `toml:"oauth,omitempty"`
+
+	// JMAP specific (embedded)
+	JMAP *JMAPConfig `toml:"jmap,omitempty"`
+
+	// Submission specific (embedded)
+	Submission *SubmissionConfig `toml:"submission,omitempty"`
+
 	// Client capability filtering (IMAP specific)
 	ClientFilters []ClientCapabilityFilter `toml:"client_filters,omitempty"`
 	DisabledCaps  []string                 `toml:"disabled_caps,omitempty"` // Globally disabled capabilities (IMAP specific)
@@ -1417,7 +1588,25 @@ type AdminCLIConfig struct {
 
 // SieveConfig holds Sieve script engine configuration
 type SieveConfig struct {
-	EnabledExtensions []string `toml:"enabled_extensions"` // List of enabled Sieve extensions (empty = all extensions enabled)
+	EnabledExtensions       []string             `toml:"enabled_extensions"`        // List of enabled Sieve extensions (empty = all extensions enabled)
+	GlobalEnabledExtensions []string             `toml:"global_enabled_extensions"` // Extensions of global before/after scripts (empty = all except vacation)
+	SpamTest                SieveSpamTestConfig  `toml:"spamtest"`                  // Spam score header of the spamtest extension
+	VirusTest               SieveVirusTestConfig `toml:"virustest"`                 // Virus status header of the virustest extension
+}
+
+// SieveSpamTestConfig maps the spam score header added by the upstream spam
+// filter to the results of the Sieve spamtest extension (RFC 5235).
+type SieveSpamTestConfig struct {
+	Header   string  `toml:"header"`    // Header with the spam score (default: "X-Spam-Score")
+	MinScore float64 `toml:"min_score"` // Score of a message that is certainly not spam (default: 0)
+	MaxScore float64 `toml:"max_score"` // Score of a message that is certainly spam (default: min_score + 10)
+}
+
+// SieveVirusTestConfig maps the virus status header added by the upstream
+// virus scanner to the results of the Sieve virustest extension (RFC 5235).
+type SieveVirusTestConfig struct {
+	Header string         `toml:"header"` // Header with the scan result (default: "X-Virus-Status")
+	Values map[string]int `toml:"values"` // Start of header values to results 1 (clean) to 5 (default: clean = 1, infected = 5)
 }
 
 // AuthCacheConfig holds persistent authentication cache configuration.
@@ -1457,23 +1646,26 @@ func (a *AuthCacheConfig) GetPurgeUnused() (time.Duration, error) {
 
 // Config holds all configuration for the application.
 type Config struct {
-	Logging          LoggingConfig          `toml:"logging"`
-	Database         DatabaseConfig         `toml:"database"`
-	S3               S3Config               `toml:"s3"`
-	TLS              TLSConfig              `toml:"tls"`
-	Cluster          ClusterConfig          `toml:"cluster"`
-	LocalCache       LocalCacheConfig       `toml:"local_cache"`
-	AuthCache        AuthCacheConfig        `toml:"auth_cache"` // Persistent auth cache configuration
-	Cleanup          CleanupConfig          `toml:"cleanup"`
-	Servers          ServersConfig          `toml:"servers"`
-	Uploader         UploaderConfig         `toml:"uploader"`
-	Metadata         MetadataConfig         `toml:"metadata"`
-	SharedMailboxes  SharedMailboxesConfig  `toml:"shared_mailboxes"`
-	Sieve            SieveConfig            `toml:"sieve"`
-	Relay            RelayConfig            `toml:"relay"`
-	SpamTraining     SpamTrainingConfig     `toml:"spam_training"`     // Spam filter training configuration
-	AdminCLI         AdminCLIConfig         `toml:"admin_cli"`         // Admin CLI tool configuration
-	TimeoutScheduler TimeoutSchedulerConfig `toml:"timeout_scheduler"` // Global timeout scheduler configuration
+	Logging              LoggingConfig              `toml:"logging"`
+	Database             DatabaseConfig             `toml:"database"`
+	S3                   S3Config                   `toml:"s3"`
+	Storage              StorageConfig              `toml:"storage"`
+	TLS                  TLSConfig                  `toml:"tls"`
+	Cluster              ClusterConfig              `toml:"cluster"`
+	LocalCache           LocalCacheConfig           `toml:"local_cache"`
+	AuthCache            AuthCacheConfig            `toml:"auth_cache"` // Persistent auth cache configuration
+	Cleanup              CleanupConfig              `toml:"cleanup"`
+	Servers              ServersConfig              `toml:"servers"`
+	Uploader             UploaderConfig             `toml:"uploader"`
+	Metadata             MetadataConfig             `toml:"metadata"`
+	SharedMailboxes      SharedMailboxesConfig      `toml:"shared_mailboxes"`
+	Sieve                SieveConfig                `toml:"sieve"`
+	Relay                RelayConfig                `toml:"relay"`
+	Events               EventsConfig               `toml:"events"`                // Mailbox event stream (webhooks, NDJSON file)
+	MailboxNotifications MailboxNotificationsConfig `toml:"mailbox_notifications"` // Push-driven IDLE via PostgreSQL LISTEN/NOTIFY
+	SpamTraining         SpamTrainingConfig         `toml:"spam_training"`         // Spam filter training configuration
+	AdminCLI             AdminCLIConfig             `toml:"admin_cli"`             // Admin CLI tool configuration
+	TimeoutScheduler     TimeoutSchedulerConfig     `toml:"timeout_scheduler"`     // Global timeout scheduler configuration
 
 	// Dynamic server instances (top-level array)
 	DynamicServers []ServerConfig `toml:"server"`
@@ -1859,6 +2051,13 @@ func (s *ServerConfig) GetMaxMessageSize() (int64, error) {
 	return helpers.ParseSize(s.MaxMessageSize)
 }
 
+func (s *ServerConfig) GetMaxImportSize() (int64, error) {
+	if s.MaxImportSize == "" {
+		return 1024 * 1024 * 1024, nil // 1GB default
+	}
+	return helpers.ParseSize(s.MaxImportSize)
+}
+
 func (s *ServerConfig) GetConnectTimeout() (time.Duration, error) {
 	if s.ConnectTimeout == "" {
 		return 30 * time.Second, nil
@@ -2023,6 +2222,15 @@ func (s *ServerConfig) GetMaxMessageSizeWithDefault() int64 {
 	return size
 }
 
+func (s *ServerConfig) GetMaxImportSizeWithDefault() int64 {
+	size, err := s.GetMaxImportSize()
+	if err != nil {
+		log.Printf("WARNING: Failed to parse max import size for server '%s': %v, using default (1GB)", s.Name, err)
+		return 1024 * 1024 * 1024 // 1GB default
+	}
+	return size
+}
+
 // GetMaxAuthErrors returns the max auth errors with a default of 2
 func (s *ServerConfig) GetMaxAuthErrors() int {
 	if s.Limits == nil || s.Limits.MaxAuthErrors <= 0 {
@@ -2164,7 +2372,7 @@ func (s *ServerConfig) Validate() error {
 		return fmt.Errorf("server address is required")
 	}
 
-	validTypes := []string{"imap", "lmtp", "pop3", "managesieve", "imap_proxy", "pop3_proxy", "managesieve_proxy", "lmtp_proxy", "metrics", "http_admin_api", "http_user_api"}
+	validTypes := []string{"imap", "lmtp", "pop3", "managesieve", "imap_proxy", "pop3_proxy", "managesieve_proxy", "lmtp_proxy", "user_api_proxy", "jmap_proxy", "submission_proxy", "metrics", "http_admin_api", "http_user_api", "jmap", "submission"}
 	isValidType := false
 	for _, validType := range validTypes {
 		if s.Type == validType {
@@ -2267,6 +2475,18 @@ func (s *ServerConfig) WarnUnusedConfigOptions(logger func(format string, args .
 			logger("WARNING: Server %s (type: %s) has 'remote_use_id_command' configured, but this only applies to IMAP proxy servers", s.Name, s.Type)
 		}
 
+	case "submission", "submission_proxy":
+		// Mail submission server and proxy
+		if len(s.SupportedExtensions) > 0 {
+			logger("WARNING: Server %s (type: %s) has 'supported_extensions' configured, but this only applies to ManageSieve servers/proxies", s.Name, s.Type)
+		}
+		if s.MaxScriptSize != "" {
+			logger("WARNING: Server %s (type: %s) has 'max_script_size' configured, but this only applies to ManageSieve servers", s.Name, s.Type)
+		}
+		if s.RemoteUseIDCommand {
+			logger("WARNING: Server %s (type: %s) has 'remote_use_id_command' configured, but this only applies to IMAP proxy servers", s.Name, s.Type)
+		}
+
 	case "managesieve_proxy":
 		// ManageSieve proxy
 		if s.AppendLimit != "" {
@@ -2279,13 +2499,13 @@ func (s *ServerConfig) WarnUnusedConfigOptions(logger func(format string, args .
 			logger("WARNING: Server %s (type: %s) has 'remote_use_xclient' configured, but this only applies to LMTP proxy servers", s.Name, s.Type)
 		}
 
-	case "metrics", "http_admin_api", "http_user_api":
+	case "metrics", "http_admin_api", "http_user_api", "jmap":
 		// HTTP servers - warn about protocol-specific options
 		if len(s.SupportedExtensions) > 0 {
 			logger("WARNING: Server %s (type: %s) has 'supported_extensions' configured, but this only applies to ManageSieve servers", s.Name, s.Type)
 		}
-		if s.MaxScriptSize != "" {
-			logger("WARNING: Server %s (type: %s) has 'max_script_size' configured, but this only applies to ManageSieve servers", s.Name, s.Type)
+		if s.MaxScriptSize != "" && s.Type != "http_user_api" {
+			logger("WARNING: Server %s (type: %s) has 'max_script_size' configured, but this only applies to ManageSieve and HTTP user API servers", s.Name, s.Type)
 		}
 		if s.AppendLimit != "" {
 			logger("WARNING: Server %s (type: %s) has 'append_limit' configured, but this only applies to IMAP servers", s.Name, s.Type)
@@ -2294,6 +2514,13 @@ func (s *ServerConfig) WarnUnusedConfigOptions(logger func(format string, args .
 			logger("WARNING: Server %s (type: %s) has 'tls_use_starttls' configured, but this only applies to protocol servers (IMAP, POP3, LMTP, ManageSieve)", s.Name, s.Type)
 		}
 	}
+
+	if s.JMAP != nil && s.Type != "jmap" {
+		logger("WARNING: Server %s (type: %s) has a 'jmap' section configured, but this only applies to JMAP servers", s.Name, s.Type)
+	}
+	if s.Submission != nil && s.Type != "submission" {
+		logger("WARNING: Server %s (type: %s) has a 'submission' section configured, but this only applies to submission servers", s.Name, s.Type)
+	}
 }
 
 // GetAllServers returns all configured servers from the dynamic configuration
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"time"
+
+	"github.com/migadu/sora/helpers"
+)
+
+// EventsConfig configures the mailbox event stream. Events are written to the
+// NDJSON file sink (if configured) and delivered to the webhook subscriptions
+// managed through the admin API.
+type EventsConfig struct {
+	Enabled             bool   `toml:"enabled"`
+	BufferSize          int    `toml:"buffer_size"`          // Events buffered in memory before new ones are dropped (default: 10000)
+	SubscriptionRefresh string `toml:"subscription_refresh"` // How often webhook subscriptions are reloaded from the database (default: "30s")
+
+	File    EventsFileConfig    `toml:"file"`
+	Webhook EventsWebhookConfig `toml:"webhook"`
+}
+
+// EventsFileConfig configures the newline-delimited JSON file sink.
+type EventsFileConfig struct {
+	Path string `toml:"path"` // File that every event is appended to (empty = disabled)
+}
+
+// EventsWebhookConfig configures webhook delivery through the on-disk queue.
+type EventsWebhookConfig struct {
+	QueuePath       string   `toml:"queue_path"`       // Base path for the delivery queue (default: "/var/spool/sora/events")
+	Timeout         string   `toml:"timeout"`          // HTTP request timeout (default: "10s")
+	Concurrency     int      `toml:"concurrency"`      // Concurrent deliveries (default: 4)
+	WorkerInterval  string   `toml:"worker_interval"`  // How often the queue is scanned for due deliveries (default: "5s")
+	MaxAttempts     int      `toml:"max_attempts"`     // Attempts before a delivery is moved to failed (default: 10)
+	RetryBackoff    []string `toml:"retry_backoff"`    // Backoff between attempts (default: ["10s", "1m", "5m", "15m", "1h", "6h"])
+	FailedRetention string   `toml:"failed_retention"` // How long failed deliveries are kept (default: "168h", "0" = forever)
+}
+
+// GetBufferSize returns the event buffer size with default
+func (e *EventsConfig) GetBufferSize() int {
+	if e.BufferSize <= 0 {
+		return 10000
+	}
+	return e.BufferSize
+}
+
+// GetSubscriptionRefresh parses the subscription refresh interval
+func (e *EventsConfig) GetSubscriptionRefresh() (time.Duration, error) {
+	if e.SubscriptionRefresh == "" {
+		return 30 * time.Second, nil
+	}
+	return helpers.ParseDuration(e.SubscriptionRefresh)
+}
+
+// GetQueuePath returns the webhook queue path with default
+func (w *EventsWebhookConfig) GetQueuePath() string {
+	if w.QueuePath != "" {
+		return w.QueuePath
+	}
+	return "/var/spool/sora/events"
+}
+
+// GetTimeout parses the webhook request timeout
+func (w *EventsWebhookConfig) GetTimeout() (time.Duration, error) {
+	if w.Timeout == "" {
+		return 10 * time.Second, nil
+	}
+	return helpers.ParseDuration(w.Timeout)
+}
+
+// GetConcurrency returns the number of concurrent deliveries with default
+func (w *EventsWebhookConfig) GetConcurrency() int {
+	if w.Concurrency <= 0 {
+		return 4
+	}
+	return w.Concurrency
+}
+
+// GetWorkerInterval parses the queue scan interval
+func (w *EventsWebhookConfig) GetWorkerInterval() (time.Duration, error) {
+	if w.WorkerInterval == "" {
+		return 5 * time.Second, nil
+	}
+	return helpers.ParseDuration(w.WorkerInterval)
+}
+
+// GetMaxAttempts returns the maximum delivery attempts with default
+func (w *EventsWebhookConfig) GetMaxAttempts() int {
+	if w.MaxAttempts <= 0 {
+		return 10
+	}
+	return w.MaxAttempts
+}
+
+// GetRetryBackoff parses the retry backoff durations
+func (w *EventsWebhookConfig) GetRetryBackoff() ([]time.Duration, error) {
+	if len(w.RetryBackoff) == 0 {
+		return []time.Duration{
+			10 * time.Second,
+			1 * time.Minute,
+			5 * time.Minute,
+			15 * time.Minute,
+			1 * time.Hour,
+			6 * time.Hour,
+		}, nil
+	}
+
+	backoff := make([]time.Duration, 0, len(w.RetryBackoff))
+	for _, b := range w.RetryBackoff {
+		d, err := helpers.ParseDuration(b)
+		if err != nil {
+			return nil, err
+		}
+		backoff = append(backoff, d)
+	}
+	return backoff, nil
+}
+
+// GetFailedRetention returns how long failed deliveries are kept.
+// Special values:
+//   - "" (empty): Uses default of 7 days
+//   - "0": Disable cleanup (failed deliveries kept forever)
+func (w *EventsWebhookConfig) GetFailedRetention() (time.Duration, error) {
+	if w.FailedRetention == "" {
+		return 168 * time.Hour, nil
+	}
+	return helpers.ParseDuration(w.FailedRetention)
+}
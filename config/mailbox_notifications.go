@@ -0,0 +1,28 @@
+package config
+
+import (
+	"time"
+
+	"github.com/migadu/sora/helpers"
+)
+
+// MailboxNotificationsConfig configures push delivery of mailbox changes.
+// When enabled, message writers publish a PostgreSQL NOTIFY per changed
+// mailbox and every node listens for them, so IDLE sessions are woken up as
+// soon as their mailbox changes instead of polling at a fixed interval.
+//
+// All nodes that write messages (IMAP, LMTP, POP3, sora-admin imports) should
+// use the same setting; writers without it do not wake up IDLE sessions and
+// their changes only show up at the next fallback poll.
+type MailboxNotificationsConfig struct {
+	Enabled              bool   `toml:"enabled"`
+	FallbackPollInterval string `toml:"fallback_poll_interval"` // IDLE poll interval while notifications are active (default: "2m")
+}
+
+// GetFallbackPollInterval parses the IDLE fallback poll interval
+func (m *MailboxNotificationsConfig) GetFallbackPollInterval() (time.Duration, error) {
+	if m.FallbackPollInterval == "" {
+		return 2 * time.Minute, nil
+	}
+	return helpers.ParseDuration(m.FallbackPollInterval)
+}
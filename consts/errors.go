@@ -15,6 +15,13 @@ var (
 	ErrMessageNotAvailable  = errors.New("message not available")
 	ErrEmptyMessageID       = errors.New("empty message ID")
 	ErrAuthenticationFailed = errors.New("authentication failed")
+	ErrQuotaExceeded        = errors.New("quota exceeded")
+	ErrDomainSuspended      = errors.New("domain suspended")
+	ErrAccountSuspended     = errors.New("account suspended")
+	ErrDomainAccountLimit   = errors.New("domain account limit reached")
+	ErrInvalidInput         = errors.New("invalid input")
+	ErrTOTPAlreadyEnabled   = errors.New("second factor already enabled")
+	ErrImportInProgress     = errors.New("import already in progress")
 
 	ErrDBNotFound                = errors.New("not found")
 	ErrDBUniqueViolation         = errors.New("unique violation")
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/server"
+)
+
+// Account status values. See migration 000027 for their meaning.
+const (
+	AccountStatusActive       = "active"
+	AccountStatusSuspended    = "suspended"
+	AccountStatusReceiveOnly  = "receive-only"
+	AccountStatusSendDisabled = "send-disabled"
+)
+
+// AccountStatuses lists the valid account status values.
+var AccountStatuses = []string{AccountStatusActive, AccountStatusSuspended, AccountStatusReceiveOnly, AccountStatusSendDisabled}
+
+// effectiveAccountStatusSQL evaluates the status of the account aliased as
+// "a", treating an expired status as active.
+const effectiveAccountStatusSQL = `CASE WHEN a.status_expires_at IS NOT NULL AND a.status_expires_at <= now() THEN 'active' ELSE a.status END`
+
+// AccountStatus is the lifecycle state of an account.
+type AccountStatus struct {
+	Status    string     `json:"status"`
+	Reason    string     `json:"reason,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Status reverts to active at this time
+	DeleteAt  *time.Time `json:"delete_at,omitempty"`  // Account is soft-deleted at this time
+}
+
+// AccountStatusAllowsLogin reports whether accounts with the given status may
+// authenticate.
+func AccountStatusAllowsLogin(status string) bool {
+	return status != AccountStatusSuspended && status != AccountStatusReceiveOnly
+}
+
+// AccountStatusAllowsDelivery reports whether mail is delivered to accounts
+// with the given status.
+func AccountStatusAllowsDelivery(status string) bool {
+	return status != AccountStatusSuspended
+}
+
+// AccountStatusAllowsSending reports whether accounts with the given status
+// may submit outgoing mail.
+func AccountStatusAllowsSending(status string) bool {
+	return status != AccountStatusSuspended && status != AccountStatusReceiveOnly && status != AccountStatusSendDisabled
+}
+
+func (s *AccountStatus) normalize() error {
+	s.Status = strings.ToLower(strings.TrimSpace(s.Status))
+	s.Reason = strings.TrimSpace(s.Reason)
+	if !slices.Contains(AccountStatuses, s.Status) {
+		return fmt.Errorf("invalid account status: %q (must be one of %s)", s.Status, strings.Join(AccountStatuses, ", "))
+	}
+	if s.Status == AccountStatusActive {
+		// Nothing to expire
+		s.ExpiresAt = nil
+	}
+	if s.ExpiresAt != nil && !s.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("status expiry must be in the future")
+	}
+	return nil
+}
+
+// SetAccountStatus sets the status of the account owning email and returns the
+// account ID. It does not disconnect existing sessions; callers kick them
+// through the connection trackers when logins become blocked.
+func (db *Database) SetAccountStatus(ctx context.Context, tx pgx.Tx, email string, status AccountStatus) (int64, error) {
+	address, err := server.NewAddress(email)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid email address: %w", consts.ErrInvalidInput, err)
+	}
+	if err := status.normalize(); err != nil {
+		return 0, fmt.Errorf("%w: %w", consts.ErrInvalidInput, err)
+	}
+
+	var accountID int64
+	err = tx.QueryRow(ctx, `
+		UPDATE accounts a
+		SET status = $2, status_reason = $3, status_expires_at = $4, delete_scheduled_at = $5
+		FROM credentials c
+		WHERE c.account_id = a.id AND LOWER(c.address) = $1 AND a.deleted_at IS NULL
+		RETURNING a.id
+	`, address.FullAddress(), status.Status, status.Reason, status.ExpiresAt, status.DeleteAt).Scan(&accountID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("account with email %s not found: %w", address.FullAddress(), consts.ErrUserNotFound)
+		}
+		return 0, fmt.Errorf("failed to set account status: %w", err)
+	}
+
+	logger.Info("Database: account status changed", "account_id", accountID, "status", status.Status, "reason", status.Reason)
+	return accountID, nil
+}
+
+// GetAccountStatus returns the effective status of an account. An expired
+// status is reported as active.
+func (db *Database) GetAccountStatus(ctx context.Context, accountID int64) (*AccountStatus, error) {
+	var status AccountStatus
+	err := db.GetReadPoolWithContext(ctx).QueryRow(ctx, `
+		SELECT `+effectiveAccountStatusSQL+`,
+			CASE WHEN a.status_expires_at IS NOT NULL AND a.status_expires_at <= now() THEN '' ELSE a.status_reason END,
+			CASE WHEN a.status_expires_at > now() THEN a.status_expires_at END,
+			a.delete_scheduled_at
+		FROM accounts a
+		WHERE a.id = $1 AND a.deleted_at IS NULL
+	`, accountID).Scan(&status.Status, &status.Reason, &status.ExpiresAt, &status.DeleteAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, consts.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get account status: %w", err)
+	}
+	return &status, nil
+}
+
+// softDeleteScheduledAccounts soft-deletes accounts whose scheduled deletion
+// time has passed.
+func (db *Database) softDeleteScheduledAccounts(ctx context.Context, tx pgx.Tx) (int64, error) {
+	result, err := tx.Exec(ctx, `
+		UPDATE accounts
+		SET deleted_at = now()
+		WHERE delete_scheduled_at IS NOT NULL AND delete_scheduled_at <= now() AND deleted_at IS NULL
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to soft-delete scheduled accounts: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
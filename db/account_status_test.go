@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountStatus_Normalize(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name    string
+		status  AccountStatus
+		wantErr bool
+	}{
+		{"active", AccountStatus{Status: "Active"}, false},
+		{"suspended with expiry", AccountStatus{Status: "suspended", ExpiresAt: &future}, false},
+		{"receive-only", AccountStatus{Status: "receive-only", Reason: " unpaid "}, false},
+		{"unknown", AccountStatus{Status: "disabled"}, true},
+		{"empty", AccountStatus{}, true},
+		{"expiry in the past", AccountStatus{Status: "suspended", ExpiresAt: &past}, true},
+		{"active ignores expiry", AccountStatus{Status: "active", ExpiresAt: &past}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.status.normalize()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.status.Status == AccountStatusActive {
+				assert.Nil(t, tt.status.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestAccountStatusPermissions(t *testing.T) {
+	tests := []struct {
+		status                   string
+		login, delivery, sending bool
+	}{
+		{AccountStatusActive, true, true, true},
+		{AccountStatusSuspended, false, false, false},
+		{AccountStatusReceiveOnly, false, true, false},
+		{AccountStatusSendDisabled, true, true, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.login, AccountStatusAllowsLogin(tt.status), tt.status)
+		assert.Equal(t, tt.delivery, AccountStatusAllowsDelivery(tt.status), tt.status)
+		assert.Equal(t, tt.sending, AccountStatusAllowsSending(tt.status), tt.status)
+	}
+}
+
+// TestAccountStatus tests the effect of account statuses on authentication,
+// recipient lookups and scheduled deletion.
+func TestAccountStatus(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping database integration test in short mode")
+	}
+
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	email := fmt.Sprintf("status-%d@example.com", time.Now().UnixNano())
+	var accountID int64
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) (err error) {
+		accountID, err = db.CreateAccount(ctx, tx, CreateAccountRequest{Email: email, Password: "password123", IsPrimary: true, HashType: "bcrypt"})
+		return err
+	}))
+
+	setStatus := func(status AccountStatus) error {
+		return inTestTx(t, db, func(tx pgx.Tx) error {
+			id, err := db.SetAccountStatus(ctx, tx, email, status)
+			if err == nil {
+				assert.Equal(t, accountID, id)
+			}
+			return err
+		})
+	}
+
+	// receive-only refuses logins but accepts mail
+	require.NoError(t, setStatus(AccountStatus{Status: AccountStatusReceiveOnly, Reason: "unpaid"}))
+	_, _, err := db.GetCredentialForAuth(ctx, email)
+	assert.ErrorIs(t, err, consts.ErrAccountSuspended)
+	assert.ErrorIs(t, err, consts.ErrUserNotFound)
+	_, err = db.GetLoginAccountIDByAddress(ctx, email)
+	assert.ErrorIs(t, err, consts.ErrAccountSuspended)
+	id, err := db.GetActiveAccountIDByAddress(ctx, email)
+	require.NoError(t, err)
+	assert.Equal(t, accountID, id)
+
+	status, err := db.GetAccountStatus(ctx, accountID)
+	require.NoError(t, err)
+	assert.Equal(t, AccountStatusReceiveOnly, status.Status)
+	assert.Equal(t, "unpaid", status.Reason)
+
+	// send-disabled keeps logins and accepts mail; only submission is refused
+	require.NoError(t, setStatus(AccountStatus{Status: AccountStatusSendDisabled}))
+	_, _, err = db.GetCredentialForAuth(ctx, email)
+	require.NoError(t, err)
+	id, err = db.GetActiveAccountIDByAddress(ctx, email)
+	require.NoError(t, err)
+	assert.Equal(t, accountID, id)
+
+	// An expired status counts as active
+	require.NoError(t, setStatus(AccountStatus{Status: AccountStatusSuspended}))
+	_, err = db.GetActiveAccountIDByAddress(ctx, email)
+	assert.ErrorIs(t, err, consts.ErrAccountSuspended)
+	_, err = db.GetWritePool().Exec(ctx, "UPDATE accounts SET status_expires_at = now() - interval '1 minute' WHERE id = $1", accountID)
+	require.NoError(t, err)
+	_, _, err = db.GetCredentialForAuth(ctx, email)
+	require.NoError(t, err)
+	status, err = db.GetAccountStatus(ctx, accountID)
+	require.NoError(t, err)
+	assert.Equal(t, AccountStatusActive, status.Status)
+
+	err = setStatus(AccountStatus{Status: "disabled"})
+	assert.ErrorIs(t, err, consts.ErrInvalidInput)
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		_, err := db.SetAccountStatus(ctx, tx, "missing-"+email, AccountStatus{Status: AccountStatusActive})
+		return err
+	})
+	assert.ErrorIs(t, err, consts.ErrUserNotFound)
+
+	// A scheduled deletion soft-deletes the account once due
+	past := time.Now().Add(-time.Minute)
+	require.NoError(t, setStatus(AccountStatus{Status: AccountStatusActive, DeleteAt: &past}))
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) error {
+		n, err := db.softDeleteScheduledAccounts(ctx, tx)
+		assert.GreaterOrEqual(t, n, int64(1))
+		return err
+	}))
+	_, _, err = db.GetCredentialForAuth(ctx, email)
+	assert.ErrorIs(t, err, consts.ErrUserNotFound)
+}
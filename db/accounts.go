@@ -80,6 +80,10 @@ func (db *Database) CreateAccount(ctx context.Context, tx pgx.Tx, req CreateAcco
 		}
 	}
 
+	if err := checkNewCredential(ctx, tx, normalizedEmail, 0); err != nil {
+		return 0, err
+	}
+
 	// Create account
 	var accountID int64
 	err = tx.QueryRow(ctx, "INSERT INTO accounts (created_at) VALUES (now()) RETURNING id").Scan(&accountID)
@@ -154,6 +158,10 @@ func (db *Database) AddCredential(ctx context.Context, tx pgx.Tx, req AddCredent
 		}
 	}
 
+	if err := checkNewCredential(ctx, tx, normalizedNewEmail, req.AccountID); err != nil {
+		return err
+	}
+
 	// If this should be the new primary identity, unset the current primary
 	if req.IsPrimary {
 		_, err = tx.Exec(ctx,
@@ -639,14 +647,17 @@ type AccountCredentialDetails struct {
 
 // AccountDetails holds comprehensive information about an account.
 type AccountDetails struct {
-	ID           int64                      `json:"account_id"`
-	CreatedAt    time.Time                  `json:"created_at"`
-	DeletedAt    *time.Time                 `json:"deleted_at,omitempty"`
-	PrimaryEmail string                     `json:"primary_email"`
-	Status       string                     `json:"status"`
-	Credentials  []AccountCredentialDetails `json:"credentials"`
-	MailboxCount int64                      `json:"mailbox_count"`
-	MessageCount int64                      `json:"message_count"`
+	ID                int64                      `json:"account_id"`
+	CreatedAt         time.Time                  `json:"created_at"`
+	DeletedAt         *time.Time                 `json:"deleted_at,omitempty"`
+	PrimaryEmail      string                     `json:"primary_email"`
+	Status            string                     `json:"status"` // "deleted" or the effective account status
+	StatusReason      string                     `json:"status_reason,omitempty"`
+	StatusExpiresAt   *time.Time                 `json:"status_expires_at,omitempty"`
+	DeleteScheduledAt *time.Time                 `json:"delete_scheduled_at,omitempty"`
+	Credentials       []AccountCredentialDetails `json:"credentials"`
+	MailboxCount      int64                      `json:"mailbox_count"`
+	MessageCount      int64                      `json:"message_count"`
 }
 
 // GetAccountDetails retrieves comprehensive details for an account by any associated email.
@@ -662,12 +673,18 @@ func (db *Database) GetAccountDetails(ctx context.Context, email string) (*Accou
 	var details AccountDetails
 	err = db.GetReadPool().QueryRow(ctx, `
 		SELECT a.id, a.created_at, a.deleted_at,
+			   `+effectiveAccountStatusSQL+`,
+			   CASE WHEN a.status_expires_at IS NOT NULL AND a.status_expires_at <= now() THEN '' ELSE a.status_reason END,
+			   CASE WHEN a.status_expires_at > now() THEN a.status_expires_at END,
+			   a.delete_scheduled_at,
 			   (SELECT COUNT(*) FROM mailboxes WHERE account_id = a.id) AS mailbox_count,
 			   COALESCE((SELECT SUM(message_count) FROM mailbox_stats WHERE mailbox_id IN (SELECT id FROM mailboxes WHERE account_id = a.id)), 0) AS message_count
 		FROM accounts a
 		JOIN credentials c ON a.id = c.account_id
 		WHERE LOWER(c.address) = $1
-	`, normalizedEmail).Scan(&details.ID, &details.CreatedAt, &details.DeletedAt, &details.MailboxCount, &details.MessageCount)
+	`, normalizedEmail).Scan(&details.ID, &details.CreatedAt, &details.DeletedAt,
+		&details.Status, &details.StatusReason, &details.StatusExpiresAt, &details.DeleteScheduledAt,
+		&details.MailboxCount, &details.MessageCount)
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -677,7 +694,6 @@ func (db *Database) GetAccountDetails(ctx context.Context, email string) (*Accou
 	}
 
 	// Set status
-	details.Status = "active"
 	if details.DeletedAt != nil {
 		details.Status = "deleted"
 	}
@@ -955,6 +971,12 @@ func (db *Database) CreateAccountWithCredentials(ctx context.Context, tx pgx.Tx,
 		}
 	}
 
+	for i, email := range normalizedEmails {
+		if err := checkNewCredential(ctx, tx, email, 0); err != nil {
+			return 0, fmt.Errorf("credential %d: %w", i+1, err)
+		}
+	}
+
 	// Create account
 	var accountID int64
 	err := tx.QueryRow(ctx, "INSERT INTO accounts (created_at) VALUES (now()) RETURNING id").Scan(&accountID)
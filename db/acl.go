@@ -102,6 +102,17 @@ func (db *Database) GrantMailboxAccessByIdentifier(ctx context.Context, ownerAcc
 		return fmt.Errorf("shared mailbox has no owner domain")
 	}
 
+	var allowed bool
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE((SELECT shared_mailboxes FROM domains WHERE name = LOWER($1)), TRUE)
+	`, *ownerDomain).Scan(&allowed)
+	if err != nil {
+		return fmt.Errorf("failed to get shared mailbox policy: %w", err)
+	}
+	if !allowed {
+		return fmt.Errorf("%w: shared mailboxes are disabled for domain %s", consts.ErrNotPermitted, *ownerDomain)
+	}
+
 	// Handle "anyone" identifier
 	if identifier == AnyoneIdentifier {
 		// Insert or update ACL for "anyone"
@@ -0,0 +1,210 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/migadu/sora/consts"
+)
+
+// Scopes an admin API key can be granted. ScopeAdmin grants everything,
+// including the management of API keys; ScopeReadOnly grants every GET
+// endpoint except the API key list. The other scopes grant reading and
+// changing their area.
+const (
+	APIKeyScopeAdmin        = "admin"
+	APIKeyScopeReadOnly     = "read-only"
+	APIKeyScopeAccounts     = "accounts"
+	APIKeyScopeConnections  = "connections"
+	APIKeyScopeCache        = "cache"
+	APIKeyScopeACL          = "acl"
+	APIKeyScopeMailDelivery = "mail-delivery"
+)
+
+// APIKeyScopes lists the scopes an admin API key can be granted.
+var APIKeyScopes = []string{
+	APIKeyScopeAdmin,
+	APIKeyScopeReadOnly,
+	APIKeyScopeAccounts,
+	APIKeyScopeConnections,
+	APIKeyScopeCache,
+	APIKeyScopeACL,
+	APIKeyScopeMailDelivery,
+}
+
+const (
+	// APIKeyPrefix starts every generated admin API key, so that keys from
+	// the configuration can be told apart without a database lookup.
+	APIKeyPrefix = "sora_"
+	// apiKeyRandomBytes is the amount of randomness in a generated key.
+	apiKeyRandomBytes = 32
+	// maxAPIKeyNameLength limits the name of an admin API key.
+	maxAPIKeyNameLength = 100
+)
+
+// AdminAPIKey is a named admin API key with the scopes it grants.
+type AdminAPIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Domains    []string   `json:"domains"` // Empty means any domain
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Normalize validates the name, scopes and domains of a key, removes
+// duplicates and lowercases the domains. It is also used for the keys in the
+// configuration file.
+func (k *AdminAPIKey) Normalize() error {
+	k.Name = strings.TrimSpace(k.Name)
+	if k.Name == "" {
+		return errors.New("API key name is required")
+	}
+	if len(k.Name) > maxAPIKeyNameLength {
+		return fmt.Errorf("API key name is longer than %d characters", maxAPIKeyNameLength)
+	}
+
+	scopes := make([]string, 0, len(k.Scopes))
+	for _, scope := range k.Scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !slices.Contains(APIKeyScopes, scope) {
+			return fmt.Errorf("invalid scope: %q (must be one of %s)", scope, strings.Join(APIKeyScopes, ", "))
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	k.Scopes = scopes
+
+	domains := make([]string, 0, len(k.Domains))
+	for _, domain := range k.Domains {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		if domain == "" || strings.ContainsAny(domain, "@/ ") {
+			return fmt.Errorf("invalid domain: %q", domain)
+		}
+		if !slices.Contains(domains, domain) {
+			domains = append(domains, domain)
+		}
+	}
+	k.Domains = domains
+	return nil
+}
+
+// GenerateAdminAPIKeySecret returns a random admin API key starting with
+// APIKeyPrefix.
+func GenerateAdminAPIKeySecret() (string, error) {
+	buf := make([]byte, apiKeyRandomBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating API key: %w", err)
+	}
+	return APIKeyPrefix + hex.EncodeToString(buf), nil
+}
+
+// CreateAdminAPIKey generates a new admin API key. It returns the stored key
+// and the secret, which is not retrievable later. A duplicate name returns
+// consts.ErrDBUniqueViolation.
+func (db *Database) CreateAdminAPIKey(ctx context.Context, tx pgx.Tx, k AdminAPIKey) (*AdminAPIKey, string, error) {
+	if err := k.Normalize(); err != nil {
+		return nil, "", fmt.Errorf("%w: %w", consts.ErrInvalidInput, err)
+	}
+	secret, err := GenerateAdminAPIKeySecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO admin_api_keys (name, key_hash, scopes, domains)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, k.Name, GenerateSHA512Hash(secret), k.Scopes, k.Domains).Scan(&k.ID, &k.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, "", consts.ErrDBUniqueViolation
+		}
+		return nil, "", fmt.Errorf("failed to create API key: %w", err)
+	}
+	return &k, secret, nil
+}
+
+// ListAdminAPIKeys returns the stored admin API keys ordered by name.
+func (db *Database) ListAdminAPIKeys(ctx context.Context) ([]AdminAPIKey, error) {
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, `
+		SELECT id, name, scopes, domains, created_at, last_used_at
+		FROM admin_api_keys
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []AdminAPIKey{}
+	for rows.Next() {
+		var k AdminAPIKey
+		if err := rows.Scan(&k.ID, &k.Name, &k.Scopes, &k.Domains, &k.CreatedAt, &k.LastUsedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// GetAdminAPIKeyBySecret returns the stored admin API key matching secret,
+// or consts.ErrDBNotFound.
+func (db *Database) GetAdminAPIKeyBySecret(ctx context.Context, secret string) (*AdminAPIKey, error) {
+	var k AdminAPIKey
+	err := db.GetReadPoolWithContext(ctx).QueryRow(ctx, `
+		SELECT id, name, scopes, domains, created_at, last_used_at
+		FROM admin_api_keys
+		WHERE key_hash = $1
+	`, GenerateSHA512Hash(secret)).Scan(&k.ID, &k.Name, &k.Scopes, &k.Domains, &k.CreatedAt, &k.LastUsedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, consts.ErrDBNotFound
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return &k, nil
+}
+
+// RecordAdminAPIKeyUse stores when an admin API key was last used. Uses
+// within a minute of the last recorded one are not written again.
+func (db *Database) RecordAdminAPIKeyUse(ctx context.Context, tx pgx.Tx, id int64) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE admin_api_keys
+		SET last_used_at = now()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute')
+	`, id)
+	if err != nil {
+		return fmt.Errorf("failed to record API key use: %w", err)
+	}
+	return nil
+}
+
+// DeleteAdminAPIKey revokes a stored admin API key. It returns
+// consts.ErrDBNotFound if there is no key with that ID.
+func (db *Database) DeleteAdminAPIKey(ctx context.Context, tx pgx.Tx, id int64) error {
+	result, err := tx.Exec(ctx, `DELETE FROM admin_api_keys WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete API key: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return consts.ErrDBNotFound
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminAPIKey_Normalize(t *testing.T) {
+	k := AdminAPIKey{
+		Name:    " Support desk ",
+		Scopes:  []string{"Read-Only", "accounts", "read-only"},
+		Domains: []string{"Example.com", "@example.org", "example.com"},
+	}
+	require.NoError(t, k.Normalize())
+	assert.Equal(t, "Support desk", k.Name)
+	assert.Equal(t, []string{"read-only", "accounts"}, k.Scopes)
+	assert.Equal(t, []string{"example.com", "example.org"}, k.Domains)
+
+	invalid := []AdminAPIKey{
+		{Name: "", Scopes: []string{"admin"}},
+		{Name: "x", Scopes: nil},
+		{Name: "x", Scopes: []string{"root"}},
+		{Name: "x", Scopes: []string{"cache"}, Domains: []string{"user@example.com"}},
+	}
+	for _, k := range invalid {
+		assert.Error(t, k.Normalize(), "%+v", k)
+	}
+}
+
+func TestGenerateAdminAPIKeySecret(t *testing.T) {
+	secret, err := GenerateAdminAPIKeySecret()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(secret, APIKeyPrefix))
+	assert.Len(t, secret, len(APIKeyPrefix)+2*apiKeyRandomBytes)
+
+	other, err := GenerateAdminAPIKeySecret()
+	require.NoError(t, err)
+	assert.NotEqual(t, secret, other)
+}
+
+// TestAdminAPIKeys tests creating, looking up and revoking admin API keys.
+func TestAdminAPIKeys(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping database integration test in short mode")
+	}
+
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	name := fmt.Sprintf("support-%d", time.Now().UnixNano())
+
+	var created *AdminAPIKey
+	var secret string
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) (err error) {
+		created, secret, err = db.CreateAdminAPIKey(ctx, tx, AdminAPIKey{
+			Name:    name,
+			Scopes:  []string{"read-only", "connections"},
+			Domains: []string{"example.com"},
+		})
+		return err
+	}))
+	assert.NotZero(t, created.ID)
+
+	err := inTestTx(t, db, func(tx pgx.Tx) error {
+		_, _, err := db.CreateAdminAPIKey(ctx, tx, AdminAPIKey{Name: name, Scopes: []string{"cache"}})
+		return err
+	})
+	assert.ErrorIs(t, err, consts.ErrDBUniqueViolation)
+
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		_, _, err := db.CreateAdminAPIKey(ctx, tx, AdminAPIKey{Name: name + "-bad", Scopes: []string{"root"}})
+		return err
+	})
+	assert.ErrorIs(t, err, consts.ErrInvalidInput)
+
+	found, err := db.GetAdminAPIKeyBySecret(ctx, secret)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, found.ID)
+	assert.Equal(t, []string{"read-only", "connections"}, found.Scopes)
+	assert.Equal(t, []string{"example.com"}, found.Domains)
+	assert.Nil(t, found.LastUsedAt)
+
+	_, err = db.GetAdminAPIKeyBySecret(ctx, secret+"x")
+	assert.ErrorIs(t, err, consts.ErrDBNotFound)
+
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.RecordAdminAPIKeyUse(ctx, tx, created.ID)
+	}))
+	keys, err := db.ListAdminAPIKeys(ctx)
+	require.NoError(t, err)
+	var listed *AdminAPIKey
+	for i := range keys {
+		if keys[i].ID == created.ID {
+			listed = &keys[i]
+		}
+	}
+	require.NotNil(t, listed)
+	assert.NotNil(t, listed.LastUsedAt)
+
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.DeleteAdminAPIKey(ctx, tx, created.ID)
+	}))
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.DeleteAdminAPIKey(ctx, tx, created.ID)
+	})
+	assert.ErrorIs(t, err, consts.ErrDBNotFound)
+	_, err = db.GetAdminAPIKeyBySecret(ctx, secret)
+	assert.ErrorIs(t, err, consts.ErrDBNotFound)
+}
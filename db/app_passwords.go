@@ -0,0 +1,315 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/migadu/sora/consts"
+)
+
+// Protocols an app password can be restricted to. They match the protocol
+// names that servers record for authentication events.
+const (
+	AppPasswordProtocolIMAP        = "imap"
+	AppPasswordProtocolPOP3        = "pop3"
+	AppPasswordProtocolManageSieve = "managesieve"
+	AppPasswordProtocolSubmission  = "submission"
+	AppPasswordProtocolJMAP        = "jmap"
+	AppPasswordProtocolUserAPI     = "userapi"
+)
+
+// AppPasswordProtocols lists the protocols an app password can be used for.
+var AppPasswordProtocols = []string{
+	AppPasswordProtocolIMAP,
+	AppPasswordProtocolPOP3,
+	AppPasswordProtocolManageSieve,
+	AppPasswordProtocolSubmission,
+	AppPasswordProtocolJMAP,
+	AppPasswordProtocolUserAPI,
+}
+
+const (
+	// appPasswordLength is the number of letters of a generated app password.
+	appPasswordLength = 16
+	// appPasswordGroup is the size of the dash-separated groups it is shown in.
+	appPasswordGroup = 4
+	// maxAppPasswordNameLength limits the label of an app password.
+	maxAppPasswordNameLength = 100
+)
+
+var errAppPasswordNotAllowed = errors.New("app password not allowed for this protocol or client address")
+
+// AppPassword is a named secret of an account that is accepted instead of
+// the account password for a subset of protocols.
+type AppPassword struct {
+	ID         int64      `json:"id"`
+	AccountID  int64      `json:"-"`
+	Name       string     `json:"name"`
+	Protocols  []string   `json:"protocols"`
+	AllowedIPs []string   `json:"allowed_ips"` // CIDR networks, empty means any address
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+}
+
+func (a *AppPassword) normalize() error {
+	a.Name = strings.TrimSpace(a.Name)
+	if a.Name == "" {
+		return errors.New("app password name is required")
+	}
+	if len(a.Name) > maxAppPasswordNameLength {
+		return fmt.Errorf("app password name is longer than %d characters", maxAppPasswordNameLength)
+	}
+
+	protocols := make([]string, 0, len(a.Protocols))
+	for _, p := range a.Protocols {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if !slices.Contains(AppPasswordProtocols, p) {
+			return fmt.Errorf("invalid protocol: %q (must be one of %s)", p, strings.Join(AppPasswordProtocols, ", "))
+		}
+		if !slices.Contains(protocols, p) {
+			protocols = append(protocols, p)
+		}
+	}
+	if len(protocols) == 0 {
+		return errors.New("at least one protocol is required")
+	}
+	a.Protocols = protocols
+
+	allowedIPs := make([]string, 0, len(a.AllowedIPs))
+	for _, ip := range a.AllowedIPs {
+		prefix, err := parseNetwork(strings.TrimSpace(ip))
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(allowedIPs, prefix.String()) {
+			allowedIPs = append(allowedIPs, prefix.String())
+		}
+	}
+	a.AllowedIPs = allowedIPs
+	return nil
+}
+
+// parseNetwork parses a CIDR network or a single IP address.
+func parseNetwork(s string) (netip.Prefix, error) {
+	if prefix, err := netip.ParsePrefix(s); err == nil {
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP address or network: %q", s)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// GenerateAppPasswordSecret returns a random app password made of lowercase
+// letters in dash-separated groups, e.g. "abcd-efgh-ijkl-mnop".
+func GenerateAppPasswordSecret() (string, error) {
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+	buf := make([]byte, appPasswordLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating app password: %w", err)
+	}
+	var sb strings.Builder
+	for i, b := range buf {
+		if i > 0 && i%appPasswordGroup == 0 {
+			sb.WriteByte('-')
+		}
+		// 256 is a multiple of 26 plus 22, the bias is negligible for 75 bits
+		sb.WriteByte(letters[int(b)%len(letters)])
+	}
+	return sb.String(), nil
+}
+
+// normalizeAppPasswordSecret strips the separators and case a user may have
+// typed an app password with.
+func normalizeAppPasswordSecret(password string) string {
+	password = strings.ToLower(password)
+	return strings.NewReplacer("-", "", " ", "").Replace(password)
+}
+
+// AppPasswordCredential is the part of an app password needed to verify a
+// login.
+type AppPasswordCredential struct {
+	ID             int64    `json:"id"`
+	HashedPassword string   `json:"password"`
+	Protocols      []string `json:"protocols"`
+	AllowedIPs     []string `json:"allowed_ips"`
+}
+
+// Allows reports whether the app password may be used for protocol from
+// remoteIP. remoteIP may include a port. An unknown protocol or client
+// address is never allowed.
+func (c *AppPasswordCredential) Allows(protocol, remoteIP string) bool {
+	if protocol == "" || !slices.Contains(c.Protocols, protocol) {
+		return false
+	}
+	if len(c.AllowedIPs) == 0 {
+		return true
+	}
+	if host, _, err := net.SplitHostPort(remoteIP); err == nil {
+		remoteIP = host
+	}
+	addr, err := netip.ParseAddr(remoteIP)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, network := range c.AllowedIPs {
+		if prefix, err := netip.ParsePrefix(network); err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthCredentials holds everything needed to verify a password login for an
+// address: the account password and the account's app passwords.
+type AuthCredentials struct {
+	AccountID      int64
+	HashedPassword string
+	AppPasswords   []AppPasswordCredential
+}
+
+// Verify checks password against the app passwords and then the account
+// password. It returns the app password that matched, or nil if the account
+// password matched. An app password that matches but is not allowed for
+// protocol or remoteIP fails the login.
+func (c *AuthCredentials) Verify(password, protocol, remoteIP string) (*AppPasswordCredential, error) {
+	// App passwords are cheap to check, unlike a bcrypt account password
+	if secret := normalizeAppPasswordSecret(password); len(secret) == appPasswordLength {
+		for i := range c.AppPasswords {
+			app := &c.AppPasswords[i]
+			if VerifyPassword(app.HashedPassword, secret) != nil {
+				continue
+			}
+			if !app.Allows(protocol, remoteIP) {
+				return nil, errAppPasswordNotAllowed
+			}
+			return app, nil
+		}
+	}
+	if c.HashedPassword == "" {
+		return nil, errors.New("invalid password")
+	}
+	if err := VerifyPassword(c.HashedPassword, password); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// CreateAppPassword generates a new app password for an account. It returns
+// the stored app password and the secret, which is not retrievable later.
+// A duplicate name returns consts.ErrDBUniqueViolation.
+func (db *Database) CreateAppPassword(ctx context.Context, tx pgx.Tx, accountID int64, a AppPassword) (*AppPassword, string, error) {
+	if err := a.normalize(); err != nil {
+		return nil, "", fmt.Errorf("%w: %w", consts.ErrInvalidInput, err)
+	}
+	secret, err := GenerateAppPasswordSecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	a.AccountID = accountID
+	err = tx.QueryRow(ctx, `
+		INSERT INTO app_passwords (account_id, name, password, protocols, allowed_ips)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, accountID, a.Name, GenerateSHA512Hash(normalizeAppPasswordSecret(secret)), a.Protocols, a.AllowedIPs).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.Code {
+			case "23505":
+				return nil, "", consts.ErrDBUniqueViolation
+			case "23503":
+				return nil, "", consts.ErrUserNotFound
+			}
+		}
+		return nil, "", fmt.Errorf("failed to create app password: %w", err)
+	}
+	return &a, secret, nil
+}
+
+// ListAppPasswords returns the app passwords of an account ordered by name.
+func (db *Database) ListAppPasswords(ctx context.Context, accountID int64) ([]AppPassword, error) {
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, `
+		SELECT id, account_id, name, protocols, allowed_ips, created_at, last_used_at, COALESCE(last_used_ip, '')
+		FROM app_passwords
+		WHERE account_id = $1
+		ORDER BY name
+	`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list app passwords: %w", err)
+	}
+	defer rows.Close()
+
+	appPasswords := []AppPassword{}
+	for rows.Next() {
+		var a AppPassword
+		if err := rows.Scan(&a.ID, &a.AccountID, &a.Name, &a.Protocols, &a.AllowedIPs, &a.CreatedAt, &a.LastUsedAt, &a.LastUsedIP); err != nil {
+			return nil, fmt.Errorf("failed to scan app password: %w", err)
+		}
+		appPasswords = append(appPasswords, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list app passwords: %w", err)
+	}
+	return appPasswords, nil
+}
+
+// AppPasswordExists reports whether an account still has the app password
+// with the given ID.
+func (db *Database) AppPasswordExists(ctx context.Context, accountID, id int64) (bool, error) {
+	var exists bool
+	err := db.GetReadPoolWithContext(ctx).QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM app_passwords WHERE id = $1 AND account_id = $2)
+	`, id, accountID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check app password: %w", err)
+	}
+	return exists, nil
+}
+
+// DeleteAppPassword revokes an app password of an account. It returns
+// consts.ErrDBNotFound if the account has no app password with that ID.
+func (db *Database) DeleteAppPassword(ctx context.Context, tx pgx.Tx, accountID, id int64) error {
+	result, err := tx.Exec(ctx, `DELETE FROM app_passwords WHERE id = $1 AND account_id = $2`, id, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to delete app password: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return consts.ErrDBNotFound
+	}
+	return nil
+}
+
+// RecordAppPasswordUse stores when and from where an app password was last
+// used. Repeated logins from the same address within a minute are not
+// written again.
+func (db *Database) RecordAppPasswordUse(ctx context.Context, tx pgx.Tx, id int64, remoteIP string) error {
+	if host, _, err := net.SplitHostPort(remoteIP); err == nil {
+		remoteIP = host
+	}
+	_, err := tx.Exec(ctx, `
+		UPDATE app_passwords
+		SET last_used_at = now(), last_used_ip = NULLIF($2, '')
+		WHERE id = $1
+		  AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute'
+		       OR last_used_ip IS DISTINCT FROM NULLIF($2, ''))
+	`, id, remoteIP)
+	if err != nil {
+		return fmt.Errorf("failed to record app password use: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppPassword_Normalize(t *testing.T) {
+	a := AppPassword{
+		Name:       " Phone ",
+		Protocols:  []string{"IMAP", "submission", "imap"},
+		AllowedIPs: []string{"192.0.2.7/24", "2001:db8::1", "::ffff:198.51.100.1"},
+	}
+	require.NoError(t, a.normalize())
+	assert.Equal(t, "Phone", a.Name)
+	assert.Equal(t, []string{"imap", "submission"}, a.Protocols)
+	assert.Equal(t, []string{"192.0.2.0/24", "2001:db8::1/128", "198.51.100.1/32"}, a.AllowedIPs)
+
+	invalid := []AppPassword{
+		{Name: "", Protocols: []string{"imap"}},
+		{Name: "x", Protocols: nil},
+		{Name: "x", Protocols: []string{"smtp"}},
+		{Name: "x", Protocols: []string{"imap"}, AllowedIPs: []string{"not-an-ip"}},
+	}
+	for _, a := range invalid {
+		assert.Error(t, a.normalize(), "%+v", a)
+	}
+}
+
+func TestGenerateAppPasswordSecret(t *testing.T) {
+	secret, err := GenerateAppPasswordSecret()
+	require.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^[a-z]{4}-[a-z]{4}-[a-z]{4}-[a-z]{4}$`), secret)
+	assert.Equal(t, appPasswordLength, len(normalizeAppPasswordSecret(secret)))
+
+	other, err := GenerateAppPasswordSecret()
+	require.NoError(t, err)
+	assert.NotEqual(t, secret, other)
+}
+
+func TestAppPasswordCredential_Allows(t *testing.T) {
+	c := AppPasswordCredential{Protocols: []string{"imap", "pop3"}}
+	assert.True(t, c.Allows("imap", "203.0.113.9:1234"))
+	assert.False(t, c.Allows("submission", "203.0.113.9"))
+	assert.False(t, c.Allows("", "203.0.113.9"))
+
+	c.AllowedIPs = []string{"192.0.2.0/24", "2001:db8::/32"}
+	assert.True(t, c.Allows("imap", "192.0.2.10"))
+	assert.True(t, c.Allows("imap", "192.0.2.10:993"))
+	assert.True(t, c.Allows("imap", "[2001:db8::5]:993"))
+	assert.True(t, c.Allows("imap", "::ffff:192.0.2.10"))
+	assert.False(t, c.Allows("imap", "198.51.100.1"))
+	assert.False(t, c.Allows("imap", ""))
+}
+
+func TestAuthCredentials_Verify(t *testing.T) {
+	secret := "abcd-efgh-ijkl-mnop"
+	creds := AuthCredentials{
+		AccountID:      1,
+		HashedPassword: GenerateSHA512Hash("account-password"),
+		AppPasswords: []AppPasswordCredential{
+			{ID: 7, HashedPassword: GenerateSHA512Hash(normalizeAppPasswordSecret(secret)), Protocols: []string{"imap"}},
+		},
+	}
+
+	app, err := creds.Verify("account-password", "pop3", "192.0.2.1")
+	require.NoError(t, err)
+	assert.Nil(t, app)
+
+	app, err = creds.Verify(secret, "imap", "192.0.2.1")
+	require.NoError(t, err)
+	require.NotNil(t, app)
+	assert.Equal(t, int64(7), app.ID)
+
+	// Separators and case are ignored
+	app, err = creds.Verify("ABCD EFGH IJKL MNOP", "imap", "192.0.2.1")
+	require.NoError(t, err)
+	require.NotNil(t, app)
+
+	_, err = creds.Verify(secret, "pop3", "192.0.2.1")
+	assert.Error(t, err)
+	_, err = creds.Verify("wrong", "imap", "192.0.2.1")
+	assert.Error(t, err)
+
+	// Accounts without a password can only log in with app passwords
+	creds.HashedPassword = ""
+	_, err = creds.Verify("", "imap", "192.0.2.1")
+	assert.Error(t, err)
+	app, err = creds.Verify(secret, "imap", "192.0.2.1")
+	require.NoError(t, err)
+	assert.NotNil(t, app)
+}
+
+// TestAppPasswords tests creating, using and revoking app passwords.
+func TestAppPasswords(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping database integration test in short mode")
+	}
+
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	email := fmt.Sprintf("apppw-%d@example.com", time.Now().UnixNano())
+	var accountID int64
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) (err error) {
+		accountID, err = db.CreateAccount(ctx, tx, CreateAccountRequest{Email: email, Password: "password123", IsPrimary: true, HashType: "bcrypt"})
+		return err
+	}))
+
+	var created *AppPassword
+	var secret string
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) (err error) {
+		created, secret, err = db.CreateAppPassword(ctx, tx, accountID, AppPassword{
+			Name:       "Phone",
+			Protocols:  []string{"imap"},
+			AllowedIPs: []string{"192.0.2.0/24"},
+		})
+		return err
+	}))
+	assert.NotZero(t, created.ID)
+
+	err := inTestTx(t, db, func(tx pgx.Tx) error {
+		_, _, err := db.CreateAppPassword(ctx, tx, accountID, AppPassword{Name: "Phone", Protocols: []string{"pop3"}})
+		return err
+	})
+	assert.ErrorIs(t, err, consts.ErrDBUniqueViolation)
+
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		_, _, err := db.CreateAppPassword(ctx, tx, accountID, AppPassword{Name: "Bad", Protocols: []string{"smtp"}})
+		return err
+	})
+	assert.ErrorIs(t, err, consts.ErrInvalidInput)
+
+	// Both the account password and the app password authenticate
+	creds, err := db.GetAuthCredentials(ctx, email)
+	require.NoError(t, err)
+	assert.Equal(t, accountID, creds.AccountID)
+	require.Len(t, creds.AppPasswords, 1)
+	app, err := creds.Verify(secret, "imap", "192.0.2.44:50000")
+	require.NoError(t, err)
+	require.NotNil(t, app)
+	assert.Equal(t, created.ID, app.ID)
+	_, err = creds.Verify(secret, "imap", "198.51.100.1")
+	assert.Error(t, err)
+	app, err = creds.Verify("password123", "imap", "198.51.100.1")
+	require.NoError(t, err)
+	assert.Nil(t, app)
+
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.RecordAppPasswordUse(ctx, tx, created.ID, "192.0.2.44:50000")
+	}))
+	list, err := db.ListAppPasswords(ctx, accountID)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "Phone", list[0].Name)
+	require.NotNil(t, list[0].LastUsedAt)
+	assert.Equal(t, "192.0.2.44", list[0].LastUsedIP)
+
+	exists, err := db.AppPasswordExists(ctx, accountID, created.ID)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.DeleteAppPassword(ctx, tx, accountID, created.ID)
+	}))
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.DeleteAppPassword(ctx, tx, accountID, created.ID)
+	})
+	assert.ErrorIs(t, err, consts.ErrDBNotFound)
+
+	creds, err = db.GetAuthCredentials(ctx, email)
+	require.NoError(t, err)
+	assert.Empty(t, creds.AppPasswords)
+	_, err = creds.Verify(secret, "imap", "192.0.2.44")
+	assert.Error(t, err)
+}
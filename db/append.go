@@ -90,14 +90,14 @@ func (db *Database) CopyMessages(ctx context.Context, tx pgx.Tx, uids *[]imap.UI
 	// persistently.  Preserve only the source message's existing flags.
 	_, err = tx.Exec(ctx, `
 		INSERT INTO messages (
-			account_id, content_hash, uploaded, message_id, in_reply_to, 
+			account_id, content_hash, uploaded, message_id, in_reply_to, message_references,
 			subject, sent_date, internal_date, flags, custom_flags, size, 
 			body_structure, recipients_json, s3_domain, s3_localpart,
 			subject_sort, from_name_sort, from_email_sort, to_name_sort, to_email_sort, cc_email_sort,
 			mailbox_id, mailbox_path, flags_changed_at, created_modseq, uid
 		)
 		SELECT 
-			m.account_id, m.content_hash, m.uploaded, m.message_id, m.in_reply_to,
+			m.account_id, m.content_hash, m.uploaded, m.message_id, m.in_reply_to, m.message_references,
 			m.subject, m.sent_date, m.internal_date, m.flags, m.custom_flags, m.size,
 			m.body_structure, m.recipients_json, m.s3_domain, m.s3_localpart,
 			m.subject_sort, m.from_name_sort, m.from_email_sort, m.to_name_sort, m.to_email_sort, m.cc_email_sort,
@@ -113,6 +113,10 @@ func (db *Database) CopyMessages(ctx context.Context, tx pgx.Tx, uids *[]imap.UI
 		return nil, fmt.Errorf("failed to batch copy messages: %w", err)
 	}
 
+	if err := notifyMailboxChange(ctx, tx, destMailboxID); err != nil {
+		return nil, err
+	}
+
 	return messageUIDMap, nil
 }
 
@@ -132,6 +136,7 @@ type InsertMessageOptions struct {
 	PlaintextBody        string
 	SentDate             time.Time
 	InReplyTo            []string
+	References           []string // Message IDs of the References header, oldest first
 	BodyStructure        *imap.BodyStructure
 	Recipients           []helpers.Recipient
 	RawHeaders           string
@@ -355,39 +360,41 @@ func (d *Database) InsertMessage(ctx context.Context, tx pgx.Tx, options *Insert
 	// Sanitize inputs
 	saneSubject := helpers.SanitizeUTF8(options.Subject)
 	saneInReplyToStr := helpers.SanitizeUTF8(inReplyToStr)
+	saneReferences := sanitizeMessageIDs(options.References)
 	sanePlaintextBody := helpers.SanitizeUTF8(options.PlaintextBody)
 	saneRawHeaders := helpers.SanitizeUTF8(options.RawHeaders)
 
 	err = tx.QueryRow(ctx, `
 		INSERT INTO messages
-			(account_id, mailbox_id, mailbox_path, uid, message_id, content_hash, s3_domain, s3_localpart, flags, custom_flags, internal_date, size, subject, sent_date, in_reply_to, body_structure, recipients_json, created_modseq, subject_sort, from_name_sort, from_email_sort, to_name_sort, to_email_sort, cc_email_sort)
+			(account_id, mailbox_id, mailbox_path, uid, message_id, content_hash, s3_domain, s3_localpart, flags, custom_flags, internal_date, size, subject, sent_date, in_reply_to, message_references, body_structure, recipients_json, created_modseq, subject_sort, from_name_sort, from_email_sort, to_name_sort, to_email_sort, cc_email_sort)
 		VALUES
-			(@account_id, @mailbox_id, @mailbox_path, @uid, @message_id, @content_hash, @s3_domain, @s3_localpart, @flags, @custom_flags, @internal_date, @size, @subject, @sent_date, @in_reply_to, @body_structure, @recipients_json, nextval('messages_modseq'), @subject_sort, @from_name_sort, @from_email_sort, @to_name_sort, @to_email_sort, @cc_email_sort)
+			(@account_id, @mailbox_id, @mailbox_path, @uid, @message_id, @content_hash, @s3_domain, @s3_localpart, @flags, @custom_flags, @internal_date, @size, @subject, @sent_date, @in_reply_to, @message_references, @body_structure, @recipients_json, nextval('messages_modseq'), @subject_sort, @from_name_sort, @from_email_sort, @to_name_sort, @to_email_sort, @cc_email_sort)
 		RETURNING id
 	`, pgx.NamedArgs{
-		"account_id":      options.AccountID,
-		"mailbox_id":      options.MailboxID,
-		"mailbox_path":    saneMailboxName,
-		"s3_domain":       options.S3Domain,
-		"s3_localpart":    options.S3Localpart,
-		"uid":             uidToUse,
-		"message_id":      saneMessageID,
-		"content_hash":    options.ContentHash,
-		"flags":           bitwiseFlags,
-		"custom_flags":    customKeywordsJSON,
-		"internal_date":   options.InternalDate,
-		"size":            options.Size,
-		"subject":         saneSubject,
-		"sent_date":       options.SentDate,
-		"in_reply_to":     saneInReplyToStr,
-		"body_structure":  bodyStructureData,
-		"recipients_json": recipientsJSON,
-		"subject_sort":    subjectSort,
-		"from_name_sort":  fromNameSort,
-		"from_email_sort": fromEmailSort,
-		"to_name_sort":    toNameSort,
-		"to_email_sort":   toEmailSort,
-		"cc_email_sort":   ccEmailSort,
+		"account_id":         options.AccountID,
+		"mailbox_id":         options.MailboxID,
+		"mailbox_path":       saneMailboxName,
+		"s3_domain":          options.S3Domain,
+		"s3_localpart":       options.S3Localpart,
+		"uid":                uidToUse,
+		"message_id":         saneMessageID,
+		"content_hash":       options.ContentHash,
+		"flags":              bitwiseFlags,
+		"custom_flags":       customKeywordsJSON,
+		"internal_date":      options.InternalDate,
+		"size":               options.Size,
+		"subject":            saneSubject,
+		"sent_date":          options.SentDate,
+		"in_reply_to":        saneInReplyToStr,
+		"message_references": saneReferences,
+		"body_structure":     bodyStructureData,
+		"recipients_json":    recipientsJSON,
+		"subject_sort":       subjectSort,
+		"from_name_sort":     fromNameSort,
+		"from_email_sort":    fromEmailSort,
+		"to_name_sort":       toNameSort,
+		"to_email_sort":      toEmailSort,
+		"cc_email_sort":      ccEmailSort,
 	}).Scan(&messageRowId)
 
 	if err != nil {
@@ -591,9 +598,38 @@ func (d *Database) InsertMessage(ctx context.Context, tx pgx.Tx, options *Insert
 		}
 	}
 
+	if err := notifyMailboxChange(ctx, tx, options.MailboxID); err != nil {
+		return 0, 0, err
+	}
+
 	return messageRowId, uidToUse, nil
 }
 
+// InsertMessageIntoMailboxes inserts a message into several mailboxes of an
+// account in the caller's transaction, so that either all copies are
+// delivered or none is, as a Sieve script filing a message into several
+// mailboxes requires. Mailboxes already holding the message are skipped;
+// ErrMessageExists is only returned if all of them do. The returned UIDs
+// are in the order of options, with 0 for skipped mailboxes.
+func (d *Database) InsertMessageIntoMailboxes(ctx context.Context, tx pgx.Tx, options []*InsertMessageOptions, upload PendingUpload) (uids []int64, err error) {
+	uids = make([]int64, len(options))
+	inserted := 0
+	for i, opts := range options {
+		_, uid, err := d.InsertMessage(ctx, tx, opts, upload)
+		if err != nil && !errors.Is(err, consts.ErrMessageExists) {
+			return nil, err
+		}
+		if err == nil {
+			uids[i] = uid
+			inserted++
+		}
+	}
+	if inserted == 0 {
+		return uids, consts.ErrMessageExists
+	}
+	return uids, nil
+}
+
 func (d *Database) InsertMessageFromImporter(ctx context.Context, tx pgx.Tx, options *InsertMessageOptions) (messageID int64, uid int64, err error) {
 	// Sanitize user-controlled text fields that go into PostgreSQL text columns.
 	// S3Domain, S3Localpart, and ContentHash are system-generated and don't need sanitization.
@@ -794,39 +830,41 @@ func (d *Database) InsertMessageFromImporter(ctx context.Context, tx pgx.Tx, opt
 	// Sanitize inputs
 	saneSubject := helpers.SanitizeUTF8(options.Subject)
 	saneInReplyToStr := helpers.SanitizeUTF8(inReplyToStr)
+	saneReferences := sanitizeMessageIDs(options.References)
 	sanePlaintextBody := helpers.SanitizeUTF8(options.PlaintextBody)
 	saneRawHeaders := helpers.SanitizeUTF8(options.RawHeaders)
 
 	err = tx.QueryRow(ctx, `
 		INSERT INTO messages
-			(account_id, mailbox_id, mailbox_path, uid, message_id, content_hash, s3_domain, s3_localpart, flags, custom_flags, internal_date, size, subject, sent_date, in_reply_to, body_structure, recipients_json, uploaded, created_modseq, subject_sort, from_name_sort, from_email_sort, to_name_sort, to_email_sort, cc_email_sort)
+			(account_id, mailbox_id, mailbox_path, uid, message_id, content_hash, s3_domain, s3_localpart, flags, custom_flags, internal_date, size, subject, sent_date, in_reply_to, message_references, body_structure, recipients_json, uploaded, created_modseq, subject_sort, from_name_sort, from_email_sort, to_name_sort, to_email_sort, cc_email_sort)
 		VALUES
-			(@account_id, @mailbox_id, @mailbox_path, @uid, @message_id, @content_hash, @s3_domain, @s3_localpart, @flags, @custom_flags, @internal_date, @size, @subject, @sent_date, @in_reply_to, @body_structure, @recipients_json, true, nextval('messages_modseq'), @subject_sort, @from_name_sort, @from_email_sort, @to_name_sort, @to_email_sort, @cc_email_sort)
+			(@account_id, @mailbox_id, @mailbox_path, @uid, @message_id, @content_hash, @s3_domain, @s3_localpart, @flags, @custom_flags, @internal_date, @size, @subject, @sent_date, @in_reply_to, @message_references, @body_structure, @recipients_json, true, nextval('messages_modseq'), @subject_sort, @from_name_sort, @from_email_sort, @to_name_sort, @to_email_sort, @cc_email_sort)
 		RETURNING id
 	`, pgx.NamedArgs{
-		"account_id":      options.AccountID,
-		"mailbox_id":      options.MailboxID,
-		"mailbox_path":    saneMailboxName,
-		"s3_domain":       options.S3Domain,
-		"s3_localpart":    options.S3Localpart,
-		"uid":             uidToUse,
-		"message_id":      saneMessageID,
-		"content_hash":    options.ContentHash,
-		"flags":           bitwiseFlags,
-		"custom_flags":    customKeywordsJSON,
-		"internal_date":   options.InternalDate,
-		"size":            options.Size,
-		"subject":         saneSubject,
-		"sent_date":       options.SentDate,
-		"in_reply_to":     saneInReplyToStr,
-		"body_structure":  bodyStructureData,
-		"recipients_json": recipientsJSON,
-		"subject_sort":    subjectSort,
-		"from_name_sort":  fromNameSort,
-		"from_email_sort": fromEmailSort,
-		"to_name_sort":    toNameSort,
-		"to_email_sort":   toEmailSort,
-		"cc_email_sort":   ccEmailSort,
+		"account_id":         options.AccountID,
+		"mailbox_id":         options.MailboxID,
+		"mailbox_path":       saneMailboxName,
+		"s3_domain":          options.S3Domain,
+		"s3_localpart":       options.S3Localpart,
+		"uid":                uidToUse,
+		"message_id":         saneMessageID,
+		"content_hash":       options.ContentHash,
+		"flags":              bitwiseFlags,
+		"custom_flags":       customKeywordsJSON,
+		"internal_date":      options.InternalDate,
+		"size":               options.Size,
+		"subject":            saneSubject,
+		"sent_date":          options.SentDate,
+		"in_reply_to":        saneInReplyToStr,
+		"message_references": saneReferences,
+		"body_structure":     bodyStructureData,
+		"recipients_json":    recipientsJSON,
+		"subject_sort":       subjectSort,
+		"from_name_sort":     fromNameSort,
+		"from_email_sort":    fromEmailSort,
+		"to_name_sort":       toNameSort,
+		"to_email_sort":      toEmailSort,
+		"cc_email_sort":      ccEmailSort,
 	}).Scan(&messageRowId)
 
 	if err != nil {
@@ -939,5 +977,9 @@ func (d *Database) InsertMessageFromImporter(ctx context.Context, tx pgx.Tx, opt
 		}
 	}
 
+	if err := notifyMailboxChange(ctx, tx, options.MailboxID); err != nil {
+		return 0, 0, err
+	}
+
 	return messageRowId, uidToUse, nil
 }
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Audit sources and results
+const (
+	AuditSourceAPI = "api"
+	AuditSourceCLI = "cli"
+
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+// maxAuditListLimit caps the number of entries returned by one query.
+const maxAuditListLimit = 10000
+
+// AdminAuditEntry is one record of a mutating administrative operation.
+type AdminAuditEntry struct {
+	ID            int64     `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	Actor         string    `json:"actor"`
+	Source        string    `json:"source"`
+	SourceIP      string    `json:"source_ip,omitempty"`
+	Action        string    `json:"action"`
+	TargetAccount string    `json:"target_account,omitempty"`
+	TargetMailbox string    `json:"target_mailbox,omitempty"`
+	PayloadHash   string    `json:"payload_hash,omitempty"`
+	Result        string    `json:"result"`
+	StatusCode    int       `json:"status_code"`
+	Error         string    `json:"error,omitempty"`
+}
+
+func (e *AdminAuditEntry) validate() error {
+	if e.Actor == "" {
+		return fmt.Errorf("audit actor is required")
+	}
+	if e.Action == "" {
+		return fmt.Errorf("audit action is required")
+	}
+	if e.Source != AuditSourceAPI && e.Source != AuditSourceCLI {
+		return fmt.Errorf("invalid audit source: %q", e.Source)
+	}
+	if e.Result != AuditResultSuccess && e.Result != AuditResultFailure {
+		return fmt.Errorf("invalid audit result: %q", e.Result)
+	}
+	return nil
+}
+
+// AdminAuditFilter selects audit entries. Zero values match everything.
+type AdminAuditFilter struct {
+	Since    time.Time // Inclusive
+	Until    time.Time // Exclusive
+	Actor    string
+	Action   string // Exact match, or prefix match when ending in '*' (e.g. "account.*")
+	Account  string // Target account, case-insensitive
+	Source   string
+	Result   string
+	BeforeID int64 // Pagination: only entries with a smaller ID
+	Limit    int   // Default 100, at most 10000
+}
+
+// InsertAdminAuditEntry appends an entry to the audit log and returns its ID.
+func (db *Database) InsertAdminAuditEntry(ctx context.Context, tx pgx.Tx, entry AdminAuditEntry) (int64, error) {
+	if err := entry.validate(); err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err := tx.QueryRow(ctx, `
+		INSERT INTO admin_audit_log (actor, source, source_ip, action, target_account, target_mailbox,
+			payload_hash, result, status_code, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`, entry.Actor, entry.Source, entry.SourceIP, entry.Action, strings.ToLower(entry.TargetAccount),
+		entry.TargetMailbox, entry.PayloadHash, entry.Result, entry.StatusCode, entry.Error).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert audit entry: %w", err)
+	}
+	return id, nil
+}
+
+// ListAdminAuditEntries returns the entries matching filter, newest first.
+func (db *Database) ListAdminAuditEntries(ctx context.Context, filter AdminAuditFilter) ([]AdminAuditEntry, error) {
+	var conds []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if !filter.Since.IsZero() {
+		add("created_at >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		add("created_at < $%d", filter.Until)
+	}
+	if filter.Actor != "" {
+		add("actor = $%d", filter.Actor)
+	}
+	if prefix, ok := strings.CutSuffix(filter.Action, "*"); ok {
+		add("starts_with(action, $%d)", prefix)
+	} else if filter.Action != "" {
+		add("action = $%d", filter.Action)
+	}
+	if filter.Account != "" {
+		add("target_account = $%d", strings.ToLower(filter.Account))
+	}
+	if filter.Source != "" {
+		add("source = $%d", filter.Source)
+	}
+	if filter.Result != "" {
+		add("result = $%d", filter.Result)
+	}
+	if filter.BeforeID > 0 {
+		add("id < $%d", filter.BeforeID)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	if limit > maxAuditListLimit {
+		limit = maxAuditListLimit
+	}
+
+	query := `
+		SELECT id, created_at, actor, source, source_ip, action, target_account, target_mailbox,
+			payload_hash, result, status_code, error
+		FROM admin_audit_log`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []AdminAuditEntry{}
+	for rows.Next() {
+		var e AdminAuditEntry
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.Actor, &e.Source, &e.SourceIP, &e.Action,
+			&e.TargetAccount, &e.TargetMailbox, &e.PayloadHash, &e.Result, &e.StatusCode, &e.Error); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminAuditEntry_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   AdminAuditEntry
+		wantErr bool
+	}{
+		{"api", AdminAuditEntry{Actor: "api-key:abc", Source: AuditSourceAPI, Action: "account.delete", Result: AuditResultSuccess}, false},
+		{"cli", AdminAuditEntry{Actor: "cli:root", Source: AuditSourceCLI, Action: "accounts.create", Result: AuditResultFailure}, false},
+		{"missing actor", AdminAuditEntry{Source: AuditSourceAPI, Action: "account.delete", Result: AuditResultSuccess}, true},
+		{"missing action", AdminAuditEntry{Actor: "cli:root", Source: AuditSourceCLI, Result: AuditResultSuccess}, true},
+		{"unknown source", AdminAuditEntry{Actor: "cli:root", Source: "web", Action: "x", Result: AuditResultSuccess}, true},
+		{"unknown result", AdminAuditEntry{Actor: "cli:root", Source: AuditSourceCLI, Action: "x", Result: "ok"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.entry.validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestAdminAuditLog tests writing and filtering audit entries against the database
+func TestAdminAuditLog(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping database integration test in short mode")
+	}
+
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	start := time.Now().Add(-time.Second)
+	actor := fmt.Sprintf("cli:test-%d", time.Now().UnixNano())
+	account := fmt.Sprintf("User-%d@Example.com", time.Now().UnixNano())
+
+	tx, err := db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+	firstID, err := db.InsertAdminAuditEntry(ctx, tx, AdminAuditEntry{
+		Actor: actor, Source: AuditSourceCLI, Action: "account.update", TargetAccount: account,
+		PayloadHash: "abc", Result: AuditResultSuccess,
+	})
+	require.NoError(t, err)
+	secondID, err := db.InsertAdminAuditEntry(ctx, tx, AdminAuditEntry{
+		Actor: actor, Source: AuditSourceCLI, Action: "account.delete", TargetAccount: account,
+		Result: AuditResultFailure, StatusCode: 1, Error: "boom",
+	})
+	require.NoError(t, err)
+	_, err = db.InsertAdminAuditEntry(ctx, tx, AdminAuditEntry{
+		Actor: actor, Source: AuditSourceCLI, Action: "cache.purge", Result: AuditResultSuccess,
+	})
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit(ctx))
+
+	entries, err := db.ListAdminAuditEntries(ctx, AdminAuditFilter{Actor: actor, Since: start})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Greater(t, entries[0].ID, entries[1].ID, "newest first")
+
+	entries, err = db.ListAdminAuditEntries(ctx, AdminAuditFilter{Actor: actor, Account: account})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, secondID, entries[0].ID)
+	assert.Equal(t, "boom", entries[0].Error)
+	assert.Equal(t, firstID, entries[1].ID)
+	assert.Equal(t, "abc", entries[1].PayloadHash)
+
+	entries, err = db.ListAdminAuditEntries(ctx, AdminAuditFilter{Actor: actor, Action: "account.*", Result: AuditResultSuccess})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, firstID, entries[0].ID)
+
+	entries, err = db.ListAdminAuditEntries(ctx, AdminAuditFilter{Actor: actor, BeforeID: secondID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, firstID, entries[0].ID)
+
+	entries, err = db.ListAdminAuditEntries(ctx, AdminAuditFilter{Actor: actor, Until: start})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -7,6 +7,7 @@ import (
 	"crypto/sha512"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -313,8 +314,20 @@ func (db *Database) UpdatePassword(ctx context.Context, tx pgx.Tx, address strin
 }
 
 // GetCredentialForAuth retrieves the account ID and hashed password for a given address.
-// It does not perform any password verification.
+// It does not perform any password verification and ignores app passwords;
+// use GetAuthCredentials to verify logins.
 func (db *Database) GetCredentialForAuth(ctx context.Context, address string) (accountID int64, hashedPassword string, err error) {
+	creds, err := db.GetAuthCredentials(ctx, address)
+	if err != nil {
+		return 0, "", err
+	}
+	return creds.AccountID, creds.HashedPassword, nil
+}
+
+// GetAuthCredentials retrieves the account ID, hashed password and app
+// passwords for a given address. It does not perform any password
+// verification; see AuthCredentials.Verify.
+func (db *Database) GetAuthCredentials(ctx context.Context, address string) (creds *AuthCredentials, err error) {
 	start := time.Now()
 	defer func() {
 		status := "success"
@@ -331,27 +344,46 @@ func (db *Database) GetCredentialForAuth(ctx context.Context, address string) (a
 
 	normalizedAddress := strings.ToLower(strings.TrimSpace(address))
 	if normalizedAddress == "" {
-		return 0, "", errors.New("address cannot be empty")
+		return nil, errors.New("address cannot be empty")
 	}
 
+	creds = &AuthCredentials{}
+	var domainStatus, accountStatus string
+	var appPasswords []byte
 	err = db.GetReadPoolWithContext(ctx).QueryRow(ctx, `
-		SELECT c.account_id, c.password
+		SELECT c.account_id, c.password, COALESCE(d.status, 'active'), `+effectiveAccountStatusSQL+`,
+			COALESCE((
+				SELECT json_agg(json_build_object('id', ap.id, 'password', ap.password, 'protocols', ap.protocols, 'allowed_ips', ap.allowed_ips))
+				FROM app_passwords ap
+				WHERE ap.account_id = a.id
+			), '[]')
 		FROM credentials c
 		JOIN accounts a ON c.account_id = a.id
+		LEFT JOIN domains d ON d.name = LOWER(c.domain)
 		WHERE LOWER(c.address) = $1 AND a.deleted_at IS NULL
-	`, normalizedAddress).Scan(&accountID, &hashedPassword)
+	`, normalizedAddress).Scan(&creds.AccountID, &creds.HashedPassword, &domainStatus, &accountStatus, &appPasswords)
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			// Address (identity) not found in the credentials table
-			return 0, "", consts.ErrUserNotFound
+			return nil, consts.ErrUserNotFound
 		}
 		// Log other unexpected database errors
 		logger.Error("Database: error fetching credentials", "address", normalizedAddress, "err", err)
-		return 0, "", fmt.Errorf("database error during authentication: %w", err)
+		return nil, fmt.Errorf("database error during authentication: %w", err)
+	}
+	if domainStatus == DomainStatusSuspended {
+		// Reported as an unknown user so that every protocol rejects the login
+		return nil, fmt.Errorf("%w: %w", consts.ErrDomainSuspended, consts.ErrUserNotFound)
+	}
+	if !AccountStatusAllowsLogin(accountStatus) {
+		return nil, fmt.Errorf("%w: %w", consts.ErrAccountSuspended, consts.ErrUserNotFound)
+	}
+	if err := json.Unmarshal(appPasswords, &creds.AppPasswords); err != nil {
+		return nil, fmt.Errorf("failed to decode app passwords: %w", err)
 	}
 
-	return accountID, hashedPassword, nil
+	return creds, nil
 }
 
 // GetAccountIDByAddress retrieves the main user ID associated with a given identity (address)
@@ -379,30 +411,67 @@ func (db *Database) GetAccountIDByAddress(ctx context.Context, address string) (
 
 // GetActiveAccountIDByAddress retrieves the account ID for a given credential address,
 // ensuring the account is not deleted. This is the preferred method for LMTP/SMTP
-// recipient validation where we need to reject deleted accounts.
+// recipient validation where we need to reject deleted accounts. Addresses of a
+// suspended domain return an error matching both consts.ErrDomainSuspended and
+// consts.ErrUserNotFound; suspended accounts match consts.ErrAccountSuspended
+// and consts.ErrUserNotFound.
 func (db *Database) GetActiveAccountIDByAddress(ctx context.Context, address string) (int64, error) {
-	var accountID int64
+	accountID, domainStatus, accountStatus, err := db.getActiveAccount(ctx, address)
+	if err != nil {
+		return 0, err
+	}
+	if domainStatus == DomainStatusSuspended {
+		return 0, fmt.Errorf("%w: %w", consts.ErrDomainSuspended, consts.ErrUserNotFound)
+	}
+	if !AccountStatusAllowsDelivery(accountStatus) {
+		return 0, fmt.Errorf("%w: %w", consts.ErrAccountSuspended, consts.ErrUserNotFound)
+	}
+	return accountID, nil
+}
+
+// GetLoginAccountIDByAddress retrieves the account ID for a given credential
+// address for logins that do not check a password (e.g. OAuth bearer tokens).
+// Deleted accounts, suspended domains and accounts whose status blocks logins
+// are reported like in GetCredentialForAuth.
+func (db *Database) GetLoginAccountIDByAddress(ctx context.Context, address string) (int64, error) {
+	accountID, domainStatus, accountStatus, err := db.getActiveAccount(ctx, address)
+	if err != nil {
+		return 0, err
+	}
+	if domainStatus == DomainStatusSuspended {
+		return 0, fmt.Errorf("%w: %w", consts.ErrDomainSuspended, consts.ErrUserNotFound)
+	}
+	if !AccountStatusAllowsLogin(accountStatus) {
+		return 0, fmt.Errorf("%w: %w", consts.ErrAccountSuspended, consts.ErrUserNotFound)
+	}
+	return accountID, nil
+}
+
+// getActiveAccount looks up the non-deleted account of a credential address
+// along with the status of its domain and its effective status.
+func (db *Database) getActiveAccount(ctx context.Context, address string) (accountID int64, domainStatus, accountStatus string, err error) {
 	normalizedAddress := strings.ToLower(strings.TrimSpace(address))
 
 	if normalizedAddress == "" {
-		return 0, errors.New("address cannot be empty")
+		return 0, "", "", errors.New("address cannot be empty")
 	}
 
-	// Query credentials with account deletion check
-	err := db.GetReadPoolWithContext(ctx).QueryRow(ctx, `
-		SELECT c.account_id
+	// Query credentials with account deletion and domain suspension check
+	err = db.GetReadPoolWithContext(ctx).QueryRow(ctx, `
+		SELECT c.account_id, COALESCE(d.status, 'active'), `+effectiveAccountStatusSQL+`
 		FROM credentials c
 		JOIN accounts a ON c.account_id = a.id
+		LEFT JOIN domains d ON d.name = LOWER(c.domain)
 		WHERE LOWER(c.address) = $1 AND a.deleted_at IS NULL
-	`, normalizedAddress).Scan(&accountID)
+	`, normalizedAddress).Scan(&accountID, &domainStatus, &accountStatus)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return 0, consts.ErrUserNotFound
+			return 0, "", "", consts.ErrUserNotFound
 		}
 		logger.Error("Database: error fetching active account ID", "address", normalizedAddress, "err", err)
-		return 0, fmt.Errorf("database error fetching active account ID: %w", err)
+		return 0, "", "", fmt.Errorf("database error fetching active account ID: %w", err)
 	}
-	return accountID, nil
+	return accountID, domainStatus, accountStatus, nil
 }
 
 // decodePasswordData handles prefix checking and decoding for common hash formats.
@@ -459,8 +459,17 @@ func (d *Database) GetUnusedContentHashes(ctx context.Context, limit int) ([]str
 }
 
 // CleanupSoftDeletedAccounts permanently deletes accounts that have been soft-deleted
-// for longer than the grace period
+// for longer than the grace period. Accounts whose scheduled deletion time has
+// passed are soft-deleted first, which starts their grace period.
 func (d *Database) CleanupSoftDeletedAccounts(ctx context.Context, tx pgx.Tx, gracePeriod time.Duration) (int64, error) {
+	scheduled, err := d.softDeleteScheduledAccounts(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	if scheduled > 0 {
+		logger.Info("soft-deleted accounts scheduled for deletion", "count", scheduled)
+	}
+
 	threshold := time.Now().Add(-gracePeriod).UTC()
 
 	// Get accounts that have been soft-deleted longer than the grace period
@@ -546,6 +555,7 @@ func (d *Database) HardDeleteAccounts(ctx context.Context, tx pgx.Tx, accountIDs
 		query     string
 	}{
 		{"vacation_responses", "DELETE FROM vacation_responses WHERE account_id = ANY($1)"},
+		{"sieve_notifications", "DELETE FROM sieve_notifications WHERE account_id = ANY($1)"},
 		{"sieve_scripts", "DELETE FROM sieve_scripts WHERE account_id = ANY($1)"},
 		{"pending_uploads", "DELETE FROM pending_uploads WHERE account_id = ANY($1)"},
 		{"mailboxes", "DELETE FROM mailboxes WHERE account_id = ANY($1)"},
@@ -0,0 +1,573 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/server"
+)
+
+// Domain status values.
+const (
+	DomainStatusActive    = "active"
+	DomainStatusSuspended = "suspended"
+)
+
+var domainNameRegexp = regexp.MustCompile(server.DomainNameRegex)
+
+// Domain holds the policies of a mail domain. Addresses whose domain has no
+// row behave as if the domain were active with all defaults.
+type Domain struct {
+	Name            string    `json:"name"`
+	Status          string    `json:"status"`
+	MaxAccounts     *int      `json:"max_accounts"` // nil = unlimited
+	CatchAll        string    `json:"catch_all,omitempty"`
+	SieveExtensions []string  `json:"sieve_extensions"` // nil = all extensions enabled on the server
+	SharedMailboxes bool      `json:"shared_mailboxes"`
+	QuotaStorage    *int64    `json:"quota_storage"`  // Default quota, stored in domain_quotas
+	QuotaMessages   *int64    `json:"quota_messages"` // Default quota, stored in domain_quotas
+	Description     string    `json:"description,omitempty"`
+	AccountCount    int       `json:"account_count"` // Read-only
+	AliasCount      int       `json:"alias_count"`   // Read-only
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Suspended reports whether logins and deliveries are refused for the domain.
+func (d *Domain) Suspended() bool {
+	return d.Status == DomainStatusSuspended
+}
+
+// AllowedSieveExtensions restricts serverExtensions to the extensions allowed
+// for the domain.
+func (d *Domain) AllowedSieveExtensions(serverExtensions []string) []string {
+	if d == nil || d.SieveExtensions == nil {
+		return serverExtensions
+	}
+	allowed := make([]string, 0, len(serverExtensions))
+	for _, ext := range serverExtensions {
+		if slices.Contains(d.SieveExtensions, strings.ToLower(ext)) {
+			allowed = append(allowed, ext)
+		}
+	}
+	return allowed
+}
+
+func (d *Domain) normalize() error {
+	d.Name = strings.ToLower(strings.TrimSpace(d.Name))
+	if !domainNameRegexp.MatchString(d.Name) {
+		return fmt.Errorf("invalid domain: %q", d.Name)
+	}
+	if d.Status == "" {
+		d.Status = DomainStatusActive
+	}
+	if d.Status != DomainStatusActive && d.Status != DomainStatusSuspended {
+		return fmt.Errorf("invalid domain status: %q (must be %q or %q)", d.Status, DomainStatusActive, DomainStatusSuspended)
+	}
+	if d.MaxAccounts != nil && *d.MaxAccounts < 0 {
+		return fmt.Errorf("max accounts cannot be negative")
+	}
+	if d.QuotaStorage != nil && *d.QuotaStorage < 0 {
+		return fmt.Errorf("storage limit cannot be negative")
+	}
+	if d.QuotaMessages != nil && *d.QuotaMessages < 0 {
+		return fmt.Errorf("message limit cannot be negative")
+	}
+	if d.CatchAll != "" {
+		targets, err := normalizeAliasTargets([]string{d.CatchAll})
+		if err != nil {
+			return fmt.Errorf("invalid catch-all: %w", err)
+		}
+		d.CatchAll = targets[0]
+	}
+	if d.SieveExtensions != nil {
+		extensions := make([]string, 0, len(d.SieveExtensions))
+		for _, ext := range d.SieveExtensions {
+			ext = strings.ToLower(strings.TrimSpace(ext))
+			if ext != "" && !slices.Contains(extensions, ext) {
+				extensions = append(extensions, ext)
+			}
+		}
+		d.SieveExtensions = extensions
+	}
+	return nil
+}
+
+const domainColumns = `
+	d.name, d.status, d.max_accounts, COALESCE(d.catch_all, ''), d.sieve_extensions, d.shared_mailboxes,
+	dq.quota_storage, dq.quota_messages, d.description,
+	(SELECT COUNT(DISTINCT c.account_id) FROM credentials c JOIN accounts a ON a.id = c.account_id
+	 WHERE c.domain = d.name AND a.deleted_at IS NULL),
+	(SELECT COUNT(*) FROM aliases al WHERE al.domain = d.name),
+	d.created_at, d.updated_at`
+
+const domainFrom = `
+	FROM domains d
+	LEFT JOIN domain_quotas dq ON dq.domain = d.name`
+
+func scanDomain(row pgx.Row) (*Domain, error) {
+	var d Domain
+	err := row.Scan(&d.Name, &d.Status, &d.MaxAccounts, &d.CatchAll, &d.SieveExtensions, &d.SharedMailboxes,
+		&d.QuotaStorage, &d.QuotaMessages, &d.Description, &d.AccountCount, &d.AliasCount,
+		&d.CreatedAt, &d.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// CreateDomain stores a new domain together with its default quota. It returns
+// consts.ErrDBUniqueViolation if the domain already exists.
+func (db *Database) CreateDomain(ctx context.Context, tx pgx.Tx, d Domain) error {
+	if err := d.normalize(); err != nil {
+		return fmt.Errorf("%w: %w", consts.ErrInvalidInput, err)
+	}
+	if err := checkAliasTargets(ctx, tx, d.CatchAll); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO domains (name, status, max_accounts, catch_all, sieve_extensions, shared_mailboxes, description)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7)
+	`, d.Name, d.Status, d.MaxAccounts, d.CatchAll, d.SieveExtensions, d.SharedMailboxes, d.Description)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return consts.ErrDBUniqueViolation
+		}
+		return fmt.Errorf("failed to create domain %s: %w", d.Name, err)
+	}
+
+	return db.setDomainDefaultQuota(ctx, tx, d)
+}
+
+// GetDomain returns a domain by name, or consts.ErrDBNotFound.
+func (db *Database) GetDomain(ctx context.Context, name string) (*Domain, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	row := db.GetReadPoolWithContext(ctx).QueryRow(ctx, `SELECT `+domainColumns+domainFrom+` WHERE d.name = $1`, name)
+	d, err := scanDomain(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, consts.ErrDBNotFound
+		}
+		return nil, fmt.Errorf("failed to get domain %s: %w", name, err)
+	}
+	return d, nil
+}
+
+// ListDomains returns all domains ordered by name.
+func (db *Database) ListDomains(ctx context.Context) ([]Domain, error) {
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, `SELECT `+domainColumns+domainFrom+` ORDER BY d.name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domains: %w", err)
+	}
+	defer rows.Close()
+
+	domains := []Domain{}
+	for rows.Next() {
+		d, err := scanDomain(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan domain: %w", err)
+		}
+		domains = append(domains, *d)
+	}
+	return domains, rows.Err()
+}
+
+// UpdateDomain replaces the policies and default quota of a domain. Reducing
+// max accounts below the current number of accounts is allowed; it only
+// prevents new accounts from being created.
+func (db *Database) UpdateDomain(ctx context.Context, tx pgx.Tx, d Domain) error {
+	if err := d.normalize(); err != nil {
+		return fmt.Errorf("%w: %w", consts.ErrInvalidInput, err)
+	}
+	if err := checkAliasTargets(ctx, tx, d.CatchAll); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE domains
+		SET status = $2, max_accounts = $3, catch_all = NULLIF($4, ''), sieve_extensions = $5,
+			shared_mailboxes = $6, description = $7, updated_at = now()
+		WHERE name = $1
+	`, d.Name, d.Status, d.MaxAccounts, d.CatchAll, d.SieveExtensions, d.SharedMailboxes, d.Description)
+	if err != nil {
+		return fmt.Errorf("failed to update domain %s: %w", d.Name, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return consts.ErrDBNotFound
+	}
+
+	return db.setDomainDefaultQuota(ctx, tx, d)
+}
+
+// setDomainDefaultQuota stores the default quota of d, removing it when
+// neither limit is set.
+func (db *Database) setDomainDefaultQuota(ctx context.Context, tx pgx.Tx, d Domain) error {
+	if d.QuotaStorage == nil && d.QuotaMessages == nil {
+		if err := db.DeleteDomainQuota(ctx, tx, d.Name); err != nil && !errors.Is(err, consts.ErrDBNotFound) {
+			return err
+		}
+		return nil
+	}
+	return db.SetDomainQuota(ctx, tx, DomainQuota{Domain: d.Name, StorageLimit: d.QuotaStorage, MessagesLimit: d.QuotaMessages})
+}
+
+// DeleteDomain removes a domain, its aliases and its default quota. Accounts
+// of the domain are not touched.
+func (db *Database) DeleteDomain(ctx context.Context, tx pgx.Tx, name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	tag, err := tx.Exec(ctx, `DELETE FROM domains WHERE name = $1`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete domain %s: %w", name, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return consts.ErrDBNotFound
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM domain_quotas WHERE domain = $1`, name); err != nil {
+		return fmt.Errorf("failed to delete quota for domain %s: %w", name, err)
+	}
+	return nil
+}
+
+// checkNewCredential enforces the domain policies for a new credential of
+// accountID (0 for a new account): the address must not be an alias, and the
+// domain must not have reached its account limit unless the account already
+// has an address in it.
+func checkNewCredential(ctx context.Context, tx pgx.Tx, address string, accountID int64) error {
+	var isAlias bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM aliases WHERE address = $1)`, address).Scan(&isAlias); err != nil {
+		return fmt.Errorf("failed to check for alias %s: %w", address, err)
+	}
+	if isAlias {
+		return fmt.Errorf("%w: address %s is an alias", consts.ErrAccountAlreadyExists, address)
+	}
+	domain := address[strings.LastIndex(address, "@")+1:]
+	return checkDomainAccountLimit(ctx, tx, domain, accountID)
+}
+
+// checkDomainAccountLimit returns consts.ErrDomainAccountLimit if the domain
+// has reached its maximum number of accounts. An account that already has an
+// address in the domain does not count as a new one. The domain row is locked
+// so that concurrent account creations are serialized.
+func checkDomainAccountLimit(ctx context.Context, tx pgx.Tx, domain string, accountID int64) error {
+	var maxAccounts *int
+	var count int
+	var member bool
+	err := tx.QueryRow(ctx, `
+		SELECT d.max_accounts,
+			(SELECT COUNT(DISTINCT c.account_id) FROM credentials c JOIN accounts a ON a.id = c.account_id
+			 WHERE c.domain = d.name AND a.deleted_at IS NULL),
+			EXISTS (SELECT 1 FROM credentials c WHERE c.domain = d.name AND c.account_id = $2)
+		FROM domains d
+		WHERE d.name = $1
+		FOR UPDATE OF d
+	`, strings.ToLower(domain), accountID).Scan(&maxAccounts, &count, &member)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("failed to check account limit of domain %s: %w", domain, err)
+	}
+	if maxAccounts != nil && !member && count >= *maxAccounts {
+		return fmt.Errorf("%w: domain %s allows at most %d accounts", consts.ErrDomainAccountLimit, domain, *maxAccounts)
+	}
+	return nil
+}
+
+// Alias is an address that fans out to one or more targets. A target that is
+// the address of an account is delivered locally, any other target is
+// forwarded through the relay.
+type Alias struct {
+	ID          int64     `json:"id"`
+	Address     string    `json:"address"`
+	Domain      string    `json:"domain"`
+	Targets     []string  `json:"targets"`
+	Description string    `json:"description,omitempty"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// normalizeAliasTargets validates and lowercases alias targets, dropping
+// duplicates.
+func normalizeAliasTargets(targets []string) ([]string, error) {
+	normalized := make([]string, 0, len(targets))
+	for _, target := range targets {
+		addr, err := server.NewAddress(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target %q: %w", target, err)
+		}
+		if addr.HasSuffix() {
+			return nil, fmt.Errorf("invalid target %q", target)
+		}
+		if !slices.Contains(normalized, addr.FullAddress()) {
+			normalized = append(normalized, addr.FullAddress())
+		}
+	}
+	if len(normalized) == 0 {
+		return nil, fmt.Errorf("at least one target is required")
+	}
+	return normalized, nil
+}
+
+// checkAliasTargets rejects targets that are aliases themselves. Targets are
+// not expanded recursively, so such a target could never be delivered.
+func checkAliasTargets(ctx context.Context, tx pgx.Tx, targets ...string) error {
+	targets = slices.DeleteFunc(slices.Clone(targets), func(t string) bool { return t == "" })
+	if len(targets) == 0 {
+		return nil
+	}
+	var alias string
+	err := tx.QueryRow(ctx, `SELECT address FROM aliases WHERE address = ANY($1) LIMIT 1`, targets).Scan(&alias)
+	if err == nil {
+		return fmt.Errorf("%w: target %s is an alias; aliases cannot point to other aliases", consts.ErrInvalidInput, alias)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to check alias targets: %w", err)
+	}
+	return nil
+}
+
+func (a *Alias) normalize() error {
+	addr, err := server.NewAddress(a.Address)
+	if err != nil {
+		return fmt.Errorf("invalid alias address: %w", err)
+	}
+	if addr.HasSuffix() || addr.Detail() != "" {
+		return fmt.Errorf("invalid alias address: %q", a.Address)
+	}
+	a.Address = addr.FullAddress()
+	a.Domain = addr.Domain()
+
+	a.Targets, err = normalizeAliasTargets(a.Targets)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(a.Targets, a.Address) {
+		return fmt.Errorf("alias %s cannot target itself", a.Address)
+	}
+	return nil
+}
+
+const aliasColumns = `id, address, domain, targets, description, enabled, created_at, updated_at`
+
+func scanAlias(row pgx.Row) (*Alias, error) {
+	var a Alias
+	err := row.Scan(&a.ID, &a.Address, &a.Domain, &a.Targets, &a.Description, &a.Enabled, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// CreateAlias stores a new alias and returns its ID. The domain of the alias
+// must exist and the address must not belong to an account.
+func (db *Database) CreateAlias(ctx context.Context, tx pgx.Tx, a Alias) (int64, error) {
+	if err := a.normalize(); err != nil {
+		return 0, fmt.Errorf("%w: %w", consts.ErrInvalidInput, err)
+	}
+
+	var exists bool
+	err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM credentials WHERE LOWER(address) = $1)`, a.Address).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check alias address: %w", err)
+	}
+	if exists {
+		return 0, fmt.Errorf("%w: address %s belongs to an account", consts.ErrAccountAlreadyExists, a.Address)
+	}
+	if err := checkAliasTargets(ctx, tx, a.Targets...); err != nil {
+		return 0, err
+	}
+	// Existing aliases and catch-alls must not point to the new alias either
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM aliases WHERE $1 = ANY(targets))
+			OR EXISTS (SELECT 1 FROM domains WHERE catch_all = $1)
+	`, a.Address).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check alias address: %w", err)
+	}
+	if exists {
+		return 0, fmt.Errorf("%w: address %s is the target of another alias or catch-all", consts.ErrInvalidInput, a.Address)
+	}
+
+	var id int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO aliases (address, domain, targets, description, enabled)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, a.Address, a.Domain, a.Targets, a.Description, a.Enabled).Scan(&id)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.Code {
+			case "23505":
+				return 0, consts.ErrDBUniqueViolation
+			case "23503":
+				return 0, fmt.Errorf("%w: domain %s", consts.ErrDBNotFound, a.Domain)
+			}
+		}
+		return 0, fmt.Errorf("failed to create alias %s: %w", a.Address, err)
+	}
+	return id, nil
+}
+
+// GetAlias returns an alias by address, or consts.ErrDBNotFound.
+func (db *Database) GetAlias(ctx context.Context, address string) (*Alias, error) {
+	address = strings.ToLower(strings.TrimSpace(address))
+	row := db.GetReadPoolWithContext(ctx).QueryRow(ctx, `SELECT `+aliasColumns+` FROM aliases WHERE address = $1`, address)
+	a, err := scanAlias(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, consts.ErrDBNotFound
+		}
+		return nil, fmt.Errorf("failed to get alias %s: %w", address, err)
+	}
+	return a, nil
+}
+
+// ListAliases returns the aliases of a domain ordered by address.
+func (db *Database) ListAliases(ctx context.Context, domain string) ([]Alias, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, `SELECT `+aliasColumns+` FROM aliases WHERE domain = $1 ORDER BY address`, domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list aliases of domain %s: %w", domain, err)
+	}
+	defer rows.Close()
+
+	aliases := []Alias{}
+	for rows.Next() {
+		a, err := scanAlias(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan alias: %w", err)
+		}
+		aliases = append(aliases, *a)
+	}
+	return aliases, rows.Err()
+}
+
+// UpdateAlias replaces the targets, description and enabled state of an alias.
+func (db *Database) UpdateAlias(ctx context.Context, tx pgx.Tx, a Alias) error {
+	if err := a.normalize(); err != nil {
+		return fmt.Errorf("%w: %w", consts.ErrInvalidInput, err)
+	}
+	if err := checkAliasTargets(ctx, tx, a.Targets...); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE aliases SET targets = $2, description = $3, enabled = $4, updated_at = now()
+		WHERE address = $1
+	`, a.Address, a.Targets, a.Description, a.Enabled)
+	if err != nil {
+		return fmt.Errorf("failed to update alias %s: %w", a.Address, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return consts.ErrDBNotFound
+	}
+	return nil
+}
+
+// DeleteAlias removes an alias.
+func (db *Database) DeleteAlias(ctx context.Context, tx pgx.Tx, address string) error {
+	address = strings.ToLower(strings.TrimSpace(address))
+	tag, err := tx.Exec(ctx, `DELETE FROM aliases WHERE address = $1`, address)
+	if err != nil {
+		return fmt.Errorf("failed to delete alias %s: %w", address, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return consts.ErrDBNotFound
+	}
+	return nil
+}
+
+// AliasTarget is one destination of a resolved alias. Local targets carry the
+// ID of the receiving account; external targets are forwarded.
+type AliasTarget struct {
+	Address   string `json:"address"`
+	AccountID int64  `json:"account_id,omitempty"`
+}
+
+// IsLocal reports whether the target is an account of this server.
+func (t AliasTarget) IsLocal() bool {
+	return t.AccountID != 0
+}
+
+// ResolveAlias expands an address that does not belong to an account through
+// the aliases and catch-all of its domain. Targets that belong to a deleted
+// account are dropped. It returns consts.ErrUserNotFound if nothing matches,
+// and an error matching both consts.ErrDomainSuspended and
+// consts.ErrUserNotFound if the domain is suspended.
+func (db *Database) ResolveAlias(ctx context.Context, address string) ([]AliasTarget, error) {
+	addr, err := server.NewAddress(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address: %w", err)
+	}
+	lookupAddress := addr.BaseAddress()
+
+	var status string
+	var targets []string
+	err = db.GetReadPoolWithContext(ctx).QueryRow(ctx, `
+		SELECT d.status, COALESCE(al.targets, CASE WHEN d.catch_all IS NULL THEN NULL ELSE ARRAY[d.catch_all] END)
+		FROM domains d
+		LEFT JOIN aliases al ON al.address = $1 AND al.enabled
+		WHERE d.name = $2
+	`, lookupAddress, addr.Domain()).Scan(&status, &targets)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, consts.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to resolve alias %s: %w", lookupAddress, err)
+	}
+	if status == DomainStatusSuspended {
+		return nil, fmt.Errorf("%w: %w", consts.ErrDomainSuspended, consts.ErrUserNotFound)
+	}
+	if len(targets) == 0 {
+		return nil, consts.ErrUserNotFound
+	}
+
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, `
+		SELECT t.address, c.account_id,
+			a.deleted_at IS NOT NULL OR COALESCE(`+effectiveAccountStatusSQL+` = 'suspended', FALSE)
+		FROM unnest($1::text[]) WITH ORDINALITY AS t(address, ord)
+		LEFT JOIN credentials c ON LOWER(c.address) = t.address
+		LEFT JOIN accounts a ON a.id = c.account_id
+		ORDER BY t.ord
+	`, targets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve targets of alias %s: %w", lookupAddress, err)
+	}
+	defer rows.Close()
+
+	resolved := make([]AliasTarget, 0, len(targets))
+	for rows.Next() {
+		var target AliasTarget
+		var accountID *int64
+		var skip bool // Deleted, or does not accept mail
+		if err := rows.Scan(&target.Address, &accountID, &skip); err != nil {
+			return nil, fmt.Errorf("failed to scan alias target: %w", err)
+		}
+		if accountID != nil {
+			if skip {
+				continue
+			}
+			target.AccountID = *accountID
+		}
+		resolved = append(resolved, target)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to resolve targets of alias %s: %w", lookupAddress, err)
+	}
+	if len(resolved) == 0 {
+		return nil, consts.ErrUserNotFound
+	}
+	return resolved, nil
+}
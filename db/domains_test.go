@@ -0,0 +1,247 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDomain_Normalize(t *testing.T) {
+	negative := -1
+	tests := []struct {
+		name    string
+		domain  Domain
+		wantErr bool
+	}{
+		{"defaults", Domain{Name: "Example.COM"}, false},
+		{"suspended", Domain{Name: "example.com", Status: DomainStatusSuspended}, false},
+		{"catch-all", Domain{Name: "example.com", CatchAll: "Postmaster@Example.com"}, false},
+		{"invalid name", Domain{Name: "not a domain"}, true},
+		{"address as name", Domain{Name: "user@example.com"}, true},
+		{"unknown status", Domain{Name: "example.com", Status: "disabled"}, true},
+		{"negative max accounts", Domain{Name: "example.com", MaxAccounts: &negative}, true},
+		{"invalid catch-all", Domain{Name: "example.com", CatchAll: "postmaster"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.domain.normalize()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "example.com", tt.domain.Name)
+			assert.NotEmpty(t, tt.domain.Status)
+		})
+	}
+
+	d := Domain{Name: "example.com", CatchAll: "Postmaster@Example.com", SieveExtensions: []string{"FileInto", " vacation", "fileinto", ""}}
+	require.NoError(t, d.normalize())
+	assert.Equal(t, "postmaster@example.com", d.CatchAll)
+	assert.Equal(t, []string{"fileinto", "vacation"}, d.SieveExtensions)
+}
+
+func TestDomain_AllowedSieveExtensions(t *testing.T) {
+	server := []string{"fileinto", "vacation", "envelope", "Variables"}
+
+	var missing *Domain
+	assert.Equal(t, server, missing.AllowedSieveExtensions(server))
+	assert.Equal(t, server, (&Domain{}).AllowedSieveExtensions(server))
+	assert.Empty(t, (&Domain{SieveExtensions: []string{}}).AllowedSieveExtensions(server))
+	assert.Equal(t, []string{"vacation", "Variables"},
+		(&Domain{SieveExtensions: []string{"vacation", "variables", "imap4flags"}}).AllowedSieveExtensions(server))
+}
+
+func TestAlias_Normalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		alias   Alias
+		wantErr bool
+	}{
+		{"valid", Alias{Address: "Sales@Example.com", Targets: []string{"alice@example.com", "Bob@Partner.example"}}, false},
+		{"no targets", Alias{Address: "sales@example.com"}, true},
+		{"detail address", Alias{Address: "sales+eu@example.com", Targets: []string{"alice@example.com"}}, true},
+		{"invalid target", Alias{Address: "sales@example.com", Targets: []string{"alice"}}, true},
+		{"self target", Alias{Address: "sales@example.com", Targets: []string{"SALES@example.com"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.alias.normalize()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "sales@example.com", tt.alias.Address)
+			assert.Equal(t, "example.com", tt.alias.Domain)
+		})
+	}
+
+	a := Alias{Address: "team@example.com", Targets: []string{"Alice@Example.com", "alice@example.com", "bob@example.com"}}
+	require.NoError(t, a.normalize())
+	assert.Equal(t, []string{"alice@example.com", "bob@example.com"}, a.Targets)
+}
+
+// inTestTx runs fn in a committed transaction.
+func inTestTx(t *testing.T, db *Database, fn func(tx pgx.Tx) error) error {
+	t.Helper()
+	ctx := context.Background()
+	tx, err := db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// TestDomains tests domain and alias CRUD and their effect on accounts,
+// authentication and recipient resolution.
+func TestDomains(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping database integration test in short mode")
+	}
+
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	domain := fmt.Sprintf("domains-%d.example.com", time.Now().UnixNano())
+	alice, bob := "alice@"+domain, "bob@"+domain
+	defer func() {
+		_ = inTestTx(t, db, func(tx pgx.Tx) error { return db.DeleteDomain(ctx, tx, domain) })
+	}()
+
+	maxAccounts := 2
+	storage := int64(1 << 30)
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.CreateDomain(ctx, tx, Domain{Name: domain, MaxAccounts: &maxAccounts, QuotaStorage: &storage, SharedMailboxes: true})
+	}))
+	err := inTestTx(t, db, func(tx pgx.Tx) error { return db.CreateDomain(ctx, tx, Domain{Name: domain}) })
+	assert.ErrorIs(t, err, consts.ErrDBUniqueViolation)
+
+	d, err := db.GetDomain(ctx, domain)
+	require.NoError(t, err)
+	assert.Equal(t, DomainStatusActive, d.Status)
+	require.NotNil(t, d.QuotaStorage)
+	assert.Equal(t, storage, *d.QuotaStorage)
+	assert.Nil(t, d.SieveExtensions)
+
+	_, err = db.GetDomain(ctx, "missing-"+domain)
+	assert.ErrorIs(t, err, consts.ErrDBNotFound)
+
+	// Accounts count against the limit; an additional address of the same
+	// account does not.
+	var aliceID, bobID int64
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) (err error) {
+		aliceID, err = db.CreateAccount(ctx, tx, CreateAccountRequest{Email: alice, Password: "password123", IsPrimary: true, HashType: "bcrypt"})
+		return err
+	}))
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) (err error) {
+		bobID, err = db.CreateAccount(ctx, tx, CreateAccountRequest{Email: bob, Password: "password123", IsPrimary: true, HashType: "bcrypt"})
+		return err
+	}))
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.AddCredential(ctx, tx, AddCredentialRequest{AccountID: aliceID, NewEmail: "a.smith@" + domain, NewPassword: "password123", NewHashType: "bcrypt"})
+	}))
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		_, err := db.CreateAccount(ctx, tx, CreateAccountRequest{Email: "carol@" + domain, Password: "password123", IsPrimary: true, HashType: "bcrypt"})
+		return err
+	})
+	assert.ErrorIs(t, err, consts.ErrDomainAccountLimit)
+
+	d, err = db.GetDomain(ctx, domain)
+	require.NoError(t, err)
+	assert.Equal(t, 2, d.AccountCount)
+
+	// Aliases fan out to local and external targets
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) error {
+		_, err := db.CreateAlias(ctx, tx, Alias{Address: "sales@" + domain, Targets: []string{alice, bob, "partner@external.example"}, Enabled: true})
+		return err
+	}))
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		_, err := db.CreateAlias(ctx, tx, Alias{Address: alice, Targets: []string{bob}, Enabled: true})
+		return err
+	})
+	assert.ErrorIs(t, err, consts.ErrAccountAlreadyExists)
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		_, err := db.CreateAlias(ctx, tx, Alias{Address: "team@" + domain, Targets: []string{"sales@" + domain}, Enabled: true})
+		return err
+	})
+	assert.ErrorIs(t, err, consts.ErrInvalidInput)
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		_, err := db.CreateAlias(ctx, tx, Alias{Address: "sales@missing-" + domain, Targets: []string{alice}, Enabled: true})
+		return err
+	})
+	assert.ErrorIs(t, err, consts.ErrDBNotFound)
+
+	// An alias address cannot become a credential
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.AddCredential(ctx, tx, AddCredentialRequest{AccountID: bobID, NewEmail: "sales@" + domain, NewPassword: "password123", NewHashType: "bcrypt"})
+	})
+	assert.ErrorIs(t, err, consts.ErrAccountAlreadyExists)
+
+	targets, err := db.ResolveAlias(ctx, "Sales@"+domain)
+	require.NoError(t, err)
+	assert.Equal(t, []AliasTarget{
+		{Address: alice, AccountID: aliceID},
+		{Address: bob, AccountID: bobID},
+		{Address: "partner@external.example"},
+	}, targets)
+
+	_, err = db.ResolveAlias(ctx, "nobody@"+domain)
+	assert.ErrorIs(t, err, consts.ErrUserNotFound)
+
+	// Disabled aliases do not resolve; the catch-all takes unknown addresses
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.UpdateAlias(ctx, tx, Alias{Address: "sales@" + domain, Targets: []string{bob}, Enabled: false})
+	}))
+	_, err = db.ResolveAlias(ctx, "sales@"+domain)
+	assert.ErrorIs(t, err, consts.ErrUserNotFound)
+
+	d.CatchAll = alice
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) error { return db.UpdateDomain(ctx, tx, *d) }))
+	targets, err = db.ResolveAlias(ctx, "nobody@"+domain)
+	require.NoError(t, err)
+	assert.Equal(t, []AliasTarget{{Address: alice, AccountID: aliceID}}, targets)
+
+	aliases, err := db.ListAliases(ctx, domain)
+	require.NoError(t, err)
+	require.Len(t, aliases, 1)
+	assert.False(t, aliases[0].Enabled)
+	assert.Equal(t, []string{bob}, aliases[0].Targets)
+
+	// Suspension refuses logins and deliveries but keeps the accounts
+	d.Status = DomainStatusSuspended
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) error { return db.UpdateDomain(ctx, tx, *d) }))
+
+	_, _, err = db.GetCredentialForAuth(ctx, alice)
+	assert.ErrorIs(t, err, consts.ErrDomainSuspended)
+	assert.ErrorIs(t, err, consts.ErrUserNotFound)
+	_, err = db.GetActiveAccountIDByAddress(ctx, bob)
+	assert.ErrorIs(t, err, consts.ErrDomainSuspended)
+	_, err = db.ResolveAlias(ctx, "nobody@"+domain)
+	assert.ErrorIs(t, err, consts.ErrDomainSuspended)
+
+	d.Status = DomainStatusActive
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) error { return db.UpdateDomain(ctx, tx, *d) }))
+	id, err := db.GetActiveAccountIDByAddress(ctx, bob)
+	require.NoError(t, err)
+	assert.Equal(t, bobID, id)
+
+	// Deleting the domain removes its aliases and default quota
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) error { return db.DeleteDomain(ctx, tx, domain) }))
+	aliases, err = db.ListAliases(ctx, domain)
+	require.NoError(t, err)
+	assert.Empty(t, aliases)
+	_, err = db.GetDomainQuota(ctx, domain)
+	assert.ErrorIs(t, err, consts.ErrDBNotFound)
+}
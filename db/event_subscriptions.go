@@ -0,0 +1,179 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+)
+
+// EventSubscription is a webhook that receives mailbox events. It is scoped to
+// one account, to all accounts of a domain, or to all accounts when neither
+// AccountID nor Domain is set.
+type EventSubscription struct {
+	ID          int64     `json:"id"`
+	AccountID   *int64    `json:"account_id,omitempty"`
+	Email       string    `json:"email,omitempty"` // Primary address of AccountID (read-only)
+	Domain      string    `json:"domain,omitempty"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"-"`
+	EventTypes  []string  `json:"event_types"`
+	Description string    `json:"description,omitempty"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (s *EventSubscription) validate() error {
+	if s.AccountID != nil && s.Domain != "" {
+		return fmt.Errorf("subscription cannot be scoped to both an account and a domain")
+	}
+	if strings.Contains(s.Domain, "@") {
+		return fmt.Errorf("invalid domain: %q", s.Domain)
+	}
+	if !strings.HasPrefix(s.URL, "https://") && !strings.HasPrefix(s.URL, "http://") {
+		return fmt.Errorf("webhook url must be http or https: %q", s.URL)
+	}
+	if s.Secret == "" {
+		return fmt.Errorf("webhook secret is required")
+	}
+	return nil
+}
+
+const eventSubscriptionColumns = `
+	s.id, s.account_id, COALESCE(c.address, ''), COALESCE(s.domain, ''), s.url, s.secret,
+	s.event_types, s.description, s.enabled, s.created_at, s.updated_at`
+
+const eventSubscriptionFrom = `
+	FROM event_subscriptions s
+	LEFT JOIN credentials c ON c.account_id = s.account_id AND c.primary_identity = TRUE`
+
+func scanEventSubscription(row pgx.Row) (*EventSubscription, error) {
+	var sub EventSubscription
+	err := row.Scan(&sub.ID, &sub.AccountID, &sub.Email, &sub.Domain, &sub.URL, &sub.Secret,
+		&sub.EventTypes, &sub.Description, &sub.Enabled, &sub.CreatedAt, &sub.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if sub.EventTypes == nil {
+		sub.EventTypes = []string{}
+	}
+	return &sub, nil
+}
+
+// CreateEventSubscription stores a new webhook subscription and returns its ID.
+func (db *Database) CreateEventSubscription(ctx context.Context, tx pgx.Tx, sub EventSubscription) (int64, error) {
+	sub.Domain = strings.ToLower(strings.TrimSpace(sub.Domain))
+	if err := sub.validate(); err != nil {
+		return 0, err
+	}
+	if sub.EventTypes == nil {
+		sub.EventTypes = []string{}
+	}
+
+	var domain *string
+	if sub.Domain != "" {
+		domain = &sub.Domain
+	}
+
+	var id int64
+	err := tx.QueryRow(ctx, `
+		INSERT INTO event_subscriptions (account_id, domain, url, secret, event_types, description, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, sub.AccountID, domain, sub.URL, sub.Secret, sub.EventTypes, sub.Description, sub.Enabled).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create event subscription: %w", err)
+	}
+	return id, nil
+}
+
+// GetEventSubscription returns a subscription by ID, or consts.ErrDBNotFound.
+func (db *Database) GetEventSubscription(ctx context.Context, id int64) (*EventSubscription, error) {
+	row := db.GetReadPoolWithContext(ctx).QueryRow(ctx, `SELECT `+eventSubscriptionColumns+eventSubscriptionFrom+` WHERE s.id = $1`, id)
+	sub, err := scanEventSubscription(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, consts.ErrDBNotFound
+		}
+		return nil, fmt.Errorf("failed to get event subscription %d: %w", id, err)
+	}
+	return sub, nil
+}
+
+// ListEventSubscriptions returns all subscriptions ordered by ID.
+func (db *Database) ListEventSubscriptions(ctx context.Context) ([]EventSubscription, error) {
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, `SELECT `+eventSubscriptionColumns+eventSubscriptionFrom+` ORDER BY s.id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list event subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subs := []EventSubscription{}
+	for rows.Next() {
+		sub, err := scanEventSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan event subscription: %w", err)
+		}
+		subs = append(subs, *sub)
+	}
+	return subs, rows.Err()
+}
+
+// UpdateEventSubscription replaces the URL, event types, description and
+// enabled state of a subscription. The secret is only replaced if non-empty.
+// The scope of a subscription cannot be changed.
+func (db *Database) UpdateEventSubscription(ctx context.Context, tx pgx.Tx, sub EventSubscription) error {
+	if !strings.HasPrefix(sub.URL, "https://") && !strings.HasPrefix(sub.URL, "http://") {
+		return fmt.Errorf("webhook url must be http or https: %q", sub.URL)
+	}
+	if sub.EventTypes == nil {
+		sub.EventTypes = []string{}
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE event_subscriptions
+		SET url = $2, secret = COALESCE(NULLIF($3, ''), secret), event_types = $4,
+			description = $5, enabled = $6, updated_at = now()
+		WHERE id = $1
+	`, sub.ID, sub.URL, sub.Secret, sub.EventTypes, sub.Description, sub.Enabled)
+	if err != nil {
+		return fmt.Errorf("failed to update event subscription %d: %w", sub.ID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return consts.ErrDBNotFound
+	}
+	return nil
+}
+
+// DeleteEventSubscription removes a subscription. Deliveries that are still
+// queued for it are dropped by the webhook worker.
+func (db *Database) DeleteEventSubscription(ctx context.Context, tx pgx.Tx, id int64) error {
+	tag, err := tx.Exec(ctx, `DELETE FROM event_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete event subscription %d: %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return consts.ErrDBNotFound
+	}
+	return nil
+}
+
+// GetMailboxOwner returns the account and name of a mailbox, or
+// consts.ErrMailboxNotFound if it does not exist.
+func (db *Database) GetMailboxOwner(ctx context.Context, mailboxID int64) (accountID int64, name string, err error) {
+	err = db.GetReadPoolWithContext(ctx).QueryRow(ctx, `
+		SELECT account_id, name FROM mailboxes WHERE id = $1
+	`, mailboxID).Scan(&accountID, &name)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, "", consts.ErrMailboxNotFound
+		}
+		return 0, "", fmt.Errorf("failed to get owner of mailbox %d: %w", mailboxID, err)
+	}
+	return accountID, name, nil
+}
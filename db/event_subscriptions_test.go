@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/migadu/sora/consts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventSubscription_Validate(t *testing.T) {
+	accountID := int64(1)
+	tests := []struct {
+		name    string
+		sub     EventSubscription
+		wantErr bool
+	}{
+		{"global", EventSubscription{URL: "https://example.com/hook", Secret: "s"}, false},
+		{"account", EventSubscription{AccountID: &accountID, URL: "http://example.com/hook", Secret: "s"}, false},
+		{"domain", EventSubscription{Domain: "example.com", URL: "https://example.com/hook", Secret: "s"}, false},
+		{"account and domain", EventSubscription{AccountID: &accountID, Domain: "example.com", URL: "https://example.com/hook", Secret: "s"}, true},
+		{"address as domain", EventSubscription{Domain: "user@example.com", URL: "https://example.com/hook", Secret: "s"}, true},
+		{"invalid url", EventSubscription{URL: "ftp://example.com", Secret: "s"}, true},
+		{"missing secret", EventSubscription{URL: "https://example.com/hook"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.sub.validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestEventSubscriptions tests subscription CRUD against the database
+func TestEventSubscriptions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping database integration test in short mode")
+	}
+
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	domain := fmt.Sprintf("events-%d.example.com", time.Now().UnixNano())
+	email := "user@" + domain
+
+	tx, err := db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+	accountID, err := db.CreateAccount(ctx, tx, CreateAccountRequest{Email: email, Password: "password123", IsPrimary: true, HashType: "bcrypt"})
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit(ctx))
+
+	tx, err = db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+	accountSubID, err := db.CreateEventSubscription(ctx, tx, EventSubscription{
+		AccountID:  &accountID,
+		URL:        "https://hooks.example.com/account",
+		Secret:     "secret1",
+		EventTypes: []string{"message.appended"},
+		Enabled:    true,
+	})
+	require.NoError(t, err)
+	domainSubID, err := db.CreateEventSubscription(ctx, tx, EventSubscription{
+		Domain:  domain,
+		URL:     "https://hooks.example.com/domain",
+		Secret:  "secret2",
+		Enabled: true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit(ctx))
+
+	sub, err := db.GetEventSubscription(ctx, accountSubID)
+	require.NoError(t, err)
+	assert.Equal(t, email, sub.Email)
+	assert.Equal(t, "secret1", sub.Secret)
+	assert.Equal(t, []string{"message.appended"}, sub.EventTypes)
+
+	sub, err = db.GetEventSubscription(ctx, domainSubID)
+	require.NoError(t, err)
+	assert.Nil(t, sub.AccountID)
+	assert.Equal(t, domain, sub.Domain)
+	assert.Empty(t, sub.EventTypes)
+
+	subs, err := db.ListEventSubscriptions(ctx)
+	require.NoError(t, err)
+	ids := make([]int64, 0, len(subs))
+	for _, s := range subs {
+		ids = append(ids, s.ID)
+	}
+	assert.Contains(t, ids, accountSubID)
+	assert.Contains(t, ids, domainSubID)
+
+	// Update keeps the secret when none is given
+	tx, err = db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+	require.NoError(t, db.UpdateEventSubscription(ctx, tx, EventSubscription{
+		ID:          accountSubID,
+		URL:         "https://hooks.example.com/updated",
+		EventTypes:  []string{"message.expunged"},
+		Description: "updated",
+		Enabled:     false,
+	}))
+	require.NoError(t, tx.Commit(ctx))
+
+	sub, err = db.GetEventSubscription(ctx, accountSubID)
+	require.NoError(t, err)
+	assert.Equal(t, "https://hooks.example.com/updated", sub.URL)
+	assert.Equal(t, "secret1", sub.Secret)
+	assert.Equal(t, []string{"message.expunged"}, sub.EventTypes)
+	assert.False(t, sub.Enabled)
+
+	tx, err = db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+	require.NoError(t, db.DeleteEventSubscription(ctx, tx, accountSubID))
+	require.NoError(t, db.DeleteEventSubscription(ctx, tx, domainSubID))
+	require.NoError(t, tx.Commit(ctx))
+
+	_, err = db.GetEventSubscription(ctx, accountSubID)
+	assert.ErrorIs(t, err, consts.ErrDBNotFound)
+	_, err = db.GetEventSubscription(ctx, domainSubID)
+	assert.ErrorIs(t, err, consts.ErrDBNotFound)
+
+	tx, err = db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+	assert.ErrorIs(t, db.DeleteEventSubscription(ctx, tx, domainSubID), consts.ErrDBNotFound)
+}
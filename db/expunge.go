@@ -48,6 +48,12 @@ func (db *Database) ExpungeMessageUIDs(ctx context.Context, tx pgx.Tx, mailboxID
 		return 0, err
 	}
 
+	if rowsAffected > 0 {
+		if err = notifyMailboxChange(ctx, tx, mailboxID); err != nil {
+			return 0, err
+		}
+	}
+
 	logger.Info("Database: successfully expunged messages", "count", rowsAffected, "mailbox_id", mailboxID, "modseq", currentModSeq)
 	return currentModSeq, nil
 }
@@ -50,6 +50,12 @@ func SplitFlags(flags []imap.Flag) (systemFlags []imap.Flag, customKeywords []st
 	return
 }
 
+// isCustomKeyword reports whether flag is a keyword stored in custom_flags
+// rather than a system flag stored in the flags bitmask.
+func isCustomKeyword(flag imap.Flag) bool {
+	return flag != "" && !strings.HasPrefix(string(flag), "\\")
+}
+
 // getAllFlagsForMessage retrieves all system and custom flags for a given message.
 // This function must be called within the same transaction as any preceding update
 // to ensure it reads the latest state.
@@ -118,6 +124,10 @@ func (db *Database) SetMessageFlags(ctx context.Context, tx pgx.Tx, messageUID i
 		return nil, 0, err
 	}
 
+	if err = notifyMailboxChange(ctx, tx, mailboxID); err != nil {
+		return nil, 0, err
+	}
+
 	return currentFlags, modSeq, nil
 }
 
@@ -194,6 +204,10 @@ func (db *Database) AddMessageFlags(ctx context.Context, tx pgx.Tx, messageUID i
 		return nil, 0, err
 	}
 
+	if err = notifyMailboxChange(ctx, tx, mailboxID); err != nil {
+		return nil, 0, err
+	}
+
 	return currentFlags, finalModSeq, nil
 }
 
@@ -266,6 +280,10 @@ func (db *Database) RemoveMessageFlags(ctx context.Context, tx pgx.Tx, messageUI
 		return nil, 0, err
 	}
 
+	if err = notifyMailboxChange(ctx, tx, mailboxID); err != nil {
+		return nil, 0, err
+	}
+
 	return currentFlags, finalModSeq, nil
 }
 
@@ -0,0 +1,229 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/migadu/sora/consts"
+)
+
+// Phases of a global Sieve script: before or after the script of the account.
+const (
+	GlobalSievePhaseBefore = "before"
+	GlobalSievePhaseAfter  = "after"
+)
+
+// maxGlobalSieveScriptNameLength limits the name of a global Sieve script.
+const maxGlobalSieveScriptNameLength = 100
+
+// GlobalSieveScript is a Sieve script managed by the administrator that runs
+// before or after the script of every account of a domain, or of all
+// accounts when Domain is empty.
+type GlobalSieveScript struct {
+	ID        int64     `json:"id"`
+	Domain    string    `json:"domain,omitempty"` // Empty = all domains
+	Phase     string    `json:"phase"`
+	Name      string    `json:"name"`
+	Script    string    `json:"script"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Normalize validates the scope, phase and name of a script and lowercases
+// the domain. The script itself is validated by the caller, which knows the
+// Sieve extensions global scripts may use.
+func (s *GlobalSieveScript) Normalize() error {
+	s.Domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s.Domain), "@"))
+	if strings.ContainsAny(s.Domain, "@/ ") {
+		return fmt.Errorf("invalid domain: %q", s.Domain)
+	}
+	s.Phase = strings.ToLower(strings.TrimSpace(s.Phase))
+	if s.Phase != GlobalSievePhaseBefore && s.Phase != GlobalSievePhaseAfter {
+		return fmt.Errorf("invalid phase: %q (must be %s or %s)", s.Phase, GlobalSievePhaseBefore, GlobalSievePhaseAfter)
+	}
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return errors.New("script name is required")
+	}
+	if len(s.Name) > maxGlobalSieveScriptNameLength {
+		return fmt.Errorf("script name is longer than %d characters", maxGlobalSieveScriptNameLength)
+	}
+	if strings.TrimSpace(s.Script) == "" {
+		return errors.New("script is empty")
+	}
+	return nil
+}
+
+// SortGlobalSieveScripts orders scripts the way they run: global before
+// scripts, domain before scripts, domain after scripts and global after
+// scripts, each by name.
+func SortGlobalSieveScripts(scripts []GlobalSieveScript) {
+	rank := func(s GlobalSieveScript) int {
+		switch {
+		case s.Phase == GlobalSievePhaseBefore && s.Domain == "":
+			return 0
+		case s.Phase == GlobalSievePhaseBefore:
+			return 1
+		case s.Domain != "":
+			return 2
+		default:
+			return 3
+		}
+	}
+	slices.SortStableFunc(scripts, func(a, b GlobalSieveScript) int {
+		if d := rank(a) - rank(b); d != 0 {
+			return d
+		}
+		if c := strings.Compare(a.Domain, b.Domain); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+}
+
+const globalSieveScriptColumns = `id, COALESCE(domain, ''), phase, name, script, active, created_at, updated_at`
+
+func scanGlobalSieveScript(row pgx.Row) (*GlobalSieveScript, error) {
+	var s GlobalSieveScript
+	if err := row.Scan(&s.ID, &s.Domain, &s.Phase, &s.Name, &s.Script, &s.Active, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// queryGlobalSieveScripts returns the scripts of a query in the order they
+// run.
+func (db *Database) queryGlobalSieveScripts(ctx context.Context, sql string, args ...any) ([]GlobalSieveScript, error) {
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scripts := []GlobalSieveScript{}
+	for rows.Next() {
+		s, err := scanGlobalSieveScript(rows)
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, *s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	SortGlobalSieveScripts(scripts)
+	return scripts, nil
+}
+
+// CreateGlobalSieveScript stores a new global Sieve script. A script with
+// the same name in the same scope returns consts.ErrDBUniqueViolation.
+func (db *Database) CreateGlobalSieveScript(ctx context.Context, tx pgx.Tx, s GlobalSieveScript) (*GlobalSieveScript, error) {
+	if err := s.Normalize(); err != nil {
+		return nil, fmt.Errorf("%w: %w", consts.ErrInvalidInput, err)
+	}
+
+	var domain *string
+	if s.Domain != "" {
+		domain = &s.Domain
+	}
+	row := tx.QueryRow(ctx, `
+		INSERT INTO global_sieve_scripts (domain, phase, name, script, active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+globalSieveScriptColumns,
+		domain, s.Phase, s.Name, s.Script, s.Active)
+	created, err := scanGlobalSieveScript(row)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, consts.ErrDBUniqueViolation
+		}
+		return nil, fmt.Errorf("failed to create global sieve script: %w", err)
+	}
+	return created, nil
+}
+
+// GetGlobalSieveScript returns a global Sieve script by ID, or
+// consts.ErrDBNotFound.
+func (db *Database) GetGlobalSieveScript(ctx context.Context, id int64) (*GlobalSieveScript, error) {
+	row := db.GetReadPoolWithContext(ctx).QueryRow(ctx, `SELECT `+globalSieveScriptColumns+` FROM global_sieve_scripts WHERE id = $1`, id)
+	s, err := scanGlobalSieveScript(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, consts.ErrDBNotFound
+		}
+		return nil, fmt.Errorf("failed to get global sieve script %d: %w", id, err)
+	}
+	return s, nil
+}
+
+// ListGlobalSieveScripts returns all global Sieve scripts, active or not, in
+// the order they run.
+func (db *Database) ListGlobalSieveScripts(ctx context.Context) ([]GlobalSieveScript, error) {
+	scripts, err := db.queryGlobalSieveScripts(ctx,
+		`SELECT `+globalSieveScriptColumns+` FROM global_sieve_scripts`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list global sieve scripts: %w", err)
+	}
+	return scripts, nil
+}
+
+// GetActiveGlobalSieveScripts returns the active scripts that apply to the
+// accounts of a domain, in the order they run.
+func (db *Database) GetActiveGlobalSieveScripts(ctx context.Context, domain string) ([]GlobalSieveScript, error) {
+	scripts, err := db.queryGlobalSieveScripts(ctx, `
+		SELECT `+globalSieveScriptColumns+`
+		FROM global_sieve_scripts
+		WHERE active AND (domain IS NULL OR domain = $1)
+	`, strings.ToLower(domain))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get global sieve scripts of %s: %w", domain, err)
+	}
+	return scripts, nil
+}
+
+// UpdateGlobalSieveScript replaces the phase, name, script and active state
+// of a global Sieve script. The domain of a script cannot be changed.
+func (db *Database) UpdateGlobalSieveScript(ctx context.Context, tx pgx.Tx, s GlobalSieveScript) (*GlobalSieveScript, error) {
+	if err := s.Normalize(); err != nil {
+		return nil, fmt.Errorf("%w: %w", consts.ErrInvalidInput, err)
+	}
+
+	row := tx.QueryRow(ctx, `
+		UPDATE global_sieve_scripts
+		SET phase = $2, name = $3, script = $4, active = $5, updated_at = now()
+		WHERE id = $1
+		RETURNING `+globalSieveScriptColumns,
+		s.ID, s.Phase, s.Name, s.Script, s.Active)
+	updated, err := scanGlobalSieveScript(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, consts.ErrDBNotFound
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, consts.ErrDBUniqueViolation
+		}
+		return nil, fmt.Errorf("failed to update global sieve script %d: %w", s.ID, err)
+	}
+	return updated, nil
+}
+
+// DeleteGlobalSieveScript removes a global Sieve script. It returns
+// consts.ErrDBNotFound if there is no script with that ID.
+func (db *Database) DeleteGlobalSieveScript(ctx context.Context, tx pgx.Tx, id int64) error {
+	tag, err := tx.Exec(ctx, `DELETE FROM global_sieve_scripts WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete global sieve script %d: %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return consts.ErrDBNotFound
+	}
+	return nil
+}
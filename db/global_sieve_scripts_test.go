@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobalSieveScript_Normalize(t *testing.T) {
+	s := GlobalSieveScript{Domain: " @Example.com ", Phase: "Before", Name: " spam ", Script: "keep;"}
+	require.NoError(t, s.Normalize())
+	assert.Equal(t, "example.com", s.Domain)
+	assert.Equal(t, GlobalSievePhaseBefore, s.Phase)
+	assert.Equal(t, "spam", s.Name)
+
+	invalid := []GlobalSieveScript{
+		{Phase: "during", Name: "x", Script: "keep;"},
+		{Phase: "before", Name: "", Script: "keep;"},
+		{Phase: "before", Name: "x", Script: " "},
+		{Domain: "user@example.com", Phase: "after", Name: "x", Script: "keep;"},
+	}
+	for _, s := range invalid {
+		assert.Error(t, s.Normalize(), "%+v", s)
+	}
+}
+
+func TestSortGlobalSieveScripts(t *testing.T) {
+	scripts := []GlobalSieveScript{
+		{Name: "z", Phase: GlobalSievePhaseAfter},
+		{Name: "b", Phase: GlobalSievePhaseAfter, Domain: "example.com"},
+		{Name: "a", Phase: GlobalSievePhaseBefore, Domain: "example.com"},
+		{Name: "b", Phase: GlobalSievePhaseBefore},
+		{Name: "a", Phase: GlobalSievePhaseBefore},
+	}
+	SortGlobalSieveScripts(scripts)
+
+	var order []string
+	for _, s := range scripts {
+		order = append(order, s.Domain+":"+s.Phase+"/"+s.Name)
+	}
+	assert.Equal(t, []string{
+		":before/a",
+		":before/b",
+		"example.com:before/a",
+		"example.com:after/b",
+		":after/z",
+	}, order)
+}
+
+// TestGlobalSieveScripts tests creating, selecting, updating and deleting
+// global Sieve scripts.
+func TestGlobalSieveScripts(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping database integration test in short mode")
+	}
+
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	domain := fmt.Sprintf("sieve-%d.example.com", time.Now().UnixNano())
+	other := "other-" + domain
+
+	create := func(s GlobalSieveScript) *GlobalSieveScript {
+		var created *GlobalSieveScript
+		require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) (err error) {
+			created, err = db.CreateGlobalSieveScript(ctx, tx, s)
+			return err
+		}))
+		return created
+	}
+	before := create(GlobalSieveScript{Domain: domain, Phase: "before", Name: "spam", Script: "keep;", Active: true})
+	after := create(GlobalSieveScript{Domain: domain, Phase: "after", Name: "archive", Script: "keep;", Active: true})
+	create(GlobalSieveScript{Domain: other, Phase: "before", Name: "spam", Script: "keep;", Active: true})
+	assert.Equal(t, domain, before.Domain)
+
+	err := inTestTx(t, db, func(tx pgx.Tx) error {
+		_, err := db.CreateGlobalSieveScript(ctx, tx, GlobalSieveScript{Domain: domain, Phase: "after", Name: "spam", Script: "keep;"})
+		return err
+	})
+	assert.ErrorIs(t, err, consts.ErrDBUniqueViolation)
+
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		_, err := db.CreateGlobalSieveScript(ctx, tx, GlobalSieveScript{Domain: domain, Phase: "during", Name: "x", Script: "keep;"})
+		return err
+	})
+	assert.ErrorIs(t, err, consts.ErrInvalidInput)
+
+	ids := func() []int64 {
+		scripts, err := db.GetActiveGlobalSieveScripts(ctx, domain)
+		require.NoError(t, err)
+		var ids []int64
+		for _, s := range scripts {
+			if s.Domain == domain {
+				ids = append(ids, s.ID)
+			}
+			assert.NotEqual(t, other, s.Domain)
+		}
+		return ids
+	}
+	assert.Equal(t, []int64{before.ID, after.ID}, ids())
+
+	after.Active = false
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) error {
+		_, err := db.UpdateGlobalSieveScript(ctx, tx, *after)
+		return err
+	}))
+	assert.Equal(t, []int64{before.ID}, ids())
+
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.DeleteGlobalSieveScript(ctx, tx, before.ID)
+	}))
+	_, err = db.GetGlobalSieveScript(ctx, before.ID)
+	assert.ErrorIs(t, err, consts.ErrDBNotFound)
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.DeleteGlobalSieveScript(ctx, tx, before.ID)
+	})
+	assert.ErrorIs(t, err, consts.ErrDBNotFound)
+}
@@ -0,0 +1,782 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/helpers"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/metrics"
+)
+
+// JMAP (RFC 8620/8621) data access.
+//
+// A JMAP Email is identified by its content hash: every live message row of
+// the account with the same content hash is the same Email, and the mailboxes
+// of those rows are its mailboxIds. Keywords are the union of the flags of
+// the rows. Moving an Email between mailboxes therefore keeps its id even
+// though the underlying rows are copied and expunged.
+//
+// The state of an account is the highest modseq of its messages, mailboxes
+// and mailbox tombstones. It is used as the state string of every data type.
+
+// JMAPMailbox is a mailbox with the counters and modseqs used by the JMAP server.
+type JMAPMailbox struct {
+	ID            int64
+	ParentID      int64 // 0 for top-level mailboxes
+	Name          string
+	Subscribed    bool
+	TotalEmails   int64
+	UnreadEmails  int64
+	CreatedModSeq int64
+	UpdatedModSeq int64
+}
+
+// JMAPMailboxChanges lists the mailboxes changed since a state.
+type JMAPMailboxChanges struct {
+	Created   []int64
+	Updated   []int64
+	Destroyed []int64
+	// CountsOnly is set when every updated mailbox only changed its counters.
+	CountsOnly bool
+}
+
+// JMAPEmailCopy is one live message row backing a JMAP Email.
+type JMAPEmailCopy struct {
+	ID        int64
+	MailboxID int64
+	UID       imap.UID
+}
+
+// JMAPEmail holds the properties of a JMAP Email that are stored in the database.
+type JMAPEmail struct {
+	ContentHash string
+	ThreadID    string
+	Copies      []JMAPEmailCopy
+	Flags       []imap.Flag // System flags and keywords of all copies
+	ReceivedAt  time.Time
+	Size        int64
+	Subject     string
+	SentAt      time.Time
+	MessageID   string
+	InReplyTo   []string
+	References  []string
+	Recipients  []helpers.Recipient
+	Preview     string
+	S3Domain    string
+	S3Localpart string
+}
+
+// MailboxIDs returns the distinct mailboxes holding a copy of the email.
+func (e *JMAPEmail) MailboxIDs() []int64 {
+	var ids []int64
+	seen := make(map[int64]bool)
+	for _, c := range e.Copies {
+		if !seen[c.MailboxID] {
+			seen[c.MailboxID] = true
+			ids = append(ids, c.MailboxID)
+		}
+	}
+	return ids
+}
+
+// JMAPEmailSort is one sort criterion of Email/query.
+type JMAPEmailSort struct {
+	Property    string // receivedAt, sentAt, size, subject, from or to
+	IsAscending bool
+}
+
+// JMAPEmailQuery holds the parameters of Email/query.
+type JMAPEmailQuery struct {
+	InMailbox          int64   // Restrict to one mailbox (0 = all)
+	InMailboxOtherThan []int64 // Exclude emails that are only in these mailboxes
+	Criteria           *imap.SearchCriteria
+	Sort               []JMAPEmailSort
+	CollapseThreads    bool
+	Position           int
+	Limit              int
+}
+
+// JMAPEmailChanges lists the emails (by content hash) changed since a state.
+type JMAPEmailChanges struct {
+	Created        []string
+	Updated        []string
+	Destroyed      []string
+	NewModSeq      int64
+	HasMoreChanges bool
+}
+
+// jmapEmailSortColumns maps Email/query sort properties to message columns.
+var jmapEmailSortColumns = map[string]string{
+	"receivedAt": "internal_date",
+	"sentAt":     "sent_date",
+	"size":       "size",
+	"subject":    "subject_sort",
+	"from":       "from_email_sort",
+	"to":         "to_email_sort",
+}
+
+// IsJMAPEmailSortSupported reports whether Email/query can sort by property.
+func IsJMAPEmailSortSupported(property string) bool {
+	_, ok := jmapEmailSortColumns[property]
+	return ok
+}
+
+// jmapEmailOrderClause builds the ORDER BY list of Email/query. The default
+// order is newest first; ties are broken by row id so paging is stable.
+func jmapEmailOrderClause(sorts []JMAPEmailSort) string {
+	if len(sorts) == 0 {
+		return "internal_date DESC, id DESC"
+	}
+	var clauses []string
+	for _, s := range sorts {
+		column, ok := jmapEmailSortColumns[s.Property]
+		if !ok {
+			continue
+		}
+		direction := "DESC"
+		if s.IsAscending {
+			direction = "ASC"
+		}
+		clauses = append(clauses, fmt.Sprintf("%s %s NULLS LAST", column, direction))
+	}
+	clauses = append(clauses, "id")
+	return strings.Join(clauses, ", ")
+}
+
+// jmapThreadIDExpr computes the JMAP thread id of a message row (see migration 000023).
+const jmapThreadIDExpr = "jmap_thread_id(%smessage_references, %sin_reply_to, %smessage_id, %scontent_hash)"
+
+func jmapThreadID(prefix string) string {
+	return fmt.Sprintf(jmapThreadIDExpr, prefix, prefix, prefix, prefix)
+}
+
+// GetJMAPState returns the current state of the account: the highest modseq
+// of its messages, mailboxes and deleted mailboxes.
+func (db *Database) GetJMAPState(ctx context.Context, accountID int64) (int64, error) {
+	var state int64
+	err := db.GetReadPoolWithContext(ctx).QueryRow(ctx, `
+		SELECT GREATEST(
+			(SELECT COALESCE(MAX(GREATEST(created_modseq, updated_modseq, expunged_modseq)), 0)
+			 FROM messages WHERE account_id = $1),
+			(SELECT COALESCE(MAX(GREATEST(created_modseq, updated_modseq)), 0)
+			 FROM mailboxes WHERE account_id = $1),
+			(SELECT COALESCE(MAX(deleted_modseq), 0)
+			 FROM mailbox_tombstones WHERE account_id = $1)
+		)
+	`, accountID).Scan(&state)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get JMAP state: %w", err)
+	}
+	return state, nil
+}
+
+// GetJMAPMailboxes returns the mailboxes owned by the account with their message counts.
+func (db *Database) GetJMAPMailboxes(ctx context.Context, accountID int64) ([]JMAPMailbox, error) {
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, `
+		SELECT mb.id, mb.name, COALESCE(mb.path, ''), COALESCE(mb.subscribed, TRUE),
+		       COALESCE(ms.message_count, 0), COALESCE(ms.unseen_count, 0),
+		       COALESCE(mb.created_modseq, 0), COALESCE(mb.updated_modseq, 0)
+		FROM mailboxes mb
+		LEFT JOIN mailbox_stats ms ON ms.mailbox_id = mb.id
+		WHERE mb.account_id = $1
+		ORDER BY mb.name
+	`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query JMAP mailboxes: %w", err)
+	}
+	defer rows.Close()
+
+	var mailboxes []JMAPMailbox
+	for rows.Next() {
+		var mbox JMAPMailbox
+		var path string
+		if err := rows.Scan(&mbox.ID, &mbox.Name, &path, &mbox.Subscribed, &mbox.TotalEmails, &mbox.UnreadEmails,
+			&mbox.CreatedModSeq, &mbox.UpdatedModSeq); err != nil {
+			return nil, fmt.Errorf("failed to scan JMAP mailbox: %w", err)
+		}
+		if ids, err := helpers.GetIdsFromPath(helpers.GetParentPathFromPath(path)); err == nil && len(ids) > 0 {
+			mbox.ParentID = ids[len(ids)-1]
+		}
+		mailboxes = append(mailboxes, mbox)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating JMAP mailboxes: %w", err)
+	}
+	return mailboxes, nil
+}
+
+// GetJMAPMailboxThreadCounts returns the number of threads and of threads with
+// an unread message in each mailbox of the account.
+func (db *Database) GetJMAPMailboxThreadCounts(ctx context.Context, accountID int64) (map[int64][2]int64, error) {
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, fmt.Sprintf(`
+		SELECT mailbox_id,
+		       COUNT(DISTINCT %[1]s),
+		       COUNT(DISTINCT %[1]s) FILTER (WHERE (flags & $2) = 0)
+		FROM messages
+		WHERE account_id = $1 AND expunged_at IS NULL AND mailbox_id IS NOT NULL
+		GROUP BY mailbox_id
+	`, jmapThreadID("")), accountID, FlagSeen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count JMAP threads: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[int64][2]int64)
+	for rows.Next() {
+		var mailboxID, total, unread int64
+		if err := rows.Scan(&mailboxID, &total, &unread); err != nil {
+			return nil, fmt.Errorf("failed to scan JMAP thread counts: %w", err)
+		}
+		counts[mailboxID] = [2]int64{total, unread}
+	}
+	return counts, rows.Err()
+}
+
+// GetJMAPMailboxChanges returns the mailboxes created, updated or destroyed
+// after sinceModSeq. Mailboxes whose messages changed are reported as updated
+// with only their counters changed.
+func (db *Database) GetJMAPMailboxChanges(ctx context.Context, accountID int64, sinceModSeq int64) (*JMAPMailboxChanges, error) {
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, `
+		SELECT mb.id, TRUE AS live,
+		       COALESCE(mb.created_modseq, 0) > $2 AS created,
+		       COALESCE(mb.updated_modseq, 0) > $2 AS renamed
+		FROM mailboxes mb
+		LEFT JOIN mailbox_stats ms ON ms.mailbox_id = mb.id
+		WHERE mb.account_id = $1
+		  AND (COALESCE(mb.created_modseq, 0) > $2
+		       OR COALESCE(mb.updated_modseq, 0) > $2
+		       OR COALESCE(ms.highest_modseq, 0) > $2)
+		UNION ALL
+		SELECT t.mailbox_id, FALSE, FALSE, FALSE
+		FROM mailbox_tombstones t
+		WHERE t.account_id = $1 AND t.deleted_modseq > $2
+		  AND NOT EXISTS (SELECT 1 FROM mailboxes mb WHERE mb.id = t.mailbox_id)
+		ORDER BY 1
+	`, accountID, sinceModSeq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query JMAP mailbox changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := &JMAPMailboxChanges{}
+	countsOnly := true
+	for rows.Next() {
+		var id int64
+		var live, created, renamed bool
+		if err := rows.Scan(&id, &live, &created, &renamed); err != nil {
+			return nil, fmt.Errorf("failed to scan JMAP mailbox change: %w", err)
+		}
+		switch {
+		case !live:
+			changes.Destroyed = append(changes.Destroyed, id)
+		case created:
+			changes.Created = append(changes.Created, id)
+		default:
+			changes.Updated = append(changes.Updated, id)
+			if renamed {
+				countsOnly = false
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating JMAP mailbox changes: %w", err)
+	}
+	changes.CountsOnly = countsOnly && len(changes.Updated) > 0
+	return changes, nil
+}
+
+// GetJMAPEmails returns the emails of the account with the given content
+// hashes. Hashes without a live message are omitted from the result.
+func (db *Database) GetJMAPEmails(ctx context.Context, accountID int64, contentHashes []string) ([]JMAPEmail, error) {
+	if len(contentHashes) == 0 {
+		return nil, nil
+	}
+
+	start := time.Now()
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, fmt.Sprintf(`
+		SELECT m.id, m.mailbox_id, m.uid, m.content_hash, %s, m.flags, m.custom_flags,
+		       m.internal_date, m.size, m.subject, m.sent_date, m.message_id, m.in_reply_to,
+		       m.message_references, m.recipients_json, m.s3_domain, m.s3_localpart,
+		       COALESCE(LEFT(mc.text_body, 256), '')
+		FROM messages m
+		LEFT JOIN message_contents mc ON mc.content_hash = m.content_hash
+		WHERE m.account_id = $1 AND m.content_hash = ANY($2)
+		  AND m.expunged_at IS NULL AND m.mailbox_id IS NOT NULL
+		ORDER BY m.content_hash, m.id
+	`, jmapThreadID("m.")), accountID, contentHashes)
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	metrics.DBQueryDuration.WithLabelValues("jmap_email_get", "read").Observe(time.Since(start).Seconds())
+	metrics.DBQueriesTotal.WithLabelValues("jmap_email_get", status, "read").Inc()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to query JMAP emails: %w", err)
+	}
+	defer rows.Close()
+
+	var emails []JMAPEmail
+	var current *JMAPEmail
+	var bitwiseFlags int
+	keywords := make(map[string]bool)
+	finish := func() {
+		if current == nil {
+			return
+		}
+		flags := BitwiseToFlags(bitwiseFlags)
+		for kw := range keywords {
+			flags = append(flags, imap.Flag(kw))
+		}
+		current.Flags = helpers.SanitizeFlags(flags)
+		emails = append(emails, *current)
+	}
+
+	for rows.Next() {
+		var (
+			row                   JMAPEmailCopy
+			uid                   int64
+			contentHash, threadID string
+			flags                 int
+			customFlagsJSON       []byte
+			internalDate          time.Time
+			size                  int64
+			subject, messageID    *string
+			sentDate              *time.Time
+			inReplyTo             *string
+			references            []string
+			recipientsJSON        []byte
+			s3Domain, s3Localpart string
+			preview               string
+		)
+		if err := rows.Scan(&row.ID, &row.MailboxID, &uid, &contentHash, &threadID, &flags, &customFlagsJSON,
+			&internalDate, &size, &subject, &sentDate, &messageID, &inReplyTo,
+			&references, &recipientsJSON, &s3Domain, &s3Localpart, &preview); err != nil {
+			return nil, fmt.Errorf("failed to scan JMAP email: %w", err)
+		}
+		row.UID = imap.UID(uid)
+
+		if current == nil || current.ContentHash != contentHash {
+			finish()
+			bitwiseFlags = 0
+			keywords = make(map[string]bool)
+			current = &JMAPEmail{
+				ContentHash: contentHash,
+				ThreadID:    threadID,
+				ReceivedAt:  internalDate,
+				Size:        size,
+				References:  references,
+				Preview:     strings.Join(strings.Fields(preview), " "),
+				S3Domain:    s3Domain,
+				S3Localpart: s3Localpart,
+			}
+			if subject != nil {
+				current.Subject = *subject
+			}
+			if sentDate != nil {
+				current.SentAt = *sentDate
+			}
+			if messageID != nil {
+				current.MessageID = *messageID
+			}
+			if inReplyTo != nil && *inReplyTo != "" {
+				current.InReplyTo = strings.Fields(*inReplyTo)
+			}
+			if len(recipientsJSON) > 0 {
+				if err := json.Unmarshal(recipientsJSON, &current.Recipients); err != nil {
+					logger.Warn("Database: failed to unmarshal recipients of JMAP email", "content_hash", contentHash, "err", err)
+				}
+			}
+		}
+
+		current.Copies = append(current.Copies, row)
+		bitwiseFlags |= flags
+		var custom []string
+		if len(customFlagsJSON) > 0 {
+			if err := json.Unmarshal(customFlagsJSON, &custom); err == nil {
+				for _, kw := range custom {
+					keywords[kw] = true
+				}
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating JMAP emails: %w", err)
+	}
+	finish()
+
+	return emails, nil
+}
+
+// QueryJMAPEmails returns the content hashes of the emails matching the query
+// in the requested order, and the total number of matching emails.
+func (db *Database) QueryJMAPEmails(ctx context.Context, accountID int64, query *JMAPEmailQuery) ([]string, int, error) {
+	criteria := query.Criteria
+	if criteria == nil {
+		criteria = &imap.SearchCriteria{}
+	}
+
+	paramCounter := 0
+	whereCondition, args, err := db.buildSearchCriteriaWithPrefix(criteria, "p", &paramCounter, "")
+	if err != nil {
+		return nil, 0, err
+	}
+	args["accountID"] = accountID
+
+	mailboxCondition := "m.mailbox_id IS NOT NULL"
+	if query.InMailbox != 0 {
+		mailboxCondition = "m.mailbox_id = @inMailbox"
+		args["inMailbox"] = query.InMailbox
+	}
+	// An email matches inMailboxOtherThan if it has a copy in any other mailbox
+	otherThanCondition := "TRUE"
+	if len(query.InMailboxOtherThan) > 0 {
+		otherThanCondition = "mailbox_id <> ALL(@otherThan)"
+		args["otherThan"] = query.InMailboxOtherThan
+	}
+
+	orderClause := jmapEmailOrderClause(query.Sort)
+	args["collapse"] = query.CollapseThreads
+
+	// Same CTE columns as the complex search path, so that every search key resolves.
+	// Copies are collapsed to one row per content hash, keeping the oldest.
+	base := fmt.Sprintf(`
+		WITH message_seqs AS (
+			SELECT
+				m.id, m.uid,
+				m.account_id, m.mailbox_id, m.content_hash, m.flags, m.custom_flags,
+				m.internal_date, m.size, m.created_modseq, m.updated_modseq, m.expunged_modseq,
+				m.flags_changed_at, m.subject, m.sent_date, m.message_id,
+				m.in_reply_to, m.message_references, m.recipients_json, mc.text_body_tsv, mc.headers_tsv,
+				m.subject_sort, m.from_name_sort, m.from_email_sort, m.to_name_sort, m.to_email_sort, m.cc_email_sort
+			FROM messages m
+			LEFT JOIN message_contents mc ON m.content_hash = mc.content_hash
+			WHERE m.account_id = @accountID AND m.expunged_at IS NULL AND %s
+		),
+		matched AS (
+			SELECT DISTINCT ON (content_hash)
+				id, content_hash, internal_date, sent_date, size, subject_sort, from_email_sort, to_email_sort,
+				%s AS thread_id
+			FROM message_seqs
+			WHERE %s AND %s
+			ORDER BY content_hash, id
+		),
+		collapsed AS (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY thread_id ORDER BY %s) AS thread_rank
+			FROM matched
+		)`, mailboxCondition, jmapThreadID(""), whereCondition, otherThanCondition, orderClause)
+
+	args["position"] = query.Position
+	limit := query.Limit
+	if limit <= 0 || limit > MaxSearchResults {
+		limit = MaxSearchResults
+	}
+	args["limit"] = limit
+
+	start := time.Now()
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, base+fmt.Sprintf(`
+		SELECT content_hash, COUNT(*) OVER ()
+		FROM collapsed
+		WHERE NOT @collapse OR thread_rank = 1
+		ORDER BY %s
+		OFFSET @position LIMIT @limit`, orderClause), args)
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	metrics.DBQueryDuration.WithLabelValues("jmap_email_query", "read").Observe(time.Since(start).Seconds())
+	metrics.DBQueriesTotal.WithLabelValues("jmap_email_query", status, "read").Inc()
+
+	if err != nil {
+		logger.Error("Database: failed executing JMAP email query", "args", args, "err", err)
+		return nil, 0, fmt.Errorf("failed to query JMAP emails: %w", err)
+	}
+	defer rows.Close()
+
+	var hashes []string
+	total := 0
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash, &total); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan JMAP email query result: %w", err)
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating JMAP email query results: %w", err)
+	}
+
+	// A page past the end has no rows to carry the total
+	if len(hashes) == 0 && query.Position > 0 {
+		err := db.GetReadPoolWithContext(ctx).QueryRow(ctx, base+`
+			SELECT COUNT(*) FROM collapsed WHERE NOT @collapse OR thread_rank = 1`, args).Scan(&total)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to count JMAP emails: %w", err)
+		}
+	}
+
+	return hashes, total, nil
+}
+
+// GetJMAPEmailChanges returns the emails created, updated or destroyed after
+// sinceModSeq, oldest change first. At most maxChanges emails are returned;
+// NewModSeq is then the state up to which changes were reported.
+//
+// Expunged messages are only kept until the cleaner's grace period ends, so
+// emails destroyed longer ago than that are not reported.
+func (db *Database) GetJMAPEmailChanges(ctx context.Context, accountID int64, sinceModSeq int64, maxChanges int) (*JMAPEmailChanges, error) {
+	start := time.Now()
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, `
+		WITH touched AS (
+			SELECT DISTINCT content_hash
+			FROM messages
+			WHERE account_id = $1 AND GREATEST(created_modseq, updated_modseq, expunged_modseq) > $2
+		)
+		SELECT t.content_hash,
+		       BOOL_OR(m.expunged_at IS NULL AND m.mailbox_id IS NOT NULL) AS live,
+		       MIN(m.created_modseq) AS first_created,
+		       MAX(GREATEST(m.created_modseq, m.updated_modseq, m.expunged_modseq)) AS last_modseq
+		FROM touched t
+		JOIN messages m ON m.account_id = $1 AND m.content_hash = t.content_hash
+		GROUP BY t.content_hash
+		ORDER BY last_modseq, t.content_hash
+	`, accountID, sinceModSeq)
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	metrics.DBQueryDuration.WithLabelValues("jmap_email_changes", "read").Observe(time.Since(start).Seconds())
+	metrics.DBQueriesTotal.WithLabelValues("jmap_email_changes", status, "read").Inc()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to query JMAP email changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := &JMAPEmailChanges{NewModSeq: sinceModSeq}
+	count := 0
+	for rows.Next() {
+		var hash string
+		var live bool
+		var firstCreated, lastModSeq int64
+		if err := rows.Scan(&hash, &live, &firstCreated, &lastModSeq); err != nil {
+			return nil, fmt.Errorf("failed to scan JMAP email change: %w", err)
+		}
+		if maxChanges > 0 && count >= maxChanges && lastModSeq > changes.NewModSeq {
+			changes.HasMoreChanges = true
+			break
+		}
+		switch {
+		case live && firstCreated > sinceModSeq:
+			changes.Created = append(changes.Created, hash)
+		case live:
+			changes.Updated = append(changes.Updated, hash)
+		case firstCreated <= sinceModSeq:
+			changes.Destroyed = append(changes.Destroyed, hash)
+		default:
+			// Created and destroyed since the state: the client never saw it
+		}
+		count++
+		changes.NewModSeq = lastModSeq
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating JMAP email changes: %w", err)
+	}
+
+	return changes, nil
+}
+
+// GetJMAPThreads returns the content hashes of the emails in each of the
+// given threads, ordered by sent date. Unknown threads are omitted.
+func (db *Database) GetJMAPThreads(ctx context.Context, accountID int64, threadIDs []string) (map[string][]string, error) {
+	if len(threadIDs) == 0 {
+		return map[string][]string{}, nil
+	}
+
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, fmt.Sprintf(`
+		SELECT %[1]s AS thread_id, content_hash
+		FROM messages
+		WHERE account_id = $1 AND expunged_at IS NULL AND mailbox_id IS NOT NULL
+		  AND %[1]s = ANY($2)
+		GROUP BY thread_id, content_hash
+		ORDER BY thread_id, MIN(sent_date), MIN(id)
+	`, jmapThreadID("")), accountID, threadIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query JMAP threads: %w", err)
+	}
+	defer rows.Close()
+
+	threads := make(map[string][]string)
+	for rows.Next() {
+		var threadID, hash string
+		if err := rows.Scan(&threadID, &hash); err != nil {
+			return nil, fmt.Errorf("failed to scan JMAP thread: %w", err)
+		}
+		threads[threadID] = append(threads[threadID], hash)
+	}
+	return threads, rows.Err()
+}
+
+// GetJMAPBlobLocation returns the S3 key parts of a message blob of the
+// account, or consts.ErrDBNotFound if no live message has that content hash.
+func (db *Database) GetJMAPBlobLocation(ctx context.Context, accountID int64, contentHash string) (s3Domain, s3Localpart string, err error) {
+	err = db.GetReadPoolWithContext(ctx).QueryRow(ctx, `
+		SELECT s3_domain, s3_localpart
+		FROM messages
+		WHERE account_id = $1 AND content_hash = $2 AND expunged_at IS NULL
+		LIMIT 1
+	`, accountID, contentHash).Scan(&s3Domain, &s3Localpart)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", consts.ErrDBNotFound
+		}
+		return "", "", fmt.Errorf("failed to look up JMAP blob: %w", err)
+	}
+	return s3Domain, s3Localpart, nil
+}
+
+// SetJMAPEmailKeywords replaces the flags of every copy of an email. The
+// \Deleted flag, which JMAP does not expose, is preserved.
+func (db *Database) SetJMAPEmailKeywords(ctx context.Context, tx pgx.Tx, accountID int64, contentHash string, flags []imap.Flag) error {
+	systemFlags, customKeywords := SplitFlags(flags)
+	customKeywordsJSON, err := json.Marshal(customKeywords)
+	if err != nil {
+		return fmt.Errorf("failed to marshal keywords: %w", err)
+	}
+
+	result, err := tx.Exec(ctx, `
+		UPDATE messages
+		SET flags = $1 | (flags & $2), custom_flags = $3, flags_changed_at = now(),
+		    updated_modseq = nextval('messages_modseq')
+		WHERE account_id = $4 AND content_hash = $5
+		  AND expunged_at IS NULL AND mailbox_id IS NOT NULL
+	`, FlagsToBitwise(systemFlags)&^FlagDeleted, FlagDeleted, customKeywordsJSON, accountID, contentHash)
+	if err != nil {
+		return fmt.Errorf("failed to set keywords: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return consts.ErrDBNotFound
+	}
+	return nil
+}
+
+// SetJMAPEmailMailboxes makes the email present in exactly the given
+// mailboxes: it is copied into new mailboxes and expunged from the others.
+func (db *Database) SetJMAPEmailMailboxes(ctx context.Context, tx pgx.Tx, accountID int64, contentHash string, mailboxIDs []int64) error {
+	if len(mailboxIDs) == 0 {
+		return fmt.Errorf("an email must belong to at least one mailbox")
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT mailbox_id, uid
+		FROM messages
+		WHERE account_id = $1 AND content_hash = $2
+		  AND expunged_at IS NULL AND mailbox_id IS NOT NULL
+		ORDER BY id
+		FOR UPDATE
+	`, accountID, contentHash)
+	if err != nil {
+		return fmt.Errorf("failed to query email copies: %w", err)
+	}
+	current := make(map[int64][]imap.UID)
+	var sourceMailbox int64
+	var sourceUID imap.UID
+	for rows.Next() {
+		var mailboxID, uid int64
+		if err := rows.Scan(&mailboxID, &uid); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan email copy: %w", err)
+		}
+		if sourceMailbox == 0 {
+			sourceMailbox, sourceUID = mailboxID, imap.UID(uid)
+		}
+		current[mailboxID] = append(current[mailboxID], imap.UID(uid))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating email copies: %w", err)
+	}
+	if len(current) == 0 {
+		return consts.ErrDBNotFound
+	}
+
+	var owned int
+	if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM mailboxes WHERE account_id = $1 AND id = ANY($2)`,
+		accountID, mailboxIDs).Scan(&owned); err != nil {
+		return fmt.Errorf("failed to check mailboxes: %w", err)
+	}
+	wanted := make(map[int64]bool, len(mailboxIDs))
+	for _, id := range mailboxIDs {
+		wanted[id] = true
+	}
+	if owned != len(wanted) {
+		return consts.ErrMailboxNotFound
+	}
+
+	targets := make([]int64, 0, len(wanted))
+	for id := range wanted {
+		targets = append(targets, id)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i] < targets[j] })
+	for _, id := range targets {
+		if _, ok := current[id]; ok {
+			continue
+		}
+		uids := []imap.UID{sourceUID}
+		if _, err := db.CopyMessages(ctx, tx, &uids, sourceMailbox, id, accountID); err != nil {
+			return err
+		}
+	}
+
+	for mailboxID, uids := range current {
+		if wanted[mailboxID] {
+			continue
+		}
+		if _, err := db.ExpungeMessageUIDs(ctx, tx, mailboxID, uids...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DestroyJMAPEmail expunges every copy of an email.
+func (db *Database) DestroyJMAPEmail(ctx context.Context, tx pgx.Tx, accountID int64, contentHash string) error {
+	result, err := tx.Exec(ctx, `
+		UPDATE messages
+		SET expunged_at = now(), expunged_modseq = nextval('messages_modseq')
+		WHERE account_id = $1 AND content_hash = $2
+		  AND expunged_at IS NULL AND mailbox_id IS NOT NULL
+	`, accountID, contentHash)
+	if err != nil {
+		return fmt.Errorf("failed to destroy email: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return consts.ErrDBNotFound
+	}
+	return nil
+}
+
+// CleanupOldMailboxTombstones removes mailbox tombstones older than the given
+// duration. JMAP clients that last synced before then must resync mailboxes.
+func (db *Database) CleanupOldMailboxTombstones(ctx context.Context, tx pgx.Tx, olderThan time.Duration) (int64, error) {
+	result, err := tx.Exec(ctx, `
+		DELETE FROM mailbox_tombstones
+		WHERE deleted_at < $1
+	`, time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
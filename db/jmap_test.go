@@ -0,0 +1,196 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJMAPEmailOrderClause(t *testing.T) {
+	assert.Equal(t, "internal_date DESC, id DESC", jmapEmailOrderClause(nil))
+	assert.Equal(t, "size ASC NULLS LAST, subject_sort DESC NULLS LAST, id",
+		jmapEmailOrderClause([]JMAPEmailSort{{Property: "size", IsAscending: true}, {Property: "subject"}}))
+	assert.True(t, IsJMAPEmailSortSupported("receivedAt"))
+	assert.False(t, IsJMAPEmailSortSupported("hasKeyword"))
+}
+
+// TestJMAPEmails tests that emails are aggregated by content hash and that
+// keyword, mailbox and destroy changes are reflected in the account state
+func TestJMAPEmails(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping database integration test in short mode")
+	}
+
+	db := setupTestDatabase(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	tx, err := db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	testEmail := fmt.Sprintf("test_jmap_%d@example.com", time.Now().UnixNano())
+	_, err = db.CreateAccount(ctx, tx, CreateAccountRequest{Email: testEmail, Password: "password", IsPrimary: true, HashType: "bcrypt"})
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit(ctx))
+
+	accountID, err := db.GetAccountIDByAddress(ctx, testEmail)
+	require.NoError(t, err)
+
+	tx, err = db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, db.CreateMailbox(ctx, tx, accountID, "INBOX", nil))
+	require.NoError(t, db.CreateMailbox(ctx, tx, accountID, "Archive", nil))
+	require.NoError(t, tx.Commit(ctx))
+
+	inbox, err := db.GetMailboxByName(ctx, accountID, "INBOX")
+	require.NoError(t, err)
+	archive, err := db.GetMailboxByName(ctx, accountID, "Archive")
+	require.NoError(t, err)
+
+	var bs imap.BodyStructure = &imap.BodyStructureSinglePart{Type: "text", Subtype: "plain", Size: 100}
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	hash := func(uid uint32) string { return fmt.Sprintf("jmaptest%d_%d", uid, base.UnixNano()) }
+	insert := func(uid uint32, messageID, subject string, sent time.Time, references []string) {
+		options := &InsertMessageOptions{
+			AccountID:     accountID,
+			MailboxID:     inbox.ID,
+			MailboxName:   "INBOX",
+			S3Domain:      "example.com",
+			S3Localpart:   fmt.Sprintf("test/jmap_test/%d", uid),
+			ContentHash:   hash(uid),
+			MessageID:     messageID,
+			InternalDate:  sent,
+			Size:          100 * int64(uid),
+			Subject:       subject,
+			PlaintextBody: "body text",
+			RawHeaders:    "headers",
+			SentDate:      sent,
+			References:    references,
+			PreservedUID:  &uid,
+			BodyStructure: &bs,
+		}
+		_, _, err := db.InsertMessageFromImporter(ctx, tx, options)
+		require.NoError(t, err)
+	}
+
+	tx, err = db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	insert(1, "root@example.com", "Plans", base.Add(time.Minute), nil)
+	insert(2, "reply@example.com", "Re: Plans", base.Add(2*time.Minute), []string{"root@example.com"})
+	insert(3, "other@example.com", "Other", base.Add(3*time.Minute), nil)
+	require.NoError(t, tx.Commit(ctx))
+
+	state, err := db.GetJMAPState(ctx, accountID)
+	require.NoError(t, err)
+	assert.Greater(t, state, int64(0))
+
+	t.Run("Get", func(t *testing.T) {
+		emails, err := db.GetJMAPEmails(ctx, accountID, []string{hash(1), hash(2), "unknown"})
+		require.NoError(t, err)
+		require.Len(t, emails, 2)
+		assert.Equal(t, emails[0].ThreadID, emails[1].ThreadID, "reply should share the thread of its root")
+		assert.Equal(t, []int64{inbox.ID}, emails[0].MailboxIDs())
+		assert.Equal(t, "body text", emails[0].Preview)
+	})
+
+	t.Run("Query", func(t *testing.T) {
+		hashes, total, err := db.QueryJMAPEmails(ctx, accountID, &JMAPEmailQuery{InMailbox: inbox.ID})
+		require.NoError(t, err)
+		assert.Equal(t, 3, total)
+		assert.Equal(t, []string{hash(3), hash(2), hash(1)}, hashes)
+
+		hashes, total, err = db.QueryJMAPEmails(ctx, accountID, &JMAPEmailQuery{CollapseThreads: true})
+		require.NoError(t, err)
+		assert.Equal(t, 2, total)
+		assert.Equal(t, []string{hash(3), hash(2)}, hashes)
+
+		hashes, _, err = db.QueryJMAPEmails(ctx, accountID, &JMAPEmailQuery{
+			Sort: []JMAPEmailSort{{Property: "size", IsAscending: true}}, Position: 1, Limit: 1,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{hash(2)}, hashes)
+	})
+
+	t.Run("KeywordsAndMailboxes", func(t *testing.T) {
+		tx, err := db.GetWritePool().Begin(ctx)
+		require.NoError(t, err)
+		require.NoError(t, db.SetJMAPEmailKeywords(ctx, tx, accountID, hash(1), []imap.Flag{imap.FlagSeen, "$label"}))
+		require.NoError(t, db.SetJMAPEmailMailboxes(ctx, tx, accountID, hash(1), []int64{archive.ID}))
+		require.NoError(t, tx.Commit(ctx))
+
+		emails, err := db.GetJMAPEmails(ctx, accountID, []string{hash(1)})
+		require.NoError(t, err)
+		require.Len(t, emails, 1)
+		assert.Equal(t, []int64{archive.ID}, emails[0].MailboxIDs())
+		assert.Contains(t, emails[0].Flags, imap.FlagSeen)
+		assert.Contains(t, emails[0].Flags, imap.Flag("$label"))
+
+		hashes, _, err := db.QueryJMAPEmails(ctx, accountID, &JMAPEmailQuery{
+			Criteria: &imap.SearchCriteria{Flag: []imap.Flag{"$label"}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{hash(1)}, hashes)
+
+		changes, err := db.GetJMAPEmailChanges(ctx, accountID, state, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{hash(1)}, changes.Updated)
+		assert.Empty(t, changes.Created)
+		assert.Empty(t, changes.Destroyed)
+
+		mailboxChanges, err := db.GetJMAPMailboxChanges(ctx, accountID, state)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []int64{inbox.ID, archive.ID}, mailboxChanges.Updated)
+		assert.True(t, mailboxChanges.CountsOnly)
+	})
+
+	t.Run("Destroy", func(t *testing.T) {
+		before, err := db.GetJMAPState(ctx, accountID)
+		require.NoError(t, err)
+
+		tx, err := db.GetWritePool().Begin(ctx)
+		require.NoError(t, err)
+		require.NoError(t, db.DestroyJMAPEmail(ctx, tx, accountID, hash(3)))
+		require.NoError(t, tx.Commit(ctx))
+
+		changes, err := db.GetJMAPEmailChanges(ctx, accountID, before, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{hash(3)}, changes.Destroyed)
+		assert.False(t, changes.HasMoreChanges)
+
+		after, err := db.GetJMAPState(ctx, accountID)
+		require.NoError(t, err)
+		assert.Equal(t, after, changes.NewModSeq)
+	})
+
+	t.Run("MailboxTombstones", func(t *testing.T) {
+		before, err := db.GetJMAPState(ctx, accountID)
+		require.NoError(t, err)
+
+		tx, err := db.GetWritePool().Begin(ctx)
+		require.NoError(t, err)
+		require.NoError(t, db.CreateMailbox(ctx, tx, accountID, "Scratch", nil))
+		require.NoError(t, tx.Commit(ctx))
+		scratch, err := db.GetMailboxByName(ctx, accountID, "Scratch")
+		require.NoError(t, err)
+
+		changes, err := db.GetJMAPMailboxChanges(ctx, accountID, before)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{scratch.ID}, changes.Created)
+
+		created, err := db.GetJMAPState(ctx, accountID)
+		require.NoError(t, err)
+
+		tx, err = db.GetWritePool().Begin(ctx)
+		require.NoError(t, err)
+		require.NoError(t, db.DeleteMailbox(ctx, tx, scratch.ID, accountID))
+		require.NoError(t, tx.Commit(ctx))
+
+		changes, err = db.GetJMAPMailboxChanges(ctx, accountID, created)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{scratch.ID}, changes.Destroyed)
+	})
+}
@@ -264,14 +264,19 @@ func (db *Database) CreateMailbox(ctx context.Context, tx pgx.Tx, AccountID int6
 
 			// Extract domain from user's primary credential
 			var domain string
+			var allowed bool
 			err := tx.QueryRow(ctx, `
-				SELECT SPLIT_PART(address, '@', 2)
-				FROM credentials
-				WHERE account_id = $1 AND primary_identity = TRUE
-			`, AccountID).Scan(&domain)
+				SELECT SPLIT_PART(c.address, '@', 2), COALESCE(d.shared_mailboxes, TRUE)
+				FROM credentials c
+				LEFT JOIN domains d ON d.name = LOWER(c.domain)
+				WHERE c.account_id = $1 AND c.primary_identity = TRUE
+			`, AccountID).Scan(&domain, &allowed)
 			if err != nil {
 				return fmt.Errorf("failed to get user domain for shared mailbox: %w", err)
 			}
+			if !allowed {
+				return fmt.Errorf("%w: shared mailboxes are disabled for domain %s", consts.ErrNotPermitted, domain)
+			}
 			ownerDomain = &domain
 		}
 	}
@@ -720,6 +725,70 @@ func (d *Database) GetMailboxSummariesBatch(ctx context.Context, mailboxIDs []in
 	return result, nil
 }
 
+// MailboxState is the per-mailbox state that NOTIFY compares to detect
+// changes in mailboxes other than the selected one.
+type MailboxState struct {
+	ID            int64
+	Name          string
+	Subscribed    bool
+	UIDValidity   uint32
+	UIDNext       int64
+	NumMessages   int
+	UnseenCount   int
+	HighestModSeq uint64
+}
+
+// GetMailboxStates returns the state of all mailboxes owned by an account,
+// read from the mailbox_stats cache table.
+func (d *Database) GetMailboxStates(ctx context.Context, accountID int64) ([]MailboxState, error) {
+	start := time.Now()
+	var err error
+	defer func() {
+		status := "success"
+		if err != nil {
+			status = "error"
+		}
+		metrics.DBQueryDuration.WithLabelValues("mailbox_states", "read").Observe(time.Since(start).Seconds())
+		metrics.DBQueriesTotal.WithLabelValues("mailbox_states", status, "read").Inc()
+	}()
+
+	rows, err := d.GetReadPoolWithContext(ctx).Query(ctx, `
+		SELECT
+			mb.id,
+			mb.name,
+			COALESCE(mb.subscribed, true),
+			mb.uid_validity,
+			mb.highest_uid + 1,
+			COALESCE(ms.message_count, 0),
+			COALESCE(ms.unseen_count, 0),
+			COALESCE(ms.highest_modseq, 1)
+		FROM mailboxes mb
+		LEFT JOIN mailbox_stats ms ON mb.id = ms.mailbox_id
+		WHERE mb.account_id = $1
+		ORDER BY mb.name
+	`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query mailbox states: %w", err)
+	}
+	defer rows.Close()
+
+	var states []MailboxState
+	for rows.Next() {
+		var s MailboxState
+		var uidValidity int64
+		if err = rows.Scan(&s.ID, &s.Name, &s.Subscribed, &uidValidity, &s.UIDNext, &s.NumMessages, &s.UnseenCount, &s.HighestModSeq); err != nil {
+			return nil, fmt.Errorf("failed to scan mailbox state: %w", err)
+		}
+		s.UIDValidity = uint32(uidValidity)
+		states = append(states, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating mailbox states: %w", err)
+	}
+
+	return states, nil
+}
+
 func (d *Database) GetMailboxMessageCountAndSizeSum(ctx context.Context, mailboxID int64) (int, int64, error) {
 	var count int
 	var size int64
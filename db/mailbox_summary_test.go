@@ -173,3 +173,53 @@ func TestGetMailboxSummaryFirstUnseen(t *testing.T) {
 		require.NoError(t, tx.Commit(ctx))
 	})
 }
+
+func TestGetMailboxStates(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping database integration test in short mode")
+	}
+
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	tx, err := db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	testEmail := fmt.Sprintf("test_states_%d@example.com", time.Now().UnixNano())
+	_, err = db.CreateAccount(ctx, tx, CreateAccountRequest{Email: testEmail, Password: "password", IsPrimary: true, HashType: "bcrypt"})
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit(ctx))
+
+	accountID, err := db.GetAccountIDByAddress(ctx, testEmail)
+	require.NoError(t, err)
+
+	tx, err = db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, db.CreateMailbox(ctx, tx, accountID, "INBOX", nil))
+	require.NoError(t, db.CreateMailbox(ctx, tx, accountID, "Archive", nil))
+	require.NoError(t, tx.Commit(ctx))
+
+	inbox, err := db.GetMailboxByName(ctx, accountID, "INBOX")
+	require.NoError(t, err)
+
+	tx, err = db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	insertTestMessageWithUID(t, db, ctx, tx, accountID, inbox.ID, "INBOX", 1, []imap.Flag{imap.FlagSeen})
+	insertTestMessageWithUID(t, db, ctx, tx, accountID, inbox.ID, "INBOX", 2, []imap.Flag{})
+	require.NoError(t, tx.Commit(ctx))
+
+	states, err := db.GetMailboxStates(ctx, accountID)
+	require.NoError(t, err)
+	require.Len(t, states, 2)
+
+	assert.Equal(t, "Archive", states[0].Name)
+	assert.Equal(t, 0, states[0].NumMessages)
+
+	assert.Equal(t, inbox.ID, states[1].ID)
+	assert.Equal(t, inbox.UIDValidity, states[1].UIDValidity)
+	assert.Equal(t, 2, states[1].NumMessages)
+	assert.Equal(t, 1, states[1].UnseenCount)
+	assert.Equal(t, int64(3), states[1].UIDNext)
+	assert.Greater(t, states[1].HighestModSeq, states[0].HighestModSeq)
+}
@@ -0,0 +1,238 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/migadu/sora/consts"
+)
+
+// Formats of a message import.
+const (
+	MessageImportFormatMbox = "mbox" // A single mbox file
+	MessageImportFormatZip  = "zip"  // A zip archive of .eml and .mbox files
+)
+
+// States of a message import.
+const (
+	MessageImportPending   = "pending"
+	MessageImportRunning   = "running"
+	MessageImportCompleted = "completed"
+	MessageImportFailed    = "failed"
+	MessageImportCancelled = "cancelled"
+)
+
+// MessageImportProgress counts the messages of an import.
+type MessageImportProgress struct {
+	Total      *int `json:"total"`     // Messages in the archive, nil until counted
+	Processed  int  `json:"processed"` // Messages read, whatever the outcome
+	Imported   int  `json:"imported"`
+	Duplicates int  `json:"duplicates"`
+	Failed     int  `json:"failed"`
+}
+
+// MessageImport is an mbox file or zip archive uploaded for import into an
+// account, and the progress of its import.
+type MessageImport struct {
+	ID        int64  `json:"id"`
+	AccountID int64  `json:"-"`
+	Format    string `json:"format"`
+	Mailbox   string `json:"mailbox"`
+	S3Key     string `json:"-"`
+	Size      int64  `json:"size"`
+	Status    string `json:"status"`
+	MessageImportProgress
+	Attempts   int        `json:"-"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+const messageImportColumns = `id, account_id, format, mailbox, s3_key, size, status,
+	total, processed, imported, duplicates, failed, attempts, COALESCE(error, ''),
+	created_at, updated_at, finished_at`
+
+func scanMessageImport(row pgx.Row) (*MessageImport, error) {
+	var imp MessageImport
+	err := row.Scan(&imp.ID, &imp.AccountID, &imp.Format, &imp.Mailbox, &imp.S3Key, &imp.Size, &imp.Status,
+		&imp.Total, &imp.Processed, &imp.Imported, &imp.Duplicates, &imp.Failed, &imp.Attempts, &imp.Error,
+		&imp.CreatedAt, &imp.UpdatedAt, &imp.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &imp, nil
+}
+
+// CreateMessageImport registers an uploaded archive for import. It returns
+// consts.ErrImportInProgress if the account has an unfinished import.
+func (db *Database) CreateMessageImport(ctx context.Context, tx pgx.Tx, imp MessageImport) (*MessageImport, error) {
+	if imp.Format != MessageImportFormatMbox && imp.Format != MessageImportFormatZip {
+		return nil, fmt.Errorf("%w: unsupported import format %q", consts.ErrInvalidInput, imp.Format)
+	}
+	if imp.Mailbox == "" {
+		imp.Mailbox = consts.MailboxInbox
+	}
+
+	created, err := scanMessageImport(tx.QueryRow(ctx, `
+		INSERT INTO message_imports (account_id, format, mailbox, s3_key, size)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+messageImportColumns,
+		imp.AccountID, imp.Format, imp.Mailbox, imp.S3Key, imp.Size))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.Code {
+			case "23505":
+				return nil, consts.ErrImportInProgress
+			case "23503":
+				return nil, consts.ErrDBNotFound
+			}
+		}
+		return nil, fmt.Errorf("failed to create message import: %w", err)
+	}
+	return created, nil
+}
+
+// ListMessageImports returns the imports of an account, newest first.
+func (db *Database) ListMessageImports(ctx context.Context, accountID int64) ([]MessageImport, error) {
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, `
+		SELECT `+messageImportColumns+`
+		FROM message_imports
+		WHERE account_id = $1
+		ORDER BY created_at DESC, id DESC
+	`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list message imports: %w", err)
+	}
+	defer rows.Close()
+
+	imports := []MessageImport{}
+	for rows.Next() {
+		imp, err := scanMessageImport(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message import: %w", err)
+		}
+		imports = append(imports, *imp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list message imports: %w", err)
+	}
+	return imports, nil
+}
+
+// GetMessageImport returns an import of an account, or consts.ErrDBNotFound.
+func (db *Database) GetMessageImport(ctx context.Context, accountID, id int64) (*MessageImport, error) {
+	imp, err := scanMessageImport(db.GetReadPoolWithContext(ctx).QueryRow(ctx, `
+		SELECT `+messageImportColumns+`
+		FROM message_imports
+		WHERE id = $1 AND account_id = $2
+	`, id, accountID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, consts.ErrDBNotFound
+		}
+		return nil, fmt.Errorf("failed to get message import: %w", err)
+	}
+	return imp, nil
+}
+
+// CancelMessageImport cancels an unfinished import of an account. It returns
+// the import as it was before, so that the caller can remove the archive of
+// an import no server had claimed yet; a running import removes its archive
+// when it notices the cancellation. It returns consts.ErrDBNotFound if the
+// account has no unfinished import with that ID.
+func (db *Database) CancelMessageImport(ctx context.Context, tx pgx.Tx, accountID, id int64) (*MessageImport, error) {
+	imp, err := scanMessageImport(tx.QueryRow(ctx, `
+		SELECT `+messageImportColumns+`
+		FROM message_imports
+		WHERE id = $1 AND account_id = $2 AND status IN ('pending', 'running')
+		FOR UPDATE
+	`, id, accountID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, consts.ErrDBNotFound
+		}
+		return nil, fmt.Errorf("failed to get message import: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE message_imports
+		SET status = 'cancelled', updated_at = now(), finished_at = now()
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel message import: %w", err)
+	}
+	return imp, nil
+}
+
+// ClaimMessageImport claims the oldest pending import, or a running import
+// whose heartbeat is older than staleBefore, for instanceID. It returns
+// consts.ErrDBNotFound if there is none.
+func (db *Database) ClaimMessageImport(ctx context.Context, tx pgx.Tx, instanceID string, staleBefore time.Time) (*MessageImport, error) {
+	imp, err := scanMessageImport(tx.QueryRow(ctx, `
+		UPDATE message_imports
+		SET status = 'running', claimed_by = $1, heartbeat_at = now(), attempts = attempts + 1, updated_at = now()
+		WHERE id = (
+			SELECT id FROM message_imports
+			WHERE status = 'pending' OR (status = 'running' AND heartbeat_at < $2)
+			ORDER BY created_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+messageImportColumns,
+		instanceID, staleBefore))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, consts.ErrDBNotFound
+		}
+		return nil, fmt.Errorf("failed to claim message import: %w", err)
+	}
+	return imp, nil
+}
+
+// UpdateMessageImportProgress stores the progress of an import claimed by
+// instanceID and renews its heartbeat. It returns consts.ErrDBNotFound if the
+// import was cancelled or claimed by another instance in the meantime.
+func (db *Database) UpdateMessageImportProgress(ctx context.Context, tx pgx.Tx, id int64, instanceID string, p MessageImportProgress) error {
+	result, err := tx.Exec(ctx, `
+		UPDATE message_imports
+		SET total = $3, processed = $4, imported = $5, duplicates = $6, failed = $7,
+			heartbeat_at = now(), updated_at = now()
+		WHERE id = $1 AND claimed_by = $2 AND status = 'running'
+	`, id, instanceID, p.Total, p.Processed, p.Imported, p.Duplicates, p.Failed)
+	if err != nil {
+		return fmt.Errorf("failed to update message import: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return consts.ErrDBNotFound
+	}
+	return nil
+}
+
+// FinishMessageImport ends an import claimed by instanceID as completed or
+// failed. It returns consts.ErrDBNotFound if the import was cancelled or
+// claimed by another instance in the meantime.
+func (db *Database) FinishMessageImport(ctx context.Context, tx pgx.Tx, id int64, instanceID, status string, p MessageImportProgress, errMsg string) error {
+	if status != MessageImportCompleted && status != MessageImportFailed {
+		return fmt.Errorf("%w: invalid final import status %q", consts.ErrInvalidInput, status)
+	}
+	result, err := tx.Exec(ctx, `
+		UPDATE message_imports
+		SET status = $3, total = $4, processed = $5, imported = $6, duplicates = $7, failed = $8,
+			error = NULLIF($9, ''), updated_at = now(), finished_at = now()
+		WHERE id = $1 AND claimed_by = $2 AND status = 'running'
+	`, id, instanceID, status, p.Total, p.Processed, p.Imported, p.Duplicates, p.Failed, errMsg)
+	if err != nil {
+		return fmt.Errorf("failed to finish message import: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return consts.ErrDBNotFound
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMessageImports tests the lifecycle of message imports: creating,
+// claiming, progress, cancelling and finishing.
+func TestMessageImports(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping database integration test in short mode")
+	}
+
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	email := fmt.Sprintf("import-%d@example.com", time.Now().UnixNano())
+	var accountID int64
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) (err error) {
+		accountID, err = db.CreateAccount(ctx, tx, CreateAccountRequest{Email: email, Password: "password123", IsPrimary: true, HashType: "bcrypt"})
+		return err
+	}))
+
+	create := func(format string) (imp *MessageImport, err error) {
+		err = inTestTx(t, db, func(tx pgx.Tx) error {
+			imp, err = db.CreateMessageImport(ctx, tx, MessageImport{
+				AccountID: accountID,
+				Format:    format,
+				S3Key:     fmt.Sprintf("imports/%d/%d", accountID, time.Now().UnixNano()),
+				Size:      1024,
+			})
+			return err
+		})
+		return imp, err
+	}
+
+	_, err := create("maildir")
+	assert.ErrorIs(t, err, consts.ErrInvalidInput)
+
+	first, err := create(MessageImportFormatMbox)
+	require.NoError(t, err)
+	assert.Equal(t, MessageImportPending, first.Status)
+	assert.Equal(t, consts.MailboxInbox, first.Mailbox)
+	assert.Nil(t, first.Total)
+
+	// One unfinished import per account
+	_, err = create(MessageImportFormatZip)
+	assert.ErrorIs(t, err, consts.ErrImportInProgress)
+
+	claim := func(instanceID string, staleBefore time.Time) (imp *MessageImport, err error) {
+		err = inTestTx(t, db, func(tx pgx.Tx) error {
+			imp, err = db.ClaimMessageImport(ctx, tx, instanceID, staleBefore)
+			return err
+		})
+		return imp, err
+	}
+
+	// Imports of other tests may be pending too, so claim until ours
+	var claimed *MessageImport
+	for claimed == nil || claimed.ID != first.ID {
+		claimed, err = claim("node-a", time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, MessageImportRunning, claimed.Status)
+	assert.Equal(t, 1, claimed.Attempts)
+
+	total := 10
+	progress := MessageImportProgress{Total: &total, Processed: 4, Imported: 3, Duplicates: 1}
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.UpdateMessageImportProgress(ctx, tx, first.ID, "node-a", progress)
+	}))
+
+	// Only the claiming instance stores progress
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.UpdateMessageImportProgress(ctx, tx, first.ID, "node-b", progress)
+	})
+	assert.ErrorIs(t, err, consts.ErrDBNotFound)
+
+	// A running import with a stale heartbeat is taken over and resumes
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `UPDATE message_imports SET heartbeat_at = now() - interval '1 hour' WHERE id = $1`, first.ID)
+		return err
+	}))
+	claimed = nil
+	for claimed == nil || claimed.ID != first.ID {
+		claimed, err = claim("node-b", time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, claimed.Attempts)
+	assert.Equal(t, 4, claimed.Processed)
+	require.NotNil(t, claimed.Total)
+	assert.Equal(t, 10, *claimed.Total)
+
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.UpdateMessageImportProgress(ctx, tx, first.ID, "node-a", progress)
+	})
+	assert.ErrorIs(t, err, consts.ErrDBNotFound)
+
+	// Cancelling returns the import as it was
+	var cancelled *MessageImport
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) (err error) {
+		cancelled, err = db.CancelMessageImport(ctx, tx, accountID, first.ID)
+		return err
+	}))
+	assert.Equal(t, MessageImportRunning, cancelled.Status)
+	assert.Equal(t, first.S3Key, cancelled.S3Key)
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		_, err := db.CancelMessageImport(ctx, tx, accountID, first.ID)
+		return err
+	})
+	assert.ErrorIs(t, err, consts.ErrDBNotFound)
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.FinishMessageImport(ctx, tx, first.ID, "node-b", MessageImportCompleted, progress, "")
+	})
+	assert.ErrorIs(t, err, consts.ErrDBNotFound)
+
+	// A new import can start once the previous one ended
+	second, err := create(MessageImportFormatZip)
+	require.NoError(t, err)
+	claimed = nil
+	for claimed == nil || claimed.ID != second.ID {
+		claimed, err = claim("node-a", time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+	}
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.FinishMessageImport(ctx, tx, second.ID, "node-a", MessageImportFailed, progress, "mailbox full")
+	}))
+
+	got, err := db.GetMessageImport(ctx, accountID, second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, MessageImportFailed, got.Status)
+	assert.Equal(t, "mailbox full", got.Error)
+	assert.NotNil(t, got.FinishedAt)
+
+	_, err = db.GetMessageImport(ctx, accountID+1000000, second.ID)
+	assert.ErrorIs(t, err, consts.ErrDBNotFound)
+
+	imports, err := db.ListMessageImports(ctx, accountID)
+	require.NoError(t, err)
+	require.Len(t, imports, 2)
+	assert.Equal(t, second.ID, imports[0].ID)
+	assert.Equal(t, MessageImportCancelled, imports[1].Status)
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/emersion/go-imap/v2"
+	"github.com/jackc/pgx/v5"
 	"github.com/migadu/sora/consts"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -552,6 +553,79 @@ func TestInsertMessage(t *testing.T) {
 	t.Logf("Successfully tested InsertMessage with accountID: %d, mailboxID: %d, messageID: %d, UID: %d", accountID, mailboxID, messageID, uid)
 }
 
+// TestInsertMessageIntoMailboxes tests delivering a message to several mailboxes at once
+func TestInsertMessageIntoMailboxes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping database integration test in short mode")
+	}
+
+	db, accountID, inboxID := setupMessageTestDatabase(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	workID := createTestMailbox(t, db, accountID, "Work")
+	archiveID := createTestMailbox(t, db, accountID, "Archive")
+
+	now := time.Now()
+	var bs imap.BodyStructure = &imap.BodyStructureSinglePart{Type: "text", Subtype: "plain", Size: 100}
+	options := func(mailboxID int64, name string, flags ...imap.Flag) *InsertMessageOptions {
+		return &InsertMessageOptions{
+			AccountID:     accountID,
+			MailboxID:     mailboxID,
+			MailboxName:   name,
+			S3Domain:      "example.com",
+			S3Localpart:   "test",
+			ContentHash:   "multimailboxhash",
+			MessageID:     "<multi@example.com>",
+			Flags:         flags,
+			InternalDate:  now,
+			Size:          100,
+			Subject:       "Filed twice",
+			SentDate:      now,
+			BodyStructure: &bs,
+		}
+	}
+	upload := PendingUpload{AccountID: accountID, ContentHash: "multimailboxhash", InstanceID: "test-instance", Size: 100}
+
+	insert := func(options ...*InsertMessageOptions) ([]int64, error) {
+		var uids []int64
+		err := inTestTx(t, db, func(tx pgx.Tx) error {
+			var err error
+			uids, err = db.InsertMessageIntoMailboxes(ctx, tx, options, upload)
+			return err
+		})
+		return uids, err
+	}
+
+	uids, err := insert(options(inboxID, "INBOX", imap.FlagSeen), options(workID, "Work"))
+	require.NoError(t, err)
+	require.Len(t, uids, 2)
+
+	inbox, err := db.ListMessages(ctx, inboxID)
+	require.NoError(t, err)
+	require.Len(t, inbox, 1)
+	assert.Equal(t, uids[0], int64(inbox[0].UID))
+	assert.Contains(t, BitwiseToFlags(inbox[0].BitwiseFlags), imap.FlagSeen)
+	work, err := db.ListMessages(ctx, workID)
+	require.NoError(t, err)
+	assert.Len(t, work, 1)
+
+	// Delivering again only adds the missing copy
+	_, err = insert(options(inboxID, "INBOX"), options(workID, "Work"))
+	assert.ErrorIs(t, err, consts.ErrMessageExists)
+
+	uids, err = insert(options(inboxID, "INBOX"), options(archiveID, "Archive"))
+	require.NoError(t, err)
+	assert.Zero(t, uids[0], "INBOX already holds the message")
+	assert.NotZero(t, uids[1])
+	archive, err := db.ListMessages(ctx, archiveID)
+	require.NoError(t, err)
+	assert.Len(t, archive, 1)
+	inbox, err = db.ListMessages(ctx, inboxID)
+	require.NoError(t, err)
+	assert.Len(t, inbox, 1)
+}
+
 // TestInsertMessageFromImporter tests message insertion from importer
 func TestInsertMessageFromImporter(t *testing.T) {
 	if testing.Short() {
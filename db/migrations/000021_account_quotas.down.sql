@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS domain_quotas;
+ALTER TABLE accounts DROP COLUMN IF EXISTS quota_messages;
+ALTER TABLE accounts DROP COLUMN IF EXISTS quota_storage;
@@ -0,0 +1,30 @@
+-- Per-account and per-domain storage/message quotas (RFC 9208 STORAGE and
+-- MESSAGE resources).
+--
+-- Limits are stored on the account itself. A NULL limit means "inherit the
+-- domain default"; a value of 0 means "explicitly unlimited" and overrides any
+-- domain default. Domain defaults live in domain_quotas keyed by the domain of
+-- the account's primary credential. If neither is set the account is unlimited.
+--
+-- STORAGE limits are stored in bytes. The IMAP layer converts to the 1024-octet
+-- units required by RFC 9208 when reporting.
+--
+-- Usage is NOT stored here. It is derived from mailbox_stats (total_size and
+-- message_count), which is already maintained incrementally by triggers, so
+-- there is no second counter that could drift.
+--
+-- ── LOCKING / PERFORMANCE NOTES ────────────────────────────────────────────
+-- Adding nullable columns without a DEFAULT is a catalog-only change on
+-- PostgreSQL 11+ — no table rewrite.
+
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS quota_storage BIGINT;
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS quota_messages BIGINT;
+
+CREATE TABLE IF NOT EXISTS domain_quotas (
+	domain TEXT PRIMARY KEY,                  -- Lowercased domain name
+	quota_storage BIGINT,                     -- Default storage limit in bytes (NULL/0 = unlimited)
+	quota_messages BIGINT,                    -- Default message count limit (NULL/0 = unlimited)
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	CONSTRAINT domain_quotas_domain_lowercase CHECK (domain = LOWER(domain))
+);
@@ -0,0 +1,17 @@
+-- Persist the References header chain (RFC 5322 section 3.6.4) for threading.
+--
+-- THREAD=REFERENCES (RFC 5256) links messages using Message-ID, In-Reply-To
+-- and References. The first two already have columns; storing References here
+-- lets the IMAP server compute threads from PostgreSQL instead of re-parsing
+-- message bodies from S3.
+--
+-- Message IDs are stored without angle brackets, oldest ancestor first, the
+-- same representation used for message_id and in_reply_to. Messages stored
+-- before this migration have NULL and are threaded by In-Reply-To alone.
+--
+-- ── LOCKING / PERFORMANCE NOTES ────────────────────────────────────────────
+-- Adding a nullable column without a DEFAULT is a catalog-only change on
+-- PostgreSQL 11+ — no table rewrite. No index is needed: threading reads the
+-- rows of a single mailbox, which are already reached via mailbox_id indexes.
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS message_references TEXT[];
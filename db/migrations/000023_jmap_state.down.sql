@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_messages_account_thread;
+DROP INDEX IF EXISTS idx_messages_account_modseq;
+DROP FUNCTION IF EXISTS jmap_thread_id(TEXT[], TEXT, TEXT, TEXT);
+DROP TRIGGER IF EXISTS trigger_mailboxes_tombstone ON mailboxes;
+DROP FUNCTION IF EXISTS record_mailbox_tombstone();
+DROP TABLE IF EXISTS mailbox_tombstones;
+DROP TRIGGER IF EXISTS trigger_mailboxes_modseq_update ON mailboxes;
+DROP TRIGGER IF EXISTS trigger_mailboxes_modseq_insert ON mailboxes;
+DROP FUNCTION IF EXISTS maintain_mailbox_modseq();
+ALTER TABLE mailboxes DROP COLUMN IF EXISTS updated_modseq;
+ALTER TABLE mailboxes DROP COLUMN IF EXISTS created_modseq;
@@ -0,0 +1,106 @@
+-- Change tracking for the JMAP server (RFC 8620 section 5.2, RFC 8621).
+--
+-- JMAP clients resynchronise with Foo/changes, which needs to know which
+-- objects were created, updated or destroyed since a given state. Messages
+-- already carry created/updated/expunged modseqs drawn from the global
+-- messages_modseq sequence; this migration gives mailboxes the same treatment
+-- so that a single account-wide modseq can serve as the state string of every
+-- JMAP data type.
+--
+-- Mailboxes get created_modseq/updated_modseq maintained by a trigger. The
+-- trigger only fires on the columns JMAP exposes: highest_uid changes on every
+-- delivery and must not bump the mailbox itself (counts are reported through
+-- the message modseqs). Deleted mailboxes leave a row in mailbox_tombstones so
+-- that Mailbox/changes can report them as destroyed; the cleaner prunes
+-- tombstones after the same grace period as expunged messages.
+--
+-- jmap_thread_id() derives a stable thread id from the first message of the
+-- References chain, falling back to In-Reply-To, the message's own Message-ID
+-- and finally its content hash.
+--
+-- ── LOCKING / PERFORMANCE NOTES ────────────────────────────────────────────
+-- Adding nullable columns without a DEFAULT is a catalog-only change on
+-- PostgreSQL 11+ — no table rewrite. Existing mailboxes keep NULL modseqs,
+-- which JMAP treats as 0 (unchanged since before any state a client can hold).
+--
+-- The two message indexes use regular CREATE INDEX (not CONCURRENTLY) because
+-- golang-migrate wraps migrations in a transaction. This takes a SHARE lock on
+-- messages, blocking writes while the indexes are built. For zero-downtime
+-- deployments on large databases, create the function and the indexes
+-- manually first with CREATE INDEX CONCURRENTLY; this migration then becomes a
+-- no-op for them due to IF NOT EXISTS.
+--   idx_messages_account_modseq: account state and Email/changes
+--   idx_messages_account_thread: Thread/get and Email threadId lookups
+
+ALTER TABLE mailboxes ADD COLUMN IF NOT EXISTS created_modseq BIGINT;
+ALTER TABLE mailboxes ADD COLUMN IF NOT EXISTS updated_modseq BIGINT;
+
+CREATE OR REPLACE FUNCTION maintain_mailbox_modseq()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        NEW.created_modseq := nextval('messages_modseq');
+    ELSIF NEW.name IS DISTINCT FROM OLD.name
+       OR NEW.path IS DISTINCT FROM OLD.path
+       OR NEW.subscribed IS DISTINCT FROM OLD.subscribed THEN
+        NEW.updated_modseq := nextval('messages_modseq');
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trigger_mailboxes_modseq_insert ON mailboxes;
+CREATE TRIGGER trigger_mailboxes_modseq_insert
+    BEFORE INSERT ON mailboxes
+    FOR EACH ROW
+    EXECUTE FUNCTION maintain_mailbox_modseq();
+
+DROP TRIGGER IF EXISTS trigger_mailboxes_modseq_update ON mailboxes;
+CREATE TRIGGER trigger_mailboxes_modseq_update
+    BEFORE UPDATE OF name, path, subscribed ON mailboxes
+    FOR EACH ROW
+    EXECUTE FUNCTION maintain_mailbox_modseq();
+
+CREATE TABLE IF NOT EXISTS mailbox_tombstones (
+	mailbox_id BIGINT PRIMARY KEY,           -- ID of the deleted mailbox
+	account_id BIGINT NOT NULL,              -- Owner of the deleted mailbox (no FK: accounts are purged later)
+	deleted_modseq BIGINT NOT NULL,          -- Modseq of the deletion
+	deleted_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_mailbox_tombstones_account_modseq ON mailbox_tombstones (account_id, deleted_modseq);
+CREATE INDEX IF NOT EXISTS idx_mailbox_tombstones_deleted_at ON mailbox_tombstones (deleted_at);
+
+CREATE OR REPLACE FUNCTION record_mailbox_tombstone()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO mailbox_tombstones (mailbox_id, account_id, deleted_modseq)
+    VALUES (OLD.id, OLD.account_id, nextval('messages_modseq'))
+    ON CONFLICT (mailbox_id) DO NOTHING;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trigger_mailboxes_tombstone ON mailboxes;
+CREATE TRIGGER trigger_mailboxes_tombstone
+    AFTER DELETE ON mailboxes
+    FOR EACH ROW
+    WHEN (OLD.account_id IS NOT NULL)
+    EXECUTE FUNCTION record_mailbox_tombstone();
+
+CREATE OR REPLACE FUNCTION jmap_thread_id(refs TEXT[], in_reply_to TEXT, message_id TEXT, content_hash TEXT)
+RETURNS TEXT AS $$
+    SELECT md5(COALESCE(
+        NULLIF(btrim(refs[1], '<> '), ''),
+        NULLIF(btrim(split_part(btrim(COALESCE(in_reply_to, '')), ' ', 1), '<> '), ''),
+        NULLIF(btrim(message_id, '<> '), ''),
+        content_hash
+    ))
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE;
+
+CREATE INDEX IF NOT EXISTS idx_messages_account_modseq
+    ON messages (account_id, (GREATEST(created_modseq, updated_modseq, expunged_modseq)));
+
+CREATE INDEX IF NOT EXISTS idx_messages_account_thread
+    ON messages (account_id, jmap_thread_id(message_references, in_reply_to, message_id, content_hash))
+    WHERE expunged_at IS NULL;
@@ -0,0 +1,29 @@
+-- Webhook subscriptions for the mailbox event stream.
+--
+-- A subscription receives the events of a single account (account_id), of
+-- every account in a domain (domain), or of all accounts when both are NULL.
+-- event_types restricts delivery to the listed event types; an empty array
+-- means all types. Each delivery is signed with HMAC-SHA256 using secret so
+-- that receivers can verify its origin.
+--
+-- Subscriptions are read by every node and cached in memory; deliveries are
+-- queued on the local disk of the node that produced the event, so this table
+-- only stores configuration and sees no write traffic from mail activity.
+
+CREATE TABLE IF NOT EXISTS event_subscriptions (
+	id BIGSERIAL PRIMARY KEY,
+	account_id BIGINT REFERENCES accounts(id) ON DELETE CASCADE, -- Subscribed account (NULL = domain or global)
+	domain TEXT,                                                 -- Subscribed domain (NULL = account or global)
+	url TEXT NOT NULL,                                           -- Webhook endpoint (http or https)
+	secret TEXT NOT NULL,                                        -- HMAC-SHA256 signing secret
+	event_types TEXT[] NOT NULL DEFAULT '{}',                    -- Delivered event types (empty = all)
+	description TEXT NOT NULL DEFAULT '',
+	enabled BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	CONSTRAINT event_subscriptions_single_scope CHECK (account_id IS NULL OR domain IS NULL),
+	CONSTRAINT event_subscriptions_domain_lowercase CHECK (domain = LOWER(domain))
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_subscriptions_account_id ON event_subscriptions (account_id) WHERE account_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_event_subscriptions_domain ON event_subscriptions (domain) WHERE domain IS NOT NULL;
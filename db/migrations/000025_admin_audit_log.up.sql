@@ -0,0 +1,33 @@
+-- Audit trail of mutating administrative operations.
+--
+-- Every POST, PUT and DELETE served by the admin API and every mutating
+-- sora-admin subcommand appends one row. Rows are never updated; retention is
+-- left to the operator (e.g. a periodic DELETE ... WHERE created_at < ...).
+--
+-- actor identifies who performed the operation: "api-key:<fingerprint>" for
+-- the admin API, where the fingerprint is a SHA-256 prefix of the API key so
+-- that the key itself is never stored, or "cli:<os user>" for sora-admin.
+-- payload_hash is the hex SHA-256 of the request body (API) or of the
+-- subcommand arguments (CLI), so that a request can be matched against a
+-- known payload without storing passwords or message contents.
+
+CREATE TABLE IF NOT EXISTS admin_audit_log (
+	id BIGSERIAL PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	actor TEXT NOT NULL,                  -- API key fingerprint or OS user
+	source TEXT NOT NULL,                 -- 'api' or 'cli'
+	source_ip TEXT NOT NULL DEFAULT '',   -- Client IP (API) or host name (CLI)
+	action TEXT NOT NULL,                 -- e.g. 'account.delete', 'connections.kick'
+	target_account TEXT NOT NULL DEFAULT '',
+	target_mailbox TEXT NOT NULL DEFAULT '',
+	payload_hash TEXT NOT NULL DEFAULT '',
+	result TEXT NOT NULL,                 -- 'success' or 'failure'
+	status_code INT NOT NULL DEFAULT 0,   -- HTTP status (API) or exit code (CLI)
+	error TEXT NOT NULL DEFAULT '',
+	CONSTRAINT admin_audit_log_source CHECK (source IN ('api', 'cli')),
+	CONSTRAINT admin_audit_log_result CHECK (result IN ('success', 'failure'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_audit_log_created_at ON admin_audit_log (created_at);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_log_action ON admin_audit_log (action, created_at);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_log_target_account ON admin_audit_log (target_account, created_at) WHERE target_account <> '';
@@ -0,0 +1,48 @@
+-- First-class domains with domain-level policies, and alias addresses.
+--
+-- Domains remain optional: an address whose domain has no row here behaves as
+-- before (active, no account limit, no catch-all, all server Sieve extensions,
+-- shared mailboxes allowed). The default quota of a domain stays in
+-- domain_quotas so that the quota code has a single source.
+--
+-- status 'suspended' rejects logins and deliveries for every address of the
+-- domain without touching the accounts themselves.
+-- catch_all receives mail for addresses of the domain that match neither a
+-- credential nor an alias.
+-- sieve_extensions restricts the Sieve extensions that scripts of the domain
+-- may use; NULL means all extensions enabled on the server.
+--
+-- An alias fans out to one or more targets. A target that is the address of
+-- an account is delivered locally, any other target is forwarded through the
+-- relay. Targets are not expanded recursively.
+
+CREATE TABLE IF NOT EXISTS domains (
+	name TEXT PRIMARY KEY,                          -- Lowercased domain name
+	status TEXT NOT NULL DEFAULT 'active',          -- 'active' or 'suspended'
+	max_accounts INTEGER,                           -- Maximum number of accounts (NULL = unlimited)
+	catch_all TEXT,                                 -- Catch-all target address (NULL = none)
+	sieve_extensions TEXT[],                        -- Allowed Sieve extensions (NULL = server default)
+	shared_mailboxes BOOLEAN NOT NULL DEFAULT TRUE, -- Whether shared mailboxes may be created and granted
+	description TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	CONSTRAINT domains_name_lowercase CHECK (name = LOWER(name)),
+	CONSTRAINT domains_status_valid CHECK (status IN ('active', 'suspended')),
+	CONSTRAINT domains_max_accounts_positive CHECK (max_accounts IS NULL OR max_accounts >= 0)
+);
+
+CREATE TABLE IF NOT EXISTS aliases (
+	id BIGSERIAL PRIMARY KEY,
+	address TEXT NOT NULL,                                         -- Lowercased alias address
+	domain TEXT NOT NULL REFERENCES domains(name) ON DELETE CASCADE,
+	targets TEXT[] NOT NULL,                                       -- Account or external addresses
+	description TEXT NOT NULL DEFAULT '',
+	enabled BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	CONSTRAINT aliases_address_lowercase CHECK (address = LOWER(address)),
+	CONSTRAINT aliases_targets_not_empty CHECK (cardinality(targets) > 0)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_aliases_address ON aliases (address);
+CREATE INDEX IF NOT EXISTS idx_aliases_domain ON aliases (domain);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_accounts_delete_scheduled_at;
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS accounts_status_valid;
+ALTER TABLE accounts DROP COLUMN IF EXISTS delete_scheduled_at;
+ALTER TABLE accounts DROP COLUMN IF EXISTS status_expires_at;
+ALTER TABLE accounts DROP COLUMN IF EXISTS status_reason;
+ALTER TABLE accounts DROP COLUMN IF EXISTS status;
@@ -0,0 +1,28 @@
+-- Account lifecycle states.
+--
+-- status controls which protocols an account may use without deleting it:
+--   active         normal operation
+--   suspended      logins and deliveries are refused
+--   receive-only   logins are refused, mail is still delivered
+--   send-disabled  logins and deliveries are allowed, submission is refused
+--
+-- status_expires_at, when set, ends a non-active status: from that moment the
+-- account is treated as active again without a write.
+-- delete_scheduled_at, when set, makes the cleaner soft-delete the account at
+-- that time; the usual grace period before purging then applies.
+--
+-- ── LOCKING / PERFORMANCE NOTES ────────────────────────────────────────────
+-- Adding a column with a constant DEFAULT is a catalog-only change on
+-- PostgreSQL 11+ — no table rewrite.
+
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS status_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS status_expires_at TIMESTAMPTZ;
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS delete_scheduled_at TIMESTAMPTZ;
+
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS accounts_status_valid;
+ALTER TABLE accounts ADD CONSTRAINT accounts_status_valid
+	CHECK (status IN ('active', 'suspended', 'receive-only', 'send-disabled'));
+
+CREATE INDEX IF NOT EXISTS idx_accounts_delete_scheduled_at ON accounts (delete_scheduled_at)
+	WHERE delete_scheduled_at IS NOT NULL AND deleted_at IS NULL;
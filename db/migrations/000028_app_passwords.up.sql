@@ -0,0 +1,25 @@
+-- App-specific passwords.
+--
+-- An account may have any number of named app passwords besides the password
+-- of its credentials. Each app password is only accepted for the protocols
+-- listed in protocols and, when allowed_ips is not empty, from clients inside
+-- one of those networks. App passwords are generated by the server, so an
+-- unsalted SHA-512 hash is sufficient and keeps checking all of an account's
+-- app passwords cheap.
+--
+-- Revoking an app password deletes its row.
+
+CREATE TABLE IF NOT EXISTS app_passwords (
+	id BIGSERIAL PRIMARY KEY,
+	account_id BIGINT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,                             -- Label chosen by the user, unique per account
+	password TEXT NOT NULL,                         -- Hashed secret
+	protocols TEXT[] NOT NULL,                      -- Protocols the password may be used for
+	allowed_ips TEXT[] NOT NULL DEFAULT '{}',       -- Allowed client networks in CIDR notation (empty = any)
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	last_used_at TIMESTAMPTZ,
+	last_used_ip TEXT,
+	CONSTRAINT app_passwords_protocols_not_empty CHECK (cardinality(protocols) > 0)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_app_passwords_account_name ON app_passwords (account_id, name);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_account_totp_recovery_codes_account;
+DROP TABLE IF EXISTS account_totp_recovery_codes;
+DROP TABLE IF EXISTS account_totp;
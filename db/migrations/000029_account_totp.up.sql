@@ -0,0 +1,26 @@
+-- TOTP second factor for the User API.
+--
+-- An account has at most one TOTP secret. The row is created when enrolment
+-- starts and only takes effect once enabled_at is set, after the user proved
+-- that the authenticator app produces valid codes. last_used_step is the time
+-- step of the last accepted code, so that a code can not be used twice.
+--
+-- Recovery codes are single-use and stored as SHA-512 hashes. Removing the
+-- second factor deletes the secret and its recovery codes.
+
+CREATE TABLE IF NOT EXISTS account_totp (
+	account_id BIGINT PRIMARY KEY REFERENCES accounts(id) ON DELETE CASCADE,
+	secret TEXT NOT NULL,                           -- Base32 encoded shared secret
+	enabled_at TIMESTAMPTZ,                         -- NULL while enrolment is pending
+	last_used_step BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS account_totp_recovery_codes (
+	id BIGSERIAL PRIMARY KEY,
+	account_id BIGINT NOT NULL REFERENCES account_totp(account_id) ON DELETE CASCADE,
+	code_hash TEXT NOT NULL,
+	used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_totp_recovery_codes_account ON account_totp_recovery_codes (account_id);
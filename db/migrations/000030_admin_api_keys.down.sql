@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_admin_api_keys_key_hash;
+DROP INDEX IF EXISTS idx_admin_api_keys_name;
+DROP TABLE IF EXISTS admin_api_keys;
@@ -0,0 +1,22 @@
+-- Admin API keys managed through the admin API.
+--
+-- Besides the keys in the configuration file, the admin API accepts the keys
+-- stored here. Each key carries the scopes it grants and, when domains is not
+-- empty, the domains it may act on. Keys are generated by the server, so an
+-- unsalted SHA-512 hash is sufficient and can be looked up directly.
+--
+-- Revoking a key deletes its row.
+
+CREATE TABLE IF NOT EXISTS admin_api_keys (
+	id BIGSERIAL PRIMARY KEY,
+	name TEXT NOT NULL,                             -- Label shown in the audit log, unique
+	key_hash TEXT NOT NULL,                         -- Hashed key
+	scopes TEXT[] NOT NULL,                         -- Granted scopes
+	domains TEXT[] NOT NULL DEFAULT '{}',           -- Domains the key may act on (empty = any)
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	last_used_at TIMESTAMPTZ,
+	CONSTRAINT admin_api_keys_scopes_not_empty CHECK (cardinality(scopes) > 0)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_admin_api_keys_name ON admin_api_keys (name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_admin_api_keys_key_hash ON admin_api_keys (key_hash);
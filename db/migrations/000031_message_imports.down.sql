@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_message_imports_unfinished;
+DROP INDEX IF EXISTS idx_message_imports_account_id;
+DROP TABLE IF EXISTS message_imports;
@@ -0,0 +1,36 @@
+-- Message imports uploaded through the user API.
+--
+-- An uploaded mbox file or zip archive is kept in object storage under
+-- s3_key until the import ends. The import runs as a background job on any
+-- server running the user API: a server claims a pending import, or a running
+-- one whose heartbeat stopped, and ingests the messages through the normal
+-- delivery path. processed counts the messages read so far, so an interrupted
+-- import resumes after them; messages delivered twice are skipped as
+-- duplicates. An account has at most one unfinished import.
+
+CREATE TABLE IF NOT EXISTS message_imports (
+	id BIGSERIAL PRIMARY KEY,
+	account_id BIGINT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+	format TEXT NOT NULL,                            -- mbox or zip
+	mailbox TEXT NOT NULL,                           -- Target mailbox of mbox files and loose .eml files
+	s3_key TEXT NOT NULL,                            -- Uploaded archive
+	size BIGINT NOT NULL,                            -- Size of the archive in bytes
+	status TEXT NOT NULL DEFAULT 'pending',
+	total INTEGER,                                   -- Messages in the archive, once counted
+	processed INTEGER NOT NULL DEFAULT 0,            -- Messages read, whatever the outcome
+	imported INTEGER NOT NULL DEFAULT 0,
+	duplicates INTEGER NOT NULL DEFAULT 0,
+	failed INTEGER NOT NULL DEFAULT 0,
+	attempts INTEGER NOT NULL DEFAULT 0,             -- Times the import was claimed
+	error TEXT,
+	claimed_by TEXT,
+	heartbeat_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	finished_at TIMESTAMPTZ,
+	CONSTRAINT message_imports_format_check CHECK (format IN ('mbox', 'zip')),
+	CONSTRAINT message_imports_status_check CHECK (status IN ('pending', 'running', 'completed', 'failed', 'cancelled'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_imports_account_id ON message_imports (account_id, created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_message_imports_unfinished ON message_imports (account_id) WHERE status IN ('pending', 'running');
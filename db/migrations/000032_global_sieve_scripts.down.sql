@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_global_sieve_scripts_scope_name;
+DROP TABLE IF EXISTS global_sieve_scripts;
@@ -0,0 +1,25 @@
+-- Sieve scripts managed by the administrator.
+--
+-- Before scripts run before the active script of the account, after scripts
+-- run after it. A script applies to the accounts of one domain, or to all
+-- accounts when domain is NULL. Within a phase, global scripts wrap domain
+-- scripts: global before scripts run first and global after scripts run
+-- last. Scripts of the same scope and phase run in the order of their names.
+--
+-- The scripts are read by every node delivering mail and cached in memory
+-- for a short time.
+
+CREATE TABLE IF NOT EXISTS global_sieve_scripts (
+	id BIGSERIAL PRIMARY KEY,
+	domain TEXT,                                   -- Domain the script applies to (NULL = all domains)
+	phase TEXT NOT NULL,                           -- 'before' or 'after' the script of the account
+	name TEXT NOT NULL,                            -- Unique within the scope, orders scripts of a phase
+	script TEXT NOT NULL,
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	CONSTRAINT global_sieve_scripts_phase CHECK (phase IN ('before', 'after')),
+	CONSTRAINT global_sieve_scripts_domain_lowercase CHECK (domain = LOWER(domain))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_global_sieve_scripts_scope_name ON global_sieve_scripts (COALESCE(domain, ''), name);
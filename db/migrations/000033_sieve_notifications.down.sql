@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_sieve_notifications_account_sent_at;
+DROP TABLE IF EXISTS sieve_notifications;
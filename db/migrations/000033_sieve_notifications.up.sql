@@ -0,0 +1,14 @@
+-- Notifications sent by the Sieve enotify extension (RFC 5435).
+--
+-- Each row is a notification of an account. The rows of the last rate limit
+-- window are counted before a notification is sent; older rows of the
+-- account are removed when a notification is recorded.
+
+CREATE TABLE IF NOT EXISTS sieve_notifications (
+	id BIGSERIAL PRIMARY KEY,
+	account_id BIGINT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+	method TEXT NOT NULL,                          -- Notification method, a mailto URI
+	sent_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sieve_notifications_account_sent_at ON sieve_notifications (account_id, sent_at);
@@ -118,14 +118,14 @@ func (db *Database) MoveMessages(ctx context.Context, tx pgx.Tx, ids *[]imap.UID
 		// The expunged messages are now excluded from the unique index, so this succeeds
 		_, err = tx.Exec(ctx, `
 			INSERT INTO messages (
-				account_id, content_hash, uploaded, message_id, in_reply_to,
+				account_id, content_hash, uploaded, message_id, in_reply_to, message_references,
 				subject, sent_date, internal_date, flags, custom_flags, size,
 				body_structure, recipients_json, s3_domain, s3_localpart,
 				subject_sort, from_name_sort, from_email_sort, to_name_sort, to_email_sort, cc_email_sort,
 				mailbox_id, mailbox_path, flags_changed_at, created_modseq, uid
 			)
 			SELECT
-				m.account_id, m.content_hash, m.uploaded, m.message_id, m.in_reply_to,
+				m.account_id, m.content_hash, m.uploaded, m.message_id, m.in_reply_to, m.message_references,
 				m.subject, m.sent_date, m.internal_date, m.flags, m.custom_flags, m.size,
 				m.body_structure, m.recipients_json, m.s3_domain, m.s3_localpart,
 				m.subject_sort, m.from_name_sort, m.from_email_sort, m.to_name_sort, m.to_email_sort, m.cc_email_sort,
@@ -146,14 +146,14 @@ func (db *Database) MoveMessages(ctx context.Context, tx pgx.Tx, ids *[]imap.UID
 		// Different mailbox: normal insert from existing rows
 		_, err = tx.Exec(ctx, `
 			INSERT INTO messages (
-				account_id, content_hash, uploaded, message_id, in_reply_to,
+				account_id, content_hash, uploaded, message_id, in_reply_to, message_references,
 				subject, sent_date, internal_date, flags, custom_flags, size,
 				body_structure, recipients_json, s3_domain, s3_localpart,
 				subject_sort, from_name_sort, from_email_sort, to_name_sort, to_email_sort, cc_email_sort,
 				mailbox_id, mailbox_path, flags_changed_at, created_modseq, uid
 			)
 			SELECT
-				m.account_id, m.content_hash, m.uploaded, m.message_id, m.in_reply_to,
+				m.account_id, m.content_hash, m.uploaded, m.message_id, m.in_reply_to, m.message_references,
 				m.subject, m.sent_date, m.internal_date, m.flags, m.custom_flags, m.size,
 				m.body_structure, m.recipients_json, m.s3_domain, m.s3_localpart,
 				m.subject_sort, m.from_name_sort, m.from_email_sort, m.to_name_sort, m.to_email_sort, m.cc_email_sort,
@@ -188,5 +188,9 @@ func (db *Database) MoveMessages(ctx context.Context, tx pgx.Tx, ids *[]imap.UID
 		}
 	}
 
+	if err := notifyMailboxChange(ctx, tx, srcMailboxID, destMailboxID); err != nil {
+		return nil, err
+	}
+
 	return messageUIDMap, nil
 }
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/logger"
+)
+
+// MailboxChangeChannel is the PostgreSQL notification channel on which
+// writers signal that a mailbox has changed. The payload is the mailbox ID.
+const MailboxChangeChannel = "sora_mailbox_changes"
+
+// mailboxChangeNotifications enables pg_notify in the mailbox writers. It is
+// off by default so that deployments without push-driven IDLE do not pay for
+// the notification queue.
+var mailboxChangeNotifications atomic.Bool
+
+// SetMailboxChangeNotifications enables or disables publishing mailbox change
+// signals from message writes (append, copy, move, flag changes, expunge).
+func SetMailboxChangeNotifications(enabled bool) {
+	mailboxChangeNotifications.Store(enabled)
+}
+
+// MailboxChangeNotificationsEnabled reports whether mailbox change signals are
+// published.
+func MailboxChangeNotificationsEnabled() bool {
+	return mailboxChangeNotifications.Load()
+}
+
+// notifyMailboxChange queues a change signal for each mailbox. PostgreSQL
+// delivers the signals when tx commits and discards them on rollback; identical
+// signals within one transaction are delivered once.
+func notifyMailboxChange(ctx context.Context, tx pgx.Tx, mailboxIDs ...int64) error {
+	if !mailboxChangeNotifications.Load() || len(mailboxIDs) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx, `SELECT pg_notify($1, id::text) FROM unnest($2::bigint[]) AS id`, MailboxChangeChannel, mailboxIDs)
+	if err != nil {
+		return fmt.Errorf("failed to notify mailbox change: %w", err)
+	}
+	return nil
+}
+
+// ListenMailboxChanges takes a dedicated connection out of the write pool,
+// listens on MailboxChangeChannel and calls handler for every signal until ctx
+// is cancelled or the connection fails. onListening, if non-nil, is called
+// once the LISTEN is in effect. The returned error is never nil; callers are
+// expected to reconnect.
+func (db *Database) ListenMailboxChanges(ctx context.Context, onListening func(), handler func(mailboxID int64)) error {
+	poolConn, err := db.WritePool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire listen connection: %w", err)
+	}
+	// The connection is kept for as long as we listen, so it must not count
+	// against (or be returned to) the pool
+	conn := poolConn.Hijack()
+	defer conn.Close(context.WithoutCancel(ctx))
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{MailboxChangeChannel}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to listen for mailbox changes: %w", err)
+	}
+	if onListening != nil {
+		onListening()
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("mailbox change listener stopped: %w", err)
+		}
+		mailboxID, err := strconv.ParseInt(notification.Payload, 10, 64)
+		if err != nil {
+			logger.Warn("Database: ignoring malformed mailbox change notification", "payload", notification.Payload)
+			continue
+		}
+		handler(mailboxID)
+	}
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifyMailboxChange_Disabled(t *testing.T) {
+	SetMailboxChangeNotifications(false)
+	// Disabled notifications must not touch the transaction
+	assert.NoError(t, notifyMailboxChange(context.Background(), nil, 1, 2))
+}
+
+// TestListenMailboxChanges tests that committed changes are delivered and
+// rolled back ones are not
+func TestListenMailboxChanges(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping database integration test in short mode")
+	}
+
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	SetMailboxChangeNotifications(true)
+	defer SetMailboxChangeNotifications(false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listening := make(chan struct{})
+	received := make(chan int64, 10)
+	go db.ListenMailboxChanges(ctx, func() { close(listening) }, func(mailboxID int64) {
+		received <- mailboxID
+	})
+
+	select {
+	case <-listening:
+	case <-time.After(10 * time.Second):
+		t.Fatal("listener did not start")
+	}
+
+	// Rolled back: no signal
+	tx, err := db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, notifyMailboxChange(ctx, tx, -1))
+	require.NoError(t, tx.Rollback(ctx))
+
+	// Committed: duplicates within the transaction are delivered once
+	tx, err = db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, notifyMailboxChange(ctx, tx, -2, -2))
+	require.NoError(t, notifyMailboxChange(ctx, tx, -2))
+	require.NoError(t, tx.Commit(ctx))
+
+	select {
+	case id := <-received:
+		assert.Equal(t, int64(-2), id)
+	case <-time.After(10 * time.Second):
+		t.Fatal("no mailbox change signal received")
+	}
+
+	select {
+	case id := <-received:
+		t.Fatalf("unexpected signal for mailbox %d", id)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
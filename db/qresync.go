@@ -0,0 +1,164 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// uidSetBounds converts a UID set into parallel arrays of range bounds usable
+// with unnest() in a query. A nil or empty set matches every UID.
+func uidSetBounds(uidSet imap.UIDSet) (starts, stops []int64) {
+	if len(uidSet) == 0 {
+		return []int64{1}, []int64{math.MaxUint32}
+	}
+	for _, r := range uidSet {
+		start, stop := int64(r.Start), int64(r.Stop)
+		if r.Stop == 0 {
+			stop = math.MaxUint32
+		}
+		if r.Start == 0 {
+			start = math.MaxUint32
+		}
+		if start > stop {
+			start, stop = stop, start
+		}
+		starts = append(starts, start)
+		stops = append(stops, stop)
+	}
+	return starts, stops
+}
+
+// GetVanishedUIDs returns the UIDs of messages in the mailbox that were expunged
+// after sinceModSeq, restricted to uidSet (all UIDs if empty). Expunged rows are
+// only kept until the cleaner's grace period ends, so expunges older than that
+// are not reported.
+func (db *Database) GetVanishedUIDs(ctx context.Context, mailboxID int64, sinceModSeq uint64, uidSet imap.UIDSet) (imap.UIDSet, error) {
+	starts, stops := uidSetBounds(uidSet)
+
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, `
+		SELECT m.uid
+		FROM messages m
+		WHERE m.mailbox_id = $1
+		  AND m.expunged_modseq IS NOT NULL
+		  AND m.expunged_modseq > $2
+		  AND EXISTS (
+		      SELECT 1 FROM unnest($3::bigint[], $4::bigint[]) AS r(lo, hi)
+		      WHERE m.uid BETWEEN r.lo AND r.hi
+		  )
+		ORDER BY m.uid
+	`, mailboxID, int64(sinceModSeq), starts, stops)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vanished messages: %w", err)
+	}
+	defer rows.Close()
+
+	var vanished imap.UIDSet
+	for rows.Next() {
+		var uid int64
+		if err := rows.Scan(&uid); err != nil {
+			return nil, fmt.Errorf("failed to scan vanished message: %w", err)
+		}
+		vanished.AddNum(imap.UID(uid))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating vanished messages: %w", err)
+	}
+	return vanished, nil
+}
+
+// GetChangedMessagesSince returns the messages of the mailbox that were added or
+// had their flags changed after sinceModSeq, restricted to uidSet (all UIDs if
+// empty), ordered by UID. Expunged messages are not included; use
+// GetVanishedUIDs for those.
+func (db *Database) GetChangedMessagesSince(ctx context.Context, mailboxID int64, sinceModSeq uint64, uidSet imap.UIDSet) ([]MessageUpdate, error) {
+	starts, stops := uidSetBounds(uidSet)
+
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, `
+		SELECT m.uid, ms.seqnum, m.flags, m.custom_flags,
+		       GREATEST(m.created_modseq, COALESCE(m.updated_modseq, 0)) AS effective_modseq
+		FROM messages m
+		JOIN message_sequences ms ON m.mailbox_id = ms.mailbox_id AND m.uid = ms.uid
+		WHERE m.mailbox_id = $1
+		  AND m.expunged_at IS NULL
+		  AND (m.created_modseq > $2 OR COALESCE(m.updated_modseq, 0) > $2)
+		  AND EXISTS (
+		      SELECT 1 FROM unnest($3::bigint[], $4::bigint[]) AS r(lo, hi)
+		      WHERE m.uid BETWEEN r.lo AND r.hi
+		  )
+		ORDER BY m.uid
+	`, mailboxID, int64(sinceModSeq), starts, stops)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query changed messages: %w", err)
+	}
+	defer rows.Close()
+
+	var updates []MessageUpdate
+	for rows.Next() {
+		var (
+			uid             int64
+			seqNum          int64
+			flags           int
+			customFlagsJSON []byte
+			modSeq          int64
+		)
+		if err := rows.Scan(&uid, &seqNum, &flags, &customFlagsJSON, &modSeq); err != nil {
+			return nil, fmt.Errorf("failed to scan changed message: %w", err)
+		}
+		var customFlags []string
+		if customFlagsJSON != nil {
+			if err := json.Unmarshal(customFlagsJSON, &customFlags); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal custom_flags for UID %d: %w", uid, err)
+			}
+		}
+		updates = append(updates, MessageUpdate{
+			UID:             imap.UID(uid),
+			SeqNum:          uint32(seqNum),
+			BitwiseFlags:    flags,
+			CustomFlags:     customFlags,
+			EffectiveModSeq: uint64(modSeq),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating changed messages: %w", err)
+	}
+	return updates, nil
+}
+
+// GetSeqNumsForUIDs returns the current sequence numbers of the given UIDs.
+// UIDs that no longer exist in the mailbox are absent from the result.
+func (db *Database) GetSeqNumsForUIDs(ctx context.Context, mailboxID int64, uids []imap.UID) (map[imap.UID]uint32, error) {
+	result := make(map[imap.UID]uint32, len(uids))
+	if len(uids) == 0 {
+		return result, nil
+	}
+
+	uidValues := make([]int64, len(uids))
+	for i, uid := range uids {
+		uidValues[i] = int64(uid)
+	}
+
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, `
+		SELECT uid, seqnum FROM message_sequences
+		WHERE mailbox_id = $1 AND uid = ANY($2)
+	`, mailboxID, uidValues)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sequence numbers: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var uid, seqNum int64
+		if err := rows.Scan(&uid, &seqNum); err != nil {
+			return nil, fmt.Errorf("failed to scan sequence number: %w", err)
+		}
+		result[imap.UID(uid)] = uint32(seqNum)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sequence numbers: %w", err)
+	}
+	return result, nil
+}
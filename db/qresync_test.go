@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUIDSetBounds(t *testing.T) {
+	starts, stops := uidSetBounds(nil)
+	assert.Equal(t, []int64{1}, starts)
+	assert.Equal(t, []int64{math.MaxUint32}, stops)
+
+	var set imap.UIDSet
+	set.AddRange(5, 10)
+	set.AddNum(20)
+	set.AddRange(30, 0) // 30:*
+	starts, stops = uidSetBounds(set)
+	assert.Equal(t, []int64{5, 20, 30}, starts)
+	assert.Equal(t, []int64{10, 20, math.MaxUint32}, stops)
+}
+
+// TestQResyncQueries tests the queries backing QRESYNC against the database
+func TestQResyncQueries(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping database integration test in short mode")
+	}
+
+	db := setupTestDatabase(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	tx, err := db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	testEmail := fmt.Sprintf("test_qresync_%d@example.com", time.Now().UnixNano())
+	_, err = db.CreateAccount(ctx, tx, CreateAccountRequest{Email: testEmail, Password: "password", IsPrimary: true, HashType: "bcrypt"})
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit(ctx))
+
+	accountID, err := db.GetAccountIDByAddress(ctx, testEmail)
+	require.NoError(t, err)
+
+	tx, err = db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, db.CreateMailbox(ctx, tx, accountID, "INBOX", nil))
+	require.NoError(t, tx.Commit(ctx))
+
+	mailbox, err := db.GetMailboxByName(ctx, accountID, "INBOX")
+	require.NoError(t, err)
+	mailboxID := mailbox.ID
+
+	tx, err = db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	for _, uid := range []uint32{1, 2, 3, 4, 5} {
+		insertTestMessageWithUIDForPoll(t, db, ctx, tx, accountID, mailboxID, "INBOX", uid, nil)
+	}
+	require.NoError(t, tx.Commit(ctx))
+
+	baseModSeq := getHighestModSeq(t, db, ctx, mailboxID)
+
+	// Expunge 2 and 4, flag 5
+	tx, err = db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	_, err = db.ExpungeMessageUIDs(ctx, tx, mailboxID, 2, 4)
+	require.NoError(t, err)
+	_, _, err = db.AddMessageFlags(ctx, tx, 5, mailboxID, []imap.Flag{imap.FlagFlagged})
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit(ctx))
+
+	t.Run("VanishedAll", func(t *testing.T) {
+		vanished, err := db.GetVanishedUIDs(ctx, mailboxID, baseModSeq, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "2,4", vanished.String())
+	})
+
+	t.Run("VanishedRestrictedToKnownUIDs", func(t *testing.T) {
+		var known imap.UIDSet
+		known.AddRange(3, 5)
+		vanished, err := db.GetVanishedUIDs(ctx, mailboxID, baseModSeq, known)
+		require.NoError(t, err)
+		assert.Equal(t, "4", vanished.String())
+	})
+
+	t.Run("VanishedAfterCurrentModSeq", func(t *testing.T) {
+		vanished, err := db.GetVanishedUIDs(ctx, mailboxID, getHighestModSeq(t, db, ctx, mailboxID), nil)
+		require.NoError(t, err)
+		assert.Empty(t, vanished)
+	})
+
+	t.Run("ChangedSince", func(t *testing.T) {
+		changed, err := db.GetChangedMessagesSince(ctx, mailboxID, baseModSeq, nil)
+		require.NoError(t, err)
+		require.Len(t, changed, 1)
+		assert.Equal(t, imap.UID(5), changed[0].UID)
+		assert.Equal(t, uint32(3), changed[0].SeqNum)
+		assert.True(t, ContainsFlag(changed[0].BitwiseFlags, FlagFlagged))
+		assert.Greater(t, changed[0].EffectiveModSeq, baseModSeq)
+	})
+
+	t.Run("SeqNumsForUIDs", func(t *testing.T) {
+		seqNums, err := db.GetSeqNumsForUIDs(ctx, mailboxID, []imap.UID{1, 2, 3, 5})
+		require.NoError(t, err)
+		assert.Equal(t, map[imap.UID]uint32{1: 1, 3: 2, 5: 3}, seqNums)
+	})
+}
@@ -0,0 +1,215 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+)
+
+// Quota limit sources, reported so that administrators can tell whether a
+// limit comes from the account itself or from its domain default.
+const (
+	QuotaSourceNone    = ""
+	QuotaSourceAccount = "account"
+	QuotaSourceDomain  = "domain"
+)
+
+// AccountQuota describes the effective quota limits and current usage of an account.
+// A limit of 0 means the resource is unlimited.
+type AccountQuota struct {
+	AccountID      int64  `json:"account_id"`
+	StorageUsed    int64  `json:"storage_used"`
+	StorageLimit   int64  `json:"storage_limit"`
+	StorageSource  string `json:"storage_source,omitempty"`
+	MessagesUsed   int64  `json:"messages_used"`
+	MessagesLimit  int64  `json:"messages_limit"`
+	MessagesSource string `json:"messages_source,omitempty"`
+}
+
+// HasLimits reports whether any quota resource is limited for this account.
+func (q *AccountQuota) HasLimits() bool {
+	return q.StorageLimit > 0 || q.MessagesLimit > 0
+}
+
+// Exceeds reports whether adding addBytes and addMessages would push the
+// account over any of its limits.
+func (q *AccountQuota) Exceeds(addBytes, addMessages int64) bool {
+	if q.StorageLimit > 0 && q.StorageUsed+addBytes > q.StorageLimit {
+		return true
+	}
+	if q.MessagesLimit > 0 && q.MessagesUsed+addMessages > q.MessagesLimit {
+		return true
+	}
+	return false
+}
+
+// IsFull reports whether the account has already reached one of its limits,
+// meaning no further message of any size can be accepted.
+func (q *AccountQuota) IsFull() bool {
+	if q.StorageLimit > 0 && q.StorageUsed >= q.StorageLimit {
+		return true
+	}
+	if q.MessagesLimit > 0 && q.MessagesUsed >= q.MessagesLimit {
+		return true
+	}
+	return false
+}
+
+// DomainQuota holds the default quota limits applied to accounts of a domain
+// that have no explicit limit of their own.
+type DomainQuota struct {
+	Domain        string `json:"domain"`
+	StorageLimit  *int64 `json:"storage_limit"`
+	MessagesLimit *int64 `json:"messages_limit"`
+}
+
+// resolveQuotaLimit picks the effective limit from an account-level and a
+// domain-level value. NULL on the account inherits the domain default; an
+// explicit 0 on the account means unlimited.
+func resolveQuotaLimit(accountLimit, domainLimit *int64) (int64, string) {
+	if accountLimit != nil {
+		if *accountLimit <= 0 {
+			return 0, QuotaSourceNone
+		}
+		return *accountLimit, QuotaSourceAccount
+	}
+	if domainLimit != nil && *domainLimit > 0 {
+		return *domainLimit, QuotaSourceDomain
+	}
+	return 0, QuotaSourceNone
+}
+
+// GetAccountQuota returns the effective quota limits for an account together with
+// its current usage, which is derived from mailbox_stats.
+func (db *Database) GetAccountQuota(ctx context.Context, accountID int64) (*AccountQuota, error) {
+	var accountStorage, accountMessages, domainStorage, domainMessages *int64
+	quota := &AccountQuota{AccountID: accountID}
+
+	err := db.GetReadPoolWithContext(ctx).QueryRow(ctx, `
+		SELECT a.quota_storage, a.quota_messages,
+			   dq.quota_storage, dq.quota_messages,
+			   COALESCE(u.total_size, 0), COALESCE(u.message_count, 0)
+		FROM accounts a
+		LEFT JOIN credentials c ON c.account_id = a.id AND c.primary_identity = TRUE
+		LEFT JOIN domain_quotas dq ON dq.domain = SPLIT_PART(LOWER(c.address), '@', 2)
+		LEFT JOIN LATERAL (
+			SELECT SUM(ms.total_size)::BIGINT AS total_size, SUM(ms.message_count)::BIGINT AS message_count
+			FROM mailboxes mb
+			JOIN mailbox_stats ms ON ms.mailbox_id = mb.id
+			WHERE mb.account_id = a.id
+		) u ON TRUE
+		WHERE a.id = $1 AND a.deleted_at IS NULL
+	`, accountID).Scan(&accountStorage, &accountMessages, &domainStorage, &domainMessages,
+		&quota.StorageUsed, &quota.MessagesUsed)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, consts.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get quota for account %d: %w", accountID, err)
+	}
+
+	quota.StorageLimit, quota.StorageSource = resolveQuotaLimit(accountStorage, domainStorage)
+	quota.MessagesLimit, quota.MessagesSource = resolveQuotaLimit(accountMessages, domainMessages)
+
+	return quota, nil
+}
+
+// CheckQuota returns consts.ErrQuotaExceeded if storing addMessages messages
+// totalling addBytes would exceed the account's quota.
+//
+// The check is advisory: concurrent deliveries may each pass before either is
+// committed, so an account can overshoot its limit by at most one batch.
+func (db *Database) CheckQuota(ctx context.Context, accountID int64, addBytes, addMessages int64) error {
+	quota, err := db.GetAccountQuota(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	if quota.Exceeds(addBytes, addMessages) {
+		return consts.ErrQuotaExceeded
+	}
+	return nil
+}
+
+// SetAccountQuota sets the storage (bytes) and message limits of an account.
+// A nil limit clears the account override so the domain default applies; 0 means unlimited.
+func (db *Database) SetAccountQuota(ctx context.Context, tx pgx.Tx, accountID int64, storageLimit, messagesLimit *int64) error {
+	if storageLimit != nil && *storageLimit < 0 {
+		return fmt.Errorf("storage limit cannot be negative")
+	}
+	if messagesLimit != nil && *messagesLimit < 0 {
+		return fmt.Errorf("message limit cannot be negative")
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE accounts SET quota_storage = $2, quota_messages = $3
+		WHERE id = $1 AND deleted_at IS NULL
+	`, accountID, storageLimit, messagesLimit)
+	if err != nil {
+		return fmt.Errorf("failed to set quota for account %d: %w", accountID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return consts.ErrUserNotFound
+	}
+	return nil
+}
+
+// GetDomainQuota returns the default quota of a domain, or consts.ErrDBNotFound if none is set.
+func (db *Database) GetDomainQuota(ctx context.Context, domain string) (*DomainQuota, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	quota := &DomainQuota{Domain: domain}
+
+	err := db.GetReadPoolWithContext(ctx).QueryRow(ctx, `
+		SELECT quota_storage, quota_messages FROM domain_quotas WHERE domain = $1
+	`, domain).Scan(&quota.StorageLimit, &quota.MessagesLimit)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, consts.ErrDBNotFound
+		}
+		return nil, fmt.Errorf("failed to get quota for domain %s: %w", domain, err)
+	}
+	return quota, nil
+}
+
+// SetDomainQuota creates or replaces the default quota of a domain.
+func (db *Database) SetDomainQuota(ctx context.Context, tx pgx.Tx, quota DomainQuota) error {
+	domain := strings.ToLower(strings.TrimSpace(quota.Domain))
+	if domain == "" || strings.Contains(domain, "@") {
+		return fmt.Errorf("invalid domain: %q", quota.Domain)
+	}
+	if quota.StorageLimit != nil && *quota.StorageLimit < 0 {
+		return fmt.Errorf("storage limit cannot be negative")
+	}
+	if quota.MessagesLimit != nil && *quota.MessagesLimit < 0 {
+		return fmt.Errorf("message limit cannot be negative")
+	}
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO domain_quotas (domain, quota_storage, quota_messages)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (domain) DO UPDATE
+		SET quota_storage = EXCLUDED.quota_storage,
+			quota_messages = EXCLUDED.quota_messages,
+			updated_at = now()
+	`, domain, quota.StorageLimit, quota.MessagesLimit)
+	if err != nil {
+		return fmt.Errorf("failed to set quota for domain %s: %w", domain, err)
+	}
+	return nil
+}
+
+// DeleteDomainQuota removes the default quota of a domain.
+func (db *Database) DeleteDomainQuota(ctx context.Context, tx pgx.Tx, domain string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	tag, err := tx.Exec(ctx, `DELETE FROM domain_quotas WHERE domain = $1`, domain)
+	if err != nil {
+		return fmt.Errorf("failed to delete quota for domain %s: %w", domain, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return consts.ErrDBNotFound
+	}
+	return nil
+}
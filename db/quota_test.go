@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/migadu/sora/consts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func int64Ptr(v int64) *int64 { return &v }
+
+func TestResolveQuotaLimit(t *testing.T) {
+	tests := []struct {
+		name           string
+		account        *int64
+		domain         *int64
+		expectedLimit  int64
+		expectedSource string
+	}{
+		{"nothing set", nil, nil, 0, QuotaSourceNone},
+		{"domain default only", nil, int64Ptr(1000), 1000, QuotaSourceDomain},
+		{"domain default zero", nil, int64Ptr(0), 0, QuotaSourceNone},
+		{"account overrides domain", int64Ptr(500), int64Ptr(1000), 500, QuotaSourceAccount},
+		{"account explicitly unlimited", int64Ptr(0), int64Ptr(1000), 0, QuotaSourceNone},
+		{"account only", int64Ptr(200), nil, 200, QuotaSourceAccount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit, source := resolveQuotaLimit(tt.account, tt.domain)
+			assert.Equal(t, tt.expectedLimit, limit)
+			assert.Equal(t, tt.expectedSource, source)
+		})
+	}
+}
+
+func TestAccountQuota_Exceeds(t *testing.T) {
+	q := &AccountQuota{StorageUsed: 900, StorageLimit: 1000, MessagesUsed: 9, MessagesLimit: 10}
+
+	assert.False(t, q.Exceeds(100, 1), "exactly reaching the limit is allowed")
+	assert.True(t, q.Exceeds(101, 1), "storage overflow")
+	assert.True(t, q.Exceeds(10, 2), "message count overflow")
+	assert.False(t, q.IsFull())
+
+	q.MessagesUsed = 10
+	assert.True(t, q.IsFull())
+
+	unlimited := &AccountQuota{StorageUsed: 1 << 40, MessagesUsed: 1 << 30}
+	assert.False(t, unlimited.HasLimits())
+	assert.False(t, unlimited.Exceeds(1<<40, 1<<30))
+	assert.False(t, unlimited.IsFull())
+}
+
+// TestAccountQuota tests quota resolution against the database
+func TestAccountQuota(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping database integration test in short mode")
+	}
+
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	domain := fmt.Sprintf("quota-%d.example.com", time.Now().UnixNano())
+	email := "user@" + domain
+
+	tx, err := db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+	accountID, err := db.CreateAccount(ctx, tx, CreateAccountRequest{Email: email, Password: "password123", IsPrimary: true, HashType: "bcrypt"})
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit(ctx))
+
+	// No limits configured
+	quota, err := db.GetAccountQuota(ctx, accountID)
+	require.NoError(t, err)
+	assert.False(t, quota.HasLimits())
+	require.NoError(t, db.CheckQuota(ctx, accountID, 1<<30, 1))
+
+	// Domain default applies
+	tx, err = db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+	require.NoError(t, db.SetDomainQuota(ctx, tx, DomainQuota{Domain: strings.ToUpper(domain), StorageLimit: int64Ptr(1024), MessagesLimit: int64Ptr(5)}))
+	require.NoError(t, tx.Commit(ctx))
+
+	quota, err = db.GetAccountQuota(ctx, accountID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1024), quota.StorageLimit)
+	assert.Equal(t, QuotaSourceDomain, quota.StorageSource)
+	assert.Equal(t, int64(5), quota.MessagesLimit)
+	assert.ErrorIs(t, db.CheckQuota(ctx, accountID, 2048, 1), consts.ErrQuotaExceeded)
+
+	// Account override wins, and an explicit 0 means unlimited
+	tx, err = db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+	require.NoError(t, db.SetAccountQuota(ctx, tx, accountID, int64Ptr(4096), int64Ptr(0)))
+	require.NoError(t, tx.Commit(ctx))
+
+	quota, err = db.GetAccountQuota(ctx, accountID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4096), quota.StorageLimit)
+	assert.Equal(t, QuotaSourceAccount, quota.StorageSource)
+	assert.Equal(t, int64(0), quota.MessagesLimit)
+	require.NoError(t, db.CheckQuota(ctx, accountID, 2048, 100))
+
+	// Removing the domain default
+	tx, err = db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+	require.NoError(t, db.DeleteDomainQuota(ctx, tx, domain))
+	assert.ErrorIs(t, db.DeleteDomainQuota(ctx, tx, domain), consts.ErrDBNotFound)
+	require.NoError(t, tx.Commit(ctx))
+
+	_, err = db.GetDomainQuota(ctx, domain)
+	assert.ErrorIs(t, err, consts.ErrDBNotFound)
+}
@@ -362,5 +362,15 @@ func (d *Database) RestoreMessages(ctx context.Context, tx pgx.Tx, params Restor
 		logger.Info("Database: skipped restoring messages that already exist in target mailboxes", "count", skippedCount)
 	}
 
+	if restoredCount > 0 {
+		mailboxIDs := make([]int64, 0, len(mailboxIDMap))
+		for _, id := range mailboxIDMap {
+			mailboxIDs = append(mailboxIDs, id)
+		}
+		if err := notifyMailboxChange(ctx, tx, mailboxIDs...); err != nil {
+			return 0, err
+		}
+	}
+
 	return restoredCount, nil
 }
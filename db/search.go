@@ -134,13 +134,24 @@ func (db *Database) buildSearchCriteriaWithPrefix(criteria *imap.SearchCriteria,
 	}
 
 	// Flags
+	// Keywords (custom flags) are stored in the custom_flags JSONB array
 	for _, flag := range criteria.Flag {
 		param := nextParam()
+		if isCustomKeyword(flag) {
+			args[param] = string(flag)
+			conditions = append(conditions, fmt.Sprintf("%scustom_flags @> jsonb_build_array(@%s::text)", datePrefix, param))
+			continue
+		}
 		args[param] = FlagToBitwise(flag)
 		conditions = append(conditions, fmt.Sprintf("(%sflags & @%s) != 0", datePrefix, param))
 	}
 	for _, flag := range criteria.NotFlag {
 		param := nextParam()
+		if isCustomKeyword(flag) {
+			args[param] = string(flag)
+			conditions = append(conditions, fmt.Sprintf("NOT COALESCE(%scustom_flags @> jsonb_build_array(@%s::text), FALSE)", datePrefix, param))
+			continue
+		}
 		args[param] = FlagToBitwise(flag)
 		conditions = append(conditions, fmt.Sprintf("(%sflags & @%s) = 0", datePrefix, param))
 	}
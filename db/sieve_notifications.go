@@ -0,0 +1,39 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RecordSieveNotification records that a Sieve notification was sent for
+// the account, and removes the account's records older than retention.
+func (db *Database) RecordSieveNotification(ctx context.Context, tx pgx.Tx, AccountID int64, method string, retention time.Duration) error {
+	now := time.Now()
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM sieve_notifications
+		WHERE account_id = $1 AND sent_at < $2
+	`, AccountID, now.Add(-retention)); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO sieve_notifications (account_id, method, sent_at)
+		VALUES ($1, $2, $3)
+	`, AccountID, method, now)
+
+	return err
+}
+
+// CountRecentSieveNotifications returns the number of Sieve notifications
+// sent for the account within the specified duration.
+func (db *Database) CountRecentSieveNotifications(ctx context.Context, AccountID int64, duration time.Duration) (int, error) {
+	var count int
+	err := db.GetReadPool().QueryRow(ctx, `
+		SELECT COUNT(*) FROM sieve_notifications
+		WHERE account_id = $1 AND sent_at > $2
+	`, AccountID, time.Now().Add(-duration)).Scan(&count)
+
+	return count, err
+}
@@ -37,6 +37,13 @@ func (db *Database) GetUserScripts(ctx context.Context, AccountID int64) ([]*Sie
 	return scripts, rows.Err()
 }
 
+// CountUserScripts returns the number of Sieve scripts of an account.
+func (db *Database) CountUserScripts(ctx context.Context, AccountID int64) (int, error) {
+	var count int
+	err := db.GetReadPool().QueryRow(ctx, "SELECT COUNT(*) FROM sieve_scripts WHERE account_id = $1", AccountID).Scan(&count)
+	return count, err
+}
+
 func (db *Database) GetScript(ctx context.Context, scriptID, AccountID int64) (*SieveScript, error) {
 	var script SieveScript
 	err := db.GetReadPool().QueryRow(ctx, "SELECT id, account_id, name, script, active, updated_at FROM sieve_scripts WHERE id = $1 AND account_id = $2",
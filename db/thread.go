@@ -0,0 +1,157 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/helpers"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/metrics"
+)
+
+// ThreadMessage holds the header data needed to thread a message (RFC 5256).
+type ThreadMessage struct {
+	UID         imap.UID
+	Seq         uint32
+	MessageID   string
+	InReplyTo   []string
+	References  []string
+	Subject     string
+	SubjectSort string // Base subject as defined by RFC 5256 section 2.1
+	SentDate    time.Time
+}
+
+// sanitizeMessageIDs prepares a list of message IDs for storage in a TEXT[]
+// column. Empty IDs are dropped and an empty list is stored as NULL.
+func sanitizeMessageIDs(ids []string) []string {
+	var sane []string
+	for _, id := range ids {
+		id = strings.TrimSpace(helpers.SanitizeUTF8(id))
+		if id != "" {
+			sane = append(sane, id)
+		}
+	}
+	return sane
+}
+
+// GetThreadMessages returns the threading data of the messages in the mailbox
+// matching the search criteria, ordered by sent date and then by UID.
+// The Message-ID, In-Reply-To and References of each message are read from
+// their columns, so no message body has to be fetched from storage.
+func (db *Database) GetThreadMessages(ctx context.Context, mailboxID int64, criteria *imap.SearchCriteria) ([]ThreadMessage, error) {
+	paramCounter := 0
+
+	if !db.needsComplexQuery(criteria, "") {
+		whereCondition, whereArgs, err := db.buildSearchCriteriaWithPrefix(criteria, "p", &paramCounter, "m")
+		if err != nil {
+			return nil, err
+		}
+		whereArgs["mailboxID"] = mailboxID
+
+		query := fmt.Sprintf(`
+			SELECT m.uid, ms.seqnum, m.message_id, m.in_reply_to, m.message_references,
+			       m.subject, m.subject_sort, m.sent_date
+			FROM messages m
+			JOIN message_sequences ms ON m.mailbox_id = ms.mailbox_id AND m.uid = ms.uid
+			WHERE m.mailbox_id = @mailboxID AND %s
+			ORDER BY m.sent_date, m.uid
+			LIMIT %d`, whereCondition, MaxSearchResults)
+		return db.queryThreadMessages(ctx, query, whereArgs, "thread_messages_simple", mailboxID)
+	}
+
+	whereCondition, whereArgs, err := db.buildSearchCriteriaWithPrefix(criteria, "p", &paramCounter, "")
+	if err != nil {
+		return nil, err
+	}
+	whereArgs["mailboxID"] = mailboxID
+
+	// Same CTE as the complex search path, so that every search key resolves
+	query := fmt.Sprintf(`
+		WITH message_seqs AS (
+			SELECT
+				m.id, m.uid,
+				ms.seqnum,
+				m.account_id, m.mailbox_id, m.content_hash, m.s3_domain, m.s3_localpart, m.uploaded, m.flags, m.custom_flags,
+				m.internal_date, m.size, m.created_modseq, m.updated_modseq, m.expunged_modseq,
+				m.flags_changed_at, m.subject, m.sent_date, m.message_id,
+				m.in_reply_to, m.message_references, m.recipients_json, mc.text_body_tsv, mc.headers_tsv,
+				m.subject_sort, m.from_name_sort, m.from_email_sort, m.to_name_sort, m.to_email_sort, m.cc_email_sort
+			FROM messages m
+			JOIN message_sequences ms ON m.mailbox_id = ms.mailbox_id AND m.uid = ms.uid
+			LEFT JOIN message_contents mc ON m.content_hash = mc.content_hash
+			WHERE m.mailbox_id = @mailboxID AND m.expunged_at IS NULL
+		)
+		SELECT uid, seqnum, message_id, in_reply_to, message_references,
+		       subject, subject_sort, sent_date
+		FROM message_seqs
+		WHERE %s
+		ORDER BY sent_date, uid
+		LIMIT %d`, whereCondition, MaxSearchResults)
+	return db.queryThreadMessages(ctx, query, whereArgs, "thread_messages_complex", mailboxID)
+}
+
+// queryThreadMessages executes a query built by GetThreadMessages and scans its rows.
+func (db *Database) queryThreadMessages(ctx context.Context, query string, args pgx.NamedArgs, metricsLabel string, mailboxID int64) ([]ThreadMessage, error) {
+	start := time.Now()
+	rows, err := db.GetReadPoolWithContext(ctx).Query(ctx, query, args)
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	metrics.DBQueryDuration.WithLabelValues(metricsLabel, "read").Observe(time.Since(start).Seconds())
+	metrics.DBQueriesTotal.WithLabelValues(metricsLabel, status, "read").Inc()
+
+	if err != nil {
+		logger.Error("Database: failed executing thread query", "query", query, "args", args, "err", err)
+		return nil, fmt.Errorf("failed to query thread messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []ThreadMessage
+	for rows.Next() {
+		var (
+			msg         ThreadMessage
+			uid, seqNum int64
+			messageID   *string
+			inReplyTo   *string
+			subject     *string
+			subjectSort *string
+			sentDate    *time.Time
+		)
+		if err := rows.Scan(&uid, &seqNum, &messageID, &inReplyTo, &msg.References, &subject, &subjectSort, &sentDate); err != nil {
+			return nil, fmt.Errorf("failed to scan thread message: %w", err)
+		}
+		msg.UID = imap.UID(uid)
+		msg.Seq = uint32(seqNum)
+		if messageID != nil {
+			msg.MessageID = *messageID
+		}
+		if inReplyTo != nil && *inReplyTo != "" {
+			msg.InReplyTo = strings.Fields(*inReplyTo)
+		}
+		if subject != nil {
+			msg.Subject = *subject
+		}
+		if subjectSort != nil {
+			msg.SubjectSort = *subjectSort
+		}
+		if sentDate != nil {
+			msg.SentDate = *sentDate
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating thread messages: %w", err)
+	}
+
+	if len(messages) >= MaxSearchResults {
+		logger.Warn("Database: thread query hit result limit", "limit", MaxSearchResults, "mailbox_id", mailboxID)
+	}
+
+	return messages, nil
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizeMessageIDs(t *testing.T) {
+	assert.Nil(t, sanitizeMessageIDs(nil))
+	assert.Nil(t, sanitizeMessageIDs([]string{"", "  "}))
+	assert.Equal(t, []string{"a@example.com", "b@example.com"}, sanitizeMessageIDs([]string{" a@example.com", "", "b@example.com"}))
+}
+
+// TestGetThreadMessages tests that References are persisted on insert and copy
+// and returned with the other threading columns
+func TestGetThreadMessages(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping database integration test in short mode")
+	}
+
+	db := setupTestDatabase(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	tx, err := db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	testEmail := fmt.Sprintf("test_thread_%d@example.com", time.Now().UnixNano())
+	_, err = db.CreateAccount(ctx, tx, CreateAccountRequest{Email: testEmail, Password: "password", IsPrimary: true, HashType: "bcrypt"})
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit(ctx))
+
+	accountID, err := db.GetAccountIDByAddress(ctx, testEmail)
+	require.NoError(t, err)
+
+	tx, err = db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, db.CreateMailbox(ctx, tx, accountID, "INBOX", nil))
+	require.NoError(t, db.CreateMailbox(ctx, tx, accountID, "Archive", nil))
+	require.NoError(t, tx.Commit(ctx))
+
+	inbox, err := db.GetMailboxByName(ctx, accountID, "INBOX")
+	require.NoError(t, err)
+	archive, err := db.GetMailboxByName(ctx, accountID, "Archive")
+	require.NoError(t, err)
+
+	var bs imap.BodyStructure = &imap.BodyStructureSinglePart{Type: "text", Subtype: "plain", Size: 100}
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	insert := func(uid uint32, messageID, subject string, sent time.Time, inReplyTo, references []string) {
+		options := &InsertMessageOptions{
+			AccountID:     accountID,
+			MailboxID:     inbox.ID,
+			MailboxName:   "INBOX",
+			S3Domain:      "example.com",
+			S3Localpart:   fmt.Sprintf("test/thread_test/%d", uid),
+			ContentHash:   fmt.Sprintf("threadtest%d_%d", uid, base.UnixNano()),
+			MessageID:     messageID,
+			InternalDate:  sent,
+			Size:          100,
+			Subject:       subject,
+			PlaintextBody: "body",
+			RawHeaders:    "headers",
+			SentDate:      sent,
+			InReplyTo:     inReplyTo,
+			References:    references,
+			PreservedUID:  &uid,
+			BodyStructure: &bs,
+		}
+		_, _, err := db.InsertMessageFromImporter(ctx, tx, options)
+		require.NoError(t, err)
+	}
+
+	tx, err = db.GetWritePool().Begin(ctx)
+	require.NoError(t, err)
+	insert(1, "root@example.com", "Plans", base.Add(2*time.Minute), nil, nil)
+	insert(2, "reply@example.com", "Re: Plans", base.Add(3*time.Minute), []string{"root@example.com"}, []string{"root@example.com"})
+	insert(3, "nested@example.com", "Re: Plans", base.Add(time.Minute), []string{"reply@example.com"}, []string{"root@example.com", "reply@example.com"})
+	require.NoError(t, tx.Commit(ctx))
+
+	t.Run("AllMessages", func(t *testing.T) {
+		messages, err := db.GetThreadMessages(ctx, inbox.ID, &imap.SearchCriteria{})
+		require.NoError(t, err)
+		require.Len(t, messages, 3)
+
+		// Ordered by sent date
+		assert.Equal(t, imap.UID(3), messages[0].UID)
+		assert.Equal(t, []string{"root@example.com", "reply@example.com"}, messages[0].References)
+		assert.Equal(t, []string{"reply@example.com"}, messages[0].InReplyTo)
+		assert.Equal(t, "PLANS", messages[0].SubjectSort)
+
+		assert.Equal(t, imap.UID(1), messages[1].UID)
+		assert.Nil(t, messages[1].References)
+		assert.Nil(t, messages[1].InReplyTo)
+		assert.Equal(t, "root@example.com", messages[1].MessageID)
+	})
+
+	t.Run("WithCriteria", func(t *testing.T) {
+		var uids imap.UIDSet
+		uids.AddRange(2, 3)
+		messages, err := db.GetThreadMessages(ctx, inbox.ID, &imap.SearchCriteria{UID: []imap.UIDSet{uids}})
+		require.NoError(t, err)
+		require.Len(t, messages, 2)
+		assert.Equal(t, imap.UID(3), messages[0].UID)
+		assert.Equal(t, uint32(3), messages[0].Seq)
+		assert.Equal(t, imap.UID(2), messages[1].UID)
+	})
+
+	t.Run("CopyKeepsReferences", func(t *testing.T) {
+		tx, err := db.GetWritePool().Begin(ctx)
+		require.NoError(t, err)
+		uids := []imap.UID{3}
+		_, err = db.CopyMessages(ctx, tx, &uids, inbox.ID, archive.ID, accountID)
+		require.NoError(t, err)
+		require.NoError(t, tx.Commit(ctx))
+
+		messages, err := db.GetThreadMessages(ctx, archive.ID, &imap.SearchCriteria{})
+		require.NoError(t, err)
+		require.Len(t, messages, 1)
+		assert.Equal(t, []string{"root@example.com", "reply@example.com"}, messages[0].References)
+	})
+}
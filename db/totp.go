@@ -0,0 +1,243 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/pkg/totp"
+)
+
+const (
+	// totpRecoveryCodeCount is the number of recovery codes issued at once.
+	totpRecoveryCodeCount = 10
+	// totpRecoveryCodeLength is the number of characters of a recovery code.
+	totpRecoveryCodeLength = 10
+)
+
+// TOTPStatus describes the second factor of an account.
+type TOTPStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+// generateTOTPRecoveryCodes returns random recovery codes made of lowercase
+// letters and digits in two dash-separated halves, e.g. "k3f9a-07xqz".
+func generateTOTPRecoveryCodes() ([]string, error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	codes := make([]string, totpRecoveryCodeCount)
+	buf := make([]byte, totpRecoveryCodeLength)
+	for i := range codes {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("error generating recovery codes: %w", err)
+		}
+		var sb strings.Builder
+		for j, b := range buf {
+			if j == totpRecoveryCodeLength/2 {
+				sb.WriteByte('-')
+			}
+			sb.WriteByte(alphabet[int(b)%len(alphabet)])
+		}
+		codes[i] = sb.String()
+	}
+	return codes, nil
+}
+
+// hashTOTPRecoveryCode hashes a recovery code the way it is stored, ignoring
+// the separators and case it was typed with.
+func hashTOTPRecoveryCode(code string) string {
+	return GenerateSHA512Hash(normalizeAppPasswordSecret(code))
+}
+
+// GetTOTPStatus returns the second factor status of an account. An account
+// without a second factor, or with a pending enrolment, is not enabled.
+func (db *Database) GetTOTPStatus(ctx context.Context, accountID int64) (*TOTPStatus, error) {
+	status := &TOTPStatus{}
+	err := db.GetReadPoolWithContext(ctx).QueryRow(ctx, `
+		SELECT t.enabled_at,
+			(SELECT count(*) FROM account_totp_recovery_codes r WHERE r.account_id = t.account_id AND r.used_at IS NULL)
+		FROM account_totp t
+		WHERE t.account_id = $1
+	`, accountID).Scan(&status.EnabledAt, &status.RecoveryCodesRemaining)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return status, nil
+		}
+		return nil, fmt.Errorf("failed to get TOTP status: %w", err)
+	}
+	status.Enabled = status.EnabledAt != nil
+	if !status.Enabled {
+		status.RecoveryCodesRemaining = 0
+	}
+	return status, nil
+}
+
+// BeginTOTPEnrolment generates a new TOTP secret for an account and stores it
+// as pending, replacing an earlier pending enrolment. The secret only takes
+// effect once EnableTOTP confirms a code. It returns
+// consts.ErrTOTPAlreadyEnabled if the account already has an active second
+// factor.
+func (db *Database) BeginTOTPEnrolment(ctx context.Context, tx pgx.Tx, accountID int64) (string, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+
+	var enabled bool
+	err = tx.QueryRow(ctx, `
+		INSERT INTO account_totp (account_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (account_id) DO UPDATE
+			SET secret = EXCLUDED.secret, last_used_step = 0, created_at = now()
+			WHERE account_totp.enabled_at IS NULL
+		RETURNING false
+	`, accountID, secret).Scan(&enabled)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// The conflicting row is enabled and was not updated
+			return "", consts.ErrTOTPAlreadyEnabled
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return "", consts.ErrUserNotFound
+		}
+		return "", fmt.Errorf("failed to store TOTP secret: %w", err)
+	}
+	return secret, nil
+}
+
+// verifyTOTPCode checks a code against the stored secret of an account and
+// marks its time step as used. The row is locked so that concurrent logins
+// can not use the same code twice. wantEnabled selects whether an active
+// second factor or a pending enrolment is checked.
+func (db *Database) verifyTOTPCode(ctx context.Context, tx pgx.Tx, accountID int64, code string, wantEnabled bool) error {
+	var secret string
+	var enabled bool
+	var lastUsedStep int64
+	err := tx.QueryRow(ctx, `
+		SELECT secret, enabled_at IS NOT NULL, last_used_step
+		FROM account_totp
+		WHERE account_id = $1
+		FOR UPDATE
+	`, accountID).Scan(&secret, &enabled, &lastUsedStep)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return consts.ErrDBNotFound
+		}
+		return fmt.Errorf("failed to get TOTP secret: %w", err)
+	}
+	if enabled != wantEnabled {
+		if enabled {
+			return consts.ErrTOTPAlreadyEnabled
+		}
+		return consts.ErrDBNotFound
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok || step <= lastUsedStep {
+		return consts.ErrAuthenticationFailed
+	}
+	if _, err := tx.Exec(ctx, `UPDATE account_totp SET last_used_step = $2 WHERE account_id = $1`, accountID, step); err != nil {
+		return fmt.Errorf("failed to record TOTP use: %w", err)
+	}
+	return nil
+}
+
+// EnableTOTP activates a pending enrolment after checking a code generated
+// by the authenticator app. It returns fresh recovery codes, which are not
+// retrievable later. A wrong code returns consts.ErrAuthenticationFailed, a
+// missing enrolment consts.ErrDBNotFound and an already active second factor
+// consts.ErrTOTPAlreadyEnabled.
+func (db *Database) EnableTOTP(ctx context.Context, tx pgx.Tx, accountID int64, code string) ([]string, error) {
+	if err := db.verifyTOTPCode(ctx, tx, accountID, code, false); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE account_totp SET enabled_at = now() WHERE account_id = $1`, accountID); err != nil {
+		return nil, fmt.Errorf("failed to enable TOTP: %w", err)
+	}
+	return db.replaceTOTPRecoveryCodes(ctx, tx, accountID)
+}
+
+// VerifyTOTP checks a code or, if recoveryCode is set, a recovery code
+// against the active second factor of an account. A used recovery code is
+// consumed. It returns consts.ErrAuthenticationFailed for a wrong or reused
+// code and consts.ErrDBNotFound if the account has no active second factor.
+func (db *Database) VerifyTOTP(ctx context.Context, tx pgx.Tx, accountID int64, code, recoveryCode string) error {
+	if recoveryCode == "" {
+		return db.verifyTOTPCode(ctx, tx, accountID, code, true)
+	}
+
+	result, err := tx.Exec(ctx, `
+		UPDATE account_totp_recovery_codes r
+		SET used_at = now()
+		FROM account_totp t
+		WHERE r.account_id = $1 AND r.code_hash = $2 AND r.used_at IS NULL
+		  AND t.account_id = r.account_id AND t.enabled_at IS NOT NULL
+	`, accountID, hashTOTPRecoveryCode(recoveryCode))
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return consts.ErrAuthenticationFailed
+	}
+	return nil
+}
+
+// RegenerateTOTPRecoveryCodes replaces the recovery codes of an account with
+// an active second factor and returns the new codes.
+func (db *Database) RegenerateTOTPRecoveryCodes(ctx context.Context, tx pgx.Tx, accountID int64) ([]string, error) {
+	var exists bool
+	err := tx.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM account_totp WHERE account_id = $1 AND enabled_at IS NOT NULL)
+	`, accountID).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check TOTP: %w", err)
+	}
+	if !exists {
+		return nil, consts.ErrDBNotFound
+	}
+	return db.replaceTOTPRecoveryCodes(ctx, tx, accountID)
+}
+
+func (db *Database) replaceTOTPRecoveryCodes(ctx context.Context, tx pgx.Tx, accountID int64) ([]string, error) {
+	codes, err := generateTOTPRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashTOTPRecoveryCode(code)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM account_totp_recovery_codes WHERE account_id = $1`, accountID); err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO account_totp_recovery_codes (account_id, code_hash)
+		SELECT $1, unnest($2::text[])
+	`, accountID, hashes); err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// DeleteTOTP removes the second factor of an account, including a pending
+// enrolment and the recovery codes. It returns consts.ErrDBNotFound if there
+// was none.
+func (db *Database) DeleteTOTP(ctx context.Context, tx pgx.Tx, accountID int64) error {
+	result, err := tx.Exec(ctx, `DELETE FROM account_totp WHERE account_id = $1`, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to delete TOTP: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return consts.ErrDBNotFound
+	}
+	return nil
+}
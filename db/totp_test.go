@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/pkg/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateTOTPRecoveryCodes(t *testing.T) {
+	codes, err := generateTOTPRecoveryCodes()
+	require.NoError(t, err)
+	require.Len(t, codes, totpRecoveryCodeCount)
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		assert.Regexp(t, regexp.MustCompile(`^[a-z0-9]{5}-[a-z0-9]{5}$`), code)
+		assert.False(t, seen[code], "duplicate recovery code %s", code)
+		seen[code] = true
+	}
+
+	// Typed variants hash the same
+	assert.Equal(t, hashTOTPRecoveryCode(codes[0]), hashTOTPRecoveryCode(strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))))
+}
+
+// TestTOTP tests enrolling, using and removing a TOTP second factor.
+func TestTOTP(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping database integration test in short mode")
+	}
+
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	email := fmt.Sprintf("totp-%d@example.com", time.Now().UnixNano())
+	var accountID int64
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) (err error) {
+		accountID, err = db.CreateAccount(ctx, tx, CreateAccountRequest{Email: email, Password: "password123", IsPrimary: true, HashType: "bcrypt"})
+		return err
+	}))
+
+	status, err := db.GetTOTPStatus(ctx, accountID)
+	require.NoError(t, err)
+	assert.False(t, status.Enabled)
+
+	var secret string
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) (err error) {
+		secret, err = db.BeginTOTPEnrolment(ctx, tx, accountID)
+		return err
+	}))
+
+	// A pending enrolment is not active
+	status, err = db.GetTOTPStatus(ctx, accountID)
+	require.NoError(t, err)
+	assert.False(t, status.Enabled)
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.VerifyTOTP(ctx, tx, accountID, "000000", "")
+	})
+	assert.ErrorIs(t, err, consts.ErrDBNotFound)
+
+	step := totp.Step(time.Now())
+	code := func(step int64) string {
+		c, err := totp.Code(secret, step)
+		require.NoError(t, err)
+		return c
+	}
+
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		_, err := db.EnableTOTP(ctx, tx, accountID, "not-a-code")
+		return err
+	})
+	assert.ErrorIs(t, err, consts.ErrAuthenticationFailed)
+
+	var recoveryCodes []string
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) (err error) {
+		recoveryCodes, err = db.EnableTOTP(ctx, tx, accountID, code(step-1))
+		return err
+	}))
+	require.Len(t, recoveryCodes, totpRecoveryCodeCount)
+
+	status, err = db.GetTOTPStatus(ctx, accountID)
+	require.NoError(t, err)
+	assert.True(t, status.Enabled)
+	assert.Equal(t, totpRecoveryCodeCount, status.RecoveryCodesRemaining)
+
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		_, err := db.BeginTOTPEnrolment(ctx, tx, accountID)
+		return err
+	})
+	assert.ErrorIs(t, err, consts.ErrTOTPAlreadyEnabled)
+
+	// Codes are accepted once, and not older than the last accepted one
+	verify := func(code, recoveryCode string) error {
+		return inTestTx(t, db, func(tx pgx.Tx) error {
+			return db.VerifyTOTP(ctx, tx, accountID, code, recoveryCode)
+		})
+	}
+	assert.ErrorIs(t, verify(code(step-1), ""), consts.ErrAuthenticationFailed)
+	require.NoError(t, verify(code(step), ""))
+	assert.ErrorIs(t, verify(code(step), ""), consts.ErrAuthenticationFailed)
+
+	// Recovery codes are single-use
+	require.NoError(t, verify("", strings.ToUpper(recoveryCodes[0])))
+	assert.ErrorIs(t, verify("", recoveryCodes[0]), consts.ErrAuthenticationFailed)
+	assert.ErrorIs(t, verify("", "wrong-code"), consts.ErrAuthenticationFailed)
+	status, err = db.GetTOTPStatus(ctx, accountID)
+	require.NoError(t, err)
+	assert.Equal(t, totpRecoveryCodeCount-1, status.RecoveryCodesRemaining)
+
+	var newCodes []string
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) (err error) {
+		newCodes, err = db.RegenerateTOTPRecoveryCodes(ctx, tx, accountID)
+		return err
+	}))
+	assert.ErrorIs(t, verify("", recoveryCodes[1]), consts.ErrAuthenticationFailed)
+	require.NoError(t, verify("", newCodes[0]))
+
+	require.NoError(t, inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.DeleteTOTP(ctx, tx, accountID)
+	}))
+	err = inTestTx(t, db, func(tx pgx.Tx) error {
+		return db.DeleteTOTP(ctx, tx, accountID)
+	})
+	assert.ErrorIs(t, err, consts.ErrDBNotFound)
+	status, err = db.GetTOTPStatus(ctx, accountID)
+	require.NoError(t, err)
+	assert.False(t, status.Enabled)
+}
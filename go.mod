@@ -35,7 +35,9 @@ require (
 // Use forked versions until upstreams are updated
 replace github.com/foxcpp/go-sieve => github.com/migadu/go-sieve v0.0.0-20260206073348-d47e90518da5
 
-replace github.com/emersion/go-imap/v2 => github.com/migadu/go-imap/v2 v2.0.0-20260316134619-b8676c927c75
+// In-tree copy of github.com/migadu/go-imap v2.0.0-20260316134619-b8676c927c75
+// with the imapserver changes Sora needs; see third_party/go-imap
+replace github.com/emersion/go-imap/v2 => ./third_party/go-imap
 
 replace github.com/emersion/go-smtp => github.com/dejanstrbac/go-smtp v0.0.0-20260313205502-a1dea4f0d630
 
@@ -23,6 +23,7 @@ import (
 	"github.com/migadu/sora/server/lmtp"
 	"github.com/migadu/sora/server/managesieve"
 	"github.com/migadu/sora/server/pop3"
+	"github.com/migadu/sora/server/submission"
 	"github.com/migadu/sora/server/uploader"
 	"github.com/migadu/sora/storage"
 )
@@ -555,6 +556,52 @@ func SetupLMTPServer(t *testing.T) (*TestServer, TestAccount) {
 	}, account
 }
 
+// SetupSubmissionServer starts a plaintext submission server that allows AUTH
+// without TLS and hands accepted messages to queue.
+func SetupSubmissionServer(t *testing.T, queue submission.RelayQueue, options submission.SubmissionServerOptions) (*TestServer, TestAccount) {
+	t.Helper()
+
+	rdb := SetupTestDatabase(t)
+	account := CreateTestAccount(t, rdb)
+	address := GetRandomAddress(t)
+
+	options.RelayQueue = queue
+	options.InsecureAuth = true
+	server, err := submission.New(context.Background(), "test", "localhost", address, rdb, nil, options)
+	if err != nil {
+		t.Fatalf("Failed to create submission server: %v", err)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		server.Start(errChan)
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+
+	cleanup := func() {
+		if err := server.Close(); err != nil {
+			t.Logf("Error closing submission server: %v", err)
+		}
+		select {
+		case err := <-errChan:
+			if err != nil {
+				t.Logf("Submission server error during shutdown: %v", err)
+			}
+		case <-time.After(1 * time.Second):
+			// Timeout waiting for server to shut down
+		}
+	}
+
+	return &TestServer{
+		Address:     address,
+		Server:      server,
+		cleanup:     cleanup,
+		ResilientDB: rdb,
+	}, account
+}
+
 func SetupPOP3Server(t *testing.T) (*TestServer, TestAccount) {
 	t.Helper()
 
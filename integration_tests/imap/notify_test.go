@@ -0,0 +1,64 @@
+//go:build integration
+
+package imap_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/migadu/sora/integration_tests/common"
+)
+
+// TestIMAP_Notify tests NOTIFY SET and NOTIFY NONE (RFC 5465)
+func TestIMAP_Notify(t *testing.T) {
+	common.SkipIfDatabaseUnavailable(t)
+
+	server, account := common.SetupIMAPServer(t)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Address)
+	if err != nil {
+		t.Fatalf("Failed to dial IMAP server: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	line, _ := reader.ReadString('\n')
+	t.Logf("S: %s", strings.TrimSpace(line))
+
+	rawCommand(t, conn, reader, "A001", fmt.Sprintf("LOGIN %s %s", account.Email, account.Password))
+
+	caps := findLine(rawCommand(t, conn, reader, "A002", "CAPABILITY"), "* CAPABILITY")
+	if !strings.Contains(caps, " NOTIFY") {
+		t.Fatalf("NOTIFY capability not advertised: %s", caps)
+	}
+
+	rawCommand(t, conn, reader, "A003", "CREATE Lists")
+	msg := "Subject: Hello\r\n\r\nbody\r\n"
+	rawCommand(t, conn, reader, "A004", fmt.Sprintf("APPEND Lists {%d+}\r\n%s", len(msg), msg))
+	rawCommand(t, conn, reader, "A005", "SELECT INBOX")
+
+	// STATUS is sent for the watched mailboxes other than the selected one
+	lines := rawCommand(t, conn, reader, "A006", "NOTIFY SET STATUS (selected (MessageNew MessageExpunge)) (personal (MessageNew MessageExpunge MailboxName))")
+	status := findLine(lines, "* STATUS Lists ")
+	if status == "" || !strings.Contains(status, "MESSAGES 1") {
+		t.Errorf("Expected STATUS for Lists, got: %v", lines)
+	}
+	if inbox := findLine(lines, "* STATUS INBOX "); inbox != "" {
+		t.Errorf("Unexpected STATUS for the selected mailbox: %q", inbox)
+	}
+
+	fmt.Fprintf(conn, "A007 NOTIFY SET (personal (AnnotationChange))\r\n")
+	line, err = reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read NOTIFY response: %v", err)
+	}
+	if !strings.HasPrefix(line, "A007 NO [BADEVENT") {
+		t.Errorf("Expected NO [BADEVENT] for an unsupported event, got: %q", strings.TrimSpace(line))
+	}
+
+	rawCommand(t, conn, reader, "A008", "NOTIFY NONE")
+}
@@ -0,0 +1,139 @@
+//go:build integration
+
+package imap_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/migadu/sora/integration_tests/common"
+)
+
+// rawCommand sends a tagged command and returns the untagged responses,
+// failing the test unless the command completes with OK.
+func rawCommand(t *testing.T, conn net.Conn, reader *bufio.Reader, tag, command string) []string {
+	t.Helper()
+	fmt.Fprintf(conn, "%s %s\r\n", tag, command)
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("%s failed reading: %v", command, err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		t.Logf("S: %s", line)
+		if strings.HasPrefix(line, tag+" ") {
+			if !strings.HasPrefix(line, tag+" OK") {
+				t.Fatalf("%s failed: %s", command, line)
+			}
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+func findLine(lines []string, prefix string) string {
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+	return ""
+}
+
+// TestIMAP_QResyncSelect tests ENABLE QRESYNC and SELECT (QRESYNC ...) (RFC 7162)
+func TestIMAP_QResyncSelect(t *testing.T) {
+	common.SkipIfDatabaseUnavailable(t)
+
+	server, account := common.SetupIMAPServer(t)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Address)
+	if err != nil {
+		t.Fatalf("Failed to dial IMAP server: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	line, _ := reader.ReadString('\n')
+	t.Logf("S: %s", strings.TrimSpace(line))
+
+	rawCommand(t, conn, reader, "A001", fmt.Sprintf("LOGIN %s %s", account.Email, account.Password))
+
+	caps := findLine(rawCommand(t, conn, reader, "A002", "CAPABILITY"), "* CAPABILITY")
+	if !strings.Contains(caps, "QRESYNC") {
+		t.Fatalf("QRESYNC not advertised: %s", caps)
+	}
+
+	enabled := findLine(rawCommand(t, conn, reader, "A003", "ENABLE QRESYNC"), "* ENABLED")
+	if !strings.Contains(enabled, "QRESYNC") {
+		t.Fatalf("QRESYNC not enabled: %s", enabled)
+	}
+
+	lines := rawCommand(t, conn, reader, "A004", "SELECT INBOX")
+	uidValidity := regexp.MustCompile(`UIDVALIDITY (\d+)`).FindStringSubmatch(strings.Join(lines, "\n"))
+	if uidValidity == nil {
+		t.Fatal("No UIDVALIDITY in SELECT response")
+	}
+
+	for i := 1; i <= 4; i++ {
+		rawCommand(t, conn, reader, fmt.Sprintf("A1%02d", i), "APPEND INBOX {13+}\r\nSubject: test")
+	}
+
+	modSeqLines := rawCommand(t, conn, reader, "A005", "STATUS INBOX (HIGHESTMODSEQ)")
+	modSeqMatch := regexp.MustCompile(`HIGHESTMODSEQ (\d+)`).FindStringSubmatch(findLine(modSeqLines, "* STATUS"))
+	if modSeqMatch == nil {
+		t.Fatalf("No HIGHESTMODSEQ in STATUS response: %v", modSeqLines)
+	}
+	knownModSeq := modSeqMatch[1]
+
+	// Expunge UID 2 and flag UID 3 after the client's known state
+	rawCommand(t, conn, reader, "A007", "UID STORE 2 +FLAGS.SILENT (\\Deleted)")
+	lines = rawCommand(t, conn, reader, "A008", "UID EXPUNGE 2")
+	if findLine(lines, "* VANISHED 2") == "" || findLine(lines, "EXPUNGE") != "" {
+		t.Errorf("Expected VANISHED instead of EXPUNGE, got: %v", lines)
+	}
+	rawCommand(t, conn, reader, "A009", "UID STORE 3 +FLAGS.SILENT (\\Flagged)")
+	rawCommand(t, conn, reader, "A010", "UNSELECT")
+
+	lines = rawCommand(t, conn, reader, "A011",
+		fmt.Sprintf("SELECT INBOX (QRESYNC (%s %s 1:4))", uidValidity[1], knownModSeq))
+
+	if vanished := findLine(lines, "* VANISHED"); vanished != "* VANISHED (EARLIER) 2" {
+		t.Errorf("Expected VANISHED (EARLIER) for UID 2, got: %q", vanished)
+	}
+	if findLine(lines, "* 3 EXISTS") == "" {
+		t.Errorf("Expected * 3 EXISTS in QRESYNC SELECT response, got: %v", lines)
+	}
+
+	fetch := findLine(lines, "* 2 FETCH")
+	if !strings.Contains(fetch, "UID 3") || !strings.Contains(fetch, "\\Flagged") || !strings.Contains(fetch, "MODSEQ") {
+		t.Errorf("Expected FETCH with UID 3, \\Flagged and MODSEQ, got: %q", fetch)
+	}
+	if other := findLine(lines, "* 1 FETCH"); other != "" {
+		t.Errorf("Unchanged message reported: %q", other)
+	}
+
+	// UID FETCH with VANISHED reports the expunged UIDs of the range first
+	lines = rawCommand(t, conn, reader, "A012",
+		fmt.Sprintf("UID FETCH 1:4 (FLAGS) (CHANGEDSINCE %s VANISHED)", knownModSeq))
+	if len(lines) == 0 || lines[0] != "* VANISHED (EARLIER) 2" {
+		t.Errorf("Expected VANISHED (EARLIER) 2 before the FETCH responses, got: %v", lines)
+	}
+	if fetch := findLine(lines, "* 2 FETCH"); !strings.Contains(fetch, "UID 3") {
+		t.Errorf("Expected FETCH of the changed message, got: %v", lines)
+	}
+
+	// A stale UIDVALIDITY is a plain SELECT
+	lines = rawCommand(t, conn, reader, "A013", "SELECT INBOX (QRESYNC (1 1))")
+	if findLine(lines, "* VANISHED") != "" {
+		t.Error("VANISHED sent for mismatched UIDVALIDITY")
+	}
+	if findLine(lines, "* 3 EXISTS") == "" {
+		t.Error("Expected EXISTS in regular SELECT response")
+	}
+}
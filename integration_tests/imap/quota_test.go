@@ -0,0 +1,85 @@
+//go:build integration
+
+package imap_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/migadu/sora/integration_tests/common"
+)
+
+// TestIMAP_Quota tests GETQUOTA, GETQUOTAROOT and SETQUOTA (RFC 9208)
+func TestIMAP_Quota(t *testing.T) {
+	common.SkipIfDatabaseUnavailable(t)
+
+	server, account := common.SetupIMAPServer(t)
+	defer server.Close()
+
+	ctx := context.Background()
+	accountID, err := server.ResilientDB.GetAccountIDByAddressWithRetry(ctx, account.Email)
+	if err != nil {
+		t.Fatalf("Failed to get account ID: %v", err)
+	}
+	storageLimit, messagesLimit := int64(10*1024*1024), int64(100)
+	if err := server.ResilientDB.SetAccountQuotaWithRetry(ctx, accountID, &storageLimit, &messagesLimit); err != nil {
+		t.Fatalf("Failed to set account quota: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", server.Address)
+	if err != nil {
+		t.Fatalf("Failed to dial IMAP server: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	line, _ := reader.ReadString('\n')
+	t.Logf("S: %s", strings.TrimSpace(line))
+
+	rawCommand(t, conn, reader, "A001", fmt.Sprintf("LOGIN %s %s", account.Email, account.Password))
+
+	caps := findLine(rawCommand(t, conn, reader, "A002", "CAPABILITY"), "* CAPABILITY")
+	for _, c := range []string{" QUOTA", "QUOTA=RES-STORAGE", "QUOTA=RES-MESSAGE"} {
+		if !strings.Contains(caps, c) {
+			t.Errorf("%s not advertised: %s", strings.TrimSpace(c), caps)
+		}
+	}
+	if strings.Contains(caps, "QUOTASET") {
+		t.Errorf("QUOTASET must not be advertised: %s", caps)
+	}
+
+	msg := "Subject: Hello\r\n\r\nbody\r\n"
+	rawCommand(t, conn, reader, "A003", fmt.Sprintf("APPEND INBOX {%d+}\r\n%s", len(msg), msg))
+
+	want := `* QUOTA "" (MESSAGE 1 100 STORAGE 1 10240)`
+	lines := rawCommand(t, conn, reader, "A004", "GETQUOTAROOT INBOX")
+	if root := findLine(lines, "* QUOTAROOT"); root != `* QUOTAROOT INBOX ""` {
+		t.Errorf("Unexpected QUOTAROOT response: %q", root)
+	}
+	if quota := findLine(lines, "* QUOTA "); quota != want {
+		t.Errorf("Unexpected QUOTA response: %q, want %q", quota, want)
+	}
+
+	lines = rawCommand(t, conn, reader, "A005", `GETQUOTA ""`)
+	if quota := findLine(lines, "* QUOTA "); quota != want {
+		t.Errorf("Unexpected GETQUOTA response: %q, want %q", quota, want)
+	}
+
+	for tag, cmd := range map[string]string{
+		"A006": `GETQUOTA "other"`,
+		"A007": `SETQUOTA "" (STORAGE 1)`,
+	} {
+		fmt.Fprintf(conn, "%s %s\r\n", tag, cmd)
+		line, err = reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read %s response: %v", cmd, err)
+		}
+		if !strings.HasPrefix(line, tag+" NO") {
+			t.Errorf("Expected NO for %s, got: %q", cmd, strings.TrimSpace(line))
+		}
+	}
+}
@@ -0,0 +1,80 @@
+//go:build integration
+
+package imap_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/migadu/sora/integration_tests/common"
+)
+
+// TestIMAP_Thread tests THREAD and UID THREAD (RFC 5256)
+func TestIMAP_Thread(t *testing.T) {
+	common.SkipIfDatabaseUnavailable(t)
+
+	server, account := common.SetupIMAPServer(t)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Address)
+	if err != nil {
+		t.Fatalf("Failed to dial IMAP server: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	line, _ := reader.ReadString('\n')
+	t.Logf("S: %s", strings.TrimSpace(line))
+
+	rawCommand(t, conn, reader, "A001", fmt.Sprintf("LOGIN %s %s", account.Email, account.Password))
+
+	caps := findLine(rawCommand(t, conn, reader, "A002", "CAPABILITY"), "* CAPABILITY")
+	if !strings.Contains(caps, "THREAD=REFERENCES") || !strings.Contains(caps, "THREAD=ORDEREDSUBJECT") {
+		t.Fatalf("THREAD capabilities not advertised: %s", caps)
+	}
+
+	rawCommand(t, conn, reader, "A003", "SELECT INBOX")
+
+	messages := []string{
+		"Message-ID: <a@example.com>\r\nDate: Mon, 1 Jan 2024 10:00:00 +0000\r\nSubject: Hello\r\n\r\nfirst\r\n",
+		"Message-ID: <c@example.com>\r\nDate: Mon, 1 Jan 2024 11:00:00 +0000\r\nSubject: Other\r\n\r\nother\r\n",
+		"Message-ID: <b@example.com>\r\nDate: Mon, 1 Jan 2024 12:00:00 +0000\r\nSubject: Re: Hello\r\nIn-Reply-To: <a@example.com>\r\nReferences: <a@example.com>\r\n\r\nreply\r\n",
+	}
+	for i, msg := range messages {
+		rawCommand(t, conn, reader, fmt.Sprintf("A1%02d", i), fmt.Sprintf("APPEND INBOX {%d+}\r\n%s", len(msg), msg))
+	}
+
+	lines := rawCommand(t, conn, reader, "A004", "THREAD REFERENCES UTF-8 ALL")
+	if thread := findLine(lines, "* THREAD"); thread != "* THREAD (1 3)(2)" {
+		t.Errorf("Unexpected THREAD REFERENCES response: %q", thread)
+	}
+
+	lines = rawCommand(t, conn, reader, "A005", "THREAD ORDEREDSUBJECT UTF-8 ALL")
+	if thread := findLine(lines, "* THREAD"); thread != "* THREAD (1 3)(2)" {
+		t.Errorf("Unexpected THREAD ORDEREDSUBJECT response: %q", thread)
+	}
+
+	lines = rawCommand(t, conn, reader, "A006", "UID THREAD REFERENCES UTF-8 SUBJECT hello")
+	fetch := rawCommand(t, conn, reader, "A007", "FETCH 1,3 (UID)")
+	var uids []string
+	for _, l := range fetch {
+		if i := strings.Index(l, "UID "); i >= 0 {
+			uids = append(uids, strings.TrimSuffix(l[i+4:], ")"))
+		}
+	}
+	if thread := findLine(lines, "* THREAD"); len(uids) != 2 || thread != fmt.Sprintf("* THREAD (%s %s)", uids[0], uids[1]) {
+		t.Errorf("Unexpected UID THREAD response: %q (UIDs %v)", thread, uids)
+	}
+
+	fmt.Fprintf(conn, "A008 THREAD UNKNOWN UTF-8 ALL\r\n")
+	line, err = reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read THREAD response: %v", err)
+	}
+	if !strings.HasPrefix(line, "A008 BAD") {
+		t.Errorf("Expected BAD for an unsupported algorithm, got: %q", strings.TrimSpace(line))
+	}
+}
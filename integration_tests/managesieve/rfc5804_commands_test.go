@@ -0,0 +1,208 @@
+//go:build integration
+
+package managesieve
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/migadu/sora/integration_tests/common"
+	"github.com/migadu/sora/server/managesieve"
+)
+
+// setupManageSieveServerWithLimits sets up a ManageSieve server with script size and count limits
+func setupManageSieveServerWithLimits(t *testing.T, maxScriptSize int64, maxScripts int) (*common.TestServer, common.TestAccount) {
+	t.Helper()
+
+	rdb := common.SetupTestDatabase(t)
+	account := common.CreateTestAccount(t, rdb)
+	address := common.GetRandomAddress(t)
+
+	server, err := managesieve.New(
+		context.Background(),
+		"test-limits",
+		"localhost",
+		address,
+		rdb,
+		managesieve.ManageSieveServerOptions{
+			InsecureAuth:        true,
+			SupportedExtensions: []string{"fileinto", "vacation", "envelope", "variables"},
+			MaxScriptSize:       maxScriptSize,
+			MaxScripts:          maxScripts,
+		},
+	)
+	if err != nil {
+		t.Fatalf("Failed to create ManageSieve server: %v", err)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		server.Start(errChan)
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+
+	t.Cleanup(func() {
+		server.Close()
+		select {
+		case err := <-errChan:
+			if err != nil {
+				t.Logf("ManageSieve server error during shutdown: %v", err)
+			}
+		case <-time.After(1 * time.Second):
+			// Timeout waiting for server to shut down
+		}
+	})
+
+	return &common.TestServer{
+		Address:     address,
+		Server:      server,
+		ResilientDB: rdb,
+	}, account
+}
+
+func TestManageSieveCheckScript(t *testing.T) {
+	common.SkipIfDatabaseUnavailable(t)
+
+	server, account := setupManageSieveServerWithLimits(t, 200, 0)
+
+	conn, err := net.Dial("tcp", server.Address)
+	if err != nil {
+		t.Fatalf("Failed to connect to ManageSieve server: %v", err)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	authenticateManageSieve(t, reader, writer, account)
+
+	// Valid script as quoted string
+	sendCommand(t, writer, `CHECKSCRIPT "keep;"`)
+	if response := readSimpleResponse(t, reader); !strings.HasPrefix(response, "OK") {
+		t.Errorf("CHECKSCRIPT of a valid script failed: %s", response)
+	}
+
+	// Invalid script as literal
+	script := `require "editheader"; addheader "X-Test" "1";`
+	sendCommand(t, writer, fmt.Sprintf("CHECKSCRIPT {%d+}", len(script)))
+	if response := readSimpleResponse(t, reader); !strings.HasPrefix(response, "+") {
+		t.Fatalf("Expected continuation, got: %s", response)
+	}
+	writer.WriteString(script)
+	writer.Flush()
+	if response := readSimpleResponse(t, reader); !strings.HasPrefix(response, "NO") {
+		t.Errorf("CHECKSCRIPT of a script with a disabled extension should fail, got: %s", response)
+	}
+
+	// Too large
+	sendCommand(t, writer, fmt.Sprintf(`CHECKSCRIPT "%s"`, strings.Repeat("#", 201)))
+	if response := readSimpleResponse(t, reader); !strings.HasPrefix(response, "NO (QUOTA/MAXSIZE)") {
+		t.Errorf("Expected QUOTA/MAXSIZE, got: %s", response)
+	}
+
+	// Nothing was stored
+	sendCommand(t, writer, "LISTSCRIPTS")
+	if response := readSimpleResponse(t, reader); response != "OK" {
+		t.Errorf("CHECKSCRIPT must not store scripts, LISTSCRIPTS returned: %s", response)
+	}
+}
+
+func TestManageSieveHaveSpaceAndLimits(t *testing.T) {
+	common.SkipIfDatabaseUnavailable(t)
+
+	server, account := setupManageSieveServerWithLimits(t, 100, 2)
+
+	conn, err := net.Dial("tcp", server.Address)
+	if err != nil {
+		t.Fatalf("Failed to connect to ManageSieve server: %v", err)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	authenticateManageSieve(t, reader, writer, account)
+
+	sendCommand(t, writer, `HAVESPACE "first" 100`)
+	if response := readSimpleResponse(t, reader); !strings.HasPrefix(response, "OK") {
+		t.Errorf("HAVESPACE within limits failed: %s", response)
+	}
+	sendCommand(t, writer, `HAVESPACE "first" 101`)
+	if response := readSimpleResponse(t, reader); !strings.HasPrefix(response, "NO (QUOTA/MAXSIZE)") {
+		t.Errorf("Expected QUOTA/MAXSIZE, got: %s", response)
+	}
+
+	for _, name := range []string{"first", "second"} {
+		if err := putScriptWithLiteral(t, reader, writer, name, "keep;"); err != nil {
+			t.Fatalf("PUTSCRIPT %s failed: %v", name, err)
+		}
+	}
+
+	// The account is full, but existing scripts can be replaced
+	sendCommand(t, writer, `HAVESPACE "third" 10`)
+	if response := readSimpleResponse(t, reader); !strings.HasPrefix(response, "NO (QUOTA/MAXSCRIPTS)") {
+		t.Errorf("Expected QUOTA/MAXSCRIPTS, got: %s", response)
+	}
+	sendCommand(t, writer, `HAVESPACE "first" 10`)
+	if response := readSimpleResponse(t, reader); !strings.HasPrefix(response, "OK") {
+		t.Errorf("HAVESPACE for an existing script failed: %s", response)
+	}
+	if err := putScriptWithLiteral(t, reader, writer, "third", "keep;"); err == nil || !strings.Contains(err.Error(), "QUOTA/MAXSCRIPTS") {
+		t.Errorf("Expected PUTSCRIPT to fail with QUOTA/MAXSCRIPTS, got: %v", err)
+	}
+	if err := putScriptWithLiteral(t, reader, writer, "first", "discard;"); err != nil {
+		t.Errorf("Replacing a script in a full account failed: %v", err)
+	}
+}
+
+func TestManageSieveRenameScript(t *testing.T) {
+	common.SkipIfDatabaseUnavailable(t)
+
+	server, account := common.SetupManageSieveServer(t)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Address)
+	if err != nil {
+		t.Fatalf("Failed to connect to ManageSieve server: %v", err)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	authenticateManageSieve(t, reader, writer, account)
+
+	for _, name := range []string{"old", "other"} {
+		if err := putScriptWithLiteral(t, reader, writer, name, "keep;"); err != nil {
+			t.Fatalf("PUTSCRIPT %s failed: %v", name, err)
+		}
+	}
+	sendCommand(t, writer, `SETACTIVE "old"`)
+	if response := readSimpleResponse(t, reader); !strings.HasPrefix(response, "OK") {
+		t.Fatalf("SETACTIVE failed: %s", response)
+	}
+
+	sendCommand(t, writer, `RENAMESCRIPT "missing" "new"`)
+	if response := readSimpleResponse(t, reader); !strings.HasPrefix(response, "NO (NONEXISTENT)") {
+		t.Errorf("Expected NONEXISTENT, got: %s", response)
+	}
+	sendCommand(t, writer, `RENAMESCRIPT "old" "other"`)
+	if response := readSimpleResponse(t, reader); !strings.HasPrefix(response, "NO (ALREADYEXISTS)") {
+		t.Errorf("Expected ALREADYEXISTS, got: %s", response)
+	}
+	sendCommand(t, writer, `RENAMESCRIPT "old" "new"`)
+	if response := readSimpleResponse(t, reader); !strings.HasPrefix(response, "OK") {
+		t.Fatalf("RENAMESCRIPT failed: %s", response)
+	}
+
+	// The renamed script stays active
+	sendCommand(t, writer, "LISTSCRIPTS")
+	listResponse := readListScriptsResponse(t, reader)
+	if !strings.Contains(listResponse, `"new" ACTIVE`) || strings.Contains(listResponse, `"old"`) {
+		t.Errorf("Unexpected LISTSCRIPTS after rename: %s", listResponse)
+	}
+}
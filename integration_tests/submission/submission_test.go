@@ -0,0 +1,189 @@
+//go:build integration
+
+package submission_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/integration_tests/common"
+	"github.com/migadu/sora/server/submission"
+)
+
+// recordingQueue is a relay queue that keeps the queued messages in memory.
+// While fail is set, EnqueueAll fails and queues nothing.
+type recordingQueue struct {
+	mu         sync.Mutex
+	recipients []string
+	fail       error
+}
+
+func (q *recordingQueue) EnqueueAll(from string, to []string, messageType string, messageBytes []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.fail != nil {
+		return q.fail
+	}
+	q.recipients = append(q.recipients, to...)
+	return nil
+}
+
+func (q *recordingQueue) setFail(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.fail = err
+}
+
+func (q *recordingQueue) queued() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]string(nil), q.recipients...)
+}
+
+func dialSubmission(t *testing.T, address string, account common.TestAccount) *smtp.Client {
+	t.Helper()
+	c, err := smtp.Dial(address)
+	if err != nil {
+		t.Fatalf("Failed to dial submission server: %v", err)
+	}
+	if err := c.Auth(sasl.NewPlainClient("", account.Email, account.Password)); err != nil {
+		c.Close()
+		t.Fatalf("AUTH failed: %v", err)
+	}
+	return c
+}
+
+func sendMessage(c *smtp.Client, from string, to ...string) error {
+	if err := c.Mail(from, nil); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt, nil); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte("Subject: Hello\r\n\r\nbody\r\n")); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// TestSubmission_AccountStatus tests that send-disabled accounts can no longer
+// submit mail while active accounts can.
+func TestSubmission_AccountStatus(t *testing.T) {
+	common.SkipIfDatabaseUnavailable(t)
+
+	queue := &recordingQueue{}
+	server, account := common.SetupSubmissionServer(t, queue, submission.SubmissionServerOptions{})
+	defer server.Close()
+
+	c := dialSubmission(t, server.Address, account)
+	defer c.Close()
+
+	if err := sendMessage(c, account.Email, "someone@example.net"); err != nil {
+		t.Fatalf("Active account failed to send: %v", err)
+	}
+	if got := queue.queued(); len(got) != 1 || got[0] != "someone@example.net" {
+		t.Fatalf("Unexpected queued recipients: %v", got)
+	}
+
+	if _, err := server.ResilientDB.SetAccountStatusWithRetry(context.Background(), account.Email, db.AccountStatus{Status: db.AccountStatusSendDisabled}); err != nil {
+		t.Fatalf("Failed to set account status: %v", err)
+	}
+
+	err := c.Mail(account.Email, nil)
+	var smtpErr *smtp.SMTPError
+	if !errors.As(err, &smtpErr) || smtpErr.Code != 550 || smtpErr.EnhancedCode != (smtp.EnhancedCode{5, 7, 1}) {
+		t.Fatalf("Expected 550 5.7.1 for a send-disabled account, got: %v", err)
+	}
+	if !strings.Contains(smtpErr.Message, "disabled") {
+		t.Errorf("Unexpected rejection message: %q", smtpErr.Message)
+	}
+	if got := queue.queued(); len(got) != 1 {
+		t.Errorf("Nothing should be queued after the rejection, got: %v", got)
+	}
+}
+
+// TestSubmission_EnqueueFailure tests that a message the queue fails to take
+// is queued for none of its recipients, so the client's retry sends it once.
+func TestSubmission_EnqueueFailure(t *testing.T) {
+	common.SkipIfDatabaseUnavailable(t)
+
+	queue := &recordingQueue{}
+	server, account := common.SetupSubmissionServer(t, queue, submission.SubmissionServerOptions{})
+	defer server.Close()
+
+	c := dialSubmission(t, server.Address, account)
+	defer c.Close()
+
+	queue.setFail(errors.New("disk full"))
+	err := sendMessage(c, account.Email, "a@example.net", "b@example.net")
+	var smtpErr *smtp.SMTPError
+	if !errors.As(err, &smtpErr) || smtpErr.Code != 451 {
+		t.Fatalf("Expected 451 when the queue fails, got: %v", err)
+	}
+	if got := queue.queued(); len(got) != 0 {
+		t.Fatalf("Nothing should be queued after the failure, got: %v", got)
+	}
+
+	queue.setFail(nil)
+	if err := sendMessage(c, account.Email, "a@example.net", "b@example.net"); err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+	if got := queue.queued(); len(got) != 2 || got[0] != "a@example.net" || got[1] != "b@example.net" {
+		t.Fatalf("Expected each recipient to be queued once, got: %v", got)
+	}
+}
+
+// TestSubmission_MaxRecipients tests that RCPT TO is refused once a message
+// has max_recipients recipients.
+func TestSubmission_MaxRecipients(t *testing.T) {
+	common.SkipIfDatabaseUnavailable(t)
+
+	queue := &recordingQueue{}
+	server, account := common.SetupSubmissionServer(t, queue, submission.SubmissionServerOptions{MaxRecipients: 2})
+	defer server.Close()
+
+	c := dialSubmission(t, server.Address, account)
+	defer c.Close()
+
+	if err := c.Mail(account.Email, nil); err != nil {
+		t.Fatalf("MAIL failed: %v", err)
+	}
+	for _, rcpt := range []string{"a@example.net", "b@example.net"} {
+		if err := c.Rcpt(rcpt, nil); err != nil {
+			t.Fatalf("RCPT %s failed: %v", rcpt, err)
+		}
+	}
+
+	err := c.Rcpt("c@example.net", nil)
+	var smtpErr *smtp.SMTPError
+	if !errors.As(err, &smtpErr) || smtpErr.Code != 452 || smtpErr.EnhancedCode != (smtp.EnhancedCode{4, 5, 3}) {
+		t.Fatalf("Expected 452 4.5.3 for the third recipient, got: %v", err)
+	}
+
+	// The accepted recipients still get the message
+	w, err := c.Data()
+	if err != nil {
+		t.Fatalf("DATA failed: %v", err)
+	}
+	if _, err := w.Write([]byte("Subject: Hello\r\n\r\nbody\r\n")); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	if got := queue.queued(); len(got) != 2 {
+		t.Fatalf("Expected 2 queued recipients, got: %v", got)
+	}
+}
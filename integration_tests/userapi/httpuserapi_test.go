@@ -15,6 +15,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/migadu/sora/db"
 	"github.com/migadu/sora/integration_tests/common"
 	"github.com/migadu/sora/pkg/resilient"
 	"github.com/migadu/sora/server"
@@ -752,6 +753,17 @@ if header :contains "Subject" "[SPAM]" {
 		t.Logf("Successfully created filter")
 	})
 
+	t.Run("CreateFilter_TooLarge", func(t *testing.T) {
+		createReq := map[string]string{
+			"script": "# " + strings.Repeat("x", 16*1024) + "\nkeep;",
+		}
+		resp := tc.makeRequest(t, "PUT", "/user/filters/too-large", createReq)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Fatalf("Expected status 413, got %d", resp.StatusCode)
+		}
+	})
+
 	t.Run("GetFilter", func(t *testing.T) {
 		resp := tc.makeRequest(t, "GET", fmt.Sprintf("/user/filters/%s", filterName), nil)
 		if resp.StatusCode != http.StatusOK {
@@ -838,6 +850,49 @@ if header :contains "Subject" "[SPAM]" {
 	})
 }
 
+// TestSieveFilters_DomainExtensions tests that filters may only use the Sieve
+// extensions allowed for the account's domain
+func TestSieveFilters_DomainExtensions(t *testing.T) {
+	tc := setupTestServer(t)
+	ctx := context.Background()
+
+	domain := fmt.Sprintf("sieve-%d.example.com", time.Now().UnixNano())
+	if err := tc.RDB.CreateDomainWithRetry(ctx, db.Domain{Name: domain, SieveExtensions: []string{"fileinto"}}); err != nil {
+		t.Fatalf("Failed to create domain: %v", err)
+	}
+	email := "filters@" + domain
+	password := "s3cur3p4ss!"
+	if _, err := tc.RDB.CreateAccountWithRetry(ctx, db.CreateAccountRequest{Email: email, Password: password, HashType: "bcrypt", IsPrimary: true}); err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+
+	resp := tc.makeRequest(t, "POST", "/user/auth/login", map[string]string{"email": email, "password": password})
+	var loginResp map[string]any
+	parseJSON(t, resp, &loginResp)
+	tc.JWTToken = loginResp["token"].(string)
+
+	t.Run("AllowedExtension", func(t *testing.T) {
+		resp := tc.makeRequest(t, "PUT", "/user/filters/allowed", map[string]string{
+			"script": "require [\"fileinto\"];\nfileinto \"Junk\";",
+		})
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+			body, _ := io.ReadAll(resp.Body)
+			t.Fatalf("Expected status 200 or 201, got %d: %s", resp.StatusCode, string(body))
+		}
+	})
+
+	t.Run("DisallowedExtension", func(t *testing.T) {
+		resp := tc.makeRequest(t, "PUT", "/user/filters/disallowed", map[string]string{
+			"script": "require [\"vacation\"];\nvacation \"Away\";",
+		})
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Expected status 400, got %d", resp.StatusCode)
+		}
+	})
+}
+
 // TestSearchFunctionality tests search operations
 func TestSearchFunctionality(t *testing.T) {
 	tc := setupTestServer(t)
@@ -87,8 +87,24 @@ import (
 var (
 	// Global logger instance
 	globalLogger *slog.Logger
+
+	// fatalHook runs before Fatal and Fatalf exit the process
+	fatalHook func(msg string)
 )
 
+// SetFatalHook registers a function that Fatal and Fatalf call with the
+// message before exiting, e.g. to record the failure of a CLI operation.
+func SetFatalHook(hook func(msg string)) {
+	fatalHook = hook
+}
+
+func runFatalHook(msg string) {
+	if hook := fatalHook; hook != nil {
+		fatalHook = nil // Guard against recursion if the hook itself fails fatally
+		hook(msg)
+	}
+}
+
 // syslogHandler wraps syslog.Writer to implement slog.Handler
 type syslogHandler struct {
 	writer *syslog.Writer
@@ -339,6 +355,7 @@ func ErrorContext(ctx context.Context, msg string, args ...any) {
 // Fatal logs a fatal message and exits
 func Fatal(msg string, args ...any) {
 	Get().Error(msg, args...)
+	runFatalHook(msg)
 	os.Exit(1)
 }
 
@@ -379,7 +396,9 @@ func Errorf(format string, args ...any) {
 
 // Fatalf logs a fatal message with formatting and exits (compatibility)
 func Fatalf(format string, args ...any) {
-	Get().Error(fmt.Sprintf(format, args...))
+	msg := fmt.Sprintf(format, args...)
+	Get().Error(msg)
+	runFatalHook(msg)
 	os.Exit(1)
 }
 
@@ -0,0 +1,215 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/metrics"
+	"github.com/migadu/sora/server"
+)
+
+// Sink receives every published event after enrichment.
+type Sink interface {
+	Name() string
+	Write(ctx context.Context, ev Event) error
+}
+
+// Directory resolves the account and mailbox details that write paths do not
+// have at hand. It is implemented by *resilient.ResilientDatabase.
+type Directory interface {
+	GetMailboxOwnerWithRetry(ctx context.Context, mailboxID int64) (int64, string, error)
+	GetPrimaryEmailForAccountWithRetry(ctx context.Context, accountID int64) (server.Address, error)
+}
+
+const (
+	lookupCacheTTL  = time.Minute
+	lookupCacheSize = 10000
+	lookupTimeout   = 5 * time.Second
+)
+
+// Dispatcher buffers published events and hands them to its sinks from a
+// single goroutine, so sinks see events in publish order.
+type Dispatcher struct {
+	events chan Event
+	dir    Directory
+	sinks  []Sink
+
+	mailboxes *ttlCache[int64, mailboxOwner]
+	emails    *ttlCache[int64, string]
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+type mailboxOwner struct {
+	accountID int64
+	name      string
+}
+
+// NewDispatcher creates a dispatcher that buffers up to bufferSize events.
+// dir may be nil, in which case events are delivered as published.
+func NewDispatcher(bufferSize int, dir Directory, sinks ...Sink) *Dispatcher {
+	return &Dispatcher{
+		events:    make(chan Event, bufferSize),
+		dir:       dir,
+		sinks:     sinks,
+		mailboxes: newTTLCache[int64, mailboxOwner](lookupCacheSize, lookupCacheTTL),
+		emails:    newTTLCache[int64, string](lookupCacheSize, lookupCacheTTL),
+		stopCh:    make(chan struct{}),
+	}
+}
+
+// Publish queues an event without blocking. The event is dropped if the
+// buffer is full.
+func (d *Dispatcher) Publish(ev Event) {
+	select {
+	case d.events <- ev:
+	default:
+		metrics.EventsDropped.Inc()
+		logger.Warn("Events: Buffer full, dropping event", "type", ev.Type, "account_id", ev.AccountID)
+	}
+}
+
+// Start begins delivering events to the sinks.
+func (d *Dispatcher) Start(ctx context.Context) {
+	names := make([]string, 0, len(d.sinks))
+	for _, s := range d.sinks {
+		names = append(names, s.Name())
+	}
+	logger.Info("Events: Starting dispatcher", "sinks", names, "buffer", cap(d.events))
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				d.drain(ctx)
+				return
+			case <-d.stopCh:
+				d.drain(ctx)
+				return
+			case ev := <-d.events:
+				d.dispatch(ctx, ev)
+			}
+		}
+	}()
+}
+
+// Stop delivers the events that are still buffered and waits for the
+// dispatcher to exit.
+func (d *Dispatcher) Stop() {
+	close(d.stopCh)
+	d.wg.Wait()
+	logger.Info("Events: Dispatcher stopped")
+}
+
+func (d *Dispatcher) drain(ctx context.Context) {
+	// Buffered events are still handed to the sinks; the webhook sink only
+	// writes them to its queue, which is fast and survives the restart.
+	ctx = context.WithoutCancel(ctx)
+	for {
+		select {
+		case ev := <-d.events:
+			d.dispatch(ctx, ev)
+		default:
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, ev Event) {
+	d.enrich(ctx, &ev)
+	for _, s := range d.sinks {
+		if err := s.Write(ctx, ev); err != nil {
+			logger.Warn("Events: Sink failed to accept event", "sink", s.Name(), "type", ev.Type, "id", ev.ID, "error", err)
+		}
+	}
+}
+
+// enrich fills in the account, mailbox name and primary address of an event
+// from the directory, caching lookups for a short time.
+func (d *Dispatcher) enrich(ctx context.Context, ev *Event) {
+	if d.dir == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	if ev.MailboxID != 0 && (ev.AccountID == 0 || ev.Mailbox == "") && ev.Type != MailboxDeleted {
+		owner, ok := d.mailboxes.get(ev.MailboxID)
+		if !ok {
+			accountID, name, err := d.dir.GetMailboxOwnerWithRetry(ctx, ev.MailboxID)
+			if err != nil {
+				logger.Debug("Events: Failed to look up mailbox", "mailbox_id", ev.MailboxID, "error", err)
+			} else {
+				owner = mailboxOwner{accountID: accountID, name: name}
+				d.mailboxes.put(ev.MailboxID, owner)
+				ok = true
+			}
+		}
+		if ok {
+			if ev.AccountID == 0 {
+				ev.AccountID = owner.accountID
+			}
+			if ev.Mailbox == "" {
+				ev.Mailbox = owner.name
+			}
+		}
+	}
+
+	if ev.AccountID != 0 && ev.Email == "" {
+		email, ok := d.emails.get(ev.AccountID)
+		if !ok {
+			addr, err := d.dir.GetPrimaryEmailForAccountWithRetry(ctx, ev.AccountID)
+			if err != nil {
+				logger.Debug("Events: Failed to look up primary address", "account_id", ev.AccountID, "error", err)
+				return
+			}
+			email = addr.FullAddress()
+			d.emails.put(ev.AccountID, email)
+		}
+		ev.Email = email
+	}
+}
+
+// ttlCache is a small map with expiring entries. It is cleared when full
+// instead of tracking recency, which is good enough for lookups that are
+// cheap to repeat.
+type ttlCache[K comparable, V any] struct {
+	mu      sync.Mutex
+	entries map[K]ttlEntry[V]
+	size    int
+	ttl     time.Duration
+}
+
+type ttlEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+func newTTLCache[K comparable, V any](size int, ttl time.Duration) *ttlCache[K, V] {
+	return &ttlCache[K, V]{entries: make(map[K]ttlEntry[V]), size: size, ttl: ttl}
+}
+
+func (c *ttlCache[K, V]) get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+func (c *ttlCache[K, V]) put(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.size {
+		clear(c.entries)
+	}
+	c.entries[key] = ttlEntry[V]{value: value, expires: time.Now().Add(c.ttl)}
+}
@@ -0,0 +1,153 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDirectory struct {
+	mu            sync.Mutex
+	mailboxLookup int
+}
+
+func (f *fakeDirectory) GetMailboxOwnerWithRetry(ctx context.Context, mailboxID int64) (int64, string, error) {
+	f.mu.Lock()
+	f.mailboxLookup++
+	f.mu.Unlock()
+	if mailboxID != 10 {
+		return 0, "", consts.ErrMailboxNotFound
+	}
+	return 7, "INBOX", nil
+}
+
+func (f *fakeDirectory) GetPrimaryEmailForAccountWithRetry(ctx context.Context, accountID int64) (server.Address, error) {
+	if accountID != 7 {
+		return server.Address{}, consts.ErrUserNotFound
+	}
+	return server.NewAddress("user@example.com")
+}
+
+type recordingSink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recordingSink) Name() string { return "recording" }
+
+func (r *recordingSink) Write(ctx context.Context, ev Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, ev)
+	return nil
+}
+
+func TestDispatcher_EnrichesAndDelivers(t *testing.T) {
+	dir := &fakeDirectory{}
+	sink := &recordingSink{}
+	d := NewDispatcher(10, dir, sink)
+
+	SetDefault(d)
+	defer SetDefault(nil)
+
+	Publish(Event{Type: FlagsChanged, MailboxID: 10, UIDs: []uint32{1}, Flags: []string{`\Seen`}})
+	Publish(Event{Type: FlagsChanged, MailboxID: 10, UIDs: []uint32{2}})
+	Publish(Event{Type: MailboxDeleted, AccountID: 7, MailboxID: 11})
+
+	// Events published before Start are buffered and delivered on Stop
+	d.Start(context.Background())
+	d.Stop()
+
+	require.Len(t, sink.events, 3)
+	first := sink.events[0]
+	assert.NotEmpty(t, first.ID)
+	assert.False(t, first.Time.IsZero())
+	assert.Equal(t, int64(7), first.AccountID)
+	assert.Equal(t, "INBOX", first.Mailbox)
+	assert.Equal(t, "user@example.com", first.Email)
+	assert.Equal(t, 1, dir.mailboxLookup, "mailbox owner lookups are cached")
+
+	deleted := sink.events[2]
+	assert.Equal(t, "user@example.com", deleted.Email)
+	assert.Empty(t, deleted.Mailbox, "deleted mailboxes are not looked up")
+}
+
+func TestDispatcher_DropsWhenFull(t *testing.T) {
+	sink := &recordingSink{}
+	d := NewDispatcher(1, nil, sink)
+
+	d.Publish(Event{ID: "1", Type: AuthSucceeded})
+	d.Publish(Event{ID: "2", Type: AuthSucceeded})
+
+	d.Start(context.Background())
+	d.Stop()
+
+	require.Len(t, sink.events, 1)
+	assert.Equal(t, "1", sink.events[0].ID)
+}
+
+func TestPublishAuth(t *testing.T) {
+	sink := &recordingSink{}
+	d := NewDispatcher(10, nil, sink)
+	SetDefault(d)
+	defer SetDefault(nil)
+
+	ctx := WithSource(context.Background(), "imap", "192.0.2.1")
+	PublishAuth(ctx, "user@example.com", 7, nil)
+	PublishAuth(ctx, "user@example.com", 0, consts.ErrUserNotFound)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	PublishAuth(canceled, "user@example.com", 0, context.Canceled)
+
+	d.Start(context.Background())
+	d.Stop()
+
+	require.Len(t, sink.events, 2)
+	assert.Equal(t, AuthSucceeded, sink.events[0].Type)
+	assert.Equal(t, int64(7), sink.events[0].AccountID)
+	assert.Equal(t, "imap", sink.events[0].Protocol)
+	assert.Equal(t, "192.0.2.1", sink.events[0].RemoteIP)
+	assert.Equal(t, AuthFailed, sink.events[1].Type)
+	assert.Equal(t, "user_not_found", sink.events[1].Reason)
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log", "events.ndjson")
+	sink, err := NewFileSink(path)
+	require.NoError(t, err)
+
+	require.NoError(t, sink.Write(context.Background(), Event{ID: "1", Type: MailboxCreated, Mailbox: "Archive"}))
+
+	// Rotation: move the file away and reopen
+	require.NoError(t, os.Rename(path, path+".1"))
+	require.NoError(t, sink.Reopen())
+	require.NoError(t, sink.Write(context.Background(), Event{ID: "2", Type: MailboxDeleted}))
+	require.NoError(t, sink.Close())
+	assert.Error(t, sink.Write(context.Background(), Event{ID: "3"}))
+
+	readIDs := func(p string) []string {
+		f, err := os.Open(p)
+		require.NoError(t, err)
+		defer f.Close()
+		var ids []string
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var ev Event
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &ev))
+			ids = append(ids, ev.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"1"}, readIDs(path+".1"))
+	assert.Equal(t, []string{"2"}, readIDs(path))
+}
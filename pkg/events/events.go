@@ -0,0 +1,169 @@
+// Package events publishes typed mailbox and authentication events to
+// pluggable sinks: signed HTTP webhooks delivered through a durable on-disk
+// queue, and a newline-delimited JSON file.
+//
+// Events are emitted after the originating database transaction commits.
+// Publishing never blocks the caller; when the in-memory buffer is full the
+// event is dropped and counted in sora_events_dropped_total.
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/pkg/metrics"
+)
+
+// Type identifies the kind of an event.
+type Type string
+
+const (
+	MessageAppended Type = "message.appended"
+	FlagsChanged    Type = "message.flags_changed"
+	MessageExpunged Type = "message.expunged"
+	MailboxCreated  Type = "mailbox.created"
+	MailboxDeleted  Type = "mailbox.deleted"
+	AuthSucceeded   Type = "auth.succeeded"
+	AuthFailed      Type = "auth.failed"
+)
+
+// AllTypes lists every event type in a stable order.
+var AllTypes = []Type{
+	MessageAppended,
+	FlagsChanged,
+	MessageExpunged,
+	MailboxCreated,
+	MailboxDeleted,
+	AuthSucceeded,
+	AuthFailed,
+}
+
+// ParseType validates an event type name.
+func ParseType(s string) (Type, error) {
+	for _, t := range AllTypes {
+		if string(t) == s {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("unknown event type: %q", s)
+}
+
+// Event is a single mailbox or authentication event. Fields that do not apply
+// to a type are omitted from the JSON encoding.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      Type      `json:"type"`
+	Time      time.Time `json:"time"`
+	AccountID int64     `json:"account_id,omitempty"`
+	Email     string    `json:"email,omitempty"` // Primary address of the account, or the login name for auth events
+	MailboxID int64     `json:"mailbox_id,omitempty"`
+	Mailbox   string    `json:"mailbox,omitempty"`
+	UIDs      []uint32  `json:"uids,omitempty"`
+	Flags     []string  `json:"flags,omitempty"`
+	MessageID string    `json:"message_id,omitempty"` // Message-ID header of an appended message
+	Subject   string    `json:"subject,omitempty"`
+	Size      int64     `json:"size,omitempty"`
+	Protocol  string    `json:"protocol,omitempty"`
+	RemoteIP  string    `json:"remote_ip,omitempty"`
+	Reason    string    `json:"reason,omitempty"` // Failure reason for auth.failed
+}
+
+// Domain returns the domain part of the event's address.
+func (e *Event) Domain() string {
+	if i := strings.LastIndex(e.Email, "@"); i >= 0 {
+		return strings.ToLower(e.Email[i+1:])
+	}
+	return ""
+}
+
+// Publisher accepts events for asynchronous delivery.
+type Publisher interface {
+	Publish(ev Event)
+}
+
+var defaultPublisher atomic.Pointer[Publisher]
+
+// SetDefault installs the process-wide publisher used by Publish. Passing nil
+// disables publishing.
+func SetDefault(p Publisher) {
+	if p == nil {
+		defaultPublisher.Store(nil)
+		return
+	}
+	defaultPublisher.Store(&p)
+}
+
+// Enabled reports whether a publisher is installed, so callers can skip
+// building events nobody will receive.
+func Enabled() bool {
+	return defaultPublisher.Load() != nil
+}
+
+// Publish hands an event to the default publisher. It assigns the ID and
+// timestamp if unset and is a no-op when the event stream is disabled.
+func Publish(ev Event) {
+	p := defaultPublisher.Load()
+	if p == nil {
+		return
+	}
+	if ev.ID == "" {
+		ev.ID = uuid.New().String()
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	metrics.EventsPublished.WithLabelValues(string(ev.Type)).Inc()
+	(*p).Publish(ev)
+}
+
+type sourceKey struct{}
+
+type source struct {
+	protocol string
+	remoteIP string
+}
+
+// WithSource records the protocol and client address of a session in ctx so
+// that auth events published further down carry them.
+func WithSource(ctx context.Context, protocol, remoteIP string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source{protocol: protocol, remoteIP: remoteIP})
+}
+
+// SourceFromContext returns the protocol and client address stored by WithSource.
+func SourceFromContext(ctx context.Context) (protocol, remoteIP string) {
+	if src, ok := ctx.Value(sourceKey{}).(source); ok {
+		return src.protocol, src.remoteIP
+	}
+	return "", ""
+}
+
+// PublishAuth publishes AuthSucceeded or AuthFailed for a login attempt,
+// depending on err. Attempts aborted by context cancellation are not reported.
+func PublishAuth(ctx context.Context, address string, accountID int64, err error) {
+	if !Enabled() || ctx.Err() != nil {
+		return
+	}
+	protocol, remoteIP := SourceFromContext(ctx)
+	ev := Event{
+		Type:      AuthSucceeded,
+		AccountID: accountID,
+		Email:     address,
+		Protocol:  protocol,
+		RemoteIP:  remoteIP,
+	}
+	if err != nil {
+		ev.Type = AuthFailed
+		ev.AccountID = 0
+		ev.Reason = "invalid_credentials"
+		if errors.Is(err, consts.ErrUserNotFound) {
+			ev.Reason = "user_not_found"
+		}
+	}
+	Publish(ev)
+}
@@ -0,0 +1,234 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/migadu/sora/logger"
+)
+
+// Delivery is one queued webhook request. The subscription secret is not
+// stored; it is looked up when the delivery is attempted.
+type Delivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID int64           `json:"subscription_id"`
+	EventType      Type            `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	QueuedAt       time.Time       `json:"queued_at"`
+	Attempts       int             `json:"attempts"`
+	LastAttempt    time.Time       `json:"last_attempt"`
+	NextRetry      time.Time       `json:"next_retry"`
+	Errors         []string        `json:"errors"`
+}
+
+// Queue is a durable webhook delivery queue with one JSON file per delivery
+// in pending/ and, once attempts are exhausted, in failed/.
+type Queue struct {
+	basePath     string
+	pendingDir   string
+	failedDir    string
+	maxAttempts  int
+	retryBackoff []time.Duration
+	mu           sync.Mutex
+}
+
+// NewQueue creates the queue directories below basePath.
+func NewQueue(basePath string, maxAttempts int, retryBackoff []time.Duration) (*Queue, error) {
+	if basePath == "" {
+		return nil, fmt.Errorf("base path cannot be empty")
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = 10
+	}
+	if len(retryBackoff) == 0 {
+		retryBackoff = []time.Duration{time.Minute}
+	}
+
+	q := &Queue{
+		basePath:     basePath,
+		pendingDir:   filepath.Join(basePath, "pending"),
+		failedDir:    filepath.Join(basePath, "failed"),
+		maxAttempts:  maxAttempts,
+		retryBackoff: retryBackoff,
+	}
+	for _, dir := range []string{q.pendingDir, q.failedDir} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+	return q, nil
+}
+
+// Enqueue adds a delivery of payload to a subscription, due immediately.
+func (q *Queue) Enqueue(subscriptionID int64, eventType Type, payload []byte) error {
+	now := time.Now()
+	d := Delivery{
+		ID:             uuid.New().String(),
+		SubscriptionID: subscriptionID,
+		EventType:      eventType,
+		Payload:        payload,
+		QueuedAt:       now,
+		NextRetry:      now,
+		Errors:         []string{},
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := writeJSONAtomic(filepath.Join(q.pendingDir, d.ID+".json"), d); err != nil {
+		return fmt.Errorf("failed to queue webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// Due returns up to limit pending deliveries whose retry time has passed,
+// oldest first.
+func (q *Queue) Due(now time.Time, limit int) ([]Delivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries, err := os.ReadDir(q.pendingDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending directory: %w", err)
+	}
+
+	var due []Delivery
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		var d Delivery
+		if err := readJSON(filepath.Join(q.pendingDir, entry.Name()), &d); err != nil {
+			logger.Error("Events: Failed to read queued webhook delivery", "file", entry.Name(), "error", err)
+			continue
+		}
+		if now.Before(d.NextRetry) {
+			continue
+		}
+		due = append(due, d)
+	}
+
+	sort.Slice(due, func(i, j int) bool { return due[i].QueuedAt.Before(due[j].QueuedAt) })
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// Remove deletes a pending delivery.
+func (q *Queue) Remove(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := os.Remove(filepath.Join(q.pendingDir, id+".json")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// MarkFailure records a failed attempt. The delivery is moved to failed/ if
+// the failure is permanent or the attempts are exhausted, otherwise it is
+// rescheduled according to the backoff. It reports whether the delivery
+// was moved to failed/.
+func (q *Queue) MarkFailure(id, errorMsg string, permanent bool) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pendingPath := filepath.Join(q.pendingDir, id+".json")
+	var d Delivery
+	if err := readJSON(pendingPath, &d); err != nil {
+		return false, fmt.Errorf("failed to read delivery: %w", err)
+	}
+
+	now := time.Now()
+	d.Attempts++
+	d.LastAttempt = now
+	d.Errors = append(d.Errors, fmt.Sprintf("[%s] %s", now.Format(time.RFC3339), errorMsg))
+
+	if permanent || d.Attempts >= q.maxAttempts {
+		if err := writeJSONAtomic(filepath.Join(q.failedDir, id+".json"), d); err != nil {
+			return false, fmt.Errorf("failed to write failed delivery: %w", err)
+		}
+		os.Remove(pendingPath)
+		return true, nil
+	}
+
+	idx := min(d.Attempts-1, len(q.retryBackoff)-1)
+	d.NextRetry = now.Add(q.retryBackoff[idx])
+	if err := writeJSONAtomic(pendingPath, d); err != nil {
+		return false, fmt.Errorf("failed to update delivery: %w", err)
+	}
+	return false, nil
+}
+
+// CleanupFailed removes failed deliveries whose last attempt is older than
+// retention. A retention of 0 keeps them forever.
+func (q *Queue) CleanupFailed(retention time.Duration) (int, error) {
+	if retention == 0 {
+		return 0, nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries, err := os.ReadDir(q.failedDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read failed directory: %w", err)
+	}
+
+	cleaned := 0
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(q.failedDir, entry.Name())
+		var d Delivery
+		if err := readJSON(path, &d); err != nil {
+			logger.Error("Events: Failed to read failed webhook delivery", "file", entry.Name(), "error", err)
+			continue
+		}
+		if time.Since(d.LastAttempt) < retention {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logger.Error("Events: Failed to delete failed webhook delivery", "id", d.ID, "error", err)
+			continue
+		}
+		cleaned++
+	}
+
+	if cleaned > 0 {
+		logger.Info("Events: Cleaned up failed webhook deliveries", "cleaned", cleaned, "retention", retention)
+	}
+	return cleaned, nil
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeJSONAtomic writes v to a temporary file and renames it into place, so
+// readers never see a partially written delivery.
+func writeJSONAtomic(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
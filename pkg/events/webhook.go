@@ -0,0 +1,332 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/metrics"
+)
+
+// maxDuePerWorker bounds how many queue entries one scan loads per worker.
+const maxDuePerWorker = 50
+
+// Webhook request headers.
+const (
+	HeaderEvent     = "X-Sora-Event"
+	HeaderDelivery  = "X-Sora-Delivery"
+	HeaderSignature = "X-Sora-Signature"
+)
+
+// SubscriptionStore lists webhook subscriptions. It is implemented by
+// *resilient.ResilientDatabase.
+type SubscriptionStore interface {
+	ListEventSubscriptionsWithRetry(ctx context.Context) ([]db.EventSubscription, error)
+}
+
+// WebhookConfig holds the delivery settings of a WebhookSink.
+type WebhookConfig struct {
+	Timeout         time.Duration
+	Concurrency     int
+	WorkerInterval  time.Duration
+	RefreshInterval time.Duration
+	FailedRetention time.Duration
+}
+
+// WebhookSink queues a delivery for every subscription matching an event and
+// POSTs the queued deliveries in the background, retrying failures.
+type WebhookSink struct {
+	store  SubscriptionStore
+	queue  *Queue
+	client *http.Client
+	cfg    WebhookConfig
+
+	mu     sync.RWMutex
+	subs   map[int64]db.EventSubscription
+	loaded bool // Subscriptions have been loaded at least once
+
+	lastCleanup time.Time
+	stopCh      chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewWebhookSink creates a webhook sink. Subscriptions are loaded when the
+// sink is started.
+func NewWebhookSink(store SubscriptionStore, queue *Queue, cfg WebhookConfig) *WebhookSink {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	return &WebhookSink{
+		store:  store,
+		queue:  queue,
+		client: &http.Client{Timeout: cfg.Timeout},
+		cfg:    cfg,
+		subs:   make(map[int64]db.EventSubscription),
+		stopCh: make(chan struct{}),
+	}
+}
+
+func (w *WebhookSink) Name() string { return "webhook" }
+
+// Write queues one delivery per matching subscription.
+func (w *WebhookSink) Write(_ context.Context, ev Event) error {
+	var payload []byte
+	for _, sub := range w.matching(ev) {
+		if payload == nil {
+			var err error
+			if payload, err = json.Marshal(ev); err != nil {
+				return fmt.Errorf("failed to encode event: %w", err)
+			}
+		}
+		if err := w.queue.Enqueue(sub.ID, ev.Type, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *WebhookSink) matching(ev Event) []db.EventSubscription {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	var matched []db.EventSubscription
+	for _, sub := range w.subs {
+		if Matches(sub, ev) {
+			matched = append(matched, sub)
+		}
+	}
+	return matched
+}
+
+// Matches reports whether a subscription wants an event: it must be enabled,
+// list the event type (or no types at all), and be scoped to the event's
+// account, the event's domain, or everything.
+func Matches(sub db.EventSubscription, ev Event) bool {
+	if !sub.Enabled {
+		return false
+	}
+	if len(sub.EventTypes) > 0 && !slices.Contains(sub.EventTypes, string(ev.Type)) {
+		return false
+	}
+	switch {
+	case sub.AccountID != nil:
+		return ev.AccountID != 0 && *sub.AccountID == ev.AccountID
+	case sub.Domain != "":
+		return sub.Domain == ev.Domain()
+	default:
+		return true
+	}
+}
+
+// Start loads the subscriptions and starts the refresh and delivery loops.
+func (w *WebhookSink) Start(ctx context.Context) {
+	if err := w.refresh(ctx); err != nil {
+		logger.Warn("Events: Failed to load webhook subscriptions", "error", err)
+	}
+
+	w.wg.Add(2)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.cfg.RefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.stopCh:
+				return
+			case <-ticker.C:
+				if err := w.refresh(ctx); err != nil {
+					logger.Warn("Events: Failed to refresh webhook subscriptions", "error", err)
+				}
+			}
+		}
+	}()
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.cfg.WorkerInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.stopCh:
+				return
+			case <-ticker.C:
+				w.processQueue(ctx)
+			}
+		}
+	}()
+
+	logger.Info("Events: Webhook delivery started", "queue", w.queue.basePath, "concurrency", w.cfg.Concurrency)
+}
+
+// Stop stops the background loops and waits for in-flight deliveries.
+func (w *WebhookSink) Stop() {
+	close(w.stopCh)
+	w.wg.Wait()
+}
+
+func (w *WebhookSink) refresh(ctx context.Context) error {
+	subs, err := w.store.ListEventSubscriptionsWithRetry(ctx)
+	if err != nil {
+		return err
+	}
+	m := make(map[int64]db.EventSubscription, len(subs))
+	for _, sub := range subs {
+		m[sub.ID] = sub
+	}
+
+	w.mu.Lock()
+	w.subs = m
+	w.loaded = true
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *WebhookSink) isLoaded() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.loaded
+}
+
+func (w *WebhookSink) subscription(id int64) (db.EventSubscription, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	sub, ok := w.subs[id]
+	return sub, ok
+}
+
+// processQueue delivers every due queue entry, up to the configured
+// concurrency, and returns once all of them have been attempted.
+func (w *WebhookSink) processQueue(ctx context.Context) {
+	if time.Since(w.lastCleanup) > time.Hour {
+		w.lastCleanup = time.Now()
+		if _, err := w.queue.CleanupFailed(w.cfg.FailedRetention); err != nil {
+			logger.Warn("Events: Failed to clean up failed webhook deliveries", "error", err)
+		}
+	}
+
+	// Without the subscription list every delivery would look orphaned
+	if !w.isLoaded() {
+		return
+	}
+
+	due, err := w.queue.Due(time.Now(), w.cfg.Concurrency*maxDuePerWorker)
+	if err != nil {
+		logger.Warn("Events: Failed to scan webhook queue", "error", err)
+		return
+	}
+
+	sem := make(chan struct{}, w.cfg.Concurrency)
+	var wg sync.WaitGroup
+	for _, d := range due {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(d Delivery) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			w.deliver(ctx, d)
+		}(d)
+	}
+	wg.Wait()
+}
+
+// deliver POSTs one delivery and records the outcome in the queue.
+func (w *WebhookSink) deliver(ctx context.Context, d Delivery) {
+	sub, ok := w.subscription(d.SubscriptionID)
+	if !ok || !sub.Enabled {
+		// The subscription was deleted or disabled after the event was queued
+		metrics.EventWebhookDeliveries.WithLabelValues("dropped").Inc()
+		if err := w.queue.Remove(d.ID); err != nil {
+			logger.Warn("Events: Failed to remove webhook delivery", "id", d.ID, "error", err)
+		}
+		return
+	}
+
+	permanent, err := w.post(ctx, sub, d)
+	if err == nil {
+		metrics.EventWebhookDeliveries.WithLabelValues("success").Inc()
+		if err := w.queue.Remove(d.ID); err != nil {
+			logger.Warn("Events: Failed to remove webhook delivery", "id", d.ID, "error", err)
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		// Shutting down; the delivery stays queued for the next start
+		return
+	}
+
+	failed, qerr := w.queue.MarkFailure(d.ID, err.Error(), permanent)
+	if qerr != nil {
+		logger.Warn("Events: Failed to update webhook delivery", "id", d.ID, "error", qerr)
+	}
+	if failed {
+		metrics.EventWebhookDeliveries.WithLabelValues("failed").Inc()
+		logger.Warn("Events: Webhook delivery failed permanently", "id", d.ID, "subscription_id", sub.ID, "url", sub.URL, "error", err)
+	} else {
+		metrics.EventWebhookDeliveries.WithLabelValues("retry").Inc()
+		logger.Debug("Events: Webhook delivery failed, will retry", "id", d.ID, "subscription_id", sub.ID, "error", err)
+	}
+}
+
+// post sends the request. A 2xx response is success; other 4xx responses
+// except 408 and 429 are permanent failures that are not retried.
+func (w *WebhookSink) post(ctx context.Context, sub db.EventSubscription, d Delivery) (permanent bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return true, fmt.Errorf("invalid request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Sora-Webhook/1.0")
+	req.Header.Set(HeaderEvent, string(d.EventType))
+	req.Header.Set(HeaderDelivery, d.ID)
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, time.Now(), d.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+		return false, fmt.Errorf("HTTP %d", resp.StatusCode)
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return true, fmt.Errorf("HTTP %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+}
+
+// Sign returns the X-Sora-Signature header value for a payload:
+// "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<payload>">". Receivers
+// recompute the HMAC with the shared secret and reject stale timestamps.
+func Sign(secret string, t time.Time, payload []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,216 @@
+package events
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/migadu/sora/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	subs []db.EventSubscription
+}
+
+func (f *fakeStore) ListEventSubscriptionsWithRetry(ctx context.Context) ([]db.EventSubscription, error) {
+	return f.subs, nil
+}
+
+func newTestWebhook(t *testing.T, maxAttempts int, subs ...db.EventSubscription) (*WebhookSink, *Queue) {
+	t.Helper()
+	queue, err := NewQueue(t.TempDir(), maxAttempts, []time.Duration{0})
+	require.NoError(t, err)
+	w := NewWebhookSink(&fakeStore{subs: subs}, queue, WebhookConfig{
+		Timeout:         5 * time.Second,
+		Concurrency:     2,
+		WorkerInterval:  time.Hour,
+		RefreshInterval: time.Hour,
+	})
+	require.NoError(t, w.refresh(context.Background()))
+	return w, queue
+}
+
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	return len(entries)
+}
+
+func TestSign(t *testing.T) {
+	payload := []byte(`{"type":"message.appended"}`)
+	ts := time.Unix(1700000000, 0)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1700000000." + string(payload)))
+	expected := "t=1700000000,v1=" + hex.EncodeToString(mac.Sum(nil))
+
+	assert.Equal(t, expected, Sign("secret", ts, payload))
+	assert.NotEqual(t, expected, Sign("other", ts, payload))
+}
+
+func TestMatches(t *testing.T) {
+	accountID := int64(42)
+	ev := Event{Type: MessageAppended, AccountID: 42, Email: "user@Example.com"}
+
+	tests := []struct {
+		name string
+		sub  db.EventSubscription
+		want bool
+	}{
+		{"global, all types", db.EventSubscription{Enabled: true}, true},
+		{"disabled", db.EventSubscription{Enabled: false}, false},
+		{"type listed", db.EventSubscription{Enabled: true, EventTypes: []string{"message.appended"}}, true},
+		{"type not listed", db.EventSubscription{Enabled: true, EventTypes: []string{"auth.failed"}}, false},
+		{"same account", db.EventSubscription{Enabled: true, AccountID: &accountID}, true},
+		{"other account", db.EventSubscription{Enabled: true, AccountID: new(int64)}, false},
+		{"same domain", db.EventSubscription{Enabled: true, Domain: "example.com"}, true},
+		{"other domain", db.EventSubscription{Enabled: true, Domain: "example.org"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Matches(tt.sub, ev))
+		})
+	}
+}
+
+func TestWebhookSink_Deliver(t *testing.T) {
+	var mu sync.Mutex
+	var got []*http.Request
+	var bodies [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		got = append(got, r)
+		bodies = append(bodies, body)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	w, queue := newTestWebhook(t, 3,
+		db.EventSubscription{ID: 1, URL: srv.URL, Secret: "s3cret", Enabled: true, EventTypes: []string{"message.appended"}},
+		db.EventSubscription{ID: 2, URL: srv.URL, Secret: "other", Enabled: true, EventTypes: []string{"auth.failed"}},
+	)
+
+	ev := Event{ID: "ev-1", Type: MessageAppended, AccountID: 7, Email: "user@example.com", UIDs: []uint32{5}}
+	require.NoError(t, w.Write(context.Background(), ev))
+	assert.Equal(t, 1, countFiles(t, queue.pendingDir), "only the matching subscription gets a delivery")
+
+	w.processQueue(context.Background())
+
+	require.Len(t, got, 1)
+	r := got[0]
+	assert.Equal(t, "message.appended", r.Header.Get(HeaderEvent))
+	assert.NotEmpty(t, r.Header.Get(HeaderDelivery))
+
+	sig := r.Header.Get(HeaderSignature)
+	ts, _, ok := strings.Cut(strings.TrimPrefix(sig, "t="), ",")
+	require.True(t, ok)
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, Sign("s3cret", time.Unix(unix, 0), bodies[0]), sig)
+
+	var decoded Event
+	require.NoError(t, json.Unmarshal(bodies[0], &decoded))
+	assert.Equal(t, ev.ID, decoded.ID)
+	assert.Equal(t, []uint32{5}, decoded.UIDs)
+
+	assert.Equal(t, 0, countFiles(t, queue.pendingDir), "delivered entries are removed")
+}
+
+func TestWebhookSink_RetryThenFail(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	w, queue := newTestWebhook(t, 2, db.EventSubscription{ID: 1, URL: srv.URL, Secret: "s", Enabled: true})
+	require.NoError(t, w.Write(context.Background(), Event{ID: "ev-1", Type: FlagsChanged}))
+
+	w.processQueue(context.Background())
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, 1, countFiles(t, queue.pendingDir), "5xx is retried")
+
+	w.processQueue(context.Background())
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, 0, countFiles(t, queue.pendingDir))
+	assert.Equal(t, 1, countFiles(t, queue.failedDir), "exhausted deliveries move to failed")
+
+	entries, err := os.ReadDir(queue.failedDir)
+	require.NoError(t, err)
+	var d Delivery
+	require.NoError(t, readJSON(filepath.Join(queue.failedDir, entries[0].Name()), &d))
+	assert.Equal(t, 2, d.Attempts)
+	assert.Len(t, d.Errors, 2)
+}
+
+func TestWebhookSink_PermanentFailure(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer srv.Close()
+
+	w, queue := newTestWebhook(t, 10, db.EventSubscription{ID: 1, URL: srv.URL, Secret: "s", Enabled: true})
+	require.NoError(t, w.Write(context.Background(), Event{ID: "ev-1", Type: MessageExpunged}))
+
+	w.processQueue(context.Background())
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, 0, countFiles(t, queue.pendingDir))
+	assert.Equal(t, 1, countFiles(t, queue.failedDir), "4xx is not retried")
+}
+
+func TestWebhookSink_DropsOrphanedDeliveries(t *testing.T) {
+	w, queue := newTestWebhook(t, 10)
+
+	require.NoError(t, queue.Enqueue(99, MailboxCreated, []byte(`{}`)))
+	w.processQueue(context.Background())
+
+	assert.Equal(t, 0, countFiles(t, queue.pendingDir), "deliveries of deleted subscriptions are dropped")
+	assert.Equal(t, 0, countFiles(t, queue.failedDir))
+}
+
+func TestQueue_CleanupFailed(t *testing.T) {
+	queue, err := NewQueue(t.TempDir(), 1, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, queue.Enqueue(1, AuthFailed, []byte(`{}`)))
+	due, err := queue.Due(time.Now(), 0)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+
+	failed, err := queue.MarkFailure(due[0].ID, "boom", false)
+	require.NoError(t, err)
+	assert.True(t, failed)
+
+	cleaned, err := queue.CleanupFailed(0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, cleaned, "retention 0 keeps failed deliveries")
+
+	cleaned, err = queue.CleanupFailed(time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 0, cleaned)
+
+	cleaned, err = queue.CleanupFailed(time.Nanosecond)
+	require.NoError(t, err)
+	assert.Equal(t, 1, cleaned)
+}
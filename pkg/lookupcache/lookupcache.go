@@ -262,6 +262,23 @@ func (c *LookupCache) Invalidate(address string) {
 	metrics.LookupCacheEntriesTotal.Set(float64(len(c.entries)))
 }
 
+// InvalidateAccount removes all entries of an account (e.g., after it was
+// suspended), whatever address they are cached under.
+func (c *LookupCache) InvalidateAccount(accountID int64) {
+	if accountID <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, entry := range c.entries {
+		if entry.AccountID == accountID {
+			delete(c.entries, key)
+		}
+	}
+	metrics.LookupCacheEntriesTotal.Set(float64(len(c.entries)))
+}
+
 // evictOldest removes the oldest entry from the cache
 // Caller must hold the write lock
 func (c *LookupCache) evictOldest() {
@@ -0,0 +1,336 @@
+// Package mbox reads and writes mailboxes in the mboxrd format: messages are
+// preceded by a "From sender date" line, and lines of the message matching
+// ">*From " are escaped with one more '>'.
+//
+// IMAP flags are kept in the Status, X-Status and X-Keywords headers, as
+// mutt, Thunderbird and Dovecot do. The writer adds these headers and the
+// reader removes them again, so a message read back is identical to the one
+// written, apart from line endings.
+//
+// # Usage
+//
+//	w := mbox.NewWriter(out)
+//	w.Write(&mbox.Message{From: "alice@example.com", Date: date, Flags: flags, Data: raw})
+//	w.Flush()
+//
+//	r := mbox.NewReader(in)
+//	for {
+//		msg, err := r.Next()
+//		if err == io.EOF {
+//			break
+//		}
+//		...
+//	}
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// dateLayout is the asctime date of the From line.
+const dateLayout = "Mon Jan _2 15:04:05 2006"
+
+// defaultSender is used in the From line when the sender is not known.
+const defaultSender = "MAILER-DAEMON"
+
+var (
+	// ErrNotMbox is returned when the input does not start with a From line.
+	ErrNotMbox = errors.New("not an mbox file")
+	// ErrMessageTooLarge is returned by Reader.Next for a message larger
+	// than Reader.MaxMessageSize. The reader skips it and can continue.
+	ErrMessageTooLarge = errors.New("message too large")
+)
+
+// Message is a message of an mbox file.
+type Message struct {
+	From   string      // Envelope sender of the From line
+	Date   time.Time   // Date of the From line, used as internal date
+	Flags  []imap.Flag // Flags from the Status, X-Status and X-Keywords headers
+	Data   []byte      // The message, with CRLF line endings when read
+	Offset int64       // Offset of the From line in the input, set when read
+}
+
+// Writer writes messages to an mbox file.
+type Writer struct {
+	w *bufio.Writer
+}
+
+// NewWriter returns a Writer writing to w. Flush must be called after the
+// last message.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Write appends a message. Lines are written with LF endings.
+func (w *Writer) Write(m *Message) error {
+	from := m.From
+	if from == "" || strings.ContainsAny(from, " \t\r\n") {
+		from = defaultSender
+	}
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	if _, err := fmt.Fprintf(w.w, "From %s %s\n", from, date.UTC().Format(dateLayout)); err != nil {
+		return err
+	}
+	for _, line := range statusHeaders(m.Flags) {
+		if _, err := w.w.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+
+	data := m.Data
+	for len(data) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			line, data = data, nil
+		}
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if isFromLine(bytes.TrimLeft(line, ">")) {
+			if err := w.w.WriteByte('>'); err != nil {
+				return err
+			}
+		}
+		if _, err := w.w.Write(line); err != nil {
+			return err
+		}
+		if err := w.w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	// A blank line separates messages
+	return w.w.WriteByte('\n')
+}
+
+// Flush writes buffered data to the underlying writer.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Reader reads messages from an mbox file.
+type Reader struct {
+	// MaxMessageSize limits the size of a message; 0 means no limit.
+	MaxMessageSize int64
+
+	r          *bufio.Reader
+	started    bool
+	from       []byte // From line of the next message
+	fromOffset int64  // Offset of the From line of the next message
+	pos        int64  // Bytes read so far
+	done       bool
+}
+
+// NewReader returns a Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// Next returns the next message, or io.EOF after the last one.
+func (r *Reader) Next() (*Message, error) {
+	if !r.started {
+		r.started = true
+		if err := r.readFirstFromLine(); err != nil {
+			return nil, err
+		}
+	}
+	if r.done {
+		return nil, io.EOF
+	}
+
+	msg := parseFromLine(r.from)
+	msg.Offset = r.fromOffset
+	var data bytes.Buffer
+	var size int64
+	tooLarge := false
+	inHeader := true
+	pendingBlank := false
+
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(line) == 0 && err == io.EOF {
+			r.done = true
+			break
+		}
+		lineOffset := r.pos
+		r.pos += int64(len(line))
+		line = bytes.TrimRight(line, "\r\n")
+
+		if isFromLine(line) {
+			r.from = line
+			r.fromOffset = lineOffset
+			break
+		}
+		if err == io.EOF {
+			r.done = true
+		}
+
+		// The blank line before a From line separates messages and is not
+		// part of the message, so blank lines are only written once the
+		// next line is known
+		if pendingBlank {
+			data.WriteString("\r\n")
+			pendingBlank = false
+		}
+		if len(line) == 0 {
+			inHeader = false
+			pendingBlank = true
+		} else if inHeader && parseStatusHeader(msg, line) {
+			// Flags are kept in the message itself, not in its data
+		} else {
+			if line[0] == '>' && isFromLine(bytes.TrimLeft(line, ">")) {
+				line = line[1:]
+			}
+			size += int64(len(line)) + 2
+			if r.MaxMessageSize > 0 && size > r.MaxMessageSize {
+				tooLarge = true
+			}
+			if !tooLarge {
+				data.Write(line)
+				data.WriteString("\r\n")
+			}
+		}
+		if r.done {
+			break
+		}
+	}
+
+	if tooLarge {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrMessageTooLarge, r.MaxMessageSize)
+	}
+	msg.Data = data.Bytes()
+	return msg, nil
+}
+
+// readFirstFromLine skips leading blank lines and reads the From line of
+// the first message.
+func (r *Reader) readFirstFromLine() error {
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		lineOffset := r.pos
+		r.pos += int64(len(line))
+		trimmed := bytes.TrimRight(line, "\r\n")
+		if isFromLine(trimmed) {
+			r.from = trimmed
+			r.fromOffset = lineOffset
+			return nil
+		}
+		if len(trimmed) > 0 {
+			return ErrNotMbox
+		}
+		if err == io.EOF {
+			// An empty file has no messages
+			r.done = true
+			return nil
+		}
+	}
+}
+
+func isFromLine(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("From "))
+}
+
+// parseFromLine returns a message with the sender and date of a From line.
+// A date that cannot be parsed is left zero.
+func parseFromLine(line []byte) *Message {
+	fields := strings.Fields(strings.TrimPrefix(string(line), "From "))
+	msg := &Message{}
+	if len(fields) == 0 {
+		return msg
+	}
+	msg.From = fields[0]
+	date := strings.Join(fields[1:], " ")
+	for _, layout := range []string{dateLayout, "Mon Jan _2 15:04:05 MST 2006", "Mon Jan _2 15:04:05 -0700 2006"} {
+		if t, err := time.Parse(layout, date); err == nil {
+			msg.Date = t
+			break
+		}
+	}
+	return msg
+}
+
+// statusHeaders returns the header lines storing flags.
+func statusHeaders(flags []imap.Flag) []string {
+	var status, xStatus string
+	var keywords []string
+	for _, flag := range flags {
+		switch flag {
+		case imap.FlagSeen:
+			status += "R"
+		case imap.FlagAnswered:
+			xStatus += "A"
+		case imap.FlagFlagged:
+			xStatus += "F"
+		case imap.FlagDeleted:
+			xStatus += "D"
+		case imap.FlagDraft:
+			xStatus += "T"
+		default:
+			if !strings.HasPrefix(string(flag), "\\") {
+				keywords = append(keywords, string(flag))
+			}
+		}
+	}
+
+	// O marks messages that are not new, which imported mail never is
+	lines := []string{"Status: " + status + "O"}
+	if xStatus != "" {
+		lines = append(lines, "X-Status: "+xStatus)
+	}
+	if len(keywords) > 0 {
+		lines = append(lines, "X-Keywords: "+strings.Join(keywords, " "))
+	}
+	return lines
+}
+
+// parseStatusHeader adds the flags of a Status, X-Status or X-Keywords
+// header line to msg. It reports whether line was such a header.
+func parseStatusHeader(msg *Message, line []byte) bool {
+	name, value, ok := strings.Cut(string(line), ":")
+	if !ok {
+		return false
+	}
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(name) {
+	case "status":
+		if strings.Contains(value, "R") {
+			msg.Flags = append(msg.Flags, imap.FlagSeen)
+		}
+	case "x-status":
+		for _, c := range value {
+			switch c {
+			case 'A':
+				msg.Flags = append(msg.Flags, imap.FlagAnswered)
+			case 'F':
+				msg.Flags = append(msg.Flags, imap.FlagFlagged)
+			case 'D':
+				msg.Flags = append(msg.Flags, imap.FlagDeleted)
+			case 'T':
+				msg.Flags = append(msg.Flags, imap.FlagDraft)
+			}
+		}
+	case "x-keywords":
+		for _, keyword := range strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ',' }) {
+			msg.Flags = append(msg.Flags, imap.Flag(keyword))
+		}
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,154 @@
+package mbox
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func readAll(t *testing.T, r *Reader) []*Message {
+	t.Helper()
+	var msgs []*Message
+	for {
+		msg, err := r.Next()
+		if err == io.EOF {
+			return msgs
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	date := time.Date(2024, 3, 5, 10, 30, 0, 0, time.UTC)
+	written := []*Message{
+		{
+			From:  "alice@example.com",
+			Date:  date,
+			Flags: []imap.Flag{imap.FlagSeen, imap.FlagFlagged, "$Label1"},
+			Data:  []byte("Subject: one\r\n\r\nFrom the start\r\n>From quoted\r\n\r\n"),
+		},
+		{
+			Date: date.Add(time.Hour),
+			Data: []byte("Subject: two\r\n\r\nbody"),
+		},
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, m := range written {
+		if err := w.Write(m); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "\n>From the start\n>>From quoted\n") {
+		t.Errorf("From lines not escaped:\n%s", out)
+	}
+	if !strings.HasPrefix(out, "From alice@example.com Tue Mar  5 10:30:00 2024\n") {
+		t.Errorf("unexpected From line:\n%s", out)
+	}
+
+	read := readAll(t, NewReader(&buf))
+	if len(read) != 2 {
+		t.Fatalf("read %d messages, want 2", len(read))
+	}
+	if got, want := string(read[0].Data), string(written[0].Data); got != want {
+		t.Errorf("message 1 data = %q, want %q", got, want)
+	}
+	if got, want := string(read[1].Data), "Subject: two\r\n\r\nbody\r\n"; got != want {
+		t.Errorf("message 2 data = %q, want %q", got, want)
+	}
+	if read[0].From != "alice@example.com" || read[1].From != defaultSender {
+		t.Errorf("senders = %q, %q", read[0].From, read[1].From)
+	}
+	if !read[0].Date.Equal(date) || !read[1].Date.Equal(date.Add(time.Hour)) {
+		t.Errorf("dates = %v, %v", read[0].Date, read[1].Date)
+	}
+	for _, flag := range written[0].Flags {
+		if !slices.Contains(read[0].Flags, flag) {
+			t.Errorf("flag %s lost, got %v", flag, read[0].Flags)
+		}
+	}
+	if len(read[1].Flags) != 0 {
+		t.Errorf("message 2 flags = %v, want none", read[1].Flags)
+	}
+}
+
+func TestReaderForeignMbox(t *testing.T) {
+	// LF line endings, mutt status headers and no blank line at the end
+	in := "\nFrom bob@example.com Thu Jan  1 00:00:00 2015\n" +
+		"Subject: hello\nStatus: RO\nX-Status: A\n\nhi\n\n" +
+		"From MAILER-DAEMON Fri Jan  2 00:00:00 2015\n" +
+		"Subject: second\n\nlast"
+
+	msgs := readAll(t, NewReader(strings.NewReader(in)))
+	if len(msgs) != 2 {
+		t.Fatalf("read %d messages, want 2", len(msgs))
+	}
+	if got := string(msgs[0].Data); got != "Subject: hello\r\n\r\nhi\r\n" {
+		t.Errorf("message 1 data = %q", got)
+	}
+	if !slices.Equal(msgs[0].Flags, []imap.Flag{imap.FlagSeen, imap.FlagAnswered}) {
+		t.Errorf("message 1 flags = %v", msgs[0].Flags)
+	}
+	if got := string(msgs[1].Data); got != "Subject: second\r\n\r\nlast\r\n" {
+		t.Errorf("message 2 data = %q", got)
+	}
+
+	// Offsets point at the From lines, so a message can be read on its own
+	if msgs[0].Offset != 1 {
+		t.Errorf("message 1 offset = %d, want 1", msgs[0].Offset)
+	}
+	if want := int64(strings.Index(in, "From MAILER-DAEMON")); msgs[1].Offset != want {
+		t.Errorf("message 2 offset = %d, want %d", msgs[1].Offset, want)
+	}
+	msg, err := NewReader(strings.NewReader(in[msgs[1].Offset:])).Next()
+	if err != nil {
+		t.Fatalf("Next at offset: %v", err)
+	}
+	if !bytes.Equal(msg.Data, msgs[1].Data) {
+		t.Errorf("message at offset = %q, want %q", msg.Data, msgs[1].Data)
+	}
+}
+
+func TestReaderNotMbox(t *testing.T) {
+	_, err := NewReader(strings.NewReader("Subject: hi\n\nbody\n")).Next()
+	if !errors.Is(err, ErrNotMbox) {
+		t.Errorf("Next = %v, want ErrNotMbox", err)
+	}
+
+	if msgs := readAll(t, NewReader(strings.NewReader(""))); len(msgs) != 0 {
+		t.Errorf("empty file has %d messages", len(msgs))
+	}
+}
+
+func TestReaderMaxMessageSize(t *testing.T) {
+	in := "From a Thu Jan  1 00:00:00 2015\nSubject: big\n\n" + strings.Repeat("x", 100) + "\n\n" +
+		"From b Thu Jan  1 00:00:00 2015\nSubject: small\n\nok\n"
+
+	r := NewReader(strings.NewReader(in))
+	r.MaxMessageSize = 50
+	if _, err := r.Next(); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("Next = %v, want ErrMessageTooLarge", err)
+	}
+	msg, err := r.Next()
+	if err != nil {
+		t.Fatalf("Next after a large message: %v", err)
+	}
+	if msg.From != "b" {
+		t.Errorf("From = %q, want b", msg.From)
+	}
+}
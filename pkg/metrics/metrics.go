@@ -259,6 +259,30 @@ var (
 		[]string{"operation"}, // operation: enqueue, acquire, mark_success, mark_failure
 	)
 
+	// Event stream metrics
+	EventsPublished = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sora_events_published_total",
+			Help: "Total number of mailbox and authentication events published",
+		},
+		[]string{"type"},
+	)
+
+	EventsDropped = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "sora_events_dropped_total",
+			Help: "Total number of events dropped because the event buffer was full",
+		},
+	)
+
+	EventWebhookDeliveries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sora_event_webhook_deliveries_total",
+			Help: "Total number of webhook delivery attempts",
+		},
+		[]string{"result"}, // result: success, retry, failed, dropped
+	)
+
 	// IMAP-specific
 	IMAPIdleConnections = promauto.NewGauge(
 		prometheus.GaugeOpts{
@@ -267,6 +291,29 @@ var (
 		},
 	)
 
+	IMAPIdleWakeups = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sora_imap_idle_wakeups_total",
+			Help: "Total number of IDLE polls by trigger (push, poll)",
+		},
+		[]string{"trigger"},
+	)
+
+	// Mailbox change notifications
+	MailboxChangeSignals = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "sora_mailbox_change_signals_total",
+			Help: "Total number of mailbox change signals received from the database",
+		},
+	)
+
+	MailboxNotifierListening = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "sora_mailbox_notifier_listening",
+			Help: "Whether the mailbox change listener is connected (1) or IDLE falls back to polling (0)",
+		},
+	)
+
 	// ManageSieve-specific
 	ManageSieveScriptsUploaded = promauto.NewCounter(
 		prometheus.CounterOpts{
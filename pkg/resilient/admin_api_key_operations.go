@@ -0,0 +1,81 @@
+package resilient
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+)
+
+// --- Admin API Key Wrappers ---
+
+type adminAPIKeyResult struct {
+	key    *db.AdminAPIKey
+	secret string
+}
+
+// CreateAdminAPIKeyWithRetry generates a new admin API key and returns it
+// together with its secret.
+func (rd *ResilientDatabase) CreateAdminAPIKeyWithRetry(ctx context.Context, key db.AdminAPIKey) (*db.AdminAPIKey, string, error) {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		created, secret, err := rd.getOperationalDatabaseForOperation(true).CreateAdminAPIKey(ctx, tx, key)
+		if err != nil {
+			return nil, err
+		}
+		return adminAPIKeyResult{key: created, secret: secret}, nil
+	}
+	result, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op,
+		consts.ErrDBUniqueViolation, consts.ErrInvalidInput)
+	if err != nil {
+		return nil, "", err
+	}
+	created := result.(adminAPIKeyResult)
+	return created.key, created.secret, nil
+}
+
+func (rd *ResilientDatabase) ListAdminAPIKeysWithRetry(ctx context.Context) ([]db.AdminAPIKey, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).ListAdminAPIKeys(ctx)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]db.AdminAPIKey), nil
+}
+
+func (rd *ResilientDatabase) GetAdminAPIKeyBySecretWithRetry(ctx context.Context, secret string) (*db.AdminAPIKey, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetAdminAPIKeyBySecret(ctx, secret)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op, consts.ErrDBNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*db.AdminAPIKey), nil
+}
+
+func (rd *ResilientDatabase) DeleteAdminAPIKeyWithRetry(ctx context.Context, id int64) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(true).DeleteAdminAPIKey(ctx, tx, id)
+	}
+	_, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op, consts.ErrDBNotFound)
+	return err
+}
+
+// RecordAdminAPIKeyUse stores the last use of an admin API key in the
+// background. Failures are only logged: they must not fail the request.
+func (rd *ResilientDatabase) RecordAdminAPIKeyUse(id int64) {
+	go func() {
+		ctx, cancel := rd.withTimeout(context.Background(), timeoutWrite)
+		defer cancel()
+		op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+			return nil, rd.getOperationalDatabaseForOperation(true).RecordAdminAPIKeyUse(ctx, tx, id)
+		}
+		if _, err := rd.executeWriteInTxWithRetry(ctx, writeRetryConfig, timeoutWrite, op); err != nil {
+			logger.Warn("Failed to record admin API key use", "api_key_id", id, "error", err)
+		}
+	}()
+}
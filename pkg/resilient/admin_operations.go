@@ -161,6 +161,30 @@ func (rd *ResilientDatabase) RestoreAccountWithRetry(ctx context.Context, email
 	return err
 }
 
+func (rd *ResilientDatabase) SetAccountStatusWithRetry(ctx context.Context, email string, status db.AccountStatus) (int64, error) {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return rd.getOperationalDatabaseForOperation(true).SetAccountStatus(ctx, tx, email, status)
+	}
+	result, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op, consts.ErrUserNotFound, consts.ErrInvalidInput)
+	if err != nil {
+		return 0, err
+	}
+	return result.(int64), nil
+}
+
+// GetAccountStatusWithRetry returns the effective status of an account. It is
+// used on authenticated request paths, so it uses the read timeouts.
+func (rd *ResilientDatabase) GetAccountStatusWithRetry(ctx context.Context, accountID int64) (*db.AccountStatus, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetAccountStatus(ctx, accountID)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op, consts.ErrUserNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*db.AccountStatus), nil
+}
+
 func (rd *ResilientDatabase) CleanupFailedUploadsWithRetry(ctx context.Context, gracePeriod time.Duration) (int64, error) {
 	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
 		return rd.getOperationalDatabaseForOperation(true).CleanupFailedUploads(ctx, tx, gracePeriod)
@@ -226,6 +250,17 @@ func (rd *ResilientDatabase) CleanupOldVacationResponsesWithRetry(ctx context.Co
 	return result.(int64), nil
 }
 
+func (rd *ResilientDatabase) CleanupOldMailboxTombstonesWithRetry(ctx context.Context, gracePeriod time.Duration) (int64, error) {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return rd.getOperationalDatabaseForOperation(true).CleanupOldMailboxTombstones(ctx, tx, gracePeriod)
+	}
+	result, err := rd.executeWriteInTxWithRetry(ctx, cleanupRetryConfig, timeoutWrite, op)
+	if err != nil {
+		return 0, err
+	}
+	return result.(int64), nil
+}
+
 func (rd *ResilientDatabase) CleanupOldHealthStatusesWithRetry(ctx context.Context, retention time.Duration) (int64, error) {
 	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
 		return rd.getOperationalDatabaseForOperation(true).CleanupOldHealthStatuses(ctx, tx, retention)
@@ -0,0 +1,87 @@
+package resilient
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+)
+
+// --- App Password Wrappers ---
+
+type appPasswordResult struct {
+	appPassword *db.AppPassword
+	secret      string
+}
+
+// CreateAppPasswordWithRetry generates a new app password for an account and
+// returns it together with its secret.
+func (rd *ResilientDatabase) CreateAppPasswordWithRetry(ctx context.Context, accountID int64, appPassword db.AppPassword) (*db.AppPassword, string, error) {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		created, secret, err := rd.getOperationalDatabaseForOperation(true).CreateAppPassword(ctx, tx, accountID, appPassword)
+		if err != nil {
+			return nil, err
+		}
+		return appPasswordResult{appPassword: created, secret: secret}, nil
+	}
+	result, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op,
+		consts.ErrDBUniqueViolation, consts.ErrInvalidInput, consts.ErrUserNotFound)
+	if err != nil {
+		return nil, "", err
+	}
+	created := result.(appPasswordResult)
+	return created.appPassword, created.secret, nil
+}
+
+func (rd *ResilientDatabase) ListAppPasswordsWithRetry(ctx context.Context, accountID int64) ([]db.AppPassword, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).ListAppPasswords(ctx, accountID)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]db.AppPassword), nil
+}
+
+func (rd *ResilientDatabase) AppPasswordExistsWithRetry(ctx context.Context, accountID, id int64) (bool, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).AppPasswordExists(ctx, accountID, id)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op)
+	if err != nil {
+		return false, err
+	}
+	return result.(bool), nil
+}
+
+// DeleteAppPasswordWithRetry revokes an app password and drops the cached
+// credentials of the account so that the proxies of this node stop accepting
+// it. Other nodes drop theirs when the account's sessions are kicked.
+func (rd *ResilientDatabase) DeleteAppPasswordWithRetry(ctx context.Context, accountID, id int64) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(true).DeleteAppPassword(ctx, tx, accountID, id)
+	}
+	if _, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op, consts.ErrDBNotFound); err != nil {
+		return err
+	}
+	rd.InvalidateAuthCacheForAccount(ctx, accountID)
+	return nil
+}
+
+// RecordAppPasswordUse stores the last use of an app password in the
+// background. Failures are only logged: they must not fail the login.
+func (rd *ResilientDatabase) RecordAppPasswordUse(appPasswordID int64, remoteIP string) {
+	go func() {
+		ctx, cancel := rd.withTimeout(context.Background(), timeoutWrite)
+		defer cancel()
+		op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+			return nil, rd.getOperationalDatabaseForOperation(true).RecordAppPasswordUse(ctx, tx, appPasswordID, remoteIP)
+		}
+		if _, err := rd.executeWriteInTxWithRetry(ctx, writeRetryConfig, timeoutWrite, op); err != nil {
+			logger.Warn("Failed to record app password use", "app_password_id", appPasswordID, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,32 @@
+package resilient
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/db"
+)
+
+// --- Admin Audit Log Wrappers ---
+
+func (rd *ResilientDatabase) InsertAdminAuditEntryWithRetry(ctx context.Context, entry db.AdminAuditEntry) (int64, error) {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return rd.getOperationalDatabaseForOperation(true).InsertAdminAuditEntry(ctx, tx, entry)
+	}
+	result, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op)
+	if err != nil {
+		return 0, err
+	}
+	return result.(int64), nil
+}
+
+func (rd *ResilientDatabase) ListAdminAuditEntriesWithRetry(ctx context.Context, filter db.AdminAuditFilter) ([]db.AdminAuditEntry, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).ListAdminAuditEntries(ctx, filter)
+	}
+	result, err := rd.executeReadWithRetry(ctx, adminRetryConfig, timeoutAdmin, op)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]db.AdminAuditEntry), nil
+}
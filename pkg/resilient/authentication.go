@@ -6,9 +6,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/migadu/sora/authcache"
 	"github.com/migadu/sora/consts"
 	"github.com/migadu/sora/db"
 	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/events"
 	"github.com/migadu/sora/pkg/retry"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -17,38 +19,40 @@ var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 )
 
+// authRetryConfig is the retry strategy for credential lookups. Auth retries
+// are limited so that a client is not kept waiting.
+var authRetryConfig = retry.BackoffConfig{
+	InitialInterval: 250 * time.Millisecond,
+	MaxInterval:     2 * time.Second,
+	Multiplier:      1.5,
+	Jitter:          true,
+	MaxRetries:      2,
+	OperationName:   "db_auth_credential",
+}
+
 // GetCredentialForAuthWithRetry retrieves credentials for authentication with retry logic.
-// Used by backend servers (IMAP, POP3, ManageSieve) which have direct database access.
+// It ignores app passwords; logins should use GetAuthCredentialsWithRetry.
 func (rd *ResilientDatabase) GetCredentialForAuthWithRetry(ctx context.Context, address string) (accountID int64, hashedPassword string, err error) {
-	config := retry.BackoffConfig{
-		InitialInterval: 250 * time.Millisecond,
-		MaxInterval:     2 * time.Second,
-		Multiplier:      1.5,
-		Jitter:          true,
-		MaxRetries:      2,
-		OperationName:   "db_auth_credential",
-	}
-
-	type credResult struct {
-		ID   int64
-		Hash string
+	creds, err := rd.GetAuthCredentialsWithRetry(ctx, address)
+	if err != nil {
+		return 0, "", err
 	}
+	return creds.AccountID, creds.HashedPassword, nil
+}
 
+// GetAuthCredentialsWithRetry retrieves the account password and app passwords
+// of an address with retry logic. Used by backend servers (IMAP, POP3,
+// ManageSieve) which have direct database access.
+func (rd *ResilientDatabase) GetAuthCredentialsWithRetry(ctx context.Context, address string) (*db.AuthCredentials, error) {
 	op := func(ctx context.Context) (any, error) {
-		id, hash, dbErr := rd.getOperationalDatabaseForOperation(false).GetCredentialForAuth(ctx, address)
-		if dbErr != nil {
-			return nil, dbErr
-		}
-		return credResult{ID: id, Hash: hash}, nil
+		return rd.getOperationalDatabaseForOperation(false).GetAuthCredentials(ctx, address)
 	}
 
-	result, err := rd.executeReadWithRetry(ctx, config, timeoutAuth, op, consts.ErrUserNotFound)
+	result, err := rd.executeReadWithRetry(ctx, authRetryConfig, timeoutAuth, op, consts.ErrUserNotFound)
 	if err != nil {
-		return 0, "", err
+		return nil, err
 	}
-
-	cred := result.(credResult)
-	return cred.ID, cred.Hash, nil
+	return result.(*db.AuthCredentials), nil
 }
 
 // AuthenticateWithRetry handles the full authentication flow with resilience.
@@ -68,66 +72,42 @@ func (rd *ResilientDatabase) GetCredentialForAuthWithRetry(ctx context.Context,
 //
 // AUTH CACHE BEHAVIOR (when enabled via SetAuthCache):
 //  1. Check the local SQLite cache first (~0.1ms)
-//  2. On cache hit + password matches: return success (no DB round-trip)
-//  3. On cache hit + password mismatch: invalidate stale entry, fall through to DB
+//  2. On cache hit + password or cached app password matches: return success (no DB round-trip)
+//  3. On cache hit + password mismatch: invalidate stale entries, fall through to DB
 //  4. On cache miss: fall through to DB
-//  5. On successful DB auth: cache the credentials for future use
+//  5. On successful DB auth: cache the credentials, or the app password that
+//     was used, for future use
+//
+// APP PASSWORDS: the protocol and client address recorded with
+// events.WithSource decide which app passwords are accepted.
 //
 // This eliminates the "thundering herd" problem on proxy restart where thousands
 // of clients reconnect simultaneously.
 func (rd *ResilientDatabase) AuthenticateWithRetry(ctx context.Context, address, password string) (accountID int64, err error) {
+	defer func() { events.PublishAuth(ctx, address, accountID, err) }()
+
+	protocol, remoteIP := events.SourceFromContext(ctx)
+
 	// --- Step 1: Try persistent auth cache (if enabled) ---
 	// The cache is ONLY populated from successful DB lookups, never from remote lookups.
 	if rd.authCache != nil {
-		cachedAccountID, cachedHash, cacheErr := rd.authCache.Get(ctx, address)
-		if cacheErr == nil {
-			// Cache hit — verify password locally using the cached hash
-			if verifyErr := db.VerifyPassword(cachedHash, password); verifyErr == nil {
-				// Password matches cached hash — no database round-trip needed
-				return cachedAccountID, nil
-			}
-			// Password mismatch — the password may have changed since caching.
-			// Invalidate the stale entry and fall through to the authoritative DB.
-			rd.authCache.Invalidate(ctx, address)
+		if cachedAccountID, ok := rd.authenticateFromCache(ctx, address, password, protocol, remoteIP); ok {
+			return cachedAccountID, nil
 		}
-		// Cache miss or cache error — proceed to PostgreSQL
 	}
 
 	// --- Step 2: Fetch credentials from PostgreSQL ---
-	config := retry.BackoffConfig{
-		InitialInterval: 250 * time.Millisecond,
-		MaxInterval:     2 * time.Second,
-		Multiplier:      1.5,
-		Jitter:          true,
-		MaxRetries:      2, // Auth retries should be limited
-		OperationName:   "db_authenticate",
-	}
-
-	type credResult struct {
-		ID   int64
-		Hash string
-	}
-
-	op := func(ctx context.Context) (any, error) {
-		id, hash, dbErr := rd.getOperationalDatabaseForOperation(false).GetCredentialForAuth(ctx, address)
-		if dbErr != nil {
-			return nil, dbErr
-		}
-		return credResult{ID: id, Hash: hash}, nil
-	}
-
-	result, err := rd.executeReadWithRetry(ctx, config, timeoutAuth, op, consts.ErrUserNotFound)
+	creds, err := rd.GetAuthCredentialsWithRetry(ctx, address)
 	if err != nil {
 		// NOTE: No logging here - let the calling server log with proper context
 		return 0, err // Return error from fetching credentials
 	}
+	accountID = creds.AccountID
+	hashedPassword := creds.HashedPassword
 
-	cred := result.(credResult)
-	accountID = cred.ID
-	hashedPassword := cred.Hash
-
-	// --- Step 3: Verify password ---
-	if err := db.VerifyPassword(hashedPassword, password); err != nil {
+	// --- Step 3: Verify password or app password ---
+	app, err := creds.Verify(password, protocol, remoteIP)
+	if err != nil {
 		// NOTE: No logging here - let the calling server log with proper context
 		// (protocol, server name, cached status, etc)
 		return 0, err // Invalid password
@@ -136,6 +116,23 @@ func (rd *ResilientDatabase) AuthenticateWithRetry(ctx context.Context, address,
 	// NOTE: No logging here - let the calling server log with proper context
 	// Backend servers log with cache=hit/miss, proxy servers log with method and cached status
 
+	if app != nil {
+		rd.RecordAppPasswordUse(app.ID, remoteIP)
+		// Cache the app password that was used; the account password is
+		// neither verified nor rehashed
+		if rd.authCache != nil {
+			cached := authcache.AppPassword{ID: app.ID, AccountID: accountID, HashedPassword: app.HashedPassword, Protocols: app.Protocols, AllowedIPs: app.AllowedIPs}
+			go func() {
+				cacheCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+				defer cancel()
+				if putErr := rd.authCache.PutAppPassword(cacheCtx, address, cached); putErr != nil {
+					logger.Warn("AuthCache: Failed to cache app password", "address", address, "error", putErr)
+				}
+			}()
+		}
+		return accountID, nil
+	}
+
 	// --- Step 4: Cache successful authentication (async, non-blocking) ---
 	if rd.authCache != nil {
 		go func() {
@@ -187,3 +184,37 @@ func (rd *ResilientDatabase) AuthenticateWithRetry(ctx context.Context, address,
 
 	return accountID, nil
 }
+
+// authenticateFromCache verifies password against the account password and
+// the app passwords cached for address. On a mismatch the cached entries are
+// invalidated, since the password may have changed or the app password may
+// have been revoked.
+func (rd *ResilientDatabase) authenticateFromCache(ctx context.Context, address, password, protocol, remoteIP string) (int64, bool) {
+	cachedAccountID, cachedHash, cacheErr := rd.authCache.Get(ctx, address)
+	if cacheErr == nil && db.VerifyPassword(cachedHash, password) == nil {
+		// Password matches cached hash — no database round-trip needed
+		return cachedAccountID, true
+	}
+
+	cachedApps, appErr := rd.authCache.GetAppPasswords(ctx, address)
+	if appErr == nil {
+		creds := db.AuthCredentials{AccountID: cachedApps[0].AccountID}
+		for _, app := range cachedApps {
+			creds.AppPasswords = append(creds.AppPasswords, db.AppPasswordCredential{
+				ID: app.ID, HashedPassword: app.HashedPassword, Protocols: app.Protocols, AllowedIPs: app.AllowedIPs,
+			})
+		}
+		if app, err := creds.Verify(password, protocol, remoteIP); err == nil && app != nil {
+			rd.RecordAppPasswordUse(app.ID, remoteIP)
+			return creds.AccountID, true
+		}
+	}
+
+	if cacheErr == nil || appErr == nil {
+		// Mismatch — invalidate the stale entries and fall through to the
+		// authoritative DB.
+		rd.authCache.Invalidate(ctx, address)
+	}
+	// Cache miss or cache error — proceed to PostgreSQL
+	return 0, false
+}
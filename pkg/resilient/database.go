@@ -94,6 +94,7 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/migadu/sora/authcache"
 	"github.com/migadu/sora/config"
 	"github.com/migadu/sora/consts"
 	"github.com/migadu/sora/db"
@@ -164,10 +165,11 @@ type ResilientDatabase struct {
 }
 
 // authCacheInterface defines the interface for the persistent auth cache.
-// This avoids a direct import cycle with the authcache package.
 type authCacheInterface interface {
 	Get(ctx context.Context, address string) (accountID int64, hashedPassword string, err error)
 	Put(ctx context.Context, address string, accountID int64, hashedPassword string) error
+	GetAppPasswords(ctx context.Context, address string) ([]authcache.AppPassword, error)
+	PutAppPassword(ctx context.Context, address string, app authcache.AppPassword) error
 	Invalidate(ctx context.Context, address string) error
 	InvalidateAccount(ctx context.Context, accountID int64) error
 }
@@ -178,6 +180,18 @@ func (rd *ResilientDatabase) SetAuthCache(cache authCacheInterface) {
 	rd.authCache = cache
 }
 
+// InvalidateAuthCacheForAccount drops the cached credentials of an account so
+// that its next login is checked against the database. It is a no-op when the
+// auth cache is disabled.
+func (rd *ResilientDatabase) InvalidateAuthCacheForAccount(ctx context.Context, accountID int64) {
+	if rd == nil || rd.authCache == nil {
+		return
+	}
+	if err := rd.authCache.InvalidateAccount(ctx, accountID); err != nil {
+		logger.Warn("AuthCache: Failed to invalidate account", "account_id", accountID, "error", err)
+	}
+}
+
 func NewResilientDatabase(ctx context.Context, config *config.DatabaseConfig, enableHealthCheck bool, runMigrations bool) (*ResilientDatabase, error) {
 	return NewResilientDatabaseWithOptions(ctx, config, enableHealthCheck, runMigrations, false)
 }
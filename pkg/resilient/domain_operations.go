@@ -0,0 +1,122 @@
+package resilient
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+)
+
+// --- Domain Wrappers ---
+
+func (rd *ResilientDatabase) CreateDomainWithRetry(ctx context.Context, domain db.Domain) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(true).CreateDomain(ctx, tx, domain)
+	}
+	_, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op, consts.ErrDBUniqueViolation)
+	return err
+}
+
+func (rd *ResilientDatabase) GetDomainWithRetry(ctx context.Context, name string) (*db.Domain, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetDomain(ctx, name)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op, consts.ErrDBNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*db.Domain), nil
+}
+
+func (rd *ResilientDatabase) ListDomainsWithRetry(ctx context.Context) ([]db.Domain, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).ListDomains(ctx)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]db.Domain), nil
+}
+
+func (rd *ResilientDatabase) UpdateDomainWithRetry(ctx context.Context, domain db.Domain) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(true).UpdateDomain(ctx, tx, domain)
+	}
+	_, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op, consts.ErrDBNotFound)
+	return err
+}
+
+func (rd *ResilientDatabase) DeleteDomainWithRetry(ctx context.Context, name string) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(true).DeleteDomain(ctx, tx, name)
+	}
+	_, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op, consts.ErrDBNotFound)
+	return err
+}
+
+// --- Alias Wrappers ---
+
+func (rd *ResilientDatabase) CreateAliasWithRetry(ctx context.Context, alias db.Alias) (int64, error) {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return rd.getOperationalDatabaseForOperation(true).CreateAlias(ctx, tx, alias)
+	}
+	result, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op,
+		consts.ErrDBUniqueViolation, consts.ErrDBNotFound, consts.ErrAccountAlreadyExists)
+	if err != nil {
+		return 0, err
+	}
+	return result.(int64), nil
+}
+
+func (rd *ResilientDatabase) GetAliasWithRetry(ctx context.Context, address string) (*db.Alias, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetAlias(ctx, address)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op, consts.ErrDBNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*db.Alias), nil
+}
+
+func (rd *ResilientDatabase) ListAliasesWithRetry(ctx context.Context, domain string) ([]db.Alias, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).ListAliases(ctx, domain)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]db.Alias), nil
+}
+
+func (rd *ResilientDatabase) UpdateAliasWithRetry(ctx context.Context, alias db.Alias) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(true).UpdateAlias(ctx, tx, alias)
+	}
+	_, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op, consts.ErrDBNotFound)
+	return err
+}
+
+func (rd *ResilientDatabase) DeleteAliasWithRetry(ctx context.Context, address string) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(true).DeleteAlias(ctx, tx, address)
+	}
+	_, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op, consts.ErrDBNotFound)
+	return err
+}
+
+// ResolveAliasWithRetry expands an address through the aliases and catch-all
+// of its domain. Used for recipient lookups, so it uses the read timeouts.
+func (rd *ResilientDatabase) ResolveAliasWithRetry(ctx context.Context, address string) ([]db.AliasTarget, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).ResolveAlias(ctx, address)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op, consts.ErrUserNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]db.AliasTarget), nil
+}
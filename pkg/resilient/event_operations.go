@@ -0,0 +1,153 @@
+package resilient
+
+import (
+	"context"
+	"slices"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/pkg/events"
+)
+
+// --- Event Subscription Wrappers ---
+
+func (rd *ResilientDatabase) CreateEventSubscriptionWithRetry(ctx context.Context, sub db.EventSubscription) (int64, error) {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return rd.getOperationalDatabaseForOperation(true).CreateEventSubscription(ctx, tx, sub)
+	}
+	result, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op)
+	if err != nil {
+		return 0, err
+	}
+	return result.(int64), nil
+}
+
+func (rd *ResilientDatabase) GetEventSubscriptionWithRetry(ctx context.Context, id int64) (*db.EventSubscription, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetEventSubscription(ctx, id)
+	}
+	result, err := rd.executeReadWithRetry(ctx, adminRetryConfig, timeoutAdmin, op, consts.ErrDBNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*db.EventSubscription), nil
+}
+
+func (rd *ResilientDatabase) ListEventSubscriptionsWithRetry(ctx context.Context) ([]db.EventSubscription, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).ListEventSubscriptions(ctx)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]db.EventSubscription), nil
+}
+
+func (rd *ResilientDatabase) UpdateEventSubscriptionWithRetry(ctx context.Context, sub db.EventSubscription) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(true).UpdateEventSubscription(ctx, tx, sub)
+	}
+	_, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op, consts.ErrDBNotFound)
+	return err
+}
+
+func (rd *ResilientDatabase) DeleteEventSubscriptionWithRetry(ctx context.Context, id int64) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(true).DeleteEventSubscription(ctx, tx, id)
+	}
+	_, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op, consts.ErrDBNotFound)
+	return err
+}
+
+// GetMailboxOwnerWithRetry returns the account and name of a mailbox.
+func (rd *ResilientDatabase) GetMailboxOwnerWithRetry(ctx context.Context, mailboxID int64) (int64, string, error) {
+	type owner struct {
+		accountID int64
+		name      string
+	}
+	op := func(ctx context.Context) (any, error) {
+		accountID, name, err := rd.getOperationalDatabaseForOperation(false).GetMailboxOwner(ctx, mailboxID)
+		if err != nil {
+			return nil, err
+		}
+		return owner{accountID: accountID, name: name}, nil
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op, consts.ErrMailboxNotFound)
+	if err != nil {
+		return 0, "", err
+	}
+	o := result.(owner)
+	return o.accountID, o.name, nil
+}
+
+// --- Event Publishing ---
+//
+// Mailbox events are published after the write transaction has committed, so
+// subscribers never see changes that were rolled back.
+
+func publishMessageAppended(options *db.InsertMessageOptions, uid int64) {
+	events.Publish(events.Event{
+		Type:      events.MessageAppended,
+		AccountID: options.AccountID,
+		MailboxID: options.MailboxID,
+		Mailbox:   options.MailboxName,
+		UIDs:      []uint32{uint32(uid)},
+		MessageID: options.MessageID,
+		Subject:   options.Subject,
+		Size:      options.Size,
+	})
+}
+
+func publishFlagsChanged(mailboxID int64, uid imap.UID, flags []imap.Flag) {
+	if !events.Enabled() {
+		return
+	}
+	names := make([]string, len(flags))
+	for i, f := range flags {
+		names[i] = string(f)
+	}
+	events.Publish(events.Event{
+		Type:      events.FlagsChanged,
+		MailboxID: mailboxID,
+		UIDs:      []uint32{uint32(uid)},
+		Flags:     names,
+	})
+}
+
+func publishUIDs(eventType events.Type, accountID, mailboxID int64, uids []imap.UID) {
+	if !events.Enabled() || len(uids) == 0 {
+		return
+	}
+	values := make([]uint32, len(uids))
+	for i, uid := range uids {
+		values[i] = uint32(uid)
+	}
+	slices.Sort(values)
+	events.Publish(events.Event{
+		Type:      eventType,
+		AccountID: accountID,
+		MailboxID: mailboxID,
+		UIDs:      values,
+	})
+}
+
+// publishCopied publishes MessageAppended for the destination UIDs of a copy
+// or move, and MessageExpunged for the source UIDs of a move.
+func publishCopied(accountID, srcMailboxID, destMailboxID int64, uidMap map[imap.UID]imap.UID, move bool) {
+	if !events.Enabled() {
+		return
+	}
+	src := make([]imap.UID, 0, len(uidMap))
+	dest := make([]imap.UID, 0, len(uidMap))
+	for s, d := range uidMap {
+		src = append(src, s)
+		dest = append(dest, d)
+	}
+	if move {
+		publishUIDs(events.MessageExpunged, accountID, srcMailboxID, src)
+	}
+	publishUIDs(events.MessageAppended, accountID, destMailboxID, dest)
+}
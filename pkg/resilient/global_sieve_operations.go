@@ -0,0 +1,78 @@
+package resilient
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+)
+
+// --- Global Sieve Script Wrappers ---
+
+func (rd *ResilientDatabase) CreateGlobalSieveScriptWithRetry(ctx context.Context, script db.GlobalSieveScript) (*db.GlobalSieveScript, error) {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return rd.getOperationalDatabaseForOperation(true).CreateGlobalSieveScript(ctx, tx, script)
+	}
+	result, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op,
+		consts.ErrDBUniqueViolation, consts.ErrInvalidInput)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*db.GlobalSieveScript), nil
+}
+
+func (rd *ResilientDatabase) GetGlobalSieveScriptWithRetry(ctx context.Context, id int64) (*db.GlobalSieveScript, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetGlobalSieveScript(ctx, id)
+	}
+	result, err := rd.executeReadWithRetry(ctx, adminRetryConfig, timeoutAdmin, op, consts.ErrDBNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*db.GlobalSieveScript), nil
+}
+
+func (rd *ResilientDatabase) ListGlobalSieveScriptsWithRetry(ctx context.Context) ([]db.GlobalSieveScript, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).ListGlobalSieveScripts(ctx)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]db.GlobalSieveScript), nil
+}
+
+// GetActiveGlobalSieveScriptsWithRetry returns the scripts that run for the
+// accounts of a domain. It is called during delivery.
+func (rd *ResilientDatabase) GetActiveGlobalSieveScriptsWithRetry(ctx context.Context, domain string) ([]db.GlobalSieveScript, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetActiveGlobalSieveScripts(ctx, domain)
+	}
+	result, err := rd.executeReadWithRetry(ctx, sieveReadRetryConfig, timeoutRead, op)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]db.GlobalSieveScript), nil
+}
+
+func (rd *ResilientDatabase) UpdateGlobalSieveScriptWithRetry(ctx context.Context, script db.GlobalSieveScript) (*db.GlobalSieveScript, error) {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return rd.getOperationalDatabaseForOperation(true).UpdateGlobalSieveScript(ctx, tx, script)
+	}
+	result, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op,
+		consts.ErrDBNotFound, consts.ErrDBUniqueViolation, consts.ErrInvalidInput)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*db.GlobalSieveScript), nil
+}
+
+func (rd *ResilientDatabase) DeleteGlobalSieveScriptWithRetry(ctx context.Context, id int64) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(true).DeleteGlobalSieveScript(ctx, tx, id)
+	}
+	_, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op, consts.ErrDBNotFound)
+	return err
+}
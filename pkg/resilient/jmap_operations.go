@@ -0,0 +1,160 @@
+package resilient
+
+import (
+	"context"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+)
+
+// --- JMAP Wrappers ---
+
+func (rd *ResilientDatabase) GetJMAPStateWithRetry(ctx context.Context, accountID int64) (int64, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetJMAPState(ctx, accountID)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op)
+	if err != nil {
+		return 0, err
+	}
+	return result.(int64), nil
+}
+
+func (rd *ResilientDatabase) GetJMAPMailboxesWithRetry(ctx context.Context, accountID int64) ([]db.JMAPMailbox, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetJMAPMailboxes(ctx, accountID)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return []db.JMAPMailbox{}, nil
+	}
+	return result.([]db.JMAPMailbox), nil
+}
+
+func (rd *ResilientDatabase) GetJMAPMailboxThreadCountsWithRetry(ctx context.Context, accountID int64) (map[int64][2]int64, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetJMAPMailboxThreadCounts(ctx, accountID)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutSearch, op)
+	if err != nil {
+		return nil, err
+	}
+	return result.(map[int64][2]int64), nil
+}
+
+func (rd *ResilientDatabase) GetJMAPMailboxChangesWithRetry(ctx context.Context, accountID int64, sinceModSeq int64) (*db.JMAPMailboxChanges, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetJMAPMailboxChanges(ctx, accountID, sinceModSeq)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*db.JMAPMailboxChanges), nil
+}
+
+func (rd *ResilientDatabase) GetJMAPEmailsWithRetry(ctx context.Context, accountID int64, contentHashes []string) ([]db.JMAPEmail, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetJMAPEmails(ctx, accountID, contentHashes)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return []db.JMAPEmail{}, nil
+	}
+	return result.([]db.JMAPEmail), nil
+}
+
+func (rd *ResilientDatabase) QueryJMAPEmailsWithRetry(ctx context.Context, accountID int64, query *db.JMAPEmailQuery) ([]string, int, error) {
+	type queryResult struct {
+		hashes []string
+		total  int
+	}
+	op := func(ctx context.Context) (any, error) {
+		hashes, total, err := rd.getOperationalDatabaseForOperation(false).QueryJMAPEmails(ctx, accountID, query)
+		if err != nil {
+			return nil, err
+		}
+		return queryResult{hashes: hashes, total: total}, nil
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutSearch, op)
+	if err != nil {
+		return nil, 0, err
+	}
+	res := result.(queryResult)
+	return res.hashes, res.total, nil
+}
+
+func (rd *ResilientDatabase) GetJMAPEmailChangesWithRetry(ctx context.Context, accountID int64, sinceModSeq int64, maxChanges int) (*db.JMAPEmailChanges, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetJMAPEmailChanges(ctx, accountID, sinceModSeq, maxChanges)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutSearch, op)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*db.JMAPEmailChanges), nil
+}
+
+func (rd *ResilientDatabase) GetJMAPThreadsWithRetry(ctx context.Context, accountID int64, threadIDs []string) (map[string][]string, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetJMAPThreads(ctx, accountID, threadIDs)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op)
+	if err != nil {
+		return nil, err
+	}
+	return result.(map[string][]string), nil
+}
+
+func (rd *ResilientDatabase) GetJMAPBlobLocationWithRetry(ctx context.Context, accountID int64, contentHash string) (string, string, error) {
+	op := func(ctx context.Context) (any, error) {
+		domain, localpart, err := rd.getOperationalDatabaseForOperation(false).GetJMAPBlobLocation(ctx, accountID, contentHash)
+		if err != nil {
+			return nil, err
+		}
+		return [2]string{domain, localpart}, nil
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op, consts.ErrDBNotFound)
+	if err != nil {
+		return "", "", err
+	}
+	location := result.([2]string)
+	return location[0], location[1], nil
+}
+
+// UpdateJMAPEmailWithRetry applies an Email/set update in a single transaction.
+// A nil flags or mailboxIDs argument leaves that property unchanged.
+func (rd *ResilientDatabase) UpdateJMAPEmailWithRetry(ctx context.Context, accountID int64, contentHash string, flags []imap.Flag, mailboxIDs []int64) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		database := rd.getOperationalDatabaseForOperation(true)
+		if flags != nil {
+			if err := database.SetJMAPEmailKeywords(ctx, tx, accountID, contentHash, flags); err != nil {
+				return nil, err
+			}
+		}
+		if mailboxIDs != nil {
+			if err := database.SetJMAPEmailMailboxes(ctx, tx, accountID, contentHash, mailboxIDs); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+	_, err := rd.executeWriteInTxWithRetry(ctx, writeRetryConfig, timeoutWrite, op, consts.ErrDBNotFound, consts.ErrMailboxNotFound)
+	return err
+}
+
+func (rd *ResilientDatabase) DestroyJMAPEmailWithRetry(ctx context.Context, accountID int64, contentHash string) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(true).DestroyJMAPEmail(ctx, tx, accountID, contentHash)
+	}
+	_, err := rd.executeWriteInTxWithRetry(ctx, writeRetryConfig, timeoutWrite, op, consts.ErrDBNotFound)
+	return err
+}
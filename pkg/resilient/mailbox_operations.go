@@ -7,6 +7,7 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/migadu/sora/consts"
 	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/pkg/events"
 	"github.com/migadu/sora/pkg/retry"
 	"github.com/migadu/sora/server"
 )
@@ -45,9 +46,29 @@ func (rd *ResilientDatabase) InsertMessageWithRetry(ctx context.Context, options
 		return 0, 0, err
 	}
 	resSlice := result.([]int64)
+	publishMessageAppended(options, resSlice[1])
 	return resSlice[0], resSlice[1], nil
 }
 
+// InsertMessageIntoMailboxesWithRetry delivers a message to several mailboxes
+// in one transaction. See db.InsertMessageIntoMailboxes.
+func (rd *ResilientDatabase) InsertMessageIntoMailboxesWithRetry(ctx context.Context, options []*db.InsertMessageOptions, upload db.PendingUpload) ([]int64, error) {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return rd.getOperationalDatabaseForOperation(true).InsertMessageIntoMailboxes(ctx, tx, options, upload)
+	}
+	result, err := rd.executeWriteInTxWithRetry(ctx, writeRetryConfig, timeoutWrite, op)
+	uids, _ := result.([]int64)
+	if err != nil {
+		return uids, err
+	}
+	for i, opts := range options {
+		if uids[i] != 0 {
+			publishMessageAppended(opts, uids[i])
+		}
+	}
+	return uids, nil
+}
+
 func (rd *ResilientDatabase) GetMessagesByNumSetWithRetry(ctx context.Context, mailboxID int64, numSet imap.NumSet, includeBodyStructure ...bool) ([]db.Message, error) {
 	op := func(ctx context.Context) (any, error) {
 		return rd.getOperationalDatabaseForOperation(false).GetMessagesByNumSet(ctx, mailboxID, numSet, includeBodyStructure...)
@@ -87,6 +108,17 @@ func (rd *ResilientDatabase) GetMailboxSummariesBatchWithRetry(ctx context.Conte
 	return result.(map[int64]*db.MailboxSummary), nil
 }
 
+func (rd *ResilientDatabase) GetMailboxStatesWithRetry(ctx context.Context, accountID int64) ([]db.MailboxState, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetMailboxStates(ctx, accountID)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]db.MailboxState), nil
+}
+
 func (rd *ResilientDatabase) GetMailboxesWithRetry(ctx context.Context, AccountID int64, subscribed bool) ([]*db.DBMailbox, error) {
 	op := func(ctx context.Context) (any, error) {
 		return rd.getOperationalDatabaseForOperation(false).GetMailboxes(ctx, AccountID, subscribed)
@@ -137,6 +169,19 @@ func (rd *ResilientDatabase) GetActiveAccountIDByAddressWithRetry(ctx context.Co
 	return result.(int64), nil
 }
 
+// GetLoginAccountIDByAddressWithRetry resolves the account of a login that
+// does not check a password, refusing accounts that may not log in.
+func (rd *ResilientDatabase) GetLoginAccountIDByAddressWithRetry(ctx context.Context, address string) (int64, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetLoginAccountIDByAddress(ctx, address)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op, consts.ErrUserNotFound)
+	if err != nil {
+		return 0, err
+	}
+	return result.(int64), nil
+}
+
 func (rd *ResilientDatabase) CreateDefaultMailboxesWithRetry(ctx context.Context, AccountID int64) error {
 	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
 		return nil, rd.getOperationalDatabaseForOperation(true).CreateDefaultMailboxes(ctx, tx, AccountID)
@@ -156,6 +201,39 @@ func (rd *ResilientDatabase) PollMailboxWithRetry(ctx context.Context, mailboxID
 	return result.(*db.MailboxPoll), nil
 }
 
+func (rd *ResilientDatabase) GetVanishedUIDsWithRetry(ctx context.Context, mailboxID int64, sinceModSeq uint64, uidSet imap.UIDSet) (imap.UIDSet, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetVanishedUIDs(ctx, mailboxID, sinceModSeq, uidSet)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op)
+	if err != nil {
+		return nil, err
+	}
+	return result.(imap.UIDSet), nil
+}
+
+func (rd *ResilientDatabase) GetChangedMessagesSinceWithRetry(ctx context.Context, mailboxID int64, sinceModSeq uint64, uidSet imap.UIDSet) ([]db.MessageUpdate, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetChangedMessagesSince(ctx, mailboxID, sinceModSeq, uidSet)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]db.MessageUpdate), nil
+}
+
+func (rd *ResilientDatabase) GetSeqNumsForUIDsWithRetry(ctx context.Context, mailboxID int64, uids []imap.UID) (map[imap.UID]uint32, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetSeqNumsForUIDs(ctx, mailboxID, uids)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op)
+	if err != nil {
+		return nil, err
+	}
+	return result.(map[imap.UID]uint32), nil
+}
+
 func (rd *ResilientDatabase) GetMessagesByFlagWithRetry(ctx context.Context, mailboxID int64, flag imap.Flag) ([]db.Message, error) {
 	op := func(ctx context.Context) (any, error) {
 		return rd.getOperationalDatabaseForOperation(false).GetMessagesByFlag(ctx, mailboxID, flag)
@@ -193,6 +271,7 @@ func (rd *ResilientDatabase) ExpungeMessageUIDsWithRetry(ctx context.Context, ma
 	if err != nil {
 		return 0, err
 	}
+	publishUIDs(events.MessageExpunged, 0, mailboxID, uids)
 	return result.(int64), nil
 }
 
@@ -217,7 +296,9 @@ func (rd *ResilientDatabase) CopyMessagesWithRetry(ctx context.Context, uids *[]
 	if err != nil {
 		return nil, err
 	}
-	return result.(map[imap.UID]imap.UID), nil
+	uidMap := result.(map[imap.UID]imap.UID)
+	publishCopied(AccountID, srcMailboxID, destMailboxID, uidMap, false)
+	return uidMap, nil
 }
 
 func (rd *ResilientDatabase) CreateMailboxWithRetry(ctx context.Context, AccountID int64, name string, parentID *int64) error {
@@ -225,6 +306,9 @@ func (rd *ResilientDatabase) CreateMailboxWithRetry(ctx context.Context, Account
 		return nil, rd.getOperationalDatabaseForOperation(true).CreateMailbox(ctx, tx, AccountID, name, parentID)
 	}
 	_, err := rd.executeWriteInTxWithRetry(ctx, writeRetryConfig, timeoutWrite, op, consts.ErrDBUniqueViolation, consts.ErrMailboxInvalidName)
+	if err == nil {
+		events.Publish(events.Event{Type: events.MailboxCreated, AccountID: AccountID, Mailbox: name})
+	}
 	return err
 }
 
@@ -233,6 +317,9 @@ func (rd *ResilientDatabase) DeleteMailboxWithRetry(ctx context.Context, mailbox
 		return nil, rd.getOperationalDatabaseForOperation(true).DeleteMailbox(ctx, tx, mailboxID, AccountID)
 	}
 	_, err := rd.executeWriteInTxWithRetry(ctx, writeRetryConfig, timeoutWrite, op)
+	if err == nil {
+		events.Publish(events.Event{Type: events.MailboxDeleted, AccountID: AccountID, MailboxID: mailboxID})
+	}
 	return err
 }
 
@@ -366,3 +453,10 @@ func (rd *ResilientDatabase) GetAccessibleMailboxesWithRetry(ctx context.Context
 	}
 	return result.([]*db.DBMailbox), nil
 }
+
+// ListenMailboxChanges listens for mailbox change signals on the current write
+// database. It is not retried; server.MailboxNotifier reconnects on failure,
+// which also picks up a failed-over write database.
+func (rd *ResilientDatabase) ListenMailboxChanges(ctx context.Context, onListening func(), handler func(mailboxID int64)) error {
+	return rd.getOperationalDatabaseForOperation(true).ListenMailboxChanges(ctx, onListening, handler)
+}
@@ -0,0 +1,84 @@
+package resilient
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+)
+
+// --- Message Import Wrappers ---
+
+func (rd *ResilientDatabase) CreateMessageImportWithRetry(ctx context.Context, imp db.MessageImport) (*db.MessageImport, error) {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return rd.getOperationalDatabaseForOperation(true).CreateMessageImport(ctx, tx, imp)
+	}
+	result, err := rd.executeWriteInTxWithRetry(ctx, writeRetryConfig, timeoutWrite, op,
+		consts.ErrImportInProgress, consts.ErrInvalidInput, consts.ErrDBNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*db.MessageImport), nil
+}
+
+func (rd *ResilientDatabase) ListMessageImportsWithRetry(ctx context.Context, accountID int64) ([]db.MessageImport, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).ListMessageImports(ctx, accountID)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]db.MessageImport), nil
+}
+
+func (rd *ResilientDatabase) GetMessageImportWithRetry(ctx context.Context, accountID, id int64) (*db.MessageImport, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetMessageImport(ctx, accountID, id)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op, consts.ErrDBNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*db.MessageImport), nil
+}
+
+func (rd *ResilientDatabase) CancelMessageImportWithRetry(ctx context.Context, accountID, id int64) (*db.MessageImport, error) {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return rd.getOperationalDatabaseForOperation(true).CancelMessageImport(ctx, tx, accountID, id)
+	}
+	result, err := rd.executeWriteInTxWithRetry(ctx, writeRetryConfig, timeoutWrite, op, consts.ErrDBNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*db.MessageImport), nil
+}
+
+func (rd *ResilientDatabase) ClaimMessageImportWithRetry(ctx context.Context, instanceID string, staleBefore time.Time) (*db.MessageImport, error) {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return rd.getOperationalDatabaseForOperation(true).ClaimMessageImport(ctx, tx, instanceID, staleBefore)
+	}
+	result, err := rd.executeWriteInTxWithRetry(ctx, writeRetryConfig, timeoutWrite, op, consts.ErrDBNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*db.MessageImport), nil
+}
+
+func (rd *ResilientDatabase) UpdateMessageImportProgressWithRetry(ctx context.Context, id int64, instanceID string, p db.MessageImportProgress) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(true).UpdateMessageImportProgress(ctx, tx, id, instanceID, p)
+	}
+	_, err := rd.executeWriteInTxWithRetry(ctx, writeRetryConfig, timeoutWrite, op, consts.ErrDBNotFound)
+	return err
+}
+
+func (rd *ResilientDatabase) FinishMessageImportWithRetry(ctx context.Context, id int64, instanceID, status string, p db.MessageImportProgress, errMsg string) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(true).FinishMessageImport(ctx, tx, id, instanceID, status, p, errMsg)
+	}
+	_, err := rd.executeWriteInTxWithRetry(ctx, writeRetryConfig, timeoutWrite, op, consts.ErrDBNotFound, consts.ErrInvalidInput)
+	return err
+}
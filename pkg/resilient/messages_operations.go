@@ -29,6 +29,7 @@ func (rd *ResilientDatabase) AddMessageFlagsWithRetry(ctx context.Context, messa
 	}
 
 	res := result.(flagUpdateResult)
+	publishFlagsChanged(mailboxID, messageUID, res.flags)
 	return res.flags, res.modSeq, nil
 }
 
@@ -51,6 +52,7 @@ func (rd *ResilientDatabase) RemoveMessageFlagsWithRetry(ctx context.Context, me
 	}
 
 	res := result.(flagUpdateResult)
+	publishFlagsChanged(mailboxID, messageUID, res.flags)
 	return res.flags, res.modSeq, nil
 }
 
@@ -73,6 +75,7 @@ func (rd *ResilientDatabase) SetMessageFlagsWithRetry(ctx context.Context, messa
 	}
 
 	res := result.(flagUpdateResult)
+	publishFlagsChanged(mailboxID, messageUID, res.flags)
 	return res.flags, res.modSeq, nil
 }
 
@@ -139,6 +142,20 @@ func (rd *ResilientDatabase) GetMessagesSorted(ctx context.Context, mailboxID in
 	return result.([]db.Message), nil
 }
 
+func (rd *ResilientDatabase) GetThreadMessagesWithRetry(ctx context.Context, mailboxID int64, criteria *imap.SearchCriteria) ([]db.ThreadMessage, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetThreadMessages(ctx, mailboxID, criteria)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutSearch, op)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return []db.ThreadMessage{}, nil
+	}
+	return result.([]db.ThreadMessage), nil
+}
+
 func (rd *ResilientDatabase) MoveMessagesWithRetry(ctx context.Context, ids *[]imap.UID, srcMailboxID, destMailboxID int64, AccountID int64) (map[imap.UID]imap.UID, error) {
 	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
 		return rd.getOperationalDatabaseForOperation(true).MoveMessages(ctx, tx, ids, srcMailboxID, destMailboxID, AccountID)
@@ -147,7 +164,9 @@ func (rd *ResilientDatabase) MoveMessagesWithRetry(ctx context.Context, ids *[]i
 	if err != nil {
 		return nil, err
 	}
-	return result.(map[imap.UID]imap.UID), nil
+	uidMap := result.(map[imap.UID]imap.UID)
+	publishCopied(AccountID, srcMailboxID, destMailboxID, uidMap, true)
+	return uidMap, nil
 }
 
 // --- POP3 and Message List Wrappers ---
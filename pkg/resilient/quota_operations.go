@@ -0,0 +1,70 @@
+package resilient
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+)
+
+// GetAccountQuotaWithRetry returns the effective quota and usage of an account.
+func (rd *ResilientDatabase) GetAccountQuotaWithRetry(ctx context.Context, accountID int64) (*db.AccountQuota, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetAccountQuota(ctx, accountID)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op, consts.ErrUserNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*db.AccountQuota), nil
+}
+
+// CheckQuotaWithRetry returns consts.ErrQuotaExceeded if the account cannot store
+// addMessages additional messages totalling addBytes.
+func (rd *ResilientDatabase) CheckQuotaWithRetry(ctx context.Context, accountID int64, addBytes, addMessages int64) error {
+	op := func(ctx context.Context) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(false).CheckQuota(ctx, accountID, addBytes, addMessages)
+	}
+	_, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op, consts.ErrQuotaExceeded, consts.ErrUserNotFound)
+	return err
+}
+
+// SetAccountQuotaWithRetry sets the storage and message limits of an account.
+func (rd *ResilientDatabase) SetAccountQuotaWithRetry(ctx context.Context, accountID int64, storageLimit, messagesLimit *int64) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(true).SetAccountQuota(ctx, tx, accountID, storageLimit, messagesLimit)
+	}
+	_, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op, consts.ErrUserNotFound)
+	return err
+}
+
+// GetDomainQuotaWithRetry returns the default quota of a domain.
+func (rd *ResilientDatabase) GetDomainQuotaWithRetry(ctx context.Context, domain string) (*db.DomainQuota, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetDomainQuota(ctx, domain)
+	}
+	result, err := rd.executeReadWithRetry(ctx, adminRetryConfig, timeoutAdmin, op, consts.ErrDBNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*db.DomainQuota), nil
+}
+
+// SetDomainQuotaWithRetry creates or replaces the default quota of a domain.
+func (rd *ResilientDatabase) SetDomainQuotaWithRetry(ctx context.Context, quota db.DomainQuota) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(true).SetDomainQuota(ctx, tx, quota)
+	}
+	_, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op)
+	return err
+}
+
+// DeleteDomainQuotaWithRetry removes the default quota of a domain.
+func (rd *ResilientDatabase) DeleteDomainQuotaWithRetry(ctx context.Context, domain string) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(true).DeleteDomainQuota(ctx, tx, domain)
+	}
+	_, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op, consts.ErrDBNotFound)
+	return err
+}
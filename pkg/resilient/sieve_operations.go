@@ -42,6 +42,20 @@ func (rd *ResilientDatabase) GetUserScriptsWithRetry(ctx context.Context, Accoun
 	return result.([]*db.SieveScript), nil
 }
 
+// CountUserScriptsWithRetry counts the Sieve scripts of a user with retry logic
+func (rd *ResilientDatabase) CountUserScriptsWithRetry(ctx context.Context, AccountID int64) (int, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).CountUserScripts(ctx, AccountID)
+	}
+
+	result, err := rd.executeReadWithRetry(ctx, sieveReadRetryConfig, timeoutRead, op)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.(int), nil
+}
+
 // GetScriptByNameWithRetry retrieves a specific Sieve script by name with retry logic
 func (rd *ResilientDatabase) GetScriptByNameWithRetry(ctx context.Context, name string, AccountID int64) (*db.SieveScript, error) {
 	op := func(ctx context.Context) (any, error) {
@@ -225,3 +239,29 @@ func (rd *ResilientDatabase) RecordVacationResponseWithRetry(ctx context.Context
 	_, err := rd.executeWriteInTxWithRetry(ctx, sieveWriteRetryConfig, timeoutWrite, op)
 	return err
 }
+
+// Sieve notification methods
+
+// CountRecentSieveNotificationsWithRetry counts the recent Sieve notifications of an account with retry logic
+func (rd *ResilientDatabase) CountRecentSieveNotificationsWithRetry(ctx context.Context, AccountID int64, duration time.Duration) (int, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).CountRecentSieveNotifications(ctx, AccountID, duration)
+	}
+
+	result, err := rd.executeReadWithRetry(ctx, sieveReadRetryConfig, timeoutRead, op)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.(int), nil
+}
+
+// RecordSieveNotificationWithRetry records that a Sieve notification was sent with retry logic
+func (rd *ResilientDatabase) RecordSieveNotificationWithRetry(ctx context.Context, AccountID int64, method string, retention time.Duration) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(true).RecordSieveNotification(ctx, tx, AccountID, method, retention)
+	}
+
+	_, err := rd.executeWriteInTxWithRetry(ctx, sieveWriteRetryConfig, timeoutWrite, op)
+	return err
+}
@@ -20,13 +20,13 @@ import (
 )
 
 type ResilientS3Storage struct {
-	storage       *storage.S3Storage
+	storage       storage.BlobStore
 	getBreaker    *circuitbreaker.CircuitBreaker
 	putBreaker    *circuitbreaker.CircuitBreaker
 	deleteBreaker *circuitbreaker.CircuitBreaker
 }
 
-func NewResilientS3Storage(s3storage *storage.S3Storage) *ResilientS3Storage {
+func NewResilientS3Storage(s3storage storage.BlobStore) *ResilientS3Storage {
 	getSettings := circuitbreaker.DefaultSettings("s3_get")
 	getSettings.ReadyToTrip = func(counts circuitbreaker.Counts) bool {
 		failureRatio := float64(counts.TotalFailures) / float64(counts.Requests)
@@ -97,10 +97,20 @@ func NewResilientS3Storage(s3storage *storage.S3Storage) *ResilientS3Storage {
 	}
 }
 
-func (rs *ResilientS3Storage) GetStorage() *storage.S3Storage {
+func (rs *ResilientS3Storage) GetStorage() storage.BlobStore {
 	return rs.storage
 }
 
+// s3Backend returns the underlying S3 storage for operations that need the
+// raw S3 API; it fails for other blob backends.
+func (rs *ResilientS3Storage) s3Backend() (*storage.S3Storage, error) {
+	s3storage, ok := rs.storage.(*storage.S3Storage)
+	if !ok {
+		return nil, fmt.Errorf("operation requires the s3 storage backend")
+	}
+	return s3storage, nil
+}
+
 func (rs *ResilientS3Storage) isRetryableError(err error) bool {
 	return rs.classifyRetryable(err, false)
 }
@@ -252,6 +262,10 @@ func (rs *ResilientS3Storage) DeleteWithRetry(ctx context.Context, key string) e
 }
 
 func (rs *ResilientS3Storage) PutObjectWithRetry(ctx context.Context, key string, reader io.Reader, objectSize int64) (*s3.PutObjectOutput, error) {
+	s3storage, err := rs.s3Backend()
+	if err != nil {
+		return nil, err
+	}
 	config := retry.BackoffConfig{
 		InitialInterval: 1 * time.Second,
 		MaxInterval:     30 * time.Second,
@@ -268,11 +282,11 @@ func (rs *ResilientS3Storage) PutObjectWithRetry(ctx context.Context, key string
 			}
 		}
 		input := &s3.PutObjectInput{
-			Bucket: aws.String(rs.storage.BucketName),
+			Bucket: aws.String(s3storage.BucketName),
 			Key:    aws.String(key),
 			Body:   reader,
 		}
-		return rs.storage.Client.PutObject(ctx, input)
+		return s3storage.Client.PutObject(ctx, input)
 	}
 	result, err := rs.executeS3OperationWithRetry(ctx, rs.putBreaker, config, rs.isRetryableError, op, key)
 	if err != nil {
@@ -283,6 +297,10 @@ func (rs *ResilientS3Storage) PutObjectWithRetry(ctx context.Context, key string
 }
 
 func (rs *ResilientS3Storage) GetObjectWithRetry(ctx context.Context, key string) (*s3.GetObjectOutput, error) {
+	s3storage, err := rs.s3Backend()
+	if err != nil {
+		return nil, err
+	}
 	config := retry.BackoffConfig{
 		InitialInterval: 500 * time.Millisecond,
 		MaxInterval:     10 * time.Second,
@@ -294,10 +312,10 @@ func (rs *ResilientS3Storage) GetObjectWithRetry(ctx context.Context, key string
 
 	op := func() (any, error) {
 		input := &s3.GetObjectInput{
-			Bucket: aws.String(rs.storage.BucketName),
+			Bucket: aws.String(s3storage.BucketName),
 			Key:    aws.String(key),
 		}
-		return rs.storage.Client.GetObject(ctx, input)
+		return s3storage.Client.GetObject(ctx, input)
 	}
 	result, err := rs.executeS3OperationWithRetry(ctx, rs.getBreaker, config, rs.isRetryableGetError, op, key)
 	if err != nil {
@@ -316,19 +334,32 @@ func (rs *ResilientS3Storage) GetObjectWithRetry(ctx context.Context, key string
 // This is used by the uploader to self-heal stuck uploads whose local file
 // was deleted but whose content was already successfully stored in S3.
 func (rs *ResilientS3Storage) ExistsWithRetry(ctx context.Context, key string) (bool, error) {
-	_, err := rs.StatObjectWithRetry(ctx, key)
+	config := retry.BackoffConfig{
+		InitialInterval: 500 * time.Millisecond,
+		MaxInterval:     5 * time.Second,
+		Multiplier:      2.0,
+		Jitter:          true,
+		MaxRetries:      3,
+		OperationName:   "s3_exists",
+	}
+
+	op := func() (any, error) {
+		// Exists reports a missing object as (false, nil) rather than an error
+		exists, _, err := rs.storage.Exists(key)
+		return exists, err
+	}
+	result, err := rs.executeS3OperationWithRetry(ctx, rs.getBreaker, config, rs.isRetryableError, op, key)
 	if err != nil {
-		// A 404 means the object simply isn't there — not an error condition.
-		var httpErr *awshttp.ResponseError
-		if errors.As(err, &httpErr) && httpErr.HTTPStatusCode() == 404 {
-			return false, nil
-		}
 		return false, err
 	}
-	return true, nil
+	return result.(bool), nil
 }
 
 func (rs *ResilientS3Storage) StatObjectWithRetry(ctx context.Context, key string) (*s3.HeadObjectOutput, error) {
+	s3storage, err := rs.s3Backend()
+	if err != nil {
+		return nil, err
+	}
 	config := retry.BackoffConfig{
 		InitialInterval: 500 * time.Millisecond,
 		MaxInterval:     5 * time.Second,
@@ -340,10 +371,10 @@ func (rs *ResilientS3Storage) StatObjectWithRetry(ctx context.Context, key strin
 
 	op := func() (any, error) {
 		input := &s3.HeadObjectInput{
-			Bucket: aws.String(rs.storage.BucketName),
+			Bucket: aws.String(s3storage.BucketName),
 			Key:    aws.String(key),
 		}
-		return rs.storage.Client.HeadObject(ctx, input)
+		return s3storage.Client.HeadObject(ctx, input)
 	}
 	result, err := rs.executeS3OperationWithRetry(ctx, rs.getBreaker, config, rs.isRetryableError, op, key)
 	if err != nil {
@@ -0,0 +1,78 @@
+package resilient
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+)
+
+// --- TOTP Wrappers ---
+
+// GetTOTPStatusWithRetry returns the second factor status of an account. It
+// is used on the login path, so it uses the read timeouts.
+func (rd *ResilientDatabase) GetTOTPStatusWithRetry(ctx context.Context, accountID int64) (*db.TOTPStatus, error) {
+	op := func(ctx context.Context) (any, error) {
+		return rd.getOperationalDatabaseForOperation(false).GetTOTPStatus(ctx, accountID)
+	}
+	result, err := rd.executeReadWithRetry(ctx, readRetryConfig, timeoutRead, op)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*db.TOTPStatus), nil
+}
+
+func (rd *ResilientDatabase) BeginTOTPEnrolmentWithRetry(ctx context.Context, accountID int64) (string, error) {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return rd.getOperationalDatabaseForOperation(true).BeginTOTPEnrolment(ctx, tx, accountID)
+	}
+	result, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op,
+		consts.ErrTOTPAlreadyEnabled, consts.ErrUserNotFound)
+	if err != nil {
+		return "", err
+	}
+	return result.(string), nil
+}
+
+func (rd *ResilientDatabase) EnableTOTPWithRetry(ctx context.Context, accountID int64, code string) ([]string, error) {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return rd.getOperationalDatabaseForOperation(true).EnableTOTP(ctx, tx, accountID, code)
+	}
+	result, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op,
+		consts.ErrAuthenticationFailed, consts.ErrDBNotFound, consts.ErrTOTPAlreadyEnabled)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]string), nil
+}
+
+// VerifyTOTPWithRetry checks a TOTP code or a recovery code. A wrong code is
+// not retried.
+func (rd *ResilientDatabase) VerifyTOTPWithRetry(ctx context.Context, accountID int64, code, recoveryCode string) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(true).VerifyTOTP(ctx, tx, accountID, code, recoveryCode)
+	}
+	_, err := rd.executeWriteInTxWithRetry(ctx, writeRetryConfig, timeoutWrite, op,
+		consts.ErrAuthenticationFailed, consts.ErrDBNotFound)
+	return err
+}
+
+func (rd *ResilientDatabase) RegenerateTOTPRecoveryCodesWithRetry(ctx context.Context, accountID int64) ([]string, error) {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return rd.getOperationalDatabaseForOperation(true).RegenerateTOTPRecoveryCodes(ctx, tx, accountID)
+	}
+	result, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op, consts.ErrDBNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]string), nil
+}
+
+func (rd *ResilientDatabase) DeleteTOTPWithRetry(ctx context.Context, accountID int64) error {
+	op := func(ctx context.Context, tx pgx.Tx) (any, error) {
+		return nil, rd.getOperationalDatabaseForOperation(true).DeleteTOTP(ctx, tx, accountID)
+	}
+	_, err := rd.executeWriteInTxWithRetry(ctx, adminRetryConfig, timeoutAdmin, op, consts.ErrDBNotFound)
+	return err
+}
@@ -0,0 +1,606 @@
+// Package sieveext implements the Sieve extensions that go-sieve lacks:
+// reject and ereject (RFC 5429), enotify with the mailto method (RFC 5435,
+// RFC 5436), spamtest, spamtestplus and virustest (RFC 5235) and body
+// (RFC 5173).
+//
+// Scripts are parsed with the go-sieve parser and rewritten before they are
+// loaded. Commands become redirects to a marker address; the Sieve policy
+// recognizes the marker with Parse and records the action instead of
+// redirecting. Tests become header tests of a header that only exists
+// during evaluation, which the executor fills with the spam or virus test
+// value or the body of the message, see Extensions.Tests. The comparator
+// and match type arguments are passed on to the header test unchanged.
+//
+// Markers and header names are random per script, so a script or a message
+// cannot forge them. The interpreter expands variables and encoded
+// characters in the arguments as it does for any redirect or header test.
+package sieveext
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/foxcpp/go-sieve"
+	"github.com/foxcpp/go-sieve/interp"
+	"github.com/foxcpp/go-sieve/lexer"
+	"github.com/foxcpp/go-sieve/parser"
+)
+
+// Extensions implemented by this package.
+const (
+	Reject       = "reject"
+	EReject      = "ereject"
+	Enotify      = "enotify"
+	Spamtest     = "spamtest"
+	Spamtestplus = "spamtestplus"
+	Virustest    = "virustest"
+	Body         = "body"
+)
+
+var extensions = []string{Reject, EReject, Enotify, Spamtest, Spamtestplus, Virustest, Body}
+
+// HeaderPrefix starts the names of the headers of rewritten tests. The
+// executor removes message headers with this prefix.
+const HeaderPrefix = "x-sieveext-"
+
+// Kinds of rewritten tests.
+const (
+	TestSpam        = "spamtest"         // RFC 5235 spamtest, "0" to "10"
+	TestSpamPercent = "spamtest-percent" // RFC 5235 spamtest :percent, "0" to "100"
+	TestVirus       = "virustest"        // RFC 5235 virustest, "0" to "5"
+	TestBodyRaw     = "body-raw"         // RFC 5173 body :raw, the undecoded body
+	TestBodyContent = "body-content"     // RFC 5173 body :content, the decoded parts of the content types
+	TestBodyText    = "body-text"        // RFC 5173 body :text, the text of the message
+)
+
+// Test is a rewritten test.
+type Test struct {
+	Kind         string
+	ContentTypes []string // Content types of body :content
+}
+
+// Extensions describes how a loaded script uses the extensions of this
+// package.
+type Extensions struct {
+	// Marker prefixes the redirect addresses of rewritten commands, empty
+	// if the script has none.
+	Marker string
+	// Tests are the rewritten tests by the lowercase name of the header
+	// they test.
+	Tests map[string]Test
+}
+
+// Kinds of the marker redirects, see Parse. A notify command becomes one
+// redirect per parameter followed by a KindNotify redirect with the method.
+const (
+	KindReject           = "reject"
+	KindEReject          = "ereject"
+	KindNotifyFrom       = "notify-from"
+	KindNotifyImportance = "notify-importance"
+	KindNotifyOption     = "notify-option"
+	KindNotifyMessage    = "notify-message"
+	KindNotify           = "notify"
+)
+
+// ErrUnsupportedMethod is returned for notification methods other than mailto.
+var ErrUnsupportedMethod = errors.New("unsupported notification method")
+
+// Load parses a Sieve script, rewrites the commands and tests of the
+// extensions of this package and loads it with the enabled extensions.
+func Load(scriptContent string, enabledExtensions []string) (*sieve.Script, Extensions, error) {
+	options := sieve.DefaultOptions()
+	toks, err := lexer.Lex(strings.NewReader(scriptContent), &options.Lexer)
+	if err != nil {
+		return nil, Extensions{}, err
+	}
+	cmds, err := parser.Parse(lexer.NewStream(toks), &options.Parser)
+	if err != nil {
+		return nil, Extensions{}, err
+	}
+
+	rw := &rewriter{enabled: enabledExtensions, required: map[string]bool{}}
+	if cmds, err = rw.commands(cmds); err != nil {
+		return nil, Extensions{}, err
+	}
+	script, err := interp.LoadScript(cmds, &options.Interp, enabledExtensions)
+	if err != nil {
+		return nil, Extensions{}, err
+	}
+	return script, rw.extensions, nil
+}
+
+// Parse splits a redirect address of a rewritten command into its kind and
+// value. ok is false for the addresses of real redirects.
+func Parse(marker, addr string) (kind, value string, ok bool) {
+	if marker == "" {
+		return "", "", false
+	}
+	rest, ok := strings.CutPrefix(addr, marker)
+	if !ok {
+		return "", "", false
+	}
+	kind, value, _ = strings.Cut(rest, ":")
+	return kind, value, true
+}
+
+// ValidImportance reports whether s is an :importance value of RFC 5435.
+func ValidImportance(s string) bool {
+	return s == "1" || s == "2" || s == "3"
+}
+
+// Mailto is a parsed mailto notification method (RFC 5436, RFC 6068).
+type Mailto struct {
+	To      []string
+	Subject string // Empty unless given in the URI
+	Body    string // Empty unless given in the URI
+}
+
+// ParseMailto parses a mailto URI. Header fields of the URI other than to,
+// subject and body are ignored, as RFC 5436 §2.2 permits.
+func ParseMailto(uri string) (Mailto, error) {
+	var m Mailto
+	scheme, rest, ok := strings.Cut(uri, ":")
+	if !ok || !strings.EqualFold(scheme, "mailto") {
+		return m, fmt.Errorf("%w: %q", ErrUnsupportedMethod, uri)
+	}
+	addrs, query, _ := strings.Cut(rest, "?")
+
+	addTo := func(list string) error {
+		for _, addr := range strings.Split(list, ",") {
+			addr, err := url.PathUnescape(strings.TrimSpace(addr))
+			if err != nil {
+				return fmt.Errorf("invalid mailto URI %q: %w", uri, err)
+			}
+			if addr == "" {
+				continue
+			}
+			parsed, err := mail.ParseAddress(addr)
+			if err != nil {
+				return fmt.Errorf("invalid mailto recipient %q: %w", addr, err)
+			}
+			m.To = append(m.To, parsed.Address)
+		}
+		return nil
+	}
+	if err := addTo(addrs); err != nil {
+		return m, err
+	}
+	for _, field := range strings.Split(query, "&") {
+		name, value, _ := strings.Cut(field, "=")
+		value, err := url.PathUnescape(value)
+		if err != nil {
+			return m, fmt.Errorf("invalid mailto URI %q: %w", uri, err)
+		}
+		switch strings.ToLower(name) {
+		case "to":
+			if err := addTo(value); err != nil {
+				return m, err
+			}
+		case "subject":
+			m.Subject = value
+		case "body":
+			m.Body = value
+		}
+	}
+	if len(m.To) == 0 {
+		return m, fmt.Errorf("mailto URI %q has no recipients", uri)
+	}
+	return m, nil
+}
+
+type rewriter struct {
+	enabled    []string
+	required   map[string]bool
+	id         string // random per script
+	extensions Extensions
+}
+
+func (r *rewriter) commands(cmds []parser.Cmd) ([]parser.Cmd, error) {
+	if cmds == nil {
+		return nil, nil
+	}
+	rewritten := make([]parser.Cmd, 0, len(cmds))
+	for _, cmd := range cmds {
+		var err error
+		if cmd.Tests, err = r.tests(cmd.Tests); err != nil {
+			return nil, err
+		}
+		if cmd.Block, err = r.commands(cmd.Block); err != nil {
+			return nil, err
+		}
+
+		switch strings.ToLower(cmd.Id) {
+		case "require":
+			var keep bool
+			if cmd, keep, err = r.require(cmd); err != nil {
+				return nil, err
+			}
+			if keep {
+				rewritten = append(rewritten, cmd)
+			}
+		case Reject, EReject:
+			redirect, err := r.reject(cmd)
+			if err != nil {
+				return nil, err
+			}
+			rewritten = append(rewritten, redirect)
+		case "notify":
+			redirects, err := r.notify(cmd)
+			if err != nil {
+				return nil, err
+			}
+			rewritten = append(rewritten, redirects...)
+		default:
+			rewritten = append(rewritten, cmd)
+		}
+	}
+	return rewritten, nil
+}
+
+// require removes the extensions of this package from a require command.
+// keep is false if no extension is left.
+func (r *rewriter) require(cmd parser.Cmd) (_ parser.Cmd, keep bool, err error) {
+	if len(cmd.Args) != 1 {
+		return cmd, true, nil // The interpreter reports the error
+	}
+	var exts []string
+	switch arg := cmd.Args[0].(type) {
+	case parser.StringArg:
+		exts = []string{arg.Value}
+	case parser.StringListArg:
+		exts = arg.Value
+	default:
+		return cmd, true, nil
+	}
+
+	remaining := make([]string, 0, len(exts))
+	for _, ext := range exts {
+		if !slices.Contains(extensions, ext) {
+			remaining = append(remaining, ext)
+			continue
+		}
+		if !slices.Contains(r.enabled, ext) {
+			return cmd, false, fmt.Errorf("extension '%s' is not supported", ext)
+		}
+		r.required[ext] = true
+		if ext == Spamtestplus {
+			r.required[Spamtest] = true // RFC 5235 §3.2
+		}
+		if r.id == "" {
+			b := make([]byte, 12)
+			if _, err := rand.Read(b); err != nil {
+				return cmd, false, fmt.Errorf("failed to generate script marker: %w", err)
+			}
+			r.id = hex.EncodeToString(b)
+			r.extensions.Marker = "sieveext-" + r.id + ":"
+		}
+	}
+	if len(remaining) == 0 {
+		return cmd, false, nil
+	}
+	cmd.Args = []parser.Arg{parser.StringListArg{Value: remaining, Position: cmd.Position}}
+	return cmd, true, nil
+}
+
+func (r *rewriter) reject(cmd parser.Cmd) (parser.Cmd, error) {
+	id := strings.ToLower(cmd.Id)
+	if !r.required[id] {
+		return cmd, parser.ErrorAt(cmd.Position, "missing require '%s'", id)
+	}
+	if len(cmd.Tests) != 0 || cmd.Block != nil {
+		return cmd, parser.ErrorAt(cmd.Position, "%s: unexpected test or block", id)
+	}
+	if len(cmd.Args) != 1 {
+		return cmd, parser.ErrorAt(cmd.Position, "%s: expected a reason", id)
+	}
+	reason, ok := cmd.Args[0].(parser.StringArg)
+	if !ok {
+		return cmd, parser.ErrorAt(cmd.Position, "%s: the reason must be a string", id)
+	}
+	kind := KindReject
+	if id == EReject {
+		kind = KindEReject
+	}
+	return r.redirect(cmd.Position, kind, reason.Value), nil
+}
+
+// notify rewrites notify [":from" string] [":importance" <"1" / "2" / "3">]
+// [":options" string-list] [":message" string] <method: string>.
+func (r *rewriter) notify(cmd parser.Cmd) ([]parser.Cmd, error) {
+	if !r.required[Enotify] {
+		return nil, parser.ErrorAt(cmd.Position, "missing require '%s'", Enotify)
+	}
+	if len(cmd.Tests) != 0 || cmd.Block != nil {
+		return nil, parser.ErrorAt(cmd.Position, "notify: unexpected test or block")
+	}
+
+	var redirects []parser.Cmd
+	var method *parser.StringArg
+	seen := map[string]bool{}
+	for i := 0; i < len(cmd.Args); i++ {
+		if method != nil {
+			return nil, parser.ErrorAt(cmd.Position, "notify: unexpected argument after the method")
+		}
+		switch arg := cmd.Args[i].(type) {
+		case parser.StringArg:
+			method = &arg
+		case parser.TagArg:
+			tag := strings.ToLower(arg.Value)
+			if seen[tag] {
+				return nil, parser.ErrorAt(arg.Position, "notify: duplicate :%s", tag)
+			}
+			seen[tag] = true
+			if i+1 >= len(cmd.Args) {
+				return nil, parser.ErrorAt(arg.Position, "notify: :%s needs a value", tag)
+			}
+			i++
+			value := cmd.Args[i]
+			switch tag {
+			case "from", "importance", "message":
+				s, ok := value.(parser.StringArg)
+				if !ok {
+					return nil, parser.ErrorAt(arg.Position, "notify: :%s needs a string", tag)
+				}
+				kind := map[string]string{"from": KindNotifyFrom, "importance": KindNotifyImportance, "message": KindNotifyMessage}[tag]
+				if tag == "importance" && !strings.Contains(s.Value, "${") && !ValidImportance(s.Value) {
+					return nil, parser.ErrorAt(s.Position, "notify: invalid :importance %q", s.Value)
+				}
+				redirects = append(redirects, r.redirect(arg.Position, kind, s.Value))
+			case "options":
+				var options []string
+				switch v := value.(type) {
+				case parser.StringArg:
+					options = []string{v.Value}
+				case parser.StringListArg:
+					options = v.Value
+				default:
+					return nil, parser.ErrorAt(arg.Position, "notify: :options needs a string list")
+				}
+				for _, option := range options {
+					redirects = append(redirects, r.redirect(arg.Position, KindNotifyOption, option))
+				}
+			default:
+				return nil, parser.ErrorAt(arg.Position, "notify: unknown tagged argument :%s", tag)
+			}
+		default:
+			return nil, parser.ErrorAt(cmd.Position, "notify: unexpected argument")
+		}
+	}
+	if method == nil {
+		return nil, parser.ErrorAt(cmd.Position, "notify: expected a method")
+	}
+	// RFC 5435 §3.8: an unsupported constant method fails at compile time
+	if !strings.Contains(method.Value, "${") {
+		if _, err := ParseMailto(method.Value); err != nil {
+			return nil, parser.ErrorAt(method.Position, "notify: %v", err)
+		}
+	}
+	return append(redirects, r.redirect(cmd.Position, KindNotify, method.Value)), nil
+}
+
+func (r *rewriter) tests(tests []parser.Test) ([]parser.Test, error) {
+	if tests == nil {
+		return nil, nil
+	}
+	rewritten := make([]parser.Test, 0, len(tests))
+	for _, test := range tests {
+		var err error
+		if test.Tests, err = r.tests(test.Tests); err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(test.Id) {
+		case "valid_notify_method":
+			test, err = r.validNotifyMethod(test)
+		case Spamtest:
+			test, err = r.spamtest(test)
+		case Virustest:
+			test, err = r.virustest(test)
+		case Body:
+			test, err = r.body(test)
+		}
+		if err != nil {
+			return nil, err
+		}
+		rewritten = append(rewritten, test)
+	}
+	return rewritten, nil
+}
+
+// validNotifyMethod replaces a valid_notify_method test by its constant
+// outcome. The URIs must not contain variables.
+func (r *rewriter) validNotifyMethod(test parser.Test) (parser.Test, error) {
+	if !r.required[Enotify] {
+		return test, parser.ErrorAt(test.Position, "missing require '%s'", Enotify)
+	}
+	var uris []string
+	if len(test.Args) == 1 {
+		switch arg := test.Args[0].(type) {
+		case parser.StringArg:
+			uris = []string{arg.Value}
+		case parser.StringListArg:
+			uris = arg.Value
+		}
+	}
+	if len(uris) == 0 {
+		return test, parser.ErrorAt(test.Position, "valid_notify_method: expected a string list")
+	}
+	valid := true
+	for _, uri := range uris {
+		if strings.Contains(uri, "${") {
+			return test, parser.ErrorAt(test.Position, "valid_notify_method: variables are not supported")
+		}
+		if _, err := ParseMailto(uri); err != nil {
+			valid = false
+		}
+	}
+	id := "false"
+	if valid {
+		id = "true"
+	}
+	return parser.Test{Position: test.Position, Id: id}, nil
+}
+
+// spamtest rewrites spamtest [":percent"] [COMPARATOR] [MATCH-TYPE] <value: string>.
+func (r *rewriter) spamtest(test parser.Test) (parser.Test, error) {
+	if !r.required[Spamtest] {
+		return test, parser.ErrorAt(test.Position, "missing require '%s'", Spamtest)
+	}
+	match, rest, err := splitMatchArgs(test)
+	if err != nil {
+		return test, err
+	}
+	kind := TestSpam
+	if len(rest) > 0 {
+		if tag, ok := rest[0].(parser.TagArg); ok && strings.EqualFold(tag.Value, "percent") {
+			if !r.required[Spamtestplus] {
+				return test, parser.ErrorAt(tag.Position, "missing require '%s'", Spamtestplus)
+			}
+			kind = TestSpamPercent
+			rest = rest[1:]
+		}
+	}
+	value, err := singleKey(test, rest)
+	if err != nil {
+		return test, err
+	}
+	return r.headerTest(test, match, Test{Kind: kind}, value), nil
+}
+
+// virustest rewrites virustest [COMPARATOR] [MATCH-TYPE] <value: string>.
+func (r *rewriter) virustest(test parser.Test) (parser.Test, error) {
+	if !r.required[Virustest] {
+		return test, parser.ErrorAt(test.Position, "missing require '%s'", Virustest)
+	}
+	match, rest, err := splitMatchArgs(test)
+	if err != nil {
+		return test, err
+	}
+	value, err := singleKey(test, rest)
+	if err != nil {
+		return test, err
+	}
+	return r.headerTest(test, match, Test{Kind: TestVirus}, value), nil
+}
+
+// body rewrites body [COMPARATOR] [MATCH-TYPE] [BODY-TRANSFORM] <key-list: string-list>,
+// BODY-TRANSFORM = ":raw" / ":content" <content-types: string-list> / ":text".
+func (r *rewriter) body(test parser.Test) (parser.Test, error) {
+	if !r.required[Body] {
+		return test, parser.ErrorAt(test.Position, "missing require '%s'", Body)
+	}
+	match, rest, err := splitMatchArgs(test)
+	if err != nil {
+		return test, err
+	}
+	transform := Test{Kind: TestBodyText}
+	transforms := 0
+	var keys []parser.Arg
+	for i := 0; i < len(rest); i++ {
+		tag, ok := rest[i].(parser.TagArg)
+		if !ok {
+			keys = append(keys, rest[i])
+			continue
+		}
+		transforms++
+		switch strings.ToLower(tag.Value) {
+		case "raw":
+			transform.Kind = TestBodyRaw
+		case "text":
+			transform.Kind = TestBodyText
+		case "content":
+			if i+1 >= len(rest) {
+				return test, parser.ErrorAt(tag.Position, "body: :content needs a string list")
+			}
+			i++
+			switch types := rest[i].(type) {
+			case parser.StringArg:
+				transform.ContentTypes = []string{types.Value}
+			case parser.StringListArg:
+				transform.ContentTypes = types.Value
+			default:
+				return test, parser.ErrorAt(tag.Position, "body: :content needs a string list")
+			}
+			transform.Kind = TestBodyContent
+		default:
+			return test, parser.ErrorAt(tag.Position, "body: unknown tagged argument :%s", tag.Value)
+		}
+	}
+	if transforms > 1 {
+		return test, parser.ErrorAt(test.Position, "body: more than one transform")
+	}
+	key, err := singleKey(test, keys)
+	if err != nil {
+		return test, err
+	}
+	return r.headerTest(test, match, transform, key), nil
+}
+
+// splitMatchArgs splits the arguments of a test into the comparator and
+// match type arguments, which the header test accepts as well, and the
+// others.
+func splitMatchArgs(test parser.Test) (match, rest []parser.Arg, err error) {
+	if len(test.Tests) != 0 {
+		return nil, nil, parser.ErrorAt(test.Position, "%s: unexpected test", test.Id)
+	}
+	for i := 0; i < len(test.Args); i++ {
+		tag, ok := test.Args[i].(parser.TagArg)
+		if !ok {
+			rest = append(rest, test.Args[i])
+			continue
+		}
+		switch strings.ToLower(tag.Value) {
+		case "comparator", "value", "count":
+			if i+1 >= len(test.Args) {
+				return nil, nil, parser.ErrorAt(tag.Position, "%s: :%s needs a value", test.Id, tag.Value)
+			}
+			match = append(match, tag, test.Args[i+1])
+			i++
+		case "is", "contains", "matches", "regex":
+			match = append(match, tag)
+		default:
+			rest = append(rest, tag)
+		}
+	}
+	return match, rest, nil
+}
+
+// singleKey returns the only positional argument of a test, its key list.
+func singleKey(test parser.Test, args []parser.Arg) (parser.Arg, error) {
+	if len(args) != 1 {
+		return nil, parser.ErrorAt(test.Position, "%s: expected a single key", test.Id)
+	}
+	switch args[0].(type) {
+	case parser.StringArg, parser.StringListArg:
+		return args[0], nil
+	case parser.TagArg:
+		return nil, parser.ErrorAt(test.Position, "%s: unexpected tagged argument", test.Id)
+	}
+	return nil, parser.ErrorAt(test.Position, "%s: the key must be a string list", test.Id)
+}
+
+// headerTest returns the header test of a rewritten test.
+func (r *rewriter) headerTest(test parser.Test, match []parser.Arg, rewritten Test, key parser.Arg) parser.Test {
+	if r.extensions.Tests == nil {
+		r.extensions.Tests = make(map[string]Test)
+	}
+	name := HeaderPrefix + r.id + "-" + strconv.Itoa(len(r.extensions.Tests))
+	r.extensions.Tests[name] = rewritten
+
+	args := append(slices.Clone(match), parser.StringArg{Value: name, Position: test.Position}, key)
+	return parser.Test{Position: test.Position, Id: "header", Args: args}
+}
+
+func (r *rewriter) redirect(pos lexer.Position, kind, value string) parser.Cmd {
+	return parser.Cmd{
+		Position: pos,
+		Id:       "redirect",
+		Args:     []parser.Arg{parser.StringArg{Value: r.extensions.Marker + kind + ":" + value, Position: pos}},
+	}
+}
@@ -0,0 +1,126 @@
+package sieveext
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMailto(t *testing.T) {
+	m, err := ParseMailto("mailto:alice@example.com,%20bob@example.com?to=carol@example.com&Subject=Hello%20there&body=a+b&cc=ignored@example.com")
+	if err != nil {
+		t.Fatalf("ParseMailto failed: %v", err)
+	}
+	if strings.Join(m.To, ",") != "alice@example.com,bob@example.com,carol@example.com" {
+		t.Errorf("Unexpected recipients %v", m.To)
+	}
+	if m.Subject != "Hello there" || m.Body != "a+b" {
+		t.Errorf("Unexpected subject %q or body %q", m.Subject, m.Body)
+	}
+
+	for _, uri := range []string{"xmpp:alice@example.com", "mailto:", "mailto:?subject=x", "mailto:not an address"} {
+		if _, err := ParseMailto(uri); err == nil {
+			t.Errorf("Expected an error for %q", uri)
+		}
+	}
+}
+
+func TestLoadRewritesRequire(t *testing.T) {
+	enabled := []string{"fileinto", "reject", "enotify"}
+	_, exts, err := Load(`require ["fileinto", "reject"]; reject "No";`, enabled)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !strings.HasPrefix(exts.Marker, "sieveext-") {
+		t.Errorf("Unexpected marker %q", exts.Marker)
+	}
+
+	_, other, err := Load(`require "reject"; reject "No";`, enabled)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if other.Marker == exts.Marker {
+		t.Error("Markers should differ per script")
+	}
+
+	if _, exts, err := Load(`require "fileinto"; fileinto "A";`, enabled); err != nil || exts.Marker != "" {
+		t.Errorf("Expected no marker without extensions, got %q, %v", exts.Marker, err)
+	}
+
+	invalid := []string{
+		`require "ereject"; ereject "No";`,     // not enabled
+		`require "reject"; reject;`,            // no reason
+		`require "reject"; reject ["a", "b"];`, // not a string
+		`require "enotify"; notify :importance "4" "mailto:a@example.com";`,
+		`require "enotify"; notify :unknown "x" "mailto:a@example.com";`,
+		`require "enotify"; notify :message "x";`,
+		`require "enotify"; if valid_notify_method "mailto:${x}" { keep; }`,
+		`require "enotify"; if notify_method_capability "mailto:a@example.com" "online" "yes" { keep; }`,
+	}
+	for _, script := range invalid {
+		if _, _, err := Load(script, []string{"reject", "enotify"}); err == nil {
+			t.Errorf("Expected %q to fail to load", script)
+		}
+	}
+}
+
+func TestLoadRewritesTests(t *testing.T) {
+	enabled := []string{"relational", "comparator-i;ascii-numeric", "spamtestplus", "virustest", "body"}
+	_, exts, err := Load(`
+require ["relational", "comparator-i;ascii-numeric", "spamtestplus", "virustest", "body"];
+if anyof (spamtest :value "ge" :comparator "i;ascii-numeric" "5",
+          spamtest :percent :value "gt" :comparator "i;ascii-numeric" "80",
+          virustest :value "eq" :comparator "i;ascii-numeric" "5",
+          body :contains "viagra",
+          body :raw :contains "viagra",
+          body :content ["text", "application/pdf"] :contains "viagra") {
+	discard;
+}
+`, enabled)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	kinds := make(map[string]int)
+	for name, test := range exts.Tests {
+		if !strings.HasPrefix(name, HeaderPrefix) {
+			t.Errorf("Unexpected header name %q", name)
+		}
+		kinds[test.Kind]++
+		if test.Kind == TestBodyContent && strings.Join(test.ContentTypes, ",") != "text,application/pdf" {
+			t.Errorf("Unexpected content types %v", test.ContentTypes)
+		}
+	}
+	for _, kind := range []string{TestSpam, TestSpamPercent, TestVirus, TestBodyText, TestBodyRaw, TestBodyContent} {
+		if kinds[kind] != 1 {
+			t.Errorf("Expected one %s test, got %d", kind, kinds[kind])
+		}
+	}
+
+	invalid := map[string][]string{
+		`require "spamtest"; if spamtest :percent "5" { discard; }`:     {"spamtest"},
+		`require "spamtest"; if spamtest :value "ge" "5" { discard; }`:  {"spamtest"}, // no relational
+		`require "body"; if body :raw :text :contains "x" { discard; }`: {"body"},
+		`require "body"; if body :content :contains "x" { discard; }`:   {"body"},
+		`require "virustest"; if virustest "5" { discard; }`:            {"spamtest"},
+		`if body :contains "x" { discard; }`:                            {"body"},
+		`require "spamtestplus"; if spamtest :unknown "5" { discard; }`: {"spamtestplus"},
+	}
+	for script, extensions := range invalid {
+		if _, _, err := Load(script, extensions); err == nil {
+			t.Errorf("Expected %q to fail to load", script)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	kind, value, ok := Parse("sieveext-1:", "sieveext-1:notify:mailto:a@example.com")
+	if !ok || kind != KindNotify || value != "mailto:a@example.com" {
+		t.Errorf("Unexpected %q %q %v", kind, value, ok)
+	}
+	if _, _, ok := Parse("", "sieveext-1:reject:x"); ok {
+		t.Error("Scripts without marker never match")
+	}
+	if _, _, ok := Parse("sieveext-1:", "user@example.com"); ok {
+		t.Error("Addresses must not match")
+	}
+}
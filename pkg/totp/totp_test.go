@@ -0,0 +1,89 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors.
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeRFC6238(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	for _, delta := range []int64{-1, 0, 1} {
+		c, _ := Code(rfcSecret, step+delta)
+		got, ok := Validate(rfcSecret, c, now)
+		if !ok || got != step+delta {
+			t.Errorf("Validate(step%+d) = %d, %v; want %d, true", delta, got, ok, step+delta)
+		}
+	}
+
+	old, _ := Code(rfcSecret, step-2)
+	if _, ok := Validate(rfcSecret, old, now); ok {
+		t.Error("Validate accepted a code outside the allowed skew")
+	}
+	if _, ok := Validate(rfcSecret, "12345", now); ok {
+		t.Error("Validate accepted a short code")
+	}
+	if _, ok := Validate("not base32!", "050471", now); ok {
+		t.Error("Validate accepted an invalid secret")
+	}
+
+	c, _ := Code(rfcSecret, step)
+	if _, ok := Validate(rfcSecret, c[:3]+" "+c[3:], now); !ok {
+		t.Error("Validate rejected a code typed with a space")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("secret length = %d, want 32", len(secret))
+	}
+	if _, err := Code(strings.ToLower(secret), 1); err != nil {
+		t.Errorf("generated secret does not decode: %v", err)
+	}
+}
+
+func TestURL(t *testing.T) {
+	got := URL("Sora Mail", "user@example.com", "JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(got, "otpauth://totp/Sora%20Mail:user@example.com?") {
+		t.Errorf("unexpected URL prefix: %s", got)
+	}
+	for _, want := range []string{"secret=JBSWY3DPEHPK3PXP", "issuer=Sora+Mail", "digits=6", "period=30"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("URL %s does not contain %s", got, want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package adminapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+)
+
+// SetAccountStatusRequest sets the lifecycle status of an account. ExpiresAt
+// reverts the status to active at that time; DeleteAt schedules a soft delete.
+type SetAccountStatusRequest struct {
+	Status    string     `json:"status"`
+	Reason    string     `json:"reason,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	DeleteAt  *time.Time `json:"delete_at,omitempty"`
+}
+
+// handleGetAccountStatus handles GET /admin/accounts/{email}/status
+func (s *Server) handleGetAccountStatus(w http.ResponseWriter, r *http.Request) {
+	email := extractPathParam(r.URL.Path, "/admin/accounts/", "/status")
+	ctx := r.Context()
+
+	accountID, err := s.rdb.GetAccountIDByAddressWithRetry(ctx, email)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserNotFound) {
+			s.writeError(w, http.StatusNotFound, "Account not found")
+			return
+		}
+		logger.Warn("HTTP API: Error getting account ID", "name", s.name, "email", email, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to find account")
+		return
+	}
+
+	status, err := s.rdb.GetAccountStatusWithRetry(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserNotFound) {
+			s.writeError(w, http.StatusNotFound, "Account not found")
+			return
+		}
+		logger.Warn("HTTP API: Error getting account status", "name", s.name, "email", email, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to get account status")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"email":  email,
+		"status": status,
+	})
+}
+
+// handleSetAccountStatus handles PUT /admin/accounts/{email}/status. When the
+// new status blocks logins, live sessions of the account are kicked on every
+// connection tracker, which broadcasts the kick cluster-wide.
+func (s *Server) handleSetAccountStatus(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	email := extractPathParam(r.URL.Path, "/admin/accounts/", "/status")
+
+	var req SetAccountStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if req.Status == "" {
+		s.writeError(w, http.StatusBadRequest, "status is required")
+		return
+	}
+
+	ctx := r.Context()
+	status := db.AccountStatus{Status: req.Status, Reason: req.Reason, ExpiresAt: req.ExpiresAt, DeleteAt: req.DeleteAt}
+	accountID, err := s.rdb.SetAccountStatusWithRetry(ctx, email, status)
+	if err != nil {
+		if errors.Is(err, consts.ErrInvalidInput) {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if errors.Is(err, consts.ErrUserNotFound) {
+			s.writeError(w, http.StatusNotFound, "Account not found")
+			return
+		}
+		logger.Warn("HTTP API: Error setting account status", "name", s.name, "email", email, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to set account status")
+		return
+	}
+
+	var kicked []string
+	if !db.AccountStatusAllowsLogin(req.Status) {
+		s.rdb.InvalidateAuthCacheForAccount(ctx, accountID)
+		for key, tracker := range s.connectionTrackers {
+			if tracker == nil {
+				continue
+			}
+			if err := tracker.KickUser(accountID, key); err != nil {
+				logger.Warn("HTTP API: Error kicking user on tracker", "name", s.name, "email", email, "tracker", key, "error", err)
+				continue
+			}
+			kicked = append(kicked, key)
+		}
+	}
+
+	logger.Info("HTTP API: Account status set", "name", s.name, "email", email, "account_id", accountID, "status", req.Status, "kicked", kicked)
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"email":     email,
+		"status":    req.Status,
+		"kicked_on": kicked,
+		"message":   "Account status updated successfully",
+	})
+}
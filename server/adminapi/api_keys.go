@@ -0,0 +1,525 @@
+package adminapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/migadu/sora/config"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+)
+
+// defaultAPIKeyName is the name of the key configured with api_key, which
+// has the admin scope.
+const defaultAPIKeyName = "default"
+
+// apiKey is a key the admin API accepts, either from the configuration or
+// from the admin_api_keys table.
+type apiKey struct {
+	db.AdminAPIKey
+	secret string // Only set for keys from the configuration
+	actor  string // Identifies the key in the audit log
+}
+
+type apiKeyContextKey struct{}
+
+// apiKeyFromContext returns the key a request was authenticated with.
+func apiKeyFromContext(ctx context.Context) *apiKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*apiKey)
+	return key
+}
+
+// allows reports whether the key grants scope. Read requests are also
+// granted by the read-only scope, except on routes that require admin.
+func (k *apiKey) allows(scope string, read bool) bool {
+	for _, granted := range k.Scopes {
+		if granted == db.APIKeyScopeAdmin || granted == scope {
+			return true
+		}
+		if granted == db.APIKeyScopeReadOnly && read && scope != db.APIKeyScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsTarget reports whether the key may act on an address, or a domain
+// given as "@domain".
+func (k *apiKey) allowsTarget(target string) bool {
+	if len(k.Domains) == 0 {
+		return true
+	}
+	idx := strings.LastIndex(target, "@")
+	if idx < 0 {
+		return false
+	}
+	return slices.Contains(k.Domains, strings.ToLower(target[idx+1:]))
+}
+
+// configAPIKeys validates the named keys of the configuration.
+func configAPIKeys(defaultKey string, keys []config.AdminAPIKeyConfig) ([]*apiKey, error) {
+	names := map[string]bool{defaultAPIKeyName: defaultKey != ""}
+	secrets := map[string]bool{defaultKey: defaultKey != ""}
+
+	result := make([]*apiKey, 0, len(keys))
+	for _, cfg := range keys {
+		key := &apiKey{
+			AdminAPIKey: db.AdminAPIKey{Name: cfg.Name, Scopes: cfg.Scopes, Domains: cfg.Domains},
+			secret:      cfg.Key,
+		}
+		if err := key.Normalize(); err != nil {
+			return nil, err
+		}
+		if key.secret == "" {
+			return nil, fmt.Errorf("API key %q has no key", key.Name)
+		}
+		if names[key.Name] {
+			return nil, fmt.Errorf("duplicate API key name %q", key.Name)
+		}
+		if secrets[key.secret] {
+			return nil, fmt.Errorf("API key %q reuses the key of another API key", key.Name)
+		}
+		names[key.Name] = true
+		secrets[key.secret] = true
+		key.actor = "api-key:" + key.Name
+		result = append(result, key)
+	}
+	return result, nil
+}
+
+// authenticate returns the key matching token, or nil if there is none.
+// Keys from the configuration are checked first; generated keys are looked
+// up in the database.
+func (s *Server) authenticate(ctx context.Context, token string) (*apiKey, error) {
+	s.keysMu.RLock()
+	defaultKey, keys := s.apiKey, s.apiKeys
+	s.keysMu.RUnlock()
+
+	if defaultKey != "" && subtle.ConstantTimeCompare([]byte(token), []byte(defaultKey)) == 1 {
+		return &apiKey{
+			AdminAPIKey: db.AdminAPIKey{Name: defaultAPIKeyName, Scopes: []string{db.APIKeyScopeAdmin}},
+			actor:       apiKeyFingerprint(defaultKey),
+		}, nil
+	}
+	for _, key := range keys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(key.secret)) == 1 {
+			return key, nil
+		}
+	}
+
+	if s.rdb == nil || !strings.HasPrefix(token, db.APIKeyPrefix) {
+		return nil, nil
+	}
+	stored, err := s.rdb.GetAdminAPIKeyBySecretWithRetry(ctx, token)
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if stored.LastUsedAt == nil || time.Since(*stored.LastUsedAt) > time.Minute {
+		s.rdb.RecordAdminAPIKeyUse(stored.ID)
+	}
+	return &apiKey{AdminAPIKey: *stored, actor: "api-key:" + stored.Name}, nil
+}
+
+// targetsFunc returns the addresses, and domains as "@domain", a request
+// acts on. It must read them from the parameters the route's handler uses.
+type targetsFunc func(r *http.Request) ([]string, error)
+
+// requireScope wraps a route so that it is only served for keys granting
+// scope and, for keys restricted to domains, only for targets in them.
+// Routes with nil targets act on the whole server and are refused to keys
+// restricted to domains.
+func (s *Server) requireScope(scope string, targets targetsFunc, next http.HandlerFunc) http.HandlerFunc {
+	return s.requireScopeFunc(func(*http.Request) string { return scope }, targets, next)
+}
+
+// requireScopeFunc is requireScope for routes whose scope depends on the
+// request.
+func (s *Server) requireScopeFunc(scopeFor func(r *http.Request) string, targets targetsFunc, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := apiKeyFromContext(r.Context())
+		if key == nil {
+			s.writeError(w, http.StatusForbidden, "Invalid API key")
+			return
+		}
+
+		scope := scopeFor(r)
+		read := r.Method == "GET" || r.Method == "HEAD" || r.Method == "OPTIONS"
+		if !key.allows(scope, read) {
+			s.writeError(w, http.StatusForbidden, fmt.Sprintf("API key %q does not grant the %s scope", key.Name, scope))
+			return
+		}
+
+		if len(key.Domains) > 0 {
+			var requestTargets []string
+			if targets != nil {
+				var err error
+				if requestTargets, err = targets(r); err != nil {
+					s.writeError(w, http.StatusBadRequest, "Failed to read request")
+					return
+				}
+			}
+			if len(requestTargets) == 0 {
+				s.writeError(w, http.StatusForbidden, fmt.Sprintf("API key %q is restricted to domains and can only be used for requests naming an account or domain", key.Name))
+				return
+			}
+			for _, target := range requestTargets {
+				if !key.allowsTarget(target) {
+					s.writeError(w, http.StatusForbidden, fmt.Sprintf("API key %q may not act on %s", key.Name, target))
+					return
+				}
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+// accountOperationScope returns the scope of a route below /admin/accounts/.
+// Restoring deleted messages puts mail back into a mailbox, so it requires
+// the mail-delivery scope rather than the accounts scope.
+func accountOperationScope(r *http.Request) string {
+	if strings.Contains(r.URL.Path, "/messages/") {
+		return db.APIKeyScopeMailDelivery
+	}
+	return db.APIKeyScopeAccounts
+}
+
+// nonEmpty returns the values that are not blank.
+func nonEmpty(values ...string) []string {
+	var result []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// pathTarget returns the address in the first path segment after prefix.
+func pathTarget(prefix string) targetsFunc {
+	return func(r *http.Request) ([]string, error) {
+		rest, _ := strings.CutPrefix(r.URL.Path, prefix)
+		return nonEmpty(strings.SplitN(rest, "/", 2)[0]), nil
+	}
+}
+
+// domainPathTarget returns the domain of /admin/domains/{domain}/...
+func domainPathTarget(r *http.Request) ([]string, error) {
+	rest, _ := strings.CutPrefix(r.URL.Path, "/admin/domains/")
+	if domain := strings.SplitN(rest, "/", 2)[0]; domain != "" {
+		return []string{"@" + domain}, nil
+	}
+	return nil, nil
+}
+
+// domainTargets returns the domain of /admin/domains/{domain}/... and the
+// addresses the request sends mail to: the catch-all of a domain update and
+// the targets of a new alias.
+func domainTargets(r *http.Request) ([]string, error) {
+	targets, _ := domainPathTarget(r)
+	rest, _ := strings.CutPrefix(r.URL.Path, "/admin/domains/")
+	var body targetsFunc
+	switch {
+	case r.Method == "PUT" && !strings.Contains(strings.Trim(rest, "/"), "/"):
+		body = catchAllTargets
+	case r.Method == "POST" && strings.HasSuffix(rest, "/aliases"):
+		body = aliasTargets
+	}
+	if body != nil {
+		bodyTargets, err := body(r)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, bodyTargets...)
+	}
+	return targets, nil
+}
+
+// aliasOperationTargets returns the alias of /admin/aliases/{address} and,
+// when replacing it, its targets.
+func aliasOperationTargets(r *http.Request) ([]string, error) {
+	targets, _ := pathTarget("/admin/aliases/")(r)
+	if r.Method == "PUT" {
+		bodyTargets, err := aliasTargets(r)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, bodyTargets...)
+	}
+	return targets, nil
+}
+
+// queryTarget returns the address in the query parameter name.
+func queryTarget(name string) targetsFunc {
+	return func(r *http.Request) ([]string, error) {
+		return nonEmpty(r.URL.Query().Get(name)), nil
+	}
+}
+
+// readBody returns the request body and leaves a copy for the handler.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// jsonTargets returns the targets of a JSON body decoded as the handler
+// decodes it. Bodies that cannot be decoded have no targets.
+func jsonTargets[T any](fields func(req *T) []string) targetsFunc {
+	return func(r *http.Request) ([]string, error) {
+		body, err := readBody(r)
+		if err != nil {
+			return nil, err
+		}
+		var req T
+		if len(body) == 0 || json.Unmarshal(body, &req) != nil {
+			return nil, nil
+		}
+		return fields(&req), nil
+	}
+}
+
+// methodTargets selects the targets of a route by request method. Methods
+// without targets act on the whole server, like listing all domains.
+func methodTargets(byMethod map[string]targetsFunc) targetsFunc {
+	return func(r *http.Request) ([]string, error) {
+		if targets := byMethod[r.Method]; targets != nil {
+			return targets(r)
+		}
+		return nil, nil
+	}
+}
+
+var createAccountTargets = jsonTargets(func(req *CreateAccountRequest) []string {
+	targets := nonEmpty(req.Email)
+	for _, c := range req.Credentials {
+		targets = append(targets, nonEmpty(c.Email)...)
+	}
+	return targets
+})
+
+var addCredentialTargets = jsonTargets(func(req *AddCredentialRequest) []string {
+	return nonEmpty(req.Email)
+})
+
+// accountTargets returns the account of /admin/accounts/{email}/... and,
+// when adding a credential, its address.
+func accountTargets(r *http.Request) ([]string, error) {
+	targets, _ := pathTarget("/admin/accounts/")(r)
+	if r.Method == "POST" && strings.Contains(r.URL.Path, "/credentials") {
+		credentials, err := addCredentialTargets(r)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, credentials...)
+	}
+	return targets, nil
+}
+
+var createDomainTargets = jsonTargets(func(req *DomainRequest) []string {
+	if name := strings.TrimSpace(req.Name); name != "" {
+		return append([]string{"@" + name}, nonEmpty(req.CatchAll)...)
+	}
+	return nil
+})
+
+var catchAllTargets = jsonTargets(func(req *DomainRequest) []string {
+	return nonEmpty(req.CatchAll)
+})
+
+var aliasTargets = jsonTargets(func(req *AliasRequest) []string {
+	return nonEmpty(req.Targets...)
+})
+
+var kickConnectionsTargets = jsonTargets(func(req *KickConnectionsRequest) []string {
+	return nonEmpty(req.UserEmail)
+})
+
+var affinitySetTargets = jsonTargets(func(req *AffinitySetRequest) []string {
+	return nonEmpty(req.User)
+})
+
+// aclIdentifierTargets returns the owner of the mailbox and the user the
+// rights are changed for, unless the rights are for "anyone".
+func aclIdentifierTargets(owner, identifier string) []string {
+	targets := nonEmpty(owner)
+	if strings.Contains(identifier, "@") {
+		targets = append(targets, strings.TrimSpace(identifier))
+	}
+	return targets
+}
+
+var aclGrantTargets = jsonTargets(func(req *ACLGrantRequest) []string {
+	return aclIdentifierTargets(req.Owner, req.Identifier)
+})
+
+var aclRevokeTargets = jsonTargets(func(req *ACLRevokeRequest) []string {
+	return aclIdentifierTargets(req.Owner, req.Identifier)
+})
+
+// mailDeliveryTargets returns the recipients handleDeliverMail reads for the
+// Content-Type of the request. Recipients the handler would take from the
+// message headers are not known here, so keys restricted to domains have to
+// name the recipients.
+func mailDeliveryTargets(r *http.Request) ([]string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/form-data"):
+		// The parsed form is kept on the request for the handler
+		if err := r.ParseMultipartForm(maxDeliverFormMemory); err != nil {
+			return nil, err
+		}
+		return nonEmpty(r.MultipartForm.Value["recipients"]...), nil
+	case mediaType == "message/rfc822" || mediaType == "text/plain":
+		if recipients := r.URL.Query().Get("recipients"); recipients != "" {
+			return nonEmpty(strings.Split(recipients, ",")...), nil
+		}
+		return nonEmpty(strings.Split(r.Header.Get("X-Recipients"), ",")...), nil
+	case mediaType == "application/json":
+		return jsonTargets(func(req *DeliverMailRequest) []string {
+			return nonEmpty(req.Recipients...)
+		})(r)
+	}
+	return nil, nil
+}
+
+// CreateAPIKeyRequest creates an admin API key.
+type CreateAPIKeyRequest struct {
+	Name    string   `json:"name"`
+	Scopes  []string `json:"scopes"`
+	Domains []string `json:"domains,omitempty"`
+}
+
+// ConfiguredAPIKey describes a key from the configuration file.
+type ConfiguredAPIKey struct {
+	Name    string   `json:"name"`
+	Scopes  []string `json:"scopes"`
+	Domains []string `json:"domains"`
+}
+
+// handleAPIKeyOperations handles DELETE /admin/api-keys/{id}
+func (s *Server) handleAPIKeyOperations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseInt(extractPathParam(r.URL.Path, "/admin/api-keys/", ""), 10, 64)
+	if err != nil || id <= 0 {
+		s.writeError(w, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	if err := s.rdb.DeleteAdminAPIKeyWithRetry(r.Context(), id); err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			s.writeError(w, http.StatusNotFound, "API key not found")
+			return
+		}
+		logger.Warn("HTTP API: Error revoking API key", "name", s.name, "id", id, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to revoke API key")
+		return
+	}
+
+	logger.Info("HTTP API: API key revoked", "name", s.name, "id", id)
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"message": "API key revoked successfully",
+		"id":      id,
+	})
+}
+
+// handleListAPIKeys handles GET /admin/api-keys. Keys themselves are never
+// returned.
+func (s *Server) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.rdb.ListAdminAPIKeysWithRetry(r.Context())
+	if err != nil {
+		logger.Warn("HTTP API: Error listing API keys", "name", s.name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to list API keys")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"configured": s.configuredAPIKeys(),
+		"api_keys":   keys,
+	})
+}
+
+// configuredAPIKeys lists the keys of the configuration file.
+func (s *Server) configuredAPIKeys() []ConfiguredAPIKey {
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+
+	configured := []ConfiguredAPIKey{}
+	if s.apiKey != "" {
+		configured = append(configured, ConfiguredAPIKey{Name: defaultAPIKeyName, Scopes: []string{db.APIKeyScopeAdmin}, Domains: []string{}})
+	}
+	for _, key := range s.apiKeys {
+		configured = append(configured, ConfiguredAPIKey{Name: key.Name, Scopes: key.Scopes, Domains: key.Domains})
+	}
+	return configured
+}
+
+// handleCreateAPIKey handles POST /admin/api-keys. The generated key is only
+// returned in this response.
+func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	// Names identify keys in the audit log, so they must not collide with
+	// the keys of the configuration file
+	for _, configured := range s.configuredAPIKeys() {
+		if strings.TrimSpace(req.Name) == configured.Name {
+			s.writeError(w, http.StatusConflict, "An API key with this name already exists")
+			return
+		}
+	}
+
+	key, secret, err := s.rdb.CreateAdminAPIKeyWithRetry(r.Context(), db.AdminAPIKey{
+		Name:    req.Name,
+		Scopes:  req.Scopes,
+		Domains: req.Domains,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, consts.ErrInvalidInput):
+			s.writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, consts.ErrDBUniqueViolation):
+			s.writeError(w, http.StatusConflict, "An API key with this name already exists")
+		default:
+			logger.Warn("HTTP API: Error creating API key", "name", s.name, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "Failed to create API key")
+		}
+		return
+	}
+
+	logger.Info("HTTP API: API key created", "name", s.name, "key_name", key.Name, "scopes", key.Scopes, "domains", key.Domains)
+	s.writeJSON(w, http.StatusCreated, map[string]any{
+		"api_key": key,
+		"key":     secret,
+	})
+}
@@ -0,0 +1,231 @@
+package adminapi
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/migadu/sora/config"
+)
+
+func testAPIKeyServer(t *testing.T, keys ...config.AdminAPIKeyConfig) *Server {
+	t.Helper()
+	apiKeys, err := configAPIKeys("admin-key", keys)
+	if err != nil {
+		t.Fatalf("configAPIKeys: %v", err)
+	}
+	return &Server{apiKey: "admin-key", apiKeys: apiKeys}
+}
+
+func TestConfigAPIKeys(t *testing.T) {
+	keys, err := configAPIKeys("", []config.AdminAPIKeyConfig{
+		{Name: " support ", Key: "k1", Scopes: []string{"Read-Only", "accounts", "accounts"}, Domains: []string{"@Example.com"}},
+	})
+	if err != nil {
+		t.Fatalf("configAPIKeys: %v", err)
+	}
+	if len(keys) != 1 || keys[0].Name != "support" || keys[0].actor != "api-key:support" {
+		t.Fatalf("unexpected keys %+v", keys)
+	}
+	if strings.Join(keys[0].Scopes, ",") != "read-only,accounts" || strings.Join(keys[0].Domains, ",") != "example.com" {
+		t.Errorf("unexpected scopes %v and domains %v", keys[0].Scopes, keys[0].Domains)
+	}
+
+	invalid := [][]config.AdminAPIKeyConfig{
+		{{Name: "x", Key: "k1", Scopes: []string{"root"}}},
+		{{Name: "x", Key: "", Scopes: []string{"cache"}}},
+		{{Name: "x", Key: "k1", Scopes: nil}},
+		{{Name: "default", Key: "k1", Scopes: []string{"cache"}}},
+		{{Name: "x", Key: "admin-key", Scopes: []string{"cache"}}},
+		{{Name: "x", Key: "k1", Scopes: []string{"cache"}}, {Name: "x", Key: "k2", Scopes: []string{"cache"}}},
+	}
+	for _, keys := range invalid {
+		if _, err := configAPIKeys("admin-key", keys); err == nil {
+			t.Errorf("configAPIKeys(%+v) should fail", keys)
+		}
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	server := testAPIKeyServer(t, config.AdminAPIKeyConfig{Name: "support", Key: "support-key", Scopes: []string{"read-only"}})
+
+	key, err := server.authenticate(context.Background(), "admin-key")
+	if err != nil || key == nil || key.Name != defaultAPIKeyName || key.actor != apiKeyFingerprint("admin-key") {
+		t.Fatalf("default key: %+v, %v", key, err)
+	}
+	key, err = server.authenticate(context.Background(), "support-key")
+	if err != nil || key == nil || key.Name != "support" {
+		t.Fatalf("named key: %+v, %v", key, err)
+	}
+	key, err = server.authenticate(context.Background(), "sora_unknown")
+	if err != nil || key != nil {
+		t.Fatalf("unknown key: %+v, %v", key, err)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	server := testAPIKeyServer(t,
+		config.AdminAPIKeyConfig{Name: "support", Key: "support-key", Scopes: []string{"read-only", "connections"}},
+		config.AdminAPIKeyConfig{Name: "reseller", Key: "reseller-key", Scopes: []string{"read-only", "accounts", "acl", "mail-delivery"}, Domains: []string{"example.com"}},
+	)
+
+	domains := methodTargets(map[string]targetsFunc{"POST": createDomainTargets})
+	tests := []struct {
+		name, key, scope, method, path, body string
+		targets                              targetsFunc
+		allowed                              bool
+	}{
+		{"admin may manage keys", "admin-key", "admin", "GET", "/admin/api-keys", "", nil, true},
+		{"read-only may read", "support-key", "accounts", "GET", "/admin/accounts/user@example.com", "", accountTargets, true},
+		{"read-only may not list keys", "support-key", "admin", "GET", "/admin/api-keys", "", nil, false},
+		{"read-only may not delete", "support-key", "accounts", "DELETE", "/admin/accounts/user@example.com", "", accountTargets, false},
+		{"scope grants writes", "support-key", "connections", "POST", "/admin/connections/kick", `{"user_email":"user@example.com"}`, kickConnectionsTargets, true},
+		{"other scopes are denied", "support-key", "cache", "POST", "/admin/cache/purge", "", nil, false},
+		{"domain in path", "reseller-key", "accounts", "DELETE", "/admin/accounts/user@example.com", "", accountTargets, true},
+		{"other domain in path", "reseller-key", "accounts", "DELETE", "/admin/accounts/user@example.org", "", accountTargets, false},
+		{"new credential in other domain", "reseller-key", "accounts", "POST", "/admin/accounts/user@example.com/credentials", `{"email":"alias@example.org"}`, accountTargets, false},
+		{"domain route", "reseller-key", "accounts", "PUT", "/admin/domains/example.com", "{}", domainTargets, true},
+		{"catch-all in domain", "reseller-key", "accounts", "PUT", "/admin/domains/example.com", `{"catch_all":"postmaster@example.com"}`, domainTargets, true},
+		{"catch-all in other domain", "reseller-key", "accounts", "PUT", "/admin/domains/example.com", `{"catch_all":"postmaster@example.org"}`, domainTargets, false},
+		{"domain quota", "reseller-key", "accounts", "PUT", "/admin/domains/example.com/quota", `{"catch_all":"ignored@example.org"}`, domainTargets, true},
+		{"alias targets in domain", "reseller-key", "accounts", "POST", "/admin/domains/example.com/aliases", `{"address":"sales@example.com","targets":["a@example.com","b@example.com"]}`, domainTargets, true},
+		{"alias target in other domain", "reseller-key", "accounts", "POST", "/admin/domains/example.com/aliases", `{"address":"sales@example.com","targets":["a@example.com","b@example.org"]}`, domainTargets, false},
+		{"updated alias target in other domain", "reseller-key", "accounts", "PUT", "/admin/aliases/sales@example.com", `{"targets":["b@example.org"]}`, aliasOperationTargets, false},
+		{"deleting an alias", "reseller-key", "accounts", "DELETE", "/admin/aliases/sales@example.com", "", aliasOperationTargets, true},
+		{"new domain with catch-all elsewhere", "reseller-key", "accounts", "POST", "/admin/domains", `{"name":"example.com","catch_all":"x@example.org"}`, domains, false},
+		{"domain in body", "reseller-key", "accounts", "POST", "/admin/accounts", `{"email":"new@example.com"}`, createAccountTargets, true},
+		{"other domain in body", "reseller-key", "accounts", "POST", "/admin/accounts", `{"email":"new@example.com","credentials":[{"email":"alias@example.org"}]}`, createAccountTargets, false},
+		{"new domain", "reseller-key", "accounts", "POST", "/admin/domains", `{"name":"example.org"}`, domains, false},
+		{"listing domains", "reseller-key", "accounts", "GET", "/admin/domains", "", domains, false},
+		{"all recipients", "reseller-key", "mail-delivery", "POST", "/admin/mail/deliver", `{"recipients":["a@example.com","b@example.org"]}`, mailDeliveryTargets, false},
+		{"recipients in query", "reseller-key", "mail-delivery", "POST", "/admin/mail/deliver?recipients=a@example.com", "raw message", mailDeliveryTargets, true},
+		{"recipients from headers", "reseller-key", "mail-delivery", "POST", "/admin/mail/deliver", "To: a@example.com\r\n\r\nbody", mailDeliveryTargets, false},
+		{"routes for the whole server", "reseller-key", "connections", "GET", "/admin/affinity/list?user=a@example.com", "", nil, false},
+		{"unrelated query parameters", "reseller-key", "read-only", "GET", "/admin/audit?user=a@example.com", "", queryTarget("account"), false},
+		{"account the handler filters on", "reseller-key", "read-only", "GET", "/admin/audit?account=a@example.com", "", queryTarget("account"), true},
+		{"ACL for a user of another domain", "reseller-key", "acl", "POST", "/admin/mailboxes/acl/grant", `{"owner":"a@example.com","mailbox":"Shared","identifier":"b@example.org","rights":"lr"}`, aclGrantTargets, false},
+		{"ACL for anyone", "reseller-key", "acl", "POST", "/admin/mailboxes/acl/grant", `{"owner":"a@example.com","mailbox":"Shared","identifier":"anyone","rights":"lr"}`, aclGrantTargets, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received string
+			handler := server.authMiddleware(server.requireScope(tt.scope, tt.targets, func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				received = string(body)
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+			if strings.HasPrefix(tt.path, "/admin/mail/deliver") {
+				if strings.HasPrefix(tt.body, "{") {
+					req.Header.Set("Content-Type", "application/json")
+				} else {
+					req.Header.Set("Content-Type", "message/rfc822")
+				}
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if allowed := rr.Code == http.StatusOK; allowed != tt.allowed {
+				t.Fatalf("status %d, body %s", rr.Code, rr.Body.String())
+			}
+			if tt.allowed && received != tt.body {
+				t.Errorf("handler received body %q, want %q", received, tt.body)
+			}
+		})
+	}
+}
+
+func TestMailDeliveryTargetsMultipart(t *testing.T) {
+	server := testAPIKeyServer(t,
+		config.AdminAPIKeyConfig{Name: "reseller", Key: "reseller-key", Scopes: []string{"mail-delivery"}, Domains: []string{"example.com"}},
+	)
+
+	for _, tt := range []struct {
+		recipients []string
+		allowed    bool
+	}{
+		{[]string{"a@example.com"}, true},
+		{[]string{"a@example.com", "b@example.org"}, false},
+		{nil, false},
+	} {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("message", "Subject: test\r\n\r\nbody")
+		for _, recipient := range tt.recipients {
+			mw.WriteField("recipients", recipient)
+		}
+		mw.Close()
+
+		var received []string
+		handler := server.authMiddleware(server.requireScope("mail-delivery", mailDeliveryTargets, func(w http.ResponseWriter, r *http.Request) {
+			// The handler parses the form again, as handleDeliverMail does
+			if err := r.ParseMultipartForm(maxDeliverFormMemory); err != nil {
+				t.Errorf("ParseMultipartForm: %v", err)
+			}
+			received = r.MultipartForm.Value["recipients"]
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		req := httptest.NewRequest("POST", "/admin/mail/deliver", &body)
+		req.Header.Set("Authorization", "Bearer reseller-key")
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if allowed := rr.Code == http.StatusOK; allowed != tt.allowed {
+			t.Errorf("recipients %v: status %d, body %s", tt.recipients, rr.Code, rr.Body.String())
+		}
+		if tt.allowed && strings.Join(received, ",") != strings.Join(tt.recipients, ",") {
+			t.Errorf("handler received recipients %v, want %v", received, tt.recipients)
+		}
+	}
+}
+
+func TestAccountOperationScope(t *testing.T) {
+	tests := map[string]string{
+		"/admin/accounts/user@example.com":                  "accounts",
+		"/admin/accounts/user@example.com/app-passwords":    "accounts",
+		"/admin/accounts/user@example.com/messages/deleted": "mail-delivery",
+		"/admin/accounts/user@example.com/messages/restore": "mail-delivery",
+	}
+	for path, want := range tests {
+		if scope := accountOperationScope(httptest.NewRequest("GET", path, nil)); scope != want {
+			t.Errorf("accountOperationScope(%s) = %s, want %s", path, scope, want)
+		}
+	}
+}
+
+func TestReloadConfigAPIKeys(t *testing.T) {
+	server := testAPIKeyServer(t)
+
+	err := server.ReloadConfig(config.ServerConfig{
+		APIKeys: []config.AdminAPIKeyConfig{{Name: "ops", Key: "ops-key", Scopes: []string{"cache"}}},
+	})
+	if err != nil {
+		t.Fatalf("ReloadConfig: %v", err)
+	}
+	if key, _ := server.authenticate(context.Background(), "ops-key"); key == nil || key.Name != "ops" {
+		t.Errorf("reloaded key not accepted: %+v", key)
+	}
+	if key, _ := server.authenticate(context.Background(), "admin-key"); key == nil {
+		t.Errorf("api_key must be kept when it is not set")
+	}
+
+	err = server.ReloadConfig(config.ServerConfig{
+		APIKeys: []config.AdminAPIKeyConfig{{Name: "ops", Key: "ops-key", Scopes: []string{"everything"}}},
+	})
+	if err == nil {
+		t.Fatal("ReloadConfig should reject invalid keys")
+	}
+	if key, _ := server.authenticate(context.Background(), "ops-key"); key == nil || key.Scopes[0] != "cache" {
+		t.Errorf("invalid config must not replace the keys: %+v", key)
+	}
+}
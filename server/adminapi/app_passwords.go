@@ -0,0 +1,172 @@
+package adminapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+)
+
+// CreateAppPasswordRequest creates an app password for an account.
+type CreateAppPasswordRequest struct {
+	Name       string   `json:"name"`
+	Protocols  []string `json:"protocols"`
+	AllowedIPs []string `json:"allowed_ips,omitempty"`
+}
+
+// handleAppPasswordOperations routes /admin/accounts/{email}/app-passwords and
+// /admin/accounts/{email}/app-passwords/{id}.
+func (s *Server) handleAppPasswordOperations(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/admin/accounts/")
+	idx := strings.Index(rest, "/app-passwords")
+	email := rest[:idx]
+	idPart := strings.TrimPrefix(strings.TrimPrefix(rest[idx:], "/app-passwords"), "/")
+
+	if idPart == "" {
+		switch r.Method {
+		case "GET":
+			s.handleListAppPasswords(w, r, email)
+		case "POST":
+			s.handleCreateAppPassword(w, r, email)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+	if r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil || id <= 0 {
+		s.writeError(w, http.StatusBadRequest, "Invalid app password ID")
+		return
+	}
+	s.handleDeleteAppPassword(w, r, email, id)
+}
+
+// lookupAccountID resolves an account address, writing the error response
+// and returning false if it cannot be resolved.
+func (s *Server) lookupAccountID(w http.ResponseWriter, r *http.Request, email string) (int64, bool) {
+	accountID, err := s.rdb.GetAccountIDByAddressWithRetry(r.Context(), email)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserNotFound) {
+			s.writeError(w, http.StatusNotFound, "Account not found")
+			return 0, false
+		}
+		logger.Warn("HTTP API: Error getting account ID", "name", s.name, "email", email, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to find account")
+		return 0, false
+	}
+	return accountID, true
+}
+
+// handleListAppPasswords handles GET /admin/accounts/{email}/app-passwords
+func (s *Server) handleListAppPasswords(w http.ResponseWriter, r *http.Request, email string) {
+	accountID, ok := s.lookupAccountID(w, r, email)
+	if !ok {
+		return
+	}
+
+	appPasswords, err := s.rdb.ListAppPasswordsWithRetry(r.Context(), accountID)
+	if err != nil {
+		logger.Warn("HTTP API: Error listing app passwords", "name", s.name, "email", email, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to list app passwords")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"email":         email,
+		"app_passwords": appPasswords,
+		"count":         len(appPasswords),
+	})
+}
+
+// handleCreateAppPassword handles POST /admin/accounts/{email}/app-passwords.
+// The generated password is only returned in this response.
+func (s *Server) handleCreateAppPassword(w http.ResponseWriter, r *http.Request, email string) {
+	defer r.Body.Close()
+
+	var req CreateAppPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	accountID, ok := s.lookupAccountID(w, r, email)
+	if !ok {
+		return
+	}
+
+	appPassword, secret, err := s.rdb.CreateAppPasswordWithRetry(r.Context(), accountID, db.AppPassword{
+		Name:       req.Name,
+		Protocols:  req.Protocols,
+		AllowedIPs: req.AllowedIPs,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, consts.ErrInvalidInput):
+			s.writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, consts.ErrDBUniqueViolation):
+			s.writeError(w, http.StatusConflict, "An app password with this name already exists")
+		case errors.Is(err, consts.ErrUserNotFound):
+			s.writeError(w, http.StatusNotFound, "Account not found")
+		default:
+			logger.Warn("HTTP API: Error creating app password", "name", s.name, "email", email, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "Failed to create app password")
+		}
+		return
+	}
+
+	logger.Info("HTTP API: App password created", "name", s.name, "email", email, "app_password_id", appPassword.ID, "protocols", appPassword.Protocols)
+	s.writeJSON(w, http.StatusCreated, map[string]any{
+		"email":        email,
+		"app_password": appPassword,
+		"password":     secret,
+	})
+}
+
+// handleDeleteAppPassword handles DELETE /admin/accounts/{email}/app-passwords/{id}.
+// Sessions of the account are kicked on every connection tracker, which
+// broadcasts the kick cluster-wide and drops cached credentials on each node.
+func (s *Server) handleDeleteAppPassword(w http.ResponseWriter, r *http.Request, email string, id int64) {
+	accountID, ok := s.lookupAccountID(w, r, email)
+	if !ok {
+		return
+	}
+
+	if err := s.rdb.DeleteAppPasswordWithRetry(r.Context(), accountID, id); err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			s.writeError(w, http.StatusNotFound, "App password not found")
+			return
+		}
+		logger.Warn("HTTP API: Error deleting app password", "name", s.name, "email", email, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to delete app password")
+		return
+	}
+
+	var kicked []string
+	for key, tracker := range s.connectionTrackers {
+		if tracker == nil {
+			continue
+		}
+		if err := tracker.KickUser(accountID, key); err != nil {
+			logger.Warn("HTTP API: Error kicking user on tracker", "name", s.name, "email", email, "tracker", key, "error", err)
+			continue
+		}
+		kicked = append(kicked, key)
+	}
+
+	logger.Info("HTTP API: App password revoked", "name", s.name, "email", email, "app_password_id", id, "kicked", kicked)
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"email":     email,
+		"id":        id,
+		"kicked_on": kicked,
+		"message":   "App password revoked successfully",
+	})
+}
@@ -0,0 +1,394 @@
+package adminapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+)
+
+// auditRoute maps a mutating endpoint to the action recorded in the audit log.
+// In patterns, {account} and {domain} match one path segment that becomes the
+// target account ("@domain" for domains); {id} matches any segment.
+type auditRoute struct {
+	method  string
+	pattern string
+	action  string
+}
+
+var auditRoutes = []auditRoute{
+	{"POST", "/admin/accounts", "account.create"},
+	{"PUT", "/admin/accounts/{account}", "account.update"},
+	{"DELETE", "/admin/accounts/{account}", "account.delete"},
+	{"POST", "/admin/accounts/{account}/restore", "account.restore"},
+	{"PUT", "/admin/accounts/{account}/quota", "account.quota.set"},
+	{"PUT", "/admin/accounts/{account}/status", "account.status.set"},
+	{"POST", "/admin/accounts/{account}/credentials", "credential.add"},
+	{"POST", "/admin/accounts/{account}/app-passwords", "app_password.create"},
+	{"DELETE", "/admin/accounts/{account}/app-passwords/{id}", "app_password.delete"},
+	{"DELETE", "/admin/accounts/{account}/totp", "totp.reset"},
+	{"POST", "/admin/accounts/{account}/messages/restore", "messages.restore"},
+	{"DELETE", "/admin/credentials/{account}", "credential.delete"},
+	{"POST", "/admin/domains", "domain.create"},
+	{"PUT", "/admin/domains/{domain}", "domain.update"},
+	{"DELETE", "/admin/domains/{domain}", "domain.delete"},
+	{"POST", "/admin/domains/{domain}/aliases", "alias.create"},
+	{"PUT", "/admin/aliases/{account}", "alias.update"},
+	{"DELETE", "/admin/aliases/{account}", "alias.delete"},
+	{"PUT", "/admin/domains/{domain}/quota", "domain.quota.set"},
+	{"DELETE", "/admin/domains/{domain}/quota", "domain.quota.delete"},
+	{"POST", "/admin/connections/kick", "connections.kick"},
+	{"POST", "/admin/cache/purge", "cache.purge"},
+	{"POST", "/admin/mail/deliver", "mail.deliver"},
+	{"POST", "/admin/mailboxes/acl/grant", "acl.grant"},
+	{"POST", "/admin/mailboxes/acl/revoke", "acl.revoke"},
+	{"POST", "/admin/affinity", "affinity.set"},
+	{"DELETE", "/admin/affinity", "affinity.delete"},
+	{"POST", "/admin/events/subscriptions", "event_subscription.create"},
+	{"PUT", "/admin/events/subscriptions/{id}", "event_subscription.update"},
+	{"DELETE", "/admin/events/subscriptions/{id}", "event_subscription.delete"},
+	{"POST", "/admin/api-keys", "api_key.create"},
+	{"DELETE", "/admin/api-keys/{id}", "api_key.delete"},
+	{"POST", "/admin/sieve/scripts", "global_sieve.create"},
+	{"PUT", "/admin/sieve/scripts/{id}", "global_sieve.update"},
+	{"DELETE", "/admin/sieve/scripts/{id}", "global_sieve.delete"},
+}
+
+// matchAuditRoute returns the audit action and the target account taken from
+// the path. Unknown endpoints are recorded as "<method> <path>" so that no
+// mutating request goes unrecorded.
+func matchAuditRoute(method, path string) (action, account string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for _, route := range auditRoutes {
+		if route.method != method {
+			continue
+		}
+		pattern := strings.Split(strings.Trim(route.pattern, "/"), "/")
+		if len(pattern) != len(segments) {
+			continue
+		}
+
+		matched := true
+		target := ""
+		for i, p := range pattern {
+			seg := segments[i]
+			switch p {
+			case "{account}", "{domain}", "{id}":
+				if seg == "" {
+					matched = false
+				}
+				if unescaped, err := url.PathUnescape(seg); err == nil {
+					seg = unescaped
+				}
+				if p == "{account}" {
+					target = seg
+				} else if p == "{domain}" {
+					target = "@" + seg
+				}
+			default:
+				if p != seg {
+					matched = false
+				}
+			}
+			if !matched {
+				break
+			}
+		}
+		if matched {
+			return route.action, target
+		}
+	}
+
+	return strings.ToLower(method) + " " + path, ""
+}
+
+// auditBodyTarget holds the request body fields that identify the target of
+// an operation whose path does not.
+type auditBodyTarget struct {
+	Email       string   `json:"email"`
+	Owner       string   `json:"owner"`
+	User        string   `json:"user"`
+	UserEmail   string   `json:"user_email"`
+	Account     string   `json:"account"`
+	Mailbox     string   `json:"mailbox"`
+	Recipients  []string `json:"recipients"`
+	Credentials []struct {
+		Email string `json:"email"`
+	} `json:"credentials"`
+}
+
+// bodyTarget extracts the target account and mailbox from a JSON request body.
+func bodyTarget(body []byte) (account, mailbox string) {
+	var t auditBodyTarget
+	if len(body) == 0 || json.Unmarshal(body, &t) != nil {
+		return "", ""
+	}
+	for _, candidate := range []string{t.Email, t.Owner, t.User, t.UserEmail, t.Account} {
+		if candidate != "" {
+			account = candidate
+			break
+		}
+	}
+	if account == "" && len(t.Credentials) > 0 {
+		account = t.Credentials[0].Email
+	}
+	if account == "" && len(t.Recipients) == 1 {
+		account = t.Recipients[0]
+	}
+	return account, t.Mailbox
+}
+
+// secretFields are the JSON fields whose values are redacted before a request
+// body is hashed.
+var secretFields = []string{"password", "password_hash", "secret"}
+
+// redactBody returns a JSON body with the values of secretFields replaced at
+// any depth, so that the payload hash cannot be used to recover a short or
+// common password by hashing candidates with the rest of the body. Bodies
+// that are not JSON are returned unchanged.
+func redactBody(body []byte) []byte {
+	var v any
+	if len(body) == 0 || json.Unmarshal(body, &v) != nil {
+		return body
+	}
+	redacted, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return body
+	}
+	return redacted
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if slices.Contains(secretFields, key) {
+				v[key] = "REDACTED"
+			} else {
+				v[key] = redactValue(value)
+			}
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+	}
+	return v
+}
+
+// auditResponseWriter records the status code and, for failed requests, the
+// beginning of the response body so that the error message can be logged.
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+const maxAuditErrorBody = 1024
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status >= 400 && w.body.Len() < maxAuditErrorBody {
+		w.body.Write(b[:min(len(b), maxAuditErrorBody-w.body.Len())])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// errorMessage returns the "error" field of a JSON error response, or the
+// plain text body.
+func (w *auditResponseWriter) errorMessage() string {
+	var resp struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(w.body.Bytes(), &resp) == nil && resp.Error != "" {
+		return resp.Error
+	}
+	return strings.TrimSpace(w.body.String())
+}
+
+// apiKeyFingerprint identifies the api_key key in the audit log without
+// storing it. Named keys are identified by their name.
+func apiKeyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "api-key:" + hex.EncodeToString(sum[:])[:12]
+}
+
+// auditMiddleware records every authenticated POST, PUT and DELETE request in
+// the admin audit log after it has been handled.
+func (s *Server) auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" && r.Method != "PUT" && r.Method != "DELETE" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = io.ReadAll(r.Body)
+			r.Body.Close()
+			if err != nil {
+				s.writeError(w, http.StatusBadRequest, "Failed to read request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		rw := &auditResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+
+		action, account := matchAuditRoute(r.Method, r.URL.Path)
+		bodyAccount, mailbox := bodyTarget(body)
+		if account == "" {
+			account = bodyAccount
+		}
+		sum := sha256.Sum256(redactBody(body))
+		actor := "api-key:unknown"
+		if key := apiKeyFromContext(r.Context()); key != nil {
+			actor = key.actor
+		}
+
+		entry := db.AdminAuditEntry{
+			Actor:         actor,
+			Source:        db.AuditSourceAPI,
+			SourceIP:      getClientIP(r),
+			Action:        action,
+			TargetAccount: account,
+			TargetMailbox: mailbox,
+			PayloadHash:   hex.EncodeToString(sum[:]),
+			Result:        db.AuditResultSuccess,
+			StatusCode:    rw.status,
+		}
+		if entry.StatusCode == 0 {
+			entry.StatusCode = http.StatusOK
+		}
+		if entry.StatusCode >= 400 {
+			entry.Result = db.AuditResultFailure
+			entry.Error = rw.errorMessage()
+		}
+
+		s.recordAudit(r.Context(), entry)
+	})
+}
+
+// recordAudit writes an audit entry. The request has already been answered,
+// so a failure is logged rather than reported to the client.
+func (s *Server) recordAudit(ctx context.Context, entry db.AdminAuditEntry) {
+	if s.rdb == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+
+	if _, err := s.rdb.InsertAdminAuditEntryWithRetry(ctx, entry); err != nil {
+		logger.Warn("HTTP API: Failed to record audit entry", "name", s.name, "action", entry.Action,
+			"account", entry.TargetAccount, "status", entry.StatusCode, "error", err)
+	}
+}
+
+// handleListAudit handles GET /admin/audit
+func (s *Server) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := db.AdminAuditFilter{
+		Actor:   query.Get("actor"),
+		Action:  query.Get("action"),
+		Account: query.Get("account"),
+		Source:  query.Get("source"),
+		Result:  query.Get("result"),
+	}
+
+	for name, dst := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := query.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				s.writeError(w, http.StatusBadRequest, "Invalid "+name+" parameter (expected RFC3339)")
+				return
+			}
+			*dst = t
+		}
+	}
+	if v := query.Get("before_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			s.writeError(w, http.StatusBadRequest, "Invalid before_id parameter")
+			return
+		}
+		filter.BeforeID = id
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			s.writeError(w, http.StatusBadRequest, "Invalid limit parameter")
+			return
+		}
+		filter.Limit = limit
+	}
+	if filter.Source != "" && filter.Source != db.AuditSourceAPI && filter.Source != db.AuditSourceCLI {
+		s.writeError(w, http.StatusBadRequest, "source must be 'api' or 'cli'")
+		return
+	}
+	if filter.Result != "" && filter.Result != db.AuditResultSuccess && filter.Result != db.AuditResultFailure {
+		s.writeError(w, http.StatusBadRequest, "result must be 'success' or 'failure'")
+		return
+	}
+
+	format := query.Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+		format = "jsonl"
+	}
+	if format != "" && format != "json" && format != "jsonl" {
+		s.writeError(w, http.StatusBadRequest, "format must be 'json' or 'jsonl'")
+		return
+	}
+
+	entries, err := s.rdb.ListAdminAuditEntriesWithRetry(r.Context(), filter)
+	if err != nil {
+		logger.Warn("HTTP API: Error listing audit entries", "name", s.name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to list audit entries")
+		return
+	}
+
+	if format == "jsonl" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(w)
+		for _, entry := range entries {
+			if err := enc.Encode(entry); err != nil {
+				logger.Warn("HTTP API: Error encoding audit entry", "name", s.name, "error", err)
+				return
+			}
+		}
+		return
+	}
+
+	response := map[string]any{
+		"entries": entries,
+		"total":   len(entries),
+	}
+	// Pagination cursor: pass as before_id to get the next (older) page
+	if len(entries) > 0 {
+		response["next_before_id"] = entries[len(entries)-1].ID
+	}
+	s.writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,130 @@
+package adminapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMatchAuditRoute(t *testing.T) {
+	tests := []struct {
+		method, path    string
+		action, account string
+	}{
+		{"POST", "/admin/accounts", "account.create", ""},
+		{"DELETE", "/admin/accounts/user@example.com", "account.delete", "user@example.com"},
+		{"PUT", "/admin/accounts/user%40example.com", "account.update", "user@example.com"},
+		{"POST", "/admin/accounts/user@example.com/messages/restore", "messages.restore", "user@example.com"},
+		{"PUT", "/admin/accounts/user@example.com/status", "account.status.set", "user@example.com"},
+		{"POST", "/admin/accounts/user@example.com/app-passwords", "app_password.create", "user@example.com"},
+		{"DELETE", "/admin/accounts/user@example.com/app-passwords/7", "app_password.delete", "user@example.com"},
+		{"DELETE", "/admin/accounts/user@example.com/totp", "totp.reset", "user@example.com"},
+		{"PUT", "/admin/domains/example.com/quota", "domain.quota.set", "@example.com"},
+		{"PUT", "/admin/domains/example.com", "domain.update", "@example.com"},
+		{"POST", "/admin/domains/example.com/aliases", "alias.create", "@example.com"},
+		{"DELETE", "/admin/aliases/sales@example.com", "alias.delete", "sales@example.com"},
+		{"POST", "/admin/cache/purge", "cache.purge", ""},
+		{"DELETE", "/admin/events/subscriptions/7", "event_subscription.delete", ""},
+		{"DELETE", "/admin/api-keys/3", "api_key.delete", ""},
+		{"PUT", "/admin/sieve/scripts/5", "global_sieve.update", ""},
+		{"POST", "/admin/unknown", "post /admin/unknown", ""},
+	}
+
+	for _, tt := range tests {
+		action, account := matchAuditRoute(tt.method, tt.path)
+		if action != tt.action || account != tt.account {
+			t.Errorf("matchAuditRoute(%s, %s) = (%q, %q), want (%q, %q)",
+				tt.method, tt.path, action, account, tt.action, tt.account)
+		}
+	}
+}
+
+func TestBodyTarget(t *testing.T) {
+	tests := []struct {
+		body             string
+		account, mailbox string
+	}{
+		{`{"owner":"owner@example.com","mailbox":"Shared/Sales","identifier":"anyone"}`, "owner@example.com", "Shared/Sales"},
+		{`{"user_email":"user@example.com"}`, "user@example.com", ""},
+		{`{"credentials":[{"email":"first@example.com"},{"email":"second@example.com"}]}`, "first@example.com", ""},
+		{`{"recipients":["rcpt@example.com"],"message":"..."}`, "rcpt@example.com", ""},
+		{`{"recipients":["a@example.com","b@example.com"]}`, "", ""},
+		{`not json`, "", ""},
+		{``, "", ""},
+	}
+
+	for _, tt := range tests {
+		account, mailbox := bodyTarget([]byte(tt.body))
+		if account != tt.account || mailbox != tt.mailbox {
+			t.Errorf("bodyTarget(%s) = (%q, %q), want (%q, %q)", tt.body, account, mailbox, tt.account, tt.mailbox)
+		}
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		body, want string
+	}{
+		{`{"email":"user@example.com","password":"hunter2"}`, `{"email":"user@example.com","password":"REDACTED"}`},
+		{`{"credentials":[{"email":"a@example.com","password_hash":"$2a$10$abc"}]}`, `{"credentials":[{"email":"a@example.com","password_hash":"REDACTED"}]}`},
+		{`{"url":"https://example.com/hook","secret":"s3cret"}`, `{"secret":"REDACTED","url":"https://example.com/hook"}`},
+		{`not json`, `not json`},
+		{``, ``},
+	}
+
+	for _, tt := range tests {
+		if got := string(redactBody([]byte(tt.body))); got != tt.want {
+			t.Errorf("redactBody(%s) = %s, want %s", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestAuditMiddlewarePreservesBody(t *testing.T) {
+	server := &Server{apiKey: "test-key"}
+
+	var received string
+	handler := server.auditMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		server.writeError(w, http.StatusNotFound, "Account not found")
+	}))
+
+	req := httptest.NewRequest("DELETE", "/admin/accounts/user@example.com", strings.NewReader(`{"x":1}`))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if received != `{"x":1}` {
+		t.Errorf("handler received body %q", received)
+	}
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rr.Code)
+	}
+}
+
+func TestAuditResponseWriterErrorMessage(t *testing.T) {
+	server := &Server{}
+	rw := &auditResponseWriter{ResponseWriter: httptest.NewRecorder()}
+	server.writeError(rw, http.StatusBadRequest, "Invalid JSON body")
+
+	if rw.status != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", rw.status)
+	}
+	if msg := rw.errorMessage(); msg != "Invalid JSON body" {
+		t.Errorf("expected error message %q, got %q", "Invalid JSON body", msg)
+	}
+}
+
+func TestAPIKeyFingerprint(t *testing.T) {
+	fp := apiKeyFingerprint("secret-key")
+	if !strings.HasPrefix(fp, "api-key:") || len(fp) != len("api-key:")+12 {
+		t.Errorf("unexpected fingerprint %q", fp)
+	}
+	if strings.Contains(fp, "secret") {
+		t.Errorf("fingerprint must not contain the key")
+	}
+	if fp == apiKeyFingerprint("other-key") {
+		t.Errorf("different keys must have different fingerprints")
+	}
+}
@@ -0,0 +1,358 @@
+package adminapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+)
+
+// DomainRequest creates or replaces a domain. Name is taken from the path on
+// update. Omitted fields get their defaults, so an update must send the full
+// domain.
+type DomainRequest struct {
+	Name            string   `json:"name,omitempty"`
+	Status          string   `json:"status,omitempty"`           // "active" (default) or "suspended"
+	MaxAccounts     *int     `json:"max_accounts,omitempty"`     // Omit for unlimited
+	CatchAll        string   `json:"catch_all,omitempty"`        // Omit for no catch-all
+	SieveExtensions []string `json:"sieve_extensions,omitempty"` // Omit for all server extensions
+	SharedMailboxes *bool    `json:"shared_mailboxes,omitempty"` // Default: true
+	QuotaStorage    *int64   `json:"quota_storage,omitempty"`    // Default storage quota in bytes
+	QuotaMessages   *int64   `json:"quota_messages,omitempty"`   // Default message quota
+	Description     string   `json:"description,omitempty"`
+}
+
+func (req *DomainRequest) toDomain(name string) db.Domain {
+	return db.Domain{
+		Name:            name,
+		Status:          req.Status,
+		MaxAccounts:     req.MaxAccounts,
+		CatchAll:        req.CatchAll,
+		SieveExtensions: req.SieveExtensions,
+		SharedMailboxes: req.SharedMailboxes == nil || *req.SharedMailboxes,
+		QuotaStorage:    req.QuotaStorage,
+		QuotaMessages:   req.QuotaMessages,
+		Description:     req.Description,
+	}
+}
+
+// AliasRequest creates or replaces an alias. Address is taken from the path on
+// update.
+type AliasRequest struct {
+	Address     string   `json:"address,omitempty"`
+	Targets     []string `json:"targets"`
+	Description string   `json:"description,omitempty"`
+	Enabled     *bool    `json:"enabled,omitempty"` // Default: true
+}
+
+// handleListDomains handles GET /admin/domains
+func (s *Server) handleListDomains(w http.ResponseWriter, r *http.Request) {
+	domains, err := s.rdb.ListDomainsWithRetry(r.Context())
+	if err != nil {
+		logger.Warn("HTTP API: Error listing domains", "name", s.name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to list domains")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"domains": domains,
+		"total":   len(domains),
+	})
+}
+
+// handleCreateDomain handles POST /admin/domains
+func (s *Server) handleCreateDomain(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req DomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if req.Name == "" {
+		s.writeError(w, http.StatusBadRequest, "Domain name is required")
+		return
+	}
+
+	ctx := r.Context()
+	name := strings.ToLower(strings.TrimSpace(req.Name))
+	if err := s.rdb.CreateDomainWithRetry(ctx, req.toDomain(name)); err != nil {
+		switch {
+		case errors.Is(err, consts.ErrInvalidInput):
+			s.writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, consts.ErrDBUniqueViolation):
+			s.writeError(w, http.StatusConflict, "Domain already exists")
+		default:
+			logger.Warn("HTTP API: Error creating domain", "name", s.name, "domain", name, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "Failed to create domain")
+		}
+		return
+	}
+
+	created, err := s.rdb.GetDomainWithRetry(ctx, name)
+	if err != nil {
+		logger.Warn("HTTP API: Error reading created domain", "name", s.name, "domain", name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to read domain")
+		return
+	}
+
+	s.writeJSON(w, http.StatusCreated, map[string]any{
+		"domain":  created,
+		"message": "Domain created successfully",
+	})
+}
+
+// handleGetDomain handles GET /admin/domains/{domain}
+func (s *Server) handleGetDomain(w http.ResponseWriter, r *http.Request, name string) {
+	domain, err := s.rdb.GetDomainWithRetry(r.Context(), name)
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			s.writeError(w, http.StatusNotFound, "Domain not found")
+			return
+		}
+		logger.Warn("HTTP API: Error getting domain", "name", s.name, "domain", name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to get domain")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, domain)
+}
+
+// handleUpdateDomain handles PUT /admin/domains/{domain}
+func (s *Server) handleUpdateDomain(w http.ResponseWriter, r *http.Request, name string) {
+	defer r.Body.Close()
+
+	var req DomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	ctx := r.Context()
+	if err := s.rdb.UpdateDomainWithRetry(ctx, req.toDomain(name)); err != nil {
+		switch {
+		case errors.Is(err, consts.ErrInvalidInput):
+			s.writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, consts.ErrDBNotFound):
+			s.writeError(w, http.StatusNotFound, "Domain not found")
+		default:
+			logger.Warn("HTTP API: Error updating domain", "name", s.name, "domain", name, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "Failed to update domain")
+		}
+		return
+	}
+
+	domain, err := s.rdb.GetDomainWithRetry(ctx, name)
+	if err != nil {
+		logger.Warn("HTTP API: Error reading updated domain", "name", s.name, "domain", name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to read domain")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"domain":  domain,
+		"message": "Domain updated successfully",
+	})
+}
+
+// handleDeleteDomain handles DELETE /admin/domains/{domain}
+func (s *Server) handleDeleteDomain(w http.ResponseWriter, r *http.Request, name string) {
+	if err := s.rdb.DeleteDomainWithRetry(r.Context(), name); err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			s.writeError(w, http.StatusNotFound, "Domain not found")
+			return
+		}
+		logger.Warn("HTTP API: Error deleting domain", "name", s.name, "domain", name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to delete domain")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"domain":  name,
+		"message": "Domain deleted successfully",
+	})
+}
+
+// handleListAliases handles GET /admin/domains/{domain}/aliases
+func (s *Server) handleListAliases(w http.ResponseWriter, r *http.Request) {
+	domain := extractPathParam(r.URL.Path, "/admin/domains/", "/aliases")
+	if domain == "" {
+		s.writeError(w, http.StatusBadRequest, "Domain is required")
+		return
+	}
+
+	aliases, err := s.rdb.ListAliasesWithRetry(r.Context(), domain)
+	if err != nil {
+		logger.Warn("HTTP API: Error listing aliases", "name", s.name, "domain", domain, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to list aliases")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"domain":  domain,
+		"aliases": aliases,
+		"total":   len(aliases),
+	})
+}
+
+// handleCreateAlias handles POST /admin/domains/{domain}/aliases
+func (s *Server) handleCreateAlias(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	domain := extractPathParam(r.URL.Path, "/admin/domains/", "/aliases")
+	if domain == "" {
+		s.writeError(w, http.StatusBadRequest, "Domain is required")
+		return
+	}
+
+	var req AliasRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if req.Address == "" {
+		s.writeError(w, http.StatusBadRequest, "Alias address is required")
+		return
+	}
+	address := strings.ToLower(strings.TrimSpace(req.Address))
+	if !strings.HasSuffix(address, "@"+strings.ToLower(domain)) {
+		s.writeError(w, http.StatusBadRequest, "Alias address must belong to domain "+domain)
+		return
+	}
+
+	ctx := r.Context()
+	_, err := s.rdb.CreateAliasWithRetry(ctx, db.Alias{
+		Address:     address,
+		Targets:     req.Targets,
+		Description: req.Description,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, consts.ErrInvalidInput):
+			s.writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, consts.ErrDBUniqueViolation):
+			s.writeError(w, http.StatusConflict, "Alias already exists")
+		case errors.Is(err, consts.ErrAccountAlreadyExists):
+			s.writeError(w, http.StatusConflict, "Address belongs to an account")
+		case errors.Is(err, consts.ErrDBNotFound):
+			s.writeError(w, http.StatusNotFound, "Domain not found")
+		default:
+			logger.Warn("HTTP API: Error creating alias", "name", s.name, "address", address, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "Failed to create alias")
+		}
+		return
+	}
+
+	created, err := s.rdb.GetAliasWithRetry(ctx, address)
+	if err != nil {
+		logger.Warn("HTTP API: Error reading created alias", "name", s.name, "address", address, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to read alias")
+		return
+	}
+
+	s.writeJSON(w, http.StatusCreated, map[string]any{
+		"alias":   created,
+		"message": "Alias created successfully",
+	})
+}
+
+// handleAliasOperations routes /admin/aliases/{address}
+func (s *Server) handleAliasOperations(w http.ResponseWriter, r *http.Request) {
+	address := extractPathParam(r.URL.Path, "/admin/aliases/", "")
+	if address == "" || strings.Contains(address, "/") {
+		s.writeError(w, http.StatusBadRequest, "Invalid alias address")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		s.handleGetAlias(w, r, address)
+	case "PUT":
+		s.handleUpdateAlias(w, r, address)
+	case "DELETE":
+		s.handleDeleteAlias(w, r, address)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleGetAlias handles GET /admin/aliases/{address}
+func (s *Server) handleGetAlias(w http.ResponseWriter, r *http.Request, address string) {
+	alias, err := s.rdb.GetAliasWithRetry(r.Context(), address)
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			s.writeError(w, http.StatusNotFound, "Alias not found")
+			return
+		}
+		logger.Warn("HTTP API: Error getting alias", "name", s.name, "address", address, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to get alias")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, alias)
+}
+
+// handleUpdateAlias handles PUT /admin/aliases/{address}
+func (s *Server) handleUpdateAlias(w http.ResponseWriter, r *http.Request, address string) {
+	defer r.Body.Close()
+
+	var req AliasRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	ctx := r.Context()
+	err := s.rdb.UpdateAliasWithRetry(ctx, db.Alias{
+		Address:     address,
+		Targets:     req.Targets,
+		Description: req.Description,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, consts.ErrInvalidInput):
+			s.writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, consts.ErrDBNotFound):
+			s.writeError(w, http.StatusNotFound, "Alias not found")
+		default:
+			logger.Warn("HTTP API: Error updating alias", "name", s.name, "address", address, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "Failed to update alias")
+		}
+		return
+	}
+
+	alias, err := s.rdb.GetAliasWithRetry(ctx, address)
+	if err != nil {
+		logger.Warn("HTTP API: Error reading updated alias", "name", s.name, "address", address, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to read alias")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"alias":   alias,
+		"message": "Alias updated successfully",
+	})
+}
+
+// handleDeleteAlias handles DELETE /admin/aliases/{address}
+func (s *Server) handleDeleteAlias(w http.ResponseWriter, r *http.Request, address string) {
+	if err := s.rdb.DeleteAliasWithRetry(r.Context(), address); err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			s.writeError(w, http.StatusNotFound, "Alias not found")
+			return
+		}
+		logger.Warn("HTTP API: Error deleting alias", "name", s.name, "address", address, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to delete alias")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"address": address,
+		"message": "Alias deleted successfully",
+	})
+}
@@ -0,0 +1,242 @@
+package adminapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/events"
+)
+
+// EventSubscriptionRequest creates or updates a webhook subscription.
+// Account and domain select the scope on create and are ignored on update;
+// with neither set the subscription receives events of all accounts.
+type EventSubscriptionRequest struct {
+	Account     string   `json:"account,omitempty"`
+	Domain      string   `json:"domain,omitempty"`
+	URL         string   `json:"url"`
+	Secret      string   `json:"secret,omitempty"` // Generated on create if empty; kept on update if empty
+	EventTypes  []string `json:"event_types"`      // Empty = all event types
+	Description string   `json:"description,omitempty"`
+	Enabled     *bool    `json:"enabled,omitempty"` // Default: true
+}
+
+func (req *EventSubscriptionRequest) validate() string {
+	if req.Account != "" && req.Domain != "" {
+		return "account and domain are mutually exclusive"
+	}
+	if strings.Contains(req.Domain, "@") {
+		return "domain must not contain '@'"
+	}
+	if !strings.HasPrefix(req.URL, "https://") && !strings.HasPrefix(req.URL, "http://") {
+		return "url must be an http or https URL"
+	}
+	for _, t := range req.EventTypes {
+		if _, err := events.ParseType(t); err != nil {
+			return err.Error()
+		}
+	}
+	return ""
+}
+
+// handleEventSubscriptionOperations routes /admin/events/subscriptions/{id}
+func (s *Server) handleEventSubscriptionOperations(w http.ResponseWriter, r *http.Request) {
+	idStr := extractPathParam(r.URL.Path, "/admin/events/subscriptions/", "")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || id <= 0 {
+		s.writeError(w, http.StatusBadRequest, "Invalid subscription ID")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		s.handleGetEventSubscription(w, r, id)
+	case "PUT":
+		s.handleUpdateEventSubscription(w, r, id)
+	case "DELETE":
+		s.handleDeleteEventSubscription(w, r, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleListEventSubscriptions handles GET /admin/events/subscriptions
+func (s *Server) handleListEventSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subs, err := s.rdb.ListEventSubscriptionsWithRetry(r.Context())
+	if err != nil {
+		logger.Warn("HTTP API: Error listing event subscriptions", "name", s.name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to list event subscriptions")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"subscriptions": subs,
+		"total":         len(subs),
+	})
+}
+
+// handleCreateEventSubscription handles POST /admin/events/subscriptions
+func (s *Server) handleCreateEventSubscription(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req EventSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		s.writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	ctx := r.Context()
+	sub := db.EventSubscription{
+		Domain:      req.Domain,
+		URL:         req.URL,
+		Secret:      req.Secret,
+		EventTypes:  req.EventTypes,
+		Description: req.Description,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+	}
+
+	if req.Account != "" {
+		accountID, err := s.rdb.GetAccountIDByAddressWithRetry(ctx, req.Account)
+		if err != nil {
+			if errors.Is(err, consts.ErrUserNotFound) {
+				s.writeError(w, http.StatusNotFound, "Account not found")
+				return
+			}
+			logger.Warn("HTTP API: Error getting account ID", "name", s.name, "email", req.Account, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "Failed to find account")
+			return
+		}
+		sub.AccountID = &accountID
+	}
+
+	if sub.Secret == "" {
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			logger.Warn("HTTP API: Error generating webhook secret", "name", s.name, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "Failed to generate secret")
+			return
+		}
+		sub.Secret = secret
+	}
+
+	id, err := s.rdb.CreateEventSubscriptionWithRetry(ctx, sub)
+	if err != nil {
+		logger.Warn("HTTP API: Error creating event subscription", "name", s.name, "url", req.URL, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to create event subscription")
+		return
+	}
+
+	created, err := s.rdb.GetEventSubscriptionWithRetry(ctx, id)
+	if err != nil {
+		logger.Warn("HTTP API: Error reading created event subscription", "name", s.name, "id", id, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to read event subscription")
+		return
+	}
+
+	// The secret is only ever returned here, so the receiver can be configured
+	s.writeJSON(w, http.StatusCreated, map[string]any{
+		"subscription": created,
+		"secret":       sub.Secret,
+		"message":      "Event subscription created successfully",
+	})
+}
+
+// handleGetEventSubscription handles GET /admin/events/subscriptions/{id}
+func (s *Server) handleGetEventSubscription(w http.ResponseWriter, r *http.Request, id int64) {
+	sub, err := s.rdb.GetEventSubscriptionWithRetry(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			s.writeError(w, http.StatusNotFound, "Event subscription not found")
+			return
+		}
+		logger.Warn("HTTP API: Error getting event subscription", "name", s.name, "id", id, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to get event subscription")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, sub)
+}
+
+// handleUpdateEventSubscription handles PUT /admin/events/subscriptions/{id}
+func (s *Server) handleUpdateEventSubscription(w http.ResponseWriter, r *http.Request, id int64) {
+	defer r.Body.Close()
+
+	var req EventSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		s.writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	ctx := r.Context()
+	err := s.rdb.UpdateEventSubscriptionWithRetry(ctx, db.EventSubscription{
+		ID:          id,
+		URL:         req.URL,
+		Secret:      req.Secret,
+		EventTypes:  req.EventTypes,
+		Description: req.Description,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+	})
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			s.writeError(w, http.StatusNotFound, "Event subscription not found")
+			return
+		}
+		logger.Warn("HTTP API: Error updating event subscription", "name", s.name, "id", id, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to update event subscription")
+		return
+	}
+
+	sub, err := s.rdb.GetEventSubscriptionWithRetry(ctx, id)
+	if err != nil {
+		logger.Warn("HTTP API: Error reading updated event subscription", "name", s.name, "id", id, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to read event subscription")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"subscription": sub,
+		"message":      "Event subscription updated successfully",
+	})
+}
+
+// handleDeleteEventSubscription handles DELETE /admin/events/subscriptions/{id}
+func (s *Server) handleDeleteEventSubscription(w http.ResponseWriter, r *http.Request, id int64) {
+	if err := s.rdb.DeleteEventSubscriptionWithRetry(r.Context(), id); err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			s.writeError(w, http.StatusNotFound, "Event subscription not found")
+			return
+		}
+		logger.Warn("HTTP API: Error deleting event subscription", "name", s.name, "id", id, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to delete event subscription")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"id":      id,
+		"message": "Event subscription deleted successfully",
+	})
+}
+
+// generateWebhookSecret returns a random 256-bit secret, hex encoded.
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,204 @@
+package adminapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/server/sieveengine"
+)
+
+// GlobalSieveScriptRequest creates or updates a global Sieve script. Domain
+// selects the scope on create and is ignored on update; without it the
+// script runs for all accounts.
+type GlobalSieveScriptRequest struct {
+	Domain string `json:"domain,omitempty"`
+	Phase  string `json:"phase"` // "before" or "after" the script of the account
+	Name   string `json:"name"`
+	Script string `json:"script"`
+	Active *bool  `json:"active,omitempty"` // Default: true
+}
+
+// globalSieveScript validates a request and returns the script to store.
+// Scripts are parsed with the extensions global scripts may use.
+func (s *Server) globalSieveScript(req GlobalSieveScriptRequest) (db.GlobalSieveScript, error) {
+	script := db.GlobalSieveScript{
+		Domain: req.Domain,
+		Phase:  req.Phase,
+		Name:   req.Name,
+		Script: req.Script,
+		Active: req.Active == nil || *req.Active,
+	}
+	if err := script.Normalize(); err != nil {
+		return script, err
+	}
+	if _, err := sieveengine.NewSieveExecutorWithExtensions(script.Script, s.sieveExtensions); err != nil {
+		return script, fmt.Errorf("invalid script: %w", err)
+	}
+	return script, nil
+}
+
+// handleGlobalSieveScriptOperations routes /admin/sieve/scripts/{id}
+func (s *Server) handleGlobalSieveScriptOperations(w http.ResponseWriter, r *http.Request) {
+	idStr := extractPathParam(r.URL.Path, "/admin/sieve/scripts/", "")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || id <= 0 {
+		s.writeError(w, http.StatusBadRequest, "Invalid script ID")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		s.handleGetGlobalSieveScript(w, r, id)
+	case "PUT":
+		s.handleUpdateGlobalSieveScript(w, r, id)
+	case "DELETE":
+		s.handleDeleteGlobalSieveScript(w, r, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleListGlobalSieveScripts handles GET /admin/sieve/scripts. With
+// ?domain= only the scripts that run for the accounts of that domain are
+// listed.
+func (s *Server) handleListGlobalSieveScripts(w http.ResponseWriter, r *http.Request) {
+	scripts, err := s.rdb.ListGlobalSieveScriptsWithRetry(r.Context())
+	if err != nil {
+		logger.Warn("HTTP API: Error listing global sieve scripts", "name", s.name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to list global sieve scripts")
+		return
+	}
+
+	if domain := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("domain"))); domain != "" {
+		filtered := []db.GlobalSieveScript{}
+		for _, script := range scripts {
+			if script.Domain == "" || script.Domain == domain {
+				filtered = append(filtered, script)
+			}
+		}
+		scripts = filtered
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"scripts": scripts,
+		"total":   len(scripts),
+	})
+}
+
+// handleCreateGlobalSieveScript handles POST /admin/sieve/scripts
+func (s *Server) handleCreateGlobalSieveScript(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req GlobalSieveScriptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	script, err := s.globalSieveScript(req)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := s.rdb.CreateGlobalSieveScriptWithRetry(r.Context(), script)
+	if err != nil {
+		switch {
+		case errors.Is(err, consts.ErrInvalidInput):
+			s.writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, consts.ErrDBUniqueViolation):
+			s.writeError(w, http.StatusConflict, "A global sieve script with this name already exists")
+		default:
+			logger.Warn("HTTP API: Error creating global sieve script", "name", s.name, "script", script.Name, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "Failed to create global sieve script")
+		}
+		return
+	}
+
+	logger.Info("HTTP API: Global sieve script created", "name", s.name, "id", created.ID, "script", created.Name, "phase", created.Phase, "domain", created.Domain)
+	s.writeJSON(w, http.StatusCreated, map[string]any{
+		"script":  created,
+		"message": "Global sieve script created successfully",
+	})
+}
+
+// handleGetGlobalSieveScript handles GET /admin/sieve/scripts/{id}
+func (s *Server) handleGetGlobalSieveScript(w http.ResponseWriter, r *http.Request, id int64) {
+	script, err := s.rdb.GetGlobalSieveScriptWithRetry(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			s.writeError(w, http.StatusNotFound, "Global sieve script not found")
+			return
+		}
+		logger.Warn("HTTP API: Error getting global sieve script", "name", s.name, "id", id, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to get global sieve script")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, script)
+}
+
+// handleUpdateGlobalSieveScript handles PUT /admin/sieve/scripts/{id}
+func (s *Server) handleUpdateGlobalSieveScript(w http.ResponseWriter, r *http.Request, id int64) {
+	defer r.Body.Close()
+
+	var req GlobalSieveScriptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	req.Domain = ""
+	script, err := s.globalSieveScript(req)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	script.ID = id
+
+	updated, err := s.rdb.UpdateGlobalSieveScriptWithRetry(r.Context(), script)
+	if err != nil {
+		switch {
+		case errors.Is(err, consts.ErrDBNotFound):
+			s.writeError(w, http.StatusNotFound, "Global sieve script not found")
+		case errors.Is(err, consts.ErrInvalidInput):
+			s.writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, consts.ErrDBUniqueViolation):
+			s.writeError(w, http.StatusConflict, "A global sieve script with this name already exists")
+		default:
+			logger.Warn("HTTP API: Error updating global sieve script", "name", s.name, "id", id, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "Failed to update global sieve script")
+		}
+		return
+	}
+
+	logger.Info("HTTP API: Global sieve script updated", "name", s.name, "id", id, "script", updated.Name, "active", updated.Active)
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"script":  updated,
+		"message": "Global sieve script updated successfully",
+	})
+}
+
+// handleDeleteGlobalSieveScript handles DELETE /admin/sieve/scripts/{id}
+func (s *Server) handleDeleteGlobalSieveScript(w http.ResponseWriter, r *http.Request, id int64) {
+	if err := s.rdb.DeleteGlobalSieveScriptWithRetry(r.Context(), id); err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			s.writeError(w, http.StatusNotFound, "Global sieve script not found")
+			return
+		}
+		logger.Warn("HTTP API: Error deleting global sieve script", "name", s.name, "id", id, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to delete global sieve script")
+		return
+	}
+
+	logger.Info("HTTP API: Global sieve script deleted", "name", s.name, "id", id)
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"id":      id,
+		"message": "Global sieve script deleted successfully",
+	})
+}
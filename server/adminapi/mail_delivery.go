@@ -18,6 +18,7 @@ import (
 	"github.com/migadu/sora/helpers"
 	"github.com/migadu/sora/server"
 	"github.com/migadu/sora/server/delivery"
+	"github.com/migadu/sora/server/sieveengine"
 )
 
 // DeliverMailRequest represents the HTTP request for mail delivery
@@ -37,6 +38,10 @@ type RecipientStatus struct {
 	Error    string `json:"error,omitempty"`
 }
 
+// maxDeliverFormMemory is the part of a multipart delivery request kept in
+// memory; the rest is stored in temporary files.
+const maxDeliverFormMemory = 32 << 20
+
 // DeliverMailResponse represents the HTTP response for mail delivery
 type DeliverMailResponse struct {
 	Success    bool              `json:"success"`
@@ -70,7 +75,7 @@ func (s *Server) handleDeliverMail(w http.ResponseWriter, r *http.Request) {
 	switch {
 	case strings.HasPrefix(mediaType, "multipart/form-data"):
 		// Parse multipart form
-		err = r.ParseMultipartForm(32 << 20) // 32MB max
+		err = r.ParseMultipartForm(maxDeliverFormMemory)
 		if err != nil {
 			s.writeError(w, http.StatusBadRequest, "Failed to parse multipart form")
 			return
@@ -260,53 +265,112 @@ func (s *Server) deliverToRecipient(ctx context.Context, req *DeliverMailRequest
 		VacationOracle:  vacationOracle,
 		VacationHandler: vacationHandler,
 		RelayQueue:      s.relayQueue,
+		GlobalScripts:   s.globalSieve,
+		FilterHeaders:   s.sieveFilterHeaders,
 	}
 
 	deliveryCtx.SieveExecutor = sieveExecutor
 
 	logger.Log("starting delivery from=%s size=%d uid=%v", req.From, len(messageBytes), req.UID)
 
-	// Lookup recipient
-	recipientInfo, err := deliveryCtx.LookupRecipient(ctx, recipient)
+	// Lookup recipient (an alias may expand to several accounts and forwards)
+	lookup, err := deliveryCtx.LookupRecipient(ctx, recipient)
 	if err != nil {
 		logger.Log("recipient lookup failed: %v", err)
 		status.Error = err.Error()
 		return status
 	}
 
-	logger.Log("recipient found AccountID=%d", recipientInfo.AccountID)
+	if len(lookup.Forwards) > 0 && s.relayQueue == nil {
+		logger.Log("cannot forward to %v: relay queue not configured", lookup.Forwards)
+		status.Error = "Recipient forwards to external addresses but relay is not configured"
+		return status
+	}
+
+	for _, recipientInfo := range lookup.Recipients {
+		logger.Log("recipient found AccountID=%d", recipientInfo.AccountID)
 
-	// Set from address if provided
-	if req.From != "" {
-		if addr, parseErr := server.NewAddress(req.From); parseErr == nil {
-			recipientInfo.FromAddress = &addr
+		// Set from address if provided
+		if req.From != "" {
+			if addr, parseErr := server.NewAddress(req.From); parseErr == nil {
+				recipientInfo.FromAddress = &addr
+			}
 		}
-	}
 
-	// Set preserved UID fields for migration
-	recipientInfo.PreservedUID = req.UID
-	recipientInfo.PreservedUIDVal = req.UIDValidity
-	recipientInfo.TargetMailbox = req.MailboxName
+		// Set preserved UID fields for migration
+		recipientInfo.PreservedUID = req.UID
+		recipientInfo.PreservedUIDVal = req.UIDValidity
+		recipientInfo.TargetMailbox = req.MailboxName
 
-	// Deliver message
-	result, err := deliveryCtx.DeliverMessage(*recipientInfo, messageBytes)
-	if err != nil {
-		logger.Log("delivery failed: %v", err)
-		status.Error = result.ErrorMessage
-		return status
-	}
+		// Deliver message
+		result, err := deliveryCtx.DeliverMessage(recipientInfo, messageBytes)
+		if err != nil {
+			logger.Log("delivery failed: %v", err)
+			status.Error = result.ErrorMessage
+			return status
+		}
 
-	if result.Discarded {
-		logger.Log("message discarded by Sieve filter")
-		status.Accepted = true
-		status.Error = "Message discarded by Sieve filter"
-		return status
+		if result.Rejected {
+			logger.Log("message rejected by Sieve filter: %s", result.RejectReason)
+			if len(lookup.Recipients) == 1 && len(lookup.Forwards) == 0 {
+				status.Error = "Message rejected by Sieve filter: " + result.RejectReason
+				return status
+			}
+			// The other accounts of an alias receive the message, so the
+			// rejection is sent to the sender instead (RFC 5429 §2.1.1)
+			s.sendRejection(req.From, recipientInfo, result.RejectReason, messageBytes, logger)
+			continue
+		}
+
+		if result.Discarded {
+			logger.Log("message discarded by Sieve filter")
+			status.Error = "Message discarded by Sieve filter"
+			continue
+		}
+
+		if result.Success {
+			if len(result.Mailboxes) > 0 {
+				logger.Log("message delivered successfully to mailbox=%s uid=%d mailboxes=%v", result.MailboxName, result.MessageUID, result.Mailboxes)
+			}
+			if len(result.Redirects) > 0 {
+				logger.Log("message redirected by Sieve filter to %v", result.Redirects)
+			}
+		}
 	}
 
-	if result.Success {
-		logger.Log("message delivered successfully to mailbox=%s uid=%d", result.MailboxName, result.MessageUID)
+	for _, forward := range lookup.Forwards {
+		if err := s.relayQueue.Enqueue(req.From, forward, "forward", messageBytes); err != nil {
+			logger.Log("failed to enqueue forward to %s: %v", forward, err)
+			status.Error = fmt.Sprintf("Failed to forward to %s", forward)
+			return status
+		}
+		logger.Log("message forwarded to %s", forward)
 	}
 
-	status.Accepted = result.Success
+	status.Accepted = true
 	return status
 }
+
+// sendRejection queues the rejection message of a message rejected by the
+// Sieve script of one account of an alias. Nothing is sent for a null
+// sender.
+func (s *Server) sendRejection(sender string, recipient delivery.RecipientInfo, reason string, messageBytes []byte, logger *adminAPILogger) {
+	if sender == "" || s.relayQueue == nil {
+		logger.Log("rejection not sent: null sender or relay queue not configured")
+		return
+	}
+	originalMessage, err := message.Read(bytes.NewReader(messageBytes))
+	if err != nil && originalMessage == nil {
+		logger.Log("failed to parse rejected message: %v", err)
+		return
+	}
+	reject := sieveengine.Action{Type: sieveengine.ActionReject, RejectReason: reason}
+	rejection, err := delivery.BuildRejection(s.hostname, reject, recipient.Address.FullAddress(), sender, originalMessage)
+	if err != nil {
+		logger.Log("failed to build rejection: %v", err)
+		return
+	}
+	if err := s.relayQueue.Enqueue("", sender, "reject", rejection); err != nil {
+		logger.Log("failed to enqueue rejection to %s: %v", sender, err)
+	}
+}
@@ -0,0 +1,192 @@
+package adminapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+)
+
+// SetQuotaRequest sets the storage (bytes) and message limits of an account or domain.
+// A null or missing limit clears it (accounts fall back to the domain default);
+// 0 means unlimited.
+type SetQuotaRequest struct {
+	StorageLimit  *int64 `json:"storage_limit"`
+	MessagesLimit *int64 `json:"messages_limit"`
+}
+
+func (req *SetQuotaRequest) validate() string {
+	if req.StorageLimit != nil && *req.StorageLimit < 0 {
+		return "storage_limit cannot be negative"
+	}
+	if req.MessagesLimit != nil && *req.MessagesLimit < 0 {
+		return "messages_limit cannot be negative"
+	}
+	return ""
+}
+
+// handleGetAccountQuota handles GET /admin/accounts/{email}/quota
+func (s *Server) handleGetAccountQuota(w http.ResponseWriter, r *http.Request) {
+	email := extractPathParam(r.URL.Path, "/admin/accounts/", "/quota")
+	ctx := r.Context()
+
+	accountID, err := s.rdb.GetAccountIDByAddressWithRetry(ctx, email)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserNotFound) {
+			s.writeError(w, http.StatusNotFound, "Account not found")
+			return
+		}
+		logger.Warn("HTTP API: Error getting account ID", "name", s.name, "email", email, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to find account")
+		return
+	}
+
+	quota, err := s.rdb.GetAccountQuotaWithRetry(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserNotFound) {
+			s.writeError(w, http.StatusNotFound, "Account not found")
+			return
+		}
+		logger.Warn("HTTP API: Error getting account quota", "name", s.name, "email", email, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to get account quota")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"email": email,
+		"quota": quota,
+	})
+}
+
+// handleSetAccountQuota handles PUT /admin/accounts/{email}/quota
+func (s *Server) handleSetAccountQuota(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	email := extractPathParam(r.URL.Path, "/admin/accounts/", "/quota")
+
+	var req SetQuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		s.writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	ctx := r.Context()
+
+	accountID, err := s.rdb.GetAccountIDByAddressWithRetry(ctx, email)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserNotFound) {
+			s.writeError(w, http.StatusNotFound, "Account not found")
+			return
+		}
+		logger.Warn("HTTP API: Error getting account ID", "name", s.name, "email", email, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to find account")
+		return
+	}
+
+	if err := s.rdb.SetAccountQuotaWithRetry(ctx, accountID, req.StorageLimit, req.MessagesLimit); err != nil {
+		if errors.Is(err, consts.ErrUserNotFound) {
+			s.writeError(w, http.StatusNotFound, "Account not found")
+			return
+		}
+		logger.Warn("HTTP API: Error setting account quota", "name", s.name, "email", email, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to set account quota")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"email":          email,
+		"storage_limit":  req.StorageLimit,
+		"messages_limit": req.MessagesLimit,
+		"message":        "Account quota updated successfully",
+	})
+}
+
+// handleGetDomainQuota handles GET /admin/domains/{domain}/quota
+func (s *Server) handleGetDomainQuota(w http.ResponseWriter, r *http.Request) {
+	domain := extractPathParam(r.URL.Path, "/admin/domains/", "/quota")
+	if domain == "" {
+		s.writeError(w, http.StatusBadRequest, "Domain is required")
+		return
+	}
+
+	quota, err := s.rdb.GetDomainQuotaWithRetry(r.Context(), domain)
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			s.writeError(w, http.StatusNotFound, "No quota set for domain")
+			return
+		}
+		logger.Warn("HTTP API: Error getting domain quota", "name", s.name, "domain", domain, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to get domain quota")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, quota)
+}
+
+// handleSetDomainQuota handles PUT /admin/domains/{domain}/quota
+func (s *Server) handleSetDomainQuota(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	domain := extractPathParam(r.URL.Path, "/admin/domains/", "/quota")
+	if domain == "" {
+		s.writeError(w, http.StatusBadRequest, "Domain is required")
+		return
+	}
+
+	var req SetQuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		s.writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	quota := db.DomainQuota{
+		Domain:        domain,
+		StorageLimit:  req.StorageLimit,
+		MessagesLimit: req.MessagesLimit,
+	}
+	if err := s.rdb.SetDomainQuotaWithRetry(r.Context(), quota); err != nil {
+		logger.Warn("HTTP API: Error setting domain quota", "name", s.name, "domain", domain, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to set domain quota")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"domain":         domain,
+		"storage_limit":  req.StorageLimit,
+		"messages_limit": req.MessagesLimit,
+		"message":        "Domain quota updated successfully",
+	})
+}
+
+// handleDeleteDomainQuota handles DELETE /admin/domains/{domain}/quota
+func (s *Server) handleDeleteDomainQuota(w http.ResponseWriter, r *http.Request) {
+	domain := extractPathParam(r.URL.Path, "/admin/domains/", "/quota")
+	if domain == "" {
+		s.writeError(w, http.StatusBadRequest, "Domain is required")
+		return
+	}
+
+	if err := s.rdb.DeleteDomainQuotaWithRetry(r.Context(), domain); err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			s.writeError(w, http.StatusNotFound, "No quota set for domain")
+			return
+		}
+		logger.Warn("HTTP API: Error deleting domain quota", "name", s.name, "domain", domain, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to delete domain quota")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"domain":  domain,
+		"message": "Domain quota removed successfully",
+	})
+}
@@ -2,7 +2,6 @@ package adminapi
 
 import (
 	"context"
-	"crypto/subtle"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
@@ -10,8 +9,10 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/migadu/sora/config"
@@ -24,6 +25,7 @@ import (
 	"github.com/migadu/sora/server"
 	"github.com/migadu/sora/server/delivery"
 	"github.com/migadu/sora/server/proxy"
+	"github.com/migadu/sora/server/sieveengine"
 	"github.com/migadu/sora/server/uploader"
 	"github.com/migadu/sora/storage"
 )
@@ -40,12 +42,14 @@ func getProxyProtocolTrustedProxies(proxyProtocolTrusted, trustedNetworks []stri
 type Server struct {
 	name               string
 	addr               string
-	apiKey             string
+	keysMu             sync.RWMutex
+	apiKey             string    // Key with the admin scope (api_key)
+	apiKeys            []*apiKey // Named keys of the configuration (api_keys)
 	allowedHosts       []string
 	rdb                *resilient.ResilientDatabase
 	cache              *cache.Cache
 	uploader           *uploader.UploadWorker
-	storage            *storage.S3Storage
+	storage            storage.BlobStore
 	relayQueue         delivery.RelayQueue // Global relay queue for mail delivery
 	server             *http.Server
 	tls                bool
@@ -61,30 +65,36 @@ type Server struct {
 	proxyServers       map[string]ProxyServer               // proxy name -> proxy server
 	proxyReader        *server.ProxyProtocolReader          // PROXY protocol support
 	authCache          AuthCacheStats                       // persistent auth cache (optional)
+	globalSieve        *delivery.GlobalSieveScripts         // before and after scripts for mail delivery
+	sieveExtensions    []string                             // extensions global scripts may use
+	sieveFilterHeaders *sieveengine.FilterHeaders           // spam and virus headers for mail delivery
 }
 
 // ServerOptions holds configuration options for the HTTP API server
 type ServerOptions struct {
-	Name               string
-	Addr               string
-	APIKey             string
-	AllowedHosts       []string
-	Cache              *cache.Cache
-	Uploader           *uploader.UploadWorker
-	Storage            *storage.S3Storage
-	RelayQueue         delivery.RelayQueue // Global relay queue for mail delivery
-	TLS                bool
-	TLSConfig          *tls.Config // TLS config from manager (takes precedence over cert files)
-	TLSCertFile        string
-	TLSKeyFile         string
-	TLSVerify          bool
-	Hostname           string
-	FTSRetention       time.Duration
-	AffinityManager    AffinityManager
-	ValidBackends      map[string][]string                  // Map of protocol -> valid backend addresses
-	ConnectionTrackers map[string]*server.ConnectionTracker // protocol -> tracker (for gossip-based kick)
-	ProxyServers       map[string]ProxyServer               // proxy name -> proxy server (for backend health)
-	AuthCache          AuthCacheStats                       // persistent auth cache (optional)
+	Name                  string
+	Addr                  string
+	APIKey                string                     // Key with the admin scope
+	APIKeys               []config.AdminAPIKeyConfig // Named keys with restricted scopes
+	AllowedHosts          []string
+	Cache                 *cache.Cache
+	Uploader              *uploader.UploadWorker
+	Storage               storage.BlobStore
+	RelayQueue            delivery.RelayQueue // Global relay queue for mail delivery
+	TLS                   bool
+	TLSConfig             *tls.Config // TLS config from manager (takes precedence over cert files)
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSVerify             bool
+	Hostname              string
+	FTSRetention          time.Duration
+	AffinityManager       AffinityManager
+	ValidBackends         map[string][]string                  // Map of protocol -> valid backend addresses
+	ConnectionTrackers    map[string]*server.ConnectionTracker // protocol -> tracker (for gossip-based kick)
+	ProxyServers          map[string]ProxyServer               // proxy name -> proxy server (for backend health)
+	AuthCache             AuthCacheStats                       // persistent auth cache (optional)
+	GlobalSieveExtensions []string                             // Extensions of global Sieve scripts (empty = all but vacation)
+	SieveFilterHeaders    *sieveengine.FilterHeaders           // Spam and virus headers of spamtest and virustest (nil = defaults)
 
 	// PROXY protocol for incoming connections (from HAProxy, nginx, etc.)
 	ProxyProtocol               bool     // Enable PROXY protocol support for incoming connections
@@ -137,9 +147,13 @@ type ProxyBackendInfo struct {
 
 // New creates a new HTTP API server
 func New(rdb *resilient.ResilientDatabase, options ServerOptions) (*Server, error) {
-	if options.APIKey == "" {
+	if options.APIKey == "" && len(options.APIKeys) == 0 {
 		return nil, fmt.Errorf("API key is required for HTTP API server")
 	}
+	apiKeys, err := configAPIKeys(options.APIKey, options.APIKeys)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api_keys: %w", err)
+	}
 
 	// Validate TLS configuration
 	if options.TLS {
@@ -159,7 +173,6 @@ func New(rdb *resilient.ResilientDatabase, options ServerOptions) (*Server, erro
 			Timeout:        options.ProxyProtocolTimeout,
 			TrustedProxies: getProxyProtocolTrustedProxies(options.ProxyProtocolTrustedProxies, options.TrustedNetworks),
 		}
-		var err error
 		proxyReader, err = server.NewProxyProtocolReader("ADMIN-API", proxyConfig)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create PROXY protocol reader: %w", err)
@@ -171,6 +184,7 @@ func New(rdb *resilient.ResilientDatabase, options ServerOptions) (*Server, erro
 		name:               options.Name,
 		addr:               options.Addr,
 		apiKey:             options.APIKey,
+		apiKeys:            apiKeys,
 		allowedHosts:       options.AllowedHosts,
 		rdb:                rdb,
 		cache:              options.Cache,
@@ -190,6 +204,11 @@ func New(rdb *resilient.ResilientDatabase, options ServerOptions) (*Server, erro
 		proxyServers:       options.ProxyServers,
 		proxyReader:        proxyReader,
 		authCache:          options.AuthCache,
+		sieveExtensions:    sieveengine.GlobalExtensions(options.GlobalSieveExtensions),
+		sieveFilterHeaders: options.SieveFilterHeaders,
+	}
+	if rdb != nil {
+		s.globalSieve = delivery.NewGlobalSieveScripts(rdb, options.GlobalSieveExtensions)
 	}
 
 	return s, nil
@@ -205,10 +224,26 @@ func (s *Server) SetAuthCache(ac AuthCacheStats) {
 func (s *Server) ReloadConfig(cfg config.ServerConfig) error {
 	var reloaded []string
 
-	if cfg.APIKey != "" && cfg.APIKey != s.apiKey {
-		s.apiKey = cfg.APIKey
+	s.keysMu.Lock()
+	defaultKey := s.apiKey
+	if cfg.APIKey != "" {
+		defaultKey = cfg.APIKey
+	}
+	apiKeys, err := configAPIKeys(defaultKey, cfg.APIKeys)
+	if err != nil {
+		s.keysMu.Unlock()
+		return fmt.Errorf("invalid api_keys: %w", err)
+	}
+	if defaultKey != s.apiKey {
+		s.apiKey = defaultKey
 		reloaded = append(reloaded, "api_key")
 	}
+	if !reflect.DeepEqual(apiKeys, s.apiKeys) {
+		s.apiKeys = apiKeys
+		reloaded = append(reloaded, "api_keys")
+	}
+	s.keysMu.Unlock()
+
 	if len(cfg.AllowedHosts) > 0 {
 		s.allowedHosts = cfg.AllowedHosts
 		reloaded = append(reloaded, "allowed_hosts")
@@ -310,65 +345,111 @@ func (s *Server) start(ctx context.Context) error {
 func (s *Server) setupRoutes() http.Handler {
 	mux := http.NewServeMux()
 
+	// Every route requires a scope of the API key and names the accounts or
+	// domains it acts on, see requireScope
+	const (
+		admin        = db.APIKeyScopeAdmin
+		readOnly     = db.APIKeyScopeReadOnly
+		accounts     = db.APIKeyScopeAccounts
+		connections  = db.APIKeyScopeConnections
+		cacheScope   = db.APIKeyScopeCache
+		acl          = db.APIKeyScopeACL
+		mailDelivery = db.APIKeyScopeMailDelivery
+	)
+
 	// Account management routes
-	mux.HandleFunc("/admin/accounts", routeHandler("POST", s.handleCreateAccount))
-	mux.HandleFunc("/admin/accounts/", s.handleAccountOperations)
+	mux.HandleFunc("/admin/accounts", s.requireScope(accounts, createAccountTargets, routeHandler("POST", s.handleCreateAccount)))
+	mux.HandleFunc("/admin/accounts/", s.requireScopeFunc(accountOperationScope, accountTargets, s.handleAccountOperations))
 
-	// Domain-scoped account management routes
-	mux.HandleFunc("/admin/domains/", s.handleDomainOperations)
+	// Domain management routes (including domain-scoped accounts, quotas and aliases)
+	mux.HandleFunc("/admin/domains", s.requireScope(accounts, methodTargets(map[string]targetsFunc{"POST": createDomainTargets}), multiMethodHandler(map[string]http.HandlerFunc{
+		"GET":  s.handleListDomains,
+		"POST": s.handleCreateDomain,
+	})))
+	mux.HandleFunc("/admin/domains/", s.requireScope(accounts, domainTargets, s.handleDomainOperations))
+	mux.HandleFunc("/admin/aliases/", s.requireScope(accounts, aliasOperationTargets, s.handleAliasOperations))
 
 	// Credential management routes
-	mux.HandleFunc("/admin/credentials/", s.handleCredentialOperations)
+	mux.HandleFunc("/admin/credentials/", s.requireScope(accounts, pathTarget("/admin/credentials/"), s.handleCredentialOperations))
 
 	// Connection management routes
-	mux.HandleFunc("/admin/connections", routeHandler("GET", s.handleListConnections))
-	mux.HandleFunc("/admin/connections/stats", routeHandler("GET", s.handleConnectionStats))
-	mux.HandleFunc("/admin/connections/kick", routeHandler("POST", s.handleKickConnections))
-	mux.HandleFunc("/admin/connections/user/", routeHandler("GET", s.handleGetUserConnections))
+	mux.HandleFunc("/admin/connections", s.requireScope(connections, nil, routeHandler("GET", s.handleListConnections)))
+	mux.HandleFunc("/admin/connections/stats", s.requireScope(connections, nil, routeHandler("GET", s.handleConnectionStats)))
+	mux.HandleFunc("/admin/connections/kick", s.requireScope(connections, kickConnectionsTargets, routeHandler("POST", s.handleKickConnections)))
+	mux.HandleFunc("/admin/connections/user/", s.requireScope(connections, pathTarget("/admin/connections/user/"), routeHandler("GET", s.handleGetUserConnections)))
 
 	// Cache management routes
-	mux.HandleFunc("/admin/cache/stats", routeHandler("GET", s.handleCacheStats))
-	mux.HandleFunc("/admin/cache/metrics", routeHandler("GET", s.handleCacheMetrics))
-	mux.HandleFunc("/admin/cache/purge", routeHandler("POST", s.handleCachePurge))
+	mux.HandleFunc("/admin/cache/stats", s.requireScope(cacheScope, nil, routeHandler("GET", s.handleCacheStats)))
+	mux.HandleFunc("/admin/cache/metrics", s.requireScope(cacheScope, nil, routeHandler("GET", s.handleCacheMetrics)))
+	mux.HandleFunc("/admin/cache/purge", s.requireScope(cacheScope, nil, routeHandler("POST", s.handleCachePurge)))
 
 	// Uploader routes
-	mux.HandleFunc("/admin/uploader/status", routeHandler("GET", s.handleUploaderStatus))
-	mux.HandleFunc("/admin/uploader/failed", routeHandler("GET", s.handleFailedUploads))
+	mux.HandleFunc("/admin/uploader/status", s.requireScope(readOnly, nil, routeHandler("GET", s.handleUploaderStatus)))
+	mux.HandleFunc("/admin/uploader/failed", s.requireScope(readOnly, nil, routeHandler("GET", s.handleFailedUploads)))
 
 	// Authentication statistics routes
-	mux.HandleFunc("/admin/auth/stats", routeHandler("GET", s.handleAuthStats))
-	mux.HandleFunc("/admin/auth/blocked", routeHandler("GET", s.handleAuthBlocked))
-	mux.HandleFunc("/admin/auth-cache/stats", routeHandler("GET", s.handleAuthCacheStats))
+	mux.HandleFunc("/admin/auth/stats", s.requireScope(readOnly, nil, routeHandler("GET", s.handleAuthStats)))
+	mux.HandleFunc("/admin/auth/blocked", s.requireScope(readOnly, nil, routeHandler("GET", s.handleAuthBlocked)))
+	mux.HandleFunc("/admin/auth-cache/stats", s.requireScope(readOnly, nil, routeHandler("GET", s.handleAuthCacheStats)))
 
 	// Health monitoring routes
-	mux.HandleFunc("/admin/health/overview", routeHandler("GET", s.handleHealthOverview))
-	mux.HandleFunc("/admin/health/servers/", s.handleHealthOperations)
+	mux.HandleFunc("/admin/health/overview", s.requireScope(readOnly, nil, routeHandler("GET", s.handleHealthOverview)))
+	mux.HandleFunc("/admin/health/servers/", s.requireScope(readOnly, nil, s.handleHealthOperations))
 
 	// Proxy backend health routes
-	mux.HandleFunc("/admin/proxy/backends", routeHandler("GET", s.handleProxyBackends))
+	mux.HandleFunc("/admin/proxy/backends", s.requireScope(readOnly, nil, routeHandler("GET", s.handleProxyBackends)))
 
 	// System configuration and status routes
-	mux.HandleFunc("/admin/config", routeHandler("GET", s.handleConfigInfo))
+	mux.HandleFunc("/admin/config", s.requireScope(readOnly, nil, routeHandler("GET", s.handleConfigInfo)))
 
 	// Mail delivery route
-	mux.HandleFunc("/admin/mail/deliver", routeHandler("POST", s.handleDeliverMail))
+	mux.HandleFunc("/admin/mail/deliver", s.requireScope(mailDelivery, mailDeliveryTargets, routeHandler("POST", s.handleDeliverMail)))
 
 	// ACL management routes
-	mux.HandleFunc("/admin/mailboxes/acl/grant", routeHandler("POST", s.handleACLGrant))
-	mux.HandleFunc("/admin/mailboxes/acl/revoke", routeHandler("POST", s.handleACLRevoke))
-	mux.HandleFunc("/admin/mailboxes/acl", routeHandler("GET", s.handleACLList))
+	mux.HandleFunc("/admin/mailboxes/acl/grant", s.requireScope(acl, aclGrantTargets, routeHandler("POST", s.handleACLGrant)))
+	mux.HandleFunc("/admin/mailboxes/acl/revoke", s.requireScope(acl, aclRevokeTargets, routeHandler("POST", s.handleACLRevoke)))
+	mux.HandleFunc("/admin/mailboxes/acl", s.requireScope(acl, queryTarget("owner"), routeHandler("GET", s.handleACLList)))
 
 	// Affinity management routes
-	mux.HandleFunc("/admin/affinity", multiMethodHandler(map[string]http.HandlerFunc{
+	mux.HandleFunc("/admin/affinity", s.requireScope(connections, methodTargets(map[string]targetsFunc{
+		"GET":    queryTarget("user"),
+		"POST":   affinitySetTargets,
+		"DELETE": queryTarget("user"),
+	}), multiMethodHandler(map[string]http.HandlerFunc{
 		"GET":    s.handleAffinityGet,
 		"POST":   s.handleAffinitySet,
 		"DELETE": s.handleAffinityDelete,
-	}))
-	mux.HandleFunc("/admin/affinity/list", routeHandler("GET", s.handleAffinityList))
-	mux.HandleFunc("/admin/affinity/stats", routeHandler("GET", s.handleAffinityStats))
+	})))
+	mux.HandleFunc("/admin/affinity/list", s.requireScope(connections, nil, routeHandler("GET", s.handleAffinityList)))
+	mux.HandleFunc("/admin/affinity/stats", s.requireScope(connections, nil, routeHandler("GET", s.handleAffinityStats)))
+
+	// Event subscription (webhook) routes
+	mux.HandleFunc("/admin/events/subscriptions", s.requireScope(admin, nil, multiMethodHandler(map[string]http.HandlerFunc{
+		"GET":  s.handleListEventSubscriptions,
+		"POST": s.handleCreateEventSubscription,
+	})))
+	mux.HandleFunc("/admin/events/subscriptions/", s.requireScope(admin, nil, s.handleEventSubscriptionOperations))
+
+	// Global Sieve script routes
+	mux.HandleFunc("/admin/sieve/scripts", s.requireScope(admin, nil, multiMethodHandler(map[string]http.HandlerFunc{
+		"GET":  s.handleListGlobalSieveScripts,
+		"POST": s.handleCreateGlobalSieveScript,
+	})))
+	mux.HandleFunc("/admin/sieve/scripts/", s.requireScope(admin, nil, s.handleGlobalSieveScriptOperations))
+
+	// Audit log route
+	mux.HandleFunc("/admin/audit", s.requireScope(readOnly, queryTarget("account"), routeHandler("GET", s.handleListAudit)))
+
+	// API key management routes
+	mux.HandleFunc("/admin/api-keys", s.requireScope(admin, nil, multiMethodHandler(map[string]http.HandlerFunc{
+		"GET":  s.handleListAPIKeys,
+		"POST": s.handleCreateAPIKey,
+	})))
+	mux.HandleFunc("/admin/api-keys/", s.requireScope(admin, nil, s.handleAPIKeyOperations))
 
 	// Wrap with middleware (in reverse order - last applied is outermost)
-	handler := s.loggingMiddleware(mux)
+	handler := s.auditMiddleware(mux)
+	handler = s.loggingMiddleware(handler)
 	handler = s.allowedHostsMiddleware(handler)
 	handler = s.authMiddleware(handler)
 
@@ -414,6 +495,36 @@ func (s *Server) handleAccountOperations(w http.ResponseWriter, r *http.Request)
 		s.handleAccountExists(w, r)
 		return
 	}
+	if strings.HasSuffix(path, "/quota") {
+		switch r.Method {
+		case "GET":
+			s.handleGetAccountQuota(w, r)
+		case "PUT":
+			s.handleSetAccountQuota(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+	if strings.Contains(path, "/app-passwords") {
+		s.handleAppPasswordOperations(w, r)
+		return
+	}
+	if strings.HasSuffix(path, "/totp") {
+		s.handleTOTPOperations(w, r)
+		return
+	}
+	if strings.HasSuffix(path, "/status") {
+		switch r.Method {
+		case "GET":
+			s.handleGetAccountStatus(w, r)
+		case "PUT":
+			s.handleSetAccountStatus(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
 	if strings.Contains(path, "/credentials") {
 		switch r.Method {
 		case "GET":
@@ -455,6 +566,21 @@ func (s *Server) handleCredentialOperations(w http.ResponseWriter, r *http.Reque
 func (s *Server) handleDomainOperations(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Path
 
+	// Check for /admin/domains/{domain}/quota
+	if strings.HasSuffix(path, "/quota") {
+		switch r.Method {
+		case "GET":
+			s.handleGetDomainQuota(w, r)
+		case "PUT":
+			s.handleSetDomainQuota(w, r)
+		case "DELETE":
+			s.handleDeleteDomainQuota(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
 	// Check for /admin/domains/{domain}/accounts
 	if strings.Contains(path, "/accounts") {
 		if r.Method != "GET" {
@@ -465,8 +591,36 @@ func (s *Server) handleDomainOperations(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Unknown domain operation
-	http.Error(w, "Not found", http.StatusNotFound)
+	// Check for /admin/domains/{domain}/aliases
+	if strings.HasSuffix(path, "/aliases") {
+		switch r.Method {
+		case "GET":
+			s.handleListAliases(w, r)
+		case "POST":
+			s.handleCreateAlias(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	// /admin/domains/{domain}
+	name := extractPathParam(path, "/admin/domains/", "")
+	if name == "" || strings.Contains(name, "/") {
+		// Unknown domain operation
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case "GET":
+		s.handleGetDomain(w, r, name)
+	case "PUT":
+		s.handleUpdateDomain(w, r, name)
+	case "DELETE":
+		s.handleDeleteDomain(w, r, name)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
 }
 
 // handleHealthOperations routes health monitoring operations
@@ -554,12 +708,18 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		if subtle.ConstantTimeCompare([]byte(parts[1]), []byte(s.apiKey)) != 1 {
+		key, err := s.authenticate(r.Context(), parts[1])
+		if err != nil {
+			logger.Warn("HTTP API: Error verifying API key", "name", s.name, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "Failed to verify API key")
+			return
+		}
+		if key == nil {
 			s.writeError(w, http.StatusForbidden, "Invalid API key")
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
 	})
 }
 
@@ -689,10 +849,14 @@ func (s *Server) handleCreateAccount(w http.ResponseWriter, r *http.Request) {
 
 		accountID, err := s.rdb.CreateAccountWithCredentialsWithRetry(ctx, createReq)
 		if err != nil {
-			if errors.Is(err, consts.ErrDBUniqueViolation) {
+			if errors.Is(err, consts.ErrDBUniqueViolation) || errors.Is(err, consts.ErrAccountAlreadyExists) {
 				s.writeError(w, http.StatusConflict, "One or more email addresses already exist")
 				return
 			}
+			if errors.Is(err, consts.ErrDomainAccountLimit) {
+				s.writeError(w, http.StatusConflict, "Domain account limit reached")
+				return
+			}
 			logger.Warn("HTTP API: Error creating account with credentials", "name", s.name, "error", err)
 			s.writeError(w, http.StatusInternalServerError, "Failed to create account with credentials")
 			return
@@ -736,10 +900,14 @@ func (s *Server) handleCreateAccount(w http.ResponseWriter, r *http.Request) {
 
 		accountID, err := s.rdb.CreateAccountWithRetry(ctx, createReq)
 		if err != nil {
-			if errors.Is(err, consts.ErrDBUniqueViolation) {
+			if errors.Is(err, consts.ErrDBUniqueViolation) || errors.Is(err, consts.ErrAccountAlreadyExists) {
 				s.writeError(w, http.StatusConflict, "Account already exists")
 				return
 			}
+			if errors.Is(err, consts.ErrDomainAccountLimit) {
+				s.writeError(w, http.StatusConflict, "Domain account limit reached")
+				return
+			}
 			logger.Warn("HTTP API: Error creating account", "name", s.name, "error", err)
 			s.writeError(w, http.StatusInternalServerError, "Failed to create account")
 			return
@@ -972,10 +1140,14 @@ func (s *Server) handleAddCredential(w http.ResponseWriter, r *http.Request) {
 
 	err = s.rdb.AddCredentialWithRetry(ctx, addReq)
 	if err != nil {
-		if errors.Is(err, consts.ErrDBUniqueViolation) {
+		if errors.Is(err, consts.ErrDBUniqueViolation) || errors.Is(err, consts.ErrAccountAlreadyExists) {
 			s.writeError(w, http.StatusConflict, "Credential with this email already exists")
 			return
 		}
+		if errors.Is(err, consts.ErrDomainAccountLimit) {
+			s.writeError(w, http.StatusConflict, "Domain account limit reached")
+			return
+		}
 		logger.Warn("HTTP API: Error adding credential", "name", s.name, "error", err)
 		s.writeError(w, http.StatusInternalServerError, "Failed to add credential")
 		return
@@ -1925,11 +2097,28 @@ func (s *Server) handleConfigInfo(w http.ResponseWriter, r *http.Request) {
 				"DELETE /admin/accounts/{email}",
 				"POST /admin/accounts/{email}/restore",
 				"GET /admin/accounts/{email}/exists",
+				"GET /admin/accounts/{email}/status",
+				"PUT /admin/accounts/{email}/status",
+				"GET /admin/accounts/{email}/app-passwords",
+				"POST /admin/accounts/{email}/app-passwords",
+				"DELETE /admin/accounts/{email}/app-passwords/{id}",
+				"GET /admin/accounts/{email}/totp",
+				"DELETE /admin/accounts/{email}/totp",
 				"POST /admin/accounts/{email}/credentials",
 				"GET /admin/accounts/{email}/credentials",
 			},
 			"domain_management": {
+				"GET /admin/domains",
+				"POST /admin/domains",
+				"GET /admin/domains/{domain}",
+				"PUT /admin/domains/{domain}",
+				"DELETE /admin/domains/{domain}",
 				"GET /admin/domains/{domain}/accounts (list accounts scoped to domain)",
+				"GET /admin/domains/{domain}/aliases",
+				"POST /admin/domains/{domain}/aliases",
+				"GET /admin/aliases/{address}",
+				"PUT /admin/aliases/{address}",
+				"DELETE /admin/aliases/{address}",
 			},
 			"credential_management": {
 				"GET /admin/credentials/{email}",
@@ -1965,6 +2154,18 @@ func (s *Server) handleConfigInfo(w http.ResponseWriter, r *http.Request) {
 			"system_information": {
 				"GET /admin/config",
 			},
+			"global_sieve_scripts": {
+				"GET /admin/sieve/scripts",
+				"POST /admin/sieve/scripts",
+				"GET /admin/sieve/scripts/{id}",
+				"PUT /admin/sieve/scripts/{id}",
+				"DELETE /admin/sieve/scripts/{id}",
+			},
+			"api_key_management": {
+				"GET /admin/api-keys",
+				"POST /admin/api-keys",
+				"DELETE /admin/api-keys/{id}",
+			},
 		},
 	})
 }
@@ -0,0 +1,70 @@
+package adminapi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/logger"
+)
+
+// handleTOTPOperations routes /admin/accounts/{email}/totp
+func (s *Server) handleTOTPOperations(w http.ResponseWriter, r *http.Request) {
+	email := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/admin/accounts/"), "/totp")
+
+	switch r.Method {
+	case "GET":
+		s.handleGetTOTP(w, r, email)
+	case "DELETE":
+		s.handleResetTOTP(w, r, email)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleGetTOTP handles GET /admin/accounts/{email}/totp
+func (s *Server) handleGetTOTP(w http.ResponseWriter, r *http.Request, email string) {
+	accountID, ok := s.lookupAccountID(w, r, email)
+	if !ok {
+		return
+	}
+
+	status, err := s.rdb.GetTOTPStatusWithRetry(r.Context(), accountID)
+	if err != nil {
+		logger.Warn("HTTP API: Error getting second factor status", "name", s.name, "email", email, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to get second factor status")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"email": email,
+		"totp":  status,
+	})
+}
+
+// handleResetTOTP handles DELETE /admin/accounts/{email}/totp. It removes the
+// second factor of a user who lost their authenticator and recovery codes;
+// the user can log in with the password alone and enrol again.
+func (s *Server) handleResetTOTP(w http.ResponseWriter, r *http.Request, email string) {
+	accountID, ok := s.lookupAccountID(w, r, email)
+	if !ok {
+		return
+	}
+
+	if err := s.rdb.DeleteTOTPWithRetry(r.Context(), accountID); err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			s.writeError(w, http.StatusNotFound, "Account has no second factor")
+			return
+		}
+		logger.Warn("HTTP API: Error resetting second factor", "name", s.name, "email", email, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to reset second factor")
+		return
+	}
+
+	logger.Info("HTTP API: Second factor reset", "name", s.name, "email", email)
+	s.writeJSON(w, http.StatusOK, map[string]string{
+		"email":   email,
+		"message": "Second factor reset successfully",
+	})
+}
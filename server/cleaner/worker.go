@@ -39,6 +39,7 @@ type DatabaseManager interface {
 	CleanupFailedUploadsWithRetry(ctx context.Context, gracePeriod time.Duration) (int64, error)
 	CleanupSoftDeletedAccountsWithRetry(ctx context.Context, gracePeriod time.Duration) (int64, error)
 	CleanupOldVacationResponsesWithRetry(ctx context.Context, gracePeriod time.Duration) (int64, error)
+	CleanupOldMailboxTombstonesWithRetry(ctx context.Context, gracePeriod time.Duration) (int64, error)
 	CleanupOldHealthStatusesWithRetry(ctx context.Context, retention time.Duration) (int64, error)
 	GetUserScopedObjectsForCleanupWithRetry(ctx context.Context, gracePeriod time.Duration, limit int) ([]db.UserScopedObjectForCleanup, error)
 	DeleteExpungedMessagesByS3KeyPartsBatchWithRetry(ctx context.Context, objects []db.UserScopedObjectForCleanup) (int64, error)
@@ -71,6 +72,8 @@ type CleanupWorker struct {
 	ftsRetention          time.Duration // How long to keep FTS vectors (text_body_tsv, headers_tsv)
 	healthStatusRetention time.Duration
 	lastNullifyHash       string // Cursor for O(1) Key-Set Pagination of legacy records
+	tiered                *storage.TieredStorage
+	tieringBatchSize      int
 	stopCh                chan struct{}
 	errCh                 chan<- error
 	wg                    sync.WaitGroup
@@ -79,14 +82,19 @@ type CleanupWorker struct {
 }
 
 // New creates a new CleanupWorker.
-func New(rdb *resilient.ResilientDatabase, s3 *storage.S3Storage, cache *cache.Cache, interval, gracePeriod, maxAgeRestriction, ftsRetention, healthStatusRetention time.Duration, errCh chan<- error) *CleanupWorker {
+func New(rdb *resilient.ResilientDatabase, s3 storage.BlobStore, cache *cache.Cache, interval, gracePeriod, maxAgeRestriction, ftsRetention, healthStatusRetention time.Duration, errCh chan<- error) *CleanupWorker {
 	// Wrap S3 storage with resilient patterns including circuit breakers
 	resilientS3 := resilient.NewResilientS3Storage(s3)
 
+	// Tiered storage moves old objects to the cold tier as part of each cycle
+	tiered, _ := s3.(*storage.TieredStorage)
+
 	return &CleanupWorker{
 		rdb:                   rdb,         // *resilient.ResilientDatabase implements DatabaseManager
 		s3:                    resilientS3, // *resilient.ResilientS3Storage implements S3Manager
 		cache:                 cache,       // *cache.Cache implements CacheManager
+		tiered:                tiered,
+		tieringBatchSize:      10000,
 		interval:              interval,
 		gracePeriod:           gracePeriod,
 		maxAgeRestriction:     maxAgeRestriction,
@@ -97,6 +105,14 @@ func New(rdb *resilient.ResilientDatabase, s3 *storage.S3Storage, cache *cache.C
 	}
 }
 
+// SetTieringBatchSize sets how many hot-tier objects are scanned for moving
+// to the cold tier per cleanup cycle. It has no effect without tiered storage.
+func (w *CleanupWorker) SetTieringBatchSize(n int) {
+	if n > 0 {
+		w.tieringBatchSize = n
+	}
+}
+
 func (w *CleanupWorker) Start(ctx context.Context) error {
 	w.mu.Lock()
 	if w.running {
@@ -251,6 +267,14 @@ func (w *CleanupWorker) runOnce(ctx context.Context) error {
 		logger.Info("Cleanup: Deleted old vacation responses", "count", vacationCount)
 	}
 
+	// Clean up mailbox tombstones kept for JMAP Mailbox/changes.
+	tombstoneCount, err := w.rdb.CleanupOldMailboxTombstonesWithRetry(ctx, w.gracePeriod)
+	if err != nil {
+		logger.Error("Cleanup: Failed to clean up old mailbox tombstones", "error", err)
+	} else if tombstoneCount > 0 {
+		logger.Info("Cleanup: Deleted old mailbox tombstones", "count", tombstoneCount)
+	}
+
 	// --- Cleanup of old health statuses ---
 	if w.healthStatusRetention > 0 {
 		healthCount, err = w.rdb.CleanupOldHealthStatusesWithRetry(ctx, w.healthStatusRetention)
@@ -425,12 +449,30 @@ func (w *CleanupWorker) runOnce(ctx context.Context) error {
 		}
 	}
 
+	// --- Phase 4: Storage tiering ---
+	// Move objects older than the tiering age to the cold tier. Running this
+	// under the cleanup lock keeps it from racing with the S3 deletes above.
+	var tieredCount int
+	if w.tiered != nil {
+		if !w.s3.IsHealthy() {
+			logger.Warn("Cleanup: Skipping storage tiering - S3 is unhealthy (circuit breaker open)")
+		} else {
+			tieredCount, err = w.tiered.MoveColdObjects(ctx, w.tieringBatchSize)
+			if err != nil {
+				logger.Error("Cleanup: Failed to move objects to cold storage tier", "error", err)
+			} else if tieredCount > 0 {
+				logger.Info("Cleanup: Moved objects to cold storage tier", "count", tieredCount)
+			}
+		}
+	}
+
 	// Log cleanup cycle summary for observability
 	logger.Info("Cleanup: Cycle completed", "failed_uploads", failedUploadsCount,
 		"soft_deleted_accounts", deletedAccountCount, "vacation_responses", vacationCount,
 		"health_statuses", healthCount, "s3_objects", len(successfulDeletes),
 		"orphan_hashes", orphanHashCount, "finalized_accounts", finalizedAccountCount,
-		"fts_pruned", ftsPrunedCount, "legacy_nullified", legacyNullifiedCount)
+		"fts_pruned", ftsPrunedCount, "legacy_nullified", legacyNullifiedCount,
+		"tiered", tieredCount)
 
 	return nil
 }
@@ -104,6 +104,7 @@ type ConnectionTracker struct {
 
 	// Cache invalidation (optional, for proxies)
 	lookupCache LookupCacheInvalidator // Interface for invalidating auth/routing cache on kick
+	authCache   AuthCacheInvalidator   // Interface for invalidating the persistent auth cache on kick
 
 	// Configuration
 	maxConnectionsPerUser      int  // Cluster-wide limit per user (0 = unlimited)
@@ -133,6 +134,11 @@ type LookupCacheInvalidator interface {
 	Invalidate(key string)
 }
 
+// AuthCacheInvalidator interface for invalidating cached credentials of an account
+type AuthCacheInvalidator interface {
+	InvalidateAuthCacheForAccount(ctx context.Context, accountID int64)
+}
+
 // NewConnectionTracker creates a new connection tracker.
 // If clusterMgr is provided, uses gossip protocol for cluster-wide tracking (for proxies).
 // If clusterMgr is nil, operates in local-only mode (for backend servers).
@@ -197,6 +203,27 @@ func (ct *ConnectionTracker) SetLookupCache(cache LookupCacheInvalidator) {
 	ct.lookupCache = cache
 }
 
+// SetAuthCache sets the persistent auth cache whose entries are dropped on kick
+// events, so that a kicked user (e.g. after a suspension) cannot log in again
+// from cached credentials.
+func (ct *ConnectionTracker) SetAuthCache(cache AuthCacheInvalidator) {
+	ct.authCache = cache
+}
+
+// invalidateAccountCaches drops the cached credentials of a kicked account from
+// the auth cache and, if it supports it, the lookup cache.
+func (ct *ConnectionTracker) invalidateAccountCaches(accountID int64) {
+	if inv, ok := ct.lookupCache.(interface{ InvalidateAccount(accountID int64) }); ok {
+		inv.InvalidateAccount(accountID)
+	}
+	if ct.authCache == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ct.authCache.InvalidateAuthCacheForAccount(ctx, accountID)
+}
+
 // trackerType returns the name of the tracker for logging purposes.
 func (ct *ConnectionTracker) trackerType() string {
 	if ct.clusterManager == nil {
@@ -524,6 +551,8 @@ func (ct *ConnectionTracker) KickUser(accountID int64, protocol string) error {
 	}
 	ct.mu.RUnlock()
 
+	ct.invalidateAccountCaches(accountID)
+
 	if ct.clusterManager != nil {
 		// Cluster mode: broadcast kick event via gossip
 		logger.Info("Gossip tracker: Broadcasting kick", "name", ct.name, "account_id", accountID, "protocol", protocol)
@@ -895,6 +924,7 @@ func (ct *ConnectionTracker) handleKick(event ConnectionEvent) {
 		ct.lookupCache.Invalidate(cacheKey)
 		logger.Debug("Gossip tracker: Invalidated cache on kick", "name", ct.name, "cache_key", cacheKey, "account_id", event.AccountID)
 	}
+	ct.invalidateAccountCaches(event.AccountID)
 
 	// Notify all sessions for this user
 	ct.kickSessionsMu.Lock()
@@ -9,19 +9,21 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/imapserver"
 	"github.com/emersion/go-message"
 	"github.com/emersion/go-message/mail"
-	"github.com/jackc/pgx/v5"
 	"github.com/migadu/sora/consts"
 	"github.com/migadu/sora/db"
 	"github.com/migadu/sora/helpers"
 	"github.com/migadu/sora/pkg/metrics"
 	"github.com/migadu/sora/pkg/resilient"
 	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/sieveengine"
 	"github.com/migadu/sora/server/uploader"
 )
 
@@ -47,8 +49,12 @@ type Logger interface {
 type DeliveryResult struct {
 	Success      bool
 	Discarded    bool
-	MailboxName  string
-	MessageUID   uint32
+	Rejected     bool     // Rejected by Sieve reject or ereject (RFC 5429)
+	RejectReason string   // Reason of the rejection, for the reply to the client
+	MailboxName  string   // First mailbox the message was stored in
+	MessageUID   uint32   // UID of the message in MailboxName
+	Mailboxes    []string // All mailboxes the message was stored in
+	Redirects    []string // Addresses the message was redirected to
 	ErrorMessage string
 }
 
@@ -61,10 +67,15 @@ type RecipientInfo struct {
 	PreservedUID    *uint32         // Optional: preserved UID for migration
 	PreservedUIDVal *uint32         // Optional: preserved UIDVALIDITY for migration
 	TargetMailbox   string          // Optional: target mailbox (bypasses Sieve)
+	Flags           []imap.Flag     // Optional: flags of the stored message (for migration)
+	InternalDate    time.Time       // Optional: internal date of the stored message (for migration)
 }
 
 // DeliverMessage is the main entry point for message delivery.
 // It handles the complete delivery flow: parsing, Sieve execution, and storage.
+// All mailboxes a Sieve script files the message into are written in one
+// transaction. Redirects and vacation responses are only sent once the
+// message is stored; a redirect that cannot be sent keeps the message in INBOX.
 func (d *DeliveryContext) DeliverMessage(recipient RecipientInfo, messageBytes []byte) (*DeliveryResult, error) {
 	result := &DeliveryResult{
 		Success:     false,
@@ -79,11 +90,159 @@ func (d *DeliveryContext) DeliverMessage(recipient RecipientInfo, messageBytes [
 		return result, err
 	}
 
+	// Enforce the recipient's quota before doing any work
+	if err := d.RDB.CheckQuotaWithRetry(d.Ctx, recipient.AccountID, int64(len(messageBytes)), 1); err != nil {
+		if errors.Is(err, consts.ErrQuotaExceeded) {
+			result.ErrorMessage = "Mailbox full, message exceeds quota"
+			return result, err
+		}
+		result.ErrorMessage = fmt.Sprintf("Failed to check quota: %v", err)
+		return result, err
+	}
+
 	// Collect metrics
 	metrics.MessageSizeBytes.WithLabelValues(d.MetricsLabel).Observe(float64(len(messageBytes)))
 	metrics.BytesThroughput.WithLabelValues(d.MetricsLabel, "in").Add(float64(len(messageBytes)))
 	metrics.MessageThroughput.WithLabelValues(d.MetricsLabel, "received", "success").Inc()
 
+	// Extract plaintext body for FTS
+	plaintextBody, err := helpers.ExtractPlaintextBody(messageEntity)
+	if err != nil {
+		emptyBody := ""
+		plaintextBody = &emptyBody
+	}
+
+	// Determine the actions
+	var sieveResult sieveengine.Result
+	if recipient.TargetMailbox != "" {
+		// Use explicit target mailbox (bypasses Sieve - for migrations)
+		sieveResult = sieveengine.Result{Actions: []sieveengine.Action{{Type: sieveengine.ActionFileInto, Mailbox: recipient.TargetMailbox}}}
+	} else {
+		// Execute Sieve scripts
+		sieveResult, err = d.SieveExecutor.ExecuteSieve(d.Ctx, recipient, messageEntity, plaintextBody, messageBytes)
+		if err != nil {
+			result.ErrorMessage = fmt.Sprintf("Sieve execution error: %v", err)
+			return result, err
+		}
+	}
+
+	// A rejected message is neither stored nor redirected (RFC 5429). The
+	// caller refuses it for the recipient.
+	if reject, ok := sieveResult.Rejection(); ok {
+		d.SieveExecutor.SendMessages(d.Ctx, recipient, sieveengine.Result{Actions: sieveResult.Notifications()}, messageEntity, messageBytes)
+		result.Success = true
+		result.Rejected = true
+		result.RejectReason = RejectionReply(reject)
+		result.MailboxName = ""
+		return result, nil
+	}
+
+	// Apply header edits (RFC 5293) to the stored message. Redirects apply
+	// their own edits to the original message.
+	originalBytes := messageBytes
+	if len(sieveResult.HeaderEdits) > 0 {
+		editedBytes, err := sieveengine.ApplyHeaderEdits(messageBytes, sieveResult.HeaderEdits)
+		if err != nil {
+			d.Logger.Log("Failed to apply header edits: %v", err)
+		} else if editedEntity, err := message.Read(bytes.NewReader(editedBytes)); err != nil {
+			d.Logger.Log("Failed to parse message after header edits: %v", err)
+		} else {
+			messageBytes = editedBytes
+			messageEntity = editedEntity
+		}
+	}
+
+	deliveries := sieveResult.Deliveries()
+	redirects := sieveResult.Redirects()
+	outgoing := sieveResult
+	if len(redirects) > 0 && !d.SieveExecutor.CanRedirect() {
+		d.Logger.Log("Redirect requested but external relay not configured, keeping message in INBOX")
+		deliveries = keepInInbox(deliveries)
+		redirects = nil
+		outgoing = sieveengine.Result{Actions: append(sieveResult.Vacation(), sieveResult.Notifications()...)}
+	}
+
+	if len(deliveries) == 0 {
+		// Nothing to store: the message is discarded or only redirected
+		failed := d.SieveExecutor.SendMessages(d.Ctx, recipient, outgoing, messageEntity, originalBytes)
+		if len(failed) == 0 {
+			result.Success = true
+			result.Discarded = len(redirects) == 0
+			result.MailboxName = ""
+			result.Redirects = redirectAddresses(redirects)
+			return result, nil
+		}
+		// Fallback: a message that could not be redirected is kept
+		deliveries = keepInInbox(nil)
+		redirects = removeRedirects(redirects, failed)
+		outgoing = sieveengine.Result{}
+	}
+
+	mailboxes, uids, err := d.storeMessage(recipient, messageBytes, messageEntity, plaintextBody, deliveries, result)
+	if err != nil {
+		return result, err
+	}
+
+	if len(outgoing.Redirects()) > 0 || len(outgoing.Vacation()) > 0 || len(outgoing.Notifications()) > 0 {
+		failed := d.SieveExecutor.SendMessages(d.Ctx, recipient, outgoing, messageEntity, originalBytes)
+		redirects = removeRedirects(redirects, failed)
+		if len(failed) > 0 && !slices.Contains(mailboxes, consts.MailboxInbox) {
+			// Fallback: a message that could not be redirected is kept
+			inboxMailboxes, _, err := d.storeMessage(recipient, messageBytes, messageEntity, plaintextBody, keepInInbox(nil), result)
+			if err != nil && !errors.Is(err, consts.ErrMessageExists) {
+				d.Logger.Log("Failed to keep message that could not be redirected: %v", err)
+			}
+			mailboxes = append(mailboxes, inboxMailboxes...)
+		}
+	}
+
+	result.Success = true
+	result.ErrorMessage = ""
+	result.Mailboxes = mailboxes
+	result.Redirects = redirectAddresses(redirects)
+	if len(mailboxes) > 0 {
+		result.MailboxName = mailboxes[0]
+		result.MessageUID = uint32(uids[0])
+	}
+	return result, nil
+}
+
+// keepInInbox adds the keep to INBOX to the deliveries of a message, unless
+// they already store it in INBOX.
+func keepInInbox(deliveries []sieveengine.Action) []sieveengine.Action {
+	for _, delivery := range deliveries {
+		if strings.EqualFold(delivery.Mailbox, consts.MailboxInbox) {
+			return deliveries
+		}
+	}
+	return append(deliveries, sieveengine.Action{Type: sieveengine.ActionKeep, Mailbox: consts.MailboxInbox})
+}
+
+// removeRedirects returns the redirects that are not among the failed ones.
+func removeRedirects(redirects, failed []sieveengine.Action) []sieveengine.Action {
+	var sent []sieveengine.Action
+	for _, redirect := range redirects {
+		if !slices.ContainsFunc(failed, func(f sieveengine.Action) bool { return f.RedirectTo == redirect.RedirectTo }) {
+			sent = append(sent, redirect)
+		}
+	}
+	return sent
+}
+
+func redirectAddresses(redirects []sieveengine.Action) []string {
+	var addresses []string
+	for _, redirect := range redirects {
+		addresses = append(addresses, redirect.RedirectTo)
+	}
+	return addresses
+}
+
+// storeMessage stores a message in the mailboxes of its Sieve deliveries,
+// in one transaction. It returns the names of the mailboxes and the UIDs of
+// the message in them. Mailboxes that already hold the message are left out.
+func (d *DeliveryContext) storeMessage(recipient RecipientInfo, messageBytes []byte, messageEntity *message.Entity,
+	plaintextBody *string, deliveries []sieveengine.Action, result *DeliveryResult) ([]string, []int64, error) {
+
 	// Extract raw headers
 	var rawHeadersText string
 	headerEndIndex := bytes.Index(messageBytes, []byte("\r\n\r\n"))
@@ -97,6 +256,7 @@ func (d *DeliveryContext) DeliverMessage(recipient RecipientInfo, messageBytes [
 	messageID, _ := mailHeader.MessageID()
 	sentDate, _ := mailHeader.Date()
 	inReplyTo, _ := mailHeader.MsgIDList("In-Reply-To")
+	references, _ := mailHeader.MsgIDList("References")
 
 	if sentDate.IsZero() {
 		sentDate = time.Now()
@@ -105,13 +265,6 @@ func (d *DeliveryContext) DeliverMessage(recipient RecipientInfo, messageBytes [
 	// Calculate content hash
 	contentHash := helpers.HashContent(messageBytes)
 
-	// Extract plaintext body for FTS
-	plaintextBody, err := helpers.ExtractPlaintextBody(messageEntity)
-	if err != nil {
-		emptyBody := ""
-		plaintextBody = &emptyBody
-	}
-
 	// Extract body structure
 	bodyStructureVal := imapserver.ExtractBodyStructure(bytes.NewReader(messageBytes))
 	bodyStructure := &bodyStructureVal
@@ -134,6 +287,67 @@ func (d *DeliveryContext) DeliverMessage(recipient RecipientInfo, messageBytes [
 	// Extract recipients
 	recipients := helpers.ExtractRecipients(messageEntity.Header)
 
+	// Resolve the mailboxes, falling back to INBOX like Sieve fileinto does
+	internalDate := recipient.InternalDate
+	if internalDate.IsZero() {
+		internalDate = time.Now()
+	}
+	size := int64(len(messageBytes))
+	var options []*db.InsertMessageOptions
+	for _, delivery := range deliveries {
+		var mailbox *db.DBMailbox
+		var err error
+		if delivery.Create {
+			mailbox, err = d.RDB.GetOrCreateMailboxByNameWithRetry(d.Ctx, recipient.AccountID, delivery.Mailbox)
+		} else {
+			mailbox, err = d.RDB.GetMailboxByNameWithRetry(d.Ctx, recipient.AccountID, delivery.Mailbox)
+			if errors.Is(err, consts.ErrMailboxNotFound) && recipient.TargetMailbox == "" {
+				mailbox, err = d.RDB.GetMailboxByNameWithRetry(d.Ctx, recipient.AccountID, consts.MailboxInbox)
+			}
+		}
+		if err != nil {
+			result.ErrorMessage = fmt.Sprintf("Failed to get mailbox %s: %v", delivery.Mailbox, err)
+			return nil, nil, err
+		}
+		if slices.ContainsFunc(options, func(o *db.InsertMessageOptions) bool { return o.MailboxID == mailbox.ID }) {
+			continue
+		}
+
+		flags := []imap.Flag{} // Unread
+		flags = append(flags, recipient.Flags...)
+		for _, flag := range delivery.Flags {
+			flags = append(flags, imap.Flag(flag))
+		}
+
+		opts := &db.InsertMessageOptions{
+			AccountID:     recipient.AccountID,
+			MailboxID:     mailbox.ID,
+			S3Domain:      recipient.Address.Domain(),
+			S3Localpart:   recipient.Address.LocalPart(),
+			MailboxName:   mailbox.Name,
+			ContentHash:   contentHash,
+			MessageID:     messageID,
+			InternalDate:  internalDate,
+			Size:          size,
+			Subject:       subject,
+			PlaintextBody: *plaintextBody,
+			SentDate:      sentDate,
+			InReplyTo:     inReplyTo,
+			References:    references,
+			BodyStructure: bodyStructure,
+			Recipients:    recipients,
+			Flags:         flags,
+			RawHeaders:    rawHeadersText,
+			FTSRetention:  d.FTSRetention,
+		}
+		// A preserved UID belongs to a single mailbox
+		if len(options) == 0 {
+			opts.PreservedUID = recipient.PreservedUID
+			opts.PreservedUIDValidity = recipient.PreservedUIDVal
+		}
+		options = append(options, opts)
+	}
+
 	// Store message locally for background upload to S3
 	// Check if file already exists to prevent race condition:
 	// If a duplicate arrives while uploader is processing the first copy,
@@ -145,7 +359,7 @@ func (d *DeliveryContext) DeliverMessage(recipient RecipientInfo, messageBytes [
 		filePath, err = d.Uploader.StoreLocally(contentHash, recipient.AccountID, messageBytes)
 		if err != nil {
 			result.ErrorMessage = fmt.Sprintf("Failed to save message to disk: %v", err)
-			return result, err
+			return nil, nil, err
 		}
 		d.Logger.Log("Message accepted locally, file written: %s", *filePath)
 	} else if err == nil {
@@ -156,63 +370,11 @@ func (d *DeliveryContext) DeliverMessage(recipient RecipientInfo, messageBytes [
 	} else {
 		// Stat error (permission issue, etc.)
 		result.ErrorMessage = fmt.Sprintf("Failed to check file existence: %v", err)
-		return result, fmt.Errorf("failed to check file existence: %w", err)
+		return nil, nil, fmt.Errorf("failed to check file existence: %w", err)
 	}
 
-	// Determine target mailbox
-	var mailboxName string
-	var discarded bool
-
-	if recipient.TargetMailbox != "" {
-		// Use explicit target mailbox (bypasses Sieve - for migrations)
-		mailboxName = recipient.TargetMailbox
-		discarded = false
-	} else {
-		// Execute Sieve scripts
-		mailboxName, discarded, err = d.SieveExecutor.ExecuteSieve(
-			d.Ctx,
-			recipient,
-			messageEntity,
-			plaintextBody,
-			messageBytes,
-		)
-		if err != nil {
-			result.ErrorMessage = fmt.Sprintf("Sieve execution error: %v", err)
-			return result, err
-		}
-
-		if discarded {
-			result.Discarded = true
-			result.Success = true
-			return result, nil
-		}
-	}
-
-	// Save message to mailbox
-	size := int64(len(messageBytes))
-	_, messageUID, err := d.RDB.InsertMessageWithRetry(d.Ctx,
-		&db.InsertMessageOptions{
-			AccountID:            recipient.AccountID,
-			MailboxID:            0, // Will be set by InsertMessage based on mailboxName
-			S3Domain:             recipient.Address.Domain(),
-			S3Localpart:          recipient.Address.LocalPart(),
-			MailboxName:          mailboxName,
-			ContentHash:          contentHash,
-			MessageID:            messageID,
-			InternalDate:         time.Now(),
-			Size:                 size,
-			Subject:              subject,
-			PlaintextBody:        *plaintextBody,
-			SentDate:             sentDate,
-			InReplyTo:            inReplyTo,
-			BodyStructure:        bodyStructure,
-			Recipients:           recipients,
-			Flags:                []imap.Flag{}, // Unread
-			RawHeaders:           rawHeadersText,
-			FTSRetention:         d.FTSRetention,
-			PreservedUID:         recipient.PreservedUID,
-			PreservedUIDValidity: recipient.PreservedUIDVal,
-		},
+	// Save message to all mailboxes at once
+	uids, err := d.RDB.InsertMessageIntoMailboxesWithRetry(d.Ctx, options,
 		db.PendingUpload{
 			ContentHash: contentHash,
 			InstanceID:  d.Hostname,
@@ -239,7 +401,7 @@ func (d *DeliveryContext) DeliverMessage(recipient RecipientInfo, messageBytes [
 			}
 			result.ErrorMessage = "Message already exists"
 			// Don't notify uploader for duplicates
-			return result, err
+			return nil, nil, err
 		}
 		// DO NOT delete the local file on non-duplicate errors.
 		//
@@ -263,7 +425,7 @@ func (d *DeliveryContext) DeliverMessage(recipient RecipientInfo, messageBytes [
 			d.Logger.Log("Keeping local file after DB error (transaction may have committed): %s", *filePath)
 		}
 		result.ErrorMessage = fmt.Sprintf("Failed to save message: %v", err)
-		return result, err
+		return nil, nil, err
 	}
 
 	// Notify uploader
@@ -275,14 +437,30 @@ func (d *DeliveryContext) DeliverMessage(recipient RecipientInfo, messageBytes [
 	metrics.TrackDomainBytes(d.MetricsLabel, recipient.Address.Domain(), "in", size)
 	metrics.TrackUserActivity(d.MetricsLabel, recipient.Address.FullAddress(), "command", 1)
 
-	result.Success = true
-	result.MailboxName = mailboxName
-	result.MessageUID = uint32(messageUID)
-	return result, nil
+	var mailboxes []string
+	var storedUIDs []int64
+	for i, opts := range options {
+		if uids[i] != 0 {
+			mailboxes = append(mailboxes, opts.MailboxName)
+			storedUIDs = append(storedUIDs, uids[i])
+		}
+	}
+	return mailboxes, storedUIDs, nil
 }
 
-// LookupRecipient looks up a recipient's user ID by email address.
-func (d *DeliveryContext) LookupRecipient(ctx context.Context, recipient string) (*RecipientInfo, error) {
+// RecipientLookup is the result of looking up a recipient address: the local
+// accounts that receive the message and the external addresses it is
+// forwarded to. An account address has a single recipient; an alias or
+// catch-all may expand to several recipients and forwards.
+type RecipientLookup struct {
+	Recipients []RecipientInfo
+	Forwards   []string
+}
+
+// LookupRecipient looks up the accounts of a recipient address. Addresses
+// without an account are resolved through the aliases and catch-all of their
+// domain.
+func (d *DeliveryContext) LookupRecipient(ctx context.Context, recipient string) (*RecipientLookup, error) {
 	// Parse recipient address
 	toAddress, err := server.NewAddress(recipient)
 	if err != nil {
@@ -291,114 +469,71 @@ func (d *DeliveryContext) LookupRecipient(ctx context.Context, recipient string)
 
 	lookupAddress := toAddress.BaseAddress()
 
-	// Lookup user account and get primary address in one query
-	// This finds the account by alias/recipient address, but returns the primary address
-	var AccountID int64
-	var primaryEmail string
-	err = d.RDB.QueryRowWithRetry(ctx, `
-		SELECT c.account_id, primary_cred.address
-		FROM credentials c
-		JOIN accounts a ON c.account_id = a.id
-		JOIN credentials primary_cred ON primary_cred.account_id = c.account_id AND primary_cred.primary_identity = TRUE
-		WHERE LOWER(c.address) = $1 AND a.deleted_at IS NULL
-	`, lookupAddress).Scan(&AccountID, &primaryEmail)
+	accountID, err := d.RDB.GetActiveAccountIDByAddressWithRetry(ctx, lookupAddress)
+	if err == nil {
+		info, err := d.recipientInfo(ctx, accountID, toAddress)
+		if err != nil {
+			return nil, err
+		}
+		return &RecipientLookup{Recipients: []RecipientInfo{*info}}, nil
+	}
+	if errors.Is(err, consts.ErrDomainSuspended) {
+		return nil, fmt.Errorf("recipient domain suspended: %s", recipient)
+	}
+	if errors.Is(err, consts.ErrAccountSuspended) {
+		return nil, fmt.Errorf("recipient account does not accept mail: %s", recipient)
+	}
+	if !errors.Is(err, consts.ErrUserNotFound) {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
 
+	targets, err := d.RDB.ResolveAliasWithRetry(ctx, lookupAddress)
 	if err != nil {
-		if err == pgx.ErrNoRows {
+		if errors.Is(err, consts.ErrDomainSuspended) {
+			return nil, fmt.Errorf("recipient domain suspended: %s", recipient)
+		}
+		if errors.Is(err, consts.ErrUserNotFound) {
 			return nil, fmt.Errorf("recipient not found: %s", recipient)
 		}
 		return nil, fmt.Errorf("database error: %w", err)
 	}
 
-	// Parse primary email address
-	primaryAddr, err := server.NewAddress(primaryEmail)
+	lookup := &RecipientLookup{}
+	for _, target := range targets {
+		if !target.IsLocal() {
+			lookup.Forwards = append(lookup.Forwards, target.Address)
+			continue
+		}
+		info, err := d.recipientInfo(ctx, target.AccountID, toAddress)
+		if err != nil {
+			return nil, err
+		}
+		lookup.Recipients = append(lookup.Recipients, *info)
+	}
+	return lookup, nil
+}
+
+// recipientInfo returns the delivery information of an account and makes sure
+// its default mailboxes exist.
+func (d *DeliveryContext) recipientInfo(ctx context.Context, accountID int64, toAddress server.Address) (*RecipientInfo, error) {
+	primaryAddr, err := d.RDB.GetPrimaryEmailForAccountWithRetry(ctx, accountID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid primary email format in database: %w", err)
+		return nil, fmt.Errorf("database error: %w", err)
 	}
 
 	// Create default mailboxes if needed
-	err = d.RDB.CreateDefaultMailboxesWithRetry(ctx, AccountID)
+	err = d.RDB.CreateDefaultMailboxesWithRetry(ctx, accountID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create default mailboxes: %w", err)
 	}
 
 	return &RecipientInfo{
-		AccountID: AccountID,
+		AccountID: accountID,
 		Address:   &primaryAddr, // Primary address (for S3 keys, metrics, etc.)
 		ToAddress: &toAddress,   // Recipient address as sent (may include +alias)
 	}, nil
 }
 
-// SaveMessageToMailbox saves a message to a specific mailbox (helper for Sieve :copy).
-func (d *DeliveryContext) SaveMessageToMailbox(ctx context.Context, recipient RecipientInfo, mailboxName string, messageBytes []byte, messageEntity *message.Entity, plaintextBody *string) error {
-	mailbox, err := d.RDB.GetMailboxByNameWithRetry(ctx, recipient.AccountID, mailboxName)
-	if err != nil {
-		if err == consts.ErrMailboxNotFound {
-			// Fallback to INBOX
-			mailbox, err = d.RDB.GetMailboxByNameWithRetry(ctx, recipient.AccountID, consts.MailboxInbox)
-			if err != nil {
-				return err
-			}
-		} else {
-			return err
-		}
-	}
-
-	// Parse message metadata
-	mailHeader := mail.Header{Header: messageEntity.Header}
-	subject, _ := mailHeader.Subject()
-	messageID, _ := mailHeader.MessageID()
-	sentDate, _ := mailHeader.Date()
-	inReplyTo, _ := mailHeader.MsgIDList("In-Reply-To")
-
-	if sentDate.IsZero() {
-		sentDate = time.Now()
-	}
-
-	contentHash := helpers.HashContent(messageBytes)
-	bodyStructureVal := imapserver.ExtractBodyStructure(bytes.NewReader(messageBytes))
-	bodyStructure := &bodyStructureVal
-	recipients := helpers.ExtractRecipients(messageEntity.Header)
-
-	var rawHeadersText string
-	headerEndIndex := bytes.Index(messageBytes, []byte("\r\n\r\n"))
-	if headerEndIndex != -1 {
-		rawHeadersText = string(messageBytes[:headerEndIndex])
-	}
-
-	size := int64(len(messageBytes))
-
-	_, _, err = d.RDB.InsertMessageWithRetry(ctx,
-		&db.InsertMessageOptions{
-			AccountID:     recipient.AccountID,
-			MailboxID:     mailbox.ID,
-			S3Domain:      recipient.Address.Domain(),
-			S3Localpart:   recipient.Address.LocalPart(),
-			MailboxName:   mailbox.Name,
-			ContentHash:   contentHash,
-			MessageID:     messageID,
-			InternalDate:  time.Now(),
-			Size:          size,
-			Subject:       subject,
-			PlaintextBody: *plaintextBody,
-			SentDate:      sentDate,
-			InReplyTo:     inReplyTo,
-			BodyStructure: bodyStructure,
-			Recipients:    recipients,
-			Flags:         []imap.Flag{},
-			RawHeaders:    rawHeadersText,
-			FTSRetention:  d.FTSRetention,
-		},
-		db.PendingUpload{
-			ContentHash: contentHash,
-			InstanceID:  d.Hostname,
-			Size:        size,
-			AccountID:   recipient.AccountID,
-		})
-
-	return err
-}
-
 // ParseMessageReader reads and parses a message from an io.Reader.
 func ParseMessageReader(r io.Reader) ([]byte, *message.Entity, error) {
 	var buf bytes.Buffer
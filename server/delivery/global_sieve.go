@@ -0,0 +1,99 @@
+package delivery
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/server/sieveengine"
+)
+
+// globalSieveTTL is how long the global scripts of a domain are used before
+// they are read again, and so how long changes take to apply.
+const globalSieveTTL = time.Minute
+
+// GlobalSieveStore reads the global Sieve scripts of a domain.
+type GlobalSieveStore interface {
+	GetActiveGlobalSieveScriptsWithRetry(ctx context.Context, domain string) ([]db.GlobalSieveScript, error)
+}
+
+// GlobalSieveScripts provides the administrator's before and after scripts
+// of a domain, parsed and cached for globalSieveTTL.
+type GlobalSieveScripts struct {
+	store      GlobalSieveStore
+	extensions []string
+
+	mu      sync.Mutex
+	domains map[string]*globalSieveEntry
+}
+
+type globalSieveEntry struct {
+	before   []sieveengine.Script
+	after    []sieveengine.Script
+	loadedAt time.Time
+}
+
+// NewGlobalSieveScripts returns the global scripts of store. Scripts may use
+// the given extensions, see sieveengine.GlobalExtensions.
+func NewGlobalSieveScripts(store GlobalSieveStore, extensions []string) *GlobalSieveScripts {
+	return &GlobalSieveScripts{
+		store:      store,
+		extensions: sieveengine.GlobalExtensions(extensions),
+		domains:    make(map[string]*globalSieveEntry),
+	}
+}
+
+// Scripts returns the before and after scripts of a domain in the order
+// they run. If the scripts cannot be read, the previously read scripts are
+// used; without those the error is returned and the message should not be
+// delivered. Stored scripts that no
+// longer parse, e.g. after the allowed extensions changed, are skipped.
+func (g *GlobalSieveScripts) Scripts(ctx context.Context, domain string) (before, after []sieveengine.Script, err error) {
+	if g == nil {
+		return nil, nil, nil
+	}
+	domain = strings.ToLower(domain)
+
+	g.mu.Lock()
+	entry := g.domains[domain]
+	g.mu.Unlock()
+	if entry != nil && time.Since(entry.loadedAt) < globalSieveTTL {
+		return entry.before, entry.after, nil
+	}
+
+	scripts, err := g.store.GetActiveGlobalSieveScriptsWithRetry(ctx, domain)
+	if err != nil {
+		if entry != nil {
+			logger.Warn("Failed to reload global sieve scripts, using the previous ones", "domain", domain, "error", err)
+			return entry.before, entry.after, nil
+		}
+		return nil, nil, err
+	}
+
+	entry = &globalSieveEntry{loadedAt: time.Now()}
+	for _, script := range scripts {
+		executor, err := sieveengine.NewSieveExecutorWithExtensions(script.Script, g.extensions)
+		if err != nil {
+			logger.Warn("Skipping invalid global sieve script", "id", script.ID, "name", script.Name, "domain", script.Domain, "error", err)
+			continue
+		}
+
+		named := sieveengine.Script{Name: script.Phase + "/" + script.Name, Executor: executor}
+		if script.Domain != "" {
+			named.Name = script.Domain + ":" + named.Name
+		}
+		if script.Phase == db.GlobalSievePhaseBefore {
+			entry.before = append(entry.before, named)
+		} else {
+			entry.after = append(entry.after, named)
+		}
+	}
+
+	g.mu.Lock()
+	g.domains[domain] = entry
+	g.mu.Unlock()
+	return entry.before, entry.after, nil
+}
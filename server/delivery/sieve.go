@@ -13,11 +13,19 @@ import (
 )
 
 // SieveExecutor interface defines the contract for Sieve script execution.
+// ExecuteSieve returns the actions of the recipient's script without
+// performing them. The message is stored by the caller, after which
+// SendMessages performs the actions that leave the account: redirects,
+// vacation responses and notifications. It returns the redirects that could
+// not be sent.
 type SieveExecutor interface {
-	ExecuteSieve(ctx context.Context, recipient RecipientInfo, messageEntity *message.Entity, plaintextBody *string, fullMessageBytes []byte) (mailboxName string, discarded bool, err error)
+	ExecuteSieve(ctx context.Context, recipient RecipientInfo, messageEntity *message.Entity, plaintextBody *string, fullMessageBytes []byte) (sieveengine.Result, error)
+	CanRedirect() bool
+	SendMessages(ctx context.Context, recipient RecipientInfo, result sieveengine.Result, messageEntity *message.Entity, fullMessageBytes []byte) (failed []sieveengine.Action)
 }
 
-// VacationOracle implements the sieveengine.VacationOracle interface using the database.
+// VacationOracle implements the sieveengine.VacationOracle and
+// sieveengine.NotifyOracle interfaces using the database.
 type VacationOracle struct {
 	RDB *resilient.ResilientDatabase
 }
@@ -36,6 +44,20 @@ func (o *VacationOracle) RecordVacationResponseSent(ctx context.Context, Account
 	return o.RDB.RecordVacationResponseWithRetry(ctx, AccountID, originalSender)
 }
 
+// IsNotificationAllowed checks if the account sent fewer than limit Sieve notifications within window.
+func (o *VacationOracle) IsNotificationAllowed(ctx context.Context, AccountID int64, limit int, window time.Duration) (bool, error) {
+	count, err := o.RDB.CountRecentSieveNotificationsWithRetry(ctx, AccountID, window)
+	if err != nil {
+		return false, fmt.Errorf("checking db for recent sieve notifications: %w", err)
+	}
+	return count < limit, nil
+}
+
+// RecordNotificationSent records that a Sieve notification has been sent.
+func (o *VacationOracle) RecordNotificationSent(ctx context.Context, AccountID int64, method string) error {
+	return o.RDB.RecordSieveNotificationWithRetry(ctx, AccountID, method, sieveengine.NotifyWindow)
+}
+
 // RelayQueue interface defines operations for queuing relay messages
 type RelayQueue interface {
 	Enqueue(from, to, messageType string, messageBytes []byte) error
@@ -47,15 +69,16 @@ type StandardSieveExecutor struct {
 	VacationOracle  *VacationOracle
 	VacationHandler VacationHandler
 	RelayHandler    RelayHandler
-	RelayQueue      RelayQueue // Optional: disk-based queue for relay retry
+	RelayQueue      RelayQueue                 // Optional: disk-based queue for relay retry
+	GlobalScripts   *GlobalSieveScripts        // Optional: before and after scripts of the administrator
+	FilterHeaders   *sieveengine.FilterHeaders // Optional: spam and virus headers of spamtest and virustest
 }
 
-// ExecuteSieve executes Sieve scripts and returns target mailbox.
-// Returns: mailboxName, discarded, error
-func (s *StandardSieveExecutor) ExecuteSieve(ctx context.Context, recipient RecipientInfo, messageEntity *message.Entity, plaintextBody *string, fullMessageBytes []byte) (string, bool, error) {
-	// Default to INBOX
-	mailboxName := consts.MailboxInbox
-
+// ExecuteSieve executes the global before scripts, the recipient's Sieve
+// script and the global after scripts, see sieveengine.Sequence, and returns
+// their actions. Without scripts, or if they fail, the message is kept in
+// INBOX. An error is only returned if the global scripts cannot be read.
+func (s *StandardSieveExecutor) ExecuteSieve(ctx context.Context, recipient RecipientInfo, messageEntity *message.Entity, plaintextBody *string, fullMessageBytes []byte) (sieveengine.Result, error) {
 	// Create Sieve context
 	envelopeFrom := ""
 	if recipient.FromAddress != nil {
@@ -67,88 +90,121 @@ func (s *StandardSieveExecutor) ExecuteSieve(ctx context.Context, recipient Reci
 		EnvelopeTo:   recipient.ToAddress.FullAddress(),
 		Header:       messageEntity.Header.Map(),
 		Body:         *plaintextBody,
+		Message:      fullMessageBytes,
+		Filter:       s.FilterHeaders,
+	}
+
+	before, after, err := s.GlobalScripts.Scripts(ctx, recipient.Address.Domain())
+	if err != nil {
+		return sieveengine.KeepResult(), fmt.Errorf("failed to get global sieve scripts: %w", err)
+	}
+	sequence := sieveengine.Sequence{
+		Before: before,
+		After:  after,
+		Observe: func(script sieveengine.Script, _ sieveengine.Result, err error) {
+			if err != nil {
+				s.DeliveryCtx.Logger.Log("Sieve script %s failed: %v", script.Name, err)
+				metrics.SieveExecutions.WithLabelValues(s.DeliveryCtx.MetricsLabel, "failure").Inc()
+			} else {
+				metrics.SieveExecutions.WithLabelValues(s.DeliveryCtx.MetricsLabel, "success").Inc()
+			}
+		},
 	}
 
 	// Get user's active script
 	activeScript, err := s.DeliveryCtx.RDB.GetActiveScriptWithRetry(ctx, recipient.AccountID)
 	if err != nil && err != consts.ErrDBNotFound {
-		// Non-critical error, continue with INBOX delivery
-		return mailboxName, false, nil
+		// Non-critical error, continue without the user script
+		activeScript = nil
 	}
-
-	var result sieveengine.Result
 	if activeScript != nil {
-		// Execute user script
 		executor, err := sieveengine.NewSieveExecutorWithOracle(activeScript.Script, recipient.AccountID, s.VacationOracle)
 		if err != nil {
 			metrics.SieveExecutions.WithLabelValues(s.DeliveryCtx.MetricsLabel, "failure").Inc()
-			return mailboxName, false, nil
-		}
-
-		result, err = executor.Evaluate(ctx, sieveCtx)
-		if err != nil {
-			metrics.SieveExecutions.WithLabelValues(s.DeliveryCtx.MetricsLabel, "failure").Inc()
-			return mailboxName, false, nil
+		} else {
+			sequence.User = &sieveengine.Script{Name: activeScript.Name, Executor: executor}
 		}
-
-		metrics.SieveExecutions.WithLabelValues(s.DeliveryCtx.MetricsLabel, "success").Inc()
-	} else {
-		// No script, keep in INBOX
-		result = sieveengine.Result{Action: sieveengine.ActionKeep}
 	}
 
-	// Process result
-	switch result.Action {
-	case sieveengine.ActionDiscard:
-		return "", true, nil
+	// Failed scripts are skipped and already logged
+	result, _ := sequence.Evaluate(ctx, sieveCtx)
+	return result, nil
+}
 
-	case sieveengine.ActionFileInto:
-		mailboxName = result.Mailbox
-		if result.Copy {
-			// Save to specified mailbox
-			err := s.DeliveryCtx.SaveMessageToMailbox(ctx, recipient, result.Mailbox, fullMessageBytes, messageEntity, plaintextBody)
-			if err != nil {
-				return "", false, err
-			}
-			// Also save to INBOX
-			mailboxName = consts.MailboxInbox
+// CanRedirect reports whether redirected messages can be sent at all. If
+// not, the message is kept instead.
+func (s *StandardSieveExecutor) CanRedirect() bool {
+	return s.RelayQueue != nil || s.RelayHandler != nil
+}
+
+// SendMessages sends the redirects, vacation responses and notifications of
+// a result.
+func (s *StandardSieveExecutor) SendMessages(ctx context.Context, recipient RecipientInfo, result sieveengine.Result, messageEntity *message.Entity, fullMessageBytes []byte) []sieveengine.Action {
+	var failed []sieveengine.Action
+	for _, redirect := range result.Redirects() {
+		if err := s.redirect(recipient, redirect, fullMessageBytes); err != nil {
+			s.DeliveryCtx.Logger.Log("Failed to redirect message to %s: %v", redirect.RedirectTo, err)
+			failed = append(failed, redirect)
 		}
+	}
 
-	case sieveengine.ActionRedirect:
-		// Handle redirect via external relay
-		if recipient.FromAddress != nil {
-			// Try immediate delivery first if queue is not configured
-			if s.RelayQueue == nil && s.RelayHandler != nil {
-				err := s.RelayHandler.SendToExternalRelay(recipient.FromAddress.FullAddress(), result.RedirectTo, fullMessageBytes)
-				if err == nil && !result.Copy {
-					// Successfully redirected without copy
-					return "", true, nil
-				}
-			} else if s.RelayQueue != nil {
-				// Queue for background delivery with retry
-				err := s.RelayQueue.Enqueue(recipient.FromAddress.FullAddress(), result.RedirectTo, "redirect", fullMessageBytes)
-				if err != nil {
-					// Failed to enqueue, log error but don't fail delivery
-					s.DeliveryCtx.Logger.Log("Failed to enqueue redirect message: %v", err)
-				} else if !result.Copy {
-					// Successfully queued for redirect without copy
-					return "", true, nil
-				}
-			}
+	// Handle vacation response
+	if s.VacationHandler != nil && recipient.FromAddress != nil {
+		for _, vacation := range result.Vacation() {
+			_ = s.VacationHandler.HandleVacationResponse(ctx, recipient.AccountID, vacation, recipient.FromAddress, recipient.Address, messageEntity)
 		}
-		// Fallback or copy: deliver to INBOX
-		mailboxName = consts.MailboxInbox
+	}
 
-	case sieveengine.ActionVacation:
-		// Handle vacation response
-		if s.VacationHandler != nil && recipient.FromAddress != nil {
-			_ = s.VacationHandler.HandleVacationResponse(ctx, recipient.AccountID, result, recipient.FromAddress, recipient.Address, messageEntity)
+	for _, notify := range result.Notifications() {
+		if err := s.notify(recipient, notify, messageEntity); err != nil {
+			s.DeliveryCtx.Logger.Log("Failed to send notification to %s: %v", notify.NotifyMethod, err)
 		}
-		mailboxName = consts.MailboxInbox
+	}
+	return failed
+}
 
-	default:
-		mailboxName = consts.MailboxInbox
+// notify sends the notification of a notify action (RFC 5435), unless the
+// message was automatically submitted.
+func (s *StandardSieveExecutor) notify(recipient RecipientInfo, notify sieveengine.Action, messageEntity *message.Entity) error {
+	if SuppressNotification(messageEntity) {
+		return nil
+	}
+	to, notification, err := BuildNotification(s.DeliveryCtx.Hostname, notify, recipient.Address.FullAddress(), messageEntity)
+	if err != nil {
+		return err
 	}
+	from := recipient.Address.FullAddress()
+	for _, addr := range to {
+		if s.RelayQueue != nil {
+			err = s.RelayQueue.Enqueue(from, addr, "notify", notification)
+		} else if s.RelayHandler != nil {
+			err = s.RelayHandler.SendToExternalRelay(from, addr, notification)
+		} else {
+			return fmt.Errorf("external relay not configured")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	return mailboxName, false, nil
+// redirect sends a message to the address of a redirect action, with the
+// header edits made before the redirect.
+func (s *StandardSieveExecutor) redirect(recipient RecipientInfo, redirect sieveengine.Action, fullMessageBytes []byte) error {
+	if recipient.FromAddress == nil {
+		return fmt.Errorf("no envelope sender")
+	}
+	messageBytes, err := sieveengine.ApplyHeaderEdits(fullMessageBytes, redirect.HeaderEdits)
+	if err != nil {
+		return err
+	}
+	if s.RelayQueue != nil {
+		// Queue for background delivery with retry
+		return s.RelayQueue.Enqueue(recipient.FromAddress.FullAddress(), redirect.RedirectTo, "redirect", messageBytes)
+	}
+	if s.RelayHandler != nil {
+		return s.RelayHandler.SendToExternalRelay(recipient.FromAddress.FullAddress(), redirect.RedirectTo, messageBytes)
+	}
+	return fmt.Errorf("external relay not configured")
 }
@@ -0,0 +1,187 @@
+package delivery
+
+import (
+	"bytes"
+	"fmt"
+	netmail "net/mail"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+	"github.com/migadu/sora/pkg/sieveext"
+	"github.com/migadu/sora/server/sieveengine"
+)
+
+// RejectionReply returns the reason of a reject action as a single line
+// for an SMTP or LMTP reply.
+func RejectionReply(reject sieveengine.Action) string {
+	reason := strings.Join(strings.Fields(reject.RejectReason), " ")
+	if reason == "" {
+		reason = "Message rejected by recipient"
+	}
+	return reason
+}
+
+// BuildRejection builds the message sent to the sender when a rejected
+// message cannot be refused in the protocol (RFC 5429 §2.1.1): an MDN
+// (RFC 8098) from the recipient reporting that the message was deleted,
+// with the reason. It is sent with a null envelope sender.
+func BuildRejection(hostname string, reject sieveengine.Action, recipient, sender string, originalMessage *message.Entity) ([]byte, error) {
+	originalHeader := mail.Header{Header: originalMessage.Header}
+	originalSubject, _ := originalHeader.Subject()
+	originalMessageID, _ := originalHeader.MessageID()
+
+	var h mail.Header
+	h.SetAddressList("From", []*mail.Address{{Address: recipient}})
+	h.SetAddressList("To", []*mail.Address{{Address: sender}})
+	h.SetSubject("Rejected: " + originalSubject)
+	h.SetDate(time.Now())
+	h.Set("Message-ID", fmt.Sprintf("<%d.reject@%s>", time.Now().UnixNano(), hostname))
+	if originalMessageID != "" {
+		h.Set("In-Reply-To", "<"+originalMessageID+">")
+		h.Set("References", "<"+originalMessageID+">")
+	}
+	h.Set("Auto-Submitted", "auto-replied (rejected)")
+	h.Set("X-Auto-Response-Suppress", "All")
+	h.SetContentType("multipart/report", map[string]string{"report-type": "disposition-notification"})
+
+	var buf bytes.Buffer
+	w, err := message.CreateWriter(&buf, h.Header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rejection writer: %w", err)
+	}
+
+	var textHeader message.Header
+	textHeader.SetContentType("text/plain", map[string]string{"charset": "utf-8"})
+	textHeader.Set("Content-Transfer-Encoding", "quoted-printable")
+	text, err := w.CreatePart(textHeader)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(text, "Your message to <%s> was automatically rejected:\r\n\r\n%s\r\n", recipient, reject.RejectReason)
+	text.Close()
+
+	var mdnHeader message.Header
+	mdnHeader.SetContentType("message/disposition-notification", nil)
+	mdn, err := w.CreatePart(mdnHeader)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(mdn, "Reporting-UA: %s; Sora\r\n", hostname)
+	fmt.Fprintf(mdn, "Final-Recipient: rfc822; %s\r\n", recipient)
+	if originalMessageID != "" {
+		fmt.Fprintf(mdn, "Original-Message-ID: <%s>\r\n", originalMessageID)
+	}
+	fmt.Fprintf(mdn, "Disposition: automatic-action/MDN-sent-automatically; deleted\r\n")
+	mdn.Close()
+
+	var headersHeader message.Header
+	headersHeader.SetContentType("text/rfc822-headers", nil)
+	headers, err := w.CreatePart(headersHeader)
+	if err != nil {
+		return nil, err
+	}
+	if err := textproto.WriteHeader(headers, originalMessage.Header.Header); err != nil {
+		return nil, err
+	}
+	headers.Close()
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SuppressNotification reports whether no notification may be sent about a
+// message: notifications are never sent for automatically submitted
+// messages, to prevent loops (RFC 5436 §2.7).
+func SuppressNotification(originalMessage *message.Entity) bool {
+	autoSubmitted := strings.TrimSpace(originalMessage.Header.Get("Auto-Submitted"))
+	return autoSubmitted != "" && !strings.EqualFold(autoSubmitted, "no")
+}
+
+// BuildNotification builds the message of a notify action with the mailto
+// method (RFC 5436) about a message delivered to recipient. It returns the
+// recipients of the mailto URI and the message, which is sent with the
+// recipient as envelope sender.
+func BuildNotification(hostname string, notify sieveengine.Action, recipient string, originalMessage *message.Entity) ([]string, []byte, error) {
+	mailto, err := sieveext.ParseMailto(notify.NotifyMethod)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	originalHeader := mail.Header{Header: originalMessage.Header}
+	originalSubject, _ := originalHeader.Subject()
+	originalFrom := originalHeader.Get("From")
+	if from, err := originalHeader.AddressList("From"); err == nil && len(from) > 0 {
+		originalFrom = from[0].String()
+	}
+
+	from := recipient
+	if notify.NotifyFrom != "" {
+		if addr, err := netmail.ParseAddress(notify.NotifyFrom); err == nil {
+			from = addr.Address
+		}
+	}
+
+	// RFC 5436 §2.7: a subject in the URI takes precedence over :message
+	subject := mailto.Subject
+	if subject == "" {
+		subject = notify.NotifyMessage
+	}
+	if subject == "" {
+		subject = fmt.Sprintf("New message from %s: %s", originalFrom, originalSubject)
+	}
+
+	body := mailto.Body
+	if body == "" {
+		var b strings.Builder
+		if notify.NotifyMessage != "" {
+			fmt.Fprintf(&b, "%s\r\n\r\n", notify.NotifyMessage)
+		}
+		fmt.Fprintf(&b, "A new message was delivered to %s.\r\n\r\n", recipient)
+		fmt.Fprintf(&b, "From: %s\r\n", originalFrom)
+		fmt.Fprintf(&b, "Subject: %s\r\n", originalSubject)
+		if date := originalHeader.Get("Date"); date != "" {
+			fmt.Fprintf(&b, "Date: %s\r\n", date)
+		}
+		body = b.String()
+	}
+
+	var h mail.Header
+	h.SetAddressList("From", []*mail.Address{{Address: from}})
+	to := make([]*mail.Address, len(mailto.To))
+	for i, addr := range mailto.To {
+		to[i] = &mail.Address{Address: addr}
+	}
+	h.SetAddressList("To", to)
+	h.SetSubject(subject)
+	h.SetDate(time.Now())
+	h.Set("Message-ID", fmt.Sprintf("<%d.notify@%s>", time.Now().UnixNano(), hostname))
+	h.Set("Auto-Submitted", "auto-notified")
+	h.Set("X-Auto-Response-Suppress", "All")
+	switch notify.NotifyImportance {
+	case "1":
+		h.Set("Importance", "high")
+	case "3":
+		h.Set("Importance", "low")
+	}
+	h.SetContentType("text/plain", map[string]string{"charset": "utf-8"})
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	var buf bytes.Buffer
+	w, err := message.CreateWriter(&buf, h.Header)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create notification writer: %w", err)
+	}
+	if _, err := w.Write([]byte(body)); err != nil {
+		w.Close()
+		return nil, nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, nil, err
+	}
+	return mailto.To, buf.Bytes(), nil
+}
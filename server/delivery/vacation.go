@@ -14,7 +14,7 @@ import (
 
 // VacationHandler interface defines the contract for handling vacation responses.
 type VacationHandler interface {
-	HandleVacationResponse(ctx context.Context, AccountID int64, result sieveengine.Result, fromAddr *server.Address, toAddress *server.Address, originalMessage *message.Entity) error
+	HandleVacationResponse(ctx context.Context, AccountID int64, vacation sieveengine.Action, fromAddr *server.Address, toAddress *server.Address, originalMessage *message.Entity) error
 }
 
 // StandardVacationHandler implements the standard vacation response handling.
@@ -26,7 +26,7 @@ type StandardVacationHandler struct {
 }
 
 // HandleVacationResponse handles vacation auto-response.
-func (h *StandardVacationHandler) HandleVacationResponse(ctx context.Context, AccountID int64, result sieveengine.Result, fromAddr *server.Address, toAddress *server.Address, originalMessage *message.Entity) error {
+func (h *StandardVacationHandler) HandleVacationResponse(ctx context.Context, AccountID int64, vacation sieveengine.Action, fromAddr *server.Address, toAddress *server.Address, originalMessage *message.Entity) error {
 	if h.RelayHandler == nil && h.RelayQueue == nil {
 		if h.Logger != nil {
 			h.Logger.Log("[VACATION] external relay not configured, cannot send vacation response")
@@ -36,13 +36,13 @@ func (h *StandardVacationHandler) HandleVacationResponse(ctx context.Context, Ac
 
 	// Create vacation response message
 	vacationFrom := toAddress.FullAddress()
-	if result.VacationFrom != "" {
-		vacationFrom = result.VacationFrom
+	if vacation.VacationFrom != "" {
+		vacationFrom = vacation.VacationFrom
 	}
 
 	vacationSubject := "Auto: Out of Office"
-	if result.VacationSubj != "" {
-		vacationSubject = result.VacationSubj
+	if vacation.VacationSubj != "" {
+		vacationSubject = vacation.VacationSubj
 	}
 
 	// Build vacation message
@@ -70,7 +70,7 @@ func (h *StandardVacationHandler) HandleVacationResponse(ctx context.Context, Ac
 	var textHeader message.Header
 	textHeader.Set("Content-Type", "text/plain; charset=utf-8")
 	textWriter, _ := w.CreatePart(textHeader)
-	textWriter.Write([]byte(result.VacationMsg))
+	textWriter.Write([]byte(vacation.VacationMsg))
 	textWriter.Close()
 	w.Close()
 
@@ -144,6 +144,12 @@ func (s *IMAPSession) Append(mboxName string, r imap.LiteralReader, options *ima
 		}
 	}
 
+	// Check the quota of the mailbox owner (which differs from the session user for shared mailboxes)
+	if err := s.checkQuota(readCtx, "APPEND", mailbox.AccountID, int64(len(fullMessageBytes)), 1); err != nil {
+		recordMetrics("failure")
+		return nil, err
+	}
+
 	// Extract raw headers string.
 	// Headers are typically terminated by a double CRLF (\r\n\r\n).
 	var rawHeadersText string
@@ -169,7 +175,7 @@ func (s *IMAPSession) Append(mboxName string, r imap.LiteralReader, options *ima
 	// Parse message headers (this does not consume the body)
 	var subject, messageID string
 	var sentDate time.Time
-	var inReplyTo []string
+	var inReplyTo, references []string
 	var actualPlaintextBody string
 	var recipients []helpers.Recipient
 
@@ -183,6 +189,7 @@ func (s *IMAPSession) Append(mboxName string, r imap.LiteralReader, options *ima
 		if len(inReplyTo) == 0 {
 			inReplyTo = nil
 		}
+		references, _ = mailHeader.MsgIDList("References")
 
 		extractedPlaintext, extractErr := helpers.ExtractPlaintextBody(messageContent)
 		if extractErr != nil {
@@ -272,6 +279,7 @@ func (s *IMAPSession) Append(mboxName string, r imap.LiteralReader, options *ima
 			PlaintextBody: actualPlaintextBody,
 			SentDate:      sentDate,
 			InReplyTo:     inReplyTo,
+			References:    references,
 			BodyStructure: &bodyStructure,
 			Recipients:    recipients,
 			RawHeaders:    rawHeadersText,
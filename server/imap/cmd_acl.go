@@ -2,6 +2,7 @@ package imap
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -296,6 +297,9 @@ func (s *IMAPSession) SetACL(mailbox string, identifier imap.RightsIdentifier, m
 	// Grant access with final rights using identifier
 	err = s.server.rdb.GrantMailboxAccessByIdentifierWithRetry(writeCtx, AccountID, identifierStr, mailbox, finalRights)
 	if err != nil {
+		if errors.Is(err, consts.ErrNotPermitted) {
+			return errSharedMailboxesNotAllowed
+		}
 		return s.internalError("failed to grant access: %v", err)
 	}
 
@@ -0,0 +1,123 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+)
+
+// accountQuotaRoot is the name of the single quota root covering all mailboxes
+// owned by the authenticated account (RFC 9208 section 3.1).
+const accountQuotaRoot = ""
+
+// newQuotaData converts an account quota into the RFC 9208 representation.
+// STORAGE values are expressed in units of 1024 octets. Only limited
+// resources are reported.
+func newQuotaData(root string, quota *db.AccountQuota) *imap.QuotaData {
+	data := &imap.QuotaData{
+		Root:      root,
+		Resources: make(map[imap.QuotaResourceType]imap.QuotaResourceData),
+	}
+	if quota.StorageLimit > 0 {
+		data.Resources[imap.QuotaResourceStorage] = imap.QuotaResourceData{
+			Usage: (quota.StorageUsed + 1023) / 1024,
+			Limit: quota.StorageLimit / 1024,
+		}
+	}
+	if quota.MessagesLimit > 0 {
+		data.Resources[imap.QuotaResourceMessage] = imap.QuotaResourceData{
+			Usage: quota.MessagesUsed,
+			Limit: quota.MessagesLimit,
+		}
+	}
+	return data
+}
+
+// GetQuota implements the GETQUOTA command (RFC 9208).
+func (s *IMAPSession) GetQuota(root string) (*imap.QuotaData, error) {
+	s.DebugLog("GETQUOTA command", "root", root)
+
+	if root != accountQuotaRoot {
+		return nil, &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeNonExistent,
+			Text: fmt.Sprintf("no such quota root: %s", root),
+		}
+	}
+
+	quota, err := s.server.rdb.GetAccountQuotaWithRetry(s.ctx, s.AccountID())
+	if err != nil {
+		return nil, s.internalError("failed to get quota: %v", err)
+	}
+
+	return newQuotaData(root, quota), nil
+}
+
+// GetQuotaRoot implements the GETQUOTAROOT command (RFC 9208).
+// Mailboxes owned by the session user share the account quota root. Shared
+// mailboxes owned by other accounts report no quota root, so that another
+// account's usage is never disclosed.
+func (s *IMAPSession) GetQuotaRoot(mailbox string) ([]string, []imap.QuotaData, error) {
+	s.DebugLog("GETQUOTAROOT command", "mailbox", mailbox)
+
+	dbMailbox, err := s.server.rdb.GetMailboxByNameWithRetry(s.ctx, s.AccountID(), mailbox)
+	if err != nil {
+		if errors.Is(err, consts.ErrMailboxNotFound) {
+			return nil, nil, &imap.Error{
+				Type: imap.StatusResponseTypeNo,
+				Code: imap.ResponseCodeNonExistent,
+				Text: fmt.Sprintf("mailbox '%s' does not exist", mailbox),
+			}
+		}
+		return nil, nil, s.internalError("failed to fetch mailbox '%s': %v", mailbox, err)
+	}
+
+	if dbMailbox.AccountID != s.AccountID() {
+		return nil, nil, nil
+	}
+
+	quota, err := s.server.rdb.GetAccountQuotaWithRetry(s.ctx, s.AccountID())
+	if err != nil {
+		return nil, nil, s.internalError("failed to get quota: %v", err)
+	}
+
+	return []string{accountQuotaRoot}, []imap.QuotaData{*newQuotaData(accountQuotaRoot, quota)}, nil
+}
+
+// SetQuota implements the SETQUOTA command (RFC 9208).
+// Quota limits are administered through the admin API and sora-admin, so
+// users are never allowed to change them over IMAP.
+func (s *IMAPSession) SetQuota(root string, limits map[imap.QuotaResourceType]int64) error {
+	s.DebugLog("SETQUOTA command rejected", "root", root)
+	return &imap.Error{
+		Type: imap.StatusResponseTypeNo,
+		Code: imap.ResponseCodeNoPerm,
+		Text: "quota limits can only be changed by an administrator",
+	}
+}
+
+// checkQuota verifies that the owner of a destination mailbox can store
+// addMessages more messages totalling addBytes. It returns an OVERQUOTA error
+// when the quota would be exceeded.
+func (s *IMAPSession) checkQuota(ctx context.Context, command string, ownerAccountID int64, addBytes, addMessages int64) error {
+	err := s.server.rdb.CheckQuotaWithRetry(ctx, ownerAccountID, addBytes, addMessages)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, consts.ErrQuotaExceeded) {
+		s.DebugLog("quota exceeded", "command", command, "owner_account_id", ownerAccountID, "bytes", addBytes, "messages", addMessages)
+		imapErr := &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeOverQuota,
+			Text: "Quota exceeded",
+		}
+		s.classifyAndTrackError(command, nil, imapErr)
+		return imapErr
+	}
+	s.classifyAndTrackError(command, err, nil)
+	return s.internalError("failed to check quota: %v", err)
+}
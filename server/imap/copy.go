@@ -81,6 +81,15 @@ func (s *IMAPSession) Copy(numSet imap.NumSet, mboxName string) (*imap.CopyData,
 		sourceUIDs = append(sourceUIDs, msg.UID)
 	}
 
+	// Copies count fully against the destination owner's quota
+	var copySize int64
+	for _, msg := range messages {
+		copySize += int64(msg.Size)
+	}
+	if err := s.checkQuota(s.ctx, "COPY", destMailbox.AccountID, copySize, int64(len(messages))); err != nil {
+		return nil, err
+	}
+
 	// Perform the batch copy operation
 	uidMap, err := s.server.rdb.CopyMessagesWithRetry(s.ctx, &sourceUIDs, selectedMailboxID, destMailbox.ID, AccountID)
 	if err != nil {
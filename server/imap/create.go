@@ -10,6 +10,14 @@ import (
 	"github.com/migadu/sora/db"
 )
 
+// errSharedMailboxesNotAllowed is returned when the domain policy of the
+// account does not allow shared mailboxes.
+var errSharedMailboxesNotAllowed = &imap.Error{
+	Type: imap.StatusResponseTypeNo,
+	Code: imap.ResponseCodeNoPerm,
+	Text: "Shared mailboxes are not allowed for this domain",
+}
+
 // Create a new mailbox
 func (s *IMAPSession) Create(name string, options *imap.CreateOptions) error {
 	// First phase: validation and mailbox lookup using read lock
@@ -100,6 +108,8 @@ func (s *IMAPSession) Create(name string, options *imap.CreateOptions) error {
 						// mailbox concurrently. If so, just fetch the existing one.
 						if errors.Is(err, consts.ErrDBUniqueViolation) {
 							s.DebugLog("parent mailbox already exists (concurrent create)", "mailbox", parentPathWithoutDelim)
+						} else if errors.Is(err, consts.ErrNotPermitted) {
+							return errSharedMailboxesNotAllowed
 						} else {
 							return s.internalError("failed to auto-create parent mailbox '%s': %v", parentPathWithoutDelim, err)
 						}
@@ -150,6 +160,9 @@ func (s *IMAPSession) Create(name string, options *imap.CreateOptions) error {
 				Text: "Mailbox already exists",
 			}
 		}
+		if errors.Is(err, consts.ErrNotPermitted) {
+			return errSharedMailboxesNotAllowed
+		}
 		return s.internalError("failed to create mailbox '%s': %v", name, err)
 	}
 
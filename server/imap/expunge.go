@@ -137,11 +137,28 @@ func (s *IMAPSession) Expunge(w *imapserver.ExpungeWriter, uidSet *imap.UIDSet)
 	release()
 
 	// Send expunge notifications to the client (network I/O, outside the lock).
-	for _, m := range messagesToExpunge {
-		if m.seq > 0 {
-			if err := w.WriteExpunge(m.seq); err != nil {
-				s.DebugLog("error writing expunge", "seq", m.seq, "uid", m.uid, "error", err)
-				return s.internalError("failed to write expunge notification: %v", err)
+	// With QRESYNC enabled, they are sent as one VANISHED response instead of
+	// EXPUNGE responses (RFC 7162 section 3.2.10).
+	if s.qresyncEnabled() {
+		var vanished imap.UIDSet
+		for _, m := range messagesToExpunge {
+			if m.seq > 0 {
+				vanished.AddNum(m.uid)
+			}
+		}
+		if len(vanished) > 0 {
+			if err := w.WriteVanished(vanished); err != nil {
+				s.DebugLog("error writing vanished", "uids", vanished.String(), "error", err)
+				return s.internalError("failed to write vanished notification: %v", err)
+			}
+		}
+	} else {
+		for _, m := range messagesToExpunge {
+			if m.seq > 0 {
+				if err := w.WriteExpunge(m.seq); err != nil {
+					s.DebugLog("error writing expunge", "seq", m.seq, "uid", m.uid, "error", err)
+					return s.internalError("failed to write expunge notification: %v", err)
+				}
 			}
 		}
 	}
@@ -150,6 +150,15 @@ func (s *IMAPSession) Fetch(w *imapserver.FetchWriter, numSet imap.NumSet, optio
 		}
 	}
 
+	// QRESYNC: UID FETCH ... (CHANGEDSINCE n VANISHED) reports expunged UIDs of
+	// the requested range as VANISHED (EARLIER) ahead of the FETCH responses.
+	if options.Vanished && options.ChangedSince > 0 && s.qresyncEnabled() {
+		if err := s.writeFetchVanished(w, selectedMailboxID, numSet, options.ChangedSince); err != nil {
+			recordMetrics("failure")
+			return err
+		}
+	}
+
 	if len(messages) == 0 {
 		recordMetrics("success")
 		return nil
@@ -40,8 +40,19 @@ func (s *IMAPSession) Idle(w *imapserver.UpdateWriter, done <-chan struct{}) err
 		}
 	}
 
+	// Wake up as soon as the selected mailbox changes. The subscription is
+	// kept for the whole IDLE so that no change between two polls is missed.
+	var changed <-chan struct{}
+	if s.server.mailboxNotifier != nil {
+		if mailboxID, ok := s.selectedMailboxID(); ok {
+			ch, unsubscribe := s.server.mailboxNotifier.Subscribe(mailboxID)
+			defer unsubscribe()
+			changed = ch
+		}
+	}
+
 	for {
-		if stop, err := s.idleLoop(w, done); err != nil {
+		if stop, err := s.idleLoop(w, done, changed, s.notifyChanges()); err != nil {
 			return err
 		} else if stop {
 			return nil
@@ -49,14 +60,44 @@ func (s *IMAPSession) Idle(w *imapserver.UpdateWriter, done <-chan struct{}) err
 	}
 }
 
-func (s *IMAPSession) idleLoop(w *imapserver.UpdateWriter, done <-chan struct{}) (stop bool, err error) {
-	timer := time.NewTimer(idlePollInterval)
+func (s *IMAPSession) idleLoop(w *imapserver.UpdateWriter, done <-chan struct{}, changed, notifyChanged <-chan struct{}) (stop bool, err error) {
+	// While change signals are being received, polling is only a fallback
+	interval := idlePollInterval
+	if (changed != nil || notifyChanged != nil) && s.server.mailboxNotifier.Active() && s.server.idleFallbackPollInterval > 0 {
+		interval = s.server.idleFallbackPollInterval
+	}
+
+	timer := time.NewTimer(interval)
 	defer timer.Stop()
 
 	select {
+	case <-changed:
+		metrics.IMAPIdleWakeups.WithLabelValues("push").Inc()
+		return false, s.Poll(w, true)
+	case <-notifyChanged:
+		metrics.IMAPIdleWakeups.WithLabelValues("push").Inc()
+		if err := s.pollNotify(w, true); err != nil {
+			return false, err
+		}
+		return false, s.Poll(w, true)
 	case <-timer.C:
+		metrics.IMAPIdleWakeups.WithLabelValues("poll").Inc()
 		return false, s.Poll(w, true)
 	case <-done:
 		return true, nil
 	}
 }
+
+// selectedMailboxID returns the ID of the selected mailbox, if any.
+func (s *IMAPSession) selectedMailboxID() (int64, bool) {
+	acquired, release := s.mutexHelper.AcquireReadLockWithTimeout()
+	if !acquired {
+		return 0, false
+	}
+	defer release()
+
+	if s.selectedMailbox == nil {
+		return 0, false
+	}
+	return s.selectedMailbox.ID, true
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/events"
 	"github.com/migadu/sora/pkg/metrics"
 	"github.com/migadu/sora/server"
 )
@@ -186,7 +187,7 @@ func (s *IMAPSession) Login(address, password string) error {
 	s.DebugLog("authentication attempt", "address", addressParsed.BaseAddress())
 
 	// Use base address (without +detail and without suffix) for authentication
-	AccountID, err := s.server.Authenticate(s.ctx, addressParsed.BaseAddress(), password)
+	AccountID, err := s.server.Authenticate(events.WithSource(s.ctx, "imap", s.RemoteIP), addressParsed.BaseAddress(), password)
 	if err != nil {
 		s.DebugLog("authentication failed", "error", err)
 
@@ -12,6 +12,7 @@ import (
 func (s *IMAPSession) Move(w *imapserver.MoveWriter, numSet imap.NumSet, dest string) error {
 	// First, safely read necessary session state
 	var selectedMailboxID int64
+	var selectedMailboxOwnerID int64
 	var decodedNumSet imap.NumSet
 
 	// Acquire read mutex to safely read session state
@@ -35,6 +36,7 @@ func (s *IMAPSession) Move(w *imapserver.MoveWriter, numSet imap.NumSet, dest st
 		}
 	}
 	selectedMailboxID = s.selectedMailbox.ID
+	selectedMailboxOwnerID = s.selectedMailbox.AccountID
 
 	// Use our helper method that assumes the mutex is held (read lock is sufficient)
 	decodedNumSet = s.decodeNumSetLocked(numSet)
@@ -98,8 +100,18 @@ func (s *IMAPSession) Move(w *imapserver.MoveWriter, numSet imap.NumSet, dest st
 	}
 
 	var sourceUIDs []imap.UID
+	var moveSize int64
 	for _, msg := range messages {
 		sourceUIDs = append(sourceUIDs, msg.UID)
+		moveSize += int64(msg.Size)
+	}
+
+	// A move within the same account does not change usage; only moves into
+	// a mailbox owned by someone else (shared mailboxes) are charged.
+	if destMailbox.AccountID != selectedMailboxOwnerID {
+		if err := s.checkQuota(s.ctx, "MOVE", destMailbox.AccountID, moveSize, int64(len(messages))); err != nil {
+			return err
+		}
 	}
 
 	// Check if the context is still valid before attempting the move
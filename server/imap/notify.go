@@ -0,0 +1,353 @@
+package imap
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+)
+
+// NOTIFY (RFC 5465) support.
+//
+// Changes to mailboxes other than the selected one are detected by comparing
+// the mailbox_stats counters and highest mod-sequence of the account's
+// mailboxes with the values last reported to the client. They are sent as
+// STATUS responses; created, deleted and renamed mailboxes are sent as LIST
+// responses. Changes to the selected mailbox are still reported by Poll. Only
+// the personal namespace is watched.
+//
+// The state is compared whenever a change signal for one of the watched
+// mailboxes arrives (see server.MailboxNotifier), and otherwise at the IDLE
+// poll interval. Mailboxes created after NOTIFY SET are only noticed by the
+// interval check.
+
+// supportedNotifyEvents are the events sent for non-selected mailboxes.
+var supportedNotifyEvents = []imap.NotifyEvent{
+	imap.NotifyEventMessageNew,
+	imap.NotifyEventMessageExpunge,
+	imap.NotifyEventFlagChange,
+	imap.NotifyEventMailboxName,
+}
+
+// notifyState is the NOTIFY SET in effect for a session.
+type notifyState struct {
+	groups      []imap.NotifyEventGroup
+	known       map[int64]db.MailboxState // Mailbox state last reported to the client
+	changed     <-chan struct{}           // Change signals for the watched mailboxes, nil without notifier
+	unsubscribe func()
+	lastCheck   time.Time
+}
+
+// matchesNotifyGroup reports whether the group applies to a non-selected mailbox.
+func matchesNotifyGroup(g imap.NotifyEventGroup, mbox db.MailboxState) bool {
+	switch g.Filter {
+	case imap.NotifyFilterPersonal:
+		return true
+	case imap.NotifyFilterInboxes:
+		return strings.EqualFold(mbox.Name, "INBOX")
+	case imap.NotifyFilterSubscribed:
+		return mbox.Subscribed
+	case imap.NotifyFilterMailboxes:
+		for _, name := range g.Mailboxes {
+			if sameMailboxName(mbox.Name, name) {
+				return true
+			}
+		}
+	case imap.NotifyFilterSubtree:
+		for _, name := range g.Mailboxes {
+			if sameMailboxName(mbox.Name, name) || isSubMailbox(mbox.Name, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameMailboxName compares mailbox names, with INBOX being case-insensitive.
+func sameMailboxName(a, b string) bool {
+	if strings.EqualFold(a, "INBOX") {
+		return strings.EqualFold(b, "INBOX")
+	}
+	return a == b
+}
+
+// isSubMailbox reports whether name is below parent in the hierarchy.
+func isSubMailbox(name, parent string) bool {
+	prefix := parent + string(consts.MailboxDelimiter)
+	if strings.EqualFold(parent, "INBOX") && len(name) > len(prefix) {
+		return strings.EqualFold(name[:len(prefix)], prefix)
+	}
+	return strings.HasPrefix(name, prefix) && len(name) > len(prefix)
+}
+
+// groupFor returns the first event group that applies to a mailbox.
+func (st *notifyState) groupFor(mbox db.MailboxState) (imap.NotifyEventGroup, bool) {
+	for _, g := range st.groups {
+		if matchesNotifyGroup(g, mbox) {
+			return g, true
+		}
+	}
+	return imap.NotifyEventGroup{}, false
+}
+
+// validateNotifyOptions checks a NOTIFY SET request (RFC 5465 section 5).
+func validateNotifyOptions(options *imap.NotifyOptions) error {
+	for _, g := range options.Groups {
+		switch g.Filter {
+		case imap.NotifyFilterSelected, imap.NotifyFilterSelectedDelayed, imap.NotifyFilterInboxes,
+			imap.NotifyFilterPersonal, imap.NotifyFilterSubscribed:
+		case imap.NotifyFilterSubtree, imap.NotifyFilterMailboxes:
+			if len(g.Mailboxes) == 0 {
+				return &imap.Error{
+					Type: imap.StatusResponseTypeBad,
+					Text: fmt.Sprintf("%s requires at least one mailbox", g.Filter),
+				}
+			}
+		default:
+			return &imap.Error{
+				Type: imap.StatusResponseTypeBad,
+				Text: fmt.Sprintf("unknown NOTIFY filter: %s", g.Filter),
+			}
+		}
+
+		for _, event := range g.Events {
+			supported := false
+			for _, e := range supportedNotifyEvents {
+				if e == event {
+					supported = true
+					break
+				}
+			}
+			if !supported {
+				names := make([]string, len(supportedNotifyEvents))
+				for i, e := range supportedNotifyEvents {
+					names[i] = string(e)
+				}
+				return &imap.Error{
+					Type: imap.StatusResponseTypeNo,
+					Code: "BADEVENT (" + imap.ResponseCode(strings.Join(names, " ")) + ")",
+					Text: fmt.Sprintf("unsupported NOTIFY event: %s", event),
+				}
+			}
+		}
+
+		// MessageNew and MessageExpunge only make sense together, and
+		// FlagChange requires both (RFC 5465 section 5)
+		if g.Has(imap.NotifyEventMessageNew) != g.Has(imap.NotifyEventMessageExpunge) ||
+			(g.Has(imap.NotifyEventFlagChange) && !g.Has(imap.NotifyEventMessageNew)) {
+			return &imap.Error{
+				Type: imap.StatusResponseTypeBad,
+				Code: imap.ResponseCodeClientBug,
+				Text: "MessageNew and MessageExpunge must be requested together, and FlagChange requires both",
+			}
+		}
+	}
+	return nil
+}
+
+// Notify implements NOTIFY SET, or NOTIFY NONE when options is nil.
+func (s *IMAPSession) Notify(w *imapserver.UpdateWriter, options *imap.NotifyOptions) error {
+	if options == nil {
+		s.clearNotify()
+		s.DebugLog("NOTIFY NONE")
+		return nil
+	}
+	if err := validateNotifyOptions(options); err != nil {
+		return err
+	}
+
+	states, err := s.server.rdb.GetMailboxStatesWithRetry(s.ctx, s.AccountID())
+	if err != nil {
+		return s.internalError("failed to get mailbox states: %v", err)
+	}
+
+	st := &notifyState{
+		groups:    options.Groups,
+		known:     make(map[int64]db.MailboxState, len(states)),
+		lastCheck: time.Now(),
+	}
+	var watched []int64
+	for _, mbox := range states {
+		st.known[mbox.ID] = mbox
+		if g, ok := st.groupFor(mbox); ok && len(g.Events) > 0 {
+			watched = append(watched, mbox.ID)
+		}
+	}
+	if s.server.mailboxNotifier != nil && len(watched) > 0 {
+		st.changed, st.unsubscribe = s.server.mailboxNotifier.SubscribeMany(watched)
+	}
+
+	s.notifyMu.Lock()
+	old := s.notify
+	s.notify = st
+	s.notifyMu.Unlock()
+	if old != nil && old.unsubscribe != nil {
+		old.unsubscribe()
+	}
+
+	s.DebugLog("NOTIFY SET", "groups", len(options.Groups), "watched_mailboxes", len(watched), "status", options.Status)
+
+	if !options.Status {
+		return nil
+	}
+	selectedID, _ := s.selectedMailboxID()
+	for _, mbox := range states {
+		if g, ok := st.groupFor(mbox); ok && mbox.ID != selectedID && g.Has(imap.NotifyEventMessageNew) {
+			if err := s.writeNotifyStatus(w, mbox); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// clearNotify cancels the NOTIFY SET in effect, if any.
+func (s *IMAPSession) clearNotify() {
+	s.notifyMu.Lock()
+	st := s.notify
+	s.notify = nil
+	s.notifyMu.Unlock()
+	if st != nil && st.unsubscribe != nil {
+		st.unsubscribe()
+	}
+}
+
+// notifyChanges returns the channel signalling changes to the mailboxes
+// watched by NOTIFY, or nil.
+func (s *IMAPSession) notifyChanges() <-chan struct{} {
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+	if s.notify == nil {
+		return nil
+	}
+	return s.notify.changed
+}
+
+// pollNotify sends the NOTIFY responses for the mailboxes that changed since
+// the last check. Unless force is set, the mailboxes are only checked after a
+// change signal or once the poll interval has passed.
+func (s *IMAPSession) pollNotify(w *imapserver.UpdateWriter, force bool) error {
+	selectedID, _ := s.selectedMailboxID()
+
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+	st := s.notify
+	if st == nil {
+		return nil
+	}
+	if !force {
+		interval := idlePollInterval
+		if s.server.mailboxNotifier.Active() && s.server.idleFallbackPollInterval > 0 {
+			interval = s.server.idleFallbackPollInterval
+		}
+		select {
+		case <-st.changed:
+		default:
+			if time.Since(st.lastCheck) < interval {
+				return nil
+			}
+		}
+	}
+	st.lastCheck = time.Now()
+
+	states, err := s.server.rdb.GetMailboxStatesWithRetry(s.ctx, s.AccountID())
+	if err != nil {
+		return s.internalError("failed to get mailbox states: %v", err)
+	}
+
+	lists, statuses := st.diff(states, selectedID)
+	for i := range lists {
+		if err := w.WriteList(&lists[i]); err != nil {
+			return err
+		}
+	}
+	for _, mbox := range statuses {
+		if err := s.writeNotifyStatus(w, mbox); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diff compares the current mailbox states with the last reported ones and
+// returns the LIST responses for created, renamed and deleted mailboxes and
+// the mailboxes whose STATUS must be sent. The reported state is updated.
+func (st *notifyState) diff(states []db.MailboxState, selectedID int64) ([]imap.ListData, []db.MailboxState) {
+	var lists []imap.ListData
+	var statuses []db.MailboxState
+
+	current := make(map[int64]db.MailboxState, len(states))
+	for _, mbox := range states {
+		current[mbox.ID] = mbox
+		g, ok := st.groupFor(mbox)
+		prev, known := st.known[mbox.ID]
+
+		if ok && g.Has(imap.NotifyEventMailboxName) {
+			if !known {
+				lists = append(lists, imap.ListData{Mailbox: mbox.Name, Delim: consts.MailboxDelimiter})
+			} else if prev.Name != mbox.Name {
+				lists = append(lists, imap.ListData{Mailbox: mbox.Name, Delim: consts.MailboxDelimiter, OldName: prev.Name})
+			}
+		}
+		if !ok || mbox.ID == selectedID {
+			continue
+		}
+
+		if !known {
+			if g.Has(imap.NotifyEventMessageNew) && mbox.NumMessages > 0 {
+				statuses = append(statuses, mbox)
+			}
+			continue
+		}
+		messagesChanged := prev.NumMessages != mbox.NumMessages || prev.UIDNext != mbox.UIDNext
+		flagsChanged := prev.UnseenCount != mbox.UnseenCount || prev.HighestModSeq != mbox.HighestModSeq
+		if (messagesChanged && g.Has(imap.NotifyEventMessageNew)) || (flagsChanged && g.Has(imap.NotifyEventFlagChange)) {
+			statuses = append(statuses, mbox)
+		}
+	}
+
+	for id, prev := range st.known {
+		if _, ok := current[id]; ok {
+			continue
+		}
+		if g, ok := st.groupFor(prev); ok && g.Has(imap.NotifyEventMailboxName) {
+			lists = append(lists, imap.ListData{
+				Mailbox: prev.Name,
+				Delim:   consts.MailboxDelimiter,
+				Attrs:   []imap.MailboxAttr{imap.MailboxAttrNonExistent},
+			})
+		}
+	}
+
+	st.known = current
+	return lists, statuses
+}
+
+// writeNotifyStatus sends the STATUS response for a changed mailbox
+// (RFC 5465 section 5.2).
+func (s *IMAPSession) writeNotifyStatus(w *imapserver.UpdateWriter, mbox db.MailboxState) error {
+	numMessages := uint32(mbox.NumMessages)
+	numUnseen := uint32(mbox.UnseenCount)
+	data := &imap.StatusData{
+		Mailbox:     mbox.Name,
+		NumMessages: &numMessages,
+		UIDNext:     imap.UID(mbox.UIDNext),
+		UIDValidity: mbox.UIDValidity,
+		NumUnseen:   &numUnseen,
+	}
+	options := &imap.StatusOptions{
+		NumMessages: true,
+		UIDNext:     true,
+		UIDValidity: true,
+		NumUnseen:   true,
+	}
+	if s.GetCapabilities().Has(imap.CapCondStore) {
+		data.HighestModSeq = mbox.HighestModSeq
+		options.HighestModSeq = true
+	}
+	return w.WriteStatus(data, options)
+}
@@ -0,0 +1,151 @@
+package imap
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/migadu/sora/db"
+)
+
+var messageEvents = []imap.NotifyEvent{imap.NotifyEventMessageNew, imap.NotifyEventMessageExpunge, imap.NotifyEventFlagChange}
+
+func TestValidateNotifyOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		groups   []imap.NotifyEventGroup
+		wantType imap.StatusResponseType
+	}{
+		{"personal", []imap.NotifyEventGroup{{Filter: imap.NotifyFilterPersonal, Events: messageEvents}}, ""},
+		{"selected and subtree", []imap.NotifyEventGroup{
+			{Filter: imap.NotifyFilterSelected, Events: messageEvents},
+			{Filter: imap.NotifyFilterSubtree, Mailboxes: []string{"Archive"}, Events: []imap.NotifyEvent{imap.NotifyEventMailboxName}},
+		}, ""},
+		{"events none", []imap.NotifyEventGroup{{Filter: imap.NotifyFilterMailboxes, Mailboxes: []string{"Spam"}}}, ""},
+		{"subtree without mailbox", []imap.NotifyEventGroup{{Filter: imap.NotifyFilterSubtree, Events: messageEvents}}, imap.StatusResponseTypeBad},
+		{"unknown filter", []imap.NotifyEventGroup{{Filter: "EVERYTHING", Events: messageEvents}}, imap.StatusResponseTypeBad},
+		{"unsupported event", []imap.NotifyEventGroup{{Filter: imap.NotifyFilterPersonal, Events: []imap.NotifyEvent{imap.NotifyEventAnnotationChange}}}, imap.StatusResponseTypeNo},
+		{"MessageNew alone", []imap.NotifyEventGroup{{Filter: imap.NotifyFilterPersonal, Events: []imap.NotifyEvent{imap.NotifyEventMessageNew}}}, imap.StatusResponseTypeBad},
+		{"FlagChange alone", []imap.NotifyEventGroup{{Filter: imap.NotifyFilterPersonal, Events: []imap.NotifyEvent{imap.NotifyEventFlagChange}}}, imap.StatusResponseTypeBad},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateNotifyOptions(&imap.NotifyOptions{Groups: tt.groups})
+			if tt.wantType == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var imapErr *imap.Error
+			if !errors.As(err, &imapErr) {
+				t.Fatalf("expected *imap.Error, got %v", err)
+			}
+			if imapErr.Type != tt.wantType {
+				t.Errorf("expected %s response, got %s", tt.wantType, imapErr.Type)
+			}
+		})
+	}
+}
+
+func TestNotifyEventGroupMatches(t *testing.T) {
+	mbox := func(name string, subscribed bool) db.MailboxState {
+		return db.MailboxState{Name: name, Subscribed: subscribed}
+	}
+	tests := []struct {
+		name  string
+		group imap.NotifyEventGroup
+		mbox  db.MailboxState
+		want  bool
+	}{
+		{"personal", imap.NotifyEventGroup{Filter: imap.NotifyFilterPersonal}, mbox("Sent", false), true},
+		{"inboxes", imap.NotifyEventGroup{Filter: imap.NotifyFilterInboxes}, mbox("INBOX", true), true},
+		{"inboxes other", imap.NotifyEventGroup{Filter: imap.NotifyFilterInboxes}, mbox("Sent", true), false},
+		{"subscribed", imap.NotifyEventGroup{Filter: imap.NotifyFilterSubscribed}, mbox("Sent", true), true},
+		{"unsubscribed", imap.NotifyEventGroup{Filter: imap.NotifyFilterSubscribed}, mbox("Sent", false), false},
+		{"mailboxes", imap.NotifyEventGroup{Filter: imap.NotifyFilterMailboxes, Mailboxes: []string{"Sent", "Drafts"}}, mbox("Drafts", false), true},
+		{"mailboxes child", imap.NotifyEventGroup{Filter: imap.NotifyFilterMailboxes, Mailboxes: []string{"Archive"}}, mbox("Archive/2024", false), false},
+		{"mailboxes inbox case", imap.NotifyEventGroup{Filter: imap.NotifyFilterMailboxes, Mailboxes: []string{"inbox"}}, mbox("INBOX", false), true},
+		{"subtree root", imap.NotifyEventGroup{Filter: imap.NotifyFilterSubtree, Mailboxes: []string{"Archive"}}, mbox("Archive", false), true},
+		{"subtree child", imap.NotifyEventGroup{Filter: imap.NotifyFilterSubtree, Mailboxes: []string{"Archive"}}, mbox("Archive/2024/Q1", false), true},
+		{"subtree sibling prefix", imap.NotifyEventGroup{Filter: imap.NotifyFilterSubtree, Mailboxes: []string{"Archive"}}, mbox("Archives", false), false},
+		{"subtree inbox", imap.NotifyEventGroup{Filter: imap.NotifyFilterSubtree, Mailboxes: []string{"Inbox"}}, mbox("INBOX/Lists", false), true},
+		{"selected", imap.NotifyEventGroup{Filter: imap.NotifyFilterSelected}, mbox("INBOX", true), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesNotifyGroup(tt.group, tt.mbox); got != tt.want {
+				t.Errorf("matchesNotifyGroup(%q) = %v, want %v", tt.mbox.Name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotifyStateDiff(t *testing.T) {
+	inbox := db.MailboxState{ID: 1, Name: "INBOX", UIDNext: 10, NumMessages: 9, HighestModSeq: 20}
+	sent := db.MailboxState{ID: 2, Name: "Sent", UIDNext: 5, NumMessages: 4, HighestModSeq: 8}
+	lists := db.MailboxState{ID: 3, Name: "Lists", UIDNext: 3, NumMessages: 2, HighestModSeq: 4}
+	spam := db.MailboxState{ID: 4, Name: "Spam", UIDNext: 7, NumMessages: 6, HighestModSeq: 9}
+
+	st := &notifyState{
+		groups: []imap.NotifyEventGroup{
+			{Filter: imap.NotifyFilterMailboxes, Mailboxes: []string{"Spam"}}, // NONE
+			{Filter: imap.NotifyFilterMailboxes, Mailboxes: []string{"Sent"}, Events: []imap.NotifyEvent{imap.NotifyEventMessageNew, imap.NotifyEventMessageExpunge}},
+			{Filter: imap.NotifyFilterPersonal, Events: append([]imap.NotifyEvent{imap.NotifyEventMailboxName}, messageEvents...)},
+		},
+		known: map[int64]db.MailboxState{1: inbox, 2: sent, 3: lists, 4: spam},
+	}
+
+	// New message in INBOX (selected), flag change in Sent (no FlagChange),
+	// Lists renamed with a new message, Spam changed (NONE), Drafts created
+	// and Trash deleted.
+	inbox2 := inbox
+	inbox2.UIDNext, inbox2.NumMessages = 11, 10
+	sent2 := sent
+	sent2.HighestModSeq, sent2.UnseenCount = 9, 1
+	lists2 := lists
+	lists2.Name, lists2.UIDNext, lists2.NumMessages = "Lists/Go", 4, 3
+	spam2 := spam
+	spam2.NumMessages = 7
+	drafts := db.MailboxState{ID: 5, Name: "Drafts", UIDNext: 1, HighestModSeq: 1}
+	st.known[6] = db.MailboxState{ID: 6, Name: "Trash"}
+
+	gotLists, gotStatuses := st.diff([]db.MailboxState{inbox2, sent2, lists2, spam2, drafts}, 1)
+
+	if len(gotStatuses) != 1 || gotStatuses[0].ID != 3 {
+		t.Fatalf("expected STATUS for Lists only, got %+v", gotStatuses)
+	}
+
+	byName := make(map[string]imap.ListData)
+	for _, l := range gotLists {
+		byName[l.Mailbox] = l
+	}
+	if len(byName) != 3 {
+		t.Fatalf("expected 3 LIST responses, got %+v", gotLists)
+	}
+	if l := byName["Lists/Go"]; l.OldName != "Lists" {
+		t.Errorf("expected rename from Lists, got %+v", l)
+	}
+	if l, ok := byName["Drafts"]; !ok || l.OldName != "" || len(l.Attrs) != 0 {
+		t.Errorf("expected LIST for created Drafts, got %+v", l)
+	}
+	if l := byName["Trash"]; len(l.Attrs) != 1 || l.Attrs[0] != imap.MailboxAttrNonExistent {
+		t.Errorf("expected \\NonExistent for deleted Trash, got %+v", l)
+	}
+
+	// The reported state is updated, so nothing changes on the next check
+	gotLists, gotStatuses = st.diff([]db.MailboxState{inbox2, sent2, lists2, spam2, drafts}, 1)
+	if len(gotLists) != 0 || len(gotStatuses) != 0 {
+		t.Errorf("expected no changes, got lists=%+v statuses=%+v", gotLists, gotStatuses)
+	}
+
+	// Once INBOX is no longer selected its changes are reported
+	inbox3 := inbox2
+	inbox3.UnseenCount = 1
+	_, gotStatuses = st.diff([]db.MailboxState{inbox3, sent2, lists2, spam2, drafts}, 0)
+	if len(gotStatuses) != 1 || gotStatuses[0].ID != 1 {
+		t.Errorf("expected STATUS for INBOX, got %+v", gotStatuses)
+	}
+}
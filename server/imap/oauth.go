@@ -0,0 +1,158 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/migadu/sora/pkg/metrics"
+	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/oauth"
+)
+
+// authenticateOAuth logs in with an OAUTHBEARER or XOAUTH2 bearer token. The
+// token's username claim selects the account; an authorization identity sent
+// by the client must name the same user.
+func (s *IMAPSession) authenticateOAuth(mechanism, authzID, token string, authStart time.Time) error {
+	netConn := s.conn.NetConn()
+
+	var proxyInfo *server.ProxyProtocolInfo
+	if s.ProxyIP != "" {
+		proxyInfo = &server.ProxyProtocolInfo{
+			SrcIP: s.RemoteIP,
+		}
+	}
+
+	// Apply progressive authentication delay BEFORE any other checks
+	remoteAddr := &server.StringAddr{Addr: s.RemoteIP}
+	server.ApplyAuthenticationDelay(s.ctx, s.server.authLimiter, remoteAddr, "IMAP-OAUTH")
+
+	if s.server.authLimiter != nil {
+		if err := s.server.authLimiter.CanAttemptAuthWithProxy(s.ctx, netConn, proxyInfo, authzID); err != nil {
+			s.DebugLog("oauth rate limited", "error", err)
+			metrics.ProtocolErrors.WithLabelValues("imap", "AUTHENTICATE", "rate_limited", "client_error").Inc()
+			return &imap.Error{
+				Type: imap.StatusResponseTypeNo,
+				Code: imap.ResponseCodeAuthenticationFailed,
+				Text: "Too many authentication attempts. Please try again later.",
+			}
+		}
+	}
+
+	recordFailure := func(user string) {
+		metrics.AuthenticationAttempts.WithLabelValues("imap", s.server.name, s.server.hostname, "failure").Inc()
+		if s.server.authLimiter != nil {
+			s.server.authLimiter.RecordAuthAttemptWithProxy(s.ctx, netConn, proxyInfo, user, false)
+		}
+	}
+
+	username, err := oauth.Authorize(s.ctx, s.server.oauthValidator, authzID, token)
+	if err != nil {
+		if errors.Is(err, oauth.ErrUnavailable) || s.ctx.Err() != nil {
+			s.WarnLog("oauth token validation unavailable", "mechanism", mechanism, "error", err)
+			return &imap.Error{
+				Type: imap.StatusResponseTypeNo,
+				Code: imap.ResponseCodeUnavailable,
+				Text: "Authentication service temporarily unavailable, please try again later",
+			}
+		}
+		s.InfoLog("authentication failed", "reason", "invalid_token", "mechanism", mechanism, "authz_id", authzID, "error", err)
+		recordFailure(authzID)
+		return &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeAuthenticationFailed,
+			Text: "Invalid token",
+		}
+	}
+
+	address, err := server.NewAddress(username)
+	if err != nil {
+		s.InfoLog("authentication failed", "reason", "invalid_token_username", "mechanism", mechanism, "username", username)
+		recordFailure(username)
+		return &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeAuthenticationFailed,
+			Text: "Invalid token",
+		}
+	}
+
+	AccountID, err := s.server.rdb.GetLoginAccountIDByAddressWithRetry(s.ctx, address.BaseAddress())
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			s.InfoLog("oauth authentication cancelled due to server shutdown")
+			return &imap.Error{
+				Type: imap.StatusResponseTypeNo,
+				Code: imap.ResponseCodeUnavailable,
+				Text: server.ErrServerShuttingDown.Error(),
+			}
+		}
+		s.InfoLog("authentication failed", "reason", "user_not_found", "mechanism", mechanism, "address", address.BaseAddress())
+		recordFailure(address.BaseAddress())
+		return &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeAuthenticationFailed,
+			Text: "Invalid token",
+		}
+	}
+
+	// Ensure default mailboxes (INBOX/Drafts/Sent/Spam/Trash) exist
+	if err := s.server.rdb.CreateDefaultMailboxesWithRetry(s.ctx, AccountID); err != nil {
+		return s.internalError("failed to create default mailboxes: %v", err)
+	}
+
+	primaryAddr, err := s.server.rdb.GetPrimaryEmailForAccountWithRetry(s.ctx, AccountID)
+	if err != nil {
+		return s.internalError("failed to get primary email: %v", err)
+	}
+
+	s.server.authenticatedConnections.Add(1)
+	duration := time.Since(authStart)
+
+	loginAddr := address.BaseAddress()
+	if loginAddr != primaryAddr.FullAddress() {
+		s.InfoLog("authentication successful", "login_address", loginAddr, "primary_address", primaryAddr.FullAddress(), "account_id", AccountID, "cached", false, "method", "oauth", "duration", fmt.Sprintf("%.3fs", duration.Seconds()))
+	} else {
+		s.InfoLog("authentication successful", "address", loginAddr, "account_id", AccountID, "cached", false, "method", "oauth", "duration", fmt.Sprintf("%.3fs", duration.Seconds()))
+	}
+
+	metrics.AuthenticationAttempts.WithLabelValues("imap", s.server.name, s.server.hostname, "success").Inc()
+	metrics.AuthenticatedConnectionsCurrent.WithLabelValues("imap", s.server.name, s.server.hostname).Inc()
+
+	// IMPORTANT: Set user state AFTER incrementing both counters to prevent race condition
+	s.IMAPUser = NewIMAPUser(primaryAddr, AccountID)
+	s.Session.User = &s.IMAPUser.User
+
+	metrics.TrackDomainConnection("imap", address.Domain())
+	metrics.TrackUserActivity("imap", address.BaseAddress(), "connection", 1)
+
+	if s.server.authLimiter != nil {
+		s.server.authLimiter.RecordAuthAttemptWithProxy(s.ctx, netConn, proxyInfo, address.BaseAddress(), true)
+	}
+
+	if err := s.registerConnection(address.BaseAddress()); err != nil {
+		// Connection limit reached - undo authentication and reject
+		s.server.authenticatedConnections.Add(-1)
+		metrics.AuthenticatedConnectionsCurrent.WithLabelValues("imap", s.server.name, s.server.hostname).Dec()
+		s.IMAPUser = nil
+		s.Session.User = nil
+		return &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeLimit,
+			Text: "Maximum connections reached",
+		}
+	}
+
+	s.startTerminationPoller()
+	s.triggerCacheWarmup()
+
+	// Clear auth idle timeout after successful authentication
+	if s.server.authIdleTimeout > 0 {
+		if err := netConn.SetReadDeadline(time.Time{}); err != nil {
+			s.WarnLog("failed to clear auth idle timeout", "error", err)
+		}
+	}
+
+	return nil
+}
@@ -17,6 +17,11 @@ func (s *IMAPSession) Poll(w *imapserver.UpdateWriter, allowExpunge bool) error
 		return nil
 	}
 
+	// Changes to other mailboxes requested with NOTIFY
+	if err := s.pollNotify(w, false); err != nil {
+		return err
+	}
+
 	// First phase: Read state with read lock
 	acquired, release := s.mutexHelper.AcquireReadLockWithTimeout()
 	if !acquired {
@@ -74,6 +79,11 @@ func (s *IMAPSession) Poll(w *imapserver.UpdateWriter, allowExpunge bool) error
 		return nil
 	}
 
+	// With QRESYNC enabled, expunges are reported as VANISHED instead of EXPUNGE.
+	if s.qresyncEnabled() && pollHasExpunges(poll) {
+		return s.pollVanished(w, allowExpunge, poll, highestModSeqToPollFrom, release)
+	}
+
 	// Determine the highest MODSEQ from the updates processed in this poll.
 	// Start with the MODSEQ we polled from, in case no updates are found.
 	maxModSeqInThisPoll := highestModSeqToPollFrom
@@ -339,14 +349,7 @@ func (s *IMAPSession) Poll(w *imapserver.UpdateWriter, allowExpunge bool) error
 			continue
 		}
 
-		allFlags := db.BitwiseToFlags(update.BitwiseFlags)
-		if allFlags == nil {
-			allFlags = []imap.Flag{}
-		}
-		for _, customFlag := range update.CustomFlags {
-			allFlags = append(allFlags, imap.Flag(customFlag))
-		}
-		s.mailboxTracker.QueueMessageFlags(update.SeqNum, update.UID, allFlags, nil)
+		s.mailboxTracker.QueueMessageFlags(update.SeqNum, update.UID, updateFlags(update), nil)
 	}
 
 	// Store sessionTracker reference before releasing lock to avoid race condition
@@ -361,3 +364,73 @@ func (s *IMAPSession) Poll(w *imapserver.UpdateWriter, allowExpunge bool) error
 
 	return sessionTracker.Poll(w, allowExpunge)
 }
+
+// pollHasExpunges reports whether a poll result contains expunged messages.
+func pollHasExpunges(poll *db.MailboxPoll) bool {
+	for _, update := range poll.Updates {
+		if update.IsExpunge {
+			return true
+		}
+	}
+	return false
+}
+
+// pollVanished applies a poll result containing expunges for a QRESYNC client.
+// The expunged UIDs are sent as a single VANISHED response and the trackers are
+// rebuilt from the database count, since the go-imap tracker can only emit
+// EXPUNGE. The caller must hold the write lock; it is released here.
+func (s *IMAPSession) pollVanished(w *imapserver.UpdateWriter, allowExpunge bool, poll *db.MailboxPoll, sinceModSeq uint64, release func()) error {
+	if !allowExpunge {
+		// VANISHED is subject to the same restrictions as EXPUNGE during FETCH,
+		// STORE and SEARCH. The mod-sequence is left alone so the next poll
+		// picks these changes up again.
+		release()
+		return nil
+	}
+
+	var vanished imap.UIDSet
+	expunged := uint32(0)
+	maxModSeq := sinceModSeq
+	for _, update := range poll.Updates {
+		if update.EffectiveModSeq > maxModSeq {
+			maxModSeq = update.EffectiveModSeq
+		}
+		if update.IsExpunge && !vanished.Contains(update.UID) {
+			vanished.AddNum(update.UID)
+			expunged++
+		}
+	}
+
+	// New messages are announced with EXISTS once the client has removed the
+	// vanished ones from its view.
+	remaining := uint32(0)
+	if current := s.currentNumMessages.Load(); current > expunged {
+		remaining = current - expunged
+	}
+	needExists := poll.NumMessages > remaining
+
+	s.sessionTracker.Close()
+	s.mailboxTracker = imapserver.NewMailboxTracker(poll.NumMessages)
+	s.sessionTracker = s.mailboxTracker.NewSession()
+	s.currentNumMessages.Store(poll.NumMessages)
+	s.currentHighestModSeq.Store(maxModSeq)
+
+	for _, update := range poll.Updates {
+		if !update.IsExpunge {
+			s.mailboxTracker.QueueMessageFlags(update.SeqNum, update.UID, updateFlags(update), nil)
+		}
+	}
+	sessionTracker := s.sessionTracker
+	release()
+
+	s.DebugLog("sending VANISHED", "uids", vanished.String(), "num_messages", poll.NumMessages)
+	if err := w.WriteVanished(vanished, false); err != nil {
+		return err
+	}
+	if needExists {
+		if err := w.WriteNumMessages(poll.NumMessages); err != nil {
+			return err
+		}
+	}
+	return sessionTracker.Poll(w, allowExpunge)
+}
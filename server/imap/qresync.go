@@ -0,0 +1,138 @@
+package imap
+
+import (
+	"context"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/migadu/sora/db"
+)
+
+// QRESYNC (RFC 7162) support.
+//
+// Expunged messages keep their row (with expunged_modseq set) until the cleaner
+// hard-deletes them after its grace period, which is what VANISHED responses
+// are built from. A client resynchronising from a mod-sequence older than that
+// window will miss some expunges; the Poll reconciliation forces a reconnect if
+// the resulting counts do not add up.
+//
+// Once QRESYNC is enabled, expunges are reported with VANISHED instead of
+// EXPUNGE, both for the EXPUNGE command and for updates found by Poll.
+
+// maxSeqMatchPairs bounds the sequence match data evaluated for a QRESYNC
+// SELECT, so a client cannot make us expand arbitrarily large sets.
+const maxSeqMatchPairs = 1000
+
+// qresyncEnabled reports whether the client has issued ENABLE QRESYNC.
+func (s *IMAPSession) qresyncEnabled() bool {
+	if s.conn == nil || !s.GetCapabilities().Has(imap.CapQResync) {
+		return false
+	}
+	return s.conn.EnabledCaps().Has(imap.CapQResync)
+}
+
+// qresyncSelectData computes the VANISHED (EARLIER) UIDs and the modified
+// messages reported by SELECT/EXAMINE with the QRESYNC parameter.
+func (s *IMAPSession) qresyncSelectData(ctx context.Context, mailboxID int64, params *imap.QResyncData) (imap.UIDSet, []imap.SelectModifiedData, error) {
+	knownUIDs := params.KnownUIDs
+
+	// Sequence match data lets us skip UIDs the client provably still has in
+	// sync: everything up to the last pair that still maps to the same sequence
+	// number (RFC 7162 section 3.2.5.2).
+	var vanishedFloor imap.UID
+	if params.SeqMatch != nil {
+		floor, err := s.seqMatchFloor(ctx, mailboxID, params.SeqMatch)
+		if err != nil {
+			return nil, nil, err
+		}
+		vanishedFloor = floor
+	}
+
+	vanished, err := s.server.rdb.GetVanishedUIDsWithRetry(ctx, mailboxID, params.ModSeq, knownUIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	if vanishedFloor > 0 {
+		var filtered imap.UIDSet
+		if nums, ok := vanished.Nums(); ok {
+			for _, uid := range nums {
+				if uid > vanishedFloor {
+					filtered.AddNum(uid)
+				}
+			}
+		}
+		vanished = filtered
+	}
+
+	changed, err := s.server.rdb.GetChangedMessagesSinceWithRetry(ctx, mailboxID, params.ModSeq, knownUIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	modified := make([]imap.SelectModifiedData, 0, len(changed))
+	for _, update := range changed {
+		modified = append(modified, imap.SelectModifiedData{
+			SeqNum: update.SeqNum,
+			UID:    update.UID,
+			Flags:  updateFlags(update),
+			ModSeq: update.EffectiveModSeq,
+		})
+	}
+
+	return vanished, modified, nil
+}
+
+// seqMatchFloor returns the highest UID of the sequence match data that still
+// has the sequence number the client knows it by, stopping at the first
+// mismatch. Zero means no pair matched.
+func (s *IMAPSession) seqMatchFloor(ctx context.Context, mailboxID int64, seqMatch *imap.QResyncSeqMatch) (imap.UID, error) {
+	seqNums, ok1 := seqMatch.SeqNums.Nums()
+	uids, ok2 := seqMatch.UIDs.Nums()
+	if !ok1 || !ok2 || len(seqNums) != len(uids) || len(uids) == 0 || len(uids) > maxSeqMatchPairs {
+		s.DebugLog("ignoring unusable QRESYNC sequence match data", "seq_nums", seqMatch.SeqNums.String(), "uids", seqMatch.UIDs.String())
+		return 0, nil
+	}
+
+	current, err := s.server.rdb.GetSeqNumsForUIDsWithRetry(ctx, mailboxID, uids)
+	if err != nil {
+		return 0, err
+	}
+
+	var floor imap.UID
+	for i, uid := range uids {
+		if current[uid] != uint32(seqNums[i]) {
+			break
+		}
+		floor = uid
+	}
+	return floor, nil
+}
+
+// writeFetchVanished sends VANISHED (EARLIER) for the UIDs of uidSet expunged
+// after changedSince.
+func (s *IMAPSession) writeFetchVanished(w *imapserver.FetchWriter, mailboxID int64, numSet imap.NumSet, changedSince uint64) error {
+	uidSet, ok := numSet.(imap.UIDSet)
+	if !ok {
+		return nil
+	}
+
+	vanished, err := s.server.rdb.GetVanishedUIDsWithRetry(s.ctx, mailboxID, changedSince, uidSet)
+	if err != nil {
+		return s.internalError("failed to get vanished messages: %v", err)
+	}
+	if len(vanished) == 0 {
+		return nil
+	}
+	return w.WriteVanished(vanished)
+}
+
+// updateFlags returns the full flag list of a message update.
+func updateFlags(update db.MessageUpdate) []imap.Flag {
+	flags := db.BitwiseToFlags(update.BitwiseFlags)
+	if flags == nil {
+		flags = []imap.Flag{}
+	}
+	for _, customFlag := range update.CustomFlags {
+		flags = append(flags, imap.Flag(customFlag))
+	}
+	return flags
+}
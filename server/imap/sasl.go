@@ -10,10 +10,14 @@ import (
 	"github.com/emersion/go-sasl"
 	"github.com/migadu/sora/pkg/metrics"
 	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/oauth"
 )
 
 // AuthenticateMechanisms returns a list of supported SASL mechanisms
 func (s *IMAPSession) AuthenticateMechanisms() []string {
+	if s.server.oauthValidator != nil {
+		return append([]string{"PLAIN"}, oauth.Mechanisms...)
+	}
 	return []string{"PLAIN"}
 }
 
@@ -291,12 +295,19 @@ func (s *IMAPSession) Authenticate(mechanism string) (sasl.Server, error) {
 			s.DebugLog("proceeding with regular authentication", "username", username)
 			return s.Login(username, password)
 		}), nil
-	default:
-		s.DebugLog("unsupported authentication mechanism", "mechanism", mechanism)
-		return nil, &imap.Error{
-			Type: imap.StatusResponseTypeNo,
-			Code: imap.ResponseCodeAuthenticationFailed,
-			Text: "Unsupported authentication mechanism",
+	case oauth.MechanismOAuthBearer, oauth.MechanismXOAuth2:
+		if s.server.oauthValidator == nil {
+			break
 		}
+		return oauth.NewServer(mechanism, func(authzID, token string) error {
+			return s.authenticateOAuth(mechanism, authzID, token, authStart)
+		}), nil
+	}
+
+	s.DebugLog("unsupported authentication mechanism", "mechanism", mechanism)
+	return nil, &imap.Error{
+		Type: imap.StatusResponseTypeNo,
+		Code: imap.ResponseCodeAuthenticationFailed,
+		Text: "Unsupported authentication mechanism",
 	}
 }
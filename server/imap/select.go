@@ -151,6 +151,22 @@ func (s *IMAPSession) Select(mboxName string, options *imap.SelectOptions) (*ima
 		}
 	}
 
+	// QRESYNC (RFC 7162): report what changed since the client's last known
+	// mod-sequence, provided its cache is for the same UIDVALIDITY.
+	var (
+		qresyncVanished imap.UIDSet
+		qresyncModified []imap.SelectModifiedData
+	)
+	isQResync := options != nil && options.QResync != nil && options.QResync.UIDValidity == mailbox.UIDValidity && s.qresyncEnabled()
+	if isQResync {
+		qresyncVanished, qresyncModified, err = s.qresyncSelectData(readCtx, mailbox.ID, options.QResync)
+		if err != nil {
+			return nil, s.internalError("failed to compute QRESYNC changes for mailbox '%s': %v", mboxName, err)
+		}
+		s.DebugLog("QRESYNC select", "mailbox", mboxName, "modseq", options.QResync.ModSeq,
+			"vanished", qresyncVanished.String(), "modified", len(qresyncModified))
+	}
+
 	// Acquire the lock once after all DB operations to update session state
 	acquired, release = s.mutexHelper.AcquireWriteLockWithTimeout()
 	if !acquired {
@@ -223,6 +239,11 @@ func (s *IMAPSession) Select(mboxName string, options *imap.SelectOptions) (*ima
 		selectData.HighestModSeq = s.currentHighestModSeq.Load()
 	}
 
+	if isQResync {
+		selectData.Vanished = qresyncVanished
+		selectData.Modified = qresyncModified
+	}
+
 	return selectData, nil
 }
 
@@ -26,12 +26,14 @@ import (
 	"github.com/migadu/sora/config"
 	"github.com/migadu/sora/db"
 	"github.com/migadu/sora/helpers"
+	"github.com/migadu/sora/pkg/events"
 	"github.com/migadu/sora/pkg/lookupcache"
 	"github.com/migadu/sora/pkg/metrics"
 	"github.com/migadu/sora/pkg/resilient"
 	"github.com/migadu/sora/pkg/spamtraining"
 	serverPkg "github.com/migadu/sora/server"
 	"github.com/migadu/sora/server/idgen"
+	"github.com/migadu/sora/server/oauth"
 	"github.com/migadu/sora/server/uploader"
 	"github.com/migadu/sora/storage"
 	"golang.org/x/crypto/bcrypt"
@@ -247,6 +249,10 @@ type IMAPServer struct {
 	config             *config.Config       // Full config reference for shared mailboxes
 	spamTraining       *spamtraining.Client // Spam filter training client (optional)
 
+	// Push-driven IDLE (nil = poll every idlePollInterval)
+	mailboxNotifier          *serverPkg.MailboxNotifier
+	idleFallbackPollInterval time.Duration
+
 	// Metadata limits (RFC 5464)
 	metadataMaxEntrySize         int
 	metadataMaxEntriesPerMailbox int
@@ -269,6 +275,9 @@ type IMAPServer struct {
 	// Authentication rate limiting
 	authLimiter serverPkg.AuthLimiter
 
+	// OAUTHBEARER/XOAUTH2 token validation (nil when disabled)
+	oauthValidator oauth.Validator
+
 	// Search rate limiting
 	searchRateLimiter *serverPkg.SearchRateLimiter
 
@@ -330,6 +339,7 @@ type IMAPServerOptions struct {
 	TrustedNetworks             []string // Global trusted networks for parameter forwarding
 	AuthRateLimit               serverPkg.AuthRateLimiterConfig
 	LookupCache                 *config.LookupCacheConfig // Authentication cache configuration
+	OAuth                       *config.OAuthConfig       // OAUTHBEARER/XOAUTH2 token validation (optional)
 	SearchRateLimitPerMin       int                       // Search rate limit (searches per minute, 0=disabled)
 	SearchRateLimitWindow       time.Duration             // Search rate limit time window
 	SessionMemoryLimit          int64                     // Per-session memory limit in bytes (0=unlimited)
@@ -363,9 +373,12 @@ type IMAPServerOptions struct {
 	Config *config.Config
 	// Spam training client (optional)
 	SpamTraining *spamtraining.Client
+	// Mailbox change notifications for push-driven IDLE (optional)
+	MailboxNotifier          *serverPkg.MailboxNotifier
+	IdleFallbackPollInterval time.Duration // IDLE poll interval while the notifier is active
 }
 
-func New(appCtx context.Context, name, hostname, imapAddr string, s3 *storage.S3Storage, rdb *resilient.ResilientDatabase, uploadWorker *uploader.UploadWorker, cache *cache.Cache, options IMAPServerOptions) (*IMAPServer, error) {
+func New(appCtx context.Context, name, hostname, imapAddr string, s3 storage.BlobStore, rdb *resilient.ResilientDatabase, uploadWorker *uploader.UploadWorker, cache *cache.Cache, options IMAPServerOptions) (*IMAPServer, error) {
 	logger.Debug("IMAP: Creating server", "name", name, "tls", options.TLS, "cert", options.TLSCertFile, "key", options.TLSKeyFile)
 	// Validate required dependencies
 	if s3 == nil {
@@ -398,6 +411,11 @@ func New(appCtx context.Context, name, hostname, imapAddr string, s3 *storage.S3
 		}
 	}
 
+	oauthValidator, err := oauth.New(options.OAuth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize OAuth: %w", err)
+	}
+
 	// Initialize authentication rate limiter with trusted networks
 	authLimiter := serverPkg.NewAuthRateLimiterWithTrustedNetworks("IMAP", name, hostname, options.AuthRateLimit, options.TrustedNetworks)
 	serverPkg.RegisterRateLimiter("imap", name, authLimiter)
@@ -506,6 +524,8 @@ func New(appCtx context.Context, name, hostname, imapAddr string, s3 *storage.S3
 		version:                      options.Version,
 		config:                       options.Config,
 		spamTraining:                 options.SpamTraining,
+		mailboxNotifier:              options.MailboxNotifier,
+		idleFallbackPollInterval:     options.IdleFallbackPollInterval,
 		metadataMaxEntrySize:         options.MetadataMaxEntrySize,
 		metadataMaxEntriesPerMailbox: options.MetadataMaxEntriesPerMailbox,
 		metadataMaxEntriesPerServer:  options.MetadataMaxEntriesPerServer,
@@ -524,30 +544,38 @@ func New(appCtx context.Context, name, hostname, imapAddr string, s3 *storage.S3
 		warmupQueue:                  warmupQueue,
 		warmupSemaphore:              warmupSemaphore,
 		caps: imap.CapSet{
-			imap.CapIMAP4rev1:     struct{}{},
-			imap.CapLiteralPlus:   struct{}{},
-			imap.CapSASLIR:        struct{}{},
-			imap.CapMove:          struct{}{},
-			imap.AuthCap("PLAIN"): struct{}{},
-			imap.CapIdle:          struct{}{},
-			imap.CapUIDPlus:       struct{}{},
-			imap.CapESearch:       struct{}{},
-			imap.CapESort:         struct{}{},
-			imap.CapSort:          struct{}{},
-			imap.CapSortDisplay:   struct{}{},
-			imap.CapSpecialUse:    struct{}{},
-			imap.CapListStatus:    struct{}{},
-			imap.CapBinary:        struct{}{},
-			imap.CapCondStore:     struct{}{},
-			imap.CapChildren:      struct{}{},
-			imap.CapID:            struct{}{},
-			imap.CapNamespace:     struct{}{},
-			imap.CapMetadata:      struct{}{},
+			imap.CapIMAP4rev1:            struct{}{},
+			imap.CapLiteralPlus:          struct{}{},
+			imap.CapSASLIR:               struct{}{},
+			imap.CapMove:                 struct{}{},
+			imap.AuthCap("PLAIN"):        struct{}{},
+			imap.CapIdle:                 struct{}{},
+			imap.CapUIDPlus:              struct{}{},
+			imap.CapESearch:              struct{}{},
+			imap.CapESort:                struct{}{},
+			imap.CapSort:                 struct{}{},
+			imap.CapSortDisplay:          struct{}{},
+			imap.CapThreadReferences:     struct{}{},
+			imap.CapThreadOrderedSubject: struct{}{},
+			imap.CapSpecialUse:           struct{}{},
+			imap.CapListStatus:           struct{}{},
+			imap.CapBinary:               struct{}{},
+			imap.CapCondStore:            struct{}{},
+			imap.CapQResync:              struct{}{},
+			imap.CapChildren:             struct{}{},
+			imap.CapID:                   struct{}{},
+			imap.CapNamespace:            struct{}{},
+			imap.CapMetadata:             struct{}{},
+			imap.CapNotify:               struct{}{},
+			imap.CapQuota:                struct{}{},
+			imap.CapQuotaResStorage:      struct{}{},
+			imap.CapQuotaResMessage:      struct{}{},
 		},
 		masterUsername:         options.MasterUsername,
 		masterPassword:         options.MasterPassword,
 		masterSASLUsername:     options.MasterSASLUsername,
 		masterSASLPassword:     options.MasterSASLPassword,
+		oauthValidator:         oauthValidator,
 		authIdleTimeout:        options.AuthIdleTimeout,
 		commandTimeout:         options.CommandTimeout,
 		absoluteSessionTimeout: options.AbsoluteSessionTimeout,
@@ -1021,6 +1049,10 @@ func (s *IMAPServer) Serve(imapAddr string) error {
 // SetConnTracker sets the connection tracker for this server
 func (s *IMAPServer) SetConnTracker(tracker *serverPkg.ConnectionTracker) {
 	s.connTracker = tracker
+	// Drop cached credentials of kicked users (e.g. on account suspension)
+	if tracker != nil && s.lookupCache != nil {
+		tracker.SetLookupCache(s.lookupCache)
+	}
 }
 
 func (s *IMAPServer) Close() {
@@ -1587,6 +1619,14 @@ func (s *IMAPServer) filterCapabilitiesForClient(sessionCaps imap.CapSet, client
 		}
 	}
 
+	// QRESYNC cannot be offered without CONDSTORE (RFC 7162 section 3.2.3).
+	if _, hasCondStore := sessionCaps[imap.CapCondStore]; !hasCondStore {
+		if _, exists := sessionCaps[imap.CapQResync]; exists {
+			delete(sessionCaps, imap.CapQResync)
+			disabledCaps = append(disabledCaps, string(imap.CapQResync))
+		}
+	}
+
 	return disabledCaps
 }
 
@@ -1706,6 +1746,8 @@ func (s *IMAPServer) GetLookupCache() *lookupcache.LookupCache {
 // This method wraps the database authentication with an optional lookup cache layer.
 // The cache decorates the database call - this is the proper architectural pattern.
 func (s *IMAPServer) Authenticate(ctx context.Context, address, password string) (accountID int64, err error) {
+	defer func() { events.PublishAuth(ctx, address, accountID, err) }()
+
 	// Check context before any work
 	if err := ctx.Err(); err != nil {
 		return 0, err
@@ -1732,7 +1774,7 @@ func (s *IMAPServer) Authenticate(ctx context.Context, address, password string)
 	}
 
 	// Fetch credentials from database (no caching - we handle that here)
-	accountID, hashedPassword, err := s.rdb.GetCredentialForAuthWithRetry(ctx, address)
+	creds, err := s.rdb.GetAuthCredentialsWithRetry(ctx, address)
 	if err != nil {
 		// Cache negative result if enabled (user not found)
 		if s.lookupCache != nil {
@@ -1743,8 +1785,13 @@ func (s *IMAPServer) Authenticate(ctx context.Context, address, password string)
 		return 0, err
 	}
 
-	// Verify password
-	if err := db.VerifyPassword(hashedPassword, password); err != nil {
+	accountID = creds.AccountID
+	hashedPassword := creds.HashedPassword
+
+	// Verify password or app password
+	protocol, remoteIP := events.SourceFromContext(ctx)
+	app, err := creds.Verify(password, protocol, remoteIP)
+	if err != nil {
 		// Cache negative result for invalid password if enabled
 		if s.lookupCache != nil {
 			// AuthInvalidPassword = 2 (from lookupcache package)
@@ -1754,6 +1801,18 @@ func (s *IMAPServer) Authenticate(ctx context.Context, address, password string)
 		return 0, err
 	}
 
+	if app != nil {
+		s.rdb.RecordAppPasswordUse(app.ID, remoteIP)
+		// The cache does not know the client address, so IP-restricted app
+		// passwords are always checked against the database. The cached hash
+		// is of the password as typed, which may differ from the stored form.
+		if s.lookupCache != nil && len(app.AllowedIPs) == 0 {
+			s.lookupCache.SetSuccess(address, accountID, db.GenerateSHA512Hash(password), password)
+		}
+		logger.Info("authentication successful", "address", address, "account_id", accountID, "app_password_id", app.ID, "cached", false, "method", "main_db")
+		return accountID, nil
+	}
+
 	// Cache successful authentication if enabled
 	if s.lookupCache != nil {
 		s.lookupCache.SetSuccess(address, accountID, hashedPassword, password)
@@ -46,6 +46,10 @@ type IMAPSession struct {
 	currentNumMessages   atomic.Uint32
 	firstUnseenSeqNum    atomic.Uint32 // Sequence number of the first unseen message
 
+	// NOTIFY state, guarded by notifyMu
+	notifyMu sync.Mutex
+	notify   *notifyState
+
 	lastSelectedMailboxID int64
 	lastHighestUID        imap.UID
 	useMasterDB           atomic.Bool // Pin session to master DB after a write to ensure consistency
@@ -226,6 +230,8 @@ func (s *IMAPSession) Close() error {
 	if s == nil {
 		return nil
 	}
+	s.clearNotify()
+
 	// Use the session's primary mutex (from the embedded server.Session)
 	// to protect modifications to IMAPSession fields and embedded Session fields.
 	s.mutex.Lock()
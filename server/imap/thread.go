@@ -0,0 +1,394 @@
+package imap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/helpers"
+)
+
+// THREAD (RFC 5256) support.
+//
+// Threads are built from the message_id, in_reply_to and message_references
+// columns, so no message has to be fetched from S3 and re-parsed. Messages
+// stored before References were persisted are linked by In-Reply-To only.
+
+// Thread implements the THREAD command (RFC 5256) with the ORDEREDSUBJECT and
+// REFERENCES algorithms.
+func (s *IMAPSession) Thread(numKind imapserver.NumKind, algorithm imap.ThreadAlgorithm, charset string, searchCriteria *imap.SearchCriteria) ([]imap.ThreadData, error) {
+	switch algorithm {
+	case imap.ThreadOrderedSubject, imap.ThreadReferences:
+	default:
+		return nil, &imap.Error{
+			Type: imap.StatusResponseTypeBad,
+			Text: fmt.Sprintf("unsupported threading algorithm: %s", algorithm),
+		}
+	}
+
+	searchCriteria = s.decodeSearchCriteria(searchCriteria)
+
+	if s.currentNumMessages.Load() == 0 && len(searchCriteria.SeqNum) > 0 {
+		s.InfoLog("skipping THREAD because mailbox is empty")
+		return []imap.ThreadData{}, nil
+	}
+
+	acquired, release := s.mutexHelper.AcquireReadLockWithTimeout()
+	if !acquired {
+		s.InfoLog("failed to acquire read lock for session tracker")
+		return nil, s.internalError("failed to acquire lock for thread")
+	}
+	if s.selectedMailbox == nil {
+		release()
+		return nil, s.internalError("no mailbox selected for thread")
+	}
+	selectedMailboxID := s.selectedMailbox.ID
+	release()
+
+	if s.ctx.Err() != nil {
+		return nil, s.internalError("request aborted")
+	}
+
+	messages, err := s.server.rdb.GetThreadMessagesWithRetry(s.ctx, selectedMailboxID, searchCriteria)
+	if err != nil {
+		return nil, s.internalError("failed to thread messages: %v", err)
+	}
+
+	var roots []*threadContainer
+	if algorithm == imap.ThreadOrderedSubject {
+		roots = threadOrderedSubject(messages)
+	} else {
+		roots = threadReferences(messages)
+	}
+
+	num := func(msg *db.ThreadMessage) uint32 {
+		if numKind == imapserver.NumKindUID {
+			return uint32(msg.UID)
+		}
+		return msg.Seq
+	}
+	threads := make([]imap.ThreadData, 0, len(roots))
+	for _, root := range roots {
+		threads = append(threads, root.threadData(num))
+	}
+
+	s.DebugLog("THREAD command", "algorithm", algorithm, "messages", len(messages), "threads", len(threads))
+	return threads, nil
+}
+
+// threadContainer is a node of a thread tree. A container without a message
+// is a dummy standing in for a referenced message that is not in the result.
+type threadContainer struct {
+	msg      *db.ThreadMessage
+	parent   *threadContainer
+	children []*threadContainer
+}
+
+func (c *threadContainer) addChild(child *threadContainer) {
+	child.parent = c
+	c.children = append(c.children, child)
+}
+
+func (c *threadContainer) removeChild(child *threadContainer) {
+	for i, existing := range c.children {
+		if existing == child {
+			c.children = append(c.children[:i], c.children[i+1:]...)
+			break
+		}
+	}
+	child.parent = nil
+}
+
+// hasDescendant reports whether other is c or one of its descendants.
+func (c *threadContainer) hasDescendant(other *threadContainer) bool {
+	for ; other != nil; other = other.parent {
+		if other == c {
+			return true
+		}
+	}
+	return false
+}
+
+// sortMessage returns the message a container is sorted and grouped by: its
+// own, or that of its first child for a dummy.
+func (c *threadContainer) sortMessage() *db.ThreadMessage {
+	if c.msg != nil || len(c.children) == 0 {
+		return c.msg
+	}
+	return c.children[0].sortMessage()
+}
+
+// threadData converts the tree below c into its THREAD response form.
+func (c *threadContainer) threadData(num func(*db.ThreadMessage) uint32) imap.ThreadData {
+	var data imap.ThreadData
+	for {
+		if c.msg != nil {
+			data.Chain = append(data.Chain, num(c.msg))
+		}
+		if len(c.children) != 1 {
+			break
+		}
+		c = c.children[0]
+	}
+	for _, child := range c.children {
+		data.SubThreads = append(data.SubThreads, child.threadData(num))
+	}
+	return data
+}
+
+// baseSubject returns the RFC 5256 base subject of a message.
+func baseSubject(msg *db.ThreadMessage) string {
+	if msg.SubjectSort != "" {
+		return msg.SubjectSort
+	}
+	return helpers.NormalizeSubjectForSort(msg.Subject)
+}
+
+// isReplyOrForward reports whether extracting the base subject removed a
+// reply or forward prefix.
+func isReplyOrForward(msg *db.ThreadMessage) bool {
+	return baseSubject(msg) != strings.ToUpper(strings.TrimSpace(msg.Subject))
+}
+
+// threadMessageLess orders messages by sent date, then by mailbox order.
+func threadMessageLess(a, b *db.ThreadMessage) bool {
+	if !a.SentDate.Equal(b.SentDate) {
+		return a.SentDate.Before(b.SentDate)
+	}
+	return a.UID < b.UID
+}
+
+// sortThreadContainers sorts siblings by sent date at every level of the
+// trees. Dummies sort by their first child once that level is sorted.
+func sortThreadContainers(list []*threadContainer) {
+	for _, c := range list {
+		sortThreadContainers(c.children)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i].sortMessage(), list[j].sortMessage()
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return threadMessageLess(a, b)
+	})
+}
+
+// threadOrderedSubject implements the ORDEREDSUBJECT algorithm (RFC 5256
+// section 3): messages with the same base subject form one thread whose first
+// message is the parent of all others.
+func threadOrderedSubject(messages []db.ThreadMessage) []*threadContainer {
+	sorted := make([]*db.ThreadMessage, len(messages))
+	for i := range messages {
+		sorted[i] = &messages[i]
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := baseSubject(sorted[i]), baseSubject(sorted[j])
+		if a != b {
+			return a < b
+		}
+		return threadMessageLess(sorted[i], sorted[j])
+	})
+
+	var roots []*threadContainer
+	var current *threadContainer
+	for _, msg := range sorted {
+		c := &threadContainer{msg: msg}
+		if current != nil && baseSubject(current.msg) == baseSubject(msg) {
+			current.addChild(c)
+			continue
+		}
+		current = c
+		roots = append(roots, c)
+	}
+
+	sortThreadContainers(roots)
+	return roots
+}
+
+// threadReferences implements the REFERENCES algorithm (RFC 5256 section 3).
+func threadReferences(messages []db.ThreadMessage) []*threadContainer {
+	// Messages are linked in mailbox order so that the first of several
+	// messages sharing a Message-ID keeps it.
+	byUID := make([]*db.ThreadMessage, len(messages))
+	for i := range messages {
+		byUID[i] = &messages[i]
+	}
+	sort.SliceStable(byUID, func(i, j int) bool { return byUID[i].UID < byUID[j].UID })
+
+	idTable := make(map[string]*threadContainer)
+	var containers []*threadContainer
+	lookup := func(id string) *threadContainer {
+		c, ok := idTable[id]
+		if !ok {
+			c = &threadContainer{}
+			idTable[id] = c
+			containers = append(containers, c)
+		}
+		return c
+	}
+
+	// Step 1: link messages to their parents
+	for _, msg := range byUID {
+		refs := normalizeThreadIDs(msg.References)
+		if len(refs) == 0 {
+			refs = normalizeThreadIDs(msg.InReplyTo)
+			if len(refs) > 1 {
+				refs = refs[:1]
+			}
+		}
+
+		// Step 1A: link the references to each other, keeping existing links
+		var prev *threadContainer
+		for _, id := range refs {
+			c := lookup(id)
+			if prev != nil && c.parent == nil && !c.hasDescendant(prev) {
+				prev.addChild(c)
+			}
+			prev = c
+		}
+
+		// Step 1B: find the message's own container. Messages without a
+		// Message-ID or with one already taken get a container of their own.
+		id := strings.Trim(strings.TrimSpace(msg.MessageID), "<>")
+		var c *threadContainer
+		if existing, ok := idTable[id]; ok && id != "" && existing.msg == nil {
+			c = existing
+		} else if !ok && id != "" {
+			c = lookup(id)
+		} else {
+			c = &threadContainer{}
+			containers = append(containers, c)
+		}
+		c.msg = msg
+
+		// Step 1C: the last reference is the parent
+		if c.parent != nil {
+			c.parent.removeChild(c)
+		}
+		if prev != nil && !c.hasDescendant(prev) {
+			prev.addChild(c)
+		}
+	}
+
+	// Step 2: gather the root set
+	var roots []*threadContainer
+	for _, c := range containers {
+		if c.parent == nil {
+			roots = append(roots, c)
+		}
+	}
+
+	// Step 3 (discarding the id table) is implicit. Step 4: prune dummies
+	roots = pruneThreadContainers(roots, true)
+	for _, c := range roots {
+		c.parent = nil
+	}
+
+	// Step 5: sort the root set
+	sortThreadContainers(roots)
+
+	// Step 6: merge threads with the same base subject
+	roots = mergeThreadsBySubject(roots)
+
+	// Step 7: sort siblings at every level
+	sortThreadContainers(roots)
+	return roots
+}
+
+// normalizeThreadIDs strips angle brackets and drops empty message IDs.
+func normalizeThreadIDs(ids []string) []string {
+	var normalized []string
+	for _, id := range ids {
+		id = strings.Trim(strings.TrimSpace(id), "<>")
+		if id != "" {
+			normalized = append(normalized, id)
+		}
+	}
+	return normalized
+}
+
+// pruneThreadContainers removes dummies without children and replaces the
+// others by their children, except for dummies at the root that link
+// several threads (RFC 5256 section 3, REFERENCES step 4).
+func pruneThreadContainers(list []*threadContainer, isRoot bool) []*threadContainer {
+	var pruned []*threadContainer
+	for _, c := range list {
+		c.children = pruneThreadContainers(c.children, false)
+		if c.msg == nil {
+			if len(c.children) == 0 {
+				continue
+			}
+			if !isRoot || len(c.children) == 1 {
+				for _, child := range c.children {
+					child.parent = c.parent
+				}
+				pruned = append(pruned, c.children...)
+				continue
+			}
+		}
+		pruned = append(pruned, c)
+	}
+	return pruned
+}
+
+// mergeThreadsBySubject gathers root threads with the same base subject
+// (RFC 5256 section 3, REFERENCES step 5). The threads must be sorted.
+func mergeThreadsBySubject(roots []*threadContainer) []*threadContainer {
+	subjects := make(map[string]*threadContainer)
+	for _, c := range roots {
+		subject := baseSubject(c.sortMessage())
+		if subject == "" {
+			continue
+		}
+		existing, ok := subjects[subject]
+		if !ok || (existing.msg != nil && (c.msg == nil ||
+			(isReplyOrForward(existing.msg) && !isReplyOrForward(c.msg)))) {
+			subjects[subject] = c
+		}
+	}
+
+	for _, c := range roots {
+		subject := baseSubject(c.sortMessage())
+		if subject == "" {
+			continue
+		}
+		table := subjects[subject]
+		if table == c {
+			continue
+		}
+
+		switch {
+		case table.msg == nil && c.msg == nil:
+			for _, child := range c.children {
+				table.addChild(child)
+			}
+			c.children = nil
+		case table.msg == nil:
+			table.addChild(c)
+		case c.msg != nil && isReplyOrForward(c.msg) && !isReplyOrForward(table.msg):
+			table.addChild(c)
+		default:
+			// Turn the table entry into a dummy holding both threads, so it
+			// keeps its place in the root set.
+			moved := &threadContainer{msg: table.msg}
+			for _, child := range table.children {
+				moved.addChild(child)
+			}
+			table.msg = nil
+			table.children = nil
+			table.addChild(moved)
+			table.addChild(c)
+		}
+	}
+
+	var merged []*threadContainer
+	for _, c := range roots {
+		if c.parent == nil && (c.msg != nil || len(c.children) > 0) {
+			merged = append(merged, c)
+		}
+	}
+	return merged
+}
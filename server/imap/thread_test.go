@@ -0,0 +1,177 @@
+package imap
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/helpers"
+)
+
+// formatThreads renders threads the way they appear in a THREAD response.
+func formatThreads(threads []imap.ThreadData) string {
+	var sb strings.Builder
+	var write func(imap.ThreadData)
+	write = func(thread imap.ThreadData) {
+		sb.WriteByte('(')
+		for i, num := range thread.Chain {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			fmt.Fprintf(&sb, "%d", num)
+		}
+		if len(thread.Chain) > 0 && len(thread.SubThreads) > 0 {
+			sb.WriteByte(' ')
+		}
+		for _, sub := range thread.SubThreads {
+			write(sub)
+		}
+		sb.WriteByte(')')
+	}
+	for _, thread := range threads {
+		write(thread)
+	}
+	return sb.String()
+}
+
+func threadUIDs(roots []*threadContainer) string {
+	threads := make([]imap.ThreadData, 0, len(roots))
+	for _, root := range roots {
+		threads = append(threads, root.threadData(func(msg *db.ThreadMessage) uint32 { return uint32(msg.UID) }))
+	}
+	return formatThreads(threads)
+}
+
+func threadMsg(uid uint32, messageID, subject string, day int, references ...string) db.ThreadMessage {
+	return db.ThreadMessage{
+		UID:         imap.UID(uid),
+		Seq:         uid,
+		MessageID:   messageID,
+		References:  references,
+		Subject:     subject,
+		SubjectSort: helpers.NormalizeSubjectForSort(subject),
+		SentDate:    time.Date(2024, 1, day, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestThreadReferences(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []db.ThreadMessage
+		want     string
+	}{
+		{
+			name: "replies and nested replies",
+			messages: []db.ThreadMessage{
+				threadMsg(1, "a@x", "Hello", 1),
+				threadMsg(2, "b@x", "Re: Hello", 2, "a@x"),
+				threadMsg(3, "c@x", "Re: Hello", 3, "a@x"),
+				threadMsg(4, "d@x", "Re: Hello", 4, "a@x", "b@x"),
+				threadMsg(5, "e@x", "Other", 5),
+			},
+			want: "(1 (2 4)(3))(5)",
+		},
+		{
+			name: "missing parent links siblings",
+			messages: []db.ThreadMessage{
+				threadMsg(6, "f@x", "Lost", 1, "missing@x"),
+				threadMsg(7, "g@x", "Re: Lost", 2, "missing@x"),
+			},
+			want: "((6)(7))",
+		},
+		{
+			name: "missing parent with a single child is removed",
+			messages: []db.ThreadMessage{
+				threadMsg(1, "a@x", "Re: Alone", 1, "missing@x"),
+			},
+			want: "(1)",
+		},
+		{
+			name: "reply without references is grouped by subject",
+			messages: []db.ThreadMessage{
+				threadMsg(8, "h@x", "Topic", 1),
+				threadMsg(9, "i@x", "Re: Topic", 2),
+			},
+			want: "(8 9)",
+		},
+		{
+			name: "threads with the same subject get a dummy parent",
+			messages: []db.ThreadMessage{
+				threadMsg(1, "a@x", "Topic", 1),
+				threadMsg(2, "b@x", "Topic", 2),
+			},
+			want: "((1)(2))",
+		},
+		{
+			name: "roots sorted by sent date",
+			messages: []db.ThreadMessage{
+				threadMsg(1, "a@x", "Late", 5),
+				threadMsg(2, "b@x", "Early", 1),
+			},
+			want: "(2)(1)",
+		},
+		{
+			name: "reference loop",
+			messages: []db.ThreadMessage{
+				threadMsg(1, "a@x", "Loop", 1, "b@x"),
+				threadMsg(2, "b@x", "Loop two", 2, "a@x"),
+			},
+			want: "(2 1)",
+		},
+		{
+			name: "duplicate message id",
+			messages: []db.ThreadMessage{
+				threadMsg(1, "a@x", "Dup", 1),
+				threadMsg(2, "a@x", "Other", 2),
+				threadMsg(3, "c@x", "Re: Dup", 3, "a@x"),
+			},
+			want: "(1 3)(2)",
+		},
+		{
+			name: "angle brackets are ignored",
+			messages: []db.ThreadMessage{
+				threadMsg(1, "<a@x>", "One", 1),
+				threadMsg(2, "b@x", "Two", 2, "<a@x>"),
+			},
+			want: "(1 2)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := threadUIDs(threadReferences(tt.messages)); got != tt.want {
+				t.Errorf("threadReferences() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThreadReferencesInReplyToFallback(t *testing.T) {
+	reply := threadMsg(2, "b@x", "Re: Question", 2)
+	reply.InReplyTo = []string{"a@x", "ignored@x"}
+	messages := []db.ThreadMessage{
+		threadMsg(1, "a@x", "Question", 1),
+		reply,
+	}
+	if got := threadUIDs(threadReferences(messages)); got != "(1 2)" {
+		t.Errorf("threadReferences() = %s, want (1 2)", got)
+	}
+}
+
+func TestThreadOrderedSubject(t *testing.T) {
+	messages := []db.ThreadMessage{
+		threadMsg(1, "a@x", "Apples", 1),
+		threadMsg(2, "b@x", "Bananas", 2),
+		threadMsg(3, "c@x", "Re: Apples", 3),
+		threadMsg(4, "d@x", "Apples", 4),
+		threadMsg(5, "e@x", "Re: Bananas", 5),
+		threadMsg(6, "f@x", "Cherries", 0),
+	}
+	want := "(6)(1 (3)(4))(2 5)"
+	if got := threadUIDs(threadOrderedSubject(messages)); got != want {
+		t.Errorf("threadOrderedSubject() = %s, want %s", got, want)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/migadu/sora/pkg/metrics"
 	"github.com/migadu/sora/pkg/resilient"
 	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/oauth"
 	"github.com/migadu/sora/server/proxy"
 )
 
@@ -52,6 +53,7 @@ type Server struct {
 	authLimiter            server.AuthLimiter
 	trustedProxies         []string // CIDR blocks for trusted proxies that can forward parameters
 	remotelookupConfig     *config.RemoteLookupConfig
+	oauthValidator         oauth.Validator
 	remoteUseIDCommand     bool                        // Whether backend supports IMAP ID command for forwarding
 	proxyReader            *server.ProxyProtocolReader // PROXY protocol reader for incoming connections
 
@@ -156,6 +158,7 @@ type ServerOptions struct {
 	AuthRateLimit            server.AuthRateLimiterConfig
 	LookupCache              *config.LookupCacheConfig // Authentication cache configuration
 	RemoteLookup             *config.RemoteLookupConfig
+	OAuth                    *config.OAuthConfig
 	TrustedProxies           []string // CIDR blocks for trusted proxies that can forward parameters
 	RemoteUseIDCommand       bool     // Whether backend supports IMAP ID command for forwarding
 
@@ -195,6 +198,12 @@ func New(appCtx context.Context, rdb *resilient.ResilientDatabase, hostname stri
 		connectTimeout = 10 * time.Second
 	}
 
+	oauthValidator, err := oauth.New(opts.OAuth)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to initialize OAuth: %w", err)
+	}
+
 	// Ensure RemoteLookup config has a default value to avoid nil panics.
 	if opts.RemoteLookup == nil {
 		opts.RemoteLookup = &config.RemoteLookupConfig{}
@@ -351,6 +360,7 @@ func New(appCtx context.Context, rdb *resilient.ResilientDatabase, hostname stri
 		authLimiter:                authLimiter,
 		trustedProxies:             opts.TrustedProxies,
 		remotelookupConfig:         opts.RemoteLookup,
+		oauthValidator:             oauthValidator,
 		remoteUseIDCommand:         opts.RemoteUseIDCommand,
 		proxyReader:                proxyReader,
 		lookupCache:                lookupCache,
@@ -610,6 +620,10 @@ func (s *Server) SetConnectionTracker(tracker *server.ConnectionTracker) {
 	if tracker != nil && s.lookupCache != nil {
 		tracker.SetLookupCache(s.lookupCache)
 	}
+	// Drop cached credentials of kicked users (e.g. on account suspension)
+	if tracker != nil && s.rdb != nil {
+		tracker.SetAuthCache(s.rdb)
+	}
 }
 
 // GetConnectionTracker returns the connection tracker for testing
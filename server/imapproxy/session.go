@@ -18,9 +18,11 @@ import (
 	"github.com/emersion/go-imap/v2"
 	"github.com/migadu/sora/consts"
 	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/events"
 	"github.com/migadu/sora/pkg/lookupcache"
 	"github.com/migadu/sora/pkg/metrics"
 	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/oauth"
 	"github.com/migadu/sora/server/proxy"
 )
 
@@ -364,12 +366,19 @@ func (s *Session) handleConnection() {
 
 		case "AUTHENTICATE":
 			authStart := time.Now()
-			if len(args) < 1 || strings.ToUpper(args[0]) != "PLAIN" {
+			if len(args) < 1 {
 				if s.handleAuthError(fmt.Sprintf("%s NO AUTHENTICATE PLAIN is the only supported mechanism", tag)) {
 					return
 				}
 				continue
 			}
+			mechanism := strings.ToUpper(args[0])
+			if mechanism != "PLAIN" && (!oauth.IsMechanism(mechanism) || s.server.oauthValidator == nil) {
+				if s.handleAuthError(fmt.Sprintf("%s NO Unsupported authentication mechanism", tag)) {
+					return
+				}
+				continue
+			}
 
 			var saslLine string
 			if len(args) > 1 {
@@ -407,6 +416,19 @@ func (s *Session) handleConnection() {
 				continue
 			}
 
+			if mechanism != "PLAIN" {
+				if !s.handleOAuthAuthenticate(tag, mechanism, decoded) {
+					continue
+				}
+				if !s.postAuthenticationSetup(tag, authStart) {
+					// Backend connection failed - send BYE and close connection
+					s.sendResponse("* BYE Backend server unavailable, please try again")
+					return
+				}
+				authenticated = true
+				continue
+			}
+
 			parts := strings.Split(string(decoded), "\x00")
 			if len(parts) != 3 {
 				if s.handleAuthError(fmt.Sprintf("%s NO Invalid SASL PLAIN response", tag)) {
@@ -460,7 +482,7 @@ func (s *Session) handleConnection() {
 			return
 
 		case "CAPABILITY":
-			s.sendResponse("* CAPABILITY IMAP4rev1 AUTH=PLAIN LOGIN")
+			s.sendResponse("* CAPABILITY " + s.capabilities())
 			s.sendResponse(fmt.Sprintf("%s OK CAPABILITY completed", tag))
 
 		case "ID":
@@ -506,12 +528,20 @@ func (s *Session) handleAuthError(response string) bool {
 	return false
 }
 
+// capabilities returns the pre-authentication capability list.
+func (s *Session) capabilities() string {
+	if s.server.oauthValidator != nil {
+		return "IMAP4rev1 AUTH=PLAIN AUTH=OAUTHBEARER AUTH=XOAUTH2 LOGIN"
+	}
+	return "IMAP4rev1 AUTH=PLAIN LOGIN"
+}
+
 // sendGreeting sends the IMAP greeting.
 func (s *Session) sendGreeting() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	greeting := "* OK [CAPABILITY IMAP4rev1 AUTH=PLAIN LOGIN] Proxy Ready\r\n"
+	greeting := "* OK [CAPABILITY " + s.capabilities() + "] Proxy Ready\r\n"
 	_, err := s.clientWriter.WriteString(greeting)
 	if err != nil {
 		return err
@@ -968,7 +998,7 @@ func (s *Session) authenticateUser(username, password string) error {
 		// Regular authentication via main DB (may use DB-level auth cache internally)
 		s.DebugLog("authenticating user via main database")
 		// Use base address (without +detail) for authentication
-		accountID, err = s.server.rdb.AuthenticateWithRetry(ctx, address.BaseAddress(), password)
+		accountID, err = s.server.rdb.AuthenticateWithRetry(events.WithSource(ctx, "imap", s.clientAddr), address.BaseAddress(), password)
 		if err != nil {
 			// Check if error is due to session context cancellation (server shutdown)
 			// Note: Must check s.ctx.Err(), not just the query error, because the query context
@@ -0,0 +1,398 @@
+package jmap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/metrics"
+)
+
+// Request is a JMAP API request (RFC 8620 section 3.3)
+type Request struct {
+	Using       []string          `json:"using"`
+	MethodCalls []Invocation      `json:"methodCalls"`
+	CreatedIDs  map[string]string `json:"createdIds,omitempty"`
+}
+
+// Response is a JMAP API response (RFC 8620 section 3.4)
+type Response struct {
+	MethodResponses []Invocation      `json:"methodResponses"`
+	CreatedIDs      map[string]string `json:"createdIds,omitempty"`
+	SessionState    string            `json:"sessionState"`
+}
+
+// Invocation is a method call or response, serialized as a 3-element array
+// of name, arguments and method call id (RFC 8620 section 3.2).
+type Invocation struct {
+	Name   string
+	Args   any
+	CallID string
+}
+
+// MarshalJSON encodes the invocation as [name, arguments, callId].
+func (inv Invocation) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{inv.Name, inv.Args, inv.CallID})
+}
+
+// UnmarshalJSON decodes an invocation from [name, arguments, callId].
+func (inv *Invocation) UnmarshalJSON(data []byte) error {
+	var parts []json.RawMessage
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return err
+	}
+	if len(parts) != 3 {
+		return fmt.Errorf("invocation must have 3 elements, got %d", len(parts))
+	}
+	if err := json.Unmarshal(parts[0], &inv.Name); err != nil {
+		return fmt.Errorf("invalid method name: %w", err)
+	}
+	var args map[string]any
+	if err := json.Unmarshal(parts[1], &args); err != nil || args == nil {
+		return fmt.Errorf("method arguments must be an object")
+	}
+	inv.Args = args
+	if err := json.Unmarshal(parts[2], &inv.CallID); err != nil {
+		return fmt.Errorf("invalid method call id: %w", err)
+	}
+	return nil
+}
+
+// MethodError is a method-level error (RFC 8620 section 3.6.2)
+type MethodError struct {
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+}
+
+func (e *MethodError) Error() string {
+	if e.Description != "" {
+		return e.Type + ": " + e.Description
+	}
+	return e.Type
+}
+
+func methodError(errType, format string, args ...any) *MethodError {
+	return &MethodError{Type: errType, Description: fmt.Sprintf(format, args...)}
+}
+
+// SetError is a per-object error of a /set method (RFC 8620 section 5.3)
+type SetError struct {
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Properties  []string `json:"properties,omitempty"`
+	ExistingID  string   `json:"existingId,omitempty"`
+}
+
+func (e *SetError) Error() string {
+	if e.Description != "" {
+		return e.Type + ": " + e.Description
+	}
+	return e.Type
+}
+
+func setError(errType, description string, properties ...string) *SetError {
+	return &SetError{Type: errType, Description: description, Properties: properties}
+}
+
+// call holds the state shared by the method calls of one API request.
+type call struct {
+	ctx       context.Context
+	email     string
+	accountID int64
+	// createdIDs maps creation ids to the ids of objects created in this request
+	createdIDs map[string]string
+	// responses holds the decoded responses of earlier calls for result references
+	responses []Invocation
+}
+
+type methodHandler func(s *Server, c *call, args json.RawMessage) (any, error)
+
+// methods maps JMAP method names to their handlers.
+var methods = map[string]methodHandler{
+	"Core/echo":       (*Server).coreEcho,
+	"Mailbox/get":     (*Server).mailboxGet,
+	"Mailbox/set":     (*Server).mailboxSet,
+	"Mailbox/changes": (*Server).mailboxChanges,
+	"Email/get":       (*Server).emailGet,
+	"Email/query":     (*Server).emailQuery,
+	"Email/set":       (*Server).emailSet,
+	"Email/changes":   (*Server).emailChanges,
+	"Thread/get":      (*Server).threadGet,
+}
+
+// methodCapability returns the capability a method belongs to.
+func methodCapability(name string) string {
+	if strings.HasPrefix(name, "Core/") {
+		return capabilityCore
+	}
+	return capabilityMail
+}
+
+// handleAPI processes a JMAP API request (RFC 8620 section 3)
+func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/jmap/" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.limits.MaxSizeRequest))
+	if err != nil {
+		s.writeProblem(w, http.StatusBadRequest, "urn:ietf:params:jmap:error:limit",
+			"Request exceeds maxSizeRequest", map[string]any{"limit": "maxSizeRequest"})
+		return
+	}
+
+	var req Request
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&req); err != nil || req.MethodCalls == nil {
+		detail := "Request is not a valid JMAP request object"
+		if err != nil {
+			detail += ": " + err.Error()
+		}
+		s.writeProblem(w, http.StatusBadRequest, "urn:ietf:params:jmap:error:notRequest", detail)
+		return
+	}
+
+	using := make(map[string]bool, len(req.Using))
+	for _, capability := range req.Using {
+		if capability != capabilityCore && capability != capabilityMail {
+			s.writeProblem(w, http.StatusBadRequest, "urn:ietf:params:jmap:error:unknownCapability",
+				fmt.Sprintf("Unknown capability %q", capability))
+			return
+		}
+		using[capability] = true
+	}
+
+	if len(req.MethodCalls) > s.limits.MaxCallsInRequest {
+		s.writeProblem(w, http.StatusBadRequest, "urn:ietf:params:jmap:error:limit",
+			"Too many method calls in request", map[string]any{"limit": "maxCallsInRequest"})
+		return
+	}
+
+	email, accountID := getAuthFromContext(r.Context())
+	c := &call{
+		ctx:        r.Context(),
+		email:      email,
+		accountID:  accountID,
+		createdIDs: req.CreatedIDs,
+	}
+	if c.createdIDs == nil {
+		c.createdIDs = make(map[string]string)
+	}
+
+	resp := Response{
+		MethodResponses: make([]Invocation, 0, len(req.MethodCalls)),
+		SessionState:    sessionState(email, accountID),
+	}
+	for _, inv := range req.MethodCalls {
+		for _, result := range s.invoke(c, inv, using) {
+			resp.MethodResponses = append(resp.MethodResponses, result)
+			c.responses = append(c.responses, result)
+		}
+	}
+	if req.CreatedIDs != nil {
+		resp.CreatedIDs = c.createdIDs
+	}
+
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// invoke runs a single method call and returns its responses.
+func (s *Server) invoke(c *call, inv Invocation, using map[string]bool) []Invocation {
+	errorResponse := func(err *MethodError) []Invocation {
+		return []Invocation{{Name: "error", Args: err, CallID: inv.CallID}}
+	}
+
+	handler, ok := methods[inv.Name]
+	if !ok {
+		return errorResponse(methodError("unknownMethod", "unknown method %s", inv.Name))
+	}
+	if !using[methodCapability(inv.Name)] {
+		return errorResponse(methodError("unknownMethod", "capability %s not in 'using'", methodCapability(inv.Name)))
+	}
+
+	args, _ := inv.Args.(map[string]any)
+	resolved, err := resolveResultReferences(args, c.responses)
+	if err != nil {
+		return errorResponse(methodError("invalidResultReference", "%v", err))
+	}
+	rawArgs, err := json.Marshal(resolved)
+	if err != nil {
+		return errorResponse(methodError("invalidArguments", "%v", err))
+	}
+
+	result, err := handler(s, c, rawArgs)
+	metrics.CommandsTotal.WithLabelValues("jmap", inv.Name, commandStatus(err)).Inc()
+	if err != nil {
+		var merr *MethodError
+		if errors.As(err, &merr) {
+			return errorResponse(merr)
+		}
+		logger.Warn("JMAP: Method failed", "name", s.name, "method", inv.Name, "account_id", c.accountID, "error", err)
+		return errorResponse(&MethodError{Type: "serverFail", Description: "internal server error"})
+	}
+
+	// Store a generic decoded copy of the result so later calls can reference it
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(&MethodError{Type: "serverFail", Description: "failed to encode response"})
+	}
+	var decoded any
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil {
+		return errorResponse(&MethodError{Type: "serverFail", Description: "failed to encode response"})
+	}
+	return []Invocation{{Name: inv.Name, Args: decoded, CallID: inv.CallID}}
+}
+
+func commandStatus(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// resultReference points at a value in an earlier method response (RFC 8620 section 3.7)
+type resultReference struct {
+	ResultOf string `json:"resultOf"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+}
+
+// resolveResultReferences replaces "#name" arguments with the values they reference.
+func resolveResultReferences(args map[string]any, responses []Invocation) (map[string]any, error) {
+	resolved := make(map[string]any, len(args))
+	for key, value := range args {
+		if !strings.HasPrefix(key, "#") {
+			resolved[key] = value
+			continue
+		}
+		name := key[1:]
+		if _, exists := args[name]; exists {
+			return nil, fmt.Errorf("argument %s given both directly and as a reference", name)
+		}
+
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		var ref resultReference
+		if err := json.Unmarshal(encoded, &ref); err != nil || ref.ResultOf == "" || ref.Name == "" {
+			return nil, fmt.Errorf("invalid result reference for %s", name)
+		}
+
+		found := false
+		for _, response := range responses {
+			if response.CallID != ref.ResultOf {
+				continue
+			}
+			if response.Name != ref.Name {
+				return nil, fmt.Errorf("response %s is %s, not %s", ref.ResultOf, response.Name, ref.Name)
+			}
+			target, err := evaluatePointer(response.Args, ref.Path)
+			if err != nil {
+				return nil, err
+			}
+			resolved[name] = target
+			found = true
+			break
+		}
+		if !found {
+			return nil, fmt.Errorf("no response with call id %s", ref.ResultOf)
+		}
+	}
+	return resolved, nil
+}
+
+// evaluatePointer evaluates a JSON Pointer (RFC 6901) with the JMAP "*"
+// extension, which maps the rest of the path over every array element and
+// flattens nested arrays into one.
+func evaluatePointer(value any, path string) (any, error) {
+	if path == "" || path == "/" {
+		return value, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("path %q must start with /", path)
+	}
+
+	token, rest, found := strings.Cut(path[1:], "/")
+	if found {
+		rest = "/" + rest
+	}
+	token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+
+	switch v := value.(type) {
+	case map[string]any:
+		child, ok := v[token]
+		if !ok {
+			return nil, fmt.Errorf("path element %q not found", token)
+		}
+		return evaluatePointer(child, rest)
+
+	case []any:
+		if token == "*" {
+			result := make([]any, 0, len(v))
+			for _, element := range v {
+				item, err := evaluatePointer(element, rest)
+				if err != nil {
+					return nil, err
+				}
+				if items, ok := item.([]any); ok {
+					result = append(result, items...)
+				} else {
+					result = append(result, item)
+				}
+			}
+			return result, nil
+		}
+		index, err := strconv.Atoi(token)
+		if err != nil || index < 0 || index >= len(v) {
+			return nil, fmt.Errorf("invalid array index %q", token)
+		}
+		return evaluatePointer(v[index], rest)
+	}
+
+	return nil, fmt.Errorf("cannot evaluate path element %q on a scalar", token)
+}
+
+// decodeArgs decodes method arguments into target and checks the accountId.
+func (c *call) decodeArgs(args json.RawMessage, target any, accountID *string) error {
+	if err := json.Unmarshal(args, target); err != nil {
+		return methodError("invalidArguments", "%v", err)
+	}
+	if accountID != nil && *accountID != accountIDString(c.accountID) {
+		return methodError("accountNotFound", "account %s not found", *accountID)
+	}
+	return nil
+}
+
+// resolveCreationID resolves "#creationId" references to ids created earlier in the request.
+func (c *call) resolveCreationID(id string) (string, bool) {
+	if !strings.HasPrefix(id, "#") {
+		return id, true
+	}
+	created, ok := c.createdIDs[id[1:]]
+	return created, ok
+}
+
+// Core/echo (RFC 8620 section 4)
+func (s *Server) coreEcho(c *call, args json.RawMessage) (any, error) {
+	var echo map[string]any
+	if err := json.Unmarshal(args, &echo); err != nil {
+		return nil, methodError("invalidArguments", "%v", err)
+	}
+	return echo, nil
+}
@@ -0,0 +1,230 @@
+package jmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/server"
+)
+
+// contextKey is a custom type for context keys to avoid collisions
+type contextKey string
+
+const (
+	contextKeyEmail     contextKey = "email"
+	contextKeyAccountID contextKey = "accountID"
+)
+
+// JWTClaims represents the JWT token claims (must match userapi.JWTClaims)
+type JWTClaims struct {
+	Email       string `json:"email"`
+	AccountID   int64  `json:"account_id"`
+	TOTPPending bool   `json:"totp_pending,omitempty"` // Pre-auth token awaiting the second factor
+	jwt.RegisteredClaims
+}
+
+var (
+	errAuthRequired    = errors.New("authentication required")
+	errInvalidAuth     = errors.New("invalid credentials")
+	errAuthRateLimited = errors.New("too many authentication attempts")
+)
+
+// authMiddleware authenticates every request with either a bearer token issued
+// by the User API or HTTP Basic credentials (RFC 8620 section 1.8).
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		email, accountID, err := s.authenticate(r)
+		if err != nil {
+			switch {
+			case errors.Is(err, errAuthRateLimited):
+				s.writeProblem(w, http.StatusTooManyRequests, "about:blank", "Too many authentication attempts. Please try again later.")
+			case errors.Is(err, errAuthRequired), errors.Is(err, errInvalidAuth):
+				w.Header().Add("WWW-Authenticate", `Basic realm="JMAP", charset="UTF-8"`)
+				if s.jwtSecret != "" {
+					w.Header().Add("WWW-Authenticate", `Bearer realm="JMAP"`)
+				}
+				s.writeProblem(w, http.StatusUnauthorized, "about:blank", err.Error())
+			default:
+				logger.Warn("JMAP: Authentication error", "name", s.name, "error", err)
+				s.writeProblem(w, http.StatusInternalServerError, "about:blank", "Authentication failed")
+			}
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeyEmail, email)
+		ctx = context.WithValue(ctx, contextKeyAccountID, accountID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticate returns the email address and account ID of the request's credentials.
+func (s *Server) authenticate(r *http.Request) (string, int64, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return "", 0, errAuthRequired
+	}
+
+	scheme, credentials, _ := strings.Cut(authHeader, " ")
+	switch strings.ToLower(scheme) {
+	case "bearer":
+		if s.jwtSecret == "" {
+			return "", 0, errInvalidAuth
+		}
+		claims, err := s.validateToken(strings.TrimSpace(credentials))
+		if err != nil {
+			logger.Debug("JMAP: Token validation error", "name", s.name, "error", err)
+			return "", 0, errInvalidAuth
+		}
+		// Tokens outlive status changes, so check the account on every request
+		if err := s.checkAccountStatus(r.Context(), claims.AccountID); err != nil {
+			return "", 0, err
+		}
+		return claims.Email, claims.AccountID, nil
+
+	case "basic":
+		username, password, ok := r.BasicAuth()
+		if !ok || username == "" || password == "" {
+			return "", 0, errInvalidAuth
+		}
+		accountID, err := s.authenticatePassword(r.Context(), getClientIP(r), username, password)
+		if err != nil {
+			return "", 0, err
+		}
+		return username, accountID, nil
+	}
+
+	return "", 0, errInvalidAuth
+}
+
+// authenticatePassword verifies a username and password with the same cache and
+// rate limiting as the User API login.
+func (s *Server) authenticatePassword(ctx context.Context, clientIP, username, password string) (int64, error) {
+	remoteAddr := &server.StringAddr{Addr: clientIP}
+
+	// Apply progressive authentication delay BEFORE any other checks
+	server.ApplyAuthenticationDelay(ctx, s.authLimiter, remoteAddr, "JMAP")
+
+	// Check cache first (if enabled)
+	if s.authCache != nil {
+		cachedAccountID, found, cacheErr := s.authCache.Authenticate(username, password)
+		if cacheErr != nil {
+			if s.authLimiter != nil {
+				s.authLimiter.RecordAuthAttempt(ctx, remoteAddr, username, false)
+			}
+			return 0, errInvalidAuth
+		}
+		if found {
+			// A status change since the entry was cached must still block the login
+			if err := s.checkAccountStatus(ctx, cachedAccountID); err != nil {
+				return 0, err
+			}
+			if s.authLimiter != nil {
+				s.authLimiter.RecordAuthAttempt(ctx, remoteAddr, username, true)
+			}
+			return cachedAccountID, nil
+		}
+	}
+
+	// Check authentication rate limiting (after cache check to avoid delays for cached hits)
+	if s.authLimiter != nil {
+		if err := s.authLimiter.CanAttemptAuth(ctx, remoteAddr, username); err != nil {
+			logger.Debug("JMAP: Authentication rate limited", "name", s.name, "ip", clientIP, "username", username, "error", err)
+			return 0, errAuthRateLimited
+		}
+	}
+
+	creds, err := s.rdb.GetAuthCredentialsWithRetry(ctx, username)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserNotFound) {
+			if s.authCache != nil {
+				s.authCache.SetFailure(username, 1, password)
+			}
+			if s.authLimiter != nil {
+				s.authLimiter.RecordAuthAttempt(ctx, remoteAddr, username, false)
+			}
+			return 0, errInvalidAuth
+		}
+		return 0, fmt.Errorf("failed to retrieve credentials: %w", err)
+	}
+
+	accountID := creds.AccountID
+	hashedPassword := creds.HashedPassword
+
+	app, err := creds.Verify(password, db.AppPasswordProtocolJMAP, clientIP)
+	if err != nil {
+		if s.authCache != nil {
+			s.authCache.SetFailure(username, 2, password)
+		}
+		if s.authLimiter != nil {
+			s.authLimiter.RecordAuthAttempt(ctx, remoteAddr, username, false)
+		}
+		return 0, errInvalidAuth
+	}
+
+	if app != nil {
+		s.rdb.RecordAppPasswordUse(app.ID, clientIP)
+		// See the IMAP server: the cache does not know the client address
+		// and the app password may have been typed differently
+		if len(app.AllowedIPs) > 0 {
+			hashedPassword = ""
+		} else {
+			hashedPassword = db.GenerateSHA512Hash(password)
+		}
+	}
+
+	if s.authCache != nil && hashedPassword != "" {
+		s.authCache.SetSuccess(username, accountID, hashedPassword, password)
+	}
+	if s.authLimiter != nil {
+		s.authLimiter.RecordAuthAttempt(ctx, remoteAddr, username, true)
+	}
+	return accountID, nil
+}
+
+// checkAccountStatus returns errInvalidAuth if the account was deleted or its
+// status blocks logins.
+func (s *Server) checkAccountStatus(ctx context.Context, accountID int64) error {
+	status, err := s.rdb.GetAccountStatusWithRetry(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserNotFound) {
+			return errInvalidAuth
+		}
+		return fmt.Errorf("failed to check account status: %w", err)
+	}
+	if !db.AccountStatusAllowsLogin(status.Status) {
+		return errInvalidAuth
+	}
+	return nil
+}
+
+// validateToken validates a JWT token and returns the claims
+func (s *Server) validateToken(tokenString string) (*JWTClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (any, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(s.jwtSecret), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("token validation failed: %w", err)
+	}
+
+	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid && claims.AccountID > 0 && !claims.TOTPPending {
+		return claims, nil
+	}
+	return nil, fmt.Errorf("invalid token claims")
+}
+
+// getAuthFromContext retrieves the authenticated user from the request context
+func getAuthFromContext(ctx context.Context) (string, int64) {
+	email, _ := ctx.Value(contextKeyEmail).(string)
+	accountID, _ := ctx.Value(contextKeyAccountID).(int64)
+	return email, accountID
+}
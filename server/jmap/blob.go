@@ -0,0 +1,161 @@
+package jmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/helpers"
+	"github.com/migadu/sora/logger"
+)
+
+var errBlobNotFound = errors.New("blob not found")
+
+// uploadCacheKey returns the cache key of an uploaded blob. Uploads are keyed
+// per account so that one account cannot read another account's uploads.
+func uploadCacheKey(accountID int64, contentHash string) string {
+	return helpers.HashContent([]byte("jmap-upload:" + strconv.FormatInt(accountID, 10) + ":" + contentHash))
+}
+
+// handleUpload stores an uploaded blob (RFC 8620 section 6.1). Uploads are
+// kept in the local message cache, so they are only visible on the node that
+// received them until they are used in an email.
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_, accountID := getAuthFromContext(r.Context())
+	accountKey := strings.Trim(strings.TrimPrefix(r.URL.Path, "/jmap/upload/"), "/")
+	if accountKey != accountIDString(accountID) {
+		s.writeProblem(w, http.StatusNotFound, "about:blank", "Account not found")
+		return
+	}
+	if s.cache == nil {
+		s.writeProblem(w, http.StatusServiceUnavailable, "about:blank", "Uploads are not available")
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.limits.MaxSizeUpload))
+	if err != nil {
+		s.writeProblem(w, http.StatusRequestEntityTooLarge, "urn:ietf:params:jmap:error:limit",
+			"Upload exceeds maxSizeUpload", map[string]any{"limit": "maxSizeUpload"})
+		return
+	}
+
+	contentHash := helpers.HashContent(data)
+	if err := s.cache.Put(uploadCacheKey(accountID, contentHash), data); err != nil {
+		logger.Warn("JMAP: Failed to store upload", "name", s.name, "account_id", accountID, "error", err)
+		s.writeProblem(w, http.StatusInternalServerError, "about:blank", "Failed to store upload")
+		return
+	}
+
+	mediaType := r.Header.Get("Content-Type")
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+	s.writeJSON(w, http.StatusCreated, map[string]any{
+		"accountId": accountKey,
+		"blobId":    uploadBlobID(contentHash),
+		"type":      mediaType,
+		"size":      len(data),
+	})
+}
+
+// handleDownload serves a blob (RFC 8620 section 6.2) at
+// /jmap/download/{accountId}/{blobId}/{name}?accept={type}
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	email, accountID := getAuthFromContext(r.Context())
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/jmap/download/"), "/", 3)
+	if len(parts) < 2 || parts[0] != accountIDString(accountID) {
+		s.writeProblem(w, http.StatusNotFound, "about:blank", "Blob not found")
+		return
+	}
+	name := ""
+	if len(parts) == 3 {
+		name = parts[2]
+	}
+
+	c := &call{ctx: r.Context(), email: email, accountID: accountID}
+	data, err := s.readBlob(c, parts[1])
+	if err != nil {
+		if !errors.Is(err, errBlobNotFound) {
+			logger.Warn("JMAP: Failed to read blob", "name", s.name, "account_id", accountID, "blob_id", parts[1], "error", err)
+		}
+		s.writeProblem(w, http.StatusNotFound, "about:blank", "Blob not found")
+		return
+	}
+
+	mediaType := r.URL.Query().Get("accept")
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	// Blobs are immutable
+	w.Header().Set("Cache-Control", "private, immutable, max-age=31536000")
+	if name != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(data)
+	}
+}
+
+// readBlob returns the content of a blob of the account: an uploaded blob
+// ("U<hash>"), a message ("B<hash>") or a part of a message ("B<hash>.<partId>").
+func (s *Server) readBlob(c *call, blobID string) ([]byte, error) {
+	if hash, ok := parseHashID('U', blobID); ok {
+		if s.cache == nil {
+			return nil, errBlobNotFound
+		}
+		data, err := s.cache.Get(uploadCacheKey(c.accountID, hash))
+		if err != nil || data == nil {
+			return nil, errBlobNotFound
+		}
+		return data, nil
+	}
+
+	messageID, partID, _ := strings.Cut(blobID, ".")
+	hash, ok := parseHashID('B', messageID)
+	if !ok {
+		return nil, errBlobNotFound
+	}
+	data, err := s.readMessageBlob(c.ctx, c.accountID, hash)
+	if err != nil || partID == "" {
+		return data, err
+	}
+
+	root, err := parseBodyStructure(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse message: %w", err)
+	}
+	part := root.findPart(partID)
+	if part == nil {
+		return nil, errBlobNotFound
+	}
+	return part.Content, nil
+}
+
+// readMessageBlob returns a raw message after checking that the account owns it.
+func (s *Server) readMessageBlob(ctx context.Context, accountID int64, contentHash string) ([]byte, error) {
+	s3Domain, s3Localpart, err := s.rdb.GetJMAPBlobLocationWithRetry(ctx, accountID, contentHash)
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			return nil, errBlobNotFound
+		}
+		return nil, err
+	}
+	return s.fetchMessage(ctx, accountID, contentHash, s3Domain, s3Localpart)
+}
@@ -0,0 +1,984 @@
+package jmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-message/mail"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+)
+
+// defaultEmailProperties are returned by Email/get when properties is omitted
+// (RFC 8621 section 4.2).
+var defaultEmailProperties = []string{
+	"id", "blobId", "threadId", "mailboxIds", "keywords", "size",
+	"receivedAt", "messageId", "inReplyTo", "references", "sender", "from",
+	"to", "cc", "bcc", "replyTo", "subject", "sentAt", "hasAttachment",
+	"preview", "bodyValues", "textBody", "htmlBody", "attachments",
+}
+
+// emailAddressTypes maps address properties to the recipient types stored
+// with each message.
+var emailAddressTypes = map[string]string{
+	"from":    "from",
+	"sender":  "sender",
+	"to":      "to",
+	"cc":      "cc",
+	"bcc":     "bcc",
+	"replyTo": "reply-to",
+}
+
+// emailMetadataProperties can be served from the database without reading the message.
+var emailMetadataProperties = map[string]bool{
+	"id": true, "blobId": true, "threadId": true, "mailboxIds": true, "keywords": true,
+	"size": true, "receivedAt": true, "messageId": true, "inReplyTo": true,
+	"references": true, "sender": true, "from": true, "to": true, "cc": true,
+	"bcc": true, "replyTo": true, "subject": true, "sentAt": true, "preview": true,
+}
+
+// emailBodyProperties require parsing the message.
+var emailBodyProperties = map[string]bool{
+	"headers": true, "bodyStructure": true, "bodyValues": true, "textBody": true,
+	"htmlBody": true, "attachments": true, "hasAttachment": true,
+}
+
+type emailGetArgs struct {
+	AccountID           string    `json:"accountId"`
+	IDs                 *[]string `json:"ids"`
+	Properties          []string  `json:"properties"`
+	BodyProperties      []string  `json:"bodyProperties"`
+	FetchTextBodyValues bool      `json:"fetchTextBodyValues"`
+	FetchHTMLBodyValues bool      `json:"fetchHTMLBodyValues"`
+	FetchAllBodyValues  bool      `json:"fetchAllBodyValues"`
+	MaxBodyValueBytes   int       `json:"maxBodyValueBytes"`
+}
+
+// Email/get (RFC 8621 section 4.2)
+func (s *Server) emailGet(c *call, rawArgs json.RawMessage) (any, error) {
+	var args emailGetArgs
+	if err := c.decodeArgs(rawArgs, &args, &args.AccountID); err != nil {
+		return nil, err
+	}
+	if args.IDs == nil {
+		return nil, methodError("requestTooLarge", "ids must be given; use Email/query to list emails")
+	}
+	if len(*args.IDs) > s.limits.MaxObjectsInGet {
+		return nil, methodError("requestTooLarge", "too many ids (max %d)", s.limits.MaxObjectsInGet)
+	}
+	if args.MaxBodyValueBytes < 0 {
+		return nil, methodError("invalidArguments", "maxBodyValueBytes must be positive")
+	}
+
+	properties := args.Properties
+	if properties == nil {
+		properties = defaultEmailProperties
+	}
+	needsBody := false
+	for _, property := range properties {
+		switch {
+		case emailMetadataProperties[property]:
+		case emailBodyProperties[property]:
+			needsBody = true
+		case strings.HasPrefix(property, "header:"):
+			if _, _, _, err := parseHeaderPropertyName(property); err != nil {
+				return nil, methodError("invalidArguments", "invalid property %q", property)
+			}
+			needsBody = true
+		default:
+			return nil, methodError("invalidArguments", "unknown property %q", property)
+		}
+	}
+
+	state, err := s.rdb.GetJMAPStateWithRetry(c.ctx, c.accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []string
+	requested := make(map[string]string, len(*args.IDs))
+	for _, id := range *args.IDs {
+		resolved, _ := c.resolveCreationID(id)
+		if hash, ok := parseEmailID(resolved); ok {
+			hashes = append(hashes, hash)
+			requested[id] = hash
+		}
+	}
+
+	emails, err := s.rdb.GetJMAPEmailsWithRetry(c.ctx, c.accountID, hashes)
+	if err != nil {
+		return nil, err
+	}
+	byHash := make(map[string]*db.JMAPEmail, len(emails))
+	for i := range emails {
+		byHash[emails[i].ContentHash] = &emails[i]
+	}
+
+	list := make([]map[string]any, 0, len(emails))
+	notFound := make([]string, 0)
+	for _, id := range *args.IDs {
+		email := byHash[requested[id]]
+		if email == nil {
+			notFound = append(notFound, id)
+			continue
+		}
+
+		var root *bodyPart
+		if needsBody {
+			raw, err := s.fetchEmailMessage(c.ctx, c.accountID, email)
+			if err == nil {
+				root, err = parseBodyStructure(raw)
+			}
+			if err != nil {
+				logger.Warn("JMAP: Failed to load message body", "name", s.name, "account_id", c.accountID,
+					"content_hash", email.ContentHash, "error", err)
+				root = &bodyPart{PartID: "1", Type: "text/plain"}
+			}
+		}
+		list = append(list, emailObject(email, root, properties, &args))
+	}
+
+	return map[string]any{
+		"accountId": args.AccountID,
+		"state":     stateString(state),
+		"list":      list,
+		"notFound":  notFound,
+	}, nil
+}
+
+// emailObject builds the JMAP representation of an email. root is the parsed
+// message and only needed for body and header properties.
+func emailObject(email *db.JMAPEmail, root *bodyPart, properties []string, args *emailGetArgs) map[string]any {
+	var lists *bodyLists
+	if root != nil {
+		lists = classifyParts(root)
+	}
+
+	obj := make(map[string]any, len(properties)+1)
+	obj["id"] = emailIDString(email.ContentHash)
+	for _, property := range properties {
+		switch property {
+		case "id":
+		case "blobId":
+			obj[property] = messageBlobID(email.ContentHash)
+		case "threadId":
+			obj[property] = threadIDString(email.ThreadID)
+		case "mailboxIds":
+			mailboxIDs := make(map[string]bool)
+			for _, id := range email.MailboxIDs() {
+				mailboxIDs[mailboxIDString(id)] = true
+			}
+			obj[property] = mailboxIDs
+		case "keywords":
+			obj[property] = keywordsFromFlags(email.Flags)
+		case "size":
+			obj[property] = email.Size
+		case "receivedAt":
+			obj[property] = email.ReceivedAt.UTC().Format(time.RFC3339)
+		case "messageId":
+			obj[property] = messageIDList(email.MessageID)
+		case "inReplyTo":
+			obj[property] = nullIfNoIDs(email.InReplyTo)
+		case "references":
+			obj[property] = nullIfNoIDs(email.References)
+		case "sender", "from", "to", "cc", "bcc", "replyTo":
+			obj[property] = recipientAddresses(email, emailAddressTypes[property])
+		case "subject":
+			obj[property] = email.Subject
+		case "sentAt":
+			if email.SentAt.IsZero() {
+				obj[property] = nil
+			} else {
+				obj[property] = email.SentAt.Format(time.RFC3339)
+			}
+		case "preview":
+			obj[property] = email.Preview
+		case "headers":
+			obj[property] = headerList(root.Header)
+		case "bodyStructure":
+			bodyProperties := args.BodyProperties
+			if bodyProperties == nil {
+				bodyProperties = defaultBodyProperties
+			}
+			if !containsAny(bodyProperties, "subParts") {
+				bodyProperties = append(append([]string{}, bodyProperties...), "subParts")
+			}
+			obj[property] = bodyPartObject(root, email.ContentHash, bodyProperties)
+		case "textBody":
+			obj[property] = bodyPartObjects(lists.TextBody, email.ContentHash, args.BodyProperties)
+		case "htmlBody":
+			obj[property] = bodyPartObjects(lists.HTMLBody, email.ContentHash, args.BodyProperties)
+		case "attachments":
+			obj[property] = bodyPartObjects(lists.Attachments, email.ContentHash, args.BodyProperties)
+		case "hasAttachment":
+			obj[property] = len(lists.Attachments) > 0
+		case "bodyValues":
+			obj[property] = bodyValues(root, lists, args)
+		default:
+			if value, err := headerProperty(root.Header, property); err == nil {
+				obj[property] = value
+			}
+		}
+	}
+	return obj
+}
+
+func bodyPartObjects(parts []*bodyPart, contentHash string, properties []string) []map[string]any {
+	result := make([]map[string]any, 0, len(parts))
+	for _, part := range parts {
+		result = append(result, bodyPartObject(part, contentHash, properties))
+	}
+	return result
+}
+
+// bodyValues returns the decoded text parts requested by the fetch*BodyValues arguments.
+func bodyValues(root *bodyPart, lists *bodyLists, args *emailGetArgs) map[string]any {
+	values := make(map[string]any)
+	add := func(part *bodyPart) {
+		if part.PartID != "" && strings.HasPrefix(part.Type, "text/") {
+			values[part.PartID] = bodyValue(part, args.MaxBodyValueBytes)
+		}
+	}
+	if args.FetchAllBodyValues {
+		var walk func(*bodyPart)
+		walk = func(p *bodyPart) {
+			add(p)
+			for _, sub := range p.SubParts {
+				walk(sub)
+			}
+		}
+		walk(root)
+		return values
+	}
+	if args.FetchTextBodyValues {
+		for _, part := range lists.TextBody {
+			add(part)
+		}
+	}
+	if args.FetchHTMLBodyValues {
+		for _, part := range lists.HTMLBody {
+			add(part)
+		}
+	}
+	return values
+}
+
+func messageIDList(messageID string) any {
+	messageID = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(messageID), "<"), ">")
+	if messageID == "" {
+		return nil
+	}
+	return []string{messageID}
+}
+
+func nullIfNoIDs(ids []string) any {
+	var result []string
+	for _, id := range ids {
+		if id = strings.TrimSuffix(strings.TrimPrefix(id, "<"), ">"); id != "" {
+			result = append(result, id)
+		}
+	}
+	if result == nil {
+		return nil
+	}
+	return result
+}
+
+// recipientAddresses returns the addresses of one type, or nil if the header is absent.
+func recipientAddresses(email *db.JMAPEmail, addressType string) any {
+	var addresses []emailAddress
+	for _, recipient := range email.Recipients {
+		if recipient.AddressType != addressType {
+			continue
+		}
+		entry := emailAddress{Email: recipient.EmailAddress}
+		if recipient.Name != "" {
+			name := recipient.Name
+			entry.Name = &name
+		}
+		addresses = append(addresses, entry)
+	}
+	if addresses == nil {
+		return nil
+	}
+	return addresses
+}
+
+type emailQueryArgs struct {
+	AccountID       string            `json:"accountId"`
+	Filter          *emailFilter      `json:"filter"`
+	Sort            []emailComparator `json:"sort"`
+	Position        int               `json:"position"`
+	Anchor          *string           `json:"anchor"`
+	AnchorOffset    int               `json:"anchorOffset"`
+	Limit           *int              `json:"limit"`
+	CalculateTotal  bool              `json:"calculateTotal"`
+	CollapseThreads bool              `json:"collapseThreads"`
+}
+
+// Email/query (RFC 8621 section 4.4)
+func (s *Server) emailQuery(c *call, rawArgs json.RawMessage) (any, error) {
+	var args emailQueryArgs
+	if err := c.decodeArgs(rawArgs, &args, &args.AccountID); err != nil {
+		return nil, err
+	}
+	if args.Limit != nil && *args.Limit < 0 {
+		return nil, methodError("invalidArguments", "limit must not be negative")
+	}
+
+	translated, err := c.translateEmailFilter(args.Filter)
+	if err != nil {
+		return nil, err
+	}
+	sorts, err := translateEmailSort(args.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := s.rdb.GetJMAPStateWithRetry(c.ctx, c.accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := s.limits.MaxObjectsInGet
+	if args.Limit != nil && *args.Limit < limit {
+		limit = *args.Limit
+	}
+
+	query := &db.JMAPEmailQuery{
+		InMailbox:          translated.InMailbox,
+		InMailboxOtherThan: translated.OtherThan,
+		Criteria:           &translated.Criteria,
+		Sort:               sorts,
+		CollapseThreads:    args.CollapseThreads,
+		Position:           args.Position,
+		Limit:              limit,
+	}
+
+	// Negative positions and anchors are resolved against the full result
+	windowed := args.Position < 0 || args.Anchor != nil
+	if windowed {
+		query.Position = 0
+		query.Limit = 0
+	}
+
+	hashes, total, err := s.rdb.QueryJMAPEmailsWithRetry(c.ctx, c.accountID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	position := args.Position
+	if windowed {
+		if args.Anchor != nil {
+			anchor, _ := c.resolveCreationID(*args.Anchor)
+			index := -1
+			for i, hash := range hashes {
+				if emailIDString(hash) == anchor {
+					index = i
+					break
+				}
+			}
+			if index < 0 {
+				return nil, methodError("anchorNotFound", "anchor %s is not in the results", *args.Anchor)
+			}
+			position = max(index+args.AnchorOffset, 0)
+		} else {
+			position = max(len(hashes)+args.Position, 0)
+		}
+		if position > len(hashes) {
+			position = len(hashes)
+		}
+		hashes = hashes[position:min(position+limit, len(hashes))]
+	}
+
+	ids := make([]string, 0, len(hashes))
+	for _, hash := range hashes {
+		ids = append(ids, emailIDString(hash))
+	}
+
+	response := map[string]any{
+		"accountId":           args.AccountID,
+		"queryState":          stateString(state),
+		"canCalculateChanges": false,
+		"position":            position,
+		"ids":                 ids,
+	}
+	if args.CalculateTotal {
+		response["total"] = total
+	}
+	if args.Limit != nil && *args.Limit > limit {
+		response["limit"] = limit
+	}
+	return response, nil
+}
+
+// Email/changes (RFC 8621 section 4.3)
+func (s *Server) emailChanges(c *call, rawArgs json.RawMessage) (any, error) {
+	var args changesArgs
+	if err := c.decodeArgs(rawArgs, &args, &args.AccountID); err != nil {
+		return nil, err
+	}
+	since, ok := parseState(args.SinceState)
+	if !ok {
+		return nil, methodError("cannotCalculateChanges", "invalid state %q", args.SinceState)
+	}
+	maxChanges := s.limits.MaxObjectsInGet
+	if args.MaxChanges != nil {
+		if *args.MaxChanges <= 0 {
+			return nil, methodError("invalidArguments", "maxChanges must be positive")
+		}
+		maxChanges = min(maxChanges, *args.MaxChanges)
+	}
+
+	state, err := s.rdb.GetJMAPStateWithRetry(c.ctx, c.accountID)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := s.rdb.GetJMAPEmailChangesWithRetry(c.ctx, c.accountID, since, maxChanges)
+	if err != nil {
+		return nil, err
+	}
+
+	newState := max(state, changes.NewModSeq, since)
+	if changes.HasMoreChanges {
+		newState = changes.NewModSeq
+	}
+	return changesResponse{
+		AccountID:      args.AccountID,
+		OldState:       args.SinceState,
+		NewState:       stateString(newState),
+		HasMoreChanges: changes.HasMoreChanges,
+		Created:        emailIDStrings(changes.Created),
+		Updated:        emailIDStrings(changes.Updated),
+		Destroyed:      emailIDStrings(changes.Destroyed),
+	}, nil
+}
+
+func emailIDStrings(hashes []string) []string {
+	result := make([]string, 0, len(hashes))
+	for _, hash := range hashes {
+		result = append(result, emailIDString(hash))
+	}
+	return result
+}
+
+// emailCreate holds the properties accepted when creating an email.
+type emailCreate struct {
+	MailboxIDs    map[string]bool           `json:"mailboxIds"`
+	Keywords      map[string]bool           `json:"keywords"`
+	ReceivedAt    *time.Time                `json:"receivedAt"`
+	From          []emailAddress            `json:"from"`
+	Sender        []emailAddress            `json:"sender"`
+	To            []emailAddress            `json:"to"`
+	Cc            []emailAddress            `json:"cc"`
+	Bcc           []emailAddress            `json:"bcc"`
+	ReplyTo       []emailAddress            `json:"replyTo"`
+	Subject       *string                   `json:"subject"`
+	SentAt        *time.Time                `json:"sentAt"`
+	MessageID     []string                  `json:"messageId"`
+	InReplyTo     []string                  `json:"inReplyTo"`
+	References    []string                  `json:"references"`
+	BodyValues    map[string]emailBodyValue `json:"bodyValues"`
+	TextBody      []emailBodyPartCreate     `json:"textBody"`
+	HTMLBody      []emailBodyPartCreate     `json:"htmlBody"`
+	Attachments   []emailBodyPartCreate     `json:"attachments"`
+	BodyStructure json.RawMessage           `json:"bodyStructure"`
+}
+
+type emailBodyValue struct {
+	Value string `json:"value"`
+}
+
+type emailBodyPartCreate struct {
+	PartID      string `json:"partId"`
+	BlobID      string `json:"blobId"`
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Disposition string `json:"disposition"`
+	Cid         string `json:"cid"`
+}
+
+// Email/set (RFC 8621 section 4.6)
+func (s *Server) emailSet(c *call, rawArgs json.RawMessage) (any, error) {
+	var args setArgs
+	if err := c.decodeArgs(rawArgs, &args, &args.AccountID); err != nil {
+		return nil, err
+	}
+	if err := s.checkSetLimits(&args); err != nil {
+		return nil, err
+	}
+
+	oldState, err := s.rdb.GetJMAPStateWithRetry(c.ctx, c.accountID)
+	if err != nil {
+		return nil, err
+	}
+	if args.IfInState != nil && *args.IfInState != stateString(oldState) {
+		return nil, methodError("stateMismatch", "state is %d", oldState)
+	}
+	resp := newSetResponse(args.AccountID, stateString(oldState))
+
+	mailboxes, err := s.rdb.GetJMAPMailboxesWithRetry(c.ctx, c.accountID)
+	if err != nil {
+		return nil, err
+	}
+	mailboxNames := make(map[int64]string, len(mailboxes))
+	for _, mbox := range mailboxes {
+		mailboxNames[mbox.ID] = mbox.Name
+	}
+
+	creationIDs := make([]string, 0, len(args.Create))
+	for cid := range args.Create {
+		creationIDs = append(creationIDs, cid)
+	}
+	sort.Strings(creationIDs)
+	for _, cid := range creationIDs {
+		var create emailCreate
+		if err := json.Unmarshal(args.Create[cid], &create); err != nil {
+			resp.NotCreated[cid] = setError("invalidProperties", err.Error())
+			continue
+		}
+		created, setErr := s.createEmail(c, &create, mailboxNames)
+		if setErr != nil {
+			resp.NotCreated[cid] = setErr
+			continue
+		}
+		c.createdIDs[cid] = created["id"].(string)
+		resp.Created[cid] = created
+	}
+
+	if len(args.Update) > 0 {
+		if err := s.updateEmails(c, args.Update, mailboxNames, resp); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, id := range args.Destroy {
+		resolved, _ := c.resolveCreationID(id)
+		hash, ok := parseEmailID(resolved)
+		if !ok {
+			resp.NotDestroyed[id] = setError("notFound", "email not found")
+			continue
+		}
+		if err := s.rdb.DestroyJMAPEmailWithRetry(c.ctx, c.accountID, hash); err != nil {
+			if errors.Is(err, consts.ErrDBNotFound) {
+				resp.NotDestroyed[id] = setError("notFound", "email not found")
+				continue
+			}
+			return nil, err
+		}
+		resp.Destroyed = append(resp.Destroyed, id)
+	}
+
+	newState, err := s.rdb.GetJMAPStateWithRetry(c.ctx, c.accountID)
+	if err != nil {
+		return nil, err
+	}
+	resp.NewState = stateString(newState)
+	return resp, nil
+}
+
+// resolveMailboxIDs converts a mailboxIds object into mailbox ids of the account.
+func (c *call) resolveMailboxIDs(mailboxIDs map[string]bool, mailboxNames map[int64]string) ([]int64, *SetError) {
+	var ids []int64
+	for id, set := range mailboxIDs {
+		if !set {
+			return nil, setError("invalidProperties", "mailboxIds values must be true", "mailboxIds")
+		}
+		resolved, _ := c.resolveCreationID(id)
+		mailboxID, ok := parseMailboxID(resolved)
+		if !ok {
+			return nil, setError("invalidProperties", "unknown mailbox "+id, "mailboxIds")
+		}
+		if _, exists := mailboxNames[mailboxID]; !exists {
+			return nil, setError("invalidProperties", "unknown mailbox "+id, "mailboxIds")
+		}
+		ids = append(ids, mailboxID)
+	}
+	if len(ids) == 0 {
+		return nil, setError("invalidProperties", "an email must be in at least one mailbox", "mailboxIds")
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// createEmail composes a message from the create properties and stores it.
+func (s *Server) createEmail(c *call, create *emailCreate, mailboxNames map[int64]string) (map[string]any, *SetError) {
+	if len(create.BodyStructure) > 0 && string(create.BodyStructure) != "null" {
+		return nil, setError("invalidProperties", "bodyStructure is not supported; use textBody, htmlBody and attachments", "bodyStructure")
+	}
+	mailboxIDs, setErr := c.resolveMailboxIDs(create.MailboxIDs, mailboxNames)
+	if setErr != nil {
+		return nil, setErr
+	}
+	flags, ok := flagsFromKeywords(create.Keywords, nil)
+	if !ok {
+		return nil, setError("invalidProperties", "invalid keywords", "keywords")
+	}
+
+	raw, setErr := s.composeEmail(c, create)
+	if setErr != nil {
+		return nil, setErr
+	}
+	if int64(len(raw)) > s.limits.MaxSizeUpload {
+		return nil, setError("tooLarge", "message exceeds maxSizeAttachmentsPerEmail")
+	}
+
+	receivedAt := time.Now()
+	if create.ReceivedAt != nil {
+		receivedAt = *create.ReceivedAt
+	}
+	hash, setErr := s.storeMessage(c, raw, mailboxIDs, mailboxNames, flags, receivedAt)
+	if setErr != nil {
+		return nil, setErr
+	}
+
+	emails, err := s.rdb.GetJMAPEmailsWithRetry(c.ctx, c.accountID, []string{hash})
+	if err != nil || len(emails) == 0 {
+		return nil, setError("serverFail", "email was stored but could not be read back")
+	}
+	return map[string]any{
+		"id":       emailIDString(hash),
+		"blobId":   messageBlobID(hash),
+		"threadId": threadIDString(emails[0].ThreadID),
+		"size":     emails[0].Size,
+	}, nil
+}
+
+func toMailAddresses(addresses []emailAddress) []*mail.Address {
+	result := make([]*mail.Address, 0, len(addresses))
+	for _, addr := range addresses {
+		entry := &mail.Address{Address: addr.Email}
+		if addr.Name != nil {
+			entry.Name = *addr.Name
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// composeEmail builds the MIME message for an Email/set create.
+func (s *Server) composeEmail(c *call, create *emailCreate) ([]byte, *SetError) {
+	var h mail.Header
+	h.Set("MIME-Version", "1.0")
+	for _, field := range []struct {
+		key       string
+		addresses []emailAddress
+	}{{"From", create.From}, {"Sender", create.Sender}, {"To", create.To}, {"Cc", create.Cc}, {"Bcc", create.Bcc}, {"Reply-To", create.ReplyTo}} {
+		if len(field.addresses) > 0 {
+			h.SetAddressList(field.key, toMailAddresses(field.addresses))
+		}
+	}
+	if create.Subject != nil {
+		h.SetSubject(*create.Subject)
+	}
+	sentAt := time.Now()
+	if create.SentAt != nil {
+		sentAt = *create.SentAt
+	}
+	h.SetDate(sentAt)
+	if len(create.MessageID) > 0 {
+		h.SetMessageID(create.MessageID[0])
+	} else if err := h.GenerateMessageIDWithHostname(s.hostname); err != nil {
+		return nil, setError("serverFail", "failed to generate Message-ID")
+	}
+	if len(create.InReplyTo) > 0 {
+		h.SetMsgIDList("In-Reply-To", create.InReplyTo)
+	}
+	if len(create.References) > 0 {
+		h.SetMsgIDList("References", create.References)
+	}
+
+	if len(create.TextBody) > 1 || len(create.HTMLBody) > 1 {
+		return nil, setError("invalidProperties", "at most one textBody and one htmlBody part is supported", "textBody", "htmlBody")
+	}
+	textBody, setErr := bodyPartValue(create.TextBody, create.BodyValues, "text/plain", "textBody")
+	if setErr != nil {
+		return nil, setErr
+	}
+	htmlBody, setErr := bodyPartValue(create.HTMLBody, create.BodyValues, "text/html", "htmlBody")
+	if setErr != nil {
+		return nil, setErr
+	}
+	if textBody == nil && htmlBody == nil {
+		empty := ""
+		textBody = &empty
+	}
+
+	var buf bytes.Buffer
+	var err error
+	if len(create.Attachments) == 0 {
+		err = writeInlineBody(&buf, h, nil, textBody, htmlBody)
+	} else {
+		err = s.writeMixedBody(c, &buf, h, textBody, htmlBody, create.Attachments)
+	}
+	if err != nil {
+		var serr *SetError
+		if errors.As(err, &serr) {
+			return nil, serr
+		}
+		return nil, setError("invalidProperties", err.Error())
+	}
+	return buf.Bytes(), nil
+}
+
+// bodyPartValue returns the content of the text or HTML body part, or nil if there is none.
+func bodyPartValue(parts []emailBodyPartCreate, values map[string]emailBodyValue, mediaType, property string) (*string, *SetError) {
+	if len(parts) == 0 {
+		return nil, nil
+	}
+	part := parts[0]
+	if part.Type != "" && !strings.EqualFold(part.Type, mediaType) {
+		return nil, setError("invalidProperties", property+" must have type "+mediaType, property)
+	}
+	value, ok := values[part.PartID]
+	if part.PartID == "" || !ok {
+		return nil, setError("invalidProperties", property+" must reference a bodyValues entry", property)
+	}
+	return &value.Value, nil
+}
+
+// writeInlineBody writes the text and HTML bodies as a single part or a
+// multipart/alternative. When mw is nil, the body is written as the whole message.
+func writeInlineBody(buf *bytes.Buffer, h mail.Header, mw *mail.Writer, textBody, htmlBody *string) error {
+	var bodies []struct {
+		mediaType string
+		value     string
+	}
+	if textBody != nil {
+		bodies = append(bodies, struct {
+			mediaType string
+			value     string
+		}{"text/plain", *textBody})
+	}
+	if htmlBody != nil {
+		bodies = append(bodies, struct {
+			mediaType string
+			value     string
+		}{"text/html", *htmlBody})
+	}
+
+	if len(bodies) == 1 {
+		var ih mail.InlineHeader
+		ih.SetContentType(bodies[0].mediaType, map[string]string{"charset": "utf-8"})
+		var w interface {
+			Write([]byte) (int, error)
+			Close() error
+		}
+		var err error
+		if mw == nil {
+			h.SetContentType(bodies[0].mediaType, map[string]string{"charset": "utf-8"})
+			w, err = mail.CreateSingleInlineWriter(buf, h)
+		} else {
+			w, err = mw.CreateSingleInline(ih)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte(bodies[0].value)); err != nil {
+			return err
+		}
+		return w.Close()
+	}
+
+	var iw *mail.InlineWriter
+	var err error
+	if mw == nil {
+		iw, err = mail.CreateInlineWriter(buf, h)
+	} else {
+		iw, err = mw.CreateInline()
+	}
+	if err != nil {
+		return err
+	}
+	for _, body := range bodies {
+		var ih mail.InlineHeader
+		ih.SetContentType(body.mediaType, map[string]string{"charset": "utf-8"})
+		w, err := iw.CreatePart(ih)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte(body.value)); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+	return iw.Close()
+}
+
+// writeMixedBody writes a multipart/mixed message with the bodies followed by the attachments.
+func (s *Server) writeMixedBody(c *call, buf *bytes.Buffer, h mail.Header, textBody, htmlBody *string, attachments []emailBodyPartCreate) error {
+	mw, err := mail.CreateWriter(buf, h)
+	if err != nil {
+		return err
+	}
+	if err := writeInlineBody(buf, h, mw, textBody, htmlBody); err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		data, err := s.readBlob(c, attachment.BlobID)
+		if err != nil {
+			return setError("invalidProperties", "attachment blob "+attachment.BlobID+" not found", "attachments")
+		}
+		mediaType := attachment.Type
+		if mediaType == "" {
+			mediaType = "application/octet-stream"
+		}
+		var ah mail.AttachmentHeader
+		ah.SetContentType(mediaType, nil)
+		disposition := "attachment"
+		if strings.EqualFold(attachment.Disposition, "inline") {
+			disposition = "inline"
+		}
+		params := map[string]string{}
+		if attachment.Name != "" {
+			params["filename"] = attachment.Name
+		}
+		ah.SetContentDisposition(disposition, params)
+		if attachment.Cid != "" {
+			ah.Set("Content-Id", "<"+attachment.Cid+">")
+		}
+		w, err := mw.CreateAttachment(ah)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// updateEmails applies the updates of an Email/set call.
+func (s *Server) updateEmails(c *call, updates map[string]json.RawMessage, mailboxNames map[int64]string, resp *setResponse) error {
+	hashes := make([]string, 0, len(updates))
+	hashByID := make(map[string]string, len(updates))
+	for id := range updates {
+		resolved, _ := c.resolveCreationID(id)
+		if hash, ok := parseEmailID(resolved); ok {
+			hashes = append(hashes, hash)
+			hashByID[id] = hash
+		}
+	}
+	emails, err := s.rdb.GetJMAPEmailsWithRetry(c.ctx, c.accountID, hashes)
+	if err != nil {
+		return err
+	}
+	byHash := make(map[string]*db.JMAPEmail, len(emails))
+	for i := range emails {
+		byHash[emails[i].ContentHash] = &emails[i]
+	}
+
+	for id, rawPatch := range updates {
+		email := byHash[hashByID[id]]
+		if email == nil {
+			resp.NotUpdated[id] = setError("notFound", "email not found")
+			continue
+		}
+		var patch map[string]json.RawMessage
+		if err := json.Unmarshal(rawPatch, &patch); err != nil {
+			resp.NotUpdated[id] = setError("invalidPatch", err.Error())
+			continue
+		}
+		flags, mailboxIDs, setErr := c.applyEmailPatch(email, patch, mailboxNames)
+		if setErr != nil {
+			resp.NotUpdated[id] = setErr
+			continue
+		}
+		if err := s.rdb.UpdateJMAPEmailWithRetry(c.ctx, c.accountID, email.ContentHash, flags, mailboxIDs); err != nil {
+			switch {
+			case errors.Is(err, consts.ErrDBNotFound):
+				resp.NotUpdated[id] = setError("notFound", "email not found")
+			case errors.Is(err, consts.ErrMailboxNotFound):
+				resp.NotUpdated[id] = setError("invalidProperties", "unknown mailbox", "mailboxIds")
+			default:
+				return err
+			}
+			continue
+		}
+		resp.Updated[id] = nil
+	}
+	return nil
+}
+
+// applyEmailPatch computes the new flags and mailboxes of an email from a
+// PatchObject. A nil result leaves that property unchanged.
+func (c *call) applyEmailPatch(email *db.JMAPEmail, patch map[string]json.RawMessage, mailboxNames map[int64]string) ([]imap.Flag, []int64, *SetError) {
+	var keywords, mailboxIDs map[string]bool
+	for path, value := range patch {
+		property, key, hasKey := strings.Cut(path, "/")
+		key = strings.ReplaceAll(strings.ReplaceAll(key, "~1", "/"), "~0", "~")
+
+		var target *map[string]bool
+		var current func() map[string]bool
+		switch property {
+		case "keywords":
+			target = &keywords
+			current = func() map[string]bool { return keywordsFromFlags(email.Flags) }
+		case "mailboxIds":
+			target = &mailboxIDs
+			current = func() map[string]bool {
+				ids := make(map[string]bool)
+				for _, id := range email.MailboxIDs() {
+					ids[mailboxIDString(id)] = true
+				}
+				return ids
+			}
+		default:
+			return nil, nil, setError("invalidProperties", "property "+property+" cannot be updated", property)
+		}
+
+		if !hasKey {
+			var replacement map[string]bool
+			if err := json.Unmarshal(value, &replacement); err != nil {
+				return nil, nil, setError("invalidProperties", err.Error(), property)
+			}
+			if replacement == nil {
+				replacement = map[string]bool{}
+			}
+			*target = replacement
+			continue
+		}
+
+		if *target == nil {
+			*target = current()
+		}
+		if property == "keywords" {
+			key = strings.ToLower(key)
+		}
+		switch string(value) {
+		case "true":
+			(*target)[key] = true
+		case "null", "false":
+			delete(*target, key)
+		default:
+			return nil, nil, setError("invalidPatch", "patch values must be true or null", property)
+		}
+	}
+
+	var flags []imap.Flag
+	if keywords != nil {
+		var ok bool
+		if flags, ok = flagsFromKeywords(keywords, email.Flags); !ok {
+			return nil, nil, setError("invalidProperties", "invalid keywords", "keywords")
+		}
+	}
+	var ids []int64
+	if mailboxIDs != nil {
+		var setErr *SetError
+		if ids, setErr = c.resolveMailboxIDs(mailboxIDs, mailboxNames); setErr != nil {
+			return nil, nil, setErr
+		}
+	}
+	return flags, ids, nil
+}
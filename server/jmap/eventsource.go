@@ -0,0 +1,116 @@
+package jmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/migadu/sora/logger"
+)
+
+// pushTypes are the data types reported in StateChange events. All of them
+// share the account state.
+var pushTypes = []string{"Mailbox", "Email", "Thread"}
+
+// handleEventSource serves the push event stream (RFC 8620 section 7.3).
+// The account state is polled; a StateChange event is sent whenever it moves.
+func (s *Server) handleEventSource(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	types := pushTypes
+	if requested := query.Get("types"); requested != "" && requested != "*" {
+		types = nil
+		for _, t := range strings.Split(requested, ",") {
+			for _, known := range pushTypes {
+				if t == known {
+					types = append(types, t)
+				}
+			}
+		}
+	}
+	closeAfterState := query.Get("closeafter") == "state"
+	var pingInterval time.Duration
+	if ping, err := strconv.Atoi(query.Get("ping")); err == nil && ping > 0 {
+		pingInterval = time.Duration(max(ping, 5)) * time.Second
+	}
+
+	_, accountID := getAuthFromContext(r.Context())
+	ctx := r.Context()
+
+	lastState, err := s.rdb.GetJMAPStateWithRetry(ctx, accountID)
+	if err != nil {
+		logger.Warn("JMAP: Failed to read state for event source", "name", s.name, "account_id", accountID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	pollTicker := time.NewTicker(s.pollInterval)
+	defer pollTicker.Stop()
+	var pingC <-chan time.Time
+	if pingInterval > 0 {
+		pingTicker := time.NewTicker(pingInterval)
+		defer pingTicker.Stop()
+		pingC = pingTicker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-pingC:
+			if _, err := fmt.Fprintf(w, "event: ping\ndata: {\"interval\":%d}\n\n", int(pingInterval.Seconds())); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-pollTicker.C:
+			state, err := s.rdb.GetJMAPStateWithRetry(ctx, accountID)
+			if err != nil {
+				logger.Debug("JMAP: Failed to poll state", "name", s.name, "account_id", accountID, "error", err)
+				continue
+			}
+			if state == lastState || len(types) == 0 {
+				continue
+			}
+			lastState = state
+
+			changed := make(map[string]string, len(types))
+			for _, t := range types {
+				changed[t] = stateString(state)
+			}
+			event, err := json.Marshal(map[string]any{
+				"@type":   "StateChange",
+				"changed": map[string]any{accountIDString(accountID): changed},
+			})
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: state\ndata: %s\n\n", event); err != nil {
+				return
+			}
+			flusher.Flush()
+			if closeAfterState {
+				return
+			}
+		}
+	}
+}
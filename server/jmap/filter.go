@@ -0,0 +1,331 @@
+package jmap
+
+import (
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/migadu/sora/db"
+)
+
+// System keywords and the IMAP flags they are stored as (RFC 8621 section 4.1.1)
+var keywordFlags = map[string]imap.Flag{
+	"$seen":     imap.FlagSeen,
+	"$flagged":  imap.FlagFlagged,
+	"$answered": imap.FlagAnswered,
+	"$draft":    imap.FlagDraft,
+}
+
+// keywordToFlag converts a JMAP keyword to an IMAP flag. Keywords are case
+// insensitive and stored in lowercase.
+func keywordToFlag(keyword string) (imap.Flag, bool) {
+	if keyword == "" || len(keyword) > 255 {
+		return "", false
+	}
+	for _, c := range keyword {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune(`()[]{}%*"\`, c) {
+			return "", false
+		}
+	}
+	keyword = strings.ToLower(keyword)
+	if flag, ok := keywordFlags[keyword]; ok {
+		return flag, true
+	}
+	return imap.Flag(keyword), true
+}
+
+// flagToKeyword converts an IMAP flag to a JMAP keyword. Flags without a
+// keyword (\Deleted, \Recent) are skipped.
+func flagToKeyword(flag imap.Flag) (string, bool) {
+	for keyword, f := range keywordFlags {
+		if strings.EqualFold(string(f), string(flag)) {
+			return keyword, true
+		}
+	}
+	if strings.HasPrefix(string(flag), "\\") || flag == "" {
+		return "", false
+	}
+	return strings.ToLower(string(flag)), true
+}
+
+// keywordsFromFlags returns the keywords object of an email.
+func keywordsFromFlags(flags []imap.Flag) map[string]bool {
+	keywords := make(map[string]bool, len(flags))
+	for _, flag := range flags {
+		if keyword, ok := flagToKeyword(flag); ok {
+			keywords[keyword] = true
+		}
+	}
+	return keywords
+}
+
+// flagsFromKeywords returns the flags for a keywords object, keeping the
+// flags of current that have no keyword.
+func flagsFromKeywords(keywords map[string]bool, current []imap.Flag) ([]imap.Flag, bool) {
+	var flags []imap.Flag
+	for _, flag := range current {
+		if _, ok := flagToKeyword(flag); !ok {
+			flags = append(flags, flag)
+		}
+	}
+	for keyword, set := range keywords {
+		if !set {
+			return nil, false
+		}
+		flag, ok := keywordToFlag(keyword)
+		if !ok {
+			return nil, false
+		}
+		flags = append(flags, flag)
+	}
+	if flags == nil {
+		flags = []imap.Flag{}
+	}
+	return flags, true
+}
+
+// emailFilter is an Email/query FilterCondition or FilterOperator (RFC 8621 section 4.4.1)
+type emailFilter struct {
+	Operator   string         `json:"operator"`
+	Conditions []*emailFilter `json:"conditions"`
+	InMailbox  *string        `json:"inMailbox"`
+	OtherThan  []string       `json:"inMailboxOtherThan"`
+	Before     *time.Time     `json:"before"`
+	After      *time.Time     `json:"after"`
+	MinSize    *int64         `json:"minSize"`
+	MaxSize    *int64         `json:"maxSize"`
+	HasKeyword *string        `json:"hasKeyword"`
+	NotKeyword *string        `json:"notKeyword"`
+	Text       *string        `json:"text"`
+	From       *string        `json:"from"`
+	To         *string        `json:"to"`
+	Cc         *string        `json:"cc"`
+	Bcc        *string        `json:"bcc"`
+	Subject    *string        `json:"subject"`
+	Body       *string        `json:"body"`
+	Header     []string       `json:"header"`
+
+	// Thread keyword and attachment conditions are not supported
+	AllInThreadHaveKeyword  *string `json:"allInThreadHaveKeyword"`
+	SomeInThreadHaveKeyword *string `json:"someInThreadHaveKeyword"`
+	NoneInThreadHaveKeyword *string `json:"noneInThreadHaveKeyword"`
+	HasAttachment           *bool   `json:"hasAttachment"`
+}
+
+// filterTranslation is the result of translating an Email/query filter.
+type filterTranslation struct {
+	Criteria  imap.SearchCriteria
+	InMailbox int64
+	OtherThan []int64
+}
+
+// translateEmailFilter converts an Email/query filter into search criteria.
+// inMailbox and inMailboxOtherThan are only supported in the top-level
+// condition or in conditions directly below a top-level AND.
+func (c *call) translateEmailFilter(filter *emailFilter) (*filterTranslation, error) {
+	result := &filterTranslation{}
+	if filter == nil {
+		return result, nil
+	}
+
+	topLevel := []*emailFilter{filter}
+	if strings.EqualFold(filter.Operator, "AND") {
+		topLevel = filter.Conditions
+	}
+	for _, condition := range topLevel {
+		if condition == nil {
+			continue
+		}
+		if condition.Operator == "" {
+			if condition.InMailbox != nil {
+				resolved, _ := c.resolveCreationID(*condition.InMailbox)
+				id, ok := parseMailboxID(resolved)
+				if !ok || (result.InMailbox != 0 && result.InMailbox != id) {
+					return nil, methodError("unsupportedFilter", "invalid inMailbox %q", *condition.InMailbox)
+				}
+				result.InMailbox = id
+			}
+			for _, otherThan := range condition.OtherThan {
+				resolved, _ := c.resolveCreationID(otherThan)
+				id, ok := parseMailboxID(resolved)
+				if !ok {
+					return nil, methodError("unsupportedFilter", "invalid inMailboxOtherThan %q", otherThan)
+				}
+				result.OtherThan = append(result.OtherThan, id)
+			}
+		}
+		criteria, err := translateCondition(condition, true)
+		if err != nil {
+			return nil, err
+		}
+		mergeCriteria(&result.Criteria, criteria)
+	}
+	return result, nil
+}
+
+// translateCondition converts a filter into search criteria. Mailbox
+// conditions are rejected unless they were handled by the caller.
+func translateCondition(filter *emailFilter, mailboxHandled bool) (*imap.SearchCriteria, error) {
+	if filter == nil {
+		return &imap.SearchCriteria{}, nil
+	}
+
+	if filter.Operator != "" {
+		var subCriteria []*imap.SearchCriteria
+		for _, condition := range filter.Conditions {
+			sub, err := translateCondition(condition, false)
+			if err != nil {
+				return nil, err
+			}
+			subCriteria = append(subCriteria, sub)
+		}
+
+		result := &imap.SearchCriteria{}
+		switch strings.ToUpper(filter.Operator) {
+		case "AND":
+			for _, sub := range subCriteria {
+				mergeCriteria(result, sub)
+			}
+		case "NOT":
+			// NOT (a OR b) = NOT a AND NOT b
+			for _, sub := range subCriteria {
+				result.Not = append(result.Not, *sub)
+			}
+		case "OR":
+			switch len(subCriteria) {
+			case 0:
+				result.Not = []imap.SearchCriteria{{}} // Matches nothing
+			case 1:
+				result = subCriteria[0]
+			default:
+				result = orCriteria(subCriteria)
+			}
+		default:
+			return nil, methodError("unsupportedFilter", "unknown operator %q", filter.Operator)
+		}
+		return result, nil
+	}
+
+	if !mailboxHandled && (filter.InMailbox != nil || len(filter.OtherThan) > 0) {
+		return nil, methodError("unsupportedFilter", "inMailbox and inMailboxOtherThan are only supported at the top level")
+	}
+	if filter.AllInThreadHaveKeyword != nil || filter.SomeInThreadHaveKeyword != nil ||
+		filter.NoneInThreadHaveKeyword != nil || filter.HasAttachment != nil {
+		return nil, methodError("unsupportedFilter", "thread keyword and attachment filters are not supported")
+	}
+
+	criteria := &imap.SearchCriteria{}
+	if filter.Before != nil {
+		criteria.Before = *filter.Before
+	}
+	if filter.After != nil {
+		criteria.Since = *filter.After
+	}
+	if filter.MinSize != nil && *filter.MinSize > 0 {
+		criteria.Larger = *filter.MinSize - 1
+	}
+	if filter.MaxSize != nil {
+		if *filter.MaxSize <= 0 {
+			criteria.Not = []imap.SearchCriteria{{}}
+		} else {
+			criteria.Smaller = *filter.MaxSize
+		}
+	}
+	if filter.HasKeyword != nil {
+		flag, ok := keywordToFlag(*filter.HasKeyword)
+		if !ok {
+			return nil, methodError("unsupportedFilter", "invalid keyword %q", *filter.HasKeyword)
+		}
+		criteria.Flag = append(criteria.Flag, flag)
+	}
+	if filter.NotKeyword != nil {
+		flag, ok := keywordToFlag(*filter.NotKeyword)
+		if !ok {
+			return nil, methodError("unsupportedFilter", "invalid keyword %q", *filter.NotKeyword)
+		}
+		criteria.NotFlag = append(criteria.NotFlag, flag)
+	}
+	if filter.Text != nil {
+		criteria.Text = append(criteria.Text, *filter.Text)
+	}
+	if filter.Body != nil {
+		criteria.Body = append(criteria.Body, *filter.Body)
+	}
+	for _, header := range []struct {
+		key   string
+		value *string
+	}{{"From", filter.From}, {"To", filter.To}, {"Cc", filter.Cc}, {"Bcc", filter.Bcc}, {"Subject", filter.Subject}} {
+		if header.value != nil {
+			criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{Key: header.key, Value: *header.value})
+		}
+	}
+	if filter.Header != nil {
+		if len(filter.Header) == 0 || len(filter.Header) > 2 || filter.Header[0] == "" {
+			return nil, methodError("unsupportedFilter", "header must be [name] or [name, value]")
+		}
+		field := imap.SearchCriteriaHeaderField{Key: filter.Header[0]}
+		if len(filter.Header) == 2 {
+			field.Value = filter.Header[1]
+		}
+		criteria.Header = append(criteria.Header, field)
+	}
+	return criteria, nil
+}
+
+// mergeCriteria adds the conditions of src to dst (logical AND).
+func mergeCriteria(dst, src *imap.SearchCriteria) {
+	if !src.Since.IsZero() && src.Since.After(dst.Since) {
+		dst.Since = src.Since
+	}
+	if !src.Before.IsZero() && (dst.Before.IsZero() || src.Before.Before(dst.Before)) {
+		dst.Before = src.Before
+	}
+	if src.Larger > dst.Larger {
+		dst.Larger = src.Larger
+	}
+	if src.Smaller > 0 && (dst.Smaller == 0 || src.Smaller < dst.Smaller) {
+		dst.Smaller = src.Smaller
+	}
+	dst.Header = append(dst.Header, src.Header...)
+	dst.Body = append(dst.Body, src.Body...)
+	dst.Text = append(dst.Text, src.Text...)
+	dst.Flag = append(dst.Flag, src.Flag...)
+	dst.NotFlag = append(dst.NotFlag, src.NotFlag...)
+	dst.Not = append(dst.Not, src.Not...)
+	dst.Or = append(dst.Or, src.Or...)
+}
+
+// orCriteria nests two or more criteria into OR pairs.
+func orCriteria(criteria []*imap.SearchCriteria) *imap.SearchCriteria {
+	if len(criteria) == 1 {
+		return criteria[0]
+	}
+	rest := orCriteria(criteria[1:])
+	return &imap.SearchCriteria{Or: [][2]imap.SearchCriteria{{*criteria[0], *rest}}}
+}
+
+// emailComparator is an Email/query sort criterion (RFC 8620 section 5.5)
+type emailComparator struct {
+	Property    string `json:"property"`
+	IsAscending *bool  `json:"isAscending"`
+	Collation   string `json:"collation"`
+}
+
+// translateEmailSort converts Email/query comparators into database sorts.
+func translateEmailSort(comparators []emailComparator) ([]db.JMAPEmailSort, error) {
+	sorts := make([]db.JMAPEmailSort, 0, len(comparators))
+	for _, comparator := range comparators {
+		if !db.IsJMAPEmailSortSupported(comparator.Property) {
+			return nil, methodError("unsupportedSort", "cannot sort by %q", comparator.Property)
+		}
+		if comparator.Collation != "" && comparator.Collation != "i;ascii-casemap" {
+			return nil, methodError("unsupportedSort", "unsupported collation %q", comparator.Collation)
+		}
+		ascending := true
+		if comparator.IsAscending != nil {
+			ascending = *comparator.IsAscending
+		}
+		sorts = append(sorts, db.JMAPEmailSort{Property: comparator.Property, IsAscending: ascending})
+	}
+	return sorts, nil
+}
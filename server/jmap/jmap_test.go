@@ -0,0 +1,264 @@
+package jmap
+
+import (
+	"bufio"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/textproto"
+)
+
+func TestParseIDs(t *testing.T) {
+	if id, ok := parseMailboxID(mailboxIDString(42)); !ok || id != 42 {
+		t.Errorf("parseMailboxID round trip failed: %d %v", id, ok)
+	}
+	for _, invalid := range []string{"", "M", "M0", "M-1", "Mabc", "E42", "42"} {
+		if _, ok := parseMailboxID(invalid); ok {
+			t.Errorf("parseMailboxID(%q) should fail", invalid)
+		}
+	}
+
+	hash := strings.Repeat("ab", 32)
+	if got, ok := parseEmailID(emailIDString(hash)); !ok || got != hash {
+		t.Errorf("parseEmailID round trip failed: %q %v", got, ok)
+	}
+	for _, invalid := range []string{"E", "T" + hash, "E" + strings.ToUpper(hash), "E" + hash + "00", "Exyz"} {
+		if _, ok := parseEmailID(invalid); ok {
+			t.Errorf("parseEmailID(%q) should fail", invalid)
+		}
+	}
+
+	if _, ok := parseState("-1"); ok {
+		t.Error("negative state should be invalid")
+	}
+	if n, ok := parseState("17"); !ok || n != 17 {
+		t.Errorf("parseState(17) = %d %v", n, ok)
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	tests := []struct {
+		keyword string
+		flag    imap.Flag
+		valid   bool
+	}{
+		{"$seen", imap.FlagSeen, true},
+		{"$Flagged", imap.FlagFlagged, true},
+		{"$Junk", "$junk", true},
+		{"work", "work", true},
+		{"", "", false},
+		{"has space", "", false},
+		{"paren(", "", false},
+		{"\\Seen", "", false},
+	}
+	for _, tt := range tests {
+		flag, ok := keywordToFlag(tt.keyword)
+		if ok != tt.valid || flag != tt.flag {
+			t.Errorf("keywordToFlag(%q) = %q, %v; want %q, %v", tt.keyword, flag, ok, tt.flag, tt.valid)
+		}
+	}
+
+	keywords := keywordsFromFlags([]imap.Flag{imap.FlagSeen, imap.FlagDeleted, "\\Recent", "Work"})
+	if !reflect.DeepEqual(keywords, map[string]bool{"$seen": true, "work": true}) {
+		t.Errorf("keywordsFromFlags = %v", keywords)
+	}
+
+	flags, ok := flagsFromKeywords(map[string]bool{"$flagged": true}, []imap.Flag{imap.FlagSeen, imap.FlagDeleted})
+	if !ok || !reflect.DeepEqual(flags, []imap.Flag{imap.FlagDeleted, imap.FlagFlagged}) {
+		t.Errorf("flagsFromKeywords = %v, %v", flags, ok)
+	}
+	if _, ok := flagsFromKeywords(map[string]bool{"$seen": false}, nil); ok {
+		t.Error("keyword values must be true")
+	}
+}
+
+func TestTranslateEmailFilter(t *testing.T) {
+	c := &call{createdIDs: map[string]string{"new": "M7"}}
+
+	var filter emailFilter
+	raw := `{"operator": "AND", "conditions": [
+		{"inMailbox": "#new"},
+		{"hasKeyword": "$seen", "minSize": 100},
+		{"operator": "OR", "conditions": [{"from": "alice"}, {"subject": "hello"}, {"text": "x"}]},
+		{"operator": "NOT", "conditions": [{"notKeyword": "$draft"}]}
+	]}`
+	if err := json.Unmarshal([]byte(raw), &filter); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := c.translateEmailFilter(&filter)
+	if err != nil {
+		t.Fatalf("translateEmailFilter: %v", err)
+	}
+	if result.InMailbox != 7 {
+		t.Errorf("InMailbox = %d, want 7", result.InMailbox)
+	}
+	if !reflect.DeepEqual(result.Criteria.Flag, []imap.Flag{imap.FlagSeen}) {
+		t.Errorf("Flag = %v", result.Criteria.Flag)
+	}
+	if result.Criteria.Larger != 99 {
+		t.Errorf("Larger = %d, want 99", result.Criteria.Larger)
+	}
+	if len(result.Criteria.Or) != 1 || len(result.Criteria.Or[0][1].Or) != 1 {
+		t.Errorf("OR of three conditions should nest into pairs: %+v", result.Criteria.Or)
+	}
+	if len(result.Criteria.Not) != 1 || !reflect.DeepEqual(result.Criteria.Not[0].NotFlag, []imap.Flag{imap.FlagDraft}) {
+		t.Errorf("Not = %+v", result.Criteria.Not)
+	}
+
+	nested := &emailFilter{Operator: "OR", Conditions: []*emailFilter{{InMailbox: new(string)}}}
+	if _, err := c.translateEmailFilter(nested); err == nil {
+		t.Error("inMailbox below OR should be rejected")
+	}
+	hasAttachment := true
+	if _, err := c.translateEmailFilter(&emailFilter{HasAttachment: &hasAttachment}); err == nil {
+		t.Error("hasAttachment should be rejected")
+	}
+}
+
+func TestEvaluatePointer(t *testing.T) {
+	var value any
+	raw := `{"list": [{"id": "a", "threadIds": ["t1"]}, {"id": "b", "threadIds": ["t2", "t3"]}], "ids": ["x", "y"]}`
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		want    any
+		wantErr bool
+	}{
+		{"/ids", []any{"x", "y"}, false},
+		{"/ids/1", "y", false},
+		{"/list/*/id", []any{"a", "b"}, false},
+		{"/list/*/threadIds", []any{"t1", "t2", "t3"}, false},
+		{"/missing", nil, true},
+		{"/ids/5", nil, true},
+		{"ids", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := evaluatePointer(value, tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("evaluatePointer(%q) error = %v", tt.path, err)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("evaluatePointer(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestResolveResultReferences(t *testing.T) {
+	responses := []Invocation{{
+		Name:   "Email/query",
+		Args:   map[string]any{"ids": []any{"E1", "E2"}},
+		CallID: "c0",
+	}}
+
+	args := map[string]any{
+		"#ids": map[string]any{"resultOf": "c0", "name": "Email/query", "path": "/ids"},
+	}
+	resolved, err := resolveResultReferences(args, responses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resolved["ids"], []any{"E1", "E2"}) {
+		t.Errorf("ids = %v", resolved["ids"])
+	}
+
+	args["#ids"] = map[string]any{"resultOf": "c0", "name": "Email/get", "path": "/ids"}
+	if _, err := resolveResultReferences(args, responses); err == nil {
+		t.Error("a reference with the wrong method name should fail")
+	}
+
+	args = map[string]any{"ids": nil, "#ids": map[string]any{"resultOf": "c0", "name": "Email/query", "path": "/ids"}}
+	if _, err := resolveResultReferences(args, responses); err == nil {
+		t.Error("an argument given directly and as a reference should fail")
+	}
+}
+
+func TestClassifyParts(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=outer\r\n\r\n" +
+		"--outer\r\nContent-Type: multipart/alternative; boundary=alt\r\n\r\n" +
+		"--alt\r\nContent-Type: text/plain\r\n\r\nplain\r\n" +
+		"--alt\r\nContent-Type: text/html\r\n\r\n<p>html</p>\r\n" +
+		"--alt--\r\n" +
+		"--outer\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=a.pdf\r\n\r\nPDF\r\n" +
+		"--outer--\r\n"
+
+	root, err := parseBodyStructure([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lists := classifyParts(root)
+
+	partIDs := func(parts []*bodyPart) []string {
+		ids := []string{}
+		for _, p := range parts {
+			ids = append(ids, p.PartID)
+		}
+		return ids
+	}
+	if got := partIDs(lists.TextBody); !reflect.DeepEqual(got, []string{"1.1"}) {
+		t.Errorf("textBody = %v", got)
+	}
+	if got := partIDs(lists.HTMLBody); !reflect.DeepEqual(got, []string{"1.2"}) {
+		t.Errorf("htmlBody = %v", got)
+	}
+	if got := partIDs(lists.Attachments); !reflect.DeepEqual(got, []string{"2"}) {
+		t.Errorf("attachments = %v", got)
+	}
+
+	single, err := parseBodyStructure([]byte("Content-Type: text/plain\r\n\r\nhello\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lists := classifyParts(single); len(lists.TextBody) != 1 || len(lists.HTMLBody) != 1 || lists.TextBody[0].PartID != "1" {
+		t.Errorf("single text part should be both textBody and htmlBody: %+v", lists)
+	}
+}
+
+func TestHeaderProperty(t *testing.T) {
+	raw := "From: Alice <alice@example.com>\r\n" +
+		"X-Tag: one\r\n" +
+		"X-Tag: two\r\n" +
+		"Message-ID: <abc@example.com>\r\n" +
+		"Subject: =?UTF-8?Q?caf=C3=A9?=\r\n\r\n"
+	th, err := textproto.ReadHeader(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := message.Header{Header: th}
+
+	tests := []struct {
+		property string
+		want     any
+	}{
+		{"header:X-Tag", " two"},
+		{"header:x-tag:all", []any{" one", " two"}},
+		{"header:Subject:asText", "café"},
+		{"header:Message-ID:asMessageIds", []string{"abc@example.com"}},
+		{"header:Missing", nil},
+		{"header:Missing:all", []any{}},
+	}
+	for _, tt := range tests {
+		got, err := headerProperty(h, tt.property)
+		if err != nil {
+			t.Errorf("headerProperty(%q): %v", tt.property, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("headerProperty(%q) = %#v, want %#v", tt.property, got, tt.want)
+		}
+	}
+
+	for _, invalid := range []string{"header:", "header:X:asBogus", "header:X:all:asText", "subject"} {
+		if _, err := headerProperty(h, invalid); err == nil {
+			t.Errorf("headerProperty(%q) should fail", invalid)
+		}
+	}
+}
@@ -0,0 +1,587 @@
+package jmap
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+)
+
+// mailboxRoles maps the default mailbox names to their JMAP roles (RFC 8621 section 2)
+var mailboxRoles = map[string]string{
+	strings.ToUpper(consts.MailboxInbox): "inbox",
+	consts.MailboxSent:                   "sent",
+	consts.MailboxDrafts:                 "drafts",
+	consts.MailboxArchive:                "archive",
+	consts.MailboxJunk:                   "junk",
+	consts.MailboxTrash:                  "trash",
+}
+
+// mailboxRole returns the role of a top-level default mailbox, or nil.
+func mailboxRole(fullName string) any {
+	if strings.EqualFold(fullName, consts.MailboxInbox) {
+		return "inbox"
+	}
+	if role, ok := mailboxRoles[fullName]; ok {
+		return role
+	}
+	return nil
+}
+
+// mailboxLeafName returns the last component of a full mailbox name.
+func mailboxLeafName(fullName string) string {
+	if i := strings.LastIndexByte(fullName, consts.MailboxDelimiter); i >= 0 {
+		return fullName[i+1:]
+	}
+	return fullName
+}
+
+// mailboxCountProperties are the properties that change when only the
+// messages in a mailbox change (RFC 8621 section 2.2).
+var mailboxCountProperties = []string{"totalEmails", "unreadEmails", "totalThreads", "unreadThreads"}
+
+type getArgs struct {
+	AccountID  string    `json:"accountId"`
+	IDs        *[]string `json:"ids"`
+	Properties []string  `json:"properties"`
+}
+
+type changesArgs struct {
+	AccountID  string `json:"accountId"`
+	SinceState string `json:"sinceState"`
+	MaxChanges *int   `json:"maxChanges"`
+}
+
+type changesResponse struct {
+	AccountID         string   `json:"accountId"`
+	OldState          string   `json:"oldState"`
+	NewState          string   `json:"newState"`
+	HasMoreChanges    bool     `json:"hasMoreChanges"`
+	Created           []string `json:"created"`
+	Updated           []string `json:"updated"`
+	Destroyed         []string `json:"destroyed"`
+	UpdatedProperties []string `json:"updatedProperties,omitempty"`
+}
+
+type setArgs struct {
+	AccountID string                     `json:"accountId"`
+	IfInState *string                    `json:"ifInState"`
+	Create    map[string]json.RawMessage `json:"create"`
+	Update    map[string]json.RawMessage `json:"update"`
+	Destroy   []string                   `json:"destroy"`
+	// Mailbox/set only
+	OnDestroyRemoveEmails bool `json:"onDestroyRemoveEmails"`
+}
+
+type setResponse struct {
+	AccountID    string               `json:"accountId"`
+	OldState     string               `json:"oldState"`
+	NewState     string               `json:"newState"`
+	Created      map[string]any       `json:"created,omitempty"`
+	Updated      map[string]any       `json:"updated,omitempty"`
+	Destroyed    []string             `json:"destroyed,omitempty"`
+	NotCreated   map[string]*SetError `json:"notCreated,omitempty"`
+	NotUpdated   map[string]*SetError `json:"notUpdated,omitempty"`
+	NotDestroyed map[string]*SetError `json:"notDestroyed,omitempty"`
+}
+
+func newSetResponse(accountID, oldState string) *setResponse {
+	return &setResponse{
+		AccountID:    accountID,
+		OldState:     oldState,
+		Created:      make(map[string]any),
+		Updated:      make(map[string]any),
+		NotCreated:   make(map[string]*SetError),
+		NotUpdated:   make(map[string]*SetError),
+		NotDestroyed: make(map[string]*SetError),
+	}
+}
+
+// checkSetLimits rejects /set calls that exceed maxObjectsInSet.
+func (s *Server) checkSetLimits(args *setArgs) error {
+	if len(args.Create)+len(args.Update)+len(args.Destroy) > s.limits.MaxObjectsInSet {
+		return methodError("requestTooLarge", "too many objects in set (max %d)", s.limits.MaxObjectsInSet)
+	}
+	return nil
+}
+
+// filterProperties returns obj restricted to the requested properties; id is always included.
+func filterProperties(obj map[string]any, properties []string) map[string]any {
+	if properties == nil {
+		return obj
+	}
+	filtered := map[string]any{"id": obj["id"]}
+	for _, p := range properties {
+		if v, ok := obj[p]; ok {
+			filtered[p] = v
+		}
+	}
+	return filtered
+}
+
+// mailboxObject builds the JMAP representation of a mailbox.
+func mailboxObject(mbox *db.JMAPMailbox, threadCounts [2]int64) map[string]any {
+	var parentID any
+	if mbox.ParentID != 0 {
+		parentID = mailboxIDString(mbox.ParentID)
+	}
+	role := mailboxRole(mbox.Name)
+	sortOrder := 10
+	if role == "inbox" {
+		sortOrder = 1
+	}
+	return map[string]any{
+		"id":            mailboxIDString(mbox.ID),
+		"name":          mailboxLeafName(mbox.Name),
+		"parentId":      parentID,
+		"role":          role,
+		"sortOrder":     sortOrder,
+		"totalEmails":   mbox.TotalEmails,
+		"unreadEmails":  mbox.UnreadEmails,
+		"totalThreads":  threadCounts[0],
+		"unreadThreads": threadCounts[1],
+		"myRights": map[string]bool{
+			"mayReadItems":   true,
+			"mayAddItems":    true,
+			"mayRemoveItems": true,
+			"maySetSeen":     true,
+			"maySetKeywords": true,
+			"mayCreateChild": true,
+			"mayRename":      role != "inbox",
+			"mayDelete":      role != "inbox",
+			"maySubmit":      true,
+		},
+		"isSubscribed": mbox.Subscribed,
+	}
+}
+
+// Mailbox/get (RFC 8621 section 2.1)
+func (s *Server) mailboxGet(c *call, rawArgs json.RawMessage) (any, error) {
+	var args getArgs
+	if err := c.decodeArgs(rawArgs, &args, &args.AccountID); err != nil {
+		return nil, err
+	}
+	if args.IDs != nil && len(*args.IDs) > s.limits.MaxObjectsInGet {
+		return nil, methodError("requestTooLarge", "too many ids (max %d)", s.limits.MaxObjectsInGet)
+	}
+
+	state, err := s.rdb.GetJMAPStateWithRetry(c.ctx, c.accountID)
+	if err != nil {
+		return nil, err
+	}
+	mailboxes, err := s.rdb.GetJMAPMailboxesWithRetry(c.ctx, c.accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var threadCounts map[int64][2]int64
+	if args.Properties == nil || containsAny(args.Properties, "totalThreads", "unreadThreads") {
+		threadCounts, err = s.rdb.GetJMAPMailboxThreadCountsWithRetry(c.ctx, c.accountID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	byID := make(map[string]*db.JMAPMailbox, len(mailboxes))
+	for i := range mailboxes {
+		byID[mailboxIDString(mailboxes[i].ID)] = &mailboxes[i]
+	}
+
+	list := make([]map[string]any, 0)
+	notFound := make([]string, 0)
+	if args.IDs == nil {
+		for i := range mailboxes {
+			list = append(list, filterProperties(mailboxObject(&mailboxes[i], threadCounts[mailboxes[i].ID]), args.Properties))
+		}
+	} else {
+		for _, id := range *args.IDs {
+			resolved, _ := c.resolveCreationID(id)
+			mbox, ok := byID[resolved]
+			if !ok {
+				notFound = append(notFound, id)
+				continue
+			}
+			list = append(list, filterProperties(mailboxObject(mbox, threadCounts[mbox.ID]), args.Properties))
+		}
+	}
+
+	return map[string]any{
+		"accountId": args.AccountID,
+		"state":     stateString(state),
+		"list":      list,
+		"notFound":  notFound,
+	}, nil
+}
+
+// Mailbox/changes (RFC 8621 section 2.2)
+func (s *Server) mailboxChanges(c *call, rawArgs json.RawMessage) (any, error) {
+	var args changesArgs
+	if err := c.decodeArgs(rawArgs, &args, &args.AccountID); err != nil {
+		return nil, err
+	}
+	since, ok := parseState(args.SinceState)
+	if !ok {
+		return nil, methodError("cannotCalculateChanges", "invalid state %q", args.SinceState)
+	}
+
+	state, err := s.rdb.GetJMAPStateWithRetry(c.ctx, c.accountID)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := s.rdb.GetJMAPMailboxChangesWithRetry(c.ctx, c.accountID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	total := len(changes.Created) + len(changes.Updated) + len(changes.Destroyed)
+	if args.MaxChanges != nil && *args.MaxChanges > 0 && total > *args.MaxChanges {
+		// Mailbox changes are not ordered by modseq, so they cannot be paged
+		return nil, methodError("cannotCalculateChanges", "more than %d mailboxes changed", *args.MaxChanges)
+	}
+
+	resp := changesResponse{
+		AccountID: args.AccountID,
+		OldState:  args.SinceState,
+		NewState:  stateString(max(state, since)),
+		Created:   mailboxIDStrings(changes.Created),
+		Updated:   mailboxIDStrings(changes.Updated),
+		Destroyed: mailboxIDStrings(changes.Destroyed),
+	}
+	if changes.CountsOnly {
+		resp.UpdatedProperties = mailboxCountProperties
+	}
+	return resp, nil
+}
+
+func mailboxIDStrings(ids []int64) []string {
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, mailboxIDString(id))
+	}
+	return result
+}
+
+// mailboxPatch holds the settable properties of a mailbox.
+type mailboxPatch struct {
+	Name         *string         `json:"name"`
+	ParentID     json.RawMessage `json:"parentId"`
+	IsSubscribed *bool           `json:"isSubscribed"`
+	Role         json.RawMessage `json:"role"`
+	SortOrder    json.RawMessage `json:"sortOrder"`
+}
+
+// Mailbox/set (RFC 8621 section 2.5)
+func (s *Server) mailboxSet(c *call, rawArgs json.RawMessage) (any, error) {
+	var args setArgs
+	if err := c.decodeArgs(rawArgs, &args, &args.AccountID); err != nil {
+		return nil, err
+	}
+	if err := s.checkSetLimits(&args); err != nil {
+		return nil, err
+	}
+
+	oldState, err := s.rdb.GetJMAPStateWithRetry(c.ctx, c.accountID)
+	if err != nil {
+		return nil, err
+	}
+	if args.IfInState != nil && *args.IfInState != stateString(oldState) {
+		return nil, methodError("stateMismatch", "state is %d", oldState)
+	}
+	resp := newSetResponse(args.AccountID, stateString(oldState))
+
+	mailboxes, err := s.rdb.GetJMAPMailboxesWithRetry(c.ctx, c.accountID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]*db.JMAPMailbox, len(mailboxes))
+	for i := range mailboxes {
+		byID[mailboxes[i].ID] = &mailboxes[i]
+	}
+
+	// Creates are processed parents first so that children can reference
+	// a parent created in the same call.
+	creationIDs := make([]string, 0, len(args.Create))
+	for cid := range args.Create {
+		creationIDs = append(creationIDs, cid)
+	}
+	sort.Strings(creationIDs)
+	pending := creationIDs
+	for len(pending) > 0 {
+		var deferred []string
+		for _, cid := range pending {
+			var patch mailboxPatch
+			if err := json.Unmarshal(args.Create[cid], &patch); err != nil {
+				resp.NotCreated[cid] = setError("invalidProperties", err.Error())
+				continue
+			}
+			if ref := parentCreationRef(patch.ParentID); ref != "" && c.createdIDs[ref] == "" && args.Create[ref] != nil && resp.NotCreated[ref] == nil {
+				deferred = append(deferred, cid)
+				continue
+			}
+			id, setErr := s.createMailbox(c, &patch, byID)
+			if setErr != nil {
+				resp.NotCreated[cid] = setErr
+				continue
+			}
+			c.createdIDs[cid] = mailboxIDString(id)
+			resp.Created[cid] = map[string]any{
+				"id":            mailboxIDString(id),
+				"role":          nil,
+				"sortOrder":     10,
+				"totalEmails":   0,
+				"unreadEmails":  0,
+				"totalThreads":  0,
+				"unreadThreads": 0,
+				"myRights":      mailboxObject(byID[id], [2]int64{})["myRights"],
+				"isSubscribed":  byID[id].Subscribed,
+			}
+		}
+		if len(deferred) == len(pending) {
+			for _, cid := range deferred {
+				resp.NotCreated[cid] = setError("invalidProperties", "parent mailbox cannot be created", "parentId")
+			}
+			break
+		}
+		pending = deferred
+	}
+
+	for id, rawPatch := range args.Update {
+		resolved, _ := c.resolveCreationID(id)
+		mailboxID, ok := parseMailboxID(resolved)
+		mbox := byID[mailboxID]
+		if !ok || mbox == nil {
+			resp.NotUpdated[id] = setError("notFound", "mailbox not found")
+			continue
+		}
+		var patch mailboxPatch
+		if err := json.Unmarshal(rawPatch, &patch); err != nil {
+			resp.NotUpdated[id] = setError("invalidProperties", err.Error())
+			continue
+		}
+		if setErr := s.updateMailbox(c, mbox, &patch, byID); setErr != nil {
+			resp.NotUpdated[id] = setErr
+			continue
+		}
+		resp.Updated[id] = nil
+	}
+
+	for _, id := range args.Destroy {
+		resolved, _ := c.resolveCreationID(id)
+		mailboxID, ok := parseMailboxID(resolved)
+		mbox := byID[mailboxID]
+		if !ok || mbox == nil {
+			resp.NotDestroyed[id] = setError("notFound", "mailbox not found")
+			continue
+		}
+		if setErr := s.destroyMailbox(c, mbox, args.OnDestroyRemoveEmails, byID); setErr != nil {
+			resp.NotDestroyed[id] = setErr
+			continue
+		}
+		delete(byID, mailboxID)
+		resp.Destroyed = append(resp.Destroyed, id)
+	}
+
+	newState, err := s.rdb.GetJMAPStateWithRetry(c.ctx, c.accountID)
+	if err != nil {
+		return nil, err
+	}
+	resp.NewState = stateString(newState)
+	return resp, nil
+}
+
+// parentCreationRef returns the creation id referenced by a parentId, if any.
+func parentCreationRef(raw json.RawMessage) string {
+	var parentID *string
+	if json.Unmarshal(raw, &parentID) == nil && parentID != nil && strings.HasPrefix(*parentID, "#") {
+		return (*parentID)[1:]
+	}
+	return ""
+}
+
+// resolveParent resolves a parentId property to a mailbox. A nil result with a
+// nil error means the mailbox is top-level.
+func (c *call) resolveParent(raw json.RawMessage, byID map[int64]*db.JMAPMailbox) (*db.JMAPMailbox, *SetError) {
+	var parentID *string
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &parentID); err != nil {
+			return nil, setError("invalidProperties", "parentId must be a string or null", "parentId")
+		}
+	}
+	if parentID == nil {
+		return nil, nil
+	}
+	resolved, ok := c.resolveCreationID(*parentID)
+	id, valid := parseMailboxID(resolved)
+	if !ok || !valid || byID[id] == nil {
+		return nil, setError("invalidProperties", "parent mailbox not found", "parentId")
+	}
+	return byID[id], nil
+}
+
+// validateMailboxName checks a mailbox name as given by a client.
+func validateMailboxName(name string) *SetError {
+	if name == "" || len(name) > maxSizeMailboxName || strings.ContainsRune(name, consts.MailboxDelimiter) ||
+		strings.ContainsAny(name, "\t\r\n\x00") {
+		return setError("invalidProperties", "invalid mailbox name", "name")
+	}
+	return nil
+}
+
+// mailboxSetError converts a database error from a mailbox change into a SetError.
+func mailboxSetError(err error) *SetError {
+	switch {
+	case errors.Is(err, consts.ErrDBUniqueViolation), errors.Is(err, consts.ErrMailboxAlreadyExists):
+		return setError("alreadyExists", "a mailbox with this name already exists", "name")
+	case errors.Is(err, consts.ErrMailboxInvalidName):
+		return setError("invalidProperties", "invalid mailbox name", "name")
+	case errors.Is(err, consts.ErrMailboxNotFound):
+		return setError("notFound", "mailbox not found")
+	}
+	return setError("serverFail", err.Error())
+}
+
+func (s *Server) createMailbox(c *call, patch *mailboxPatch, byID map[int64]*db.JMAPMailbox) (int64, *SetError) {
+	if patch.Name == nil {
+		return 0, setError("invalidProperties", "name is required", "name")
+	}
+	if setErr := validateMailboxName(*patch.Name); setErr != nil {
+		return 0, setErr
+	}
+	if len(patch.Role) > 0 && string(patch.Role) != "null" {
+		return 0, setError("invalidProperties", "roles are assigned by the server", "role")
+	}
+	parent, setErr := c.resolveParent(patch.ParentID, byID)
+	if setErr != nil {
+		return 0, setErr
+	}
+
+	fullName := *patch.Name
+	var parentID *int64
+	if parent != nil {
+		fullName = parent.Name + string(consts.MailboxDelimiter) + *patch.Name
+		parentID = &parent.ID
+	}
+
+	if err := s.rdb.CreateMailboxWithRetry(c.ctx, c.accountID, fullName, parentID); err != nil {
+		return 0, mailboxSetError(err)
+	}
+	created, err := s.rdb.GetMailboxByNameWithRetry(c.ctx, c.accountID, fullName)
+	if err != nil {
+		return 0, mailboxSetError(err)
+	}
+	mbox := &db.JMAPMailbox{ID: created.ID, Name: fullName, Subscribed: created.Subscribed}
+	if parent != nil {
+		mbox.ParentID = parent.ID
+	}
+	if patch.IsSubscribed != nil && *patch.IsSubscribed != created.Subscribed {
+		if err := s.rdb.SetMailboxSubscribedWithRetry(c.ctx, created.ID, c.accountID, *patch.IsSubscribed); err != nil {
+			return 0, mailboxSetError(err)
+		}
+		mbox.Subscribed = *patch.IsSubscribed
+	}
+	byID[created.ID] = mbox
+	return created.ID, nil
+}
+
+func (s *Server) updateMailbox(c *call, mbox *db.JMAPMailbox, patch *mailboxPatch, byID map[int64]*db.JMAPMailbox) *SetError {
+	if len(patch.Role) > 0 && mailboxRoleJSON(mbox.Name) != string(patch.Role) {
+		return setError("invalidProperties", "roles are assigned by the server", "role")
+	}
+
+	newName := mailboxLeafName(mbox.Name)
+	if patch.Name != nil {
+		if setErr := validateMailboxName(*patch.Name); setErr != nil {
+			return setErr
+		}
+		newName = *patch.Name
+	}
+
+	parent := byID[mbox.ParentID]
+	if len(patch.ParentID) > 0 {
+		var setErr *SetError
+		if parent, setErr = c.resolveParent(patch.ParentID, byID); setErr != nil {
+			return setErr
+		}
+		// A mailbox cannot be moved below itself
+		for p := parent; p != nil; p = byID[p.ParentID] {
+			if p.ID == mbox.ID {
+				return setError("invalidProperties", "mailbox cannot be its own descendant", "parentId")
+			}
+		}
+	}
+
+	fullName := newName
+	var parentID *int64
+	if parent != nil {
+		fullName = parent.Name + string(consts.MailboxDelimiter) + newName
+		parentID = &parent.ID
+	}
+
+	if fullName != mbox.Name {
+		if mailboxRole(mbox.Name) == "inbox" {
+			return setError("forbidden", "the inbox cannot be renamed")
+		}
+		if err := s.rdb.RenameMailboxWithRetry(c.ctx, mbox.ID, c.accountID, fullName, parentID); err != nil {
+			return mailboxSetError(err)
+		}
+		// Children were renamed along with the mailbox
+		oldPrefix := mbox.Name + string(consts.MailboxDelimiter)
+		for _, other := range byID {
+			if strings.HasPrefix(other.Name, oldPrefix) {
+				other.Name = fullName + other.Name[len(mbox.Name):]
+			}
+		}
+		mbox.Name = fullName
+		if parent != nil {
+			mbox.ParentID = parent.ID
+		} else {
+			mbox.ParentID = 0
+		}
+	}
+
+	if patch.IsSubscribed != nil && *patch.IsSubscribed != mbox.Subscribed {
+		if err := s.rdb.SetMailboxSubscribedWithRetry(c.ctx, mbox.ID, c.accountID, *patch.IsSubscribed); err != nil {
+			return mailboxSetError(err)
+		}
+		mbox.Subscribed = *patch.IsSubscribed
+	}
+	return nil
+}
+
+// mailboxRoleJSON returns the JSON encoding of the role of a mailbox.
+func mailboxRoleJSON(fullName string) string {
+	encoded, _ := json.Marshal(mailboxRole(fullName))
+	return string(encoded)
+}
+
+func (s *Server) destroyMailbox(c *call, mbox *db.JMAPMailbox, removeEmails bool, byID map[int64]*db.JMAPMailbox) *SetError {
+	if mailboxRole(mbox.Name) == "inbox" {
+		return setError("forbidden", "the inbox cannot be destroyed")
+	}
+	for _, other := range byID {
+		if other.ParentID == mbox.ID {
+			return setError("mailboxHasChild", "mailbox has child mailboxes")
+		}
+	}
+	if mbox.TotalEmails > 0 && !removeEmails {
+		return setError("mailboxHasEmail", "mailbox is not empty")
+	}
+	if err := s.rdb.DeleteMailboxWithRetry(c.ctx, mbox.ID, c.accountID); err != nil {
+		return mailboxSetError(err)
+	}
+	return nil
+}
+
+func containsAny(list []string, values ...string) bool {
+	for _, item := range list {
+		for _, v := range values {
+			if item == v {
+				return true
+			}
+		}
+	}
+	return false
+}
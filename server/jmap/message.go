@@ -0,0 +1,622 @@
+package jmap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/helpers"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/server"
+
+	_ "github.com/emersion/go-message/charset"
+)
+
+// fetchMessage returns the raw message of an email. Messages not yet uploaded
+// are read from the local upload queue.
+func (s *Server) fetchMessage(ctx context.Context, accountID int64, contentHash, s3Domain, s3Localpart string) ([]byte, error) {
+	if s.cache != nil {
+		if data, err := s.cache.Get(contentHash); err == nil && len(data) > 0 {
+			return data, nil
+		}
+	}
+
+	if data, err := os.ReadFile(s.uploader.FilePath(contentHash, accountID)); err == nil && len(data) > 0 {
+		return data, nil
+	}
+
+	if s.s3 == nil {
+		return nil, fmt.Errorf("message %s is not available locally and no storage is configured", contentHash)
+	}
+	if s3Domain == "" || s3Localpart == "" {
+		return nil, fmt.Errorf("message %s is missing S3 key information", contentHash)
+	}
+	reader, err := s.s3.GetWithRetry(ctx, helpers.NewS3Key(s3Domain, s3Localpart, contentHash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch message %s from S3: %w", contentHash, err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message %s from S3: %w", contentHash, err)
+	}
+
+	if s.cache != nil {
+		if err := s.cache.Put(contentHash, data); err != nil {
+			logger.Debug("JMAP: Failed to cache message", "name", s.name, "content_hash", contentHash, "error", err)
+		}
+	}
+	return data, nil
+}
+
+// fetchEmailMessage returns the raw message of a database email.
+func (s *Server) fetchEmailMessage(ctx context.Context, accountID int64, email *db.JMAPEmail) ([]byte, error) {
+	return s.fetchMessage(ctx, accountID, email.ContentHash, email.S3Domain, email.S3Localpart)
+}
+
+// bodyPart is a parsed MIME part as described by the EmailBodyPart object
+// (RFC 8621 section 4.1.4).
+type bodyPart struct {
+	PartID      string // IMAP section number, empty for multiparts
+	Header      message.Header
+	Type        string
+	Params      map[string]string
+	Disposition string
+	Name        string
+	SubParts    []*bodyPart
+	Content     []byte // Decoded content of leaf parts
+}
+
+// parseBodyStructure parses a raw message into its part tree. Part ids are
+// IMAP section numbers, so a part can be found again from its blob id.
+func parseBodyStructure(raw []byte) (*bodyPart, error) {
+	entity, err := server.ParseMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	return parseEntity(entity, "", true)
+}
+
+func parseEntity(entity *message.Entity, section string, top bool) (*bodyPart, error) {
+	part := &bodyPart{Header: entity.Header}
+	part.Type, part.Params, _ = entity.Header.ContentType()
+	if part.Type == "" {
+		part.Type = "text/plain"
+	}
+	part.Type = strings.ToLower(part.Type)
+	if disposition, params, err := entity.Header.ContentDisposition(); err == nil {
+		part.Disposition = strings.ToLower(disposition)
+		part.Name = params["filename"]
+	}
+	if part.Name == "" {
+		part.Name = part.Params["name"]
+	}
+
+	if mr := entity.MultipartReader(); mr != nil {
+		for i := 1; ; i++ {
+			child, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+				return part, nil
+			}
+			childSection := strconv.Itoa(i)
+			if section != "" {
+				childSection = section + "." + childSection
+			}
+			sub, err := parseEntity(child, childSection, false)
+			if err != nil {
+				return nil, err
+			}
+			part.SubParts = append(part.SubParts, sub)
+		}
+		return part, nil
+	}
+
+	part.PartID = section
+	if top {
+		part.PartID = "1"
+	}
+	content, err := io.ReadAll(entity.Body)
+	if err != nil && len(content) == 0 {
+		logger.Debug("JMAP: Failed to read body part", "part", part.PartID, "error", err)
+	}
+	part.Content = content
+	return part, nil
+}
+
+// findPart returns the leaf part with the given part id.
+func (p *bodyPart) findPart(partID string) *bodyPart {
+	if p.PartID == partID && len(p.SubParts) == 0 {
+		return p
+	}
+	for _, sub := range p.SubParts {
+		if found := sub.findPart(partID); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func isMultipart(p *bodyPart) bool { return strings.HasPrefix(p.Type, "multipart/") }
+
+func isInlineMediaType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "image/") || strings.HasPrefix(mediaType, "audio/") ||
+		strings.HasPrefix(mediaType, "video/")
+}
+
+// bodyLists holds the textBody, htmlBody and attachments of an email.
+type bodyLists struct {
+	TextBody    []*bodyPart
+	HTMLBody    []*bodyPart
+	Attachments []*bodyPart
+}
+
+// classifyParts implements the algorithm of RFC 8621 section 4.1.4 that
+// splits a message into its text body, HTML body and attachments.
+func classifyParts(root *bodyPart) *bodyLists {
+	lists := &bodyLists{TextBody: []*bodyPart{}, HTMLBody: []*bodyPart{}, Attachments: []*bodyPart{}}
+	text, html := &lists.TextBody, &lists.HTMLBody
+	parseStructure([]*bodyPart{root}, "mixed", false, html, text, &lists.Attachments)
+	return lists
+}
+
+// parseStructure follows the reference pseudo-code; a nil htmlBody or
+// textBody corresponds to null.
+func parseStructure(parts []*bodyPart, multipartType string, inAlternative bool, htmlBody, textBody, attachments *[]*bodyPart) {
+	textLength, htmlLength := -1, -1
+	if textBody != nil {
+		textLength = len(*textBody)
+	}
+	if htmlBody != nil {
+		htmlLength = len(*htmlBody)
+	}
+
+	for i, part := range parts {
+		isInline := part.Disposition != "attachment" &&
+			(part.Type == "text/plain" || part.Type == "text/html" || isInlineMediaType(part.Type)) &&
+			(i == 0 || (multipartType != "related" && (isInlineMediaType(part.Type) || part.Name == "")))
+
+		switch {
+		case isMultipart(part):
+			subMultipartType := strings.TrimPrefix(part.Type, "multipart/")
+			parseStructure(part.SubParts, subMultipartType, inAlternative || subMultipartType == "alternative",
+				htmlBody, textBody, attachments)
+
+		case isInline:
+			if multipartType == "alternative" {
+				switch {
+				case part.Type == "text/plain" && textBody != nil:
+					*textBody = append(*textBody, part)
+				case part.Type == "text/html" && htmlBody != nil:
+					*htmlBody = append(*htmlBody, part)
+				default:
+					*attachments = append(*attachments, part)
+				}
+				continue
+			}
+			if inAlternative {
+				if part.Type == "text/plain" {
+					htmlBody = nil
+				}
+				if part.Type == "text/html" {
+					textBody = nil
+				}
+			}
+			if textBody != nil {
+				*textBody = append(*textBody, part)
+			}
+			if htmlBody != nil {
+				*htmlBody = append(*htmlBody, part)
+			}
+			if (textBody == nil || htmlBody == nil) && isInlineMediaType(part.Type) {
+				*attachments = append(*attachments, part)
+			}
+
+		default:
+			*attachments = append(*attachments, part)
+		}
+	}
+
+	if multipartType == "alternative" && textBody != nil && htmlBody != nil {
+		// Fill whichever alternative is missing with the other one
+		if textLength == len(*textBody) && htmlLength != len(*htmlBody) {
+			*textBody = append(*textBody, (*htmlBody)[htmlLength:]...)
+		}
+		if htmlLength == len(*htmlBody) && textLength != len(*textBody) {
+			*htmlBody = append(*htmlBody, (*textBody)[textLength:]...)
+		}
+	}
+}
+
+// defaultBodyProperties are returned for body parts when bodyProperties is omitted.
+var defaultBodyProperties = []string{"partId", "blobId", "size", "name", "type", "charset", "disposition", "cid", "language", "location"}
+
+// bodyPartObject builds the EmailBodyPart representation of a part.
+func bodyPartObject(p *bodyPart, contentHash string, properties []string) map[string]any {
+	if properties == nil {
+		properties = defaultBodyProperties
+	}
+	obj := make(map[string]any, len(properties))
+	for _, property := range properties {
+		switch property {
+		case "partId":
+			obj[property] = nullIfEmpty(p.PartID)
+		case "blobId":
+			if p.PartID != "" {
+				obj[property] = partBlobID(contentHash, p.PartID)
+			} else {
+				obj[property] = nil
+			}
+		case "size":
+			obj[property] = len(p.Content)
+		case "headers":
+			obj[property] = headerList(p.Header)
+		case "name":
+			obj[property] = nullIfEmpty(p.Name)
+		case "type":
+			obj[property] = p.Type
+		case "charset":
+			charset := p.Params["charset"]
+			if charset == "" && strings.HasPrefix(p.Type, "text/") {
+				charset = "us-ascii"
+			}
+			obj[property] = nullIfEmpty(strings.ToLower(charset))
+		case "disposition":
+			obj[property] = nullIfEmpty(p.Disposition)
+		case "cid":
+			cid := strings.TrimSpace(p.Header.Get("Content-Id"))
+			obj[property] = nullIfEmpty(strings.TrimSuffix(strings.TrimPrefix(cid, "<"), ">"))
+		case "language":
+			var languages []string
+			for _, lang := range strings.Split(p.Header.Get("Content-Language"), ",") {
+				if lang = strings.TrimSpace(lang); lang != "" {
+					languages = append(languages, lang)
+				}
+			}
+			if languages == nil {
+				obj[property] = nil
+			} else {
+				obj[property] = languages
+			}
+		case "location":
+			obj[property] = nullIfEmpty(strings.TrimSpace(p.Header.Get("Content-Location")))
+		case "subParts":
+			if isMultipart(p) {
+				subParts := make([]map[string]any, 0, len(p.SubParts))
+				for _, sub := range p.SubParts {
+					subParts = append(subParts, bodyPartObject(sub, contentHash, properties))
+				}
+				obj[property] = subParts
+			} else {
+				obj[property] = nil
+			}
+		default:
+			if strings.HasPrefix(property, "header:") {
+				if value, err := headerProperty(p.Header, property); err == nil {
+					obj[property] = value
+				}
+			}
+		}
+	}
+	return obj
+}
+
+// partBlobID returns the blob id of a part of a message.
+func partBlobID(contentHash, partID string) string {
+	return messageBlobID(contentHash) + "." + partID
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// bodyValue builds the EmailBodyValue of a text part, truncated to maxBytes
+// (0 = unlimited) on a UTF-8 boundary.
+func bodyValue(p *bodyPart, maxBytes int) map[string]any {
+	value := p.Content
+	truncated := false
+	if maxBytes > 0 && len(value) > maxBytes {
+		cut := maxBytes
+		for cut > 0 && !utf8.RuneStart(value[cut]) {
+			cut--
+		}
+		value = value[:cut]
+		truncated = true
+	}
+	return map[string]any{
+		"value":             string(value),
+		"isEncodingProblem": !utf8.Valid(value),
+		"isTruncated":       truncated,
+	}
+}
+
+// headerList returns the EmailHeader list of a header, in message order.
+func headerList(h message.Header) []map[string]string {
+	headers := make([]map[string]string, 0, h.Len())
+	fields := h.Fields()
+	for fields.Next() {
+		headers = append(headers, map[string]string{"name": fields.Key(), "value": rawHeaderValue(fields)})
+	}
+	return headers
+}
+
+// rawHeaderValue returns the raw value of a header field: everything after
+// the colon, without the trailing CRLF.
+func rawHeaderValue(field message.HeaderFields) string {
+	raw, err := field.Raw()
+	if err != nil {
+		return " " + field.Value()
+	}
+	_, value, found := bytes.Cut(raw, []byte(":"))
+	if !found {
+		return " " + field.Value()
+	}
+	return strings.TrimRight(string(value), "\r\n")
+}
+
+var errInvalidHeaderProperty = errors.New("invalid header property")
+
+// parseHeaderPropertyName parses a "header:{name}[:as{Form}][:all]" property
+// (RFC 8621 section 4.1.2).
+func parseHeaderPropertyName(property string) (name, form string, all bool, err error) {
+	parts := strings.Split(property, ":")
+	if len(parts) < 2 || len(parts) > 4 || parts[0] != "header" || parts[1] == "" {
+		return "", "", false, errInvalidHeaderProperty
+	}
+	name = parts[1]
+	form = "asRaw"
+	for _, modifier := range parts[2:] {
+		switch {
+		case modifier == "all" && !all:
+			all = true
+		case headerForms[modifier] && form == "asRaw" && !all:
+			form = modifier
+		default:
+			return "", "", false, errInvalidHeaderProperty
+		}
+	}
+	return name, form, all, nil
+}
+
+var headerForms = map[string]bool{
+	"asRaw": true, "asText": true, "asAddresses": true, "asMessageIds": true, "asDate": true, "asURLs": true,
+}
+
+// headerProperty evaluates a header property against a header.
+func headerProperty(h message.Header, property string) (any, error) {
+	name, form, all, err := parseHeaderPropertyName(property)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []any
+	fields := h.FieldsByKey(name)
+	for fields.Next() {
+		value, err := parseHeaderForm(fields, form)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	if all {
+		if values == nil {
+			return []any{}, nil
+		}
+		return values, nil
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return values[len(values)-1], nil
+}
+
+func parseHeaderForm(field message.HeaderFields, form string) (any, error) {
+	raw := rawHeaderValue(field)
+	switch form {
+	case "asRaw":
+		return raw, nil
+	case "asText":
+		text, err := field.Text()
+		if err != nil {
+			text = field.Value()
+		}
+		return strings.TrimSpace(text), nil
+	case "asAddresses":
+		addresses, err := mail.ParseAddressList(strings.TrimSpace(field.Value()))
+		if err != nil {
+			return nil, nil
+		}
+		return emailAddresses(addresses), nil
+	case "asMessageIds":
+		h := mail.Header{}
+		h.Set("X-Ids", strings.TrimSpace(field.Value()))
+		ids, err := h.MsgIDList("X-Ids")
+		if err != nil || len(ids) == 0 {
+			return nil, nil
+		}
+		return ids, nil
+	case "asDate":
+		h := mail.Header{}
+		h.Set("Date", strings.TrimSpace(field.Value()))
+		date, err := h.Date()
+		if err != nil {
+			return nil, nil
+		}
+		return date.UTC(), nil
+	case "asURLs":
+		var urls []string
+		for _, item := range strings.Split(field.Value(), ",") {
+			item = strings.TrimSpace(item)
+			if strings.HasPrefix(item, "<") && strings.HasSuffix(item, ">") {
+				urls = append(urls, item[1:len(item)-1])
+			}
+		}
+		if urls == nil {
+			return nil, nil
+		}
+		return urls, nil
+	}
+	return nil, errInvalidHeaderProperty
+}
+
+// emailAddress is an EmailAddress object (RFC 8621 section 4.1.2.3)
+type emailAddress struct {
+	Name  *string `json:"name"`
+	Email string  `json:"email"`
+}
+
+func emailAddresses(addresses []*mail.Address) []emailAddress {
+	result := make([]emailAddress, 0, len(addresses))
+	for _, addr := range addresses {
+		entry := emailAddress{Email: addr.Address}
+		if addr.Name != "" {
+			name := addr.Name
+			entry.Name = &name
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// bodyStructureSafe extracts the IMAP body structure of a message, falling
+// back to a plain text structure for messages that cannot be parsed.
+func bodyStructureSafe(data []byte) (bs imap.BodyStructure) {
+	fallback := &imap.BodyStructureSinglePart{
+		Type:     "text",
+		Subtype:  "plain",
+		Params:   map[string]string{"charset": "utf-8"},
+		Extended: &imap.BodyStructureSinglePartExt{},
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			bs = fallback
+		}
+	}()
+
+	bs = imapserver.ExtractBodyStructure(bytes.NewReader(data))
+	if bs == nil || helpers.ValidateBodyStructure(&bs) != nil {
+		return fallback
+	}
+	return bs
+}
+
+// storeMessage stores a new message in the given mailboxes the same way as
+// an IMAP APPEND, and returns its content hash.
+func (s *Server) storeMessage(c *call, raw []byte, mailboxIDs []int64, mailboxNames map[int64]string, flags []imap.Flag, receivedAt time.Time) (string, *SetError) {
+	size := int64(len(raw))
+	if err := s.rdb.CheckQuotaWithRetry(c.ctx, c.accountID, size*int64(len(mailboxIDs)), int64(len(mailboxIDs))); err != nil {
+		if errors.Is(err, consts.ErrQuotaExceeded) {
+			return "", setError("overQuota", "mailbox quota exceeded")
+		}
+		return "", setError("serverFail", err.Error())
+	}
+
+	address, err := s.rdb.GetPrimaryEmailForAccountWithRetry(c.ctx, c.accountID)
+	if err != nil {
+		return "", setError("serverFail", "failed to look up primary address")
+	}
+
+	var rawHeaders string
+	if end := bytes.Index(raw, []byte("\r\n\r\n")); end != -1 {
+		rawHeaders = string(raw[:end])
+	}
+
+	var subject, messageID, plaintextBody string
+	var sentDate time.Time
+	var inReplyTo, references []string
+	var recipients []helpers.Recipient
+	if entity, err := server.ParseMessage(bytes.NewReader(raw)); err == nil {
+		mailHeader := mail.Header{Header: entity.Header}
+		subject, _ = mailHeader.Subject()
+		messageID, _ = mailHeader.MessageID()
+		sentDate, _ = mailHeader.Date()
+		inReplyTo, _ = mailHeader.MsgIDList("In-Reply-To")
+		if len(inReplyTo) == 0 {
+			inReplyTo = nil
+		}
+		references, _ = mailHeader.MsgIDList("References")
+		recipients = helpers.ExtractRecipients(entity.Header)
+		if body, err := helpers.ExtractPlaintextBody(entity); err == nil && body != nil {
+			plaintextBody = *body
+		}
+	}
+	if sentDate.IsZero() {
+		sentDate = receivedAt
+	}
+
+	contentHash := helpers.HashContent(raw)
+	bodyStructure := bodyStructureSafe(raw)
+
+	// Don't overwrite a file the uploader may be reading
+	if _, err := os.Stat(s.uploader.FilePath(contentHash, c.accountID)); os.IsNotExist(err) {
+		if _, err := s.uploader.StoreLocally(contentHash, c.accountID, raw); err != nil {
+			return "", setError("serverFail", "failed to store message")
+		}
+	} else if err != nil {
+		return "", setError("serverFail", "failed to store message")
+	}
+
+	_, _, err = s.rdb.InsertMessageWithRetry(c.ctx,
+		&db.InsertMessageOptions{
+			AccountID:     c.accountID,
+			MailboxID:     mailboxIDs[0],
+			S3Domain:      address.Domain(),
+			S3Localpart:   address.LocalPart(),
+			MailboxName:   mailboxNames[mailboxIDs[0]],
+			ContentHash:   contentHash,
+			MessageID:     messageID,
+			Flags:         helpers.SanitizeFlags(flags),
+			InternalDate:  receivedAt,
+			Size:          size,
+			Subject:       subject,
+			PlaintextBody: plaintextBody,
+			SentDate:      sentDate,
+			InReplyTo:     inReplyTo,
+			References:    references,
+			BodyStructure: &bodyStructure,
+			Recipients:    recipients,
+			RawHeaders:    rawHeaders,
+			FTSRetention:  s.ftsRetention,
+		},
+		db.PendingUpload{
+			InstanceID:  s.hostname,
+			ContentHash: contentHash,
+			Size:        size,
+			AccountID:   c.accountID,
+		})
+	if err != nil {
+		if errors.Is(err, consts.ErrMessageExists) || errors.Is(err, consts.ErrDBUniqueViolation) {
+			return "", &SetError{Type: "alreadyExists", Description: "the email already exists", ExistingID: emailIDString(contentHash)}
+		}
+		logger.Warn("JMAP: Failed to insert message", "name", s.name, "account_id", c.accountID, "error", err)
+		return "", setError("serverFail", "failed to store message")
+	}
+	s.uploader.NotifyUploadQueued()
+
+	if len(mailboxIDs) > 1 {
+		if err := s.rdb.UpdateJMAPEmailWithRetry(c.ctx, c.accountID, contentHash, nil, mailboxIDs); err != nil {
+			logger.Warn("JMAP: Failed to copy new email to its mailboxes", "name", s.name, "account_id", c.accountID, "error", err)
+			return "", setError("serverFail", "failed to add email to all mailboxes")
+		}
+	}
+	return contentHash, nil
+}
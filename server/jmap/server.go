@@ -0,0 +1,458 @@
+// Package jmap implements a JMAP server (RFC 8620 Core, RFC 8621 Mail) on
+// top of the same database and storage as the IMAP server.
+package jmap
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/migadu/sora/cache"
+	"github.com/migadu/sora/config"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/lookupcache"
+	"github.com/migadu/sora/pkg/resilient"
+	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/uploader"
+	"github.com/migadu/sora/storage"
+)
+
+// Limits holds the limits advertised in the urn:ietf:params:jmap:core capability.
+type Limits struct {
+	MaxSizeUpload         int64
+	MaxConcurrentUpload   int
+	MaxSizeRequest        int64
+	MaxConcurrentRequests int
+	MaxCallsInRequest     int
+	MaxObjectsInGet       int
+	MaxObjectsInSet       int
+}
+
+// DefaultLimits returns the limits used for options left at zero.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxSizeUpload:         50 * 1024 * 1024,
+		MaxConcurrentUpload:   4,
+		MaxSizeRequest:        10 * 1024 * 1024,
+		MaxConcurrentRequests: 4,
+		MaxCallsInRequest:     16,
+		MaxObjectsInGet:       500,
+		MaxObjectsInSet:       500,
+	}
+}
+
+// Server represents the JMAP HTTP server
+type Server struct {
+	name                       string
+	addr                       string
+	hostname                   string
+	baseURL                    string
+	jwtSecret                  string
+	allowedOrigins             []string
+	allowedHosts               []string
+	limits                     Limits
+	pollInterval               time.Duration
+	ftsRetention               time.Duration
+	rdb                        *resilient.ResilientDatabase
+	s3                         *resilient.ResilientS3Storage
+	cache                      *cache.Cache
+	uploader                   *uploader.UploadWorker
+	authCache                  *lookupcache.LookupCache
+	positiveRevalidationWindow time.Duration
+	authLimiter                *server.AuthRateLimiter
+	server                     *http.Server
+	tls                        bool
+	tlsConfig                  *tls.Config // TLS config from manager (takes precedence) or nil
+	tlsCertFile                string
+	tlsKeyFile                 string
+	tlsVerify                  bool
+}
+
+// ServerOptions holds configuration options for the JMAP server
+type ServerOptions struct {
+	Name                    string
+	Addr                    string
+	Hostname                string
+	BaseURL                 string // Public URL of the server; derived from each request when empty
+	JWTSecret               string // Accepts bearer tokens issued by the User API when set
+	AllowedOrigins          []string
+	AllowedHosts            []string
+	Limits                  Limits
+	EventSourcePollInterval time.Duration
+	FTSRetention            time.Duration
+	Storage                 storage.BlobStore
+	Cache                   *cache.Cache
+	Uploader                *uploader.UploadWorker
+	AuthRateLimit           server.AuthRateLimiterConfig
+	LookupCache             *config.LookupCacheConfig // Authentication cache configuration
+	TLS                     bool
+	TLSConfig               *tls.Config // TLS config from manager (takes precedence over cert files)
+	TLSCertFile             string
+	TLSKeyFile              string
+	TLSVerify               bool
+}
+
+// New creates a new JMAP server
+func New(rdb *resilient.ResilientDatabase, options ServerOptions) (*Server, error) {
+	if options.Uploader == nil {
+		return nil, fmt.Errorf("uploader is required for JMAP server")
+	}
+
+	// Validate TLS configuration
+	if options.TLS && options.TLSConfig == nil {
+		if options.TLSCertFile == "" || options.TLSKeyFile == "" {
+			return nil, fmt.Errorf("TLS certificate and key files are required when TLS is enabled (or use TLS manager)")
+		}
+	}
+
+	limits := options.Limits
+	defaults := DefaultLimits()
+	if limits.MaxSizeUpload <= 0 {
+		limits.MaxSizeUpload = defaults.MaxSizeUpload
+	}
+	if limits.MaxConcurrentUpload <= 0 {
+		limits.MaxConcurrentUpload = defaults.MaxConcurrentUpload
+	}
+	if limits.MaxSizeRequest <= 0 {
+		limits.MaxSizeRequest = defaults.MaxSizeRequest
+	}
+	if limits.MaxConcurrentRequests <= 0 {
+		limits.MaxConcurrentRequests = defaults.MaxConcurrentRequests
+	}
+	if limits.MaxCallsInRequest <= 0 {
+		limits.MaxCallsInRequest = defaults.MaxCallsInRequest
+	}
+	if limits.MaxObjectsInGet <= 0 {
+		limits.MaxObjectsInGet = defaults.MaxObjectsInGet
+	}
+	if limits.MaxObjectsInSet <= 0 {
+		limits.MaxObjectsInSet = defaults.MaxObjectsInSet
+	}
+
+	var s3 *resilient.ResilientS3Storage
+	if options.Storage != nil {
+		s3 = resilient.NewResilientS3Storage(options.Storage)
+	}
+
+	pollInterval := options.EventSourcePollInterval
+	if pollInterval <= 0 {
+		pollInterval = 5 * time.Second
+	}
+
+	// Create auth rate limiter
+	authLimiter := server.NewAuthRateLimiter("jmap", options.Name, options.Hostname, options.AuthRateLimit)
+	server.RegisterRateLimiter("jmap", options.Name, authLimiter)
+
+	// Initialize authentication cache if configured
+	var authCache *lookupcache.LookupCache
+	var positiveRevalidationWindow time.Duration
+	if options.LookupCache != nil && options.LookupCache.Enabled {
+		lookupCacheConfig := options.LookupCache
+
+		positiveTTL, err := time.ParseDuration(lookupCacheConfig.PositiveTTL)
+		if err != nil || lookupCacheConfig.PositiveTTL == "" {
+			logger.Info("JMAP: Using default positive TTL (5m)", "name", options.Name)
+			positiveTTL = 5 * time.Minute
+		}
+
+		negativeTTL, err := time.ParseDuration(lookupCacheConfig.NegativeTTL)
+		if err != nil || lookupCacheConfig.NegativeTTL == "" {
+			logger.Info("JMAP: Using default negative TTL (1m)", "name", options.Name)
+			negativeTTL = 1 * time.Minute
+		}
+
+		cleanupInterval, err := time.ParseDuration(lookupCacheConfig.CleanupInterval)
+		if err != nil || lookupCacheConfig.CleanupInterval == "" {
+			logger.Info("JMAP: Using default cleanup interval (5m)", "name", options.Name)
+			cleanupInterval = 5 * time.Minute
+		}
+
+		maxSize := lookupCacheConfig.MaxSize
+		if maxSize == 0 {
+			maxSize = 10000
+		}
+
+		positiveRevalidationWindow, err = lookupCacheConfig.GetPositiveRevalidationWindow()
+		if err != nil {
+			logger.Info("JMAP: Invalid positive revalidation window in auth cache config, using default (30s)", "name", options.Name, "error", err)
+			positiveRevalidationWindow = 30 * time.Second
+		}
+
+		authCache = lookupcache.New(positiveTTL, negativeTTL, maxSize, cleanupInterval, positiveRevalidationWindow)
+		logger.Info("JMAP: Lookup cache enabled", "name", options.Name, "positive_ttl", positiveTTL, "negative_ttl", negativeTTL, "max_size", maxSize, "positive_revalidation_window", positiveRevalidationWindow)
+	}
+
+	return &Server{
+		name:                       options.Name,
+		addr:                       options.Addr,
+		hostname:                   options.Hostname,
+		baseURL:                    strings.TrimSuffix(options.BaseURL, "/"),
+		jwtSecret:                  options.JWTSecret,
+		allowedOrigins:             options.AllowedOrigins,
+		allowedHosts:               options.AllowedHosts,
+		limits:                     limits,
+		pollInterval:               pollInterval,
+		ftsRetention:               options.FTSRetention,
+		rdb:                        rdb,
+		s3:                         s3,
+		cache:                      options.Cache,
+		uploader:                   options.Uploader,
+		authCache:                  authCache,
+		positiveRevalidationWindow: positiveRevalidationWindow,
+		authLimiter:                authLimiter,
+		tls:                        options.TLS,
+		tlsConfig:                  options.TLSConfig,
+		tlsCertFile:                options.TLSCertFile,
+		tlsKeyFile:                 options.TLSKeyFile,
+		tlsVerify:                  options.TLSVerify,
+	}, nil
+}
+
+// ReloadConfig updates runtime-configurable settings from new config.
+func (s *Server) ReloadConfig(cfg config.ServerConfig) error {
+	var reloaded []string
+
+	if len(cfg.AllowedOrigins) > 0 {
+		s.allowedOrigins = cfg.AllowedOrigins
+		reloaded = append(reloaded, "allowed_origins")
+	}
+	if len(cfg.AllowedHosts) > 0 {
+		s.allowedHosts = cfg.AllowedHosts
+		reloaded = append(reloaded, "allowed_hosts")
+	}
+
+	if len(reloaded) > 0 {
+		logger.Info("JMAP config reloaded", "name", s.name, "updated", reloaded)
+	}
+	return nil
+}
+
+// Start creates the JMAP server and starts serving in the background
+func Start(ctx context.Context, rdb *resilient.ResilientDatabase, options ServerOptions, errChan chan error) *Server {
+	srv, err := New(rdb, options)
+	if err != nil {
+		errChan <- fmt.Errorf("failed to create JMAP server: %w", err)
+		return nil
+	}
+
+	protocol := "HTTP"
+	if options.TLS {
+		protocol = "HTTPS"
+	}
+	serverName := options.Name
+	if serverName == "" {
+		serverName = "default"
+	}
+	logger.Info("JMAP: Starting server", "name", serverName, "protocol", protocol, "addr", options.Addr)
+	go func() {
+		if err := srv.start(ctx); err != nil && err != http.ErrServerClosed && ctx.Err() == nil {
+			errChan <- fmt.Errorf("JMAP server failed: %w", err)
+		}
+	}()
+	return srv
+}
+
+// start initializes and starts the HTTP server
+func (s *Server) start(ctx context.Context) error {
+	s.server = &http.Server{
+		Addr:        s.addr,
+		Handler:     s.SetupRoutes(),
+		ReadTimeout: 30 * time.Second,
+		// No WriteTimeout: EventSource responses stay open indefinitely
+		IdleTimeout: 120 * time.Second,
+	}
+
+	// Graceful shutdown
+	go func() {
+		<-ctx.Done()
+		logger.Info("JMAP: Shutting down server...", "name", s.name)
+		server.UnregisterRateLimiter("jmap", s.name)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		if err := s.server.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("JMAP: Error shutting down server", "name", s.name, "error", err)
+		}
+	}()
+
+	if s.tls {
+		var tlsConfig *tls.Config
+		if s.tlsConfig != nil {
+			tlsConfig = s.tlsConfig.Clone()
+		} else {
+			tlsConfig = &tls.Config{
+				MinVersion:    tls.VersionTLS12,
+				Renegotiation: tls.RenegotiateNever,
+			}
+		}
+
+		if s.tlsVerify {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			tlsConfig.ClientAuth = tls.NoClientCert
+		}
+		s.server.TLSConfig = tlsConfig
+
+		if s.tlsConfig != nil {
+			return s.server.ListenAndServeTLS("", "")
+		}
+		return s.server.ListenAndServeTLS(s.tlsCertFile, s.tlsKeyFile)
+	}
+	return s.server.ListenAndServe()
+}
+
+// SetupRoutes configures all HTTP routes and middleware
+func (s *Server) SetupRoutes() http.Handler {
+	mux := http.NewServeMux()
+
+	// Session resource (RFC 8620 section 2.2), discoverable via .well-known (section 2.2.1)
+	mux.Handle("/.well-known/jmap", s.authMiddleware(http.HandlerFunc(s.handleSession)))
+	mux.Handle("/jmap/session", s.authMiddleware(http.HandlerFunc(s.handleSession)))
+
+	mux.Handle("/jmap/", s.authMiddleware(http.HandlerFunc(s.handleAPI)))
+	mux.Handle("/jmap/upload/", s.authMiddleware(http.HandlerFunc(s.handleUpload)))
+	mux.Handle("/jmap/download/", s.authMiddleware(http.HandlerFunc(s.handleDownload)))
+	mux.Handle("/jmap/eventsource/", s.authMiddleware(http.HandlerFunc(s.handleEventSource)))
+
+	// Wrap with middleware (in reverse order - last applied is outermost)
+	handler := s.loggingMiddleware(mux)
+	handler = s.corsMiddleware(handler)
+	handler = s.allowedHostsMiddleware(handler)
+
+	return handler
+}
+
+// Middleware functions
+
+func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		logger.Debug("JMAP: request", "name", s.name, "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+		next.ServeHTTP(w, r)
+		logger.Debug("JMAP: request completed", "name", s.name, "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+	})
+}
+
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+
+		if origin != "" && len(s.allowedOrigins) > 0 {
+			allowed := false
+			for _, allowedOrigin := range s.allowedOrigins {
+				if allowedOrigin == "*" || allowedOrigin == origin {
+					allowed = true
+					break
+				}
+			}
+
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Last-Event-ID")
+				w.Header().Set("Access-Control-Max-Age", "3600")
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) allowedHostsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(s.allowedHosts) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !isIPAllowed(getClientIP(r), s.allowedHosts) {
+			s.writeProblem(w, http.StatusForbidden, "about:blank", "Host not allowed")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Utility functions
+
+func getClientIP(r *http.Request) string {
+	// Try X-Forwarded-For header first (for proxies)
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		ips := strings.Split(xff, ",")
+		return strings.TrimSpace(ips[0])
+	}
+
+	// Try X-Real-IP header
+	if xri := r.Header.Get("X-Real-IP"); xri != "" {
+		return xri
+	}
+
+	// Fall back to RemoteAddr
+	if idx := strings.LastIndex(r.RemoteAddr, ":"); idx != -1 {
+		return r.RemoteAddr[:idx]
+	}
+	return r.RemoteAddr
+}
+
+func isIPAllowed(clientIP string, allowedHosts []string) bool {
+	for _, allowedHost := range allowedHosts {
+		if allowedHost == clientIP {
+			return true
+		}
+	}
+	return false
+}
+
+// publicBaseURL returns the URL clients use to reach this server.
+func (s *Server) publicBaseURL(r *http.Request) string {
+	if s.baseURL != "" {
+		return s.baseURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		logger.Warn("JMAP: Error encoding JSON response", "name", s.name, "error", err)
+	}
+}
+
+// writeProblem writes a request-level error as an RFC 7807 problem details object
+// (RFC 8620 section 3.6.1).
+func (s *Server) writeProblem(w http.ResponseWriter, status int, problemType, detail string, extra ...map[string]any) {
+	problem := map[string]any{
+		"type":   problemType,
+		"status": status,
+		"detail": detail,
+	}
+	for _, fields := range extra {
+		for k, v := range fields {
+			problem[k] = v
+		}
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		logger.Warn("JMAP: Error encoding problem response", "name", s.name, "error", err)
+	}
+}
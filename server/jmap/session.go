@@ -0,0 +1,143 @@
+package jmap
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/helpers"
+)
+
+// Capability URIs (RFC 8620 section 2, RFC 8621 section 1.3)
+const (
+	capabilityCore = "urn:ietf:params:jmap:core"
+	capabilityMail = "urn:ietf:params:jmap:mail"
+)
+
+// maxSizeMailboxName is the maximum length in octets of a mailbox name.
+const maxSizeMailboxName = 255
+
+// Object ids are prefixed with a letter per type so that an id of one type is
+// never mistaken for another (RFC 8620 section 1.2).
+
+func accountIDString(accountID int64) string  { return "A" + strconv.FormatInt(accountID, 10) }
+func mailboxIDString(mailboxID int64) string  { return "M" + strconv.FormatInt(mailboxID, 10) }
+func emailIDString(contentHash string) string { return "E" + contentHash }
+func threadIDString(threadID string) string   { return "T" + threadID }
+func messageBlobID(contentHash string) string { return "B" + contentHash }
+func uploadBlobID(contentHash string) string  { return "U" + contentHash }
+func stateString(modSeq int64) string         { return strconv.FormatInt(modSeq, 10) }
+
+func parseNumericID(prefix byte, id string) (int64, bool) {
+	if len(id) < 2 || id[0] != prefix {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(id[1:], 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+func parseMailboxID(id string) (int64, bool) { return parseNumericID('M', id) }
+
+// parseHashID parses an id made of a one letter prefix and a hex hash.
+func parseHashID(prefix byte, id string) (string, bool) {
+	if len(id) < 2 || id[0] != prefix {
+		return "", false
+	}
+	hash := id[1:]
+	if len(hash) > 64 {
+		return "", false
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return "", false
+		}
+	}
+	return hash, true
+}
+
+func parseEmailID(id string) (string, bool)  { return parseHashID('E', id) }
+func parseThreadID(id string) (string, bool) { return parseHashID('T', id) }
+
+func parseState(state string) (int64, bool) {
+	n, err := strconv.ParseInt(state, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// handleSession serves the JMAP Session resource (RFC 8620 section 2)
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	email, accountID := getAuthFromContext(r.Context())
+	accountKey := accountIDString(accountID)
+	base := s.publicBaseURL(r)
+
+	sortOptions := make([]string, 0, 6)
+	for _, property := range []string{"receivedAt", "sentAt", "size", "subject", "from", "to"} {
+		if db.IsJMAPEmailSortSupported(property) {
+			sortOptions = append(sortOptions, property)
+		}
+	}
+
+	session := map[string]any{
+		"capabilities": map[string]any{
+			capabilityCore: map[string]any{
+				"maxSizeUpload":         s.limits.MaxSizeUpload,
+				"maxConcurrentUpload":   s.limits.MaxConcurrentUpload,
+				"maxSizeRequest":        s.limits.MaxSizeRequest,
+				"maxConcurrentRequests": s.limits.MaxConcurrentRequests,
+				"maxCallsInRequest":     s.limits.MaxCallsInRequest,
+				"maxObjectsInGet":       s.limits.MaxObjectsInGet,
+				"maxObjectsInSet":       s.limits.MaxObjectsInSet,
+				"collationAlgorithms":   []string{"i;ascii-casemap"},
+			},
+			capabilityMail: map[string]any{},
+		},
+		"accounts": map[string]any{
+			accountKey: map[string]any{
+				"name":       email,
+				"isPersonal": true,
+				"isReadOnly": false,
+				"accountCapabilities": map[string]any{
+					capabilityCore: map[string]any{},
+					capabilityMail: map[string]any{
+						"maxMailboxesPerEmail":       nil,
+						"maxMailboxDepth":            nil,
+						"maxSizeMailboxName":         maxSizeMailboxName,
+						"maxSizeAttachmentsPerEmail": s.limits.MaxSizeUpload,
+						"emailQuerySortOptions":      sortOptions,
+						"mayCreateTopLevelMailbox":   true,
+					},
+				},
+			},
+		},
+		"primaryAccounts": map[string]string{
+			capabilityCore: accountKey,
+			capabilityMail: accountKey,
+		},
+		"username":       email,
+		"apiUrl":         base + "/jmap/",
+		"downloadUrl":    base + "/jmap/download/{accountId}/{blobId}/{name}?accept={type}",
+		"uploadUrl":      base + "/jmap/upload/{accountId}/",
+		"eventSourceUrl": base + "/jmap/eventsource/?types={types}&closeafter={closeafter}&ping={ping}",
+		"state":          sessionState(email, accountID),
+	}
+
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	s.writeJSON(w, http.StatusOK, session)
+}
+
+// sessionState identifies the contents of the session resource. It only
+// changes when the authenticated user does.
+func sessionState(email string, accountID int64) string {
+	return helpers.HashContent([]byte(strings.ToLower(email) + ":" + strconv.FormatInt(accountID, 10)))[:16]
+}
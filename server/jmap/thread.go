@@ -0,0 +1,55 @@
+package jmap
+
+import "encoding/json"
+
+// Thread/get (RFC 8621 section 3.1)
+func (s *Server) threadGet(c *call, rawArgs json.RawMessage) (any, error) {
+	var args getArgs
+	if err := c.decodeArgs(rawArgs, &args, &args.AccountID); err != nil {
+		return nil, err
+	}
+	if args.IDs == nil {
+		return nil, methodError("requestTooLarge", "ids must be given")
+	}
+	if len(*args.IDs) > s.limits.MaxObjectsInGet {
+		return nil, methodError("requestTooLarge", "too many ids (max %d)", s.limits.MaxObjectsInGet)
+	}
+
+	state, err := s.rdb.GetJMAPStateWithRetry(c.ctx, c.accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var threadIDs []string
+	for _, id := range *args.IDs {
+		if threadID, ok := parseThreadID(id); ok {
+			threadIDs = append(threadIDs, threadID)
+		}
+	}
+	threads, err := s.rdb.GetJMAPThreadsWithRetry(c.ctx, c.accountID, threadIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]map[string]any, 0, len(threads))
+	notFound := make([]string, 0)
+	for _, id := range *args.IDs {
+		threadID, _ := parseThreadID(id)
+		hashes, ok := threads[threadID]
+		if !ok {
+			notFound = append(notFound, id)
+			continue
+		}
+		list = append(list, filterProperties(map[string]any{
+			"id":       id,
+			"emailIds": emailIDStrings(hashes),
+		}, args.Properties))
+	}
+
+	return map[string]any{
+		"accountId": args.AccountID,
+		"state":     stateString(state),
+		"list":      list,
+		"notFound":  notFound,
+	}, nil
+}
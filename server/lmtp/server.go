@@ -111,7 +111,7 @@ type LMTPServerBackend struct {
 	name           string
 	hostname       string
 	rdb            *resilient.ResilientDatabase
-	s3             *storage.S3Storage
+	s3             storage.BlobStore
 	uploader       *uploader.UploadWorker
 	server         *smtp.Server
 	appCtx         context.Context
@@ -138,6 +138,8 @@ type LMTPServerBackend struct {
 	// Sieve script caching
 	sieveCache           *SieveScriptCache
 	defaultSieveExecutor sieveengine.Executor
+	globalSieve          *delivery.GlobalSieveScripts
+	sieveFilterHeaders   *sieveengine.FilterHeaders
 
 	// PROXY protocol support
 	proxyReader *server.ProxyProtocolReader
@@ -166,12 +168,14 @@ type LMTPServerOptions struct {
 	ProxyProtocolTrustedProxies []string // CIDR blocks for PROXY protocol validation (defaults to trusted_networks if empty)
 	TrustedNetworks             []string // Global trusted networks for parameter forwarding
 	FTSRetention                time.Duration
-	MaxMessageSize              int64    // Maximum size for incoming messages in bytes
-	SieveExtensions             []string // Sieve extensions to enable (nil/empty = all default extensions)
-	InsecureAuth                bool     // Allow PLAIN auth over non-TLS connections (default: true for LMTP behind trusted network)
+	MaxMessageSize              int64                      // Maximum size for incoming messages in bytes
+	SieveExtensions             []string                   // Sieve extensions to enable (nil/empty = all default extensions)
+	GlobalSieveExtensions       []string                   // Sieve extensions of global scripts (nil/empty = all but vacation)
+	SieveFilterHeaders          *sieveengine.FilterHeaders // Spam and virus headers of spamtest and virustest (nil = defaults)
+	InsecureAuth                bool                       // Allow PLAIN auth over non-TLS connections (default: true for LMTP behind trusted network)
 }
 
-func New(appCtx context.Context, name, hostname, addr string, s3 *storage.S3Storage, rdb *resilient.ResilientDatabase, uploadWorker *uploader.UploadWorker, options LMTPServerOptions) (*LMTPServerBackend, error) {
+func New(appCtx context.Context, name, hostname, addr string, s3 storage.BlobStore, rdb *resilient.ResilientDatabase, uploadWorker *uploader.UploadWorker, options LMTPServerOptions) (*LMTPServerBackend, error) {
 	// Initialize PROXY protocol reader if enabled
 	var proxyReader *server.ProxyProtocolReader
 	if options.ProxyProtocol {
@@ -243,6 +247,12 @@ func New(appCtx context.Context, name, hostname, addr string, s3 *storage.S3Stor
 	backend.defaultSieveExecutor = defaultExecutor
 	logger.Debug("default sieve script parsed and cached", "name", backend.name)
 
+	// Global before and after scripts are read from the database per domain
+	if rdb != nil {
+		backend.globalSieve = delivery.NewGlobalSieveScripts(rdb, options.GlobalSieveExtensions)
+	}
+	backend.sieveFilterHeaders = options.SieveFilterHeaders
+
 	// Set up TLS config: Support both file-based certificates and global TLS manager
 	// 1. Per-server TLS: cert files provided (for both implicit TLS and STARTTLS)
 	// 2. Global TLS: options.TLS=true, no cert files, global TLS config provided (for both implicit TLS and STARTTLS)
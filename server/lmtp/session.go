@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,6 +24,7 @@ import (
 	"github.com/migadu/sora/helpers"
 	"github.com/migadu/sora/pkg/metrics"
 	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/delivery"
 	"github.com/migadu/sora/server/sieveengine"
 )
 
@@ -30,12 +33,18 @@ var defaultSieveScript string
 
 // sendToExternalRelay queues a message for external relay delivery
 func (s *LMTPSession) sendToExternalRelay(from string, to string, message []byte) error {
+	return s.enqueueRelay(from, to, "redirect", message)
+}
+
+// enqueueRelay queues a message of the given type (redirect, forward) for
+// external relay delivery.
+func (s *LMTPSession) enqueueRelay(from, to, messageType string, message []byte) error {
 	if s.backend.relayQueue == nil {
 		return fmt.Errorf("relay queue not configured")
 	}
 
 	// Queue the message for background delivery
-	err := s.backend.relayQueue.Enqueue(from, to, "redirect", message)
+	err := s.backend.relayQueue.Enqueue(from, to, messageType, message)
 	if err != nil {
 		return fmt.Errorf("failed to enqueue relay message: %w", err)
 	}
@@ -48,12 +57,27 @@ func (s *LMTPSession) sendToExternalRelay(from string, to string, message []byte
 	return nil
 }
 
+// lmtpTarget is a local account that receives the message of the current
+// transaction.
+type lmtpTarget struct {
+	user          *server.User
+	recipientAddr *server.Address // Envelope recipient for Sieve (may include +detail)
+}
+
+// isTemporarySMTPError reports whether err is a 4xx SMTP reply.
+func isTemporarySMTPError(err error) bool {
+	var smtpErr *smtp.SMTPError
+	return errors.As(err, &smtpErr) && smtpErr.Code >= 400 && smtpErr.Code < 500
+}
+
 // LMTPSession represents a single LMTP session.
 type LMTPSession struct {
 	server.Session
 	backend       *LMTPServerBackend
 	sender        *server.Address
 	recipientAddr *server.Address // Original recipient address (may include +detail)
+	targets       []lmtpTarget    // Local accounts receiving the message
+	forwards      []string        // External alias targets the message is forwarded to
 	conn          *smtp.Conn
 	cancel        context.CancelFunc
 	ctx           context.Context
@@ -158,19 +182,102 @@ func (s *LMTPSession) Rcpt(to string, opts *smtp.RcptOptions) error {
 	// Look up account ID by credential address (excluding deleted accounts)
 	AccountID, err := s.backend.rdb.GetActiveAccountIDByAddressWithRetry(readCtx, lookupAddress)
 	if err != nil {
+		if errors.Is(err, consts.ErrDomainSuspended) {
+			s.DebugLog("recipient domain suspended", "address", lookupAddress)
+			recordMetrics("failure")
+			return errMailboxDisabled
+		}
+		if errors.Is(err, consts.ErrAccountSuspended) {
+			s.DebugLog("recipient account does not accept mail", "address", lookupAddress)
+			recordMetrics("failure")
+			return errMailboxDisabled
+		}
+		if errors.Is(err, consts.ErrUserNotFound) {
+			// Not an account, try the aliases and catch-all of the domain
+			if err := s.rcptAlias(readCtx, toAddress); err != nil {
+				recordMetrics("failure")
+				return err
+			}
+			recordMetrics("success")
+			return nil
+		}
+		// Database error (connection failure, timeout, etc.) - temporary failure
+		s.WarnLog("database error during user lookup", "address", lookupAddress, "error", err)
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         451,
+			EnhancedCode: smtp.EnhancedCode{4, 4, 3},
+			Message:      "Temporary failure, please try again later",
+		}
+	}
+
+	target, err := s.prepareTarget(readCtx, AccountID, toAddress)
+	if err != nil {
+		recordMetrics("failure")
+		return err
+	}
+
+	// Acquire write lock to update User
+	acquired, release := s.mutexHelper.AcquireWriteLockWithTimeout()
+	if !acquired {
+		s.WarnLog("failed to acquire write lock", "command", "RCPT")
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         421,
+			EnhancedCode: smtp.EnhancedCode{4, 4, 5},
+			Message:      "Server busy, try again later",
+		}
+	}
+	defer release()
+	s.User = target.user                   // Always use primary address
+	s.recipientAddr = target.recipientAddr // Store for Sieve envelope (with +detail preserved on primary address)
+	s.targets = []lmtpTarget{*target}
+	s.forwards = nil
+
+	// Pin the session to the master DB to prevent reading stale data from a replica.
+	s.useMasterDB = true
+
+	// Log recipient acceptance with alias detection
+	if fullAddress != target.user.Address.FullAddress() {
+		s.DebugLog("recipient accepted", "recipient", fullAddress, "primary_address", target.user.Address.FullAddress(), "account_id", AccountID)
+	} else {
+		s.DebugLog("recipient accepted", "recipient", fullAddress, "account_id", AccountID)
+	}
+	recordMetrics("success")
+	return nil
+}
+
+// errMailboxDisabled rejects recipients of a suspended domain and suspended
+// accounts.
+var errMailboxDisabled = &smtp.SMTPError{
+	Code:         550,
+	EnhancedCode: smtp.EnhancedCode{5, 2, 1},
+	Message:      "Mailbox disabled, not accepting messages",
+}
+
+// rcptAlias accepts an address that is not an account by expanding it through
+// the aliases and catch-all of its domain. Local targets that cannot receive
+// the message (e.g. a full mailbox) are skipped as long as another target
+// accepts it.
+func (s *LMTPSession) rcptAlias(readCtx context.Context, toAddress server.Address) error {
+	lookupAddress := toAddress.BaseAddress()
+
+	aliasTargets, err := s.backend.rdb.ResolveAliasWithRetry(readCtx, lookupAddress)
+	if err != nil {
+		if errors.Is(err, consts.ErrDomainSuspended) {
+			s.DebugLog("recipient domain suspended", "address", lookupAddress)
+			return errMailboxDisabled
+		}
 		if errors.Is(err, consts.ErrUserNotFound) {
 			// User not found or account deleted - permanent failure
 			s.DebugLog("user not found", "address", lookupAddress)
-			recordMetrics("failure")
 			return &smtp.SMTPError{
 				Code:         550,
 				EnhancedCode: smtp.EnhancedCode{5, 1, 1},
 				Message:      "No such user here",
 			}
 		}
-		// Database error (connection failure, timeout, etc.) - temporary failure
-		s.WarnLog("database error during user lookup", "address", lookupAddress, "error", err)
-		recordMetrics("failure")
+		s.WarnLog("database error during alias lookup", "address", lookupAddress, "error", err)
 		return &smtp.SMTPError{
 			Code:         451,
 			EnhancedCode: smtp.EnhancedCode{4, 4, 3},
@@ -178,22 +285,95 @@ func (s *LMTPSession) Rcpt(to string, opts *smtp.RcptOptions) error {
 		}
 	}
 
+	var targets []lmtpTarget
+	var forwards []string
+	var targetErr error
+	for _, aliasTarget := range aliasTargets {
+		if !aliasTarget.IsLocal() {
+			if s.backend.relayQueue == nil {
+				s.WarnLog("cannot forward to alias target, relay not configured", "alias", lookupAddress, "target", aliasTarget.Address)
+				continue
+			}
+			forwards = append(forwards, aliasTarget.Address)
+			continue
+		}
+		target, err := s.prepareTarget(readCtx, aliasTarget.AccountID, toAddress)
+		if err != nil {
+			s.InfoLog("skipping alias target", "alias", lookupAddress, "target", aliasTarget.Address, "error", err)
+			targetErr = err
+			continue
+		}
+		targets = append(targets, *target)
+	}
+	if len(targets) == 0 && len(forwards) == 0 {
+		if targetErr != nil {
+			return targetErr
+		}
+		return &smtp.SMTPError{
+			Code:         550,
+			EnhancedCode: smtp.EnhancedCode{5, 1, 1},
+			Message:      "No such user here",
+		}
+	}
+
+	acquired, release := s.mutexHelper.AcquireWriteLockWithTimeout()
+	if !acquired {
+		s.WarnLog("failed to acquire write lock", "command", "RCPT")
+		return &smtp.SMTPError{
+			Code:         421,
+			EnhancedCode: smtp.EnhancedCode{4, 4, 5},
+			Message:      "Server busy, try again later",
+		}
+	}
+	defer release()
+	s.User = nil
+	s.recipientAddr = nil
+	if len(targets) > 0 {
+		s.User = targets[0].user
+		s.recipientAddr = targets[0].recipientAddr
+	}
+	s.targets = targets
+	s.forwards = forwards
+	s.useMasterDB = true
+
+	s.DebugLog("alias recipient accepted", "recipient", toAddress.FullAddress(), "local_targets", len(targets), "forwards", len(forwards))
+	return nil
+}
+
+// sieveExtensions returns the Sieve extensions that scripts of the recipient
+// may use: the extensions enabled on the server, restricted by the domain
+// policy if the domain has one. A script using other extensions fails to
+// compile and is skipped, as ManageSieve and the user API refuse to store it.
+func (s *LMTPSession) sieveExtensions(readCtx context.Context) ([]string, error) {
+	extensions := s.backend.sieveCache.extensions()
+	d, err := s.backend.rdb.GetDomainWithRetry(readCtx, s.User.Domain())
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			return extensions, nil
+		}
+		return nil, err
+	}
+	return d.AllowedSieveExtensions(extensions), nil
+}
+
+// prepareTarget makes sure the account can receive a message for toAddress:
+// it creates the default mailboxes and rejects full mailboxes early. It
+// returns the target with the account's primary address.
+func (s *LMTPSession) prepareTarget(readCtx context.Context, AccountID int64, toAddress server.Address) (*lmtpTarget, error) {
 	// This is a potential write operation, so it must use the main context.
 	// Ensure default mailboxes (INBOX/Drafts/Sent/Spam/Trash) exist. Use the resilient method.
-	err = s.backend.rdb.CreateDefaultMailboxesWithRetry(s.ctx, AccountID)
+	err := s.backend.rdb.CreateDefaultMailboxesWithRetry(s.ctx, AccountID)
 	if err != nil {
 		// Check if error is due to context cancellation (server shutdown)
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 			s.InfoLog("mailbox creation cancelled due to server shutdown")
-			recordMetrics("failure")
-			return &smtp.SMTPError{
+			return nil, &smtp.SMTPError{
 				Code:         421,
 				EnhancedCode: smtp.EnhancedCode{4, 2, 1},
 				Message:      "service shutting down",
 			}
 		}
-		recordMetrics("failure")
-		return s.InternalError("failed to create default mailboxes: %v", err)
+		return nil, s.InternalError("failed to create default mailboxes: %v", err)
 	}
 
 	// Get primary email address for this account
@@ -203,35 +383,40 @@ func (s *LMTPSession) Rcpt(to string, opts *smtp.RcptOptions) error {
 		// Check if error is due to context cancellation (server shutdown)
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 			s.InfoLog("primary email fetch cancelled due to server shutdown")
-			recordMetrics("failure")
-			return &smtp.SMTPError{
+			return nil, &smtp.SMTPError{
 				Code:         421,
 				EnhancedCode: smtp.EnhancedCode{4, 2, 1},
 				Message:      "service shutting down",
 			}
 		}
 		s.WarnLog("failed to get primary email", "account_id", AccountID, "error", err)
-		recordMetrics("failure")
-		return &smtp.SMTPError{
+		return nil, &smtp.SMTPError{
 			Code:         451,
 			EnhancedCode: smtp.EnhancedCode{4, 4, 3},
 			Message:      "Temporary failure, please try again later",
 		}
 	}
 
-	// Acquire write lock to update User
-	acquired, release := s.mutexHelper.AcquireWriteLockWithTimeout()
-	if !acquired {
-		s.WarnLog("failed to acquire write lock", "command", "RCPT")
-		recordMetrics("failure")
-		return &smtp.SMTPError{
-			Code:         421,
-			EnhancedCode: smtp.EnhancedCode{4, 4, 5},
-			Message:      "Server busy, try again later",
+	// Reject early if the mailbox is already full. The message size is not
+	// known yet, so the exact check happens again in DATA.
+	quota, err := s.backend.rdb.GetAccountQuotaWithRetry(readCtx, AccountID)
+	if err != nil {
+		s.WarnLog("failed to get quota", "account_id", AccountID, "error", err)
+		return nil, &smtp.SMTPError{
+			Code:         451,
+			EnhancedCode: smtp.EnhancedCode{4, 4, 3},
+			Message:      "Temporary failure, please try again later",
+		}
+	}
+	if quota.IsFull() {
+		s.InfoLog("recipient over quota", "account_id", AccountID, "storage_used", quota.StorageUsed, "storage_limit", quota.StorageLimit,
+			"messages_used", quota.MessagesUsed, "messages_limit", quota.MessagesLimit)
+		return nil, &smtp.SMTPError{
+			Code:         452,
+			EnhancedCode: smtp.EnhancedCode{4, 2, 2},
+			Message:      "Mailbox full, please try again later",
 		}
 	}
-	defer release()
-	s.User = server.NewUser(primaryAddr, AccountID) // Always use primary address
 
 	// Construct envelope recipient address for Sieve:
 	// - If original recipient has +detail, preserve it but use primary address domain
@@ -247,19 +432,11 @@ func (s *LMTPSession) Rcpt(to string, opts *smtp.RcptOptions) error {
 			envelopeRecipient = primaryWithDetail
 		}
 	}
-	s.recipientAddr = &envelopeRecipient // Store for Sieve envelope (with +detail preserved on primary address)
 
-	// Pin the session to the master DB to prevent reading stale data from a replica.
-	s.useMasterDB = true
-
-	// Log recipient acceptance with alias detection
-	if fullAddress != primaryAddr.FullAddress() {
-		s.DebugLog("recipient accepted", "recipient", fullAddress, "primary_address", primaryAddr.FullAddress(), "account_id", AccountID)
-	} else {
-		s.DebugLog("recipient accepted", "recipient", fullAddress, "account_id", AccountID)
-	}
-	recordMetrics("success")
-	return nil
+	return &lmtpTarget{
+		user:          server.NewUser(primaryAddr, AccountID), // Always use primary address
+		recipientAddr: &envelopeRecipient,
+	}, nil
 }
 
 func (s *LMTPSession) Data(r io.Reader) error {
@@ -284,7 +461,7 @@ func (s *LMTPSession) Data(r io.Reader) error {
 	defer release()
 
 	// Check if we have a valid sender and recipient
-	if s.sender == nil || s.User == nil {
+	if s.sender == nil || (len(s.targets) == 0 && len(s.forwards) == 0) {
 		s.WarnLog("data command without valid sender or recipient")
 		recordMetrics("failure")
 		return &smtp.SMTPError{
@@ -353,6 +530,73 @@ func (s *LMTPSession) Data(r io.Reader) error {
 	metrics.BytesThroughput.WithLabelValues("lmtp", "in").Add(float64(len(fullMessageBytes)))
 	metrics.MessageThroughput.WithLabelValues("lmtp", "received", "success").Inc()
 
+	// Deliver to every local account of the recipient. A plain address has a
+	// single target; an alias may fan out to several.
+	delivered := 0
+	var deliveryErr error
+	for _, target := range s.targets {
+		s.User = target.user
+		s.recipientAddr = target.recipientAddr
+		if err := s.deliverMessage(fullMessageBytes); err != nil {
+			if len(s.targets) > 1 {
+				s.WarnLog("delivery to alias target failed", "account_id", target.user.AccountID(), "error", err)
+			}
+			deliveryErr = err
+			continue
+		}
+		delivered++
+	}
+	// Temporary failures are returned even after a partial delivery: the
+	// retry is deduplicated for the targets that already have the message.
+	if deliveryErr != nil && (delivered == 0 || isTemporarySMTPError(deliveryErr)) {
+		recordMetrics("failure")
+		return deliveryErr
+	}
+
+	// Forward to the external targets of an alias last, since forwards are
+	// not deduplicated when the delivery is retried
+	for _, to := range s.forwards {
+		if err := s.enqueueRelay(s.sender.FullAddress(), to, "forward", fullMessageBytes); err != nil {
+			s.WarnLog("failed to forward message", "to", to, "error", err)
+			recordMetrics("failure")
+			return &smtp.SMTPError{
+				Code:         451,
+				EnhancedCode: smtp.EnhancedCode{4, 4, 3},
+				Message:      "Temporary failure, please try again later",
+			}
+		}
+		s.InfoLog("message forwarded", "to", to)
+	}
+
+	recordMetrics("success")
+	return nil
+}
+
+// deliverMessage runs Sieve and stores the message for the current target
+// (s.User and s.recipientAddr).
+func (s *LMTPSession) deliverMessage(fullMessageBytes []byte) error {
+	// Enforce the recipient's quota now that the message size is known
+	quotaCtx := s.ctx
+	if s.useMasterDB {
+		quotaCtx = context.WithValue(s.ctx, consts.UseMasterDBKey, true)
+	}
+	if err := s.backend.rdb.CheckQuotaWithRetry(quotaCtx, s.User.AccountID(), int64(len(fullMessageBytes)), 1); err != nil {
+		if errors.Is(err, consts.ErrQuotaExceeded) {
+			s.InfoLog("message rejected, quota exceeded", "size", len(fullMessageBytes))
+			return &smtp.SMTPError{
+				Code:         552,
+				EnhancedCode: smtp.EnhancedCode{5, 2, 2},
+				Message:      "Mailbox full, message exceeds quota",
+			}
+		}
+		s.WarnLog("failed to check quota", "error", err)
+		return &smtp.SMTPError{
+			Code:         451,
+			EnhancedCode: smtp.EnhancedCode{4, 4, 3},
+			Message:      "Temporary failure, please try again later",
+		}
+	}
+
 	// Extract raw headers string.
 	// Headers are typically terminated by a double CRLF (\r\n\r\n).
 	var rawHeadersText string
@@ -367,7 +611,6 @@ func (s *LMTPSession) Data(r io.Reader) error {
 
 	messageContent, err := server.ParseMessage(bytes.NewReader(fullMessageBytes))
 	if err != nil {
-		recordMetrics("failure")
 		return s.InternalError("failed to parse message: %v", err)
 	}
 
@@ -380,6 +623,7 @@ func (s *LMTPSession) Data(r io.Reader) error {
 	messageID, _ := mailHeader.MessageID()
 	sentDate, _ := mailHeader.Date()
 	inReplyTo, _ := mailHeader.MsgIDList("In-Reply-To")
+	references, _ := mailHeader.MsgIDList("References")
 
 	if sentDate.IsZero() {
 		sentDate = time.Now()
@@ -388,7 +632,7 @@ func (s *LMTPSession) Data(r io.Reader) error {
 		s.DebugLog("message sent date", "sent_date", sentDate)
 	}
 
-	bodyStructureVal := imapserver.ExtractBodyStructure(bytes.NewReader(buf.Bytes()))
+	bodyStructureVal := imapserver.ExtractBodyStructure(bytes.NewReader(fullMessageBytes))
 	bodyStructure := &bodyStructureVal
 	var plaintextBody *string
 	plaintextBodyResult, extractErr := helpers.ExtractPlaintextBody(messageContent)
@@ -421,8 +665,6 @@ func (s *LMTPSession) Data(r io.Reader) error {
 	}
 
 	activeScript, err := s.backend.rdb.GetActiveScriptWithRetry(readCtx, s.AccountID())
-	var result sieveengine.Result
-	var mailboxName string
 
 	// Create an adapter for the VacationOracle interface
 	sieveVacOracle := &dbVacationOracle{
@@ -443,10 +685,13 @@ func (s *LMTPSession) Data(r io.Reader) error {
 		EnvelopeTo:   envelopeTo,
 		Header:       messageContent.Header.Map(),
 		Body:         *plaintextBody,
+		Message:      fullMessageBytes,
+		Filter:       s.backend.sieveFilterHeaders,
 	}
 
 	// Always run the default script first as a "before script"
 	// Use the pre-parsed default executor from the backend
+	defaultResult := sieveengine.KeepResult()
 	if s.backend.defaultSieveExecutor != nil {
 		// SIEVE debugging information
 		if s.backend.debug {
@@ -458,42 +703,51 @@ func (s *LMTPSession) Data(r io.Reader) error {
 			}
 		}
 
-		defaultResult, defaultEvalErr := s.backend.defaultSieveExecutor.Evaluate(s.ctx, sieveCtx)
+		result, defaultEvalErr := s.backend.defaultSieveExecutor.Evaluate(s.ctx, sieveCtx)
 		if defaultEvalErr != nil {
 			metrics.SieveExecutions.WithLabelValues("lmtp", "failure").Inc()
 			s.WarnLog("default sieve script evaluation error", "error", defaultEvalErr)
 			// fallback: default to INBOX
-			result = sieveengine.Result{Action: sieveengine.ActionKeep}
 		} else {
 			metrics.SieveExecutions.WithLabelValues("lmtp", "success").Inc()
-			// Set the result from the default script
-			result = defaultResult
-
-			// Log more details about the action
-			switch result.Action {
-			case sieveengine.ActionFileInto:
-				s.InfoLog("default sieve fileinto", "mailbox", result.Mailbox, "copy", result.Copy, "create", result.CreateMailbox)
-			case sieveengine.ActionRedirect:
-				s.InfoLog("default sieve redirect", "redirect_to", result.RedirectTo, "copy", result.Copy)
-			case sieveengine.ActionDiscard:
-				s.InfoLog("default sieve discard")
-			case sieveengine.ActionVacation:
-				s.InfoLog("default sieve vacation response triggered")
-			case sieveengine.ActionKeep:
-				s.InfoLog("default sieve keep")
-			}
+			defaultResult = result
+			s.logSieveResult("default", defaultResult)
 		}
 	} else {
 		s.DebugLog("no default sieve executor available")
-		result = sieveengine.Result{Action: sieveengine.ActionKeep}
 	}
 
-	// If user has an active script, run it and let it override the resultAction
+	// The administrator's before and after scripts run around the user script
+	before, after, globalErr := s.backend.globalSieve.Scripts(readCtx, s.User.Domain())
+	if globalErr != nil {
+		return s.InternalError("failed to get global sieve scripts: %v", globalErr)
+	}
+	sequence := sieveengine.Sequence{
+		Before: before,
+		After:  after,
+		Observe: func(script sieveengine.Script, scriptResult sieveengine.Result, evalErr error) {
+			if evalErr != nil {
+				metrics.SieveExecutions.WithLabelValues("lmtp", "failure").Inc()
+				s.WarnLog("sieve script evaluation error", "script", script.Name, "error", evalErr)
+				return
+			}
+			metrics.SieveExecutions.WithLabelValues("lmtp", "success").Inc()
+			s.logSieveResult(script.Name, scriptResult)
+		},
+	}
+
+	// If user has an active script, run it after the default script
 	if err == nil && activeScript != nil {
 		s.InfoLog("using user sieve script", "name", activeScript.Name, "script_id", activeScript.ID, "updated_at", activeScript.UpdatedAt.Format(time.RFC3339))
+		// User scripts may only use the extensions allowed for the domain
+		extensions, extErr := s.sieveExtensions(readCtx)
+		if extErr != nil {
+			return s.InternalError("failed to get domain policy: %v", extErr)
+		}
 		// Try to get the user script from cache or create and cache it with metadata validation
 		userSieveExecutor, userScriptErr := s.backend.sieveCache.GetOrCreateWithMetadata(
 			activeScript.Script,
+			extensions,
 			activeScript.ID,
 			activeScript.UpdatedAt,
 			s.AccountID(),
@@ -503,39 +757,7 @@ func (s *LMTPSession) Data(r io.Reader) error {
 			s.WarnLog("failed to get/create sieve executor", "error", userScriptErr)
 			// Keep the result from the default script
 		} else {
-			userResult, userEvalErr := userSieveExecutor.Evaluate(s.ctx, sieveCtx)
-			if userEvalErr != nil {
-				metrics.SieveExecutions.WithLabelValues("lmtp", "failure").Inc()
-				s.WarnLog("user sieve script evaluation error", "error", userEvalErr)
-				// Keep the result from the default script
-			} else {
-				metrics.SieveExecutions.WithLabelValues("lmtp", "success").Inc()
-
-				// Merge user script result with default script result
-				// If user script returns implicit keep (ActionKeep), preserve the default script's action
-				// Otherwise, the user script overrides the default
-				if userResult.Action == sieveengine.ActionKeep && result.Action != sieveengine.ActionKeep {
-					s.InfoLog("user sieve implicit keep - preserving default script action", "default_action", result.Action)
-					// Keep the default script result (don't override)
-				} else {
-					// User script has an explicit action, override the default
-					result = userResult
-
-					// Log more details about the action
-					switch result.Action {
-					case sieveengine.ActionFileInto:
-						s.InfoLog("user sieve fileinto", "mailbox", result.Mailbox, "copy", result.Copy, "create", result.CreateMailbox)
-					case sieveengine.ActionRedirect:
-						s.InfoLog("user sieve redirect", "redirect_to", result.RedirectTo, "copy", result.Copy)
-					case sieveengine.ActionDiscard:
-						s.InfoLog("user sieve discard")
-					case sieveengine.ActionVacation:
-						s.InfoLog("user sieve vacation response triggered")
-					case sieveengine.ActionKeep:
-						s.InfoLog("user sieve explicit keep")
-					}
-				}
-			}
+			sequence.User = &sieveengine.Script{Name: "user", Executor: userSieveExecutor}
 		}
 	} else {
 		if err != nil && err != consts.ErrDBNotFound {
@@ -545,6 +767,23 @@ func (s *LMTPSession) Data(r io.Reader) error {
 		}
 	}
 
+	// The actions of the default script and the sequence are performed. The
+	// implicit keep is only performed if no script cancelled it, so a
+	// message the default script files into Junk stays there. Scripts that
+	// fail are skipped and logged by Observe.
+	sequenceResult, _ := sequence.Evaluate(s.ctx, sieveCtx)
+	result := sieveengine.Combine(defaultResult, sequenceResult)
+
+	// A rejected message is neither stored nor redirected (RFC 5429), even
+	// if another script files it
+	if reject, ok := result.Rejection(); ok {
+		s.sendNotifications(result, messageContent)
+		return s.rejectMessage(reject, messageContent)
+	}
+
+	// Redirects are sent without the header edits made after them
+	originalMessageBytes := fullMessageBytes
+
 	// Apply header edits if any (RFC 5293 - editheader extension)
 	if len(result.HeaderEdits) > 0 {
 		s.DebugLog("applying header edits", "count", len(result.HeaderEdits))
@@ -569,6 +808,7 @@ func (s *LMTPSession) Data(r io.Reader) error {
 				messageID, _ = mailHeader.MessageID()
 				sentDate, _ = mailHeader.Date()
 				inReplyTo, _ = mailHeader.MsgIDList("In-Reply-To")
+				references, _ = mailHeader.MsgIDList("References")
 				if sentDate.IsZero() {
 					sentDate = time.Now()
 				}
@@ -582,6 +822,32 @@ func (s *LMTPSession) Data(r io.Reader) error {
 		}
 	}
 
+	deliveries := result.Deliveries()
+	redirects := result.Redirects()
+	if len(redirects) > 0 && s.backend.relayQueue == nil {
+		s.DebugLog("redirect requested but external relay not configured, keeping message in inbox")
+		deliveries = keepInInbox(deliveries)
+		redirects = nil
+	}
+
+	if len(deliveries) == 0 {
+		// Nothing to store: the message is discarded or only redirected
+		failed := s.redirectMessage(redirects, originalMessageBytes)
+		if len(failed) == 0 {
+			s.sendVacationResponses(result, messageContent)
+			s.sendNotifications(result, messageContent)
+			if len(redirects) == 0 {
+				s.InfoLog("sieve message discarded")
+			} else {
+				s.DebugLog("redirect without :copy - skipping local delivery")
+			}
+			return nil
+		}
+		// Fallback: store in INBOX if the message could not be redirected
+		deliveries = keepInInbox(nil)
+		redirects = nil
+	}
+
 	// Store message locally for background upload to S3
 	// This happens AFTER Sieve processing and header edits, so we store the modified message
 	// Check if file already exists to prevent race condition:
@@ -593,7 +859,6 @@ func (s *LMTPSession) Data(r io.Reader) error {
 		// File doesn't exist, safe to write
 		filePath, err = s.backend.uploader.StoreLocally(contentHash, s.AccountID(), fullMessageBytes)
 		if err != nil {
-			recordMetrics("failure")
 			return s.InternalError("failed to save message to disk: %v", err)
 		}
 		s.DebugLog("message accepted locally", "path", *filePath)
@@ -604,111 +869,25 @@ func (s *LMTPSession) Data(r io.Reader) error {
 		s.DebugLog("message file already exists, skipping write (concurrent delivery)", "path", expectedPath)
 	} else {
 		// Stat error (permission issue, etc.)
-		recordMetrics("failure")
 		return s.InternalError("failed to check file existence: %v", err)
 	}
 
-	s.InfoLog("executing sieve action", "action", result.Action)
-
-	switch result.Action {
-	case sieveengine.ActionDiscard:
-		s.InfoLog("sieve message discarded")
-		recordMetrics("success")
-		return nil
-
-	case sieveengine.ActionFileInto:
-		mailboxName = result.Mailbox
-		if result.Copy {
-			s.InfoLog("sieve fileinto :copy - saving to both mailbox and inbox", "mailbox", mailboxName)
-
-			// First save to the specified mailbox (with :create if specified)
-			err := s.saveMessageToMailbox(mailboxName, fullMessageBytes, contentHash,
-				subject, messageID, sentDate, inReplyTo, bodyStructure, plaintextBody, recipients, rawHeadersText, result.CreateMailbox)
-			if err != nil {
-				// Allow duplicates (message already in target mailbox)
-				if !errors.Is(err, consts.ErrMessageExists) && !errors.Is(err, consts.ErrDBUniqueViolation) {
-					recordMetrics("failure")
-					return s.InternalError("failed to save message to specified mailbox: %v", err)
-				}
-				s.DebugLog("duplicate message in target mailbox, continuing", "mailbox", mailboxName)
-			}
-
-			// Then save to INBOX (for the :copy functionality)
-			s.DebugLog("saving copy to inbox due to :copy modifier")
-
-			// Call saveMessageToMailbox again for INBOX (no :create for INBOX - it always exists)
-			err = s.saveMessageToMailbox(consts.MailboxInbox, fullMessageBytes, contentHash,
-				subject, messageID, sentDate, inReplyTo, bodyStructure, plaintextBody, recipients, rawHeadersText, false)
-			if err != nil {
-				// Allow duplicates (message already in INBOX)
-				if !errors.Is(err, consts.ErrMessageExists) && !errors.Is(err, consts.ErrDBUniqueViolation) {
-					recordMetrics("failure")
-					return s.InternalError("failed to save message copy to inbox: %v", err)
-				}
-				s.DebugLog("duplicate message in INBOX, continuing")
-			}
-
-			// Success - both copies saved
-			s.InfoLog("message delivered according to fileinto :copy directive")
-			recordMetrics("success")
-			return nil
-		} else {
-			s.InfoLog("sieve fileinto - saving to mailbox only", "mailbox", mailboxName)
-		}
-
-	case sieveengine.ActionRedirect:
-		if result.Copy {
-			s.DebugLog("sieve redirect :copy action", "redirect_to", result.RedirectTo)
-		} else {
-			s.DebugLog("sieve redirect action", "redirect_to", result.RedirectTo)
-		}
-
-		// Queue the message for external relay delivery if configured
-		if s.backend.relayQueue != nil {
-			s.DebugLog("queueing message for relay delivery")
-			err := s.sendToExternalRelay(s.sender.FullAddress(), result.RedirectTo, fullMessageBytes)
-			if err != nil {
-				s.DebugLog("error enqueuing redirected message, falling back to inbox", "error", err)
-				// Continue processing even if queue fails, store in INBOX as fallback
-			} else {
-				s.DebugLog("successfully queued message for relay delivery", "redirect_to", result.RedirectTo)
-
-				// If :copy is not specified and relay succeeded, we don't store the message locally
-				if !result.Copy {
-					s.DebugLog("redirect without :copy - skipping local delivery")
-					recordMetrics("success")
-					return nil
-				}
-				s.DebugLog("redirect :copy - continuing with local delivery")
-			}
-		} else {
-			s.DebugLog("redirect requested but external relay not configured")
-		}
-
-		// Fallback: store in INBOX if relay is not configured or fails
-		// Or if :copy is specified
-		mailboxName = consts.MailboxInbox
-
-	case sieveengine.ActionVacation:
-		// Handle vacation response
-		err := s.handleVacationResponse(result, messageContent)
-		if err != nil {
-			s.DebugLog("error handling vacation response", "error", err)
-			// Continue processing even if vacation response fails
-		}
-		// Store the original message in INBOX
-		mailboxName = consts.MailboxInbox
-
-	default:
-		s.DebugLog("sieve keep action")
-		mailboxName = consts.MailboxInbox
+	// Save the message to all mailboxes of the Sieve result at once, so that
+	// a retried delivery never finds it in only some of them
+	storedMessage := &lmtpMessage{
+		bytes:          fullMessageBytes,
+		contentHash:    contentHash,
+		subject:        subject,
+		messageID:      messageID,
+		sentDate:       sentDate,
+		inReplyTo:      inReplyTo,
+		references:     references,
+		bodyStructure:  bodyStructure,
+		plaintextBody:  plaintextBody,
+		recipients:     recipients,
+		rawHeadersText: rawHeadersText,
 	}
-
-	// Save the message to the determined mailbox (either the specified one or INBOX)
-	// For fileinto actions without :copy, pass the :create flag if specified
-	createMailbox := result.Action == sieveengine.ActionFileInto && result.CreateMailbox
-	err = s.saveMessageToMailbox(mailboxName, fullMessageBytes, contentHash,
-		subject, messageID, sentDate, inReplyTo, bodyStructure, plaintextBody, recipients, rawHeadersText, createMailbox)
+	mailboxes, err := s.saveMessageToMailboxes(deliveries, storedMessage)
 	if err != nil {
 		// Handle duplicate messages (acceptable in LMTP - return success)
 		if errors.Is(err, consts.ErrMessageExists) || errors.Is(err, consts.ErrDBUniqueViolation) {
@@ -740,7 +919,6 @@ func (s *LMTPSession) Data(r io.Reader) error {
 					s.DebugLog("keeping file for cleanup job due to shutdown", "content_hash", contentHash)
 				}
 				metrics.MessageThroughput.WithLabelValues("lmtp", "delivered", "shutdown").Inc()
-				recordMetrics("failure")
 				return &smtp.SMTPError{
 					Code:         421,
 					EnhancedCode: smtp.EnhancedCode{4, 2, 1},
@@ -758,7 +936,6 @@ func (s *LMTPSession) Data(r io.Reader) error {
 				s.DebugLog("keeping file for cleanup job after error", "content_hash", contentHash)
 			}
 			metrics.MessageThroughput.WithLabelValues("lmtp", "delivered", "failure").Inc()
-			recordMetrics("failure")
 			return s.InternalError("failed to save message: %v", err)
 		}
 	} else {
@@ -766,7 +943,21 @@ func (s *LMTPSession) Data(r io.Reader) error {
 		metrics.MessageThroughput.WithLabelValues("lmtp", "delivered", "success").Inc()
 	}
 
-	s.InfoLog("message delivered", "mailbox", mailboxName)
+	s.InfoLog("message delivered", "mailboxes", mailboxes)
+
+	// Redirects, vacation responses and notifications are sent once the
+	// message is stored, a retried delivery would send them again otherwise
+	if failed := s.redirectMessage(redirects, originalMessageBytes); len(failed) > 0 {
+		if !slices.ContainsFunc(deliveries, func(a sieveengine.Action) bool { return strings.EqualFold(a.Mailbox, consts.MailboxInbox) }) {
+			// Fallback: store in INBOX if the message could not be redirected
+			if _, err := s.saveMessageToMailboxes(keepInInbox(nil), storedMessage); err != nil &&
+				!errors.Is(err, consts.ErrMessageExists) && !errors.Is(err, consts.ErrDBUniqueViolation) {
+				s.WarnLog("failed to keep message that could not be redirected", "error", err)
+			}
+		}
+	}
+	s.sendVacationResponses(result, messageContent)
+	s.sendNotifications(result, messageContent)
 
 	// Track domain and user activity - LMTP delivery is critical!
 	if s.User != nil {
@@ -775,7 +966,6 @@ func (s *LMTPSession) Data(r io.Reader) error {
 		metrics.TrackUserActivity("lmtp", s.FullAddress(), "command", 1)
 	}
 
-	recordMetrics("success")
 	return nil
 }
 
@@ -797,6 +987,9 @@ func (s *LMTPSession) Reset() {
 
 	s.User = nil
 	s.sender = nil
+	s.recipientAddr = nil
+	s.targets = nil
+	s.forwards = nil
 
 	s.DebugLog("session reset")
 	recordMetrics("success")
@@ -860,7 +1053,7 @@ func (s *LMTPSession) InternalError(format string, a ...any) error {
 // handleVacationResponse constructs and sends a vacation auto-response.
 // The decision to send and the recording of the response event are handled
 // by the Sieve engine's policy, using the VacationOracle.
-func (s *LMTPSession) handleVacationResponse(result sieveengine.Result, originalMessage *message.Entity) error {
+func (s *LMTPSession) handleVacationResponse(vacation sieveengine.Action, originalMessage *message.Entity) error {
 	if s.backend.relayQueue == nil {
 		s.DebugLog("relay not configured, cannot send vacation response", "sender", s.sender.FullAddress())
 		return nil
@@ -874,8 +1067,8 @@ func (s *LMTPSession) handleVacationResponse(result sieveengine.Result, original
 
 	// Create the vacation response message
 	var vacationFrom string
-	if result.VacationFrom != "" {
-		vacationFrom = result.VacationFrom
+	if vacation.VacationFrom != "" {
+		vacationFrom = vacation.VacationFrom
 		s.DebugLog("using custom vacation from address", "from", vacationFrom)
 	} else {
 		vacationFrom = s.User.Address.FullAddress()
@@ -883,8 +1076,8 @@ func (s *LMTPSession) handleVacationResponse(result sieveengine.Result, original
 	}
 
 	var vacationSubject string
-	if result.VacationSubj != "" {
-		vacationSubject = result.VacationSubj
+	if vacation.VacationSubj != "" {
+		vacationSubject = vacation.VacationSubj
 		s.DebugLog("using custom vacation subject", "subject", vacationSubject)
 	} else {
 		vacationSubject = "Auto: Out of Office"
@@ -923,8 +1116,8 @@ func (s *LMTPSession) handleVacationResponse(result sieveengine.Result, original
 		return fmt.Errorf("failed to create message writer: %w", err)
 	}
 
-	s.DebugLog("adding vacation message body", "body_length", len(result.VacationMsg))
-	_, err = w.Write([]byte(result.VacationMsg))
+	s.DebugLog("adding vacation message body", "body_length", len(vacation.VacationMsg))
+	_, err = w.Write([]byte(vacation.VacationMsg))
 	if err != nil {
 		w.Close()
 		s.WarnLog("error writing vacation message body", "error", err)
@@ -947,71 +1140,97 @@ func (s *LMTPSession) handleVacationResponse(result sieveengine.Result, original
 	return nil
 }
 
-// saveMessageToMailbox saves a message to the specified mailbox
-func (s *LMTPSession) saveMessageToMailbox(mailboxName string,
-	fullMessageBytes []byte, contentHash string, subject string, messageID string,
-	sentDate time.Time, inReplyTo []string, bodyStructure *imap.BodyStructure,
-	plaintextBody *string, recipients []helpers.Recipient, rawHeadersText string, createMailbox bool) error {
+// lmtpMessage is a parsed message as it is stored in the mailboxes of its
+// Sieve deliveries.
+type lmtpMessage struct {
+	bytes          []byte
+	contentHash    string
+	subject        string
+	messageID      string
+	sentDate       time.Time
+	inReplyTo      []string
+	references     []string
+	bodyStructure  *imap.BodyStructure
+	plaintextBody  *string
+	recipients     []helpers.Recipient
+	rawHeadersText string
+}
 
+// saveMessageToMailboxes saves a message to the mailboxes of its Sieve
+// deliveries in a single transaction and returns the names of the mailboxes.
+func (s *LMTPSession) saveMessageToMailboxes(deliveries []sieveengine.Action, msg *lmtpMessage) ([]string, error) {
 	// Create a context for read operations that respects session pinning
 	readCtx := s.ctx
 	if s.useMasterDB {
 		readCtx = context.WithValue(s.ctx, consts.UseMasterDBKey, true)
 	}
 
-	// If :create flag is set, use GetOrCreateMailboxByNameWithRetry
-	var mailbox *db.DBMailbox
-	var err error
-	if createMailbox {
-		s.DebugLog("creating mailbox if it doesn't exist", "mailbox", mailboxName)
-		mailbox, err = s.backend.rdb.GetOrCreateMailboxByNameWithRetry(s.ctx, s.AccountID(), mailboxName)
-		if err != nil {
-			return fmt.Errorf("failed to get or create mailbox '%s': %v", mailboxName, err)
-		}
-		s.DebugLog("mailbox ready for delivery", "mailbox", mailboxName, "mailbox_id", mailbox.ID)
-	} else {
-		// Normal behavior: get mailbox, fallback to INBOX if not found
-		mailbox, err = s.backend.rdb.GetMailboxByNameWithRetry(readCtx, s.AccountID(), mailboxName)
-		if err != nil {
-			if err == consts.ErrMailboxNotFound {
-				s.WarnLog("mailbox not found, falling back to inbox", "mailbox", mailboxName)
+	size := int64(len(msg.bytes))
+	var mailboxes []string
+	var options []*db.InsertMessageOptions
+	for _, delivery := range deliveries {
+		// If :create flag is set, use GetOrCreateMailboxByNameWithRetry
+		var mailbox *db.DBMailbox
+		var err error
+		if delivery.Create {
+			s.DebugLog("creating mailbox if it doesn't exist", "mailbox", delivery.Mailbox)
+			mailbox, err = s.backend.rdb.GetOrCreateMailboxByNameWithRetry(s.ctx, s.AccountID(), delivery.Mailbox)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get or create mailbox '%s': %v", delivery.Mailbox, err)
+			}
+		} else {
+			// Normal behavior: get mailbox, fallback to INBOX if not found
+			mailbox, err = s.backend.rdb.GetMailboxByNameWithRetry(readCtx, s.AccountID(), delivery.Mailbox)
+			if err != nil {
+				if err != consts.ErrMailboxNotFound {
+					return nil, fmt.Errorf("failed to get mailbox '%s': %v", delivery.Mailbox, err)
+				}
+				s.WarnLog("mailbox not found, falling back to inbox", "mailbox", delivery.Mailbox)
 				mailbox, err = s.backend.rdb.GetMailboxByNameWithRetry(readCtx, s.AccountID(), consts.MailboxInbox)
 				if err != nil {
-					return fmt.Errorf("failed to get INBOX mailbox: %v", err)
+					return nil, fmt.Errorf("failed to get INBOX mailbox: %v", err)
 				}
-			} else {
-				return fmt.Errorf("failed to get mailbox '%s': %v", mailboxName, err)
 			}
 		}
-	}
+		// fileinto "Foo" of a missing mailbox and keep both end up in INBOX
+		if slices.ContainsFunc(options, func(o *db.InsertMessageOptions) bool { return o.MailboxID == mailbox.ID }) {
+			continue
+		}
 
-	size := int64(len(fullMessageBytes))
+		flags := []imap.Flag{} // Explicitly set empty flags to mark as unread
+		for _, flag := range delivery.Flags {
+			flags = append(flags, imap.Flag(flag))
+		}
 
-	// User.Address is always the primary address (set during RCPT TO)
-	// No need to query - it's already cached in the session
-	_, messageUID, err := s.backend.rdb.InsertMessageWithRetry(s.ctx,
-		&db.InsertMessageOptions{
+		// User.Address is always the primary address (set during RCPT TO)
+		// No need to query - it's already cached in the session
+		options = append(options, &db.InsertMessageOptions{
 			AccountID:     s.AccountID(),
 			MailboxID:     mailbox.ID,
 			S3Domain:      s.User.Domain(),
 			S3Localpart:   s.User.LocalPart(),
 			MailboxName:   mailbox.Name,
-			ContentHash:   contentHash,
-			MessageID:     messageID,
+			ContentHash:   msg.contentHash,
+			MessageID:     msg.messageID,
 			InternalDate:  time.Now(),
 			Size:          size,
-			Subject:       subject,
-			PlaintextBody: *plaintextBody,
-			SentDate:      sentDate,
-			InReplyTo:     inReplyTo,
-			BodyStructure: bodyStructure,
-			Recipients:    recipients,
-			Flags:         []imap.Flag{}, // Explicitly set empty flags to mark as unread
-			RawHeaders:    rawHeadersText,
+			Subject:       msg.subject,
+			PlaintextBody: *msg.plaintextBody,
+			SentDate:      msg.sentDate,
+			InReplyTo:     msg.inReplyTo,
+			References:    msg.references,
+			BodyStructure: msg.bodyStructure,
+			Recipients:    msg.recipients,
+			Flags:         flags,
+			RawHeaders:    msg.rawHeadersText,
 			FTSRetention:  s.backend.ftsRetention,
-		},
+		})
+		mailboxes = append(mailboxes, mailbox.Name)
+	}
+
+	messageUIDs, err := s.backend.rdb.InsertMessageIntoMailboxesWithRetry(s.ctx, options,
 		db.PendingUpload{
-			ContentHash: contentHash,
+			ContentHash: msg.contentHash,
 			InstanceID:  s.backend.hostname,
 			Size:        size,
 			AccountID:   s.AccountID(),
@@ -1020,10 +1239,10 @@ func (s *LMTPSession) saveMessageToMailbox(mailboxName string,
 	if err != nil {
 		// Handle duplicate messages (either pre-detected or from unique constraint violation)
 		if errors.Is(err, consts.ErrMessageExists) || errors.Is(err, consts.ErrDBUniqueViolation) {
-			s.WarnLog("duplicate message detected, skipping delivery", "content_hash", contentHash, "message_id", messageID)
-			return fmt.Errorf("message already exists: %w", err)
+			s.WarnLog("duplicate message detected, skipping delivery", "content_hash", msg.contentHash, "message_id", msg.messageID)
+			return nil, fmt.Errorf("message already exists: %w", err)
 		}
-		return fmt.Errorf("failed to save message: %v", err)
+		return nil, fmt.Errorf("failed to save message: %w", err)
 	}
 
 	// Pin this session to the master DB to ensure read-your-writes consistency
@@ -1031,6 +1250,144 @@ func (s *LMTPSession) saveMessageToMailbox(mailboxName string,
 
 	// Notify uploader that a new upload is queued
 	s.backend.uploader.NotifyUploadQueued()
-	s.DebugLog("message saved", "uid", messageUID, "mailbox", mailbox.Name)
+	s.DebugLog("message saved", "uids", messageUIDs, "mailboxes", mailboxes)
+	return mailboxes, nil
+}
+
+// redirectMessage queues the message for every redirect of the Sieve result
+// and returns the redirects that could not be queued. Header edits made after
+// a redirect are not applied to the redirected message.
+func (s *LMTPSession) redirectMessage(redirects []sieveengine.Action, originalMessageBytes []byte) []sieveengine.Action {
+	var failed []sieveengine.Action
+	for _, redirect := range redirects {
+		messageBytes := originalMessageBytes
+		if len(redirect.HeaderEdits) > 0 {
+			modifiedBytes, err := sieveengine.ApplyHeaderEdits(originalMessageBytes, redirect.HeaderEdits)
+			if err != nil {
+				s.WarnLog("failed to apply header edits to redirected message", "error", err)
+			} else {
+				messageBytes = modifiedBytes
+			}
+		}
+
+		s.DebugLog("queueing message for relay delivery", "redirect_to", redirect.RedirectTo, "copy", redirect.Copy)
+		if err := s.sendToExternalRelay(s.sender.FullAddress(), redirect.RedirectTo, messageBytes); err != nil {
+			s.DebugLog("error enqueuing redirected message, falling back to inbox", "error", err)
+			failed = append(failed, redirect)
+			continue
+		}
+		s.DebugLog("successfully queued message for relay delivery", "redirect_to", redirect.RedirectTo)
+	}
+	return failed
+}
+
+// sendVacationResponses sends the vacation responses of the Sieve result.
+func (s *LMTPSession) sendVacationResponses(result sieveengine.Result, messageContent *message.Entity) {
+	for _, vacation := range result.Vacation() {
+		if err := s.handleVacationResponse(vacation, messageContent); err != nil {
+			s.DebugLog("error handling vacation response", "error", err)
+			// Continue processing even if vacation response fails
+		}
+	}
+}
+
+// sendNotifications sends the notifications of the Sieve result (RFC 5435)
+// through the relay queue. No notifications are sent for automatically
+// submitted messages.
+func (s *LMTPSession) sendNotifications(result sieveengine.Result, messageContent *message.Entity) {
+	notifications := result.Notifications()
+	if len(notifications) == 0 {
+		return
+	}
+	if delivery.SuppressNotification(messageContent) {
+		s.DebugLog("sieve notifications suppressed for automatically submitted message")
+		return
+	}
+	from := s.User.Address.FullAddress()
+	for _, notify := range notifications {
+		to, notification, err := delivery.BuildNotification(s.HostName, notify, from, messageContent)
+		if err != nil {
+			s.WarnLog("failed to build sieve notification", "method", notify.NotifyMethod, "error", err)
+			continue
+		}
+		for _, addr := range to {
+			if err := s.enqueueRelay(from, addr, "notify", notification); err != nil {
+				s.WarnLog("failed to enqueue sieve notification", "to", addr, "error", err)
+				continue
+			}
+			s.InfoLog("queued sieve notification for relay delivery", "to", addr)
+		}
+	}
+}
+
+// rejectMessage refuses a message rejected by Sieve (RFC 5429). A single
+// recipient is refused in the LMTP reply, so the MTA returns the message to
+// the sender. The accounts of an alias share the reply, so the rejection is
+// sent to the sender through the relay queue instead. The message is
+// discarded if that is not possible.
+func (s *LMTPSession) rejectMessage(reject sieveengine.Action, originalMessage *message.Entity) error {
+	reason := delivery.RejectionReply(reject)
+	if len(s.targets) == 1 && len(s.forwards) == 0 {
+		s.InfoLog("message rejected by sieve", "reason", reason)
+		return &smtp.SMTPError{
+			Code:         550,
+			EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+			Message:      reason,
+		}
+	}
+
+	sender := s.sender.FullAddress()
+	if sender == "" {
+		s.InfoLog("message from null sender rejected by sieve, discarding", "reason", reason)
+		return nil
+	}
+	rejection, err := delivery.BuildRejection(s.HostName, reject, s.User.Address.FullAddress(), sender, originalMessage)
+	if err != nil {
+		s.WarnLog("failed to build sieve rejection, discarding message", "error", err)
+		return nil
+	}
+	if err := s.enqueueRelay("", sender, "reject", rejection); err != nil {
+		s.WarnLog("failed to enqueue sieve rejection, discarding message", "error", err)
+		return nil
+	}
+	s.InfoLog("message rejected by sieve, rejection queued", "to", sender, "reason", reason)
 	return nil
 }
+
+// logSieveResult logs the actions of a Sieve script.
+func (s *LMTPSession) logSieveResult(script string, result sieveengine.Result) {
+	for _, action := range result.Actions {
+		switch action.Type {
+		case sieveengine.ActionFileInto:
+			s.InfoLog(script+" sieve fileinto", "mailbox", action.Mailbox, "copy", action.Copy, "create", action.Create, "flags", action.Flags)
+		case sieveengine.ActionRedirect:
+			s.InfoLog(script+" sieve redirect", "redirect_to", action.RedirectTo, "copy", action.Copy)
+		case sieveengine.ActionVacation:
+			s.InfoLog(script + " sieve vacation response triggered")
+		case sieveengine.ActionReject:
+			s.InfoLog(script+" sieve reject", "reason", action.RejectReason, "ereject", action.RejectProtocol)
+		case sieveengine.ActionNotify:
+			s.InfoLog(script+" sieve notify", "method", action.NotifyMethod, "importance", action.NotifyImportance)
+		case sieveengine.ActionKeep:
+			if action.Implicit {
+				s.DebugLog(script + " sieve implicit keep")
+			} else {
+				s.InfoLog(script + " sieve explicit keep")
+			}
+		}
+	}
+	if result.Discarded() {
+		s.InfoLog(script + " sieve discard")
+	}
+}
+
+// keepInInbox adds a keep to the deliveries of a message, unless it is
+// already delivered to INBOX.
+func keepInInbox(deliveries []sieveengine.Action) []sieveengine.Action {
+	for _, delivery := range deliveries {
+		if strings.EqualFold(delivery.Mailbox, consts.MailboxInbox) {
+			return deliveries
+		}
+	}
+	return append(deliveries, sieveengine.Action{Type: sieveengine.ActionKeep, Mailbox: consts.MailboxInbox})
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -50,19 +51,32 @@ func NewSieveScriptCache(maxEntries int, ttl time.Duration, enabledExtensions []
 	return cache
 }
 
-// hashScript creates a hash of the script content for use as a cache key
-func hashScript(script string) string {
+// hashScript creates a hash of the script content and the extensions it is
+// compiled with for use as a cache key. The same script is compiled
+// separately for domains that allow different extensions.
+func hashScript(script string, extensions []string) string {
 	h := sha256.New()
+	h.Write([]byte(strings.Join(extensions, ",")))
+	h.Write([]byte{0})
 	h.Write([]byte(script))
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// extensions returns the Sieve extensions enabled on the server.
+func (c *SieveScriptCache) extensions() []string {
+	if len(c.enabledExtensions) == 0 {
+		// Empty list means use all default extensions
+		return sieveengine.DefaultSieveExtensions
+	}
+	return c.enabledExtensions
+}
+
 // Get retrieves a parsed Sieve script from the cache
 func (c *SieveScriptCache) Get(scriptContent string) (sieveengine.Executor, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	key := hashScript(scriptContent)
+	key := hashScript(scriptContent, c.extensions())
 	entry, exists := c.cache[key]
 	if !exists {
 		return nil, false
@@ -88,7 +102,7 @@ func (c *SieveScriptCache) Put(scriptContent string, executor sieveengine.Execut
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	key := hashScript(scriptContent)
+	key := hashScript(scriptContent, c.extensions())
 	now := time.Now()
 
 	// Check if already exists
@@ -113,10 +127,14 @@ func (c *SieveScriptCache) Put(scriptContent string, executor sieveengine.Execut
 
 // PutWithMetadata stores a parsed Sieve script in the cache with metadata
 func (c *SieveScriptCache) PutWithMetadata(scriptContent string, executor sieveengine.Executor, scriptID int64, updatedAt time.Time) {
+	c.putWithKey(hashScript(scriptContent, c.extensions()), executor, scriptID, updatedAt)
+}
+
+// putWithKey stores a parsed Sieve script with metadata under a cache key
+func (c *SieveScriptCache) putWithKey(key string, executor sieveengine.Executor, scriptID int64, updatedAt time.Time) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	key := hashScript(scriptContent)
 	now := time.Now()
 
 	// Check if already exists
@@ -204,15 +222,8 @@ func (c *SieveScriptCache) GetOrCreate(scriptContent string, AccountID int64, or
 		return executor, nil
 	}
 
-	// Use configured extensions (nil means all extensions enabled)
-	extensions := c.enabledExtensions
-	if len(extensions) == 0 {
-		// Empty list means use all default extensions
-		extensions = sieveengine.DefaultSieveExtensions
-	}
-
 	// Create new executor with configured extensions
-	executor, err := sieveengine.NewSieveExecutorWithOracleAndExtensions(scriptContent, AccountID, oracle, extensions)
+	executor, err := sieveengine.NewSieveExecutorWithOracleAndExtensions(scriptContent, AccountID, oracle, c.extensions())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create sieve executor: %w", err)
 	}
@@ -223,11 +234,16 @@ func (c *SieveScriptCache) GetOrCreate(scriptContent string, AccountID int64, or
 	return executor, nil
 }
 
-// GetOrCreateWithMetadata attempts to get a cached executor with validation, or creates and caches it if not found
-func (c *SieveScriptCache) GetOrCreateWithMetadata(scriptContent string, scriptID int64, updatedAt time.Time, AccountID int64, oracle sieveengine.VacationOracle) (sieveengine.Executor, error) {
+// GetOrCreateWithMetadata attempts to get a cached executor with validation, or creates and caches it if not found.
+// The script is compiled with the given extensions, or with the extensions enabled on the server if nil.
+func (c *SieveScriptCache) GetOrCreateWithMetadata(scriptContent string, extensions []string, scriptID int64, updatedAt time.Time, AccountID int64, oracle sieveengine.VacationOracle) (sieveengine.Executor, error) {
+	if extensions == nil {
+		extensions = c.extensions()
+	}
+
 	c.mu.Lock()
 
-	key := hashScript(scriptContent)
+	key := hashScript(scriptContent, extensions)
 	entry, exists := c.cache[key]
 
 	// Check if we have a valid cached entry
@@ -250,21 +266,13 @@ func (c *SieveScriptCache) GetOrCreateWithMetadata(scriptContent string, scriptI
 
 	c.mu.Unlock()
 
-	// Use configured extensions (nil means all extensions enabled)
-	extensions := c.enabledExtensions
-	if len(extensions) == 0 {
-		// Empty list means use all default extensions
-		extensions = sieveengine.DefaultSieveExtensions
-	}
-
-	// Create new executor with configured extensions
 	executor, err := sieveengine.NewSieveExecutorWithOracleAndExtensions(scriptContent, AccountID, oracle, extensions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create sieve executor: %w", err)
 	}
 
 	// Cache it with metadata
-	c.PutWithMetadata(scriptContent, executor, scriptID, updatedAt)
+	c.putWithKey(key, executor, scriptID, updatedAt)
 
 	return executor, nil
 }
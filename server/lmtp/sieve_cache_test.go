@@ -0,0 +1,28 @@
+package lmtp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSieveScriptCacheExtensions(t *testing.T) {
+	cache := NewSieveScriptCache(10, time.Minute, nil)
+	defer cache.Stop()
+
+	script := "require [\"vacation\"];\nvacation \"Away\";"
+	updatedAt := time.Now()
+
+	if _, err := cache.GetOrCreateWithMetadata(script, nil, 1, updatedAt, 1, nil); err != nil {
+		t.Fatalf("GetOrCreateWithMetadata() with server extensions = %v", err)
+	}
+
+	// A domain that does not allow vacation must not get the executor
+	// compiled for the server extensions
+	if _, err := cache.GetOrCreateWithMetadata(script, []string{"fileinto"}, 1, updatedAt, 1, nil); err == nil {
+		t.Error("GetOrCreateWithMetadata() with fileinto only succeeded, want error")
+	}
+
+	if _, err := cache.GetOrCreateWithMetadata(script, nil, 1, updatedAt, 1, nil); err != nil {
+		t.Errorf("GetOrCreateWithMetadata() with server extensions after failure = %v", err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/emersion/go-message"
 	"github.com/migadu/sora/pkg/resilient"
 	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/sieveengine"
 )
 
 // shouldSuppressVacation implements RFC 5230 §4.5 mandatory suppression rules
@@ -68,7 +69,8 @@ func shouldSuppressVacation(sender *server.Address, originalMessage *message.Ent
 	return "" // No suppression needed
 }
 
-// dbVacationOracle implements the sieveengine.VacationOracle interface using the database.
+// dbVacationOracle implements the sieveengine.VacationOracle and
+// sieveengine.NotifyOracle interfaces using the database.
 type dbVacationOracle struct {
 	rdb *resilient.ResilientDatabase
 }
@@ -92,3 +94,17 @@ func (o *dbVacationOracle) RecordVacationResponseSent(ctx context.Context, Accou
 	// For this example, we'll ignore 'handle' for the DB recording.
 	return o.rdb.RecordVacationResponseWithRetry(ctx, AccountID, originalSender)
 }
+
+// IsNotificationAllowed checks if the account sent fewer than limit Sieve notifications within window.
+func (o *dbVacationOracle) IsNotificationAllowed(ctx context.Context, AccountID int64, limit int, window time.Duration) (bool, error) {
+	count, err := o.rdb.CountRecentSieveNotificationsWithRetry(ctx, AccountID, window)
+	if err != nil {
+		return false, fmt.Errorf("checking db for recent sieve notifications: %w", err)
+	}
+	return count < limit, nil
+}
+
+// RecordNotificationSent records that a Sieve notification has been sent.
+func (o *dbVacationOracle) RecordNotificationSent(ctx context.Context, AccountID int64, method string) error {
+	return o.rdb.RecordSieveNotificationWithRetry(ctx, AccountID, method, sieveengine.NotifyWindow)
+}
@@ -15,15 +15,15 @@ import (
 func TestVacationMessageConstruction(t *testing.T) {
 	tests := []struct {
 		name           string
-		vacationResult sieveengine.Result
+		vacationResult sieveengine.Action
 		expectedFrom   string
 		expectedSubj   string
 		expectedBody   string
 	}{
 		{
 			name: "Basic vacation message",
-			vacationResult: sieveengine.Result{
-				Action:       sieveengine.ActionVacation,
+			vacationResult: sieveengine.Action{
+				Type:         sieveengine.ActionVacation,
 				VacationFrom: "user@example.com",
 				VacationSubj: "Out of Office",
 				VacationMsg:  "I'm away. Will respond when I return.",
@@ -34,8 +34,8 @@ func TestVacationMessageConstruction(t *testing.T) {
 		},
 		{
 			name: "Vacation with multiline body",
-			vacationResult: sieveengine.Result{
-				Action:       sieveengine.ActionVacation,
+			vacationResult: sieveengine.Action{
+				Type:         sieveengine.ActionVacation,
 				VacationFrom: "user@example.com",
 				VacationSubj: "Auto Reply",
 				VacationMsg:  "Thank you for your email.\n\nI am currently out of the office.\nI will respond when I return.",
@@ -46,8 +46,8 @@ func TestVacationMessageConstruction(t *testing.T) {
 		},
 		{
 			name: "Vacation with special characters",
-			vacationResult: sieveengine.Result{
-				Action:       sieveengine.ActionVacation,
+			vacationResult: sieveengine.Action{
+				Type:         sieveengine.ActionVacation,
 				VacationFrom: "user@example.com",
 				VacationSubj: "Out of Office: Réponse automatique",
 				VacationMsg:  "Bonjour,\n\nJe suis absent(e). Réponse différée.\n\nMerci!",
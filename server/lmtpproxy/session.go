@@ -860,6 +860,19 @@ func (s *Session) handleRecipient(to string, lookupStart time.Time) error {
 	// Use GetActiveAccountIDByAddressWithRetry which properly handles ErrUserNotFound
 	// as a business logic error (not a circuit breaker failure)
 	accountID, err := s.server.rdb.GetActiveAccountIDByAddressWithRetry(dbCtx, s.username)
+	if errors.Is(err, consts.ErrUserNotFound) && !errors.Is(err, consts.ErrDomainSuspended) && !errors.Is(err, consts.ErrAccountSuspended) {
+		// Aliases and catch-all addresses are expanded by the backend. Route
+		// by the first local target so that affinity follows that account.
+		if targets, aliasErr := s.server.rdb.ResolveAliasWithRetry(dbCtx, s.username); aliasErr == nil {
+			accountID, err = 0, nil
+			for _, target := range targets {
+				if target.IsLocal() {
+					accountID = target.AccountID
+					break
+				}
+			}
+		}
+	}
 	if err != nil {
 		// Check if error is due to session context cancellation (server shutdown)
 		// Note: Must check s.ctx.Err(), not just the query error, because the query context
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/metrics"
+)
+
+// MailboxChangeListener delivers mailbox change signals published by the
+// database writers. ListenMailboxChanges blocks until ctx is cancelled or the
+// underlying connection fails.
+type MailboxChangeListener interface {
+	ListenMailboxChanges(ctx context.Context, onListening func(), handler func(mailboxID int64)) error
+}
+
+// MailboxNotifier fans out mailbox change signals to the sessions waiting on
+// a mailbox (IDLE, NOTIFY). Signals carry no data; subscribers are expected to
+// poll the mailbox when woken up.
+type MailboxNotifier struct {
+	mu          sync.Mutex
+	subscribers map[int64]map[chan struct{}]struct{} // mailboxID -> wake-up channels
+
+	listening atomic.Bool
+}
+
+// NewMailboxNotifier creates a notifier without a listener. Run must be
+// started for signals from other nodes to arrive.
+func NewMailboxNotifier() *MailboxNotifier {
+	return &MailboxNotifier{
+		subscribers: make(map[int64]map[chan struct{}]struct{}),
+	}
+}
+
+// Subscribe returns a channel that receives a value whenever mailboxID
+// changes, and a function that cancels the subscription. Signals are
+// coalesced: a subscriber that is busy receives at most one pending signal.
+func (n *MailboxNotifier) Subscribe(mailboxID int64) (<-chan struct{}, func()) {
+	return n.SubscribeMany([]int64{mailboxID})
+}
+
+// SubscribeMany is like Subscribe, but the returned channel receives a value
+// whenever any of mailboxIDs changes.
+func (n *MailboxNotifier) SubscribeMany(mailboxIDs []int64) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	n.mu.Lock()
+	for _, mailboxID := range mailboxIDs {
+		subs, ok := n.subscribers[mailboxID]
+		if !ok {
+			subs = make(map[chan struct{}]struct{})
+			n.subscribers[mailboxID] = subs
+		}
+		subs[ch] = struct{}{}
+	}
+	n.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			n.mu.Lock()
+			for _, mailboxID := range mailboxIDs {
+				if subs, ok := n.subscribers[mailboxID]; ok {
+					delete(subs, ch)
+					if len(subs) == 0 {
+						delete(n.subscribers, mailboxID)
+					}
+				}
+			}
+			n.mu.Unlock()
+		})
+	}
+}
+
+// Notify wakes up all subscribers of mailboxID.
+func (n *MailboxNotifier) Notify(mailboxID int64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for ch := range n.subscribers[mailboxID] {
+		select {
+		case ch <- struct{}{}:
+		default: // A signal is already pending
+		}
+	}
+}
+
+// notifyAll wakes up every subscriber, used after signals may have been lost.
+func (n *MailboxNotifier) notifyAll() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, subs := range n.subscribers {
+		for ch := range subs {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// Active reports whether the notifier is connected to its listener. While it
+// is not, subscribers must fall back to regular polling.
+func (n *MailboxNotifier) Active() bool {
+	return n != nil && n.listening.Load()
+}
+
+// Subscribers returns the number of mailboxes with at least one subscriber.
+func (n *MailboxNotifier) Subscribers() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.subscribers)
+}
+
+// Run listens for mailbox change signals until ctx is cancelled, reconnecting
+// with backoff when the listener fails. After a reconnect all subscribers are
+// woken up once, since signals sent while disconnected are lost.
+func (n *MailboxNotifier) Run(ctx context.Context, listener MailboxChangeListener) {
+	const (
+		minBackoff = time.Second
+		maxBackoff = 30 * time.Second
+	)
+	backoff := minBackoff
+
+	for {
+		err := listener.ListenMailboxChanges(ctx,
+			func() {
+				n.listening.Store(true)
+				metrics.MailboxNotifierListening.Set(1)
+				n.notifyAll()
+				backoff = minBackoff
+				logger.Info("Mailbox notifier: listening for mailbox changes")
+			},
+			func(mailboxID int64) {
+				metrics.MailboxChangeSignals.Inc()
+				n.Notify(mailboxID)
+			})
+
+		n.listening.Store(false)
+		metrics.MailboxNotifierListening.Set(0)
+
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Warn("Mailbox notifier: listener failed, falling back to polling", "error", err, "retry_in", backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMailboxNotifier_NotifyCoalesces(t *testing.T) {
+	n := NewMailboxNotifier()
+
+	ch, unsubscribe := n.Subscribe(1)
+	other, unsubscribeOther := n.Subscribe(2)
+	defer unsubscribeOther()
+
+	n.Notify(1)
+	n.Notify(1) // Coalesced with the pending signal
+
+	select {
+	case <-ch:
+	default:
+		t.Fatal("expected a signal for mailbox 1")
+	}
+	select {
+	case <-ch:
+		t.Fatal("signals should be coalesced")
+	default:
+	}
+	select {
+	case <-other:
+		t.Fatal("mailbox 2 should not be signalled")
+	default:
+	}
+
+	unsubscribe()
+	unsubscribe() // Idempotent
+	if got := n.Subscribers(); got != 1 {
+		t.Errorf("expected 1 subscribed mailbox, got %d", got)
+	}
+	n.Notify(1) // No subscribers left, must not block
+}
+
+func TestMailboxNotifier_SubscribeMany(t *testing.T) {
+	n := NewMailboxNotifier()
+
+	ch, unsubscribe := n.SubscribeMany([]int64{1, 2})
+	single, unsubscribeSingle := n.Subscribe(2)
+	defer unsubscribeSingle()
+
+	n.Notify(2)
+	select {
+	case <-ch:
+	default:
+		t.Fatal("expected a signal for mailbox 2")
+	}
+	select {
+	case <-single:
+	default:
+		t.Fatal("single subscriber of mailbox 2 should be signalled too")
+	}
+
+	unsubscribe()
+	if got := n.Subscribers(); got != 1 {
+		t.Errorf("expected 1 subscribed mailbox after unsubscribe, got %d", got)
+	}
+}
+
+type fakeMailboxListener struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (f *fakeMailboxListener) ListenMailboxChanges(ctx context.Context, onListening func(), handler func(int64)) error {
+	f.mu.Lock()
+	f.calls++
+	call := f.calls
+	f.mu.Unlock()
+
+	if call == 1 {
+		return errors.New("connection refused")
+	}
+	onListening()
+	handler(7)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestMailboxNotifier_RunReconnectsAndDelivers(t *testing.T) {
+	n := NewMailboxNotifier()
+	ch, unsubscribe := n.Subscribe(7)
+	defer unsubscribe()
+
+	if n.Active() {
+		t.Fatal("notifier should not be active before Run")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	listener := &fakeMailboxListener{}
+	finished := make(chan struct{})
+	go func() {
+		n.Run(ctx, listener)
+		close(finished)
+	}()
+
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a signal after the listener reconnected")
+	}
+	if !n.Active() {
+		t.Error("notifier should be active while listening")
+	}
+
+	cancel()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+	if n.Active() {
+		t.Error("notifier should be inactive after Run returned")
+	}
+}
+
+func TestMailboxNotifier_NilIsInactive(t *testing.T) {
+	var n *MailboxNotifier
+	if n.Active() {
+		t.Error("nil notifier must report inactive")
+	}
+}
@@ -2,11 +2,14 @@ package managesieve
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 )
 
 // SupportedExtensions lists all SIEVE extensions that the underlying
-// go-sieve library (github.com/migadu/go-sieve) can validate and execute.
+// go-sieve library (github.com/migadu/go-sieve) can validate and execute,
+// and those Sora implements on top of it (reject, ereject, enotify,
+// spamtest, spamtestplus, virustest and body, see pkg/sieveext).
 //
 // This is the authoritative list of extensions available in Sora.
 // Extensions not in this list will cause script validation to fail.
@@ -28,19 +31,26 @@ var SupportedExtensions = []string{
 	"comparator-i;unicode-casemap", // RFC 4790 - Unicode case-insensitive
 
 	// Common extensions
-	"imap4flags", // RFC 5232 - IMAP flag manipulation
-	"variables",  // RFC 5229 - Variable support
-	"relational", // RFC 5231 - Relational tests (gt, lt, etc.)
-	"vacation",   // RFC 5230 - Vacation auto-responder
-	"copy",       // RFC 3894 - Copy extension for redirect and fileinto
-	"regex",      // draft-murchison-sieve-regex - Regular expression match type
-	"date",       // RFC 5260 - Date and index extensions - date test
-	"index",      // RFC 5260 - Date and index extensions - header indexing
-	"mailbox",    // RFC 5490 - Mailbox existence test
-	"subaddress", // RFC 5233 - Subaddress extension (user+detail@domain)
+	"imap4flags",   // RFC 5232 - IMAP flag manipulation
+	"variables",    // RFC 5229 - Variable support
+	"relational",   // RFC 5231 - Relational tests (gt, lt, etc.)
+	"vacation",     // RFC 5230 - Vacation auto-responder
+	"copy",         // RFC 3894 - Copy extension for redirect and fileinto
+	"regex",        // draft-murchison-sieve-regex - Regular expression match type
+	"date",         // RFC 5260 - Date and index extensions - date test
+	"index",        // RFC 5260 - Date and index extensions - header indexing
+	"mailbox",      // RFC 5490 - Mailbox existence test
+	"subaddress",   // RFC 5233 - Subaddress extension (user+detail@domain)
+	"spamtest",     // RFC 5235 - Spam score from the upstream filter
+	"spamtestplus", // RFC 5235 - Spam score as a percentage
+	"virustest",    // RFC 5235 - Virus status from the upstream scanner
+	"body",         // RFC 5173 - Tests on the message body
 
 	// Security-sensitive extensions (available but not enabled by default)
 	"editheader", // RFC 5293 - Editheader extension - add/delete headers
+	"reject",     // RFC 5429 - Refuse delivery, may cause backscatter
+	"ereject",    // RFC 5429 - Refuse delivery in the LMTP transaction
+	"enotify",    // RFC 5435 - Notifications, mailto method only (RFC 5436)
 }
 
 // DefaultEnabledExtensions is the safe subset of extensions enabled by default.
@@ -68,6 +78,10 @@ var DefaultEnabledExtensions = []string{
 	"index",
 	"mailbox",
 	"subaddress",
+	"spamtest",
+	"spamtestplus",
+	"virustest",
+	"body",
 }
 
 // ValidateExtensions checks if the provided extensions are supported by go-sieve.
@@ -112,3 +126,12 @@ func GetSieveCapabilities(supportedExtensions []string) []string {
 	copy(capabilities, supportedExtensions)
 	return capabilities
 }
+
+// GetNotifyMethods returns the notification methods to advertise in the
+// NOTIFY capability (RFC 5804 §1.7), none if enotify is not supported.
+func GetNotifyMethods(supportedExtensions []string) []string {
+	if slices.Contains(supportedExtensions, "enotify") {
+		return []string{"mailto"}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package managesieve
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/oauth"
+)
+
+// authenticateOAuth verifies an OAUTHBEARER or XOAUTH2 client response and
+// returns the address and account the token was issued for. On failure it
+// completes the SASL exchange (error challenge and the client's dummy
+// response) and returns the NO response to send.
+func (s *ManageSieveSession) authenticateOAuth(mechanism string, response []byte) (server.Address, int64, string) {
+	fail := func(errMsg string) (server.Address, int64, string) {
+		s.sendResponse("\"" + base64.StdEncoding.EncodeToString(oauth.ErrorChallenge(mechanism)) + "\"\r\n")
+		if _, err := s.reader.ReadString('\n'); err != nil {
+			s.DebugLog("error reading oauth error acknowledgement", "error", err)
+		}
+		return server.Address{}, 0, errMsg
+	}
+
+	authzID, token, err := oauth.ParseResponse(mechanism, response)
+	if err != nil {
+		s.DebugLog("invalid oauth response", "mechanism", mechanism, "error", err)
+		return server.Address{}, 0, "NO Invalid authentication format\r\n"
+	}
+
+	netConn := *s.conn
+	var proxyInfo *server.ProxyProtocolInfo
+	if s.ProxyIP != "" {
+		proxyInfo = &server.ProxyProtocolInfo{
+			SrcIP: s.RemoteIP,
+		}
+	}
+
+	// Apply progressive authentication delay BEFORE any other checks
+	remoteAddr := &server.StringAddr{Addr: s.RemoteIP}
+	server.ApplyAuthenticationDelay(s.ctx, s.server.authLimiter, remoteAddr, "MANAGESIEVE-OAUTH")
+
+	if s.server.authLimiter != nil {
+		if err := s.server.authLimiter.CanAttemptAuthWithProxy(s.ctx, netConn, proxyInfo, authzID); err != nil {
+			s.DebugLog("oauth rate limited", "error", err)
+			return fail("NO Too many authentication attempts. Please try again later.\r\n")
+		}
+	}
+
+	recordFailure := func(user string) {
+		if s.server.authLimiter != nil {
+			s.server.authLimiter.RecordAuthAttemptWithProxy(s.ctx, netConn, proxyInfo, user, false)
+		}
+	}
+
+	username, err := oauth.Authorize(s.ctx, s.server.oauthValidator, authzID, token)
+	if err != nil {
+		if errors.Is(err, oauth.ErrUnavailable) || s.ctx.Err() != nil {
+			s.WarnLog("oauth token validation unavailable", "mechanism", mechanism, "error", err)
+			return fail("NO (TRYLATER) Authentication service temporarily unavailable\r\n")
+		}
+		s.InfoLog("authentication failed", "reason", "invalid_token", "mechanism", mechanism, "authz_id", authzID, "error", err)
+		recordFailure(authzID)
+		return fail("NO Authentication failed\r\n")
+	}
+
+	address, err := server.NewAddress(username)
+	if err != nil {
+		s.InfoLog("authentication failed", "reason", "invalid_token_username", "mechanism", mechanism, "username", username)
+		recordFailure(username)
+		return fail("NO Authentication failed\r\n")
+	}
+
+	accountID, err := s.server.rdb.GetLoginAccountIDByAddressWithRetry(s.ctx, address.BaseAddress())
+	if err != nil {
+		if s.ctx.Err() != nil {
+			s.InfoLog("oauth authentication cancelled due to server shutdown")
+			return fail("NO (TRYLATER) Server shutting down\r\n")
+		}
+		s.InfoLog("authentication failed", "reason", "user_not_found", "mechanism", mechanism, "address", address.BaseAddress())
+		recordFailure(address.BaseAddress())
+		return fail("NO Authentication failed\r\n")
+	}
+
+	if s.server.authLimiter != nil {
+		s.server.authLimiter.RecordAuthAttemptWithProxy(s.ctx, netConn, proxyInfo, address.BaseAddress(), true)
+	}
+
+	return address, accountID, ""
+}
@@ -0,0 +1,66 @@
+package managesieve
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"testing"
+)
+
+func newTestScriptSession(input string, maxScriptSize int64) (*ManageSieveSession, *strings.Builder) {
+	var out strings.Builder
+	return &ManageSieveSession{
+		server: &ManageSieveServer{maxScriptSize: maxScriptSize},
+		reader: bufio.NewReader(strings.NewReader(input)),
+		writer: bufio.NewWriter(&out),
+	}, &out
+}
+
+func TestReadScriptContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		arg      string
+		input    string
+		expected string
+		ok       bool
+		response string
+	}{
+		{name: "Quoted string", arg: `"keep;"`, expected: "keep;", ok: true},
+		{name: "Quoted string with escapes", arg: `"fileinto \"A\";"`, expected: `fileinto "A";`, ok: true},
+		{name: "Literal", arg: "{5+}", input: "keep;", expected: "keep;", ok: true, response: "+\r\n"},
+		{name: "Invalid length", arg: "{x+}", ok: false, response: "NO Invalid literal string length\r\n"},
+		{name: "Short literal", arg: "{10+}", input: "keep;", ok: false, response: "+\r\nNO Failed to read literal string content\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, out := newTestScriptSession(tt.input, 0)
+			content, ok := s.readScriptContent(tt.arg)
+			if ok != tt.ok || content != tt.expected {
+				t.Errorf("Expected %q, %v, got %q, %v", tt.expected, tt.ok, content, ok)
+			}
+			if out.String() != tt.response {
+				t.Errorf("Expected response %q, got %q", tt.response, out.String())
+			}
+		})
+	}
+}
+
+func TestCheckScriptLimits(t *testing.T) {
+	s, out := newTestScriptSession("", 10)
+	if !s.checkScriptSize(10) {
+		t.Error("A script of the maximum size should be accepted")
+	}
+	if s.checkScriptSize(11) {
+		t.Error("A script over the maximum size should be refused")
+	}
+	if !strings.HasPrefix(out.String(), "NO (QUOTA/MAXSIZE)") {
+		t.Errorf("Expected a QUOTA/MAXSIZE response, got %q", out.String())
+	}
+
+	// Without limits, no database lookups are needed
+	s, _ = newTestScriptSession("", 0)
+	if !s.checkScriptSize(1<<30) || !s.checkScriptCount(context.Background(), 1) {
+		t.Error("Scripts should not be limited without limits")
+	}
+}
@@ -16,11 +16,13 @@ import (
 
 	"github.com/migadu/sora/config"
 	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/pkg/events"
 	"github.com/migadu/sora/pkg/lookupcache"
 	"github.com/migadu/sora/pkg/metrics"
 	"github.com/migadu/sora/pkg/resilient"
 	serverPkg "github.com/migadu/sora/server"
 	"github.com/migadu/sora/server/idgen"
+	"github.com/migadu/sora/server/oauth"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -45,6 +47,7 @@ type ManageSieveServer struct {
 	useStartTLS         bool
 	insecureAuth        bool
 	maxScriptSize       int64
+	maxScripts          int      // Maximum number of scripts per account (0 = unlimited)
 	supportedExtensions []string // List of supported Sieve extensions
 	masterUsername      []byte
 	masterPassword      []byte
@@ -67,6 +70,9 @@ type ManageSieveServer struct {
 	// Authentication rate limiting
 	authLimiter serverPkg.AuthLimiter
 
+	// OAUTHBEARER/XOAUTH2 token validation (nil when disabled)
+	oauthValidator oauth.Validator
+
 	// Authentication cache (wraps rdb authentication calls)
 	lookupCache *lookupcache.LookupCache
 
@@ -98,6 +104,7 @@ type ManageSieveServerOptions struct {
 	TLSUseStartTLS              bool
 	TLSConfig                   *tls.Config // Global TLS config from TLS manager (optional)
 	MaxScriptSize               int64
+	MaxScripts                  int      // Maximum number of scripts per account (0 = unlimited)
 	SupportedExtensions         []string // List of supported Sieve extensions
 	MasterUsername              string
 	MasterPassword              string
@@ -114,6 +121,7 @@ type ManageSieveServerOptions struct {
 	TrustedNetworks             []string // Global trusted networks for parameter forwarding
 	AuthRateLimit               serverPkg.AuthRateLimiterConfig
 	LookupCache                 *config.LookupCacheConfig // Authentication cache configuration
+	OAuth                       *config.OAuthConfig       // OAUTHBEARER/XOAUTH2 token validation (nil = disabled)
 	AuthIdleTimeout             time.Duration             // Idle timeout during authentication phase (pre-auth only, 0 = disabled)
 	CommandTimeout              time.Duration             // Maximum idle time before disconnection
 	AbsoluteSessionTimeout      time.Duration             // Maximum total session duration (0 = use default 30m)
@@ -158,6 +166,12 @@ func New(appCtx context.Context, name, hostname, addr string, rdb *resilient.Res
 		options.TLSUseStartTLS = false
 	}
 
+	oauthValidator, err := oauth.New(options.OAuth)
+	if err != nil {
+		serverCancel()
+		return nil, fmt.Errorf("failed to initialize OAuth: %w", err)
+	}
+
 	// Initialize authentication rate limiter with trusted networks
 	authLimiter := serverPkg.NewAuthRateLimiterWithTrustedNetworks("ManageSieve", name, hostname, options.AuthRateLimit, options.TrustedNetworks)
 	serverPkg.RegisterRateLimiter("managesieve", name, authLimiter)
@@ -226,6 +240,7 @@ func New(appCtx context.Context, name, hostname, addr string, rdb *resilient.Res
 		useStartTLS:            options.TLSUseStartTLS,
 		insecureAuth:           options.InsecureAuth || !options.TLS, // Auto-enable when TLS not configured
 		maxScriptSize:          options.MaxScriptSize,
+		maxScripts:             options.MaxScripts,
 		supportedExtensions:    options.SupportedExtensions,
 		masterUsername:         []byte(options.MasterUsername),
 		masterPassword:         []byte(options.MasterPassword),
@@ -233,6 +248,7 @@ func New(appCtx context.Context, name, hostname, addr string, rdb *resilient.Res
 		masterSASLPassword:     []byte(options.MasterSASLPassword),
 		proxyReader:            proxyReader,
 		authLimiter:            authLimiter,
+		oauthValidator:         oauthValidator,
 		lookupCache:            lookupCache,
 		authIdleTimeout:        options.AuthIdleTimeout,
 		commandTimeout:         options.CommandTimeout,
@@ -562,6 +578,10 @@ func (s *ManageSieveServer) Start(errChan chan error) {
 // SetConnTracker sets the connection tracker for this server
 func (s *ManageSieveServer) SetConnTracker(tracker *serverPkg.ConnectionTracker) {
 	s.connTracker = tracker
+	// Drop cached credentials of kicked users (e.g. on account suspension)
+	if tracker != nil && s.lookupCache != nil {
+		tracker.SetLookupCache(s.lookupCache)
+	}
 }
 
 func (s *ManageSieveServer) Close() {
@@ -769,6 +789,10 @@ func (s *ManageSieveServer) ReloadConfig(cfg config.ServerConfig) error {
 		s.maxScriptSize = maxSize
 		reloaded = append(reloaded, "max_script_size")
 	}
+	if cfg.MaxScripts != s.maxScripts {
+		s.maxScripts = cfg.MaxScripts
+		reloaded = append(reloaded, "max_scripts")
+	}
 	if cfg.MasterSASLUsername != string(s.masterSASLUsername) {
 		s.masterSASLUsername = []byte(cfg.MasterSASLUsername)
 		reloaded = append(reloaded, "master_sasl_username")
@@ -793,6 +817,8 @@ func (s *ManageSieveServer) GetLookupCache() *lookupcache.LookupCache {
 // This method wraps the database authentication with an optional lookup cache layer.
 // The cache decorates the database call - this is the proper architectural pattern.
 func (s *ManageSieveServer) Authenticate(ctx context.Context, address, password string) (accountID int64, err error) {
+	defer func() { events.PublishAuth(ctx, address, accountID, err) }()
+
 	// Check context before any work
 	if err := ctx.Err(); err != nil {
 		return 0, err
@@ -819,7 +845,7 @@ func (s *ManageSieveServer) Authenticate(ctx context.Context, address, password
 	}
 
 	// Fetch credentials from database (no caching - we handle that here)
-	accountID, hashedPassword, err := s.rdb.GetCredentialForAuthWithRetry(ctx, address)
+	creds, err := s.rdb.GetAuthCredentialsWithRetry(ctx, address)
 	if err != nil {
 		// Cache negative result if enabled (user not found)
 		if s.lookupCache != nil {
@@ -830,8 +856,13 @@ func (s *ManageSieveServer) Authenticate(ctx context.Context, address, password
 		return 0, err
 	}
 
-	// Verify password
-	if err := db.VerifyPassword(hashedPassword, password); err != nil {
+	accountID = creds.AccountID
+	hashedPassword := creds.HashedPassword
+
+	// Verify password or app password
+	protocol, remoteIP := events.SourceFromContext(ctx)
+	app, err := creds.Verify(password, protocol, remoteIP)
+	if err != nil {
 		// Cache negative result for invalid password if enabled
 		if s.lookupCache != nil {
 			// AuthInvalidPassword = 2 (from lookupcache package)
@@ -841,6 +872,18 @@ func (s *ManageSieveServer) Authenticate(ctx context.Context, address, password
 		return 0, err
 	}
 
+	if app != nil {
+		s.rdb.RecordAppPasswordUse(app.ID, remoteIP)
+		// The cache does not know the client address, so IP-restricted app
+		// passwords are always checked against the database. The cached hash
+		// is of the password as typed, which may differ from the stored form.
+		if s.lookupCache != nil && len(app.AllowedIPs) == 0 {
+			s.lookupCache.SetSuccess(address, accountID, db.GenerateSHA512Hash(password), password)
+		}
+		logger.Info("authentication successful", "address", address, "account_id", accountID, "app_password_id", app.ID, "cached", false, "method", "main_db")
+		return accountID, nil
+	}
+
 	// Cache successful authentication if enabled
 	if s.lookupCache != nil {
 		s.lookupCache.SetSuccess(address, accountID, hashedPassword, password)
@@ -10,16 +10,19 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/foxcpp/go-sieve"
 	"github.com/migadu/sora/consts"
 	"github.com/migadu/sora/helpers"
 	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/events"
 	"github.com/migadu/sora/pkg/metrics"
+	"github.com/migadu/sora/pkg/sieveext"
 	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/oauth"
 )
 
 type ManageSieveSession struct {
@@ -61,6 +64,9 @@ func (s *ManageSieveSession) sendCapabilities() {
 	capabilities := GetSieveCapabilities(s.server.supportedExtensions)
 	extensionsStr := strings.Join(capabilities, " ")
 	s.sendRawLine(fmt.Sprintf("\"SIEVE\" \"%s\"", extensionsStr))
+	if methods := GetNotifyMethods(s.server.supportedExtensions); len(methods) > 0 {
+		s.sendRawLine(fmt.Sprintf("\"NOTIFY\" \"%s\"", strings.Join(methods, " ")))
+	}
 
 	if s.server.tlsConfig != nil && s.server.useStartTLS && !s.isTLS {
 		s.sendRawLine("\"STARTTLS\"")
@@ -68,11 +74,17 @@ func (s *ManageSieveSession) sendCapabilities() {
 		s.sendRawLine("\"SASL\" \"\"")
 	} else if s.isTLS || s.server.insecureAuth {
 		// After STARTTLS or on implicit TLS: Advertise available SASL mechanisms
-		s.sendRawLine("\"SASL\" \"PLAIN\"")
+		if s.server.oauthValidator != nil {
+			s.sendRawLine("\"SASL\" \"PLAIN OAUTHBEARER XOAUTH2\"")
+		} else {
+			s.sendRawLine("\"SASL\" \"PLAIN\"")
+		}
 	}
 	if s.server.maxScriptSize > 0 {
 		s.sendRawLine(fmt.Sprintf("\"MAXSCRIPTSIZE\" \"%d\"", s.server.maxScriptSize))
 	}
+	// RFC 5804 §1.7: VERSION "1.0" announces CHECKSCRIPT, RENAMESCRIPT and NOOP
+	s.sendRawLine("\"VERSION\" \"1.0\"")
 }
 
 func (s *ManageSieveSession) handleConnection() {
@@ -279,7 +291,7 @@ func (s *ManageSieveSession) handleConnection() {
 
 			// If master password didn't work, try regular authentication
 			if !authSuccess {
-				accountID, err = s.server.Authenticate(s.ctx, address.BaseAddress(), password)
+				accountID, err = s.server.Authenticate(events.WithSource(s.ctx, "managesieve", s.RemoteIP), address.BaseAddress(), password)
 				if err != nil {
 					// Record failed attempt
 					if s.server.authLimiter != nil {
@@ -423,34 +435,96 @@ func (s *ManageSieveSession) handleConnection() {
 				continue
 			}
 			scriptName := parts[1]
-			scriptContent := parts[2]
-
-			// Check if script content is a literal string {length+}
-			if strings.HasPrefix(scriptContent, "{") && strings.HasSuffix(scriptContent, "+}") {
-				// Extract length from {length+}
-				lengthStr := strings.TrimSuffix(strings.TrimPrefix(scriptContent, "{"), "+}")
-				length := 0
-				if _, err := fmt.Sscanf(lengthStr, "%d", &length); err != nil || length < 0 {
-					s.sendResponse("NO Invalid literal string length\r\n")
-					recordMetrics("failure")
-					continue
-				}
+			scriptContent, ok := s.readScriptContent(parts[2])
+			if !ok {
+				recordMetrics("failure")
+				continue
+			}
 
-				// Send continuation response (+ ready for literal data)
-				s.sendResponse("+\r\n")
+			if s.handlePutScript(scriptName, scriptContent) {
+				recordMetrics("success")
+			} else {
+				recordMetrics("failure")
+			}
 
-				// Read the literal content (length bytes)
-				literalContent := make([]byte, length)
-				n, err := io.ReadFull(s.reader, literalContent)
-				if err != nil || n != length {
-					s.sendResponse("NO Failed to read literal string content\r\n")
-					recordMetrics("failure")
-					continue
-				}
-				scriptContent = string(literalContent)
+		case "CHECKSCRIPT":
+			start := time.Now()
+			recordMetrics := func(status string) {
+				metrics.CommandsTotal.WithLabelValues("managesieve", "CHECKSCRIPT", status).Inc()
+				metrics.CommandDuration.WithLabelValues("managesieve", "CHECKSCRIPT").Observe(time.Since(start).Seconds())
 			}
 
-			if s.handlePutScript(scriptName, scriptContent) {
+			if !s.authenticated {
+				s.sendResponse("NO Not authenticated\r\n")
+				recordMetrics("failure")
+				continue
+			}
+			if len(parts) < 2 {
+				s.sendResponse("NO Syntax: CHECKSCRIPT scriptContent\r\n")
+				recordMetrics("failure")
+				continue
+			}
+			scriptContent, ok := s.readScriptContent(parts[1])
+			if !ok {
+				recordMetrics("failure")
+				continue
+			}
+
+			if s.handleCheckScript(scriptContent) {
+				recordMetrics("success")
+			} else {
+				recordMetrics("failure")
+			}
+
+		case "HAVESPACE":
+			start := time.Now()
+			recordMetrics := func(status string) {
+				metrics.CommandsTotal.WithLabelValues("managesieve", "HAVESPACE", status).Inc()
+				metrics.CommandDuration.WithLabelValues("managesieve", "HAVESPACE").Observe(time.Since(start).Seconds())
+			}
+
+			if !s.authenticated {
+				s.sendResponse("NO Not authenticated\r\n")
+				recordMetrics("failure")
+				continue
+			}
+			if len(parts) < 3 {
+				s.sendResponse("NO Syntax: HAVESPACE scriptName size\r\n")
+				recordMetrics("failure")
+				continue
+			}
+			size, err := strconv.ParseInt(parts[2], 10, 64)
+			if err != nil || size < 0 {
+				s.sendResponse("NO Syntax: HAVESPACE scriptName size\r\n")
+				recordMetrics("failure")
+				continue
+			}
+
+			if s.handleHaveSpace(parts[1], size) {
+				recordMetrics("success")
+			} else {
+				recordMetrics("failure")
+			}
+
+		case "RENAMESCRIPT":
+			start := time.Now()
+			recordMetrics := func(status string) {
+				metrics.CommandsTotal.WithLabelValues("managesieve", "RENAMESCRIPT", status).Inc()
+				metrics.CommandDuration.WithLabelValues("managesieve", "RENAMESCRIPT").Observe(time.Since(start).Seconds())
+			}
+
+			if !s.authenticated {
+				s.sendResponse("NO Not authenticated\r\n")
+				recordMetrics("failure")
+				continue
+			}
+			if len(parts) < 3 {
+				s.sendResponse("NO Syntax: RENAMESCRIPT oldName newName\r\n")
+				recordMetrics("failure")
+				continue
+			}
+
+			if s.handleRenameScript(parts[1], parts[2]) {
 				recordMetrics("success")
 			} else {
 				recordMetrics("failure")
@@ -760,23 +834,12 @@ func (s *ManageSieveSession) handlePutScript(name, content string) bool {
 		return false
 	}
 	accountID := s.AccountID()
+	domain := s.Domain()
 	useMaster := s.useMasterDB
 	release()
 
 	// Phase 2: Validate and perform DB operations
-	if s.server.maxScriptSize > 0 && int64(len(content)) > s.server.maxScriptSize {
-		s.sendResponse(fmt.Sprintf("NO (MAXSCRIPTSIZE) Script size %d exceeds maximum allowed size %d\r\n", len(content), s.server.maxScriptSize))
-		return false
-	}
-
-	scriptReader := strings.NewReader(content)
-	options := sieve.DefaultOptions()
-	// Configure extensions based on server configuration
-	// If no extensions are configured, none are supported
-	options.EnabledExtensions = s.server.supportedExtensions
-	_, err := sieve.Load(scriptReader, options)
-	if err != nil {
-		s.sendResponse(fmt.Sprintf("NO Script validation failed: %v\r\n", err))
+	if !s.checkScriptSize(int64(len(content))) || !s.validateScript(domain, content) {
 		return false
 	}
 
@@ -793,6 +856,9 @@ func (s *ManageSieveSession) handlePutScript(name, content string) bool {
 			return false
 		}
 	}
+	if script == nil && !s.checkScriptCount(readCtx, accountID) {
+		return false
+	}
 
 	var responseMsg string
 	if script != nil {
@@ -834,6 +900,249 @@ func (s *ManageSieveSession) handlePutScript(name, content string) bool {
 	return true
 }
 
+// readScriptContent returns the script argument of PUTSCRIPT or CHECKSCRIPT,
+// a quoted string or a literal string {length+} read from the client. It
+// sends a NO response and returns false if the literal cannot be read.
+func (s *ManageSieveSession) readScriptContent(arg string) (string, bool) {
+	if !strings.HasPrefix(arg, "{") || !strings.HasSuffix(arg, "+}") {
+		return server.UnquoteString(arg), true
+	}
+
+	// Extract length from {length+}
+	lengthStr := strings.TrimSuffix(strings.TrimPrefix(arg, "{"), "+}")
+	length := 0
+	if _, err := fmt.Sscanf(lengthStr, "%d", &length); err != nil || length < 0 {
+		s.sendResponse("NO Invalid literal string length\r\n")
+		return "", false
+	}
+
+	// Send continuation response (+ ready for literal data)
+	s.sendResponse("+\r\n")
+
+	// Read the literal content (length bytes)
+	literalContent := make([]byte, length)
+	n, err := io.ReadFull(s.reader, literalContent)
+	if err != nil || n != length {
+		s.sendResponse("NO Failed to read literal string content\r\n")
+		return "", false
+	}
+	return string(literalContent), true
+}
+
+// checkScriptSize sends a NO response and returns false if a script of the
+// given size exceeds the maximum script size.
+func (s *ManageSieveSession) checkScriptSize(size int64) bool {
+	if s.server.maxScriptSize > 0 && size > s.server.maxScriptSize {
+		s.sendResponse(fmt.Sprintf("NO (QUOTA/MAXSIZE) Script size %d exceeds maximum allowed size %d\r\n", size, s.server.maxScriptSize))
+		return false
+	}
+	return true
+}
+
+// checkScriptCount sends a NO response and returns false if the account
+// already has the maximum number of scripts, so a new one cannot be stored.
+func (s *ManageSieveSession) checkScriptCount(ctx context.Context, accountID int64) bool {
+	if s.server.maxScripts <= 0 {
+		return true
+	}
+	count, err := s.server.rdb.CountUserScriptsWithRetry(ctx, accountID)
+	if err != nil {
+		s.sendResponse("NO (TRYLATER) \"Service temporarily unavailable\"\r\n")
+		return false
+	}
+	if count >= s.server.maxScripts {
+		s.sendResponse(fmt.Sprintf("NO (QUOTA/MAXSCRIPTS) Maximum number of scripts (%d) reached\r\n", s.server.maxScripts))
+		return false
+	}
+	return true
+}
+
+// validateScript sends a NO response and returns false if the script is not
+// valid with the Sieve extensions of the domain.
+func (s *ManageSieveSession) validateScript(domain, content string) bool {
+	extensions, err := s.sieveExtensions(domain)
+	if err != nil {
+		s.sendResponse("NO (TRYLATER) \"Service temporarily unavailable\"\r\n")
+		return false
+	}
+
+	// Extensions are configured by server configuration and domain policy.
+	// If no extensions are configured, none are supported
+	if _, _, err := sieveext.Load(content, extensions); err != nil {
+		s.sendResponse(fmt.Sprintf("NO Script validation failed: %v\r\n", err))
+		return false
+	}
+	return true
+}
+
+// handleCheckScript validates a script without storing it (RFC 5804 §2.12).
+func (s *ManageSieveSession) handleCheckScript(content string) bool {
+	// Check if the context is closing before proceeding.
+	if s.ctx.Err() != nil {
+		s.DebugLog("request aborted", "command", "CHECKSCRIPT")
+		s.sendResponse("NO Session closed\r\n")
+		return false
+	}
+
+	acquired, release := s.mutexHelper.AcquireReadLockWithTimeout()
+	if !acquired {
+		s.WarnLog("failed to acquire read lock", "command", "CHECKSCRIPT")
+		s.sendResponse("NO Server busy, try again later\r\n")
+		return false
+	}
+	domain := s.Domain()
+	release()
+
+	if !s.checkScriptSize(int64(len(content))) || !s.validateScript(domain, content) {
+		return false
+	}
+	s.sendResponse("OK\r\n")
+	return true
+}
+
+// handleHaveSpace reports whether a script with the given name and size could
+// be stored (RFC 5804 §2.5).
+func (s *ManageSieveSession) handleHaveSpace(name string, size int64) bool {
+	// Check if the context is closing before proceeding.
+	if s.ctx.Err() != nil {
+		s.DebugLog("request aborted", "command", "HAVESPACE")
+		s.sendResponse("NO Session closed\r\n")
+		return false
+	}
+
+	name = strings.TrimSpace(server.UnquoteString(name))
+	if name == "" {
+		s.sendResponse("NO Script name cannot be empty\r\n")
+		return false
+	}
+
+	acquired, release := s.mutexHelper.AcquireReadLockWithTimeout()
+	if !acquired {
+		s.WarnLog("failed to acquire read lock", "command", "HAVESPACE")
+		s.sendResponse("NO Server busy, try again later\r\n")
+		return false
+	}
+	accountID := s.AccountID()
+	useMaster := s.useMasterDB
+	release()
+
+	if !s.checkScriptSize(size) {
+		return false
+	}
+
+	if s.server.maxScripts > 0 {
+		readCtx := s.ctx
+		if useMaster {
+			readCtx = context.WithValue(s.ctx, consts.UseMasterDBKey, true)
+		}
+
+		// Replacing an existing script does not add one
+		_, err := s.server.rdb.GetScriptByNameWithRetry(readCtx, name, accountID)
+		if err != nil {
+			if err != consts.ErrDBNotFound {
+				s.sendResponse("NO (TRYLATER) \"Service temporarily unavailable\"\r\n")
+				return false
+			}
+			if !s.checkScriptCount(readCtx, accountID) {
+				return false
+			}
+		}
+	}
+
+	s.sendResponse("OK\r\n")
+	return true
+}
+
+// handleRenameScript renames a script, keeping it active if it is
+// (RFC 5804 §2.11.1).
+func (s *ManageSieveSession) handleRenameScript(oldName, newName string) bool {
+	// Check if the context is closing before proceeding.
+	if s.ctx.Err() != nil {
+		s.DebugLog("request aborted", "command", "RENAMESCRIPT")
+		s.sendResponse("NO Session closed\r\n")
+		return false
+	}
+
+	oldName = strings.TrimSpace(server.UnquoteString(oldName))
+	newName = strings.TrimSpace(server.UnquoteString(newName))
+	if newName == "" {
+		s.sendResponse("NO Script name cannot be empty\r\n")
+		return false
+	}
+
+	// Phase 1: Read session state
+	acquired, release := s.mutexHelper.AcquireReadLockWithTimeout()
+	if !acquired {
+		s.WarnLog("failed to acquire read lock", "command", "RENAMESCRIPT")
+		s.sendResponse("NO Server busy, try again later\r\n")
+		return false
+	}
+	accountID := s.AccountID()
+	useMaster := s.useMasterDB
+	release()
+
+	// Phase 2: DB operations
+	readCtx := s.ctx
+	if useMaster {
+		readCtx = context.WithValue(s.ctx, consts.UseMasterDBKey, true)
+	}
+
+	script, err := s.server.rdb.GetScriptByNameWithRetry(readCtx, oldName, accountID)
+	if err != nil {
+		if err == consts.ErrDBNotFound {
+			s.sendResponse("NO (NONEXISTENT) No such script\r\n")
+			return false
+		}
+		s.sendResponse("NO (TRYLATER) \"Service temporarily unavailable\"\r\n")
+		return false
+	}
+	if oldName == newName {
+		s.sendResponse("OK\r\n")
+		return true
+	}
+
+	_, err = s.server.rdb.GetScriptByNameWithRetry(readCtx, newName, accountID)
+	if err == nil {
+		s.sendResponse("NO (ALREADYEXISTS) A script with the new name already exists\r\n")
+		return false
+	}
+	if err != consts.ErrDBNotFound {
+		s.sendResponse("NO (TRYLATER) \"Service temporarily unavailable\"\r\n")
+		return false
+	}
+
+	if _, err := s.server.rdb.UpdateScriptWithRetry(s.ctx, script.ID, accountID, newName, script.Script); err != nil {
+		s.sendResponse("NO (TRYLATER) \"Service temporarily unavailable\"\r\n")
+		return false
+	}
+
+	// Phase 3: Update session state
+	acquired, release = s.mutexHelper.AcquireWriteLockWithTimeout()
+	if !acquired {
+		s.WarnLog("failed to acquire write lock", "command", "RENAMESCRIPT", "purpose", "pin_session")
+	} else {
+		s.useMasterDB = true
+		release()
+	}
+	s.sendResponse("OK\r\n")
+	return true
+}
+
+// sieveExtensions returns the Sieve extensions that scripts of the domain may
+// use: the extensions enabled on the server, restricted by the domain policy
+// if the domain has one.
+func (s *ManageSieveSession) sieveExtensions(domain string) ([]string, error) {
+	d, err := s.server.rdb.GetDomainWithRetry(s.ctx, domain)
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			return s.server.supportedExtensions, nil
+		}
+		s.WarnLog("failed to get domain policy", "domain", domain, "error", err)
+		return nil, err
+	}
+	return d.AllowedSieveExtensions(s.server.supportedExtensions), nil
+}
+
 func (s *ManageSieveSession) handleSetActive(name string) bool {
 	start := time.Now()
 	// Check if the context is closing before proceeding.
@@ -854,6 +1163,7 @@ func (s *ManageSieveSession) handleSetActive(name string) bool {
 		return false
 	}
 	accountID := s.AccountID()
+	domain := s.Domain()
 	useMaster := s.useMasterDB
 	release()
 
@@ -896,14 +1206,7 @@ func (s *ManageSieveSession) handleSetActive(name string) bool {
 	}
 
 	// Validate the script before activating it
-	scriptReader := strings.NewReader(script.Script)
-	options := sieve.DefaultOptions()
-	// Configure extensions based on server configuration
-	// If no extensions are configured, none are supported
-	options.EnabledExtensions = s.server.supportedExtensions
-	_, err = sieve.Load(scriptReader, options)
-	if err != nil {
-		s.sendResponse(fmt.Sprintf("NO Script validation failed: %v\r\n", err))
+	if !s.validateScript(domain, script.Script) {
 		return false
 	}
 
@@ -1078,7 +1381,7 @@ func (s *ManageSieveSession) handleAuthenticate(parts []string) bool {
 	// Remove quotes from mechanism if present
 	mechanism := server.UnquoteString(parts[1])
 	mechanism = strings.ToUpper(mechanism)
-	if mechanism != "PLAIN" {
+	if mechanism != "PLAIN" && (!oauth.IsMechanism(mechanism) || s.server.oauthValidator == nil) {
 		s.sendResponse("NO Unsupported authentication mechanism\r\n")
 		return false
 	}
@@ -1153,6 +1456,19 @@ func (s *ManageSieveSession) handleAuthenticate(parts []string) bool {
 		return false
 	}
 
+	if mechanism != "PLAIN" {
+		address, accountID, errMsg := s.authenticateOAuth(mechanism, decoded)
+		if errMsg != "" {
+			s.sendResponse(errMsg)
+			return false
+		}
+		if !s.completeAuthentication(address, accountID, "oauth", start) {
+			return false
+		}
+		success = true
+		return true
+	}
+
 	// Parse SASL PLAIN format: [authz-id] \0 authn-id \0 password
 	parts = strings.Split(string(decoded), "\x00")
 	if len(parts) != 3 {
@@ -1295,7 +1611,7 @@ func (s *ManageSieveSession) handleAuthenticate(parts []string) bool {
 			}
 		}
 
-		accountID, err = s.server.Authenticate(s.ctx, address.BaseAddress(), password)
+		accountID, err = s.server.Authenticate(events.WithSource(s.ctx, "managesieve", s.RemoteIP), address.BaseAddress(), password)
 		if err != nil {
 			// Record failed attempt
 			if s.server.authLimiter != nil {
@@ -1314,6 +1630,21 @@ func (s *ManageSieveSession) handleAuthenticate(parts []string) bool {
 		targetAddress = &address
 	}
 
+	method := ""
+	if impersonating {
+		method = "master"
+	}
+	if !s.completeAuthentication(*targetAddress, accountID, method, start) {
+		return false
+	}
+	success = true
+	return true
+}
+
+// completeAuthentication marks the session as authenticated for the account
+// and sends the success response. method is logged for logins that do not go
+// through Authenticate, which logs on its own.
+func (s *ManageSieveSession) completeAuthentication(address server.Address, accountID int64, method string, start time.Time) bool {
 	// Check if the context was cancelled during authentication logic
 	if s.ctx.Err() != nil {
 		s.DebugLog("request aborted, aborting session update")
@@ -1329,17 +1660,17 @@ func (s *ManageSieveSession) handleAuthenticate(parts []string) bool {
 	}
 	defer release()
 
-	s.User = server.NewUser(*targetAddress, accountID)
+	s.User = server.NewUser(address, accountID)
 
 	// Increment authenticated connections counter
 	s.server.authenticatedConnections.Add(1)
 
 	// Log authentication success with standardized format
 	// Note: Regular auth via Authenticate() already logs in server.go with cached/method
-	// For master SASL auth, we log here with method=master
-	if impersonating {
+	// For master SASL and OAuth auth, we log here with the method
+	if method != "" {
 		duration := time.Since(start)
-		s.InfoLog("authentication successful", "address", targetAddress.BaseAddress(), "account_id", accountID, "cached", false, "method", "master", "duration", fmt.Sprintf("%.3fs", duration.Seconds()))
+		s.InfoLog("authentication successful", "address", address.BaseAddress(), "account_id", accountID, "cached", false, "method", method, "duration", fmt.Sprintf("%.3fs", duration.Seconds()))
 	}
 
 	// Track successful authentication
@@ -1352,7 +1683,7 @@ func (s *ManageSieveSession) handleAuthenticate(parts []string) bool {
 	s.authenticated = true
 
 	// Register connection for tracking
-	s.registerConnection(targetAddress.FullAddress())
+	s.registerConnection(address.FullAddress())
 
 	// Start termination poller to check for kick commands
 	s.startTerminationPoller()
@@ -1364,7 +1695,6 @@ func (s *ManageSieveSession) handleAuthenticate(parts []string) bool {
 	}
 
 	s.sendResponse("OK Authenticated\r\n")
-	success = true
 	return true
 }
 
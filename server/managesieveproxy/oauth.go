@@ -0,0 +1,172 @@
+package managesieveproxy
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/metrics"
+	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/oauth"
+	"github.com/migadu/sora/server/proxy"
+)
+
+// handleOAuthAuthenticate runs an OAUTHBEARER or XOAUTH2 exchange for the
+// decoded client response. It returns true once the user is known and routed;
+// on failure the NO response has already been sent.
+func (s *Session) handleOAuthAuthenticate(mechanism string, response []byte, authStart time.Time) bool {
+	authzID, token, err := oauth.ParseResponse(mechanism, response)
+	if err != nil {
+		s.handleAuthError(fmt.Sprintf(`NO "Invalid %s response"`, mechanism))
+		return false
+	}
+
+	if err := s.authenticateOAuth(mechanism, authzID, token, authStart); err != nil {
+		s.DebugLog("authentication failed", "mechanism", mechanism, "error", err)
+
+		// RFC 7628: send the error as a final challenge and wait for the client's dummy response
+		s.sendResponse(`"` + base64.StdEncoding.EncodeToString(oauth.ErrorChallenge(mechanism)) + `"`)
+		if _, err := s.clientReader.ReadString('\n'); err != nil {
+			s.DebugLog("error reading oauth error acknowledgement", "error", err)
+		}
+
+		if server.IsTemporaryAuthFailure(err) {
+			s.sendResponse(`NO (UNAVAILABLE) "Service temporarily unavailable, please try again later"`)
+		} else {
+			s.sendResponse(`NO "Authentication failed"`)
+		}
+		return false
+	}
+	return true
+}
+
+// authenticateOAuth validates a bearer token locally and resolves the account
+// and backend route for its user. Like master username logins, remotelookup is
+// queried with route_only since there is no password to check.
+func (s *Session) authenticateOAuth(mechanism, authzID, token string, authStart time.Time) error {
+	authTimeout := s.server.connManager.GetRemoteLookupTimeout()
+	ctx, cancel := context.WithTimeout(s.ctx, authTimeout)
+	defer cancel()
+
+	// Apply progressive authentication delay BEFORE any other checks
+	remoteAddr := s.clientConn.RemoteAddr()
+	server.ApplyAuthenticationDelay(s.ctx, s.server.authLimiter, remoteAddr, "MANAGESIEVE-PROXY-OAUTH")
+
+	if err := s.server.authLimiter.CanAttemptAuthWithProxy(s.ctx, s.clientConn, nil, authzID); err != nil {
+		metrics.ProtocolErrors.WithLabelValues("managesieve_proxy", "AUTH", "rate_limited", "client_error").Inc()
+		return err
+	}
+
+	recordFailure := func(user string) {
+		s.server.authLimiter.RecordAuthAttemptWithProxy(s.ctx, s.clientConn, s.proxyInfo, user, false)
+		metrics.AuthenticationAttempts.WithLabelValues("managesieve_proxy", s.server.name, s.server.hostname, "failure").Inc()
+	}
+
+	username, err := oauth.Authorize(ctx, s.server.oauthValidator, authzID, token)
+	if err != nil {
+		if s.ctx.Err() != nil {
+			return server.ErrServerShuttingDown
+		}
+		if errors.Is(err, oauth.ErrUnavailable) {
+			s.WarnLog("oauth token validation unavailable", "mechanism", mechanism, "error", err)
+			return server.ErrAuthServiceUnavailable
+		}
+		s.InfoLog("authentication failed", "reason", "invalid_token", "mechanism", mechanism, "error", err)
+		recordFailure(authzID)
+		return consts.ErrAuthenticationFailed
+	}
+
+	address, err := server.NewAddress(username)
+	if err != nil {
+		s.InfoLog("authentication failed", "reason", "invalid_token_username", "mechanism", mechanism, "username", username)
+		recordFailure(username)
+		return consts.ErrAuthenticationFailed
+	}
+	s.username = address.BaseAddress()
+
+	routed := false
+	if s.server.connManager.HasRouting() {
+		clientIP, _ := server.GetHostPortFromAddr(remoteAddr)
+		routingInfo, authResult, err := s.server.connManager.AuthenticateAndRouteWithClientIP(proxy.WithAuthMechanism(ctx, mechanism), address.BaseAddress(), "", clientIP, true)
+		logger.Debug("remotelookup oauth routing", "proto", "managesieve_proxy", "name", s.server.name, "user", address.BaseAddress(), "result", authResult.String(), "error", err)
+
+		if err != nil {
+			if errors.Is(err, proxy.ErrRemoteLookupInvalidResponse) {
+				recordFailure(address.BaseAddress())
+				return fmt.Errorf("remotelookup server error: invalid response")
+			}
+			if errors.Is(err, proxy.ErrRemoteLookupTransient) {
+				if errors.Is(err, server.ErrServerShuttingDown) {
+					return server.ErrServerShuttingDown
+				}
+				s.WarnLog("remotelookup transient error - service unavailable", "error", err)
+				return server.ErrAuthServiceUnavailable
+			}
+			// Unknown error type - fallthrough to main DB
+		} else {
+			switch authResult {
+			case proxy.AuthSuccess:
+				s.accountID = routingInfo.AccountID
+				s.isRemoteLookupAccount = routingInfo.IsRemoteLookupAccount
+				s.routingInfo = routingInfo
+				if routingInfo.ActualEmail != "" {
+					s.username = routingInfo.ActualEmail
+				}
+				routed = true
+
+			case proxy.AuthFailed:
+				s.InfoLog("authentication failed", "reason", "remotelookup_rejected", "mechanism", mechanism)
+				recordFailure(address.BaseAddress())
+				return consts.ErrAuthenticationFailed
+
+			case proxy.AuthTemporarilyUnavailable:
+				s.WarnLog("remotelookup service temporarily unavailable")
+				return server.ErrAuthServiceUnavailable
+
+			case proxy.AuthUserNotFound:
+				if s.server.remotelookupConfig == nil || !s.server.remotelookupConfig.ShouldLookupLocalUsers() {
+					s.InfoLog("user not found in remotelookup, local lookup disabled - rejecting", "mechanism", mechanism)
+					recordFailure(address.BaseAddress())
+					return consts.ErrAuthenticationFailed
+				}
+				// Fallthrough to main DB
+			}
+		}
+	}
+
+	if !routed {
+		accountID, err := s.server.rdb.GetLoginAccountIDByAddressWithRetry(ctx, address.BaseAddress())
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return server.ErrServerShuttingDown
+			}
+			s.InfoLog("authentication failed", "reason", "user_not_found", "mechanism", mechanism, "user", address.BaseAddress())
+			recordFailure(address.BaseAddress())
+			return fmt.Errorf("%w: %w", consts.ErrAuthenticationFailed, err)
+		}
+		s.accountID = accountID
+		s.isRemoteLookupAccount = false
+	}
+
+	s.server.authLimiter.RecordAuthAttemptWithProxy(s.ctx, s.clientConn, s.proxyInfo, s.username, true)
+	metrics.AuthenticationAttempts.WithLabelValues("managesieve_proxy", s.server.name, s.server.hostname, "success").Inc()
+	if addr, err := server.NewAddress(s.username); err == nil {
+		metrics.TrackDomainConnection("managesieve_proxy", addr.Domain())
+		metrics.TrackUserActivity("managesieve_proxy", addr.FullAddress(), "connection", 1)
+	}
+
+	duration := time.Since(authStart)
+	s.InfoLog("authentication successful",
+		"address", s.username,
+		"backend", "none", // Backend not connected yet at this point
+		"method", "oauth",
+		"mechanism", mechanism,
+		"cached", false,
+		"duration", fmt.Sprintf("%.3fs", duration.Seconds()))
+
+	return nil
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/migadu/sora/pkg/resilient"
 	"github.com/migadu/sora/server"
 	"github.com/migadu/sora/server/managesieve"
+	"github.com/migadu/sora/server/oauth"
 	"github.com/migadu/sora/server/proxy"
 )
 
@@ -50,6 +51,7 @@ type Server struct {
 	authLimiter            server.AuthLimiter
 	trustedProxies         []string // CIDR blocks for trusted proxies that can forward parameters
 	remotelookupConfig     *config.RemoteLookupConfig
+	oauthValidator         oauth.Validator
 	authIdleTimeout        time.Duration
 	commandTimeout         time.Duration // Idle timeout
 	absoluteSessionTimeout time.Duration // Maximum total session duration
@@ -71,6 +73,9 @@ type Server struct {
 	// SIEVE extensions (additional to builtin)
 	supportedExtensions []string
 
+	// Maximum script size advertised to clients, enforced by the backends
+	maxScriptSize int64
+
 	// Authentication limits
 	maxAuthErrors int // Maximum authentication errors before disconnection
 
@@ -117,6 +122,7 @@ type ServerOptions struct {
 	AffinityStickiness       float64
 	AuthRateLimit            server.AuthRateLimiterConfig
 	RemoteLookup             *config.RemoteLookupConfig
+	OAuth                    *config.OAuthConfig
 	TrustedProxies           []string // CIDR blocks for trusted proxies that can forward parameters
 
 	// Connection limiting
@@ -143,6 +149,7 @@ type ServerOptions struct {
 
 	// SIEVE extensions
 	SupportedExtensions []string // Additional SIEVE extensions beyond builtins (e.g., ["vacation", "regex"])
+	MaxScriptSize       int64    // MAXSCRIPTSIZE capability, should match the backends (0 = not advertised)
 }
 
 // New creates a new ManageSieve proxy server.
@@ -154,6 +161,12 @@ func New(appCtx context.Context, rdb *resilient.ResilientDatabase, hostname stri
 		return nil, fmt.Errorf("no remote addresses configured")
 	}
 
+	oauthValidator, err := oauth.New(opts.OAuth)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to initialize OAuth: %w", err)
+	}
+
 	// Set default timeout if not specified
 	connectTimeout := opts.ConnectTimeout
 	if connectTimeout == 0 {
@@ -323,6 +336,7 @@ func New(appCtx context.Context, rdb *resilient.ResilientDatabase, hostname stri
 		authLimiter:                authLimiter,
 		trustedProxies:             opts.TrustedProxies,
 		remotelookupConfig:         opts.RemoteLookup,
+		oauthValidator:             oauthValidator,
 		authIdleTimeout:            opts.AuthIdleTimeout,
 		commandTimeout:             opts.CommandTimeout,
 		absoluteSessionTimeout:     opts.AbsoluteSessionTimeout,
@@ -334,6 +348,7 @@ func New(appCtx context.Context, rdb *resilient.ResilientDatabase, hostname stri
 		maxAuthErrors:              opts.MaxAuthErrors,
 		debug:                      opts.Debug,
 		supportedExtensions:        opts.SupportedExtensions,
+		maxScriptSize:              opts.MaxScriptSize,
 		activeSessions:             make(map[*Session]struct{}),
 		proxyReader:                proxyReader,
 	}
@@ -582,6 +597,10 @@ func (s *Server) SetConnectionTracker(tracker *server.ConnectionTracker) {
 	if tracker != nil && s.lookupCache != nil {
 		tracker.SetLookupCache(s.lookupCache)
 	}
+	// Drop cached credentials of kicked users (e.g. on account suspension)
+	if tracker != nil && s.rdb != nil {
+		tracker.SetAuthCache(s.rdb)
+	}
 }
 
 // GetConnectionTracker returns the connection tracker for the server.
@@ -17,10 +17,12 @@ import (
 	"github.com/migadu/sora/consts"
 	"github.com/migadu/sora/helpers"
 	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/events"
 	"github.com/migadu/sora/pkg/lookupcache"
 	"github.com/migadu/sora/pkg/metrics"
 	"github.com/migadu/sora/server"
 	"github.com/migadu/sora/server/managesieve"
+	"github.com/migadu/sora/server/oauth"
 	"github.com/migadu/sora/server/proxy"
 )
 
@@ -176,12 +178,19 @@ func (s *Session) handleConnection() {
 				continue
 			}
 
-			if len(args) < 1 || strings.ToUpper(server.UnquoteString(args[0])) != "PLAIN" {
+			if len(args) < 1 {
 				if s.handleAuthError(`NO "AUTHENTICATE PLAIN is the only supported mechanism"`) {
 					return
 				}
 				continue
 			}
+			mechanism := strings.ToUpper(server.UnquoteString(args[0]))
+			if mechanism != "PLAIN" && (!oauth.IsMechanism(mechanism) || s.server.oauthValidator == nil) {
+				if s.handleAuthError(`NO "Unsupported authentication mechanism"`) {
+					return
+				}
+				continue
+			}
 
 			// Check if initial response is included
 			var saslLine string
@@ -255,30 +264,36 @@ func (s *Session) handleConnection() {
 				continue
 			}
 
-			parts := strings.Split(string(decoded), "\x00")
-			if len(parts) != 3 {
-				if s.handleAuthError(`NO "Invalid SASL PLAIN response"`) {
-					return
+			authStart := time.Now() // Start authentication timing
+			if mechanism != "PLAIN" {
+				if !s.handleOAuthAuthenticate(mechanism, decoded, authStart) {
+					continue
+				}
+			} else {
+				parts := strings.Split(string(decoded), "\x00")
+				if len(parts) != 3 {
+					if s.handleAuthError(`NO "Invalid SASL PLAIN response"`) {
+						return
+					}
+					continue
 				}
-				continue
-			}
-
-			// authzID := parts[0] // Not used in proxy
-			authnID := parts[1]
-			password := parts[2]
 
-			authStart := time.Now() // Start authentication timing
-			if err := s.authenticateUser(authnID, password, authStart); err != nil {
-				s.DebugLog("authentication failed", "error", err)
-				// This is an actual authentication failure, not a protocol error.
-				// The rate limiter handles this, so we don't count it as a command error.
-				// Check if error is due to server shutdown or temporary unavailability
-				if server.IsTemporaryAuthFailure(err) {
-					s.sendResponse(`NO (UNAVAILABLE) "Service temporarily unavailable, please try again later"`)
-				} else {
-					s.sendResponse(`NO "Authentication failed"`)
+				// authzID := parts[0] // Not used in proxy
+				authnID := parts[1]
+				password := parts[2]
+
+				if err := s.authenticateUser(authnID, password, authStart); err != nil {
+					s.DebugLog("authentication failed", "error", err)
+					// This is an actual authentication failure, not a protocol error.
+					// The rate limiter handles this, so we don't count it as a command error.
+					// Check if error is due to server shutdown or temporary unavailability
+					if server.IsTemporaryAuthFailure(err) {
+						s.sendResponse(`NO (UNAVAILABLE) "Service temporarily unavailable, please try again later"`)
+					} else {
+						s.sendResponse(`NO "Authentication failed"`)
+					}
+					continue
 				}
-				continue
 			}
 
 			// Connect to backend and authenticate
@@ -899,7 +914,7 @@ func (s *Session) authenticateUser(username, password string, authStart time.Tim
 		// Regular authentication via main DB
 		s.DebugLog("Authenticating via main DB")
 		// Use base address (without +detail) for authentication
-		accountID, err = s.server.rdb.AuthenticateWithRetry(ctx, address.BaseAddress(), password)
+		accountID, err = s.server.rdb.AuthenticateWithRetry(events.WithSource(ctx, "managesieve", s.clientAddr), address.BaseAddress(), password)
 		if err != nil {
 			// Check if error is due to session context cancellation (server shutdown)
 			// Note: Must check s.ctx.Err(), not just the query error, because the query context
@@ -1007,6 +1022,11 @@ func (s *Session) sendCapabilities() error {
 	if _, err := s.clientWriter.WriteString(fmt.Sprintf(`"SIEVE" "%s"`, capabilitiesStr) + "\r\n"); err != nil {
 		return fmt.Errorf("failed to write SIEVE: %w", err)
 	}
+	if methods := managesieve.GetNotifyMethods(s.server.supportedExtensions); len(methods) > 0 {
+		if _, err := s.clientWriter.WriteString(fmt.Sprintf(`"NOTIFY" "%s"`, strings.Join(methods, " ")) + "\r\n"); err != nil {
+			return fmt.Errorf("failed to write NOTIFY: %w", err)
+		}
+	}
 
 	// Check if we're on a TLS connection
 	_, isSecure := s.clientConn.(*tls.Conn)
@@ -1022,11 +1042,21 @@ func (s *Session) sendCapabilities() error {
 		}
 	} else {
 		// After STARTTLS or on implicit TLS: Advertise available SASL mechanisms
-		if _, err := s.clientWriter.WriteString(`"SASL" "PLAIN"` + "\r\n"); err != nil {
+		mechanisms := "PLAIN"
+		if s.server.oauthValidator != nil {
+			mechanisms = "PLAIN OAUTHBEARER XOAUTH2"
+		}
+		if _, err := s.clientWriter.WriteString(`"SASL" "` + mechanisms + `"` + "\r\n"); err != nil {
 			return fmt.Errorf("failed to write SASL: %w", err)
 		}
 	}
 
+	if s.server.maxScriptSize > 0 {
+		if _, err := s.clientWriter.WriteString(fmt.Sprintf(`"MAXSCRIPTSIZE" "%d"`, s.server.maxScriptSize) + "\r\n"); err != nil {
+			return fmt.Errorf("failed to write MAXSCRIPTSIZE: %w", err)
+		}
+	}
+
 	if _, err := s.clientWriter.WriteString(`"VERSION" "1.0"` + "\r\n"); err != nil {
 		return fmt.Errorf("failed to write VERSION: %w", err)
 	}
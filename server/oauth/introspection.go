@@ -0,0 +1,83 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxIntrospectionResponseSize bounds the size of an introspection response.
+const maxIntrospectionResponseSize = 64 * 1024
+
+// introspectionValidator checks tokens with an RFC 7662 token introspection
+// endpoint. Each login makes one request, so opaque tokens can be revoked
+// immediately by the authorization server.
+type introspectionValidator struct {
+	url           string
+	clientID      string
+	clientSecret  string
+	usernameClaim string
+	client        *http.Client
+}
+
+func newIntrospectionValidator(url, clientID, clientSecret, usernameClaim string, timeout time.Duration) *introspectionValidator {
+	return &introspectionValidator{
+		url:           url,
+		clientID:      clientID,
+		clientSecret:  clientSecret,
+		usernameClaim: usernameClaim,
+		client:        &http.Client{Timeout: timeout},
+	}
+}
+
+// Validate asks the introspection endpoint whether the token is active and
+// returns the username claim of the response.
+func (v *introspectionValidator) Validate(ctx context.Context, token string) (string, error) {
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", "access_token")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if v.clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(v.clientID), url.QueryEscape(v.clientSecret))
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: introspection endpoint returned status %d", ErrUnavailable, resp.StatusCode)
+	}
+
+	var claims map[string]any
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxIntrospectionResponseSize)).Decode(&claims); err != nil {
+		return "", fmt.Errorf("%w: invalid introspection response: %v", ErrUnavailable, err)
+	}
+
+	if active, _ := claims["active"].(bool); !active {
+		return "", fmt.Errorf("%w: token is not active", ErrInvalidToken)
+	}
+
+	username := claimString(claims, v.usernameClaim)
+	if username == "" {
+		// "username" is the standard introspection member for the resource owner
+		username = claimString(claims, "username")
+	}
+	if username == "" {
+		return "", fmt.Errorf("%w: missing %q claim", ErrInvalidToken, v.usernameClaim)
+	}
+	return username, nil
+}
@@ -0,0 +1,287 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/migadu/sora/logger"
+)
+
+// minKeyRefreshInterval limits how often an unknown key id can trigger a
+// reload of the key set.
+const minKeyRefreshInterval = time.Minute
+
+// maxJWKSSize bounds the size of a fetched key set.
+const maxJWKSSize = 1 << 20
+
+// jwk is a single JSON Web Key (RFC 7517). Only the public key members
+// used for signature verification are decoded.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// jwksValidator verifies JWT access tokens against a JSON Web Key Set.
+type jwksValidator struct {
+	url             string
+	file            string
+	refreshInterval time.Duration
+	client          *http.Client
+	usernameClaim   string
+	parser          *jwt.Parser
+
+	mu       sync.RWMutex
+	keys     map[string]any // kid -> public key
+	loadedAt time.Time
+}
+
+func newJWKSValidator(url, file string, refreshInterval, timeout time.Duration, issuer, audience, usernameClaim string) *jwksValidator {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if issuer != "" {
+		opts = append(opts, jwt.WithIssuer(issuer))
+	}
+	if audience != "" {
+		opts = append(opts, jwt.WithAudience(audience))
+	}
+	return &jwksValidator{
+		url:             url,
+		file:            file,
+		refreshInterval: refreshInterval,
+		client:          &http.Client{Timeout: timeout},
+		usernameClaim:   usernameClaim,
+		parser:          jwt.NewParser(opts...),
+		keys:            make(map[string]any),
+	}
+}
+
+// Validate verifies the token signature and registered claims and returns
+// the username claim.
+func (v *jwksValidator) Validate(ctx context.Context, token string) (string, error) {
+	if v.stale() {
+		if err := v.refresh(ctx); err != nil {
+			// Keep using the previous key set; it is only replaced on success
+			logger.Warn("OAuth: Failed to refresh key set", "error", err)
+		}
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.key(ctx, kid)
+	})
+	if err != nil {
+		if errors.Is(err, ErrUnavailable) {
+			return "", err
+		}
+		return "", fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	username := claimString(claims, v.usernameClaim)
+	if username == "" {
+		return "", fmt.Errorf("%w: missing %q claim", ErrInvalidToken, v.usernameClaim)
+	}
+	return username, nil
+}
+
+// key returns the verification key for kid. An unknown kid reloads the key
+// set once, so rotated keys are picked up before the regular refresh.
+func (v *jwksValidator) key(ctx context.Context, kid string) (any, error) {
+	if k := v.lookup(kid); k != nil {
+		return k, nil
+	}
+
+	v.mu.RLock()
+	recent := time.Since(v.loadedAt) < minKeyRefreshInterval
+	v.mu.RUnlock()
+	if !recent {
+		if err := v.refresh(ctx); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		if k := v.lookup(kid); k != nil {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookup finds a key by kid. Tokens without a kid are accepted when the set
+// holds a single key.
+func (v *jwksValidator) lookup(kid string) any {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if kid == "" && len(v.keys) == 1 {
+		for _, k := range v.keys {
+			return k
+		}
+	}
+	return v.keys[kid]
+}
+
+func (v *jwksValidator) stale() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.refreshInterval > 0 && time.Since(v.loadedAt) > v.refreshInterval
+}
+
+// refresh reloads the key set from the configured file or URL.
+func (v *jwksValidator) refresh(ctx context.Context) error {
+	data, err := v.fetch(ctx)
+	var keys map[string]any
+	if err == nil {
+		keys, err = parseJWKS(data)
+	}
+	if err != nil {
+		v.mu.Lock()
+		// Back off so a failing source is not hit for every login
+		v.loadedAt = time.Now()
+		v.mu.Unlock()
+		return err
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.loadedAt = time.Now()
+	v.mu.Unlock()
+
+	logger.Debug("OAuth: Loaded key set", "keys", len(keys))
+	return nil
+}
+
+func (v *jwksValidator) fetch(ctx context.Context) ([]byte, error) {
+	if v.file != "" {
+		return os.ReadFile(v.file)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, v.url)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+}
+
+// parseJWKS decodes the signature keys of a key set. Keys of unsupported
+// types and encryption keys are skipped.
+func parseJWKS(data []byte) (map[string]any, error) {
+	var set jwkSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid key set: %w", err)
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			logger.Warn("OAuth: Skipping key", "kid", k.Kid, "error", err)
+			continue
+		}
+		if pub != nil {
+			keys[k.Kid] = pub
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("key set contains no usable signature keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
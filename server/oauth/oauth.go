@@ -0,0 +1,117 @@
+// Package oauth validates OAuth 2.0 bearer tokens presented with the
+// OAUTHBEARER (RFC 7628) and XOAUTH2 SASL mechanisms.
+//
+// Tokens are checked either locally as signed JWTs against a JSON Web Key
+// Set, or remotely with an RFC 7662 token introspection endpoint. In both
+// cases the configured username claim (default "email") names the account
+// the token was issued for.
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/migadu/sora/config"
+)
+
+// SASL mechanism names
+const (
+	MechanismOAuthBearer = "OAUTHBEARER"
+	MechanismXOAuth2     = "XOAUTH2"
+)
+
+// Mechanisms lists the token mechanisms in the order they are advertised.
+var Mechanisms = []string{MechanismOAuthBearer, MechanismXOAuth2}
+
+var (
+	// ErrInvalidToken is returned for tokens that are malformed, expired,
+	// not signed by a trusted key or not active.
+	ErrInvalidToken = errors.New("invalid bearer token")
+
+	// ErrUnavailable is returned when the key set or introspection endpoint
+	// cannot be reached. Callers should report a temporary failure.
+	ErrUnavailable = errors.New("token validation temporarily unavailable")
+
+	// ErrIdentityMismatch is returned when the SASL authorization identity
+	// does not match the user the token was issued for.
+	ErrIdentityMismatch = errors.New("authorization identity does not match token")
+)
+
+// Validator checks bearer tokens.
+type Validator interface {
+	// Validate checks the token and returns the username it was issued for.
+	Validate(ctx context.Context, token string) (string, error)
+}
+
+// New creates a validator from configuration. It returns nil when OAuth
+// is not enabled.
+func New(cfg *config.OAuthConfig) (Validator, error) {
+	if cfg == nil || !cfg.Enabled {
+		return nil, nil
+	}
+
+	timeout, err := cfg.GetTimeout()
+	if err != nil {
+		return nil, fmt.Errorf("invalid oauth timeout: %w", err)
+	}
+
+	sources := 0
+	for _, v := range []string{cfg.JWKSURL, cfg.JWKSFile, cfg.IntrospectionURL} {
+		if v != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, fmt.Errorf("oauth requires exactly one of jwks_url, jwks_file or introspection_url")
+	}
+
+	if cfg.IntrospectionURL != "" {
+		return newIntrospectionValidator(cfg.IntrospectionURL, cfg.IntrospectionClientID, cfg.IntrospectionClientSecret, cfg.GetUsernameClaim(), timeout), nil
+	}
+
+	refresh, err := cfg.GetJWKSRefreshInterval()
+	if err != nil {
+		return nil, fmt.Errorf("invalid oauth jwks_refresh_interval: %w", err)
+	}
+	v := newJWKSValidator(cfg.JWKSURL, cfg.JWKSFile, refresh, timeout, cfg.Issuer, cfg.Audience, cfg.GetUsernameClaim())
+	if err := v.refresh(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to load oauth key set: %w", err)
+	}
+	return v, nil
+}
+
+// IsMechanism reports whether mechanism is one of the token mechanisms.
+func IsMechanism(mechanism string) bool {
+	switch strings.ToUpper(mechanism) {
+	case MechanismOAuthBearer, MechanismXOAuth2:
+		return true
+	}
+	return false
+}
+
+// Authorize validates the token and checks that the optional authorization
+// identity sent with it names the same user. It returns the username the
+// token was issued for.
+func Authorize(ctx context.Context, v Validator, authzID, token string) (string, error) {
+	if token == "" {
+		return "", ErrInvalidToken
+	}
+	username, err := v.Validate(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	if authzID != "" && !strings.EqualFold(authzID, username) {
+		return "", ErrIdentityMismatch
+	}
+	return strings.ToLower(username), nil
+}
+
+// claimString returns a string claim, or an empty string if it is missing.
+func claimString(claims map[string]any, name string) string {
+	if v, ok := claims[name].(string); ok {
+		return strings.TrimSpace(v)
+	}
+	return ""
+}
@@ -0,0 +1,203 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/migadu/sora/config"
+)
+
+func b64url(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// writeJWKS writes a key set with the public halves of the given keys.
+func writeJWKS(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) string {
+	t.Helper()
+	set := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa1", "use": "sig", "n": b64url(rsaKey.N.Bytes()), "e": b64url(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": b64url(ecKey.X.FillBytes(make([]byte, 32))), "y": b64url(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "RSA", "kid": "enc1", "use": "enc", "n": b64url(rsaKey.N.Bytes()), "e": "AQAB"},
+	}}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestJWKSValidator(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeJWKS(t, rsaKey, ecKey)
+
+	v, err := New(&config.OAuthConfig{
+		Enabled:  true,
+		JWKSFile: path,
+		Issuer:   "https://sso.example.com",
+		Audience: "mail",
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+	valid := jwt.MapClaims{"iss": "https://sso.example.com", "aud": "mail", "exp": exp, "email": "User@Example.com"}
+
+	tests := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr error
+	}{
+		{"rsa", sign(t, jwt.SigningMethodRS256, "rsa1", rsaKey, valid), "User@Example.com", nil},
+		{"ec", sign(t, jwt.SigningMethodES256, "ec1", ecKey, valid), "User@Example.com", nil},
+		{"wrong issuer", sign(t, jwt.SigningMethodRS256, "rsa1", rsaKey, jwt.MapClaims{"iss": "https://evil.example.com", "aud": "mail", "exp": exp, "email": "user@example.com"}), "", ErrInvalidToken},
+		{"wrong audience", sign(t, jwt.SigningMethodRS256, "rsa1", rsaKey, jwt.MapClaims{"iss": "https://sso.example.com", "aud": "other", "exp": exp, "email": "user@example.com"}), "", ErrInvalidToken},
+		{"expired", sign(t, jwt.SigningMethodRS256, "rsa1", rsaKey, jwt.MapClaims{"iss": "https://sso.example.com", "aud": "mail", "exp": time.Now().Add(-time.Hour).Unix(), "email": "user@example.com"}), "", ErrInvalidToken},
+		{"no expiry", sign(t, jwt.SigningMethodRS256, "rsa1", rsaKey, jwt.MapClaims{"iss": "https://sso.example.com", "aud": "mail", "email": "user@example.com"}), "", ErrInvalidToken},
+		{"missing claim", sign(t, jwt.SigningMethodRS256, "rsa1", rsaKey, jwt.MapClaims{"iss": "https://sso.example.com", "aud": "mail", "exp": exp, "sub": "123"}), "", ErrInvalidToken},
+		{"encryption key", sign(t, jwt.SigningMethodRS256, "enc1", rsaKey, valid), "", ErrInvalidToken},
+		{"hmac", sign(t, jwt.SigningMethodHS256, "rsa1", []byte("secret"), valid), "", ErrInvalidToken},
+		{"garbage", "not-a-token", "", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.Validate(context.Background(), tt.token)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("got %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntrospectionValidator(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "sora" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.PostFormValue("token") {
+		case "good":
+			json.NewEncoder(w).Encode(map[string]any{"active": true, "email": "user@example.com"})
+		case "username-only":
+			json.NewEncoder(w).Encode(map[string]any{"active": true, "username": "other@example.com"})
+		case "broken":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			json.NewEncoder(w).Encode(map[string]any{"active": false})
+		}
+	}))
+	defer srv.Close()
+
+	v, err := New(&config.OAuthConfig{
+		Enabled:                   true,
+		IntrospectionURL:          srv.URL,
+		IntrospectionClientID:     "sora",
+		IntrospectionClientSecret: "s3cret",
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	ctx := context.Background()
+	if got, err := v.Validate(ctx, "good"); err != nil || got != "user@example.com" {
+		t.Errorf("good: got %q, %v", got, err)
+	}
+	if got, err := v.Validate(ctx, "username-only"); err != nil || got != "other@example.com" {
+		t.Errorf("username-only: got %q, %v", got, err)
+	}
+	if _, err := v.Validate(ctx, "revoked"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("revoked: err = %v, want ErrInvalidToken", err)
+	}
+	if _, err := v.Validate(ctx, "broken"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("broken: err = %v, want ErrUnavailable", err)
+	}
+}
+
+type staticValidator string
+
+func (v staticValidator) Validate(ctx context.Context, token string) (string, error) {
+	if token != "token" {
+		return "", ErrInvalidToken
+	}
+	return string(v), nil
+}
+
+func TestAuthorize(t *testing.T) {
+	v := staticValidator("User@Example.com")
+	ctx := context.Background()
+
+	if got, err := Authorize(ctx, v, "", "token"); err != nil || got != "user@example.com" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if got, err := Authorize(ctx, v, "user@example.com", "token"); err != nil || got != "user@example.com" {
+		t.Errorf("matching authzid: got %q, %v", got, err)
+	}
+	if _, err := Authorize(ctx, v, "bob@example.com", "token"); !errors.Is(err, ErrIdentityMismatch) {
+		t.Errorf("foreign authzid: err = %v", err)
+	}
+	if _, err := Authorize(ctx, v, "", ""); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("empty token: err = %v", err)
+	}
+}
+
+func TestNewConfigErrors(t *testing.T) {
+	if v, err := New(nil); v != nil || err != nil {
+		t.Errorf("nil config: got %v, %v", v, err)
+	}
+	if v, err := New(&config.OAuthConfig{JWKSFile: "x"}); v != nil || err != nil {
+		t.Errorf("disabled config: got %v, %v", v, err)
+	}
+	if _, err := New(&config.OAuthConfig{Enabled: true}); err == nil {
+		t.Error("expected error without a token source")
+	}
+	if _, err := New(&config.OAuthConfig{Enabled: true, JWKSFile: "a", IntrospectionURL: "b"}); err == nil {
+		t.Error("expected error with two token sources")
+	}
+	if _, err := New(&config.OAuthConfig{Enabled: true, JWKSFile: filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Error("expected error for missing key set file")
+	}
+}
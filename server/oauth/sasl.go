@@ -0,0 +1,156 @@
+package oauth
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/emersion/go-sasl"
+)
+
+// ErrMalformedResponse is returned for client responses that do not follow
+// the mechanism's syntax.
+var ErrMalformedResponse = errors.New("malformed SASL response")
+
+// ParseResponse decodes the initial client response of a token mechanism
+// and returns the optional authorization identity and the bearer token.
+func ParseResponse(mechanism string, resp []byte) (authzID, token string, err error) {
+	switch strings.ToUpper(mechanism) {
+	case MechanismOAuthBearer:
+		return parseOAuthBearer(resp)
+	case MechanismXOAuth2:
+		return parseXOAuth2(resp)
+	}
+	return "", "", ErrMalformedResponse
+}
+
+// parseOAuthBearer decodes an RFC 7628 client response:
+//
+//	gs2-header kvsep *(key "=" value kvsep) kvsep
+//
+// e.g. "n,a=user@example.com,\x01host=mail.example.com\x01auth=Bearer TOKEN\x01\x01".
+func parseOAuthBearer(resp []byte) (string, string, error) {
+	parts := bytes.SplitN(resp, []byte{','}, 3)
+	if len(parts) != 3 {
+		return "", "", ErrMalformedResponse
+	}
+	// Channel binding is not supported
+	if !bytes.Equal(parts[0], []byte("n")) && !bytes.Equal(parts[0], []byte("y")) {
+		return "", "", ErrMalformedResponse
+	}
+
+	var authzID string
+	if len(parts[1]) > 0 {
+		if !bytes.HasPrefix(parts[1], []byte("a=")) {
+			return "", "", ErrMalformedResponse
+		}
+		authzID = decodeSASLName(string(parts[1][2:]))
+	}
+
+	token, err := bearerFromKVPairs(parts[2])
+	if err != nil {
+		return "", "", err
+	}
+	return authzID, token, nil
+}
+
+// parseXOAuth2 decodes an XOAUTH2 client response:
+//
+//	"user=" user "\x01auth=Bearer " token "\x01\x01"
+func parseXOAuth2(resp []byte) (string, string, error) {
+	user, rest, ok := bytes.Cut(resp, []byte{0x01})
+	if !ok || !bytes.HasPrefix(user, []byte("user=")) {
+		return "", "", ErrMalformedResponse
+	}
+	token, err := bearerFromKVPairs(rest)
+	if err != nil {
+		return "", "", err
+	}
+	return string(user[len("user="):]), token, nil
+}
+
+// bearerFromKVPairs extracts the bearer token from \x01-separated key/value
+// pairs. Other keys (host, port) are ignored.
+func bearerFromKVPairs(data []byte) (string, error) {
+	for _, kv := range bytes.Split(data, []byte{0x01}) {
+		if len(kv) == 0 {
+			continue
+		}
+		key, value, ok := bytes.Cut(kv, []byte{'='})
+		if !ok {
+			return "", ErrMalformedResponse
+		}
+		if string(key) != "auth" {
+			continue
+		}
+		scheme, token, ok := strings.Cut(string(value), " ")
+		if !ok || !strings.EqualFold(scheme, "bearer") {
+			return "", ErrMalformedResponse
+		}
+		token = strings.TrimSpace(token)
+		if token == "" {
+			return "", ErrMalformedResponse
+		}
+		return token, nil
+	}
+	return "", ErrMalformedResponse
+}
+
+// decodeSASLName reverses the saslname escaping of RFC 5801 ("=2C" for ','
+// and "=3D" for '=').
+func decodeSASLName(s string) string {
+	return strings.NewReplacer("=2C", ",", "=3D", "=").Replace(s)
+}
+
+// ErrorChallenge returns the JSON error the server sends as final challenge
+// after a failed token. The client answers with a dummy response before the
+// server reports the failure.
+func ErrorChallenge(mechanism string) []byte {
+	if strings.ToUpper(mechanism) == MechanismXOAuth2 {
+		return []byte(`{"status":"401","schemes":"bearer"}`)
+	}
+	return []byte(`{"status":"invalid_token","schemes":"bearer"}`)
+}
+
+// AuthenticateFunc verifies a bearer token and its optional authorization
+// identity. The returned error is reported to the client as is.
+type AuthenticateFunc func(authzID, token string) error
+
+// saslServer implements sasl.Server for the token mechanisms.
+type saslServer struct {
+	mechanism    string
+	authenticate AuthenticateFunc
+	done         bool
+	failErr      error
+}
+
+// NewServer returns a SASL server for OAUTHBEARER or XOAUTH2. On failure it
+// sends the JSON error challenge and returns the error from authenticate
+// once the client has answered it.
+func NewServer(mechanism string, authenticate AuthenticateFunc) sasl.Server {
+	return &saslServer{mechanism: strings.ToUpper(mechanism), authenticate: authenticate}
+}
+
+func (s *saslServer) Next(response []byte) (challenge []byte, done bool, err error) {
+	if s.failErr != nil {
+		return nil, true, s.failErr
+	}
+	if s.done {
+		return nil, true, sasl.ErrUnexpectedClientResponse
+	}
+	if response == nil {
+		// No initial response, ask for it with an empty challenge
+		return []byte{}, false, nil
+	}
+	s.done = true
+
+	authzID, token, err := ParseResponse(s.mechanism, response)
+	if err != nil {
+		return nil, true, err
+	}
+	if err := s.authenticate(authzID, token); err != nil {
+		s.failErr = err
+		return ErrorChallenge(s.mechanism), false, nil
+	}
+	return nil, true, nil
+}
@@ -0,0 +1,78 @@
+package oauth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		mechanism string
+		resp      string
+		authzID   string
+		token     string
+		wantErr   bool
+	}{
+		{"oauthbearer", "OAUTHBEARER", "n,a=user@example.com,\x01host=mail.example.com\x01port=993\x01auth=Bearer abc.def\x01\x01", "user@example.com", "abc.def", false},
+		{"oauthbearer without authzid", "oauthbearer", "n,,\x01auth=bearer abc\x01\x01", "", "abc", false},
+		{"oauthbearer escaped authzid", "OAUTHBEARER", "n,a=we=2Cird=3Dname@example.com,\x01auth=Bearer abc\x01\x01", "we,ird=name@example.com", "abc", false},
+		{"oauthbearer channel binding", "OAUTHBEARER", "p=tls-unique,,\x01auth=Bearer abc\x01\x01", "", "", true},
+		{"oauthbearer missing auth", "OAUTHBEARER", "n,,\x01host=x\x01\x01", "", "", true},
+		{"oauthbearer basic scheme", "OAUTHBEARER", "n,,\x01auth=Basic abc\x01\x01", "", "", true},
+		{"xoauth2", "XOAUTH2", "user=user@example.com\x01auth=Bearer ya29.token\x01\x01", "user@example.com", "ya29.token", false},
+		{"xoauth2 missing user", "XOAUTH2", "auth=Bearer abc\x01\x01", "", "", true},
+		{"xoauth2 empty token", "XOAUTH2", "user=u@example.com\x01auth=Bearer \x01\x01", "", "", true},
+		{"unknown mechanism", "PLAIN", "\x00u\x00p", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authzID, token, err := ParseResponse(tt.mechanism, []byte(tt.resp))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q/%q", authzID, token)
+				}
+				return
+			}
+			if err != nil || authzID != tt.authzID || token != tt.token {
+				t.Fatalf("got %q/%q, %v; want %q/%q", authzID, token, err, tt.authzID, tt.token)
+			}
+		})
+	}
+}
+
+func TestServerExchange(t *testing.T) {
+	errRejected := errors.New("rejected")
+	var gotAuthzID, gotToken string
+	auth := func(authzID, token string) error {
+		gotAuthzID, gotToken = authzID, token
+		if token != "good" {
+			return errRejected
+		}
+		return nil
+	}
+
+	// Success without initial response
+	s := NewServer("xoauth2", auth)
+	challenge, done, err := s.Next(nil)
+	if err != nil || done || len(challenge) != 0 {
+		t.Fatalf("initial: %q, %v, %v", challenge, done, err)
+	}
+	_, done, err = s.Next([]byte("user=u@example.com\x01auth=Bearer good\x01\x01"))
+	if err != nil || !done {
+		t.Fatalf("response: %v, %v", done, err)
+	}
+	if gotAuthzID != "u@example.com" || gotToken != "good" {
+		t.Errorf("authenticate called with %q/%q", gotAuthzID, gotToken)
+	}
+
+	// Failure sends the error challenge, then fails after the dummy response
+	s = NewServer(MechanismOAuthBearer, auth)
+	challenge, done, err = s.Next([]byte("n,,\x01auth=Bearer bad\x01\x01"))
+	if err != nil || done || string(challenge) != string(ErrorChallenge(MechanismOAuthBearer)) {
+		t.Fatalf("failure challenge: %q, %v, %v", challenge, done, err)
+	}
+	if _, done, err = s.Next([]byte{0x01}); !done || !errors.Is(err, errRejected) {
+		t.Fatalf("after dummy response: %v, %v", done, err)
+	}
+}
@@ -0,0 +1,95 @@
+package pop3
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+
+	"github.com/migadu/sora/pkg/metrics"
+	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/oauth"
+)
+
+// authenticateOAuth verifies an OAUTHBEARER or XOAUTH2 client response and
+// returns the account and address the token was issued for. On failure it
+// completes the SASL exchange (error challenge and the client's dummy
+// response) and returns the error response to send.
+func (s *POP3Session) authenticateOAuth(ctx context.Context, reader *bufio.Reader, writer *bufio.Writer, mechanism string, response []byte) (int64, string, string) {
+	fail := func(errMsg string) (int64, string, string) {
+		writer.WriteString("+ " + base64.StdEncoding.EncodeToString(oauth.ErrorChallenge(mechanism)) + "\r\n")
+		writer.Flush()
+		if _, err := reader.ReadString('\n'); err != nil {
+			s.DebugLog("error reading oauth error acknowledgement", "error", err)
+		}
+		return 0, "", errMsg
+	}
+
+	authzID, token, err := oauth.ParseResponse(mechanism, response)
+	if err != nil {
+		s.DebugLog("invalid oauth response", "mechanism", mechanism, "error", err)
+		return 0, "", "-ERR [AUTH] Invalid authentication format\r\n"
+	}
+
+	netConn := *s.conn
+	var proxyInfo *server.ProxyProtocolInfo
+	if s.ProxyIP != "" {
+		proxyInfo = &server.ProxyProtocolInfo{
+			SrcIP: s.RemoteIP,
+		}
+	}
+
+	// Apply progressive authentication delay BEFORE any other checks
+	remoteAddr := &server.StringAddr{Addr: s.RemoteIP}
+	server.ApplyAuthenticationDelay(ctx, s.server.authLimiter, remoteAddr, "POP3-OAUTH")
+
+	if s.server.authLimiter != nil {
+		if err := s.server.authLimiter.CanAttemptAuthWithProxy(ctx, netConn, proxyInfo, authzID); err != nil {
+			s.DebugLog("oauth rate limited", "error", err)
+			return fail("-ERR [LOGIN-DELAY] Too many authentication attempts. Please try again later.\r\n")
+		}
+	}
+
+	recordFailure := func(user string) {
+		metrics.AuthenticationAttempts.WithLabelValues("pop3", s.server.name, s.server.hostname, "failure").Inc()
+		if s.server.authLimiter != nil {
+			s.server.authLimiter.RecordAuthAttemptWithProxy(ctx, netConn, proxyInfo, user, false)
+		}
+	}
+
+	username, err := oauth.Authorize(ctx, s.server.oauthValidator, authzID, token)
+	if err != nil {
+		if errors.Is(err, oauth.ErrUnavailable) || ctx.Err() != nil {
+			s.WarnLog("oauth token validation unavailable", "mechanism", mechanism, "error", err)
+			return fail("-ERR [SYS/TEMP] Service temporarily unavailable, please try again later\r\n")
+		}
+		s.InfoLog("authentication failed", "reason", "invalid_token", "mechanism", mechanism, "authz_id", authzID, "error", err)
+		recordFailure(authzID)
+		return fail("-ERR [AUTH] Authentication failed\r\n")
+	}
+
+	address, err := server.NewAddress(username)
+	if err != nil {
+		s.InfoLog("authentication failed", "reason", "invalid_token_username", "mechanism", mechanism, "username", username)
+		recordFailure(username)
+		return fail("-ERR [AUTH] Authentication failed\r\n")
+	}
+
+	accountID, err := s.server.rdb.GetLoginAccountIDByAddressWithRetry(ctx, address.BaseAddress())
+	if err != nil {
+		if ctx.Err() != nil {
+			s.InfoLog("oauth authentication cancelled due to server shutdown")
+			return fail("-ERR [SYS/TEMP] Service temporarily unavailable, please try again later\r\n")
+		}
+		s.InfoLog("authentication failed", "reason", "user_not_found", "mechanism", mechanism, "address", address.BaseAddress())
+		recordFailure(address.BaseAddress())
+		return fail("-ERR [AUTH] Authentication failed\r\n")
+	}
+
+	if s.server.authLimiter != nil {
+		s.server.authLimiter.RecordAuthAttemptWithProxy(ctx, netConn, proxyInfo, address.BaseAddress(), true)
+	}
+	metrics.AuthenticationAttempts.WithLabelValues("pop3", s.server.name, s.server.hostname, "success").Inc()
+
+	return accountID, address.BaseAddress(), ""
+}
@@ -17,11 +17,13 @@ import (
 	"github.com/migadu/sora/cache"
 	"github.com/migadu/sora/config"
 	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/pkg/events"
 	"github.com/migadu/sora/pkg/lookupcache"
 	"github.com/migadu/sora/pkg/metrics"
 	"github.com/migadu/sora/pkg/resilient"
 	serverPkg "github.com/migadu/sora/server"
 	"github.com/migadu/sora/server/idgen"
+	"github.com/migadu/sora/server/oauth"
 	"github.com/migadu/sora/server/uploader"
 	"github.com/migadu/sora/storage"
 	"golang.org/x/crypto/bcrypt"
@@ -67,6 +69,9 @@ type POP3Server struct {
 	// Authentication rate limiting
 	authLimiter serverPkg.AuthLimiter
 
+	// OAUTHBEARER/XOAUTH2 token validation (nil when disabled)
+	oauthValidator oauth.Validator
+
 	// Authentication cache (wraps rdb authentication calls)
 	lookupCache *lookupcache.LookupCache
 
@@ -118,6 +123,7 @@ type POP3ServerOptions struct {
 	TrustedNetworks             []string // Global trusted networks for parameter forwarding
 	AuthRateLimit               serverPkg.AuthRateLimiterConfig
 	LookupCache                 *config.LookupCacheConfig // Authentication cache configuration
+	OAuth                       *config.OAuthConfig       // OAUTHBEARER/XOAUTH2 token validation (optional)
 	SessionMemoryLimit          int64                     // Memory limit per session in bytes
 	AuthIdleTimeout             time.Duration             // Idle timeout during authentication phase (pre-auth only, 0 = disabled)
 	CommandTimeout              time.Duration             // Maximum idle time before disconnection
@@ -127,7 +133,7 @@ type POP3ServerOptions struct {
 	Config                      *config.Config            // Full config for shared settings like connection tracking timeouts
 }
 
-func New(appCtx context.Context, name, hostname, popAddr string, s3 *storage.S3Storage, rdb *resilient.ResilientDatabase, uploadWorker *uploader.UploadWorker, cache *cache.Cache, options POP3ServerOptions) (*POP3Server, error) {
+func New(appCtx context.Context, name, hostname, popAddr string, s3 storage.BlobStore, rdb *resilient.ResilientDatabase, uploadWorker *uploader.UploadWorker, cache *cache.Cache, options POP3ServerOptions) (*POP3Server, error) {
 	// Wrap S3 storage with resilient patterns including circuit breakers
 	resilientS3 := resilient.NewResilientS3Storage(s3)
 
@@ -155,6 +161,12 @@ func New(appCtx context.Context, name, hostname, popAddr string, s3 *storage.S3S
 		}
 	}
 
+	oauthValidator, err := oauth.New(options.OAuth)
+	if err != nil {
+		serverCancel()
+		return nil, fmt.Errorf("failed to initialize OAuth: %w", err)
+	}
+
 	// Initialize authentication rate limiter with trusted networks
 	authLimiter := serverPkg.NewAuthRateLimiterWithTrustedNetworks("POP3", name, hostname, options.AuthRateLimit, options.TrustedNetworks)
 	serverPkg.RegisterRateLimiter("pop3", name, authLimiter)
@@ -236,6 +248,7 @@ func New(appCtx context.Context, name, hostname, popAddr string, s3 *storage.S3S
 		masterSASLPassword:     []byte(options.MasterSASLPassword),
 		proxyReader:            proxyReader,
 		authLimiter:            authLimiter,
+		oauthValidator:         oauthValidator,
 		lookupCache:            lookupCache,
 		trustedNetworks:        options.TrustedNetworks,
 		sessionMemoryLimit:     options.SessionMemoryLimit,
@@ -550,6 +563,10 @@ func (s *POP3Server) Start(errChan chan error) {
 // SetConnTracker sets the connection tracker for this server
 func (s *POP3Server) SetConnTracker(tracker *serverPkg.ConnectionTracker) {
 	s.connTracker = tracker
+	// Drop cached credentials of kicked users (e.g. on account suspension)
+	if tracker != nil && s.lookupCache != nil {
+		tracker.SetLookupCache(s.lookupCache)
+	}
 }
 
 func (s *POP3Server) Close() {
@@ -788,6 +805,8 @@ func (s *POP3Server) GetLookupCache() *lookupcache.LookupCache {
 // This method wraps the database authentication with an optional lookup cache layer.
 // The cache decorates the database call - this is the proper architectural pattern.
 func (s *POP3Server) Authenticate(ctx context.Context, address, password string) (accountID int64, err error) {
+	defer func() { events.PublishAuth(ctx, address, accountID, err) }()
+
 	// Check context before any work
 	if err := ctx.Err(); err != nil {
 		return 0, err
@@ -814,7 +833,7 @@ func (s *POP3Server) Authenticate(ctx context.Context, address, password string)
 	}
 
 	// Fetch credentials from database (no caching - we handle that here)
-	accountID, hashedPassword, err := s.rdb.GetCredentialForAuthWithRetry(ctx, address)
+	creds, err := s.rdb.GetAuthCredentialsWithRetry(ctx, address)
 	if err != nil {
 		// Cache negative result if enabled (user not found)
 		if s.lookupCache != nil {
@@ -825,8 +844,13 @@ func (s *POP3Server) Authenticate(ctx context.Context, address, password string)
 		return 0, err
 	}
 
-	// Verify password
-	if err := db.VerifyPassword(hashedPassword, password); err != nil {
+	accountID = creds.AccountID
+	hashedPassword := creds.HashedPassword
+
+	// Verify password or app password
+	protocol, remoteIP := events.SourceFromContext(ctx)
+	app, err := creds.Verify(password, protocol, remoteIP)
+	if err != nil {
 		// Cache negative result for invalid password if enabled
 		if s.lookupCache != nil {
 			// AuthInvalidPassword = 2 (from lookupcache package)
@@ -836,6 +860,18 @@ func (s *POP3Server) Authenticate(ctx context.Context, address, password string)
 		return 0, err
 	}
 
+	if app != nil {
+		s.rdb.RecordAppPasswordUse(app.ID, remoteIP)
+		// The cache does not know the client address, so IP-restricted app
+		// passwords are always checked against the database. The cached hash
+		// is of the password as typed, which may differ from the stored form.
+		if s.lookupCache != nil && len(app.AllowedIPs) == 0 {
+			s.lookupCache.SetSuccess(address, accountID, db.GenerateSHA512Hash(password), password)
+		}
+		logger.Info("authentication successful", "address", address, "account_id", accountID, "app_password_id", app.ID, "cached", false, "method", "main_db")
+		return accountID, nil
+	}
+
 	// Cache successful authentication if enabled
 	if s.lookupCache != nil {
 		s.lookupCache.SetSuccess(address, accountID, hashedPassword, password)
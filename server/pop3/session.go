@@ -23,8 +23,10 @@ import (
 	"github.com/migadu/sora/consts"
 	"github.com/migadu/sora/db"
 	"github.com/migadu/sora/helpers"
+	"github.com/migadu/sora/pkg/events"
 	"github.com/migadu/sora/pkg/metrics"
 	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/oauth"
 	"github.com/migadu/sora/storage"
 )
 
@@ -146,7 +148,11 @@ func (s *POP3Session) handleConnection() {
 			writer.WriteString("EXPIRE NEVER\r\n")
 			writer.WriteString(fmt.Sprintf("LOGIN-DELAY %d\r\n", int(Pop3ErrorDelay.Seconds())))
 			writer.WriteString("AUTH-RESP-CODE\r\n")
-			writer.WriteString("SASL PLAIN\r\n")
+			if s.server.oauthValidator != nil {
+				writer.WriteString("SASL PLAIN " + strings.Join(oauth.Mechanisms, " ") + "\r\n")
+			} else {
+				writer.WriteString("SASL PLAIN\r\n")
+			}
 			writer.WriteString("LANG\r\n")
 			writer.WriteString("UTF8\r\n")
 			writer.WriteString("IMPLEMENTATION Sora-POP3-Server\r\n")
@@ -362,7 +368,7 @@ func (s *POP3Session) handleConnection() {
 			// If master password didn't work, try regular authentication
 			if !authSuccess {
 				// Use base address (without +detail) for authentication
-				accountID, err = s.server.Authenticate(ctx, userAddress.BaseAddress(), password)
+				accountID, err = s.server.Authenticate(events.WithSource(ctx, "pop3", s.RemoteIP), userAddress.BaseAddress(), password)
 				if err != nil {
 					// Check if error is due to context cancellation (server shutdown)
 					if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
@@ -1416,7 +1422,7 @@ func (s *POP3Session) handleConnection() {
 			// Remove quotes from mechanism if present for compatibility
 			mechanism := server.UnquoteString(parts[1])
 			mechanism = strings.ToUpper(mechanism)
-			if mechanism != "PLAIN" {
+			if mechanism != "PLAIN" && (!oauth.IsMechanism(mechanism) || s.server.oauthValidator == nil) {
 				recordMetrics("failure")
 				if s.handleClientError(writer, "-ERR Unsupported authentication mechanism\r\n") {
 					return
@@ -1478,6 +1484,23 @@ func (s *POP3Session) handleConnection() {
 				continue
 			}
 
+			if oauth.IsMechanism(mechanism) {
+				accountID, userEmail, errMsg := s.authenticateOAuth(ctx, reader, writer, mechanism, decoded)
+				if errMsg != "" {
+					recordMetrics("failure")
+					if s.handleClientError(writer, errMsg) {
+						return
+					}
+					continue
+				}
+				if !s.completeAuthentication(ctx, writer, accountID, userEmail, "oauth", start) {
+					recordMetrics("failure")
+					continue
+				}
+				recordMetrics("success")
+				continue
+			}
+
 			// Parse SASL PLAIN format: [authz-id] \0 authn-id \0 password
 			parts := strings.Split(string(decoded), "\x00")
 			if len(parts) != 3 {
@@ -1641,7 +1664,7 @@ func (s *POP3Session) handleConnection() {
 					}
 				}
 
-				accountID, err = s.server.Authenticate(ctx, address.BaseAddress(), password)
+				accountID, err = s.server.Authenticate(events.WithSource(ctx, "pop3", s.RemoteIP), address.BaseAddress(), password)
 				if err != nil {
 					// Check if error is due to context cancellation (server shutdown)
 					if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
@@ -1671,83 +1694,17 @@ func (s *POP3Session) handleConnection() {
 				}
 			}
 
-			// This is a potential write operation.
-			// Ensure default mailboxes (INBOX/Drafts/Sent/Spam/Trash) exist
-			err = s.server.rdb.CreateDefaultMailboxesWithRetry(ctx, accountID)
-			if err != nil {
-				s.DebugLog("error creating default mailboxes", "error", err)
-				writer.WriteString("-ERR [SYS/TEMP] Service temporarily unavailable, please try again later\r\n")
-				writer.Flush()
-				recordMetrics("failure")
-				continue
-			}
-			// Create a context that signals to the DB layer to use the master connection.
-			// We will set useMasterDB later under the write lock.
-			readCtx := context.WithValue(ctx, consts.UseMasterDBKey, true)
-
-			inboxMailboxID, err := s.server.rdb.GetMailboxByNameWithRetry(readCtx, accountID, consts.MailboxInbox)
-			if err != nil {
-				s.DebugLog("error getting inbox", "error", err)
-				writer.WriteString("-ERR [SYS/TEMP] Service temporarily unavailable, please try again later\r\n")
-				writer.Flush()
-				recordMetrics("failure")
-				continue
-			}
-
-			// Acquire write lock to update session state
-			acquired, release := s.mutexHelper.AcquireWriteLockWithTimeout()
-			if !acquired {
-				s.WarnLog("failed to acquire write lock within timeout")
-				writer.WriteString("-ERR Server busy, please try again\r\n")
-				writer.Flush()
-				recordMetrics("failure")
-				continue
-			}
-
-			s.inboxMailboxID = inboxMailboxID.ID
-			// Initialize User for connection tracking - will use correct email below
-			// For impersonation: authzID, otherwise: authnID
-			var userEmail string
+			userEmail := authnID
+			method := ""
 			if impersonating {
 				userEmail = authzID
-			} else {
-				userEmail = authnID
+				method = "master"
 			}
-			userAddr, _ := server.NewAddress(userEmail)
-			s.User = server.NewUser(userAddr, accountID)
-			s.deleted = make(map[int]bool) // Initialize deletion map on authentication
-			s.useMasterDB.Store(true)      // Pin session to master DB after a write to ensure consistency
-			release()
-
-			s.server.authenticatedConnections.Add(1)
-
-			// Log authentication success with standardized format
-			// Note: Regular auth via Authenticate() already logs in server.go with cached/method
-			// For master SASL auth, we log here with method=master
-			if impersonating {
-				duration := time.Since(start)
-				s.InfoLog("authentication successful", "address", authzID, "account_id", accountID, "cached", false, "method", "master", "duration", fmt.Sprintf("%.3fs", duration.Seconds()))
-			}
-
-			// Track successful authentication - MUST be before setting authenticated flag
-			metrics.AuthenticatedConnectionsCurrent.WithLabelValues("pop3", s.server.name, s.server.hostname).Inc()
-			metrics.CriticalOperationDuration.WithLabelValues("pop3_authentication").Observe(time.Since(start).Seconds())
-
-			// IMPORTANT: Set authenticated flag AFTER incrementing both counters to prevent race condition
-			s.authenticated.Store(true)
-
-			// Register connection for tracking
-			if impersonating {
-				s.registerConnection(authzID)
-			} else {
-				s.registerConnection(authnID)
+			if !s.completeAuthentication(ctx, writer, accountID, userEmail, method, start) {
+				recordMetrics("failure")
+				continue
 			}
 
-			// Start termination poller to check for kick commands
-			s.startTerminationPoller()
-
-			writer.WriteString("+OK Authentication successful\r\n")
-
 			recordMetrics("success")
 
 		case "LANG":
@@ -1943,6 +1900,76 @@ func isNotExist(err error) bool {
 	return err != nil && os.IsNotExist(err)
 }
 
+// completeAuthentication prepares the session of an authenticated account and
+// writes the success response. userEmail is the address the user logged in as.
+// method is logged for logins that do not go through Authenticate, which logs
+// on its own. On failure the error response has been written and false is
+// returned.
+func (s *POP3Session) completeAuthentication(ctx context.Context, writer *bufio.Writer, accountID int64, userEmail, method string, start time.Time) bool {
+	// This is a potential write operation.
+	// Ensure default mailboxes (INBOX/Drafts/Sent/Spam/Trash) exist
+	if err := s.server.rdb.CreateDefaultMailboxesWithRetry(ctx, accountID); err != nil {
+		s.DebugLog("error creating default mailboxes", "error", err)
+		writer.WriteString("-ERR [SYS/TEMP] Service temporarily unavailable, please try again later\r\n")
+		writer.Flush()
+		return false
+	}
+	// Create a context that signals to the DB layer to use the master connection.
+	// We will set useMasterDB later under the write lock.
+	readCtx := context.WithValue(ctx, consts.UseMasterDBKey, true)
+
+	inboxMailboxID, err := s.server.rdb.GetMailboxByNameWithRetry(readCtx, accountID, consts.MailboxInbox)
+	if err != nil {
+		s.DebugLog("error getting inbox", "error", err)
+		writer.WriteString("-ERR [SYS/TEMP] Service temporarily unavailable, please try again later\r\n")
+		writer.Flush()
+		return false
+	}
+
+	// Acquire write lock to update session state
+	acquired, release := s.mutexHelper.AcquireWriteLockWithTimeout()
+	if !acquired {
+		s.WarnLog("failed to acquire write lock within timeout")
+		writer.WriteString("-ERR Server busy, please try again\r\n")
+		writer.Flush()
+		return false
+	}
+
+	s.inboxMailboxID = inboxMailboxID.ID
+	// Initialize User for connection tracking
+	userAddr, _ := server.NewAddress(userEmail)
+	s.User = server.NewUser(userAddr, accountID)
+	s.deleted = make(map[int]bool) // Initialize deletion map on authentication
+	s.useMasterDB.Store(true)      // Pin session to master DB after a write to ensure consistency
+	release()
+
+	s.server.authenticatedConnections.Add(1)
+
+	// Log authentication success with standardized format
+	// Note: Regular auth via Authenticate() already logs in server.go with cached/method
+	// For master SASL and OAuth auth, we log here with the method
+	if method != "" {
+		duration := time.Since(start)
+		s.InfoLog("authentication successful", "address", userEmail, "account_id", accountID, "cached", false, "method", method, "duration", fmt.Sprintf("%.3fs", duration.Seconds()))
+	}
+
+	// Track successful authentication - MUST be before setting authenticated flag
+	metrics.AuthenticatedConnectionsCurrent.WithLabelValues("pop3", s.server.name, s.server.hostname).Inc()
+	metrics.CriticalOperationDuration.WithLabelValues("pop3_authentication").Observe(time.Since(start).Seconds())
+
+	// IMPORTANT: Set authenticated flag AFTER incrementing both counters to prevent race condition
+	s.authenticated.Store(true)
+
+	// Register connection for tracking
+	s.registerConnection(userEmail)
+
+	// Start termination poller to check for kick commands
+	s.startTerminationPoller()
+
+	writer.WriteString("+OK Authentication successful\r\n")
+	return true
+}
+
 func (s *POP3Session) handleClientError(writer *bufio.Writer, errMsg string) bool {
 	s.errorsCount++
 	if s.errorsCount > Pop3MaxErrorsAllowed {
@@ -0,0 +1,181 @@
+package pop3proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/metrics"
+	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/oauth"
+	"github.com/migadu/sora/server/proxy"
+)
+
+// handleOAuthAuth runs an OAUTHBEARER or XOAUTH2 exchange for the decoded
+// client response. It returns true once the user is authenticated and the
+// backend connection is established; on failure the error response has
+// already been sent.
+func (s *POP3ProxySession) handleOAuthAuth(reader *bufio.Reader, writer *bufio.Writer, mechanism string, response []byte) bool {
+	authzID, token, err := oauth.ParseResponse(mechanism, response)
+	if err != nil {
+		s.handleAuthError(writer, "-ERR Invalid authentication format\r\n")
+		return false
+	}
+
+	if err := s.authenticateOAuth(mechanism, authzID, token); err != nil {
+		s.DebugLog("SASL authentication failed", "mechanism", mechanism, "error", err)
+
+		// RFC 7628: send the error as a final challenge and wait for the client's dummy response
+		writer.WriteString("+ " + base64.StdEncoding.EncodeToString(oauth.ErrorChallenge(mechanism)) + "\r\n")
+		writer.Flush()
+		if _, err := reader.ReadString('\n'); err != nil {
+			s.DebugLog("error reading oauth error acknowledgement", "error", err)
+		}
+
+		if server.IsTemporaryAuthFailure(err) {
+			writer.WriteString("-ERR [SYS/TEMP] Service temporarily unavailable, please try again later\r\n")
+		} else if server.IsBackendError(err) {
+			s.WarnLog("Backend error during SASL authentication", "error", err)
+			writer.WriteString("-ERR [SYS/TEMP] Backend server temporarily unavailable\r\n")
+		} else {
+			writer.WriteString("-ERR [AUTH] Authentication failed\r\n")
+		}
+		writer.Flush()
+		return false
+	}
+	return true
+}
+
+// authenticateOAuth validates a bearer token locally, resolves the account and
+// backend route for its user and connects to the backend. Like master username
+// logins, remotelookup is queried with route_only since there is no password
+// to check.
+func (s *POP3ProxySession) authenticateOAuth(mechanism, authzID, token string) error {
+	authTimeout := s.server.connManager.GetRemoteLookupTimeout()
+	ctx, cancel := context.WithTimeout(s.ctx, authTimeout)
+	defer cancel()
+
+	// Apply progressive authentication delay BEFORE any other checks
+	remoteAddr := s.clientConn.RemoteAddr()
+	server.ApplyAuthenticationDelay(ctx, s.server.authLimiter, remoteAddr, "POP3-PROXY-OAUTH")
+
+	if err := s.server.authLimiter.CanAttemptAuthWithProxy(ctx, s.clientConn, nil, authzID); err != nil {
+		metrics.ProtocolErrors.WithLabelValues("pop3_proxy", "AUTH", "rate_limited", "client_error").Inc()
+		return err
+	}
+
+	recordFailure := func(user string) {
+		s.server.authLimiter.RecordAuthAttemptWithProxy(ctx, s.clientConn, s.proxyInfo, user, false)
+		metrics.AuthenticationAttempts.WithLabelValues("pop3_proxy", s.server.name, s.server.hostname, "failure").Inc()
+	}
+
+	username, err := oauth.Authorize(ctx, s.server.oauthValidator, authzID, token)
+	if err != nil {
+		if s.ctx.Err() != nil {
+			return server.ErrServerShuttingDown
+		}
+		if errors.Is(err, oauth.ErrUnavailable) {
+			s.WarnLog("oauth token validation unavailable", "mechanism", mechanism, "error", err)
+			return server.ErrAuthServiceUnavailable
+		}
+		s.InfoLog("authentication failed", "reason", "invalid_token", "mechanism", mechanism, "error", err)
+		recordFailure(authzID)
+		return consts.ErrAuthenticationFailed
+	}
+
+	address, err := server.NewAddress(username)
+	if err != nil {
+		s.InfoLog("authentication failed", "reason", "invalid_token_username", "mechanism", mechanism, "username", username)
+		recordFailure(username)
+		return consts.ErrAuthenticationFailed
+	}
+	s.username = address.BaseAddress()
+
+	routed := false
+	if s.server.connManager.HasRouting() {
+		clientIP, _ := server.GetHostPortFromAddr(remoteAddr)
+		routingInfo, authResult, err := s.server.connManager.AuthenticateAndRouteWithClientIP(proxy.WithAuthMechanism(ctx, mechanism), address.BaseAddress(), "", clientIP, true)
+		logger.Debug("remotelookup oauth routing", "proto", "pop3_proxy", "name", s.server.name, "user", address.BaseAddress(), "result", authResult.String(), "error", err)
+
+		if err != nil {
+			if errors.Is(err, proxy.ErrRemoteLookupInvalidResponse) {
+				recordFailure(address.BaseAddress())
+				return fmt.Errorf("remotelookup server error: invalid response")
+			}
+			if errors.Is(err, proxy.ErrRemoteLookupTransient) {
+				if errors.Is(err, server.ErrServerShuttingDown) {
+					return server.ErrServerShuttingDown
+				}
+				s.WarnLog("remotelookup transient error - service unavailable", "error", err)
+				return server.ErrAuthServiceUnavailable
+			}
+			// Unknown error type - fallthrough to main DB
+		} else {
+			switch authResult {
+			case proxy.AuthSuccess:
+				s.accountID = routingInfo.AccountID
+				s.isRemoteLookupAccount = routingInfo.IsRemoteLookupAccount
+				s.routingInfo = routingInfo
+				if routingInfo.ActualEmail != "" {
+					s.username = routingInfo.ActualEmail
+				}
+				routed = true
+
+			case proxy.AuthFailed:
+				s.InfoLog("authentication failed", "reason", "remotelookup_rejected", "mechanism", mechanism)
+				recordFailure(address.BaseAddress())
+				return consts.ErrAuthenticationFailed
+
+			case proxy.AuthTemporarilyUnavailable:
+				s.WarnLog("remotelookup service temporarily unavailable")
+				return server.ErrAuthServiceUnavailable
+
+			case proxy.AuthUserNotFound:
+				if s.server.remotelookupConfig == nil || !s.server.remotelookupConfig.ShouldLookupLocalUsers() {
+					s.InfoLog("user not found in remotelookup, local lookup disabled - rejecting", "mechanism", mechanism)
+					recordFailure(address.BaseAddress())
+					return consts.ErrAuthenticationFailed
+				}
+				// Fallthrough to main DB
+			}
+		}
+	}
+
+	if !routed {
+		accountID, err := s.server.rdb.GetLoginAccountIDByAddressWithRetry(ctx, address.BaseAddress())
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return server.ErrServerShuttingDown
+			}
+			s.InfoLog("authentication failed", "reason", "user_not_found", "mechanism", mechanism, "user", address.BaseAddress())
+			recordFailure(address.BaseAddress())
+			return fmt.Errorf("%w: %w", consts.ErrAuthenticationFailed, err)
+		}
+		s.accountID = accountID
+		s.isRemoteLookupAccount = false
+	}
+
+	s.authenticated = true
+	s.server.authLimiter.RecordAuthAttemptWithProxy(ctx, s.clientConn, s.proxyInfo, s.username, true)
+	metrics.AuthenticationAttempts.WithLabelValues("pop3_proxy", s.server.name, s.server.hostname, "success").Inc()
+	if addr, err := server.NewAddress(s.username); err == nil {
+		metrics.TrackDomainConnection("pop3_proxy", addr.Domain())
+		metrics.TrackUserActivity("pop3_proxy", addr.FullAddress(), "connection", 1)
+	}
+	s.InfoLog("authentication successful", "cached", false, "method", "oauth", "mechanism", mechanism)
+
+	// Set username on client connection for timeout logging
+	if soraConn, ok := s.clientConn.(interface{ SetUsername(string) }); ok {
+		soraConn.SetUsername(s.username)
+	}
+
+	// Connect to backend
+	if err := s.connectToBackend(); err != nil {
+		return fmt.Errorf("failed to connect to backend: %w", err)
+	}
+	return nil
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/migadu/sora/pkg/metrics"
 	"github.com/migadu/sora/pkg/resilient"
 	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/oauth"
 	"github.com/migadu/sora/server/proxy"
 )
 
@@ -44,6 +45,7 @@ type POP3ProxyServer struct {
 	authLimiter            server.AuthLimiter
 	trustedProxies         []string // CIDR blocks for trusted proxies that can forward parameters
 	remotelookupConfig     *config.RemoteLookupConfig
+	oauthValidator         oauth.Validator
 	authIdleTimeout        time.Duration
 	commandTimeout         time.Duration // Idle timeout
 	absoluteSessionTimeout time.Duration // Maximum total session duration
@@ -155,6 +157,7 @@ type POP3ProxyServerOptions struct {
 	AffinityStickiness       float64
 	AuthRateLimit            server.AuthRateLimiterConfig
 	RemoteLookup             *config.RemoteLookupConfig
+	OAuth                    *config.OAuthConfig
 	TrustedProxies           []string // CIDR blocks for trusted proxies that can forward parameters
 	RemoteUseXCLIENT         bool     // Whether backend supports XCLIENT command for forwarding
 
@@ -182,6 +185,12 @@ func New(appCtx context.Context, hostname, addr string, rdb *resilient.Resilient
 	// Create a new context with a cancel function for clean shutdown
 	serverCtx, serverCancel := context.WithCancel(appCtx)
 
+	oauthValidator, err := oauth.New(options.OAuth)
+	if err != nil {
+		serverCancel()
+		return nil, fmt.Errorf("failed to initialize OAuth: %w", err)
+	}
+
 	// Ensure RemoteLookup config has a default value to avoid nil panics.
 	if options.RemoteLookup == nil {
 		options.RemoteLookup = &config.RemoteLookupConfig{}
@@ -352,6 +361,7 @@ func New(appCtx context.Context, hostname, addr string, rdb *resilient.Resilient
 		authLimiter:                authLimiter,
 		trustedProxies:             options.TrustedProxies,
 		remotelookupConfig:         options.RemoteLookup,
+		oauthValidator:             oauthValidator,
 		authIdleTimeout:            options.AuthIdleTimeout,
 		commandTimeout:             options.CommandTimeout,
 		absoluteSessionTimeout:     options.AbsoluteSessionTimeout,
@@ -587,6 +597,10 @@ func (s *POP3ProxyServer) SetConnectionTracker(tracker *server.ConnectionTracker
 	if tracker != nil && s.lookupCache != nil {
 		tracker.SetLookupCache(s.lookupCache)
 	}
+	// Drop cached credentials of kicked users (e.g. on account suspension)
+	if tracker != nil && s.rdb != nil {
+		tracker.SetAuthCache(s.rdb)
+	}
 }
 
 // GetConnectionTracker returns the connection tracker for the server.
@@ -16,9 +16,11 @@ import (
 
 	"github.com/migadu/sora/consts"
 	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/events"
 	"github.com/migadu/sora/pkg/lookupcache"
 	"github.com/migadu/sora/pkg/metrics"
 	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/oauth"
 	"github.com/migadu/sora/server/proxy"
 )
 
@@ -132,7 +134,11 @@ func (s *POP3ProxySession) handleConnection() {
 			// Return proxy capabilities before authentication
 			writer.WriteString("+OK Capability list follows\r\n")
 			writer.WriteString("USER\r\n")
-			writer.WriteString("SASL PLAIN\r\n")
+			if s.server.oauthValidator != nil {
+				writer.WriteString("SASL PLAIN OAUTHBEARER XOAUTH2\r\n")
+			} else {
+				writer.WriteString("SASL PLAIN\r\n")
+			}
 			writer.WriteString("RESP-CODES\r\n")
 			writer.WriteString("AUTH-RESP-CODE\r\n")
 			writer.WriteString("IMPLEMENTATION Sora-POP3-Proxy\r\n")
@@ -230,7 +236,7 @@ func (s *POP3ProxySession) handleConnection() {
 			// Remove quotes from mechanism if present for compatibility
 			mechanism := server.UnquoteString(parts[1])
 			mechanism = strings.ToUpper(mechanism)
-			if mechanism != "PLAIN" {
+			if mechanism != "PLAIN" && (!oauth.IsMechanism(mechanism) || s.server.oauthValidator == nil) {
 				if s.handleAuthError(writer, "-ERR Unsupported authentication mechanism\r\n") {
 					return
 				}
@@ -274,6 +280,14 @@ func (s *POP3ProxySession) handleConnection() {
 				continue
 			}
 
+			if mechanism != "PLAIN" {
+				if !s.handleOAuthAuth(reader, writer, mechanism, decoded) {
+					continue
+				}
+				s.completeSASLAuthentication(writer, mechanism, authStart)
+				return
+			}
+
 			// Parse SASL PLAIN format: [authz-id] \0 authn-id \0 password
 			authParts := strings.Split(string(decoded), "\x00")
 			if len(authParts) != 3 {
@@ -313,31 +327,7 @@ func (s *POP3ProxySession) handleConnection() {
 				continue
 			}
 
-			writer.WriteString("+OK Authentication successful\r\n")
-			writer.Flush()
-
-			// Log authentication at INFO level with all required fields
-			duration := time.Since(authStart)
-			s.InfoLog("authenticated via SASL PLAIN",
-				"address", s.username,
-				"backend", s.serverAddr,
-				"routing", s.routingMethod,
-				"duration", fmt.Sprintf("%.3fs", duration.Seconds()))
-
-			// Clear the read deadline before moving to the proxying phase, which sets its own.
-			if s.server.authIdleTimeout > 0 {
-				if err := s.clientConn.SetReadDeadline(time.Time{}); err != nil {
-					s.WarnLog("Failed to clear read deadline", "error", err)
-				}
-			}
-
-			// Register connection
-			if err := s.registerConnection(); err != nil {
-				s.InfoLog("rejected connection registration", "error", err)
-			}
-
-			// Start proxying
-			s.startProxying()
+			s.completeSASLAuthentication(writer, mechanism, authStart)
 			return
 
 		case "QUIT":
@@ -354,6 +344,36 @@ func (s *POP3ProxySession) handleConnection() {
 	}
 }
 
+// completeSASLAuthentication confirms a successful AUTH to the client and
+// switches the session to proxying.
+func (s *POP3ProxySession) completeSASLAuthentication(writer *bufio.Writer, mechanism string, authStart time.Time) {
+	writer.WriteString("+OK Authentication successful\r\n")
+	writer.Flush()
+
+	// Log authentication at INFO level with all required fields
+	duration := time.Since(authStart)
+	s.InfoLog("authenticated via SASL "+mechanism,
+		"address", s.username,
+		"backend", s.serverAddr,
+		"routing", s.routingMethod,
+		"duration", fmt.Sprintf("%.3fs", duration.Seconds()))
+
+	// Clear the read deadline before moving to the proxying phase, which sets its own.
+	if s.server.authIdleTimeout > 0 {
+		if err := s.clientConn.SetReadDeadline(time.Time{}); err != nil {
+			s.WarnLog("Failed to clear read deadline", "error", err)
+		}
+	}
+
+	// Register connection
+	if err := s.registerConnection(); err != nil {
+		s.InfoLog("rejected connection registration", "error", err)
+	}
+
+	// Start proxying
+	s.startProxying()
+}
+
 // handleAuthError increments the error count, sends an error response, and
 // returns true if the connection should be dropped.
 func (s *POP3ProxySession) handleAuthError(writer *bufio.Writer, response string) bool {
@@ -804,7 +824,7 @@ func (s *POP3ProxySession) authenticate(username, password string) error {
 		// Regular authentication via main DB
 		s.DebugLog("Authenticating user via main database")
 		// Use base address (without +detail) for authentication
-		accountID, err = s.server.rdb.AuthenticateWithRetry(ctx, address.BaseAddress(), password)
+		accountID, err = s.server.rdb.AuthenticateWithRetry(events.WithSource(ctx, "pop3", s.RemoteIP), address.BaseAddress(), password)
 		if err != nil {
 			// Check if error is due to session context cancellation (server shutdown)
 			// Note: Must check s.ctx.Err(), not just the query error, because the query context
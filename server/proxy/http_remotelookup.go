@@ -11,6 +11,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 	"time"
 
@@ -67,6 +68,7 @@ type HTTPRemoteLookupResponse struct {
 	Address      string `json:"address"`       // Email address for the user (required - used to derive account_id)
 	PasswordHash string `json:"password_hash"` // Password hash to verify against (required)
 	Server       string `json:"server"`        // Backend server IP/hostname:port (optional - if empty, uses auth-only mode)
+	Status       string `json:"status"`        // Account status (optional - "active" when empty); statuses that block logins fail authentication
 	AccountID    int64  // Derived from Address, not part of JSON response
 	AuthOnlyMode bool   // Internal flag: true when Server is empty (auth-only, local backend selection)
 }
@@ -274,7 +276,17 @@ func (c *HTTPRemoteLookupClient) LookupUserRouteWithClientIP(ctx context.Context
 			}
 		}
 
-		logger.Debug("remotelookup: Requesting lookup", "user", lookupEmail, "client_ip", clientIP, "url", requestURL, "route_only", routeOnly)
+		// Tell the lookup service which SASL mechanism was used (e.g. for OAuth logins,
+		// which are always route_only since the token was validated by the proxy)
+		if mechanism := AuthMechanismFromContext(ctx); mechanism != "" {
+			if strings.Contains(requestURL, "?") {
+				requestURL += "&auth_mechanism=" + url.QueryEscape(mechanism)
+			} else {
+				requestURL += "?auth_mechanism=" + url.QueryEscape(mechanism)
+			}
+		}
+
+		logger.Debug("remotelookup: Requesting lookup", "user", lookupEmail, "client_ip", clientIP, "url", requestURL, "route_only", routeOnly, "auth_mechanism", AuthMechanismFromContext(ctx))
 
 		// Make HTTP request
 		req, err := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
@@ -372,6 +384,12 @@ func (c *HTTPRemoteLookupClient) LookupUserRouteWithClientIP(ctx context.Context
 			return nil, fmt.Errorf("%w: password_hash is empty in response", ErrRemoteLookupInvalidResponse)
 		}
 
+		// Unknown statuses fail closed rather than letting a blocked account in
+		if lookupResp.Status != "" && !slices.Contains(db.AccountStatuses, lookupResp.Status) {
+			logger.Warn("remotelookup: Validation failed - unknown account status", "user", lookupEmail, "status", lookupResp.Status)
+			return nil, fmt.Errorf("%w: unknown account status %q in response", ErrRemoteLookupInvalidResponse, lookupResp.Status)
+		}
+
 		// If server is null/empty, this is auth-only mode (remotelookup handles authentication,
 		// Sora handles backend selection via affinity/consistent-hash/round-robin)
 		// We mark this with a special flag in the response so it can be processed differently
@@ -443,6 +461,13 @@ func (c *HTTPRemoteLookupClient) LookupUserRouteWithClientIP(ctx context.Context
 	}
 
 	if !routeOnly {
+		// The account may exist and the password may match, but the login is
+		// still refused while the account status blocks it
+		if lookupResp.Status != "" && !db.AccountStatusAllowsLogin(lookupResp.Status) {
+			logger.Info("remotelookup: Account status blocks login", "user", authEmail, "status", lookupResp.Status)
+			return nil, AuthFailed, nil
+		}
+
 		// Verify password against hash returned by HTTP endpoint
 		// Note: The HTTP endpoint handles all master token logic and returns the appropriate hash
 		if !c.verifyPassword(password, lookupResp.PasswordHash) {
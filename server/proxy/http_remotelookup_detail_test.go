@@ -180,3 +180,41 @@ func TestHTTPRemoteLookupURLEncoding(t *testing.T) {
 		})
 	}
 }
+
+// TestHTTPRemoteLookupAuthMechanism verifies that the SASL mechanism set on the
+// context is sent along with route_only for token logins
+func TestHTTPRemoteLookupAuthMechanism(t *testing.T) {
+	var captured url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"address": "user@example.com",
+			"server":  "backend:143",
+		})
+	}))
+	defer server.Close()
+
+	client := NewHTTPRemoteLookupClient(server.URL+"/lookup?email=$email", 5*time.Second, "", 143,
+		false, false, false, false, false, false, nil, nil)
+
+	ctx := WithAuthMechanism(context.Background(), "OAUTHBEARER")
+	info, result, err := client.LookupUserRouteWithClientIP(ctx, "user@example.com", "", "", true)
+	if err != nil || result != AuthSuccess || info == nil {
+		t.Fatalf("lookup: %v, %v, %v", info, result, err)
+	}
+	if got := captured.Get("auth_mechanism"); got != "oauthbearer" {
+		t.Errorf("auth_mechanism = %q, want oauthbearer", got)
+	}
+	if got := captured.Get("route_only"); got != "true" {
+		t.Errorf("route_only = %q, want true", got)
+	}
+
+	// Password logins don't send the parameter
+	if _, _, err := client.LookupUserRouteWithClientIP(context.Background(), "user@example.com", "", "", true); err != nil {
+		t.Fatal(err)
+	}
+	if captured.Has("auth_mechanism") {
+		t.Errorf("unexpected auth_mechanism %q", captured.Get("auth_mechanism"))
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"net/http/httptest"
 	"testing"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 // TestHTTPRemoteLookupErrorTypes verifies that the HTTP remotelookup client returns
@@ -136,6 +138,21 @@ func TestHTTPRemoteLookupErrorTypes(t *testing.T) {
 			expectErrorType:  nil,
 			description:      "200 with missing server triggers auth-only mode (password verification still happens)",
 		},
+		{
+			name: "200_UnknownStatus",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]any{
+					"address":       "user@example.com",
+					"password_hash": "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy",
+					"server":        "backend:143",
+					"status":        "disabled",
+				})
+			},
+			expectAuthResult: AuthFailed,
+			expectErrorType:  ErrRemoteLookupInvalidResponse,
+			description:      "200 with an unknown account status should return ErrRemoteLookupInvalidResponse",
+		},
 		{
 			name: "200_ValidResponse",
 			handler: func(w http.ResponseWriter, r *http.Request) {
@@ -206,6 +223,54 @@ func TestHTTPRemoteLookupErrorTypes(t *testing.T) {
 	}
 }
 
+// TestHTTPRemoteLookupAccountStatus verifies that statuses blocking logins fail
+// authentication even with the right password, unless only the route is needed
+func TestHTTPRemoteLookupAccountStatus(t *testing.T) {
+	tests := []struct {
+		status    string
+		routeOnly bool
+		expect    AuthResult
+	}{
+		{"", false, AuthSuccess},
+		{"active", false, AuthSuccess},
+		{"send-disabled", false, AuthSuccess},
+		{"suspended", false, AuthFailed},
+		{"receive-only", false, AuthFailed},
+		{"suspended", true, AuthSuccess},
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]any{
+					"address":       "user@example.com",
+					"password_hash": string(hash),
+					"server":        "backend:143",
+					"status":        tt.status,
+				})
+			}))
+			defer server.Close()
+
+			client := NewHTTPRemoteLookupClient(server.URL+"/lookup?email=$email", 5*time.Second, "test-token", 143,
+				false, false, false, false, false, false, nil, nil)
+
+			_, authResult, err := client.LookupUserRouteWithOptions(context.Background(), "user@example.com", "password", tt.routeOnly)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if authResult != tt.expect {
+				t.Errorf("status %q (route only %v): expected AuthResult %v, got %v", tt.status, tt.routeOnly, tt.expect, authResult)
+			}
+		})
+	}
+}
+
 // TestHTTPRemoteLookupNetworkError verifies that network errors return ErrRemoteLookupTransient
 func TestHTTPRemoteLookupNetworkError(t *testing.T) {
 	// Create remotelookup client pointing to non-existent server
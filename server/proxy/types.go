@@ -47,6 +47,22 @@ var (
 	ErrRemoteLookupInvalidResponse = errors.New("remotelookup invalid response")
 )
 
+type authMechanismKey struct{}
+
+// WithAuthMechanism returns a context that makes remotelookup requests carry
+// the SASL mechanism the client authenticated with (e.g. "oauthbearer"), so
+// the lookup service can tell token logins apart from password logins.
+func WithAuthMechanism(ctx context.Context, mechanism string) context.Context {
+	return context.WithValue(ctx, authMechanismKey{}, strings.ToLower(mechanism))
+}
+
+// AuthMechanismFromContext returns the mechanism set by WithAuthMechanism, or
+// "" when none was set.
+func AuthMechanismFromContext(ctx context.Context) string {
+	mechanism, _ := ctx.Value(authMechanismKey{}).(string)
+	return mechanism
+}
+
 // UserRoutingLookup interface for routing lookups
 // NOTE: No caching - remotelookup is just a data source, caching happens at higher level
 type UserRoutingLookup interface {
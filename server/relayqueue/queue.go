@@ -18,7 +18,7 @@ type QueuedMessage struct {
 	ID          string    `json:"id"`           // Unique message ID
 	From        string    `json:"from"`         // Sender address
 	To          string    `json:"to"`           // Recipient address
-	Type        string    `json:"type"`         // "redirect" or "vacation"
+	Type        string    `json:"type"`         // "redirect", "vacation", "forward", "reject", "notify" or "submission"
 	QueuedAt    time.Time `json:"queued_at"`    // When first queued
 	Attempts    int       `json:"attempts"`     // Number of delivery attempts
 	LastAttempt time.Time `json:"last_attempt"` // Last attempt timestamp
@@ -201,10 +201,41 @@ func (q *DiskQueue) CleanupOldFailedMessages(retentionPeriod time.Duration) (int
 
 // Enqueue adds a new message to the relay queue
 func (q *DiskQueue) Enqueue(from, to, messageType string, messageBytes []byte) error {
-	start := time.Now()
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
+	_, err := q.enqueue(from, to, messageType, messageBytes)
+	return err
+}
+
+// EnqueueAll adds a message to the relay queue once per recipient. Either all
+// recipients are queued or, on error, none of them: entries written before the
+// error are removed again. The worker cannot acquire them in between since the
+// queue is locked.
+func (q *DiskQueue) EnqueueAll(from string, to []string, messageType string, messageBytes []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ids := make([]string, 0, len(to))
+	for _, rcpt := range to {
+		id, err := q.enqueue(from, rcpt, messageType, messageBytes)
+		if err != nil {
+			for _, queued := range ids {
+				os.Remove(filepath.Join(q.pendingDir, queued+".json"))
+				os.Remove(filepath.Join(q.pendingDir, queued+".msg"))
+			}
+			return err
+		}
+		ids = append(ids, id)
+	}
+	return nil
+}
+
+// enqueue writes a message for one recipient to the pending directory and
+// returns its ID. The caller must hold q.mu.
+func (q *DiskQueue) enqueue(from, to, messageType string, messageBytes []byte) (string, error) {
+	start := time.Now()
+
 	// Generate unique ID
 	id := uuid.New().String()
 
@@ -226,7 +257,7 @@ func (q *DiskQueue) Enqueue(from, to, messageType string, messageBytes []byte) e
 	if err := q.writeFileAtomic(metadataPath, metadata); err != nil {
 		metrics.RelayQueueOperations.WithLabelValues("enqueue", "error").Inc()
 		metrics.RelayQueueOperationDuration.WithLabelValues("enqueue").Observe(time.Since(start).Seconds())
-		return fmt.Errorf("failed to write metadata: %w", err)
+		return "", fmt.Errorf("failed to write metadata: %w", err)
 	}
 
 	// Write message body atomically
@@ -236,13 +267,13 @@ func (q *DiskQueue) Enqueue(from, to, messageType string, messageBytes []byte) e
 		os.Remove(metadataPath)
 		metrics.RelayQueueOperations.WithLabelValues("enqueue", "error").Inc()
 		metrics.RelayQueueOperationDuration.WithLabelValues("enqueue").Observe(time.Since(start).Seconds())
-		return fmt.Errorf("failed to write message: %w", err)
+		return "", fmt.Errorf("failed to write message: %w", err)
 	}
 
 	metrics.RelayQueueOperations.WithLabelValues("enqueue", "success").Inc()
 	metrics.RelayQueueOperationDuration.WithLabelValues("enqueue").Observe(time.Since(start).Seconds())
 	logger.Info("RelayQueue: Enqueued message", "type", messageType, "id", id, "from", from, "to", to)
-	return nil
+	return id, nil
 }
 
 // AcquireNext finds the next message ready for processing and moves it to processing state
@@ -170,6 +170,49 @@ func TestEnqueue(t *testing.T) {
 	}
 }
 
+// TestEnqueueAll tests queueing a message for several recipients at once
+func TestEnqueueAll(t *testing.T) {
+	queue, err := NewDiskQueue(t.TempDir(), 10, nil)
+	if err != nil {
+		t.Fatalf("Failed to create queue: %v", err)
+	}
+
+	to := []string{"a@example.com", "b@example.com", "c@example.com"}
+	if err := queue.EnqueueAll("sender@example.com", to, "submission", []byte("Subject: Test\r\n\r\nTest")); err != nil {
+		t.Fatalf("EnqueueAll failed: %v", err)
+	}
+
+	pending, _, _, err := queue.GetStats()
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	if pending != len(to) {
+		t.Errorf("Expected %d pending messages, got %d", len(to), pending)
+	}
+
+	recipients := make(map[string]bool)
+	for range to {
+		msg, _, err := queue.AcquireNext()
+		if err != nil || msg == nil {
+			t.Fatalf("AcquireNext failed: %v", err)
+		}
+		recipients[msg.To] = true
+	}
+	for _, rcpt := range to {
+		if !recipients[rcpt] {
+			t.Errorf("Expected a queued message for %s", rcpt)
+		}
+	}
+
+	// Without a pending directory nothing can be queued
+	if err := os.RemoveAll(queue.pendingDir); err != nil {
+		t.Fatalf("Failed to remove pending directory: %v", err)
+	}
+	if err := queue.EnqueueAll("sender@example.com", to, "submission", []byte("Test")); err == nil {
+		t.Error("Expected EnqueueAll to fail without a pending directory")
+	}
+}
+
 // TestAcquireNext tests acquiring messages for processing
 func TestAcquireNext(t *testing.T) {
 	queue, err := NewDiskQueue(t.TempDir(), 10, nil)
@@ -36,8 +36,12 @@
 // SIEVE scripts are executed during LMTP delivery:
 //  1. Parse and validate script
 //  2. Execute tests in order
-//  3. Perform matched actions
-//  4. Implicit "keep" if no explicit action
+//  3. Collect matched actions in script order
+//  4. Implicit "keep" unless fileinto, redirect or discard cancelled it
+//
+// A script may perform several actions, e.g. file a message into two
+// mailboxes and redirect it. The Result lists all of them and the delivery
+// performs them together.
 //
 // # Supported Tests
 //
@@ -85,8 +89,11 @@
 //		// Script error
 //	}
 //
-//	// Apply result actions
-//	if result.Mailbox != "" {
-//		deliverToMailbox(result.Mailbox)
+//	// Apply result actions, in order
+//	for _, action := range result.Deliveries() {
+//		deliverToMailbox(action.Mailbox, action.Flags)
+//	}
+//	for _, action := range result.Redirects() {
+//		redirect(action.RedirectTo)
 //	}
 package sieveengine
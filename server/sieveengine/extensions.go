@@ -0,0 +1,114 @@
+package sieveengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/migadu/sora/pkg/sieveext"
+)
+
+// NotifyLimit notifications (RFC 5435) are sent per account in NotifyWindow.
+// Further notify actions of the window are dropped.
+const (
+	NotifyLimit  = 20
+	NotifyWindow = time.Hour
+)
+
+// NotifyOracle is implemented by vacation oracles that also rate limit the
+// notifications of the enotify extension. Without it, notifications are not
+// limited.
+type NotifyOracle interface {
+	// IsNotificationAllowed reports whether the account sent fewer than
+	// limit notifications in the last window.
+	IsNotificationAllowed(ctx context.Context, AccountID int64, limit int, window time.Duration) (bool, error)
+	// RecordNotificationSent records a notification of the account.
+	RecordNotificationSent(ctx context.Context, AccountID int64, method string) error
+}
+
+// recordExtension records a reject, ereject or notify command, rewritten by
+// sieveext into a redirect of the given kind.
+func (p *SievePolicy) recordExtension(kind, value string) error {
+	switch kind {
+	case sieveext.KindReject, sieveext.KindEReject:
+		// RFC 5429 §2.1: at most one reject or ereject per script run
+		if p.rejection != nil {
+			return errors.New("reject and ereject can only be performed once")
+		}
+		p.rejection = &Action{Type: ActionReject, RejectReason: value, RejectProtocol: kind == sieveext.KindEReject}
+	case sieveext.KindNotifyFrom:
+		p.notify.NotifyFrom = value
+	case sieveext.KindNotifyImportance:
+		if !sieveext.ValidImportance(value) {
+			return fmt.Errorf("notify: invalid :importance %q", value)
+		}
+		p.notify.NotifyImportance = value
+	case sieveext.KindNotifyOption:
+		p.notify.NotifyOptions = append(p.notify.NotifyOptions, value)
+	case sieveext.KindNotifyMessage:
+		p.notify.NotifyMessage = value
+	case sieveext.KindNotify:
+		notify := p.notify
+		p.notify = Action{}
+		if _, err := sieveext.ParseMailto(value); err != nil {
+			return fmt.Errorf("notify: %w", err)
+		}
+		notify.Type = ActionNotify
+		notify.NotifyMethod = value
+		// RFC 5435 §3.9: duplicate notifications are sent once
+		if !slices.ContainsFunc(p.notifications, func(a Action) bool {
+			return strings.EqualFold(a.NotifyMethod, value)
+		}) {
+			p.notifications = append(p.notifications, notify)
+		}
+	default:
+		return fmt.Errorf("unknown rewritten command %q", kind)
+	}
+	return nil
+}
+
+// allowedNotifications returns the notify actions of the script run that
+// the rate limit of the account allows, and records them. Like vacation,
+// a failing oracle drops the notification but not the message.
+func (p *SievePolicy) allowedNotifications(ctx context.Context) []Action {
+	oracle, ok := p.vacationOracle.(NotifyOracle)
+	if !ok {
+		return p.notifications
+	}
+	var allowed []Action
+	for _, notify := range p.notifications {
+		ok, err := oracle.IsNotificationAllowed(ctx, p.AccountID, NotifyLimit, NotifyWindow)
+		if err != nil || !ok {
+			continue
+		}
+		_ = oracle.RecordNotificationSent(ctx, p.AccountID, notify.NotifyMethod)
+		allowed = append(allowed, notify)
+	}
+	return allowed
+}
+
+// Rejection returns the reject or ereject action of the result.
+func (r Result) Rejection() (Action, bool) {
+	for _, action := range r.Actions {
+		if action.Type == ActionReject {
+			return action, true
+		}
+	}
+	return Action{}, false
+}
+
+// Notifications returns the notify actions, one per method.
+func (r Result) Notifications() []Action {
+	var notifications []Action
+	for _, action := range r.Actions {
+		if action.Type == ActionNotify && !slices.ContainsFunc(notifications, func(a Action) bool {
+			return strings.EqualFold(a.NotifyMethod, action.NotifyMethod)
+		}) {
+			notifications = append(notifications, action)
+		}
+	}
+	return notifications
+}
@@ -0,0 +1,293 @@
+package sieveengine
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testExtensionsEnabled = []string{"fileinto", "variables", "vacation", "reject", "ereject", "enotify"}
+
+func evaluateExtensionScript(t *testing.T, script string, oracle VacationOracle) (Result, error) {
+	t.Helper()
+	executor, err := NewSieveExecutorWithOracleAndExtensions(script, 1, oracle, testExtensionsEnabled)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	return executor.Evaluate(context.Background(), Context{
+		EnvelopeFrom: "sender@example.com",
+		EnvelopeTo:   "recipient@example.com",
+		Header: map[string][]string{
+			"Subject": {"Offer"},
+			"From":    {"sender@example.com"},
+		},
+		Body: "Test body",
+	})
+}
+
+func TestReject(t *testing.T) {
+	result, err := evaluateExtensionScript(t, `
+require ["reject", "variables"];
+if header :matches "Subject" "*" {
+	set "subject" "${1}";
+}
+reject "No ${subject} please";
+`, nil)
+	if err != nil {
+		t.Fatalf("Failed to evaluate script: %v", err)
+	}
+	assertActions(t, result, ActionReject)
+	reject, ok := result.Rejection()
+	if !ok || reject.RejectReason != "No Offer please" || reject.RejectProtocol {
+		t.Errorf("Expected reject with expanded reason, got %+v", reject)
+	}
+	if result.Discarded() {
+		t.Error("A rejected message should not be reported as discarded")
+	}
+
+	result, err = evaluateExtensionScript(t, `require "ereject"; ereject "Go away";`, nil)
+	if err != nil {
+		t.Fatalf("Failed to evaluate script: %v", err)
+	}
+	if reject, ok := result.Rejection(); !ok || !reject.RejectProtocol {
+		t.Errorf("Expected ereject, got %+v", result.Actions)
+	}
+}
+
+func TestRejectIncompatibleActions(t *testing.T) {
+	scripts := []string{
+		`require ["reject", "fileinto"]; fileinto "Junk"; reject "No";`,
+		`require "reject"; keep; reject "No";`,
+		`require "reject"; redirect "other@example.com"; reject "No";`,
+		`require ["reject", "vacation"]; vacation "Away"; reject "No";`,
+		`require ["reject", "ereject"]; reject "No"; ereject "No";`,
+	}
+	for _, script := range scripts {
+		if _, err := evaluateExtensionScript(t, script, nil); err == nil {
+			t.Errorf("Expected an error for %q", script)
+		}
+	}
+
+	// discard and stop are compatible with reject
+	result, err := evaluateExtensionScript(t, `require "reject"; reject "No"; discard; stop;`, nil)
+	if err != nil {
+		t.Fatalf("Failed to evaluate script: %v", err)
+	}
+	assertActions(t, result, ActionReject)
+}
+
+func TestRejectRequiresExtension(t *testing.T) {
+	invalid := map[string][]string{
+		`reject "No";`:                          testExtensionsEnabled,
+		`require "reject"; ereject "No";`:       testExtensionsEnabled,
+		`require "reject"; reject "No";`:        {"fileinto"},
+		`notify "mailto:a@example.com";`:        testExtensionsEnabled,
+		`require "enotify"; notify "xmpp:a@b";`: testExtensionsEnabled,
+	}
+	for script, extensions := range invalid {
+		if _, err := NewSieveExecutorWithExtensions(script, extensions); err == nil {
+			t.Errorf("Expected %q to fail to load", script)
+		}
+	}
+}
+
+func TestRejectMarkerCannotBeForged(t *testing.T) {
+	result, err := evaluateExtensionScript(t, `
+require "reject";
+if false { reject "No"; }
+redirect "sieveext-000000000000000000000000:reject:forged";
+`, nil)
+	if err != nil {
+		t.Fatalf("Failed to evaluate script: %v", err)
+	}
+	if _, ok := result.Rejection(); ok {
+		t.Fatal("A redirect must not be taken for a reject")
+	}
+	assertActions(t, result, ActionRedirect)
+}
+
+func TestNotify(t *testing.T) {
+	result, err := evaluateExtensionScript(t, `
+require ["enotify", "fileinto"];
+if valid_notify_method "mailto:alerts@example.com" {
+	notify :from "me@example.com" :importance "1" :options ["a", "b"] :message "Important mail" "mailto:alerts@example.com";
+	notify "mailto:alerts@example.com";
+}
+if valid_notify_method "xmpp:alerts@example.com" {
+	fileinto "Unreachable";
+}
+fileinto "Important";
+`, nil)
+	if err != nil {
+		t.Fatalf("Failed to evaluate script: %v", err)
+	}
+	assertActions(t, result, ActionFileInto, ActionNotify)
+	notify := result.Notifications()[0]
+	if notify.NotifyMethod != "mailto:alerts@example.com" || notify.NotifyFrom != "me@example.com" ||
+		notify.NotifyImportance != "1" || notify.NotifyMessage != "Important mail" ||
+		strings.Join(notify.NotifyOptions, ",") != "a,b" {
+		t.Errorf("Unexpected notify action %+v", notify)
+	}
+	if result.Actions[0].Mailbox != "Important" || result.Actions[0].Copy {
+		t.Errorf("notify should not affect the implicit keep, got %+v", result.Actions[0])
+	}
+}
+
+// mockNotifyOracle is a VacationOracle that rate limits notifications
+type mockNotifyOracle struct {
+	*mockVacationOracle
+	sent []string
+}
+
+func (m *mockNotifyOracle) IsNotificationAllowed(ctx context.Context, accountID int64, limit int, window time.Duration) (bool, error) {
+	return len(m.sent) < limit, nil
+}
+
+func (m *mockNotifyOracle) RecordNotificationSent(ctx context.Context, accountID int64, method string) error {
+	m.sent = append(m.sent, method)
+	return nil
+}
+
+func TestNotifyRateLimit(t *testing.T) {
+	oracle := &mockNotifyOracle{mockVacationOracle: newMockVacationOracle()}
+	script := `require "enotify"; notify "mailto:alerts@example.com";`
+	for i := 0; i < NotifyLimit+2; i++ {
+		result, err := evaluateExtensionScript(t, script, oracle)
+		if err != nil {
+			t.Fatalf("Failed to evaluate script: %v", err)
+		}
+		if got := len(result.Notifications()); (i < NotifyLimit) != (got == 1) {
+			t.Fatalf("Run %d: got %d notifications", i, got)
+		}
+	}
+	if len(oracle.sent) != NotifyLimit {
+		t.Errorf("Expected %d recorded notifications, got %d", NotifyLimit, len(oracle.sent))
+	}
+}
+
+func evaluateFilterScript(t *testing.T, script string, header map[string][]string, filter *FilterHeaders) Result {
+	t.Helper()
+	executor, err := NewSieveExecutorWithExtensions(script, []string{"fileinto", "relational", "comparator-i;ascii-numeric", "spamtestplus", "virustest", "body"})
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	msg := "Subject: Offer\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Cheap m=C3=A9dicine\r\n" +
+		"--b\r\n" +
+		"Content-Type: application/x-report\r\n" +
+		"\r\n" +
+		"Quarterly numbers\r\n" +
+		"--b--\r\n"
+	result, err := executor.Evaluate(context.Background(), Context{
+		EnvelopeFrom: "sender@example.com",
+		EnvelopeTo:   "recipient@example.com",
+		Header:       header,
+		Body:         "Cheap médicine",
+		Message:      []byte(msg),
+		Filter:       filter,
+	})
+	if err != nil {
+		t.Fatalf("Failed to evaluate script: %v", err)
+	}
+	return result
+}
+
+func TestSpamTest(t *testing.T) {
+	script := `
+require ["fileinto", "relational", "comparator-i;ascii-numeric", "spamtestplus"];
+if spamtest :value "eq" :comparator "i;ascii-numeric" "0" {
+	fileinto "Untested";
+} elsif spamtest :percent :value "ge" :comparator "i;ascii-numeric" "50" {
+	fileinto "Junk";
+} elsif spamtest :value "ge" :comparator "i;ascii-numeric" "3" {
+	fileinto "Maybe";
+}
+`
+	filter := &FilterHeaders{SpamHeader: "X-Spam-Status", SpamMinScore: -5, SpamMaxScore: 15}
+	cases := map[string]string{
+		"":                               "Untested",
+		"No, score=-7.1 required=5.0":    "INBOX",
+		"No, score=0.2 required=5.0":     "Maybe",
+		"Yes, score=6.3 required=5.0":    "Junk",
+		"garbage":                        "Untested",
+		"No, hits=1.0 score=4.0 tests=x": "Maybe",
+	}
+	for value, mailbox := range cases {
+		header := map[string][]string{"Subject": {"Offer"}}
+		if value != "" {
+			header["X-Spam-Status"] = []string{value}
+		}
+		result := evaluateFilterScript(t, script, header, filter)
+		if got := result.Actions[0].Mailbox; got != mailbox {
+			t.Errorf("%q: expected %s, got %s", value, mailbox, got)
+		}
+	}
+
+	if got := (*FilterHeaders)(nil).SpamTest(map[string][]string{"x-spam-score": {"7.3"}}); got != "8" {
+		t.Errorf("Expected default scale to give 8, got %s", got)
+	}
+}
+
+func TestVirusTest(t *testing.T) {
+	script := `
+require ["fileinto", "relational", "comparator-i;ascii-numeric", "virustest"];
+if virustest :value "ge" :comparator "i;ascii-numeric" "4" {
+	fileinto "Quarantine";
+}
+`
+	filter := &FilterHeaders{VirusHeader: "X-Virus-Scan", VirusValues: map[string]int{"clean": 1, "infected": 5, "infected-removed": 2}}
+	cases := map[string]string{
+		"Clean":                   "INBOX",
+		"Infected: Eicar-Test":    "Quarantine",
+		"infected-removed: Eicar": "INBOX",
+	}
+	for value, mailbox := range cases {
+		result := evaluateFilterScript(t, script, map[string][]string{"X-Virus-Scan": {value}}, filter)
+		if got := result.Actions[0].Mailbox; got != mailbox {
+			t.Errorf("%q: expected %s, got %s", value, mailbox, got)
+		}
+	}
+}
+
+func TestFilterHeadersCannotBeForged(t *testing.T) {
+	executor, err := NewSieveExecutorWithExtensions(`require ["fileinto", "spamtest"]; if spamtest "10" { fileinto "Junk"; }`, []string{"fileinto", "spamtest"})
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	header := map[string][]string{}
+	for name := range executor.(*SieveExecutor).tests {
+		header[name] = []string{"10"}
+	}
+	result, err := executor.Evaluate(context.Background(), Context{Header: header})
+	if err != nil {
+		t.Fatalf("Failed to evaluate script: %v", err)
+	}
+	assertActions(t, result, ActionKeep)
+}
+
+func TestBody(t *testing.T) {
+	cases := map[string]bool{
+		`body :contains "médicine"`:                             true,
+		`body :text :contains "Quarterly"`:                      false,
+		`body :raw :contains "m=C3=A9dicine"`:                   true,
+		`body :raw :contains "médicine"`:                        false,
+		`body :content "text" :contains "médicine"`:             true,
+		`body :content "application/x-report" :contains "Quar"`: true,
+		`body :content "image" :contains "Quarterly"`:           false,
+		`body :content "" :contains "Quarterly"`:                true,
+	}
+	for test, match := range cases {
+		result := evaluateFilterScript(t, `require ["fileinto", "body"]; if `+test+` { fileinto "Match"; }`, map[string][]string{"Subject": {"Offer"}}, nil)
+		if got := result.Actions[0].Mailbox == "Match"; got != match {
+			t.Errorf("%s: expected %v, got %v", test, match, got)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package sieveengine
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-message"
+	_ "github.com/emersion/go-message/charset"
+	"github.com/migadu/sora/pkg/sieveext"
+)
+
+// Defaults of FilterHeaders.
+const (
+	DefaultSpamHeader  = "X-Spam-Score"
+	DefaultVirusHeader = "X-Virus-Status"
+)
+
+// DefaultVirusValues maps the values of DefaultVirusHeader to virustest
+// results.
+var DefaultVirusValues = map[string]int{"clean": 1, "infected": 5}
+
+// maxBodyPartSize limits the decoded size of a part for body :content.
+const maxBodyPartSize = 1 << 20
+
+// FilterHeaders maps the headers the upstream spam and virus filters add to
+// a message to the results of the spamtest and virustest tests (RFC 5235).
+// Zero fields take the defaults.
+type FilterHeaders struct {
+	// SpamHeader holds the spam score, either a number ("7.3",
+	// "7.30 / 15.00") or a "score=" field ("Yes, score=7.3 required=5.0").
+	SpamHeader string
+	// SpamMinScore is the score of a message that is certainly not spam:
+	// spamtest 1, or 0 with :percent. Lower scores count as SpamMinScore.
+	SpamMinScore float64
+	// SpamMaxScore is the score of a message that is certainly spam:
+	// spamtest 10, or 100 with :percent. Higher scores count as
+	// SpamMaxScore. It defaults to SpamMinScore + 10.
+	SpamMaxScore float64
+
+	// VirusHeader holds the result of the virus scan.
+	VirusHeader string
+	// VirusValues maps the start of VirusHeader values, case-insensitively,
+	// to virustest results from 1 (no virus) to 5 (virus that cannot be
+	// removed). Defaults to DefaultVirusValues.
+	VirusValues map[string]int
+}
+
+var spamScoreRegexp = regexp.MustCompile(`(?i)(?:score=)?(-?\d+(?:\.\d+)?)`)
+
+// spamScore returns the spam score of a message with lowercase header
+// names, and false if it was not tested.
+func (f *FilterHeaders) spamScore(header map[string][]string) (float64, bool) {
+	name := DefaultSpamHeader
+	if f != nil && f.SpamHeader != "" {
+		name = f.SpamHeader
+	}
+	values := header[strings.ToLower(name)]
+	if len(values) == 0 {
+		return 0, false
+	}
+	value := values[0]
+	if i := strings.Index(strings.ToLower(value), "score="); i >= 0 {
+		value = value[i:]
+	}
+	match := spamScoreRegexp.FindStringSubmatch(value)
+	if match == nil {
+		return 0, false
+	}
+	score, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	return score, true
+}
+
+// spamRatio returns the position of the spam score between SpamMinScore
+// and SpamMaxScore, from 0 to 1, and false if the message was not tested.
+func (f *FilterHeaders) spamRatio(header map[string][]string) (float64, bool) {
+	score, ok := f.spamScore(header)
+	if !ok {
+		return 0, false
+	}
+	var minScore, maxScore float64
+	if f != nil {
+		minScore, maxScore = f.SpamMinScore, f.SpamMaxScore
+	}
+	if maxScore <= minScore {
+		maxScore = minScore + 10
+	}
+	return math.Min(1, math.Max(0, (score-minScore)/(maxScore-minScore))), true
+}
+
+// SpamTest returns the result of spamtest (RFC 5235 §3.1): "0" if the
+// message was not tested, else "1" (not spam) to "10" (spam).
+func (f *FilterHeaders) SpamTest(header map[string][]string) string {
+	ratio, ok := f.spamRatio(header)
+	if !ok {
+		return "0"
+	}
+	return strconv.Itoa(1 + int(math.Round(9*ratio)))
+}
+
+// SpamTestPercent returns the result of spamtest :percent (RFC 5235 §3.2):
+// "0" (not spam or not tested) to "100" (spam).
+func (f *FilterHeaders) SpamTestPercent(header map[string][]string) string {
+	ratio, _ := f.spamRatio(header)
+	return strconv.Itoa(int(math.Round(100 * ratio)))
+}
+
+// VirusTest returns the result of virustest (RFC 5235 §3.3): "0" if the
+// message was not tested or the result is not mapped, else "1" to "5".
+func (f *FilterHeaders) VirusTest(header map[string][]string) string {
+	name, values := DefaultVirusHeader, DefaultVirusValues
+	if f != nil && f.VirusHeader != "" {
+		name = f.VirusHeader
+	}
+	if f != nil && len(f.VirusValues) > 0 {
+		values = f.VirusValues
+	}
+	headerValues := header[strings.ToLower(name)]
+	if len(headerValues) == 0 {
+		return "0"
+	}
+	status := strings.ToLower(strings.TrimSpace(headerValues[0]))
+	// The longest matching prefix wins, so "infected" is not taken for "in"
+	result, longest := 0, -1
+	for prefix, value := range values {
+		if strings.HasPrefix(status, strings.ToLower(prefix)) && len(prefix) > longest && value >= 1 && value <= 5 {
+			result, longest = value, len(prefix)
+		}
+	}
+	return strconv.Itoa(result)
+}
+
+// setTestHeaders sets the headers of the spamtest, virustest and body tests
+// a script was rewritten to, see sieveext. Headers of the message with the
+// names of these headers are removed first.
+func setTestHeaders(header map[string][]string, tests map[string]sieveext.Test, ctx Context) {
+	for name := range header {
+		if strings.HasPrefix(name, sieveext.HeaderPrefix) {
+			delete(header, name)
+		}
+	}
+	// Computed from the headers of the message only
+	filterHeader := make(map[string][]string, len(header))
+	for name, values := range header {
+		filterHeader[name] = values
+	}
+	for name, test := range tests {
+		switch test.Kind {
+		case sieveext.TestSpam:
+			header[name] = []string{ctx.Filter.SpamTest(filterHeader)}
+		case sieveext.TestSpamPercent:
+			header[name] = []string{ctx.Filter.SpamTestPercent(filterHeader)}
+		case sieveext.TestVirus:
+			header[name] = []string{ctx.Filter.VirusTest(filterHeader)}
+		case sieveext.TestBodyText:
+			header[name] = []string{ctx.Body}
+		case sieveext.TestBodyRaw:
+			header[name] = []string{string(rawBody(ctx.Message))}
+		case sieveext.TestBodyContent:
+			header[name] = bodyContent(ctx.Message, test.ContentTypes)
+		}
+	}
+}
+
+// rawBody returns the body of a message without decoding it.
+func rawBody(msg []byte) []byte {
+	if i := bytes.Index(msg, []byte("\r\n\r\n")); i >= 0 {
+		return msg[i+4:]
+	}
+	if i := bytes.Index(msg, []byte("\n\n")); i >= 0 {
+		return msg[i+2:]
+	}
+	return nil
+}
+
+// bodyContent returns the decoded parts of a message with the given content
+// types (RFC 5173 §5.2). A type without subtype matches all its subtypes,
+// an empty type matches all parts. Multipart containers are skipped.
+func bodyContent(msg []byte, contentTypes []string) []string {
+	if len(msg) == 0 {
+		return nil
+	}
+	entity, err := message.Read(bytes.NewReader(msg))
+	if entity == nil {
+		return nil
+	}
+	if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+		return nil
+	}
+
+	var parts []string
+	_ = entity.Walk(func(_ []int, part *message.Entity, err error) error {
+		if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+			return nil
+		}
+		mediaType, _, _ := part.Header.ContentType()
+		if mediaType == "" {
+			mediaType = "text/plain"
+		}
+		mediaType = strings.ToLower(mediaType)
+		if strings.HasPrefix(mediaType, "multipart/") || !matchesContentType(mediaType, contentTypes) {
+			return nil
+		}
+		content, err := io.ReadAll(io.LimitReader(part.Body, maxBodyPartSize))
+		if err == nil {
+			parts = append(parts, string(content))
+		}
+		return nil
+	})
+	return parts
+}
+
+func matchesContentType(mediaType string, contentTypes []string) bool {
+	for _, contentType := range contentTypes {
+		contentType = strings.ToLower(strings.TrimSpace(contentType))
+		if contentType == "" || contentType == mediaType ||
+			(!strings.Contains(contentType, "/") && strings.HasPrefix(mediaType, contentType+"/")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package sieveengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/migadu/sora/server/managesieve"
+)
+
+// GlobalSieveExtensions are the extensions of the administrator's before
+// and after scripts when none are configured: every supported extension,
+// editheader included, except vacation. Global scripts run for all
+// accounts, so there is no account to track vacation responses for.
+var GlobalSieveExtensions = GlobalExtensions(nil)
+
+// GlobalExtensions returns the extensions global scripts may use: the
+// configured ones, or all supported extensions if none are configured,
+// without vacation.
+func GlobalExtensions(configured []string) []string {
+	if len(configured) == 0 {
+		configured = managesieve.SupportedExtensions
+	}
+	extensions := make([]string, 0, len(configured))
+	for _, ext := range configured {
+		if !strings.EqualFold(ext, "vacation") {
+			extensions = append(extensions, ext)
+		}
+	}
+	return extensions
+}
+
+// Script is a named executor of a Sequence.
+type Script struct {
+	Name     string
+	Executor Executor
+}
+
+// Sequence holds the scripts that run for a message, in order: the
+// administrator's before scripts, the user's script and the administrator's
+// after scripts.
+//
+// stop only ends the script that executes it. A before script that cancels
+// the implicit keep (fileinto, redirect or discard without :copy) ends the
+// before scripts and skips the user script, so that the administrator's
+// decision stands. The after scripts always run. Each script sees the
+// header edits of the scripts before it. A script that fails is skipped, as
+// if it kept the message.
+type Sequence struct {
+	Before []Script
+	User   *Script // Nil if the user has no active script
+	After  []Script
+
+	// Observe, if set, is called with the outcome of every script that runs.
+	Observe func(script Script, result Result, err error)
+}
+
+// Evaluate runs the scripts of the sequence and combines their results, see
+// Combine. The returned error joins the errors of the scripts that failed;
+// the result holds the actions of the others.
+func (s Sequence) Evaluate(evalCtx context.Context, ctx Context) (Result, error) {
+	var results []Result
+	var errs []error
+	ctx.Header = lowercaseHeader(ctx.Header)
+
+	run := func(script Script) Result {
+		result, err := script.Executor.Evaluate(evalCtx, ctx)
+		if s.Observe != nil {
+			s.Observe(script, result, err)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sieve script %s: %w", script.Name, err))
+			result = KeepResult()
+		}
+		if len(result.HeaderEdits) > 0 {
+			ctx.Header = applyHeaderEditsToMap(ctx.Header, result.HeaderEdits)
+		}
+		results = append(results, result)
+		return result
+	}
+
+	kept := true
+	for _, script := range s.Before {
+		if !keeps(run(script)) {
+			kept = false
+			break
+		}
+	}
+	if kept && s.User != nil {
+		run(*s.User)
+	}
+	for _, script := range s.After {
+		run(script)
+	}
+
+	if len(results) == 0 {
+		return KeepResult(), nil
+	}
+	return Combine(results...), errors.Join(errs...)
+}
+
+// keeps reports whether a result still keeps the message.
+func keeps(result Result) bool {
+	return slices.ContainsFunc(result.Actions, func(a Action) bool { return a.Type == ActionKeep })
+}
+
+// lowercaseHeader returns a copy of header with lowercase field names.
+func lowercaseHeader(header map[string][]string) map[string][]string {
+	lowered := make(map[string][]string, len(header))
+	for key, values := range header {
+		key = strings.ToLower(key)
+		lowered[key] = append(lowered[key], values...)
+	}
+	return lowered
+}
+
+// applyHeaderEditsToMap applies header edits to a header map with lowercase
+// field names, the way ApplyHeaderEdits applies them to a message.
+func applyHeaderEditsToMap(header map[string][]string, edits []HeaderEdit) map[string][]string {
+	edited := make(map[string][]string, len(header))
+	for key, values := range header {
+		edited[key] = slices.Clone(values)
+	}
+
+	for _, edit := range edits {
+		key := strings.ToLower(edit.FieldName)
+		values := edited[key]
+		switch edit.Action {
+		case "add":
+			if edit.Last {
+				values = append(values, edit.Value)
+			} else {
+				values = append([]string{edit.Value}, values...)
+			}
+		case "delete":
+			switch {
+			case edit.Index > 0:
+				idx := edit.Index - 1
+				if edit.Last {
+					idx = len(values) - edit.Index
+				}
+				if idx >= 0 && idx < len(values) {
+					values = slices.Delete(values, idx, idx+1)
+				}
+			case edit.Value != "":
+				if idx := slices.Index(values, edit.Value); idx >= 0 {
+					values = slices.Delete(values, idx, idx+1)
+				}
+			default:
+				values = nil
+			}
+		}
+		if len(values) == 0 {
+			delete(edited, key)
+		} else {
+			edited[key] = values
+		}
+	}
+	return edited
+}
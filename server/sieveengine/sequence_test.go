@@ -0,0 +1,136 @@
+package sieveengine
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func testScript(t *testing.T, name, script string) Script {
+	t.Helper()
+	executor, err := NewSieveExecutorWithExtensions(script, GlobalSieveExtensions)
+	if err != nil {
+		t.Fatalf("Failed to create executor for %s: %v", name, err)
+	}
+	return Script{Name: name, Executor: executor}
+}
+
+type failingExecutor struct{}
+
+func (failingExecutor) Evaluate(context.Context, Context) (Result, error) {
+	return Result{}, errors.New("runtime error")
+}
+
+func TestSequence(t *testing.T) {
+	spam := testScript(t, "spam", `
+require ["fileinto"];
+if header :contains "X-Spam" "Yes" { fileinto "Junk"; }
+`)
+	stop := testScript(t, "stop", `stop;`)
+	work := testScript(t, "work", `
+require ["fileinto"];
+if header :contains "Subject" "Report" { fileinto "Work"; }
+if exists "X-Internal" { fileinto "Leaked"; }
+`)
+	strip := testScript(t, "strip", `
+require ["editheader"];
+deleteheader "X-Internal";
+`)
+	tag := testScript(t, "tag", `
+require ["editheader"];
+addheader "X-Filtered" "yes";
+`)
+
+	message := func(headers ...string) Context {
+		header := map[string][]string{}
+		for i := 0; i+1 < len(headers); i += 2 {
+			header[headers[i]] = append(header[headers[i]], headers[i+1])
+		}
+		return Context{EnvelopeFrom: "sender@example.com", EnvelopeTo: "user@example.com", Header: header}
+	}
+
+	tests := []struct {
+		name      string
+		sequence  Sequence
+		ctx       Context
+		mailboxes []string
+		ran       []string
+	}{
+		{
+			name:      "user script runs after a keeping before script",
+			sequence:  Sequence{Before: []Script{spam}, User: &work},
+			ctx:       message("Subject", "Report"),
+			mailboxes: []string{"Work"},
+			ran:       []string{"spam", "work"},
+		},
+		{
+			name:      "before script that files skips the user script",
+			sequence:  Sequence{Before: []Script{spam, stop}, User: &work, After: []Script{tag}},
+			ctx:       message("Subject", "Report", "X-Spam", "Yes"),
+			mailboxes: []string{"Junk"},
+			ran:       []string{"spam", "tag"},
+		},
+		{
+			name:      "stop only ends its own script",
+			sequence:  Sequence{Before: []Script{stop}, User: &work},
+			ctx:       message("Subject", "Report"),
+			mailboxes: []string{"Work"},
+			ran:       []string{"stop", "work"},
+		},
+		{
+			name:      "user script sees header edits of before scripts",
+			sequence:  Sequence{Before: []Script{strip}, User: &work},
+			ctx:       message("Subject", "Hello", "x-internal", "secret"),
+			mailboxes: []string{"INBOX"},
+			ran:       []string{"strip", "work"},
+		},
+		{
+			name:      "failing script is skipped",
+			sequence:  Sequence{Before: []Script{{Name: "broken", Executor: failingExecutor{}}}, User: &work},
+			ctx:       message("Subject", "Report"),
+			mailboxes: []string{"Work"},
+			ran:       []string{"broken", "work"},
+		},
+		{
+			name:      "no scripts keep the message",
+			sequence:  Sequence{},
+			ctx:       message("Subject", "Hello"),
+			mailboxes: []string{"INBOX"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ran []string
+			tt.sequence.Observe = func(script Script, _ Result, _ error) { ran = append(ran, script.Name) }
+
+			result, err := tt.sequence.Evaluate(context.Background(), tt.ctx)
+			if failed := slices.Contains(ran, "broken"); failed != (err != nil) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if !slices.Equal(ran, tt.ran) {
+				t.Errorf("Expected scripts %v to run, got %v", tt.ran, ran)
+			}
+			var mailboxes []string
+			for _, delivery := range result.Deliveries() {
+				mailboxes = append(mailboxes, delivery.Mailbox)
+			}
+			if !slices.Equal(mailboxes, tt.mailboxes) {
+				t.Errorf("Expected deliveries to %v, got %v", tt.mailboxes, mailboxes)
+			}
+		})
+	}
+}
+
+func TestGlobalExtensions(t *testing.T) {
+	if slices.Contains(GlobalSieveExtensions, "vacation") {
+		t.Error("Global scripts must not use vacation")
+	}
+	if !slices.Contains(GlobalSieveExtensions, "editheader") {
+		t.Error("Global scripts should be able to use editheader by default")
+	}
+	if got := GlobalExtensions([]string{"fileinto", "Vacation"}); !slices.Equal(got, []string{"fileinto"}) {
+		t.Errorf("Expected vacation to be removed, got %v", got)
+	}
+}
@@ -3,24 +3,31 @@ package sieveengine
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/emersion/go-message"
 	"github.com/foxcpp/go-sieve"
 	"github.com/foxcpp/go-sieve/interp"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/pkg/sieveext"
 	"github.com/migadu/sora/server/managesieve"
 )
 
-type Action string
+// ActionType is the kind of a Sieve action.
+type ActionType string
 
 const (
-	ActionKeep     Action = "keep"
-	ActionDiscard  Action = "discard"
-	ActionFileInto Action = "fileinto"
-	ActionRedirect Action = "redirect"
-	ActionVacation Action = "vacation"
+	ActionKeep     ActionType = "keep"
+	ActionDiscard  ActionType = "discard"
+	ActionFileInto ActionType = "fileinto"
+	ActionRedirect ActionType = "redirect"
+	ActionVacation ActionType = "vacation"
+	ActionReject   ActionType = "reject"
+	ActionNotify   ActionType = "notify"
 )
 
 // DefaultSieveExtensions is the safe subset of SIEVE extensions enabled by default.
@@ -37,26 +44,53 @@ type HeaderEdit struct {
 	Index     int  // for deleteheader: specific index (0 means all)
 }
 
+// Action is a single action performed by a Sieve script.
+type Action struct {
+	Type           ActionType
+	Mailbox        string       // used for fileinto and keep
+	RedirectTo     string       // used for redirect
+	Flags          []string     // RFC5232 - flags of the message stored by fileinto or keep
+	Copy           bool         // RFC3894 - the action did not cancel the implicit keep
+	Create         bool         // RFC5490 - :create modifier (mailbox extension)
+	Implicit       bool         // used for keep - the implicit keep of RFC5228 §2.10.2
+	HeaderEdits    []HeaderEdit // RFC5293 - header edits made before the action
+	VacationFrom   string       // used for vacation - from address
+	VacationSubj   string       // used for vacation - subject
+	VacationMsg    string       // used for vacation - message body
+	VacationIsMime bool         // used for vacation - is MIME message
+
+	RejectReason     string   // RFC5429 - reason of reject and ereject
+	RejectProtocol   bool     // RFC5429 - ereject rather than reject
+	NotifyMethod     string   // RFC5435 - notification method, a mailto URI
+	NotifyFrom       string   // RFC5435 - :from of notify
+	NotifyImportance string   // RFC5435 - :importance of notify, "1", "2" or "3"
+	NotifyOptions    []string // RFC5435 - :options of notify
+	NotifyMessage    string   // RFC5435 - :message of notify
+}
+
+// Result holds the actions of a Sieve script in the order the script
+// performed them. When the message is kept, the keep is the last delivery
+// action. A result that neither keeps, files nor redirects the message
+// discards it.
 type Result struct {
-	Action         Action
-	Mailbox        string            // used for fileinto
-	RedirectTo     string            // used for redirect
-	Flags          []string          // flags to add to the message
-	VacationFrom   string            // used for vacation - from address
-	VacationSubj   string            // used for vacation - subject
-	VacationMsg    string            // used for vacation - message body
-	VacationIsMime bool              // used for vacation - is MIME message
-	Copy           bool              // RFC3894 - :copy modifier for redirect and fileinto
-	CreateMailbox  bool              // RFC5490 - :create modifier (mailbox extension)
-	HeaderEdits    []HeaderEdit      // RFC5293 - editheader extension (addheader/deleteheader)
-	Additional     map[string]string // future-proofing
+	Actions     []Action
+	HeaderEdits []HeaderEdit // RFC5293 - all header edits, applied to the stored message
+}
+
+// KeepResult returns the result of a script without actions: the implicit
+// keep to INBOX. It is used when no script runs or a script fails.
+func KeepResult() Result {
+	return Result{Actions: []Action{{Type: ActionKeep, Mailbox: consts.MailboxInbox, Implicit: true}}}
 }
 
 type Context struct {
 	EnvelopeFrom string
 	EnvelopeTo   string
 	Header       map[string][]string
-	Body         string
+	Body         string // Text of the message, for body :text (RFC 5173)
+
+	Message []byte         // Optional: the whole message, for body :raw and :content (RFC 5173)
+	Filter  *FilterHeaders // Optional: headers of spamtest and virustest (RFC 5235), nil for the defaults
 }
 
 // VacationOracle defines the methods SievePolicy needs to interact with
@@ -80,6 +114,7 @@ type SieveExecutor struct {
 	script *sieve.Script
 	// policy is now initialized with AccountID and vacationOracle
 	policy *SievePolicy
+	tests  map[string]sieveext.Test // spamtest, virustest and body tests by header name
 }
 
 // NewSieveExecutor creates a new SieveExecutor with the given script content.
@@ -95,19 +130,17 @@ func NewSieveExecutor(scriptContent string) (Executor, error) {
 // If enabledExtensions is nil, all extensions are allowed
 func NewSieveExecutorWithExtensions(scriptContent string, enabledExtensions []string) (Executor, error) {
 	// Load the script
-	scriptReader := strings.NewReader(scriptContent)
-	options := sieve.DefaultOptions()
-	options.EnabledExtensions = enabledExtensions
-	script, err := sieve.Load(scriptReader, options)
+	script, exts, err := sieveext.Load(scriptContent, enabledExtensions)
 	if err != nil {
 		return nil, err
 	}
 
-	policy := &SievePolicy{} // Basic policy, no oracle, no AccountID by default.
+	policy := &SievePolicy{marker: exts.Marker} // Basic policy, no oracle, no AccountID by default.
 
 	return &SieveExecutor{
 		script: script,
 		policy: policy,
+		tests:  exts.Tests,
 	}, nil
 }
 
@@ -118,10 +151,7 @@ func NewSieveExecutorWithOracle(scriptContent string, AccountID int64, oracle Va
 
 // NewSieveExecutorWithOracleAndExtensions creates a new SieveExecutor with the given script content, AccountID, vacation oracle, and enabled extensions.
 func NewSieveExecutorWithOracleAndExtensions(scriptContent string, AccountID int64, oracle VacationOracle, enabledExtensions []string) (Executor, error) {
-	scriptReader := strings.NewReader(scriptContent)
-	options := sieve.DefaultOptions()
-	options.EnabledExtensions = enabledExtensions
-	script, err := sieve.Load(scriptReader, options)
+	script, exts, err := sieveext.Load(scriptContent, enabledExtensions)
 	if err != nil {
 		return nil, err
 	}
@@ -129,11 +159,13 @@ func NewSieveExecutorWithOracleAndExtensions(scriptContent string, AccountID int
 	policy := &SievePolicy{
 		AccountID:      AccountID,
 		vacationOracle: oracle,
+		marker:         exts.Marker,
 	}
 
 	return &SieveExecutor{
 		script: script,
 		policy: policy,
+		tests:  exts.Tests,
 	}, nil
 }
 
@@ -151,6 +183,9 @@ func (e *SieveExecutor) Evaluate(evalCtx context.Context, ctx Context) (Result,
 	for key, values := range ctx.Header {
 		normalizedHeaders[strings.ToLower(key)] = values
 	}
+	if len(e.tests) > 0 {
+		setTestHeaders(normalizedHeaders, e.tests, ctx)
+	}
 
 	message := &SieveMessage{
 		Headers: normalizedHeaders,
@@ -164,6 +199,7 @@ func (e *SieveExecutor) Evaluate(evalCtx context.Context, ctx Context) (Result,
 		AccountID:         e.policy.AccountID,
 		vacationOracle:    e.policy.vacationOracle,
 		vacationResponses: make(map[string]time.Time),
+		marker:            e.policy.marker,
 	}
 
 	// Create runtime data
@@ -172,87 +208,19 @@ func (e *SieveExecutor) Evaluate(evalCtx context.Context, ctx Context) (Result,
 	// Execute the script
 	err := e.script.Execute(evalCtx, data) // Pass the evaluation context
 	if err != nil {
-		return Result{Action: ActionKeep}, err
+		return KeepResult(), err
 	}
 
-	// Process the results
-	result := Result{
-		Action:     ActionKeep,
-		Additional: make(map[string]string),
-		Flags:      make([]string, 0),
-	}
+	result := Result{}
 
-	// Check if vacation response was triggered
-	// The go-sieve library stores vacation responses in data.VacationResponses
-	vacationTriggered := len(data.VacationResponses) > 0
-
-	// Handle fileinto action (takes precedence over vacation)
-	if len(data.Mailboxes) > 0 {
-		// Use the first mailbox (we could support multiple mailboxes in the future)
-		result.Action = ActionFileInto
-		result.Mailbox = data.Mailboxes[0]
-
-		// Check if ImplicitKeep is true (means :copy was used) OR if Keep is true (explicit keep action)
-		// With normal fileinto (no :copy), ImplicitKeep would be false, but an explicit keep
-		// after fileinto should still save a copy to INBOX
-		result.Copy = data.ImplicitKeep || data.Keep
-
-		// Check if :create modifier was used (RFC 5490 - mailbox extension)
-		// MailboxesCreate contains mailboxes that should be created if they don't exist
-		if len(data.MailboxesCreate) > 0 {
-			// Check if the target mailbox should be created
-			for _, createMailbox := range data.MailboxesCreate {
-				if createMailbox == result.Mailbox {
-					result.CreateMailbox = true
-					break
-				}
-			}
+	// RFC 5429 §2.1: a rejected message is neither kept nor filed or
+	// redirected, and no vacation response is sent
+	if execPolicy.rejection != nil {
+		if data.Keep || len(data.Mailboxes) > 0 || len(data.RedirectAddr) > 0 || len(data.VacationResponses) > 0 {
+			return KeepResult(), errors.New("reject cannot be combined with keep, fileinto, redirect or vacation")
 		}
-	} else if len(data.RedirectAddr) > 0 {
-		// Handle redirect action (takes precedence over vacation)
-		// Use the first redirect address (we could support multiple redirects in the future)
-		result.Action = ActionRedirect
-		result.RedirectTo = data.RedirectAddr[0]
-
-		// Check if ImplicitKeep is true (means :copy was used) OR if Keep is true (explicit keep action)
-		// With normal redirect (no :copy), ImplicitKeep would be false, but an explicit keep
-		// after redirect should still save a local copy
-		result.Copy = data.ImplicitKeep || data.Keep
-	} else if !data.Keep && !data.ImplicitKeep {
-		// Handle discard action
-		// This includes both explicit discard commands and scripts with no keep action
-		result.Action = ActionDiscard
-	} else if vacationTriggered {
-		// Process vacation responses
-		// Per RFC 5230, vacation is an implicit keep, so we only reach here if ImplicitKeep is still true
-		// (fileinto/redirect/discard are handled above and cancel the implicit keep)
-		// Get the first vacation response (there should only be one per evaluation)
-		for sender, vacation := range data.VacationResponses {
-			// Check with the policy/oracle if we should send this vacation response
-			duration := time.Duration(vacation.Days) * 24 * time.Hour
-			allowed, err := execPolicy.VacationResponseAllowed(evalCtx, data, sender, vacation.Handle, duration)
-			if err != nil {
-				// Log error but don't fail the message delivery
-				continue
-			}
-
-			if allowed {
-				result.Action = ActionVacation
-				result.VacationFrom = vacation.From
-				result.VacationSubj = vacation.Subject
-				result.VacationMsg = vacation.Body
-				result.VacationIsMime = vacation.IsMime
-
-				// Record that we sent the vacation response
-				_ = execPolicy.SendVacationResponse(evalCtx, data, sender, vacation.From, vacation.Subject, vacation.Body, vacation.IsMime)
-			}
-			break // Only process the first vacation response
-		}
-	}
-
-	// Handle flags
-	if len(data.Flags) > 0 {
-		result.Flags = data.Flags
+		result.Actions = append([]Action{*execPolicy.rejection}, execPolicy.allowedNotifications(evalCtx)...)
+		return result, nil
 	}
 
 	// Handle header edits (RFC 5293 - editheader extension)
@@ -269,9 +237,196 @@ func (e *SieveExecutor) Evaluate(evalCtx context.Context, ctx Context) (Result,
 		}
 	}
 
+	// The interpreter only tracks :copy through the implicit keep, and the
+	// flags of the last fileinto, keep or flag command. Both are what the
+	// delivery of the message depends on.
+	fileInto := func(mailbox string) Action {
+		return Action{
+			Type:        ActionFileInto,
+			Mailbox:     mailbox,
+			Flags:       data.Flags,
+			Copy:        data.ImplicitKeep,
+			Create:      slices.Contains(data.MailboxesCreate, mailbox),
+			HeaderEdits: result.HeaderEdits,
+		}
+	}
+
+	// fileinto and redirect are recorded in separate lists. The policy saw
+	// how many mailboxes and header edits preceded every redirect, which
+	// restores the order of the script.
+	mailboxes := data.Mailboxes
+	for i, addr := range data.RedirectAddr {
+		state := redirectState{mailboxes: len(mailboxes), headerEdits: len(result.HeaderEdits)}
+		if i < len(execPolicy.redirects) {
+			state = execPolicy.redirects[i]
+		}
+		for len(mailboxes) > 0 && len(data.Mailboxes)-len(mailboxes) < state.mailboxes {
+			result.Actions = append(result.Actions, fileInto(mailboxes[0]))
+			mailboxes = mailboxes[1:]
+		}
+		result.Actions = append(result.Actions, Action{
+			Type:        ActionRedirect,
+			RedirectTo:  addr,
+			Copy:        data.ImplicitKeep,
+			HeaderEdits: result.HeaderEdits[:state.headerEdits],
+		})
+	}
+	for _, mailbox := range mailboxes {
+		result.Actions = append(result.Actions, fileInto(mailbox))
+	}
+
+	// An explicit keep, or the implicit keep if no fileinto, redirect or
+	// discard cancelled it (RFC 5228 §2.10.2)
+	if data.Keep || data.ImplicitKeep {
+		result.Actions = append(result.Actions, Action{
+			Type:        ActionKeep,
+			Mailbox:     consts.MailboxInbox,
+			Flags:       data.Flags,
+			Implicit:    !data.Keep,
+			HeaderEdits: result.HeaderEdits,
+		})
+	}
+
+	// Per RFC 5230, vacation is compatible with every other action, so the
+	// response is sent however the message itself is delivered.
+	// Only the first vacation response is processed; there is one per evaluation.
+	for sender, vacation := range data.VacationResponses {
+		// Check with the policy/oracle if we should send this vacation response
+		duration := time.Duration(vacation.Days) * 24 * time.Hour
+		allowed, err := execPolicy.VacationResponseAllowed(evalCtx, data, sender, vacation.Handle, duration)
+		if err != nil {
+			// Log error but don't fail the message delivery
+			continue
+		}
+
+		if allowed {
+			result.Actions = append(result.Actions, Action{
+				Type:           ActionVacation,
+				VacationFrom:   vacation.From,
+				VacationSubj:   vacation.Subject,
+				VacationMsg:    vacation.Body,
+				VacationIsMime: vacation.IsMime,
+			})
+
+			// Record that we sent the vacation response
+			_ = execPolicy.SendVacationResponse(evalCtx, data, sender, vacation.From, vacation.Subject, vacation.Body, vacation.IsMime)
+		}
+		break // Only process the first vacation response
+	}
+
+	result.Actions = append(result.Actions, execPolicy.allowedNotifications(evalCtx)...)
+
 	return result, nil
 }
 
+// Combine returns the result of running several scripts on the same
+// message, such as the default script followed by the user script. The
+// actions of all scripts are performed. The implicit keep is only performed
+// if none of the scripts cancelled it, while an explicit keep of any script
+// is always performed. Header edits accumulate in script order.
+func Combine(results ...Result) Result {
+	var combined Result
+	var keep *Action
+	implicitKeep, explicitKeep := true, false
+	for _, result := range results {
+		kept := false
+		for _, action := range result.Actions {
+			// Edits of earlier scripts apply before the edits of this one
+			if len(combined.HeaderEdits) > 0 && action.Type != ActionVacation {
+				action.HeaderEdits = append(slices.Clone(combined.HeaderEdits), action.HeaderEdits...)
+			}
+			if action.Type == ActionKeep {
+				kept = true
+				explicitKeep = explicitKeep || !action.Implicit
+				keep = &action
+				continue
+			}
+			combined.Actions = append(combined.Actions, action)
+		}
+		if !kept {
+			implicitKeep = false
+		}
+		combined.HeaderEdits = append(combined.HeaderEdits, result.HeaderEdits...)
+	}
+	if keep != nil && (implicitKeep || explicitKeep) {
+		keep.Implicit = !explicitKeep
+		combined.Actions = append(combined.Actions, *keep)
+	}
+	return combined
+}
+
+// Deliveries returns the fileinto and keep actions, one per mailbox. An
+// action filing into a mailbox that an earlier action already files into
+// adds its flags and :create to the earlier action.
+func (r Result) Deliveries() []Action {
+	var deliveries []Action
+	index := make(map[string]int)
+	for _, action := range r.Actions {
+		if action.Type != ActionFileInto && action.Type != ActionKeep {
+			continue
+		}
+		key := action.Mailbox
+		if strings.EqualFold(key, consts.MailboxInbox) {
+			key = consts.MailboxInbox
+		}
+		if i, ok := index[key]; ok {
+			delivery := &deliveries[i]
+			for _, flag := range action.Flags {
+				if !slices.Contains(delivery.Flags, flag) {
+					delivery.Flags = append(slices.Clone(delivery.Flags), flag)
+				}
+			}
+			delivery.Create = delivery.Create || action.Create
+			continue
+		}
+		index[key] = len(deliveries)
+		deliveries = append(deliveries, action)
+	}
+	return deliveries
+}
+
+// Redirects returns the redirect actions, one per address (RFC 5228 §4.2).
+func (r Result) Redirects() []Action {
+	var redirects []Action
+	for _, action := range r.Actions {
+		if action.Type == ActionRedirect && !slices.ContainsFunc(redirects, func(a Action) bool {
+			return strings.EqualFold(a.RedirectTo, action.RedirectTo)
+		}) {
+			redirects = append(redirects, action)
+		}
+	}
+	return redirects
+}
+
+// Vacation returns the vacation actions.
+func (r Result) Vacation() []Action {
+	var vacation []Action
+	for _, action := range r.Actions {
+		if action.Type == ActionVacation {
+			vacation = append(vacation, action)
+		}
+	}
+	return vacation
+}
+
+// Discarded reports whether the message is neither stored, redirected nor
+// rejected.
+func (r Result) Discarded() bool {
+	for _, action := range r.Actions {
+		switch action.Type {
+		case ActionKeep, ActionFileInto, ActionRedirect, ActionReject:
+			return false
+		}
+	}
+	return true
+}
+
+// redirectState is the state of the script when a redirect was performed.
+type redirectState struct {
+	mailboxes   int // number of fileinto mailboxes
+	headerEdits int // number of header edits
+}
+
 // SievePolicy implements the PolicyReader interface
 type SievePolicy struct {
 	vacationResponses  map[string]time.Time
@@ -281,12 +436,27 @@ type SievePolicy struct {
 	lastVacationIsMime bool
 	lastVacationHandle string // Stores the handle of the currently allowed vacation
 	vacationTriggered  bool
+	redirects          []redirectState // state of the script at every redirect, in order
+
+	marker        string   // marker of the commands rewritten by sieveext
+	rejection     *Action  // reject or ereject of the script
+	notify        Action   // parameters of the notify being rewritten
+	notifications []Action // notify actions, one per method
 
 	AccountID      int64
 	vacationOracle VacationOracle
 }
 
 func (p *SievePolicy) RedirectAllowed(ctx context.Context, d *interp.RuntimeData, addr string) (bool, error) {
+	// reject, ereject and notify arrive as redirects to the marker, which
+	// are never performed
+	if kind, value, ok := sieveext.Parse(p.marker, addr); ok {
+		return false, p.recordExtension(kind, value)
+	}
+
+	// Remember where in the script the redirect happened, the interpreter
+	// does not keep the order of fileinto and redirect
+	p.redirects = append(p.redirects, redirectState{mailboxes: len(d.Mailboxes), headerEdits: len(d.HeaderEdits)})
 	// For now, always allow redirects
 	return true, nil
 }
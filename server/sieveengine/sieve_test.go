@@ -33,29 +33,25 @@ stop;
 	tests := []struct {
 		name             string
 		subject          string
-		expectedAction   Action
-		expectedCopy     bool
+		expectedActions  []ActionType
 		expectedRedirect string
 	}{
 		{
 			name:             "Security code match - should keep only",
 			subject:          "Your Security code is 12345",
-			expectedAction:   ActionKeep,
-			expectedCopy:     false,
+			expectedActions:  []ActionType{ActionKeep},
 			expectedRedirect: "",
 		},
 		{
 			name:             "Verify match - should keep only",
 			subject:          "Verify your candidate account",
-			expectedAction:   ActionKeep,
-			expectedCopy:     false,
+			expectedActions:  []ActionType{ActionKeep},
 			expectedRedirect: "",
 		},
 		{
 			name:             "No match - should redirect with keep",
 			subject:          "Regular email",
-			expectedAction:   ActionRedirect,
-			expectedCopy:     true,
+			expectedActions:  []ActionType{ActionRedirect, ActionKeep},
 			expectedRedirect: "another@email.com",
 		},
 	}
@@ -78,16 +74,19 @@ stop;
 				t.Fatalf("Failed to evaluate script: %v", err)
 			}
 
-			if result.Action != tt.expectedAction {
-				t.Errorf("Expected action %s, got %s", tt.expectedAction, result.Action)
-			}
+			assertActions(t, result, tt.expectedActions...)
 
-			if result.Copy != tt.expectedCopy {
-				t.Errorf("Expected Copy=%v, got %v", tt.expectedCopy, result.Copy)
+			redirectTo := ""
+			if redirects := result.Redirects(); len(redirects) > 0 {
+				redirectTo = redirects[0].RedirectTo
+			}
+			if redirectTo != tt.expectedRedirect {
+				t.Errorf("Expected RedirectTo=%s, got %s", tt.expectedRedirect, redirectTo)
 			}
 
-			if result.RedirectTo != tt.expectedRedirect {
-				t.Errorf("Expected RedirectTo=%s, got %s", tt.expectedRedirect, result.RedirectTo)
+			// Every branch keeps explicitly
+			if keep := result.Actions[len(result.Actions)-1]; keep.Implicit {
+				t.Errorf("Expected an explicit keep, got the implicit keep")
 			}
 		})
 	}
@@ -121,16 +120,14 @@ redirect "another@email.com";
 	}
 
 	// Without explicit keep, redirect should not keep a copy (RFC 5228 behavior)
-	if result.Action != ActionRedirect {
-		t.Errorf("Expected action %s, got %s", ActionRedirect, result.Action)
-	}
+	assertActions(t, result, ActionRedirect)
 
-	if result.Copy {
+	if result.Actions[0].Copy {
 		t.Errorf("Expected Copy=false (no explicit keep), got true")
 	}
 
-	if result.RedirectTo != "another@email.com" {
-		t.Errorf("Expected RedirectTo=another@email.com, got %s", result.RedirectTo)
+	if result.Actions[0].RedirectTo != "another@email.com" {
+		t.Errorf("Expected RedirectTo=another@email.com, got %s", result.Actions[0].RedirectTo)
 	}
 }
 
@@ -163,16 +160,18 @@ redirect :copy "another@email.com";
 	}
 
 	// With :copy modifier, should keep a copy
-	if result.Action != ActionRedirect {
-		t.Errorf("Expected action %s, got %s", ActionRedirect, result.Action)
-	}
+	assertActions(t, result, ActionRedirect, ActionKeep)
 
-	if !result.Copy {
+	if !result.Actions[0].Copy {
 		t.Errorf("Expected Copy=true (with :copy modifier), got false")
 	}
 
-	if result.RedirectTo != "another@email.com" {
-		t.Errorf("Expected RedirectTo=another@email.com, got %s", result.RedirectTo)
+	if result.Actions[0].RedirectTo != "another@email.com" {
+		t.Errorf("Expected RedirectTo=another@email.com, got %s", result.Actions[0].RedirectTo)
+	}
+
+	if !result.Actions[1].Implicit {
+		t.Errorf("Expected the implicit keep")
 	}
 }
 
@@ -206,16 +205,14 @@ keep;
 	}
 
 	// With explicit keep after fileinto, should save to both Spam and INBOX
-	if result.Action != ActionFileInto {
-		t.Errorf("Expected action %s, got %s", ActionFileInto, result.Action)
-	}
+	assertActions(t, result, ActionFileInto, ActionKeep)
 
-	if !result.Copy {
-		t.Errorf("Expected Copy=true (explicit keep after fileinto), got false")
+	if result.Actions[0].Mailbox != "Spam" {
+		t.Errorf("Expected Mailbox=Spam, got %s", result.Actions[0].Mailbox)
 	}
 
-	if result.Mailbox != "Spam" {
-		t.Errorf("Expected Mailbox=Spam, got %s", result.Mailbox)
+	if result.Actions[1].Implicit {
+		t.Errorf("Expected an explicit keep")
 	}
 }
 
@@ -248,16 +245,14 @@ fileinto "Spam";
 	}
 
 	// Without explicit keep, fileinto should not copy to INBOX (RFC 5228 behavior)
-	if result.Action != ActionFileInto {
-		t.Errorf("Expected action %s, got %s", ActionFileInto, result.Action)
-	}
+	assertActions(t, result, ActionFileInto)
 
-	if result.Copy {
+	if result.Actions[0].Copy {
 		t.Errorf("Expected Copy=false (no explicit keep), got true")
 	}
 
-	if result.Mailbox != "Spam" {
-		t.Errorf("Expected Mailbox=Spam, got %s", result.Mailbox)
+	if result.Actions[0].Mailbox != "Spam" {
+		t.Errorf("Expected Mailbox=Spam, got %s", result.Actions[0].Mailbox)
 	}
 }
 
@@ -326,17 +321,16 @@ if not header :contains "precedence" ["list", "bulk", "junk"] {
 
 	// The bug was that this returned ActionDiscard
 	// Correct behavior: vacation is an implicit keep (RFC 5230)
-	if result.Action != ActionVacation {
-		t.Errorf("Expected action %s, got %s - vacation should be implicit keep, not discard", ActionVacation, result.Action)
-	}
+	assertActions(t, result, ActionKeep, ActionVacation)
 
-	if result.VacationSubj != "Out of Office" {
-		t.Errorf("Expected vacation subject 'Out of Office', got %s", result.VacationSubj)
+	vacation := result.Vacation()[0]
+	if vacation.VacationSubj != "Out of Office" {
+		t.Errorf("Expected vacation subject 'Out of Office', got %s", vacation.VacationSubj)
 	}
 
 	expectedMsg := "Thank you for your email. I am currently out of the office and will get back to you shortly."
-	if result.VacationMsg != expectedMsg {
-		t.Errorf("Expected vacation message %q, got %q", expectedMsg, result.VacationMsg)
+	if vacation.VacationMsg != expectedMsg {
+		t.Errorf("Expected vacation message %q, got %q", expectedMsg, vacation.VacationMsg)
 	}
 }
 
@@ -369,10 +363,8 @@ keep;
 		t.Fatalf("Failed to evaluate script: %v", err)
 	}
 
-	// Vacation should be the action
-	if result.Action != ActionVacation {
-		t.Errorf("Expected action %s, got %s", ActionVacation, result.Action)
-	}
+	// The message is kept and the vacation response sent
+	assertActions(t, result, ActionKeep, ActionVacation)
 }
 
 func TestVacationWithDiscard(t *testing.T) {
@@ -406,9 +398,11 @@ discard;
 		t.Fatalf("Failed to evaluate script: %v", err)
 	}
 
-	// Explicit discard should override vacation's implicit keep
-	if result.Action != ActionDiscard {
-		t.Errorf("Expected action %s, got %s - explicit discard should override vacation", ActionDiscard, result.Action)
+	// Explicit discard should override vacation's implicit keep, the
+	// vacation response is still sent (RFC 5230 §4.7)
+	assertActions(t, result, ActionVacation)
+	if !result.Discarded() {
+		t.Errorf("Expected the message to be discarded - explicit discard should override vacation")
 	}
 }
 
@@ -441,17 +435,12 @@ fileinto "Archive";
 		t.Fatalf("Failed to evaluate script: %v", err)
 	}
 
-	// Fileinto should take precedence as the primary action
-	if result.Action != ActionFileInto {
-		t.Errorf("Expected action %s, got %s", ActionFileInto, result.Action)
-	}
+	// Both the fileinto and the vacation response are performed
+	assertActions(t, result, ActionFileInto, ActionVacation)
 
-	if result.Mailbox != "Archive" {
-		t.Errorf("Expected mailbox Archive, got %s", result.Mailbox)
+	if result.Actions[0].Mailbox != "Archive" {
+		t.Errorf("Expected mailbox Archive, got %s", result.Actions[0].Mailbox)
 	}
-
-	// Note: In a real implementation, we might want to track that vacation
-	// was also triggered, but current implementation only returns one action
 }
 
 func TestVacationRateLimiting(t *testing.T) {
@@ -483,9 +472,7 @@ vacation :days 7 :subject "Away" "I'm away";
 		t.Fatalf("Failed to evaluate script (first): %v", err)
 	}
 
-	if result1.Action != ActionVacation {
-		t.Errorf("First evaluation: Expected action %s, got %s", ActionVacation, result1.Action)
-	}
+	assertActions(t, result1, ActionKeep, ActionVacation)
 
 	// Second evaluation immediately after - should NOT trigger vacation (rate limited)
 	// Need to create new executor instance to simulate new message evaluation
@@ -500,9 +487,7 @@ vacation :days 7 :subject "Away" "I'm away";
 	}
 
 	// Should fall back to implicit keep (vacation blocked by rate limit)
-	if result2.Action != ActionKeep {
-		t.Errorf("Second evaluation: Expected action %s (vacation rate limited), got %s", ActionKeep, result2.Action)
-	}
+	assertActions(t, result2, ActionKeep)
 }
 
 func TestVacationPrecedenceHeader(t *testing.T) {
@@ -524,27 +509,27 @@ if not header :contains "precedence" ["list", "bulk", "junk"] {
 	tests := []struct {
 		name           string
 		precedence     string
-		expectedAction Action
+		expectedAction []ActionType
 	}{
 		{
 			name:           "Regular email - should send vacation",
 			precedence:     "",
-			expectedAction: ActionVacation,
+			expectedAction: []ActionType{ActionKeep, ActionVacation},
 		},
 		{
 			name:           "List email - should not send vacation",
 			precedence:     "list",
-			expectedAction: ActionKeep,
+			expectedAction: []ActionType{ActionKeep},
 		},
 		{
 			name:           "Bulk email - should not send vacation",
 			precedence:     "bulk",
-			expectedAction: ActionKeep,
+			expectedAction: []ActionType{ActionKeep},
 		},
 		{
 			name:           "Junk email - should not send vacation",
 			precedence:     "junk",
-			expectedAction: ActionKeep,
+			expectedAction: []ActionType{ActionKeep},
 		},
 	}
 
@@ -570,9 +555,7 @@ if not header :contains "precedence" ["list", "bulk", "junk"] {
 				t.Fatalf("Failed to evaluate script: %v", err)
 			}
 
-			if result.Action != tt.expectedAction {
-				t.Errorf("Expected action %s, got %s", tt.expectedAction, result.Action)
-			}
+			assertActions(t, result, tt.expectedAction...)
 		})
 	}
 }
@@ -591,7 +574,7 @@ if header :contains "From" "@gmail.com" {
 	tests := []struct {
 		name           string
 		headerKey      string // "From", "from", "FROM", etc.
-		expectedAction Action
+		expectedAction ActionType
 	}{
 		{
 			name:           "Capital From (standard)",
@@ -642,13 +625,178 @@ if header :contains "From" "@gmail.com" {
 				t.Fatalf("Failed to evaluate script: %v", err)
 			}
 
-			if result.Action != tt.expectedAction {
-				t.Errorf("Expected action %s, got %s", tt.expectedAction, result.Action)
+			assertActions(t, result, ActionKeep, tt.expectedAction)
+
+			if vacation := result.Vacation(); len(vacation) > 0 && vacation[0].VacationSubj != "Gmail blocked" {
+				t.Errorf("Expected vacation subject 'Gmail blocked', got '%s'", vacation[0].VacationSubj)
 			}
+		})
+	}
+}
+
+// assertActions checks the types of the actions of a result, in order.
+func assertActions(t *testing.T, result Result, expected ...ActionType) {
+	t.Helper()
+	actual := make([]ActionType, len(result.Actions))
+	for i, action := range result.Actions {
+		actual[i] = action.Type
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("Expected actions %v, got %v", expected, actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("Expected actions %v, got %v", expected, actual)
+		}
+	}
+}
+
+func evaluateTestScript(t *testing.T, script string) Result {
+	t.Helper()
+	enabledExtensions := []string{"fileinto", "imap4flags", "copy", "mailbox", "editheader", "vacation"}
+	executor, err := NewSieveExecutorWithExtensions(script, enabledExtensions)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+
+	result, err := executor.Evaluate(context.Background(), Context{
+		EnvelopeFrom: "sender@example.com",
+		EnvelopeTo:   "recipient@example.com",
+		Header: map[string][]string{
+			"Subject": {"Test"},
+			"From":    {"sender@example.com"},
+		},
+		Body: "Test body",
+	})
+	if err != nil {
+		t.Fatalf("Failed to evaluate script: %v", err)
+	}
+	return result
+}
+
+func TestMultipleActions(t *testing.T) {
+	result := evaluateTestScript(t, `
+require ["fileinto", "mailbox", "imap4flags"];
+fileinto "A";
+redirect "first@example.net";
+fileinto :create "B";
+redirect "second@example.net";
+fileinto "A";
+addflag "\\Seen";
+`)
+
+	assertActions(t, result, ActionFileInto, ActionRedirect, ActionFileInto, ActionRedirect)
+	if result.Actions[0].Mailbox != "A" || result.Actions[0].Create {
+		t.Errorf("Expected fileinto A without :create, got %+v", result.Actions[0])
+	}
+	if result.Actions[1].RedirectTo != "first@example.net" || result.Actions[3].RedirectTo != "second@example.net" {
+		t.Errorf("Expected redirects in script order, got %+v", result.Redirects())
+	}
+	if result.Actions[2].Mailbox != "B" || !result.Actions[2].Create {
+		t.Errorf("Expected fileinto :create B, got %+v", result.Actions[2])
+	}
+	for _, action := range result.Deliveries() {
+		if len(action.Flags) != 1 || action.Flags[0] != "\\seen" {
+			t.Errorf("Expected \\Seen on %s, got %v", action.Mailbox, action.Flags)
+		}
+	}
+	if len(result.Deliveries()) != 2 {
+		t.Errorf("Expected deliveries to A and B, got %+v", result.Deliveries())
+	}
+}
+
+func TestMultipleActionsWithCopy(t *testing.T) {
+	result := evaluateTestScript(t, `
+require ["fileinto", "copy"];
+fileinto :copy "Archive";
+redirect :copy "backup@example.net";
+`)
+
+	// :copy keeps the implicit keep of both actions
+	assertActions(t, result, ActionFileInto, ActionRedirect, ActionKeep)
+	for _, action := range result.Actions {
+		if action.Type != ActionKeep && !action.Copy {
+			t.Errorf("Expected Copy=true on %s", action.Type)
+		}
+	}
+	if keep := result.Actions[2]; !keep.Implicit || keep.Mailbox != "INBOX" {
+		t.Errorf("Expected the implicit keep to INBOX, got %+v", keep)
+	}
+}
+
+func TestHeaderEditsPerAction(t *testing.T) {
+	result := evaluateTestScript(t, `
+require ["fileinto", "editheader"];
+redirect "before@example.net";
+addheader "X-Filtered" "yes";
+redirect "after@example.net";
+fileinto "Filtered";
+`)
+
+	assertActions(t, result, ActionRedirect, ActionRedirect, ActionFileInto)
+	if len(result.Actions[0].HeaderEdits) != 0 {
+		t.Errorf("Expected no header edits before the first redirect, got %v", result.Actions[0].HeaderEdits)
+	}
+	if len(result.Actions[1].HeaderEdits) != 1 || result.Actions[1].HeaderEdits[0].FieldName != "X-Filtered" {
+		t.Errorf("Expected X-Filtered before the second redirect, got %v", result.Actions[1].HeaderEdits)
+	}
+	if len(result.HeaderEdits) != 1 {
+		t.Errorf("Expected 1 header edit, got %v", result.HeaderEdits)
+	}
+}
+
+func TestCombine(t *testing.T) {
+	fileInto := func(mailbox string) Result {
+		return Result{Actions: []Action{{Type: ActionFileInto, Mailbox: mailbox}}}
+	}
+	explicitKeep := Result{Actions: []Action{{Type: ActionKeep, Mailbox: "INBOX", Flags: []string{"\\seen"}}}}
+	discard := Result{}
+
+	tests := []struct {
+		name     string
+		results  []Result
+		expected []ActionType
+		implicit bool
+	}{
+		{"both keep", []Result{KeepResult(), KeepResult()}, []ActionType{ActionKeep}, true},
+		{"default files", []Result{fileInto("Junk"), KeepResult()}, []ActionType{ActionFileInto}, false},
+		{"user files", []Result{KeepResult(), fileInto("Work")}, []ActionType{ActionFileInto}, false},
+		{"both file", []Result{fileInto("Junk"), fileInto("Work")}, []ActionType{ActionFileInto, ActionFileInto}, false},
+		{"default discards", []Result{discard, KeepResult()}, []ActionType{}, false},
+		{"explicit keep after discard", []Result{discard, explicitKeep}, []ActionType{ActionKeep}, false},
+	}
 
-			if result.Action == ActionVacation && result.VacationSubj != "Gmail blocked" {
-				t.Errorf("Expected vacation subject 'Gmail blocked', got '%s'", result.VacationSubj)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			combined := Combine(tt.results...)
+			assertActions(t, combined, tt.expected...)
+			if n := len(combined.Actions); n > 0 && combined.Actions[n-1].Type == ActionKeep && combined.Actions[n-1].Implicit != tt.implicit {
+				t.Errorf("Expected Implicit=%v", tt.implicit)
 			}
 		})
 	}
 }
+
+func TestDeliveriesMergeMailboxes(t *testing.T) {
+	result := Result{Actions: []Action{
+		{Type: ActionFileInto, Mailbox: "inbox", Flags: []string{"\\seen"}},
+		{Type: ActionFileInto, Mailbox: "Work", Create: true},
+		{Type: ActionRedirect, RedirectTo: "a@example.net"},
+		{Type: ActionRedirect, RedirectTo: "A@example.net"},
+		{Type: ActionKeep, Mailbox: "INBOX", Flags: []string{"\\flagged"}},
+	}}
+
+	deliveries := result.Deliveries()
+	if len(deliveries) != 2 {
+		t.Fatalf("Expected 2 deliveries, got %+v", deliveries)
+	}
+	if len(deliveries[0].Flags) != 2 {
+		t.Errorf("Expected the flags of fileinto INBOX and keep, got %v", deliveries[0].Flags)
+	}
+	if !deliveries[1].Create {
+		t.Errorf("Expected :create on Work")
+	}
+	if len(result.Redirects()) != 1 {
+		t.Errorf("Expected one redirect per address, got %+v", result.Redirects())
+	}
+}
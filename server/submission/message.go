@@ -0,0 +1,65 @@
+package submission
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/emersion/go-message/textproto"
+	"github.com/migadu/sora/server/idgen"
+)
+
+// completeMessage adds the Date and Message-ID header fields when the
+// client did not provide them (RFC 6409 section 8). The message is
+// returned unchanged when both are present.
+func completeMessage(raw []byte, hostname string, now time.Time) ([]byte, error) {
+	return rewriteHeader(raw, func(h *textproto.Header) bool {
+		changed := false
+		if !h.Has("Message-Id") {
+			h.Set("Message-Id", fmt.Sprintf("<%s.%d@%s>", idgen.New(), now.UnixNano(), hostname))
+			changed = true
+		}
+		if !h.Has("Date") {
+			h.Set("Date", now.Format(time.RFC1123Z))
+			changed = true
+		}
+		return changed
+	})
+}
+
+// stripBcc removes the Bcc header field from the copy handed to the relay
+// so that blind carbon copy recipients are not disclosed.
+func stripBcc(raw []byte) ([]byte, error) {
+	return rewriteHeader(raw, func(h *textproto.Header) bool {
+		if !h.Has("Bcc") {
+			return false
+		}
+		h.Del("Bcc")
+		return true
+	})
+}
+
+// rewriteHeader parses the header of raw and applies edit. The message is
+// only re-serialized when edit reports a change.
+func rewriteHeader(raw []byte, edit func(h *textproto.Header) bool) ([]byte, error) {
+	br := bufio.NewReader(bytes.NewReader(raw))
+	h, err := textproto.ReadHeader(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse message header: %w", err)
+	}
+	if !edit(&h) {
+		return raw, nil
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(raw) + 128)
+	if err := textproto.WriteHeader(&buf, h); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(&buf, br); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,104 @@
+package submission
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-sasl"
+)
+
+func TestCompleteMessageAddsMissingHeaders(t *testing.T) {
+	raw := []byte("From: alice@example.com\r\nSubject: hi\r\n\r\nbody\r\n")
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	out, err := completeMessage(raw, "mx.example.com", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(out)
+	if !strings.Contains(msg, "Date: Sat, 01 Mar 2025 12:00:00 +0000\r\n") {
+		t.Errorf("Date header missing:\n%s", msg)
+	}
+	if !strings.Contains(msg, "@mx.example.com>\r\n") {
+		t.Errorf("Message-Id header missing:\n%s", msg)
+	}
+	if !strings.HasSuffix(msg, "\r\n\r\nbody\r\n") {
+		t.Errorf("body not preserved:\n%s", msg)
+	}
+}
+
+func TestCompleteMessageKeepsCompleteMessage(t *testing.T) {
+	raw := []byte("Date: Sat, 01 Mar 2025 12:00:00 +0000\r\nMessage-ID: <a@b>\r\nFrom: alice@example.com\r\n\r\nbody\r\n")
+
+	out, err := completeMessage(raw, "mx.example.com", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(raw) {
+		t.Errorf("message was modified:\n%s", out)
+	}
+}
+
+func TestStripBcc(t *testing.T) {
+	raw := []byte("From: alice@example.com\r\nBcc: secret@example.com,\r\n other@example.com\r\nTo: bob@example.com\r\n\r\nbody\r\n")
+
+	out, err := stripBcc(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(out)
+	if strings.Contains(msg, "secret@example.com") || strings.Contains(msg, "other@example.com") {
+		t.Errorf("Bcc not removed:\n%s", msg)
+	}
+	if !strings.Contains(msg, "To: bob@example.com\r\n") {
+		t.Errorf("To header lost:\n%s", msg)
+	}
+
+	unchanged := []byte("To: bob@example.com\r\n\r\nbody\r\n")
+	out, err = stripBcc(unchanged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(unchanged) {
+		t.Errorf("message without Bcc was modified:\n%s", out)
+	}
+}
+
+func TestLoginServer(t *testing.T) {
+	var gotUser, gotPass string
+	auth := func(identity, username, password string) error {
+		gotUser, gotPass = username, password
+		return nil
+	}
+
+	// Without initial response
+	srv := newLoginServer(auth)
+	challenge, done, err := srv.Next(nil)
+	if err != nil || done || string(challenge) != "Username:" {
+		t.Fatalf("step 1: %q %v %v", challenge, done, err)
+	}
+	challenge, done, err = srv.Next([]byte("alice@example.com"))
+	if err != nil || done || string(challenge) != "Password:" {
+		t.Fatalf("step 2: %q %v %v", challenge, done, err)
+	}
+	if _, done, err = srv.Next([]byte("secret")); err != nil || !done {
+		t.Fatalf("step 3: %v %v", done, err)
+	}
+	if gotUser != "alice@example.com" || gotPass != "secret" {
+		t.Errorf("got %q/%q", gotUser, gotPass)
+	}
+
+	// Username as initial response
+	srv = newLoginServer(auth)
+	challenge, done, err = srv.Next([]byte("bob@example.com"))
+	if err != nil || done || string(challenge) != "Password:" {
+		t.Fatalf("initial response: %q %v %v", challenge, done, err)
+	}
+	if _, done, err = srv.Next([]byte("pw")); err != nil || !done || gotUser != "bob@example.com" {
+		t.Fatalf("final step: %v %v %q", done, err, gotUser)
+	}
+	if _, _, err = srv.Next(nil); err != sasl.ErrUnexpectedClientResponse {
+		t.Errorf("extra step should fail, got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package submission
+
+import (
+	"github.com/emersion/go-sasl"
+)
+
+// loginServer implements the obsolete but widely used LOGIN mechanism
+// (draft-murchison-sasl-login). go-sasl only provides the client side.
+type loginServer struct {
+	username     string
+	step         int
+	authenticate sasl.PlainAuthenticator
+}
+
+func newLoginServer(authenticator sasl.PlainAuthenticator) sasl.Server {
+	return &loginServer{authenticate: authenticator}
+}
+
+func (a *loginServer) Next(response []byte) (challenge []byte, done bool, err error) {
+	switch a.step {
+	case 0:
+		a.step++
+		// Some clients send the username as initial response
+		if response != nil {
+			a.username = string(response)
+			a.step++
+			return []byte("Password:"), false, nil
+		}
+		return []byte("Username:"), false, nil
+	case 1:
+		a.username = string(response)
+		a.step++
+		return []byte("Password:"), false, nil
+	case 2:
+		a.step++
+		return nil, true, a.authenticate("", a.username, string(response))
+	default:
+		return nil, true, sasl.ErrUnexpectedClientResponse
+	}
+}
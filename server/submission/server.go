@@ -0,0 +1,674 @@
+package submission
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/emersion/go-smtp"
+	"github.com/migadu/sora/config"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/events"
+	"github.com/migadu/sora/pkg/lookupcache"
+	"github.com/migadu/sora/pkg/metrics"
+	"github.com/migadu/sora/pkg/resilient"
+	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/idgen"
+	"github.com/migadu/sora/server/uploader"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultMaxRecipients is the default maximum number of recipients per message
+const DefaultMaxRecipients = 100
+
+// RelayQueue queues submitted messages for relay. EnqueueAll queues a message
+// for all its recipients or, on error, for none of them, so a client that
+// retries after a temporary failure does not send the message twice.
+type RelayQueue interface {
+	EnqueueAll(from string, to []string, messageType string, messageBytes []byte) error
+}
+
+// RelayWorkerNotifier provides immediate processing notification for relay workers
+type RelayWorkerNotifier interface {
+	NotifyQueued()
+}
+
+// SubmissionServerOptions holds the settings of a submission server (RFC 6409)
+type SubmissionServerOptions struct {
+	RelayQueue           RelayQueue          // Global relay queue used to send submitted messages
+	RelayWorker          RelayWorkerNotifier // Optional: notifies worker for immediate processing
+	Debug                bool
+	TLS                  bool
+	TLSCertFile          string
+	TLSKeyFile           string
+	TLSVerify            bool
+	TLSUseStartTLS       bool        // STARTTLS on the submission port (587) instead of implicit TLS (465)
+	TLSConfig            *tls.Config // Global TLS config from TLS manager (optional)
+	MasterSASLUsername   string
+	MasterSASLPassword   string
+	AuthRateLimit        server.AuthRateLimiterConfig
+	LookupCache          *config.LookupCacheConfig
+	MaxConnections       int
+	MaxConnectionsPerIP  int
+	ListenBacklog        int    // TCP listen backlog size (0 = use default 1024)
+	ProxyProtocol        bool   // Enable PROXY protocol support (always required when enabled)
+	ProxyProtocolTimeout string // Timeout for reading PROXY headers
+	TrustedNetworks      []string
+	FTSRetention         time.Duration
+	MaxMessageSize       int64  // Maximum size for submitted messages in bytes
+	MaxRecipients        int    // Maximum recipients per message (0 = DefaultMaxRecipients)
+	SaveSent             bool   // Store a copy of every submitted message in the sender's Sent mailbox
+	SentMailbox          string // Mailbox used for sent copies (default: Sent)
+	InsecureAuth         bool   // Allow AUTH over non-TLS connections
+}
+
+// SubmissionServerBackend implements an authenticated message submission server.
+// Accepted messages are handed to the relay queue for outbound delivery.
+type SubmissionServerBackend struct {
+	addr           string
+	name           string
+	hostname       string
+	rdb            *resilient.ResilientDatabase
+	uploader       *uploader.UploadWorker
+	server         *smtp.Server
+	appCtx         context.Context
+	tlsConfig      *tls.Config
+	debug          bool
+	ftsRetention   time.Duration
+	maxMessageSize int64
+	maxRecipients  int
+	relayQueue     RelayQueue
+	relayWorker    RelayWorkerNotifier
+	saveSent       bool
+	sentMailbox    string
+
+	masterSASLUsername []byte
+	masterSASLPassword []byte
+
+	// Connection counters
+	totalConnections         atomic.Int64
+	activeConnections        atomic.Int64
+	authenticatedConnections atomic.Int64
+
+	// Connection limiting
+	limiter       *server.ConnectionLimiter
+	listenBacklog int
+
+	// Authentication
+	authLimiter server.AuthLimiter
+	lookupCache *lookupcache.LookupCache
+
+	// PROXY protocol support
+	proxyReader *server.ProxyProtocolReader
+}
+
+// New creates a submission server. A relay queue is required since
+// submitted messages are delivered through it.
+func New(appCtx context.Context, name, hostname, addr string, rdb *resilient.ResilientDatabase, uploadWorker *uploader.UploadWorker, options SubmissionServerOptions) (*SubmissionServerBackend, error) {
+	if options.RelayQueue == nil {
+		return nil, fmt.Errorf("submission server [%s] requires the relay queue to be enabled ([relay.queue])", name)
+	}
+	if options.SaveSent && uploadWorker == nil {
+		return nil, fmt.Errorf("submission server [%s] cannot save sent copies without an upload worker", name)
+	}
+
+	var proxyReader *server.ProxyProtocolReader
+	if options.ProxyProtocol {
+		proxyConfig := server.ProxyProtocolConfig{
+			Enabled:        true,
+			Mode:           "required",
+			TrustedProxies: options.TrustedNetworks,
+			Timeout:        options.ProxyProtocolTimeout,
+		}
+
+		var err error
+		proxyReader, err = server.NewProxyProtocolReader("SUBMISSION", proxyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize PROXY protocol reader: %w", err)
+		}
+	}
+
+	if !options.TLS && options.TLSUseStartTLS {
+		logger.Debug("tls_use_starttls ignored", "name", name)
+		options.TLSUseStartTLS = false
+	}
+
+	sentMailbox := options.SentMailbox
+	if sentMailbox == "" {
+		sentMailbox = consts.MailboxSent
+	}
+
+	if options.MaxRecipients <= 0 {
+		options.MaxRecipients = DefaultMaxRecipients
+	}
+
+	backend := &SubmissionServerBackend{
+		addr:               addr,
+		name:               name,
+		hostname:           hostname,
+		rdb:                rdb,
+		uploader:           uploadWorker,
+		appCtx:             appCtx,
+		debug:              options.Debug,
+		ftsRetention:       options.FTSRetention,
+		maxMessageSize:     options.MaxMessageSize,
+		maxRecipients:      options.MaxRecipients,
+		relayQueue:         options.RelayQueue,
+		relayWorker:        options.RelayWorker,
+		saveSent:           options.SaveSent,
+		sentMailbox:        sentMailbox,
+		masterSASLUsername: []byte(options.MasterSASLUsername),
+		masterSASLPassword: []byte(options.MasterSASLPassword),
+		proxyReader:        proxyReader,
+	}
+
+	limiterTrustedProxies := server.GetTrustedProxiesForServer(proxyReader)
+	backend.limiter = server.NewConnectionLimiterWithTrustedNets("SUBMISSION", options.MaxConnections, options.MaxConnectionsPerIP, limiterTrustedProxies)
+
+	backend.listenBacklog = options.ListenBacklog
+	if backend.listenBacklog == 0 {
+		backend.listenBacklog = 1024
+	}
+
+	// Authentication rate limiter shares its configuration style with IMAP/POP3
+	authLimiter := server.NewAuthRateLimiterWithTrustedNetworks("SUBMISSION", name, hostname, options.AuthRateLimit, options.TrustedNetworks)
+	server.RegisterRateLimiter("submission", name, authLimiter)
+	backend.authLimiter = authLimiter
+
+	backend.lookupCache = newLookupCache(name, options.LookupCache)
+
+	// Set up TLS config:
+	// 1. Per-server TLS: cert files provided (for both implicit TLS and STARTTLS)
+	// 2. Global TLS: options.TLS=true, no cert files, global TLS config provided
+	// 3. No TLS: options.TLS=false (only behind a submission proxy)
+	if options.TLS && options.TLSCertFile != "" && options.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(options.TLSCertFile, options.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		backend.tlsConfig = &tls.Config{
+			Certificates:             []tls.Certificate{cert},
+			MinVersion:               tls.VersionTLS12,
+			ClientAuth:               tls.NoClientCert,
+			ServerName:               hostname,
+			PreferServerCipherSuites: true,
+			NextProtos:               []string{"smtp"},
+			Renegotiation:            tls.RenegotiateNever,
+		}
+
+		if !options.TLSVerify {
+			backend.tlsConfig.InsecureSkipVerify = true
+			logger.Debug("tls certificate verification disabled", "name", name)
+		}
+	} else if options.TLS && options.TLSConfig != nil {
+		backend.tlsConfig = options.TLSConfig
+	} else if options.TLS {
+		return nil, fmt.Errorf("TLS enabled for submission [%s] but no tls_cert_file/tls_key_file provided and no global TLS manager configured", name)
+	}
+
+	s := smtp.NewServer(backend)
+	s.Addr = addr
+	s.Domain = hostname
+	s.Network = "tcp"
+	s.AllowInsecureAuth = options.InsecureAuth
+	s.MaxMessageBytes = options.MaxMessageSize
+
+	// XCLIENT lets a submission proxy forward the real client address
+	trustedNets, err := server.ParseTrustedNetworks(options.TrustedNetworks)
+	if err != nil {
+		logger.Debug("failed to parse trusted networks, xclient disabled", "name", name, "error", err)
+		trustedNets = []*net.IPNet{}
+	}
+	s.EnableXCLIENT = len(trustedNets) > 0
+	s.XCLIENTTrustedNets = trustedNets
+
+	if options.TLSUseStartTLS && backend.tlsConfig != nil {
+		s.TLSConfig = backend.tlsConfig
+		logger.Debug("starttls enabled", "name", name)
+	}
+
+	if options.Debug {
+		s.Debug = os.Stdout
+	}
+
+	backend.server = s
+
+	backend.limiter.StartCleanup(appCtx)
+
+	return backend, nil
+}
+
+// newLookupCache creates the authentication cache, enabled by default
+func newLookupCache(name string, cacheConfig *config.LookupCacheConfig) *lookupcache.LookupCache {
+	if cacheConfig == nil {
+		cacheConfig = &config.LookupCacheConfig{
+			Enabled:                    true,
+			PositiveTTL:                "5m",
+			NegativeTTL:                "1m",
+			MaxSize:                    10000,
+			CleanupInterval:            "5m",
+			PositiveRevalidationWindow: "30s",
+		}
+	}
+
+	if !cacheConfig.Enabled {
+		logger.Info("Submission: Lookup cache disabled", "name", name)
+		return nil
+	}
+
+	positiveTTL, err := time.ParseDuration(cacheConfig.PositiveTTL)
+	if err != nil || cacheConfig.PositiveTTL == "" {
+		positiveTTL = 5 * time.Minute
+	}
+	negativeTTL, err := time.ParseDuration(cacheConfig.NegativeTTL)
+	if err != nil || cacheConfig.NegativeTTL == "" {
+		negativeTTL = 1 * time.Minute
+	}
+	cleanupInterval, err := time.ParseDuration(cacheConfig.CleanupInterval)
+	if err != nil || cacheConfig.CleanupInterval == "" {
+		cleanupInterval = 5 * time.Minute
+	}
+	maxSize := cacheConfig.MaxSize
+	if maxSize == 0 {
+		maxSize = 10000
+	}
+	positiveRevalidationWindow, err := cacheConfig.GetPositiveRevalidationWindow()
+	if err != nil {
+		logger.Info("Submission: Invalid positive revalidation window in auth cache config, using default (30s)", "name", name, "error", err)
+		positiveRevalidationWindow = 30 * time.Second
+	}
+
+	logger.Info("Submission: Lookup cache enabled", "name", name, "positive_ttl", positiveTTL, "negative_ttl", negativeTTL, "max_size", maxSize)
+	return lookupcache.New(positiveTTL, negativeTTL, maxSize, cleanupInterval, positiveRevalidationWindow)
+}
+
+func (b *SubmissionServerBackend) NewSession(c *smtp.Conn) (smtp.Session, error) {
+	sessionCtx, sessionCancel := context.WithCancel(b.appCtx)
+
+	b.totalConnections.Add(1)
+	b.activeConnections.Add(1)
+
+	metrics.ConnectionsTotal.WithLabelValues("submission", b.name, b.hostname).Inc()
+	metrics.ConnectionsCurrent.WithLabelValues("submission", b.name, b.hostname).Inc()
+
+	s := &SubmissionSession{
+		backend:   b,
+		conn:      c,
+		ctx:       sessionCtx,
+		cancel:    sessionCancel,
+		startTime: time.Now(),
+	}
+
+	// Unwrap connection layers to find PROXY protocol information
+	netConn := c.Conn()
+	var proxyInfo *server.ProxyProtocolInfo
+	currentConn := netConn
+	for currentConn != nil {
+		if proxyConn, ok := currentConn.(*proxyProtocolConn); ok {
+			proxyInfo = proxyConn.GetProxyInfo()
+			break
+		} else if limitingConn, ok := currentConn.(*connectionLimitingConn); ok {
+			if limitingInfo := limitingConn.GetProxyInfo(); limitingInfo != nil {
+				proxyInfo = limitingInfo
+				break
+			}
+		}
+		if wrapper, ok := currentConn.(interface{ Unwrap() net.Conn }); ok {
+			currentConn = wrapper.Unwrap()
+		} else {
+			break
+		}
+	}
+
+	clientIP, proxyIP := server.GetConnectionIPs(netConn, proxyInfo)
+	s.RemoteIP = clientIP
+	s.ProxyIP = proxyIP
+
+	// XCLIENT resets the session, so attributes accepted earlier on this
+	// connection are applied to every new session
+	if xclientAddr := c.XCLIENTData()["ADDR"]; xclientAddr != "" && xclientAddr != "[UNAVAILABLE]" {
+		if s.ProxyIP == "" {
+			s.ProxyIP = s.RemoteIP
+		}
+		s.RemoteIP = xclientAddr
+	}
+
+	s.Id = idgen.New()
+	s.HostName = b.hostname
+	s.ServerName = b.name
+	s.Protocol = "SUBMISSION"
+	s.Stats = b
+
+	logFunc := func(format string, args ...any) {
+		s.InfoLog(format, args...)
+	}
+	s.mutexHelper = server.NewMutexTimeoutHelper(&s.mutex, sessionCtx, "SUBMISSION", logFunc)
+
+	s.DebugLog("new session", "active_count", b.activeConnections.Load())
+
+	return s, nil
+}
+
+func (b *SubmissionServerBackend) Start(errChan chan error) {
+	go b.monitorActiveConnections()
+
+	tcpListener, err := server.ListenWithBacklog(context.Background(), "tcp", b.server.Addr, b.listenBacklog)
+	if err != nil {
+		errChan <- fmt.Errorf("failed to create listener: %w", err)
+		return
+	}
+
+	var listener net.Listener
+	if b.tlsConfig != nil && b.server.TLSConfig == nil {
+		// Implicit TLS (port 465)
+		listener = tls.NewListener(tcpListener, b.tlsConfig)
+		logger.Info("submission server listening with tls", "name", b.name, "addr", b.server.Addr)
+	} else {
+		listener = tcpListener
+		logger.Info("submission server listening", "name", b.name, "addr", b.server.Addr, "starttls", b.server.TLSConfig != nil)
+	}
+	defer listener.Close()
+
+	if b.proxyReader != nil {
+		listener = &proxyProtocolListener{
+			Listener:    listener,
+			proxyReader: b.proxyReader,
+		}
+	}
+
+	limitedListener := &connectionLimitingListener{
+		Listener: listener,
+		limiter:  b.limiter,
+		name:     b.name,
+	}
+
+	if err := b.server.Serve(limitedListener); err != nil {
+		if b.appCtx.Err() != nil {
+			logger.Info("submission server stopped gracefully", "name", b.name)
+		} else {
+			errChan <- fmt.Errorf("submission server error: %w", err)
+		}
+	} else {
+		logger.Info("submission server stopped gracefully", "name", b.name)
+	}
+}
+
+// ReloadConfig updates runtime-configurable settings from new config.
+// Called on SIGHUP. Only affects new messages.
+func (b *SubmissionServerBackend) ReloadConfig(cfg config.ServerConfig) error {
+	var reloaded []string
+
+	if maxSize := cfg.GetMaxMessageSizeWithDefault(); maxSize != b.maxMessageSize {
+		b.maxMessageSize = maxSize
+		reloaded = append(reloaded, "max_message_size")
+	}
+	if cfg.Debug != b.debug {
+		b.debug = cfg.Debug
+		reloaded = append(reloaded, "debug")
+	}
+	if cfg.MasterSASLUsername != string(b.masterSASLUsername) {
+		b.masterSASLUsername = []byte(cfg.MasterSASLUsername)
+		reloaded = append(reloaded, "master_sasl_username")
+	}
+	if cfg.MasterSASLPassword != string(b.masterSASLPassword) {
+		b.masterSASLPassword = []byte(cfg.MasterSASLPassword)
+		reloaded = append(reloaded, "master_sasl_password")
+	}
+
+	if len(reloaded) > 0 {
+		logger.Info("Submission config reloaded", "name", b.name, "updated", reloaded)
+	}
+	return nil
+}
+
+func (b *SubmissionServerBackend) Close() error {
+	if b.lookupCache != nil {
+		b.lookupCache.Stop(context.Background())
+	}
+	if b.server != nil {
+		return b.server.Close()
+	}
+	return nil
+}
+
+// GetTotalConnections returns the cumulative total of all connections ever made
+func (b *SubmissionServerBackend) GetTotalConnections() int64 {
+	return b.totalConnections.Load()
+}
+
+// GetActiveConnections returns the current number of active connections
+func (b *SubmissionServerBackend) GetActiveConnections() int64 {
+	return b.activeConnections.Load()
+}
+
+// GetAuthenticatedConnections returns the current authenticated connection count
+func (b *SubmissionServerBackend) GetAuthenticatedConnections() int64 {
+	return b.authenticatedConnections.Load()
+}
+
+// GetLimiter returns the connection limiter for testing purposes
+func (b *SubmissionServerBackend) GetLimiter() *server.ConnectionLimiter {
+	return b.limiter
+}
+
+// Authenticate authenticates a user with the same lookup cache and
+// password verification as the IMAP and POP3 servers.
+func (b *SubmissionServerBackend) Authenticate(ctx context.Context, address, password string) (accountID int64, err error) {
+	defer func() { events.PublishAuth(ctx, address, accountID, err) }()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if b.lookupCache != nil {
+		cachedAccountID, found, cacheErr := b.lookupCache.Authenticate(address, password)
+		if cacheErr != nil {
+			logger.Debug("Authentication failed (cached)", "address", address, "cache", "hit")
+			return 0, cacheErr
+		}
+		if found {
+			logger.Info("authentication successful", "address", address, "account_id", cachedAccountID, "cached", true, "method", "cache")
+			return cachedAccountID, nil
+		}
+	}
+
+	creds, err := b.rdb.GetAuthCredentialsWithRetry(ctx, address)
+	if err != nil {
+		if b.lookupCache != nil && errors.Is(err, consts.ErrUserNotFound) {
+			b.lookupCache.SetFailure(address, int(lookupcache.AuthUserNotFound), password)
+		}
+		logger.Info("authentication failed", "address", address, "reason", "user_not_found", "cached", false, "method", "main_db")
+		return 0, err
+	}
+
+	accountID = creds.AccountID
+	hashedPassword := creds.HashedPassword
+
+	protocol, remoteIP := events.SourceFromContext(ctx)
+	app, err := creds.Verify(password, protocol, remoteIP)
+	if err != nil {
+		if b.lookupCache != nil {
+			b.lookupCache.SetFailure(address, int(lookupcache.AuthInvalidPassword), password)
+		}
+		logger.Info("authentication failed", "address", address, "reason", "invalid_password", "cached", false, "method", "main_db")
+		return 0, err
+	}
+
+	if app != nil {
+		b.rdb.RecordAppPasswordUse(app.ID, remoteIP)
+		// The cache does not know the client address, so IP-restricted app
+		// passwords are always checked against the database. The cached hash
+		// is of the password as typed, which may differ from the stored form.
+		if b.lookupCache != nil && len(app.AllowedIPs) == 0 {
+			b.lookupCache.SetSuccess(address, accountID, db.GenerateSHA512Hash(password), password)
+		}
+		logger.Info("authentication successful", "address", address, "account_id", accountID, "app_password_id", app.ID, "cached", false, "method", "main_db")
+		return accountID, nil
+	}
+
+	if b.lookupCache != nil {
+		b.lookupCache.SetSuccess(address, accountID, hashedPassword, password)
+	}
+
+	logger.Info("authentication successful", "address", address, "account_id", accountID, "cached", false, "method", "main_db")
+
+	if db.NeedsRehash(hashedPassword) {
+		go func() {
+			newHash, hashErr := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+			if hashErr != nil {
+				logger.Error("Rehash: Failed to generate new hash", "address", address, "error", hashErr)
+				return
+			}
+
+			newHashedPassword := string(newHash)
+			if strings.HasPrefix(hashedPassword, "{BLF-CRYPT}") {
+				newHashedPassword = "{BLF-CRYPT}" + newHashedPassword
+			}
+
+			updateCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			if err := b.rdb.UpdatePasswordWithRetry(updateCtx, address, newHashedPassword); err != nil {
+				logger.Error("Rehash: Failed to update password", "address", address, "error", err)
+			} else if b.lookupCache != nil {
+				b.lookupCache.Invalidate(address)
+			}
+		}()
+	}
+
+	return accountID, nil
+}
+
+// connectionLimitingListener wraps a net.Listener to enforce connection limits at the TCP level
+type connectionLimitingListener struct {
+	net.Listener
+	limiter *server.ConnectionLimiter
+	name    string
+}
+
+// Accept accepts connections and checks connection limits before returning them
+func (l *connectionLimitingListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		var realClientIP string
+		var proxyInfo *server.ProxyProtocolInfo
+		if proxyConn, ok := conn.(*proxyProtocolConn); ok {
+			proxyInfo = proxyConn.GetProxyInfo()
+			if proxyInfo != nil && proxyInfo.SrcIP != "" {
+				realClientIP = proxyInfo.SrcIP
+			}
+		}
+
+		releaseConn, limitErr := l.limiter.AcceptWithRealIP(conn.RemoteAddr(), realClientIP)
+		if limitErr != nil {
+			logger.Debug("connection rejected", "name", l.name, "error", limitErr)
+			conn.Close()
+			continue
+		}
+
+		return &connectionLimitingConn{
+			Conn:        conn,
+			releaseFunc: releaseConn,
+			proxyInfo:   proxyInfo,
+		}, nil
+	}
+}
+
+// connectionLimitingConn wraps a net.Conn to ensure connection limit cleanup on close
+type connectionLimitingConn struct {
+	net.Conn
+	releaseFunc func()
+	proxyInfo   *server.ProxyProtocolInfo
+	closeMu     sync.Mutex
+	closed      bool
+}
+
+// GetProxyInfo implements the same interface as proxyProtocolConn
+func (c *connectionLimitingConn) GetProxyInfo() *server.ProxyProtocolInfo {
+	return c.proxyInfo
+}
+
+func (c *connectionLimitingConn) Close() error {
+	c.closeMu.Lock()
+	defer c.closeMu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	if c.releaseFunc != nil {
+		c.releaseFunc()
+		c.releaseFunc = nil
+	}
+	return c.Conn.Close()
+}
+
+// proxyProtocolListener wraps a listener to handle PROXY protocol
+type proxyProtocolListener struct {
+	net.Listener
+	proxyReader *server.ProxyProtocolReader
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		proxyInfo, wrappedConn, err := l.proxyReader.ReadProxyHeader(conn)
+		if err == nil {
+			return &proxyProtocolConn{
+				Conn:      wrappedConn,
+				proxyInfo: proxyInfo,
+			}, nil
+		}
+
+		if l.proxyReader.IsOptionalMode() && errors.Is(err, server.ErrNoProxyHeader) {
+			logger.Debug("no proxy protocol header - treating as direct", "remote_addr", conn.RemoteAddr())
+			return wrappedConn, nil
+		}
+
+		conn.Close()
+		logger.Debug("proxy protocol error - rejecting", "remote_addr", conn.RemoteAddr(), "error", err)
+	}
+}
+
+// proxyProtocolConn wraps a connection with PROXY protocol information
+type proxyProtocolConn struct {
+	net.Conn
+	proxyInfo *server.ProxyProtocolInfo
+}
+
+func (c *proxyProtocolConn) GetProxyInfo() *server.ProxyProtocolInfo {
+	return c.proxyInfo
+}
+
+// monitorActiveConnections periodically logs active connection count for monitoring
+func (b *SubmissionServerBackend) monitorActiveConnections() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			logger.Info("submission server active connections", "name", b.name, "active_connections", b.activeConnections.Load(), "authenticated_connections", b.authenticatedConnections.Load())
+		case <-b.appCtx.Done():
+			return
+		}
+	}
+}
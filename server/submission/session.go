@@ -0,0 +1,629 @@
+package submission
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/helpers"
+	"github.com/migadu/sora/pkg/events"
+	"github.com/migadu/sora/pkg/metrics"
+	"github.com/migadu/sora/server"
+)
+
+// SubmissionSession represents a single submission session.
+type SubmissionSession struct {
+	server.Session
+	backend       *SubmissionServerBackend
+	conn          *smtp.Conn
+	ctx           context.Context
+	cancel        context.CancelFunc
+	mutex         sync.RWMutex
+	mutexHelper   *server.MutexTimeoutHelper
+	authenticated bool
+	sender        *server.Address
+	recipients    []string
+	startTime     time.Time
+}
+
+// AuthMechanisms returns the SASL mechanisms offered after EHLO.
+func (s *SubmissionSession) AuthMechanisms() []string {
+	return []string{sasl.Plain, sasl.Login}
+}
+
+// Auth returns the SASL server for a mechanism.
+func (s *SubmissionSession) Auth(mech string) (sasl.Server, error) {
+	switch mech {
+	case sasl.Plain:
+		return sasl.NewPlainServer(s.authenticate), nil
+	case sasl.Login:
+		return newLoginServer(s.authenticate), nil
+	}
+	return nil, smtp.ErrAuthUnknownMechanism
+}
+
+// authenticate verifies the credentials of an AUTH command. identity is
+// the authorization identity, which is only accepted together with the
+// master SASL credentials (used by the submission proxy).
+func (s *SubmissionSession) authenticate(identity, username, password string) error {
+	start := time.Now()
+	recordMetrics := func(status string) {
+		metrics.CommandsTotal.WithLabelValues("submission", "AUTH", status).Inc()
+		metrics.CommandDuration.WithLabelValues("submission", "AUTH").Observe(time.Since(start).Seconds())
+	}
+
+	if s.authenticated {
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         503,
+			EnhancedCode: smtp.EnhancedCode{5, 5, 1},
+			Message:      "Already authenticated",
+		}
+	}
+
+	var address server.Address
+	var accountID int64
+	impersonating := false
+
+	masterSASLUsername := s.backend.masterSASLUsername
+	masterSASLPassword := s.backend.masterSASLPassword
+	if len(masterSASLUsername) > 0 && len(masterSASLPassword) > 0 &&
+		username == string(masterSASLUsername) && password == string(masterSASLPassword) {
+		if identity == "" {
+			s.DebugLog("master sasl authentication without authorization identity")
+			recordMetrics("failure")
+			return smtp.ErrAuthFailed
+		}
+
+		target, err := server.NewAddress(identity)
+		if err != nil {
+			s.DebugLog("invalid impersonation target", "authz_id", identity, "error", err)
+			recordMetrics("failure")
+			return smtp.ErrAuthFailed
+		}
+		accountID, err = s.backend.rdb.GetAccountIDByAddressWithRetry(s.ctx, target.BaseAddress())
+		if err != nil {
+			s.DebugLog("impersonation target not found", "authz_id", identity, "error", err)
+			recordMetrics("failure")
+			return smtp.ErrAuthFailed
+		}
+		address = target
+		impersonating = true
+	}
+
+	if !impersonating {
+		if identity != "" && identity != username {
+			s.DebugLog("proxy authentication requires master credentials", "authz_id", identity, "authn_id", username)
+			recordMetrics("failure")
+			return smtp.ErrAuthFailed
+		}
+
+		var err error
+		address, err = server.NewAddress(username)
+		if err != nil {
+			s.DebugLog("invalid username format", "error", err)
+			recordMetrics("failure")
+			return smtp.ErrAuthFailed
+		}
+
+		netConn := s.conn.Conn()
+		var proxyInfo *server.ProxyProtocolInfo
+		if s.ProxyIP != "" {
+			proxyInfo = &server.ProxyProtocolInfo{SrcIP: s.RemoteIP}
+		}
+
+		remoteAddr := &server.StringAddr{Addr: s.RemoteIP}
+		server.ApplyAuthenticationDelay(s.ctx, s.backend.authLimiter, remoteAddr, "SUBMISSION-AUTH")
+
+		if s.backend.authLimiter != nil {
+			if err := s.backend.authLimiter.CanAttemptAuthWithProxy(s.ctx, netConn, proxyInfo, address.FullAddress()); err != nil {
+				s.DebugLog("authentication rate limited", "error", err)
+				metrics.AuthenticationAttempts.WithLabelValues("submission", s.backend.name, s.backend.hostname, "rate_limited").Inc()
+				recordMetrics("failure")
+				return &smtp.SMTPError{
+					Code:         454,
+					EnhancedCode: smtp.EnhancedCode{4, 7, 0},
+					Message:      "Too many authentication attempts, please try again later",
+				}
+			}
+		}
+
+		accountID, err = s.backend.Authenticate(events.WithSource(s.ctx, "submission", s.RemoteIP), address.BaseAddress(), password)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				s.InfoLog("authentication cancelled due to server shutdown")
+				recordMetrics("failure")
+				return &smtp.SMTPError{
+					Code:         421,
+					EnhancedCode: smtp.EnhancedCode{4, 3, 2},
+					Message:      "Service shutting down",
+				}
+			}
+			if s.backend.authLimiter != nil {
+				s.backend.authLimiter.RecordAuthAttemptWithProxy(s.ctx, netConn, proxyInfo, address.FullAddress(), false)
+			}
+			metrics.AuthenticationAttempts.WithLabelValues("submission", s.backend.name, s.backend.hostname, "failure").Inc()
+			recordMetrics("failure")
+			return smtp.ErrAuthFailed
+		}
+
+		if s.backend.authLimiter != nil {
+			s.backend.authLimiter.RecordAuthAttemptWithProxy(s.ctx, netConn, proxyInfo, address.FullAddress(), true)
+		}
+	}
+
+	acquired, release := s.mutexHelper.AcquireWriteLockWithTimeout()
+	if !acquired {
+		s.WarnLog("failed to acquire write lock", "command", "AUTH")
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         421,
+			EnhancedCode: smtp.EnhancedCode{4, 4, 5},
+			Message:      "Server busy, try again later",
+		}
+	}
+	s.User = server.NewUser(address, accountID)
+	s.authenticated = true
+	release()
+
+	s.backend.authenticatedConnections.Add(1)
+	metrics.AuthenticatedConnectionsCurrent.WithLabelValues("submission", s.backend.name, s.backend.hostname).Inc()
+	metrics.AuthenticationAttempts.WithLabelValues("submission", s.backend.name, s.backend.hostname, "success").Inc()
+
+	if impersonating {
+		s.InfoLog("authentication successful", "address", address.FullAddress(), "account_id", accountID, "method", "master")
+	}
+
+	recordMetrics("success")
+	return nil
+}
+
+func (s *SubmissionSession) Mail(from string, opts *smtp.MailOptions) error {
+	start := time.Now()
+	recordMetrics := func(status string) {
+		metrics.CommandsTotal.WithLabelValues("submission", "MAIL", status).Inc()
+		metrics.CommandDuration.WithLabelValues("submission", "MAIL").Observe(time.Since(start).Seconds())
+	}
+
+	if !s.authenticated {
+		recordMetrics("failure")
+		return smtp.ErrAuthRequired
+	}
+
+	// Authenticated users never send bounces
+	if from == "" {
+		s.WarnLog("null sender rejected")
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         553,
+			EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+			Message:      "Null sender not permitted",
+		}
+	}
+
+	fromAddress, err := server.NewAddress(from)
+	if err != nil {
+		s.WarnLog("invalid from address", "from", from, "error", err)
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         553,
+			EnhancedCode: smtp.EnhancedCode{5, 1, 7},
+			Message:      "Invalid sender",
+		}
+	}
+
+	// The envelope sender must be one of the authenticated account's addresses
+	ownerID, err := s.backend.rdb.GetAccountIDByAddressWithRetry(s.ctx, fromAddress.BaseAddress())
+	if err != nil && !errors.Is(err, consts.ErrUserNotFound) {
+		s.WarnLog("database error during sender lookup", "from", fromAddress.BaseAddress(), "error", err)
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         451,
+			EnhancedCode: smtp.EnhancedCode{4, 4, 3},
+			Message:      "Temporary failure, please try again later",
+		}
+	}
+	if err != nil || ownerID != s.AccountID() {
+		s.InfoLog("sender address not owned by authenticated user", "from", fromAddress.FullAddress())
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         553,
+			EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+			Message:      "Sender address rejected: not owned by authenticated user",
+		}
+	}
+
+	// send-disabled accounts can still log in and receive mail, but not send
+	status, err := s.backend.rdb.GetAccountStatusWithRetry(s.ctx, s.AccountID())
+	if err != nil {
+		s.WarnLog("database error during account status lookup", "error", err)
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         451,
+			EnhancedCode: smtp.EnhancedCode{4, 4, 3},
+			Message:      "Temporary failure, please try again later",
+		}
+	}
+	if !db.AccountStatusAllowsSending(status.Status) {
+		s.InfoLog("sending disabled for account", "from", fromAddress.FullAddress(), "status", status.Status)
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         550,
+			EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+			Message:      "Sending is disabled for this account",
+		}
+	}
+
+	acquired, release := s.mutexHelper.AcquireWriteLockWithTimeout()
+	if !acquired {
+		s.WarnLog("failed to acquire write lock", "command", "MAIL")
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         421,
+			EnhancedCode: smtp.EnhancedCode{4, 4, 5},
+			Message:      "Server busy, try again later",
+		}
+	}
+	defer release()
+
+	s.sender = &fromAddress
+	s.recipients = nil
+
+	s.DebugLog("mail from accepted", "from", fromAddress.FullAddress())
+	recordMetrics("success")
+	return nil
+}
+
+func (s *SubmissionSession) Rcpt(to string, opts *smtp.RcptOptions) error {
+	start := time.Now()
+	recordMetrics := func(status string) {
+		metrics.CommandsTotal.WithLabelValues("submission", "RCPT", status).Inc()
+		metrics.CommandDuration.WithLabelValues("submission", "RCPT").Observe(time.Since(start).Seconds())
+	}
+
+	if !s.authenticated {
+		recordMetrics("failure")
+		return smtp.ErrAuthRequired
+	}
+
+	toAddress, err := server.NewAddress(to)
+	if err != nil {
+		s.WarnLog("invalid to address", "to", to, "error", err)
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         553,
+			EnhancedCode: smtp.EnhancedCode{5, 1, 3},
+			Message:      "Invalid recipient",
+		}
+	}
+
+	acquired, release := s.mutexHelper.AcquireWriteLockWithTimeout()
+	if !acquired {
+		s.WarnLog("failed to acquire write lock", "command", "RCPT")
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         421,
+			EnhancedCode: smtp.EnhancedCode{4, 4, 5},
+			Message:      "Server busy, try again later",
+		}
+	}
+	defer release()
+
+	if len(s.recipients) >= s.backend.maxRecipients {
+		s.InfoLog("too many recipients", "limit", s.backend.maxRecipients)
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         452,
+			EnhancedCode: smtp.EnhancedCode{4, 5, 3},
+			Message:      fmt.Sprintf("Too many recipients, at most %d are accepted per message", s.backend.maxRecipients),
+		}
+	}
+
+	s.recipients = append(s.recipients, toAddress.FullAddress())
+
+	s.DebugLog("rcpt to accepted", "to", toAddress.FullAddress())
+	recordMetrics("success")
+	return nil
+}
+
+func (s *SubmissionSession) Data(r io.Reader) error {
+	start := time.Now()
+	recordMetrics := func(status string) {
+		metrics.CommandsTotal.WithLabelValues("submission", "DATA", status).Inc()
+		metrics.CommandDuration.WithLabelValues("submission", "DATA").Observe(time.Since(start).Seconds())
+	}
+
+	acquired, release := s.mutexHelper.AcquireWriteLockWithTimeout()
+	if !acquired {
+		s.WarnLog("failed to acquire write lock", "command", "DATA")
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         421,
+			EnhancedCode: smtp.EnhancedCode{4, 4, 5},
+			Message:      "Server busy, try again later",
+		}
+	}
+	defer release()
+
+	if !s.authenticated || s.sender == nil || len(s.recipients) == 0 {
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         503,
+			EnhancedCode: smtp.EnhancedCode{5, 5, 1},
+			Message:      "Bad sequence of commands (missing MAIL FROM or RCPT TO)",
+		}
+	}
+
+	var buf bytes.Buffer
+	var reader io.Reader = r
+	if s.backend.maxMessageSize > 0 {
+		reader = io.LimitReader(r, s.backend.maxMessageSize+1)
+	}
+	if _, err := io.Copy(&buf, reader); err != nil {
+		s.WarnLog("error reading message data", "error", err, "bytes_read", buf.Len())
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         421,
+			EnhancedCode: smtp.EnhancedCode{4, 4, 2},
+			Message:      "Error reading message data",
+		}
+	}
+
+	if s.backend.maxMessageSize > 0 && int64(buf.Len()) > s.backend.maxMessageSize {
+		s.WarnLog("message size exceeds limit", "size", buf.Len(), "limit", s.backend.maxMessageSize)
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         552,
+			EnhancedCode: smtp.EnhancedCode{5, 3, 4},
+			Message:      fmt.Sprintf("message size exceeds maximum allowed size of %d bytes", s.backend.maxMessageSize),
+		}
+	}
+
+	if buf.Len() == 0 {
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         550,
+			EnhancedCode: smtp.EnhancedCode{5, 6, 0},
+			Message:      "empty message rejected: a message must contain at least headers",
+		}
+	}
+
+	messageBytes, err := completeMessage(buf.Bytes(), s.backend.hostname, time.Now())
+	if err != nil {
+		s.InfoLog("malformed message rejected", "error", err)
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         554,
+			EnhancedCode: smtp.EnhancedCode{5, 6, 0},
+			Message:      "Malformed message header",
+		}
+	}
+	relayBytes, err := stripBcc(messageBytes)
+	if err != nil {
+		recordMetrics("failure")
+		return s.InternalError("failed to prepare message: %v", err)
+	}
+
+	// Queue one relay entry per recipient. The queue persists messages to
+	// disk, so the message is safe once all recipients are queued. Either all
+	// recipients are queued or none, so a client that retries after a
+	// temporary failure does not send the message twice.
+	if err := s.backend.relayQueue.EnqueueAll(s.sender.FullAddress(), s.recipients, "submission", relayBytes); err != nil {
+		s.WarnLog("failed to enqueue message", "recipients", len(s.recipients), "error", err)
+		recordMetrics("failure")
+		return &smtp.SMTPError{
+			Code:         451,
+			EnhancedCode: smtp.EnhancedCode{4, 3, 0},
+			Message:      "Temporary failure queueing message, please try again later",
+		}
+	}
+	if s.backend.relayWorker != nil {
+		s.backend.relayWorker.NotifyQueued()
+	}
+
+	metrics.MessageSizeBytes.WithLabelValues("submission").Observe(float64(len(messageBytes)))
+	metrics.BytesThroughput.WithLabelValues("submission", "in").Add(float64(len(messageBytes)))
+	metrics.MessageThroughput.WithLabelValues("submission", "queued", "success").Inc()
+
+	s.InfoLog("message queued for relay", "from", s.sender.FullAddress(), "recipients", len(s.recipients), "size", len(messageBytes))
+
+	// The message is already accepted; a failed Sent copy is only logged
+	if s.backend.saveSent {
+		if err := s.saveSentCopy(messageBytes); err != nil {
+			s.WarnLog("failed to save sent copy", "mailbox", s.backend.sentMailbox, "error", err)
+		}
+	}
+
+	s.sender = nil
+	s.recipients = nil
+
+	recordMetrics("success")
+	return nil
+}
+
+// saveSentCopy stores a submitted message as seen in the sender's Sent mailbox.
+func (s *SubmissionSession) saveSentCopy(messageBytes []byte) error {
+	ctx := context.WithValue(s.ctx, consts.UseMasterDBKey, true)
+	accountID := s.AccountID()
+	size := int64(len(messageBytes))
+
+	if err := s.backend.rdb.CheckQuotaWithRetry(ctx, accountID, size, 1); err != nil {
+		return err
+	}
+
+	// S3 keys always use the primary address of the account
+	primary, err := s.backend.rdb.GetPrimaryEmailForAccountWithRetry(ctx, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to get primary address: %w", err)
+	}
+
+	mailbox, err := s.backend.rdb.GetOrCreateMailboxByNameWithRetry(s.ctx, accountID, s.backend.sentMailbox)
+	if err != nil {
+		return fmt.Errorf("failed to get or create mailbox '%s': %w", s.backend.sentMailbox, err)
+	}
+
+	messageContent, err := server.ParseMessage(bytes.NewReader(messageBytes))
+	if err != nil {
+		return fmt.Errorf("failed to parse message: %w", err)
+	}
+
+	mailHeader := mail.Header{Header: messageContent.Header}
+	subject, _ := mailHeader.Subject()
+	messageID, _ := mailHeader.MessageID()
+	sentDate, _ := mailHeader.Date()
+	inReplyTo, _ := mailHeader.MsgIDList("In-Reply-To")
+	references, _ := mailHeader.MsgIDList("References")
+	if sentDate.IsZero() {
+		sentDate = time.Now()
+	}
+
+	var rawHeadersText string
+	if headerEndIndex := bytes.Index(messageBytes, []byte("\r\n\r\n")); headerEndIndex != -1 {
+		rawHeadersText = string(messageBytes[:headerEndIndex])
+	}
+
+	plaintextBody, _ := helpers.ExtractPlaintextBody(messageContent)
+	if plaintextBody == nil {
+		plaintextBody = new(string)
+	}
+
+	bodyStructureVal := imapserver.ExtractBodyStructure(bytes.NewReader(messageBytes))
+	bodyStructure := &bodyStructureVal
+	if err := helpers.ValidateBodyStructure(bodyStructure); err != nil {
+		s.DebugLog("invalid body structure, using fallback", "error", err)
+		var fallback imap.BodyStructure = &imap.BodyStructureSinglePart{
+			Type:     "text",
+			Subtype:  "plain",
+			Size:     uint32(len(messageBytes)),
+			Extended: &imap.BodyStructureSinglePartExt{},
+		}
+		bodyStructure = &fallback
+	}
+
+	contentHash := helpers.HashContent(messageBytes)
+
+	// Don't overwrite a file the uploader may be processing
+	expectedPath := s.backend.uploader.FilePath(contentHash, accountID)
+	if _, err := os.Stat(expectedPath); os.IsNotExist(err) {
+		if _, err := s.backend.uploader.StoreLocally(contentHash, accountID, messageBytes); err != nil {
+			return fmt.Errorf("failed to save message to disk: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to check file existence: %w", err)
+	}
+
+	_, uid, err := s.backend.rdb.InsertMessageWithRetry(s.ctx,
+		&db.InsertMessageOptions{
+			AccountID:     accountID,
+			MailboxID:     mailbox.ID,
+			S3Domain:      primary.Domain(),
+			S3Localpart:   primary.LocalPart(),
+			MailboxName:   mailbox.Name,
+			ContentHash:   contentHash,
+			MessageID:     messageID,
+			InternalDate:  time.Now(),
+			Size:          size,
+			Subject:       subject,
+			PlaintextBody: *plaintextBody,
+			SentDate:      sentDate,
+			InReplyTo:     inReplyTo,
+			References:    references,
+			BodyStructure: bodyStructure,
+			Recipients:    helpers.ExtractRecipients(messageContent.Header),
+			Flags:         []imap.Flag{imap.FlagSeen},
+			RawHeaders:    rawHeadersText,
+			FTSRetention:  s.backend.ftsRetention,
+		},
+		db.PendingUpload{
+			ContentHash: contentHash,
+			InstanceID:  s.backend.hostname,
+			Size:        size,
+			AccountID:   accountID,
+		})
+	if err != nil {
+		if errors.Is(err, consts.ErrMessageExists) || errors.Is(err, consts.ErrDBUniqueViolation) {
+			s.DebugLog("sent copy already exists", "message_id", messageID)
+			return nil
+		}
+		return fmt.Errorf("failed to save message: %w", err)
+	}
+
+	s.backend.uploader.NotifyUploadQueued()
+	s.DebugLog("sent copy saved", "mailbox", mailbox.Name, "uid", uid)
+	return nil
+}
+
+func (s *SubmissionSession) Reset() {
+	acquired, release := s.mutexHelper.AcquireWriteLockWithTimeout()
+	if !acquired {
+		s.WarnLog("failed to acquire write lock", "command", "RSET")
+		return
+	}
+	defer release()
+
+	// Authentication survives RSET (RFC 4954 section 4)
+	s.sender = nil
+	s.recipients = nil
+}
+
+func (s *SubmissionSession) Logout() error {
+	acquired, release := s.mutexHelper.AcquireWriteLockWithTimeout()
+	if !acquired {
+		s.WarnLog("failed to acquire write lock", "command", "LOGOUT")
+	} else {
+		defer release()
+	}
+
+	metrics.ConnectionDuration.WithLabelValues("submission", s.backend.name, s.backend.hostname).Observe(time.Since(s.startTime).Seconds())
+
+	activeCount := s.backend.activeConnections.Add(-1)
+	metrics.ConnectionsCurrent.WithLabelValues("submission", s.backend.name, s.backend.hostname).Dec()
+
+	if s.authenticated {
+		s.authenticated = false
+		s.backend.authenticatedConnections.Add(-1)
+		metrics.AuthenticatedConnectionsCurrent.WithLabelValues("submission", s.backend.name, s.backend.hostname).Dec()
+	}
+
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	s.DebugLog("session logout completed", "active_count", activeCount)
+
+	return &smtp.SMTPError{
+		Code:         221,
+		EnhancedCode: smtp.EnhancedCode{2, 0, 0},
+		Message:      "Closing transmission channel",
+	}
+}
+
+// XCLIENT implements smtp.XCLIENTBackend. go-smtp only calls it for
+// connections from XCLIENTTrustedNets and resets the session afterwards;
+// the attributes are applied in NewSession.
+func (s *SubmissionSession) XCLIENT(session smtp.Session, attrs map[string]string) error {
+	s.DebugLog("xclient command received", "attributes", attrs)
+	return nil
+}
+
+func (s *SubmissionSession) InternalError(format string, a ...any) error {
+	errorMsg := fmt.Sprintf(format, a...)
+	s.InfoLog("internal error", "message", errorMsg)
+	return &smtp.SMTPError{
+		Code:         421,
+		EnhancedCode: smtp.EnhancedCode{4, 4, 2},
+		Message:      errorMsg,
+	}
+}
@@ -0,0 +1,725 @@
+package submissionproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/migadu/sora/logger"
+
+	"github.com/migadu/sora/cluster"
+	"github.com/migadu/sora/config"
+	"github.com/migadu/sora/pkg/lookupcache"
+	"github.com/migadu/sora/pkg/metrics"
+	"github.com/migadu/sora/pkg/resilient"
+	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/proxy"
+)
+
+// Server represents a mail submission proxy server.
+//
+// Clients authenticate against the proxy, which resolves the backend for the
+// account and then authenticates to it with the master SASL credentials on
+// behalf of the user. After that the connection is piped transparently.
+type Server struct {
+	listener               net.Listener
+	listenerMu             sync.RWMutex
+	rdb                    *resilient.ResilientDatabase
+	name                   string // Server name for logging
+	addr                   string
+	hostname               string
+	connManager            *proxy.ConnectionManager
+	connTracker            *server.ConnectionTracker
+	tls                    bool
+	tlsUseStartTLS         bool
+	tlsConfig              *tls.Config // Global TLS config from TLS manager or per-server config
+	masterUsername         string
+	masterPassword         string
+	masterSASLUsername     string
+	masterSASLPassword     string
+	enableAffinity         bool
+	wg                     sync.WaitGroup
+	ctx                    context.Context
+	cancel                 context.CancelFunc
+	authLimiter            server.AuthLimiter
+	remotelookupConfig     *config.RemoteLookupConfig
+	remoteUseXCLIENT       bool          // Whether backend supports XCLIENT command for forwarding
+	authIdleTimeout        time.Duration // Idle timeout between commands before authentication
+	commandTimeout         time.Duration // Idle timeout
+	absoluteSessionTimeout time.Duration // Maximum total session duration
+	minBytesPerMinute      int64         // Minimum throughput
+	maxMessageSize         int64
+
+	// Connection limiting
+	limiter *server.ConnectionLimiter
+
+	// Auth cache for routing and password validation
+	lookupCache                *lookupcache.LookupCache
+	positiveRevalidationWindow time.Duration
+
+	// Listen backlog
+	listenBacklog int
+
+	// Auth security
+	insecureAuth bool
+
+	// Debug logging
+	debug bool
+
+	// Authentication limits
+	maxAuthErrors int // Maximum authentication errors before disconnection
+
+	// Active session tracking for graceful shutdown
+	activeSessionsMu sync.RWMutex
+	activeSessions   map[*Session]struct{}
+
+	// PROXY protocol support for incoming connections
+	proxyReader *server.ProxyProtocolReader
+
+	// Startup throttle to prevent thundering herd on restart
+	startupThrottleUntil time.Time
+}
+
+// ServerOptions holds options for creating a new submission proxy server.
+type ServerOptions struct {
+	Name                     string // Server name for logging
+	Addr                     string
+	RemoteAddrs              []string
+	RemotePort               int // Default port for backends if not in address
+	InsecureAuth             bool
+	TLS                      bool
+	TLSUseStartTLS           bool // Use STARTTLS on listening port (587) instead of implicit TLS (465)
+	TLSCertFile              string
+	TLSKeyFile               string
+	TLSVerify                bool
+	TLSConfig                *tls.Config // Global TLS config from TLS manager (optional)
+	RemoteTLS                bool
+	RemoteTLSUseStartTLS     bool // Use STARTTLS for backend connections
+	RemoteTLSVerify          bool
+	RemoteUseProxyProtocol   bool
+	RemoteUseXCLIENT         bool // Whether backend supports XCLIENT command for forwarding
+	MasterUsername           string
+	MasterPassword           string
+	MasterSASLUsername       string
+	MasterSASLPassword       string
+	ConnectTimeout           time.Duration
+	AuthIdleTimeout          time.Duration
+	CommandTimeout           time.Duration // Idle timeout
+	AbsoluteSessionTimeout   time.Duration // Maximum total session duration
+	MinBytesPerMinute        int64         // Minimum throughput
+	MaxMessageSize           int64
+	EnableAffinity           bool
+	EnableBackendHealthCheck bool // Enable backend health checking (default: true)
+	AuthRateLimit            server.AuthRateLimiterConfig
+	RemoteLookup             *config.RemoteLookupConfig
+	TrustedProxies           []string // CIDR blocks for trusted proxies that can forward parameters
+
+	// PROXY protocol for incoming connections (from HAProxy, nginx, etc.)
+	ProxyProtocol        bool   // Enable PROXY protocol support for incoming connections
+	ProxyProtocolTimeout string // Timeout for reading PROXY protocol headers (e.g., "5s")
+
+	// Connection limiting
+	MaxConnections      int      // Maximum total connections per instance (0 = unlimited, local only)
+	MaxConnectionsPerIP int      // Maximum connections per client IP (0 = unlimited, cluster-wide if ClusterManager provided)
+	TrustedNetworks     []string // CIDR blocks for trusted networks that bypass per-IP limits
+	ListenBacklog       int      // TCP listen backlog size (0 = system default; recommended: 4096-8192)
+
+	// Auth cache configuration
+	LookupCache *config.LookupCacheConfig
+
+	// Authentication limits
+	MaxAuthErrors int // Maximum authentication errors before disconnection (0 = use default)
+
+	// Cluster support
+	ClusterManager *cluster.Manager // Optional: enables cluster-wide per-IP limiting
+
+	// Debug logging
+	Debug bool
+}
+
+// New creates a new submission proxy server.
+func New(appCtx context.Context, rdb *resilient.ResilientDatabase, hostname string, opts ServerOptions) (*Server, error) {
+	ctx, cancel := context.WithCancel(appCtx)
+
+	if len(opts.RemoteAddrs) == 0 && (opts.RemoteLookup == nil || !opts.RemoteLookup.Enabled) {
+		cancel()
+		return nil, fmt.Errorf("no remote addresses configured")
+	}
+
+	// Set default timeout if not specified
+	connectTimeout := opts.ConnectTimeout
+	if connectTimeout == 0 {
+		connectTimeout = 10 * time.Second
+	}
+
+	// Ensure RemoteLookup config has a default value to avoid nil panics.
+	if opts.RemoteLookup == nil {
+		opts.RemoteLookup = &config.RemoteLookupConfig{}
+	}
+
+	// Initialize remotelookup client if configured
+	var routingLookup proxy.UserRoutingLookup
+	if opts.RemoteLookup.Enabled {
+		remotelookupClient, err := proxy.InitializeRemoteLookup("submission", opts.RemoteLookup)
+		if err != nil {
+			logger.Debug("Submission Proxy: Failed to initialize remotelookup client", "proxy", opts.Name, "error", err)
+			if !opts.RemoteLookup.ShouldLookupLocalUsers() {
+				cancel()
+				return nil, fmt.Errorf("failed to initialize remotelookup client: %w", err)
+			}
+			logger.Debug("Submission Proxy: Continuing without remotelookup due to lookup_local_users=true", "proxy", opts.Name)
+		} else {
+			routingLookup = remotelookupClient
+		}
+	}
+
+	// Create connection manager with routing
+	connManager, err := proxy.NewConnectionManagerWithRoutingAndStartTLSAndHealthCheck(opts.RemoteAddrs, opts.RemotePort, opts.RemoteTLS, opts.RemoteTLSUseStartTLS, opts.RemoteTLSVerify, opts.RemoteUseProxyProtocol, connectTimeout, routingLookup, opts.Name, !opts.EnableBackendHealthCheck)
+	if err != nil {
+		if routingLookup != nil {
+			routingLookup.Close()
+		}
+		cancel()
+		return nil, fmt.Errorf("failed to create connection manager: %w", err)
+	}
+
+	// Resolve addresses to expand hostnames to IPs
+	if err := connManager.ResolveAddresses(); err != nil {
+		logger.Debug("Submission Proxy: Failed to resolve addresses", "proxy", opts.Name, "error", err)
+	}
+
+	// Initialize authentication rate limiter with trusted networks
+	authLimiter := server.NewAuthRateLimiterWithTrustedNetworks("SUBMISSION-PROXY", opts.Name, hostname, opts.AuthRateLimit, opts.TrustedProxies)
+	server.RegisterRateLimiter("submission_proxy", opts.Name, authLimiter)
+
+	// Initialize connection limiter with trusted networks
+	var limiter *server.ConnectionLimiter
+	if opts.MaxConnections > 0 || opts.MaxConnectionsPerIP > 0 {
+		if opts.ClusterManager != nil {
+			// Cluster mode: use cluster-wide per-IP limiting
+			instanceID := fmt.Sprintf("submission-proxy-%s-%d", hostname, time.Now().UnixNano())
+			limiter = server.NewConnectionLimiterWithCluster("SUBMISSION-PROXY", instanceID, opts.ClusterManager, opts.MaxConnections, opts.MaxConnectionsPerIP, opts.TrustedNetworks)
+		} else {
+			// Local mode: use local-only limiting
+			limiter = server.NewConnectionLimiterWithTrustedNets("SUBMISSION-PROXY", opts.MaxConnections, opts.MaxConnectionsPerIP, opts.TrustedNetworks)
+		}
+	}
+
+	// Set listen backlog with reasonable default
+	listenBacklog := opts.ListenBacklog
+	if listenBacklog == 0 {
+		listenBacklog = 1024 // Default backlog
+	}
+
+	// Initialize PROXY protocol reader if enabled
+	var proxyReader *server.ProxyProtocolReader
+	if opts.ProxyProtocol {
+		proxyConfig := server.ProxyProtocolConfig{
+			Enabled:        true,
+			Timeout:        opts.ProxyProtocolTimeout,
+			TrustedProxies: opts.TrustedNetworks, // Proxies always use trusted_networks
+		}
+		proxyReader, err = server.NewProxyProtocolReader("SUBMISSION-PROXY", proxyConfig)
+		if err != nil {
+			if routingLookup != nil {
+				routingLookup.Close()
+			}
+			cancel()
+			return nil, fmt.Errorf("failed to create PROXY protocol reader: %w", err)
+		}
+		logger.Info("PROXY protocol enabled for incoming connections", "proxy", opts.Name)
+	}
+
+	// Initialize authentication cache from config
+	// Apply defaults if not configured (enabled by default for performance)
+	var lookupCache *lookupcache.LookupCache
+	var positiveRevalidationWindow time.Duration
+	lookupCacheConfig := opts.LookupCache
+	if lookupCacheConfig == nil {
+		defaultConfig := config.DefaultLookupCacheConfig()
+		lookupCacheConfig = &defaultConfig
+	}
+
+	if lookupCacheConfig.Enabled {
+		positiveTTL, err := lookupCacheConfig.GetPositiveTTL()
+		if err != nil {
+			logger.Info("Submission Proxy: Invalid positive TTL in auth cache config, using default (5m)", "name", opts.Name, "error", err)
+			positiveTTL = 5 * time.Minute
+		}
+		negativeTTL, err := lookupCacheConfig.GetNegativeTTL()
+		if err != nil {
+			logger.Info("Submission Proxy: Invalid negative TTL in auth cache config, using default (1m)", "name", opts.Name, "error", err)
+			negativeTTL = 1 * time.Minute
+		}
+		cleanupInterval, err := lookupCacheConfig.GetCleanupInterval()
+		if err != nil {
+			logger.Info("Submission Proxy: Invalid cleanup interval in auth cache config, using default (5m)", "name", opts.Name, "error", err)
+			cleanupInterval = 5 * time.Minute
+		}
+		maxSize := lookupCacheConfig.MaxSize
+		if maxSize <= 0 {
+			maxSize = 10000
+		}
+		positiveRevalidationWindow, err = lookupCacheConfig.GetPositiveRevalidationWindow()
+		if err != nil {
+			logger.Info("Submission Proxy: Invalid positive revalidation window in auth cache config, using default (30s)", "name", opts.Name, "error", err)
+			positiveRevalidationWindow = 30 * time.Second
+		}
+
+		lookupCache = lookupcache.New(positiveTTL, negativeTTL, maxSize, cleanupInterval, positiveRevalidationWindow)
+		logger.Info("Submission Proxy: Lookup cache enabled", "name", opts.Name, "positive_ttl", positiveTTL, "negative_ttl", negativeTTL, "max_size", maxSize, "positive_revalidation_window", positiveRevalidationWindow)
+	} else {
+		logger.Info("Submission Proxy: Lookup cache disabled", "name", opts.Name)
+	}
+
+	maxAuthErrors := opts.MaxAuthErrors
+	if maxAuthErrors <= 0 {
+		maxAuthErrors = 2
+	}
+
+	s := &Server{
+		rdb:                        rdb,
+		name:                       opts.Name,
+		addr:                       opts.Addr,
+		hostname:                   hostname,
+		connManager:                connManager,
+		tls:                        opts.TLS,
+		tlsUseStartTLS:             opts.TLSUseStartTLS,
+		masterUsername:             opts.MasterUsername,
+		masterPassword:             opts.MasterPassword,
+		masterSASLUsername:         opts.MasterSASLUsername,
+		masterSASLPassword:         opts.MasterSASLPassword,
+		enableAffinity:             opts.EnableAffinity,
+		ctx:                        ctx,
+		cancel:                     cancel,
+		authLimiter:                authLimiter,
+		remotelookupConfig:         opts.RemoteLookup,
+		remoteUseXCLIENT:           opts.RemoteUseXCLIENT,
+		authIdleTimeout:            opts.AuthIdleTimeout,
+		commandTimeout:             opts.CommandTimeout,
+		absoluteSessionTimeout:     opts.AbsoluteSessionTimeout,
+		minBytesPerMinute:          opts.MinBytesPerMinute,
+		maxMessageSize:             opts.MaxMessageSize,
+		limiter:                    limiter,
+		lookupCache:                lookupCache,
+		positiveRevalidationWindow: positiveRevalidationWindow,
+		listenBacklog:              listenBacklog,
+		insecureAuth:               opts.InsecureAuth || !opts.TLS, // Auto-enable when TLS not configured
+		debug:                      opts.Debug,
+		maxAuthErrors:              maxAuthErrors,
+		activeSessions:             make(map[*Session]struct{}),
+		proxyReader:                proxyReader,
+	}
+
+	// Setup TLS config: Support both implicit TLS and STARTTLS
+	// 1. Per-server TLS: cert files provided
+	// 2. Global TLS: opts.TLS=true, no cert files, global TLS config provided
+	// 3. No TLS: opts.TLS=false
+	if opts.TLS && opts.TLSCertFile != "" && opts.TLSKeyFile != "" {
+		// Scenario 1: Per-server TLS with explicit cert files
+		cert, err := tls.LoadX509KeyPair(opts.TLSCertFile, opts.TLSKeyFile)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		clientAuth := tls.NoClientCert
+		if opts.TLSVerify {
+			clientAuth = tls.RequireAndVerifyClientCert
+		}
+
+		s.tlsConfig = &tls.Config{
+			Certificates:             []tls.Certificate{cert},
+			MinVersion:               tls.VersionTLS12,
+			ClientAuth:               clientAuth,
+			ServerName:               hostname,
+			PreferServerCipherSuites: true,
+			NextProtos:               []string{"smtp"},
+			Renegotiation:            tls.RenegotiateNever,
+		}
+	} else if opts.TLS && opts.TLSConfig != nil {
+		// Scenario 2: Global TLS manager (works for both implicit TLS and STARTTLS)
+		s.tlsConfig = opts.TLSConfig
+	} else if opts.TLS {
+		// TLS enabled but no cert files and no global TLS config provided
+		cancel()
+		return nil, fmt.Errorf("TLS enabled for submission proxy [%s] but no tls_cert_file/tls_key_file provided and no global TLS manager configured", opts.Name)
+	}
+
+	return s, nil
+}
+
+// Start starts the submission proxy server.
+func (s *Server) Start() error {
+	// Configure SoraConn with timeout protection
+	connConfig := server.SoraConnConfig{
+		Protocol:             "submission_proxy",
+		ServerName:           s.name,
+		Hostname:             s.hostname,
+		IdleTimeout:          s.commandTimeout,
+		AbsoluteTimeout:      s.absoluteSessionTimeout,
+		MinBytesPerMinute:    s.minBytesPerMinute,
+		EnableTimeoutChecker: s.commandTimeout > 0 || s.absoluteSessionTimeout > 0,
+		OnTimeout: func(conn net.Conn, reason string) {
+			var message string
+			switch reason {
+			case "idle":
+				message = "421 4.4.2 Idle timeout, closing connection\r\n"
+			case "slow_throughput":
+				message = "421 4.4.2 Connection too slow, closing connection\r\n"
+			case "session_max":
+				message = "421 4.4.2 Maximum session duration exceeded, closing connection\r\n"
+			default:
+				message = "421 4.4.2 Connection timeout, closing connection\r\n"
+			}
+			_, _ = fmt.Fprint(conn, message)
+		},
+	}
+
+	// Create base TCP listener with custom backlog
+	tcpListener, err := server.ListenWithBacklog(context.Background(), "tcp", s.addr, s.listenBacklog)
+	if err != nil {
+		s.cancel()
+		return fmt.Errorf("failed to start TCP listener: %w", err)
+	}
+	logger.Debug("Submission Proxy: Using listen backlog", "proxy", s.name, "backlog", s.listenBacklog)
+
+	s.listenerMu.Lock()
+	if s.tlsConfig != nil && !s.tlsUseStartTLS {
+		// Implicit TLS (port 465): Use SoraTLSListener with JA4 capture and timeout protection
+		s.listener = server.NewSoraTLSListener(tcpListener, s.tlsConfig, connConfig)
+	} else {
+		// STARTTLS (port 587) or no TLS: plain listener, TLS upgrade happens in session
+		s.listener = server.NewSoraListener(tcpListener, connConfig)
+	}
+	s.listenerMu.Unlock()
+
+	// Start connection limiter cleanup if enabled
+	if s.limiter != nil {
+		s.limiter.StartCleanup(s.ctx)
+	}
+
+	// Startup throttle: spread reconnection load after proxy restart
+	// to prevent thundering herd on the database connection pool
+	s.startupThrottleUntil = time.Now().Add(30 * time.Second)
+	logger.Info("Submission Proxy: Startup throttle active for 30s (5ms delay between accepts)", "proxy", s.name)
+
+	// Start session monitoring routine
+	go s.monitorActiveSessions()
+
+	return s.acceptConnections()
+}
+
+// acceptConnections accepts incoming connections.
+func (s *Server) acceptConnections() error {
+	for {
+		// Startup throttle: spread reconnection load after proxy restart
+		// to prevent thundering herd on the database connection pool
+		if time.Now().Before(s.startupThrottleUntil) {
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.ctx.Done():
+				return nil // Graceful shutdown
+			default:
+				// All Accept() errors are connection-level issues (TLS handshake failures, client disconnects, etc.)
+				logger.Debug("Submission Proxy: Failed to accept connection", "proxy", s.name, "error", err)
+				continue
+			}
+		}
+
+		// Check connection limits before processing
+		var releaseConn func()
+		if s.limiter != nil {
+			releaseConn, err = s.limiter.AcceptWithRealIP(conn.RemoteAddr(), "")
+			if err != nil {
+				logger.Debug("Submission Proxy: Connection rejected", "proxy", s.name, "error", err)
+				conn.Close()
+				continue
+			}
+		}
+
+		// Read PROXY protocol header if enabled
+		var proxyInfo *server.ProxyProtocolInfo
+		if s.proxyReader != nil {
+			var wrappedConn net.Conn
+			proxyInfo, wrappedConn, err = s.proxyReader.ReadProxyHeader(conn)
+			if err != nil {
+				logger.Error("PROXY protocol error", "proxy", s.name, "remote", server.GetAddrString(conn.RemoteAddr()), "error", err)
+				conn.Close()
+				if releaseConn != nil {
+					releaseConn()
+				}
+				continue
+			}
+			conn = wrappedConn // Use wrapped connection that has buffered reader
+		}
+
+		// Track proxy connection
+		metrics.ConnectionsTotal.WithLabelValues("submission_proxy", s.name, s.hostname).Inc()
+		metrics.ConnectionsCurrent.WithLabelValues("submission_proxy", s.name, s.hostname).Inc()
+
+		session := newSession(s, conn, proxyInfo)
+		session.releaseConn = releaseConn
+		s.registerSession(session)
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+
+			// CRITICAL: Panic recovery MUST clean up metrics and limiter
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Debug("Submission Proxy: Session panic recovered", "proxy", s.name, "panic", r)
+					s.unregisterSession(session)
+					metrics.ConnectionsCurrent.WithLabelValues("submission_proxy", s.name, s.hostname).Dec()
+					conn.Close()
+					if releaseConn != nil {
+						releaseConn()
+					}
+				}
+			}()
+
+			// Note: releaseConn is called in session.close(), which is deferred in handleConnection()
+			session.handleConnection()
+		}()
+	}
+}
+
+// SetConnectionTracker sets the connection tracker for the server.
+func (s *Server) SetConnectionTracker(tracker *server.ConnectionTracker) {
+	s.connTracker = tracker
+	// Enable cache invalidation on kick events if lookup cache is available
+	if tracker != nil && s.lookupCache != nil {
+		tracker.SetLookupCache(s.lookupCache)
+	}
+	// Drop cached credentials of kicked users (e.g. on account suspension)
+	if tracker != nil && s.rdb != nil {
+		tracker.SetAuthCache(s.rdb)
+	}
+}
+
+// GetConnectionTracker returns the connection tracker for the server.
+func (s *Server) GetConnectionTracker() *server.ConnectionTracker {
+	return s.connTracker
+}
+
+// GetConnectionManager returns the connection manager for health checks
+func (s *Server) GetConnectionManager() *proxy.ConnectionManager {
+	return s.connManager
+}
+
+// GetLimiter returns the connection limiter for testing purposes
+func (s *Server) GetLimiter() *server.ConnectionLimiter {
+	return s.limiter
+}
+
+// Addr returns the server's listening address
+func (s *Server) Addr() string {
+	s.listenerMu.RLock()
+	defer s.listenerMu.RUnlock()
+	if s.listener != nil {
+		return s.listener.Addr().String()
+	}
+	return s.addr
+}
+
+// registerSession adds a session to the active sessions map for graceful shutdown tracking
+func (s *Server) registerSession(session *Session) {
+	s.activeSessionsMu.Lock()
+	defer s.activeSessionsMu.Unlock()
+	s.activeSessions[session] = struct{}{}
+}
+
+// unregisterSession removes a session from the active sessions map
+func (s *Server) unregisterSession(session *Session) {
+	s.activeSessionsMu.Lock()
+	defer s.activeSessionsMu.Unlock()
+	delete(s.activeSessions, session)
+}
+
+// sendGracefulShutdownMessage sends a shutdown message to all active client connections
+func (s *Server) sendGracefulShutdownMessage() {
+	s.activeSessionsMu.RLock()
+	activeSessions := make([]*Session, 0, len(s.activeSessions))
+	for session := range s.activeSessions {
+		activeSessions = append(activeSessions, session)
+	}
+	s.activeSessionsMu.RUnlock()
+
+	if len(activeSessions) == 0 {
+		return
+	}
+
+	logger.Info("Sending graceful shutdown messages to submission sessions", "name", s.name, "count", len(activeSessions))
+
+	// Step 1: Set gracefulShutdown flag on all sessions.
+	for _, session := range activeSessions {
+		session.mu.Lock()
+		session.gracefulShutdown = true
+		session.mu.Unlock()
+	}
+
+	// Step 2: Write 421 shutdown message directly to clientConn.
+	for _, session := range activeSessions {
+		session.mu.Lock()
+		if session.clientConn != nil {
+			_, _ = fmt.Fprint(session.clientConn, "421 4.3.2 Service shutting down, please try again later\r\n")
+		}
+		session.mu.Unlock()
+	}
+
+	// Step 3: Give clients a moment to process the message before closing.
+	time.Sleep(1 * time.Second)
+
+	// Step 4: Close all connections.
+	for _, session := range activeSessions {
+		session.mu.Lock()
+		if session.backendConn != nil {
+			session.backendConn.Close()
+		}
+		if session.clientConn != nil {
+			session.clientConn.Close()
+		}
+		session.mu.Unlock()
+	}
+
+	logger.Debug("Submission Proxy: Proceeding with connection cleanup", "name", s.name)
+}
+
+// ReloadConfig updates runtime-configurable settings from new config.
+// Called on SIGHUP. Only affects new connections; existing sessions keep old settings.
+func (s *Server) ReloadConfig(cfg config.ServerConfig) error {
+	var reloaded []string
+
+	if newVal := cfg.GetMaxAuthErrors(); newVal != s.maxAuthErrors {
+		s.maxAuthErrors = newVal
+		reloaded = append(reloaded, "max_auth_errors")
+	}
+	if timeout := cfg.GetAuthIdleTimeoutWithDefault(); timeout != s.authIdleTimeout {
+		s.authIdleTimeout = timeout
+		reloaded = append(reloaded, "auth_idle_timeout")
+	}
+	if timeout, err := cfg.GetCommandTimeout(); err == nil && timeout != s.commandTimeout {
+		s.commandTimeout = timeout
+		reloaded = append(reloaded, "command_timeout")
+	}
+	if timeout, err := cfg.GetAbsoluteSessionTimeout(); err == nil && timeout != s.absoluteSessionTimeout {
+		s.absoluteSessionTimeout = timeout
+		reloaded = append(reloaded, "absolute_session_timeout")
+	}
+	if bpm := cfg.GetMinBytesPerMinute(); bpm != s.minBytesPerMinute {
+		s.minBytesPerMinute = bpm
+		reloaded = append(reloaded, "min_bytes_per_minute")
+	}
+	if maxSize := cfg.GetMaxMessageSizeWithDefault(); maxSize != s.maxMessageSize {
+		s.maxMessageSize = maxSize
+		reloaded = append(reloaded, "max_message_size")
+	}
+	if cfg.MasterSASLUsername != s.masterSASLUsername {
+		s.masterSASLUsername = cfg.MasterSASLUsername
+		reloaded = append(reloaded, "master_sasl_username")
+	}
+	if cfg.MasterSASLPassword != s.masterSASLPassword {
+		s.masterSASLPassword = cfg.MasterSASLPassword
+		reloaded = append(reloaded, "master_sasl_password")
+	}
+	if cfg.Debug != s.debug {
+		s.debug = cfg.Debug
+		reloaded = append(reloaded, "debug")
+	}
+
+	if len(reloaded) > 0 {
+		logger.Info("Submission proxy config reloaded", "name", s.name, "updated", reloaded)
+	}
+	return nil
+}
+
+// Stop stops the submission proxy server.
+func (s *Server) Stop() error {
+	logger.Info("Stopping submission proxy server", "name", s.name)
+
+	// Unregister rate limiter from global registry
+	server.UnregisterRateLimiter("submission_proxy", s.name)
+
+	// Stop connection tracker first to prevent it from trying to access closed database
+	if s.connTracker != nil {
+		s.connTracker.Stop()
+	}
+
+	// Send graceful shutdown messages to all active sessions
+	s.sendGracefulShutdownMessage()
+
+	s.cancel()
+
+	s.listenerMu.RLock()
+	listener := s.listener
+	s.listenerMu.RUnlock()
+
+	if listener != nil {
+		listener.Close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logger.Debug("Submission Proxy: Server stopped gracefully", "name", s.name)
+	case <-time.After(30 * time.Second):
+		logger.Debug("Submission Proxy: Server stop timeout", "name", s.name)
+	}
+
+	// Close remotelookup client if it exists
+	if s.connManager != nil {
+		if routingLookup := s.connManager.GetRoutingLookup(); routingLookup != nil {
+			if err := routingLookup.Close(); err != nil {
+				logger.Debug("Submission Proxy: Error closing remotelookup client", "name", s.name, "error", err)
+			}
+		}
+	}
+
+	// Stop auth cache
+	if s.lookupCache != nil {
+		stopCtx, stopCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer stopCancel()
+		if err := s.lookupCache.Stop(stopCtx); err != nil {
+			logger.Error("Error stopping auth cache", "proxy", s.name, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// monitorActiveSessions periodically logs active session count for monitoring
+func (s *Server) monitorActiveSessions() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.activeSessionsMu.RLock()
+			count := len(s.activeSessions)
+			s.activeSessionsMu.RUnlock()
+
+			if s.limiter != nil {
+				stats := s.limiter.GetStats()
+				logger.Info("Submission proxy active sessions", "proxy", s.name, "active_sessions", count, "limiter_total", stats.TotalConnections, "limiter_max", stats.MaxConnections)
+			} else {
+				logger.Info("Submission proxy active sessions", "proxy", s.name, "active_sessions", count)
+			}
+
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,1099 @@
+package submissionproxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/pkg/events"
+	"github.com/migadu/sora/pkg/lookupcache"
+	"github.com/migadu/sora/pkg/metrics"
+	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/proxy"
+)
+
+// Session represents a single client connection to the submission proxy.
+type Session struct {
+	server                *Server
+	clientConn            net.Conn
+	clientReader          *bufio.Reader
+	clientWriter          *bufio.Writer
+	backendConn           net.Conn
+	backendReader         *bufio.Reader
+	backendWriter         *bufio.Writer
+	ctx                   context.Context
+	cancel                context.CancelFunc
+	mu                    sync.Mutex
+	RemoteIP              string
+	helo                  string
+	username              string
+	accountID             int64
+	isRemoteLookupAccount bool
+	routingInfo           *proxy.UserRoutingInfo
+	routingMethod         string // Routing method used: remotelookup, affinity, consistent_hash, roundrobin
+	serverAddr            string
+	errorCount            int
+	startTime             time.Time
+	releaseConn           func() // Connection limiter cleanup function
+	proxyInfo             *server.ProxyProtocolInfo
+	gracefulShutdown      bool // Set during server shutdown to prevent copy goroutine from closing clientConn
+}
+
+func newSession(s *Server, conn net.Conn, proxyInfo *server.ProxyProtocolInfo) *Session {
+	sessionCtx, sessionCancel := context.WithCancel(s.ctx)
+
+	// Use real client IP from PROXY protocol if available
+	remoteIP := server.GetAddrString(conn.RemoteAddr())
+	if proxyInfo != nil && proxyInfo.SrcIP != "" {
+		remoteIP = proxyInfo.SrcIP
+	}
+
+	return &Session{
+		server:       s,
+		clientConn:   conn,
+		clientReader: bufio.NewReader(conn),
+		clientWriter: bufio.NewWriter(conn),
+		RemoteIP:     remoteIP,
+		ctx:          sessionCtx,
+		cancel:       sessionCancel,
+		startTime:    time.Now(),
+		proxyInfo:    proxyInfo,
+	}
+}
+
+// handleConnection runs the pre-authentication command loop. Once the client
+// has authenticated the session switches to transparent proxying.
+func (s *Session) handleConnection() {
+	defer s.cancel()
+	defer s.close()
+
+	// Ensure connections are closed when context is cancelled (e.g. by absolute timeout or server shutdown)
+	go func() {
+		<-s.ctx.Done()
+		s.mu.Lock()
+		if s.clientConn != nil {
+			s.clientConn.Close()
+		}
+		s.mu.Unlock()
+	}()
+
+	// Enforce absolute session timeout to prevent hung sessions from leaking
+	if s.server.absoluteSessionTimeout > 0 {
+		timeout := time.AfterFunc(s.server.absoluteSessionTimeout, func() {
+			s.InfoLog("Absolute session timeout reached - force closing", "duration", s.server.absoluteSessionTimeout)
+			s.cancel()
+		})
+		defer timeout.Stop()
+	}
+
+	s.InfoLog("connected")
+
+	// Perform TLS handshake if this is a TLS connection
+	if tlsConn, ok := s.clientConn.(interface{ PerformHandshake() error }); ok {
+		if err := tlsConn.PerformHandshake(); err != nil {
+			s.DebugLog("TLS handshake failed", "error", err)
+			return
+		}
+	}
+
+	if err := s.sendResponse(fmt.Sprintf("220 %s ESMTP Service Ready", s.server.hostname)); err != nil {
+		s.DebugLog("Failed to send greeting", "error", err)
+		return
+	}
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			s.sendResponse("421 4.3.2 Service closing connection")
+			return
+		default:
+		}
+
+		// Set a read deadline for the client command to prevent idle connections.
+		if s.server.authIdleTimeout > 0 {
+			if err := s.clientConn.SetReadDeadline(time.Now().Add(s.server.authIdleTimeout)); err != nil {
+				s.DebugLog("Failed to set read deadline", "error", err)
+				return
+			}
+		}
+
+		line, err := s.clientReader.ReadString('\n')
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				s.DebugLog("Client timed out waiting for command")
+				s.sendResponse("421 4.4.2 Idle timeout, closing connection")
+				return
+			}
+			if !isClosingError(err) {
+				s.DebugLog("Error reading from client", "error", err)
+			}
+			return
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
+			continue
+		}
+		command := strings.ToUpper(parts[0])
+		if command == "AUTH" {
+			s.DebugLog("Client command", "line", "AUTH ***")
+		} else {
+			s.DebugLog("Client command", "line", line)
+		}
+
+		switch command {
+		case "EHLO", "HELO":
+			if len(parts) < 2 {
+				s.sendResponse("501 5.5.4 Syntax error in parameters")
+				continue
+			}
+			s.helo = parts[1]
+			if command == "HELO" {
+				s.sendResponse(fmt.Sprintf("250 %s", s.server.hostname))
+				continue
+			}
+			s.sendResponse(fmt.Sprintf("250-%s", s.server.hostname))
+			s.sendResponse("250-PIPELINING")
+			s.sendResponse("250-8BITMIME")
+			if s.server.maxMessageSize > 0 {
+				s.sendResponse(fmt.Sprintf("250-SIZE %d", s.server.maxMessageSize))
+			}
+			if s.server.tlsConfig != nil && s.server.tlsUseStartTLS && !s.isConnectionSecure() {
+				s.sendResponse("250-STARTTLS")
+			}
+			if s.server.insecureAuth || s.isConnectionSecure() {
+				s.sendResponse("250-AUTH PLAIN LOGIN")
+			}
+			s.sendResponse("250 ENHANCEDSTATUSCODES")
+
+		case "STARTTLS":
+			if s.server.tlsConfig == nil || !s.server.tlsUseStartTLS {
+				s.sendResponse("502 5.5.1 STARTTLS not available")
+				continue
+			}
+			if s.isConnectionSecure() {
+				s.sendResponse("503 5.5.1 Already running in TLS")
+				continue
+			}
+			if err := s.sendResponse("220 2.0.0 Ready to start TLS"); err != nil {
+				return
+			}
+
+			tlsConn := tls.Server(s.clientConn, s.server.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				s.DebugLog("TLS handshake failed", "error", err)
+				return
+			}
+
+			s.mu.Lock()
+			s.clientConn = tlsConn
+			s.mu.Unlock()
+			s.clientReader = bufio.NewReader(tlsConn)
+			s.clientWriter = bufio.NewWriter(tlsConn)
+
+			// Client must send EHLO again after STARTTLS (RFC 3207)
+			s.helo = ""
+			s.DebugLog("STARTTLS negotiation successful")
+
+		case "AUTH":
+			if s.helo == "" {
+				s.sendResponse("503 5.5.1 Send EHLO first")
+				continue
+			}
+			if !s.server.insecureAuth && !s.isConnectionSecure() {
+				if s.handleAuthError("538 5.7.11 Encryption required for requested authentication mechanism") {
+					return
+				}
+				continue
+			}
+			if len(parts) < 2 {
+				s.sendResponse("501 5.5.4 Missing authentication mechanism")
+				continue
+			}
+
+			authStart := time.Now()
+			var initialResponse string
+			if len(parts) > 2 {
+				initialResponse = parts[2]
+			}
+
+			username, password, err := s.readCredentials(strings.ToUpper(parts[1]), initialResponse)
+			if err != nil {
+				var reply authReplyError
+				switch {
+				case errors.Is(err, errAuthCancelled):
+					s.sendResponse("501 5.0.0 Authentication cancelled")
+				case errors.As(err, &reply):
+					if s.handleAuthError(string(reply)) {
+						return
+					}
+				default:
+					s.DebugLog("Error reading SASL response", "error", err)
+					return
+				}
+				continue
+			}
+
+			if err := s.authenticate(username, password); err != nil {
+				var rateLimitErr *server.RateLimitError
+				if errors.As(err, &rateLimitErr) || server.IsTemporaryAuthFailure(err) {
+					s.sendResponse("454 4.7.0 Temporary authentication failure, please try again later")
+				} else if server.IsBackendError(err) {
+					s.WarnLog("Backend error during authentication", "error", err)
+					s.sendResponse("454 4.7.0 Backend server temporarily unavailable")
+				} else if s.handleAuthError("535 5.7.8 Authentication credentials invalid") {
+					return
+				}
+				s.DebugLog("Authentication failed", "error", err)
+				continue
+			}
+
+			if err := s.sendResponse("235 2.7.0 Authentication successful"); err != nil {
+				return
+			}
+
+			s.InfoLog("authentication complete",
+				"address", s.username,
+				"backend", s.serverAddr,
+				"routing", s.routingMethod,
+				"duration", fmt.Sprintf("%.3fs", time.Since(authStart).Seconds()))
+
+			// Clear the read deadline before moving to the proxying phase, which sets its own.
+			if s.server.authIdleTimeout > 0 {
+				if err := s.clientConn.SetReadDeadline(time.Time{}); err != nil {
+					s.WarnLog("Failed to clear read deadline", "error", err)
+				}
+			}
+
+			if err := s.registerConnection(); err != nil {
+				s.InfoLog("rejected connection registration", "error", err)
+			}
+
+			s.startProxying()
+			return
+
+		case "MAIL", "RCPT", "DATA", "BDAT":
+			s.sendResponse("530 5.7.0 Authentication required")
+
+		case "RSET", "NOOP":
+			s.sendResponse("250 2.0.0 OK")
+
+		case "QUIT":
+			s.sendResponse("221 2.0.0 Bye")
+			return
+
+		default:
+			s.sendResponse("502 5.5.2 Command not implemented")
+		}
+	}
+}
+
+var errAuthCancelled = errors.New("authentication cancelled")
+
+// authReplyError is a SASL exchange failure carrying the SMTP reply to send.
+type authReplyError string
+
+func (e authReplyError) Error() string { return string(e) }
+
+// readCredentials runs the SASL exchange for the PLAIN and LOGIN mechanisms
+// and returns the decoded credentials.
+func (s *Session) readCredentials(mechanism, initialResponse string) (string, string, error) {
+	switch mechanism {
+	case "PLAIN":
+		data := initialResponse
+		if data == "" {
+			var err error
+			if data, err = s.challenge(""); err != nil {
+				return "", "", err
+			}
+		}
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return "", "", authReplyError("501 5.5.2 Invalid base64 data")
+		}
+		// SASL PLAIN format: [authz-id] \0 authn-id \0 password
+		authParts := strings.Split(string(decoded), "\x00")
+		if len(authParts) != 3 {
+			return "", "", authReplyError("501 5.5.2 Invalid authentication format")
+		}
+		// Authorization identity is handled by master SASL on the backend
+		if authParts[0] != "" && authParts[0] != authParts[1] {
+			return "", "", authReplyError("535 5.7.8 Authorization identity not supported")
+		}
+		return authParts[1], authParts[2], nil
+
+	case "LOGIN":
+		var username string
+		if initialResponse != "" {
+			decoded, err := base64.StdEncoding.DecodeString(initialResponse)
+			if err != nil {
+				return "", "", authReplyError("501 5.5.2 Invalid base64 data")
+			}
+			username = string(decoded)
+		} else {
+			data, err := s.challenge("Username:")
+			if err != nil {
+				return "", "", err
+			}
+			decoded, err := base64.StdEncoding.DecodeString(data)
+			if err != nil {
+				return "", "", authReplyError("501 5.5.2 Invalid base64 data")
+			}
+			username = string(decoded)
+		}
+		data, err := s.challenge("Password:")
+		if err != nil {
+			return "", "", err
+		}
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return "", "", authReplyError("501 5.5.2 Invalid base64 data")
+		}
+		return username, string(decoded), nil
+
+	default:
+		return "", "", authReplyError("504 5.5.4 Unsupported authentication mechanism")
+	}
+}
+
+// challenge sends a 334 continuation and reads the client's response line.
+func (s *Session) challenge(prompt string) (string, error) {
+	if err := s.sendResponse("334 " + base64.StdEncoding.EncodeToString([]byte(prompt))); err != nil {
+		return "", err
+	}
+	line, err := s.clientReader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSpace(line)
+	if line == "*" {
+		return "", errAuthCancelled
+	}
+	return line, nil
+}
+
+// handleAuthError increments the error count, sends an error response, and
+// returns true if the connection should be dropped.
+func (s *Session) handleAuthError(response string) bool {
+	s.errorCount++
+	s.sendResponse(response)
+	if s.errorCount >= s.server.maxAuthErrors {
+		s.DebugLog("Too many authentication errors, dropping connection")
+		s.sendResponse("421 4.7.0 Too many errors, closing connection")
+		return true
+	}
+	return false
+}
+
+// sendResponse sends a response line to the client.
+func (s *Session) sendResponse(response string) error {
+	if _, err := s.clientWriter.WriteString(response + "\r\n"); err != nil {
+		return err
+	}
+	return s.clientWriter.Flush()
+}
+
+// getLogger returns a ProxySessionLogger for this session
+func (s *Session) getLogger() *server.ProxySessionLogger {
+	return &server.ProxySessionLogger{
+		Protocol:   "submission_proxy",
+		ServerName: s.server.name,
+		ClientConn: s.clientConn,
+		Username:   s.username,
+		AccountID:  s.accountID,
+		Debug:      s.server.debug,
+	}
+}
+
+// InfoLog logs at INFO level with session context
+func (s *Session) InfoLog(msg string, keyvals ...any) {
+	s.getLogger().InfoLog(msg, keyvals...)
+}
+
+// DebugLog logs at DEBUG level with session context
+func (s *Session) DebugLog(msg string, keyvals ...any) {
+	s.getLogger().DebugLog(msg, keyvals...)
+}
+
+// WarnLog logs at WARN level with session context
+func (s *Session) WarnLog(msg string, keyvals ...any) {
+	s.getLogger().WarnLog(msg, keyvals...)
+}
+
+func (s *Session) authenticate(username, password string) error {
+	// Empty passwords are never valid under any condition
+	if password == "" {
+		return consts.ErrAuthenticationFailed
+	}
+
+	authTimeout := s.server.connManager.GetRemoteLookupTimeout()
+	ctx, cancel := context.WithTimeout(s.ctx, authTimeout)
+	defer cancel()
+
+	// Apply progressive authentication delay BEFORE any other checks
+	server.ApplyAuthenticationDelay(ctx, s.server.authLimiter, s.clientConn.RemoteAddr(), "SUBMISSION-PROXY")
+
+	// Check cache first (before rate limiter to avoid delays for cached successful auth)
+	if s.server.lookupCache != nil {
+		if cached, found := s.server.lookupCache.Get(s.server.name, username); found {
+			passwordMatches := cached.PasswordHash != "" && cached.PasswordHash == lookupcache.HashPassword(password)
+
+			switch {
+			case cached.IsNegative && passwordMatches:
+				s.DebugLog("cache hit - negative entry with same password", "username", username, "age", time.Since(cached.CreatedAt))
+				metrics.CacheOperationsTotal.WithLabelValues("get", "hit_negative").Inc()
+				s.recordAuth(ctx, username, false)
+				return consts.ErrAuthenticationFailed
+
+			case !cached.IsNegative && passwordMatches:
+				s.DebugLog("cache hit - using cached auth", "username", username, "account_id", cached.AccountID, "backend", cached.ServerAddress, "age", time.Since(cached.CreatedAt))
+				metrics.CacheOperationsTotal.WithLabelValues("get", "hit").Inc()
+
+				s.accountID = cached.AccountID
+				s.isRemoteLookupAccount = cached.FromRemoteLookup
+				s.routingInfo = &proxy.UserRoutingInfo{
+					AccountID:              cached.AccountID,
+					ServerAddress:          cached.ServerAddress,
+					RemoteTLS:              cached.RemoteTLS,
+					RemoteTLSUseStartTLS:   cached.RemoteTLSUseStartTLS,
+					RemoteTLSVerify:        cached.RemoteTLSVerify,
+					RemoteUseProxyProtocol: cached.RemoteUseProxyProtocol,
+				}
+				s.username = username
+				if cached.ActualEmail != "" {
+					s.username = cached.ActualEmail
+				}
+				s.recordAuth(ctx, s.username, true)
+
+				if err := s.ctx.Err(); err != nil {
+					return server.ErrServerShuttingDown
+				}
+				if err := s.connectToBackend(); err != nil {
+					return fmt.Errorf("failed to connect to backend: %w", err)
+				}
+				s.InfoLog("authentication successful", "cached", true, "method", "cache")
+				return nil
+
+			case cached.IsNegative:
+				// Different password - always revalidate (user might have fixed their password)
+				metrics.CacheOperationsTotal.WithLabelValues("get", "revalidate_negative_different_pw").Inc()
+
+			case cached.IsOld(s.server.positiveRevalidationWindow):
+				// Different password on an older positive entry - revalidate
+				metrics.CacheOperationsTotal.WithLabelValues("get", "revalidate_positive_different_pw").Inc()
+
+			default:
+				// Entry is fresh - likely wrong password attempt
+				s.DebugLog("cache hit - wrong password on fresh positive entry", "username", username)
+				metrics.CacheOperationsTotal.WithLabelValues("get", "hit_positive_wrong_pw").Inc()
+				s.recordAuth(ctx, username, false)
+				return consts.ErrAuthenticationFailed
+			}
+		} else {
+			metrics.CacheOperationsTotal.WithLabelValues("get", "miss").Inc()
+		}
+	}
+
+	// Check if the authentication attempt is allowed by the rate limiter
+	if err := s.server.authLimiter.CanAttemptAuthWithProxy(ctx, s.clientConn, s.proxyInfo, username); err != nil {
+		metrics.ProtocolErrors.WithLabelValues("submission_proxy", "AUTH", "rate_limited", "client_error").Inc()
+		return err
+	}
+
+	// Parse username to check for master username or token suffix (user@domain.com@SUFFIX).
+	// A suffix matching the configured master username is validated locally and
+	// the base address is used for routing; any other suffix is treated as a token.
+	usernameForRemoteLookup := username
+	masterAuthValidated := false
+	parsedAddr, parseErr := server.NewAddress(username)
+	if parseErr == nil && parsedAddr.HasSuffix() && len(s.server.masterUsername) > 0 &&
+		checkMasterCredential(parsedAddr.Suffix(), []byte(s.server.masterUsername)) {
+		if !checkMasterCredential(password, []byte(s.server.masterPassword)) {
+			s.recordAuth(ctx, parsedAddr.BaseAddress(), false)
+			return consts.ErrAuthenticationFailed
+		}
+		usernameForRemoteLookup = parsedAddr.BaseAddress()
+		masterAuthValidated = true
+	}
+
+	if s.server.connManager.HasRouting() {
+		routingInfo, authResult, err := s.server.connManager.AuthenticateAndRouteWithOptions(ctx, usernameForRemoteLookup, password, masterAuthValidated)
+		if err != nil {
+			if errors.Is(err, proxy.ErrRemoteLookupInvalidResponse) {
+				s.WarnLog("remotelookup returned invalid response - server bug, rejecting authentication", "error", err)
+				s.recordAuth(ctx, username, false)
+				return fmt.Errorf("remotelookup server error: invalid response")
+			}
+			if errors.Is(err, proxy.ErrRemoteLookupTransient) {
+				if errors.Is(err, server.ErrServerShuttingDown) {
+					metrics.RemoteLookupResult.WithLabelValues("submission", "shutdown").Inc()
+					return server.ErrServerShuttingDown
+				}
+				// Transient error (network, 5xx, circuit breaker) - NEVER fallback to DB
+				s.WarnLog("remotelookup transient error - service unavailable", "error", err)
+				metrics.RemoteLookupResult.WithLabelValues("submission", "transient_error_rejected").Inc()
+				s.recordAuth(ctx, username, false)
+				return fmt.Errorf("%w: remotelookup service unavailable", server.ErrAuthServiceUnavailable)
+			}
+			// Unknown error type - fall through to main DB auth
+		} else {
+			switch authResult {
+			case proxy.AuthSuccess:
+				metrics.RemoteLookupResult.WithLabelValues("submission", "success").Inc()
+				s.accountID = routingInfo.AccountID
+				s.isRemoteLookupAccount = routingInfo.IsRemoteLookupAccount
+				s.routingInfo = routingInfo
+
+				resolvedEmail := username
+				if routingInfo.ActualEmail != "" {
+					resolvedEmail = routingInfo.ActualEmail
+				} else if masterAuthValidated {
+					resolvedEmail = usernameForRemoteLookup
+				}
+				s.username = resolvedEmail
+
+				// Cache key is the submitted username, but store ActualEmail so
+				// cache hits can use the resolved address
+				if s.server.lookupCache != nil {
+					s.server.lookupCache.Set(s.server.name, username, &lookupcache.CacheEntry{
+						AccountID:              routingInfo.AccountID,
+						PasswordHash:           lookupcache.HashPassword(password),
+						ActualEmail:            resolvedEmail,
+						ServerAddress:          routingInfo.ServerAddress,
+						RemoteTLS:              routingInfo.RemoteTLS,
+						RemoteTLSUseStartTLS:   routingInfo.RemoteTLSUseStartTLS,
+						RemoteTLSVerify:        routingInfo.RemoteTLSVerify,
+						RemoteUseProxyProtocol: routingInfo.RemoteUseProxyProtocol,
+						Result:                 lookupcache.AuthSuccess,
+						FromRemoteLookup:       true,
+					})
+				}
+
+				s.recordAuth(ctx, resolvedEmail, true)
+				method := "remotelookup"
+				if masterAuthValidated {
+					method = "master"
+				}
+				s.InfoLog("authentication successful", "cached", false, "method", method)
+
+				if err := s.connectToBackend(); err != nil {
+					return fmt.Errorf("failed to connect to backend: %w", err)
+				}
+				return nil
+
+			case proxy.AuthFailed:
+				s.cacheFailure(username, password)
+				s.recordAuth(ctx, username, false)
+				s.InfoLog("authentication failed", "reason", "invalid_password", "cached", false, "method", "remotelookup")
+				return consts.ErrAuthenticationFailed
+
+			case proxy.AuthTemporarilyUnavailable:
+				s.WarnLog("remotelookup service temporarily unavailable")
+				metrics.AuthenticationAttempts.WithLabelValues("submission_proxy", s.server.name, s.server.hostname, "unavailable").Inc()
+				return fmt.Errorf("%w: authentication service temporarily unavailable", server.ErrAuthServiceUnavailable)
+
+			case proxy.AuthUserNotFound:
+				if s.server.remotelookupConfig == nil || !s.server.remotelookupConfig.ShouldLookupLocalUsers() {
+					metrics.RemoteLookupResult.WithLabelValues("submission", "user_not_found_rejected").Inc()
+					s.recordAuth(ctx, username, false)
+					return consts.ErrAuthenticationFailed
+				}
+				metrics.RemoteLookupResult.WithLabelValues("submission", "user_not_found_fallback").Inc()
+				// Fall through to main DB auth
+			}
+		}
+	}
+
+	// Fallback to main DB
+	if parseErr != nil {
+		return fmt.Errorf("invalid address format: %w", parseErr)
+	}
+	if s.server.rdb == nil {
+		s.recordAuth(ctx, username, false)
+		return consts.ErrAuthenticationFailed
+	}
+
+	var accountID int64
+	var err error
+	if masterAuthValidated {
+		accountID, err = s.server.rdb.GetAccountIDByAddressWithRetry(ctx, parsedAddr.BaseAddress())
+	} else {
+		accountID, err = s.server.rdb.AuthenticateWithRetry(events.WithSource(ctx, "submission", s.RemoteIP), parsedAddr.BaseAddress(), password)
+	}
+	if err != nil {
+		// Must check s.ctx.Err(), not just the query error, because the query
+		// context can time out independently from server shutdown
+		if s.ctx.Err() != nil {
+			return server.ErrServerShuttingDown
+		}
+
+		// Only cache definitive auth failures, not transient DB errors
+		if errors.Is(err, consts.ErrUserNotFound) ||
+			strings.Contains(err.Error(), "user not found") ||
+			strings.Contains(err.Error(), "hashedPassword is not the hash") {
+			s.cacheFailure(username, password)
+		}
+		s.InfoLog("authentication failed", "cached", false, "method", "main_db", "error", err)
+		s.recordAuth(ctx, username, false)
+		return fmt.Errorf("%w: %w", consts.ErrAuthenticationFailed, err)
+	}
+
+	method := "main_db"
+	if masterAuthValidated {
+		method = "master"
+	}
+	s.InfoLog("authentication successful", "cached", false, "method", method)
+
+	if s.server.lookupCache != nil {
+		s.server.lookupCache.Set(s.server.name, username, &lookupcache.CacheEntry{
+			AccountID:    accountID,
+			PasswordHash: lookupcache.HashPassword(password),
+			Result:       lookupcache.AuthSuccess,
+		})
+	}
+
+	// Use base address (without +detail) for backend impersonation
+	s.username = parsedAddr.BaseAddress()
+	s.accountID = accountID
+	s.isRemoteLookupAccount = false
+	s.recordAuth(ctx, s.username, true)
+
+	if err := s.connectToBackend(); err != nil {
+		return fmt.Errorf("failed to connect to backend: %w", err)
+	}
+	return nil
+}
+
+// recordAuth records the attempt with the rate limiter and in the metrics.
+func (s *Session) recordAuth(ctx context.Context, username string, success bool) {
+	s.server.authLimiter.RecordAuthAttemptWithProxy(ctx, s.clientConn, s.proxyInfo, username, success)
+
+	if !success {
+		metrics.AuthenticationAttempts.WithLabelValues("submission_proxy", s.server.name, s.server.hostname, "failure").Inc()
+		return
+	}
+	metrics.AuthenticationAttempts.WithLabelValues("submission_proxy", s.server.name, s.server.hostname, "success").Inc()
+	if addr, err := server.NewAddress(username); err == nil {
+		metrics.TrackDomainConnection("submission_proxy", addr.Domain())
+		metrics.TrackUserActivity("submission_proxy", addr.FullAddress(), "connection", 1)
+	}
+
+	// Set username on client connection for timeout logging
+	if soraConn, ok := s.clientConn.(interface{ SetUsername(string) }); ok {
+		soraConn.SetUsername(username)
+	}
+}
+
+// cacheFailure stores a negative lookup cache entry for the credentials.
+func (s *Session) cacheFailure(username, password string) {
+	if s.server.lookupCache == nil {
+		return
+	}
+	s.server.lookupCache.Set(s.server.name, username, &lookupcache.CacheEntry{
+		PasswordHash: lookupcache.HashPassword(password),
+		Result:       lookupcache.AuthFailed,
+		IsNegative:   true,
+	})
+}
+
+// invalidateCache drops the cached entry for the user so that the next
+// attempt performs a fresh remotelookup/database lookup.
+func (s *Session) invalidateCache() {
+	if s.server.lookupCache != nil && s.username != "" {
+		s.server.lookupCache.Invalidate(s.server.name + ":" + s.username)
+	}
+}
+
+func (s *Session) connectToBackend() error {
+	routeResult, err := proxy.DetermineRoute(proxy.RouteParams{
+		Ctx:                   s.ctx,
+		Username:              s.username,
+		Protocol:              "submission",
+		IsRemoteLookupAccount: s.isRemoteLookupAccount,
+		RoutingInfo:           s.routingInfo,
+		ConnManager:           s.server.connManager,
+		EnableAffinity:        s.server.enableAffinity,
+		ProxyName:             "Submission Proxy",
+	})
+	if err != nil {
+		s.WarnLog("Error determining route", "error", err)
+	}
+
+	s.routingInfo = routeResult.RoutingInfo
+	s.routingMethod = routeResult.RoutingMethod
+	preferredAddr := routeResult.PreferredAddr
+	metrics.ProxyRoutingMethod.WithLabelValues("submission", routeResult.RoutingMethod).Inc()
+
+	clientHost, clientPort := server.GetHostPortFromAddr(s.clientConn.RemoteAddr())
+	serverHost, serverPort := server.GetHostPortFromAddr(s.clientConn.LocalAddr())
+	backendConn, actualAddr, err := s.server.connManager.ConnectWithProxy(
+		s.ctx,
+		preferredAddr,
+		clientHost, clientPort, serverHost, serverPort, s.routingInfo,
+	)
+	if err != nil {
+		metrics.ProxyBackendConnections.WithLabelValues("submission", "failure").Inc()
+		return fmt.Errorf("%w: %w", server.ErrBackendConnectionFailed, err)
+	}
+	if routeResult.IsRemoteLookupRoute && actualAddr != preferredAddr {
+		// For remotelookup routes, falling back to another server is a hard failure.
+		backendConn.Close()
+		metrics.ProxyBackendConnections.WithLabelValues("submission", "failure").Inc()
+		return fmt.Errorf("%w: remotelookup route to %s failed, and fallback is disabled for remotelookup routes", server.ErrBackendConnectionFailed, preferredAddr)
+	}
+
+	metrics.ProxyBackendConnections.WithLabelValues("submission", "success").Inc()
+	s.mu.Lock()
+	s.backendConn = backendConn
+	s.mu.Unlock()
+	s.serverAddr = actualAddr
+	s.backendReader = bufio.NewReader(backendConn)
+	s.backendWriter = bufio.NewWriter(backendConn)
+
+	if s.server.enableAffinity && actualAddr != "" {
+		proxy.UpdateAffinityAfterConnection(proxy.RouteParams{
+			Username:              s.username,
+			Protocol:              "submission",
+			IsRemoteLookupAccount: s.isRemoteLookupAccount,
+			RoutingInfo:           s.routingInfo,
+			ConnManager:           s.server.connManager,
+			EnableAffinity:        s.server.enableAffinity,
+			ProxyName:             "Submission Proxy",
+		}, actualAddr, routeResult.RoutingMethod == "affinity")
+	}
+
+	if err := s.setupBackend(); err != nil {
+		s.backendConn.Close()
+		return err
+	}
+	return nil
+}
+
+// setupBackend performs the SMTP handshake with the backend: greeting, EHLO,
+// optional STARTTLS and XCLIENT, and finally AUTH PLAIN with the master SASL
+// credentials on behalf of the user.
+func (s *Session) setupBackend() error {
+	// Bound the whole handshake by the connect timeout
+	if err := s.backendConn.SetDeadline(time.Now().Add(s.server.connManager.GetConnectTimeout())); err != nil {
+		return fmt.Errorf("%w: failed to set deadline: %w", server.ErrBackendConnectionFailed, err)
+	}
+	defer func() {
+		if s.backendConn != nil {
+			_ = s.backendConn.SetDeadline(time.Time{})
+		}
+	}()
+
+	if _, err := s.readBackendReply("220"); err != nil {
+		return fmt.Errorf("%w: greeting: %w", server.ErrBackendConnectionFailed, err)
+	}
+	if err := s.backendEHLO(); err != nil {
+		return err
+	}
+
+	// Negotiate STARTTLS with the backend if remotelookup or the global config asks for it
+	var tlsConfig *tls.Config
+	if s.routingInfo != nil && s.routingInfo.RemoteTLSUseStartTLS {
+		tlsConfig = &tls.Config{
+			InsecureSkipVerify: !s.routingInfo.RemoteTLSVerify,
+			Renegotiation:      tls.RenegotiateNever,
+		}
+	} else if s.server.connManager.IsRemoteStartTLS() {
+		tlsConfig = s.server.connManager.GetTLSConfig()
+	}
+	if tlsConfig != nil {
+		if err := s.backendCommand("STARTTLS", "220"); err != nil {
+			return fmt.Errorf("%w: STARTTLS: %w", server.ErrBackendConnectionFailed, err)
+		}
+		tlsConn := tls.Client(s.backendConn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			return fmt.Errorf("%w: TLS handshake with backend failed: %w", server.ErrBackendConnectionFailed, err)
+		}
+		s.mu.Lock()
+		s.backendConn = tlsConn
+		s.mu.Unlock()
+		s.backendReader = bufio.NewReader(tlsConn)
+		s.backendWriter = bufio.NewWriter(tlsConn)
+		if err := s.backendEHLO(); err != nil {
+			return err
+		}
+	}
+
+	useXCLIENT := s.server.remoteUseXCLIENT
+	if s.routingInfo != nil {
+		useXCLIENT = s.routingInfo.RemoteUseXCLIENT
+	}
+	if useXCLIENT {
+		if err := s.sendForwardingParametersToBackend(); err != nil {
+			s.WarnLog("Failed to send XCLIENT to backend - continuing without forwarding parameters", "backend", s.serverAddr, "error", err)
+		}
+	}
+
+	// Authenticate to backend using master SASL credentials via AUTH PLAIN
+	authString := fmt.Sprintf("%s\x00%s\x00%s", s.username, s.server.masterSASLUsername, s.server.masterSASLPassword)
+	encoded := base64.StdEncoding.EncodeToString([]byte(authString))
+	if err := s.backendCommand("AUTH PLAIN "+encoded, "235"); err != nil {
+		// Invalidate cache so the next attempt picks up backend changes
+		// (e.g., domain moved to a different server)
+		s.invalidateCache()
+		return fmt.Errorf("%w: %w", server.ErrBackendAuthFailed, err)
+	}
+
+	s.DebugLog("Authenticated to backend", "backend", s.serverAddr)
+	return nil
+}
+
+// backendEHLO sends EHLO to the backend and consumes the reply.
+func (s *Session) backendEHLO() error {
+	if err := s.backendCommand("EHLO "+s.server.hostname, "250"); err != nil {
+		return fmt.Errorf("%w: EHLO: %w", server.ErrBackendConnectionFailed, err)
+	}
+	return nil
+}
+
+// backendCommand sends a command to the backend and checks the reply code.
+func (s *Session) backendCommand(command, expect string) error {
+	if _, err := s.backendWriter.WriteString(command + "\r\n"); err != nil {
+		return err
+	}
+	if err := s.backendWriter.Flush(); err != nil {
+		return err
+	}
+	_, err := s.readBackendReply(expect)
+	return err
+}
+
+// readBackendReply reads a (possibly multi-line) SMTP reply from the backend
+// and returns its last line. An error is returned if the code does not match.
+func (s *Session) readBackendReply(expect string) (string, error) {
+	for {
+		line, err := s.backendReader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) < 3 {
+			return "", fmt.Errorf("malformed reply: %q", line)
+		}
+		if len(line) > 3 && line[3] == '-' {
+			continue
+		}
+		if !strings.HasPrefix(line, expect) {
+			return line, fmt.Errorf("unexpected reply: %s", line)
+		}
+		return line, nil
+	}
+}
+
+// sendForwardingParametersToBackend sends an XCLIENT command with the real
+// client information. The backend resets the session and greets again, so
+// EHLO has to be repeated afterwards.
+func (s *Session) sendForwardingParametersToBackend() error {
+	forwardingParams := server.NewForwardingParams(s.clientConn, s.proxyInfo)
+	forwardingParams.Protocol = "ESMTP"
+	forwardingParams.HELO = s.helo
+	// TTL is not part of the Postfix XCLIENT attribute set
+	forwardingParams.ProxyTTL = 0
+
+	if err := s.backendCommand("XCLIENT "+forwardingParams.ToLMTPXCLIENT(), "220"); err != nil {
+		return err
+	}
+	return s.backendEHLO()
+}
+
+func (s *Session) startProxying() {
+	if s.backendConn == nil {
+		return
+	}
+	defer s.backendConn.Close()
+
+	var wg sync.WaitGroup
+
+	activityCtx, activityCancel := context.WithCancel(s.ctx)
+	defer activityCancel()
+	go s.updateActivityPeriodically(activityCtx)
+
+	// Copy from client to backend. Any pipelined data already buffered in
+	// clientReader is forwarded first.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Half-close so the backend can finish sending its final reply (e.g. to QUIT)
+		defer func() {
+			if closeWriter, ok := s.backendConn.(interface{ CloseWrite() error }); ok {
+				_ = closeWriter.CloseWrite()
+			} else {
+				s.backendConn.Close()
+			}
+		}()
+		n, err := s.copyWithDeadline(s.backendConn, s.clientReader, "client-to-backend")
+		metrics.BytesThroughput.WithLabelValues("submission_proxy", "in").Add(float64(n))
+		if err != nil && !isClosingError(err) {
+			s.DebugLog("error copying client to backend", "error", err)
+		}
+	}()
+
+	// Copy from backend to client
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() {
+			s.mu.Lock()
+			if !s.gracefulShutdown {
+				s.clientConn.Close()
+			}
+			s.mu.Unlock()
+		}()
+		n, err := s.copyWithDeadline(s.clientConn, s.backendReader, "backend-to-client")
+		metrics.BytesThroughput.WithLabelValues("submission_proxy", "out").Add(float64(n))
+		if err != nil && !isClosingError(err) {
+			s.DebugLog("error copying backend to client", "error", err)
+		}
+	}()
+
+	// Unblock the copy goroutines when the context is cancelled. Not part of
+	// the waitgroup, see pop3proxy for the reasoning.
+	go func() {
+		<-s.ctx.Done()
+		s.clientConn.Close()
+		s.backendConn.Close()
+	}()
+
+	wg.Wait()
+}
+
+// copyWithDeadline copies from a buffered reader to a connection with write
+// deadline protection, so that no data buffered during authentication is lost.
+func (s *Session) copyWithDeadline(dst net.Conn, src *bufio.Reader, direction string) (int64, error) {
+	const writeDeadline = 30 * time.Second
+	var total int64
+	buf := make([]byte, 32*1024)
+	nextDeadline := time.Now()
+
+	for {
+		nr, err := src.Read(buf)
+		if nr > 0 {
+			// Only update write deadline once per second to reduce syscall frequency
+			if now := time.Now(); now.After(nextDeadline) {
+				if err := dst.SetWriteDeadline(now.Add(writeDeadline)); err != nil {
+					return total, fmt.Errorf("failed to set write deadline: %w", err)
+				}
+				nextDeadline = now.Add(time.Second)
+			}
+			nw, ew := dst.Write(buf[:nr])
+			total += int64(nw)
+			if ew != nil {
+				return total, fmt.Errorf("write error in %s: %w", direction, ew)
+			}
+			if nr != nw {
+				return total, io.ErrShortWrite
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return total, nil
+			}
+			return total, err
+		}
+	}
+}
+
+// close closes all connections and unregisters from tracking.
+func (s *Session) close() {
+	s.server.unregisterSession(s)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.releaseConn != nil {
+		s.releaseConn()
+		s.releaseConn = nil
+	}
+
+	s.InfoLog("disconnected", "duration", time.Since(s.startTime).Round(time.Second), "backend", s.serverAddr)
+	metrics.ConnectionsCurrent.WithLabelValues("submission_proxy", s.server.name, s.server.hostname).Dec()
+
+	// Unregister synchronously to prevent leaks; s.ctx is likely already cancelled
+	if s.server.connTracker != nil && s.username != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+		if err := s.server.connTracker.UnregisterConnection(ctx, s.accountID, "Submission", s.RemoteIP); err != nil {
+			s.WarnLog("Failed to unregister connection", "error", err)
+		}
+	}
+
+	if s.clientConn != nil {
+		s.clientConn.Close()
+	}
+	if s.backendConn != nil {
+		s.backendConn.Close()
+	}
+}
+
+// registerConnection registers the connection with the connection tracker.
+func (s *Session) registerConnection() error {
+	queryTimeout := 30 * time.Second
+	if s.server.rdb != nil {
+		queryTimeout = s.server.rdb.GetQueryTimeout()
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, queryTimeout)
+	defer cancel()
+
+	if s.server.connTracker != nil {
+		return s.server.connTracker.RegisterConnection(ctx, s.accountID, s.username, "Submission", s.RemoteIP)
+	}
+	return nil
+}
+
+// updateActivityPeriodically waits for kick notifications for the account.
+func (s *Session) updateActivityPeriodically(ctx context.Context) {
+	if s.server.connTracker == nil {
+		<-ctx.Done()
+		return
+	}
+
+	kickChan := s.server.connTracker.RegisterSession(s.accountID)
+	defer s.server.connTracker.UnregisterSession(s.accountID, kickChan)
+
+	select {
+	case <-kickChan:
+		s.InfoLog("connection kicked - disconnecting", "backend", s.serverAddr)
+		s.clientConn.Close()
+		s.backendConn.Close()
+	case <-ctx.Done():
+	}
+}
+
+// isConnectionSecure checks if the underlying client connection is TLS-encrypted.
+func (s *Session) isConnectionSecure() bool {
+	conn := s.clientConn
+	for conn != nil {
+		if _, ok := conn.(*tls.Conn); ok {
+			return true
+		}
+		if wrapper, ok := conn.(interface{ Unwrap() net.Conn }); ok {
+			conn = wrapper.Unwrap()
+		} else {
+			break
+		}
+	}
+	return false
+}
+
+func isClosingError(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed)
+}
+
+func checkMasterCredential(provided string, actual []byte) bool {
+	return subtle.ConstantTimeCompare([]byte(provided), actual) == 1
+}
@@ -0,0 +1,83 @@
+package submissionproxy
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTestSession(clientInput string) (*Session, *strings.Builder) {
+	out := &strings.Builder{}
+	return &Session{
+		server:       &Server{maxAuthErrors: 2},
+		clientReader: bufio.NewReader(strings.NewReader(clientInput)),
+		clientWriter: bufio.NewWriter(out),
+	}, out
+}
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func TestReadCredentialsPlain(t *testing.T) {
+	s, _ := newTestSession("")
+	user, pass, err := s.readCredentials("PLAIN", b64("\x00alice@example.com\x00secret"))
+	if err != nil || user != "alice@example.com" || pass != "secret" {
+		t.Fatalf("got %q/%q, %v", user, pass, err)
+	}
+
+	// Continuation without initial response
+	s, out := newTestSession(b64("alice@example.com\x00alice@example.com\x00secret") + "\r\n")
+	user, pass, err = s.readCredentials("PLAIN", "")
+	if err != nil || user != "alice@example.com" || pass != "secret" {
+		t.Fatalf("got %q/%q, %v", user, pass, err)
+	}
+	if out.String() != "334 \r\n" {
+		t.Errorf("unexpected challenge %q", out.String())
+	}
+
+	// Foreign authorization identity is rejected
+	s, _ = newTestSession("")
+	_, _, err = s.readCredentials("PLAIN", b64("bob@example.com\x00alice@example.com\x00secret"))
+	var reply authReplyError
+	if !errors.As(err, &reply) || !strings.HasPrefix(string(reply), "535") {
+		t.Errorf("expected 535 reply, got %v", err)
+	}
+}
+
+func TestReadCredentialsLogin(t *testing.T) {
+	s, out := newTestSession(b64("alice@example.com") + "\r\n" + b64("secret") + "\r\n")
+	user, pass, err := s.readCredentials("LOGIN", "")
+	if err != nil || user != "alice@example.com" || pass != "secret" {
+		t.Fatalf("got %q/%q, %v", user, pass, err)
+	}
+	want := "334 " + b64("Username:") + "\r\n334 " + b64("Password:") + "\r\n"
+	if out.String() != want {
+		t.Errorf("challenges = %q, want %q", out.String(), want)
+	}
+
+	s, _ = newTestSession("*\r\n")
+	if _, _, err := s.readCredentials("LOGIN", b64("alice@example.com")); !errors.Is(err, errAuthCancelled) {
+		t.Errorf("expected cancellation, got %v", err)
+	}
+
+	s, _ = newTestSession("")
+	if _, _, err := s.readCredentials("CRAM-MD5", ""); err == nil || !strings.HasPrefix(err.Error(), "504") {
+		t.Errorf("expected 504 for unsupported mechanism, got %v", err)
+	}
+}
+
+func TestReadBackendReply(t *testing.T) {
+	s := &Session{backendReader: bufio.NewReader(strings.NewReader(
+		"250-mx.example.com\r\n250-PIPELINING\r\n250 AUTH PLAIN\r\n535 5.7.8 nope\r\n"))}
+
+	line, err := s.readBackendReply("250")
+	if err != nil || line != "250 AUTH PLAIN" {
+		t.Fatalf("got %q, %v", line, err)
+	}
+	if _, err := s.readBackendReply("235"); err == nil {
+		t.Error("expected error for unexpected reply code")
+	}
+}
@@ -0,0 +1,144 @@
+package userapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+)
+
+// AppPasswordRequest represents a request to create an app password
+type AppPasswordRequest struct {
+	Name       string   `json:"name"`
+	Protocols  []string `json:"protocols"`
+	AllowedIPs []string `json:"allowed_ips,omitempty"`
+}
+
+// handleListAppPasswords lists the app passwords of the authenticated user
+func (s *Server) handleListAppPasswords(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	accountID, err := getAccountIDFromContext(ctx)
+	if err != nil {
+		s.writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	appPasswords, err := s.rdb.ListAppPasswordsWithRetry(ctx, accountID)
+	if err != nil {
+		logger.Warn("HTTP Mail API: Error listing app passwords", "name", s.name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to list app passwords")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"app_passwords": appPasswords,
+		"count":         len(appPasswords),
+	})
+}
+
+// handleCreateAppPassword creates an app password. The generated password is
+// only returned in this response.
+func (s *Server) handleCreateAppPassword(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	accountID, err := getAccountIDFromContext(ctx)
+	if err != nil {
+		s.writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !s.requireAccountPassword(w, r) {
+		return
+	}
+
+	var req AppPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	appPassword, secret, err := s.rdb.CreateAppPasswordWithRetry(ctx, accountID, db.AppPassword{
+		Name:       req.Name,
+		Protocols:  req.Protocols,
+		AllowedIPs: req.AllowedIPs,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, consts.ErrInvalidInput):
+			s.writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, consts.ErrDBUniqueViolation):
+			s.writeError(w, http.StatusConflict, "An app password with this name already exists")
+		default:
+			logger.Warn("HTTP Mail API: Error creating app password", "name", s.name, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "Failed to create app password")
+		}
+		return
+	}
+
+	s.writeJSON(w, http.StatusCreated, map[string]any{
+		"app_password": appPassword,
+		"password":     secret,
+	})
+}
+
+// handleDeleteAppPassword revokes an app password. Sessions of the account are
+// kicked so that clients using it have to log in again.
+func (s *Server) handleDeleteAppPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	accountID, err := getAccountIDFromContext(ctx)
+	if err != nil {
+		s.writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !s.requireAccountPassword(w, r) {
+		return
+	}
+
+	// Extract ID from path: /user/app-passwords/{id}
+	id, err := strconv.ParseInt(extractPathParam(r.URL.Path, "/user/app-passwords/", ""), 10, 64)
+	if err != nil || id <= 0 {
+		s.writeError(w, http.StatusBadRequest, "Invalid app password ID")
+		return
+	}
+
+	if err := s.rdb.DeleteAppPasswordWithRetry(ctx, accountID, id); err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			s.writeError(w, http.StatusNotFound, "App password not found")
+			return
+		}
+		logger.Warn("HTTP Mail API: Error deleting app password", "name", s.name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to delete app password")
+		return
+	}
+
+	for key, tracker := range s.connectionTrackers {
+		if tracker == nil {
+			continue
+		}
+		if err := tracker.KickUser(accountID, key); err != nil {
+			logger.Warn("HTTP Mail API: Error kicking user on tracker", "name", s.name, "tracker", key, "error", err)
+		}
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]string{
+		"message": "App password revoked successfully",
+	})
+}
+
+// requireAccountPassword rejects requests whose token was issued for an app
+// password: managing app passwords and the second factor needs the account
+// password, so that a leaked app password cannot be used to mint new
+// credentials or remove the second factor.
+func (s *Server) requireAccountPassword(w http.ResponseWriter, r *http.Request) bool {
+	if appPasswordID, _ := r.Context().Value(contextKeyAppPasswordID).(int64); appPasswordID != 0 {
+		s.writeError(w, http.StatusForbidden, "Log in with the account password to manage credentials")
+		return false
+	}
+	return true
+}
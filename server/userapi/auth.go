@@ -23,15 +23,23 @@ type contextKey string
 const (
 	contextKeyEmail     contextKey = "email"
 	contextKeyAccountID contextKey = "accountID"
+	// contextKeyAppPasswordID holds the app password a token was issued for
+	contextKeyAppPasswordID contextKey = "appPasswordID"
 )
 
 // JWTClaims represents the JWT token claims
 type JWTClaims struct {
-	Email     string `json:"email"`
-	AccountID int64  `json:"account_id"`
+	Email         string `json:"email"`
+	AccountID     int64  `json:"account_id"`
+	AppPasswordID int64  `json:"app_password_id,omitempty"` // Set when logged in with an app password
+	TOTPPending   bool   `json:"totp_pending,omitempty"`    // Set on pre-auth tokens awaiting the second factor
 	jwt.RegisteredClaims
 }
 
+// preAuthTokenDuration is how long a pre-auth token can be exchanged for a
+// full token with a TOTP code.
+const preAuthTokenDuration = 5 * time.Minute
+
 // LoginRequest represents the login request payload
 type LoginRequest struct {
 	Email    string `json:"email"`
@@ -46,6 +54,22 @@ type LoginResponse struct {
 	AccountID int64  `json:"account_id"`
 }
 
+// TOTPChallengeResponse is returned by login instead of a token when the
+// account has a second factor. The pre-auth token is exchanged for a token at
+// /user/auth/totp.
+type TOTPChallengeResponse struct {
+	TOTPRequired bool   `json:"totp_required"`
+	PreAuthToken string `json:"pre_auth_token"`
+	ExpiresAt    int64  `json:"expires_at"`
+}
+
+// TOTPLoginRequest completes a login with a TOTP code or a recovery code
+type TOTPLoginRequest struct {
+	PreAuthToken string `json:"pre_auth_token"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
 // RefreshTokenRequest represents the token refresh request
 type RefreshTokenRequest struct {
 	Token string `json:"token"`
@@ -83,6 +107,9 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 
 	var accountID int64
 	var hashedPassword string
+	var creds *db.AuthCredentials
+	var app *db.AppPasswordCredential
+	var appPasswordID int64
 	var err error
 
 	// Check cache first (if enabled)
@@ -104,7 +131,16 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 			if s.authLimiter != nil {
 				s.authLimiter.RecordAuthAttempt(ctx, remoteAddr, req.Email, true)
 			}
-			// Skip database lookup - use cached account ID
+			// Skip the credential lookup, but a status change since the
+			// entry was cached must still block the login
+			if code, msg := s.checkAccountStatus(ctx, accountID); code != http.StatusOK {
+				if code == http.StatusForbidden || code == http.StatusUnauthorized {
+					// Same answer as the database path
+					code, msg = http.StatusUnauthorized, "Invalid credentials"
+				}
+				s.writeError(w, code, msg)
+				return
+			}
 			goto generateToken
 		}
 		// Cache miss or revalidation needed - fall through to full auth
@@ -121,7 +157,7 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Authenticate user (full database lookup)
-	accountID, hashedPassword, err = s.rdb.GetCredentialForAuthWithRetry(ctx, req.Email)
+	creds, err = s.rdb.GetAuthCredentialsWithRetry(ctx, req.Email)
 	if err != nil {
 		if errors.Is(err, consts.ErrUserNotFound) {
 			// Cache negative result if cache enabled (result=1 for user not found)
@@ -141,8 +177,12 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify password
-	if err := db.VerifyPassword(hashedPassword, req.Password); err != nil {
+	accountID = creds.AccountID
+	hashedPassword = creds.HashedPassword
+
+	// Verify password or an app password allowed for the User API
+	app, err = creds.Verify(req.Password, db.AppPasswordProtocolUserAPI, clientIP)
+	if err != nil {
 		// Cache negative result if cache enabled (result=2 for invalid password)
 		if s.authCache != nil {
 			s.authCache.SetFailure(req.Email, 2, req.Password)
@@ -155,8 +195,12 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Cache positive result if cache enabled
-	if s.authCache != nil {
+	if app != nil {
+		s.rdb.RecordAppPasswordUse(app.ID, clientIP)
+		appPasswordID = app.ID
+	} else if s.authCache != nil {
+		// Cache positive result if cache enabled. App password logins are not
+		// cached: the token must record which app password was used.
 		s.authCache.SetSuccess(req.Email, accountID, hashedPassword, req.Password)
 	}
 
@@ -167,8 +211,33 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 
 generateToken:
 
+	// Accounts with a second factor get a pre-auth token first. App passwords
+	// are generated credentials of their own and skip the second factor.
+	if appPasswordID == 0 {
+		totpStatus, err := s.rdb.GetTOTPStatusWithRetry(ctx, accountID)
+		if err != nil {
+			logger.Warn("HTTP Mail API: Error checking second factor", "name", s.name, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "Authentication failed")
+			return
+		}
+		if totpStatus.Enabled {
+			preAuthToken, expiresAt, err := s.generatePreAuthToken(req.Email, accountID)
+			if err != nil {
+				logger.Warn("HTTP Mail API: Error generating pre-auth token", "name", s.name, "error", err)
+				s.writeError(w, http.StatusInternalServerError, "Token generation failed")
+				return
+			}
+			s.writeJSON(w, http.StatusOK, TOTPChallengeResponse{
+				TOTPRequired: true,
+				PreAuthToken: preAuthToken,
+				ExpiresAt:    expiresAt.Unix(),
+			})
+			return
+		}
+	}
+
 	// Generate JWT token
-	token, expiresAt, err := s.generateToken(req.Email, accountID)
+	token, expiresAt, err := s.generateToken(req.Email, accountID, appPasswordID)
 	if err != nil {
 		logger.Warn("HTTP Mail API: Error generating token", "name", s.name, "error", err)
 		s.writeError(w, http.StatusInternalServerError, "Token generation failed")
@@ -185,6 +254,85 @@ generateToken:
 	s.writeJSON(w, http.StatusOK, response)
 }
 
+// handleTOTPLogin exchanges a pre-auth token and a TOTP or recovery code for
+// a JWT token. Wrong codes count as failed logins for rate limiting.
+func (s *Server) handleTOTPLogin(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req TOTPLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.PreAuthToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		s.writeError(w, http.StatusBadRequest, "Pre-auth token and code or recovery code are required")
+		return
+	}
+
+	claims, err := s.validatePreAuthToken(req.PreAuthToken)
+	if err != nil {
+		s.writeError(w, http.StatusUnauthorized, "Invalid or expired token")
+		return
+	}
+
+	ctx := r.Context()
+	clientIP := getClientIP(r)
+	remoteAddr := &server.StringAddr{Addr: clientIP}
+
+	server.ApplyAuthenticationDelay(ctx, s.authLimiter, remoteAddr, "USER-API-TOTP")
+	if s.authLimiter != nil {
+		if err := s.authLimiter.CanAttemptAuth(ctx, remoteAddr, claims.Email); err != nil {
+			logger.Debug("User API: TOTP login rate limited", "name", s.name, "ip", clientIP, "email", claims.Email, "error", err)
+			s.writeError(w, http.StatusTooManyRequests, "Too many authentication attempts. Please try again later.")
+			return
+		}
+	}
+
+	if code, msg := s.checkAccountStatus(ctx, claims.AccountID); code != http.StatusOK {
+		s.writeError(w, code, msg)
+		return
+	}
+
+	if err := s.rdb.VerifyTOTPWithRetry(ctx, claims.AccountID, req.Code, req.RecoveryCode); err != nil {
+		switch {
+		case errors.Is(err, consts.ErrAuthenticationFailed):
+			if s.authLimiter != nil {
+				s.authLimiter.RecordAuthAttempt(ctx, remoteAddr, claims.Email, false)
+			}
+			s.writeError(w, http.StatusUnauthorized, "Invalid code")
+		case errors.Is(err, consts.ErrDBNotFound):
+			// The second factor was removed since the password step
+			s.writeError(w, http.StatusUnauthorized, "Invalid or expired token")
+		default:
+			logger.Warn("HTTP Mail API: Error verifying second factor", "name", s.name, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "Authentication failed")
+		}
+		return
+	}
+
+	if s.authLimiter != nil {
+		s.authLimiter.RecordAuthAttempt(ctx, remoteAddr, claims.Email, true)
+	}
+	if req.RecoveryCode != "" {
+		logger.Info("User API: Login with recovery code", "name", s.name, "email", claims.Email, "account_id", claims.AccountID)
+	}
+
+	token, expiresAt, err := s.generateToken(claims.Email, claims.AccountID, 0)
+	if err != nil {
+		logger.Warn("HTTP Mail API: Error generating token", "name", s.name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Token generation failed")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, LoginResponse{
+		Token:     token,
+		ExpiresAt: expiresAt.Unix(),
+		Email:     claims.Email,
+		AccountID: claims.AccountID,
+	})
+}
+
 // handleRefreshToken handles JWT token refresh
 func (s *Server) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
@@ -207,8 +355,18 @@ func (s *Server) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Do not extend tokens of accounts that may no longer log in
+	if code, msg := s.checkAccountStatus(r.Context(), claims.AccountID); code != http.StatusOK {
+		s.writeError(w, code, msg)
+		return
+	}
+	if code, msg := s.checkAppPassword(r.Context(), claims); code != http.StatusOK {
+		s.writeError(w, code, msg)
+		return
+	}
+
 	// Generate new token with extended expiration
-	newToken, expiresAt, err := s.generateToken(claims.Email, claims.AccountID)
+	newToken, expiresAt, err := s.generateToken(claims.Email, claims.AccountID, claims.AppPasswordID)
 	if err != nil {
 		logger.Warn("HTTP Mail API: Error generating refresh token", "name", s.name, "error", err)
 		s.writeError(w, http.StatusInternalServerError, "Token generation failed")
@@ -225,19 +383,34 @@ func (s *Server) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusOK, response)
 }
 
-// generateToken creates a new JWT token for the user
-func (s *Server) generateToken(email string, accountID int64) (string, time.Time, error) {
-	expiresAt := time.Now().Add(s.tokenDuration)
+// generateToken creates a new JWT token for the user. appPasswordID is the
+// app password the user logged in with, or 0 for the account password.
+func (s *Server) generateToken(email string, accountID, appPasswordID int64) (string, time.Time, error) {
+	return s.signToken(JWTClaims{
+		Email:         email,
+		AccountID:     accountID,
+		AppPasswordID: appPasswordID,
+	}, s.tokenDuration)
+}
 
-	claims := JWTClaims{
-		Email:     email,
-		AccountID: accountID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expiresAt),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    s.tokenIssuer,
-			Subject:   email,
-		},
+// generatePreAuthToken creates a short-lived token that only proves the
+// password step of a login and is accepted by handleTOTPLogin alone.
+func (s *Server) generatePreAuthToken(email string, accountID int64) (string, time.Time, error) {
+	return s.signToken(JWTClaims{
+		Email:       email,
+		AccountID:   accountID,
+		TOTPPending: true,
+	}, preAuthTokenDuration)
+}
+
+// signToken sets the registered claims and signs the token.
+func (s *Server) signToken(claims JWTClaims, duration time.Duration) (string, time.Time, error) {
+	expiresAt := time.Now().Add(duration)
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		Issuer:    s.tokenIssuer,
+		Subject:   claims.Email,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -249,8 +422,35 @@ func (s *Server) generateToken(email string, accountID int64) (string, time.Time
 	return tokenString, expiresAt, nil
 }
 
-// validateToken validates a JWT token and returns the claims
+// validateToken validates a JWT token and returns the claims. Pre-auth
+// tokens are rejected.
 func (s *Server) validateToken(tokenString string) (*JWTClaims, error) {
+	claims, err := s.parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TOTPPending {
+		return nil, fmt.Errorf("second factor required")
+	}
+	return claims, nil
+}
+
+// validatePreAuthToken validates a pre-auth token issued by login for an
+// account with a second factor.
+func (s *Server) validatePreAuthToken(tokenString string) (*JWTClaims, error) {
+	claims, err := s.parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.TOTPPending {
+		return nil, fmt.Errorf("not a pre-auth token")
+	}
+	return claims, nil
+}
+
+// parseToken verifies the signature and expiry of a JWT token and returns
+// its claims
+func (s *Server) parseToken(tokenString string) (*JWTClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (any, error) {
 		// Verify signing method
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -322,14 +522,61 @@ func (s *Server) jwtAuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Tokens outlive status changes and revocations, so check the account
+		// on every request
+		if code, msg := s.checkAccountStatus(r.Context(), claims.AccountID); code != http.StatusOK {
+			s.writeError(w, code, msg)
+			return
+		}
+		if code, msg := s.checkAppPassword(r.Context(), claims); code != http.StatusOK {
+			s.writeError(w, code, msg)
+			return
+		}
+
 		// Add claims to request context
 		ctx := context.WithValue(r.Context(), contextKeyEmail, claims.Email)
 		ctx = context.WithValue(ctx, contextKeyAccountID, claims.AccountID)
+		ctx = context.WithValue(ctx, contextKeyAppPasswordID, claims.AppPasswordID)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// checkAccountStatus reports whether the account may still use the API. It
+// returns http.StatusOK or the status code and message to reject with.
+func (s *Server) checkAccountStatus(ctx context.Context, accountID int64) (int, string) {
+	status, err := s.rdb.GetAccountStatusWithRetry(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, consts.ErrUserNotFound) {
+			return http.StatusUnauthorized, "Invalid or expired token"
+		}
+		logger.Warn("HTTP Mail API: Error checking account status", "name", s.name, "account_id", accountID, "error", err)
+		return http.StatusServiceUnavailable, "Service temporarily unavailable"
+	}
+	if !db.AccountStatusAllowsLogin(status.Status) {
+		return http.StatusForbidden, "Account is suspended"
+	}
+	return http.StatusOK, ""
+}
+
+// checkAppPassword rejects tokens issued for an app password that has been
+// revoked since. It returns http.StatusOK or the status code and message to
+// reject with.
+func (s *Server) checkAppPassword(ctx context.Context, claims *JWTClaims) (int, string) {
+	if claims.AppPasswordID == 0 {
+		return http.StatusOK, ""
+	}
+	exists, err := s.rdb.AppPasswordExistsWithRetry(ctx, claims.AccountID, claims.AppPasswordID)
+	if err != nil {
+		logger.Warn("HTTP Mail API: Error checking app password", "name", s.name, "account_id", claims.AccountID, "error", err)
+		return http.StatusServiceUnavailable, "Service temporarily unavailable"
+	}
+	if !exists {
+		return http.StatusUnauthorized, "Invalid or expired token"
+	}
+	return http.StatusOK, ""
+}
+
 // getAccountIDFromContext retrieves the account ID from the request context
 func getAccountIDFromContext(ctx context.Context) (int64, error) {
 	accountID, ok := ctx.Value(contextKeyAccountID).(int64)
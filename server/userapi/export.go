@@ -0,0 +1,292 @@
+package userapi
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/helpers"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/mbox"
+)
+
+// exportErrorsFile lists the messages a zip export had to leave out.
+const exportErrorsFile = "export-errors.txt"
+
+// handleExport streams the messages of a mailbox, or of every mailbox of
+// the account, for download.
+//
+// With format=mbox a single mailbox is exported as an mbox file and the whole
+// account as a zip archive with one <mailbox>.mbox file per mailbox. With
+// format=zip messages are exported as <mailbox>/<uid>.eml files of a zip
+// archive; the internal date is the modification time of a file and the flags
+// are its comment. Both layouts are accepted by POST /user/imports.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	accountID, err := getAccountIDFromContext(ctx)
+	if err != nil {
+		s.writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if s.storage == nil {
+		s.writeError(w, http.StatusServiceUnavailable, "Storage not configured")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = db.MessageImportFormatMbox
+	}
+	if format != db.MessageImportFormatMbox && format != db.MessageImportFormatZip {
+		s.writeError(w, http.StatusBadRequest, "Invalid format, must be mbox or zip")
+		return
+	}
+
+	var mailboxes []*db.DBMailbox
+	mailboxName := r.URL.Query().Get("mailbox")
+	if mailboxName != "" {
+		mailbox, err := s.rdb.GetMailboxByNameWithRetry(ctx, accountID, mailboxName)
+		if err != nil {
+			if errors.Is(err, consts.ErrMailboxNotFound) {
+				s.writeError(w, http.StatusNotFound, "Mailbox not found")
+				return
+			}
+			logger.Warn("HTTP Mail API: Error getting mailbox for export", "name", s.name, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "Failed to get mailbox")
+			return
+		}
+		mailboxes = []*db.DBMailbox{mailbox}
+	} else {
+		all, err := s.rdb.GetMailboxesWithRetry(ctx, accountID, false)
+		if err != nil {
+			logger.Warn("HTTP Mail API: Error listing mailboxes for export", "name", s.name, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "Failed to list mailboxes")
+			return
+		}
+		// Shared mailboxes of other accounts are not part of the account
+		for _, mailbox := range all {
+			if mailbox.AccountID == accountID {
+				mailboxes = append(mailboxes, mailbox)
+			}
+		}
+	}
+
+	// Exports take longer than the write timeout of the server
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		logger.Debug("HTTP Mail API: Cannot extend write deadline for export", "name", s.name, "error", err)
+	}
+
+	logger.Info("HTTP Mail API: Exporting messages", "name", s.name, "account_id", accountID, "format", format, "mailboxes", len(mailboxes))
+
+	if format == db.MessageImportFormatMbox && mailboxName != "" {
+		w.Header().Set("Content-Type", "application/mbox")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exportFileName(mailboxName)+".mbox"))
+		w.WriteHeader(http.StatusOK)
+		mw := mbox.NewWriter(w)
+		if _, err := s.exportMailboxAsMbox(r, mw, mailboxes[0]); err != nil {
+			s.abortExport(accountID, err)
+		}
+		if err := mw.Flush(); err != nil {
+			s.abortExport(accountID, err)
+		}
+		return
+	}
+
+	fileName := "export"
+	if mailboxName != "" {
+		fileName = exportFileName(mailboxName)
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName+".zip"))
+	w.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(w)
+	var skipped []string
+	for _, mailbox := range mailboxes {
+		var mailboxSkipped []string
+		if format == db.MessageImportFormatMbox {
+			entry, err := zw.CreateHeader(&zip.FileHeader{Name: mailbox.Name + ".mbox", Method: zip.Deflate, Modified: time.Now()})
+			if err != nil {
+				s.abortExport(accountID, err)
+			}
+			mw := mbox.NewWriter(entry)
+			mailboxSkipped, err = s.exportMailboxAsMbox(r, mw, mailbox)
+			if err == nil {
+				err = mw.Flush()
+			}
+			if err != nil {
+				s.abortExport(accountID, err)
+			}
+		} else {
+			mailboxSkipped, err = s.exportMailboxAsEML(r, zw, mailbox)
+			if err != nil {
+				s.abortExport(accountID, err)
+			}
+		}
+		skipped = append(skipped, mailboxSkipped...)
+	}
+
+	if len(skipped) > 0 {
+		entry, err := zw.Create(exportErrorsFile)
+		if err == nil {
+			_, err = io.WriteString(entry, strings.Join(skipped, "\n")+"\n")
+		}
+		if err != nil {
+			s.abortExport(accountID, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		s.abortExport(accountID, err)
+	}
+}
+
+// exportMailboxAsMbox writes the messages of a mailbox to an mbox file. It
+// returns a line for every message that could not be read.
+func (s *Server) exportMailboxAsMbox(r *http.Request, mw *mbox.Writer, mailbox *db.DBMailbox) ([]string, error) {
+	return s.exportMailbox(r, mailbox, func(msg *db.Message, data []byte) error {
+		return mw.Write(&mbox.Message{
+			From:  exportSender(msg),
+			Date:  msg.InternalDate,
+			Flags: messageFlags(msg),
+			Data:  data,
+		})
+	})
+}
+
+// exportMailboxAsEML writes the messages of a mailbox as .eml files to a zip
+// archive. It returns a line for every message that could not be read.
+func (s *Server) exportMailboxAsEML(r *http.Request, zw *zip.Writer, mailbox *db.DBMailbox) ([]string, error) {
+	return s.exportMailbox(r, mailbox, func(msg *db.Message, data []byte) error {
+		flags := make([]string, 0, len(msg.CustomFlags)+4)
+		for _, flag := range messageFlags(msg) {
+			flags = append(flags, string(flag))
+		}
+		entry, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     fmt.Sprintf("%s/%d.eml", mailbox.Name, msg.UID),
+			Method:   zip.Deflate,
+			Modified: msg.InternalDate,
+			Comment:  strings.Join(flags, " "),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = entry.Write(data)
+		return err
+	})
+}
+
+// exportMailbox calls write for every message of a mailbox, in UID order.
+// Messages whose content cannot be read are skipped and returned as lines
+// for exportErrorsFile; errors of write end the export.
+func (s *Server) exportMailbox(r *http.Request, mailbox *db.DBMailbox, write func(msg *db.Message, data []byte) error) ([]string, error) {
+	ctx := r.Context()
+
+	seqSet := imap.SeqSet{}
+	seqSet.AddRange(1, 0) // 1:* means all messages
+	messages, err := s.rdb.GetMessagesByNumSetWithRetry(ctx, mailbox.ID, seqSet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages of %s: %w", mailbox.Name, err)
+	}
+
+	var skipped []string
+	for i := range messages {
+		msg := &messages[i]
+		data, err := s.messageContent(msg)
+		if err != nil {
+			logger.Warn("HTTP Mail API: Skipping message in export", "name", s.name, "mailbox", mailbox.Name, "uid", msg.UID, "error", err)
+			skipped = append(skipped, fmt.Sprintf("%s/%d: %v", mailbox.Name, msg.UID, err))
+			continue
+		}
+		if err := write(msg, data); err != nil {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return skipped, nil
+}
+
+// messageContent returns the raw content of a message from the cache, the
+// object storage or, before it is uploaded, the local disk.
+func (s *Server) messageContent(msg *db.Message) ([]byte, error) {
+	if s.cache != nil {
+		if data, err := s.cache.Get(msg.ContentHash); err == nil && data != nil {
+			return data, nil
+		}
+	}
+
+	if !msg.IsUploaded {
+		if s.uploader == nil {
+			return nil, errors.New("message not yet uploaded")
+		}
+		return os.ReadFile(s.uploader.FilePath(msg.ContentHash, msg.AccountID))
+	}
+
+	reader, err := s.storage.Get(helpers.NewS3Key(msg.S3Domain, msg.S3Localpart, msg.ContentHash))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if s.cache != nil {
+		if err := s.cache.Put(msg.ContentHash, data); err != nil {
+			logger.Debug("HTTP Mail API: Failed to cache message", "name", s.name, "error", err)
+		}
+	}
+	return data, nil
+}
+
+// abortExport ends an export that fails after the response started. The
+// connection is closed without finishing the response, so that clients do
+// not mistake a truncated export for a complete one.
+func (s *Server) abortExport(accountID int64, err error) {
+	logger.Warn("HTTP Mail API: Export failed", "name", s.name, "account_id", accountID, "error", err)
+	panic(http.ErrAbortHandler)
+}
+
+// messageFlags returns the system and custom flags of a message.
+func messageFlags(msg *db.Message) []imap.Flag {
+	flags := db.BitwiseToFlags(msg.BitwiseFlags)
+	for _, keyword := range msg.CustomFlags {
+		flags = append(flags, imap.Flag(keyword))
+	}
+	return flags
+}
+
+// exportSender returns the sender for the From line of an mbox file.
+func exportSender(msg *db.Message) string {
+	var recipients []helpers.Recipient
+	if len(msg.RecipientsJSON) > 0 && json.Unmarshal(msg.RecipientsJSON, &recipients) == nil {
+		for _, recipient := range recipients {
+			if recipient.AddressType == "from" && recipient.EmailAddress != "" {
+				return recipient.EmailAddress
+			}
+		}
+	}
+	return ""
+}
+
+// exportFileName turns a mailbox name into a download file name.
+func exportFileName(mailboxName string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == '"' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, mailboxName)
+}
@@ -0,0 +1,434 @@
+package userapi
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-message"
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/mbox"
+	"github.com/migadu/sora/server/delivery"
+)
+
+const (
+	// importPollInterval is how often the worker looks for imports uploaded
+	// to other servers, or abandoned by them.
+	importPollInterval = 30 * time.Second
+	// importLeaseTimeout is how long a running import may go without a
+	// heartbeat before another server takes it over.
+	importLeaseTimeout = 5 * time.Minute
+	// importProgressInterval is how often progress is stored. It must be
+	// well below importLeaseTimeout, as it is also the heartbeat.
+	importProgressInterval = 10 * time.Second
+	// maxImportAttempts is how often an import is started before it fails.
+	maxImportAttempts = 5
+	// maxConsecutiveImportFailures ends a run when messages keep failing,
+	// which points at the database rather than at the messages. The import
+	// resumes once its lease expires.
+	maxConsecutiveImportFailures = 20
+)
+
+// errImportStopped ends a run whose import was cancelled or taken over.
+var errImportStopped = errors.New("import stopped")
+
+// importMessage is a message read from an uploaded archive.
+type importMessage struct {
+	Mailbox      string
+	Flags        []imap.Flag
+	InternalDate time.Time
+	Data         []byte
+	Err          error // The message could not be read, for example because it is too large
+}
+
+// importLogger adapts delivery logging to the structured logger.
+type importLogger struct {
+	importID int64
+}
+
+func (l *importLogger) Log(format string, args ...any) {
+	logger.Debug("HTTP Mail API: Import delivery", "import_id", l.importID, "msg", fmt.Sprintf(format, args...))
+}
+
+// runImportWorker claims and runs imports until ctx is done. Every server
+// running the user API runs a worker; the database hands each import to one
+// of them and to another one if its server stops.
+func (s *Server) runImportWorker(ctx context.Context) {
+	ticker := time.NewTicker(importPollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.processImports(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.importWake:
+		}
+	}
+}
+
+// processImports runs claimable imports one after the other.
+func (s *Server) processImports(ctx context.Context) {
+	for ctx.Err() == nil {
+		imp, err := s.rdb.ClaimMessageImportWithRetry(ctx, s.importInstanceID(), time.Now().Add(-importLeaseTimeout))
+		if err != nil {
+			if !errors.Is(err, consts.ErrDBNotFound) && ctx.Err() == nil {
+				logger.Warn("HTTP Mail API: Failed to claim import", "name", s.name, "error", err)
+			}
+			return
+		}
+		s.runImport(ctx, imp)
+	}
+}
+
+// runImport imports the messages of a claimed import, skipping those an
+// earlier run already processed.
+func (s *Server) runImport(ctx context.Context, imp *db.MessageImport) {
+	log := func(msg string, args ...any) {
+		logger.Info("HTTP Mail API: "+msg, append([]any{"name", s.name, "import_id", imp.ID, "account_id", imp.AccountID}, args...)...)
+	}
+	progress := imp.MessageImportProgress
+
+	if imp.Attempts > maxImportAttempts {
+		s.finishImport(imp, db.MessageImportFailed, progress, fmt.Sprintf("import stopped after %d attempts", maxImportAttempts))
+		return
+	}
+	log("Running import", "attempt", imp.Attempts, "resume_after", progress.Processed)
+
+	file, err := s.downloadImportArchive(imp.S3Key)
+	if err != nil {
+		// Retried once the lease expires
+		logger.Warn("HTTP Mail API: Failed to download import archive", "name", s.name, "import_id", imp.ID, "error", err)
+		return
+	}
+	defer removeTempFile(file)
+
+	if progress.Total == nil {
+		total := 0
+		if err := s.readImportArchive(file, imp, func(importMessage) error { total++; return nil }); err != nil {
+			s.finishImport(imp, db.MessageImportFailed, progress, fmt.Sprintf("invalid archive: %v", err))
+			return
+		}
+		progress.Total = &total
+	}
+
+	primaryAddr, err := s.rdb.GetPrimaryEmailForAccountWithRetry(ctx, imp.AccountID)
+	if err != nil {
+		logger.Warn("HTTP Mail API: Failed to get account of import", "name", s.name, "import_id", imp.ID, "error", err)
+		return
+	}
+	if err := s.rdb.CreateDefaultMailboxesWithRetry(ctx, imp.AccountID); err != nil {
+		logger.Warn("HTTP Mail API: Failed to create default mailboxes for import", "name", s.name, "import_id", imp.ID, "error", err)
+		return
+	}
+
+	deliveryCtx := &delivery.DeliveryContext{
+		Ctx:          ctx,
+		RDB:          s.rdb,
+		Uploader:     s.uploader,
+		Hostname:     s.hostname,
+		FTSRetention: s.ftsRetention,
+		MetricsLabel: "http_import",
+		Logger:       &importLogger{importID: imp.ID},
+	}
+	mailboxes := map[string]bool{}
+	index := 0
+	consecutiveFailures := 0
+	lastSaved := time.Now()
+
+	err = s.readImportArchive(file, imp, func(m importMessage) error {
+		index++
+		if index <= imp.Processed {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := m.Err
+		if err == nil {
+			_, err = message.Read(bytes.NewReader(m.Data))
+		}
+		if err == nil {
+			err = s.ensureImportMailbox(ctx, imp.AccountID, m.Mailbox, mailboxes)
+		}
+		if err == nil {
+			_, err = deliveryCtx.DeliverMessage(delivery.RecipientInfo{
+				AccountID:     imp.AccountID,
+				Address:       &primaryAddr,
+				ToAddress:     &primaryAddr,
+				TargetMailbox: m.Mailbox,
+				Flags:         m.Flags,
+				InternalDate:  m.InternalDate,
+			}, m.Data)
+		}
+
+		switch {
+		case err == nil:
+			progress.Imported++
+			consecutiveFailures = 0
+		case errors.Is(err, consts.ErrMessageExists) || errors.Is(err, consts.ErrDBUniqueViolation):
+			progress.Duplicates++
+			consecutiveFailures = 0
+		case errors.Is(err, consts.ErrQuotaExceeded):
+			return err
+		case ctx.Err() != nil:
+			return ctx.Err()
+		default:
+			logger.Debug("HTTP Mail API: Failed to import message", "name", s.name, "import_id", imp.ID, "index", index, "error", err)
+			progress.Failed++
+			consecutiveFailures++
+			if consecutiveFailures >= maxConsecutiveImportFailures {
+				return fmt.Errorf("%d messages in a row failed, last error: %w", consecutiveFailures, err)
+			}
+		}
+		progress.Processed = index
+
+		if time.Since(lastSaved) >= importProgressInterval {
+			lastSaved = time.Now()
+			if err := s.rdb.UpdateMessageImportProgressWithRetry(ctx, imp.ID, s.importInstanceID(), progress); err != nil {
+				if errors.Is(err, consts.ErrDBNotFound) {
+					return errImportStopped
+				}
+				logger.Warn("HTTP Mail API: Failed to store import progress", "name", s.name, "import_id", imp.ID, "error", err)
+			}
+		}
+		return nil
+	})
+
+	switch {
+	case err == nil:
+		log("Import completed", "imported", progress.Imported, "duplicates", progress.Duplicates, "failed", progress.Failed)
+		s.finishImport(imp, db.MessageImportCompleted, progress, "")
+	case errors.Is(err, consts.ErrQuotaExceeded):
+		s.finishImport(imp, db.MessageImportFailed, progress, "mailbox full, the account quota is exceeded")
+	case errors.Is(err, errImportStopped):
+		s.stoppedImport(imp)
+	case ctx.Err() != nil:
+		// Shutting down: store the progress so that the next run resumes
+		// from here once the lease expires
+		saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.rdb.UpdateMessageImportProgressWithRetry(saveCtx, imp.ID, s.importInstanceID(), progress); err != nil && !errors.Is(err, consts.ErrDBNotFound) {
+			logger.Warn("HTTP Mail API: Failed to store import progress", "name", s.name, "import_id", imp.ID, "error", err)
+		}
+	default:
+		// Retried once the lease expires, up to maxImportAttempts
+		logger.Warn("HTTP Mail API: Import interrupted", "name", s.name, "import_id", imp.ID, "processed", progress.Processed, "error", err)
+		if err := s.rdb.UpdateMessageImportProgressWithRetry(ctx, imp.ID, s.importInstanceID(), progress); err != nil && !errors.Is(err, consts.ErrDBNotFound) {
+			logger.Warn("HTTP Mail API: Failed to store import progress", "name", s.name, "import_id", imp.ID, "error", err)
+		}
+	}
+}
+
+// finishImport ends an import and removes its archive.
+func (s *Server) finishImport(imp *db.MessageImport, status string, progress db.MessageImportProgress, errMsg string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := s.rdb.FinishMessageImportWithRetry(ctx, imp.ID, s.importInstanceID(), status, progress, errMsg); err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			s.stoppedImport(imp)
+			return
+		}
+		logger.Warn("HTTP Mail API: Failed to finish import", "name", s.name, "import_id", imp.ID, "error", err)
+		return
+	}
+	if status == db.MessageImportFailed {
+		logger.Warn("HTTP Mail API: Import failed", "name", s.name, "import_id", imp.ID, "account_id", imp.AccountID, "error", errMsg)
+	}
+	s.deleteImportArchive(imp.S3Key)
+}
+
+// stoppedImport handles an import that was cancelled, or taken over by
+// another server, while it ran. Only the archive of a cancelled import is
+// removed.
+func (s *Server) stoppedImport(imp *db.MessageImport) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	current, err := s.rdb.GetMessageImportWithRetry(ctx, imp.AccountID, imp.ID)
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			// The account was deleted
+			s.deleteImportArchive(imp.S3Key)
+		}
+		return
+	}
+	if current.Status == db.MessageImportCancelled {
+		logger.Info("HTTP Mail API: Import cancelled", "name", s.name, "import_id", imp.ID, "account_id", imp.AccountID)
+		s.deleteImportArchive(imp.S3Key)
+	}
+}
+
+// downloadImportArchive copies an uploaded archive to a temporary file.
+func (s *Server) downloadImportArchive(s3Key string) (*os.File, error) {
+	reader, err := s.storage.Get(s3Key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	file, _, err := spoolUpload(reader)
+	return file, err
+}
+
+// readImportArchive calls fn for every message of an archive, in a stable
+// order so that an interrupted import can skip the messages it processed.
+// Errors of fn end the reading; messages that cannot be read are passed to
+// fn with Err set.
+func (s *Server) readImportArchive(file *os.File, imp *db.MessageImport, fn func(importMessage) error) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if imp.Format == db.MessageImportFormatMbox {
+		return s.readImportMbox(file, imp.Mailbox, fn)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	archive, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range archive.File {
+		name := entry.Name
+		base := path.Base(name)
+		if entry.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(base, ".") {
+			continue
+		}
+
+		switch strings.ToLower(path.Ext(name)) {
+		case ".eml":
+			mailbox := normalizeImportMailbox(path.Dir(name))
+			if mailbox == "" || mailbox == "." {
+				mailbox = imp.Mailbox
+			}
+			m := importMessage{Mailbox: mailbox, InternalDate: entry.Modified}
+			for _, flag := range strings.Fields(entry.Comment) {
+				m.Flags = append(m.Flags, imap.Flag(flag))
+			}
+			m.Data, m.Err = s.readImportEntry(entry)
+			if err := fn(m); err != nil {
+				return err
+			}
+		case ".mbox":
+			mailbox := normalizeImportMailbox(strings.TrimSuffix(name, path.Ext(name)))
+			if mailbox == "" {
+				mailbox = imp.Mailbox
+			}
+			reader, err := entry.Open()
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			err = s.readImportMbox(reader, mailbox, fn)
+			reader.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// readImportMbox calls fn for every message of an mbox file.
+func (s *Server) readImportMbox(r io.Reader, mailbox string, fn func(importMessage) error) error {
+	reader := mbox.NewReader(r)
+	reader.MaxMessageSize = s.maxMessageSize
+	for {
+		msg, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && !errors.Is(err, mbox.ErrMessageTooLarge) {
+			return err
+		}
+
+		m := importMessage{Mailbox: mailbox, Err: err}
+		if msg != nil {
+			m.Flags, m.InternalDate, m.Data = msg.Flags, msg.Date, msg.Data
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+}
+
+// readImportEntry reads an .eml file of a zip archive with CRLF line endings.
+func (s *Server) readImportEntry(entry *zip.File) ([]byte, error) {
+	if entry.UncompressedSize64 > uint64(s.maxMessageSize) {
+		return nil, fmt.Errorf("%w: %d bytes", mbox.ErrMessageTooLarge, entry.UncompressedSize64)
+	}
+	reader, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, s.maxMessageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.maxMessageSize {
+		return nil, fmt.Errorf("%w: more than %d bytes", mbox.ErrMessageTooLarge, s.maxMessageSize)
+	}
+	return toCRLF(data), nil
+}
+
+// ensureImportMailbox creates a mailbox and its parents if they are missing.
+// created caches the mailboxes known to exist.
+func (s *Server) ensureImportMailbox(ctx context.Context, accountID int64, name string, created map[string]bool) error {
+	if created[name] {
+		return nil
+	}
+
+	var parentID *int64
+	parts := strings.Split(name, string(consts.MailboxDelimiter))
+	for i := range parts {
+		prefix := strings.Join(parts[:i+1], string(consts.MailboxDelimiter))
+		mailbox, err := s.rdb.GetMailboxByNameWithRetry(ctx, accountID, prefix)
+		if errors.Is(err, consts.ErrMailboxNotFound) {
+			err = s.rdb.CreateMailboxWithRetry(ctx, accountID, prefix, parentID)
+			if err != nil && !errors.Is(err, consts.ErrDBUniqueViolation) {
+				return fmt.Errorf("failed to create mailbox %s: %w", prefix, err)
+			}
+			mailbox, err = s.rdb.GetMailboxByNameWithRetry(ctx, accountID, prefix)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get mailbox %s: %w", prefix, err)
+		}
+		parentID = &mailbox.ID
+	}
+	created[name] = true
+	return nil
+}
+
+// toCRLF converts bare LF line endings to CRLF.
+func toCRLF(data []byte) []byte {
+	if !bytes.Contains(data, []byte("\n")) || bytes.Count(data, []byte("\n")) == bytes.Count(data, []byte("\r\n")) {
+		return data
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(data) + len(data)/40)
+	for i, c := range data {
+		if c == '\n' && (i == 0 || data[i-1] != '\r') {
+			buf.WriteByte('\r')
+		}
+		buf.WriteByte(c)
+	}
+	return buf.Bytes()
+}
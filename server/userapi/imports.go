@@ -0,0 +1,313 @@
+package userapi
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/db"
+	"github.com/migadu/sora/logger"
+)
+
+// importS3Prefix is the object storage prefix of uploaded archives.
+const importS3Prefix = "imports/"
+
+// importsEnabled reports whether the server can import messages: uploaded
+// archives are kept in the object storage and messages are stored through
+// the uploader like delivered mail.
+func (s *Server) importsEnabled() bool {
+	return s.storage != nil && s.uploader != nil
+}
+
+// handleCreateImport handles POST /user/imports. The body is an mbox file
+// (format=mbox) or a zip archive of .eml and .mbox files (format=zip), see
+// handleExport. Messages of an mbox file and .eml files at the top of a zip
+// archive go to the mailbox parameter, INBOX by default. The archive is
+// imported in the background; the response describes the import, whose
+// progress is polled with GET /user/imports/{id}.
+func (s *Server) handleCreateImport(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	accountID, err := getAccountIDFromContext(ctx)
+	if err != nil {
+		s.writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if !s.importsEnabled() {
+		s.writeError(w, http.StatusServiceUnavailable, "Imports are not available on this server")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != db.MessageImportFormatMbox && format != db.MessageImportFormatZip {
+		s.writeError(w, http.StatusBadRequest, "Invalid format, must be mbox or zip")
+		return
+	}
+	mailbox := normalizeImportMailbox(r.URL.Query().Get("mailbox"))
+	if mailbox == "" {
+		mailbox = consts.MailboxInbox
+	}
+
+	// Refuse a second import before receiving the upload; the database
+	// enforces this again when the import is created
+	imports, err := s.rdb.ListMessageImportsWithRetry(ctx, accountID)
+	if err != nil {
+		logger.Warn("HTTP Mail API: Error listing imports", "name", s.name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to create import")
+		return
+	}
+	for _, imp := range imports {
+		if imp.Status == db.MessageImportPending || imp.Status == db.MessageImportRunning {
+			s.writeError(w, http.StatusConflict, "An import is already in progress")
+			return
+		}
+	}
+
+	// Uploads take longer than the timeouts of the server
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		logger.Debug("HTTP Mail API: Cannot extend read deadline for import", "name", s.name, "error", err)
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		logger.Debug("HTTP Mail API: Cannot extend write deadline for import", "name", s.name, "error", err)
+	}
+
+	file, size, err := spoolUpload(http.MaxBytesReader(w, r.Body, s.maxImportSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			s.writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload is larger than %d bytes", s.maxImportSize))
+			return
+		}
+		logger.Warn("HTTP Mail API: Error receiving import", "name", s.name, "error", err)
+		s.writeError(w, http.StatusBadRequest, "Failed to receive upload")
+		return
+	}
+	defer removeTempFile(file)
+
+	if err := checkImportArchive(file, size, format); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid %s upload: %v", format, err))
+		return
+	}
+
+	suffix := make([]byte, 16)
+	if _, err := rand.Read(suffix); err != nil {
+		s.writeError(w, http.StatusInternalServerError, "Failed to create import")
+		return
+	}
+	s3Key := fmt.Sprintf("%s%d/%s", importS3Prefix, accountID, hex.EncodeToString(suffix))
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		s.writeError(w, http.StatusInternalServerError, "Failed to create import")
+		return
+	}
+	if err := s.storage.Put(s3Key, file, size); err != nil {
+		logger.Warn("HTTP Mail API: Error storing import", "name", s.name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to store upload")
+		return
+	}
+
+	imp, err := s.rdb.CreateMessageImportWithRetry(ctx, db.MessageImport{
+		AccountID: accountID,
+		Format:    format,
+		Mailbox:   mailbox,
+		S3Key:     s3Key,
+		Size:      size,
+	})
+	if err != nil {
+		s.deleteImportArchive(s3Key)
+		if errors.Is(err, consts.ErrImportInProgress) {
+			s.writeError(w, http.StatusConflict, "An import is already in progress")
+			return
+		}
+		logger.Warn("HTTP Mail API: Error creating import", "name", s.name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to create import")
+		return
+	}
+
+	select {
+	case s.importWake <- struct{}{}:
+	default:
+	}
+
+	logger.Info("HTTP Mail API: Import uploaded", "name", s.name, "account_id", accountID, "import_id", imp.ID, "format", format, "size", size)
+	s.writeJSON(w, http.StatusAccepted, imp)
+}
+
+// handleListImports handles GET /user/imports
+func (s *Server) handleListImports(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	accountID, err := getAccountIDFromContext(ctx)
+	if err != nil {
+		s.writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	imports, err := s.rdb.ListMessageImportsWithRetry(ctx, accountID)
+	if err != nil {
+		logger.Warn("HTTP Mail API: Error listing imports", "name", s.name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to list imports")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"imports": imports,
+	})
+}
+
+// handleGetImport handles GET /user/imports/{id}
+func (s *Server) handleGetImport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	accountID, err := getAccountIDFromContext(ctx)
+	if err != nil {
+		s.writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	id, err := strconv.ParseInt(extractPathParam(r.URL.Path, "/user/imports/", ""), 10, 64)
+	if err != nil || id <= 0 {
+		s.writeError(w, http.StatusBadRequest, "Invalid import ID")
+		return
+	}
+
+	imp, err := s.rdb.GetMessageImportWithRetry(ctx, accountID, id)
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			s.writeError(w, http.StatusNotFound, "Import not found")
+			return
+		}
+		logger.Warn("HTTP Mail API: Error getting import", "name", s.name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to get import")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, imp)
+}
+
+// handleCancelImport handles DELETE /user/imports/{id}. Messages imported
+// so far are kept.
+func (s *Server) handleCancelImport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	accountID, err := getAccountIDFromContext(ctx)
+	if err != nil {
+		s.writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	id, err := strconv.ParseInt(extractPathParam(r.URL.Path, "/user/imports/", ""), 10, 64)
+	if err != nil || id <= 0 {
+		s.writeError(w, http.StatusBadRequest, "Invalid import ID")
+		return
+	}
+
+	imp, err := s.rdb.CancelMessageImportWithRetry(ctx, accountID, id)
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			s.writeError(w, http.StatusNotFound, "No pending or running import with this ID")
+			return
+		}
+		logger.Warn("HTTP Mail API: Error cancelling import", "name", s.name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to cancel import")
+		return
+	}
+
+	// A running import removes its archive when it notices the cancellation
+	if imp.Status == db.MessageImportPending && s.storage != nil {
+		s.deleteImportArchive(imp.S3Key)
+	}
+
+	logger.Info("HTTP Mail API: Import cancelled", "name", s.name, "account_id", accountID, "import_id", id)
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"message": "Import cancelled successfully",
+		"id":      id,
+	})
+}
+
+// deleteImportArchive removes an uploaded archive from the object storage.
+// Failures are only logged.
+func (s *Server) deleteImportArchive(s3Key string) {
+	if err := s.storage.Delete(s3Key); err != nil {
+		logger.Warn("HTTP Mail API: Failed to delete import archive", "name", s.name, "key", s3Key, "error", err)
+	}
+}
+
+// spoolUpload copies an upload to a temporary file and returns it with its
+// size. The caller removes the file with removeTempFile.
+func spoolUpload(r io.Reader) (*os.File, int64, error) {
+	file, err := os.CreateTemp("", "sora-import-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := io.Copy(file, r)
+	if err != nil {
+		removeTempFile(file)
+		return nil, 0, err
+	}
+	return file, size, nil
+}
+
+func removeTempFile(file *os.File) {
+	file.Close()
+	os.Remove(file.Name())
+}
+
+// checkImportArchive checks that an upload looks like an archive of the
+// given format, so that obviously wrong uploads are refused right away.
+func checkImportArchive(file *os.File, size int64, format string) error {
+	if format == db.MessageImportFormatZip {
+		_, err := zip.NewReader(file, size)
+		return err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(io.LimitReader(file, 64*1024))
+	scanner.Buffer(make([]byte, 64*1024), 64*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if !bytes.HasPrefix(scanner.Bytes(), []byte("From ")) {
+			return errors.New("not an mbox file")
+		}
+		return nil
+	}
+	return errors.New("no messages")
+}
+
+// normalizeImportMailbox cleans a mailbox name taken from an upload.
+func normalizeImportMailbox(name string) string {
+	parts := strings.Split(strings.Trim(strings.TrimSpace(name), "/"), "/")
+	clean := parts[:0]
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			clean = append(clean, part)
+		}
+	}
+	if len(clean) > 0 && strings.EqualFold(clean[0], consts.MailboxInbox) {
+		clean[0] = consts.MailboxInbox
+	}
+	return strings.Join(clean, "/")
+}
+
+// importInstanceID identifies this server in claimed imports.
+func (s *Server) importInstanceID() string {
+	return s.hostname + "/" + s.name
+}
@@ -16,6 +16,8 @@ import (
 	"github.com/migadu/sora/pkg/lookupcache"
 	"github.com/migadu/sora/pkg/resilient"
 	"github.com/migadu/sora/server"
+	"github.com/migadu/sora/server/managesieve"
+	"github.com/migadu/sora/server/uploader"
 	"github.com/migadu/sora/storage"
 )
 
@@ -26,10 +28,11 @@ type Server struct {
 	jwtSecret                  string
 	tokenDuration              time.Duration
 	tokenIssuer                string
+	totpIssuer                 string
 	allowedOrigins             []string
 	allowedHosts               []string
 	rdb                        *resilient.ResilientDatabase
-	storage                    *storage.S3Storage
+	storage                    storage.BlobStore
 	cache                      *cache.Cache
 	authCache                  *lookupcache.LookupCache
 	positiveRevalidationWindow time.Duration
@@ -40,6 +43,20 @@ type Server struct {
 	tlsCertFile                string
 	tlsKeyFile                 string
 	tlsVerify                  bool
+	connectionTrackers         map[string]*server.ConnectionTracker // protocol -> tracker (for kicks on revocation)
+
+	// Message imports
+	uploader       *uploader.UploadWorker
+	hostname       string
+	ftsRetention   time.Duration
+	maxImportSize  int64
+	maxMessageSize int64
+	importWake     chan struct{} // Wakes the import worker when an import is uploaded
+
+	// Sieve script limits per account
+	maxScriptSize       int64
+	maxScripts          int
+	supportedExtensions []string // Sieve extensions enabled on the server
 }
 
 // ServerOptions holds configuration options for the HTTP Mail API server
@@ -51,7 +68,8 @@ type ServerOptions struct {
 	TokenIssuer    string
 	AllowedOrigins []string
 	AllowedHosts   []string
-	Storage        *storage.S3Storage
+	TOTPIssuer     string // Issuer shown in authenticator apps
+	Storage        storage.BlobStore
 	Cache          *cache.Cache
 	AuthRateLimit  server.AuthRateLimiterConfig
 	LookupCache    *config.LookupCacheConfig // Authentication cache configuration
@@ -60,6 +78,20 @@ type ServerOptions struct {
 	TLSCertFile    string
 	TLSKeyFile     string
 	TLSVerify      bool
+
+	ConnectionTrackers map[string]*server.ConnectionTracker // Used to kick sessions when an app password is revoked
+
+	// Message imports are only available with an uploader and storage
+	Uploader       *uploader.UploadWorker
+	Hostname       string
+	FTSRetention   time.Duration
+	MaxImportSize  int64 // Maximum size of an uploaded archive
+	MaxMessageSize int64 // Maximum size of a message in an archive
+
+	MaxScriptSize int64 // Maximum size of a Sieve script
+	MaxScripts    int   // Maximum number of Sieve scripts per account (0 = unlimited)
+
+	SupportedExtensions []string // Sieve extensions scripts may use, restricted by domain policy (nil = all, as ManageSieve)
 }
 
 // New creates a new HTTP Mail API server
@@ -76,6 +108,22 @@ func New(rdb *resilient.ResilientDatabase, options ServerOptions) (*Server, erro
 		options.TokenIssuer = "sora-mail-api"
 	}
 
+	if options.TOTPIssuer == "" {
+		options.TOTPIssuer = "Sora"
+	}
+
+	if options.MaxImportSize == 0 {
+		options.MaxImportSize = 1024 * 1024 * 1024 // Default to 1GB
+	}
+
+	if options.MaxMessageSize == 0 {
+		options.MaxMessageSize = 50 * 1024 * 1024 // Default to 50MB
+	}
+
+	if options.MaxScriptSize == 0 {
+		options.MaxScriptSize = 16 * 1024 // Default to 16KB, as ManageSieve
+	}
+
 	// Validate TLS configuration
 	if options.TLS {
 		// If TLSConfig is provided (from manager), use it. Otherwise require cert files.
@@ -136,6 +184,7 @@ func New(rdb *resilient.ResilientDatabase, options ServerOptions) (*Server, erro
 		jwtSecret:                  options.JWTSecret,
 		tokenDuration:              options.TokenDuration,
 		tokenIssuer:                options.TokenIssuer,
+		totpIssuer:                 options.TOTPIssuer,
 		allowedOrigins:             options.AllowedOrigins,
 		allowedHosts:               options.AllowedHosts,
 		rdb:                        rdb,
@@ -149,6 +198,21 @@ func New(rdb *resilient.ResilientDatabase, options ServerOptions) (*Server, erro
 		tlsCertFile:                options.TLSCertFile,
 		tlsKeyFile:                 options.TLSKeyFile,
 		tlsVerify:                  options.TLSVerify,
+		connectionTrackers:         options.ConnectionTrackers,
+		uploader:                   options.Uploader,
+		hostname:                   options.Hostname,
+		ftsRetention:               options.FTSRetention,
+		maxImportSize:              options.MaxImportSize,
+		maxMessageSize:             options.MaxMessageSize,
+		importWake:                 make(chan struct{}, 1),
+		maxScriptSize:              options.MaxScriptSize,
+		maxScripts:                 options.MaxScripts,
+		supportedExtensions:        options.SupportedExtensions,
+	}
+
+	// Use all supported extensions by default if none are configured, as ManageSieve
+	if len(s.supportedExtensions) == 0 {
+		s.supportedExtensions = managesieve.SupportedExtensions
 	}
 
 	return s, nil
@@ -168,6 +232,22 @@ func (s *Server) ReloadConfig(cfg config.ServerConfig) error {
 		reloaded = append(reloaded, "allowed_hosts")
 	}
 
+	if cfg.MaxImportSize != "" {
+		if size, err := cfg.GetMaxImportSize(); err == nil {
+			s.maxImportSize = size
+			reloaded = append(reloaded, "max_import_size")
+		}
+	}
+
+	if size := cfg.GetMaxScriptSizeWithDefault(); size != s.maxScriptSize {
+		s.maxScriptSize = size
+		reloaded = append(reloaded, "max_script_size")
+	}
+	if cfg.MaxScripts != s.maxScripts {
+		s.maxScripts = cfg.MaxScripts
+		reloaded = append(reloaded, "max_scripts")
+	}
+
 	if len(reloaded) > 0 {
 		logger.Info("User API config reloaded", "name", s.name, "updated", reloaded)
 	}
@@ -210,6 +290,10 @@ func (s *Server) start(ctx context.Context) error {
 		IdleTimeout:  120 * time.Second,
 	}
 
+	if s.importsEnabled() {
+		go s.runImportWorker(ctx)
+	}
+
 	// Graceful shutdown
 	go func() {
 		<-ctx.Done()
@@ -263,6 +347,7 @@ func (s *Server) SetupRoutes() http.Handler {
 	// Public routes (no authentication required)
 	mux.HandleFunc("/user/auth/login", routeHandler("POST", s.handleLogin))
 	mux.HandleFunc("/user/auth/refresh", routeHandler("POST", s.handleRefreshToken))
+	mux.HandleFunc("/user/auth/totp", routeHandler("POST", s.handleTOTPLogin))
 
 	// Mailbox operations
 	mux.Handle("/user/mailboxes", s.jwtAuthMiddleware(multiMethodHandler(map[string]http.HandlerFunc{
@@ -278,6 +363,31 @@ func (s *Server) SetupRoutes() http.Handler {
 	mux.Handle("/user/filters", s.jwtAuthMiddleware(routeHandler("GET", s.handleListFilters)))
 	mux.Handle("/user/filters/", s.jwtAuthMiddleware(http.HandlerFunc(s.handleFilterOperations)))
 
+	// App password operations
+	mux.Handle("/user/app-passwords", s.jwtAuthMiddleware(multiMethodHandler(map[string]http.HandlerFunc{
+		"GET":  s.handleListAppPasswords,
+		"POST": s.handleCreateAppPassword,
+	})))
+	mux.Handle("/user/app-passwords/", s.jwtAuthMiddleware(routeHandler("DELETE", s.handleDeleteAppPassword)))
+
+	// Export and import
+	mux.Handle("/user/export", s.jwtAuthMiddleware(routeHandler("GET", s.handleExport)))
+	mux.Handle("/user/imports", s.jwtAuthMiddleware(multiMethodHandler(map[string]http.HandlerFunc{
+		"GET":  s.handleListImports,
+		"POST": s.handleCreateImport,
+	})))
+	mux.Handle("/user/imports/", s.jwtAuthMiddleware(multiMethodHandler(map[string]http.HandlerFunc{
+		"GET":    s.handleGetImport,
+		"DELETE": s.handleCancelImport,
+	})))
+
+	// TOTP second factor
+	mux.Handle("/user/totp", s.jwtAuthMiddleware(routeHandler("GET", s.handleGetTOTP)))
+	mux.Handle("/user/totp/setup", s.jwtAuthMiddleware(routeHandler("POST", s.handleSetupTOTP)))
+	mux.Handle("/user/totp/enable", s.jwtAuthMiddleware(routeHandler("POST", s.handleEnableTOTP)))
+	mux.Handle("/user/totp/disable", s.jwtAuthMiddleware(routeHandler("POST", s.handleDisableTOTP)))
+	mux.Handle("/user/totp/recovery-codes", s.jwtAuthMiddleware(routeHandler("POST", s.handleRegenerateRecoveryCodes)))
+
 	// Wrap with middleware (in reverse order - last applied is outermost)
 	handler := s.loggingMiddleware(mux)
 	handler = s.corsMiddleware(handler)
@@ -1,14 +1,17 @@
 package userapi
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 
 	"github.com/migadu/sora/logger"
 
 	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/pkg/sieveext"
 )
 
 // SieveScriptResponse represents a Sieve script in API responses
@@ -144,6 +147,45 @@ func (s *Server) handlePutFilter(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if int64(len(req.Script)) > s.maxScriptSize {
+		s.writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Script size %d exceeds maximum allowed size %d", len(req.Script), s.maxScriptSize))
+		return
+	}
+
+	// Scripts may only use the Sieve extensions allowed for the domain, as
+	// with ManageSieve
+	extensions, err := s.sieveExtensions(ctx, accountID)
+	if err != nil {
+		logger.Warn("HTTP Mail API: Error retrieving domain policy", "name", s.name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to save script")
+		return
+	}
+	if _, _, err := sieveext.Load(req.Script, extensions); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("Script validation failed: %v", err))
+		return
+	}
+
+	// Replacing an existing script does not count against the script limit
+	if s.maxScripts > 0 {
+		if _, err := s.rdb.GetScriptByNameWithRetry(ctx, name, accountID); err != nil {
+			if !errors.Is(err, consts.ErrDBNotFound) {
+				logger.Warn("HTTP Mail API: Error retrieving Sieve script", "name", s.name, "error", err)
+				s.writeError(w, http.StatusInternalServerError, "Failed to save script")
+				return
+			}
+			count, err := s.rdb.CountUserScriptsWithRetry(ctx, accountID)
+			if err != nil {
+				logger.Warn("HTTP Mail API: Error counting Sieve scripts", "name", s.name, "error", err)
+				s.writeError(w, http.StatusInternalServerError, "Failed to save script")
+				return
+			}
+			if count >= s.maxScripts {
+				s.writeError(w, http.StatusForbidden, fmt.Sprintf("Maximum number of scripts (%d) reached", s.maxScripts))
+				return
+			}
+		}
+	}
+
 	// Create or update script
 	script, err := s.rdb.CreateOrUpdateScriptWithRetry(ctx, accountID, name, req.Script)
 	if err != nil {
@@ -162,6 +204,24 @@ func (s *Server) handlePutFilter(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusOK, response)
 }
 
+// sieveExtensions returns the Sieve extensions that scripts of the account
+// may use: the extensions enabled on the server, restricted by the policy of
+// the domain of its primary address if the domain has one.
+func (s *Server) sieveExtensions(ctx context.Context, accountID int64) ([]string, error) {
+	primary, err := s.rdb.GetPrimaryEmailForAccountWithRetry(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	d, err := s.rdb.GetDomainWithRetry(ctx, primary.Domain())
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			return s.supportedExtensions, nil
+		}
+		return nil, err
+	}
+	return d.AllowedSieveExtensions(s.supportedExtensions), nil
+}
+
 // handleDeleteFilter deletes a Sieve script
 func (s *Server) handleDeleteFilter(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
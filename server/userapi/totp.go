@@ -0,0 +1,194 @@
+package userapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/migadu/sora/consts"
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/totp"
+)
+
+// TOTPCodeRequest carries a TOTP code or a recovery code
+type TOTPCodeRequest struct {
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+// handleGetTOTP returns the second factor status of the authenticated user
+func (s *Server) handleGetTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	accountID, err := getAccountIDFromContext(ctx)
+	if err != nil {
+		s.writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	status, err := s.rdb.GetTOTPStatusWithRetry(ctx, accountID)
+	if err != nil {
+		logger.Warn("HTTP Mail API: Error getting second factor status", "name", s.name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to get second factor status")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, status)
+}
+
+// handleSetupTOTP starts the enrolment of a TOTP second factor. It returns the
+// secret and an otpauth:// URL for the authenticator app; the second factor
+// is only enabled once handleEnableTOTP confirms a code.
+func (s *Server) handleSetupTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	accountID, err := getAccountIDFromContext(ctx)
+	if err != nil {
+		s.writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !s.requireAccountPassword(w, r) {
+		return
+	}
+
+	secret, err := s.rdb.BeginTOTPEnrolmentWithRetry(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, consts.ErrTOTPAlreadyEnabled) {
+			s.writeError(w, http.StatusConflict, "Second factor is already enabled")
+			return
+		}
+		logger.Warn("HTTP Mail API: Error starting second factor enrolment", "name", s.name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to set up second factor")
+		return
+	}
+
+	email, _ := ctx.Value(contextKeyEmail).(string)
+	s.writeJSON(w, http.StatusOK, map[string]string{
+		"secret":      secret,
+		"otpauth_url": totp.URL(s.totpIssuer, email, secret),
+	})
+}
+
+// handleEnableTOTP confirms a pending enrolment with a code from the
+// authenticator app and returns the recovery codes, which are only shown once.
+func (s *Server) handleEnableTOTP(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	accountID, err := getAccountIDFromContext(ctx)
+	if err != nil {
+		s.writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !s.requireAccountPassword(w, r) {
+		return
+	}
+
+	var req TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		s.writeError(w, http.StatusBadRequest, "Code is required")
+		return
+	}
+
+	recoveryCodes, err := s.rdb.EnableTOTPWithRetry(ctx, accountID, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, consts.ErrAuthenticationFailed):
+			s.writeError(w, http.StatusBadRequest, "Invalid code")
+		case errors.Is(err, consts.ErrDBNotFound):
+			s.writeError(w, http.StatusNotFound, "No second factor enrolment in progress")
+		case errors.Is(err, consts.ErrTOTPAlreadyEnabled):
+			s.writeError(w, http.StatusConflict, "Second factor is already enabled")
+		default:
+			logger.Warn("HTTP Mail API: Error enabling second factor", "name", s.name, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "Failed to enable second factor")
+		}
+		return
+	}
+
+	logger.Info("HTTP Mail API: Second factor enabled", "name", s.name, "account_id", accountID)
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"enabled":        true,
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// handleDisableTOTP removes the second factor after checking a current code
+// or a recovery code.
+func (s *Server) handleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	accountID, ok := s.verifyTOTPRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.rdb.DeleteTOTPWithRetry(r.Context(), accountID); err != nil && !errors.Is(err, consts.ErrDBNotFound) {
+		logger.Warn("HTTP Mail API: Error disabling second factor", "name", s.name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to disable second factor")
+		return
+	}
+
+	logger.Info("HTTP Mail API: Second factor disabled", "name", s.name, "account_id", accountID)
+	s.writeJSON(w, http.StatusOK, map[string]string{
+		"message": "Second factor disabled successfully",
+	})
+}
+
+// handleRegenerateRecoveryCodes replaces the recovery codes after checking a
+// current code or a recovery code.
+func (s *Server) handleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	accountID, ok := s.verifyTOTPRequest(w, r)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := s.rdb.RegenerateTOTPRecoveryCodesWithRetry(r.Context(), accountID)
+	if err != nil {
+		if errors.Is(err, consts.ErrDBNotFound) {
+			s.writeError(w, http.StatusNotFound, "Second factor is not enabled")
+			return
+		}
+		logger.Warn("HTTP Mail API: Error regenerating recovery codes", "name", s.name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to regenerate recovery codes")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// verifyTOTPRequest checks the code of a request that changes an enabled
+// second factor. It writes the error response and returns false on failure.
+func (s *Server) verifyTOTPRequest(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	accountID, err := getAccountIDFromContext(ctx)
+	if err != nil {
+		s.writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return 0, false
+	}
+	if !s.requireAccountPassword(w, r) {
+		return 0, false
+	}
+
+	var req TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		s.writeError(w, http.StatusBadRequest, "Code or recovery code is required")
+		return 0, false
+	}
+
+	if err := s.rdb.VerifyTOTPWithRetry(ctx, accountID, req.Code, req.RecoveryCode); err != nil {
+		switch {
+		case errors.Is(err, consts.ErrAuthenticationFailed):
+			s.writeError(w, http.StatusBadRequest, "Invalid code")
+		case errors.Is(err, consts.ErrDBNotFound):
+			s.writeError(w, http.StatusNotFound, "Second factor is not enabled")
+		default:
+			logger.Warn("HTTP Mail API: Error verifying second factor", "name", s.name, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "Failed to verify code")
+		}
+		return 0, false
+	}
+	return accountID, true
+}
@@ -25,8 +25,9 @@ import (
 
 // JWTClaims represents the JWT token claims (must match userapi.JWTClaims)
 type JWTClaims struct {
-	Email     string `json:"email"`
-	AccountID int64  `json:"account_id"`
+	Email       string `json:"email"`
+	AccountID   int64  `json:"account_id"`
+	TOTPPending bool   `json:"totp_pending,omitempty"` // Pre-auth token awaiting the second factor
 	jwt.RegisteredClaims
 }
 
@@ -41,6 +42,7 @@ type Server struct {
 	lookupCache                *lookupcache.LookupCache // Route lookup cache (optional)
 	positiveRevalidationWindow time.Duration            // Revalidation window for cached routes
 	jwtSecret                  string                   // JWT secret for token validation
+	protocol                   string                   // "userapi" or "jmap"
 	tls                        bool
 	tlsCertFile                string
 	tlsKeyFile                 string
@@ -67,6 +69,7 @@ type ServerOptions struct {
 	RemoteAddrs              []string
 	RemotePort               int    // Default port for backends if not in address
 	JWTSecret                string // JWT secret for token validation
+	Protocol                 string // "userapi" (default) or "jmap"
 	TLS                      bool
 	TLSCertFile              string
 	TLSKeyFile               string
@@ -99,7 +102,17 @@ func New(appCtx context.Context, rdb *resilient.ResilientDatabase, opts ServerOp
 		return nil, fmt.Errorf("no remote addresses configured")
 	}
 
-	if opts.JWTSecret == "" {
+	protocol := opts.Protocol
+	if protocol == "" {
+		protocol = "userapi"
+	}
+	if protocol != "userapi" && protocol != "jmap" {
+		cancel()
+		return nil, fmt.Errorf("unsupported protocol %q for User API proxy", protocol)
+	}
+
+	// JMAP clients may authenticate with Basic credentials, which the backend verifies
+	if opts.JWTSecret == "" && protocol != "jmap" {
 		cancel()
 		return nil, fmt.Errorf("JWT secret is required for User API proxy")
 	}
@@ -248,6 +261,7 @@ func New(appCtx context.Context, rdb *resilient.ResilientDatabase, opts ServerOp
 		lookupCache:                lookupCache,
 		positiveRevalidationWindow: positiveRevalidationWindow,
 		jwtSecret:                  opts.JWTSecret,
+		protocol:                   protocol,
 		tls:                        opts.TLS,
 		tlsCertFile:                opts.TLSCertFile,
 		tlsKeyFile:                 opts.TLSKeyFile,
@@ -276,6 +290,10 @@ func (s *Server) Start() error {
 		IdleTimeout:  120 * time.Second,
 		ConnState:    s.connStateHandler,
 	}
+	if s.protocol == "jmap" {
+		// JMAP event source streams stay open indefinitely
+		s.httpServer.WriteTimeout = 0
+	}
 
 	// Note: PROXY protocol is handled by wrapping the listener in Start(),
 	// not via ConnContext, because we need to replace the connection before HTTP server sees it
@@ -358,9 +376,14 @@ func (s *Server) Start() error {
 func (s *Server) setupHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Track metrics
-		metrics.ConnectionsTotal.WithLabelValues("userapi_proxy", s.name, "").Inc()
-		metrics.ConnectionsCurrent.WithLabelValues("userapi_proxy", s.name, "").Inc()
-		defer metrics.ConnectionsCurrent.WithLabelValues("userapi_proxy", s.name, "").Dec()
+		metrics.ConnectionsTotal.WithLabelValues(s.protocol+"_proxy", s.name, "").Inc()
+		metrics.ConnectionsCurrent.WithLabelValues(s.protocol+"_proxy", s.name, "").Inc()
+		defer metrics.ConnectionsCurrent.WithLabelValues(s.protocol+"_proxy", s.name, "").Dec()
+
+		if s.protocol == "jmap" {
+			s.handleJMAPRequest(w, r)
+			return
+		}
 
 		// Check if this is an authentication endpoint (no JWT required)
 		isAuthEndpoint := strings.HasPrefix(r.URL.Path, "/user/auth/")
@@ -382,6 +405,13 @@ func (s *Server) setupHandler() http.Handler {
 				return
 			}
 
+			// Exports and imports stream for longer than the server timeouts
+			if r.URL.Path == "/user/export" || (r.URL.Path == "/user/imports" && r.Method == "POST") {
+				rc := http.NewResponseController(w)
+				_ = rc.SetReadDeadline(time.Time{})
+				_ = rc.SetWriteDeadline(time.Time{})
+			}
+
 			// Proxy authenticated request with user headers
 			s.proxyRequest(w, r, backendAddr, &claims.Email, &claims.AccountID)
 			return
@@ -402,6 +432,69 @@ func (s *Server) setupHandler() http.Handler {
 	})
 }
 
+// handleJMAPRequest routes a JMAP request by the user of its credentials. The
+// credentials are forwarded unchanged and verified by the backend.
+func (s *Server) handleJMAPRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		// CORS preflight requests carry no credentials
+		backendAddr := s.connManager.GetBackendByConsistentHash(r.URL.Path)
+		if backendAddr == "" {
+			http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		s.proxyRequest(w, r, backendAddr, nil, nil)
+		return
+	}
+
+	email, accountID, err := s.jmapRoutingUser(r)
+	if err != nil {
+		logger.Debug("JMAP Proxy: Authentication failed", "name", s.name, "path", r.URL.Path, "error", err)
+		w.Header().Add("WWW-Authenticate", `Basic realm="JMAP", charset="UTF-8"`)
+		if s.jwtSecret != "" {
+			w.Header().Add("WWW-Authenticate", `Bearer realm="JMAP"`)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	backendAddr, err := s.getBackendForUser(email, accountID)
+	if err != nil {
+		logger.Warn("JMAP Proxy: Failed to get backend", "name", s.name, "user", email, "error", err)
+		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	// No X-Forwarded-User: the backend authenticates the forwarded credentials itself
+	r.Header.Del("X-Forwarded-User")
+	r.Header.Del("X-Forwarded-User-ID")
+	s.proxyRequest(w, r, backendAddr, nil, nil)
+}
+
+// jmapRoutingUser returns the user a JMAP request is routed by: the subject
+// of a valid bearer token, or the username of Basic credentials.
+func (s *Server) jmapRoutingUser(r *http.Request) (string, int64, error) {
+	authHeader := r.Header.Get("Authorization")
+	scheme, _, _ := strings.Cut(authHeader, " ")
+	switch strings.ToLower(scheme) {
+	case "bearer":
+		if s.jwtSecret == "" {
+			return "", 0, fmt.Errorf("bearer tokens are not accepted")
+		}
+		claims, err := s.extractAndValidateToken(r)
+		if err != nil {
+			return "", 0, err
+		}
+		return claims.Email, claims.AccountID, nil
+	case "basic":
+		username, password, ok := r.BasicAuth()
+		if !ok || username == "" || password == "" {
+			return "", 0, fmt.Errorf("invalid basic credentials")
+		}
+		return strings.ToLower(username), 0, nil
+	}
+	return "", 0, fmt.Errorf("authorization header required")
+}
+
 // getBackendForUser determines the backend server for a user using cache, affinity and remotelookup
 func (s *Server) getBackendForUser(email string, accountID int64) (string, error) {
 	ctx := context.Background()
@@ -428,7 +521,7 @@ func (s *Server) getBackendForUser(email string, accountID int64) (string, error
 
 	// 2. Check affinity (if configured)
 	if s.affinityManager != nil {
-		if backend, found := s.affinityManager.GetBackend(email, "userapi"); found {
+		if backend, found := s.affinityManager.GetBackend(email, s.protocol); found {
 			logger.Debug("User API Proxy: Using affinity backend", "name", s.name, "user", email, "backend", backend)
 			// Cache the route if lookup cache is enabled
 			if s.lookupCache != nil {
@@ -456,7 +549,7 @@ func (s *Server) getBackendForUser(email string, accountID int64) (string, error
 
 			// Set affinity for future requests
 			if s.affinityManager != nil {
-				s.affinityManager.SetBackend(email, routingInfo.ServerAddress, "userapi")
+				s.affinityManager.SetBackend(email, routingInfo.ServerAddress, s.protocol)
 			}
 
 			// Cache the route if lookup cache is enabled
@@ -484,7 +577,7 @@ func (s *Server) getBackendForUser(email string, accountID int64) (string, error
 
 	// Set affinity for future requests
 	if s.affinityManager != nil {
-		s.affinityManager.SetBackend(email, backendAddr, "userapi")
+		s.affinityManager.SetBackend(email, backendAddr, s.protocol)
 	}
 
 	// Cache the route if lookup cache is enabled
@@ -564,7 +657,7 @@ func (s *Server) validateToken(tokenString string) (*JWTClaims, error) {
 		return nil, fmt.Errorf("token validation failed: %w", err)
 	}
 
-	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
+	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid && !claims.TOTPPending {
 		return claims, nil
 	}
 
@@ -86,6 +86,26 @@ func TestValidateToken(t *testing.T) {
 			}(),
 			shouldErr: true,
 		},
+		{
+			name: "pre-auth token awaiting second factor",
+			token: func() string {
+				claims := JWTClaims{
+					Email:       "test@example.com",
+					AccountID:   123,
+					TOTPPending: true,
+					RegisteredClaims: jwt.RegisteredClaims{
+						ExpiresAt: jwt.NewNumericDate(time.Now().Add(5 * time.Minute)),
+						IssuedAt:  jwt.NewNumericDate(time.Now()),
+						Issuer:    "sora-test",
+						Subject:   "test@example.com",
+					},
+				}
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+				tokenString, _ := token.SignedString([]byte(secret))
+				return tokenString
+			}(),
+			shouldErr: true,
+		},
 		{
 			name:      "malformed token",
 			token:     "not.a.valid.jwt.token",
@@ -261,6 +281,28 @@ func TestNewServerValidation(t *testing.T) {
 			shouldErr: true,
 			errMsg:    "JWT secret is required",
 		},
+		{
+			name: "jmap without JWT secret",
+			opts: ServerOptions{
+				Name:        "test-proxy",
+				Addr:        ":8080",
+				RemoteAddrs: []string{"backend1:8081"},
+				Protocol:    "jmap",
+			},
+			shouldErr: false,
+		},
+		{
+			name: "unknown protocol",
+			opts: ServerOptions{
+				Name:        "test-proxy",
+				Addr:        ":8080",
+				RemoteAddrs: []string{"backend1:8081"},
+				JWTSecret:   "test-secret",
+				Protocol:    "carddav",
+			},
+			shouldErr: true,
+			errMsg:    "unsupported protocol",
+		},
 	}
 
 	for _, tt := range tests {
@@ -295,6 +337,77 @@ func TestNewServerValidation(t *testing.T) {
 	}
 }
 
+// TestJMAPRoutingUser tests which user a JMAP request is routed by
+func TestJMAPRoutingUser(t *testing.T) {
+	secret := "test-secret-key"
+	server := &Server{jwtSecret: secret, protocol: "jmap"}
+
+	claims := JWTClaims{
+		Email:     "bearer@example.com",
+		AccountID: 42,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+
+	tests := []struct {
+		name      string
+		setup     func(r *http.Request)
+		shouldErr bool
+		email     string
+		accountID int64
+	}{
+		{
+			name:      "bearer token",
+			setup:     func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) },
+			email:     "bearer@example.com",
+			accountID: 42,
+		},
+		{
+			name:  "basic credentials",
+			setup: func(r *http.Request) { r.SetBasicAuth("User@Example.com", "secret") },
+			email: "user@example.com",
+		},
+		{
+			name:      "basic without password",
+			setup:     func(r *http.Request) { r.SetBasicAuth("user@example.com", "") },
+			shouldErr: true,
+		},
+		{
+			name:      "invalid bearer token",
+			setup:     func(r *http.Request) { r.Header.Set("Authorization", "Bearer invalid.token") },
+			shouldErr: true,
+		},
+		{
+			name:      "no credentials",
+			setup:     func(r *http.Request) {},
+			shouldErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/jmap/", nil)
+			tt.setup(req)
+
+			email, accountID, err := server.jmapRoutingUser(req)
+			if tt.shouldErr {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if email != tt.email || accountID != tt.accountID {
+				t.Errorf("Expected %s/%d, got %s/%d", tt.email, tt.accountID, email, accountID)
+			}
+		})
+	}
+}
+
 // Helper function
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) &&
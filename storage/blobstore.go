@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/migadu/sora/config"
+	"github.com/migadu/sora/logger"
+)
+
+// BlobStore is the object storage used for message bodies. S3Storage is the
+// default implementation; FilesystemStorage keeps objects on local disk and
+// TieredStorage moves old objects from one store to another.
+type BlobStore interface {
+	Put(key string, body io.Reader, size int64) error
+	Get(key string) (io.ReadCloser, error)
+	// Exists reports whether the object exists and returns its version ID,
+	// if the backend has one.
+	Exists(key string) (bool, string, error)
+	// Delete removes an object. Deleting a missing object is not an error.
+	Delete(key string) error
+	DeleteBulk(keys []string) map[string]error
+	Copy(sourcePath, destPath string) error
+	// ListObjects lists objects with the given prefix in key order.
+	ListObjects(ctx context.Context, prefix string, recursive bool) (<-chan S3Object, <-chan error)
+	// ListObjectsAfter lists objects with the given prefix whose keys sort
+	// after startAfter, in key order.
+	ListObjectsAfter(ctx context.Context, prefix, startAfter string, recursive bool) (<-chan S3Object, <-chan error)
+	// Ping checks that the backend is reachable.
+	Ping(ctx context.Context) error
+}
+
+var (
+	_ BlobStore = (*S3Storage)(nil)
+	_ BlobStore = (*FilesystemStorage)(nil)
+	_ BlobStore = (*TieredStorage)(nil)
+)
+
+// Blob backends selectable with [storage] backend.
+const (
+	BackendS3         = "s3"
+	BackendFilesystem = "filesystem"
+)
+
+// NewFromConfig creates the blob store selected by the [storage] section,
+// including client-side encryption from [s3] and optional tiering.
+func NewFromConfig(s3Cfg *config.S3Config, storageCfg *config.StorageConfig) (BlobStore, error) {
+	var primary BlobStore
+	backend := storageCfg.GetBackend()
+
+	switch backend {
+	case BackendS3:
+		s3Store, err := newS3FromConfig(s3Cfg, s3Cfg.Bucket, "")
+		if err != nil {
+			return nil, err
+		}
+		primary = s3Store
+	case BackendFilesystem:
+		if s3Cfg.Encrypt {
+			return nil, fmt.Errorf("client-side encryption is only supported with the s3 storage backend")
+		}
+		fsStore, err := NewFilesystemStorage(storageCfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		primary = fsStore
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (must be %q or %q)", storageCfg.Backend, BackendS3, BackendFilesystem)
+	}
+
+	tiering := &storageCfg.Tiering
+	if !tiering.Enabled {
+		return primary, nil
+	}
+
+	after, err := tiering.GetAfter()
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage tiering after: %w", err)
+	}
+	coldBucket := tiering.Bucket
+	if coldBucket == "" {
+		if backend != BackendS3 {
+			return nil, fmt.Errorf("storage tiering with the %s backend requires a tiering bucket", backend)
+		}
+		coldBucket = s3Cfg.Bucket
+	}
+	inPlace := backend == BackendS3 && coldBucket == s3Cfg.Bucket
+	if inPlace && tiering.StorageClass == "" {
+		return nil, fmt.Errorf("storage tiering into the primary bucket requires a storage_class")
+	}
+
+	cold, err := newS3FromConfig(s3Cfg, coldBucket, tiering.StorageClass)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize cold storage tier: %w", err)
+	}
+	return NewTieredStorage(primary, cold, after, inPlace), nil
+}
+
+// newS3FromConfig creates an S3 store for bucket using the [s3] endpoint,
+// credentials and encryption settings.
+func newS3FromConfig(cfg *config.S3Config, bucket, storageClass string) (*S3Storage, error) {
+	if cfg.AccessKey == "" || cfg.SecretKey == "" || bucket == "" {
+		return nil, fmt.Errorf("missing required S3 credentials or bucket")
+	}
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("S3 endpoint not specified")
+	}
+	timeout, err := cfg.GetTimeout()
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 timeout: %w", err)
+	}
+
+	s, err := New(cfg.Endpoint, cfg.AccessKey, cfg.SecretKey, bucket, !cfg.DisableTLS, cfg.GetDebug(), timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize S3 storage at endpoint '%s': %w", cfg.Endpoint, err)
+	}
+	if cfg.Encrypt {
+		if err := s.ConfigureEncryption(cfg); err != nil {
+			return nil, fmt.Errorf("failed to enable S3 encryption: %w", err)
+		}
+	}
+	if storageClass != "" {
+		s.StorageClass = strings.ToUpper(storageClass)
+		logger.Info("STORAGE: Using storage class", "bucket", bucket, "storage_class", s.StorageClass)
+	}
+	return s, nil
+}
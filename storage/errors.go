@@ -1,6 +1,12 @@
 package storage
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
 
 // Sentinel errors for storage operations.
 // These errors can be checked using errors.Is() for proper error handling.
@@ -12,3 +18,23 @@ var (
 	// ErrEmptyData indicates that storage returned empty data
 	ErrEmptyData = errors.New("storage returned empty data")
 )
+
+// NotFoundError is returned by non-S3 blob stores when an object does not exist.
+type NotFoundError struct {
+	Key string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("object %s not found", e.Key)
+}
+
+// IsNotFound reports whether err means the object does not exist, for any
+// blob store backend.
+func IsNotFound(err error) bool {
+	var notFound *NotFoundError
+	if errors.As(err, &notFound) {
+		return true
+	}
+	var responseError *awshttp.ResponseError
+	return errors.As(err, &responseError) && responseError.HTTPStatusCode() == http.StatusNotFound
+}
@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/migadu/sora/logger"
+	"github.com/migadu/sora/pkg/metrics"
+)
+
+// ErrInvalidKey indicates an object key that cannot be mapped to a file path.
+var ErrInvalidKey = errors.New("invalid object key")
+
+// FilesystemStorage stores objects as files below a root directory, using
+// the object key as the relative path. It is intended for single-node
+// deployments and test environments that run without S3.
+type FilesystemStorage struct {
+	Root string
+}
+
+// NewFilesystemStorage creates a filesystem blob store rooted at root,
+// creating the directory if necessary.
+func NewFilesystemStorage(root string) (*FilesystemStorage, error) {
+	if root == "" {
+		return nil, fmt.Errorf("storage path is required for the filesystem backend")
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve storage path %s: %w", root, err)
+	}
+	if err := os.MkdirAll(absRoot, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create storage path %s: %w", absRoot, err)
+	}
+
+	logger.Info("STORAGE: Initialized filesystem storage", "path", absRoot)
+	return &FilesystemStorage{Root: absRoot}, nil
+}
+
+// path maps an object key to a file below the root, rejecting keys that
+// would escape it.
+func (f *FilesystemStorage) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." || strings.HasPrefix(part, ".tmp-") {
+			return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+		}
+	}
+	return filepath.Join(f.Root, filepath.FromSlash(key)), nil
+}
+
+func (f *FilesystemStorage) Put(key string, body io.Reader, size int64) error {
+	start := time.Now()
+	err := f.put(key, body)
+	if err != nil {
+		metrics.StorageOperationErrors.WithLabelValues("PUT", "filesystem_error").Inc()
+		metrics.S3OperationsTotal.WithLabelValues("PUT", "error").Inc()
+	} else {
+		metrics.S3OperationsTotal.WithLabelValues("PUT", "success").Inc()
+	}
+	metrics.S3OperationDuration.WithLabelValues("PUT").Observe(time.Since(start).Seconds())
+	return err
+}
+
+// put writes the object to a temporary file and renames it into place, so
+// readers never see a partially written object.
+func (f *FilesystemStorage) put(key string, body io.Reader) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", key, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", key, err)
+	}
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to sync %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to close %s: %w", key, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	return nil
+}
+
+func (f *FilesystemStorage) Get(key string) (io.ReadCloser, error) {
+	start := time.Now()
+	defer func() {
+		metrics.S3OperationDuration.WithLabelValues("GET").Observe(time.Since(start).Seconds())
+	}()
+
+	path, err := f.path(key)
+	if err != nil {
+		metrics.S3OperationsTotal.WithLabelValues("GET", "error").Inc()
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		metrics.S3OperationsTotal.WithLabelValues("GET", "error").Inc()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, &NotFoundError{Key: key}
+		}
+		return nil, err
+	}
+	metrics.S3OperationsTotal.WithLabelValues("GET", "success").Inc()
+	return file, nil
+}
+
+func (f *FilesystemStorage) Exists(key string) (bool, string, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return false, "", err
+	}
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, "", nil
+		}
+		return false, "", fmt.Errorf("failed to stat object %s: %w", key, err)
+	}
+	return true, "", nil
+}
+
+func (f *FilesystemStorage) Delete(key string) error {
+	start := time.Now()
+	path, err := f.path(key)
+	if err == nil {
+		err = os.Remove(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+	}
+	if err != nil {
+		metrics.S3OperationsTotal.WithLabelValues("DELETE", "error").Inc()
+	} else {
+		metrics.S3OperationsTotal.WithLabelValues("DELETE", "success").Inc()
+		f.removeEmptyParents(path)
+	}
+	metrics.S3OperationDuration.WithLabelValues("DELETE").Observe(time.Since(start).Seconds())
+	return err
+}
+
+// removeEmptyParents removes directories left empty by a delete, up to the root.
+func (f *FilesystemStorage) removeEmptyParents(path string) {
+	for dir := filepath.Dir(path); dir != f.Root && strings.HasPrefix(dir, f.Root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+func (f *FilesystemStorage) DeleteBulk(keys []string) map[string]error {
+	errs := make(map[string]error)
+	for _, key := range keys {
+		if err := f.Delete(key); err != nil {
+			errs[key] = err
+		}
+	}
+	return errs
+}
+
+func (f *FilesystemStorage) Copy(sourcePath, destPath string) error {
+	src, err := f.Get(sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to get source object for copy: %w", err)
+	}
+	defer src.Close()
+
+	if err := f.put(destPath, src); err != nil {
+		return fmt.Errorf("failed to copy object from %s to %s: %w", sourcePath, destPath, err)
+	}
+	return nil
+}
+
+func (f *FilesystemStorage) ListObjects(ctx context.Context, prefix string, recursive bool) (<-chan S3Object, <-chan error) {
+	return f.ListObjectsAfter(ctx, prefix, "", recursive)
+}
+
+// ListObjectsAfter walks the directory tree in key order. As with S3, a
+// non-recursive listing only returns objects directly below the prefix.
+func (f *FilesystemStorage) ListObjectsAfter(ctx context.Context, prefix, startAfter string, recursive bool) (<-chan S3Object, <-chan error) {
+	objectCh := make(chan S3Object)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(objectCh)
+		defer close(errCh)
+
+		// Start walking at the deepest directory fully named by the prefix
+		walkRoot := f.Root
+		if i := strings.LastIndex(prefix, "/"); i >= 0 {
+			dir, err := f.path(prefix[:i])
+			if err != nil {
+				errCh <- err
+				return
+			}
+			walkRoot = dir
+		}
+
+		var keys []S3Object
+		err := filepath.WalkDir(walkRoot, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+				return nil
+			}
+			rel, err := filepath.Rel(f.Root, path)
+			if err != nil {
+				return err
+			}
+			key := filepath.ToSlash(rel)
+			if !strings.HasPrefix(key, prefix) || key <= startAfter {
+				return nil
+			}
+			if !recursive && strings.Contains(key[len(prefix):], "/") {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			keys = append(keys, S3Object{
+				Key:          key,
+				Size:         info.Size(),
+				LastModified: info.ModTime(),
+				ETag:         fileETag(info),
+			})
+			return nil
+		})
+		if err != nil {
+			errCh <- err
+			return
+		}
+
+		// WalkDir visits entries in lexical order per directory, which is not
+		// the same as key order across directories ("a/b" vs "a-b")
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Key < keys[j].Key })
+		for _, obj := range keys {
+			select {
+			case objectCh <- obj:
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return objectCh, errCh
+}
+
+// fileETag derives a change marker from the file's size and modification time.
+func fileETag(info fs.FileInfo) string {
+	sum := md5.Sum([]byte(fmt.Sprintf("%d-%d", info.Size(), info.ModTime().UnixNano())))
+	return hex.EncodeToString(sum[:])
+}
+
+// Ping checks that the root directory is accessible.
+func (f *FilesystemStorage) Ping(ctx context.Context) error {
+	if _, err := os.Stat(f.Root); err != nil {
+		return fmt.Errorf("storage path not accessible: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func putString(t *testing.T, s BlobStore, key, data string) {
+	t.Helper()
+	require.NoError(t, s.Put(key, strings.NewReader(data), int64(len(data))))
+}
+
+func getString(t *testing.T, s BlobStore, key string) string {
+	t.Helper()
+	r, err := s.Get(key)
+	require.NoError(t, err)
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func listKeys(t *testing.T, s BlobStore, prefix, startAfter string, recursive bool) []string {
+	t.Helper()
+	objectCh, errCh := s.ListObjectsAfter(context.Background(), prefix, startAfter, recursive)
+	var keys []string
+	for obj := range objectCh {
+		keys = append(keys, obj.Key)
+	}
+	require.NoError(t, <-errCh)
+	return keys
+}
+
+func TestFilesystemStorage_PutGetDelete(t *testing.T) {
+	s, err := NewFilesystemStorage(t.TempDir())
+	require.NoError(t, err)
+
+	key := "example.com/alice/abc123"
+	exists, _, err := s.Exists(key)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = s.Get(key)
+	assert.True(t, IsNotFound(err))
+
+	putString(t, s, key, "hello")
+	exists, _, err = s.Exists(key)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, "hello", getString(t, s, key))
+
+	// Overwrites replace the object
+	putString(t, s, key, "world")
+	assert.Equal(t, "world", getString(t, s, key))
+
+	require.NoError(t, s.Copy(key, "example.com/bob/abc123"))
+	assert.Equal(t, "world", getString(t, s, "example.com/bob/abc123"))
+
+	require.NoError(t, s.Delete(key))
+	require.NoError(t, s.Delete(key), "deleting a missing object is not an error")
+	exists, _, err = s.Exists(key)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// Empty directories are cleaned up, the root is kept
+	_, err = os.Stat(filepath.Join(s.Root, "example.com", "alice"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(s.Root)
+	assert.NoError(t, err)
+
+	errs := s.DeleteBulk([]string{"example.com/bob/abc123", "example.com/bob/missing"})
+	assert.Empty(t, errs)
+}
+
+func TestFilesystemStorage_RejectsInvalidKeys(t *testing.T) {
+	s, err := NewFilesystemStorage(t.TempDir())
+	require.NoError(t, err)
+
+	for _, key := range []string{"", "/etc/passwd", "../outside", "a/../../outside", "a//b", "a/./b", "a\\b", "a/.tmp-123"} {
+		err := s.Put(key, strings.NewReader("x"), 1)
+		assert.ErrorIs(t, err, ErrInvalidKey, "key %q", key)
+	}
+}
+
+func TestFilesystemStorage_ListObjects(t *testing.T) {
+	s, err := NewFilesystemStorage(t.TempDir())
+	require.NoError(t, err)
+
+	for _, key := range []string{"a/b", "a-b", "a/c/d", "b/e", "a/a"} {
+		putString(t, s, key, key)
+	}
+
+	assert.Equal(t, []string{"a-b", "a/a", "a/b", "a/c/d", "b/e"}, listKeys(t, s, "", "", true))
+	assert.Equal(t, []string{"a/a", "a/b", "a/c/d"}, listKeys(t, s, "a/", "", true))
+	assert.Equal(t, []string{"a/a", "a/b"}, listKeys(t, s, "a/", "", false))
+	assert.Equal(t, []string{"a/c/d", "b/e"}, listKeys(t, s, "", "a/b", true))
+	assert.Empty(t, listKeys(t, s, "missing/", "", true))
+}
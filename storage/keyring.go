@@ -0,0 +1,357 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Objects encrypted with a key ring start with a self-describing header:
+//
+//	magic (8) | key id length (1) | key id | scope (1) | [wrapped data key (60)]
+//
+// followed by the GCM nonce and ciphertext. The whole header is passed to GCM
+// as additional authenticated data, so it cannot be altered without the
+// decryption failing. Objects written before the key ring was introduced have
+// no header and are decrypted with the legacy encryption_key.
+var encryptionMagic = []byte("SORAENC\x01")
+
+const (
+	keySize = 32
+	// wrappedKeySize is the size of a data key sealed by a master key:
+	// nonce (12) + key (32) + GCM tag (16).
+	wrappedKeySize = 12 + keySize + 16
+)
+
+var (
+	// ErrUnknownEncryptionKey indicates that an object was encrypted with a
+	// master key ID that is not present in the key ring.
+	ErrUnknownEncryptionKey = errors.New("object encrypted with unknown key id")
+
+	// ErrNoLegacyKey indicates that an object without a key ring header was
+	// read but no legacy encryption_key is configured.
+	ErrNoLegacyKey = errors.New("object has no key header and no legacy encryption key is configured")
+)
+
+// KeyScope controls how widely a data encryption key is shared.
+type KeyScope byte
+
+const (
+	// KeyScopeGlobal encrypts every object directly with the master key.
+	KeyScopeGlobal KeyScope = iota
+	// KeyScopeDomain encrypts objects with a data key per domain.
+	KeyScopeDomain
+	// KeyScopeAccount encrypts objects with a data key per account.
+	KeyScopeAccount
+)
+
+// ParseKeyScope parses the encryption_key_scope configuration value.
+func ParseKeyScope(s string) (KeyScope, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "global":
+		return KeyScopeGlobal, nil
+	case "domain":
+		return KeyScopeDomain, nil
+	case "account":
+		return KeyScopeAccount, nil
+	default:
+		return KeyScopeGlobal, fmt.Errorf("invalid encryption key scope %q (must be global, domain or account)", s)
+	}
+}
+
+func (k KeyScope) String() string {
+	switch k {
+	case KeyScopeDomain:
+		return "domain"
+	case KeyScopeAccount:
+		return "account"
+	default:
+		return "global"
+	}
+}
+
+// scopeID returns the domain or account an object key belongs to. Message
+// keys have the form domain/localpart/hash (see helpers.NewS3Key); keys that
+// do not follow that layout fall back to the global scope.
+func (k KeyScope) scopeID(objectKey string) (KeyScope, string) {
+	parts := strings.SplitN(objectKey, "/", 3)
+	switch {
+	case k == KeyScopeDomain && len(parts) >= 2 && parts[0] != "":
+		return KeyScopeDomain, parts[0]
+	case k == KeyScopeAccount && len(parts) == 3 && parts[0] != "" && parts[1] != "":
+		return KeyScopeAccount, parts[0] + "/" + parts[1]
+	default:
+		return KeyScopeGlobal, ""
+	}
+}
+
+// EncryptionHeader describes how an object was encrypted.
+type EncryptionHeader struct {
+	KeyID string
+	Scope KeyScope
+
+	wrappedKey []byte
+	size       int
+}
+
+// ParseEncryptionHeader reads the key ring header of an encrypted object.
+// It returns false for objects written with the legacy single key.
+func ParseEncryptionHeader(data []byte) (EncryptionHeader, bool) {
+	if !bytes.HasPrefix(data, encryptionMagic) {
+		return EncryptionHeader{}, false
+	}
+	pos := len(encryptionMagic)
+	if len(data) < pos+1 {
+		return EncryptionHeader{}, false
+	}
+	idLen := int(data[pos])
+	pos++
+	if idLen == 0 || len(data) < pos+idLen+1 {
+		return EncryptionHeader{}, false
+	}
+	h := EncryptionHeader{KeyID: string(data[pos : pos+idLen])}
+	pos += idLen
+	h.Scope = KeyScope(data[pos])
+	pos++
+	switch h.Scope {
+	case KeyScopeGlobal:
+	case KeyScopeDomain, KeyScopeAccount:
+		if len(data) < pos+wrappedKeySize {
+			return EncryptionHeader{}, false
+		}
+		h.wrappedKey = data[pos : pos+wrappedKeySize]
+		pos += wrappedKeySize
+	default:
+		return EncryptionHeader{}, false
+	}
+	h.size = pos
+	return h, true
+}
+
+// KeyRing holds the versioned master keys used for client-side encryption.
+// New objects are always encrypted with the active key; objects encrypted
+// with an older key stay readable as long as that key remains in the ring.
+type KeyRing struct {
+	keys     map[string][]byte
+	activeID string
+	scope    KeyScope
+
+	mu       sync.Mutex
+	dataKeys map[string]dataKey // "<master key id>\x00<scope id>" -> data key
+}
+
+type dataKey struct {
+	key     []byte
+	wrapped []byte
+}
+
+// NewKeyRing builds a key ring from hex-encoded 32-byte master keys indexed
+// by key ID. activeID selects the key used for new objects and may be empty
+// when the ring holds a single key.
+func NewKeyRing(keys map[string]string, activeID string, scope string) (*KeyRing, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one encryption key is required")
+	}
+	keyScope, err := ParseKeyScope(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	ring := &KeyRing{
+		keys:     make(map[string][]byte, len(keys)),
+		activeID: activeID,
+		scope:    keyScope,
+		dataKeys: make(map[string]dataKey),
+	}
+	for id, hexKey := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("encryption key id %q must be between 1 and 255 bytes", id)
+		}
+		key, err := hex.DecodeString(hexKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode encryption key %q: %w", id, err)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("encryption key %q must be 32 bytes (64 hex characters)", id)
+		}
+		ring.keys[id] = key
+	}
+
+	if ring.activeID == "" {
+		if len(keys) > 1 {
+			return nil, fmt.Errorf("encryption_key_id is required when more than one encryption key is configured")
+		}
+		for id := range keys {
+			ring.activeID = id
+		}
+	}
+	if _, ok := ring.keys[ring.activeID]; !ok {
+		return nil, fmt.Errorf("active encryption key %q is not in the key ring", ring.activeID)
+	}
+	return ring, nil
+}
+
+// ActiveKeyID returns the ID of the master key used for new objects.
+func (r *KeyRing) ActiveKeyID() string {
+	return r.activeID
+}
+
+// Scope returns the configured data key scope.
+func (r *KeyRing) Scope() KeyScope {
+	return r.scope
+}
+
+// KeyIDs returns the IDs of all master keys in the ring, sorted.
+func (r *KeyRing) KeyIDs() []string {
+	ids := make([]string, 0, len(r.keys))
+	for id := range r.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// IsCurrent reports whether an object stored under objectKey with header h
+// is already encrypted with the active master key and the configured scope.
+func (r *KeyRing) IsCurrent(objectKey string, h EncryptionHeader) bool {
+	scope, _ := r.scope.scopeID(objectKey)
+	return h.KeyID == r.activeID && h.Scope == scope
+}
+
+// Encrypt encrypts plaintext for the object stored under objectKey using the
+// active master key.
+func (r *KeyRing) Encrypt(objectKey string, plaintext []byte) ([]byte, error) {
+	scope, scopeID := r.scope.scopeID(objectKey)
+
+	header := make([]byte, 0, len(encryptionMagic)+2+len(r.activeID)+wrappedKeySize)
+	header = append(header, encryptionMagic...)
+	header = append(header, byte(len(r.activeID)))
+	header = append(header, r.activeID...)
+	header = append(header, byte(scope))
+
+	key := r.keys[r.activeID]
+	if scope != KeyScopeGlobal {
+		dk, err := r.dataKey(scope, scopeID)
+		if err != nil {
+			return nil, err
+		}
+		header = append(header, dk.wrapped...)
+		key = dk.key
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(header)+len(nonce)+len(plaintext)+gcm.Overhead())
+	out = append(out, header...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plaintext, header), nil
+}
+
+// Decrypt decrypts an object that carries a key ring header.
+func (r *KeyRing) Decrypt(data []byte) ([]byte, error) {
+	h, ok := ParseEncryptionHeader(data)
+	if !ok {
+		return nil, fmt.Errorf("missing or malformed encryption header")
+	}
+	master, ok := r.keys[h.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEncryptionKey, h.KeyID)
+	}
+
+	key := master
+	if h.Scope != KeyScopeGlobal {
+		unwrapped, err := unwrapKey(master, h.KeyID, h.wrappedKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+		}
+		key = unwrapped
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	body := data[h.size:]
+	if len(body) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := body[:gcm.NonceSize()], body[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, data[:h.size])
+}
+
+// dataKey returns the data key for a domain or account under the active
+// master key, generating and wrapping a new one on first use. Each object
+// carries its own wrapped copy, so keys generated by different processes
+// never need to be coordinated.
+func (r *KeyRing) dataKey(scope KeyScope, scopeID string) (dataKey, error) {
+	cacheKey := r.activeID + "\x00" + scope.String() + ":" + scopeID
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if dk, ok := r.dataKeys[cacheKey]; ok {
+		return dk, nil
+	}
+
+	key := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return dataKey{}, err
+	}
+	wrapped, err := wrapKey(r.keys[r.activeID], r.activeID, key)
+	if err != nil {
+		return dataKey{}, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	dk := dataKey{key: key, wrapped: wrapped}
+	r.dataKeys[cacheKey] = dk
+	return dk, nil
+}
+
+// wrapKey seals a data key with a master key, binding it to the key ID.
+func wrapKey(master []byte, keyID string, key []byte) ([]byte, error) {
+	gcm, err := newGCM(master)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, key, []byte(keyID)), nil
+}
+
+// unwrapKey opens a data key sealed by wrapKey.
+func unwrapKey(master []byte, keyID string, wrapped []byte) ([]byte, error) {
+	gcm, err := newGCM(master)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) != wrappedKeySize {
+		return nil, fmt.Errorf("wrapped key has invalid size %d", len(wrapped))
+	}
+	nonce, sealed := wrapped[:gcm.NonceSize()], wrapped[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, []byte(keyID))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
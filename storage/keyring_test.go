@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/migadu/sora/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testKey1 = strings.Repeat("11", 32)
+	testKey2 = strings.Repeat("22", 32)
+	testKey3 = strings.Repeat("33", 32)
+)
+
+func TestNewKeyRing_Validation(t *testing.T) {
+	_, err := NewKeyRing(nil, "", "")
+	assert.Error(t, err)
+
+	_, err = NewKeyRing(map[string]string{"k1": "abcd"}, "k1", "")
+	assert.Error(t, err, "short key must be rejected")
+
+	_, err = NewKeyRing(map[string]string{"k1": testKey1, "k2": testKey2}, "", "")
+	assert.Error(t, err, "active key id is required with several keys")
+
+	_, err = NewKeyRing(map[string]string{"k1": testKey1}, "k2", "")
+	assert.Error(t, err, "active key must be in the ring")
+
+	_, err = NewKeyRing(map[string]string{"k1": testKey1}, "", "mailbox")
+	assert.Error(t, err, "unknown scope must be rejected")
+
+	ring, err := NewKeyRing(map[string]string{"k1": testKey1}, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "k1", ring.ActiveKeyID())
+	assert.Equal(t, KeyScopeGlobal, ring.Scope())
+}
+
+func TestKeyRing_RoundTrip(t *testing.T) {
+	for _, scope := range []string{"global", "domain", "account"} {
+		t.Run(scope, func(t *testing.T) {
+			ring, err := NewKeyRing(map[string]string{"k1": testKey1}, "k1", scope)
+			require.NoError(t, err)
+
+			plaintext := []byte("Subject: hello\r\n\r\nbody")
+			ciphertext, err := ring.Encrypt("example.com/user/abc123", plaintext)
+			require.NoError(t, err)
+
+			h, ok := ParseEncryptionHeader(ciphertext)
+			require.True(t, ok)
+			assert.Equal(t, "k1", h.KeyID)
+			assert.Equal(t, scope, h.Scope.String())
+			assert.True(t, ring.IsCurrent("example.com/user/abc123", h))
+
+			decrypted, err := ring.Decrypt(ciphertext)
+			require.NoError(t, err)
+			assert.Equal(t, plaintext, decrypted)
+		})
+	}
+}
+
+func TestKeyRing_ScopeFallsBackToGlobal(t *testing.T) {
+	ring, err := NewKeyRing(map[string]string{"k1": testKey1}, "k1", "account")
+	require.NoError(t, err)
+
+	ciphertext, err := ring.Encrypt("not-a-message-key", []byte("data"))
+	require.NoError(t, err)
+
+	h, ok := ParseEncryptionHeader(ciphertext)
+	require.True(t, ok)
+	assert.Equal(t, KeyScopeGlobal, h.Scope)
+	assert.True(t, ring.IsCurrent("not-a-message-key", h))
+}
+
+func TestKeyRing_DataKeysPerAccount(t *testing.T) {
+	ring, err := NewKeyRing(map[string]string{"k1": testKey1}, "k1", "account")
+	require.NoError(t, err)
+
+	a1, err := ring.Encrypt("example.com/alice/h1", []byte("x"))
+	require.NoError(t, err)
+	a2, err := ring.Encrypt("example.com/alice/h2", []byte("x"))
+	require.NoError(t, err)
+	b1, err := ring.Encrypt("example.com/bob/h1", []byte("x"))
+	require.NoError(t, err)
+
+	ha1, _ := ParseEncryptionHeader(a1)
+	ha2, _ := ParseEncryptionHeader(a2)
+	hb1, _ := ParseEncryptionHeader(b1)
+	assert.Equal(t, ha1.wrappedKey, ha2.wrappedKey, "objects of one account share a data key")
+	assert.NotEqual(t, ha1.wrappedKey, hb1.wrappedKey, "accounts must not share a data key")
+}
+
+func TestKeyRing_Rotation(t *testing.T) {
+	oldRing, err := NewKeyRing(map[string]string{"k1": testKey1}, "k1", "domain")
+	require.NoError(t, err)
+	ciphertext, err := oldRing.Encrypt("example.com/user/abc", []byte("old"))
+	require.NoError(t, err)
+
+	newRing, err := NewKeyRing(map[string]string{"k1": testKey1, "k2": testKey2}, "k2", "domain")
+	require.NoError(t, err)
+
+	h, ok := ParseEncryptionHeader(ciphertext)
+	require.True(t, ok)
+	assert.False(t, newRing.IsCurrent("example.com/user/abc", h))
+
+	// Objects encrypted with a retired key stay readable while it is in the ring
+	decrypted, err := newRing.Decrypt(ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("old"), decrypted)
+
+	// ... but not once it has been removed
+	pruned, err := NewKeyRing(map[string]string{"k2": testKey2}, "k2", "domain")
+	require.NoError(t, err)
+	_, err = pruned.Decrypt(ciphertext)
+	assert.ErrorIs(t, err, ErrUnknownEncryptionKey)
+
+	// A wrong key under the same id fails authentication
+	wrong, err := NewKeyRing(map[string]string{"k1": testKey3}, "k1", "domain")
+	require.NoError(t, err)
+	_, err = wrong.Decrypt(ciphertext)
+	assert.Error(t, err)
+}
+
+func TestKeyRing_HeaderIsAuthenticated(t *testing.T) {
+	ring, err := NewKeyRing(map[string]string{"k1": testKey1, "k2": testKey1}, "k1", "global")
+	require.NoError(t, err)
+
+	ciphertext, err := ring.Encrypt("example.com/user/abc", []byte("data"))
+	require.NoError(t, err)
+
+	// Relabel the object with another id that maps to the same key material
+	tampered := append([]byte(nil), ciphertext...)
+	tampered[len(encryptionMagic)+2] = '2'
+	_, err = ring.Decrypt(tampered)
+	assert.Error(t, err)
+}
+
+func TestS3Storage_LegacyObjectsWithKeyRing(t *testing.T) {
+	legacy := &S3Storage{}
+	require.NoError(t, legacy.EnableEncryption(testKey1))
+	legacyData, err := legacy.encryptData("example.com/user/abc", []byte("legacy"))
+	require.NoError(t, err)
+	_, ok := ParseEncryptionHeader(legacyData)
+	assert.False(t, ok, "legacy objects have no header")
+
+	s := &S3Storage{}
+	require.NoError(t, s.ConfigureEncryption(&config.S3Config{
+		EncryptionKey:      testKey1,
+		EncryptionKeys:     map[string]string{"k2": testKey2},
+		EncryptionKeyID:    "k2",
+		EncryptionKeyScope: "account",
+	}))
+
+	decrypted, err := s.decryptData(legacyData)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("legacy"), decrypted)
+
+	newData, err := s.encryptData("example.com/user/abc", []byte("new"))
+	require.NoError(t, err)
+	h, ok := ParseEncryptionHeader(newData)
+	require.True(t, ok)
+	assert.Equal(t, "k2", h.KeyID)
+
+	decrypted, err = s.decryptData(newData)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("new"), decrypted)
+
+	// Without a legacy key, headerless objects cannot be read
+	ringOnly := &S3Storage{}
+	require.NoError(t, ringOnly.ConfigureEncryption(&config.S3Config{
+		EncryptionKeys: map[string]string{"k2": testKey2},
+	}))
+	_, err = ringOnly.decryptData(legacyData)
+	assert.ErrorIs(t, err, ErrNoLegacyKey)
+}
@@ -19,6 +19,13 @@
 // AES-256-GCM before upload. The encryption key is configured in config.toml
 // and should be a 32-byte hex-encoded string.
 //
+// A key ring of versioned master keys can be configured instead. Objects
+// encrypted with a key ring carry a header naming the master key, and can
+// optionally use a per-domain or per-account data key wrapped by that master
+// key. Objects are stored under domain/localpart/hash, so deduplication is
+// already scoped to an account and never spans two data keys. Existing
+// objects are moved to the active key with RotateObject.
+//
 // # Usage Example
 //
 //	// Initialize storage
@@ -82,6 +89,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/smithy-go"
+	"github.com/migadu/sora/config"
 	"github.com/migadu/sora/logger"
 	"github.com/migadu/sora/pkg/metrics"
 )
@@ -90,7 +98,9 @@ type S3Storage struct {
 	Client        *s3.Client
 	BucketName    string
 	Encrypt       bool
-	EncryptionKey []byte
+	EncryptionKey []byte        // Legacy single key, used for objects without a key ring header
+	KeyRing       *KeyRing      // Versioned master keys; when set, new objects are encrypted with the active key
+	StorageClass  string        // S3 storage class for new objects (empty: bucket default)
 	Timeout       time.Duration // Timeout for individual S3 operations
 }
 
@@ -179,6 +189,32 @@ func (s *S3Storage) EnableEncryption(encryptionKey string) error {
 	return nil
 }
 
+// ConfigureEncryption enables client-side encryption from the S3 configuration.
+// Without encryption_keys it behaves like EnableEncryption. With a key ring,
+// the legacy encryption_key is optional and only used to read objects written
+// before the key ring was configured.
+func (s *S3Storage) ConfigureEncryption(cfg *config.S3Config) error {
+	if len(cfg.EncryptionKeys) == 0 {
+		return s.EnableEncryption(cfg.EncryptionKey)
+	}
+
+	ring, err := NewKeyRing(cfg.EncryptionKeys, cfg.EncryptionKeyID, cfg.EncryptionKeyScope)
+	if err != nil {
+		return err
+	}
+	if cfg.EncryptionKey != "" {
+		if err := s.EnableEncryption(cfg.EncryptionKey); err != nil {
+			return err
+		}
+	}
+
+	s.Encrypt = true
+	s.KeyRing = ring
+	logger.Info("STORAGE: Client-side encryption key ring enabled", "active_key", ring.ActiveKeyID(), "keys", len(ring.KeyIDs()), "scope", ring.Scope().String())
+
+	return nil
+}
+
 // Exists checks if an object with the given key exists in the bucket.
 func (s *S3Storage) Exists(key string) (bool, string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
@@ -223,7 +259,7 @@ func (s *S3Storage) Put(key string, body io.Reader, size int64) error {
 			return fmt.Errorf("failed to read data for encryption: %w", err)
 		}
 
-		encryptedData, err := s.encryptData(data)
+		encryptedData, err := s.encryptData(key, data)
 		if err != nil {
 			metrics.StorageOperationErrors.WithLabelValues("PUT", "encryption_error").Inc()
 			return fmt.Errorf("failed to encrypt data: %w", err)
@@ -234,6 +270,9 @@ func (s *S3Storage) Put(key string, body io.Reader, size int64) error {
 			Key:    aws.String(key),
 			Body:   bytes.NewReader(encryptedData),
 		}
+		if s.StorageClass != "" {
+			input.StorageClass = types.StorageClass(s.StorageClass)
+		}
 
 		_, err = s.Client.PutObject(ctx, input)
 		if err != nil {
@@ -252,6 +291,9 @@ func (s *S3Storage) Put(key string, body io.Reader, size int64) error {
 		Key:    aws.String(key),
 		Body:   body,
 	}
+	if s.StorageClass != "" {
+		input.StorageClass = types.StorageClass(s.StorageClass)
+	}
 
 	_, err := s.Client.PutObject(ctx, input)
 	if err != nil {
@@ -265,7 +307,11 @@ func (s *S3Storage) Put(key string, body io.Reader, size int64) error {
 }
 
 // encryptData encrypts data using AES-256-GCM
-func (s *S3Storage) encryptData(plaintext []byte) ([]byte, error) {
+func (s *S3Storage) encryptData(key string, plaintext []byte) ([]byte, error) {
+	if s.KeyRing != nil {
+		return s.KeyRing.Encrypt(key, plaintext)
+	}
+
 	// Create a new AES cipher block using the key
 	block, err := aes.NewCipher(s.EncryptionKey)
 	if err != nil {
@@ -291,6 +337,19 @@ func (s *S3Storage) encryptData(plaintext []byte) ([]byte, error) {
 
 // decryptData decrypts data using AES-256-GCM
 func (s *S3Storage) decryptData(ciphertext []byte) ([]byte, error) {
+	if s.KeyRing != nil {
+		if _, ok := ParseEncryptionHeader(ciphertext); ok {
+			plaintext, err := s.KeyRing.Decrypt(ciphertext)
+			if err == nil || s.EncryptionKey == nil {
+				return plaintext, err
+			}
+			// A legacy object may start with the header magic by chance; retry with the legacy key
+		}
+	}
+	if s.EncryptionKey == nil {
+		return nil, ErrNoLegacyKey
+	}
+
 	// Create a new AES cipher block using the key
 	block, err := aes.NewCipher(s.EncryptionKey)
 	if err != nil {
@@ -568,6 +627,9 @@ func (s *S3Storage) Copy(sourcePath, destPath string) error {
 		CopySource: aws.String(copySource),
 		Key:        aws.String(destPath),
 	}
+	if s.StorageClass != "" {
+		input.StorageClass = types.StorageClass(s.StorageClass)
+	}
 
 	_, err := s.Client.CopyObject(ctx, input)
 	if err != nil {
@@ -582,10 +644,17 @@ type S3Object struct {
 	Size         int64
 	LastModified time.Time
 	ETag         string
+	StorageClass string
 }
 
 // ListObjects lists objects in S3 with the given prefix
 func (s *S3Storage) ListObjects(ctx context.Context, prefix string, recursive bool) (<-chan S3Object, <-chan error) {
+	return s.ListObjectsAfter(ctx, prefix, "", recursive)
+}
+
+// ListObjectsAfter lists objects in S3 with the given prefix whose keys sort
+// after startAfter. It is used to resume long-running scans.
+func (s *S3Storage) ListObjectsAfter(ctx context.Context, prefix, startAfter string, recursive bool) (<-chan S3Object, <-chan error) {
 	objectCh := make(chan S3Object)
 	errCh := make(chan error, 1)
 
@@ -598,6 +667,10 @@ func (s *S3Storage) ListObjects(ctx context.Context, prefix string, recursive bo
 			Prefix: aws.String(prefix),
 		}
 
+		if startAfter != "" {
+			input.StartAfter = aws.String(startAfter)
+		}
+
 		if !recursive {
 			input.Delimiter = aws.String("/")
 		}
@@ -612,11 +685,18 @@ func (s *S3Storage) ListObjects(ctx context.Context, prefix string, recursive bo
 			}
 
 			for _, object := range page.Contents {
-				objectCh <- S3Object{
+				obj := S3Object{
 					Key:          aws.ToString(object.Key),
 					Size:         aws.ToInt64(object.Size),
 					LastModified: aws.ToTime(object.LastModified),
 					ETag:         strings.Trim(aws.ToString(object.ETag), "\""),
+					StorageClass: string(object.StorageClass),
+				}
+				select {
+				case objectCh <- obj:
+				case <-ctx.Done():
+					errCh <- ctx.Err()
+					return
 				}
 			}
 		}
@@ -624,3 +704,15 @@ func (s *S3Storage) ListObjects(ctx context.Context, prefix string, recursive bo
 
 	return objectCh, errCh
 }
+
+// Ping checks that the bucket is reachable by listing at most one object.
+func (s *S3Storage) Ping(ctx context.Context) error {
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.BucketName),
+		MaxKeys: aws.Int32(1),
+	}
+	if _, err := s.Client.ListObjectsV2(ctx, input); err != nil {
+		return fmt.Errorf("S3 list objects failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/migadu/sora/logger"
+)
+
+// TieredStorage writes new objects to a hot store and moves objects older
+// than After to a cold store. Reads, existence checks and deletes consult
+// both tiers, so callers never need to know where an object lives.
+//
+// The cold tier may be the same S3 bucket as the hot tier with a cheaper
+// storage class; objects are then rewritten in place instead of moved.
+type TieredStorage struct {
+	Hot   BlobStore
+	Cold  BlobStore
+	After time.Duration
+
+	inPlace   bool
+	coldClass string
+
+	mu     sync.Mutex
+	cursor string // Key after which the next MoveColdObjects scan resumes
+}
+
+// NewTieredStorage creates a tiered store. inPlace must be set when hot and
+// cold refer to the same bucket.
+func NewTieredStorage(hot, cold BlobStore, after time.Duration, inPlace bool) *TieredStorage {
+	t := &TieredStorage{
+		Hot:     hot,
+		Cold:    cold,
+		After:   after,
+		inPlace: inPlace,
+	}
+	if s3Cold, ok := cold.(*S3Storage); ok {
+		t.coldClass = s3Cold.StorageClass
+	}
+	logger.Info("STORAGE: Tiering enabled", "after", after, "in_place", inPlace, "storage_class", t.coldClass)
+	return t
+}
+
+func (t *TieredStorage) Put(key string, body io.Reader, size int64) error {
+	return t.Hot.Put(key, body, size)
+}
+
+func (t *TieredStorage) Get(key string) (io.ReadCloser, error) {
+	r, err := t.Hot.Get(key)
+	if err == nil || t.inPlace || !IsNotFound(err) {
+		return r, err
+	}
+	return t.Cold.Get(key)
+}
+
+func (t *TieredStorage) Exists(key string) (bool, string, error) {
+	exists, version, err := t.Hot.Exists(key)
+	if err != nil || exists || t.inPlace {
+		return exists, version, err
+	}
+	return t.Cold.Exists(key)
+}
+
+func (t *TieredStorage) Delete(key string) error {
+	if err := t.Hot.Delete(key); err != nil {
+		return err
+	}
+	if t.inPlace {
+		return nil
+	}
+	return t.Cold.Delete(key)
+}
+
+func (t *TieredStorage) DeleteBulk(keys []string) map[string]error {
+	errs := t.Hot.DeleteBulk(keys)
+	if t.inPlace {
+		return errs
+	}
+	for key, err := range t.Cold.DeleteBulk(keys) {
+		if errs == nil {
+			errs = make(map[string]error)
+		}
+		if _, ok := errs[key]; !ok {
+			errs[key] = err
+		}
+	}
+	return errs
+}
+
+// Copy copies within the hot tier. A source that has already been moved to
+// the cold tier is read from there and written to the hot tier.
+func (t *TieredStorage) Copy(sourcePath, destPath string) error {
+	err := t.Hot.Copy(sourcePath, destPath)
+	if err == nil || t.inPlace || !IsNotFound(err) {
+		return err
+	}
+
+	src, err := t.Cold.Get(sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to get source object for copy: %w", err)
+	}
+	defer src.Close()
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return fmt.Errorf("failed to read source object data: %w", err)
+	}
+	return t.Hot.Put(destPath, bytes.NewReader(data), int64(len(data)))
+}
+
+func (t *TieredStorage) ListObjects(ctx context.Context, prefix string, recursive bool) (<-chan S3Object, <-chan error) {
+	return t.ListObjectsAfter(ctx, prefix, "", recursive)
+}
+
+// ListObjectsAfter merges the listings of both tiers in key order. An object
+// present in both tiers (while it is being moved) is listed once.
+func (t *TieredStorage) ListObjectsAfter(ctx context.Context, prefix, startAfter string, recursive bool) (<-chan S3Object, <-chan error) {
+	if t.inPlace {
+		return t.Hot.ListObjectsAfter(ctx, prefix, startAfter, recursive)
+	}
+
+	objectCh := make(chan S3Object)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(objectCh)
+		defer close(errCh)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		hotObjs, hotErrs := t.Hot.ListObjectsAfter(ctx, prefix, startAfter, recursive)
+		coldObjs, coldErrs := t.Cold.ListObjectsAfter(ctx, prefix, startAfter, recursive)
+
+		hot, hotOK := <-hotObjs
+		cold, coldOK := <-coldObjs
+		for hotOK || coldOK {
+			var next S3Object
+			switch {
+			case hotOK && coldOK && hot.Key == cold.Key:
+				next = hot
+				hot, hotOK = <-hotObjs
+				cold, coldOK = <-coldObjs
+			case hotOK && (!coldOK || hot.Key < cold.Key):
+				next = hot
+				hot, hotOK = <-hotObjs
+			default:
+				next = cold
+				cold, coldOK = <-coldObjs
+			}
+
+			select {
+			case objectCh <- next:
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			}
+		}
+
+		if err := errors.Join(<-hotErrs, <-coldErrs); err != nil {
+			errCh <- err
+		}
+	}()
+
+	return objectCh, errCh
+}
+
+func (t *TieredStorage) Ping(ctx context.Context) error {
+	if err := t.Hot.Ping(ctx); err != nil {
+		return err
+	}
+	if t.inPlace {
+		return nil
+	}
+	if err := t.Cold.Ping(ctx); err != nil {
+		return fmt.Errorf("cold tier: %w", err)
+	}
+	return nil
+}
+
+// MoveColdObjects scans up to limit objects of the hot tier (0 for no limit)
+// and moves those older than After to the cold tier. Consecutive calls
+// continue where the previous scan stopped and wrap around at the end.
+// It returns the number of objects moved.
+func (t *TieredStorage) MoveColdObjects(ctx context.Context, limit int) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cutoff := time.Now().Add(-t.After)
+	objectCh, errCh := t.Hot.ListObjectsAfter(ctx, "", t.cursor, true)
+
+	moved, scanned := 0, 0
+	for obj := range objectCh {
+		scanned++
+		t.cursor = obj.Key
+
+		if obj.LastModified.Before(cutoff) && !(t.inPlace && obj.StorageClass == t.coldClass) {
+			if err := t.moveObject(obj.Key); err != nil {
+				if ctx.Err() != nil {
+					return moved, ctx.Err()
+				}
+				logger.Warn("STORAGE: Failed to move object to cold tier", "key", obj.Key, "error", err)
+			} else {
+				moved++
+			}
+		}
+
+		if limit > 0 && scanned >= limit {
+			return moved, nil
+		}
+	}
+	if err := <-errCh; err != nil {
+		return moved, fmt.Errorf("failed to list hot tier: %w", err)
+	}
+
+	// Reached the end of the hot tier; start over on the next call
+	t.cursor = ""
+	return moved, nil
+}
+
+// moveObject copies an object to the cold tier and then removes it from the
+// hot tier, so it is readable from at least one tier at all times.
+func (t *TieredStorage) moveObject(key string) error {
+	r, err := t.Hot.Get(key)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := t.Cold.Put(key, bytes.NewReader(data), int64(len(data))); err != nil {
+		return err
+	}
+	if t.inPlace {
+		return nil
+	}
+	return t.Hot.Delete(key)
+}
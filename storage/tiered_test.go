@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTiers(t *testing.T) (*FilesystemStorage, *FilesystemStorage, *TieredStorage) {
+	t.Helper()
+	hot, err := NewFilesystemStorage(t.TempDir())
+	require.NoError(t, err)
+	cold, err := NewFilesystemStorage(t.TempDir())
+	require.NoError(t, err)
+	return hot, cold, NewTieredStorage(hot, cold, 24*time.Hour, false)
+}
+
+func age(t *testing.T, s *FilesystemStorage, key string, d time.Duration) {
+	t.Helper()
+	old := time.Now().Add(-d)
+	require.NoError(t, os.Chtimes(filepath.Join(s.Root, filepath.FromSlash(key)), old, old))
+}
+
+func TestTieredStorage_MoveColdObjects(t *testing.T) {
+	hot, cold, tiered := newTestTiers(t)
+
+	putString(t, tiered, "example.com/alice/old", "old")
+	putString(t, tiered, "example.com/alice/new", "new")
+	age(t, hot, "example.com/alice/old", 48*time.Hour)
+
+	moved, err := tiered.MoveColdObjects(context.Background(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, moved)
+
+	exists, _, err := hot.Exists("example.com/alice/old")
+	require.NoError(t, err)
+	assert.False(t, exists, "moved object must be removed from the hot tier")
+	exists, _, err = cold.Exists("example.com/alice/old")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	// Reads are served from whichever tier holds the object
+	assert.Equal(t, "old", getString(t, tiered, "example.com/alice/old"))
+	assert.Equal(t, "new", getString(t, tiered, "example.com/alice/new"))
+	exists, _, err = tiered.Exists("example.com/alice/old")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	assert.Equal(t, []string{"example.com/alice/new", "example.com/alice/old"}, listKeys(t, tiered, "example.com/", "", true))
+
+	// Copying a cold object lands in the hot tier
+	require.NoError(t, tiered.Copy("example.com/alice/old", "example.com/bob/old"))
+	assert.Equal(t, "old", getString(t, hot, "example.com/bob/old"))
+
+	require.NoError(t, tiered.Delete("example.com/alice/old"))
+	exists, _, err = tiered.Exists("example.com/alice/old")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestTieredStorage_MoveColdObjectsResumes(t *testing.T) {
+	hot, _, tiered := newTestTiers(t)
+
+	keys := []string{"a/1", "a/2", "a/3"}
+	for _, key := range keys {
+		putString(t, tiered, key, key)
+		age(t, hot, key, 48*time.Hour)
+	}
+
+	// Each call scans at most two objects and continues where the last stopped
+	moved, err := tiered.MoveColdObjects(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, moved)
+	moved, err = tiered.MoveColdObjects(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, moved)
+
+	assert.Empty(t, listKeys(t, hot, "", "", true))
+	assert.Equal(t, keys, listKeys(t, tiered, "", "", true))
+}
+
+func TestTieredStorage_ListDeduplicates(t *testing.T) {
+	hot, cold, tiered := newTestTiers(t)
+
+	// An object that is mid-move exists in both tiers
+	putString(t, hot, "a/1", "x")
+	putString(t, cold, "a/1", "x")
+	putString(t, cold, "a/0", "x")
+	putString(t, hot, "a/2", "x")
+
+	assert.Equal(t, []string{"a/0", "a/1", "a/2"}, listKeys(t, tiered, "a/", "", true))
+	assert.Equal(t, []string{"a/2"}, listKeys(t, tiered, "a/", "a/1", true))
+}
@@ -0,0 +1,9 @@
+module github.com/emersion/go-imap/v2
+
+go 1.18
+
+require (
+	github.com/emersion/go-message v0.18.1
+	github.com/emersion/go-sasl v0.0.0-20231106173351-e73c9f7bad43
+	golang.org/x/text v0.14.0
+)
@@ -0,0 +1,181 @@
+package imapserver
+
+import (
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+func (c *Conn) handleGetACL(dec *imapwire.Decoder) error {
+	var mailbox string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return err
+	}
+
+	session, ok := c.session.(SessionACL)
+	if !ok {
+		return newClientBugError("ACL extension is not supported")
+	}
+
+	data, err := session.GetACL(mailbox)
+	if err != nil {
+		return err
+	}
+
+	return c.writeGetACL(data)
+}
+
+func (c *Conn) handleSetACL(dec *imapwire.Decoder) error {
+	var mailbox, identifierStr, rightsStr string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) ||
+		!dec.ExpectSP() || !dec.ExpectAString(&identifierStr) ||
+		!dec.ExpectSP() || !dec.ExpectAString(&rightsStr) ||
+		!dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return err
+	}
+
+	session, ok := c.session.(SessionACL)
+	if !ok {
+		return newClientBugError("ACL extension is not supported")
+	}
+
+	// Parse rights modification (+ or - prefix, or replace)
+	modification := imap.RightModificationReplace
+	rights := imap.RightSet(rightsStr)
+	if len(rightsStr) > 0 {
+		switch rightsStr[0] {
+		case '+':
+			modification = imap.RightModificationAdd
+			rights = imap.RightSet(rightsStr[1:])
+		case '-':
+			modification = imap.RightModificationRemove
+			rights = imap.RightSet(rightsStr[1:])
+		}
+	}
+
+	identifier := imap.RightsIdentifier(identifierStr)
+	return session.SetACL(mailbox, identifier, modification, rights)
+}
+
+func (c *Conn) handleDeleteACL(dec *imapwire.Decoder) error {
+	var mailbox, identifierStr string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) ||
+		!dec.ExpectSP() || !dec.ExpectAString(&identifierStr) ||
+		!dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return err
+	}
+
+	session, ok := c.session.(SessionACL)
+	if !ok {
+		return newClientBugError("ACL extension is not supported")
+	}
+
+	identifier := imap.RightsIdentifier(identifierStr)
+	return session.DeleteACL(mailbox, identifier)
+}
+
+func (c *Conn) handleListRights(dec *imapwire.Decoder) error {
+	var mailbox, identifierStr string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) ||
+		!dec.ExpectSP() || !dec.ExpectAString(&identifierStr) ||
+		!dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return err
+	}
+
+	session, ok := c.session.(SessionACL)
+	if !ok {
+		return newClientBugError("ACL extension is not supported")
+	}
+
+	identifier := imap.RightsIdentifier(identifierStr)
+	data, err := session.ListRights(mailbox, identifier)
+	if err != nil {
+		return err
+	}
+
+	return c.writeListRights(data)
+}
+
+func (c *Conn) handleMyRights(dec *imapwire.Decoder) error {
+	var mailbox string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return err
+	}
+
+	session, ok := c.session.(SessionACL)
+	if !ok {
+		return newClientBugError("ACL extension is not supported")
+	}
+
+	data, err := session.MyRights(mailbox)
+	if err != nil {
+		return err
+	}
+
+	return c.writeMyRights(data)
+}
+
+func (c *Conn) writeGetACL(data *imap.GetACLData) error {
+	enc := newResponseEncoder(c)
+	defer enc.end()
+
+	enc.Atom("*").SP().Atom("ACL").SP().Mailbox(data.Mailbox)
+	for i := range data.ACL {
+		entry := &data.ACL[i]
+		enc.SP().String(string(entry.Identifier)).SP().String(string(entry.Rights))
+	}
+	return enc.CRLF()
+}
+
+func (c *Conn) writeListRights(data *imap.ListRightsData) error {
+	enc := newResponseEncoder(c)
+	defer enc.end()
+
+	enc.Atom("*").SP().Atom("LISTRIGHTS").SP().
+		Mailbox(data.Mailbox).SP().
+		String(string(data.Identifier)).SP().
+		String(string(data.RequiredRights))
+
+	// Write optional rights groups
+	for i := range data.OptionalRights {
+		enc.SP().String(string(data.OptionalRights[i]))
+	}
+
+	return enc.CRLF()
+}
+
+func (c *Conn) writeMyRights(data *imap.MyRightsData) error {
+	enc := newResponseEncoder(c)
+	defer enc.end()
+
+	enc.Atom("*").SP().Atom("MYRIGHTS").SP().
+		Mailbox(data.Mailbox).SP().
+		String(string(data.Rights))
+
+	return enc.CRLF()
+}
+
+// For backwards compatibility, keep the old SETACL format helper
+func formatRights(rm imap.RightModification, rs imap.RightSet) string {
+	return internal.FormatRights(rm, rs)
+}
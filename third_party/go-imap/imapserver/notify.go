@@ -0,0 +1,183 @@
+package imapserver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+// notifyEvents maps upper-cased event names to their canonical spelling.
+var notifyEvents = map[string]imap.NotifyEvent{
+	"MESSAGENEW":            imap.NotifyEventMessageNew,
+	"MESSAGEEXPUNGE":        imap.NotifyEventMessageExpunge,
+	"FLAGCHANGE":            imap.NotifyEventFlagChange,
+	"ANNOTATIONCHANGE":      imap.NotifyEventAnnotationChange,
+	"MAILBOXNAME":           imap.NotifyEventMailboxName,
+	"SUBSCRIPTIONCHANGE":    imap.NotifyEventSubscriptionChange,
+	"MAILBOXMETADATACHANGE": imap.NotifyEventMailboxMetadataChange,
+	"SERVERMETADATACHANGE":  imap.NotifyEventServerMetadataChange,
+}
+
+func (c *Conn) handleNotify(dec *imapwire.Decoder) error {
+	options, err := readNotify(c, dec)
+	if err != nil {
+		return err
+	}
+
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return err
+	}
+
+	session, ok := c.session.(SessionNotify)
+	if !ok {
+		return newClientBugError("NOTIFY is not supported")
+	}
+
+	w := &UpdateWriter{conn: c, allowExpunge: true}
+	return session.Notify(w, options)
+}
+
+// readNotify parses the arguments of NOTIFY (RFC 5465 section 8). It returns
+// nil options for NOTIFY NONE.
+func readNotify(c *Conn, dec *imapwire.Decoder) (*imap.NotifyOptions, error) {
+	var op string
+	if !dec.ExpectSP() || !dec.ExpectAtom(&op) {
+		return nil, dec.Err()
+	}
+
+	switch strings.ToUpper(op) {
+	case "NONE":
+		if !dec.ExpectCRLF() {
+			return nil, dec.Err()
+		}
+		return nil, nil
+	case "SET":
+		// handled below
+	default:
+		return nil, newClientBugError(fmt.Sprintf("Unknown NOTIFY operation: %v", op))
+	}
+
+	var options imap.NotifyOptions
+	if !dec.ExpectSP() {
+		return nil, dec.Err()
+	}
+	var atom string
+	if dec.Atom(&atom) {
+		if !strings.EqualFold(atom, "STATUS") {
+			return nil, newClientBugError(fmt.Sprintf("Unknown NOTIFY SET option: %v", atom))
+		}
+		options.Status = true
+		if !dec.ExpectSP() {
+			return nil, dec.Err()
+		}
+	}
+
+	for {
+		var group imap.NotifyEventGroup
+		err := dec.ExpectList(func() error {
+			return readNotifyEventGroup(c, dec, &group)
+		})
+		if err != nil {
+			return nil, err
+		}
+		options.Groups = append(options.Groups, group)
+		if !dec.SP() {
+			break
+		}
+	}
+
+	if !dec.ExpectCRLF() {
+		return nil, dec.Err()
+	}
+	return &options, nil
+}
+
+// readNotifyEventGroup reads the contents of an event group:
+//
+//	filter-mailboxes SP events
+//
+// It is called by Decoder.List once per space-separated item, so the filter,
+// its mailboxes and the events are consumed on the first call.
+func readNotifyEventGroup(c *Conn, dec *imapwire.Decoder, group *imap.NotifyEventGroup) error {
+	if group.Filter != "" {
+		return newClientBugError("Unexpected NOTIFY event group item")
+	}
+
+	var filter string
+	if !dec.ExpectAtom(&filter) || !dec.ExpectSP() {
+		return dec.Err()
+	}
+	group.Filter = imap.NotifyFilter(strings.ToUpper(filter))
+
+	switch group.Filter {
+	case imap.NotifyFilterSubtree, imap.NotifyFilterMailboxes:
+		isList, err := dec.List(func() error {
+			var mailbox string
+			if !dec.ExpectMailbox(&mailbox) {
+				return dec.Err()
+			}
+			group.Mailboxes = append(group.Mailboxes, mailbox)
+			return nil
+		})
+		if err != nil {
+			return err
+		} else if !isList {
+			var mailbox string
+			if !dec.ExpectMailbox(&mailbox) {
+				return dec.Err()
+			}
+			group.Mailboxes = append(group.Mailboxes, mailbox)
+		}
+		if !dec.ExpectSP() {
+			return dec.Err()
+		}
+	}
+
+	isList, err := dec.List(func() error {
+		// The fetch-att list following MessageNew is parsed for validity
+		// but otherwise ignored: new messages are announced with EXISTS
+		var fetchOptions imap.FetchOptions
+		isFetchList, err := dec.List(func() error {
+			name, err := readFetchAttName(dec)
+			if err != nil {
+				return err
+			}
+			return handleFetchAtt(c, dec, name, &fetchOptions, &fetchWriterOptions{obsolete: make(map[*imap.FetchItemBodySection]string)})
+		})
+		if err != nil {
+			return err
+		} else if isFetchList {
+			if len(group.Events) == 0 || group.Events[len(group.Events)-1] != imap.NotifyEventMessageNew {
+				return newClientBugError("Fetch attributes are only allowed after MessageNew")
+			}
+			return nil
+		}
+
+		var name string
+		if !dec.ExpectAtom(&name) {
+			return dec.Err()
+		}
+		event, ok := notifyEvents[strings.ToUpper(name)]
+		if !ok {
+			// Unknown events are left to the session, which answers BADEVENT
+			event = imap.NotifyEvent(name)
+		}
+		group.Events = append(group.Events, event)
+		return nil
+	})
+	if err != nil {
+		return err
+	} else if !isList {
+		var none string
+		if !dec.ExpectAtom(&none) {
+			return dec.Err()
+		} else if !strings.EqualFold(none, "NONE") {
+			return newClientBugError("Expected NOTIFY events list or NONE")
+		}
+	} else if len(group.Events) == 0 {
+		return newClientBugError("NOTIFY events list must not be empty")
+	}
+	return nil
+}
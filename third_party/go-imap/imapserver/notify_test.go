@@ -0,0 +1,94 @@
+package imapserver
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+func TestReadNotify(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected *imap.NotifyOptions
+		wantErr  bool
+	}{
+		{
+			name:  "none",
+			input: " NONE\r\n",
+		},
+		{
+			// RFC 5465 section 6
+			name:  "set status",
+			input: " SET STATUS (selected (MessageNew (uid body.peek[header.fields (from to subject)]) MessageExpunge)) (subtree Lists (MessageNew MessageExpunge FlagChange)) (mailboxes (INBOX Sent) NONE)\r\n",
+			expected: &imap.NotifyOptions{
+				Status: true,
+				Groups: []imap.NotifyEventGroup{
+					{
+						Filter: imap.NotifyFilterSelected,
+						Events: []imap.NotifyEvent{imap.NotifyEventMessageNew, imap.NotifyEventMessageExpunge},
+					},
+					{
+						Filter:    imap.NotifyFilterSubtree,
+						Mailboxes: []string{"Lists"},
+						Events:    []imap.NotifyEvent{imap.NotifyEventMessageNew, imap.NotifyEventMessageExpunge, imap.NotifyEventFlagChange},
+					},
+					{
+						Filter:    imap.NotifyFilterMailboxes,
+						Mailboxes: []string{"INBOX", "Sent"},
+					},
+				},
+			},
+		},
+		{
+			name:  "unknown event",
+			input: " SET (personal (mailboxname FooChange))\r\n",
+			expected: &imap.NotifyOptions{
+				Groups: []imap.NotifyEventGroup{
+					{
+						Filter: imap.NotifyFilterPersonal,
+						Events: []imap.NotifyEvent{imap.NotifyEventMailboxName, "FooChange"},
+					},
+				},
+			},
+		},
+		{
+			name:    "empty events",
+			input:   " SET (personal ())\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "fetch attributes without MessageNew",
+			input:   " SET (selected (MessageExpunge (UID)))\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown operation",
+			input:   " GET\r\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := imapwire.NewDecoder(bufio.NewReader(strings.NewReader(tt.input)), imapwire.ConnSideServer)
+			options, err := readNotify(&Conn{}, dec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("readNotify() = %+v, want error", options)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readNotify() = %v", err)
+			}
+			if !reflect.DeepEqual(options, tt.expected) {
+				t.Errorf("readNotify() = %+v, want %+v", options, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package imapserver
+
+import (
+	"sort"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+func (c *Conn) handleGetQuota(dec *imapwire.Decoder) error {
+	var root string
+	if !dec.ExpectSP() || !dec.ExpectAString(&root) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	session, err := c.quotaSession()
+	if err != nil {
+		return err
+	}
+
+	data, err := session.GetQuota(root)
+	if err != nil {
+		return err
+	}
+
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	return writeQuota(enc.Encoder, data)
+}
+
+func (c *Conn) handleGetQuotaRoot(dec *imapwire.Decoder) error {
+	var mailbox string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	session, err := c.quotaSession()
+	if err != nil {
+		return err
+	}
+
+	roots, data, err := session.GetQuotaRoot(mailbox)
+	if err != nil {
+		return err
+	}
+
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	enc.Atom("*").SP().Atom("QUOTAROOT").SP().Mailbox(mailbox)
+	for _, root := range roots {
+		enc.SP().String(root)
+	}
+	if err := enc.CRLF(); err != nil {
+		return err
+	}
+	for i := range data {
+		if err := writeQuota(enc.Encoder, &data[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Conn) handleSetQuota(dec *imapwire.Decoder) error {
+	var root string
+	if !dec.ExpectSP() || !dec.ExpectAString(&root) || !dec.ExpectSP() {
+		return dec.Err()
+	}
+
+	limits := make(map[imap.QuotaResourceType]int64)
+	err := dec.ExpectList(func() error {
+		var (
+			name  string
+			limit int64
+		)
+		if !dec.ExpectAtom(&name) || !dec.ExpectSP() || !dec.ExpectNumber64(&limit) {
+			return dec.Err()
+		}
+		limits[imap.QuotaResourceType(name)] = limit
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	session, err := c.quotaSession()
+	if err != nil {
+		return err
+	}
+
+	return session.SetQuota(root, limits)
+}
+
+func (c *Conn) quotaSession() (SessionQuota, error) {
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return nil, err
+	}
+	session, ok := c.session.(SessionQuota)
+	if !ok {
+		return nil, newClientBugError("QUOTA is not supported")
+	}
+	return session, nil
+}
+
+// writeQuota writes a QUOTA response (RFC 9208 section 7.1). Resources are
+// sorted by name.
+func writeQuota(enc *imapwire.Encoder, data *imap.QuotaData) error {
+	resources := make([]imap.QuotaResourceType, 0, len(data.Resources))
+	for res := range data.Resources {
+		resources = append(resources, res)
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i] < resources[j] })
+
+	enc.Atom("*").SP().Atom("QUOTA").SP().String(data.Root).SP()
+	enc.List(len(resources), func(i int) {
+		res := data.Resources[resources[i]]
+		enc.Atom(string(resources[i])).SP().Number64(res.Usage).SP().Number64(res.Limit)
+	})
+	return enc.CRLF()
+}
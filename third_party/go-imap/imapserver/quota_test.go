@@ -0,0 +1,50 @@
+package imapserver
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+func TestWriteQuota(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     imap.QuotaData
+		expected string
+	}{
+		{
+			name:     "no resources",
+			data:     imap.QuotaData{Root: ""},
+			expected: "* QUOTA \"\" ()\r\n",
+		},
+		{
+			// RFC 9208 section 7.1
+			name: "sorted resources",
+			data: imap.QuotaData{
+				Root: "INBOX",
+				Resources: map[imap.QuotaResourceType]imap.QuotaResourceData{
+					imap.QuotaResourceStorage: {Usage: 10, Limit: 512},
+					imap.QuotaResourceMessage: {Usage: 3, Limit: 1000},
+				},
+			},
+			expected: "* QUOTA \"INBOX\" (MESSAGE 3 1000 STORAGE 10 512)\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			bw := bufio.NewWriter(&sb)
+			if err := writeQuota(imapwire.NewEncoder(bw, imapwire.ConnSideServer), &tt.data); err != nil {
+				t.Fatalf("writeQuota() = %v", err)
+			}
+			bw.Flush()
+			if sb.String() != tt.expected {
+				t.Errorf("writeQuota() wrote %q, want %q", sb.String(), tt.expected)
+			}
+		})
+	}
+}
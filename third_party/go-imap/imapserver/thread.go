@@ -0,0 +1,101 @@
+package imapserver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+func (c *Conn) handleThread(dec *imapwire.Decoder, numKind NumKind) error {
+	var algorithm, charset string
+	if !dec.ExpectSP() || !dec.ExpectAtom(&algorithm) || !dec.ExpectSP() || !dec.ExpectAString(&charset) || !dec.ExpectSP() {
+		return dec.Err()
+	}
+
+	var searchCriteria imap.SearchCriteria
+	for {
+		if err := readSearchKey(c, &searchCriteria, dec); err != nil {
+			return fmt.Errorf("in search-key: %w", err)
+		}
+		if !dec.SP() {
+			break
+		}
+	}
+
+	if !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	if err := c.checkState(imap.ConnStateSelected); err != nil {
+		return err
+	}
+
+	session, ok := c.session.(SessionThread)
+	if !ok {
+		return newClientBugError("THREAD is not supported")
+	}
+
+	alg := imap.ThreadAlgorithm(strings.ToUpper(algorithm))
+	if !c.availableCapsSet().Has(imap.Cap("THREAD=" + string(alg))) {
+		return &imap.Error{
+			Type: imap.StatusResponseTypeBad,
+			Text: fmt.Sprintf("Unsupported threading algorithm: %v", algorithm),
+		}
+	}
+
+	switch strings.ToUpper(charset) {
+	case "US-ASCII", "UTF-8":
+		// supported charsets
+	default:
+		return &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeBadCharset,
+			Text: "Only US-ASCII and UTF-8 are supported THREAD charsets",
+		}
+	}
+
+	threads, err := session.Thread(numKind, alg, charset, &searchCriteria)
+	if err != nil {
+		return err
+	}
+
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	return writeThread(enc.Encoder, threads, numKind)
+}
+
+func writeThread(enc *imapwire.Encoder, threads []imap.ThreadData, numKind NumKind) error {
+	enc.Atom("*").SP().Atom("THREAD")
+	if len(threads) > 0 {
+		enc.SP()
+	}
+	for _, thread := range threads {
+		writeThreadList(enc, &thread, numKind)
+	}
+	return enc.CRLF()
+}
+
+// writeThreadList writes a thread-list (RFC 5256 section 4). Nested lists
+// are not separated by spaces.
+func writeThreadList(enc *imapwire.Encoder, thread *imap.ThreadData, numKind NumKind) {
+	enc.Special('(')
+	for i, num := range thread.Chain {
+		if i > 0 {
+			enc.SP()
+		}
+		if numKind == NumKindUID {
+			enc.UID(imap.UID(num))
+		} else {
+			enc.Number(num)
+		}
+	}
+	if len(thread.Chain) > 0 && len(thread.SubThreads) > 0 {
+		enc.SP()
+	}
+	for i := range thread.SubThreads {
+		writeThreadList(enc, &thread.SubThreads[i], numKind)
+	}
+	enc.Special(')')
+}
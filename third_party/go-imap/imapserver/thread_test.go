@@ -0,0 +1,59 @@
+package imapserver
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+func TestWriteThread(t *testing.T) {
+	tests := []struct {
+		name     string
+		threads  []imap.ThreadData
+		expected string
+	}{
+		{
+			name:     "empty",
+			expected: "* THREAD\r\n",
+		},
+		{
+			// RFC 5256 section 4
+			name: "nested",
+			threads: []imap.ThreadData{
+				{Chain: []uint32{2}},
+				{Chain: []uint32{3, 6}, SubThreads: []imap.ThreadData{
+					{Chain: []uint32{4, 23}},
+					{Chain: []uint32{44, 7, 96}},
+				}},
+			},
+			expected: "* THREAD (2)(3 6 (4 23)(44 7 96))\r\n",
+		},
+		{
+			name: "missing root",
+			threads: []imap.ThreadData{
+				{SubThreads: []imap.ThreadData{
+					{Chain: []uint32{3}},
+					{Chain: []uint32{5}},
+				}},
+			},
+			expected: "* THREAD ((3)(5))\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			bw := bufio.NewWriter(&sb)
+			if err := writeThread(imapwire.NewEncoder(bw, imapwire.ConnSideServer), tt.threads, NumKindSeq); err != nil {
+				t.Fatalf("writeThread() = %v", err)
+			}
+			bw.Flush()
+			if sb.String() != tt.expected {
+				t.Errorf("writeThread() wrote %q, want %q", sb.String(), tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package imapserver
+
+import (
+	"fmt"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+// VanishedWriter writes VANISHED updates for QRESYNC-enabled connections.
+type VanishedWriter struct {
+	conn *Conn
+}
+
+// WriteVanished notifies the client that the messages with the provided UIDs
+// have been expunged. If earlier is true, this is a VANISHED (EARLIER) response.
+func (w *VanishedWriter) WriteVanished(uids imap.UIDSet, earlier bool) error {
+	if w.conn == nil {
+		return nil
+	}
+	if !w.conn.enabled.Has(imap.CapQResync) {
+		return fmt.Errorf("imapserver: VANISHED responses require QRESYNC to be enabled")
+	}
+	return w.conn.writeVanished(uids, earlier)
+}
+
+// WriteVanished writes a VANISHED response instead of EXPUNGE responses. It
+// can only be used once QRESYNC has been enabled.
+func (w *ExpungeWriter) WriteVanished(uids imap.UIDSet) error {
+	vw := &VanishedWriter{conn: w.conn}
+	return vw.WriteVanished(uids, false)
+}
+
+// WriteVanished writes a VANISHED response. Without earlier, it is subject to
+// the same restrictions as EXPUNGE updates.
+func (w *UpdateWriter) WriteVanished(uids imap.UIDSet, earlier bool) error {
+	if !earlier && !w.allowExpunge {
+		return fmt.Errorf("imapserver: VANISHED updates are not allowed in this context")
+	}
+	vw := &VanishedWriter{conn: w.conn}
+	return vw.WriteVanished(uids, earlier)
+}
+
+// WriteVanished writes the VANISHED (EARLIER) response of a UID FETCH with
+// the VANISHED modifier. It must be called before any message is written.
+func (w *FetchWriter) WriteVanished(uids imap.UIDSet) error {
+	vw := &VanishedWriter{conn: w.conn}
+	return vw.WriteVanished(uids, true)
+}
+
+func (c *Conn) writeVanished(uids imap.UIDSet, earlier bool) error {
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	return writeVanished(enc.Encoder, uids, earlier)
+}
+
+func writeVanished(enc *imapwire.Encoder, uids imap.UIDSet, earlier bool) error {
+	enc.Atom("*").SP().Atom("VANISHED")
+	if earlier {
+		enc.SP().Special('(').Atom("EARLIER").Special(')')
+	}
+	enc.SP().NumSet(uids)
+	return enc.CRLF()
+}
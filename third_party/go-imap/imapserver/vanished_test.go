@@ -0,0 +1,59 @@
+package imapserver
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+func TestWriteVanished(t *testing.T) {
+	tests := []struct {
+		name     string
+		uids     imap.UIDSet
+		earlier  bool
+		expected string
+	}{
+		{
+			name:     "expunge",
+			uids:     imap.UIDSetNum(3),
+			expected: "* VANISHED 3\r\n",
+		},
+		{
+			name:     "earlier",
+			uids:     imap.UIDSet{imap.UIDRange{Start: 1, Stop: 4}, imap.UIDRange{Start: 7, Stop: 7}},
+			earlier:  true,
+			expected: "* VANISHED (EARLIER) 1:4,7\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			bw := bufio.NewWriter(&sb)
+			if err := writeVanished(imapwire.NewEncoder(bw, imapwire.ConnSideServer), tt.uids, tt.earlier); err != nil {
+				t.Fatalf("writeVanished() = %v", err)
+			}
+			bw.Flush()
+			if sb.String() != tt.expected {
+				t.Errorf("writeVanished() wrote %q, want %q", sb.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestWriteVanishedRequiresQResync(t *testing.T) {
+	conn := &Conn{enabled: make(imap.CapSet)}
+
+	w := &UpdateWriter{conn: conn, allowExpunge: true}
+	if err := w.WriteVanished(imap.UIDSetNum(1), false); err == nil {
+		t.Error("WriteVanished() without QRESYNC enabled should fail")
+	}
+
+	w = &UpdateWriter{conn: conn}
+	if err := w.WriteVanished(imap.UIDSetNum(1), false); err == nil {
+		t.Error("WriteVanished() should fail where EXPUNGE updates are not allowed")
+	}
+}
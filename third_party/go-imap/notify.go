@@ -0,0 +1,57 @@
+package imap
+
+// NotifyFilter selects the mailboxes a NOTIFY event group applies to.
+type NotifyFilter string
+
+const (
+	NotifyFilterSelected        NotifyFilter = "SELECTED"
+	NotifyFilterSelectedDelayed NotifyFilter = "SELECTED-DELAYED"
+	NotifyFilterInboxes         NotifyFilter = "INBOXES"
+	NotifyFilterPersonal        NotifyFilter = "PERSONAL"
+	NotifyFilterSubscribed      NotifyFilter = "SUBSCRIBED"
+	NotifyFilterSubtree         NotifyFilter = "SUBTREE"
+	NotifyFilterMailboxes       NotifyFilter = "MAILBOXES"
+)
+
+// NotifyEvent is an event a client can ask to be notified about.
+type NotifyEvent string
+
+const (
+	NotifyEventMessageNew            NotifyEvent = "MessageNew"
+	NotifyEventMessageExpunge        NotifyEvent = "MessageExpunge"
+	NotifyEventFlagChange            NotifyEvent = "FlagChange"
+	NotifyEventAnnotationChange      NotifyEvent = "AnnotationChange"
+	NotifyEventMailboxName           NotifyEvent = "MailboxName"
+	NotifyEventSubscriptionChange    NotifyEvent = "SubscriptionChange"
+	NotifyEventMailboxMetadataChange NotifyEvent = "MailboxMetadataChange"
+	NotifyEventServerMetadataChange  NotifyEvent = "ServerMetadataChange"
+)
+
+// NotifyEventGroup is one "(filter events)" group of NOTIFY SET.
+//
+// Mailboxes is used by the SUBTREE and MAILBOXES filters. An empty Events
+// list stands for NONE.
+type NotifyEventGroup struct {
+	Filter    NotifyFilter
+	Mailboxes []string
+	Events    []NotifyEvent
+}
+
+// Has reports whether the group contains an event.
+func (g *NotifyEventGroup) Has(event NotifyEvent) bool {
+	for _, e := range g.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// NotifyOptions contains options for the NOTIFY SET command.
+//
+// Status is set by the STATUS indicator, which asks for the current STATUS of
+// all watched mailboxes.
+type NotifyOptions struct {
+	Status bool
+	Groups []NotifyEventGroup
+}
@@ -0,0 +1,25 @@
+package imap
+
+// QuotaResourceType is a QUOTA resource type.
+//
+// See RFC 9208 section 5.
+type QuotaResourceType string
+
+const (
+	QuotaResourceStorage           QuotaResourceType = "STORAGE"
+	QuotaResourceMessage           QuotaResourceType = "MESSAGE"
+	QuotaResourceMailbox           QuotaResourceType = "MAILBOX"
+	QuotaResourceAnnotationStorage QuotaResourceType = "ANNOTATION-STORAGE"
+)
+
+// QuotaData is the data returned by a QUOTA response.
+type QuotaData struct {
+	Root      string
+	Resources map[QuotaResourceType]QuotaResourceData
+}
+
+// QuotaResourceData contains the usage and limit for a quota resource.
+type QuotaResourceData struct {
+	Usage int64
+	Limit int64
+}
@@ -0,0 +1,19 @@
+package imap
+
+// ThreadAlgorithm is a threading algorithm.
+type ThreadAlgorithm string
+
+const (
+	ThreadOrderedSubject ThreadAlgorithm = "ORDEREDSUBJECT"
+	ThreadReferences     ThreadAlgorithm = "REFERENCES"
+)
+
+// ThreadData is a thread returned by the THREAD command.
+//
+// Chain holds the messages that follow each other without branching,
+// SubThreads the branches below the last of them. Chain is empty when the
+// root of the thread is a missing message that only links its children.
+type ThreadData struct {
+	Chain      []uint32
+	SubThreads []ThreadData
+}